@@ -41,6 +41,22 @@ func AggregateSignatures(signatures []*Signature) (*Signature, error) {
 	return &Signature{flowSignature: aggregateFlowSignature}, nil
 }
 
+// AggregatePublicKeys takes in an input slice of bls.PublicKeys and aggregates them into a single
+// bls.PublicKey. Verifying a signature on a single payload against the aggregated bls.PublicKey is
+// equivalent to calling VerifyAggregateSignatureSinglePayload with the input slice, so the aggregated
+// bls.PublicKey can be reused to verify many signatures from the same set of signers.
+func AggregatePublicKeys(publicKeys []*PublicKey) (*PublicKey, error) {
+	flowPublicKeys, err := extractFlowPublicKeys(publicKeys)
+	if err != nil {
+		return nil, err
+	}
+	aggregateFlowPublicKey, err := flowCrypto.AggregateBLSPublicKeys(flowPublicKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{flowPublicKey: aggregateFlowPublicKey, flowPublicKeyBytes: aggregateFlowPublicKey.Encode()}, nil
+}
+
 // VerifyAggregateSignatureSinglePayload takes in a slice of bls.PublicKeys, a bls.Signature, and a single payload and returns
 // true if every bls.PublicKey in the slice signed the payload. The input bls.Signature is the aggregate
 // signature of each of their respective bls.Signatures for that payload.
@@ -73,6 +89,47 @@ func VerifyAggregateSignatureMultiplePayloads(publicKeys []*PublicKey, signature
 	return flowCrypto.VerifyBLSSignatureManyMessages(flowPublicKeys, signature.flowSignature, payloadsBytes, hashingAlgorithms)
 }
 
+// VerifyAggregateSignatureSingleHashedPayload is the same as VerifyAggregateSignatureSinglePayload, except that the
+// payload's domain-separated hash is taken from the bls.HashedPayload instead of being recomputed.
+func VerifyAggregateSignatureSingleHashedPayload(publicKeys []*PublicKey, signature *Signature, hashedPayload *HashedPayload) (bool, error) {
+	if hashedPayload == nil {
+		return false, errors.New("bls.HashedPayload is nil")
+	}
+	flowPublicKeys, err := extractFlowPublicKeys(publicKeys)
+	if err != nil {
+		return false, err
+	}
+	return flowCrypto.VerifyBLSSignatureOneMessage(
+		flowPublicKeys, signature.flowSignature, hashedPayload.payloadBytes, hashedPayload.hasher(),
+	)
+}
+
+// VerifyAggregateSignatureMultipleHashedPayloads is the same as VerifyAggregateSignatureMultiplePayloads, except that
+// the payloads' domain-separated hashes are taken from the bls.HashedPayloads instead of being recomputed. Signers
+// that signed the same payload can share a bls.HashedPayload, so that it's only hashed once.
+func VerifyAggregateSignatureMultipleHashedPayloads(publicKeys []*PublicKey, signature *Signature, hashedPayloads []*HashedPayload) (bool, error) {
+	if len(publicKeys) != len(hashedPayloads) {
+		return false, fmt.Errorf("number of public keys %d does not equal number of payloads %d", len(publicKeys), len(hashedPayloads))
+	}
+
+	flowPublicKeys, err := extractFlowPublicKeys(publicKeys)
+	if err != nil {
+		return false, err
+	}
+
+	var payloadsBytes [][]byte
+	var hashingAlgorithms []hash.Hasher
+	for _, hashedPayload := range hashedPayloads {
+		if hashedPayload == nil {
+			return false, errors.New("bls.HashedPayload is nil")
+		}
+		payloadsBytes = append(payloadsBytes, hashedPayload.payloadBytes)
+		hashingAlgorithms = append(hashingAlgorithms, hashedPayload.hasher())
+	}
+
+	return flowCrypto.VerifyBLSSignatureManyMessages(flowPublicKeys, signature.flowSignature, payloadsBytes, hashingAlgorithms)
+}
+
 //
 // TYPES: PrivateKey
 //
@@ -207,6 +264,21 @@ func (publicKey *PublicKey) Verify(signature *Signature, input []byte) (bool, er
 	return publicKey.flowPublicKey.Verify(signature.flowSignature, input, hashingAlgorithm)
 }
 
+// VerifyHashedPayload is the same as Verify, except that the payload's domain-separated hash is taken from the
+// bls.HashedPayload instead of being recomputed.
+func (publicKey *PublicKey) VerifyHashedPayload(signature *Signature, hashedPayload *HashedPayload) (bool, error) {
+	if publicKey == nil || len(publicKey.flowPublicKeyBytes) == 0 {
+		return false, errors.New("bls.PublicKey is nil")
+	}
+	if hashedPayload == nil {
+		return false, errors.New("bls.HashedPayload is nil")
+	}
+	if publicKey.loadFlowPublicKey() != nil {
+		return false, errors.New("failed to load flowPublicKey")
+	}
+	return publicKey.flowPublicKey.Verify(signature.flowSignature, hashedPayload.payloadBytes, hashedPayload.hasher())
+}
+
 func (publicKey *PublicKey) ToBytes() []byte {
 	return publicKey.flowPublicKeyBytes
 }
@@ -398,6 +470,65 @@ func (signature *Signature) IsEmpty() bool {
 	return signature == nil || signature.flowSignature == nil
 }
 
+//
+// TYPES: HashedPayload
+//
+
+// HashedPayload is a payload along with its hash under the domain separation tag of hashingAlgorithm. Signing and
+// verifying a signature both start by hashing the payload this way, so a payload that many signatures are verified
+// on, like the payload of a QC, can be hashed once and verified against as a HashedPayload.
+type HashedPayload struct {
+	payloadBytes []byte
+	payloadHash  hash.Hash
+}
+
+func NewHashedPayload(payloadBytes []byte) *HashedPayload {
+	return &HashedPayload{
+		payloadBytes: bytes.Clone(payloadBytes),
+		payloadHash:  hashingAlgorithm.ComputeHash(payloadBytes),
+	}
+}
+
+func (hashedPayload *HashedPayload) GetPayloadBytes() []byte {
+	return hashedPayload.payloadBytes
+}
+
+func (hashedPayload *HashedPayload) hasher() hash.Hasher {
+	return &hashedPayloadHasher{hashedPayload: hashedPayload}
+}
+
+// hashedPayloadHasher is the hash.Hasher that flowCrypto is given to verify a signature on a HashedPayload. flowCrypto
+// hashes the payload with the hasher it's given, so it gets the precomputed hash back. Any other data is hashed with
+// hashingAlgorithm. Only ComputeHash is used by flowCrypto, so the hasher doesn't support being written to.
+type hashedPayloadHasher struct {
+	hashedPayload *HashedPayload
+}
+
+func (hasher *hashedPayloadHasher) Algorithm() hash.HashingAlgorithm {
+	return hashingAlgorithm.Algorithm()
+}
+
+func (hasher *hashedPayloadHasher) Size() int {
+	return hashingAlgorithm.Size()
+}
+
+func (hasher *hashedPayloadHasher) ComputeHash(data []byte) hash.Hash {
+	if bytes.Equal(data, hasher.hashedPayload.payloadBytes) {
+		return hasher.hashedPayload.payloadHash
+	}
+	return hashingAlgorithm.ComputeHash(data)
+}
+
+func (hasher *hashedPayloadHasher) Write(_ []byte) (int, error) {
+	return 0, errors.New("bls.hashedPayloadHasher can't be written to")
+}
+
+func (hasher *hashedPayloadHasher) SumHash() hash.Hash {
+	return hasher.hashedPayload.payloadHash
+}
+
+func (hasher *hashedPayloadHasher) Reset() {}
+
 func extractFlowPublicKeys(publicKeys []*PublicKey) ([]flowCrypto.PublicKey, error) {
 	flowPublicKeys := make([]flowCrypto.PublicKey, len(publicKeys))
 	for i, publicKey := range publicKeys {
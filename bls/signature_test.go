@@ -94,6 +94,27 @@ func TestVerifyingBLSSignatures(t *testing.T) {
 	)
 	require.Error(t, err)
 
+	// Test AggregatePublicKeys().
+	// 1. Verify the AggregateSignature against the aggregated public key.
+	aggregatePublicKey, err := AggregatePublicKeys([]*PublicKey{blsPublicKey1, blsPublicKey2})
+	require.NoError(t, err)
+	isVerified, err = aggregatePublicKey.Verify(aggregateSignature, randomPayload3)
+	require.NoError(t, err)
+	require.True(t, isVerified)
+	// 2. Verify the AggregateSignature doesn't work on a different payload.
+	isVerified, err = aggregatePublicKey.Verify(aggregateSignature, randomPayload1)
+	require.NoError(t, err)
+	require.False(t, isVerified)
+	// 3. Verify the aggregated public key survives a round trip through bytes.
+	decodedAggregatePublicKey, err := (&PublicKey{}).FromBytes(aggregatePublicKey.ToBytes())
+	require.NoError(t, err)
+	isVerified, err = decodedAggregatePublicKey.Verify(aggregateSignature, randomPayload3)
+	require.NoError(t, err)
+	require.True(t, isVerified)
+	// 4. Aggregating a malformed public key fails.
+	_, err = AggregatePublicKeys([]*PublicKey{blsPublicKey1, malformedBlsPublicKey})
+	require.Error(t, err)
+
 	// Test AggregateSignatures() and VerifyMultiPayloadAggregateSignature() on different payloads.
 	// 1. PrivateKey1 signs a random payload.
 	randomPayload4 := _generateRandomBytes(t, 256)
@@ -330,6 +351,93 @@ func TestVerifyingBLSSignatures(t *testing.T) {
 	require.True(t, (&Signature{}).IsEmpty())
 }
 
+func TestVerifyingBLSSignaturesOnHashedPayloads(t *testing.T) {
+	blsPrivateKey1 := _generateRandomBLSPrivateKey(t)
+	blsPublicKey1 := blsPrivateKey1.PublicKey()
+	blsPrivateKey2 := _generateRandomBLSPrivateKey(t)
+	blsPublicKey2 := blsPrivateKey2.PublicKey()
+
+	// Test NewHashedPayload().
+	// 1. The payload is hashed with the domain-separated hashingAlgorithm.
+	randomPayload1 := _generateRandomBytes(t, 256)
+	hashedPayload1 := NewHashedPayload(randomPayload1)
+	require.Equal(t, randomPayload1, hashedPayload1.GetPayloadBytes())
+	require.True(t, hashingAlgorithm.ComputeHash(randomPayload1).Equal(hashedPayload1.payloadHash))
+	// 2. The HashedPayload doesn't change if the payload it was created from does.
+	randomPayload1Copy := bytes.Clone(randomPayload1)
+	randomPayload1[0] ^= 0xff
+	require.Equal(t, randomPayload1Copy, hashedPayload1.GetPayloadBytes())
+	randomPayload1 = randomPayload1Copy
+
+	// Test bls.PublicKey.VerifyHashedPayload().
+	// 1. Verify bls.PublicKey1 is the signer.
+	blsSignature1, err := blsPrivateKey1.Sign(randomPayload1)
+	require.NoError(t, err)
+	isVerified, err := blsPublicKey1.VerifyHashedPayload(blsSignature1, hashedPayload1)
+	require.NoError(t, err)
+	require.True(t, isVerified)
+	// 2. Verify bls.PublicKey2 is not the signer.
+	isVerified, err = blsPublicKey2.VerifyHashedPayload(blsSignature1, hashedPayload1)
+	require.NoError(t, err)
+	require.False(t, isVerified)
+	// 3. Verify the signature doesn't verify against a different HashedPayload.
+	randomPayload2 := _generateRandomBytes(t, 256)
+	hashedPayload2 := NewHashedPayload(randomPayload2)
+	isVerified, err = blsPublicKey1.VerifyHashedPayload(blsSignature1, hashedPayload2)
+	require.NoError(t, err)
+	require.False(t, isVerified)
+	// 4. Verify a nil HashedPayload errors.
+	_, err = blsPublicKey1.VerifyHashedPayload(blsSignature1, nil)
+	require.Error(t, err)
+
+	// Test VerifyAggregateSignatureSingleHashedPayload().
+	blsSignature2, err := blsPrivateKey2.Sign(randomPayload1)
+	require.NoError(t, err)
+	aggregateSignature, err := AggregateSignatures([]*Signature{blsSignature1, blsSignature2})
+	require.NoError(t, err)
+	// 1. Verify the AggregateSignature is signed by both public keys.
+	isVerified, err = VerifyAggregateSignatureSingleHashedPayload(
+		[]*PublicKey{blsPublicKey1, blsPublicKey2}, aggregateSignature, hashedPayload1,
+	)
+	require.NoError(t, err)
+	require.True(t, isVerified)
+	// 2. Verify the AggregateSignature doesn't verify against a different HashedPayload.
+	isVerified, err = VerifyAggregateSignatureSingleHashedPayload(
+		[]*PublicKey{blsPublicKey1, blsPublicKey2}, aggregateSignature, hashedPayload2,
+	)
+	require.NoError(t, err)
+	require.False(t, isVerified)
+
+	// Test VerifyAggregateSignatureMultipleHashedPayloads().
+	// 1. PublicKey1 signs payload 1 and PublicKey2 signs payload 2.
+	blsSignature3, err := blsPrivateKey2.Sign(randomPayload2)
+	require.NoError(t, err)
+	aggregateSignature, err = AggregateSignatures([]*Signature{blsSignature1, blsSignature3})
+	require.NoError(t, err)
+	isVerified, err = VerifyAggregateSignatureMultipleHashedPayloads(
+		[]*PublicKey{blsPublicKey1, blsPublicKey2}, aggregateSignature, []*HashedPayload{hashedPayload1, hashedPayload2},
+	)
+	require.NoError(t, err)
+	require.True(t, isVerified)
+	// 2. The result matches VerifyAggregateSignatureMultiplePayloads().
+	isVerified, err = VerifyAggregateSignatureMultiplePayloads(
+		[]*PublicKey{blsPublicKey1, blsPublicKey2}, aggregateSignature, [][]byte{randomPayload1, randomPayload2},
+	)
+	require.NoError(t, err)
+	require.True(t, isVerified)
+	// 3. Verify the AggregateSignature doesn't verify with the payloads swapped.
+	isVerified, err = VerifyAggregateSignatureMultipleHashedPayloads(
+		[]*PublicKey{blsPublicKey1, blsPublicKey2}, aggregateSignature, []*HashedPayload{hashedPayload2, hashedPayload1},
+	)
+	require.NoError(t, err)
+	require.False(t, isVerified)
+	// 4. Verify a mismatched number of public keys and payloads errors.
+	_, err = VerifyAggregateSignatureMultipleHashedPayloads(
+		[]*PublicKey{blsPublicKey1, blsPublicKey2}, aggregateSignature, []*HashedPayload{hashedPayload1},
+	)
+	require.Error(t, err)
+}
+
 func TestJsonMarshalingBLSKeys(t *testing.T) {
 	// Generate random BLS PrivateKey, PublicKey, and Signature.
 	privateKey := _generateRandomBLSPrivateKey(t)
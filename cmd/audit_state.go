@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"path/filepath"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var auditStateCmd = &cobra.Command{
+	Use:   "audit-state",
+	Short: "Check the node's state for dangling references",
+	Long: `Scans the state of a stopped node for entries that reference entries that don't exist, such as NFTs
+whose post is missing or coin balances whose creator has no profile, and logs them. The audit runs in
+batches and logs a cursor after each one, which can be passed to --cursor to resume an interrupted audit.
+With --repair, the dangling entries that can't be valid on their own are deleted.`,
+	Run: AuditState,
+}
+
+// auditStateBatchSize is the number of entries that are scanned, and at most repaired, in a single run of the
+// StateAuditor.
+const auditStateBatchSize = 10000
+
+func init() {
+	auditStateCmd.Flags().Bool("testnet", false, "Audit the state of a DeSo testnet node")
+	auditStateCmd.Flags().String("data-dir", "",
+		"The data directory of the node. When unset, defaults to the system's configuration directory.")
+	auditStateCmd.Flags().String("state-dir", "", "The --state-dir the node was run with, if any.")
+	auditStateCmd.Flags().String("data-encryption-key-file", "",
+		"The key file the node was run with in --data-encryption-key-file, if its data directory is encrypted.")
+	auditStateCmd.Flags().Bool("repair", false, "Delete the dangling entries that can't be valid on their own.")
+	auditStateCmd.Flags().String("cursor", "", "The cursor logged by a previous audit to resume from.")
+	auditStateCmd.Flags().Uint64("max-entries", 0,
+		"The number of entries to scan before stopping. When unset, scans the entire state.")
+	rootCmd.AddCommand(auditStateCmd)
+}
+
+func AuditState(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	params := &lib.DeSoMainnetParams
+	if testnet, _ := flags.GetBool("testnet"); testnet {
+		params = &lib.DeSoTestnetParams
+	}
+	dataDir, _ := flags.GetString("data-dir")
+	if dataDir == "" {
+		dataDir = lib.GetDataDir(params)
+	}
+	dataDir = filepath.Join(dataDir, lib.DBVersionString)
+	if stateDir, _ := flags.GetString("state-dir"); stateDir != "" {
+		dataDir = filepath.Join(stateDir, lib.DBVersionString)
+	}
+	repair, _ := flags.GetBool("repair")
+	maxEntries, _ := flags.GetUint64("max-entries")
+
+	var cursor *lib.StateAuditCursor
+	if cursorHex, _ := flags.GetString("cursor"); cursorHex != "" {
+		cursorBytes, err := hex.DecodeString(cursorHex)
+		if err != nil {
+			glog.Fatalf("AuditState: Problem decoding --cursor: %v", err)
+		}
+		cursor = &lib.StateAuditCursor{}
+		if err = cursor.FromBytes(cursorBytes); err != nil {
+			glog.Fatalf("AuditState: %v", err)
+		}
+	}
+
+	if keyFile, _ := flags.GetString("data-encryption-key-file"); keyFile != "" {
+		if err := lib.LoadDataEncryptionKey(lib.NewDataEncryptionKeyFileProvider(keyFile)); err != nil {
+			glog.Fatalf("AuditState: %v", err)
+		}
+	}
+
+	dbDir := lib.GetBadgerDbPath(dataDir)
+	opts := lib.PerformanceBadgerOptions(dbDir)
+	opts.ValueDir = dbDir
+	db, err := badger.Open(opts)
+	if err != nil {
+		glog.Fatalf("AuditState: Problem opening DB %v: %v", dbDir, err)
+	}
+	defer db.Close()
+
+	auditor := lib.NewStateAuditor(db, repair)
+	numEntriesScanned := uint64(0)
+	numFindings := 0
+	numEntriesRepaired := uint64(0)
+	for {
+		batchSize := uint64(auditStateBatchSize)
+		if maxEntries > 0 && maxEntries-numEntriesScanned < batchSize {
+			batchSize = maxEntries - numEntriesScanned
+		}
+		report, err := auditor.Run(cursor, batchSize)
+		if err != nil {
+			glog.Fatalf("AuditState: %v", err)
+		}
+		for _, finding := range report.Findings {
+			glog.Infof("AuditState: %v: %v (key: %x, repaired: %v)",
+				finding.Check, finding.Description, finding.Key, finding.Repaired)
+		}
+		numEntriesScanned += report.NumEntriesScanned
+		numFindings += len(report.Findings)
+		numEntriesRepaired += report.NumEntriesRepaired
+		cursor = report.Cursor
+		if cursor == nil {
+			break
+		}
+		glog.Infof("AuditState: Scanned %d entries, resume with --cursor=%x", numEntriesScanned, cursor.ToBytes())
+		if maxEntries > 0 && numEntriesScanned >= maxEntries {
+			break
+		}
+	}
+	if cursor == nil {
+		glog.Infof("AuditState: Audit complete")
+	}
+	glog.Infof("AuditState: Scanned %d entries, found %d dangling entries, repaired %d",
+		numEntriesScanned, numFindings, numEntriesRepaired)
+}
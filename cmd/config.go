@@ -20,13 +20,32 @@ type Config struct {
 	Regtest              bool
 	RegtestAccelerated   bool
 	PostgresURI          string
+	BlockSegmentStore    bool
+	BlockArchiveSource   string
+
+	// BlocksDirectory and StateDirectory are where the block segment store and the chain DB are stored. They
+	// default to the DataDirectory. AncestralRecordsDirectory is only set when the snapshot's ancestral records
+	// are stored in a DB of their own rather than in the chain DB.
+	BlocksDirectory           string
+	StateDirectory            string
+	AncestralRecordsDirectory string
+
+	// DBIntegrityCheck checks the chain DB for damage on startup, see lib.CheckDBIntegrity. With
+	// DBIntegrityCheckStrict, the node refuses to start if the check finds errors.
+	DBIntegrityCheck       bool
+	DBIntegrityCheckStrict bool
+
+	// DataEncryptionKeyFile and DataEncryptionKeyCommand supply the key the node's DBs are encrypted with, if any.
+	DataEncryptionKeyFile    string
+	DataEncryptionKeyCommand string
 
 	// Peers
-	ConnectIPs          []string
-	AddIPs              []string
-	AddSeeds            []string
-	TargetOutboundPeers uint32
-	StallTimeoutSeconds uint64
+	ConnectIPs               []string
+	AddIPs                   []string
+	AddSeeds                 []string
+	TargetOutboundPeers      uint32
+	StallTimeoutSeconds      uint64
+	BlockStallTimeoutSeconds uint64
 
 	// Peer Restrictions
 	PrivateMode       bool
@@ -36,25 +55,81 @@ type Config struct {
 	MaxInboundPeers   uint32
 	OneInboundPerIp   bool
 
+	// PeerRequestRateLimits overrides the budgets of the requests each peer can send.
+	PeerRequestRateLimits string
+
+	// TxnReconciliationIntervalMillis is how often transactions are reconciled with outbound peers.
+	TxnReconciliationIntervalMillis uint64
+
+	// CompactBlockRelay announces new blocks with compact blocks to the peers that support them.
+	CompactBlockRelay bool
+
+	// FeeTelemetryIntervalSeconds is how often a summary of the mempool's fees is shared with peers.
+	FeeTelemetryIntervalSeconds uint64
+
+	// TxnMessageWorkers is the number of workers that process transaction relay messages from peers.
+	TxnMessageWorkers uint64
+
+	// Proxy
+	Proxy       string
+	ProxyUser   string
+	ProxyPass   string
+	OnionProxy  string
+	PeerProxies []string
+
 	// NetworkingManager config
 	PeerConnectionRefreshIntervalMillis uint64
 
 	// Snapshot
-	HyperSync                 bool
-	ForceChecksum             bool
-	SyncType                  lib.NodeSyncType
-	MaxSyncBlockHeight        uint32
-	SnapshotBlockHeightPeriod uint64
-	DisableEncoderMigrations  bool
-	HypersyncMaxQueueSize     uint32
+	HyperSync                  bool
+	ForceChecksum              bool
+	SyncType                   lib.NodeSyncType
+	MaxSyncBlockHeight         uint32
+	SnapshotBlockHeightPeriod  uint64
+	DisableEncoderMigrations   bool
+	HypersyncMaxQueueSize      uint32
+	HypersyncChunkApplyWorkers uint32
+
+	// ContinuousChecksum keeps the state checksum up to date on every flush and records it for every block.
+	ContinuousChecksum bool
+
+	// TrustedSnapshotSignerPublicKeys are the BLS public keys whose signed state roots we accept
+	// when hypersyncing in the v2 snapshot format. If empty, we hypersync in the v1 format.
+	TrustedSnapshotSignerPublicKeys []string
+
+	// StateCommitment enables the Merkle trie state commitment, which produces a state root per block.
+	StateCommitment bool
+
+	// StateCacheMaxBytes is the size of the in-memory cache of hot state entries, or zero to disable it.
+	StateCacheMaxBytes uint64
+
+	// UndoDataRetentionBlocks is the number of final blocks whose UtxoOperations are kept. ArchivalUndoData keeps
+	// the UtxoOperations of every block instead.
+	UndoDataRetentionBlocks uint64
+	ArchivalUndoData        bool
 
 	// PoS Validator
-	PosValidatorSeed string
+	PosValidatorSeed                         string
+	PosValidatorAllowNewSlashingProtectionDB bool
+	// PosValidatorSlashingProtectionDirectory is where the slashing protection database is stored, if it's not in
+	// the data directory. A validator and its standby must share it.
+	PosValidatorSlashingProtectionDirectory   string
+	PosValidatorStandby                       bool
+	PosValidatorStandbyTakeoverTimeoutSeconds uint64
 
 	// Mempool
 	MempoolBackupIntervalMillis                uint64
 	MempoolMaxValidationViewConnects           uint64
 	TransactionValidationRefreshIntervalMillis uint64
+	MempoolMaxSizeBytes                        uint64
+	MempoolMaxQueuedTxnsPerPublicKey           uint64
+	MempoolValidationWorkers                   uint64
+	MempoolNonLocalTxnTTLSeconds               uint64
+	MempoolLocalTxnRebroadcastIntervalSeconds  uint64
+	MempoolMaxTxnsPerPublicKey                 uint64
+	MempoolMaxBytesPerPublicKey                uint64
+	MempoolBurstTxnsPerPublicKey               uint64
+	MempoolBurstBytesPerPublicKey              uint64
 
 	// Mining
 	MinerPublicKeys  []string
@@ -72,20 +147,55 @@ type Config struct {
 	TrustedBlockProducerPublicKeys  []string
 	TrustedBlockProducerStartHeight uint64
 
+	// BlockInclusion filters the transactions included in the PoS blocks this node produces.
+	BlockInclusionExcludedTxnTypes   []string
+	BlockInclusionExcludedPublicKeys []string
+	BlockInclusionMinFeeRates        string
+
+	// BlockProducerDeterministicTxnShuffle orders the transactions of the blocks this node produces by the
+	// deterministic shuffle.
+	BlockProducerDeterministicTxnShuffle bool
+
 	// Logging
 	LogDirectory          string
 	GlogV                 uint64
 	GlogVmodule           string
+	LogFormat             string
+	LogComponentLevels    string
 	LogDBSummarySnapshots bool
 	DatadogProfiler       bool
 	TimeEvents            bool
+	// TraceLogThresholdMillis enables tracing, and logs every span that takes at least this long. Zero disables
+	// tracing.
+	TraceLogThresholdMillis uint64
 
 	// State Syncer
 	StateChangeDir                 string
 	StateSyncerMempoolTxnSyncLimit uint64
+	StateChangeFileMaxSizeBytes    uint64
 
 	// PoS Checkpoint Syncing
 	CheckpointSyncingProviders []string
+	BlockCheckpointsFile       string
+	MaxReorgDepth              uint64
+
+	// Read Replicas
+	ReplicationListenAddress  string
+	ReplicationPrimaryAddress string
+
+	// Admin RPC
+	AdminRPCListenAddress string
+	AdminRPCAuthToken     string
+
+	// TxnType Metrics
+	TxnTypeMetricsWindowBlocks uint64
+
+	// Health
+	HealthListenAddress string
+
+	// Epoch Export
+	EpochExportDir        string
+	EpochExportWebhookURL string
 }
 
 // Viper doesn't work when you have environment variables. This is the
@@ -119,9 +229,17 @@ func LoadConfig() *Config {
 	if dataDir == "" {
 		dataDir = lib.GetDataDir(config.Params)
 	}
-	config.DataDirectory = filepath.Join(dataDir, lib.DBVersionString)
-	if err := os.MkdirAll(config.DataDirectory, os.ModePerm); err != nil {
-		glog.Fatalf("Could not create data directories (%s): %v", config.DataDirectory, err)
+	config.DataDirectory = getVersionedDirectory(dataDir)
+	config.BlocksDirectory = config.DataDirectory
+	if blocksDir := viper.GetString("blocks-dir"); blocksDir != "" {
+		config.BlocksDirectory = getVersionedDirectory(blocksDir)
+	}
+	config.StateDirectory = config.DataDirectory
+	if stateDir := viper.GetString("state-dir"); stateDir != "" {
+		config.StateDirectory = getVersionedDirectory(stateDir)
+	}
+	if ancestralRecordsDir := viper.GetString("ancestral-records-dir"); ancestralRecordsDir != "" {
+		config.AncestralRecordsDirectory = getVersionedDirectory(ancestralRecordsDir)
 	}
 
 	config.MempoolDumpDirectory = viper.GetString("mempool-dump-dir")
@@ -129,6 +247,12 @@ func LoadConfig() *Config {
 	config.Regtest = viper.GetBool("regtest")
 	config.RegtestAccelerated = viper.GetBool("regtest-accelerated")
 	config.PostgresURI = viper.GetString("postgres-uri")
+	config.BlockSegmentStore = viper.GetBool("block-segment-store")
+	config.BlockArchiveSource = viper.GetString("block-archive-source")
+	config.DBIntegrityCheck = viper.GetBool("db-integrity-check")
+	config.DBIntegrityCheckStrict = viper.GetBool("db-integrity-check-strict")
+	config.DataEncryptionKeyFile = viper.GetString("data-encryption-key-file")
+	config.DataEncryptionKeyCommand = viper.GetString("data-encryption-key-command")
 	config.HyperSync = viper.GetBool("hypersync")
 	config.ForceChecksum = viper.GetBool("force-checksum")
 	config.SyncType = lib.NodeSyncType(viper.GetString("sync-type"))
@@ -136,13 +260,36 @@ func LoadConfig() *Config {
 	config.SnapshotBlockHeightPeriod = viper.GetUint64("snapshot-block-height-period")
 	config.DisableEncoderMigrations = viper.GetBool("disable-encoder-migrations")
 	config.HypersyncMaxQueueSize = viper.GetUint32("hypersync-max-queue-size")
+	config.HypersyncChunkApplyWorkers = viper.GetUint32("hypersync-chunk-apply-workers")
+	config.TrustedSnapshotSignerPublicKeys = viper.GetStringSlice("trusted-snapshot-signer-public-keys")
+	config.StateCommitment = viper.GetBool("state-commitment")
+	config.ContinuousChecksum = viper.GetBool("continuous-checksum")
+	config.StateCacheMaxBytes = viper.GetUint64("state-cache-max-bytes")
+	config.UndoDataRetentionBlocks = viper.GetUint64("undo-data-retention-blocks")
+	config.ArchivalUndoData = viper.GetBool("archival-undo-data")
 
 	// PoS Validator
 	config.PosValidatorSeed = viper.GetString("pos-validator-seed")
+	config.PosValidatorAllowNewSlashingProtectionDB = viper.GetBool("pos-validator-allow-new-slashing-protection-db")
+	config.PosValidatorSlashingProtectionDirectory = viper.GetString("pos-validator-slashing-protection-dir")
+	if config.PosValidatorSlashingProtectionDirectory == "" {
+		config.PosValidatorSlashingProtectionDirectory = config.DataDirectory
+	}
+	config.PosValidatorStandby = viper.GetBool("pos-validator-standby")
+	config.PosValidatorStandbyTakeoverTimeoutSeconds = viper.GetUint64("pos-validator-standby-takeover-timeout-seconds")
 
 	// Mempool
 	config.MempoolBackupIntervalMillis = viper.GetUint64("mempool-backup-time-millis")
 	config.MempoolMaxValidationViewConnects = viper.GetUint64("mempool-max-validation-view-connects")
+	config.MempoolMaxSizeBytes = viper.GetUint64("mempool-max-size-bytes")
+	config.MempoolMaxQueuedTxnsPerPublicKey = viper.GetUint64("mempool-max-queued-txns-per-public-key")
+	config.MempoolValidationWorkers = viper.GetUint64("mempool-validation-workers")
+	config.MempoolNonLocalTxnTTLSeconds = viper.GetUint64("mempool-non-local-txn-ttl-seconds")
+	config.MempoolLocalTxnRebroadcastIntervalSeconds = viper.GetUint64("mempool-local-txn-rebroadcast-interval-seconds")
+	config.MempoolMaxTxnsPerPublicKey = viper.GetUint64("mempool-max-txns-per-public-key")
+	config.MempoolMaxBytesPerPublicKey = viper.GetUint64("mempool-max-bytes-per-public-key")
+	config.MempoolBurstTxnsPerPublicKey = viper.GetUint64("mempool-burst-txns-per-public-key")
+	config.MempoolBurstBytesPerPublicKey = viper.GetUint64("mempool-burst-bytes-per-public-key")
 	config.TransactionValidationRefreshIntervalMillis = viper.GetUint64("transaction-validation-refresh-interval-millis")
 
 	// Peers
@@ -152,6 +299,7 @@ func LoadConfig() *Config {
 	config.AddSeeds = GetStringSliceWorkaround("add-seeds")
 	config.TargetOutboundPeers = viper.GetUint32("target-outbound-peers")
 	config.StallTimeoutSeconds = viper.GetUint64("stall-timeout-seconds")
+	config.BlockStallTimeoutSeconds = viper.GetUint64("block-stall-timeout-seconds")
 
 	// Peer Restrictions
 	config.PrivateMode = viper.GetBool("private-mode")
@@ -160,6 +308,18 @@ func LoadConfig() *Config {
 	config.IgnoreInboundInvs = viper.GetBool("ignore-inbound-invs")
 	config.MaxInboundPeers = viper.GetUint32("max-inbound-peers")
 	config.OneInboundPerIp = viper.GetBool("one-inbound-per-ip")
+	config.PeerRequestRateLimits = viper.GetString("peer-request-rate-limits")
+	config.TxnReconciliationIntervalMillis = viper.GetUint64("txn-reconciliation-interval-millis")
+	config.CompactBlockRelay = viper.GetBool("compact-block-relay")
+	config.FeeTelemetryIntervalSeconds = viper.GetUint64("fee-telemetry-interval-seconds")
+	config.TxnMessageWorkers = viper.GetUint64("txn-message-workers")
+
+	// Proxy
+	config.Proxy = viper.GetString("proxy")
+	config.ProxyUser = viper.GetString("proxy-user")
+	config.ProxyPass = viper.GetString("proxy-pass")
+	config.OnionProxy = viper.GetString("onion-proxy")
+	config.PeerProxies = GetStringSliceWorkaround("peer-proxies")
 
 	// NetworkManager config
 	config.PeerConnectionRefreshIntervalMillis = viper.GetUint64("peer-connection-refresh-interval-millis")
@@ -181,6 +341,10 @@ func LoadConfig() *Config {
 	// TODO: Couldn't get this to work with environement variable
 	config.TrustedBlockProducerPublicKeys = viper.GetStringSlice("trusted-block-producer-public-keys")
 	glog.V(2).Infof("Trusted Block Producer Public Keys: %v", config.TrustedBlockProducerPublicKeys)
+	config.BlockInclusionExcludedTxnTypes = viper.GetStringSlice("block-inclusion-excluded-txn-types")
+	config.BlockInclusionExcludedPublicKeys = viper.GetStringSlice("block-inclusion-excluded-public-keys")
+	config.BlockInclusionMinFeeRates = viper.GetString("block-inclusion-min-fee-rates")
+	config.BlockProducerDeterministicTxnShuffle = viper.GetBool("block-producer-deterministic-txn-shuffle")
 
 	// Logging
 	config.LogDirectory = viper.GetString("log-dir")
@@ -189,13 +353,17 @@ func LoadConfig() *Config {
 	}
 	config.GlogV = viper.GetUint64("glog-v")
 	config.GlogVmodule = viper.GetString("glog-vmodule")
+	config.LogFormat = viper.GetString("log-format")
+	config.LogComponentLevels = viper.GetString("log-component-levels")
 	config.LogDBSummarySnapshots = viper.GetBool("log-db-summary-snapshots")
 	config.DatadogProfiler = viper.GetBool("datadog-profiler")
 	config.TimeEvents = viper.GetBool("time-events")
+	config.TraceLogThresholdMillis = viper.GetUint64("trace-log-threshold-millis")
 
 	// State Syncer
 	config.StateChangeDir = viper.GetString("state-change-dir")
 	config.StateSyncerMempoolTxnSyncLimit = viper.GetUint64("state-syncer-mempool-txn-sync-limit")
+	config.StateChangeFileMaxSizeBytes = viper.GetUint64("state-change-file-max-size-bytes")
 
 	// PoS Checkpoint Syncing
 	config.CheckpointSyncingProviders = GetStringSliceWorkaround("checkpoint-syncing-providers")
@@ -215,6 +383,33 @@ func LoadConfig() *Config {
 		}
 	}
 
+	config.BlockCheckpointsFile = viper.GetString("block-checkpoints-file")
+	config.MaxReorgDepth = viper.GetUint64("max-reorg-depth")
+
+	// Read Replicas
+	config.ReplicationListenAddress = viper.GetString("replication-listen-addr")
+	config.ReplicationPrimaryAddress = viper.GetString("replication-primary-addr")
+	if config.ReplicationPrimaryAddress != "" {
+		// A read replica gets all of its state from the primary, so it must neither sync from peers nor accept
+		// transactions of its own.
+		config.DisableNetworking = true
+		config.ReadOnlyMode = true
+	}
+
+	// Admin RPC
+	config.AdminRPCListenAddress = viper.GetString("admin-rpc-listen-addr")
+	config.AdminRPCAuthToken = viper.GetString("admin-rpc-auth-token")
+
+	// TxnType Metrics
+	config.TxnTypeMetricsWindowBlocks = viper.GetUint64("txn-type-metrics-window-blocks")
+
+	// Health
+	config.HealthListenAddress = viper.GetString("health-listen-addr")
+
+	// Epoch Export
+	config.EpochExportDir = viper.GetString("epoch-export-dir")
+	config.EpochExportWebhookURL = viper.GetString("epoch-export-webhook-url")
+
 	if len(config.CheckpointSyncingProviders) == 0 && config.Regtest {
 		glog.Warningln("No checkpoint syncing providers specified. Syncing will require verification of signatures" +
 			" on all blocks, which may be slow. Consider specifying a checkpoint syncing provider.")
@@ -223,21 +418,116 @@ func LoadConfig() *Config {
 	return &config
 }
 
+// getVersionedDirectory returns the subdirectory of dir for the current DB version, creating it if it doesn't exist.
+func getVersionedDirectory(dir string) string {
+	versionedDir := filepath.Join(dir, lib.DBVersionString)
+	if err := os.MkdirAll(versionedDir, os.ModePerm); err != nil {
+		glog.Fatalf("Could not create data directories (%s): %v", versionedDir, err)
+	}
+	return versionedDir
+}
+
+// NodeConfig returns the lib.NodeConfig that the node is started with.
+func (config *Config) NodeConfig(blockCheckpoints []lib.BlockCheckpoint) (*lib.NodeConfig, error) {
+	return lib.NewNodeConfigBuilder(config.Params).
+		SetRegtest(config.Regtest).
+		SetDataDirs(config.DataDirectory, config.MempoolDumpDirectory, config.StateChangeDir).
+		SetPeers(config.ConnectIPs, config.TargetOutboundPeers, config.MaxInboundPeers, config.OneInboundPerIp).
+		SetPeerTimeouts(config.PeerConnectionRefreshIntervalMillis, config.StallTimeoutSeconds,
+			config.BlockStallTimeoutSeconds).
+		SetPeerRequestRateLimits(config.PeerRequestRateLimits).
+		SetTxnReconciliation(config.TxnReconciliationIntervalMillis).
+		SetCompactBlockRelay(config.CompactBlockRelay).
+		SetFeeTelemetry(config.FeeTelemetryIntervalSeconds).
+		SetTxnMessageWorkers(config.TxnMessageWorkers).
+		SetNetworkingModes(config.DisableNetworking, config.ReadOnlyMode, config.IgnoreInboundInvs).
+		SetHyperSync(config.HyperSync, config.SyncType, config.SnapshotBlockHeightPeriod, config.HypersyncMaxQueueSize,
+			config.HypersyncChunkApplyWorkers).
+		SetStateVerification(config.ForceChecksum, config.ContinuousChecksum, config.StateCommitment,
+			config.TrustedSnapshotSignerPublicKeys).
+		SetSyncLimits(config.MaxSyncBlockHeight, config.DisableEncoderMigrations).
+		SetCheckpoints(config.CheckpointSyncingProviders, blockCheckpoints).
+		SetMaxReorgDepth(config.MaxReorgDepth).
+		SetStateCache(config.StateCacheMaxBytes).
+		SetUndoDataRetention(config.UndoDataRetentionBlocks, config.ArchivalUndoData).
+		SetFees(config.RateLimitFeerate, config.MinFeerate).
+		SetMempool(config.MempoolBackupIntervalMillis, config.MempoolMaxValidationViewConnects,
+			config.TransactionValidationRefreshIntervalMillis, config.MempoolMaxSizeBytes,
+			config.MempoolMaxQueuedTxnsPerPublicKey, config.MempoolValidationWorkers).
+		SetMempoolLocalTxns(config.MempoolNonLocalTxnTTLSeconds, config.MempoolLocalTxnRebroadcastIntervalSeconds).
+		SetMempoolPublicKeyQuota(config.MempoolMaxTxnsPerPublicKey, config.MempoolMaxBytesPerPublicKey,
+			config.MempoolBurstTxnsPerPublicKey, config.MempoolBurstBytesPerPublicKey).
+		SetStateSyncerMempoolTxnSyncLimit(config.StateSyncerMempoolTxnSyncLimit).
+		SetStateChangeFileMaxSizeBytes(config.StateChangeFileMaxSizeBytes).
+		SetMining(config.MinerPublicKeys, config.NumMiningThreads).
+		SetBlockProducer(config.MaxBlockTemplatesCache, config.MinBlockUpdateInterval, config.BlockCypherAPIKey,
+			config.BlockProducerSeed).
+		SetTrustedBlockProducers(config.TrustedBlockProducerPublicKeys, config.TrustedBlockProducerStartHeight).
+		SetBlockInclusionFilter(config.BlockInclusionExcludedTxnTypes, config.BlockInclusionExcludedPublicKeys,
+			config.BlockInclusionMinFeeRates).
+		SetBlockProducerDeterministicTxnShuffle(config.BlockProducerDeterministicTxnShuffle).
+		SetLogging(config.LogFormat, config.LogComponentLevels).
+		Build()
+}
+
 func (config *Config) Print() {
 	glog.Infof("Logging to directory %s", config.LogDirectory)
+
+	if config.LogComponentLevels != "" {
+		glog.Infof("Log Component Levels: %s", config.LogComponentLevels)
+	}
 	glog.Infof("Running node in %s mode", config.Params.NetworkType)
 	glog.Infof("Data Directory: %s", config.DataDirectory)
 
+	if config.BlocksDirectory != config.DataDirectory {
+		glog.Infof("Blocks Directory: %s", config.BlocksDirectory)
+	}
+
+	if config.StateDirectory != config.DataDirectory {
+		glog.Infof("State Directory: %s", config.StateDirectory)
+	}
+
+	if config.AncestralRecordsDirectory != "" {
+		glog.Infof("Ancestral Records Directory: %s", config.AncestralRecordsDirectory)
+	}
+
 	if config.MempoolDumpDirectory != "" {
 		glog.Infof("Mempool Dump Directory: %s", config.MempoolDumpDirectory)
 	}
 
+	if !config.DBIntegrityCheck {
+		glog.Infof("DB Integrity Check: OFF")
+	} else if config.DBIntegrityCheckStrict {
+		glog.Infof("DB Integrity Check: STRICT")
+	}
+
+	if config.DataEncryptionKeyFile != "" {
+		glog.Infof("Data Encryption Key File: %s", config.DataEncryptionKeyFile)
+	} else if config.DataEncryptionKeyCommand != "" {
+		glog.Infof("Data Encryption: Key fetched with --data-encryption-key-command")
+	}
+
+	if config.MempoolNonLocalTxnTTLSeconds > 0 {
+		glog.Infof("Mempool Non-Local Txn TTL: %d seconds", config.MempoolNonLocalTxnTTLSeconds)
+	}
+
+	if config.MempoolMaxTxnsPerPublicKey > 0 || config.MempoolMaxBytesPerPublicKey > 0 {
+		glog.Infof("Mempool Public Key Quota: %d txns (+%d burst), %d bytes (+%d burst)",
+			config.MempoolMaxTxnsPerPublicKey, config.MempoolBurstTxnsPerPublicKey,
+			config.MempoolMaxBytesPerPublicKey, config.MempoolBurstBytesPerPublicKey)
+	}
+
 	if config.PostgresURI != "" {
 		glog.Infof("Postgres URI: %s", config.PostgresURI)
 	}
 
 	if config.PosValidatorSeed != "" {
 		glog.Infof(lib.CLog(lib.Blue, "PoS Validator: ON"))
+		glog.Infof("PoS Validator Slashing Protection Directory: %s", config.PosValidatorSlashingProtectionDirectory)
+		if config.PosValidatorStandby {
+			glog.Infof("PoS Validator Standby: ON, taking over after %d seconds without a heartbeat from the primary",
+				config.PosValidatorStandbyTakeoverTimeoutSeconds)
+		}
 	}
 
 	if config.HyperSync {
@@ -252,6 +542,28 @@ func (config *Config) Print() {
 			"connecting to a trustworthy sync peer."))
 	}
 
+	if config.ContinuousChecksum {
+		glog.Infof("ContinuousChecksum: ON")
+	}
+
+	if config.MaxReorgDepth > 0 {
+		glog.Infof("Max Reorg Depth: %d blocks", config.MaxReorgDepth)
+	}
+
+	if config.StateCommitment {
+		glog.Infof("StateCommitment: ON")
+	}
+
+	if config.StateCacheMaxBytes > 0 {
+		glog.Infof("State Cache Max Bytes: %d", config.StateCacheMaxBytes)
+	}
+
+	if config.ArchivalUndoData || config.UndoDataRetentionBlocks == 0 {
+		glog.Infof("Undo Data Retention: ALL BLOCKS")
+	} else {
+		glog.Infof("Undo Data Retention: %d blocks", config.UndoDataRetentionBlocks)
+	}
+
 	if config.SnapshotBlockHeightPeriod > 0 {
 		glog.Infof("SnapshotBlockHeightPeriod: %v", config.SnapshotBlockHeightPeriod)
 	}
@@ -274,6 +586,14 @@ func (config *Config) Print() {
 		glog.Infof("Add IPs: %s", config.ConnectIPs)
 	}
 
+	if config.Proxy != "" {
+		glog.Infof("Proxy: %s", config.Proxy)
+	}
+
+	if config.OnionProxy != "" {
+		glog.Infof("Onion Proxy: %s", config.OnionProxy)
+	}
+
 	if config.PrivateMode {
 		glog.Infof("PRIVATE MODE")
 	}
@@ -286,11 +606,70 @@ func (config *Config) Print() {
 		glog.Infof("NETWORKING DISABLED")
 	}
 
+	if config.ReplicationListenAddress != "" {
+		glog.Infof("Replication Primary: Listening on %s", config.ReplicationListenAddress)
+	}
+
+	if config.ReplicationPrimaryAddress != "" {
+		glog.Infof("READ REPLICA: Following primary %s", config.ReplicationPrimaryAddress)
+	}
+
+	if config.AdminRPCListenAddress != "" {
+		glog.Infof("Admin RPC: Listening on %s", config.AdminRPCListenAddress)
+	}
+
+	if config.HealthListenAddress != "" {
+		glog.Infof("Health: Listening on %s", config.HealthListenAddress)
+	}
+
+	if config.BlockSegmentStore {
+		glog.Infof("Block Segment Store: Storing block bodies in %s",
+			lib.GetBlockSegmentStorePath(config.BlocksDirectory))
+	}
+
+	if config.BlockArchiveSource != "" {
+		glog.Infof("Block Archive: Importing blocks from %s", config.BlockArchiveSource)
+	}
+
+	if config.TxnTypeMetricsWindowBlocks > 0 {
+		glog.Infof("TxnType Metrics: Tracking the last %d blocks", config.TxnTypeMetricsWindowBlocks)
+	}
+
+	if config.EpochExportDir != "" {
+		glog.Infof("Epoch Export: Writing exports to %s", config.EpochExportDir)
+	}
+
+	if config.EpochExportWebhookURL != "" {
+		glog.Infof("Epoch Export: Posting exports to %s", config.EpochExportWebhookURL)
+	}
+
 	if config.IgnoreInboundInvs {
 		glog.Infof("IGNORING INBOUND INVS")
 	}
 
+	if config.TraceLogThresholdMillis > 0 {
+		glog.Infof("Tracing: Logging spans that take at least %dms", config.TraceLogThresholdMillis)
+	}
+
 	glog.Infof("Max Inbound Peers: %d", config.MaxInboundPeers)
+	if config.PeerRequestRateLimits != "" {
+		glog.Infof("Peer Request Rate Limits: %s", config.PeerRequestRateLimits)
+	}
+	if config.TxnReconciliationIntervalMillis > 0 {
+		glog.Infof("Txn Reconciliation Interval: %dms", config.TxnReconciliationIntervalMillis)
+	} else {
+		glog.Infof("Txn Reconciliation: DISABLED")
+	}
+	glog.Infof("Compact Block Relay: %v", config.CompactBlockRelay)
+	if config.BlockProducerDeterministicTxnShuffle {
+		glog.Infof("Block Producer: Ordering txns by the deterministic shuffle")
+	}
+	if config.FeeTelemetryIntervalSeconds > 0 {
+		glog.Infof("Fee Telemetry Interval: %ds", config.FeeTelemetryIntervalSeconds)
+	} else {
+		glog.Infof("Fee Telemetry: DISABLED")
+	}
+	glog.Infof("Txn Message Workers: %d", config.TxnMessageWorkers)
 	glog.Infof("Protocol listening on port %d", config.ProtocolPort)
 
 	if len(config.MinerPublicKeys) > 0 {
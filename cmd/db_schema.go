@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var dbSchemaCmd = &cobra.Command{
+	Use:   "db-schema",
+	Short: "Print the layout of the keys and values stored under every DB prefix",
+	Long: `Prints the schema of every prefix in the DB: the fields of its keys, and the DeSoEncoder or the fields
+stored in its values. The JSON output is meant for tooling that needs to decode arbitrary DB entries, and the
+markdown output is the document checked in at docs/db_schema.md.`,
+	Run: PrintDBSchema,
+}
+
+func init() {
+	dbSchemaCmd.Flags().String("format", "json", "The output format, either json or markdown.")
+	rootCmd.AddCommand(dbSchemaCmd)
+}
+
+func PrintDBSchema(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(lib.GetDBSchema()); err != nil {
+			glog.Fatalf("PrintDBSchema: Problem encoding schema: %v", err)
+		}
+	case "markdown":
+		if err := lib.WriteDBSchemaMarkdown(os.Stdout); err != nil {
+			glog.Fatalf("PrintDBSchema: Problem writing schema: %v", err)
+		}
+	default:
+		glog.Fatalf("PrintDBSchema: Unknown --format %v; must be json or markdown", format)
+	}
+}
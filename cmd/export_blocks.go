@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var exportBlocksCmd = &cobra.Command{
+	Use:   "export-blocks",
+	Short: "Export the node's blocks to a block archive",
+	Long: `Writes the committed blocks of a stopped node to a block archive, which other nodes can import with
+--block-archive-source. Upload the contents of --out-dir to any static file host to serve the archive.`,
+	Run: ExportBlocks,
+}
+
+func init() {
+	exportBlocksCmd.Flags().Bool("testnet", false, "Export the blocks of a DeSo testnet node")
+	exportBlocksCmd.Flags().String("data-dir", "",
+		"The data directory of the node. When unset, defaults to the system's configuration directory.")
+	exportBlocksCmd.Flags().String("blocks-dir", "", "The --blocks-dir the node was run with, if any.")
+	exportBlocksCmd.Flags().String("state-dir", "", "The --state-dir the node was run with, if any.")
+	exportBlocksCmd.Flags().String("data-encryption-key-file", "",
+		"The key file the node was run with in --data-encryption-key-file, if its data directory is encrypted.")
+	exportBlocksCmd.Flags().Bool("block-segment-store", false,
+		"Set to true if the node was run with --block-segment-store.")
+	exportBlocksCmd.Flags().String("out-dir", "", "The directory to write the archive to.")
+	exportBlocksCmd.Flags().Uint64("start-height", 1, "The height of the first block to export.")
+	exportBlocksCmd.Flags().Uint64("end-height", 0,
+		"The height of the last block to export. When unset, exports up to the highest committed block.")
+	exportBlocksCmd.Flags().Uint64("segment-max-size-bytes", lib.DefaultBlockArchiveSegmentMaxSizeBytes,
+		"The size at which a new segment is started.")
+	rootCmd.AddCommand(exportBlocksCmd)
+}
+
+func ExportBlocks(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	params := &lib.DeSoMainnetParams
+	if testnet, _ := flags.GetBool("testnet"); testnet {
+		params = &lib.DeSoTestnetParams
+	}
+	dataDir, _ := flags.GetString("data-dir")
+	if dataDir == "" {
+		dataDir = lib.GetDataDir(params)
+	}
+	dataDir = filepath.Join(dataDir, lib.DBVersionString)
+	blocksDir, stateDir := dataDir, dataDir
+	if dir, _ := flags.GetString("blocks-dir"); dir != "" {
+		blocksDir = filepath.Join(dir, lib.DBVersionString)
+	}
+	if dir, _ := flags.GetString("state-dir"); dir != "" {
+		stateDir = filepath.Join(dir, lib.DBVersionString)
+	}
+	outDir, _ := flags.GetString("out-dir")
+	if outDir == "" {
+		glog.Fatal("ExportBlocks: --out-dir is required")
+	}
+	startHeight, _ := flags.GetUint64("start-height")
+	endHeight, _ := flags.GetUint64("end-height")
+	segmentMaxSizeBytes, _ := flags.GetUint64("segment-max-size-bytes")
+
+	if keyFile, _ := flags.GetString("data-encryption-key-file"); keyFile != "" {
+		if err := lib.LoadDataEncryptionKey(lib.NewDataEncryptionKeyFileProvider(keyFile)); err != nil {
+			glog.Fatalf("ExportBlocks: %v", err)
+		}
+	}
+
+	dbDir := lib.GetBadgerDbPath(stateDir)
+	opts := lib.PerformanceBadgerOptions(dbDir)
+	opts.ValueDir = dbDir
+	db, err := badger.Open(opts)
+	if err != nil {
+		glog.Fatalf("ExportBlocks: Problem opening DB %v: %v", dbDir, err)
+	}
+	defer db.Close()
+
+	if useBlockSegmentStore, _ := flags.GetBool("block-segment-store"); useBlockSegmentStore {
+		store, err := lib.OpenBlockSegmentStore(
+			lib.GetBlockSegmentStorePath(blocksDir), lib.DefaultBlockSegmentMaxSizeBytes)
+		if err != nil {
+			glog.Fatalf("ExportBlocks: Problem opening block segment store: %v", err)
+		}
+		defer store.Close()
+		lib.RegisterBlockSegmentStore(db, store)
+		defer lib.UnregisterBlockSegmentStore(db)
+	}
+
+	if _, err = lib.ExportBlockArchive(db, params, outDir, startHeight, endHeight, segmentMaxSizeBytes); err != nil {
+		glog.Fatalf("ExportBlocks: %v", err)
+	}
+}
@@ -8,12 +8,14 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/DataDog/datadog-go/v5/statsd"
 	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/deso-protocol/core/lib"
@@ -35,6 +37,31 @@ type Node struct {
 	Postgres  *lib.Postgres
 	Listeners []net.Listener
 
+	// BlockSegmentStore is only set when block bodies are stored outside of the ChainDB.
+	BlockSegmentStore *lib.BlockSegmentStore
+	// AncestralRecordsDB is only set when the snapshot's ancestral records are stored outside of the ChainDB.
+	AncestralRecordsDB *badger.DB
+
+	// SlashingProtectionDB is only set when the node runs as a PoS validator, other than a standby.
+	SlashingProtectionDB *lib.SlashingProtectionDB
+	// ValidatorStandby is only set when the node runs as the standby of a PoS validator. The standby opens the
+	// slashing protection database when it takes over.
+	ValidatorStandby *lib.ValidatorStandby
+
+	// ReplicationPrimary is only set when the node streams its flushes to read replicas, and
+	// ReplicationReplica is only set when the node is a read replica.
+	ReplicationPrimary *lib.ReplicationPrimary
+	ReplicationReplica *lib.ReplicationReplica
+
+	// AdminRPCServer is only set when the admin RPC is enabled.
+	AdminRPCServer *lib.AdminRPCServer
+	// HealthServer is only set when the health endpoints are enabled.
+	HealthServer *lib.HealthServer
+	// TxnTypeMetrics is only set when TxnType metrics are enabled.
+	TxnTypeMetrics *lib.TxnTypeMetricsTracker
+	// EpochExporter is only set when epoch exports are enabled.
+	EpochExporter *lib.EpochExporter
+
 	// IsRunning is false when a NewNode is created, set to true on Start(), set to false
 	// after Stop() is called. Mainly used in testing.
 	IsRunning bool
@@ -106,16 +133,34 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		lib.Mode = lib.EnableTimer
 	}
 
+	if node.Config.TraceLogThresholdMillis > 0 {
+		lib.SetTracer(lib.NewExportingTracer(lib.NewLogSpanExporter(
+			time.Duration(node.Config.TraceLogThresholdMillis) * time.Millisecond)))
+	}
+
 	// Setup statsd
 	statsdClient, err := statsd.New(fmt.Sprintf("%s:%d", os.Getenv("DD_AGENT_HOST"), 8125))
 	if err != nil {
 		glog.Fatal(err)
 	}
 
-	// Setup listeners and peers
-	desoAddrMgr := addrmgr.New(node.Config.DataDirectory, net.LookupIP)
+	// Setup listeners and peers. When outbound connections go through a proxy, we also resolve hostnames
+	// through the proxy so that DNS lookups don't leak our IP address.
+	lookupIP := net.LookupIP
+	if node.Config.Proxy != "" {
+		lookupIP = func(host string) ([]net.IP, error) {
+			return connmgr.TorLookupIP(host, node.Config.Proxy)
+		}
+	}
+	desoAddrMgr := addrmgr.New(node.Config.DataDirectory, lookupIP)
 	desoAddrMgr.Start()
 
+	peerDialer, err := lib.NewPeerDialer(node.Config.Proxy, node.Config.ProxyUser, node.Config.ProxyPass,
+		node.Config.OnionProxy, node.Config.PeerProxies, desoAddrMgr, node.Params)
+	if err != nil {
+		panic(err)
+	}
+
 	// This just gets localhost listening addresses on the protocol port.
 	// Such as [{127.0.0.1 18000 } {::1 18000 }], and associated listener structs.
 	_, node.Listeners = GetAddrsToListenOn(node.Config.ProtocolPort)
@@ -125,22 +170,35 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 	if len(node.Config.ConnectIPs) == 0 {
 		glog.Infof("Looking for AddIPs: %v", len(node.Config.AddIPs))
 		for _, host := range node.Config.AddIPs {
-			addIPsForHost(desoAddrMgr, host, node.Params)
+			addIPsForHost(desoAddrMgr, lookupIP, host, node.Params)
 		}
 
 		glog.Infof("Looking for DNSSeeds: %v", len(node.Params.DNSSeeds))
 		for _, host := range node.Params.DNSSeeds {
-			addIPsForHost(desoAddrMgr, host, node.Params)
+			addIPsForHost(desoAddrMgr, lookupIP, host, node.Params)
 		}
 
 		// This is where we connect to addresses from DNSSeeds.
 		if !node.Config.PrivateMode {
-			go addSeedAddrsFromPrefixes(desoAddrMgr, node.Params)
+			go addSeedAddrsFromPrefixes(desoAddrMgr, lookupIP, node.Params)
 		}
 	}
 
+	// Setup data encryption. This has to happen before any of the node's DBs is opened.
+	if node.Config.DataEncryptionKeyFile != "" && node.Config.DataEncryptionKeyCommand != "" {
+		glog.Fatal("Only one of --data-encryption-key-file and --data-encryption-key-command can be set")
+	}
+	if node.Config.DataEncryptionKeyFile != "" {
+		err = lib.LoadDataEncryptionKey(lib.NewDataEncryptionKeyFileProvider(node.Config.DataEncryptionKeyFile))
+	} else if node.Config.DataEncryptionKeyCommand != "" {
+		err = lib.LoadDataEncryptionKey(lib.NewDataEncryptionKeyCommandProvider(node.Config.DataEncryptionKeyCommand))
+	}
+	if err != nil {
+		glog.Fatal(err)
+	}
+
 	// Setup chain database
-	dbDir := lib.GetBadgerDbPath(node.Config.DataDirectory)
+	dbDir := lib.GetBadgerDbPath(node.Config.StateDirectory)
 	opts := lib.PerformanceBadgerOptions(dbDir)
 	opts.ValueDir = dbDir
 	node.ChainDB, err = badger.Open(opts)
@@ -148,13 +206,69 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		panic(err)
 	}
 
+	// Setup block segment store
+	if node.Config.BlockSegmentStore {
+		node.BlockSegmentStore, err = lib.OpenBlockSegmentStore(
+			lib.GetBlockSegmentStorePath(node.Config.BlocksDirectory), lib.DefaultBlockSegmentMaxSizeBytes)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		lib.RegisterBlockSegmentStore(node.ChainDB, node.BlockSegmentStore)
+	}
+
+	// Setup ancestral records database. This has to happen before the server creates the snapshot.
+	if node.Config.AncestralRecordsDirectory != "" {
+		ancestralRecordsDbDir := lib.GetAncestralRecordsDbPath(node.Config.AncestralRecordsDirectory)
+		ancestralRecordsOpts := lib.PerformanceBadgerOptions(ancestralRecordsDbDir)
+		ancestralRecordsOpts.ValueDir = ancestralRecordsDbDir
+		node.AncestralRecordsDB, err = badger.Open(ancestralRecordsOpts)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if err = lib.RegisterAncestralRecordsDB(node.ChainDB, node.AncestralRecordsDB); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	// Check the chain DB before anything reads from it, so that damage is reported with a remediation rather than
+	// as a decode error deep into the sync.
+	if node.Config.DBIntegrityCheck {
+		report, err := lib.CheckDBIntegrity(node.ChainDB, node.Params)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if report.HasErrors() {
+			glog.Error(report.String())
+			if node.Config.DBIntegrityCheckStrict {
+				glog.Fatal("Node.Start: DB integrity check found errors. Fix them, or restart with " +
+					"--db-integrity-check-strict=false to start anyway.")
+			}
+		} else if len(report.Issues) > 0 {
+			glog.Warning(report.String())
+		} else {
+			glog.Info(report.String())
+		}
+	}
+
 	// Setup snapshot logger
 	if node.Config.LogDBSummarySnapshots {
 		lib.StartDBSummarySnapshots(node.ChainDB)
 	}
 
-	// Validate that we weren't passed incompatible Hypersync flags
-	lib.ValidateHyperSyncFlags(node.Config.HyperSync, node.Config.SyncType)
+	// Load any operator-supplied block checkpoints. These are added on top of the ones hardcoded in the params.
+	var blockCheckpoints []lib.BlockCheckpoint
+	if node.Config.BlockCheckpointsFile != "" {
+		blockCheckpoints, err = lib.LoadBlockCheckpointsFromFile(node.Config.BlockCheckpointsFile)
+		if err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	// Build the config of the server. This validates that we weren't passed incompatible flags, e.g. Hypersync flags.
+	nodeConfig, err := node.Config.NodeConfig(blockCheckpoints)
+	if err != nil {
+		glog.Fatal(err)
+	}
 
 	// Setup postgres using a remote URI. Postgres is not currently supported when we're in hypersync mode.
 	if node.Config.HyperSync && node.Config.PostgresURI != "" {
@@ -185,6 +299,41 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 
 	// Setup eventManager
 	eventManager := lib.NewEventManager()
+	if node.Config.ReplicationListenAddress != "" {
+		node.ReplicationPrimary = lib.NewReplicationPrimary(
+			node.ChainDB, node.Config.ReplicationListenAddress, lib.DefaultReplicationMaxBufferedBatches)
+		node.ReplicationPrimary.RegisterWithEventManager(eventManager)
+		if err = node.ReplicationPrimary.Start(); err != nil {
+			glog.Fatal(err)
+		}
+	}
+	if node.Config.EpochExportDir != "" || node.Config.EpochExportWebhookURL != "" {
+		var sinks []lib.EpochExportSink
+		if node.Config.EpochExportDir != "" {
+			fileSink, err := lib.NewFileEpochExportSink(node.Config.EpochExportDir)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			sinks = append(sinks, fileSink)
+		}
+		if node.Config.EpochExportWebhookURL != "" {
+			sinks = append(sinks, lib.NewWebhookEpochExportSink(node.Config.EpochExportWebhookURL))
+		}
+		node.EpochExporter, err = lib.NewEpochExporter(node.ChainDB, node.Params, sinks...)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		node.EpochExporter.RegisterWithEventManager(eventManager)
+		node.EpochExporter.Start()
+	}
+	if node.Config.TxnTypeMetricsWindowBlocks > 0 {
+		node.TxnTypeMetrics, err = lib.NewTxnTypeMetricsTracker(node.ChainDB, node.Config.TxnTypeMetricsWindowBlocks)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		node.TxnTypeMetrics.RegisterWithEventManager(eventManager)
+		node.TxnTypeMetrics.Start()
+	}
 
 	var blsKeystore *lib.BLSKeystore
 	if node.Config.PosValidatorSeed != "" {
@@ -192,6 +341,23 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		if err != nil {
 			panic(err)
 		}
+		if node.Config.PosValidatorStandby {
+			node.ValidatorStandby, err = lib.NewValidatorStandby(blsKeystore.GetSigner(),
+				node.Config.PosValidatorSlashingProtectionDirectory, node.Config.PosValidatorAllowNewSlashingProtectionDB,
+				time.Duration(node.Config.PosValidatorStandbyTakeoverTimeoutSeconds)*time.Second, time.Now())
+			if err != nil {
+				glog.Fatal(err)
+			}
+		} else {
+			node.SlashingProtectionDB, err = lib.OpenSlashingProtectionDB(
+				node.Config.PosValidatorSlashingProtectionDirectory, node.Config.PosValidatorAllowNewSlashingProtectionDB)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			if err = blsKeystore.GetSigner().SetSlashingProtectionDB(node.SlashingProtectionDB); err != nil {
+				glog.Fatal(err)
+			}
+		}
 	}
 
 	// Setup the server. ShouldRestart is used whenever we detect an issue and should restart the node after a recovery
@@ -199,51 +365,16 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 	// performs regular health checks to detect whenever this occurs.
 	shouldRestart := false
 	node.Server, err, shouldRestart = lib.NewServer(
-		node.Params,
-		node.Config.Regtest,
+		nodeConfig,
 		node.Listeners,
 		desoAddrMgr,
-		node.Config.ConnectIPs,
+		peerDialer,
 		node.ChainDB,
 		node.Postgres,
-		node.Config.TargetOutboundPeers,
-		node.Config.MaxInboundPeers,
-		node.Config.MinerPublicKeys,
-		node.Config.NumMiningThreads,
-		node.Config.OneInboundPerIp,
-		node.Config.PeerConnectionRefreshIntervalMillis,
-		node.Config.HyperSync,
-		node.Config.SyncType,
-		node.Config.MaxSyncBlockHeight,
-		node.Config.DisableEncoderMigrations,
-		node.Config.RateLimitFeerate,
-		node.Config.MinFeerate,
-		node.Config.StallTimeoutSeconds,
-		node.Config.MaxBlockTemplatesCache,
-		node.Config.MinBlockUpdateInterval,
-		node.Config.BlockCypherAPIKey,
-		true,
-		node.Config.SnapshotBlockHeightPeriod,
-		node.Config.DataDirectory,
-		node.Config.MempoolDumpDirectory,
-		node.Config.DisableNetworking,
-		node.Config.ReadOnlyMode,
-		node.Config.IgnoreInboundInvs,
 		statsdClient,
-		node.Config.BlockProducerSeed,
-		node.Config.TrustedBlockProducerPublicKeys,
-		node.Config.TrustedBlockProducerStartHeight,
 		eventManager,
 		node.nodeMessageChan,
-		node.Config.ForceChecksum,
-		node.Config.StateChangeDir,
-		node.Config.HypersyncMaxQueueSize,
 		blsKeystore,
-		node.Config.MempoolBackupIntervalMillis,
-		node.Config.MempoolMaxValidationViewConnects,
-		node.Config.TransactionValidationRefreshIntervalMillis,
-		node.Config.StateSyncerMempoolTxnSyncLimit,
-		node.Config.CheckpointSyncingProviders,
 	)
 	if err != nil {
 		// shouldRestart can be true if, on the previous run, we did not finish flushing all ancestral
@@ -258,9 +389,57 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		panic(err)
 	}
 
+	if node.ValidatorStandby != nil {
+		node.Server.SetValidatorStandby(node.ValidatorStandby)
+	}
+
 	if !shouldRestart {
+		// Import the block archive before the server starts syncing blocks from peers. If the import fails, the
+		// server syncs whatever is left from its peers.
+		if node.Config.BlockArchiveSource != "" {
+			importer := lib.NewBlockArchiveImporter(node.Server.GetBlockchain(), node.Config.BlockArchiveSource,
+				lib.GetBlockArchiveDownloadPath(node.Config.BlocksDirectory))
+			numBlocksProcessed, err := importer.Import()
+			if err != nil {
+				glog.Errorf("Start: Problem importing block archive, syncing the rest from peers: %v", err)
+			}
+			glog.Infof("Start: Imported %v blocks from block archive %v", numBlocksProcessed,
+				node.Config.BlockArchiveSource)
+		}
+
 		node.Server.Start()
 
+		if node.Config.ReplicationPrimaryAddress != "" {
+			node.ReplicationReplica, err = lib.NewReplicationReplica(
+				node.ChainDB, node.Server.GetBlockchain().Snapshot(), node.Config.ReplicationPrimaryAddress)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			node.ReplicationReplica.Start()
+		}
+
+		if node.Config.AdminRPCListenAddress != "" {
+			node.AdminRPCServer, err = lib.NewAdminRPCServer(
+				node.Config.AdminRPCListenAddress, node.Config.AdminRPCAuthToken, node.Server.GetTxnRelayFilter(),
+				node.TxnTypeMetrics, node.Server.GetBlockchain())
+			if err != nil {
+				glog.Fatal(err)
+			}
+			if err = node.AdminRPCServer.Start(); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		if node.Config.HealthListenAddress != "" {
+			node.HealthServer, err = lib.NewHealthServer(node.Config.HealthListenAddress, node.Server)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			if err = node.HealthServer.Start(); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
 		// Setup TXIndex - not compatible with postgres
 		if node.Config.TXIndex && node.Postgres == nil {
 			node.TXIndex, err = lib.NewTXIndex(node.Server.GetBlockchain(), node.Params, node.Config.DataDirectory)
@@ -317,43 +496,120 @@ func (node *Node) Stop() {
 	glog.Infof(lib.CLog(lib.Yellow, "Node is shutting down. This might take a minute. Please don't "+
 		"close the node now or else you might corrupt the state."))
 
-	// Server
-	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping server..."))
-	if node.Server != nil {
-		node.Server.Stop()
-	}
-	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Server successfully stopped."))
+	// The Server stops its own subsystems, including the snapshot, before we stop the services
+	// that read from the chain and close the databases underneath them.
+	shutdownManager := lib.NewShutdownManager()
 
-	// Snapshot
-	if node.Server != nil && node.Server.GetBlockchain() != nil {
-		snap := node.Server.GetBlockchain().Snapshot()
-		if snap != nil {
-			glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping snapshot..."))
-			snap.Stop()
-			glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Snapshot successfully stopped."))
+	// Health. We stop serving health first so that load balancers stop routing traffic to the node
+	// before it starts shutting down.
+	shutdownManager.AddStage("health server", 0, func() error {
+		if node.HealthServer != nil {
+			node.HealthServer.Stop()
+			node.HealthServer = nil
 		}
-	}
+		return nil
+	})
+
+	// Server
+	shutdownManager.AddStage("server", 5*lib.DefaultShutdownStageTimeout, func() error {
+		if node.Server != nil {
+			node.Server.Stop()
+		}
+		return nil
+	})
+
+	// Admin RPC
+	shutdownManager.AddStage("admin RPC", 0, func() error {
+		if node.AdminRPCServer != nil {
+			node.AdminRPCServer.Stop()
+			node.AdminRPCServer = nil
+		}
+		return nil
+	})
+
+	// Replication
+	shutdownManager.AddStage("replication", 0, func() error {
+		if node.ReplicationPrimary != nil {
+			node.ReplicationPrimary.Stop()
+			node.ReplicationPrimary = nil
+		}
+		if node.ReplicationReplica != nil {
+			node.ReplicationReplica.Stop()
+			node.ReplicationReplica = nil
+		}
+		return nil
+	})
+
+	// Epoch Export. The exporter reads from the chain db, so we stop it before closing the db.
+	shutdownManager.AddStage("epoch exporter", 0, func() error {
+		if node.EpochExporter != nil {
+			node.EpochExporter.Stop()
+			node.EpochExporter = nil
+		}
+		return nil
+	})
+
+	// TxnType Metrics. The tracker writes its window to the chain db, so we stop it before closing the db.
+	shutdownManager.AddStage("txn type metrics", 0, func() error {
+		if node.TxnTypeMetrics != nil {
+			node.TxnTypeMetrics.Stop()
+			node.TxnTypeMetrics = nil
+		}
+		return nil
+	})
 
 	// TXIndex
-	if node.TXIndex != nil {
-		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping TXIndex..."))
-		node.TXIndex.Stop()
-		node.closeDb(node.TXIndex.TXIndexChain.DB(), "txindex")
-		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: TXIndex successfully stopped."))
-	}
+	shutdownManager.AddStage("TXIndex", 0, func() error {
+		if node.TXIndex != nil {
+			node.TXIndex.Stop()
+			node.closeDb(node.TXIndex.TXIndexChain.DB(), "txindex")
+		}
+		return nil
+	})
 
 	// Databases
-	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Closing all databases..."))
-	if node.ChainDB != nil {
-		node.closeDb(node.ChainDB, "chain")
-	}
-	if node.Server != nil && node.Server.GetBlockchain() != nil {
-		blockchainDb := node.Server.GetBlockchain().DB()
-		node.closeDb(blockchainDb, "blockchain DB")
-	}
+	shutdownManager.AddStage("databases", 0, func() error {
+		if node.SlashingProtectionDB != nil {
+			if err := node.SlashingProtectionDB.Close(); err != nil {
+				glog.Errorf(lib.CLog(lib.Red, fmt.Sprintf("Node.Stop: Problem closing slashing protection db: err: (%v)", err)))
+			}
+			node.SlashingProtectionDB = nil
+		}
+		if node.ValidatorStandby != nil {
+			if slashingProtectionDB := node.ValidatorStandby.GetSlashingProtectionDB(); slashingProtectionDB != nil {
+				if err := slashingProtectionDB.Close(); err != nil {
+					glog.Errorf(lib.CLog(lib.Red, fmt.Sprintf("Node.Stop: Problem closing slashing protection db: err: (%v)", err)))
+				}
+			}
+			node.ValidatorStandby = nil
+		}
+		if node.BlockSegmentStore != nil {
+			lib.UnregisterBlockSegmentStore(node.ChainDB)
+			if err := node.BlockSegmentStore.Close(); err != nil {
+				glog.Errorf(lib.CLog(lib.Red, fmt.Sprintf("Node.Stop: Problem closing block segment store: err: (%v)", err)))
+			}
+			node.BlockSegmentStore = nil
+		}
+		if node.AncestralRecordsDB != nil {
+			lib.UnregisterAncestralRecordsDB(node.ChainDB)
+			node.closeDb(node.AncestralRecordsDB, "ancestral records")
+			node.AncestralRecordsDB = nil
+		}
+		if node.ChainDB != nil {
+			node.closeDb(node.ChainDB, "chain")
+		}
+		if node.Server != nil && node.Server.GetBlockchain() != nil {
+			blockchainDb := node.Server.GetBlockchain().DB()
+			node.closeDb(blockchainDb, "blockchain DB")
+		}
 
-	node.stopWaitGroup.Wait()
-	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Databases successfully closed."))
+		node.stopWaitGroup.Wait()
+		return nil
+	})
+
+	if err := shutdownManager.Shutdown(); err != nil {
+		glog.Errorf(lib.CLog(lib.Red, fmt.Sprintf("Node.Stop: Problem shutting down node: %v", err)))
+	}
 
 	if node.internalExitChan != nil {
 		close(node.internalExitChan)
@@ -508,8 +764,23 @@ func GetAddrsToListenOn(protocolPort uint16) ([]net.TCPAddr, []net.Listener) {
 	return listeningAddrs, listeners
 }
 
-func addIPsForHost(desoAddrMgr *addrmgr.AddrManager, host string, params *lib.DeSoParams) {
-	ipAddrs, err := net.LookupIP(host)
+func addIPsForHost(desoAddrMgr *addrmgr.AddrManager, lookupIP func(string) ([]net.IP, error), host string,
+	params *lib.DeSoParams) {
+
+	// A .onion address can't be resolved to IPs, so we add it to the address manager as is. It is only
+	// dialed if a proxy is configured.
+	if strings.HasSuffix(host, ".onion") {
+		netAddr, err := desoAddrMgr.HostToNetAddress(host, params.DefaultSocketPort, 0)
+		if err != nil {
+			glog.V(2).Infof("_addSeedAddrs: Problem parsing onion host (continuing on): %s %v\n", host, err)
+			return
+		}
+		glog.V(1).Infof("_addSeedAddrs: Adding onion address: %s\n", host)
+		desoAddrMgr.AddAddress(netAddr, netAddr)
+		return
+	}
+
+	ipAddrs, err := lookupIP(host)
 	if err != nil {
 		glog.V(2).Infof("_addSeedAddrs: DNS discovery failed on seed host (continuing on): %s %v\n", host, err)
 		return
@@ -556,7 +827,8 @@ func addIPsForHost(desoAddrMgr *addrmgr.AddrManager, host string, params *lib.De
 // Must be run in a goroutine. This function continuously adds IPs from a DNS seed
 // prefix+suffix by iterating up through all of the possible numeric values, which are typically
 // [0, 10]
-func addSeedAddrsFromPrefixes(desoAddrMgr *addrmgr.AddrManager, params *lib.DeSoParams) {
+func addSeedAddrsFromPrefixes(desoAddrMgr *addrmgr.AddrManager, lookupIP func(string) ([]net.IP, error),
+	params *lib.DeSoParams) {
 	MaxIterations := 20
 	go func() {
 		for dnsNumber := 0; dnsNumber < MaxIterations; dnsNumber++ {
@@ -566,7 +838,7 @@ func addSeedAddrsFromPrefixes(desoAddrMgr *addrmgr.AddrManager, params *lib.DeSo
 				go func(dnsGenerator []string) {
 					dnsString := fmt.Sprintf("%s%d%s", dnsGenerator[0], dnsNumber, dnsGenerator[1])
 					glog.V(2).Infof("_addSeedAddrsFromPrefixes: Querying DNS seed: %s", dnsString)
-					addIPsForHost(desoAddrMgr, dnsString, params)
+					addIPsForHost(desoAddrMgr, lookupIP, dnsString, params)
 					wg.Done()
 				}(dnsGeneratorOuter)
 			}
@@ -46,6 +46,17 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"Useful for testing situations where multiple clients need to run on the "+
 			"same machine without trampling over each other. "+
 			"When unset, defaults to the system's configuration directory.")
+	cmd.PersistentFlags().String("blocks-dir", "",
+		"When set, the block bodies of the --block-segment-store and the downloads of the --block-archive-source "+
+			"are stored in this directory instead of the data directory, e.g. on a large, cheap disk.")
+	cmd.PersistentFlags().String("state-dir", "",
+		"When set, the chain DB, which holds the state, the block index, and the blocks that aren't in the "+
+			"--block-segment-store, is stored in this directory instead of the data directory, e.g. on an NVMe disk. "+
+			"The txindex and the node's other files stay in the data directory.")
+	cmd.PersistentFlags().String("ancestral-records-dir", "",
+		"When set, the snapshot's ancestral records, from which the snapshot chunks served to hypersyncing peers "+
+			"are built, are stored in a DB of their own in this directory instead of in the chain DB. Can only be "+
+			"set before the node first reaches a snapshot height, and must be set every time the node starts.")
 	cmd.PersistentFlags().String("mempool-dump-dir", "",
 		"When set, the mempool is initialized using a db in the directory specified, and"+
 			"subsequent dumps are also written to this dir")
@@ -54,6 +65,31 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"ids to transaction information. This enables the use of certain API calls "+
 			"like ones that allow the lookup of particular transactions by their ID. "+
 			"Defaults to false because the index can be large.")
+	cmd.PersistentFlags().Bool("block-segment-store", false,
+		"When set to true, new block bodies are stored in append-only segment files in the data directory "+
+			"and read through memory maps, instead of in badger. This reduces compaction work and speeds up "+
+			"block reads. Blocks stored in badger before the flag was set are still read from badger.")
+	cmd.PersistentFlags().Bool("db-integrity-check", true,
+		"When set to true, the node checks the chain DB on startup for unknown prefixes, entries that don't "+
+			"decode, a broken best chain, inconsistent snapshot metadata, and unknown encoder migrations, and logs "+
+			"every issue it finds along with a suggested remediation. The check only reads a bounded sample of "+
+			"the DB.")
+	cmd.PersistentFlags().Bool("db-integrity-check-strict", false,
+		"When set to true, the node refuses to start if the --db-integrity-check finds errors, rather than "+
+			"only logging them.")
+	cmd.PersistentFlags().String("data-encryption-key-file", "",
+		"When set, the node's databases, including the txindex and the mempool dumps, are encrypted at rest with "+
+			"the hex-encoded AES-128, AES-192, or AES-256 key stored in this file. Encryption can only be turned on "+
+			"for a new data directory, and the same key must be supplied every time the node starts.")
+	cmd.PersistentFlags().String("data-encryption-key-command", "",
+		"When set, the node's databases are encrypted at rest with the hex-encoded key printed by this shell "+
+			"command, e.g. a KMS CLI call that decrypts a wrapped key. Takes the place of --data-encryption-key-file "+
+			"for operators who don't want the key stored on disk.")
+	cmd.PersistentFlags().String("block-archive-source", "",
+		"When set, the node imports the blocks of the block archive at this base URL or local directory "+
+			"before it starts syncing from peers. Archives are written with the export-blocks command and can "+
+			"be served from any static file host. Every block is checked as if it came from a peer, and if the "+
+			"import fails, the node syncs the remaining blocks from its peers.")
 	cmd.PersistentFlags().Bool("regtest", false,
 		"Can only be used in conjunction with --testnet. Creates a private testnet node with fast block times"+
 			"and instantly spendable block rewards.")
@@ -77,6 +113,33 @@ func SetupRunFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().Bool("disable-encoder-migrations", false, "Disable badgerDB encoder migrations")
 	// Semephore cap that limits the number of snapshot chunks stored in the OperationChannel during hypersync.
 	cmd.PersistentFlags().Uint32("hypersync-max-queue-size", lib.HypersyncDefaultMaxQueueSize, "Limit number of snapshot chunks stored in the OperationChannel during hypersync.")
+	cmd.PersistentFlags().Uint32("hypersync-chunk-apply-workers", lib.HypersyncDefaultChunkApplyWorkers,
+		"Number of snapshot chunks of different prefixes that are written to the db at the same time during "+
+			"hypersync. Set to 1 to write chunks one at a time.")
+	// Trusted signers of v2 snapshot state roots.
+	cmd.PersistentFlags().StringSlice("trusted-snapshot-signer-public-keys", []string{},
+		"A comma-separated list of BLS public keys. When hypersyncing from peers that serve the v2 snapshot "+
+			"format, the node only accepts a snapshot state root signed by one of these keys. If empty, the "+
+			"node doesn't use the v2 format and hypersyncs in the v1 format from its sync peer.")
+	cmd.PersistentFlags().Bool("continuous-checksum", false,
+		"Keep the state checksum up to date on every flush and record it for every block, so that the state "+
+			"can be compared with other nodes at any block rather than just at snapshot heights. Requires "+
+			"--hypersync. The first time it's enabled, the checksum is computed from the existing state, which "+
+			"can take a while.")
+	cmd.PersistentFlags().Bool("state-commitment", false,
+		"Maintain a Merkle trie over the state that produces a state root for every block, which can be used to "+
+			"prove state values and to detect state divergence. Requires --hypersync. The first time it's enabled, "+
+			"the trie is built from the existing state, which can take a while.")
+	cmd.PersistentFlags().Uint64("state-cache-max-bytes", 0,
+		"The size of an in-memory LRU cache of hot state entries, i.e. profiles, global params, and follows, "+
+			"that saves disk reads under heavy API load. Requires --hypersync. Set to 0 to disable the cache.")
+	cmd.PersistentFlags().Uint64("undo-data-retention-blocks", lib.DefaultUndoDataRetentionBlocks,
+		"The number of final blocks whose undo data, i.e. UtxoOperations, is kept. The undo data of older blocks "+
+			"is deleted once they're final, since the chain can't reorg past them. Set to 0 to keep the undo data "+
+			"of every block.")
+	cmd.PersistentFlags().Bool("archival-undo-data", false,
+		"Keep the undo data of every block regardless of --undo-data-retention-blocks. Use this on archival "+
+			"nodes and on nodes that replay the history of old blocks.")
 	// Disable slow sync
 	cmd.PersistentFlags().String("sync-type", "any", `We have the following options for SyncType:
 		- any: Will sync with a node no matter what kind of syncing it supports.
@@ -91,6 +154,23 @@ func SetupRunFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().String("pos-validator-seed", "", "A BIP39 seed phrase or seed hex used to generate the "+
 		"private key of the Proof of Stake validator. Setting this flag automatically makes the node run as a Proof "+
 		"of Stake Validator.")
+	cmd.PersistentFlags().Bool("pos-validator-allow-new-slashing-protection-db", false, "When set, a PoS validator "+
+		"is allowed to start with an empty slashing protection database if none exists in the data directory. "+
+		"By default, the node refuses to start a validator without its signing history, since that history is "+
+		"what prevents it from signing conflicting votes or timeouts. Only set this on a brand new validator, or "+
+		"when you are certain no other node has signed with the same key.")
+	cmd.PersistentFlags().String("pos-validator-slashing-protection-dir", "", "The directory in which the "+
+		"PoS validator's slashing protection database is stored. Defaults to the data directory. A validator and "+
+		"its standby must share this directory, e.g. on a network file system.")
+	cmd.PersistentFlags().Bool("pos-validator-standby", false, "When set, the node runs as a hot standby of the "+
+		"PoS validator with the same --pos-validator-seed. The standby syncs the chain but doesn't sign anything "+
+		"while it receives heartbeats from the primary, which it should be connected to, e.g. with --connect-ips. "+
+		"If the primary goes silent, the standby opens the shared slashing protection database in "+
+		"--pos-validator-slashing-protection-dir and takes over signing. The database can only be opened by one "+
+		"node at a time, so the standby can't take over while the primary's process is still running.")
+	cmd.PersistentFlags().Uint64("pos-validator-standby-takeover-timeout-seconds",
+		lib.DefaultValidatorStandbyTakeoverTimeoutSeconds, "How long a PoS validator standby waits without a "+
+			"heartbeat from the primary before it takes over signing.")
 
 	// Mempool
 	cmd.PersistentFlags().Uint64("mempool-backup-time-millis", 30000,
@@ -98,6 +178,39 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"The default value is 30 seconds, or 30,000 milliseconds.")
 	cmd.PersistentFlags().Uint64("mempool-max-validation-view-connects", 10000,
 		"The maximum number of connects that the PoS mempool transaction validation routine will perform.")
+	cmd.PersistentFlags().Uint64("mempool-max-size-bytes", 0,
+		"The memory budget in bytes for the PoS mempool. When the mempool is full, the transactions with the "+
+			"lowest ancestor-package fee rate are evicted first. The mempool never exceeds the network-wide "+
+			"MempoolMaxSizeBytes global param, so this can only lower the limit. The default value of 0 means "+
+			"that only the global param applies.")
+	cmd.PersistentFlags().Uint64("mempool-max-queued-txns-per-public-key", 16,
+		"The maximum number of transactions per public key that the PoS mempool holds in its nonce queue. "+
+			"Transactions whose nonce expires too far in the future are queued until the block height catches "+
+			"up, instead of being rejected. Set to 0 to reject these transactions.")
+	cmd.PersistentFlags().Uint64("mempool-validation-workers", lib.PosMempoolDefaultValidationWorkers,
+		"The number of transactions the PoS mempool pre-checks at the same time before taking its lock. The "+
+			"pre-checks verify the sanity, the fee, and the signature of the transaction. Set to 0 to use the "+
+			"default.")
+	cmd.PersistentFlags().Uint64("mempool-non-local-txn-ttl-seconds", 0,
+		"How long a transaction relayed by a peer can stay in the PoS mempool before it expires. Transactions "+
+			"submitted to this node don't expire this way. Set to 0 to keep relayed transactions until they're "+
+			"confirmed or their nonce expires.")
+	cmd.PersistentFlags().Uint64("mempool-local-txn-rebroadcast-interval-seconds", 60,
+		"How often the transactions submitted to this node are rebroadcast to all peers until they're confirmed "+
+			"or dropped from the mempool. Set to 0 to never rebroadcast them.")
+	cmd.PersistentFlags().Uint64("mempool-max-txns-per-public-key", 0,
+		"The maximum number of transactions a single public key can hold in the PoS mempool. Transactions that "+
+			"would put their public key over the limit are rejected, so that a single public key can't take over "+
+			"the mempool. Set to 0 for no limit.")
+	cmd.PersistentFlags().Uint64("mempool-max-bytes-per-public-key", 0,
+		"The maximum total size in bytes of the transactions a single public key can hold in the PoS mempool. "+
+			"Set to 0 for no limit.")
+	cmd.PersistentFlags().Uint64("mempool-burst-txns-per-public-key", 0,
+		"The number of transactions a public key can hold over --mempool-max-txns-per-public-key while the PoS "+
+			"mempool is less than half full.")
+	cmd.PersistentFlags().Uint64("mempool-burst-bytes-per-public-key", 0,
+		"The number of bytes a public key can hold over --mempool-max-bytes-per-public-key while the PoS "+
+			"mempool is less than half full.")
 	cmd.PersistentFlags().Uint64("transaction-validation-refresh-interval-millis", 10,
 		"The frequency in milliseconds with which the transaction validation routine is run in mempool. "+
 			"The default value is 10 milliseconds.")
@@ -120,6 +233,10 @@ func SetupRunFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().Uint64("stall-timeout-seconds", 900,
 		"How long the node will wait for a peer to reply to certain types of requests. "+
 			"We make this gratuitous just in case the node we're connecting to is backed up.")
+	cmd.PersistentFlags().Uint64("block-stall-timeout-seconds", 60,
+		"How long the node will wait for a peer to send the blocks it requested before disconnecting "+
+			"from the peer and requesting the blocks from another peer. Large block bundles get one "+
+			"timeout per 250 blocks, up to --stall-timeout-seconds. If set to 0, --stall-timeout-seconds is used.")
 
 	// Peer Restrictions
 	cmd.PersistentFlags().Bool("private-mode", false, "The node does not look up addresses from DNS seeds.")
@@ -136,6 +253,45 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"our connections and potentially make onerous requests as well. Useful to "+
 			"disable this flag when testing locally to allow multiple inbound connections "+
 			"from test servers")
+	cmd.PersistentFlags().String("peer-request-rate-limits", "",
+		"A comma-separated list of type=rate:burst entries that override the budgets of the GetHeaders, "+
+			"GetBlocks, and GetSnapshot requests each peer can send, e.g. \"get_snapshot=2:20,get_blocks=0:0\". "+
+			"The rate is in requests per second, and a rate of 0 disables the limit. Requests over budget are "+
+			"dropped, and peers that keep exceeding their budget are disconnected. The defaults are "+
+			"get_headers=10:100, get_blocks=10:100, and get_snapshot=5:40.")
+	cmd.PersistentFlags().Uint64("txn-reconciliation-interval-millis", lib.DefaultTxnReconciliationIntervalMillis,
+		"How often the node reconciles its mempool with each outbound peer that supports transaction "+
+			"reconciliation. Transactions are flooded to only a few of the peers that support it, and the "+
+			"rest learn about them by exchanging sketches of the transactions they're missing, which uses far "+
+			"less bandwidth than flooding INVs. If set to 0, the node floods transactions to every peer.")
+	cmd.PersistentFlags().Bool("compact-block-relay", true,
+		"When set to true, the node announces new blocks to the peers that support it with compact blocks, "+
+			"which carry short IDs of the block's transactions instead of the transactions themselves. Peers "+
+			"reconstruct the block from their mempool and only fetch the transactions they're missing, which "+
+			"cuts the bandwidth and latency of block propagation.")
+	cmd.PersistentFlags().Uint64("fee-telemetry-interval-seconds", lib.DefaultFeeTelemetryIntervalSeconds,
+		"How often the node shares a summary of its mempool's fee rates with the peers that support fee "+
+			"telemetry. The summaries it receives are aggregated with its own into a network-wide fee estimate, "+
+			"which is more robust than the estimate of a single mempool. If set to 0, the node neither shares "+
+			"nor aggregates fee telemetry.")
+	cmd.PersistentFlags().Uint64("txn-message-workers", lib.DefaultTxnMessageWorkers,
+		"The number of workers that process the INVs, transaction bundles, and other transaction relay messages "+
+			"received from peers. These messages are processed separately from votes, timeouts, and blocks, which "+
+			"are always handled first. A peer's transaction relay messages that arrive while its worker is backed "+
+			"up are dropped.")
+
+	// Proxy
+	cmd.PersistentFlags().String("proxy", "",
+		"The host:port of a SOCKS5 proxy, such as a Tor daemon, that all outbound peer connections are made "+
+			"through. When set, hostnames are also resolved through the proxy, which requires the proxy to be Tor.")
+	cmd.PersistentFlags().String("proxy-user", "", "The username for the SOCKS5 proxy set with --proxy.")
+	cmd.PersistentFlags().String("proxy-pass", "", "The password for the SOCKS5 proxy set with --proxy.")
+	cmd.PersistentFlags().String("onion-proxy", "",
+		"The host:port of a SOCKS5 proxy that connections to .onion peers are made through. If it isn't set, "+
+			"connections to .onion peers use --proxy. If neither is set, .onion peers are never dialed.")
+	cmd.PersistentFlags().StringSlice("peer-proxies", []string{},
+		"A comma-separated list of peerHost:peerPort=proxyHost:proxyPort entries that route the connection to "+
+			"a specific peer through its own SOCKS5 proxy, overriding --proxy and --onion-proxy.")
 
 	cmd.PersistentFlags().Uint64("peer-connection-refresh-interval-millis", 10000,
 		"The frequency in milliseconds with which the node will refresh its peer connections. This applies to"+
@@ -209,6 +365,20 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"be signed by one of these keys in order to be considered valid. Setting this value to zero "+
 			"enforces that all blocks after genesis must be signed by a trusted block producer. The default "+
 			"value was chosen to be in-line with the default trusted public keys chosen.")
+	cmd.PersistentFlags().StringSlice("block-inclusion-excluded-txn-types", []string{},
+		"A comma-separated list of TxnTypes, e.g. NFT_BID,CREATE_NFT, that this node never includes in the PoS "+
+			"blocks it produces. Blocks from other validators that include them are still accepted.")
+	cmd.PersistentFlags().StringSlice("block-inclusion-excluded-public-keys", []string{},
+		"A comma-separated list of public keys whose transactions this node never includes in the PoS blocks "+
+			"it produces. Blocks from other validators that include them are still accepted.")
+	cmd.PersistentFlags().String("block-inclusion-min-fee-rates", "",
+		"A comma-separated list of type=rate entries with the minimum fee rate, in nanos per KB, that a "+
+			"transaction of each TxnType must pay to be included in the PoS blocks this node produces, e.g. "+
+			"\"default=2000,NFT_BID=5000\". The default entry applies to every TxnType without its own entry.")
+	cmd.PersistentFlags().Bool("block-producer-deterministic-txn-shuffle", false,
+		"When set, the blocks this node produces order their transactions by fee band, and within a fee band "+
+			"by a shuffle seeded by the previous block hash, instead of by the order they arrived in. Networks "+
+			"that enforce the shuffle from the DeterministicTxnShuffleBlockHeight fork on use it regardless.")
 
 	// Logging
 	cmd.PersistentFlags().String("log-dir", "", "The directory for logs")
@@ -218,19 +388,74 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"where pattern is a literal file name (minus the \".go\" suffix) or \"glob\" "+
 			"pattern and N is a V level. For instance, -vmodule=gopher*=3 sets the V "+
 			"level to 3 in all Go files whose names begin \"gopher\".")
+	cmd.PersistentFlags().String("log-format", "text",
+		"The format of the logs of the networking and consensus components. Either \"text\", which writes them "+
+			"through glog, or \"json\", which writes each message to stderr as a JSON object with its component "+
+			"and fields, e.g. the peer ID or the block hash.")
+	cmd.PersistentFlags().String("log-component-levels", "",
+		"A comma-separated list of component=level pairs that set the minimum level logged by each component, "+
+			"e.g. \"peer=warning,consensus=debug\". The components are server, peer, connmgr, netmgr, and "+
+			"consensus, and the levels are debug, info, warning, and error. Components without a level log at the "+
+			"info level, and their debug logs follow --glog-v.")
 	cmd.PersistentFlags().Bool("log-db-summary-snapshots", false, "The node will log a snapshot of all DB keys every 30s.")
 	cmd.PersistentFlags().Bool("datadog-profiler", false, "Enable the DataDog profiler for performance testing")
 	cmd.PersistentFlags().Bool("time-events", false, "Enable simple event timer, helpful in hands-on performance testing")
+	cmd.PersistentFlags().Uint64("trace-log-threshold-millis", 0, "When set, the node traces block processing, "+
+		"transaction connection, DB flushes, and mempool admission, and logs every span that takes at least this "+
+		"many milliseconds. Defaults to zero, which disables tracing.")
 	cmd.PersistentFlags().String("state-change-dir", "", "The directory for state change logs. WARNING: Changing this "+
 		"from an empty string to a non-empty string (or from a non-empty string to the empty string) requires a resync.")
 	cmd.PersistentFlags().Uint("state-syncer-mempool-txn-sync-limit", 10000, "The maximum number of transactions to "+
 		"process in the mempool tx state syncer at a time.")
+	cmd.PersistentFlags().Uint64("state-change-file-max-size-bytes", 0, "When set, the committed state change file "+
+		"is rotated once it's larger than this many bytes, and the rotated files are deleted once every registered "+
+		"state change cursor has read past them. Defaults to zero, which never rotates the file.")
 
 	// PoS Checkpoint Syncing
 	cmd.PersistentFlags().StringSlice("checkpoint-syncing-providers", []string{}, fmt.Sprintf("A comma-separated list of URLs that "+
 		"supports the committed tip block info endpoint to be used for checkpoint syncing. "+
 		"If unset, the field will default to %v on mainnet and %v on testnet",
 		lib.DefaultMainnetCheckpointProvider, lib.DefaultTestnetCheckpointProvider))
+	cmd.PersistentFlags().String("block-checkpoints-file", "", "Path to a JSON file of trusted block "+
+		"checkpoints, in the form [{\"Height\": 123, \"HashHex\": \"00000a...\"}]. The checkpoints are added to the ones "+
+		"hardcoded for the network. Headers that conflict with a checkpoint, or that fork off the chain below one, are "+
+		"rejected, and the signatures of blocks below the latest checkpoint are not verified. Only use checkpoints from "+
+		"a source you trust.")
+	cmd.PersistentFlags().Uint64("max-reorg-depth", 0, "If set, PoW reorgs that would disconnect more than this "+
+		"many blocks aren't applied until the operator approves them through the admin RPC. Useful for exchanges that "+
+		"credit deposits after a fixed number of confirmations. Committed PoS blocks are never reorged. 0 means no limit.")
+
+	// Read Replicas
+	cmd.PersistentFlags().String("replication-listen-addr", "", "If set, the node acts as a replication "+
+		"primary and streams every db flush to the read replicas that connect to this address, e.g. 0.0.0.0:17500.")
+	cmd.PersistentFlags().String("replication-primary-addr", "", "If set, the node runs as a read replica of "+
+		"the primary at this address. A read replica doesn't sync or validate blocks itself; it applies the "+
+		"primary's db flushes directly and implies --disable-networking and --read-only-mode. The data directory "+
+		"must be bootstrapped from a copy of a cleanly stopped primary's data directory.")
+
+	// Admin RPC
+	cmd.PersistentFlags().String("admin-rpc-listen-addr", "", "If set, the node serves the admin RPC on this "+
+		"loopback address, e.g. 127.0.0.1:17010. The admin RPC lets the operator pause and resume the relaying "+
+		"and mining of specific transaction types at runtime, without restarting the node.")
+	cmd.PersistentFlags().String("admin-rpc-auth-token", "", "The token that admin RPC requests must send in "+
+		"an \"Authorization: Bearer <token>\" header. Required if --admin-rpc-listen-addr is set.")
+
+	// TxnType Metrics
+	cmd.PersistentFlags().Uint64("txn-type-metrics-window-blocks", lib.DefaultTxnTypeMetricsWindowBlocks,
+		"The number of recent blocks the node keeps per-transaction-type counts, sizes, and fees for. The "+
+			"metrics are served by the admin RPC. Set to 0 to disable them.")
+
+	// Health
+	cmd.PersistentFlags().String("health-listen-addr", "", "If set, the node serves its health on this address, "+
+		"e.g. 0.0.0.0:17011. GET /health reports sync progress, and GET /health/ready returns a 503 until the "+
+		"node is fully synced and connected to peers, so load balancers can route traffic only to ready nodes.")
+
+	// Epoch Export
+	cmd.PersistentFlags().String("epoch-export-dir", "", "If set, the node writes a JSON export of the total "+
+		"supply, staked totals, validator set, and fee burn to this directory at the end of every PoS epoch, "+
+		"named epoch-<number>.json.")
+	cmd.PersistentFlags().String("epoch-export-webhook-url", "", "If set, the node posts the JSON export "+
+		"written at the end of every PoS epoch to this URL, retrying a few times if it doesn't return a 2xx.")
 	cmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
 		viper.BindPFlag(flag.Name, flag)
 	})
@@ -0,0 +1,145 @@
+package consensus
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/core/collections/bitset"
+	"github.com/hashicorp/golang-lru/v2"
+)
+
+// DefaultAggregatedPublicKeyCacheSize is the default number of aggregated public keys an AggregatedPublicKeyCache
+// holds. Within an epoch, consecutive QCs are usually signed by the same few subsets of validators, so a small
+// cache is enough to get a high hit rate.
+const DefaultAggregatedPublicKeyCacheSize = 1024
+
+// AggregatedPublicKeyCache caches the aggregated BLS public keys of the signers of QCs, keyed by the epoch of the
+// validator set and the QC's signers bitset. Verifying a QC's aggregate signature against a cached aggregated
+// public key saves re-aggregating the public keys of all signers, which is the bulk of the cost of verifying a
+// QC with a large validator set.
+//
+// The cache doesn't trust that an (epoch, signersList) pair always maps to the same signers. Each entry also
+// stores the public keys it was aggregated from, and a hit is only used if those public keys are identical to
+// the signers' public keys in the validator set being verified against. Comparing the keys' bytes is far cheaper
+// than aggregating them, and it guarantees that a caller passing the wrong epoch can only cause a cache miss,
+// never an incorrect verification.
+//
+// The cache also holds the domain-separated hashes of the vote and timeout payloads that QCs are verified on. The
+// same QC is verified many times, e.g. as a block's QC and as the high QC of later timeouts, and its payload only
+// depends on its (View, BlockHash), so its hash is computed once and reused.
+type AggregatedPublicKeyCache struct {
+	mtx            sync.Mutex
+	cache          *lru.Cache[aggregatedPublicKeyCacheKey, *aggregatedPublicKeyCacheEntry]
+	hashedPayloads *lru.Cache[[32]byte, *bls.HashedPayload]
+
+	hits   uint64
+	misses uint64
+}
+
+type aggregatedPublicKeyCacheKey struct {
+	epoch       uint64
+	signersList string
+}
+
+type aggregatedPublicKeyCacheEntry struct {
+	signerPublicKeysBytes []byte
+	aggregatedPublicKey   *bls.PublicKey
+}
+
+func NewAggregatedPublicKeyCache(maxSize int) *AggregatedPublicKeyCache {
+	if maxSize <= 0 {
+		maxSize = DefaultAggregatedPublicKeyCacheSize
+	}
+	cache, _ := lru.New[aggregatedPublicKeyCacheKey, *aggregatedPublicKeyCacheEntry](maxSize)
+	hashedPayloads, _ := lru.New[[32]byte, *bls.HashedPayload](maxSize)
+	return &AggregatedPublicKeyCache{cache: cache, hashedPayloads: hashedPayloads}
+}
+
+// GetAggregatedPublicKey returns the aggregate of signerPublicKeys, which must be the public keys of the validators
+// in signersList, in the order they appear in the validator set of the given epoch. The aggregate is served from
+// the cache if possible, and computed and cached otherwise.
+func (apkc *AggregatedPublicKeyCache) GetAggregatedPublicKey(
+	epoch uint64,
+	signersList *bitset.Bitset,
+	signerPublicKeys []*bls.PublicKey,
+) (*bls.PublicKey, error) {
+	key := aggregatedPublicKeyCacheKey{epoch: epoch, signersList: string(signersList.ToBytes())}
+	var signerPublicKeysBytes []byte
+	for _, publicKey := range signerPublicKeys {
+		signerPublicKeysBytes = append(signerPublicKeysBytes, publicKey.ToBytes()...)
+	}
+
+	apkc.mtx.Lock()
+	entry, exists := apkc.cache.Get(key)
+	if exists && bytes.Equal(entry.signerPublicKeysBytes, signerPublicKeysBytes) {
+		apkc.hits++
+		apkc.mtx.Unlock()
+		return entry.aggregatedPublicKey, nil
+	}
+	apkc.misses++
+	apkc.mtx.Unlock()
+
+	// Aggregate outside the lock so that concurrent verifications of different QCs don't serialize.
+	aggregatedPublicKey, err := bls.AggregatePublicKeys(signerPublicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	apkc.mtx.Lock()
+	defer apkc.mtx.Unlock()
+	apkc.cache.Add(key, &aggregatedPublicKeyCacheEntry{
+		signerPublicKeysBytes: signerPublicKeysBytes,
+		aggregatedPublicKey:   aggregatedPublicKey,
+	})
+	return aggregatedPublicKey, nil
+}
+
+// GetHashedPayload returns the domain-separated hash of a vote or timeout signature payload. The hash is served
+// from the cache if possible, and computed and cached otherwise. The hits and misses of hashed payloads aren't
+// counted in GetStats.
+func (apkc *AggregatedPublicKeyCache) GetHashedPayload(payload [32]byte) *bls.HashedPayload {
+	if hashedPayload, exists := apkc.hashedPayloads.Get(payload); exists {
+		return hashedPayload
+	}
+	hashedPayload := bls.NewHashedPayload(payload[:])
+	apkc.hashedPayloads.Add(payload, hashedPayload)
+	return hashedPayload
+}
+
+// GetStats returns the number of cache hits and misses of aggregated public keys since the cache was created.
+func (apkc *AggregatedPublicKeyCache) GetStats() (_hits uint64, _misses uint64) {
+	apkc.mtx.Lock()
+	defer apkc.mtx.Unlock()
+	return apkc.hits, apkc.misses
+}
+
+// getHashedPayload returns the domain-separated hash of the payload from the cache, or computes it if cache is nil.
+func getHashedPayload(cache *AggregatedPublicKeyCache, payload [32]byte) *bls.HashedPayload {
+	if cache == nil {
+		return bls.NewHashedPayload(payload[:])
+	}
+	return cache.GetHashedPayload(payload)
+}
+
+// isValidSignatureManyPublicKeysWithCache is the same as isValidSignatureManyPublicKeys, except that it verifies
+// the signature against the cached aggregate of the signers' public keys and the cached hash of the payload. If
+// cache is nil, it falls back to isValidSignatureManyPublicKeys.
+func isValidSignatureManyPublicKeysWithCache(
+	cache *AggregatedPublicKeyCache,
+	epoch uint64,
+	signersList *bitset.Bitset,
+	publicKeys []*bls.PublicKey,
+	signature *bls.Signature,
+	payload [32]byte,
+) bool {
+	if cache == nil || len(publicKeys) == 0 {
+		return isValidSignatureManyPublicKeys(publicKeys, signature, payload[:])
+	}
+	aggregatedPublicKey, err := cache.GetAggregatedPublicKey(epoch, signersList, publicKeys)
+	if err != nil {
+		return false
+	}
+	isValid, err := aggregatedPublicKey.VerifyHashedPayload(signature, cache.GetHashedPayload(payload))
+	return err == nil && isValid
+}
@@ -0,0 +1,149 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/core/collections/bitset"
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsValidSuperMajorityQuorumCertificateWithCache(t *testing.T) {
+	validatorPrivateKey1 := createDummyBLSPrivateKey()
+	validatorPrivateKey2 := createDummyBLSPrivateKey()
+	validatorPrivateKey3 := createDummyBLSPrivateKey()
+
+	validator1 := validator{publicKey: validatorPrivateKey1.PublicKey(), stakeAmount: uint256.NewInt(3)}
+	validator2 := validator{publicKey: validatorPrivateKey2.PublicKey(), stakeAmount: uint256.NewInt(2)}
+	validator3 := validator{publicKey: validatorPrivateKey3.PublicKey(), stakeAmount: uint256.NewInt(1)}
+	validators := []Validator{&validator1, &validator2, &validator3}
+
+	// Validators 1 and 2 sign two different blocks.
+	newQC := func(view uint64) *quorumCertificate {
+		blockHash := createDummyBlockHash()
+		signaturePayload := GetVoteSignaturePayload(view, blockHash)
+		validator1Signature, err := validatorPrivateKey1.Sign(signaturePayload[:])
+		require.NoError(t, err)
+		validator2Signature, err := validatorPrivateKey2.Sign(signaturePayload[:])
+		require.NoError(t, err)
+		signature, err := bls.AggregateSignatures([]*bls.Signature{validator1Signature, validator2Signature})
+		require.NoError(t, err)
+		return &quorumCertificate{
+			blockHash: blockHash,
+			view:      view,
+			aggregatedSignature: &aggregatedSignature{
+				signersList: bitset.NewBitset().FromBytes([]byte{0x3}), // 0b0011, which represents validators 1 and 2
+				signature:   signature,
+			},
+		}
+	}
+	qc1 := newQC(10)
+	qc2 := newQC(11)
+
+	cache := NewAggregatedPublicKeyCache(0)
+
+	// The first QC aggregates the signers' public keys, and the second QC reuses them.
+	require.True(t, IsValidSuperMajorityQuorumCertificateWithCache(qc1, validators, 1, cache))
+	require.True(t, IsValidSuperMajorityQuorumCertificateWithCache(qc2, validators, 1, cache))
+	hits, misses := cache.GetStats()
+	require.Equal(t, uint64(1), hits)
+	require.Equal(t, uint64(1), misses)
+
+	// A QC with a tampered signature still fails with a cache hit.
+	tamperedQC := *qc2
+	tamperedQC.view = 12
+	require.False(t, IsValidSuperMajorityQuorumCertificateWithCache(&tamperedQC, validators, 1, cache))
+
+	// A different validator set under the same epoch and signers list isn't served from the cache. The QC was not
+	// signed by the new validators, so it is rejected.
+	otherValidator1 := validator{publicKey: createDummyBLSPrivateKey().PublicKey(), stakeAmount: uint256.NewInt(3)}
+	otherValidators := []Validator{&otherValidator1, &validator2, &validator3}
+	require.False(t, IsValidSuperMajorityQuorumCertificateWithCache(qc1, otherValidators, 1, cache))
+	hits, misses = cache.GetStats()
+	require.Equal(t, uint64(2), hits)
+	require.Equal(t, uint64(2), misses)
+
+	// The cached and uncached verifications agree.
+	require.True(t, IsValidSuperMajorityQuorumCertificate(qc1, validators))
+	require.False(t, IsValidSuperMajorityQuorumCertificate(qc1, otherValidators))
+}
+
+func TestIsValidSuperMajorityAggregateQuorumCertificateWithCache(t *testing.T) {
+	validatorPrivateKey1 := createDummyBLSPrivateKey()
+	validatorPrivateKey2 := createDummyBLSPrivateKey()
+	validatorPrivateKey3 := createDummyBLSPrivateKey()
+
+	validator1 := validator{publicKey: validatorPrivateKey1.PublicKey(), stakeAmount: uint256.NewInt(3)}
+	validator2 := validator{publicKey: validatorPrivateKey2.PublicKey(), stakeAmount: uint256.NewInt(2)}
+	validator3 := validator{publicKey: validatorPrivateKey3.PublicKey(), stakeAmount: uint256.NewInt(1)}
+	validators := []Validator{&validator1, &validator2, &validator3}
+
+	// Validators 1 and 2 sign the high QC.
+	view := uint64(10)
+	blockHash := createDummyBlockHash()
+	votePayload := GetVoteSignaturePayload(view, blockHash)
+	validator1VoteSignature, err := validatorPrivateKey1.Sign(votePayload[:])
+	require.NoError(t, err)
+	validator2VoteSignature, err := validatorPrivateKey2.Sign(votePayload[:])
+	require.NoError(t, err)
+	highQCSignature, err := bls.AggregateSignatures([]*bls.Signature{validator1VoteSignature, validator2VoteSignature})
+	require.NoError(t, err)
+	highQC := &quorumCertificate{
+		blockHash: blockHash,
+		view:      view,
+		aggregatedSignature: &aggregatedSignature{
+			signersList: bitset.NewBitset().FromBytes([]byte{0x3}), // 0b0011, which represents validators 1 and 2
+			signature:   highQCSignature,
+		},
+	}
+
+	// Validators 1 and 2 time out with the high QC, and validator 3 with an older one.
+	timeoutView := view + 2
+	signTimeout := func(privateKey *bls.PrivateKey, highQCView uint64) *bls.Signature {
+		timeoutPayload := GetTimeoutSignaturePayload(timeoutView, highQCView)
+		signature, err := privateKey.Sign(timeoutPayload[:])
+		require.NoError(t, err)
+		return signature
+	}
+	timeoutSignature, err := bls.AggregateSignatures([]*bls.Signature{
+		signTimeout(validatorPrivateKey1, view),
+		signTimeout(validatorPrivateKey2, view),
+		signTimeout(validatorPrivateKey3, view-1),
+	})
+	require.NoError(t, err)
+	aggQC := &aggregateQuorumCertificate{
+		view:        timeoutView,
+		highQC:      highQC,
+		highQCViews: []uint64{view, view, view - 1},
+		aggregatedSignature: &aggregatedSignature{
+			signersList: bitset.NewBitset().FromBytes([]byte{0x7}), // 0b0111, which represents all validators
+			signature:   timeoutSignature,
+		},
+	}
+
+	cache := NewAggregatedPublicKeyCache(0)
+
+	// The cached and uncached verifications agree.
+	require.True(t, IsValidSuperMajorityAggregateQuorumCertificateWithCache(aggQC, validators, validators, 1, cache))
+	require.True(t, IsValidSuperMajorityAggregateQuorumCertificate(aggQC, validators, validators))
+
+	// The hashes of the vote and timeout payloads were cached, and are reused.
+	for _, payload := range [][32]byte{
+		votePayload,
+		GetTimeoutSignaturePayload(timeoutView, view),
+		GetTimeoutSignaturePayload(timeoutView, view-1),
+	} {
+		hashedPayload, exists := cache.hashedPayloads.Get(payload)
+		require.True(t, exists)
+		require.Equal(t, payload[:], hashedPayload.GetPayloadBytes())
+		require.Same(t, hashedPayload, cache.GetHashedPayload(payload))
+	}
+	require.True(t, IsValidSuperMajorityAggregateQuorumCertificateWithCache(aggQC, validators, validators, 1, cache))
+
+	// A tampered aggregate QC still fails with the payload hashes cached.
+	tamperedAggQC := *aggQC
+	tamperedAggQC.highQCViews = []uint64{view, view - 1, view - 1}
+	require.False(t, IsValidSuperMajorityAggregateQuorumCertificateWithCache(&tamperedAggQC, validators, validators, 1, cache))
+	require.False(t, IsValidSuperMajorityAggregateQuorumCertificate(&tamperedAggQC, validators, validators))
+}
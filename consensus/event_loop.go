@@ -15,10 +15,11 @@ import (
 
 func NewFastHotStuffEventLoop() *fastHotStuffEventLoop {
 	return &fastHotStuffEventLoop{
-		status:          eventLoopStatusNotInitialized,
-		crankTimerTask:  NewScheduledTask[uint64](),
-		nextTimeoutTask: NewScheduledTask[uint64](),
-		Events:          make(chan *FastHotStuffEvent, signalChannelBufferSize),
+		status:                              eventLoopStatusNotInitialized,
+		crankTimerTask:                      NewScheduledTask[uint64](),
+		nextTimeoutTask:                     NewScheduledTask[uint64](),
+		timeoutBackoffMultiplierBasisPoints: defaultTimeoutBackoffMultiplierBasisPoints,
+		Events:                              make(chan *FastHotStuffEvent, signalChannelBufferSize),
 	}
 }
 
@@ -239,6 +240,26 @@ func (fe *fastHotStuffEventLoop) UpdateSafeBlocks(safeBlocks []BlockWithValidato
 	return nil
 }
 
+// SetTimeoutBackoffMultiplier sets the multiplier, in basis points, that is applied to the timeout base
+// duration for every consecutive timeout. The multiplier must be >= 10000 (1x). The new multiplier is
+// used the next time a timeout is scheduled, which happens when the view advances. The server calls this
+// alongside ProcessTipBlock so that the back-off follows the multiplier in the chain's global params.
+func (fe *fastHotStuffEventLoop) SetTimeoutBackoffMultiplier(multiplierBasisPoints uint64) error {
+	// Grab the event loop's lock
+	fe.lock.Lock()
+	defer fe.lock.Unlock()
+
+	if multiplierBasisPoints < minTimeoutBackoffMultiplierBasisPoints {
+		return errors.Errorf(
+			"FastHotStuffEventLoop.SetTimeoutBackoffMultiplier: Multiplier must be >= %d basis points",
+			minTimeoutBackoffMultiplierBasisPoints,
+		)
+	}
+
+	fe.timeoutBackoffMultiplierBasisPoints = multiplierBasisPoints
+	return nil
+}
+
 // storeBlocks is a helper function that validates the provided blocks, validator lists, and stores them.
 // It must be called while holding the event loop's lock.
 func (fe *fastHotStuffEventLoop) storeBlocks(tip BlockWithValidatorList, safeBlocks []BlockWithValidatorList) error {
@@ -610,8 +631,9 @@ func (fe *fastHotStuffEventLoop) resetScheduledTasks() {
 		// currentView > tip.block.GetView() + 1.
 		numTimeouts := fe.currentView - fe.tip.block.GetView() - 1
 
-		// Compute the exponential back-off: nextTimeoutDuration * 2^numTimeouts
-		timeoutDuration = fe.timeoutBaseDuration * time.Duration(powerOfTwo(numTimeouts, maxConsecutiveTimeouts))
+		// Compute the exponential back-off: nextTimeoutDuration * multiplier^numTimeouts
+		timeoutDuration = computeTimeoutBackoffDuration(
+			fe.timeoutBaseDuration, fe.timeoutBackoffMultiplierBasisPoints, numTimeouts, maxConsecutiveTimeouts)
 	}
 
 	// Schedule the next crank timer task. This will run with currentView param.
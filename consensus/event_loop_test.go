@@ -862,6 +862,21 @@ func TestResetEventLoopSignal(t *testing.T) {
 	require.Equal(t, fc.crankTimerTask.GetDuration(), oneHourInNanoSecs)     // 1 hour away
 	require.Equal(t, fc.nextTimeoutTask.GetDuration(), 16*oneHourInNanoSecs) // 2 hours * 2^3 = 16 hours away
 
+	// Multipliers below 1x are rejected
+	require.Error(t, fc.SetTimeoutBackoffMultiplier(9999))
+
+	// Lower the back-off multiplier to 1.5x. It applies the next time the view advances.
+	require.NoError(t, fc.SetTimeoutBackoffMultiplier(15000))
+	require.Equal(t, fc.nextTimeoutTask.GetDuration(), 16*oneHourInNanoSecs) // Still 16 hours away
+
+	// Advance the view to simulate a 4th timeout
+	_, err = fc.AdvanceViewOnTimeout()
+	require.NoError(t, err)
+
+	// Confirm the ETAs for the crank timer and timeout timer
+	require.Equal(t, fc.crankTimerTask.GetDuration(), oneHourInNanoSecs)          // 1 hour away
+	require.Equal(t, fc.nextTimeoutTask.GetDuration(), oneHourInNanoSecs*2*81/16) // 2 hours * 1.5^4 = 10.125 hours away
+
 	// Stop the event loop
 	fc.Stop()
 }
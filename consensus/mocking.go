@@ -3,18 +3,19 @@ package consensus
 import "time"
 
 type MockFastHotStuffEventLoop struct {
-	OnGetEvents               func() chan *FastHotStuffEvent
-	OnInit                    func(time.Duration, time.Duration, QuorumCertificate, BlockWithValidatorList, []BlockWithValidatorList) error
-	OnGetCurrentView          func() uint64
-	OnAdvanceViewOnTimeout    func() (uint64, error)
-	OnProcessTipBlock         func(BlockWithValidatorList, []BlockWithValidatorList, time.Duration, time.Duration) error
-	OnUpdateSafeBlocks        func([]BlockWithValidatorList) error
-	OnProcessValidatorVote    func(VoteMessage) error
-	OnProcessValidatorTimeout func(TimeoutMessage) error
-	OnStart                   func()
-	OnStop                    func()
-	OnIsInitialized           func() bool
-	OnIsRunning               func() bool
+	OnGetEvents                   func() chan *FastHotStuffEvent
+	OnInit                        func(time.Duration, time.Duration, QuorumCertificate, BlockWithValidatorList, []BlockWithValidatorList) error
+	OnGetCurrentView              func() uint64
+	OnAdvanceViewOnTimeout        func() (uint64, error)
+	OnProcessTipBlock             func(BlockWithValidatorList, []BlockWithValidatorList, time.Duration, time.Duration) error
+	OnSetTimeoutBackoffMultiplier func(uint64) error
+	OnUpdateSafeBlocks            func([]BlockWithValidatorList) error
+	OnProcessValidatorVote        func(VoteMessage) error
+	OnProcessValidatorTimeout     func(TimeoutMessage) error
+	OnStart                       func()
+	OnStop                        func()
+	OnIsInitialized               func() bool
+	OnIsRunning                   func() bool
 }
 
 func (fc *MockFastHotStuffEventLoop) GetEvents() chan *FastHotStuffEvent {
@@ -41,6 +42,10 @@ func (fc *MockFastHotStuffEventLoop) ProcessTipBlock(
 	return fc.OnProcessTipBlock(tipBlock, safeBlocks, crankTimerDuration, timeoutTimerDuration)
 }
 
+func (fc *MockFastHotStuffEventLoop) SetTimeoutBackoffMultiplier(multiplierBasisPoints uint64) error {
+	return fc.OnSetTimeoutBackoffMultiplier(multiplierBasisPoints)
+}
+
 func (fc *MockFastHotStuffEventLoop) UpdateSafeBlocks(safeBlocks []BlockWithValidatorList) error {
 	return fc.OnUpdateSafeBlocks(safeBlocks)
 }
@@ -57,6 +57,14 @@ func (opCode SignatureOpCode) ToBytes() []byte {
 // doesn't get stuck in a near indefinite back-off state.
 const maxConsecutiveTimeouts = 16
 
+// The default multiplier, in basis points, that the event loop applies to the timeout base duration
+// for every consecutive timeout. The multiplier can't be less than 1x, so that timeouts never get
+// shorter as they back off.
+const (
+	defaultTimeoutBackoffMultiplierBasisPoints = 20000 // 2x
+	minTimeoutBackoffMultiplierBasisPoints     = 10000 // 1x
+)
+
 // Create an alias type of the 32 bit block hash so that the raw [32]byte type isn't
 // ambiguously repeated in the code base
 type BlockHashValue = [32]byte
@@ -71,6 +79,7 @@ type FastHotStuffEventLoop interface {
 	GetCurrentView() uint64
 	AdvanceViewOnTimeout() (uint64, error)
 	ProcessTipBlock(BlockWithValidatorList, []BlockWithValidatorList, time.Duration, time.Duration) error
+	SetTimeoutBackoffMultiplier(uint64) error
 	UpdateSafeBlocks([]BlockWithValidatorList) error
 	ProcessValidatorVote(VoteMessage) error
 	ProcessValidatorTimeout(TimeoutMessage) error
@@ -184,6 +193,8 @@ type fastHotStuffEventLoop struct {
 
 	crankTimerInterval  time.Duration
 	timeoutBaseDuration time.Duration
+	// The multiplier, in basis points, applied to the timeout base duration for every consecutive timeout.
+	timeoutBackoffMultiplierBasisPoints uint64
 
 	crankTimerTask  *ScheduledTask[uint64]
 	nextTimeoutTask *ScheduledTask[uint64]
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/binary"
+	"math"
+	"math/big"
 	"reflect"
+	"time"
 
 	"github.com/deso-protocol/core/bls"
 	"github.com/deso-protocol/core/collections"
@@ -48,6 +51,18 @@ func isProperlyFormedGenericEvent(event *FastHotStuffEvent) bool {
 // Given a QC and a sorted validator list, this function returns true if the QC contains a valid
 // super-majority of signatures from the validator list for the QC's (View, BlockHash) pair.
 func IsValidSuperMajorityQuorumCertificate(qc QuorumCertificate, validators []Validator) bool {
+	return IsValidSuperMajorityQuorumCertificateWithCache(qc, validators, 0, nil)
+}
+
+// IsValidSuperMajorityQuorumCertificateWithCache is the same as IsValidSuperMajorityQuorumCertificate, except that
+// the aggregated public key of the QC's signers is looked up in the provided cache under the epoch of the validator
+// set, and so is the hash of the QC's payload. The cache is optional.
+func IsValidSuperMajorityQuorumCertificateWithCache(
+	qc QuorumCertificate,
+	validators []Validator,
+	epoch uint64,
+	cache *AggregatedPublicKeyCache,
+) bool {
 	if !isProperlyFormedQC(qc) || !isProperlyFormedValidatorSet(validators) {
 		return false
 	}
@@ -60,7 +75,14 @@ func IsValidSuperMajorityQuorumCertificate(qc QuorumCertificate, validators []Va
 		return false
 	}
 
-	return isValidSignatureManyPublicKeys(validatorPublicKeysInQC, qc.GetAggregatedSignature().GetSignature(), signaturePayload[:])
+	return isValidSignatureManyPublicKeysWithCache(
+		cache,
+		epoch,
+		qc.GetAggregatedSignature().GetSignersList(),
+		validatorPublicKeysInQC,
+		qc.GetAggregatedSignature().GetSignature(),
+		signaturePayload,
+	)
 }
 
 // IsValidSuperMajorityAggregateQuorumCertificate validates that the aggregate QC is properly formed and signed
@@ -68,6 +90,20 @@ func IsValidSuperMajorityQuorumCertificate(qc QuorumCertificate, validators []Va
 // - aggQCValidators: The validator set that signed the timeouts for the view that has timed out (the view in the aggregate QC)
 // - highQCValidators: The validator set that signed the high QC (the view in the high QC)
 func IsValidSuperMajorityAggregateQuorumCertificate(aggQC AggregateQuorumCertificate, aggQCValidators []Validator, highQCValidators []Validator) bool {
+	return IsValidSuperMajorityAggregateQuorumCertificateWithCache(aggQC, aggQCValidators, highQCValidators, 0, nil)
+}
+
+// IsValidSuperMajorityAggregateQuorumCertificateWithCache is the same as IsValidSuperMajorityAggregateQuorumCertificate,
+// except that the aggregated public key of the high QC's signers is looked up in the provided cache under the epoch
+// of highQCValidators. The timeout signatures themselves are on different payloads, so their public keys can't be
+// aggregated ahead of time, but the hashes of their payloads are looked up in the cache. The cache is optional.
+func IsValidSuperMajorityAggregateQuorumCertificateWithCache(
+	aggQC AggregateQuorumCertificate,
+	aggQCValidators []Validator,
+	highQCValidators []Validator,
+	highQCEpoch uint64,
+	cache *AggregatedPublicKeyCache,
+) bool {
 	if !isProperlyFormedAggregateQC(aggQC) {
 		return false
 	}
@@ -76,7 +112,7 @@ func IsValidSuperMajorityAggregateQuorumCertificate(aggQC AggregateQuorumCertifi
 		return false
 	}
 
-	if !IsValidSuperMajorityQuorumCertificate(aggQC.GetHighQC(), highQCValidators) {
+	if !IsValidSuperMajorityQuorumCertificateWithCache(aggQC.GetHighQC(), highQCValidators, highQCEpoch, cache) {
 		return false
 	}
 
@@ -93,7 +129,11 @@ func IsValidSuperMajorityAggregateQuorumCertificate(aggQC AggregateQuorumCertifi
 	// The highQC views slice may contain 0 values for validators that did not send a timeout message
 	// for the timed out view. The 0 values are kept in the slice to maintain the ordering of the signers
 	// in the highQC views identical to the ordering of the validators in the validator list and signers list.
-	signedPayloads := [][]byte{}
+	//
+	// Most validators time out with the same high QC, so the payload for each distinct high QC view
+	// is only hashed once, and signers with the same high QC view share it.
+	signedPayloads := []*bls.HashedPayload{}
+	hashedPayloadsByHighQCView := make(map[uint64]*bls.HashedPayload)
 	for _, highQCView := range aggQC.GetHighQCViews() {
 		// If we encounter a 0 value for the validator at the current index, then it means that the
 		// the validator did not send a timeout message for the timed out view. We skip this validator.
@@ -101,8 +141,12 @@ func IsValidSuperMajorityAggregateQuorumCertificate(aggQC AggregateQuorumCertifi
 			continue
 		}
 
-		payload := GetTimeoutSignaturePayload(aggQC.GetView(), highQCView)
-		signedPayloads = append(signedPayloads, payload[:])
+		hashedPayload, exists := hashedPayloadsByHighQCView[highQCView]
+		if !exists {
+			hashedPayload = getHashedPayload(cache, GetTimeoutSignaturePayload(aggQC.GetView(), highQCView))
+			hashedPayloadsByHighQCView[highQCView] = hashedPayload
+		}
+		signedPayloads = append(signedPayloads, hashedPayload)
 	}
 
 	// This is a safety check to ensure that the number of signed payloads matches the number of signers.
@@ -117,7 +161,7 @@ func IsValidSuperMajorityAggregateQuorumCertificate(aggQC AggregateQuorumCertifi
 	//
 	// Ex: If the signerPublicKeys list is [A, B, C, D, E] and the high QC views are [5, 4, 3, 4, 1],
 	// then it means that signer A has a highQC view of 5, signer B has a highQC view of 4,...
-	isValidSignature, err := bls.VerifyAggregateSignatureMultiplePayloads(
+	isValidSignature, err := bls.VerifyAggregateSignatureMultipleHashedPayloads(
 		signerPublicKeys,
 		aggQC.GetAggregatedSignature().GetSignature(),
 		signedPayloads,
@@ -622,14 +666,26 @@ func generateRandomBytes(numBytes int) []byte {
 	return randomBytes
 }
 
-func powerOfTwo(exponent uint64, maxExponent uint64) int64 {
-	if exponent > maxExponent {
-		return powerOfTwo(maxExponent, maxExponent)
-	}
-
-	result := int64(1)
-	for i := uint64(0); i < exponent; i++ {
-		result *= 2
+// computeTimeoutBackoffDuration returns baseDuration * (multiplierBasisPoints / 10000)^numTimeouts, where
+// numTimeouts is capped at maxNumTimeouts. The result saturates at the max time.Duration instead of overflowing.
+func computeTimeoutBackoffDuration(
+	baseDuration time.Duration,
+	multiplierBasisPoints uint64,
+	numTimeouts uint64,
+	maxNumTimeouts uint64,
+) time.Duration {
+	if numTimeouts > maxNumTimeouts {
+		numTimeouts = maxNumTimeouts
+	}
+
+	result := big.NewInt(int64(baseDuration))
+	multiplier := new(big.Int).SetUint64(multiplierBasisPoints)
+	for i := uint64(0); i < numTimeouts; i++ {
+		result.Mul(result, multiplier)
+		result.Div(result, big.NewInt(10000))
+		if !result.IsInt64() {
+			return time.Duration(math.MaxInt64)
+		}
 	}
-	return result
+	return time.Duration(result.Int64())
 }
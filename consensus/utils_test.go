@@ -1,7 +1,9 @@
 package consensus
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/deso-protocol/core/bls"
 	"github.com/deso-protocol/core/collections/bitset"
@@ -712,3 +714,23 @@ func TestIsEqualQC(t *testing.T) {
 		require.True(t, IsEqualQC(qc, qc))
 	}
 }
+
+func TestComputeTimeoutBackoffDuration(t *testing.T) {
+	baseDuration := time.Duration(1000)
+
+	// No timeouts
+	require.Equal(t, baseDuration, computeTimeoutBackoffDuration(baseDuration, 20000, 0, 16))
+
+	// 2x and 1.5x multipliers
+	require.Equal(t, 8*baseDuration, computeTimeoutBackoffDuration(baseDuration, 20000, 3, 16))
+	require.Equal(t, time.Duration(3375), computeTimeoutBackoffDuration(baseDuration, 15000, 3, 16))
+
+	// 1x multiplier never backs off
+	require.Equal(t, baseDuration, computeTimeoutBackoffDuration(baseDuration, 10000, 10, 16))
+
+	// The number of timeouts is capped
+	require.Equal(t, 16*baseDuration, computeTimeoutBackoffDuration(baseDuration, 20000, 10, 4))
+
+	// The result saturates instead of overflowing
+	require.Equal(t, time.Duration(math.MaxInt64), computeTimeoutBackoffDuration(time.Hour, 30000, 100, 100))
+}
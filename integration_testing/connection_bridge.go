@@ -124,8 +124,8 @@ func (bridge *ConnectionBridge) createInboundConnection(node *cmd.Node) *lib.Pee
 	// Because it is an inbound Peer of the node, it is simultaneously a "fake" outbound Peer of the bridge.
 	// Hence, we will mark the _isOutbound parameter as "true" in NewPeer.
 	peer := lib.NewPeer(uint64(lib.RandInt64(math.MaxInt64)), conn, true,
-		netAddress, true, 10000, 0, &lib.DeSoMainnetParams,
-		messagesFromPeer, nil, nil, lib.NodeSyncTypeAny, donePeerChan)
+		netAddress, true, 10000, 0, 0, nil, &lib.DeSoMainnetParams,
+		messagesFromPeer, nil, nil, lib.NodeSyncTypeAny, donePeerChan, lib.NewLogger(nil, lib.LogComponentPeer))
 	return peer
 }
 
@@ -152,8 +152,8 @@ func (bridge *ConnectionBridge) createOutboundConnection(node *cmd.Node, otherNo
 		messagesFromPeer := make(chan *lib.ServerMessage, 100)
 		donePeerChan := make(chan *lib.Peer, 100)
 		peer := lib.NewPeer(uint64(lib.RandInt64(math.MaxInt64)), conn,
-			false, na, false, 10000, 0, bridge.nodeB.Params,
-			messagesFromPeer, nil, nil, lib.NodeSyncTypeAny, donePeerChan)
+			false, na, false, 10000, 0, 0, nil, bridge.nodeB.Params,
+			messagesFromPeer, nil, nil, lib.NodeSyncTypeAny, donePeerChan, lib.NewLogger(nil, lib.LogComponentPeer))
 		bridge.newPeerChan <- peer
 		//}
 	}(ll)
@@ -0,0 +1,300 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// The address manager only tells us which addresses exist and picks among them at random, so a freshly
+// restarted node spends a long time dialing dead or slow peers before it settles on good ones. The
+// AddrQualityTracker fills that gap. It records the outcome and dial latency of every outbound connection
+// attempt, persists that history to the data directory, and scores addresses so that the NetworkManager
+// can bias its outbound dialing toward the addresses that have served us well in the past.
+
+const (
+	// AddrQualityFileName is the name of the file in the data directory that the address quality
+	// history is persisted to.
+	AddrQualityFileName = "peer_quality.json"
+
+	// addrQualityDefaultLatency is the dial latency we assume for addresses we haven't connected to yet.
+	addrQualityDefaultLatency = 500 * time.Millisecond
+	// addrQualityLatencyWeight controls how quickly the EWMA latency reacts to new samples. A weight
+	// of 0.2 means each new sample accounts for 20% of the new average.
+	addrQualityLatencyWeight = 0.2
+	// addrQualityMaxEntries bounds the number of addresses we keep history for. When it's exceeded,
+	// the entries that were least recently attempted are dropped.
+	addrQualityMaxEntries = 4096
+	// addrQualityNumCandidates is the number of random addresses the NetworkManager samples from the
+	// address manager before dialing the highest scoring one.
+	addrQualityNumCandidates = 5
+	// addrQualitySaveInterval is the minimum amount of time between two writes of the history file.
+	addrQualitySaveInterval = 2 * time.Minute
+)
+
+// AddrQualityEntry is the connection history we keep for a single address.
+type AddrQualityEntry struct {
+	// Address is the address key, as returned by addrmgr.NetAddressKey.
+	Address string
+	// NumSuccesses and NumFailures count the outbound connection attempts to this address.
+	NumSuccesses uint64
+	NumFailures  uint64
+	// NumConsecutiveFailures is reset every time a connection attempt succeeds.
+	NumConsecutiveFailures uint64
+	LastSuccess            time.Time
+	LastFailure            time.Time
+	LastAttempt            time.Time
+	// AvgLatency is the exponentially weighted moving average of the dial latency of the successful
+	// connection attempts to this address.
+	AvgLatency time.Duration
+}
+
+// Score returns a number in (0, 1] that ranks how likely we are to get a good connection by dialing
+// this address. It's the smoothed success rate of the address, discounted by its latency and by any
+// run of consecutive failures.
+func (entry *AddrQualityEntry) Score() float64 {
+	// An address with no history gets a success rate of 1/2 and the default latency.
+	successRate := float64(entry.NumSuccesses+1) / float64(entry.NumSuccesses+entry.NumFailures+2)
+	latency := entry.AvgLatency
+	if entry.NumSuccesses == 0 {
+		latency = addrQualityDefaultLatency
+	}
+	latencyFactor := 1 / (1 + latency.Seconds()/addrQualityDefaultLatency.Seconds())
+	failureFactor := 1 / float64(1+entry.NumConsecutiveFailures)
+	return successRate * latencyFactor * failureFactor
+}
+
+// AddrQualityTracker keeps the connection history of the addresses we dial and persists it across restarts.
+// It is safe for concurrent use.
+type AddrQualityTracker struct {
+	mtx sync.RWMutex
+
+	// filePath is where the history is persisted. If it's empty, the history is kept in memory only.
+	filePath string
+	entries  map[string]*AddrQualityEntry
+
+	dirty    bool
+	lastSave time.Time
+}
+
+// NewAddrQualityTracker creates a tracker that persists its history to dataDir. If dataDir is empty, the
+// history is kept in memory only. Any history previously saved to dataDir is loaded.
+func NewAddrQualityTracker(dataDir string) (*AddrQualityTracker, error) {
+	tracker := &AddrQualityTracker{
+		entries: make(map[string]*AddrQualityEntry),
+	}
+	if dataDir == "" {
+		return tracker, nil
+	}
+	tracker.filePath = filepath.Join(dataDir, AddrQualityFileName)
+	if err := tracker.load(); err != nil {
+		return nil, errors.Wrapf(err, "NewAddrQualityTracker: Problem loading address quality history")
+	}
+	return tracker, nil
+}
+
+func (tracker *AddrQualityTracker) load() error {
+	fileBytes, err := os.ReadFile(tracker.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "AddrQualityTracker.load: Problem reading file %v", tracker.filePath)
+	}
+	var entries []*AddrQualityEntry
+	if err = json.Unmarshal(fileBytes, &entries); err != nil {
+		// A corrupt history shouldn't prevent the node from starting. We just start over.
+		glog.Errorf("AddrQualityTracker.load: Problem decoding file %v, discarding it: %v", tracker.filePath, err)
+		return nil
+	}
+	for _, entry := range entries {
+		if entry == nil || entry.Address == "" {
+			continue
+		}
+		tracker.entries[entry.Address] = entry
+	}
+	return nil
+}
+
+// Save writes the history to disk. It's a no-op for in-memory trackers.
+func (tracker *AddrQualityTracker) Save() error {
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+	return tracker.save()
+}
+
+// MaybeSave writes the history to disk if it's changed and enough time has passed since the last write.
+func (tracker *AddrQualityTracker) MaybeSave() error {
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+	if !tracker.dirty || time.Since(tracker.lastSave) < addrQualitySaveInterval {
+		return nil
+	}
+	return tracker.save()
+}
+
+func (tracker *AddrQualityTracker) save() error {
+	if tracker.filePath == "" {
+		return nil
+	}
+	entries := make([]*AddrQualityEntry, 0, len(tracker.entries))
+	for _, entry := range tracker.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		return entries[ii].Address < entries[jj].Address
+	})
+	fileBytes, err := json.Marshal(entries)
+	if err != nil {
+		return errors.Wrapf(err, "AddrQualityTracker.save: Problem encoding entries")
+	}
+	// Write to a temporary file first so a crash mid-write can't corrupt the history.
+	tempFilePath := tracker.filePath + ".tmp"
+	if err = os.WriteFile(tempFilePath, fileBytes, 0644); err != nil {
+		return errors.Wrapf(err, "AddrQualityTracker.save: Problem writing file %v", tempFilePath)
+	}
+	if err = os.Rename(tempFilePath, tracker.filePath); err != nil {
+		return errors.Wrapf(err, "AddrQualityTracker.save: Problem renaming %v to %v", tempFilePath, tracker.filePath)
+	}
+	tracker.dirty = false
+	tracker.lastSave = time.Now()
+	return nil
+}
+
+func (tracker *AddrQualityTracker) getOrCreateEntry(addrKey string) *AddrQualityEntry {
+	entry, exists := tracker.entries[addrKey]
+	if !exists {
+		tracker.evictIfNeeded()
+		entry = &AddrQualityEntry{Address: addrKey}
+		tracker.entries[addrKey] = entry
+	}
+	return entry
+}
+
+// evictIfNeeded drops the least recently attempted entry if there's no room to track another address.
+func (tracker *AddrQualityTracker) evictIfNeeded() {
+	if len(tracker.entries) < addrQualityMaxEntries {
+		return
+	}
+	var oldest *AddrQualityEntry
+	for _, entry := range tracker.entries {
+		if oldest == nil || entry.LastAttempt.Before(oldest.LastAttempt) {
+			oldest = entry
+		}
+	}
+	delete(tracker.entries, oldest.Address)
+}
+
+// RecordSuccess records a successful connection to the address that took dialLatency to establish.
+func (tracker *AddrQualityTracker) RecordSuccess(netAddr *wire.NetAddressV2, dialLatency time.Duration) {
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+
+	now := time.Now()
+	entry := tracker.getOrCreateEntry(addrmgr.NetAddressKey(netAddr))
+	if entry.NumSuccesses == 0 {
+		entry.AvgLatency = dialLatency
+	} else {
+		entry.AvgLatency = time.Duration(addrQualityLatencyWeight*float64(dialLatency) +
+			(1-addrQualityLatencyWeight)*float64(entry.AvgLatency))
+	}
+	entry.NumSuccesses++
+	entry.NumConsecutiveFailures = 0
+	entry.LastSuccess = now
+	entry.LastAttempt = now
+	tracker.dirty = true
+}
+
+// RecordFailure records a failed connection attempt to the address.
+func (tracker *AddrQualityTracker) RecordFailure(netAddr *wire.NetAddressV2) {
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+
+	now := time.Now()
+	entry := tracker.getOrCreateEntry(addrmgr.NetAddressKey(netAddr))
+	entry.NumFailures++
+	entry.NumConsecutiveFailures++
+	entry.LastFailure = now
+	entry.LastAttempt = now
+	tracker.dirty = true
+}
+
+// GetEntry returns a copy of the history of the address, or nil if we don't have any.
+func (tracker *AddrQualityTracker) GetEntry(netAddr *wire.NetAddressV2) *AddrQualityEntry {
+	tracker.mtx.RLock()
+	defer tracker.mtx.RUnlock()
+
+	entry, exists := tracker.entries[addrmgr.NetAddressKey(netAddr)]
+	if !exists {
+		return nil
+	}
+	entryCopy := *entry
+	return &entryCopy
+}
+
+// Score returns the score of the address. Addresses we have no history for get the score of an empty entry.
+func (tracker *AddrQualityTracker) Score(netAddr *wire.NetAddressV2) float64 {
+	tracker.mtx.RLock()
+	defer tracker.mtx.RUnlock()
+
+	entry, exists := tracker.entries[addrmgr.NetAddressKey(netAddr)]
+	if !exists {
+		return (&AddrQualityEntry{}).Score()
+	}
+	return entry.Score()
+}
+
+// SelectBest returns the highest scoring address among the candidates, or nil if there are none. Ties
+// are broken in favor of the earlier candidate, so the random order the candidates were drawn in is kept.
+func (tracker *AddrQualityTracker) SelectBest(candidates []*wire.NetAddressV2) *wire.NetAddressV2 {
+	var bestAddr *wire.NetAddressV2
+	bestScore := float64(0)
+	for _, candidate := range candidates {
+		if candidate == nil {
+			continue
+		}
+		score := tracker.Score(candidate)
+		if bestAddr == nil || score > bestScore {
+			bestAddr = candidate
+			bestScore = score
+		}
+	}
+	return bestAddr
+}
+
+// GetGoodAddresses returns the keys of up to maxAddrs addresses that we've connected to successfully
+// before, ordered by descending score. It's used to seed the address manager on startup.
+func (tracker *AddrQualityTracker) GetGoodAddresses(maxAddrs int) []string {
+	tracker.mtx.RLock()
+	defer tracker.mtx.RUnlock()
+
+	goodEntries := []*AddrQualityEntry{}
+	for _, entry := range tracker.entries {
+		if entry.NumSuccesses > 0 {
+			goodEntries = append(goodEntries, entry)
+		}
+	}
+	sort.Slice(goodEntries, func(ii, jj int) bool {
+		scoreII, scoreJJ := goodEntries[ii].Score(), goodEntries[jj].Score()
+		if scoreII != scoreJJ {
+			return scoreII > scoreJJ
+		}
+		return goodEntries[ii].Address < goodEntries[jj].Address
+	})
+	if maxAddrs >= 0 && len(goodEntries) > maxAddrs {
+		goodEntries = goodEntries[:maxAddrs]
+	}
+	addrs := make([]string, len(goodEntries))
+	for ii, entry := range goodEntries {
+		addrs[ii] = entry.Address
+	}
+	return addrs
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func _testNetAddr(ip string) *wire.NetAddressV2 {
+	return wire.NetAddressV2FromBytes(time.Now(), 0, net.ParseIP(ip).To4(), 17000)
+}
+
+func TestAddrQualityTracker(t *testing.T) {
+	require := require.New(t)
+
+	dataDir := t.TempDir()
+	tracker, err := NewAddrQualityTracker(dataDir)
+	require.NoError(err)
+
+	goodAddr := _testNetAddr("1.1.1.1")
+	slowAddr := _testNetAddr("2.2.2.2")
+	badAddr := _testNetAddr("3.3.3.3")
+	unknownAddr := _testNetAddr("4.4.4.4")
+
+	for ii := 0; ii < 3; ii++ {
+		tracker.RecordSuccess(goodAddr, 50*time.Millisecond)
+		tracker.RecordSuccess(slowAddr, 2*time.Second)
+		tracker.RecordFailure(badAddr)
+	}
+	goodEntry := tracker.GetEntry(goodAddr)
+	require.Equal(uint64(3), goodEntry.NumSuccesses)
+	require.Equal(50*time.Millisecond, goodEntry.AvgLatency)
+	badEntry := tracker.GetEntry(badAddr)
+	require.Equal(uint64(3), badEntry.NumFailures)
+	require.Equal(uint64(3), badEntry.NumConsecutiveFailures)
+	require.Nil(tracker.GetEntry(unknownAddr))
+
+	// Fast, reliable addresses outrank slow ones, which outrank unknown ones, which outrank failing ones.
+	require.Greater(tracker.Score(goodAddr), tracker.Score(slowAddr))
+	require.Greater(tracker.Score(slowAddr), tracker.Score(badAddr))
+	require.Greater(tracker.Score(unknownAddr), tracker.Score(badAddr))
+	require.Equal(goodAddr, tracker.SelectBest([]*wire.NetAddressV2{badAddr, unknownAddr, slowAddr, goodAddr}))
+	require.Equal(unknownAddr, tracker.SelectBest([]*wire.NetAddressV2{badAddr, unknownAddr}))
+	require.Nil(tracker.SelectBest(nil))
+
+	// A success resets the run of consecutive failures.
+	tracker.RecordSuccess(badAddr, 100*time.Millisecond)
+	badEntry = tracker.GetEntry(badAddr)
+	require.Equal(uint64(0), badEntry.NumConsecutiveFailures)
+	require.Equal(uint64(1), badEntry.NumSuccesses)
+
+	// Only addresses we've connected to are good, ordered by score. The recovered address is fast enough
+	// now to outrank the slow one.
+	require.Equal([]string{
+		addrmgr.NetAddressKey(goodAddr), addrmgr.NetAddressKey(badAddr), addrmgr.NetAddressKey(slowAddr),
+	}, tracker.GetGoodAddresses(-1))
+	require.Equal([]string{addrmgr.NetAddressKey(goodAddr)}, tracker.GetGoodAddresses(1))
+
+	// MaybeSave writes the first time since nothing has been saved yet, and not again until the interval passes.
+	require.NoError(tracker.MaybeSave())
+	filePath := filepath.Join(dataDir, AddrQualityFileName)
+	_, err = os.Stat(filePath)
+	require.NoError(err)
+	tracker.RecordFailure(unknownAddr)
+	require.NoError(tracker.MaybeSave())
+	reloaded, err := NewAddrQualityTracker(dataDir)
+	require.NoError(err)
+	require.Nil(reloaded.GetEntry(unknownAddr))
+
+	// Save always writes, and the history survives a restart.
+	require.NoError(tracker.Save())
+	reloaded, err = NewAddrQualityTracker(dataDir)
+	require.NoError(err)
+	require.Equal(tracker.GetGoodAddresses(-1), reloaded.GetGoodAddresses(-1))
+	reloadedEntry := reloaded.GetEntry(goodAddr)
+	require.Equal(uint64(3), reloadedEntry.NumSuccesses)
+	require.Equal(50*time.Millisecond, reloadedEntry.AvgLatency)
+	require.NotNil(reloaded.GetEntry(unknownAddr))
+
+	// A corrupt file is discarded rather than failing startup.
+	require.NoError(os.WriteFile(filePath, []byte("not json"), 0644))
+	reloaded, err = NewAddrQualityTracker(dataDir)
+	require.NoError(err)
+	require.Len(reloaded.GetGoodAddresses(-1), 0)
+
+	// An in-memory tracker never writes.
+	inMemory, err := NewAddrQualityTracker("")
+	require.NoError(err)
+	inMemory.RecordSuccess(goodAddr, time.Millisecond)
+	require.NoError(inMemory.Save())
+}
@@ -0,0 +1,345 @@
+package lib
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Admin RPC
+//
+// The AdminRPCServer exposes runtime controls that an operator can use without restarting the node. It serves
+// JSON over HTTP, and because the controls affect what the node relays, it is locked down in two ways: it only
+// listens on a loopback address, and every request must carry the configured token in an
+// "Authorization: Bearer <token>" header.
+//
+// Endpoints:
+//   - GET  /admin/paused-txn-types: returns the paused TxnTypes.
+//   - POST /admin/pause-txn-types: pauses the TxnTypes in the request, e.g. {"TxnTypes": ["NFT_BID"]}.
+//   - POST /admin/resume-txn-types: resumes the TxnTypes in the request.
+//   - GET  /admin/txn-type-metrics?blocks=N: returns the per-TxnType metrics of the last N blocks, and of the whole
+//     metrics window for comparison. See TxnTypeMetricsTracker.
+//   - GET  /admin/pending-reorg: returns the reorg that is held for being deeper than the max reorg depth, if any.
+//   - POST /admin/approve-reorg: applies the pending reorg, e.g. {"ForkTipHashHex": "00000a..."}.
+//   - GET  /admin/block-confirmation-status?hash=H: returns the confirmations and finality of a block. See
+//     reorg_guard.go.
+//
+// The pause and resume endpoints respond with the TxnTypes that are paused after the request is applied. See
+// TxnRelayFilter for what pausing a TxnType does.
+
+const (
+	AdminRPCRoutePathGetPausedTxnTypes = "/admin/paused-txn-types"
+	AdminRPCRoutePathPauseTxnTypes     = "/admin/pause-txn-types"
+	AdminRPCRoutePathResumeTxnTypes    = "/admin/resume-txn-types"
+	AdminRPCRoutePathGetTxnTypeMetrics = "/admin/txn-type-metrics"
+	AdminRPCRoutePathGetPendingReorg   = "/admin/pending-reorg"
+	AdminRPCRoutePathApproveReorg      = "/admin/approve-reorg"
+	AdminRPCRoutePathGetBlockStatus    = "/admin/block-confirmation-status"
+
+	// adminRPCDefaultTxnTypeMetricsBlocks is the number of blocks the txn-type-metrics endpoint returns when the
+	// request doesn't say.
+	adminRPCDefaultTxnTypeMetricsBlocks = 10
+
+	// adminRPCMaxRequestBodyBytes bounds the size of the request bodies we decode.
+	adminRPCMaxRequestBodyBytes = 1 << 16
+	adminRPCReadHeaderTimeout   = 10 * time.Second
+)
+
+// AdminRPCTxnTypesRequest is the body of the pause and resume requests. TxnTypes are given by their TxnString,
+// e.g. "NFT_BID".
+type AdminRPCTxnTypesRequest struct {
+	TxnTypes []TxnString
+}
+
+// AdminRPCPausedTxnTypesResponse is the body of the responses of all the TxnType endpoints.
+type AdminRPCPausedTxnTypesResponse struct {
+	PausedTxnTypes []TxnString
+}
+
+// AdminRPCTxnTypeMetricsResponse is the body of the response of the txn-type-metrics endpoint. Recent adds up the
+// requested blocks, Window adds up every block the node keeps metrics for, and Blocks has the requested blocks,
+// oldest first.
+type AdminRPCTxnTypeMetricsResponse struct {
+	Recent *TxnTypeMetricsSummary
+	Window *TxnTypeMetricsSummary
+	Blocks []*BlockTxnTypeMetrics
+}
+
+// AdminRPCApproveReorgRequest is the body of the approve-reorg request. The fork tip must match the pending
+// reorg's, so that the operator only approves the reorg they looked into.
+type AdminRPCApproveReorgRequest struct {
+	ForkTipHashHex string
+}
+
+// AdminRPCPendingReorgResponse is the body of the responses of the reorg endpoints. PendingReorg is null if no
+// reorg is pending.
+type AdminRPCPendingReorgResponse struct {
+	PendingReorg *PendingReorg
+}
+
+// AdminRPCErrorResponse is the body of the response when a request fails.
+type AdminRPCErrorResponse struct {
+	Error string
+}
+
+type AdminRPCServer struct {
+	listenAddr     string
+	authToken      string
+	txnRelayFilter *TxnRelayFilter
+	// txnTypeMetrics is nil if the node doesn't track TxnType metrics.
+	txnTypeMetrics *TxnTypeMetricsTracker
+	blockchain     *Blockchain
+
+	listener   net.Listener
+	httpServer *http.Server
+	waitGroup  sync.WaitGroup
+}
+
+// NewAdminRPCServer creates an AdminRPCServer that controls the given TxnRelayFilter and Blockchain, and serves the
+// metrics of the given TxnTypeMetricsTracker if it isn't nil. The listen address must be a loopback host:port, e.g.
+// 127.0.0.1:17010, and the auth token must be non-empty.
+func NewAdminRPCServer(listenAddr string, authToken string, txnRelayFilter *TxnRelayFilter,
+	txnTypeMetrics *TxnTypeMetricsTracker, blockchain *Blockchain) (*AdminRPCServer, error) {
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewAdminRPCServer: Listen address %v must be in the form host:port", listenAddr)
+	}
+	if !isLoopbackHost(host) {
+		return nil, fmt.Errorf("NewAdminRPCServer: Listen address %v must be a loopback address", listenAddr)
+	}
+	if authToken == "" {
+		return nil, fmt.Errorf("NewAdminRPCServer: Auth token must be set")
+	}
+	if txnRelayFilter == nil {
+		return nil, fmt.Errorf("NewAdminRPCServer: TxnRelayFilter must be set")
+	}
+	if blockchain == nil {
+		return nil, fmt.Errorf("NewAdminRPCServer: Blockchain must be set")
+	}
+	return &AdminRPCServer{
+		listenAddr:     listenAddr,
+		authToken:      authToken,
+		txnRelayFilter: txnRelayFilter,
+		txnTypeMetrics: txnTypeMetrics,
+		blockchain:     blockchain,
+	}, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Start begins serving requests in the background.
+func (admin *AdminRPCServer) Start() error {
+	var err error
+	admin.listener, err = net.Listen("tcp", admin.listenAddr)
+	if err != nil {
+		return errors.Wrapf(err, "AdminRPCServer.Start: Problem listening on %v", admin.listenAddr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminRPCRoutePathGetPausedTxnTypes, admin.authenticate(http.MethodGet, admin.getPausedTxnTypes))
+	mux.HandleFunc(AdminRPCRoutePathPauseTxnTypes, admin.authenticate(http.MethodPost, admin.pauseTxnTypes))
+	mux.HandleFunc(AdminRPCRoutePathResumeTxnTypes, admin.authenticate(http.MethodPost, admin.resumeTxnTypes))
+	mux.HandleFunc(AdminRPCRoutePathGetTxnTypeMetrics, admin.authenticate(http.MethodGet, admin.getTxnTypeMetrics))
+	mux.HandleFunc(AdminRPCRoutePathGetPendingReorg, admin.authenticate(http.MethodGet, admin.getPendingReorg))
+	mux.HandleFunc(AdminRPCRoutePathApproveReorg, admin.authenticate(http.MethodPost, admin.approveReorg))
+	mux.HandleFunc(AdminRPCRoutePathGetBlockStatus, admin.authenticate(http.MethodGet, admin.getBlockStatus))
+	admin.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: adminRPCReadHeaderTimeout,
+	}
+
+	admin.waitGroup.Add(1)
+	go func() {
+		defer admin.waitGroup.Done()
+		if err := admin.httpServer.Serve(admin.listener); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("AdminRPCServer: Problem serving requests: %v", err)
+		}
+	}()
+	glog.Infof("AdminRPCServer.Start: Listening on %v", admin.listener.Addr())
+	return nil
+}
+
+// Stop closes the listener and waits for the server to exit.
+func (admin *AdminRPCServer) Stop() {
+	if admin.httpServer == nil {
+		return
+	}
+	if err := admin.httpServer.Close(); err != nil {
+		glog.Errorf("AdminRPCServer.Stop: Problem closing server: %v", err)
+	}
+	admin.waitGroup.Wait()
+}
+
+// Addr returns the address the server is listening on. It is only set once the server has started.
+func (admin *AdminRPCServer) Addr() net.Addr {
+	if admin.listener == nil {
+		return nil
+	}
+	return admin.listener.Addr()
+}
+
+// authenticate wraps a handler so that it only runs for requests with the given method and a valid auth token.
+func (admin *AdminRPCServer) authenticate(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(ww http.ResponseWriter, req *http.Request) {
+		token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(admin.authToken)) != 1 {
+			admin.writeError(ww, http.StatusUnauthorized, "invalid auth token")
+			return
+		}
+		if req.Method != method {
+			admin.writeError(ww, http.StatusMethodNotAllowed, fmt.Sprintf("method must be %v", method))
+			return
+		}
+		handler(ww, req)
+	}
+}
+
+func (admin *AdminRPCServer) getPausedTxnTypes(ww http.ResponseWriter, req *http.Request) {
+	admin.writePausedTxnTypes(ww)
+}
+
+func (admin *AdminRPCServer) pauseTxnTypes(ww http.ResponseWriter, req *http.Request) {
+	txnTypes, err := admin.decodeTxnTypesRequest(req)
+	if err != nil {
+		admin.writeError(ww, http.StatusBadRequest, err.Error())
+		return
+	}
+	admin.txnRelayFilter.PauseTxnTypes(txnTypes)
+	glog.Infof("AdminRPCServer: Paused TxnTypes %v", txnTypes)
+	admin.writePausedTxnTypes(ww)
+}
+
+func (admin *AdminRPCServer) resumeTxnTypes(ww http.ResponseWriter, req *http.Request) {
+	txnTypes, err := admin.decodeTxnTypesRequest(req)
+	if err != nil {
+		admin.writeError(ww, http.StatusBadRequest, err.Error())
+		return
+	}
+	admin.txnRelayFilter.ResumeTxnTypes(txnTypes)
+	glog.Infof("AdminRPCServer: Resumed TxnTypes %v", txnTypes)
+	admin.writePausedTxnTypes(ww)
+}
+
+func (admin *AdminRPCServer) decodeTxnTypesRequest(req *http.Request) ([]TxnType, error) {
+	requestData := AdminRPCTxnTypesRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, req.Body, adminRPCMaxRequestBodyBytes))
+	if err := decoder.Decode(&requestData); err != nil {
+		return nil, fmt.Errorf("problem decoding request: %v", err)
+	}
+	if len(requestData.TxnTypes) == 0 {
+		return nil, fmt.Errorf("no TxnTypes given")
+	}
+	var txnTypes []TxnType
+	for _, txnString := range requestData.TxnTypes {
+		txnType := GetTxnTypeFromString(txnString)
+		// Block rewards are never relayed, so they can't be paused.
+		if txnType == TxnTypeUnset || txnType == TxnTypeBlockReward {
+			return nil, fmt.Errorf("TxnType %v can't be paused", txnString)
+		}
+		txnTypes = append(txnTypes, txnType)
+	}
+	return txnTypes, nil
+}
+
+func (admin *AdminRPCServer) writePausedTxnTypes(ww http.ResponseWriter) {
+	res := AdminRPCPausedTxnTypesResponse{PausedTxnTypes: []TxnString{}}
+	for _, txnType := range admin.txnRelayFilter.GetPausedTxnTypes() {
+		res.PausedTxnTypes = append(res.PausedTxnTypes, txnType.GetTxnString())
+	}
+	admin.writeJSON(ww, http.StatusOK, res)
+}
+
+func (admin *AdminRPCServer) getTxnTypeMetrics(ww http.ResponseWriter, req *http.Request) {
+	if admin.txnTypeMetrics == nil {
+		admin.writeError(ww, http.StatusNotFound, "TxnType metrics are disabled on this node")
+		return
+	}
+	numBlocks := uint64(adminRPCDefaultTxnTypeMetricsBlocks)
+	if blocksParam := req.URL.Query().Get("blocks"); blocksParam != "" {
+		var err error
+		numBlocks, err = strconv.ParseUint(blocksParam, 10, 64)
+		if err != nil || numBlocks == 0 {
+			admin.writeError(ww, http.StatusBadRequest, fmt.Sprintf("blocks must be a positive integer: %v", blocksParam))
+			return
+		}
+	}
+	admin.writeJSON(ww, http.StatusOK, AdminRPCTxnTypeMetricsResponse{
+		Recent: admin.txnTypeMetrics.GetSummary(numBlocks),
+		Window: admin.txnTypeMetrics.GetSummary(0),
+		Blocks: admin.txnTypeMetrics.GetBlocks(numBlocks),
+	})
+}
+
+func (admin *AdminRPCServer) getPendingReorg(ww http.ResponseWriter, req *http.Request) {
+	admin.writeJSON(ww, http.StatusOK, AdminRPCPendingReorgResponse{PendingReorg: admin.blockchain.GetPendingReorg()})
+}
+
+func (admin *AdminRPCServer) approveReorg(ww http.ResponseWriter, req *http.Request) {
+	requestData := AdminRPCApproveReorgRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, req.Body, adminRPCMaxRequestBodyBytes))
+	if err := decoder.Decode(&requestData); err != nil {
+		admin.writeError(ww, http.StatusBadRequest, fmt.Sprintf("problem decoding request: %v", err))
+		return
+	}
+	forkTipHash, err := decodeAdminRPCBlockHash(requestData.ForkTipHashHex)
+	if err != nil {
+		admin.writeError(ww, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = admin.blockchain.ApprovePendingReorg(forkTipHash); err != nil {
+		admin.writeError(ww, http.StatusBadRequest, err.Error())
+		return
+	}
+	glog.Infof("AdminRPCServer: Approved reorg to fork tip %v", forkTipHash)
+	admin.writeJSON(ww, http.StatusOK, AdminRPCPendingReorgResponse{PendingReorg: admin.blockchain.GetPendingReorg()})
+}
+
+func (admin *AdminRPCServer) getBlockStatus(ww http.ResponseWriter, req *http.Request) {
+	blockHash, err := decodeAdminRPCBlockHash(req.URL.Query().Get("hash"))
+	if err != nil {
+		admin.writeError(ww, http.StatusBadRequest, err.Error())
+		return
+	}
+	status, err := admin.blockchain.GetBlockConfirmationStatus(blockHash)
+	if err != nil {
+		admin.writeError(ww, http.StatusNotFound, err.Error())
+		return
+	}
+	admin.writeJSON(ww, http.StatusOK, status)
+}
+
+func decodeAdminRPCBlockHash(blockHashHex string) (*BlockHash, error) {
+	blockHashBytes, err := hex.DecodeString(blockHashHex)
+	if err != nil || len(blockHashBytes) != HashSizeBytes {
+		return nil, fmt.Errorf("invalid block hash %v", blockHashHex)
+	}
+	return NewBlockHash(blockHashBytes), nil
+}
+
+func (admin *AdminRPCServer) writeError(ww http.ResponseWriter, statusCode int, message string) {
+	admin.writeJSON(ww, statusCode, AdminRPCErrorResponse{Error: message})
+}
+
+func (admin *AdminRPCServer) writeJSON(ww http.ResponseWriter, statusCode int, res interface{}) {
+	ww.Header().Set("Content-Type", "application/json")
+	ww.WriteHeader(statusCode)
+	if err := json.NewEncoder(ww).Encode(res); err != nil {
+		glog.Errorf("AdminRPCServer: Problem encoding response: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnRelayFilter(t *testing.T) {
+	require := require.New(t)
+
+	// A nil filter doesn't pause anything.
+	var nilFilter *TxnRelayFilter
+	basicTransferTxn := &MsgDeSoTxn{TxnMeta: &BasicTransferMetadata{}}
+	require.False(nilFilter.IsTxnPaused(basicTransferTxn))
+	require.Empty(nilFilter.GetPausedTxnTypes())
+
+	filter := NewTxnRelayFilter()
+	filter.PauseTxnTypes([]TxnType{TxnTypeNFTBid, TxnTypeBasicTransfer, TxnTypeNFTBid})
+	require.Equal([]TxnType{TxnTypeBasicTransfer, TxnTypeNFTBid}, filter.GetPausedTxnTypes())
+	require.True(filter.IsTxnPaused(basicTransferTxn))
+	require.False(filter.IsTxnPaused(&MsgDeSoTxn{TxnMeta: &SubmitPostMetadata{}}))
+
+	// An atomic transaction wrapper is paused if any of its inner transactions is.
+	wrapperTxn := &MsgDeSoTxn{TxnMeta: &AtomicTxnsWrapperMetadata{
+		Txns: []*MsgDeSoTxn{{TxnMeta: &SubmitPostMetadata{}}, basicTransferTxn},
+	}}
+	require.True(filter.IsTxnPaused(wrapperTxn))
+
+	filter.ResumeTxnTypes([]TxnType{TxnTypeBasicTransfer, TxnTypeLike})
+	require.Equal([]TxnType{TxnTypeNFTBid}, filter.GetPausedTxnTypes())
+	require.False(filter.IsTxnPaused(basicTransferTxn))
+	require.False(filter.IsTxnPaused(wrapperTxn))
+}
+
+func TestAdminRPCServer(t *testing.T) {
+	require := require.New(t)
+	chain, _, _ := NewLowDifficultyBlockchain(t)
+	filter := NewTxnRelayFilter()
+
+	// The admin RPC only listens on loopback addresses, and requires an auth token.
+	_, err := NewAdminRPCServer("0.0.0.0:0", "token", filter, nil, chain)
+	require.Error(err)
+	_, err = NewAdminRPCServer("127.0.0.1:0", "", filter, nil, chain)
+	require.Error(err)
+
+	admin, err := NewAdminRPCServer("127.0.0.1:0", "token", filter, nil, chain)
+	require.NoError(err)
+	require.NoError(admin.Start())
+	defer admin.Stop()
+	baseURL := "http://" + admin.Addr().String()
+
+	sendRequest := func(method string, path string, authToken string, body interface{}) (int, []byte) {
+		var bodyBytes []byte
+		if body != nil {
+			bodyBytes, err = json.Marshal(body)
+			require.NoError(err)
+		}
+		req, err := http.NewRequest(method, baseURL+path, bytes.NewReader(bodyBytes))
+		require.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+authToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		defer res.Body.Close()
+		resBuffer := &bytes.Buffer{}
+		_, err = resBuffer.ReadFrom(res.Body)
+		require.NoError(err)
+		return res.StatusCode, resBuffer.Bytes()
+	}
+	requirePausedTxnTypes := func(resBytes []byte, expectedTxnTypes []TxnString) {
+		res := AdminRPCPausedTxnTypesResponse{}
+		require.NoError(json.Unmarshal(resBytes, &res))
+		require.Equal(expectedTxnTypes, res.PausedTxnTypes)
+	}
+
+	// Requests without the right token are rejected.
+	statusCode, _ := sendRequest(http.MethodGet, AdminRPCRoutePathGetPausedTxnTypes, "wrong", nil)
+	require.Equal(http.StatusUnauthorized, statusCode)
+	statusCode, _ = sendRequest(http.MethodPost, AdminRPCRoutePathPauseTxnTypes, "",
+		AdminRPCTxnTypesRequest{TxnTypes: []TxnString{TxnStringNFTBid}})
+	require.Equal(http.StatusUnauthorized, statusCode)
+	require.Empty(filter.GetPausedTxnTypes())
+
+	statusCode, resBytes := sendRequest(http.MethodGet, AdminRPCRoutePathGetPausedTxnTypes, "token", nil)
+	require.Equal(http.StatusOK, statusCode)
+	requirePausedTxnTypes(resBytes, []TxnString{})
+
+	// Pause and resume TxnTypes.
+	statusCode, resBytes = sendRequest(http.MethodPost, AdminRPCRoutePathPauseTxnTypes, "token",
+		AdminRPCTxnTypesRequest{TxnTypes: []TxnString{TxnStringNFTBid, TxnStringDAOCoinLimitOrder}})
+	require.Equal(http.StatusOK, statusCode)
+	requirePausedTxnTypes(resBytes, []TxnString{TxnStringNFTBid, TxnStringDAOCoinLimitOrder})
+	require.True(filter.IsTxnTypePaused(TxnTypeNFTBid))
+
+	statusCode, resBytes = sendRequest(http.MethodPost, AdminRPCRoutePathResumeTxnTypes, "token",
+		AdminRPCTxnTypesRequest{TxnTypes: []TxnString{TxnStringNFTBid}})
+	require.Equal(http.StatusOK, statusCode)
+	requirePausedTxnTypes(resBytes, []TxnString{TxnStringDAOCoinLimitOrder})
+	require.False(filter.IsTxnTypePaused(TxnTypeNFTBid))
+
+	// Unknown TxnTypes, block rewards, and the wrong method are rejected.
+	statusCode, _ = sendRequest(http.MethodPost, AdminRPCRoutePathPauseTxnTypes, "token",
+		AdminRPCTxnTypesRequest{TxnTypes: []TxnString{"NOT_A_TXN_TYPE"}})
+	require.Equal(http.StatusBadRequest, statusCode)
+	statusCode, _ = sendRequest(http.MethodPost, AdminRPCRoutePathPauseTxnTypes, "token",
+		AdminRPCTxnTypesRequest{TxnTypes: []TxnString{TxnStringBlockReward}})
+	require.Equal(http.StatusBadRequest, statusCode)
+	statusCode, _ = sendRequest(http.MethodGet, AdminRPCRoutePathPauseTxnTypes, "token", nil)
+	require.Equal(http.StatusMethodNotAllowed, statusCode)
+	require.Equal([]TxnType{TxnTypeDAOCoinLimitOrder}, filter.GetPausedTxnTypes())
+
+	// The reorg endpoints report that no reorg is pending, so there's nothing to approve.
+	statusCode, resBytes = sendRequest(http.MethodGet, AdminRPCRoutePathGetPendingReorg, "token", nil)
+	require.Equal(http.StatusOK, statusCode)
+	pendingReorgRes := AdminRPCPendingReorgResponse{}
+	require.NoError(json.Unmarshal(resBytes, &pendingReorgRes))
+	require.Nil(pendingReorgRes.PendingReorg)
+	statusCode, _ = sendRequest(http.MethodPost, AdminRPCRoutePathApproveReorg, "token",
+		AdminRPCApproveReorgRequest{ForkTipHashHex: chain.BlockTip().Hash.String()})
+	require.Equal(http.StatusBadRequest, statusCode)
+
+	// Block confirmation status.
+	statusCode, resBytes = sendRequest(http.MethodGet,
+		AdminRPCRoutePathGetBlockStatus+"?hash="+chain.BlockTip().Hash.String(), "token", nil)
+	require.Equal(http.StatusOK, statusCode)
+	blockStatus := BlockConfirmationStatus{}
+	require.NoError(json.Unmarshal(resBytes, &blockStatus))
+	require.True(blockStatus.IsMainChain)
+	require.Equal(uint64(1), blockStatus.Confirmations)
+	statusCode, _ = sendRequest(http.MethodGet, AdminRPCRoutePathGetBlockStatus+"?hash=00", "token", nil)
+	require.Equal(http.StatusBadRequest, statusCode)
+	statusCode, _ = sendRequest(http.MethodGet,
+		AdminRPCRoutePathGetBlockStatus+"?hash="+RandomBytesHex(HashSizeBytes), "token", nil)
+	require.Equal(http.StatusNotFound, statusCode)
+}
+
+func TestAdminRPCServerTxnTypeMetrics(t *testing.T) {
+	require := require.New(t)
+	chain, _, _ := NewLowDifficultyBlockchain(t)
+
+	getTxnTypeMetrics := func(admin *AdminRPCServer, query string) (int, *AdminRPCTxnTypeMetricsResponse) {
+		req, err := http.NewRequest(http.MethodGet,
+			"http://"+admin.Addr().String()+AdminRPCRoutePathGetTxnTypeMetrics+query, nil)
+		require.NoError(err)
+		req.Header.Set("Authorization", "Bearer token")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		defer res.Body.Close()
+		metricsRes := &AdminRPCTxnTypeMetricsResponse{}
+		require.NoError(json.NewDecoder(res.Body).Decode(metricsRes))
+		return res.StatusCode, metricsRes
+	}
+
+	// Without a tracker, the endpoint reports that metrics are disabled.
+	admin, err := NewAdminRPCServer("127.0.0.1:0", "token", NewTxnRelayFilter(), nil, chain)
+	require.NoError(err)
+	require.NoError(admin.Start())
+	statusCode, _ := getTxnTypeMetrics(admin, "")
+	require.Equal(http.StatusNotFound, statusCode)
+	admin.Stop()
+
+	tracker, err := NewTxnTypeMetricsTracker(nil, 100)
+	require.NoError(err)
+	for ii := uint64(1); ii <= 20; ii++ {
+		tracker.AddBlock(&BlockTxnTypeMetrics{
+			BlockHeight:  ii,
+			BlockHashHex: RandomBytesHex(HashSizeBytes),
+			TxnTypes:     []*TxnTypeMetrics{{TxnType: TxnStringCreatePostAssociation, Count: ii}},
+		})
+	}
+	admin, err = NewAdminRPCServer("127.0.0.1:0", "token", NewTxnRelayFilter(), tracker, chain)
+	require.NoError(err)
+	require.NoError(admin.Start())
+	defer admin.Stop()
+
+	// By default, the last ten blocks are compared to the whole window.
+	statusCode, res := getTxnTypeMetrics(admin, "")
+	require.Equal(http.StatusOK, statusCode)
+	require.Len(res.Blocks, 10)
+	require.Equal(uint64(11), res.Recent.StartBlockHeight)
+	require.Equal(uint64(155), res.Recent.TxnTypes[0].Count)
+	require.Equal(uint64(20), res.Window.NumBlocks)
+	require.Equal(uint64(210), res.Window.TxnTypes[0].Count)
+
+	statusCode, res = getTxnTypeMetrics(admin, "?blocks=2")
+	require.Equal(http.StatusOK, statusCode)
+	require.Equal(tracker.GetBlocks(2), res.Blocks)
+
+	statusCode, _ = getTxnTypeMetrics(admin, "?blocks=0")
+	require.Equal(http.StatusBadRequest, statusCode)
+}
@@ -0,0 +1,316 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// DeSo Balance Reconciliation
+//
+// Exchanges and custodians audit a public key's DESO balance by replaying every change to it, rather than by
+// trusting the balance the node stores. ReconcileDeSoBalance does this from the UtxoOperations the node stored for
+// each block: every operation that credits or debits the public key's balance is a DeSoBalanceChange, and adding
+// up the changes over a height range, starting from the balance before the range, reconstructs the balance at the
+// end of the range. The reconstructed balance is compared against the stored balance, and every inconsistency
+// found along the way is returned as a DeSoBalanceDiscrepancy instead of an error, so that a single report
+// covers everything an auditor has to look into.
+//
+// A node only has the UtxoOperations of the blocks it connected itself, so a node that hypersynced can only
+// reconcile the blocks after its snapshot. The UtxoOperations aren't stored when running with Postgres.
+
+// DeSoBalanceChange is a UtxoOperation that changed a public key's DESO balance.
+type DeSoBalanceChange struct {
+	BlockHeight uint64
+	BlockHash   *BlockHash
+	// TxnHash is the hash of the transaction the operation belongs to, or nil for the operations that a PoS block
+	// applies outside its transactions, such as staking rewards at the end of an epoch. The operations of the
+	// transactions inside an atomic transaction are attributed to the atomic transaction.
+	TxnHash       *BlockHash
+	OperationType OperationType
+	AmountNanos   uint64
+	// IsCredit is true if the operation added AmountNanos to the balance, and false if it spent them.
+	IsCredit bool
+	// BalanceAfterNanos is the reconstructed balance after the operation.
+	BalanceAfterNanos uint64
+}
+
+// DeSoBalanceDiscrepancyType is a kind of inconsistency that ReconcileDeSoBalance can find.
+type DeSoBalanceDiscrepancyType uint8
+
+const (
+	// DeSoBalanceDiscrepancyMissingUtxoOps means that the node has no UtxoOperations for a block from the start
+	// height to the committed tip, so the block's changes are missing from the reconstructed balance, or from the
+	// stored balance as of the end height.
+	DeSoBalanceDiscrepancyMissingUtxoOps DeSoBalanceDiscrepancyType = 0
+	// DeSoBalanceDiscrepancyNegativeBalance means that a change spent more than the reconstructed balance. The
+	// reconstruction continues from a balance of zero.
+	DeSoBalanceDiscrepancyNegativeBalance DeSoBalanceDiscrepancyType = 1
+	// DeSoBalanceDiscrepancyBalanceMismatch means that the reconstructed balance at the end of the range isn't the
+	// stored balance.
+	DeSoBalanceDiscrepancyBalanceMismatch DeSoBalanceDiscrepancyType = 2
+)
+
+func (discrepancyType DeSoBalanceDiscrepancyType) String() string {
+	switch discrepancyType {
+	case DeSoBalanceDiscrepancyMissingUtxoOps:
+		return "MISSING_UTXO_OPS"
+	case DeSoBalanceDiscrepancyNegativeBalance:
+		return "NEGATIVE_BALANCE"
+	case DeSoBalanceDiscrepancyBalanceMismatch:
+		return "BALANCE_MISMATCH"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// DeSoBalanceDiscrepancy is an inconsistency found by ReconcileDeSoBalance.
+type DeSoBalanceDiscrepancy struct {
+	Type        DeSoBalanceDiscrepancyType
+	BlockHeight uint64
+	// BlockHash is nil for a balance mismatch.
+	BlockHash   *BlockHash
+	Description string
+}
+
+// DeSoBalanceReconciliationReport is the result of ReconcileDeSoBalance.
+type DeSoBalanceReconciliationReport struct {
+	PublicKey   []byte
+	StartHeight uint64
+	EndHeight   uint64
+
+	// OpeningBalanceNanos is the balance before StartHeight that the reconstruction starts from.
+	OpeningBalanceNanos uint64
+	// Changes are the changes to the balance from StartHeight to EndHeight, in the order they were applied.
+	Changes []*DeSoBalanceChange
+	// ReconstructedBalanceNanos is the balance after the changes.
+	ReconstructedBalanceNanos uint64
+	// StoredBalanceNanos is the stored balance as of EndHeight. When EndHeight is below the committed tip, it's the
+	// stored balance at the committed tip with the changes after EndHeight undone.
+	StoredBalanceNanos uint64
+
+	// Discrepancies are the inconsistencies found, in the order of the blocks they were found in. A report without
+	// discrepancies reconciles.
+	Discrepancies []*DeSoBalanceDiscrepancy
+}
+
+// IsReconciled returns true if the reconstructed balance matches the stored balance and nothing is missing from it.
+func (report *DeSoBalanceReconciliationReport) IsReconciled() bool {
+	return len(report.Discrepancies) == 0
+}
+
+// ReconcileDeSoBalance reconstructs the DESO balance of publicKey from the UtxoOperations of the committed blocks
+// from startHeight to endHeight, starting from openingBalanceNanos, which is the balance after the block before
+// startHeight, or zero when starting from the genesis block, whose changes are the seed balances. The
+// reconstructed balance is compared against the stored balance. An endHeight past the committed tip is capped at
+// the committed tip.
+//
+// The UtxoOperations of every block from startHeight to the committed tip are read from the DB, including the
+// blocks after endHeight, which are needed to find the stored balance as of endHeight.
+func (bc *Blockchain) ReconcileDeSoBalance(publicKey []byte, startHeight uint64, endHeight uint64,
+	openingBalanceNanos uint64) (*DeSoBalanceReconciliationReport, error) {
+
+	if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("ReconcileDeSoBalance: Public key has length %d but expected length %d",
+			len(publicKey), btcec.PubKeyBytesLenCompressed)
+	}
+	if bc.postgres != nil {
+		return nil, fmt.Errorf("ReconcileDeSoBalance: Not supported when running with Postgres")
+	}
+
+	// Read the committed blocks and the stored balance under the chain lock, so that the balance is the one after
+	// the committed tip. The UtxoOperations of committed blocks don't change, so they're read without the lock.
+	bc.ChainLock.RLock()
+	committedTip, committedTipIndex := bc.GetCommittedTip()
+	if committedTip == nil {
+		bc.ChainLock.RUnlock()
+		return nil, fmt.Errorf("ReconcileDeSoBalance: No committed tip")
+	}
+	committedBlocks := append([]*BlockNode{}, bc.bestChain[:committedTipIndex+1]...)
+	storedTipBalanceNanos, err := DbGetDeSoBalanceNanosForPublicKey(bc.db, bc.snapshot, publicKey)
+	bc.ChainLock.RUnlock()
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReconcileDeSoBalance: Problem getting stored balance")
+	}
+
+	if endHeight > uint64(committedTip.Height) {
+		endHeight = uint64(committedTip.Height)
+	}
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("ReconcileDeSoBalance: Start height %d is after end height %d",
+			startHeight, endHeight)
+	}
+
+	report := &DeSoBalanceReconciliationReport{
+		PublicKey:           publicKey,
+		StartHeight:         startHeight,
+		EndHeight:           endHeight,
+		OpeningBalanceNanos: openingBalanceNanos,
+	}
+	balanceNanos := openingBalanceNanos
+	// The changes after endHeight are only added up, so that they can be undone from the stored balance.
+	creditsAfterEndNanos := uint64(0)
+	debitsAfterEndNanos := uint64(0)
+	for _, blockNode := range committedBlocks[startHeight:] {
+		blockHeight := uint64(blockNode.Height)
+		changes, err := bc._getDeSoBalanceChangesForBlock(publicKey, blockNode)
+		if err == badger.ErrKeyNotFound {
+			report.Discrepancies = append(report.Discrepancies, &DeSoBalanceDiscrepancy{
+				Type:        DeSoBalanceDiscrepancyMissingUtxoOps,
+				BlockHeight: blockHeight,
+				BlockHash:   blockNode.Hash,
+				Description: fmt.Sprintf("No UtxoOperations stored for block %v at height %d",
+					blockNode.Hash, blockHeight),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "ReconcileDeSoBalance: Problem getting changes for block %v at height %d",
+				blockNode.Hash, blockHeight)
+		}
+
+		for _, change := range changes {
+			if blockHeight > endHeight {
+				if change.IsCredit {
+					creditsAfterEndNanos, err = SafeUint64().Add(creditsAfterEndNanos, change.AmountNanos)
+				} else {
+					debitsAfterEndNanos, err = SafeUint64().Add(debitsAfterEndNanos, change.AmountNanos)
+				}
+				if err != nil {
+					return nil, errors.Wrapf(err, "ReconcileDeSoBalance: Problem adding up changes after end height")
+				}
+				continue
+			}
+
+			if change.IsCredit {
+				if balanceNanos, err = SafeUint64().Add(balanceNanos, change.AmountNanos); err != nil {
+					return nil, errors.Wrapf(err, "ReconcileDeSoBalance: Problem adding change at height %d",
+						blockHeight)
+				}
+			} else if change.AmountNanos > balanceNanos {
+				report.Discrepancies = append(report.Discrepancies, &DeSoBalanceDiscrepancy{
+					Type:        DeSoBalanceDiscrepancyNegativeBalance,
+					BlockHeight: blockHeight,
+					BlockHash:   blockNode.Hash,
+					Description: fmt.Sprintf("%v of txn %v spends %d nanos from a reconstructed balance of %d nanos",
+						change.OperationType, change.TxnHash, change.AmountNanos, balanceNanos),
+				})
+				balanceNanos = 0
+			} else {
+				balanceNanos -= change.AmountNanos
+			}
+			change.BalanceAfterNanos = balanceNanos
+			report.Changes = append(report.Changes, change)
+		}
+	}
+	report.ReconstructedBalanceNanos = balanceNanos
+
+	// Undo the changes after endHeight to find the stored balance as of endHeight.
+	storedBalanceNanos, err := SafeUint64().Add(storedTipBalanceNanos, debitsAfterEndNanos)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReconcileDeSoBalance: Problem undoing changes after end height")
+	}
+	if creditsAfterEndNanos > storedBalanceNanos {
+		report.Discrepancies = append(report.Discrepancies, &DeSoBalanceDiscrepancy{
+			Type:        DeSoBalanceDiscrepancyBalanceMismatch,
+			BlockHeight: endHeight,
+			Description: fmt.Sprintf("The stored balance of %d nanos at the committed tip is less than the %d nanos "+
+				"credited after height %d", storedTipBalanceNanos, creditsAfterEndNanos, endHeight),
+		})
+		return report, nil
+	}
+	report.StoredBalanceNanos = storedBalanceNanos - creditsAfterEndNanos
+	if report.ReconstructedBalanceNanos != report.StoredBalanceNanos {
+		report.Discrepancies = append(report.Discrepancies, &DeSoBalanceDiscrepancy{
+			Type:        DeSoBalanceDiscrepancyBalanceMismatch,
+			BlockHeight: endHeight,
+			Description: fmt.Sprintf("Reconstructed balance of %d nanos doesn't match the stored balance of %d nanos "+
+				"at height %d", report.ReconstructedBalanceNanos, report.StoredBalanceNanos, endHeight),
+		})
+	}
+	return report, nil
+}
+
+// _getDeSoBalanceChangesForBlock returns the changes to the public key's balance in the block, in the order they
+// were applied. It returns badger.ErrKeyNotFound if the block's UtxoOperations aren't stored.
+func (bc *Blockchain) _getDeSoBalanceChangesForBlock(publicKey []byte, blockNode *BlockNode) (
+	[]*DeSoBalanceChange, error) {
+
+	// The genesis block has no UtxoOperations. Its changes are the seed balances, which are added when the DB is
+	// initialized.
+	var changes []*DeSoBalanceChange
+	if blockNode.Height == 0 {
+		for _, seedBalance := range bc.params.SeedBalances {
+			if seedBalance.AmountNanos == 0 || !bytes.Equal(seedBalance.PublicKey, publicKey) {
+				continue
+			}
+			changes = append(changes, &DeSoBalanceChange{
+				BlockHash:     blockNode.Hash,
+				OperationType: OperationTypeAddUtxo,
+				AmountNanos:   seedBalance.AmountNanos,
+				IsCredit:      true,
+			})
+		}
+		return changes, nil
+	}
+
+	utxoOpsForBlock, err := GetUtxoOperationsForBlock(bc.db, bc.snapshot, blockNode.Hash)
+	if err != nil {
+		return nil, err
+	}
+	// The block is only needed to attribute the changes to its transactions.
+	var txnHashes []*BlockHash
+	if block := bc.GetBlock(blockNode.Hash); block != nil {
+		if txnHashes, err = ComputeTransactionHashes(block.Txns); err != nil {
+			return nil, errors.Wrapf(err, "_getDeSoBalanceChangesForBlock: Problem hashing txns")
+		}
+	}
+
+	var addChanges func(utxoOps []*UtxoOperation, txnHash *BlockHash)
+	addChanges = func(utxoOps []*UtxoOperation, txnHash *BlockHash) {
+		for _, utxoOp := range utxoOps {
+			change := &DeSoBalanceChange{
+				BlockHeight:   uint64(blockNode.Height),
+				BlockHash:     blockNode.Hash,
+				TxnHash:       txnHash,
+				OperationType: utxoOp.Type,
+			}
+			var changePublicKey []byte
+			switch utxoOp.Type {
+			case OperationTypeAddUtxo, OperationTypeSpendUtxo:
+				if utxoOp.Entry == nil {
+					continue
+				}
+				changePublicKey = utxoOp.Entry.PublicKey
+				change.AmountNanos = utxoOp.Entry.AmountNanos
+				change.IsCredit = utxoOp.Type == OperationTypeAddUtxo
+			case OperationTypeAddBalance, OperationTypeSpendBalance, OperationTypeStakeDistributionPayToBalance:
+				changePublicKey = utxoOp.BalancePublicKey
+				change.AmountNanos = utxoOp.BalanceAmountNanos
+				change.IsCredit = utxoOp.Type != OperationTypeSpendBalance
+			case OperationTypeAtomicTxnsWrapper:
+				for _, innerUtxoOps := range utxoOp.AtomicTxnsInnerUtxoOps {
+					addChanges(innerUtxoOps, txnHash)
+				}
+				continue
+			default:
+				continue
+			}
+			if change.AmountNanos == 0 || !bytes.Equal(changePublicKey, publicKey) {
+				continue
+			}
+			changes = append(changes, change)
+		}
+	}
+	for ii, utxoOps := range utxoOpsForBlock {
+		var txnHash *BlockHash
+		if ii < len(txnHashes) {
+			txnHash = txnHashes[ii]
+		}
+		addChanges(utxoOps, txnHash)
+	}
+	return changes, nil
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileDeSoBalance(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+
+	// Mine two blocks to give the sender some DeSo, then send some of it to the recipient, and then have the
+	// recipient send some of it back.
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	transfer := func(amountNanos uint64, senderPk string, recipientPk string, senderPriv string) (
+		*MsgDeSoTxn, *MsgDeSoBlock) {
+
+		txn := _assembleBasicTransferTxnFullySigned(t, chain, amountNanos, 10, senderPk, recipientPk, senderPriv,
+			mempool)
+		_, err := mempool.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+		require.NoError(err)
+		block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+		require.Equal(2, len(block.Txns))
+		return txn, block
+	}
+	txn, transferBlock := transfer(1000, senderPkString, recipientPkString, senderPrivString)
+	refundTxn, refundBlock := transfer(500, recipientPkString, senderPkString, recipientPrivString)
+	transferHeight := uint64(transferBlock.Header.Height)
+	refundHeight := uint64(refundBlock.Header.Height)
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	recipientPkBytes, _, err := Base58CheckDecode(recipientPkString)
+	require.NoError(err)
+	senderBalanceNanos, err := DbGetDeSoBalanceNanosForPublicKey(db, chain.snapshot, senderPkBytes)
+	require.NoError(err)
+
+	// The sender's balance reconciles from genesis. The sender mined every block, so they were credited a block
+	// reward in each of them, and they only spent DeSo on the transfer.
+	report, err := chain.ReconcileDeSoBalance(senderPkBytes, 0, math.MaxUint64, 0)
+	require.NoError(err)
+	require.True(report.IsReconciled())
+	require.Equal(refundHeight, report.EndHeight)
+	require.Equal(senderBalanceNanos, report.ReconstructedBalanceNanos)
+	require.Equal(senderBalanceNanos, report.StoredBalanceNanos)
+	spends := 0
+	for _, change := range report.Changes {
+		if !change.IsCredit {
+			spends++
+			require.Equal(transferHeight, change.BlockHeight)
+			require.Equal(txn.Hash(), change.TxnHash)
+		}
+	}
+	require.NotZero(spends)
+
+	// The recipient was credited by the transfer, and spent it on the refund and its fee, getting the rest back as
+	// change. Every change of the refund belongs to the refund txn.
+	report, err = chain.ReconcileDeSoBalance(recipientPkBytes, 0, math.MaxUint64, 0)
+	require.NoError(err)
+	require.True(report.IsReconciled())
+	require.Equal(uint64(1000), report.Changes[0].AmountNanos)
+	require.True(report.Changes[0].IsCredit)
+	require.Equal(txn.Hash(), report.Changes[0].TxnHash)
+	require.Equal(uint64(1000), report.Changes[0].BalanceAfterNanos)
+	require.Greater(len(report.Changes), 2)
+	for _, change := range report.Changes[1:] {
+		require.Equal(refundHeight, change.BlockHeight)
+		require.Equal(refundTxn.Hash(), change.TxnHash)
+	}
+	require.Less(report.ReconstructedBalanceNanos, uint64(500))
+	recipientBalanceNanos := report.ReconstructedBalanceNanos
+
+	// A range that ends before the tip reconciles against the stored balance with the later changes undone, and the
+	// next range reconciles starting from its reconstructed balance.
+	report, err = chain.ReconcileDeSoBalance(senderPkBytes, 0, transferHeight-1, 0)
+	require.NoError(err)
+	require.True(report.IsReconciled())
+	balanceBeforeTransferNanos := report.ReconstructedBalanceNanos
+	report, err = chain.ReconcileDeSoBalance(senderPkBytes, transferHeight, math.MaxUint64, balanceBeforeTransferNanos)
+	require.NoError(err)
+	require.True(report.IsReconciled())
+	require.Equal(senderBalanceNanos, report.ReconstructedBalanceNanos)
+
+	// A wrong opening balance doesn't reconcile, and an opening balance that's too low to cover a spend drives the
+	// balance negative.
+	report, err = chain.ReconcileDeSoBalance(senderPkBytes, transferHeight, math.MaxUint64, balanceBeforeTransferNanos+1)
+	require.NoError(err)
+	require.Len(report.Discrepancies, 1)
+	require.Equal(DeSoBalanceDiscrepancyBalanceMismatch, report.Discrepancies[0].Type)
+	report, err = chain.ReconcileDeSoBalance(recipientPkBytes, refundHeight, refundHeight, 0)
+	require.NoError(err)
+	require.Len(report.Discrepancies, 1)
+	require.Equal(DeSoBalanceDiscrepancyNegativeBalance, report.Discrepancies[0].Type)
+	require.Equal(refundHeight, report.Discrepancies[0].BlockHeight)
+	require.Equal(recipientBalanceNanos, report.StoredBalanceNanos)
+
+	// A block without UtxoOperations is reported, along with the spend that its missing changes would have covered.
+	transferBlockHash, err := transferBlock.Header.Hash()
+	require.NoError(err)
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return DeleteUtxoOperationsForBlockWithTxn(txn, chain.snapshot, transferBlockHash, nil, true)
+	}))
+	report, err = chain.ReconcileDeSoBalance(recipientPkBytes, 0, math.MaxUint64, 0)
+	require.NoError(err)
+	require.Len(report.Discrepancies, 2)
+	require.Equal(DeSoBalanceDiscrepancyMissingUtxoOps, report.Discrepancies[0].Type)
+	require.Equal(transferBlockHash, report.Discrepancies[0].BlockHash)
+	require.Equal(DeSoBalanceDiscrepancyNegativeBalance, report.Discrepancies[1].Type)
+
+	// The start height can't be after the end height.
+	_, err = chain.ReconcileDeSoBalance(senderPkBytes, transferHeight, transferHeight-1, 0)
+	require.Error(err)
+}
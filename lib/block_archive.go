@@ -0,0 +1,517 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// A block archive is a copy of the committed block history that a new node can download from static file
+// hosting, e.g. a CDN or an object storage bucket, instead of requesting every block from its peers with
+// GetBlocks. It consists of:
+//   - Segment files, each holding the blocks of a contiguous range of heights. Each block is stored as its
+//     uvarint-prefixed ToBytes encoding.
+//   - A manifest.json file listing the segments in height order, with the size and SHA-256 of each segment and
+//     the hashes of its first and last blocks.
+//
+// Archives are written by ExportBlockArchive from the DB of a synced node, and uploaded as-is. A node imports them
+// with a BlockArchiveImporter, which downloads the segments over HTTP, resuming partial downloads with range
+// requests, checks them against the manifest, and processes their blocks as if they had been received from a peer,
+// signatures included. Nothing in an archive is trusted: a bad archive can only slow down the sync, since the node
+// falls back to syncing from its peers.
+
+const (
+	BlockArchiveManifestFileName = "manifest.json"
+
+	// BlockArchiveDownloadDirName is the name of the folder, relative to the node's data directory, in which
+	// segments are downloaded before they're imported.
+	BlockArchiveDownloadDirName = "block_archive"
+
+	// BlockArchiveVersion is the version of the archive format written by ExportBlockArchive.
+	BlockArchiveVersion = uint64(1)
+
+	// DefaultBlockArchiveSegmentMaxSizeBytes is the size at which the exporter starts a new segment. Segments are
+	// downloaded and checked one at a time, so they're kept small enough to download in one go.
+	DefaultBlockArchiveSegmentMaxSizeBytes = uint64(64 << 20) // 64MB
+)
+
+// BlockArchiveManifest describes the segments of a block archive.
+type BlockArchiveManifest struct {
+	Version uint64
+	// GenesisBlockHash identifies the network the archive belongs to.
+	GenesisBlockHash string
+	StartHeight      uint64
+	EndHeight        uint64
+	Segments         []*BlockArchiveSegment
+}
+
+// BlockArchiveSegment describes one segment file of a block archive. Hashes are hex-encoded.
+type BlockArchiveSegment struct {
+	FileName       string
+	StartHeight    uint64
+	EndHeight      uint64
+	SizeBytes      uint64
+	SHA256         string
+	FirstBlockHash string
+	LastBlockHash  string
+}
+
+func GetBlockArchiveDownloadPath(dataDir string) string {
+	return filepath.Join(dataDir, BlockArchiveDownloadDirName)
+}
+
+func blockArchiveSegmentFileName(startHeight uint64, endHeight uint64) string {
+	return fmt.Sprintf("blocks-%010d-%010d.blk", startHeight, endHeight)
+}
+
+// Validate checks that the manifest belongs to the network and that its segments cover its height range in order.
+func (manifest *BlockArchiveManifest) Validate(params *DeSoParams) error {
+	if manifest.Version != BlockArchiveVersion {
+		return fmt.Errorf("BlockArchiveManifest.Validate: Unsupported version %v, expected %v",
+			manifest.Version, BlockArchiveVersion)
+	}
+	if manifest.GenesisBlockHash != params.GenesisBlockHashHex {
+		return fmt.Errorf("BlockArchiveManifest.Validate: Genesis block hash %v doesn't match the network's %v",
+			manifest.GenesisBlockHash, params.GenesisBlockHashHex)
+	}
+	if len(manifest.Segments) == 0 {
+		return fmt.Errorf("BlockArchiveManifest.Validate: Manifest has no segments")
+	}
+	nextHeight := manifest.StartHeight
+	for _, segment := range manifest.Segments {
+		// Segment file names are joined to the archive's location, so they can't be allowed to point anywhere else.
+		if segment.FileName == "" || filepath.Base(segment.FileName) != segment.FileName ||
+			strings.ContainsAny(segment.FileName, `/\`) || segment.FileName == "." || segment.FileName == ".." {
+			return fmt.Errorf("BlockArchiveManifest.Validate: Invalid segment file name %q", segment.FileName)
+		}
+		if segment.StartHeight != nextHeight || segment.EndHeight < segment.StartHeight {
+			return fmt.Errorf("BlockArchiveManifest.Validate: Segment %v covers heights %v to %v, expected it "+
+				"to start at %v", segment.FileName, segment.StartHeight, segment.EndHeight, nextHeight)
+		}
+		if len(segment.SHA256) != 2*sha256.Size {
+			return fmt.Errorf("BlockArchiveManifest.Validate: Segment %v has an invalid SHA256 %v",
+				segment.FileName, segment.SHA256)
+		}
+		nextHeight = segment.EndHeight + 1
+	}
+	if nextHeight != manifest.EndHeight+1 {
+		return fmt.Errorf("BlockArchiveManifest.Validate: Segments end at height %v, expected %v",
+			nextHeight-1, manifest.EndHeight)
+	}
+	return nil
+}
+
+//
+// Export
+//
+
+// ExportBlockArchive writes the committed blocks of the best chain in the DB, from startHeight to endHeight
+// inclusive, to a block archive in dir. An endHeight of zero, or one above the highest committed block, exports up
+// to the highest committed block. The node must have the bodies of all the blocks in the range, so a node that
+// hypersynced can only export the blocks after its snapshot.
+func ExportBlockArchive(handle *badger.DB, params *DeSoParams, dir string, startHeight uint64, endHeight uint64,
+	maxSegmentSizeBytes uint64) (*BlockArchiveManifest, error) {
+
+	blockHashes, endHeight, err := _getBlockArchiveHashes(handle, startHeight, endHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ExportBlockArchive: ")
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "ExportBlockArchive: Problem creating directory %v", dir)
+	}
+
+	manifest := &BlockArchiveManifest{
+		Version:          BlockArchiveVersion,
+		GenesisBlockHash: params.GenesisBlockHashHex,
+		StartHeight:      startHeight,
+		EndHeight:        endHeight,
+	}
+	var segmentBytes []byte
+	var segment *BlockArchiveSegment
+	for ii, blockHash := range blockHashes {
+		height := startHeight + uint64(ii)
+		block, err := GetBlock(blockHash, handle, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ExportBlockArchive: Problem reading block %v at height %v",
+				blockHash, height)
+		}
+		blockBytes, err := block.ToBytes(false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ExportBlockArchive: Problem encoding block %v", blockHash)
+		}
+		if segment == nil {
+			segment = &BlockArchiveSegment{StartHeight: height, FirstBlockHash: blockHash.String()}
+		}
+		segmentBytes = append(segmentBytes, EncodeByteArray(blockBytes)...)
+		segment.EndHeight = height
+		segment.LastBlockHash = blockHash.String()
+
+		if uint64(len(segmentBytes)) >= maxSegmentSizeBytes || height == endHeight {
+			if err = _writeBlockArchiveSegment(dir, segment, segmentBytes); err != nil {
+				return nil, errors.Wrapf(err, "ExportBlockArchive: ")
+			}
+			manifest.Segments = append(manifest.Segments, segment)
+			segment = nil
+			segmentBytes = nil
+		}
+	}
+
+	// The manifest is written last, and atomically, so an archive is never visible with missing segments.
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "ExportBlockArchive: Problem encoding manifest")
+	}
+	manifestPath := filepath.Join(dir, BlockArchiveManifestFileName)
+	if err = os.WriteFile(manifestPath+".tmp", manifestBytes, 0644); err != nil {
+		return nil, errors.Wrapf(err, "ExportBlockArchive: Problem writing manifest")
+	}
+	if err = os.Rename(manifestPath+".tmp", manifestPath); err != nil {
+		return nil, errors.Wrapf(err, "ExportBlockArchive: Problem writing manifest")
+	}
+	glog.Infof("ExportBlockArchive: Exported blocks %v to %v in %v segments to %v",
+		startHeight, endHeight, len(manifest.Segments), dir)
+	return manifest, nil
+}
+
+// _getBlockArchiveHashes walks the best chain in the DB back from its tip, and returns the hashes of the committed
+// blocks from startHeight to endHeight, along with the end height that was used.
+func _getBlockArchiveHashes(handle *badger.DB, startHeight uint64, endHeight uint64) (
+	_blockHashes []*BlockHash, _endHeight uint64, _err error) {
+
+	hash := DbGetBestHash(handle, nil, ChainTypeDeSoBlock)
+	if hash == nil {
+		return nil, 0, fmt.Errorf("_getBlockArchiveHashes: No best chain in the DB")
+	}
+	tipBlock, err := GetBlock(hash, handle, nil)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "_getBlockArchiveHashes: Problem reading tip block %v", hash)
+	}
+
+	var blockHashes []*BlockHash
+	foundEnd := false
+	for height := tipBlock.Header.Height; height >= startHeight; height-- {
+		node := GetHeightHashToNodeInfo(handle, nil, uint32(height), hash, false)
+		if node == nil {
+			return nil, 0, fmt.Errorf("_getBlockArchiveHashes: Missing block node %v at height %v", hash, height)
+		}
+		// Uncommitted PoS blocks can still be reorged, so they're never exported.
+		if !foundEnd && node.IsCommitted() && (endHeight == 0 || height <= endHeight) {
+			foundEnd = true
+			endHeight = height
+		}
+		if foundEnd {
+			blockHashes = append(blockHashes, hash)
+		}
+		if height == 0 {
+			break
+		}
+		hash = node.Header.PrevBlockHash
+	}
+	if !foundEnd || uint64(len(blockHashes)) != endHeight-startHeight+1 {
+		return nil, 0, fmt.Errorf("_getBlockArchiveHashes: No committed blocks from height %v", startHeight)
+	}
+
+	// The hashes were collected from the tip down.
+	for ii, jj := 0, len(blockHashes)-1; ii < jj; ii, jj = ii+1, jj-1 {
+		blockHashes[ii], blockHashes[jj] = blockHashes[jj], blockHashes[ii]
+	}
+	return blockHashes, endHeight, nil
+}
+
+func _writeBlockArchiveSegment(dir string, segment *BlockArchiveSegment, segmentBytes []byte) error {
+	segment.FileName = blockArchiveSegmentFileName(segment.StartHeight, segment.EndHeight)
+	segment.SizeBytes = uint64(len(segmentBytes))
+	checksum := sha256.Sum256(segmentBytes)
+	segment.SHA256 = hex.EncodeToString(checksum[:])
+	if err := os.WriteFile(filepath.Join(dir, segment.FileName), segmentBytes, 0644); err != nil {
+		return errors.Wrapf(err, "_writeBlockArchiveSegment: Problem writing segment %v", segment.FileName)
+	}
+	return nil
+}
+
+//
+// Import
+//
+
+// BlockArchiveImporter imports the blocks of a block archive into a Blockchain. The source is either the base URL
+// the archive's files are served from, or a local directory holding them.
+type BlockArchiveImporter struct {
+	blockchain *Blockchain
+	source     string
+	// downloadDir is where segments are downloaded to before they're checked and imported. Partial downloads are
+	// kept there, so an interrupted import resumes where it left off.
+	downloadDir string
+	httpClient  *http.Client
+}
+
+func NewBlockArchiveImporter(blockchain *Blockchain, source string, downloadDir string) *BlockArchiveImporter {
+	return &BlockArchiveImporter{
+		blockchain:  blockchain,
+		source:      strings.TrimSuffix(source, "/"),
+		downloadDir: downloadDir,
+		httpClient:  &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+func (importer *BlockArchiveImporter) isRemote() bool {
+	return strings.HasPrefix(importer.source, "http://") || strings.HasPrefix(importer.source, "https://")
+}
+
+// Import fetches the archive's manifest, then downloads, checks, and processes every segment with blocks above the
+// block tip, in order. It returns the number of blocks it processed. Blocks that were processed before an error
+// stay processed, so Import can be called again to continue.
+func (importer *BlockArchiveImporter) Import() (_numBlocksProcessed uint64, _err error) {
+	manifest, err := importer.fetchManifest()
+	if err != nil {
+		return 0, errors.Wrapf(err, "BlockArchiveImporter.Import: ")
+	}
+	if err = manifest.Validate(importer.blockchain.params); err != nil {
+		return 0, errors.Wrapf(err, "BlockArchiveImporter.Import: ")
+	}
+
+	var numBlocksProcessed uint64
+	for _, segment := range manifest.Segments {
+		if segment.EndHeight <= uint64(importer.blockchain.BlockTip().Height) {
+			continue
+		}
+		segmentPath, err := importer.fetchSegment(segment)
+		if err != nil {
+			return numBlocksProcessed, errors.Wrapf(err, "BlockArchiveImporter.Import: ")
+		}
+		numSegmentBlocksProcessed, err := importer.processSegment(segment, segmentPath)
+		numBlocksProcessed += numSegmentBlocksProcessed
+		if err != nil {
+			return numBlocksProcessed, errors.Wrapf(err, "BlockArchiveImporter.Import: ")
+		}
+		if importer.isRemote() {
+			if err = os.Remove(segmentPath); err != nil {
+				glog.Errorf("BlockArchiveImporter.Import: Problem removing segment %v: %v", segmentPath, err)
+			}
+		}
+		glog.Infof("BlockArchiveImporter.Import: Processed segment %v, block tip is now at height %v",
+			segment.FileName, importer.blockchain.BlockTip().Height)
+	}
+	return numBlocksProcessed, nil
+}
+
+func (importer *BlockArchiveImporter) fetchManifest() (*BlockArchiveManifest, error) {
+	var manifestBytes []byte
+	var err error
+	if importer.isRemote() {
+		manifestBytes, err = importer.httpGet(importer.source + "/" + BlockArchiveManifestFileName)
+	} else {
+		manifestBytes, err = os.ReadFile(filepath.Join(importer.source, BlockArchiveManifestFileName))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "BlockArchiveImporter.fetchManifest: Problem fetching manifest")
+	}
+	manifest := &BlockArchiveManifest{}
+	if err = json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil, errors.Wrapf(err, "BlockArchiveImporter.fetchManifest: Problem decoding manifest")
+	}
+	return manifest, nil
+}
+
+func (importer *BlockArchiveImporter) httpGet(url string) ([]byte, error) {
+	resp, err := importer.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v returned status %v", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// fetchSegment returns the path of a local copy of the segment whose size and SHA-256 match the manifest,
+// downloading it first if the archive is remote.
+func (importer *BlockArchiveImporter) fetchSegment(segment *BlockArchiveSegment) (string, error) {
+	segmentPath := filepath.Join(importer.source, segment.FileName)
+	if importer.isRemote() {
+		segmentPath = filepath.Join(importer.downloadDir, segment.FileName)
+		if err := importer.downloadSegment(segment, segmentPath); err != nil {
+			return "", errors.Wrapf(err, "BlockArchiveImporter.fetchSegment: ")
+		}
+	}
+	if err := _checkBlockArchiveSegmentFile(segment, segmentPath); err != nil {
+		// A corrupt download is removed so the next attempt starts over.
+		if importer.isRemote() {
+			os.Remove(segmentPath)
+		}
+		return "", errors.Wrapf(err, "BlockArchiveImporter.fetchSegment: ")
+	}
+	return segmentPath, nil
+}
+
+// downloadSegment downloads the segment to segmentPath. The download goes to a .part file first, and if one is
+// left over from an earlier attempt, only the rest of the segment is requested with a Range header.
+func (importer *BlockArchiveImporter) downloadSegment(segment *BlockArchiveSegment, segmentPath string) error {
+	if _, err := os.Stat(segmentPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(importer.downloadDir, 0755); err != nil {
+		return errors.Wrapf(err, "BlockArchiveImporter.downloadSegment: Problem creating %v", importer.downloadDir)
+	}
+	partPath := segmentPath + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil && uint64(info.Size()) <= segment.SizeBytes {
+		offset = info.Size()
+	}
+
+	if uint64(offset) < segment.SizeBytes {
+		url := importer.source + "/" + segment.FileName
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return errors.Wrapf(err, "BlockArchiveImporter.downloadSegment: ")
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		resp, err := importer.httpClient.Do(req)
+		if err != nil {
+			return errors.Wrapf(err, "BlockArchiveImporter.downloadSegment: Problem requesting %v", url)
+		}
+		defer resp.Body.Close()
+
+		flags := os.O_CREATE | os.O_WRONLY
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			flags |= os.O_APPEND
+		case http.StatusOK:
+			// The server ignored the Range header and sent the whole segment.
+			flags |= os.O_TRUNC
+		default:
+			return fmt.Errorf("BlockArchiveImporter.downloadSegment: GET %v returned status %v", url, resp.Status)
+		}
+		file, err := os.OpenFile(partPath, flags, 0644)
+		if err != nil {
+			return errors.Wrapf(err, "BlockArchiveImporter.downloadSegment: Problem opening %v", partPath)
+		}
+		// Never write more than the manifest says the segment holds.
+		_, copyErr := io.Copy(file, io.LimitReader(resp.Body, int64(segment.SizeBytes)))
+		closeErr := file.Close()
+		if copyErr != nil {
+			return errors.Wrapf(copyErr, "BlockArchiveImporter.downloadSegment: Problem downloading %v", url)
+		}
+		if closeErr != nil {
+			return errors.Wrapf(closeErr, "BlockArchiveImporter.downloadSegment: Problem writing %v", partPath)
+		}
+	}
+	if err := os.Rename(partPath, segmentPath); err != nil {
+		return errors.Wrapf(err, "BlockArchiveImporter.downloadSegment: Problem renaming %v", partPath)
+	}
+	return nil
+}
+
+func _checkBlockArchiveSegmentFile(segment *BlockArchiveSegment, segmentPath string) error {
+	file, err := os.Open(segmentPath)
+	if err != nil {
+		return errors.Wrapf(err, "_checkBlockArchiveSegmentFile: Problem opening %v", segmentPath)
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return errors.Wrapf(err, "_checkBlockArchiveSegmentFile: Problem reading %v", segmentPath)
+	}
+	if uint64(size) != segment.SizeBytes {
+		return fmt.Errorf("_checkBlockArchiveSegmentFile: Segment %v has size %v, expected %v",
+			segment.FileName, size, segment.SizeBytes)
+	}
+	if checksum := hex.EncodeToString(hasher.Sum(nil)); checksum != segment.SHA256 {
+		return fmt.Errorf("_checkBlockArchiveSegmentFile: Segment %v has SHA256 %v, expected %v",
+			segment.FileName, checksum, segment.SHA256)
+	}
+	return nil
+}
+
+// processSegment decodes the segment's blocks and checks that they have the expected heights and link up with each
+// other and with the chain. Blocks at or below the block tip must already be on the best chain, and are skipped.
+// The rest are processed in order.
+func (importer *BlockArchiveImporter) processSegment(segment *BlockArchiveSegment, segmentPath string) (
+	_numBlocksProcessed uint64, _err error) {
+
+	segmentBytes, err := os.ReadFile(segmentPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "BlockArchiveImporter.processSegment: Problem reading %v", segmentPath)
+	}
+	rr := bytes.NewReader(segmentBytes)
+	bc := importer.blockchain
+
+	var numBlocksProcessed uint64
+	var prevBlockHash *BlockHash
+	for height := segment.StartHeight; height <= segment.EndHeight; height++ {
+		blockLen, err := ReadUvarint(rr)
+		if err != nil || blockLen > uint64(rr.Len()) {
+			return numBlocksProcessed, fmt.Errorf("BlockArchiveImporter.processSegment: Segment %v is "+
+				"truncated at height %v", segment.FileName, height)
+		}
+		blockBytes := make([]byte, blockLen)
+		if _, err = io.ReadFull(rr, blockBytes); err != nil {
+			return numBlocksProcessed, errors.Wrapf(err, "BlockArchiveImporter.processSegment: ")
+		}
+		block := &MsgDeSoBlock{}
+		if err = block.FromBytes(blockBytes); err != nil {
+			return numBlocksProcessed, errors.Wrapf(err, "BlockArchiveImporter.processSegment: Problem "+
+				"decoding block at height %v", height)
+		}
+		blockHash, err := block.Hash()
+		if err != nil {
+			return numBlocksProcessed, errors.Wrapf(err, "BlockArchiveImporter.processSegment: ")
+		}
+		if block.Header.Height != height {
+			return numBlocksProcessed, fmt.Errorf("BlockArchiveImporter.processSegment: Block %v has height "+
+				"%v, expected %v", blockHash, block.Header.Height, height)
+		}
+		if (height == segment.StartHeight && blockHash.String() != segment.FirstBlockHash) ||
+			(height == segment.EndHeight && blockHash.String() != segment.LastBlockHash) {
+			return numBlocksProcessed, fmt.Errorf("BlockArchiveImporter.processSegment: Block %v at height %v "+
+				"doesn't match the manifest", blockHash, height)
+		}
+		if prevBlockHash != nil && !prevBlockHash.IsEqual(block.Header.PrevBlockHash) {
+			return numBlocksProcessed, fmt.Errorf("BlockArchiveImporter.processSegment: Block %v at height %v "+
+				"doesn't build on the previous block %v", blockHash, height, prevBlockHash)
+		}
+		prevBlockHash = blockHash
+
+		if tipHeight := uint64(bc.BlockTip().Height); height <= tipHeight {
+			bc.ChainLock.RLock()
+			bestChainHash := bc.bestChain[height].Hash
+			bc.ChainLock.RUnlock()
+			if !bestChainHash.IsEqual(blockHash) {
+				return numBlocksProcessed, fmt.Errorf("BlockArchiveImporter.processSegment: Block %v at height "+
+					"%v isn't on the best chain, which has %v", blockHash, height, bestChainHash)
+			}
+			continue
+		}
+
+		_, isOrphan, _, err := bc.ProcessBlock(block, true)
+		if err != nil {
+			return numBlocksProcessed, errors.Wrapf(err, "BlockArchiveImporter.processSegment: Problem "+
+				"processing block %v at height %v", blockHash, height)
+		}
+		if isOrphan {
+			return numBlocksProcessed, fmt.Errorf("BlockArchiveImporter.processSegment: Block %v at height %v "+
+				"is an orphan", blockHash, height)
+		}
+		numBlocksProcessed++
+	}
+	if rr.Len() != 0 {
+		return numBlocksProcessed, fmt.Errorf("BlockArchiveImporter.processSegment: Segment %v has %v extra "+
+			"bytes", segment.FileName, rr.Len())
+	}
+	return numBlocksProcessed, nil
+}
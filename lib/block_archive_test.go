@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockArchiveExportAndImport(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	for ii := 0; ii < 5; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	tipHeight := uint64(chain.BlockTip().Height)
+
+	// Tiny segments make every block its own segment.
+	archiveDir := t.TempDir()
+	manifest, err := ExportBlockArchive(db, params, archiveDir, 1, 0, 1)
+	require.NoError(err)
+	require.NoError(manifest.Validate(params))
+	require.Equal(uint64(1), manifest.StartHeight)
+	require.Equal(tipHeight, manifest.EndHeight)
+	require.Len(manifest.Segments, int(tipHeight))
+
+	// A node with only the genesis block imports the archive from a directory.
+	importChain, _, _ := NewLowDifficultyBlockchain(t)
+	numBlocksProcessed, err := NewBlockArchiveImporter(importChain, archiveDir, t.TempDir()).Import()
+	require.NoError(err)
+	require.Equal(tipHeight, numBlocksProcessed)
+	require.True(importChain.BlockTip().Hash.IsEqual(chain.BlockTip().Hash))
+
+	// Importing again doesn't process anything.
+	numBlocksProcessed, err = NewBlockArchiveImporter(importChain, archiveDir, t.TempDir()).Import()
+	require.NoError(err)
+	require.Zero(numBlocksProcessed)
+
+	// Over HTTP, a partial download left over from an earlier attempt is resumed with a range request.
+	archiveManifest := manifest
+	manifest, err = ExportBlockArchive(db, params, archiveDir, 1, 3, DefaultBlockArchiveSegmentMaxSizeBytes)
+	require.NoError(err)
+	require.Len(manifest.Segments, 1)
+	var rangeHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(ww http.ResponseWriter, req *http.Request) {
+		rangeHeaders = append(rangeHeaders, req.Header.Get("Range"))
+		http.ServeFile(ww, req, filepath.Join(archiveDir, filepath.Base(req.URL.Path)))
+	}))
+	defer server.Close()
+
+	downloadDir := t.TempDir()
+	segment := manifest.Segments[0]
+	segmentBytes, err := os.ReadFile(filepath.Join(archiveDir, segment.FileName))
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(downloadDir, segment.FileName+".part"), segmentBytes[:10], 0644))
+
+	httpChain, _, _ := NewLowDifficultyBlockchain(t)
+	numBlocksProcessed, err = NewBlockArchiveImporter(httpChain, server.URL+"/", downloadDir).Import()
+	require.NoError(err)
+	require.Equal(uint64(3), numBlocksProcessed)
+	require.Equal(uint32(3), httpChain.BlockTip().Height)
+	require.Equal([]string{"", "bytes=10-"}, rangeHeaders)
+	// Imported segments are removed from the download directory.
+	downloadedFiles, err := os.ReadDir(downloadDir)
+	require.NoError(err)
+	require.Empty(downloadedFiles)
+
+	// A corrupted segment is rejected before any of its blocks are processed.
+	manifest = archiveManifest
+	manifestBytes, err := json.Marshal(manifest)
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(archiveDir, BlockArchiveManifestFileName), manifestBytes, 0644))
+	segment = manifest.Segments[3]
+	segmentPath := filepath.Join(archiveDir, segment.FileName)
+	segmentBytes, err = os.ReadFile(segmentPath)
+	require.NoError(err)
+	segmentBytes[len(segmentBytes)-1] ^= 0xff
+	require.NoError(os.WriteFile(segmentPath, segmentBytes, 0644))
+	numBlocksProcessed, err = NewBlockArchiveImporter(httpChain, server.URL, t.TempDir()).Import()
+	require.Error(err)
+	require.Zero(numBlocksProcessed)
+	require.Equal(uint32(3), httpChain.BlockTip().Height)
+}
+
+func TestBlockArchiveManifestValidate(t *testing.T) {
+	require := require.New(t)
+	params := &DeSoTestnetParams
+
+	newManifest := func() *BlockArchiveManifest {
+		return &BlockArchiveManifest{
+			Version:          BlockArchiveVersion,
+			GenesisBlockHash: params.GenesisBlockHashHex,
+			StartHeight:      1,
+			EndHeight:        5,
+			Segments: []*BlockArchiveSegment{
+				{FileName: blockArchiveSegmentFileName(1, 2), StartHeight: 1, EndHeight: 2, SHA256: RandomBytesHex(32)},
+				{FileName: blockArchiveSegmentFileName(3, 5), StartHeight: 3, EndHeight: 5, SHA256: RandomBytesHex(32)},
+			},
+		}
+	}
+	require.NoError(newManifest().Validate(params))
+
+	manifest := newManifest()
+	manifest.GenesisBlockHash = RandomBytesHex(HashSizeBytes)
+	require.Error(manifest.Validate(params))
+
+	manifest = newManifest()
+	manifest.Segments[1].StartHeight = 4
+	require.Error(manifest.Validate(params))
+
+	manifest = newManifest()
+	manifest.EndHeight = 6
+	require.Error(manifest.Validate(params))
+
+	for _, fileName := range []string{"", "..", "../manifest.json", "dir/segment.blk"} {
+		manifest = newManifest()
+		manifest.Segments[0].FileName = fileName
+		require.Error(manifest.Validate(params), fileName)
+	}
+}
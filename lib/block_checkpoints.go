@@ -0,0 +1,197 @@
+package lib
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// BlockCheckpoint pins the hash of the block at a given height. Checkpoints come from two places: the
+// BlockCheckpoints hardcoded in DeSoParams, and an optional file supplied by the node operator with
+// --block-checkpoints-file. Once a checkpoint is known, the Blockchain rejects every header that conflicts
+// with it:
+//   - A header at a checkpoint height must have the checkpoint's hash.
+//   - Once the best header chain contains a checkpoint, no header at or below that checkpoint's height
+//     can be added unless it is already part of the best header chain. Such a header would start a fork
+//     below the checkpoint.
+//
+// This means a fresh node cannot be fed a long-range fake chain that forks off before the latest
+// checkpoint, no matter how much work or how many views the fake chain claims. Checkpoints also speed up
+// initial sync, since the signatures of blocks that are ancestors of a checkpoint don't need to be verified.
+//
+// Note that checkpoints are trusted. A node operator who supplies a checkpoints file is vouching for every
+// block hash in it.
+type BlockCheckpoint struct {
+	Height  uint64 `json:"Height"`
+	HashHex string `json:"HashHex"`
+}
+
+// LoadBlockCheckpointsFromFile reads operator-supplied checkpoints from a JSON file containing an array of
+// BlockCheckpoint objects, e.g. [{"Height": 12345, "HashHex": "00000a..."}].
+func LoadBlockCheckpointsFromFile(path string) ([]BlockCheckpoint, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadBlockCheckpointsFromFile: Problem reading file %v", path)
+	}
+	var checkpoints []BlockCheckpoint
+	if err = json.Unmarshal(fileBytes, &checkpoints); err != nil {
+		return nil, errors.Wrapf(err, "LoadBlockCheckpointsFromFile: Problem parsing file %v", path)
+	}
+	// Parse the hashes now so that a malformed file is reported at startup with its path.
+	if _, err = parseBlockCheckpoints(checkpoints); err != nil {
+		return nil, errors.Wrapf(err, "LoadBlockCheckpointsFromFile: Invalid checkpoint in file %v", path)
+	}
+	return checkpoints, nil
+}
+
+func parseBlockCheckpoints(checkpoints []BlockCheckpoint) (map[uint64]*BlockHash, error) {
+	checkpointHashesByHeight := make(map[uint64]*BlockHash)
+	for _, checkpoint := range checkpoints {
+		checkpointHashBytes, err := hex.DecodeString(checkpoint.HashHex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parseBlockCheckpoints: Problem parsing hash for height %d", checkpoint.Height)
+		}
+		if len(checkpointHashBytes) != HashSizeBytes {
+			return nil, errors.Errorf("parseBlockCheckpoints: Hash for height %d has length %d but should be %d",
+				checkpoint.Height, len(checkpointHashBytes), HashSizeBytes)
+		}
+		checkpointHash := NewBlockHash(checkpointHashBytes)
+		if existingHash, exists := checkpointHashesByHeight[checkpoint.Height]; exists && !existingHash.IsEqual(checkpointHash) {
+			return nil, errors.Errorf("parseBlockCheckpoints: Conflicting hashes %v and %v for height %d",
+				existingHash, checkpointHash, checkpoint.Height)
+		}
+		checkpointHashesByHeight[checkpoint.Height] = checkpointHash
+	}
+	return checkpointHashesByHeight, nil
+}
+
+// AddBlockCheckpoints adds checkpoints on top of the ones already known to the Blockchain. It returns an error,
+// and adds none of the checkpoints, if any of them conflicts with a known checkpoint or with the best header
+// chain the node has already stored.
+func (bc *Blockchain) AddBlockCheckpoints(checkpoints []BlockCheckpoint) error {
+	bc.ChainLock.Lock()
+	defer bc.ChainLock.Unlock()
+
+	return bc.addBlockCheckpointsNoLock(checkpoints)
+}
+
+func (bc *Blockchain) addBlockCheckpointsNoLock(checkpoints []BlockCheckpoint) error {
+	if len(checkpoints) == 0 {
+		return nil
+	}
+	newCheckpointHashesByHeight, err := parseBlockCheckpoints(checkpoints)
+	if err != nil {
+		return errors.Wrapf(err, "AddBlockCheckpoints: ")
+	}
+	for height, checkpointHash := range newCheckpointHashesByHeight {
+		if existingHash, exists := bc.blockCheckpoints[height]; exists && !existingHash.IsEqual(checkpointHash) {
+			return errors.Errorf("AddBlockCheckpoints: Checkpoint %v at height %d conflicts with known checkpoint %v",
+				checkpointHash, height, existingHash)
+		}
+		if height >= uint64(len(bc.bestHeaderChain)) {
+			continue
+		}
+		storedNode := bc.bestHeaderChain[height]
+		if uint64(storedNode.Height) == height && !storedNode.Hash.IsEqual(checkpointHash) {
+			return errors.Errorf("AddBlockCheckpoints: Checkpoint %v at height %d conflicts with stored header %v. "+
+				"The node's data directory was synced from a chain that does not match the checkpoint",
+				checkpointHash, height, storedNode.Hash)
+		}
+	}
+
+	if bc.blockCheckpoints == nil {
+		bc.blockCheckpoints = make(map[uint64]*BlockHash)
+	}
+	for height, checkpointHash := range newCheckpointHashesByHeight {
+		if _, exists := bc.blockCheckpoints[height]; !exists {
+			bc.blockCheckpointHeights = append(bc.blockCheckpointHeights, height)
+		}
+		bc.blockCheckpoints[height] = checkpointHash
+	}
+	sort.Slice(bc.blockCheckpointHeights, func(ii, jj int) bool {
+		return bc.blockCheckpointHeights[ii] < bc.blockCheckpointHeights[jj]
+	})
+	glog.V(1).Infof("AddBlockCheckpoints: Node now has %d block checkpoints", len(bc.blockCheckpoints))
+	return nil
+}
+
+// GetBlockCheckpoints returns all checkpoints known to the Blockchain, ordered by height.
+func (bc *Blockchain) GetBlockCheckpoints() []BlockCheckpoint {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	checkpoints := make([]BlockCheckpoint, 0, len(bc.blockCheckpointHeights))
+	for _, height := range bc.blockCheckpointHeights {
+		checkpoints = append(checkpoints, BlockCheckpoint{Height: height, HashHex: bc.blockCheckpoints[height].String()})
+	}
+	return checkpoints
+}
+
+// getHighestReachedBlockCheckpointHeight returns the height of the highest checkpoint that is part of the best
+// header chain. The second return value is false if the best header chain hasn't reached any checkpoint yet.
+// The caller must hold the ChainLock.
+func (bc *Blockchain) getHighestReachedBlockCheckpointHeight() (uint64, bool) {
+	for ii := len(bc.blockCheckpointHeights) - 1; ii >= 0; ii-- {
+		height := bc.blockCheckpointHeights[ii]
+		if _, inBestHeaderChain := bc.bestHeaderChainMap[*bc.blockCheckpoints[height]]; inBestHeaderChain {
+			return height, true
+		}
+	}
+	return 0, false
+}
+
+// checkHeaderAgainstBlockCheckpoints returns an error if the header with the provided hash and height conflicts
+// with a checkpoint. See the comment on BlockCheckpoint for the rules enforced. The caller must hold the ChainLock.
+func (bc *Blockchain) checkHeaderAgainstBlockCheckpoints(headerHash *BlockHash, height uint64) error {
+	if len(bc.blockCheckpoints) == 0 {
+		return nil
+	}
+	if checkpointHash, exists := bc.blockCheckpoints[height]; exists && !checkpointHash.IsEqual(headerHash) {
+		return errors.Wrapf(HeaderErrorConflictsWithCheckpoint,
+			"checkHeaderAgainstBlockCheckpoints: Header %v at height %d, checkpoint %v", headerHash, height, checkpointHash)
+	}
+	if _, inBestHeaderChain := bc.bestHeaderChainMap[*headerHash]; inBestHeaderChain {
+		return nil
+	}
+	if checkpointHeight, reached := bc.getHighestReachedBlockCheckpointHeight(); reached && height <= checkpointHeight {
+		return errors.Wrapf(HeaderErrorForkBeforeCheckpoint,
+			"checkHeaderAgainstBlockCheckpoints: Header %v at height %d, checkpoint height %d",
+			headerHash, height, checkpointHeight)
+	}
+	return nil
+}
+
+// IsAncestorOfBlockCheckpoint returns true if the block with the provided header is vouched for by a
+// checkpoint. See isAncestorOfBlockCheckpoint.
+func (bc *Blockchain) IsAncestorOfBlockCheckpoint(header *MsgDeSoHeader) bool {
+	if header == nil {
+		return false
+	}
+	headerHash, err := header.Hash()
+	if err != nil {
+		return false
+	}
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	return bc.isAncestorOfBlockCheckpoint(headerHash, header.Height)
+}
+
+// isAncestorOfBlockCheckpoint returns true if the block with the provided hash and height is part of the
+// best header chain at or below a checkpoint that the best header chain has reached. The signatures in
+// such a block don't need to be verified since the checkpoint vouches for it. The caller must hold the
+// ChainLock, or at least a read lock on it.
+func (bc *Blockchain) isAncestorOfBlockCheckpoint(blockHash *BlockHash, height uint64) bool {
+	if blockHash == nil {
+		return false
+	}
+	if _, inBestHeaderChain := bc.bestHeaderChainMap[*blockHash]; !inBestHeaderChain {
+		return false
+	}
+	checkpointHeight, reached := bc.getHighestReachedBlockCheckpointHeight()
+	return reached && height <= checkpointHeight
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCheckpoints(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	for ii := 0; ii < 3; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	block1 := chain.bestHeaderChain[1]
+	block2 := chain.bestHeaderChain[2]
+	block3 := chain.bestHeaderChain[3]
+	randomHash := NewBlockHash(RandomBytes(HashSizeBytes))
+
+	// Checkpoints that conflict with the stored header chain are refused.
+	require.Error(chain.AddBlockCheckpoints([]BlockCheckpoint{{Height: 2, HashHex: randomHash.String()}}))
+	require.Empty(chain.GetBlockCheckpoints())
+
+	// Malformed hashes are refused.
+	require.Error(chain.AddBlockCheckpoints([]BlockCheckpoint{{Height: 2, HashHex: "abcd"}}))
+
+	require.NoError(chain.AddBlockCheckpoints([]BlockCheckpoint{{Height: 2, HashHex: block2.Hash.String()}}))
+	require.Equal([]BlockCheckpoint{{Height: 2, HashHex: block2.Hash.String()}}, chain.GetBlockCheckpoints())
+
+	// A second checkpoint at the same height with a different hash is refused.
+	require.Error(chain.AddBlockCheckpoints([]BlockCheckpoint{{Height: 2, HashHex: block1.Hash.String()}}))
+
+	// Headers at the checkpoint height must match it, and no fork can start at or below it.
+	err := chain.checkHeaderAgainstBlockCheckpoints(randomHash, 2)
+	require.Error(err)
+	require.Contains(err.Error(), HeaderErrorConflictsWithCheckpoint)
+	err = chain.checkHeaderAgainstBlockCheckpoints(randomHash, 1)
+	require.Error(err)
+	require.Contains(err.Error(), HeaderErrorForkBeforeCheckpoint)
+	require.NoError(chain.checkHeaderAgainstBlockCheckpoints(block1.Hash, 1))
+	require.NoError(chain.checkHeaderAgainstBlockCheckpoints(randomHash, 3))
+
+	// ProcessHeader applies the same rules, before even looking at the proof of work.
+	forkHeader := *block1.Header
+	forkHeader.Nonce++
+	forkHeaderHash, err := forkHeader.Hash()
+	require.NoError(err)
+	_, _, err = chain.ProcessHeader(&forkHeader, forkHeaderHash, false)
+	require.Error(err)
+	require.Contains(err.Error(), HeaderErrorForkBeforeCheckpoint)
+
+	// Only blocks at or below the checkpoint are vouched for by it.
+	require.True(chain.IsAncestorOfBlockCheckpoint(block1.Header))
+	require.True(chain.IsAncestorOfBlockCheckpoint(block2.Header))
+	require.False(chain.IsAncestorOfBlockCheckpoint(block3.Header))
+	require.False(chain.IsAncestorOfBlockCheckpoint(&forkHeader))
+}
+
+func TestLoadBlockCheckpointsFromFile(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	hash := NewBlockHash(RandomBytes(HashSizeBytes))
+
+	validPath := filepath.Join(dir, "checkpoints.json")
+	require.NoError(os.WriteFile(validPath, []byte(`[{"Height": 10, "HashHex": "`+hash.String()+`"}]`), 0644))
+	checkpoints, err := LoadBlockCheckpointsFromFile(validPath)
+	require.NoError(err)
+	require.Equal([]BlockCheckpoint{{Height: 10, HashHex: hash.String()}}, checkpoints)
+
+	conflictingPath := filepath.Join(dir, "conflicting.json")
+	require.NoError(os.WriteFile(conflictingPath, []byte(`[{"Height": 10, "HashHex": "`+hash.String()+`"}, `+
+		`{"Height": 10, "HashHex": "`+NewBlockHash(RandomBytes(HashSizeBytes)).String()+`"}]`), 0644))
+	_, err = LoadBlockCheckpointsFromFile(conflictingPath)
+	require.Error(err)
+
+	_, err = LoadBlockCheckpointsFromFile(filepath.Join(dir, "missing.json"))
+	require.Error(err)
+}
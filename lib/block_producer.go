@@ -46,6 +46,12 @@ type DeSoBlockProducer struct {
 	params   *DeSoParams
 	postgres *Postgres
 
+	// txnRelayFilter holds the TxnTypes that we don't include in the block templates we produce. It may be nil.
+	txnRelayFilter *TxnRelayFilter
+	// deterministicTxnShuffle orders the txns of the block templates we produce by the deterministic shuffle even
+	// if the network doesn't enforce it. See deterministic_txn_shuffle.go.
+	deterministicTxnShuffle bool
+
 	// producerWaitGroup allows us to wait until the producer has properly closed.
 	producerWaitGroup sync.WaitGroup
 	// exit is used to signal that DeSoBlockProducer routines should be terminated.
@@ -77,6 +83,8 @@ func NewDeSoBlockProducer(
 	chain *Blockchain,
 	params *DeSoParams,
 	postgres *Postgres,
+	txnRelayFilter *TxnRelayFilter,
+	deterministicTxnShuffle bool,
 ) (*DeSoBlockProducer, error) {
 	var privKey *btcec.PrivateKey
 	if blockProducerSeed != "" {
@@ -113,6 +121,9 @@ func NewDeSoBlockProducer(
 		chain:    chain,
 		params:   params,
 		postgres: postgres,
+
+		txnRelayFilter:          txnRelayFilter,
+		deterministicTxnShuffle: deterministicTxnShuffle,
 	}, nil
 }
 
@@ -169,6 +180,14 @@ func (desoBlockProducer *DeSoBlockProducer) _getBlockTemplate(publicKey []byte)
 	blockRewardTxn.TxnMeta = &BlockRewardMetadataa{
 		ExtraData: UintToBuf(0),
 	}
+	// Signal for the soft fork deployments that are currently accepting signals.
+	softForkSignalBits, err := NewUtxoView(desoBlockProducer.chain.db, desoBlockProducer.params,
+		desoBlockProducer.postgres, desoBlockProducer.chain.snapshot, nil,
+	).GetSoftForkSignalBitsForBlockHeight(uint64(lastNode.Height + 1))
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "DeSoBlockProducer._getBlockTemplate: Problem computing soft fork signal bits: ")
+	}
+	SetSoftForkSignalBits(blockRewardTxn, softForkSignalBits)
 
 	// Create the block and add the BlockReward txn to it.
 	blockRet := NewMessage(MsgTypeBlock).(*MsgDeSoBlock)
@@ -192,6 +211,13 @@ func (desoBlockProducer *DeSoBlockProducer) _getBlockTemplate(publicKey []byte)
 		if err != nil {
 			return nil, nil, nil, errors.Wrapf(err, "DeSoBlockProducer._getBlockTemplate: Problem getting mempool transactions: ")
 		}
+		// Sort the txns in shuffle order before connecting them so that the subset we end up including is also
+		// in shuffle order.
+		mempoolTxns := txnsOrderedByTimeAdded
+		if shouldUseDeterministicTxnShuffle(desoBlockProducer.params, blockRet.Header.Height,
+			desoBlockProducer.deterministicTxnShuffle) {
+			mempoolTxns = SortMempoolTxnsDeterministicShuffle(txnsOrderedByTimeAdded, lastNode.Hash)
+		}
 
 		// Now keep
 		// adding transactions to the block until the block is full.
@@ -217,12 +243,17 @@ func (desoBlockProducer *DeSoBlockProducer) _getBlockTemplate(publicKey []byte)
 			desoBlockProducer.postgres, desoBlockProducer.chain.snapshot, nil)
 
 		txnsAddedToBlock := make(map[BlockHash]bool)
-		for ii, mempoolTx := range txnsOrderedByTimeAdded {
+		for ii, mempoolTx := range mempoolTxns {
 			// If we hit a transaction that's too big to fit into a block then we're done.
 			if mempoolTx.TxSizeBytes+currentBlockSize > desoBlockProducer.params.MinerMaxBlockSizeBytes {
 				break
 			}
 
+			// Skip transactions whose TxnType the operator has paused.
+			if desoBlockProducer.txnRelayFilter.IsTxnPaused(mempoolTx.Tx) {
+				continue
+			}
+
 			// Try to apply the transaction to the view with the strictest possible checks.
 			// Make a copy of the view in order to test applying the txn without compromising the
 			// integrity of the view.
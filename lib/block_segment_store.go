@@ -0,0 +1,379 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// BlockSegmentStoreDirName is the name of the folder, relative to the node's data directory, in which
+// block bodies are stored when the block segment store is enabled.
+const BlockSegmentStoreDirName = "blocks"
+
+// DefaultBlockSegmentMaxSizeBytes is the size at which a segment file is sealed and a new one is started.
+const DefaultBlockSegmentMaxSizeBytes = uint64(256 << 20) // 256MB
+
+// BlockSegmentStore keeps full block bodies out of Badger. Blocks never change once they're stored, so
+// keeping them in the LSM tree only adds compaction work. Instead, the store appends each block to the
+// current segment file, and Badger only holds a small BlockSegmentLocation for each block under
+// PrefixBlockHashToBlockSegmentLocation. Segment files are read through read-only memory maps, so a
+// GetBlock is a map lookup, a Badger point read, and a copy.
+//
+// A block is appended to its segment before its location is committed to Badger. If the node crashes in
+// between, the segment ends with bytes that nothing points to, which is harmless.
+//
+// Blocks stored in Badger before the store was enabled are still read from Badger. The store is opened by
+// the node and associated with the chain DB using RegisterBlockSegmentStore.
+type BlockSegmentStore struct {
+	lock sync.RWMutex
+	dir  string
+
+	maxSegmentSizeBytes uint64
+	segments            []*blockSegment
+}
+
+type blockSegment struct {
+	index uint32
+	file  *os.File
+	size  uint64
+	// mmapData maps the first len(mmapData) bytes of the file. It is remapped when a read goes past it.
+	mmapData []byte
+}
+
+// BlockSegmentLocation is where a block's bytes are stored in a BlockSegmentStore.
+type BlockSegmentLocation struct {
+	SegmentIndex uint32
+	Offset       uint64
+	NumBytes     uint64
+	// Checksum is the CRC32 of the block's bytes. It is verified on every read.
+	Checksum uint32
+	Height   uint64
+}
+
+func (location *BlockSegmentLocation) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(uint64(location.SegmentIndex))...)
+	data = append(data, UintToBuf(location.Offset)...)
+	data = append(data, UintToBuf(location.NumBytes)...)
+	data = append(data, UintToBuf(uint64(location.Checksum))...)
+	data = append(data, UintToBuf(location.Height)...)
+	return data
+}
+
+func (location *BlockSegmentLocation) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	segmentIndex, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockSegmentLocation.FromBytes: Problem reading SegmentIndex")
+	}
+	location.SegmentIndex = uint32(segmentIndex)
+	if location.Offset, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BlockSegmentLocation.FromBytes: Problem reading Offset")
+	}
+	if location.NumBytes, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BlockSegmentLocation.FromBytes: Problem reading NumBytes")
+	}
+	checksum, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockSegmentLocation.FromBytes: Problem reading Checksum")
+	}
+	location.Checksum = uint32(checksum)
+	if location.Height, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BlockSegmentLocation.FromBytes: Problem reading Height")
+	}
+	return nil
+}
+
+func GetBlockSegmentStorePath(dataDir string) string {
+	return filepath.Join(dataDir, BlockSegmentStoreDirName)
+}
+
+func blockSegmentFileName(segmentIndex uint32) string {
+	return fmt.Sprintf("segment-%08d.blk", segmentIndex)
+}
+
+// OpenBlockSegmentStore opens the segments in dir, creating the directory if it doesn't exist.
+func OpenBlockSegmentStore(dir string, maxSegmentSizeBytes uint64) (*BlockSegmentStore, error) {
+	if maxSegmentSizeBytes == 0 {
+		return nil, errors.New("OpenBlockSegmentStore: maxSegmentSizeBytes must be positive")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "OpenBlockSegmentStore: Problem creating directory %v", dir)
+	}
+	fileNames, err := filepath.Glob(filepath.Join(dir, "segment-*.blk"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "OpenBlockSegmentStore: Problem listing segments in %v", dir)
+	}
+	sort.Strings(fileNames)
+
+	store := &BlockSegmentStore{dir: dir, maxSegmentSizeBytes: maxSegmentSizeBytes}
+	for ii, fileName := range fileNames {
+		if filepath.Base(fileName) != blockSegmentFileName(uint32(ii)) {
+			store.Close()
+			return nil, fmt.Errorf("OpenBlockSegmentStore: Expected segment %v but found %v",
+				blockSegmentFileName(uint32(ii)), filepath.Base(fileName))
+		}
+		segment, err := openBlockSegment(dir, uint32(ii))
+		if err != nil {
+			store.Close()
+			return nil, errors.Wrapf(err, "OpenBlockSegmentStore: ")
+		}
+		store.segments = append(store.segments, segment)
+	}
+	if len(store.segments) == 0 {
+		segment, err := openBlockSegment(dir, 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "OpenBlockSegmentStore: ")
+		}
+		store.segments = append(store.segments, segment)
+	}
+	glog.Infof("OpenBlockSegmentStore: Opened %d block segments in %v", len(store.segments), dir)
+	return store, nil
+}
+
+func openBlockSegment(dir string, segmentIndex uint32) (*blockSegment, error) {
+	path := filepath.Join(dir, blockSegmentFileName(segmentIndex))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "openBlockSegment: Problem opening %v", path)
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "openBlockSegment: Problem reading size of %v", path)
+	}
+	return &blockSegment{index: segmentIndex, file: file, size: uint64(fileInfo.Size())}, nil
+}
+
+// Append writes the block's bytes to the end of the current segment and syncs the segment to disk.
+func (store *BlockSegmentStore) Append(blockBytes []byte, height uint64) (*BlockSegmentLocation, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	segment := store.segments[len(store.segments)-1]
+	if segment.size > 0 && segment.size+uint64(len(blockBytes)) > store.maxSegmentSizeBytes {
+		newSegment, err := openBlockSegment(store.dir, segment.index+1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "BlockSegmentStore.Append: ")
+		}
+		store.segments = append(store.segments, newSegment)
+		segment = newSegment
+	}
+
+	if _, err := segment.file.Write(blockBytes); err != nil {
+		return nil, errors.Wrapf(err, "BlockSegmentStore.Append: Problem writing to segment %d", segment.index)
+	}
+	if err := segment.file.Sync(); err != nil {
+		return nil, errors.Wrapf(err, "BlockSegmentStore.Append: Problem syncing segment %d", segment.index)
+	}
+	location := &BlockSegmentLocation{
+		SegmentIndex: segment.index,
+		Offset:       segment.size,
+		NumBytes:     uint64(len(blockBytes)),
+		Checksum:     crc32.ChecksumIEEE(blockBytes),
+		Height:       height,
+	}
+	segment.size += uint64(len(blockBytes))
+	return location, nil
+}
+
+// Read returns a copy of the bytes at the location.
+func (store *BlockSegmentStore) Read(location *BlockSegmentLocation) ([]byte, error) {
+	end := location.Offset + location.NumBytes
+
+	// Most reads hit a region that is already mapped, so try that under the read lock first.
+	store.lock.RLock()
+	data, needsRemap, err := store._readNoLock(location, end)
+	store.lock.RUnlock()
+	if err != nil || !needsRemap {
+		return data, err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	segment := store.segments[location.SegmentIndex]
+	if uint64(len(segment.mmapData)) < end {
+		if err = segment.remap(); err != nil {
+			return nil, errors.Wrapf(err, "BlockSegmentStore.Read: ")
+		}
+	}
+	data, _, err = store._readNoLock(location, end)
+	return data, err
+}
+
+func (store *BlockSegmentStore) _readNoLock(location *BlockSegmentLocation, end uint64) (
+	_data []byte, _needsRemap bool, _err error) {
+
+	if int(location.SegmentIndex) >= len(store.segments) {
+		return nil, false, fmt.Errorf("BlockSegmentStore.Read: Segment %d doesn't exist", location.SegmentIndex)
+	}
+	segment := store.segments[location.SegmentIndex]
+	if end > segment.size {
+		return nil, false, fmt.Errorf("BlockSegmentStore.Read: Location ends at %d but segment %d is only %d bytes",
+			end, segment.index, segment.size)
+	}
+	if uint64(len(segment.mmapData)) < end {
+		return nil, true, nil
+	}
+	data := append([]byte{}, segment.mmapData[location.Offset:end]...)
+	if crc32.ChecksumIEEE(data) != location.Checksum {
+		return nil, false, fmt.Errorf("BlockSegmentStore.Read: Checksum mismatch for %d bytes at offset %d "+
+			"of segment %d", location.NumBytes, location.Offset, segment.index)
+	}
+	return data, false, nil
+}
+
+// remap maps the whole segment file, replacing the previous mapping.
+func (segment *blockSegment) remap() error {
+	if err := segment.unmap(); err != nil {
+		return err
+	}
+	if segment.size == 0 {
+		return nil
+	}
+	mmapData, err := syscall.Mmap(int(segment.file.Fd()), 0, int(segment.size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return errors.Wrapf(err, "blockSegment.remap: Problem mapping segment %d", segment.index)
+	}
+	segment.mmapData = mmapData
+	return nil
+}
+
+func (segment *blockSegment) unmap() error {
+	if segment.mmapData == nil {
+		return nil
+	}
+	if err := syscall.Munmap(segment.mmapData); err != nil {
+		return errors.Wrapf(err, "blockSegment.unmap: Problem unmapping segment %d", segment.index)
+	}
+	segment.mmapData = nil
+	return nil
+}
+
+// Close unmaps and closes every segment.
+func (store *BlockSegmentStore) Close() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var firstErr error
+	for _, segment := range store.segments {
+		if err := segment.unmap(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := segment.file.Close(); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "BlockSegmentStore.Close: Problem closing segment %d", segment.index)
+		}
+	}
+	store.segments = nil
+	return firstErr
+}
+
+//
+// Registry
+//
+
+// blockSegmentStores maps each chain DB to the block segment store that holds its block bodies. GetBlock
+// is called with just a DB handle from many places, so the association is kept here rather than threaded
+// through every caller.
+var (
+	blockSegmentStoresLock sync.RWMutex
+	blockSegmentStores     = make(map[*badger.DB]*BlockSegmentStore)
+)
+
+// RegisterBlockSegmentStore makes new blocks written to handle through the Blockchain go to store, and makes
+// GetBlock read them back from it.
+func RegisterBlockSegmentStore(handle *badger.DB, store *BlockSegmentStore) {
+	blockSegmentStoresLock.Lock()
+	defer blockSegmentStoresLock.Unlock()
+	blockSegmentStores[handle] = store
+}
+
+func UnregisterBlockSegmentStore(handle *badger.DB) {
+	blockSegmentStoresLock.Lock()
+	defer blockSegmentStoresLock.Unlock()
+	delete(blockSegmentStores, handle)
+}
+
+// GetBlockSegmentStore returns the store registered for handle, or nil if blocks are stored in Badger.
+func GetBlockSegmentStore(handle *badger.DB) *BlockSegmentStore {
+	blockSegmentStoresLock.RLock()
+	defer blockSegmentStoresLock.RUnlock()
+	return blockSegmentStores[handle]
+}
+
+//
+// DB UTILS
+//
+
+func BlockHashToBlockSegmentLocationKey(blockHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixBlockHashToBlockSegmentLocation...), blockHash[:]...)
+}
+
+// DBGetBlockSegmentLocationWithTxn returns the location of the block in the segment store, or nil if the block
+// isn't in the segment store.
+func DBGetBlockSegmentLocationWithTxn(txn *badger.Txn, blockHash *BlockHash) (*BlockSegmentLocation, error) {
+	item, err := txn.Get(BlockHashToBlockSegmentLocationKey(blockHash))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetBlockSegmentLocationWithTxn: Problem getting location")
+	}
+	locationBytes, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetBlockSegmentLocationWithTxn: Problem copying location")
+	}
+	location := &BlockSegmentLocation{}
+	if err = location.FromBytes(locationBytes); err != nil {
+		return nil, errors.Wrapf(err, "DBGetBlockSegmentLocationWithTxn: ")
+	}
+	return location, nil
+}
+
+// putBlockHashToBlockSegmentWithTxn appends the block to the segment store and records its location. The
+// state syncer still gets an upsert for the block under PrefixBlockHashToBlock, as if the block had been
+// written to Badger.
+func putBlockHashToBlockSegmentWithTxn(
+	txn *badger.Txn,
+	blockStore *BlockSegmentStore,
+	blockHash *BlockHash,
+	blockHeight uint64,
+	blockBytes []byte,
+	eventManager *EventManager,
+) error {
+	// First check to see if the block is already stored.
+	location, err := DBGetBlockSegmentLocationWithTxn(txn, blockHash)
+	if err != nil {
+		return errors.Wrapf(err, "putBlockHashToBlockSegmentWithTxn: ")
+	}
+	if location != nil {
+		return nil
+	}
+	location, err = blockStore.Append(blockBytes, blockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "putBlockHashToBlockSegmentWithTxn: ")
+	}
+	if err = txn.Set(BlockHashToBlockSegmentLocationKey(blockHash), location.ToBytes()); err != nil {
+		return errors.Wrapf(err, "putBlockHashToBlockSegmentWithTxn: Problem setting location")
+	}
+	if eventManager != nil {
+		eventManager.stateSyncerOperation(&StateSyncerOperationEvent{
+			StateChangeEntry: &StateChangeEntry{
+				OperationType: DbOperationTypeUpsert,
+				KeyBytes:      BlockHashToBlockKey(blockHash),
+				EncoderBytes:  blockBytes,
+			},
+			IsMempoolTxn: eventManager.isMempoolManager,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockSegmentStore(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+
+	// Segments are sealed once they'd go over 10 bytes, so the third record starts a new segment.
+	store, err := OpenBlockSegmentStore(dir, 10)
+	require.NoError(err)
+	records := [][]byte{[]byte("abcd"), []byte("efgh"), []byte("ijklmnop"), []byte("this is longer than a segment")}
+	var locations []*BlockSegmentLocation
+	for ii, record := range records {
+		location, err := store.Append(record, uint64(ii))
+		require.NoError(err)
+		locations = append(locations, location)
+	}
+	require.Equal([]uint32{0, 0, 1, 2}, []uint32{
+		locations[0].SegmentIndex, locations[1].SegmentIndex, locations[2].SegmentIndex, locations[3].SegmentIndex})
+	require.Equal(uint64(4), locations[1].Offset)
+
+	for ii, location := range locations {
+		data, err := store.Read(location)
+		require.NoError(err)
+		require.Equal(records[ii], data)
+	}
+
+	// Appending to a mapped segment remaps it on the next read past the end of the mapping.
+	location, err := store.Append([]byte("q"), 4)
+	require.NoError(err)
+	data, err := store.Read(location)
+	require.NoError(err)
+	require.Equal([]byte("q"), data)
+	require.NoError(store.Close())
+
+	// Everything is still there after reopening, and locations survive a round trip through their encoding.
+	store, err = OpenBlockSegmentStore(dir, 10)
+	require.NoError(err)
+	defer store.Close()
+	decodedLocation := &BlockSegmentLocation{}
+	require.NoError(decodedLocation.FromBytes(locations[2].ToBytes()))
+	require.Equal(locations[2], decodedLocation)
+	data, err = store.Read(decodedLocation)
+	require.NoError(err)
+	require.Equal(records[2], data)
+
+	// Corrupt or out of range locations are rejected.
+	_, err = store.Read(&BlockSegmentLocation{SegmentIndex: 0, Offset: 0, NumBytes: 4, Checksum: 1})
+	require.Error(err)
+	_, err = store.Read(&BlockSegmentLocation{SegmentIndex: 0, Offset: 8, NumBytes: 4})
+	require.Error(err)
+	_, err = store.Read(&BlockSegmentLocation{SegmentIndex: 9, Offset: 0, NumBytes: 1})
+	require.Error(err)
+}
+
+func TestBlockSegmentStoreOpenRejectsMissingSegment(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, blockSegmentFileName(1)), []byte("x"), 0600))
+	_, err := OpenBlockSegmentStore(dir, 10)
+	require.Error(err)
+}
+
+func TestGetBlockFromBlockSegmentStore(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	// The genesis block is stored in badger before the segment store is registered.
+	require.NoError(InitDbWithDeSoGenesisBlock(&DeSoTestnetParams, db, nil, nil, nil))
+	genesisHash := MustDecodeHexBlockHash(DeSoTestnetParams.GenesisBlockHashHex)
+
+	store, err := OpenBlockSegmentStore(t.TempDir(), DefaultBlockSegmentMaxSizeBytes)
+	require.NoError(err)
+	defer store.Close()
+	RegisterBlockSegmentStore(db, store)
+	defer UnregisterBlockSegmentStore(db)
+
+	block := &MsgDeSoBlock{
+		Header: expectedBlockHeaderVersion1,
+		Txns: []*MsgDeSoTxn{{
+			TxOutputs: []*DeSoOutput{{PublicKey: m0PkBytes, AmountNanos: 1}},
+			TxnMeta:   &BlockRewardMetadataa{ExtraData: []byte{1}},
+		}},
+	}
+	blockHash, err := block.Header.Hash()
+	require.NoError(err)
+	// Storing the block twice only appends it once.
+	for ii := 0; ii < 2; ii++ {
+		require.NoError(db.Update(func(txn *badger.Txn) error {
+			return PutBlockWithTxn(txn, nil, block, store, nil)
+		}))
+	}
+	require.Equal(1, len(store.segments))
+	expectedBytes, err := block.ToBytes(false)
+	require.NoError(err)
+	require.Equal(uint64(len(expectedBytes)), store.segments[0].size)
+
+	// The block body isn't in badger, only its location.
+	require.Nil(_getBlockFromBadger(db, blockHash))
+	storedBlock, err := GetBlock(blockHash, db, nil)
+	require.NoError(err)
+	storedBytes, err := storedBlock.ToBytes(false)
+	require.NoError(err)
+	require.Equal(expectedBytes, storedBytes)
+
+	// Blocks from before the store was registered are still read from badger.
+	genesisBlock, err := GetBlock(genesisHash, db, nil)
+	require.NoError(err)
+	require.Equal(uint64(0), genesisBlock.Header.Height)
+}
+
+func _getBlockFromBadger(db *badger.DB, blockHash *BlockHash) *MsgDeSoBlock {
+	var block *MsgDeSoBlock
+	db.View(func(txn *badger.Txn) error {
+		block = GetBlockWithTxn(txn, nil, blockHash)
+		return nil
+	})
+	return block
+}
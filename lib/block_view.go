@@ -73,6 +73,7 @@ type UtxoView struct {
 
 	// Follow data
 	FollowKeyToFollowEntry map[FollowKey]*FollowEntry
+	PKIDToFollowCountEntry map[PKID]*FollowCountEntry
 
 	// NFT data
 	NFTKeyToNFTEntry              map[NFTKey]*NFTEntry
@@ -109,10 +110,16 @@ type UtxoView struct {
 
 	// DAO coin limit order entry mapping.
 	DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry
+	// Price-level index over the DAO coin limit order entries above, used for order matching.
+	daoCoinLimitOrderBooks map[daoCoinLimitOrderBookKey]*daoCoinLimitOrderBook
+
+	// Receipts of the transactions connected in blocks, keyed by txn hash.
+	TxnHashToTxnReceipt map[BlockHash]*TxnReceipt
 
 	// Association mappings
 	AssociationMapKeyToUserAssociationEntry map[AssociationMapKey]*UserAssociationEntry
 	AssociationMapKeyToPostAssociationEntry map[AssociationMapKey]*PostAssociationEntry
+	PostAssociationCountMapKeyToCountEntry  map[PostAssociationCountMapKey]*PostAssociationCountEntry
 
 	// Map of DeSoNonce and PKID to TransactorNonceEntry
 	TransactorNonceMapKeyToTransactorNonceEntry map[TransactorNonceMapKey]*TransactorNonceEntry
@@ -175,6 +182,57 @@ type UtxoView struct {
 	// to a snapshotted StakeEntry for the ValidatorPKID and StakerPKID pair at a given SnapshotAtEpochNumber.
 	SnapshotStakesToReward map[SnapshotStakeMapKey]*StakeEntry
 
+	// Staking reward statements recorded when an epoch completes.
+	StakingRewardStatementMapKeyToStakingRewardStatementEntry map[StakingRewardStatementMapKey]*StakingRewardStatementEntry
+
+	// Per-epoch consensus participation of the validators, updated as blocks are connected.
+	ValidatorPerformanceMapKeyToValidatorPerformanceEntry map[ValidatorPerformanceMapKey]*ValidatorPerformanceEntry
+
+	// The state of each soft fork deployment in each signaling window.
+	SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry map[SoftForkDeploymentStateMapKey]*SoftForkDeploymentStateEntry
+
+	// Key-value records written by SetKeyValueRecords transactions.
+	KeyValueRecordMapKeyToKeyValueRecordEntry map[KeyValueRecordMapKey]*KeyValueRecordEntry
+
+	// Vesting schedules of unvested LockedBalanceEntries.
+	LockupVestingScheduleKeyToLockupVestingScheduleEntry map[LockupVestingScheduleKey]*LockupVestingScheduleEntry
+
+	// Read watermarks of members for the conversations of access groups.
+	MessageReadStateKeyToMessageReadStateEntry map[MessageReadStateKey]*MessageReadStateEntry
+
+	// Profiles referencing NFTs as their avatars, keyed by NFT and profile.
+	NFTAvatarKeyToNFTAvatarEntry map[NFTAvatarKey]*NFTAvatarEntry
+
+	// External chain events anchored by BridgeEventAnchor transactions.
+	BridgeEventAnchorKeyToBridgeEventAnchorEntry map[BridgeEventAnchorKey]*BridgeEventAnchorEntry
+
+	// DAO coin balances of holders after the blocks that changed them, recorded as blocks are connected.
+	DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry map[DAOCoinBalanceChangeKey]*DAOCoinBalanceChangeEntry
+
+	// SwapIdentity transactions that swapped PKIDs, recorded as they're connected.
+	PKIDSwapKeyToPKIDSwapEntry map[PKIDSwapKey]*PKIDSwapEntry
+
+	// Delegates authorized by DelegatedPoster transactions to post on behalf of an account.
+	DelegatedPosterKeyToDelegatedPosterEntry map[DelegatedPosterKey]*DelegatedPosterEntry
+
+	// Hashes of off-chain content anchored by AnchorHash transactions, and the rate limit windows of the
+	// public keys that anchored them.
+	AnchorHashKeyToAnchorHashEntry          map[AnchorHashKey]*AnchorHashEntry
+	AnchorHashRateLimitPKIDToRateLimitEntry map[PKID]*AnchorHashRateLimitEntry
+
+	// Posts and profiles hidden by SubmitPost and UpdateProfile transactions, recorded as they're connected.
+	ContentTombstoneKeyToContentTombstoneEntry map[ContentTombstoneKey]*ContentTombstoneEntry
+
+	// Fee splits of PoS blocks, recorded as they're connected.
+	BlockHeightToBlockFeeSplitEntry map[uint64]*BlockFeeSplitEntry
+
+	// Recurring payments authorized by Subscription transactions.
+	SubscriptionKeyToSubscriptionEntry map[SubscriptionKey]*SubscriptionEntry
+
+	// Global params in effect after the blocks that updated them, recorded as UpdateGlobalParams transactions are
+	// connected.
+	BlockHeightToGlobalParamsHistoryEntry map[uint64]*GlobalParamsHistoryEntry
+
 	// The hash of the tip the view is currently referencing. Mainly used
 	// for error-checking when doing a bulk operation on the view.
 	TipHash *BlockHash
@@ -196,6 +254,13 @@ type UtxoView struct {
 	Snapshot *Snapshot
 	// EventManager is used to emit callbacks when certain actions are triggered.
 	EventManager *EventManager
+
+	// traceSpan is the parent of the spans started by this view, e.g. the span of the block being processed.
+	// It is nil when the view isn't doing traced work. It is never copied.
+	traceSpan TraceSpan
+	// viewTx is the ViewTx whose read transaction the view's getters read the DB in, or nil if they each read in
+	// their own transaction. It is never copied. See view_tx.go.
+	viewTx *ViewTx
 }
 
 // Assumes the db Handle is already set on the view, but otherwise the
@@ -243,6 +308,7 @@ func (bav *UtxoView) _ResetViewMappingsAfterFlush() {
 
 	// Follow data
 	bav.FollowKeyToFollowEntry = make(map[FollowKey]*FollowEntry)
+	bav.PKIDToFollowCountEntry = make(map[PKID]*FollowCountEntry)
 
 	// NFT data
 	bav.NFTKeyToNFTEntry = make(map[NFTKey]*NFTEntry)
@@ -269,10 +335,15 @@ func (bav *UtxoView) _ResetViewMappingsAfterFlush() {
 
 	// DAO Coin Limit Order Entries
 	bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry = make(map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry)
+	bav.daoCoinLimitOrderBooks = make(map[daoCoinLimitOrderBookKey]*daoCoinLimitOrderBook)
+
+	// Txn Receipts
+	bav.TxnHashToTxnReceipt = make(map[BlockHash]*TxnReceipt)
 
 	// Association entries
 	bav.AssociationMapKeyToUserAssociationEntry = make(map[AssociationMapKey]*UserAssociationEntry)
 	bav.AssociationMapKeyToPostAssociationEntry = make(map[AssociationMapKey]*PostAssociationEntry)
+	bav.PostAssociationCountMapKeyToCountEntry = make(map[PostAssociationCountMapKey]*PostAssociationCountEntry)
 
 	// Transaction nonce map
 	bav.TransactorNonceMapKeyToTransactorNonceEntry = make(map[TransactorNonceMapKey]*TransactorNonceEntry)
@@ -313,6 +384,57 @@ func (bav *UtxoView) _ResetViewMappingsAfterFlush() {
 
 	// SnapshotStakesToReward
 	bav.SnapshotStakesToReward = make(map[SnapshotStakeMapKey]*StakeEntry)
+
+	// StakingRewardStatementMapKeyToStakingRewardStatementEntry
+	bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry = make(map[StakingRewardStatementMapKey]*StakingRewardStatementEntry)
+
+	// ValidatorPerformanceMapKeyToValidatorPerformanceEntry
+	bav.ValidatorPerformanceMapKeyToValidatorPerformanceEntry = make(map[ValidatorPerformanceMapKey]*ValidatorPerformanceEntry)
+
+	// SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry
+	bav.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry = make(map[SoftForkDeploymentStateMapKey]*SoftForkDeploymentStateEntry)
+
+	// KeyValueRecordMapKeyToKeyValueRecordEntry
+	bav.KeyValueRecordMapKeyToKeyValueRecordEntry = make(map[KeyValueRecordMapKey]*KeyValueRecordEntry)
+
+	// LockupVestingScheduleKeyToLockupVestingScheduleEntry
+	bav.LockupVestingScheduleKeyToLockupVestingScheduleEntry = make(map[LockupVestingScheduleKey]*LockupVestingScheduleEntry)
+
+	// MessageReadStateKeyToMessageReadStateEntry
+	bav.MessageReadStateKeyToMessageReadStateEntry = make(map[MessageReadStateKey]*MessageReadStateEntry)
+
+	// NFTAvatarKeyToNFTAvatarEntry
+	bav.NFTAvatarKeyToNFTAvatarEntry = make(map[NFTAvatarKey]*NFTAvatarEntry)
+
+	// BridgeEventAnchorKeyToBridgeEventAnchorEntry
+	bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry = make(map[BridgeEventAnchorKey]*BridgeEventAnchorEntry)
+
+	// DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry
+	bav.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry = make(map[DAOCoinBalanceChangeKey]*DAOCoinBalanceChangeEntry)
+
+	// PKIDSwapKeyToPKIDSwapEntry
+	bav.PKIDSwapKeyToPKIDSwapEntry = make(map[PKIDSwapKey]*PKIDSwapEntry)
+
+	// DelegatedPosterKeyToDelegatedPosterEntry
+	bav.DelegatedPosterKeyToDelegatedPosterEntry = make(map[DelegatedPosterKey]*DelegatedPosterEntry)
+
+	// AnchorHashKeyToAnchorHashEntry
+	bav.AnchorHashKeyToAnchorHashEntry = make(map[AnchorHashKey]*AnchorHashEntry)
+
+	// AnchorHashRateLimitPKIDToRateLimitEntry
+	bav.AnchorHashRateLimitPKIDToRateLimitEntry = make(map[PKID]*AnchorHashRateLimitEntry)
+
+	// ContentTombstoneKeyToContentTombstoneEntry
+	bav.ContentTombstoneKeyToContentTombstoneEntry = make(map[ContentTombstoneKey]*ContentTombstoneEntry)
+
+	// BlockHeightToBlockFeeSplitEntry
+	bav.BlockHeightToBlockFeeSplitEntry = make(map[uint64]*BlockFeeSplitEntry)
+
+	// SubscriptionKeyToSubscriptionEntry
+	bav.SubscriptionKeyToSubscriptionEntry = make(map[SubscriptionKey]*SubscriptionEntry)
+
+	// BlockHeightToGlobalParamsHistoryEntry
+	bav.BlockHeightToGlobalParamsHistoryEntry = make(map[uint64]*GlobalParamsHistoryEntry)
 }
 
 func (bav *UtxoView) CopyUtxoView() *UtxoView {
@@ -474,6 +596,11 @@ func (bav *UtxoView) CopyUtxoView() *UtxoView {
 		newFollowEntry := *followEntry
 		newView.FollowKeyToFollowEntry[followKey] = &newFollowEntry
 	}
+	newView.PKIDToFollowCountEntry = make(map[PKID]*FollowCountEntry, len(bav.PKIDToFollowCountEntry))
+	for pkid, followCountEntry := range bav.PKIDToFollowCountEntry {
+		newFollowCountEntry := *followCountEntry
+		newView.PKIDToFollowCountEntry[pkid] = &newFollowCountEntry
+	}
 
 	// Copy the like data
 	newView.LikeKeyToLikeEntry = make(map[LikeKey]*LikeEntry, len(bav.LikeKeyToLikeEntry))
@@ -554,11 +681,21 @@ func (bav *UtxoView) CopyUtxoView() *UtxoView {
 	// Copy the DAO Coin Limit Order Entries
 	newView.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry = make(map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry,
 		len(bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry))
+	newView.daoCoinLimitOrderBooks = make(map[daoCoinLimitOrderBookKey]*daoCoinLimitOrderBook,
+		len(bav.daoCoinLimitOrderBooks))
 	for entryKey, entry := range bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry {
 		newEntry := *entry
+		newView._indexDAOCoinLimitOrderEntry(&newEntry)
 		newView.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[entryKey] = &newEntry
 	}
 
+	// Copy the Txn Receipts
+	newView.TxnHashToTxnReceipt = make(map[BlockHash]*TxnReceipt, len(bav.TxnHashToTxnReceipt))
+	for txnHash, receipt := range bav.TxnHashToTxnReceipt {
+		newReceipt := *receipt
+		newView.TxnHashToTxnReceipt[txnHash] = &newReceipt
+	}
+
 	// Copy the Association entries
 	newView.AssociationMapKeyToUserAssociationEntry = make(map[AssociationMapKey]*UserAssociationEntry, len(bav.AssociationMapKeyToUserAssociationEntry))
 	for entryKey, entry := range bav.AssociationMapKeyToUserAssociationEntry {
@@ -570,6 +707,12 @@ func (bav *UtxoView) CopyUtxoView() *UtxoView {
 		newEntry := *entry
 		newView.AssociationMapKeyToPostAssociationEntry[entryKey] = &newEntry
 	}
+	newView.PostAssociationCountMapKeyToCountEntry = make(
+		map[PostAssociationCountMapKey]*PostAssociationCountEntry, len(bav.PostAssociationCountMapKeyToCountEntry))
+	for countMapKey, countEntry := range bav.PostAssociationCountMapKeyToCountEntry {
+		newCountEntry := *countEntry
+		newView.PostAssociationCountMapKeyToCountEntry[countMapKey] = &newCountEntry
+	}
 
 	// Copy the nonce map
 	newView.TransactorNonceMapKeyToTransactorNonceEntry = make(map[TransactorNonceMapKey]*TransactorNonceEntry,
@@ -677,6 +820,141 @@ func (bav *UtxoView) CopyUtxoView() *UtxoView {
 		newView.SnapshotStakesToReward[mapKey] = snapshotStakeToReward.Copy()
 	}
 
+	// Copy the StakingRewardStatementEntries
+	newView.StakingRewardStatementMapKeyToStakingRewardStatementEntry = make(
+		map[StakingRewardStatementMapKey]*StakingRewardStatementEntry,
+		len(bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry),
+	)
+	for mapKey, statement := range bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry {
+		newView.StakingRewardStatementMapKeyToStakingRewardStatementEntry[mapKey] = statement.Copy()
+	}
+
+	// Copy the ValidatorPerformanceEntries
+	newView.ValidatorPerformanceMapKeyToValidatorPerformanceEntry = make(
+		map[ValidatorPerformanceMapKey]*ValidatorPerformanceEntry,
+		len(bav.ValidatorPerformanceMapKeyToValidatorPerformanceEntry),
+	)
+	for mapKey, performanceEntry := range bav.ValidatorPerformanceMapKeyToValidatorPerformanceEntry {
+		newView.ValidatorPerformanceMapKeyToValidatorPerformanceEntry[mapKey] = performanceEntry.Copy()
+	}
+
+	// Copy the SoftForkDeploymentStateEntries
+	newView.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry = make(
+		map[SoftForkDeploymentStateMapKey]*SoftForkDeploymentStateEntry,
+		len(bav.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry),
+	)
+	for mapKey, deploymentStateEntry := range bav.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry {
+		newView.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry[mapKey] = deploymentStateEntry.Copy()
+	}
+
+	// Copy the KeyValueRecordEntries
+	newView.KeyValueRecordMapKeyToKeyValueRecordEntry = make(
+		map[KeyValueRecordMapKey]*KeyValueRecordEntry, len(bav.KeyValueRecordMapKeyToKeyValueRecordEntry),
+	)
+	for mapKey, keyValueRecordEntry := range bav.KeyValueRecordMapKeyToKeyValueRecordEntry {
+		newView.KeyValueRecordMapKeyToKeyValueRecordEntry[mapKey] = keyValueRecordEntry.Copy()
+	}
+
+	// Copy the LockupVestingScheduleEntries
+	newView.LockupVestingScheduleKeyToLockupVestingScheduleEntry = make(
+		map[LockupVestingScheduleKey]*LockupVestingScheduleEntry, len(bav.LockupVestingScheduleKeyToLockupVestingScheduleEntry),
+	)
+	for mapKey, vestingScheduleEntry := range bav.LockupVestingScheduleKeyToLockupVestingScheduleEntry {
+		newView.LockupVestingScheduleKeyToLockupVestingScheduleEntry[mapKey] = vestingScheduleEntry.Copy()
+	}
+
+	// Copy the MessageReadStateEntries
+	newView.MessageReadStateKeyToMessageReadStateEntry = make(
+		map[MessageReadStateKey]*MessageReadStateEntry, len(bav.MessageReadStateKeyToMessageReadStateEntry),
+	)
+	for mapKey, readStateEntry := range bav.MessageReadStateKeyToMessageReadStateEntry {
+		newView.MessageReadStateKeyToMessageReadStateEntry[mapKey] = readStateEntry.Copy()
+	}
+
+	// Copy the NFTAvatarEntries
+	newView.NFTAvatarKeyToNFTAvatarEntry = make(
+		map[NFTAvatarKey]*NFTAvatarEntry, len(bav.NFTAvatarKeyToNFTAvatarEntry),
+	)
+	for mapKey, avatarEntry := range bav.NFTAvatarKeyToNFTAvatarEntry {
+		newView.NFTAvatarKeyToNFTAvatarEntry[mapKey] = avatarEntry.Copy()
+	}
+
+	// Copy the BridgeEventAnchorEntries
+	newView.BridgeEventAnchorKeyToBridgeEventAnchorEntry = make(
+		map[BridgeEventAnchorKey]*BridgeEventAnchorEntry, len(bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry),
+	)
+	for mapKey, anchorEntry := range bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry {
+		newView.BridgeEventAnchorKeyToBridgeEventAnchorEntry[mapKey] = anchorEntry.Copy()
+	}
+
+	// Copy the DAOCoinBalanceChangeEntries
+	newView.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry = make(
+		map[DAOCoinBalanceChangeKey]*DAOCoinBalanceChangeEntry, len(bav.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry),
+	)
+	for mapKey, balanceChangeEntry := range bav.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry {
+		newView.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry[mapKey] = balanceChangeEntry.Copy()
+	}
+
+	// Copy the PKIDSwapEntries
+	newView.PKIDSwapKeyToPKIDSwapEntry = make(map[PKIDSwapKey]*PKIDSwapEntry, len(bav.PKIDSwapKeyToPKIDSwapEntry))
+	for mapKey, swapEntry := range bav.PKIDSwapKeyToPKIDSwapEntry {
+		newView.PKIDSwapKeyToPKIDSwapEntry[mapKey] = swapEntry.Copy()
+	}
+
+	// Copy the DelegatedPosterEntries
+	newView.DelegatedPosterKeyToDelegatedPosterEntry = make(
+		map[DelegatedPosterKey]*DelegatedPosterEntry, len(bav.DelegatedPosterKeyToDelegatedPosterEntry),
+	)
+	for mapKey, delegatedPosterEntry := range bav.DelegatedPosterKeyToDelegatedPosterEntry {
+		newView.DelegatedPosterKeyToDelegatedPosterEntry[mapKey] = delegatedPosterEntry.Copy()
+	}
+
+	// Copy the AnchorHashEntries and AnchorHashRateLimitEntries
+	newView.AnchorHashKeyToAnchorHashEntry = make(
+		map[AnchorHashKey]*AnchorHashEntry, len(bav.AnchorHashKeyToAnchorHashEntry),
+	)
+	for mapKey, anchorHashEntry := range bav.AnchorHashKeyToAnchorHashEntry {
+		newView.AnchorHashKeyToAnchorHashEntry[mapKey] = anchorHashEntry.Copy()
+	}
+	newView.AnchorHashRateLimitPKIDToRateLimitEntry = make(
+		map[PKID]*AnchorHashRateLimitEntry, len(bav.AnchorHashRateLimitPKIDToRateLimitEntry),
+	)
+	for mapKey, rateLimitEntry := range bav.AnchorHashRateLimitPKIDToRateLimitEntry {
+		newView.AnchorHashRateLimitPKIDToRateLimitEntry[mapKey] = rateLimitEntry.Copy()
+	}
+
+	// Copy the ContentTombstoneEntries
+	newView.ContentTombstoneKeyToContentTombstoneEntry = make(
+		map[ContentTombstoneKey]*ContentTombstoneEntry, len(bav.ContentTombstoneKeyToContentTombstoneEntry),
+	)
+	for mapKey, tombstoneEntry := range bav.ContentTombstoneKeyToContentTombstoneEntry {
+		newView.ContentTombstoneKeyToContentTombstoneEntry[mapKey] = tombstoneEntry.Copy()
+	}
+
+	// Copy the BlockFeeSplitEntries
+	newView.BlockHeightToBlockFeeSplitEntry = make(
+		map[uint64]*BlockFeeSplitEntry, len(bav.BlockHeightToBlockFeeSplitEntry),
+	)
+	for blockHeight, feeSplitEntry := range bav.BlockHeightToBlockFeeSplitEntry {
+		newView.BlockHeightToBlockFeeSplitEntry[blockHeight] = feeSplitEntry.Copy()
+	}
+
+	// Copy the SubscriptionEntries
+	newView.SubscriptionKeyToSubscriptionEntry = make(
+		map[SubscriptionKey]*SubscriptionEntry, len(bav.SubscriptionKeyToSubscriptionEntry),
+	)
+	for mapKey, subscriptionEntry := range bav.SubscriptionKeyToSubscriptionEntry {
+		newView.SubscriptionKeyToSubscriptionEntry[mapKey] = subscriptionEntry.Copy()
+	}
+
+	// Copy the GlobalParamsHistoryEntries
+	newView.BlockHeightToGlobalParamsHistoryEntry = make(
+		map[uint64]*GlobalParamsHistoryEntry, len(bav.BlockHeightToGlobalParamsHistoryEntry),
+	)
+	for blockHeight, historyEntry := range bav.BlockHeightToGlobalParamsHistoryEntry {
+		newView.BlockHeightToGlobalParamsHistoryEntry[blockHeight] = historyEntry.Copy()
+	}
+
 	newView.TipHash = bav.TipHash.NewBlockHash()
 
 	return newView
@@ -852,7 +1130,15 @@ func (bav *UtxoView) GetDeSoBalanceNanosForPublicKey(publicKeyArg []byte) (uint6
 	}
 
 	var err error
-	balanceNanos, err = bav.GetDbAdapter().GetDeSoBalanceForPublicKey(publicKey)
+	if bav.Postgres != nil {
+		balanceNanos, err = bav.GetDbAdapter().GetDeSoBalanceForPublicKey(publicKey)
+	} else {
+		err = bav.viewDB(func(txn *badger.Txn, snap *Snapshot) error {
+			var innerErr error
+			balanceNanos, innerErr = DbGetDeSoBalanceNanosForPublicKeyWithTxn(txn, snap, publicKey)
+			return innerErr
+		})
+	}
 	if err != nil {
 		return 0, errors.Wrapf(err,
 			"GetDeSoBalanceNanosForPublicKey: Problem getting balance for public key %v",
@@ -1169,7 +1455,11 @@ func (bav *UtxoView) _disconnectBasicTransfer(currentTxn *MsgDeSoTxn, txnHash *B
 	operationIndex := len(utxoOpsForTxn) - 1
 	if blockHeight >= bav.Params.ForkHeights.DerivedKeyTrackSpendingLimitsBlockHeight {
 		if len(utxoOpsForTxn) > 0 && utxoOpsForTxn[operationIndex].Type == OperationTypeSpendingLimitAccounting {
-			currentOperation := utxoOpsForTxn[operationIndex]
+			currentOperation, err := GetUtxoOperationData[SpendingLimitAccountingOperationData](
+				utxoOpsForTxn[operationIndex])
+			if err != nil {
+				return errors.Wrapf(err, "_disconnectBasicTransfer: ")
+			}
 			// Get the current derived key entry
 			derivedPkBytes, isDerived, err := IsDerivedSignature(currentTxn, blockHeight)
 			if !isDerived || err != nil {
@@ -1196,11 +1486,23 @@ func (bav *UtxoView) _disconnectBasicTransfer(currentTxn *MsgDeSoTxn, txnHash *B
 		}
 	}
 
+	// Next, we check to see if the last utxoOp was a message read state operation. It's added after the diamond
+	// operation, so we disconnect it first.
+	if len(utxoOpsForTxn) > 0 && utxoOpsForTxn[operationIndex].Type == OperationTypeMessageReadState {
+		if err := bav._disconnectMessageReadState(currentTxn, utxoOpsForTxn[operationIndex]); err != nil {
+			return errors.Wrapf(err, "_disconnectBasicTransfer: ")
+		}
+		operationIndex--
+	}
+
 	// Next, we check to see if the last utxoOp (either last one in the list or last one before the spending limit
 	// account op) was a diamond operation. If it was, we disconnect the diamond-related changes and decrement
 	// the operation index to move past it.
 	if len(utxoOpsForTxn) > 0 && utxoOpsForTxn[operationIndex].Type == OperationTypeDeSoDiamond {
-		currentOperation := utxoOpsForTxn[operationIndex]
+		currentOperation, err := GetUtxoOperationData[DeSoDiamondOperationData](utxoOpsForTxn[operationIndex])
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectBasicTransfer: ")
+		}
 
 		diamondPostHashBytes, hasDiamondPostHash := currentTxn.ExtraData[DiamondPostHashKey]
 		if !hasDiamondPostHash {
@@ -1407,7 +1709,10 @@ func (bav *UtxoView) _disconnectUpdateGlobalParams(
 			"%v but found type %v",
 			OperationTypeUpdateGlobalParams, utxoOpsForTxn[operationIndex].Type)
 	}
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[UpdateGlobalParamsOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUpdateGlobalParams: ")
+	}
 
 	// Reset the global params to their previous value.
 	// This previous value comes from the UtxoOperation data.
@@ -1416,6 +1721,7 @@ func (bav *UtxoView) _disconnectUpdateGlobalParams(
 		prevGlobalParamEntry = &InitialGlobalParamsEntry
 	}
 	bav.GlobalParamsEntry = prevGlobalParamEntry
+	bav._removeGlobalParamsHistory(txnHash, uint64(blockHeight), prevGlobalParamEntry)
 
 	// Reset any modified forbidden pub key entries if they exist.
 	if operationData.PrevForbiddenPubKeyEntry != nil {
@@ -1620,6 +1926,31 @@ func (bav *UtxoView) DisconnectTransaction(currentTxn *MsgDeSoTxn, txnHash *Bloc
 	case TxnTypeCoinUnlock:
 		return bav._disconnectCoinUnlock(OperationTypeCoinUnlock, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
 
+	case TxnTypeSetKeyValueRecords:
+		return bav._disconnectSetKeyValueRecords(
+			OperationTypeSetKeyValueRecords, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
+	case TxnTypeNFTBatch:
+		return bav._disconnectNFTBatch(OperationTypeNFTBatch, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
+	case TxnTypeBridgeEventAnchor:
+		return bav._disconnectBridgeEventAnchor(
+			OperationTypeBridgeEventAnchor, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
+	case TxnTypeDelegatedPoster:
+		return bav._disconnectDelegatedPoster(
+			OperationTypeDelegatedPoster, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
+	case TxnTypeRotateValidatorVotingKey:
+		return bav._disconnectRotateValidatorVotingKey(
+			OperationTypeRotateValidatorVotingKey, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
+	case TxnTypeAnchorHash:
+		return bav._disconnectAnchorHash(OperationTypeAnchorHash, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
+	case TxnTypeSubscription:
+		return bav._disconnectSubscription(OperationTypeSubscription, currentTxn, txnHash, utxoOpsForTxn, blockHeight)
+
 	}
 
 	return fmt.Errorf("DisconnectBlock: Unimplemented txn type %v", currentTxn.TxnMeta.GetTxnType().String())
@@ -1640,6 +1971,10 @@ func (bav *UtxoView) DisconnectBlock(
 		return fmt.Errorf("DisconnectBlock: Block being disconnected does not match tip")
 	}
 
+	// Remember the DAO coin balances before the block is disconnected, so that the balance changes recorded for
+	// the block can be deleted.
+	prevDAOCoinBalances := bav._getDAOCoinBalancesInView()
+
 	// Verify the number of ADD and SPEND operations in the utxOps list is equal
 	// to the number of outputs and inputs in the block respectively.
 	//
@@ -1781,6 +2116,43 @@ func (bav *UtxoView) DisconnectBlock(
 				bav._setValidatorEntryMappings(utxoOp.PrevValidatorEntry)
 			}
 		}
+
+		// Delete the staking reward statements that were recorded when the final block of the epoch was connected.
+		if isLastBlockInEpoch &&
+			desoBlock.Header.Height >= uint64(bav.Params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight) {
+			var currentEpochEntry *EpochEntry
+			currentEpochEntry, err = bav.GetCurrentEpochEntry()
+			if err != nil {
+				return errors.Wrapf(err, "DisconnectBlock: Problem getting current epoch entry")
+			}
+			if err = bav._deleteStakingRewardStatementsForEpoch(currentEpochEntry.EpochNumber); err != nil {
+				return errors.Wrapf(err, "DisconnectBlock: Problem deleting staking reward statements")
+			}
+		}
+
+		// Subtract the block from the validator performance entries it was added to when it was connected.
+		if desoBlock.Header.Height >= uint64(bav.Params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight) {
+			var allSnapshotValidators []*ValidatorEntry
+			allSnapshotValidators, err = bav.GetAllSnapshotValidatorSetEntriesByStake()
+			if err != nil {
+				return errors.Wrapf(err, "DisconnectBlock: Problem getting snapshot validator set")
+			}
+			var currentEpochNumber uint64
+			currentEpochNumber, err = bav.GetCurrentEpochNumber()
+			if err != nil {
+				return errors.Wrapf(err, "DisconnectBlock: Problem getting current epoch number")
+			}
+			if err = bav._updateValidatorPerformanceForBlock(
+				desoBlock.Header, allSnapshotValidators, currentEpochNumber, false,
+			); err != nil {
+				return errors.Wrapf(err, "DisconnectBlock: Problem reverting validator performance")
+			}
+		}
+	}
+
+	// Remove the block from the soft fork deployment windows it was added to when it was connected.
+	if err = bav._updateSoftForkDeploymentStatesForBlock(desoBlock, false); err != nil {
+		return errors.Wrapf(err, "DisconnectBlock: Problem reverting soft fork deployment states")
 	}
 
 	// Loop through the txns backwards to process them.
@@ -1794,12 +2166,28 @@ func (bav *UtxoView) DisconnectBlock(
 		if err = bav.DisconnectTransaction(currentTxn, txnHash, utxoOpsForTxn, uint32(desoBlockHeight)); err != nil {
 			return errors.Wrapf(err, "DisconnectBlock: Problem disconnecting transaction: %v", currentTxn)
 		}
+
+		// Delete the receipts that were stored when the transaction was connected.
+		bav._deleteTxnReceiptMappings(txnHash)
+		if txnMeta, ok := currentTxn.TxnMeta.(*AtomicTxnsWrapperMetadata); ok {
+			for _, innerTxn := range txnMeta.Txns {
+				bav._deleteTxnReceiptMappings(innerTxn.Hash())
+			}
+		}
 	}
 
 	// At this point, all of the transactions in the block should be fully
 	// reversed and the view should therefore be in the state it was in before
 	// this block was applied.
 
+	// Delete the DAO coin balance changes that were recorded when the block was connected.
+	bav._deleteDAOCoinBalanceChangesForBlock(prevDAOCoinBalances, desoBlock.Header.Height)
+
+	// Delete the fee split that was recorded when the block was connected.
+	if bav.Postgres == nil {
+		bav._deleteBlockFeeSplitMappings(desoBlock.Header.Height)
+	}
+
 	// Update the tip to point to the parent of this block since we've managed
 	// to successfully disconnect it.
 	bav.TipHash = desoBlock.Header.PrevBlockHash
@@ -1835,12 +2223,11 @@ func (bav *UtxoView) _verifySignature(txn *MsgDeSoTxn, blockHeight uint32) (_der
 			return nil, errors.Wrapf(RuleErrorTxnSigHasHighS, "_verifySignature: high-S deteceted")
 		}
 	}
-	// Compute a hash of the transaction.
-	txBytes, err := txn.ToBytes(true /*preSignature*/)
+	// Compute the digest that the transaction was signed over.
+	_, txHash, err := txn.signatureDigest()
 	if err != nil {
-		return nil, errors.Wrapf(err, "_verifySignature: Problem serializing txn without signature: ")
+		return nil, errors.Wrapf(err, "_verifySignature: ")
 	}
-	txHash := Sha256DoubleHash(txBytes)
 
 	// Look for the derived key in transaction ExtraData and validate it. For transactions
 	// signed using a derived key, the derived public key is passed in ExtraData. Alternatively,
@@ -1951,15 +2338,13 @@ func IsDerivedSignature(txn *MsgDeSoTxn, blockHeight uint32) (_derivedPkBytes []
 	// If transaction doesn't contain a derived key in ExtraData, then check if it contains the recovery ID.
 	if txn.Signature.IsRecoverable {
 		// Assemble the transaction hash; we need it in order to recover the public key.
-		txBytes, err := txn.ToBytes(true /*preSignature*/)
+		_, txHash, err := txn.signatureDigest()
 		if err != nil {
-			return nil, false, errors.Wrapf(err, "IsDerivedSignature: Problem "+
-				"serializing txn without signature: ")
+			return nil, false, errors.Wrapf(err, "IsDerivedSignature: ")
 		}
-		txHash := Sha256DoubleHash(txBytes)[:]
 
 		// Recover the public key from the signature.
-		derivedPublicKey, err := txn.Signature.RecoverPublicKey(txHash)
+		derivedPublicKey, err := txn.Signature.RecoverPublicKey(txHash[:])
 		if err != nil {
 			return nil, false, errors.Wrapf(err, "IsDerivedSignature: Problem recovering "+
 				"public key from signature")
@@ -2290,6 +2675,15 @@ func (bav *UtxoView) _connectBasicTransferWithExtraSpend(
 
 	}
 
+	// Set the transactor's read watermark if the txn carries message read state.
+	readStateUtxoOp, err := bav._connectMessageReadState(txn, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectBasicTransferWithExtraSpend ")
+	}
+	if readStateUtxoOp != nil {
+		utxoOpsForTxn = append(utxoOpsForTxn, readStateUtxoOp)
+	}
+
 	// If signature verification is requested then do that as well.
 	if verifySignatures {
 		if err := bav._verifyTxnSignature(txn, blockHeight); err != nil {
@@ -3215,9 +3609,9 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 	}
 	if len(extraData[USDCentsPerBitcoinKey]) > 0 {
 		// Validate that the exchange rate is not less than the floor as a sanity-check.
-		newUSDCentsPerBitcoin, usdCentsPerBitcoinBytesRead := Uvarint(extraData[USDCentsPerBitcoinKey])
-		if usdCentsPerBitcoinBytesRead <= 0 {
-			return 0, 0, nil, fmt.Errorf("_connectUpdateGlobalParams: unable to decode USDCentsPerBitcoin as uint64")
+		newUSDCentsPerBitcoin, _, err := GetExtraDataUint64(extraData, USDCentsPerBitcoinKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
 		}
 		if newUSDCentsPerBitcoin < MinUSDCentsPerBitcoin {
 			return 0, 0, nil, RuleErrorExchangeRateTooLow
@@ -3229,9 +3623,9 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 	}
 
 	if len(extraData[MinNetworkFeeNanosPerKBKey]) > 0 {
-		newMinNetworkFeeNanosPerKB, minNetworkFeeNanosPerKBBytesRead := Uvarint(extraData[MinNetworkFeeNanosPerKBKey])
-		if minNetworkFeeNanosPerKBBytesRead <= 0 {
-			return 0, 0, nil, fmt.Errorf("_connectUpdateGlobalParams: unable to decode MinNetworkFeeNanosPerKB as uint64")
+		newMinNetworkFeeNanosPerKB, _, err := GetExtraDataUint64(extraData, MinNetworkFeeNanosPerKBKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
 		}
 		if newMinNetworkFeeNanosPerKB < MinNetworkFeeNanosPerKBValue {
 			return 0, 0, nil, RuleErrorMinNetworkFeeTooLow
@@ -3243,9 +3637,9 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 	}
 
 	if len(extraData[CreateProfileFeeNanosKey]) > 0 {
-		newCreateProfileFeeNanos, createProfileFeeNanosBytesRead := Uvarint(extraData[CreateProfileFeeNanosKey])
-		if createProfileFeeNanosBytesRead <= 0 {
-			return 0, 0, nil, fmt.Errorf("_connectUpdateGlobalParams: unable to decode CreateProfileFeeNanos as uint64")
+		newCreateProfileFeeNanos, _, err := GetExtraDataUint64(extraData, CreateProfileFeeNanosKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
 		}
 		if newCreateProfileFeeNanos < MinCreateProfileFeeNanos {
 			return 0, 0, nil, RuleErrorCreateProfileFeeTooLow
@@ -3257,9 +3651,9 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 	}
 
 	if len(extraData[CreateNFTFeeNanosKey]) > 0 {
-		newCreateNFTFeeNanos, createNFTFeeNanosBytesRead := Uvarint(extraData[CreateNFTFeeNanosKey])
-		if createNFTFeeNanosBytesRead <= 0 {
-			return 0, 0, nil, fmt.Errorf("_connectUpdateGlobalParams: unable to decode CreateNFTFeeNanos as uint64")
+		newCreateNFTFeeNanos, _, err := GetExtraDataUint64(extraData, CreateNFTFeeNanosKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
 		}
 		if newCreateNFTFeeNanos < MinCreateNFTFeeNanos {
 			return 0, 0, nil, RuleErrorCreateNFTFeeTooLow
@@ -3271,9 +3665,9 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 	}
 
 	if len(extraData[MaxCopiesPerNFTKey]) > 0 {
-		newMaxCopiesPerNFT, maxCopiesPerNFTBytesRead := Uvarint(extraData[MaxCopiesPerNFTKey])
-		if maxCopiesPerNFTBytesRead <= 0 {
-			return 0, 0, nil, fmt.Errorf("_connectUpdateGlobalParams: unable to decode MaxCopiesPerNFT as uint64")
+		newMaxCopiesPerNFT, _, err := GetExtraDataUint64(extraData, MaxCopiesPerNFTKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
 		}
 		if newMaxCopiesPerNFT < MinMaxCopiesPerNFT {
 			return 0, 0, nil, RuleErrorMaxCopiesPerNFTTooLow
@@ -3287,9 +3681,9 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 	if blockHeight >= bav.Params.ForkHeights.BalanceModelBlockHeight &&
 		len(extraData[MaxNonceExpirationBlockHeightOffsetKey]) > 0 {
 
-		newMaxNonceExpirationBlockHeightOffset, maxNonceExpirationBlockHeightOffsetBytesRead := Uvarint(extraData[MaxNonceExpirationBlockHeightOffsetKey])
-		if maxNonceExpirationBlockHeightOffsetBytesRead <= 0 {
-			return 0, 0, nil, fmt.Errorf("_connectUpdateGlobalParams: unable to decode MaxNonceExpirationBlockHeightOffset as uint64")
+		newMaxNonceExpirationBlockHeightOffset, _, err := GetExtraDataUint64(extraData, MaxNonceExpirationBlockHeightOffsetKey)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectUpdateGlobalParams: ")
 		}
 		newGlobalParamsEntry.MaxNonceExpirationBlockHeightOffset = newMaxNonceExpirationBlockHeightOffset
 	}
@@ -3627,6 +4021,57 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 			newGlobalParamsEntry.TimeoutIntervalMillisecondsPoS = val
 		}
 	}
+	if blockHeight >= bav.Params.ForkHeights.PoSTimeoutBackoffParamsBlockHeight {
+		if len(extraData[TimeoutBackoffMultiplierBasisPointsPoSKey]) > 0 {
+			val, bytesRead := Uvarint(
+				extraData[TimeoutBackoffMultiplierBasisPointsPoSKey],
+			)
+			if bytesRead <= 0 {
+				return 0, 0, nil, fmt.Errorf(
+					"_connectUpdateGlobalParams: unable to decode TimeoutBackoffMultiplierBasisPointsPoS as uint64",
+				)
+			}
+			if val < MinTimeoutBackoffMultiplierBasisPointsPoS {
+				return 0, 0, nil, RuleErrorTimeoutBackoffMultiplierPoSTooLow
+			}
+			if val > MaxTimeoutBackoffMultiplierBasisPointsPoS {
+				return 0, 0, nil, RuleErrorTimeoutBackoffMultiplierPoSTooHigh
+			}
+			newGlobalParamsEntry.TimeoutBackoffMultiplierBasisPointsPoS = val
+		}
+	}
+	if blockHeight >= bav.Params.ForkHeights.BlockRewardMaturityParamsBlockHeight {
+		if len(extraData[BlockRewardMaturityBlocksKey]) > 0 {
+			val, bytesRead := Uvarint(
+				extraData[BlockRewardMaturityBlocksKey],
+			)
+			if bytesRead <= 0 {
+				return 0, 0, nil, fmt.Errorf(
+					"_connectUpdateGlobalParams: unable to decode BlockRewardMaturityBlocks as uint64",
+				)
+			}
+			if val > MaxBlockRewardMaturityBlocks {
+				return 0, 0, nil, RuleErrorBlockRewardMaturityBlocksTooHigh
+			}
+			newGlobalParamsEntry.BlockRewardMaturityBlocks = val
+		}
+	}
+	if blockHeight >= bav.Params.ForkHeights.FeeRedistributionParamsBlockHeight {
+		if len(extraData[FeeRedistributionBasisPointsKey]) > 0 {
+			val, bytesRead := Uvarint(
+				extraData[FeeRedistributionBasisPointsKey],
+			)
+			if bytesRead <= 0 {
+				return 0, 0, nil, fmt.Errorf(
+					"_connectUpdateGlobalParams: unable to decode FeeRedistributionBasisPoints as uint64",
+				)
+			}
+			if val > MaxFeeRedistributionBasisPoints {
+				return 0, 0, nil, RuleErrorFeeRedistributionBasisPointsTooHigh
+			}
+			newGlobalParamsEntry.FeeRedistributionBasisPoints = val
+		}
+	}
 
 	var newForbiddenPubKeyEntry *ForbiddenPubKeyEntry
 	var prevForbiddenPubKeyEntry *ForbiddenPubKeyEntry
@@ -3668,6 +4113,7 @@ func (bav *UtxoView) _connectUpdateGlobalParams(
 	// Update the GlobalParamsEntry using the txn's ExtraData. Save the previous value
 	// so it can be easily reverted.
 	bav.GlobalParamsEntry = &newGlobalParamsEntry
+	bav._addGlobalParamsHistory(txHash, uint64(blockHeight), &newGlobalParamsEntry)
 
 	// Update the forbidden pub key entry on the view, if we have one to update.
 	if newForbiddenPubKeyEntry != nil {
@@ -3749,6 +4195,18 @@ func (bav *UtxoView) ConnectTransaction(
 	_fees uint64,
 	_err error,
 ) {
+	span := StartTraceSpan("UtxoView.ConnectTransaction", bav.traceSpan)
+	defer func() {
+		if span.IsRecording() {
+			span.SetAttributes(txnTraceAttributes(txn, txHash)...)
+			span.SetAttributes(
+				TraceAttribute{Key: TraceAttributeKeyBlockHeight, Value: blockHeight},
+				TraceAttribute{Key: TraceAttributeKeyTxnFeeNanos, Value: _fees},
+			)
+		}
+		EndTraceSpan(span, _err)
+	}()
+
 	return bav._connectTransaction(
 		txn,
 		txHash,
@@ -4071,6 +4529,27 @@ func (bav *UtxoView) _connectSingleTxn(
 	case TxnTypeCoinUnlock:
 		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectCoinUnlock(txn, txHash, blockHeight, blockTimestampNanoSecs, verifySignatures)
 
+	case TxnTypeSetKeyValueRecords:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectSetKeyValueRecords(txn, txHash, blockHeight, verifySignatures)
+
+	case TxnTypeNFTBatch:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectNFTBatch(txn, txHash, blockHeight, verifySignatures)
+
+	case TxnTypeBridgeEventAnchor:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectBridgeEventAnchor(txn, txHash, blockHeight, verifySignatures)
+
+	case TxnTypeDelegatedPoster:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectDelegatedPoster(txn, txHash, blockHeight, verifySignatures)
+
+	case TxnTypeRotateValidatorVotingKey:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectRotateValidatorVotingKey(txn, txHash, blockHeight, verifySignatures)
+
+	case TxnTypeAnchorHash:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectAnchorHash(txn, txHash, blockHeight, verifySignatures)
+
+	case TxnTypeSubscription:
+		totalInput, totalOutput, utxoOpsForTxn, err = bav._connectSubscription(txn, txHash, blockHeight, verifySignatures)
+
 	default:
 		err = fmt.Errorf("ConnectTransaction: Unimplemented txn type %v", txn.TxnMeta.GetTxnType().String())
 	}
@@ -4323,7 +4802,19 @@ func (bav *UtxoView) _compareBalancesToSnapshot(balanceSnapshot map[PublicKey]ui
 
 func (bav *UtxoView) ConnectBlock(
 	desoBlock *MsgDeSoBlock, txHashes []*BlockHash, verifySignatures bool, eventManager *EventManager, blockHeight uint64) (
-	[][]*UtxoOperation, error) {
+	_utxoOps [][]*UtxoOperation, _err error) {
+
+	// The transactions connected below are traced as children of the block's span.
+	span := StartTraceSpan("UtxoView.ConnectBlock", bav.traceSpan)
+	if span.IsRecording() {
+		span.SetAttributes(blockTraceAttributes(desoBlock)...)
+	}
+	parentSpan := bav.traceSpan
+	bav.traceSpan = span
+	defer func() {
+		bav.traceSpan = parentSpan
+		EndTraceSpan(span, _err)
+	}()
 
 	glog.V(1).Infof("ConnectBlock: Connecting block %v with %v txns", desoBlock, len(desoBlock.Txns))
 
@@ -4336,6 +4827,10 @@ func (bav *UtxoView) ConnectBlock(
 		return nil, errors.New(errorMsg)
 	}
 
+	// Remember the DAO coin balances before the block is connected, so that the balances it changes can be
+	// recorded.
+	prevDAOCoinBalances := bav._getDAOCoinBalancesInView()
+
 	// If the block height is past the Proof of Stake cutover, then we update the random seed hash.
 	// We do this first before connecting any transactions so that the latest seed hash is used for
 	// transactions that use on-chain randomness.
@@ -4373,11 +4868,34 @@ func (bav *UtxoView) ConnectBlock(
 		}
 	}
 
+	// After the canonical txn ordering fork, every transaction after the block reward must appear in
+	// canonical order. This lets us detect block producers that reorder transactions to extract value.
+	if bav.Params.IsCanonicalTxnOrderingBlockHeight(blockHeight) && len(desoBlock.Txns) > 1 {
+		if err := ValidateCanonicalTxnOrder(desoBlock.Txns[1:], txHashes[1:]); err != nil {
+			return nil, errors.Wrapf(err, "ConnectBlock: ")
+		}
+	}
+	// Networks that enforce the deterministic shuffle require it in place of the canonical order, for PoW
+	// and PoS blocks alike. See deterministic_txn_shuffle.go.
+	if bav.Params.IsDeterministicTxnShuffleBlockHeight(blockHeight) && len(desoBlock.Txns) > 1 {
+		err := ValidateDeterministicTxnShuffleOrder(desoBlock.Txns[1:], txHashes[1:], desoBlock.Header.PrevBlockHash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ConnectBlock: ")
+		}
+	}
+
+	// After the PoS cut-over, the share of the fees the block producer can claim depends on a global param.
+	feeRedistributionBasisPoints, err := bav.GetFeeRedistributionBasisPoints(blockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ConnectBlock: ")
+	}
+
 	// Loop through all the transactions and validate them using the view. Also
 	// keep track of the total fees throughout.
 	var totalFees uint64
 	utxoOps := [][]*UtxoOperation{}
 	var maxUtilityFee uint64
+	var txnReceipts []*TxnReceipt
 	for txIndex, txn := range desoBlock.Txns {
 		txHash := txHashes[txIndex]
 
@@ -4398,6 +4916,8 @@ func (bav *UtxoView) ConnectBlock(
 		if err != nil {
 			return nil, errors.Wrapf(err, "ConnectBlock: error connecting txn #%d", txIndex)
 		}
+		txnReceipts = append(txnReceipts, bav.newTxnReceipts(
+			txn, txHash, uint64(txIndex), currentFees, blockHeight, feeRedistributionBasisPoints)...)
 
 		// After the block reward patch block height, we only include fees from transactions
 		// where the transactor is not the block reward output public key. This prevents
@@ -4417,7 +4937,7 @@ func (bav *UtxoView) ConnectBlock(
 		if includeFeesInBlockReward {
 			if txn.TxnMeta.GetTxnType() != TxnTypeAtomicTxnsWrapper {
 				// Compute the BMF given the current fees paid in the block.
-				_, utilityFee = computeBMF(currentFees)
+				_, utilityFee = computeFeeSplit(currentFees, feeRedistributionBasisPoints)
 
 				// Add the fees from this txn to the total fees. If any overflow occurs
 				// mark the block as invalid and return a rule error. Note that block reward
@@ -4450,7 +4970,7 @@ func (bav *UtxoView) ConnectBlock(
 					return nil, errors.Wrap(
 						err, "ConnectBlock: error adding non-block-reward recipient fees from atomic transaction")
 				}
-				_, utilityFee = computeBMF(nonBlockRewardRecipientFees)
+				_, utilityFee = computeFeeSplit(nonBlockRewardRecipientFees, feeRedistributionBasisPoints)
 				maxUtilityFee, err = SafeUint64().Add(maxUtilityFee, utilityFee)
 				if err != nil {
 					return nil, errors.Wrap(err,
@@ -4570,6 +5090,18 @@ func (bav *UtxoView) ConnectBlock(
 				bav._setValidatorEntryMappings(validatorEntry)
 			}
 		}
+		// Record the block in the validator performance index.
+		if err = bav._updateValidatorPerformanceForBlock(
+			desoBlock.Header, allSnapshotValidators, currentEpochNumber, true,
+		); err != nil {
+			return nil, errors.Wrapf(err, "ConnectBlock: error updating validator performance")
+		}
+	}
+
+	// Count the block's soft fork signals. This also moves the deployments to their next state when the block
+	// is the first in a signaling window.
+	if err := bav._updateSoftForkDeploymentStatesForBlock(desoBlock, true); err != nil {
+		return nil, errors.Wrapf(err, "ConnectBlock: error updating soft fork deployment states")
 	}
 
 	// If we're past the PoS Setup Fork Height, check if we should run the end of epoch hook.
@@ -4609,6 +5141,26 @@ func (bav *UtxoView) ConnectBlock(
 	}
 	bav.TipHash = blockHash
 
+	// Now that the block's hash is known, store a receipt for each of its transactions.
+	for _, txnReceipt := range txnReceipts {
+		txnReceipt.BlockHash = blockHash
+		bav._setTxnReceiptMappings(txnReceipt)
+	}
+
+	// Record the DAO coin balances the block changed.
+	bav._setDAOCoinBalanceChangesForBlock(prevDAOCoinBalances, blockHeight)
+
+	// Record how the block's fees were split between the block producer and the burn.
+	if bav.Postgres == nil &&
+		blockHeight >= uint64(bav.Params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight) &&
+		blockHeight >= uint64(bav.Params.ForkHeights.FeeRedistributionParamsBlockHeight) {
+		feeSplitEntry, err := NewBlockFeeSplitEntry(desoBlock, blockHash, feeRedistributionBasisPoints)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ConnectBlock: ")
+		}
+		bav._setBlockFeeSplitMappings(feeSplitEntry)
+	}
+
 	return utxoOps, nil
 }
 
@@ -5038,26 +5590,47 @@ func (bav *UtxoView) GetUnspentUtxoEntrysForPublicKey(pkBytes []byte) ([]*UtxoEn
 }
 
 // GetSpendableDeSoBalanceNanosForPublicKey gets the current spendable balance for the
-// provided public key. It only considers the last block as immature currently and
-// instead of the configured number of immature block rewards. Additionally, using the
-// tipHash of the view only gives us access to the previous block, not the current block,
-// so we are unable to mark the current block reward as immature.
-// However, this bug does not introduce a security issue and is addressed with the BlockRewardPatch fork,
-// but should be fixed soon.
+// provided public key, which is its balance minus its immature block rewards. See
+// GetImmatureBlockRewardNanosForPublicKey.
 func (bav *UtxoView) GetSpendableDeSoBalanceNanosForPublicKey(pkBytes []byte,
 	tipHeight uint32) (_spendableBalance uint64, _err error) {
-	// After the cut-over to Proof Of Stake, we no longer check for immature block rewards.
-	// All block rewards are immediately mature.
+	immatureBlockRewards, err := bav.GetImmatureBlockRewardNanosForPublicKey(pkBytes, tipHeight)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetSpendableDeSoBalanceNanosForPublicKey: ")
+	}
+
+	balanceNanos, err := bav.GetDeSoBalanceNanosForPublicKey(pkBytes)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetSpendableDeSoBalanceNanosForPublicKey: ")
+	}
+	spendableBalanceNanos, err := SafeUint64().Sub(balanceNanos, immatureBlockRewards)
+	if err != nil {
+		return 0, errors.Wrapf(err,
+			"GetSpendableDeSoBalanceNanosForPublicKey: error subtract immature block rewards (%d) from "+
+				"balance nanos (%d)", immatureBlockRewards, balanceNanos)
+	}
+	return spendableBalanceNanos, nil
+}
+
+// GetImmatureBlockRewardNanosForPublicKey gets the block rewards paid to the provided public
+// key that can't be spent yet. Before the cut-over to Proof of Stake, it only considers the
+// last block as immature currently and instead of the configured number of immature block
+// rewards. Additionally, using the tipHash of the view only gives us access to the previous
+// block, not the current block, so we are unable to mark the current block reward as immature.
+// However, this bug does not introduce a security issue and is addressed with the BlockRewardPatch fork,
+// but should be fixed soon. After the cut-over, the number of immature blocks is the
+// BlockRewardMaturityBlocks global param.
+func (bav *UtxoView) GetImmatureBlockRewardNanosForPublicKey(pkBytes []byte,
+	tipHeight uint32) (_immatureBlockRewards uint64, _err error) {
 	if tipHeight >= bav.Params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight {
-		balanceNanos, err := bav.GetDeSoBalanceNanosForPublicKey(pkBytes)
+		immatureBlockRewards, err := bav._getImmatureBlockRewardNanosForPublicKeyPoS(pkBytes, tipHeight)
 		if err != nil {
-			return 0, errors.Wrap(err, "GetSpendableDeSoBalanceNanosForPublicKey: ")
+			return 0, errors.Wrap(err, "GetImmatureBlockRewardNanosForPublicKey: ")
 		}
-		return balanceNanos, nil
+		return immatureBlockRewards, nil
 	}
-	// In order to get the spendable balance, we need to account for any immature block rewards.
-	// We get these by starting at the chain tip and iterating backwards until we have collected
-	// all the immature block rewards for this public key.
+	// We get the immature block rewards by starting at the chain tip and iterating backwards until
+	// we have collected all the immature block rewards for this public key.
 	nextBlockHash := bav.TipHash
 	numImmatureBlocks := uint32(bav.Params.BlockRewardMaturity / bav.Params.TimeBetweenBlocks)
 	immatureBlockRewards := uint64(0)
@@ -5081,7 +5654,7 @@ func (bav *UtxoView) GetSpendableDeSoBalanceNanosForPublicKey(pkBytes []byte,
 		for _, output := range outputs {
 			immatureBlockRewards, err = SafeUint64().Add(immatureBlockRewards, output.AmountNanos)
 			if err != nil {
-				return 0, errors.Wrap(err, "GetSpendableDeSoBalanceNanosForPublicKey: Problem "+
+				return 0, errors.Wrap(err, "GetImmatureBlockRewardNanosForPublicKey: Problem "+
 					"adding immature block rewards")
 			}
 		}
@@ -5095,18 +5668,18 @@ func (bav *UtxoView) GetSpendableDeSoBalanceNanosForPublicKey(pkBytes []byte,
 			blockNode := GetHeightHashToNodeInfo(bav.Handle, bav.Snapshot, tipHeight, nextBlockHash, false)
 			if blockNode == nil {
 				return 0, fmt.Errorf(
-					"GetSpendableDeSoBalanceNanosForPublicKey: Problem getting block for blockhash %s",
+					"GetImmatureBlockRewardNanosForPublicKey: Problem getting block for blockhash %s",
 					nextBlockHash.String())
 			}
 			blockRewardForPK, err := DbGetBlockRewardForPublicKeyBlockHash(bav.Handle, bav.Snapshot, pkBytes, nextBlockHash)
 			if err != nil {
 				return 0, errors.Wrapf(
-					err, "GetSpendableDeSoBalanceNanosForPublicKey: Problem getting block reward for "+
+					err, "GetImmatureBlockRewardNanosForPublicKey: Problem getting block reward for "+
 						"public key %s blockhash %s", PkToString(pkBytes, bav.Params), nextBlockHash.String())
 			}
 			immatureBlockRewards, err = SafeUint64().Add(immatureBlockRewards, blockRewardForPK)
 			if err != nil {
-				return 0, errors.Wrapf(err, "GetSpendableDeSoBalanceNanosForPublicKey: Problem adding "+
+				return 0, errors.Wrapf(err, "GetImmatureBlockRewardNanosForPublicKey: Problem adding "+
 					"block reward (%d) to immature block rewards (%d)", blockRewardForPK, immatureBlockRewards)
 			}
 			// TODO: This is the specific line that causes the bug. We should be using blockNode.Header.PrevBlockHash
@@ -5122,18 +5695,7 @@ func (bav *UtxoView) GetSpendableDeSoBalanceNanosForPublicKey(pkBytes []byte,
 		}
 	}
 
-	balanceNanos, err := bav.GetDeSoBalanceNanosForPublicKey(pkBytes)
-
-	if err != nil {
-		return 0, errors.Wrap(err, "GetSpendableDeSoBalanceNanosForPublicKey: ")
-	}
-	spendableBalanceNanos, err := SafeUint64().Sub(balanceNanos, immatureBlockRewards)
-	if err != nil {
-		return 0, errors.Wrapf(err,
-			"GetSpendableDeSoBalanceNanosForPublicKey: error subtract immature block rewards (%d) from "+
-				"balance nanos (%d)", immatureBlockRewards, balanceNanos)
-	}
-	return spendableBalanceNanos, nil
+	return immatureBlockRewards, nil
 }
 
 func copyExtraData(extraData map[string][]byte) map[string][]byte {
@@ -470,10 +470,13 @@ func (bav *UtxoView) _disconnectAccessGroup(
 	}
 	// If the last operation is not an AccessGroup operation, then we return an error.
 
-	accessGroupOp := utxoOpsForTxn[len(utxoOpsForTxn)-1]
-	if accessGroupOp.Type != OperationTypeAccessGroup {
+	if utxoOpsForTxn[len(utxoOpsForTxn)-1].Type != OperationTypeAccessGroup {
 		return fmt.Errorf("_disconnectAccessGroup: Trying to revert "+
-			"OperationTypeAccessGroup but found type %v", accessGroupOp.Type)
+			"OperationTypeAccessGroup but found type %v", utxoOpsForTxn[len(utxoOpsForTxn)-1].Type)
+	}
+	accessGroupOp, err := GetUtxoOperationData[AccessGroupOperationData](utxoOpsForTxn[len(utxoOpsForTxn)-1])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAccessGroup: ")
 	}
 
 	// Check that the transaction has the right TxnType.
@@ -486,7 +489,7 @@ func (bav *UtxoView) _disconnectAccessGroup(
 	txMeta := currentTxn.TxnMeta.(*AccessGroupMetadata)
 
 	// Sanity check that the access public key and key name are valid
-	err := ValidateAccessGroupPublicKeyAndName(txMeta.AccessGroupOwnerPublicKey, txMeta.AccessGroupKeyName)
+	err = ValidateAccessGroupPublicKeyAndName(txMeta.AccessGroupOwnerPublicKey, txMeta.AccessGroupKeyName)
 	if err != nil {
 		return errors.Wrapf(err, "_disconnectAccessGroup: failed validating the access "+
 			"public key and key name")
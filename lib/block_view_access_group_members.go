@@ -520,10 +520,14 @@ func (bav *UtxoView) _disconnectAccessGroupMembers(
 		return fmt.Errorf("_disconnectAccessGroupMembers: Trying to revert " +
 			"AccessGroupMembersList but with no operations")
 	}
-	accessGroupMembersOp := utxoOpsForTxn[len(utxoOpsForTxn)-1]
-	if accessGroupMembersOp.Type != OperationTypeAccessGroupMembers {
+	if utxoOpsForTxn[len(utxoOpsForTxn)-1].Type != OperationTypeAccessGroupMembers {
 		return fmt.Errorf("_disconnectAccessGroupMembers: Trying to revert "+
-			"AccessGroupMembersList but found types %v and %v", accessGroupMembersOp.Type, operationType)
+			"AccessGroupMembersList but found types %v and %v", utxoOpsForTxn[len(utxoOpsForTxn)-1].Type, operationType)
+	}
+	accessGroupMembersOp, err := GetUtxoOperationData[AccessGroupMembersOperationData](
+		utxoOpsForTxn[len(utxoOpsForTxn)-1])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAccessGroupMembers: ")
 	}
 
 	// Check that the transaction has the right TxnType.
@@ -0,0 +1,894 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// AnchorHash: Records the hash of off-chain content, such as an image or a video stored on a CDN or IPFS,
+// on chain so that applications can prove the content existed at the height it was anchored and verify
+// its integrity when they fetch it. The transaction stores the hash along with the size of the content and
+// a hint of its MIME type in an AnchorHashEntry, which is indexed by the content hash so that all of the
+// public keys that anchored a piece of content can be looked up, earliest first. A public key can only
+// anchor a content hash once.
+//
+// The transaction is meant to be cheap, so it only pays the regular per-KB fee. To keep it from being used
+// to spam the index, a public key can anchor at most DeSoParams.MaxAnchorHashesPerWindow hashes in each
+// window of DeSoParams.AnchorHashRateLimitWindowBlocks blocks. The number of hashes a public key anchored in
+// its current window is stored in an AnchorHashRateLimitEntry.
+
+//
+// TYPES: AnchorHashMetadata
+//
+
+type AnchorHashMetadata struct {
+	// The hash of the content. Consensus doesn't interpret it, so any hash function can be used as long as
+	// the applications that verify the content agree on it.
+	ContentHash []byte
+	// The size of the content in bytes.
+	ContentSizeBytes uint64
+	// A hint of the MIME type of the content, e.g. "image/png". It's optional and isn't verified.
+	MimeType []byte
+}
+
+func (txnData *AnchorHashMetadata) GetTxnType() TxnType {
+	return TxnTypeAnchorHash
+}
+
+func (txnData *AnchorHashMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, EncodeByteArray(txnData.ContentHash)...)
+	data = append(data, UintToBuf(txnData.ContentSizeBytes)...)
+	data = append(data, EncodeByteArray(txnData.MimeType)...)
+	return data, nil
+}
+
+func (txnData *AnchorHashMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	// ContentHash
+	if txnData.ContentHash, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashMetadata.FromBytes: Problem reading ContentHash: ")
+	}
+
+	// ContentSizeBytes
+	if txnData.ContentSizeBytes, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashMetadata.FromBytes: Problem reading ContentSizeBytes: ")
+	}
+
+	// MimeType
+	if txnData.MimeType, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashMetadata.FromBytes: Problem reading MimeType: ")
+	}
+
+	return nil
+}
+
+func (txnData *AnchorHashMetadata) New() DeSoTxnMetadata {
+	return &AnchorHashMetadata{}
+}
+
+//
+// TYPES: AnchorHashEntry
+//
+
+type AnchorHashEntry struct {
+	// The ContentHash and the AnchorerPKID together are the primary key for an AnchorHashEntry.
+	ContentHash      []byte
+	AnchorerPKID     *PKID
+	ContentSizeBytes uint64
+	MimeType         []byte
+	// The txn that anchored the content and the height of its block.
+	AnchorTxnHash     *BlockHash
+	AnchorBlockHeight uint64
+	isDeleted         bool
+}
+
+type AnchorHashKey struct {
+	ContentHash  string
+	AnchorerPKID PKID
+}
+
+func (entry *AnchorHashEntry) Copy() *AnchorHashEntry {
+	return &AnchorHashEntry{
+		ContentHash:       append([]byte{}, entry.ContentHash...),
+		AnchorerPKID:      entry.AnchorerPKID.NewPKID(),
+		ContentSizeBytes:  entry.ContentSizeBytes,
+		MimeType:          append([]byte{}, entry.MimeType...),
+		AnchorTxnHash:     entry.AnchorTxnHash.NewBlockHash(),
+		AnchorBlockHeight: entry.AnchorBlockHeight,
+		isDeleted:         entry.isDeleted,
+	}
+}
+
+func (entry *AnchorHashEntry) ToMapKey() AnchorHashKey {
+	return AnchorHashKey{
+		ContentHash:  string(entry.ContentHash),
+		AnchorerPKID: *entry.AnchorerPKID,
+	}
+}
+
+func (entry *AnchorHashEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeByteArray(entry.ContentHash)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.AnchorerPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.ContentSizeBytes)...)
+	data = append(data, EncodeByteArray(entry.MimeType)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.AnchorTxnHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.AnchorBlockHeight)...)
+	return data
+}
+
+func (entry *AnchorHashEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// ContentHash
+	if entry.ContentHash, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashEntry.Decode: Problem reading ContentHash: ")
+	}
+
+	// AnchorerPKID
+	if entry.AnchorerPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashEntry.Decode: Problem reading AnchorerPKID: ")
+	}
+
+	// ContentSizeBytes
+	if entry.ContentSizeBytes, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashEntry.Decode: Problem reading ContentSizeBytes: ")
+	}
+
+	// MimeType
+	if entry.MimeType, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashEntry.Decode: Problem reading MimeType: ")
+	}
+
+	// AnchorTxnHash
+	if entry.AnchorTxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashEntry.Decode: Problem reading AnchorTxnHash: ")
+	}
+
+	// AnchorBlockHeight
+	if entry.AnchorBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashEntry.Decode: Problem reading AnchorBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (entry *AnchorHashEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *AnchorHashEntry) GetEncoderType() EncoderType {
+	return EncoderTypeAnchorHashEntry
+}
+
+func (entry *AnchorHashEntry) IsDeleted() bool {
+	return entry.isDeleted
+}
+
+//
+// TYPES: AnchorHashRateLimitEntry
+//
+
+type AnchorHashRateLimitEntry struct {
+	// AnchorerPKID is the primary key for an AnchorHashRateLimitEntry.
+	AnchorerPKID *PKID
+	// The first block height of the window the hashes were anchored in, and the number of hashes anchored
+	// in it. Anchoring a hash in a later window starts a new window.
+	WindowStartBlockHeight uint64
+	NumAnchoredHashes      uint64
+	isDeleted              bool
+}
+
+func (entry *AnchorHashRateLimitEntry) Copy() *AnchorHashRateLimitEntry {
+	return &AnchorHashRateLimitEntry{
+		AnchorerPKID:           entry.AnchorerPKID.NewPKID(),
+		WindowStartBlockHeight: entry.WindowStartBlockHeight,
+		NumAnchoredHashes:      entry.NumAnchoredHashes,
+		isDeleted:              entry.isDeleted,
+	}
+}
+
+func (entry *AnchorHashRateLimitEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.AnchorerPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.WindowStartBlockHeight)...)
+	data = append(data, UintToBuf(entry.NumAnchoredHashes)...)
+	return data
+}
+
+func (entry *AnchorHashRateLimitEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// AnchorerPKID
+	if entry.AnchorerPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashRateLimitEntry.Decode: Problem reading AnchorerPKID: ")
+	}
+
+	// WindowStartBlockHeight
+	if entry.WindowStartBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashRateLimitEntry.Decode: Problem reading WindowStartBlockHeight: ")
+	}
+
+	// NumAnchoredHashes
+	if entry.NumAnchoredHashes, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "AnchorHashRateLimitEntry.Decode: Problem reading NumAnchoredHashes: ")
+	}
+
+	return nil
+}
+
+func (entry *AnchorHashRateLimitEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *AnchorHashRateLimitEntry) GetEncoderType() EncoderType {
+	return EncoderTypeAnchorHashRateLimitEntry
+}
+
+func (entry *AnchorHashRateLimitEntry) IsDeleted() bool {
+	return entry.isDeleted
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForAnchorHash(contentHash []byte, anchorerPKID *PKID) []byte {
+	key := DBPrefixKeyForAnchorHashesByContentHash(contentHash)
+	key = append(key, anchorerPKID.ToBytes()...)
+	return key
+}
+
+func DBPrefixKeyForAnchorHashesByContentHash(contentHash []byte) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice. The content hash is
+	// prefixed with its length so that a hash isn't a prefix of the keys of longer hashes.
+	prefixCopy := append([]byte{}, Prefixes.PrefixAnchorHashByContentHashAnchorerPKID...)
+	return append(prefixCopy, EncodeByteArray(contentHash)...)
+}
+
+func DBKeyForAnchorHashRateLimit(anchorerPKID *PKID) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixAnchorHashRateLimitByPKID...)
+	return append(prefixCopy, anchorerPKID.ToBytes()...)
+}
+
+func DBGetAnchorHashEntry(
+	handle *badger.DB, snap *Snapshot, contentHash []byte, anchorerPKID *PKID,
+) (*AnchorHashEntry, error) {
+	var ret *AnchorHashEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetAnchorHashEntryWithTxn(txn, snap, contentHash, anchorerPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetAnchorHashEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, contentHash []byte, anchorerPKID *PKID,
+) (*AnchorHashEntry, error) {
+	// Retrieve AnchorHashEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForAnchorHash(contentHash, anchorerPKID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetAnchorHashEntryWithTxn: problem retrieving AnchorHashEntry")
+	}
+
+	// Decode AnchorHashEntry from bytes.
+	entry := &AnchorHashEntry{}
+	rr := bytes.NewReader(entryBytes)
+	if exist, err := DecodeFromBytes(entry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetAnchorHashEntryWithTxn: problem decoding AnchorHashEntry")
+	}
+	return entry, nil
+}
+
+func DBGetAnchorHashEntriesForContentHash(handle *badger.DB, contentHash []byte) ([]*AnchorHashEntry, error) {
+	var ret []*AnchorHashEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetAnchorHashEntriesForContentHashWithTxn(txn, contentHash)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetAnchorHashEntriesForContentHashWithTxn(txn *badger.Txn, contentHash []byte) ([]*AnchorHashEntry, error) {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, DBPrefixKeyForAnchorHashesByContentHash(contentHash), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetAnchorHashEntriesForContentHashWithTxn: problem retrieving AnchorHashEntries")
+	}
+
+	var entries []*AnchorHashEntry
+	for _, entryBytes := range valsFound {
+		rr := bytes.NewReader(entryBytes)
+		entry, err := DecodeDeSoEncoder(&AnchorHashEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetAnchorHashEntriesForContentHashWithTxn: problem decoding AnchorHashEntry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutAnchorHashEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *AnchorHashEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutAnchorHashEntryWithTxn: called with nil AnchorHashEntry")
+		return nil
+	}
+
+	key := DBKeyForAnchorHash(entry.ContentHash, entry.AnchorerPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutAnchorHashEntryWithTxn: problem storing AnchorHashEntry in index PrefixAnchorHashByContentHashAnchorerPKID",
+		)
+	}
+	return nil
+}
+
+func DBDeleteAnchorHashEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *AnchorHashEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteAnchorHashEntryWithTxn: called with nil AnchorHashEntry")
+		return nil
+	}
+
+	key := DBKeyForAnchorHash(entry.ContentHash, entry.AnchorerPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteAnchorHashEntryWithTxn: problem deleting AnchorHashEntry from index PrefixAnchorHashByContentHashAnchorerPKID",
+		)
+	}
+	return nil
+}
+
+func DBGetAnchorHashRateLimitEntry(
+	handle *badger.DB, snap *Snapshot, anchorerPKID *PKID,
+) (*AnchorHashRateLimitEntry, error) {
+	var ret *AnchorHashRateLimitEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetAnchorHashRateLimitEntryWithTxn(txn, snap, anchorerPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetAnchorHashRateLimitEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, anchorerPKID *PKID,
+) (*AnchorHashRateLimitEntry, error) {
+	// Retrieve AnchorHashRateLimitEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForAnchorHashRateLimit(anchorerPKID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetAnchorHashRateLimitEntryWithTxn: problem retrieving AnchorHashRateLimitEntry")
+	}
+
+	// Decode AnchorHashRateLimitEntry from bytes.
+	entry := &AnchorHashRateLimitEntry{}
+	rr := bytes.NewReader(entryBytes)
+	if exist, err := DecodeFromBytes(entry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetAnchorHashRateLimitEntryWithTxn: problem decoding AnchorHashRateLimitEntry")
+	}
+	return entry, nil
+}
+
+func DBPutAnchorHashRateLimitEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *AnchorHashRateLimitEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutAnchorHashRateLimitEntryWithTxn: called with nil AnchorHashRateLimitEntry")
+		return nil
+	}
+
+	key := DBKeyForAnchorHashRateLimit(entry.AnchorerPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutAnchorHashRateLimitEntryWithTxn: problem storing AnchorHashRateLimitEntry in index PrefixAnchorHashRateLimitByPKID",
+		)
+	}
+	return nil
+}
+
+func DBDeleteAnchorHashRateLimitEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *AnchorHashRateLimitEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteAnchorHashRateLimitEntryWithTxn: called with nil AnchorHashRateLimitEntry")
+		return nil
+	}
+
+	key := DBKeyForAnchorHashRateLimit(entry.AnchorerPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteAnchorHashRateLimitEntryWithTxn: problem deleting AnchorHashRateLimitEntry from index PrefixAnchorHashRateLimitByPKID",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateAnchorHashTxn(
+	transactorPublicKey []byte,
+	metadata *AnchorHashMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the AnchorHash fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Validate txn metadata.
+	if err := ValidateAnchorHashMetadata(bc.params, metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateAnchorHashTxn: invalid txn metadata: ")
+	}
+
+	// We don't need to make any tweaks to the amount because it's basically
+	// a standard "pay per kilobyte" transaction.
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateAnchorHashTxn: problem adding inputs: ")
+	}
+
+	// Sanity-check that the spendAmount is zero.
+	if err = amountEqualsAdditionalOutputs(spendAmount, additionalOutputs); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateAnchorHashTxn: %v", err)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectAnchorHash(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height. The previous rate limit window is stored in a field of
+	// the UtxoOperation that only the compact encoding includes.
+	if blockHeight < bav.Params.ForkHeights.AnchorHashBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.UtxoOperationCompactEncodingBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorAnchorHashBeforeBlockHeight, "_connectAnchorHash: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeAnchorHash {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectAnchorHash: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*AnchorHashMetadata)
+
+	if err := ValidateAnchorHashMetadata(bav.Params, txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorHash: ")
+	}
+
+	// A public key can only anchor a content hash once.
+	anchorerPKID := bav.GetPKIDForPublicKey(txn.PublicKey).PKID
+	prevEntry, err := bav.GetAnchorHashEntry(txMeta.ContentHash, anchorerPKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorHash: ")
+	}
+	if prevEntry != nil {
+		return 0, 0, nil, errors.Wrapf(RuleErrorAnchorHashAlreadyAnchored,
+			"_connectAnchorHash: content hash %x, anchorer %v", txMeta.ContentHash, PkToString(txn.PublicKey, bav.Params))
+	}
+
+	// Count the hash against the transactor's rate limit.
+	prevRateLimitEntry, err := bav.GetAnchorHashRateLimitEntry(anchorerPKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorHash: ")
+	}
+	rateLimitEntry, err := bav._getNextAnchorHashRateLimitEntry(anchorerPKID, prevRateLimitEntry, uint64(blockHeight))
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorHash: anchorer %v: ", PkToString(txn.PublicKey, bav.Params))
+	}
+
+	// Connect a basic transfer to get the total input and the
+	// total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectAnchorHash: ")
+	}
+	if verifySignatures {
+		// _connectBasicTransfer has already checked that the txn is signed
+		// by the top-level public key, which we take to be the anchorer's
+		// public key.
+	}
+
+	bav._setAnchorHashEntryMappings(&AnchorHashEntry{
+		ContentHash:       append([]byte{}, txMeta.ContentHash...),
+		AnchorerPKID:      anchorerPKID.NewPKID(),
+		ContentSizeBytes:  txMeta.ContentSizeBytes,
+		MimeType:          append([]byte{}, txMeta.MimeType...),
+		AnchorTxnHash:     txHash.NewBlockHash(),
+		AnchorBlockHeight: uint64(blockHeight),
+	})
+	var prevRateLimitEntryCopy *AnchorHashRateLimitEntry
+	if prevRateLimitEntry != nil {
+		prevRateLimitEntryCopy = prevRateLimitEntry.Copy()
+	}
+	bav._setAnchorHashRateLimitEntryMappings(rateLimitEntry)
+
+	// Add a UTXO operation
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                         OperationTypeAnchorHash,
+		PrevAnchorHashRateLimitEntry: prevRateLimitEntryCopy,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectAnchorHash(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.AnchorHashBlockHeight {
+		return errors.Wrapf(RuleErrorAnchorHashBeforeBlockHeight, "_disconnectAnchorHash: ")
+	}
+
+	// Validate the last operation is an AnchorHash operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectAnchorHash: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeAnchorHash {
+		return fmt.Errorf(
+			"_disconnectAnchorHash: trying to revert %v but found %v",
+			OperationTypeAnchorHash,
+			utxoOpsForTxn[operationIndex].Type,
+		)
+	}
+	operationData, err := GetUtxoOperationData[AnchorHashOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAnchorHash: ")
+	}
+	txMeta := currentTxn.TxnMeta.(*AnchorHashMetadata)
+
+	// Delete the anchor. A public key can't anchor a content hash twice, so there's nothing to restore.
+	anchorerPKID := bav.GetPKIDForPublicKey(currentTxn.PublicKey).PKID
+	currentEntry, err := bav.GetAnchorHashEntry(txMeta.ContentHash, anchorerPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAnchorHash: ")
+	}
+	if currentEntry == nil || !currentEntry.AnchorTxnHash.IsEqual(txHash) {
+		return fmt.Errorf("_disconnectAnchorHash: content hash %x wasn't anchored by txn %v",
+			txMeta.ContentHash, txHash)
+	}
+	bav._deleteAnchorHashEntryMappings(currentEntry)
+
+	// Restore the transactor's rate limit window, or delete it if this was its first anchor.
+	currentRateLimitEntry, err := bav.GetAnchorHashRateLimitEntry(anchorerPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAnchorHash: ")
+	}
+	if currentRateLimitEntry == nil {
+		return fmt.Errorf("_disconnectAnchorHash: no AnchorHashRateLimitEntry for anchorer %v", anchorerPKID)
+	}
+	if operationData.PrevAnchorHashRateLimitEntry != nil {
+		bav._setAnchorHashRateLimitEntryMappings(operationData.PrevAnchorHashRateLimitEntry)
+	} else {
+		bav._deleteAnchorHashRateLimitEntryMappings(currentRateLimitEntry)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// ValidateAnchorHashMetadata checks the metadata of an AnchorHash txn against the limits in the params.
+// It doesn't depend on the state, so it's shared by txn construction and connection.
+func ValidateAnchorHashMetadata(params *DeSoParams, metadata *AnchorHashMetadata) error {
+	if len(metadata.ContentHash) == 0 ||
+		uint64(len(metadata.ContentHash)) > params.MaxAnchorHashContentHashLengthBytes {
+		return errors.Wrapf(RuleErrorAnchorHashInvalidContentHash,
+			"ValidateAnchorHashMetadata: %d bytes", len(metadata.ContentHash))
+	}
+	if uint64(len(metadata.MimeType)) > params.MaxAnchorHashMimeTypeLengthBytes {
+		return errors.Wrapf(RuleErrorAnchorHashInvalidMimeType,
+			"ValidateAnchorHashMetadata: %d bytes > %d", len(metadata.MimeType), params.MaxAnchorHashMimeTypeLengthBytes)
+	}
+	// The MIME type is only a hint, but it's displayed by applications, so it has to be printable ASCII.
+	for _, char := range metadata.MimeType {
+		if char < 0x20 || char > 0x7e {
+			return errors.Wrapf(RuleErrorAnchorHashInvalidMimeType,
+				"ValidateAnchorHashMetadata: non-printable character %#x", char)
+		}
+	}
+	return nil
+}
+
+// _getNextAnchorHashRateLimitEntry returns the rate limit window of the anchorer after it anchors another
+// hash at the block height, or an error if the anchorer has already anchored as many hashes as it can in
+// the window. The rate limit is disabled if the params don't define a window.
+func (bav *UtxoView) _getNextAnchorHashRateLimitEntry(
+	anchorerPKID *PKID, prevEntry *AnchorHashRateLimitEntry, blockHeight uint64,
+) (*AnchorHashRateLimitEntry, error) {
+	windowStartBlockHeight := uint64(0)
+	if bav.Params.AnchorHashRateLimitWindowBlocks > 0 {
+		windowStartBlockHeight = blockHeight - blockHeight%bav.Params.AnchorHashRateLimitWindowBlocks
+	}
+	numAnchoredHashes := uint64(0)
+	if prevEntry != nil && prevEntry.WindowStartBlockHeight == windowStartBlockHeight {
+		numAnchoredHashes = prevEntry.NumAnchoredHashes
+	}
+	if bav.Params.AnchorHashRateLimitWindowBlocks > 0 && numAnchoredHashes >= bav.Params.MaxAnchorHashesPerWindow {
+		return nil, errors.Wrapf(RuleErrorAnchorHashRateLimitExceeded,
+			"%d hashes anchored in the window starting at block height %d", numAnchoredHashes, windowStartBlockHeight)
+	}
+	return &AnchorHashRateLimitEntry{
+		AnchorerPKID:           anchorerPKID.NewPKID(),
+		WindowStartBlockHeight: windowStartBlockHeight,
+		NumAnchoredHashes:      numAnchoredHashes + 1,
+	}, nil
+}
+
+func (bav *UtxoView) GetAnchorHashEntry(contentHash []byte, anchorerPKID *PKID) (*AnchorHashEntry, error) {
+	if anchorerPKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetAnchorHashEntry: Called with nil anchorerPKID")
+	}
+
+	// First check the UtxoView.
+	mapKey := AnchorHashKey{ContentHash: string(contentHash), AnchorerPKID: *anchorerPKID}
+	if entry, exists := bav.AnchorHashKeyToAnchorHashEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// If no AnchorHashEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbEntry, err := DBGetAnchorHashEntry(bav.Handle, bav.Snapshot, contentHash, anchorerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetAnchorHashEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the AnchorHashEntry from the db in the UtxoView.
+		bav._setAnchorHashEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetAnchorHashEntriesForContentHash returns all of the anchors of the content hash, merging the anchors in
+// the view with the anchors in the database. The anchors are sorted by their block height, so the first one
+// proves the earliest height at which the content existed.
+func (bav *UtxoView) GetAnchorHashEntriesForContentHash(contentHash []byte) ([]*AnchorHashEntry, error) {
+	// Load the anchors from the database into the view. We don't overwrite the
+	// anchors in the view since they're more recent than the database.
+	dbEntries, err := DBGetAnchorHashEntriesForContentHash(bav.Handle, contentHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetAnchorHashEntriesForContentHash: ")
+	}
+	for _, entry := range dbEntries {
+		if _, exists := bav.AnchorHashKeyToAnchorHashEntry[entry.ToMapKey()]; !exists {
+			bav._setAnchorHashEntryMappings(entry)
+		}
+	}
+
+	var entries []*AnchorHashEntry
+	for mapKey, entry := range bav.AnchorHashKeyToAnchorHashEntry {
+		if !entry.isDeleted && mapKey.ContentHash == string(contentHash) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		if entries[ii].AnchorBlockHeight != entries[jj].AnchorBlockHeight {
+			return entries[ii].AnchorBlockHeight < entries[jj].AnchorBlockHeight
+		}
+		return bytes.Compare(entries[ii].AnchorerPKID.ToBytes(), entries[jj].AnchorerPKID.ToBytes()) < 0
+	})
+	return entries, nil
+}
+
+func (bav *UtxoView) GetAnchorHashRateLimitEntry(anchorerPKID *PKID) (*AnchorHashRateLimitEntry, error) {
+	if anchorerPKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetAnchorHashRateLimitEntry: Called with nil anchorerPKID")
+	}
+
+	// First check the UtxoView.
+	if entry, exists := bav.AnchorHashRateLimitPKIDToRateLimitEntry[*anchorerPKID]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// If no AnchorHashRateLimitEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbEntry, err := DBGetAnchorHashRateLimitEntry(bav.Handle, bav.Snapshot, anchorerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetAnchorHashRateLimitEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the AnchorHashRateLimitEntry from the db in the UtxoView.
+		bav._setAnchorHashRateLimitEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+func (bav *UtxoView) _setAnchorHashEntryMappings(entry *AnchorHashEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setAnchorHashEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.AnchorHashKeyToAnchorHashEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteAnchorHashEntryMappings(entry *AnchorHashEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteAnchorHashEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setAnchorHashEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _setAnchorHashRateLimitEntryMappings(entry *AnchorHashRateLimitEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setAnchorHashRateLimitEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.AnchorHashRateLimitPKIDToRateLimitEntry[*entry.AnchorerPKID] = entry
+}
+
+func (bav *UtxoView) _deleteAnchorHashRateLimitEntryMappings(entry *AnchorHashRateLimitEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteAnchorHashRateLimitEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setAnchorHashRateLimitEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushAnchorHashEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, entryIter := range bav.AnchorHashKeyToAnchorHashEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(entry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushAnchorHashEntriesToDbWithTxn: AnchorHashEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(),
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if entry.isDeleted {
+			if err := DBDeleteAnchorHashEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushAnchorHashEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutAnchorHashEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushAnchorHashEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
+
+func (bav *UtxoView) _flushAnchorHashRateLimitEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, entryIter := range bav.AnchorHashRateLimitPKIDToRateLimitEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !entry.AnchorerPKID.Eq(&mapKey) {
+			return fmt.Errorf(
+				"_flushAnchorHashRateLimitEntriesToDbWithTxn: AnchorHashRateLimitEntry PKID %v doesn't match MapKey %v",
+				entry.AnchorerPKID,
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if entry.isDeleted {
+			if err := DBDeleteAnchorHashRateLimitEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushAnchorHashRateLimitEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutAnchorHashRateLimitEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushAnchorHashRateLimitEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnchorHash(t *testing.T) {
+	var err error
+
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	// AnchorHash txns require the compact UtxoOperation encoding.
+	setAnchorHashBlockHeight := func(blockHeight uint32) {
+		params.ForkHeights.AnchorHashBlockHeight = blockHeight
+		params.ForkHeights.UtxoOperationCompactEncodingBlockHeight = blockHeight
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}
+	defer func(prevForkHeights ForkHeights) {
+		params.ForkHeights = prevForkHeights
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}(params.ForkHeights)
+	setAnchorHashBlockHeight(math.MaxUint32)
+	defer func(prevWindowBlocks uint64, prevMaxAnchorHashes uint64) {
+		params.AnchorHashRateLimitWindowBlocks = prevWindowBlocks
+		params.MaxAnchorHashesPerWindow = prevMaxAnchorHashes
+	}(params.AnchorHashRateLimitWindowBlocks, params.MaxAnchorHashesPerWindow)
+	params.AnchorHashRateLimitWindowBlocks = 1000
+	params.MaxAnchorHashesPerWindow = 2
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       chain.blockTip().Height + 1,
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+
+	contentHash := Sha256DoubleHash([]byte("image bytes"))[:]
+	anchor := func(contentHash []byte) *AnchorHashMetadata {
+		return &AnchorHashMetadata{
+			ContentHash:      contentHash,
+			ContentSizeBytes: 2048,
+			MimeType:         []byte("image/png"),
+		}
+	}
+
+	{
+		// RuleErrorAnchorHashBeforeBlockHeight
+		err = _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, anchor(contentHash))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAnchorHashBeforeBlockHeight)
+
+		setAnchorHashBlockHeight(uint32(1))
+	}
+	{
+		// RuleErrorAnchorHashInvalidContentHash
+		err = _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, anchor(nil))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAnchorHashInvalidContentHash)
+		err = _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, anchor(make([]byte, 65)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAnchorHashInvalidContentHash)
+	}
+	{
+		// RuleErrorAnchorHashInvalidMimeType
+		metadata := anchor(contentHash)
+		metadata.MimeType = []byte("image/png\n")
+		err = _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAnchorHashInvalidMimeType)
+		metadata.MimeType = make([]byte, 129)
+		err = _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAnchorHashInvalidMimeType)
+	}
+
+	// Happy path: m0 anchors the content, then m1 anchors it too.
+	require.NoError(t, _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, anchor(contentHash)))
+	entry, err := DBGetAnchorHashEntry(db, chain.snapshot, contentHash, m0PKID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2048), entry.ContentSizeBytes)
+	require.Equal(t, []byte("image/png"), entry.MimeType)
+	require.Equal(t, testMeta.txns[len(testMeta.txns)-1].Hash(), entry.AnchorTxnHash)
+	require.Equal(t, uint64(chain.blockTip().Height+1), entry.AnchorBlockHeight)
+
+	{
+		// RuleErrorAnchorHashAlreadyAnchored
+		err = _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, anchor(contentHash))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAnchorHashAlreadyAnchored)
+	}
+
+	require.NoError(t, _submitAnchorHashWithTestMeta(testMeta, m1Pub, m1Priv, anchor(contentHash)))
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	entries, err := utxoView.GetAnchorHashEntriesForContentHash(contentHash)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.ElementsMatch(t, []PKID{*m0PKID, *m1PKID}, []PKID{*entries[0].AnchorerPKID, *entries[1].AnchorerPKID})
+
+	// A content hash that's a prefix of another isn't confused with it.
+	entries, err = utxoView.GetAnchorHashEntriesForContentHash(contentHash[:16])
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	{
+		// RuleErrorAnchorHashRateLimitExceeded: m0 can anchor one more hash in the window.
+		require.NoError(t, _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, anchor(contentHash[:16])))
+		rateLimitEntry, err := DBGetAnchorHashRateLimitEntry(db, chain.snapshot, m0PKID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), rateLimitEntry.WindowStartBlockHeight)
+		require.Equal(t, uint64(2), rateLimitEntry.NumAnchoredHashes)
+
+		err = _submitAnchorHashWithTestMeta(testMeta, m0Pub, m0Priv, anchor(contentHash[:8]))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAnchorHashRateLimitExceeded)
+
+		// The count starts over in the next window.
+		nextRateLimitEntry, err := utxoView._getNextAnchorHashRateLimitEntry(m0PKID, rateLimitEntry, 1500)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1000), nextRateLimitEntry.WindowStartBlockHeight)
+		require.Equal(t, uint64(1), nextRateLimitEntry.NumAnchoredHashes)
+	}
+
+	// Disconnecting the txns deletes the anchors and the rate limit windows.
+	_executeAllTestRollbackAndFlush(testMeta)
+	entries, err = DBGetAnchorHashEntriesForContentHash(db, contentHash)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	rateLimitEntry, err := DBGetAnchorHashRateLimitEntry(db, chain.snapshot, m0PKID)
+	require.NoError(t, err)
+	require.Nil(t, rateLimitEntry)
+}
+
+func TestAnchorHashMetadataEncoding(t *testing.T) {
+	metadata := &AnchorHashMetadata{
+		ContentHash:      Sha256DoubleHash([]byte("video bytes"))[:],
+		ContentSizeBytes: 1 << 30,
+		MimeType:         []byte("video/mp4"),
+	}
+	encodedBytes, err := metadata.ToBytes(false)
+	require.NoError(t, err)
+	decodedMetadata := &AnchorHashMetadata{}
+	require.NoError(t, decodedMetadata.FromBytes(encodedBytes))
+	require.Equal(t, metadata, decodedMetadata)
+}
+
+func _submitAnchorHashWithTestMeta(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *AnchorHashMetadata,
+) error {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, _, _, err := testMeta.chain.CreateAnchorHashTxn(
+		transactorPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		nil,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	blockHeight := testMeta.chain.blockTip().Height + 1
+	utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	utxoOps, totalInput, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return err
+	}
+	require.Equal(testMeta.t, totalInputMake, totalInput)
+	require.Equal(testMeta.t, OperationTypeAnchorHash, utxoOps[len(utxoOps)-1].Type)
+	require.NoError(testMeta.t, utxoView.FlushToDb(uint64(blockHeight)))
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return nil
+}
@@ -3,6 +3,8 @@ package lib
 import (
 	"bytes"
 	"fmt"
+	"sort"
+
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
@@ -239,6 +241,9 @@ func (bav *UtxoView) _connectCreatePostAssociation(
 	// Note that we don't need to check isDeleted because the Get returns nil if isDeleted=true
 	if prevAssociationEntry != nil {
 		bav._deletePostAssociationEntryMappings(prevAssociationEntry)
+		if err = bav._updatePostAssociationCount(prevAssociationEntry, false); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectCreatePostAssociation: ")
+		}
 	}
 
 	// Retrieve existing ExtraData to merge with any new ExtraData.
@@ -261,6 +266,9 @@ func (bav *UtxoView) _connectCreatePostAssociation(
 	}
 	// Create the association.
 	bav._setPostAssociationEntryMappings(currentAssociationEntry)
+	if err = bav._updatePostAssociationCount(currentAssociationEntry, true); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectCreatePostAssociation: ")
+	}
 
 	// Track state changes.
 	postEntry := bav.GetPostEntryForPostHash(txMeta.PostHash)
@@ -338,6 +346,9 @@ func (bav *UtxoView) _connectDeletePostAssociation(
 		return 0, 0, nil, errors.New("_connectDeletePostAssociation: no existing association entry found")
 	}
 	bav._deletePostAssociationEntryMappings(prevAssociationEntry)
+	if err = bav._updatePostAssociationCount(prevAssociationEntry, false); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDeletePostAssociation: ")
+	}
 
 	// Track state changes.
 	postEntry := bav.GetPostEntryForPostHash(prevAssociationEntry.PostHash)
@@ -377,7 +388,10 @@ func (bav *UtxoView) _disconnectCreateUserAssociation(
 		)
 	}
 	txMeta := currentTxn.TxnMeta.(*CreateUserAssociationMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[UserAssociationOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCreateUserAssociation: ")
+	}
 
 	// Delete the current association entry.
 	currentAssociationEntry, err := bav.GetUserAssociationByAttributes(currentTxn.PublicKey, txMeta)
@@ -419,7 +433,10 @@ func (bav *UtxoView) _disconnectDeleteUserAssociation(
 			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[UserAssociationOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDeleteUserAssociation: ")
+	}
 
 	// Set the prev association entry. Error if doesn't exist.
 	// Note that we don't need to check isDeleted because the Get returns nil if isDeleted=true
@@ -453,7 +470,10 @@ func (bav *UtxoView) _disconnectCreatePostAssociation(
 		)
 	}
 	txMeta := currentTxn.TxnMeta.(*CreatePostAssociationMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[PostAssociationOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCreatePostAssociation: ")
+	}
 
 	// Delete the current association entry.
 	currentAssociationEntry, err := bav.GetPostAssociationByAttributes(currentTxn.PublicKey, txMeta)
@@ -464,11 +484,17 @@ func (bav *UtxoView) _disconnectCreatePostAssociation(
 		return errors.New("_disconnectCreatePostAssociation: no created association entry found")
 	}
 	bav._deletePostAssociationEntryMappings(currentAssociationEntry)
+	if err = bav._updatePostAssociationCount(currentAssociationEntry, false); err != nil {
+		return errors.Wrapf(err, "_disconnectCreatePostAssociation: ")
+	}
 
 	// Set the prev association entry, if exists.
 	// Note that we don't need to check isDeleted because the Get returns nil if isDeleted=true
 	if operationData.PrevPostAssociationEntry != nil {
 		bav._setPostAssociationEntryMappings(operationData.PrevPostAssociationEntry)
+		if err = bav._updatePostAssociationCount(operationData.PrevPostAssociationEntry, true); err != nil {
+			return errors.Wrapf(err, "_disconnectCreatePostAssociation: ")
+		}
 	}
 
 	// Disconnect the basic transfer.
@@ -495,7 +521,10 @@ func (bav *UtxoView) _disconnectDeletePostAssociation(
 			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[PostAssociationOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDeletePostAssociation: ")
+	}
 
 	// Set the prev association entry. Error if doesn't exist.
 	// Note that we don't need to check isDeleted because the Get returns nil if isDeleted=true
@@ -503,6 +532,9 @@ func (bav *UtxoView) _disconnectDeletePostAssociation(
 		return fmt.Errorf("_disconnectDeletePostAssociation: no deleted association entry found")
 	}
 	bav._setPostAssociationEntryMappings(operationData.PrevPostAssociationEntry)
+	if err := bav._updatePostAssociationCount(operationData.PrevPostAssociationEntry, true); err != nil {
+		return errors.Wrapf(err, "_disconnectDeletePostAssociation: ")
+	}
 
 	// Disconnect the basic transfer.
 	return bav._disconnectBasicTransfer(
@@ -1059,6 +1091,86 @@ func (bav *UtxoView) CountPostAssociationsByAttributes(associationQuery *PostAss
 	return uint64(len(newUtxoViewAssociationEntries) + dbAssociationIds.Size()), nil
 }
 
+// GetPostAssociationCountEntry returns the number of associations on the post with the AssociationType and the
+// AssociationValue, including the associations in the view.
+func (bav *UtxoView) GetPostAssociationCountEntry(
+	postHash *BlockHash, associationType []byte, associationValue []byte,
+) (*PostAssociationCountEntry, error) {
+	mapKey := NewPostAssociationCountMapKey(postHash, associationType, associationValue)
+	if countEntry, exists := bav.PostAssociationCountMapKeyToCountEntry[mapKey]; exists {
+		return countEntry, nil
+	}
+
+	var countEntry *PostAssociationCountEntry
+	if bav.Postgres != nil {
+		count, err := bav.Postgres.GetPostAssociationCount(postHash, associationType, associationValue)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetPostAssociationCountEntry: Problem fetching count from Postgres: ")
+		}
+		countEntry = &PostAssociationCountEntry{
+			PostHash:         postHash.NewBlockHash(),
+			AssociationType:  bytes.ToLower(associationType),
+			AssociationValue: append([]byte{}, associationValue...),
+			Count:            count,
+		}
+	} else {
+		var err error
+		countEntry, err = DbGetPostAssociationCountEntry(bav.Handle, postHash, associationType, associationValue)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetPostAssociationCountEntry: Problem fetching count from db: ")
+		}
+	}
+	bav.PostAssociationCountMapKeyToCountEntry[mapKey] = countEntry
+	return countEntry, nil
+}
+
+// GetPostAssociationCountEntriesForPost returns the nonzero counts of the post's associations, e.g. the number of
+// each reaction to the post, including the associations in the view. If associationType isn't empty, only the
+// counts with that AssociationType are returned. The counts are sorted by AssociationType and AssociationValue.
+func (bav *UtxoView) GetPostAssociationCountEntriesForPost(
+	postHash *BlockHash, associationType []byte,
+) ([]*PostAssociationCountEntry, error) {
+	var dbCountEntries []*PostAssociationCountEntry
+	var err error
+	if bav.Postgres != nil {
+		dbCountEntries, err = bav.Postgres.GetPostAssociationCounts(postHash, associationType)
+	} else {
+		dbCountEntries, err = DbGetPostAssociationCountEntriesForPost(bav.Handle, postHash, associationType)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetPostAssociationCountEntriesForPost: ")
+	}
+
+	// The counts in the view take priority over the ones in the DB.
+	mapKeyToCountEntry := make(map[PostAssociationCountMapKey]*PostAssociationCountEntry)
+	for _, countEntry := range dbCountEntries {
+		mapKeyToCountEntry[countEntry.ToMapKey()] = countEntry
+	}
+	lowerAssociationType := string(bytes.ToLower(associationType))
+	for mapKey, countEntry := range bav.PostAssociationCountMapKeyToCountEntry {
+		if mapKey.PostHash != *postHash ||
+			(len(associationType) > 0 && mapKey.AssociationType != lowerAssociationType) {
+			continue
+		}
+		mapKeyToCountEntry[mapKey] = countEntry
+	}
+
+	var countEntries []*PostAssociationCountEntry
+	for _, countEntry := range mapKeyToCountEntry {
+		if countEntry.Count > 0 {
+			countEntries = append(countEntries, countEntry)
+		}
+	}
+	sort.Slice(countEntries, func(ii, jj int) bool {
+		if typeComparison := bytes.Compare(
+			countEntries[ii].AssociationType, countEntries[jj].AssociationType); typeComparison != 0 {
+			return typeComparison < 0
+		}
+		return bytes.Compare(countEntries[ii].AssociationValue, countEntries[jj].AssociationValue) < 0
+	})
+	return countEntries, nil
+}
+
 func (bav *UtxoView) _getUtxoViewPostAssociationEntriesByAttributes(
 	associationQuery *PostAssociationQuery,
 ) ([]*PostAssociationEntry, *Set[BlockHash]) {
@@ -1180,6 +1292,26 @@ func (bav *UtxoView) _deletePostAssociationEntryMappings(entry *PostAssociationE
 	bav._setPostAssociationEntryMappings(&tombstoneEntry)
 }
 
+// _updatePostAssociationCount updates the count of the association's post, AssociationType, and AssociationValue
+// when the association is added or removed.
+func (bav *UtxoView) _updatePostAssociationCount(entry *PostAssociationEntry, isAssociationAdded bool) error {
+	countEntry, err := bav.GetPostAssociationCountEntry(entry.PostHash, entry.AssociationType, entry.AssociationValue)
+	if err != nil {
+		return errors.Wrapf(err, "_updatePostAssociationCount: ")
+	}
+	newCountEntry := *countEntry
+	if isAssociationAdded {
+		newCountEntry.Count++
+	} else if newCountEntry.Count == 0 {
+		return fmt.Errorf("_updatePostAssociationCount: Count of post %v, type %s, and value %s is already zero; "+
+			"this should never happen", entry.PostHash, entry.AssociationType, entry.AssociationValue)
+	} else {
+		newCountEntry.Count--
+	}
+	bav.PostAssociationCountMapKeyToCountEntry[newCountEntry.ToMapKey()] = &newCountEntry
+	return nil
+}
+
 // ###########################
 // ## HELPERS
 // ###########################
@@ -2634,3 +2634,109 @@ func _testAssociationsWithDerivedKey(t *testing.T) {
 		)
 	}
 }
+
+func TestPostAssociationCounts(t *testing.T) {
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	params.ForkHeights.AssociationsAndAccessGroupsBlockHeight = uint32(0)
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       chain.blockTip().Height + 1,
+		feeRateNanosPerKb: uint64(101),
+	}
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e3)
+
+	// m0 submits a post.
+	_submitAssociationTxnHappyPath(
+		testMeta, m0Pub, m0Priv, MsgDeSoTxn{TxnMeta: &SubmitPostMetadata{Body: []byte("Hello, world!")}}, true,
+	)
+	postHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+
+	react := func(publicKey string, privateKey string, associationType string, associationValue string) {
+		_submitAssociationTxnHappyPath(testMeta, publicKey, privateKey, MsgDeSoTxn{
+			TxnMeta: &CreatePostAssociationMetadata{
+				PostHash:         postHash,
+				AppPublicKey:     &ZeroPublicKey,
+				AssociationType:  []byte(associationType),
+				AssociationValue: []byte(associationValue),
+			},
+		}, true)
+	}
+	requireCounts := func(associationType string, expectedCounts map[string]uint64) {
+		utxoView, err := mempool.GetAugmentedUniversalView()
+		require.NoError(t, err)
+		countEntries, err := utxoView.GetPostAssociationCountEntriesForPost(postHash, []byte(associationType))
+		require.NoError(t, err)
+		dbCountEntries, err := DbGetPostAssociationCountEntriesForPost(db, postHash, []byte(associationType))
+		require.NoError(t, err)
+		require.Len(t, countEntries, len(expectedCounts))
+		require.Len(t, dbCountEntries, len(expectedCounts))
+		for ii, countEntry := range countEntries {
+			require.Equal(t, expectedCounts[string(countEntry.AssociationValue)], countEntry.Count)
+			require.Equal(t, countEntry.Count, dbCountEntries[ii].Count)
+			require.Equal(t, countEntry.AssociationValue, dbCountEntries[ii].AssociationValue)
+		}
+	}
+
+	// m1 and m2 like the post, using different cases for the type, and m3 loves it. m1 liking the post again
+	// overwrites their association, so it isn't counted twice.
+	react(m1Pub, m1Priv, "REACTION", "LIKE")
+	react(m2Pub, m2Priv, "reaction", "LIKE")
+	react(m3Pub, m3Priv, "REACTION", "LOVE")
+	react(m1Pub, m1Priv, "REACTION", "LIKE")
+	react(m1Pub, m1Priv, "TAG", "NEWS")
+	requireCounts("REACTION", map[string]uint64{"LIKE": 2, "LOVE": 1})
+	requireCounts("Reaction", map[string]uint64{"LIKE": 2, "LOVE": 1})
+	requireCounts("", map[string]uint64{"LIKE": 2, "LOVE": 1, "NEWS": 1})
+
+	utxoView, err := mempool.GetAugmentedUniversalView()
+	require.NoError(t, err)
+	countEntry, err := utxoView.GetPostAssociationCountEntry(postHash, []byte("REACTION"), []byte("LIKE"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), countEntry.Count)
+	require.Equal(t, []byte("reaction"), countEntry.AssociationType)
+	countEntry, err = utxoView.GetPostAssociationCountEntry(postHash, []byte("REACTION"), []byte("like"))
+	require.NoError(t, err)
+	require.Zero(t, countEntry.Count)
+
+	// m2 removes their like.
+	postAssociationEntry, err := utxoView.GetPostAssociationByAttributes(m2PkBytes, &CreatePostAssociationMetadata{
+		PostHash:         postHash,
+		AppPublicKey:     &ZeroPublicKey,
+		AssociationType:  []byte("REACTION"),
+		AssociationValue: []byte("LIKE"),
+	})
+	require.NoError(t, err)
+	_submitAssociationTxnHappyPath(testMeta, m2Pub, m2Priv, MsgDeSoTxn{
+		TxnMeta: &DeletePostAssociationMetadata{AssociationID: postAssociationEntry.AssociationID},
+	}, true)
+	requireCounts("REACTION", map[string]uint64{"LIKE": 1, "LOVE": 1})
+
+	// The counts built from the post associations are the same as the ones kept up to date by the view.
+	require.NoError(t, DbBuildPostAssociationCountsIfMissing(db))
+	requireCounts("", map[string]uint64{"LIKE": 1, "LOVE": 1, "NEWS": 1})
+	require.NoError(t, DbRebuildPostAssociationCounts(db))
+	requireCounts("", map[string]uint64{"LIKE": 1, "LOVE": 1, "NEWS": 1})
+
+	// Once every txn is disconnected, the post has no counts.
+	_executeAllTestRollbackAndFlush(testMeta)
+	requireCounts("", map[string]uint64{})
+}
@@ -487,7 +487,10 @@ func (bav *UtxoView) _disconnectAtomicTxnsWrapper(
 	txMeta := currentTxn.TxnMeta.(*AtomicTxnsWrapperMetadata)
 
 	// Sanity check the AtomicTxns operation exists.
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[AtomicTxnsWrapperOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAtomicTxnsWrapper: ")
+	}
 	if operationData.AtomicTxnsInnerUtxoOps == nil ||
 		len(operationData.AtomicTxnsInnerUtxoOps) != len(txMeta.Txns) {
 		return fmt.Errorf("_disconnectAtomicTxnsWrapper: Trying to revert OperationTypeAtomicTxns " +
@@ -6,6 +6,7 @@ import (
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
@@ -26,7 +27,10 @@ func (bav *UtxoView) _getBalanceEntryForHODLerPKIDAndCreatorPKID(
 	if bav.Postgres != nil {
 		balanceEntry = bav.GetBalanceEntry(hodlerPKID, creatorPKID, isDAOCoin)
 	} else {
-		balanceEntry = DBGetBalanceEntryForHODLerAndCreatorPKIDs(bav.Handle, bav.Snapshot, hodlerPKID, creatorPKID, isDAOCoin)
+		bav.viewDB(func(txn *badger.Txn, snap *Snapshot) error {
+			balanceEntry = DBGetBalanceEntryForHODLerAndCreatorPKIDsWithTxn(txn, snap, hodlerPKID, creatorPKID, isDAOCoin)
+			return nil
+		})
 	}
 	if balanceEntry != nil {
 		bav._setBalanceEntryMappingsWithPKIDs(balanceEntry, hodlerPKID, creatorPKID, isDAOCoin)
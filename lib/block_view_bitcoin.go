@@ -391,7 +391,10 @@ func (bav *UtxoView) _disconnectBitcoinExchange(
 			"%v but found type %v",
 			OperationTypeBitcoinExchange, utxoOpsForTxn[operationIndex].Type)
 	}
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[BitcoinExchangeOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectBitcoinExchange: ")
+	}
 
 	// Get the transaction metadata from the transaction now that we know it has
 	// OperationTypeBitcoinExchange.
@@ -446,7 +449,10 @@ func (bav *UtxoView) _disconnectUpdateBitcoinUSDExchangeRate(
 			"%v but found type %v",
 			OperationTypeUpdateBitcoinUSDExchangeRate, utxoOpsForTxn[operationIndex].Type)
 	}
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[UpdateBitcoinUSDExchangeRateOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUpdateBitcoinUSDExchangeRate: ")
+	}
 
 	// Get the transaction metadata from the transaction now that we know it has
 	// OperationTypeUpdateBitcoinUSDExchangeRate.
@@ -0,0 +1,711 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// BridgeEventAnchor: Records an event of an external chain, such as a deposit into a bridge contract,
+// on chain so that the flows of wrapped assets can be audited. Only the bridge operators whitelisted in
+// DeSoParams.BridgeOperatorPublicKeys can submit a BridgeEventAnchor transaction, and the event has to
+// be attested by at least DeSoParams.BridgeEventAnchorMinAttestations distinct operators. Each operator
+// attests the event by signing GetAttestationPayload() with its key, and consensus verifies every
+// signature when it connects the transaction.
+//
+// An event is identified by the ID of its chain and its deposit hash, and it can only be anchored once.
+// The transaction doesn't move any DESO: it only stores a BridgeEventAnchorEntry, which is deleted if the
+// transaction is disconnected.
+
+//
+// TYPES: BridgeEventAnchorMetadata
+//
+
+type BridgeOperatorAttestation struct {
+	OperatorPublicKey []byte
+	// The DER signature of the operator over the double SHA-256 hash of the attestation payload.
+	Signature []byte
+}
+
+type BridgeEventAnchorMetadata struct {
+	// The ID of the external chain the event happened on, e.g. 1 for Ethereum mainnet.
+	ChainID uint64
+	// The hash identifying the event on the external chain, e.g. the hash of the deposit txn.
+	DepositHash []byte
+	// The asset the event moved on the external chain, e.g. the address of a token contract.
+	// It's empty for the native asset of the chain.
+	AssetID []byte
+	// The amount the event moved, in the base units of the asset.
+	Amount       *uint256.Int
+	Attestations []*BridgeOperatorAttestation
+}
+
+func (txnData *BridgeEventAnchorMetadata) GetTxnType() TxnType {
+	return TxnTypeBridgeEventAnchor
+}
+
+func (txnData *BridgeEventAnchorMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	if txnData.Amount == nil {
+		return nil, fmt.Errorf("BridgeEventAnchorMetadata.ToBytes: Amount is nil")
+	}
+	var data []byte
+	data = append(data, UintToBuf(txnData.ChainID)...)
+	data = append(data, EncodeByteArray(txnData.DepositHash)...)
+	data = append(data, EncodeByteArray(txnData.AssetID)...)
+	data = append(data, VariableEncodeUint256(txnData.Amount)...)
+	data = append(data, UintToBuf(uint64(len(txnData.Attestations)))...)
+	for _, attestation := range txnData.Attestations {
+		data = append(data, EncodeByteArray(attestation.OperatorPublicKey)...)
+		data = append(data, EncodeByteArray(attestation.Signature)...)
+	}
+	return data, nil
+}
+
+func (txnData *BridgeEventAnchorMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	// ChainID
+	if txnData.ChainID, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem reading ChainID: ")
+	}
+
+	// DepositHash
+	if txnData.DepositHash, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem reading DepositHash: ")
+	}
+
+	// AssetID
+	if txnData.AssetID, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem reading AssetID: ")
+	}
+
+	// Amount
+	if txnData.Amount, err = VariableDecodeUint256(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem reading Amount: ")
+	}
+
+	// Attestations
+	numAttestations, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem reading len(Attestations): ")
+	}
+	attestations, err := SafeMakeSliceWithLength[*BridgeOperatorAttestation](numAttestations)
+	if err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem creating Attestations slice: ")
+	}
+	for ii := range attestations {
+		attestation := &BridgeOperatorAttestation{}
+		if attestation.OperatorPublicKey, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem reading OperatorPublicKey: ")
+		}
+		if attestation.Signature, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "BridgeEventAnchorMetadata.FromBytes: Problem reading Signature: ")
+		}
+		attestations[ii] = attestation
+	}
+	txnData.Attestations = attestations
+
+	return nil
+}
+
+func (txnData *BridgeEventAnchorMetadata) New() DeSoTxnMetadata {
+	return &BridgeEventAnchorMetadata{}
+}
+
+// GetAttestationPayload returns the bytes an operator signs to attest the event. The payload covers every
+// field of the event but none of the attestations, so the operators can sign it independently.
+func (txnData *BridgeEventAnchorMetadata) GetAttestationPayload() []byte {
+	var data []byte
+	data = append(data, []byte(TxnStringBridgeEventAnchor)...)
+	data = append(data, UintToBuf(txnData.ChainID)...)
+	data = append(data, EncodeByteArray(txnData.DepositHash)...)
+	data = append(data, EncodeByteArray(txnData.AssetID)...)
+	data = append(data, VariableEncodeUint256(txnData.Amount)...)
+	return data
+}
+
+//
+// TYPES: BridgeEventAnchorEntry
+//
+
+type BridgeEventAnchorEntry struct {
+	// The ChainID and the DepositHash together are the primary key for a BridgeEventAnchorEntry.
+	ChainID     uint64
+	DepositHash []byte
+	AssetID     []byte
+	Amount      *uint256.Int
+	// The operators who attested the event, in the order of the attestations of the txn.
+	AttestingOperatorPublicKeys [][]byte
+	// The txn that anchored the event and the height of its block.
+	AnchorTxnHash     *BlockHash
+	AnchorBlockHeight uint64
+	isDeleted         bool
+}
+
+type BridgeEventAnchorKey struct {
+	ChainID     uint64
+	DepositHash string
+}
+
+func (entry *BridgeEventAnchorEntry) Copy() *BridgeEventAnchorEntry {
+	attestingOperatorPublicKeys := make([][]byte, 0, len(entry.AttestingOperatorPublicKeys))
+	for _, publicKey := range entry.AttestingOperatorPublicKeys {
+		attestingOperatorPublicKeys = append(attestingOperatorPublicKeys, append([]byte{}, publicKey...))
+	}
+	return &BridgeEventAnchorEntry{
+		ChainID:                     entry.ChainID,
+		DepositHash:                 append([]byte{}, entry.DepositHash...),
+		AssetID:                     append([]byte{}, entry.AssetID...),
+		Amount:                      entry.Amount.Clone(),
+		AttestingOperatorPublicKeys: attestingOperatorPublicKeys,
+		AnchorTxnHash:               entry.AnchorTxnHash.NewBlockHash(),
+		AnchorBlockHeight:           entry.AnchorBlockHeight,
+		isDeleted:                   entry.isDeleted,
+	}
+}
+
+func (entry *BridgeEventAnchorEntry) ToMapKey() BridgeEventAnchorKey {
+	return BridgeEventAnchorKey{
+		ChainID:     entry.ChainID,
+		DepositHash: string(entry.DepositHash),
+	}
+}
+
+func (entry *BridgeEventAnchorEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(entry.ChainID)...)
+	data = append(data, EncodeByteArray(entry.DepositHash)...)
+	data = append(data, EncodeByteArray(entry.AssetID)...)
+	data = append(data, VariableEncodeUint256(entry.Amount)...)
+	data = append(data, UintToBuf(uint64(len(entry.AttestingOperatorPublicKeys)))...)
+	for _, publicKey := range entry.AttestingOperatorPublicKeys {
+		data = append(data, EncodeByteArray(publicKey)...)
+	}
+	data = append(data, EncodeToBytes(blockHeight, entry.AnchorTxnHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.AnchorBlockHeight)...)
+	return data
+}
+
+func (entry *BridgeEventAnchorEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// ChainID
+	if entry.ChainID, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading ChainID: ")
+	}
+
+	// DepositHash
+	if entry.DepositHash, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading DepositHash: ")
+	}
+
+	// AssetID
+	if entry.AssetID, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading AssetID: ")
+	}
+
+	// Amount
+	if entry.Amount, err = VariableDecodeUint256(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading Amount: ")
+	}
+
+	// AttestingOperatorPublicKeys
+	numPublicKeys, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading len(AttestingOperatorPublicKeys): ")
+	}
+	entry.AttestingOperatorPublicKeys, err = SafeMakeSliceWithLength[[]byte](numPublicKeys)
+	if err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem creating AttestingOperatorPublicKeys slice: ")
+	}
+	for ii := range entry.AttestingOperatorPublicKeys {
+		if entry.AttestingOperatorPublicKeys[ii], err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading AttestingOperatorPublicKey: ")
+		}
+	}
+
+	// AnchorTxnHash
+	if entry.AnchorTxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading AnchorTxnHash: ")
+	}
+
+	// AnchorBlockHeight
+	if entry.AnchorBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BridgeEventAnchorEntry.Decode: Problem reading AnchorBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (entry *BridgeEventAnchorEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *BridgeEventAnchorEntry) GetEncoderType() EncoderType {
+	return EncoderTypeBridgeEventAnchorEntry
+}
+
+func (entry *BridgeEventAnchorEntry) IsDeleted() bool {
+	return entry.isDeleted
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForBridgeEventAnchor(chainID uint64, depositHash []byte) []byte {
+	key := DBPrefixKeyForBridgeEventAnchorsByChainID(chainID)
+	key = append(key, depositHash...)
+	return key
+}
+
+func DBPrefixKeyForBridgeEventAnchorsByChainID(chainID uint64) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixBridgeEventAnchorByChainIDAndDepositHash...)
+	return append(prefixCopy, EncodeUint64(chainID)...)
+}
+
+func DBGetBridgeEventAnchorEntry(
+	handle *badger.DB, snap *Snapshot, chainID uint64, depositHash []byte,
+) (*BridgeEventAnchorEntry, error) {
+	var ret *BridgeEventAnchorEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetBridgeEventAnchorEntryWithTxn(txn, snap, chainID, depositHash)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetBridgeEventAnchorEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, chainID uint64, depositHash []byte,
+) (*BridgeEventAnchorEntry, error) {
+	// Retrieve BridgeEventAnchorEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForBridgeEventAnchor(chainID, depositHash))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetBridgeEventAnchorEntryWithTxn: problem retrieving BridgeEventAnchorEntry")
+	}
+
+	// Decode BridgeEventAnchorEntry from bytes.
+	entry := &BridgeEventAnchorEntry{}
+	rr := bytes.NewReader(entryBytes)
+	if exist, err := DecodeFromBytes(entry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetBridgeEventAnchorEntryWithTxn: problem decoding BridgeEventAnchorEntry")
+	}
+	return entry, nil
+}
+
+func DBGetBridgeEventAnchorEntriesForChain(handle *badger.DB, chainID uint64) ([]*BridgeEventAnchorEntry, error) {
+	var ret []*BridgeEventAnchorEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetBridgeEventAnchorEntriesForChainWithTxn(txn, chainID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetBridgeEventAnchorEntriesForChainWithTxn(txn *badger.Txn, chainID uint64) ([]*BridgeEventAnchorEntry, error) {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, DBPrefixKeyForBridgeEventAnchorsByChainID(chainID), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetBridgeEventAnchorEntriesForChainWithTxn: problem retrieving BridgeEventAnchorEntries")
+	}
+
+	var entries []*BridgeEventAnchorEntry
+	for _, entryBytes := range valsFound {
+		rr := bytes.NewReader(entryBytes)
+		entry, err := DecodeDeSoEncoder(&BridgeEventAnchorEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetBridgeEventAnchorEntriesForChainWithTxn: problem decoding BridgeEventAnchorEntry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutBridgeEventAnchorEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *BridgeEventAnchorEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutBridgeEventAnchorEntryWithTxn: called with nil BridgeEventAnchorEntry")
+		return nil
+	}
+
+	key := DBKeyForBridgeEventAnchor(entry.ChainID, entry.DepositHash)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutBridgeEventAnchorEntryWithTxn: problem storing BridgeEventAnchorEntry in index PrefixBridgeEventAnchorByChainIDAndDepositHash",
+		)
+	}
+	return nil
+}
+
+func DBDeleteBridgeEventAnchorEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *BridgeEventAnchorEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteBridgeEventAnchorEntryWithTxn: called with nil BridgeEventAnchorEntry")
+		return nil
+	}
+
+	key := DBKeyForBridgeEventAnchor(entry.ChainID, entry.DepositHash)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteBridgeEventAnchorEntryWithTxn: problem deleting BridgeEventAnchorEntry from index PrefixBridgeEventAnchorByChainIDAndDepositHash",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateBridgeEventAnchorTxn(
+	transactorPublicKey []byte,
+	metadata *BridgeEventAnchorMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the BridgeEventAnchor fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Validate txn metadata.
+	if err := ValidateBridgeEventAnchorMetadata(bc.params, metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateBridgeEventAnchorTxn: invalid txn metadata: ")
+	}
+
+	// We don't need to make any tweaks to the amount because it's basically
+	// a standard "pay per kilobyte" transaction.
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateBridgeEventAnchorTxn: problem adding inputs: ")
+	}
+
+	// Sanity-check that the spendAmount is zero.
+	if err = amountEqualsAdditionalOutputs(spendAmount, additionalOutputs); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateBridgeEventAnchorTxn: %v", err)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectBridgeEventAnchor(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.BridgeEventAnchorBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorBridgeEventAnchorBeforeBlockHeight, "_connectBridgeEventAnchor: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeBridgeEventAnchor {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectBridgeEventAnchor: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*BridgeEventAnchorMetadata)
+
+	// Only the bridge operators can anchor events.
+	if !bav.Params.BridgeOperatorPublicKeys[MakePkMapKey(txn.PublicKey)] {
+		return 0, 0, nil, errors.Wrapf(RuleErrorBridgeEventAnchorTransactorNotOperator,
+			"_connectBridgeEventAnchor: %v", PkToString(txn.PublicKey, bav.Params))
+	}
+
+	// Validate the event and the signatures of its attestations.
+	if err := ValidateBridgeEventAnchorMetadata(bav.Params, txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectBridgeEventAnchor: ")
+	}
+
+	// An event can only be anchored once.
+	prevEntry, err := bav.GetBridgeEventAnchorEntry(txMeta.ChainID, txMeta.DepositHash)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectBridgeEventAnchor: ")
+	}
+	if prevEntry != nil {
+		return 0, 0, nil, errors.Wrapf(RuleErrorBridgeEventAnchorEventAlreadyAnchored,
+			"_connectBridgeEventAnchor: chain %d, deposit hash %x", txMeta.ChainID, txMeta.DepositHash)
+	}
+
+	// Connect a basic transfer to get the total input and the
+	// total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectBridgeEventAnchor: ")
+	}
+	if verifySignatures {
+		// _connectBasicTransfer has already checked that the txn is signed
+		// by the top-level public key, which we take to be the operator's
+		// public key. The attestations were verified above.
+	}
+
+	attestingOperatorPublicKeys := make([][]byte, 0, len(txMeta.Attestations))
+	for _, attestation := range txMeta.Attestations {
+		attestingOperatorPublicKeys = append(attestingOperatorPublicKeys, append([]byte{}, attestation.OperatorPublicKey...))
+	}
+	bav._setBridgeEventAnchorEntryMappings(&BridgeEventAnchorEntry{
+		ChainID:                     txMeta.ChainID,
+		DepositHash:                 append([]byte{}, txMeta.DepositHash...),
+		AssetID:                     append([]byte{}, txMeta.AssetID...),
+		Amount:                      txMeta.Amount.Clone(),
+		AttestingOperatorPublicKeys: attestingOperatorPublicKeys,
+		AnchorTxnHash:               txHash.NewBlockHash(),
+		AnchorBlockHeight:           uint64(blockHeight),
+	})
+
+	// Add a UTXO operation
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type: OperationTypeBridgeEventAnchor,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectBridgeEventAnchor(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.BridgeEventAnchorBlockHeight {
+		return errors.Wrapf(RuleErrorBridgeEventAnchorBeforeBlockHeight, "_disconnectBridgeEventAnchor: ")
+	}
+
+	// Validate the last operation is a BridgeEventAnchor operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectBridgeEventAnchor: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	operationData := utxoOpsForTxn[operationIndex]
+	if operationData.Type != OperationTypeBridgeEventAnchor {
+		return fmt.Errorf(
+			"_disconnectBridgeEventAnchor: trying to revert %v but found %v",
+			OperationTypeBridgeEventAnchor,
+			operationData.Type,
+		)
+	}
+	txMeta := currentTxn.TxnMeta.(*BridgeEventAnchorMetadata)
+
+	// Delete the anchored event. Events can't be anchored twice, so there's nothing to restore.
+	currentEntry, err := bav.GetBridgeEventAnchorEntry(txMeta.ChainID, txMeta.DepositHash)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectBridgeEventAnchor: ")
+	}
+	if currentEntry == nil || !currentEntry.AnchorTxnHash.IsEqual(txHash) {
+		return fmt.Errorf("_disconnectBridgeEventAnchor: event for chain %d, deposit hash %x wasn't "+
+			"anchored by txn %v", txMeta.ChainID, txMeta.DepositHash, txHash)
+	}
+	bav._deleteBridgeEventAnchorEntryMappings(currentEntry)
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// ValidateBridgeEventAnchorMetadata checks the event of a BridgeEventAnchor txn against the limits in the
+// params and verifies that enough distinct bridge operators signed it. It doesn't depend on the state, so
+// it's shared by txn construction and connection.
+func ValidateBridgeEventAnchorMetadata(params *DeSoParams, metadata *BridgeEventAnchorMetadata) error {
+	if metadata.ChainID == 0 {
+		return RuleErrorBridgeEventAnchorInvalidChainID
+	}
+	if len(metadata.DepositHash) == 0 || uint64(len(metadata.DepositHash)) > params.MaxBridgeEventFieldLengthBytes {
+		return errors.Wrapf(RuleErrorBridgeEventAnchorInvalidDepositHash,
+			"ValidateBridgeEventAnchorMetadata: %d bytes", len(metadata.DepositHash))
+	}
+	if uint64(len(metadata.AssetID)) > params.MaxBridgeEventFieldLengthBytes {
+		return errors.Wrapf(RuleErrorBridgeEventAnchorAssetIDTooLong,
+			"ValidateBridgeEventAnchorMetadata: %d bytes > %d", len(metadata.AssetID), params.MaxBridgeEventFieldLengthBytes)
+	}
+	if metadata.Amount == nil || metadata.Amount.IsZero() {
+		return RuleErrorBridgeEventAnchorInvalidAmount
+	}
+
+	// An anchor needs at least one attestation even if the params don't require any.
+	minAttestations := params.BridgeEventAnchorMinAttestations
+	if minAttestations == 0 {
+		minAttestations = 1
+	}
+	if uint64(len(metadata.Attestations)) < minAttestations {
+		return errors.Wrapf(RuleErrorBridgeEventAnchorTooFewAttestations,
+			"ValidateBridgeEventAnchorMetadata: %d attestations < %d", len(metadata.Attestations), minAttestations)
+	}
+
+	// Each attestation has to come from a different operator and sign the payload of the event.
+	payload := metadata.GetAttestationPayload()
+	operatorsSeen := make(map[PkMapKey]bool, len(metadata.Attestations))
+	for _, attestation := range metadata.Attestations {
+		operatorPkMapKey := MakePkMapKey(attestation.OperatorPublicKey)
+		if !params.BridgeOperatorPublicKeys[operatorPkMapKey] {
+			return errors.Wrapf(RuleErrorBridgeEventAnchorAttestationNotOperator,
+				"ValidateBridgeEventAnchorMetadata: %v", PkToString(attestation.OperatorPublicKey, params))
+		}
+		if operatorsSeen[operatorPkMapKey] {
+			return errors.Wrapf(RuleErrorBridgeEventAnchorDuplicateAttestation,
+				"ValidateBridgeEventAnchorMetadata: %v", PkToString(attestation.OperatorPublicKey, params))
+		}
+		operatorsSeen[operatorPkMapKey] = true
+		if err := _verifyDeSoSignature(attestation.OperatorPublicKey, payload, attestation.Signature); err != nil {
+			return errors.Wrapf(RuleErrorBridgeEventAnchorInvalidAttestationSig,
+				"ValidateBridgeEventAnchorMetadata: %v: %v", PkToString(attestation.OperatorPublicKey, params), err)
+		}
+	}
+	return nil
+}
+
+func (bav *UtxoView) GetBridgeEventAnchorEntry(chainID uint64, depositHash []byte) (*BridgeEventAnchorEntry, error) {
+	// First check the UtxoView.
+	mapKey := BridgeEventAnchorKey{ChainID: chainID, DepositHash: string(depositHash)}
+	if entry, exists := bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// If no BridgeEventAnchorEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbEntry, err := DBGetBridgeEventAnchorEntry(bav.Handle, bav.Snapshot, chainID, depositHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetBridgeEventAnchorEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the BridgeEventAnchorEntry from the db in the UtxoView.
+		bav._setBridgeEventAnchorEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetBridgeEventAnchorEntriesForChain returns all of the events anchored for the external chain,
+// merging the events in the view with the events in the database.
+func (bav *UtxoView) GetBridgeEventAnchorEntriesForChain(chainID uint64) ([]*BridgeEventAnchorEntry, error) {
+	// Load the events from the database into the view. We don't overwrite the
+	// events in the view since they're more recent than the database.
+	dbEntries, err := DBGetBridgeEventAnchorEntriesForChain(bav.Handle, chainID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetBridgeEventAnchorEntriesForChain: ")
+	}
+	for _, entry := range dbEntries {
+		if _, exists := bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry[entry.ToMapKey()]; !exists {
+			bav._setBridgeEventAnchorEntryMappings(entry)
+		}
+	}
+
+	var entries []*BridgeEventAnchorEntry
+	for _, entry := range bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry {
+		if !entry.isDeleted && entry.ChainID == chainID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (bav *UtxoView) _setBridgeEventAnchorEntryMappings(entry *BridgeEventAnchorEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setBridgeEventAnchorEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteBridgeEventAnchorEntryMappings(entry *BridgeEventAnchorEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteBridgeEventAnchorEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setBridgeEventAnchorEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushBridgeEventAnchorEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, entryIter := range bav.BridgeEventAnchorKeyToBridgeEventAnchorEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(entry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushBridgeEventAnchorEntriesToDbWithTxn: BridgeEventAnchorEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(),
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if entry.isDeleted {
+			if err := DBDeleteBridgeEventAnchorEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushBridgeEventAnchorEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutBridgeEventAnchorEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushBridgeEventAnchorEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
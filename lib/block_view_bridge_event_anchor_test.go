@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	ecdsa2 "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridgeEventAnchor(t *testing.T) {
+	var err error
+
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	// m0, m1, and m2 are the bridge operators, and two of them have to attest each event.
+	params.BridgeOperatorPublicKeys = map[PkMapKey]bool{
+		MakePkMapKey(m0PkBytes): true,
+		MakePkMapKey(m1PkBytes): true,
+		MakePkMapKey(m2PkBytes): true,
+	}
+	params.BridgeEventAnchorMinAttestations = 2
+
+	setBridgeEventAnchorBlockHeight := func(blockHeight uint32) {
+		params.ForkHeights.BridgeEventAnchorBlockHeight = blockHeight
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}
+	defer setBridgeEventAnchorBlockHeight(params.ForkHeights.BridgeEventAnchorBlockHeight)
+	setBridgeEventAnchorBlockHeight(math.MaxUint32)
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       chain.blockTip().Height + 1,
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e6)
+
+	depositHash := bytes.Repeat([]byte{1}, 32)
+	event := func(attestors ...string) *BridgeEventAnchorMetadata {
+		metadata := &BridgeEventAnchorMetadata{
+			ChainID:     1,
+			DepositHash: depositHash,
+			AssetID:     bytes.Repeat([]byte{2}, 20),
+			Amount:      uint256.NewInt(0).Lsh(uint256.NewInt(1), 100),
+		}
+		for _, attestorPriv := range attestors {
+			metadata.Attestations = append(metadata.Attestations, _attestBridgeEvent(t, metadata, attestorPriv))
+		}
+		return metadata
+	}
+
+	{
+		// RuleErrorBridgeEventAnchorBeforeBlockHeight
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, event(m0Priv, m1Priv))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorBeforeBlockHeight)
+
+		setBridgeEventAnchorBlockHeight(uint32(1))
+	}
+	{
+		// RuleErrorBridgeEventAnchorTransactorNotOperator
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m3Pub, m3Priv, event(m0Priv, m1Priv))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorTransactorNotOperator)
+	}
+	{
+		// RuleErrorBridgeEventAnchorInvalidChainID
+		metadata := event()
+		metadata.ChainID = 0
+		metadata.Attestations = []*BridgeOperatorAttestation{
+			_attestBridgeEvent(t, metadata, m0Priv), _attestBridgeEvent(t, metadata, m1Priv)}
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorInvalidChainID)
+	}
+	{
+		// RuleErrorBridgeEventAnchorInvalidDepositHash
+		metadata := event()
+		metadata.DepositHash = bytes.Repeat([]byte{1}, int(params.MaxBridgeEventFieldLengthBytes)+1)
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorInvalidDepositHash)
+	}
+	{
+		// RuleErrorBridgeEventAnchorInvalidAmount
+		metadata := event()
+		metadata.Amount = uint256.NewInt(0)
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorInvalidAmount)
+	}
+	{
+		// RuleErrorBridgeEventAnchorTooFewAttestations
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, event(m0Priv))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorTooFewAttestations)
+	}
+	{
+		// RuleErrorBridgeEventAnchorAttestationNotOperator
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, event(m0Priv, m3Priv))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorAttestationNotOperator)
+	}
+	{
+		// RuleErrorBridgeEventAnchorDuplicateAttestation
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, event(m0Priv, m0Priv))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorDuplicateAttestation)
+	}
+	{
+		// RuleErrorBridgeEventAnchorInvalidAttestationSig: the amount changed after m1 signed it.
+		metadata := event(m0Priv, m1Priv)
+		metadata.Amount = uint256.NewInt(1)
+		metadata.Attestations[0] = _attestBridgeEvent(t, metadata, m0Priv)
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorInvalidAttestationSig)
+	}
+	{
+		// Happy path: m0 anchors the event attested by m1 and m2. The transactor doesn't have to attest.
+		metadata := event(m1Priv, m2Priv)
+		require.NoError(t, _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, metadata))
+
+		entry, err := DBGetBridgeEventAnchorEntry(db, chain.snapshot, 1, depositHash)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		require.Equal(t, metadata.AssetID, entry.AssetID)
+		require.Equal(t, metadata.Amount, entry.Amount)
+		require.Equal(t, [][]byte{m1PkBytes, m2PkBytes}, entry.AttestingOperatorPublicKeys)
+		require.Equal(t, testMeta.txns[len(testMeta.txns)-1].Hash(), entry.AnchorTxnHash)
+
+		entries, err := DBGetBridgeEventAnchorEntriesForChain(db, 1)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		entries, err = DBGetBridgeEventAnchorEntriesForChain(db, 2)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	}
+	{
+		// RuleErrorBridgeEventAnchorEventAlreadyAnchored
+		err = _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, event(m0Priv, m2Priv))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBridgeEventAnchorEventAlreadyAnchored)
+	}
+	{
+		// Happy path: the same deposit hash on another chain is another event.
+		metadata := event()
+		metadata.ChainID = 2
+		metadata.AssetID = nil
+		metadata.Attestations = []*BridgeOperatorAttestation{
+			_attestBridgeEvent(t, metadata, m0Priv), _attestBridgeEvent(t, metadata, m2Priv)}
+		require.NoError(t, _submitBridgeEventAnchorWithTestMeta(testMeta, m0Pub, m0Priv, metadata))
+		entries, err := DBGetBridgeEventAnchorEntriesForChain(db, 2)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	}
+
+	_executeAllTestRollbackAndFlush(testMeta)
+	for _, chainID := range []uint64{1, 2} {
+		entries, err := DBGetBridgeEventAnchorEntriesForChain(db, chainID)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	}
+}
+
+func TestBridgeEventAnchorMetadataEncoding(t *testing.T) {
+	metadata := &BridgeEventAnchorMetadata{
+		ChainID:     137,
+		DepositHash: []byte{1, 2, 3},
+		AssetID:     []byte{4, 5},
+		Amount:      uint256.NewInt(12345),
+		Attestations: []*BridgeOperatorAttestation{
+			{OperatorPublicKey: m0PkBytes, Signature: []byte{6, 7}},
+			{OperatorPublicKey: m1PkBytes, Signature: []byte{8}},
+		},
+	}
+	encodedBytes, err := metadata.ToBytes(false)
+	require.NoError(t, err)
+	decodedMetadata := &BridgeEventAnchorMetadata{}
+	require.NoError(t, decodedMetadata.FromBytes(encodedBytes))
+	require.Equal(t, metadata, decodedMetadata)
+}
+
+func _attestBridgeEvent(
+	t *testing.T, metadata *BridgeEventAnchorMetadata, operatorPrivBase58Check string) *BridgeOperatorAttestation {
+
+	operatorPrivBytes, _, err := Base58CheckDecode(operatorPrivBase58Check)
+	require.NoError(t, err)
+	operatorPrivKey, operatorPubKey := btcec.PrivKeyFromBytes(operatorPrivBytes)
+	payloadHash := Sha256DoubleHash(metadata.GetAttestationPayload())
+	return &BridgeOperatorAttestation{
+		OperatorPublicKey: operatorPubKey.SerializeCompressed(),
+		Signature:         ecdsa2.Sign(operatorPrivKey, payloadHash[:]).Serialize(),
+	}
+}
+
+func _submitBridgeEventAnchorWithTestMeta(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *BridgeEventAnchorMetadata,
+) error {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, _, _, err := testMeta.chain.CreateBridgeEventAnchorTxn(
+		transactorPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		nil,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	blockHeight := testMeta.chain.blockTip().Height + 1
+	utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	utxoOps, totalInput, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return err
+	}
+	require.Equal(testMeta.t, totalInputMake, totalInput)
+	require.Equal(testMeta.t, OperationTypeBridgeEventAnchor, utxoOps[len(utxoOps)-1].Type)
+	require.NoError(testMeta.t, utxoView.FlushToDb(uint64(blockHeight)))
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return nil
+}
@@ -0,0 +1,385 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Content Tombstones
+//
+// Posts and profiles are never removed from the state. Instead, a SubmitPost or UpdateProfile hides them by setting
+// IsHidden, and from then on they're left out of feeds and lookups. Caches and moderation tooling that read the
+// entries would only see them disappear, so a ContentTombstoneEntry is recorded whenever a post or profile is hidden,
+// holding the block height, the transaction that hid it, and whether it was hidden by its owner or by a
+// ParamUpdater. GetContentTombstonesSinceHeight returns the tombstones of the blocks after a height, which lets a
+// consumer that last synced at that height invalidate the entries that were hidden since.
+//
+// The tombstones are recorded when the hiding transaction is connected and deleted when it's disconnected. If the
+// entry is unhidden later, its tombstone is kept, and consumers should check the entry's current IsHidden. Like the
+// PKID swap history, the tombstones are derived from the blocks, so they aren't part of the state, a node only has
+// the tombstones of the blocks it connected itself, and they aren't recorded when running with Postgres.
+
+//
+// TYPES: ContentTombstoneEntry
+//
+
+type ContentTombstoneEntryType uint8
+
+const (
+	ContentTombstoneEntryTypePost    ContentTombstoneEntryType = 1
+	ContentTombstoneEntryTypeProfile ContentTombstoneEntryType = 2
+)
+
+func (entryType ContentTombstoneEntryType) String() string {
+	switch entryType {
+	case ContentTombstoneEntryTypePost:
+		return "post"
+	case ContentTombstoneEntryTypeProfile:
+		return "profile"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(entryType))
+	}
+}
+
+type ContentTombstoneReason uint8
+
+const (
+	// ContentTombstoneReasonHiddenByOwner means the entry was hidden by its owner, or by a key authorized to act
+	// on the owner's behalf.
+	ContentTombstoneReasonHiddenByOwner ContentTombstoneReason = 1
+	// ContentTombstoneReasonHiddenByParamUpdater means the entry was hidden by a ParamUpdater. Only profiles can be
+	// hidden this way.
+	ContentTombstoneReasonHiddenByParamUpdater ContentTombstoneReason = 2
+)
+
+func (reason ContentTombstoneReason) String() string {
+	switch reason {
+	case ContentTombstoneReasonHiddenByOwner:
+		return "hidden_by_owner"
+	case ContentTombstoneReasonHiddenByParamUpdater:
+		return "hidden_by_param_updater"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(reason))
+	}
+}
+
+// ContentTombstoneEntry records a transaction that hid a post or a profile.
+type ContentTombstoneEntry struct {
+	EntryType ContentTombstoneEntryType
+	// EntryKey is the post hash of a post, or the PKID of a profile.
+	EntryKey []byte
+	// OwnerPublicKey is the poster of a post, or the public key of a profile.
+	OwnerPublicKey *PublicKey
+	Reason         ContentTombstoneReason
+	BlockHeight    uint64
+	TxnHash        *BlockHash
+
+	isDeleted bool
+}
+
+// ContentTombstoneKey identifies a tombstone by the transaction that hid the entry. A transaction hides at most one
+// post or profile.
+type ContentTombstoneKey struct {
+	BlockHeight uint64
+	TxnHash     BlockHash
+}
+
+func (entry *ContentTombstoneEntry) Copy() *ContentTombstoneEntry {
+	return &ContentTombstoneEntry{
+		EntryType:      entry.EntryType,
+		EntryKey:       append([]byte{}, entry.EntryKey...),
+		OwnerPublicKey: NewPublicKey(entry.OwnerPublicKey.ToBytes()),
+		Reason:         entry.Reason,
+		BlockHeight:    entry.BlockHeight,
+		TxnHash:        entry.TxnHash.NewBlockHash(),
+		isDeleted:      entry.isDeleted,
+	}
+}
+
+func (entry *ContentTombstoneEntry) ToMapKey() ContentTombstoneKey {
+	return ContentTombstoneKey{
+		BlockHeight: entry.BlockHeight,
+		TxnHash:     *entry.TxnHash,
+	}
+}
+
+// isBefore returns true if the entry's transaction sorts before the other entry's transaction.
+func (entry *ContentTombstoneEntry) isBefore(other *ContentTombstoneEntry) bool {
+	if entry.BlockHeight != other.BlockHeight {
+		return entry.BlockHeight < other.BlockHeight
+	}
+	return bytes.Compare(entry.TxnHash[:], other.TxnHash[:]) < 0
+}
+
+func (entry *ContentTombstoneEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, byte(entry.EntryType))
+	data = append(data, EncodeByteArray(entry.EntryKey)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.OwnerPublicKey, skipMetadata...)...)
+	data = append(data, byte(entry.Reason))
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.TxnHash, skipMetadata...)...)
+	return data
+}
+
+func (entry *ContentTombstoneEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// EntryType
+	entryType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "ContentTombstoneEntry.Decode: Problem reading EntryType: ")
+	}
+	entry.EntryType = ContentTombstoneEntryType(entryType)
+
+	// EntryKey
+	entry.EntryKey, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ContentTombstoneEntry.Decode: Problem reading EntryKey: ")
+	}
+
+	// OwnerPublicKey
+	entry.OwnerPublicKey, err = DecodeDeSoEncoder(&PublicKey{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ContentTombstoneEntry.Decode: Problem reading OwnerPublicKey: ")
+	}
+
+	// Reason
+	reason, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "ContentTombstoneEntry.Decode: Problem reading Reason: ")
+	}
+	entry.Reason = ContentTombstoneReason(reason)
+
+	// BlockHeight
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ContentTombstoneEntry.Decode: Problem reading BlockHeight: ")
+	}
+
+	// TxnHash
+	entry.TxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ContentTombstoneEntry.Decode: Problem reading TxnHash: ")
+	}
+
+	return nil
+}
+
+func (entry *ContentTombstoneEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *ContentTombstoneEntry) GetEncoderType() EncoderType {
+	return EncoderTypeContentTombstoneEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForContentTombstone(entry *ContentTombstoneEntry) []byte {
+	data := DBPrefixKeyForContentTombstonesAtHeight(entry.BlockHeight)
+	data = append(data, entry.TxnHash.ToBytes()...)
+	return data
+}
+
+func DBPrefixKeyForContentTombstonesAtHeight(blockHeight uint64) []byte {
+	data := append([]byte{}, Prefixes.PrefixContentTombstoneByHeightTxnHash...)
+	data = append(data, EncodeUint64(blockHeight)...)
+	return data
+}
+
+// DBGetContentTombstonesSinceHeight returns the tombstones recorded for the blocks after startHeight, ordered by
+// block height and then by transaction hash.
+func DBGetContentTombstonesSinceHeight(handle *badger.DB, startHeight uint64) ([]*ContentTombstoneEntry, error) {
+	var entries []*ContentTombstoneEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = append([]byte{}, Prefixes.PrefixContentTombstoneByHeightTxnHash...)
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(DBPrefixKeyForContentTombstonesAtHeight(startHeight + 1)); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := DecodeDeSoEncoder(&ContentTombstoneEntry{}, bytes.NewReader(entryBytes))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetContentTombstonesSinceHeight: problem retrieving tombstones: ")
+	}
+	return entries, nil
+}
+
+func DBPutContentTombstoneWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ContentTombstoneEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutContentTombstoneWithTxn: called with nil entry")
+		return nil
+	}
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForContentTombstone(entry), EncodeToBytes(blockHeight, entry), eventManager,
+	); err != nil {
+		return errors.Wrapf(err, "DBPutContentTombstoneWithTxn: problem storing tombstone: ")
+	}
+	return nil
+}
+
+func DBDeleteContentTombstoneWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ContentTombstoneEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	if err := DBDeleteWithTxn(txn, snap, DBKeyForContentTombstone(entry), eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteContentTombstoneWithTxn: problem deleting tombstone: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setContentTombstoneMappings(entry *ContentTombstoneEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setContentTombstoneMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ContentTombstoneKeyToContentTombstoneEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteContentTombstoneMappings(entry *ContentTombstoneEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteContentTombstoneMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry for the content tombstone.
+	deletedEntry := entry.Copy()
+	deletedEntry.isDeleted = true
+	bav._setContentTombstoneMappings(deletedEntry)
+}
+
+// _getPostContentTombstoneEntry returns the tombstone for a post hidden by the txn. Only the poster can hide a post.
+func _getPostContentTombstoneEntry(
+	postEntry *PostEntry,
+	blockHeight uint64,
+	txnHash *BlockHash,
+) *ContentTombstoneEntry {
+	return &ContentTombstoneEntry{
+		EntryType:      ContentTombstoneEntryTypePost,
+		EntryKey:       postEntry.PostHash.ToBytes(),
+		OwnerPublicKey: NewPublicKey(postEntry.PosterPublicKey),
+		Reason:         ContentTombstoneReasonHiddenByOwner,
+		BlockHeight:    blockHeight,
+		TxnHash:        txnHash.NewBlockHash(),
+	}
+}
+
+// _getProfileContentTombstoneEntry returns the tombstone for a profile hidden by the txn, which was submitted by
+// transactorPublicKey.
+func _getProfileContentTombstoneEntry(
+	profilePKID *PKID,
+	profileEntry *ProfileEntry,
+	transactorPublicKey []byte,
+	blockHeight uint64,
+	txnHash *BlockHash,
+) *ContentTombstoneEntry {
+	reason := ContentTombstoneReasonHiddenByOwner
+	if !bytes.Equal(transactorPublicKey, profileEntry.PublicKey) {
+		reason = ContentTombstoneReasonHiddenByParamUpdater
+	}
+	return &ContentTombstoneEntry{
+		EntryType:      ContentTombstoneEntryTypeProfile,
+		EntryKey:       profilePKID.ToBytes(),
+		OwnerPublicKey: NewPublicKey(profileEntry.PublicKey),
+		Reason:         reason,
+		BlockHeight:    blockHeight,
+		TxnHash:        txnHash.NewBlockHash(),
+	}
+}
+
+// GetContentTombstonesSinceHeight returns the tombstones of the posts and profiles hidden in the blocks after
+// startHeight, ordered from oldest to newest. If limit is greater than zero, at most limit tombstones are returned,
+// and a consumer can page through the rest by passing the BlockHeight of the last one, minus one, as startHeight and
+// skipping the ones it has already seen. The result only reflects the blocks this node recorded tombstones for, see
+// the comment at the top of this file.
+func (bav *UtxoView) GetContentTombstonesSinceHeight(startHeight uint64, limit int) ([]*ContentTombstoneEntry, error) {
+	// Merge the tombstones in the db with the ones in the UtxoView, which are more up to date.
+	dbEntries, err := DBGetContentTombstonesSinceHeight(bav.Handle, startHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetContentTombstonesSinceHeight: ")
+	}
+	entries := make(map[ContentTombstoneKey]*ContentTombstoneEntry, len(dbEntries))
+	for _, entry := range dbEntries {
+		entries[entry.ToMapKey()] = entry
+	}
+	for mapKey, entry := range bav.ContentTombstoneKeyToContentTombstoneEntry {
+		if mapKey.BlockHeight > startHeight {
+			entries[mapKey] = entry
+		}
+	}
+
+	var tombstones []*ContentTombstoneEntry
+	for _, entry := range entries {
+		if !entry.isDeleted {
+			tombstones = append(tombstones, entry.Copy())
+		}
+	}
+	sort.Slice(tombstones, func(ii, jj int) bool {
+		return tombstones[ii].isBefore(tombstones[jj])
+	})
+	if limit > 0 && len(tombstones) > limit {
+		tombstones = tombstones[:limit]
+	}
+	return tombstones, nil
+}
+
+func (bav *UtxoView) _flushContentTombstoneEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, entry := range bav.ContentTombstoneKeyToContentTombstoneEntry {
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushContentTombstoneEntriesToDbWithTxn: entry key %v doesn't match MapKey %v",
+				entry.ToMapKey(), mapKey,
+			)
+		}
+
+		// Tombstones are only ever set once, so we only need to delete the ones whose transaction was disconnected.
+		if entry.isDeleted {
+			if err := DBDeleteContentTombstoneWithTxn(txn, bav.Snapshot, entry, bav.EventManager, true); err != nil {
+				return errors.Wrapf(err, "_flushContentTombstoneEntriesToDbWithTxn: ")
+			}
+			continue
+		}
+		if err := DBPutContentTombstoneWithTxn(txn, bav.Snapshot, entry, blockHeight, bav.EventManager); err != nil {
+			return errors.Wrapf(err, "_flushContentTombstoneEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentTombstones(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+
+	// Mine two blocks to give the sender some DeSo, and make the sender a param updater so it can update m0's
+	// profile.
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(senderPkBytes)] = true
+	defer func(prevForkHeight uint32) {
+		params.ForkHeights.ParamUpdaterProfileUpdateFixBlockHeight = prevForkHeight
+	}(params.ForkHeights.ParamUpdaterProfileUpdateFixBlockHeight)
+	params.ForkHeights.ParamUpdaterProfileUpdateFixBlockHeight = 0
+
+	mineTxn := func(txn *MsgDeSoTxn) *MsgDeSoBlock {
+		_signTxn(t, txn, senderPrivString)
+		_, err := mempool.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+		require.NoError(err)
+		block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+		require.Equal(2, len(block.Txns))
+		return block
+	}
+	submitPost := func(postHashToModify []byte, isHidden bool) *MsgDeSoBlock {
+		txn, _, _, _, err := chain.CreateSubmitPostTxn(senderPkBytes, postHashToModify, nil, []byte(`{"Body":"hello"}`),
+			nil, false, 1, nil, isHidden, 10, mempool, nil)
+		require.NoError(err)
+		return mineTxn(txn)
+	}
+	updateM0Profile := func(username string, isHidden bool) *MsgDeSoBlock {
+		txn, _, _, _, err := chain.CreateUpdateProfileTxn(senderPkBytes, m0PkBytes, username, "", "", 0, 20000, isHidden,
+			0, nil, 10, mempool, nil)
+		require.NoError(err)
+		return mineTxn(txn)
+	}
+
+	// Create a post and m0's profile, and then hide both. Hiding the post again doesn't add another tombstone.
+	postBlock := submitPost(nil, false)
+	postHash := postBlock.Txns[1].Hash()
+	updateM0Profile("m0", false)
+	hidePostBlock := submitPost(postHash[:], true)
+	hideProfileBlock := updateM0Profile("", true)
+	submitPost(postHash[:], true)
+	hidePostHeight := uint64(hidePostBlock.Header.Height)
+	hideProfileHeight := uint64(hideProfileBlock.Header.Height)
+
+	utxoView := NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	tombstones, err := utxoView.GetContentTombstonesSinceHeight(0, 0)
+	require.NoError(err)
+	require.Equal(2, len(tombstones))
+	require.Equal(&ContentTombstoneEntry{
+		EntryType:      ContentTombstoneEntryTypePost,
+		EntryKey:       postHash[:],
+		OwnerPublicKey: NewPublicKey(senderPkBytes),
+		Reason:         ContentTombstoneReasonHiddenByOwner,
+		BlockHeight:    hidePostHeight,
+		TxnHash:        hidePostBlock.Txns[1].Hash(),
+	}, tombstones[0])
+	require.Equal(&ContentTombstoneEntry{
+		EntryType:      ContentTombstoneEntryTypeProfile,
+		EntryKey:       utxoView.GetPKIDForPublicKey(m0PkBytes).PKID.ToBytes(),
+		OwnerPublicKey: NewPublicKey(m0PkBytes),
+		Reason:         ContentTombstoneReasonHiddenByParamUpdater,
+		BlockHeight:    hideProfileHeight,
+		TxnHash:        hideProfileBlock.Txns[1].Hash(),
+	}, tombstones[1])
+
+	// The tombstones can be enumerated from a height, and limited.
+	tombstones, err = utxoView.GetContentTombstonesSinceHeight(hidePostHeight, 0)
+	require.NoError(err)
+	require.Equal(1, len(tombstones))
+	require.Equal(ContentTombstoneEntryTypeProfile, tombstones[0].EntryType)
+	tombstones, err = utxoView.GetContentTombstonesSinceHeight(0, 1)
+	require.NoError(err)
+	require.Equal(1, len(tombstones))
+	require.Equal(ContentTombstoneEntryTypePost, tombstones[0].EntryType)
+	tombstones, err = utxoView.GetContentTombstonesSinceHeight(hideProfileHeight, 0)
+	require.NoError(err)
+	require.Empty(tombstones)
+
+	// Disconnecting the txn that hid the profile deletes its tombstone, both in the view and once it's flushed.
+	// The blocks after it have to be disconnected first.
+	disconnectBlock := func(block *MsgDeSoBlock) {
+		blockHash, err := block.Header.Hash()
+		require.NoError(err)
+		txHashes, err := ComputeTransactionHashes(block.Txns)
+		require.NoError(err)
+		utxoOps, err := GetUtxoOperationsForBlock(db, chain.snapshot, blockHash)
+		require.NoError(err)
+		require.NoError(utxoView.DisconnectBlock(block, txHashes, utxoOps, 0))
+	}
+	lastBlock, err := GetBlock(chain.BlockTip().Hash, db, chain.snapshot)
+	require.NoError(err)
+	disconnectBlock(lastBlock)
+	disconnectBlock(hideProfileBlock)
+	tombstones, err = utxoView.GetContentTombstonesSinceHeight(0, 0)
+	require.NoError(err)
+	require.Equal(1, len(tombstones))
+	require.Equal(ContentTombstoneEntryTypePost, tombstones[0].EntryType)
+	require.NoError(utxoView.FlushToDb(0))
+	utxoView = NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	tombstones, err = utxoView.GetContentTombstonesSinceHeight(0, 0)
+	require.NoError(err)
+	require.Equal(1, len(tombstones))
+	require.Equal(hidePostHeight, tombstones[0].BlockHeight)
+}
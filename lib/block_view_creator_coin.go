@@ -241,7 +241,10 @@ func (bav *UtxoView) _disconnectCreatorCoin(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*CreatorCoinMetadataa)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[CreatorCoinOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCreatorCoin: ")
+	}
 	operationIndex--
 
 	// We sometimes have some extra AddUtxo operations we need to remove
@@ -467,7 +470,10 @@ func (bav *UtxoView) _disconnectCreatorCoinTransfer(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*CreatorCoinTransferMetadataa)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[CreatorCoinTransferOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCreatorCoinTransfer: ")
+	}
 	operationIndex--
 
 	// Get the profile corresponding to the creator coin txn.
@@ -53,7 +53,10 @@ func (bav *UtxoView) _disconnectDAOCoin(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*DAOCoinMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[DAOCoinOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDAOCoin: ")
+	}
 
 	// Get the profile corresponding to the DAO coin txn.
 	existingProfileEntry := bav.GetProfileEntryForPublicKey(txMeta.ProfilePublicKey)
@@ -207,7 +210,10 @@ func (bav *UtxoView) _disconnectDAOCoinTransfer(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*DAOCoinTransferMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[DAOCoinTransferOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDAOCoinTransfer: ")
+	}
 
 	// Get the profile corresponding to the DAO coin transfer txn.
 	existingProfileEntry := bav.GetProfileEntryForPublicKey(txMeta.ProfilePublicKey)
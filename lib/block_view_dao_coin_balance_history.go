@@ -0,0 +1,373 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// DAO Coin Balance History
+//
+// Airdrops and governance votes are often based on the holders of a DAO coin at some past block height, rather
+// than on the current holders. To answer these queries without an external indexer, a DAOCoinBalanceChangeEntry
+// is recorded for every DAO coin balance that a block changes, holding the balance after the block. The balance
+// of a holder at height H is the balance of their last change at or before H, and GetDAOCoinHoldersAtHeight
+// returns all the holders with a non-zero balance at H.
+//
+// The changes are found by comparing the view's DAO coin balances before and after the block is connected, so
+// every kind of transaction that moves DAO coins is covered without hooking into each of them. When a block is
+// disconnected, the changes recorded for it are deleted. The changes are derived from the blocks, so they aren't
+// part of the state, and a node only has the changes of the blocks it connected itself. A node that hypersynced
+// has no changes for the blocks before its snapshot, and the changes aren't recorded when running with Postgres.
+
+//
+// TYPES: DAOCoinBalanceChangeEntry
+//
+
+// DAOCoinBalanceChangeEntry records a holder's DAO coin balance after a block that changed it.
+type DAOCoinBalanceChangeEntry struct {
+	CreatorPKID  *PKID
+	HODLerPKID   *PKID
+	BlockHeight  uint64
+	BalanceNanos *uint256.Int
+
+	isDeleted bool
+}
+
+type DAOCoinBalanceChangeKey struct {
+	CreatorPKID PKID
+	HODLerPKID  PKID
+	BlockHeight uint64
+}
+
+func (entry *DAOCoinBalanceChangeEntry) Copy() *DAOCoinBalanceChangeEntry {
+	return &DAOCoinBalanceChangeEntry{
+		CreatorPKID:  entry.CreatorPKID.NewPKID(),
+		HODLerPKID:   entry.HODLerPKID.NewPKID(),
+		BlockHeight:  entry.BlockHeight,
+		BalanceNanos: entry.BalanceNanos.Clone(),
+		isDeleted:    entry.isDeleted,
+	}
+}
+
+func (entry *DAOCoinBalanceChangeEntry) ToMapKey() DAOCoinBalanceChangeKey {
+	return DAOCoinBalanceChangeKey{
+		CreatorPKID: *entry.CreatorPKID,
+		HODLerPKID:  *entry.HODLerPKID,
+		BlockHeight: entry.BlockHeight,
+	}
+}
+
+func (entry *DAOCoinBalanceChangeEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.CreatorPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.HODLerPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, VariableEncodeUint256(entry.BalanceNanos)...)
+	return data
+}
+
+func (entry *DAOCoinBalanceChangeEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// CreatorPKID
+	entry.CreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinBalanceChangeEntry.Decode: Problem reading CreatorPKID: ")
+	}
+
+	// HODLerPKID
+	entry.HODLerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinBalanceChangeEntry.Decode: Problem reading HODLerPKID: ")
+	}
+
+	// BlockHeight
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinBalanceChangeEntry.Decode: Problem reading BlockHeight: ")
+	}
+
+	// BalanceNanos
+	entry.BalanceNanos, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DAOCoinBalanceChangeEntry.Decode: Problem reading BalanceNanos: ")
+	}
+
+	return nil
+}
+
+func (entry *DAOCoinBalanceChangeEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DAOCoinBalanceChangeEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDAOCoinBalanceChangeEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForDAOCoinBalanceChange(entry *DAOCoinBalanceChangeEntry) []byte {
+	data := DBPrefixKeyForDAOCoinBalanceChangesByCreator(entry.CreatorPKID)
+	data = append(data, entry.HODLerPKID.ToBytes()...)
+	data = append(data, EncodeUint64(entry.BlockHeight)...)
+	return data
+}
+
+func DBPrefixKeyForDAOCoinBalanceChangesByCreator(creatorPKID *PKID) []byte {
+	data := append([]byte{}, Prefixes.PrefixDAOCoinBalanceChangeByCreatorHODLerHeight...)
+	data = append(data, creatorPKID.ToBytes()...)
+	return data
+}
+
+// DBGetDAOCoinBalanceChangesForCreator returns all the balance changes recorded for the creator's DAO coin,
+// ordered by holder and then by block height.
+func DBGetDAOCoinBalanceChangesForCreator(handle *badger.DB, creatorPKID *PKID) ([]*DAOCoinBalanceChangeEntry, error) {
+	var entries []*DAOCoinBalanceChangeEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = DBPrefixKeyForDAOCoinBalanceChangesByCreator(creatorPKID)
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(opts.Prefix); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := DecodeDeSoEncoder(&DAOCoinBalanceChangeEntry{}, bytes.NewReader(entryBytes))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDAOCoinBalanceChangesForCreator: problem retrieving balance changes: ")
+	}
+	return entries, nil
+}
+
+func DBPutDAOCoinBalanceChangeWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinBalanceChangeEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutDAOCoinBalanceChangeWithTxn: called with nil entry")
+		return nil
+	}
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForDAOCoinBalanceChange(entry), EncodeToBytes(blockHeight, entry), eventManager,
+	); err != nil {
+		return errors.Wrapf(err, "DBPutDAOCoinBalanceChangeWithTxn: problem storing balance change: ")
+	}
+	return nil
+}
+
+func DBDeleteDAOCoinBalanceChangeWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DAOCoinBalanceChangeEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	if err := DBDeleteWithTxn(
+		txn, snap, DBKeyForDAOCoinBalanceChange(entry), eventManager, entryIsDeleted,
+	); err != nil {
+		return errors.Wrapf(err, "DBDeleteDAOCoinBalanceChangeWithTxn: problem deleting balance change: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setDAOCoinBalanceChangeMappings(entry *DAOCoinBalanceChangeEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setDAOCoinBalanceChangeMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteDAOCoinBalanceChangeMappings(entry *DAOCoinBalanceChangeEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteDAOCoinBalanceChangeMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := entry.Copy()
+	tombstoneEntry.isDeleted = true
+	bav._setDAOCoinBalanceChangeMappings(tombstoneEntry)
+}
+
+// _getDAOCoinBalancesInView returns the DAO coin balances currently in the view. It is called before a block is
+// connected or disconnected, so that _getDAOCoinBalanceChanges can tell which balances the block changed.
+func (bav *UtxoView) _getDAOCoinBalancesInView() map[BalanceEntryMapKey]uint256.Int {
+	if bav.Postgres != nil {
+		return nil
+	}
+	balances := make(map[BalanceEntryMapKey]uint256.Int, len(bav.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry))
+	for mapKey, balanceEntry := range bav.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry {
+		if balanceEntry == nil || balanceEntry.isDeleted {
+			balances[mapKey] = *uint256.NewInt(0)
+			continue
+		}
+		balances[mapKey] = balanceEntry.BalanceNanos
+	}
+	return balances
+}
+
+// _getDAOCoinBalanceChanges returns a DAOCoinBalanceChangeEntry at blockHeight for each DAO coin balance in the
+// view that differs from prevBalances. The balances that weren't in the view before are compared to the db,
+// since the view loaded them from the db.
+func (bav *UtxoView) _getDAOCoinBalanceChanges(
+	prevBalances map[BalanceEntryMapKey]uint256.Int,
+	blockHeight uint64,
+) []*DAOCoinBalanceChangeEntry {
+	if bav.Postgres != nil {
+		return nil
+	}
+	var entries []*DAOCoinBalanceChangeEntry
+	for mapKey, balanceEntry := range bav.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry {
+		if balanceEntry == nil {
+			continue
+		}
+		balanceNanos := uint256.NewInt(0)
+		if !balanceEntry.isDeleted {
+			balanceNanos = balanceEntry.BalanceNanos.Clone()
+		}
+		prevBalanceNanos, exists := prevBalances[mapKey]
+		if !exists {
+			prevBalanceNanos = DbGetBalanceEntry(
+				bav.Handle, bav.Snapshot, &mapKey.HODLerPKID, &mapKey.CreatorPKID, true).BalanceNanos
+		}
+		if balanceNanos.Eq(&prevBalanceNanos) {
+			continue
+		}
+		entries = append(entries, &DAOCoinBalanceChangeEntry{
+			CreatorPKID:  mapKey.CreatorPKID.NewPKID(),
+			HODLerPKID:   mapKey.HODLerPKID.NewPKID(),
+			BlockHeight:  blockHeight,
+			BalanceNanos: balanceNanos,
+		})
+	}
+	return entries
+}
+
+// _setDAOCoinBalanceChangesForBlock records the DAO coin balances changed by the block at blockHeight. It is
+// called after the block is connected.
+func (bav *UtxoView) _setDAOCoinBalanceChangesForBlock(
+	prevBalances map[BalanceEntryMapKey]uint256.Int,
+	blockHeight uint64,
+) {
+	for _, entry := range bav._getDAOCoinBalanceChanges(prevBalances, blockHeight) {
+		bav._setDAOCoinBalanceChangeMappings(entry)
+	}
+}
+
+// _deleteDAOCoinBalanceChangesForBlock deletes the DAO coin balance changes recorded for the block at
+// blockHeight. It is called after the block is disconnected, which reverts the same balances the block changed.
+func (bav *UtxoView) _deleteDAOCoinBalanceChangesForBlock(
+	prevBalances map[BalanceEntryMapKey]uint256.Int,
+	blockHeight uint64,
+) {
+	for _, entry := range bav._getDAOCoinBalanceChanges(prevBalances, blockHeight) {
+		bav._deleteDAOCoinBalanceChangeMappings(entry)
+	}
+}
+
+// GetDAOCoinHoldersAtHeight returns the holders of the creator's DAO coin with a non-zero balance after the block
+// at blockHeight was connected, ordered by HODLerPKID. The returned BalanceEntries only have their HODLerPKID,
+// CreatorPKID, and BalanceNanos set. The result only reflects the blocks this node recorded balance changes for,
+// see the comment at the top of this file.
+func (bav *UtxoView) GetDAOCoinHoldersAtHeight(creatorPKID *PKID, blockHeight uint64) ([]*BalanceEntry, error) {
+	if creatorPKID == nil {
+		return nil, errors.New("GetDAOCoinHoldersAtHeight: called with nil CreatorPKID")
+	}
+
+	// Merge the balance changes in the db with the ones in the UtxoView, which are more up to date.
+	dbEntries, err := DBGetDAOCoinBalanceChangesForCreator(bav.Handle, creatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinHoldersAtHeight: ")
+	}
+	entries := make(map[DAOCoinBalanceChangeKey]*DAOCoinBalanceChangeEntry, len(dbEntries))
+	for _, entry := range dbEntries {
+		entries[entry.ToMapKey()] = entry
+	}
+	for mapKey, entry := range bav.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry {
+		if mapKey.CreatorPKID.Eq(creatorPKID) {
+			entries[mapKey] = entry
+		}
+	}
+
+	// The balance of each holder at blockHeight is the balance of their last change at or before blockHeight.
+	latestEntries := make(map[PKID]*DAOCoinBalanceChangeEntry)
+	for _, entry := range entries {
+		if entry.isDeleted || entry.BlockHeight > blockHeight {
+			continue
+		}
+		if latestEntry, exists := latestEntries[*entry.HODLerPKID]; !exists || entry.BlockHeight > latestEntry.BlockHeight {
+			latestEntries[*entry.HODLerPKID] = entry
+		}
+	}
+
+	var holders []*BalanceEntry
+	for _, entry := range latestEntries {
+		if entry.BalanceNanos.IsZero() {
+			continue
+		}
+		holders = append(holders, &BalanceEntry{
+			HODLerPKID:   entry.HODLerPKID.NewPKID(),
+			CreatorPKID:  entry.CreatorPKID.NewPKID(),
+			BalanceNanos: *entry.BalanceNanos.Clone(),
+		})
+	}
+	sort.Slice(holders, func(ii, jj int) bool {
+		return bytes.Compare(holders[ii].HODLerPKID.ToBytes(), holders[jj].HODLerPKID.ToBytes()) < 0
+	})
+	return holders, nil
+}
+
+func (bav *UtxoView) _flushDAOCoinBalanceChangeEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, entry := range bav.DAOCoinBalanceChangeKeyToDAOCoinBalanceChangeEntry {
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushDAOCoinBalanceChangeEntriesToDbWithTxn: entry key %v doesn't match MapKey %v",
+				entry.ToMapKey(), mapKey,
+			)
+		}
+
+		// Changes are only ever set once per block, so we only need to delete the ones that were tombstoned
+		// when their block was disconnected.
+		if entry.isDeleted {
+			if err := DBDeleteDAOCoinBalanceChangeWithTxn(txn, bav.Snapshot, entry, bav.EventManager, true); err != nil {
+				return errors.Wrapf(err, "_flushDAOCoinBalanceChangeEntriesToDbWithTxn: ")
+			}
+			continue
+		}
+		if err := DBPutDAOCoinBalanceChangeWithTxn(txn, bav.Snapshot, entry, blockHeight, bav.EventManager); err != nil {
+			return errors.Wrapf(err, "_flushDAOCoinBalanceChangeEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinHoldersAtHeight(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+
+	// Mine two blocks to give the sender some DeSo.
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	recipientPkBytes, _, err := Base58CheckDecode(recipientPkString)
+	require.NoError(err)
+
+	// mineTxn mines a block with the sender's transaction, and returns the block.
+	mineTxn := func(txn *MsgDeSoTxn) *MsgDeSoBlock {
+		_signTxn(t, txn, senderPrivString)
+		_, err := mempool.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+		require.NoError(err)
+		block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+		require.Equal(2, len(block.Txns))
+		return block
+	}
+	transferDAOCoins := func(amountNanos uint64) *MsgDeSoBlock {
+		txn, _, _, _, err := chain.CreateDAOCoinTransferTxn(senderPkBytes, &DAOCoinTransferMetadata{
+			ProfilePublicKey:       senderPkBytes,
+			DAOCoinToTransferNanos: *uint256.NewInt(amountNanos),
+			ReceiverPublicKey:      recipientPkBytes,
+		}, 10, mempool, nil)
+		require.NoError(err)
+		return mineTxn(txn)
+	}
+
+	// The sender creates a profile, mints 1000 DAO coins, and then transfers them to the recipient in two blocks.
+	txn, _, _, _, err := chain.CreateUpdateProfileTxn(senderPkBytes, nil, "sender", "", "",
+		1000, 12500, false, 0, nil, 10, mempool, nil)
+	require.NoError(err)
+	mineTxn(txn)
+	txn, _, _, _, err = chain.CreateDAOCoinTxn(senderPkBytes, &DAOCoinMetadata{
+		ProfilePublicKey: senderPkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt(1000),
+	}, 10, mempool, nil)
+	require.NoError(err)
+	mintBlock := mineTxn(txn)
+	firstTransferBlock := transferDAOCoins(300)
+	secondTransferBlock := transferDAOCoins(700)
+
+	senderPKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, senderPkBytes).PKID
+	recipientPKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, recipientPkBytes).PKID
+	requireHolders := func(utxoView *UtxoView, blockHeight uint64, expectedBalances map[PKID]uint64) {
+		holders, err := utxoView.GetDAOCoinHoldersAtHeight(senderPKID, blockHeight)
+		require.NoError(err)
+		require.Len(holders, len(expectedBalances))
+		for _, holder := range holders {
+			require.Equal(senderPKID, holder.CreatorPKID)
+			require.Equal(expectedBalances[*holder.HODLerPKID], holder.BalanceNanos.Uint64())
+		}
+	}
+
+	utxoView := NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	requireHolders(utxoView, mintBlock.Header.Height-1, map[PKID]uint64{})
+	requireHolders(utxoView, mintBlock.Header.Height, map[PKID]uint64{*senderPKID: 1000})
+	requireHolders(utxoView, firstTransferBlock.Header.Height, map[PKID]uint64{*senderPKID: 700, *recipientPKID: 300})
+	requireHolders(utxoView, secondTransferBlock.Header.Height, map[PKID]uint64{*recipientPKID: 1000})
+	requireHolders(utxoView, secondTransferBlock.Header.Height+10, map[PKID]uint64{*recipientPKID: 1000})
+
+	// The recipient doesn't have DAO coins of their own.
+	holders, err := utxoView.GetDAOCoinHoldersAtHeight(recipientPKID, secondTransferBlock.Header.Height)
+	require.NoError(err)
+	require.Empty(holders)
+
+	// Disconnecting the last block deletes its balance changes, both in the view and once it's flushed.
+	blockHash, err := secondTransferBlock.Header.Hash()
+	require.NoError(err)
+	txHashes, err := ComputeTransactionHashes(secondTransferBlock.Txns)
+	require.NoError(err)
+	utxoOps, err := GetUtxoOperationsForBlock(db, chain.snapshot, blockHash)
+	require.NoError(err)
+	require.NoError(utxoView.DisconnectBlock(secondTransferBlock, txHashes, utxoOps, 0))
+	requireHolders(utxoView, secondTransferBlock.Header.Height, map[PKID]uint64{*senderPKID: 700, *recipientPKID: 300})
+	require.NoError(utxoView.FlushToDb(0))
+	utxoView = NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	requireHolders(utxoView, secondTransferBlock.Header.Height, map[PKID]uint64{*senderPKID: 700, *recipientPKID: 300})
+	requireHolders(utxoView, mintBlock.Header.Height, map[PKID]uint64{*senderPKID: 1000})
+}
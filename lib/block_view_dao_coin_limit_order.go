@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math"
 	"math/big"
-	"sort"
 	"strings"
 
 	"github.com/davecgh/go-spew/spew"
@@ -1003,6 +1002,9 @@ func (bav *UtxoView) _connectDAOCoinLimitOrder(
 // GetNextLimitOrdersToFill retrieves the next set of candidate DAOCoinLimitOrderEntries
 // to fulfill the quantity specified by the transactorOrder. If lastSeenOrder is specified
 // we will exclude lastSeenOrder and all BETTER orders from the result set.
+//
+// Orders in the view are read from the view's price-level order book for the pair, so the
+// cost of a call grows with the number of orders returned rather than the depth of the book.
 func (bav *UtxoView) GetNextLimitOrdersToFill(
 	transactorOrder *DAOCoinLimitOrderEntry, lastSeenOrder *DAOCoinLimitOrderEntry, blockHeight uint32) (
 	[]*DAOCoinLimitOrderEntry, error) {
@@ -1012,11 +1014,9 @@ func (bav *UtxoView) GetNextLimitOrdersToFill(
 	// by block height.
 	orderEntriesInView := map[DAOCoinLimitOrderMapKey]bool{}
 	if blockHeight >= bav.Params.ForkHeights.OrderBookDBFetchOptimizationBlockHeight {
-		for _, orderEntry := range bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry {
-			if transactorOrder.BuyingDAOCoinCreatorPKID.Eq(orderEntry.SellingDAOCoinCreatorPKID) &&
-				transactorOrder.SellingDAOCoinCreatorPKID.Eq(orderEntry.BuyingDAOCoinCreatorPKID) {
-				orderEntriesInView[orderEntry.ToMapKey()] = true
-			}
+		if book := bav._getDAOCoinLimitOrderBook(
+			transactorOrder.SellingDAOCoinCreatorPKID, transactorOrder.BuyingDAOCoinCreatorPKID); book != nil {
+			orderEntriesInView = book.orderKeysInView
 		}
 	}
 
@@ -1033,42 +1033,35 @@ func (bav *UtxoView) GetNextLimitOrdersToFill(
 		}
 	}
 
-	// Aggregate all matching orders then sort.
-	sortedMatchingOrders := []*DAOCoinLimitOrderEntry{}
-
-	// Aggregate matching orders.
-	for _, matchingOrder := range bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry {
-		// This doesn't mean that the matching order is invalid and should be deleted.
-		// It just means that the matching order isn't actually a viable match.
-		err := bav.IsValidDAOCoinLimitOrderMatch(transactorOrder, matchingOrder)
-		if err != nil {
-			// If matching own order, fail immediately. Otherwise just skip this order.
-			if err == RuleErrorDAOCoinLimitOrderMatchingOwnOrder {
-				return nil, err
-			}
-
-			continue
-		}
+	book := bav._getDAOCoinLimitOrderBook(
+		transactorOrder.SellingDAOCoinCreatorPKID, transactorOrder.BuyingDAOCoinCreatorPKID)
+	if book == nil {
+		return []*DAOCoinLimitOrderEntry{}, nil
+	}
 
-		// We should have seen this order already.
-		if lastSeenOrder != nil && !lastSeenOrder.IsBetterMatchingOrderThan(matchingOrder) {
-			continue
+	// If the transactor has an order in the book that would otherwise have matched, fail
+	// immediately. This check covers all of the transactor's orders, including ones that are
+	// better than lastSeenOrder.
+	for _, matchingOrder := range book.ordersByTransactor[*transactorOrder.TransactorPKID] {
+		if matchErr := bav.IsValidDAOCoinLimitOrderMatch(transactorOrder, matchingOrder); matchErr == RuleErrorDAOCoinLimitOrderMatchingOwnOrder {
+			return nil, matchErr
 		}
-
-		sortedMatchingOrders = append(sortedMatchingOrders, matchingOrder)
 	}
 
-	// Sort matching orders by best matching.
-	// Sort logic first looks at price, then block height (FIFO), then quantity (lowest first).
-	sort.Slice(sortedMatchingOrders, func(ii, jj int) bool {
-		return sortedMatchingOrders[ii].IsBetterMatchingOrderThan(sortedMatchingOrders[jj])
-	})
-
-	// Pull orders up to when the quantity is filled or we run out of orders.
+	// Pull orders from best to worst matching until the quantity is filled or we run out of orders.
+	// Sort logic first looks at price, then block height (FIFO), then order ID.
 	outputMatchingOrders := []*DAOCoinLimitOrderEntry{}
 	transactorOrderQuantityToFill := transactorOrder.QuantityToFillInBaseUnits.Clone()
 
-	for _, matchingOrder := range sortedMatchingOrders {
+	book.forEachOrderFromBestToWorst(lastSeenOrder, func(matchingOrder *DAOCoinLimitOrderEntry) bool {
+		// This doesn't mean that the matching order is invalid and should be deleted.
+		// It just means that the matching order isn't actually a viable match.
+		if matchErr := bav.IsValidDAOCoinLimitOrderMatch(transactorOrder, matchingOrder); matchErr != nil {
+			// Orders are visited by descending exchange rate, so if this order's price
+			// doesn't work for the transactor then no subsequent order's price will.
+			return matchErr != RuleErrorDAOCoinLimitOrderInvalidExchangeRate
+		}
+
 		outputMatchingOrders = append(outputMatchingOrders, matchingOrder)
 
 		// Calculate transactor's updated quantity
@@ -1076,13 +1069,14 @@ func (bav *UtxoView) GetNextLimitOrdersToFill(
 		transactorOrderQuantityToFill, _, _, _, err = _calculateDAOCoinsTransferredInLimitOrderMatch(
 			matchingOrder, transactorOrder.OperationType, transactorOrderQuantityToFill)
 		if err != nil {
-			return nil, err
+			return false
 		}
 
 		// Break once the transactor's quantity to fill is zero.
-		if transactorOrderQuantityToFill.IsZero() {
-			break
-		}
+		return !transactorOrderQuantityToFill.IsZero()
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return outputMatchingOrders, nil
@@ -1103,7 +1097,10 @@ func (bav *UtxoView) _disconnectDAOCoinLimitOrder(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*DAOCoinLimitOrderMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[DAOCoinLimitOrderOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDAOCoinLimitOrder: ")
+	}
 	operationIndex--
 
 	transactorPKID := bav.GetPKIDForPublicKey(currentTxn.PublicKey).PKID
@@ -1207,6 +1204,7 @@ func (bav *UtxoView) _setDAOCoinLimitOrderEntryMappings(entry *DAOCoinLimitOrder
 		return
 	}
 
+	bav._indexDAOCoinLimitOrderEntry(entry)
 	bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[entry.ToMapKey()] = entry
 }
 
@@ -1525,7 +1523,7 @@ func (bav *UtxoView) _getAllDAOCoinLimitOrders() ([]*DAOCoinLimitOrderEntry, err
 		orderMapKey := orderEntry.ToMapKey()
 
 		if _, exists := bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[orderMapKey]; !exists {
-			bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[orderMapKey] = orderEntry
+			bav._setDAOCoinLimitOrderEntryMappings(orderEntry)
 		}
 	}
 
@@ -1566,7 +1564,7 @@ func (bav *UtxoView) GetAllDAOCoinLimitOrdersForThisDAOCoinPair(
 		orderMapKey := orderEntry.ToMapKey()
 
 		if _, exists := bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[orderMapKey]; !exists {
-			bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[orderMapKey] = orderEntry
+			bav._setDAOCoinLimitOrderEntryMappings(orderEntry)
 		}
 	}
 
@@ -1614,7 +1612,7 @@ func (bav *UtxoView) GetAllDAOCoinLimitOrdersForThisTransactor(
 		orderMapKey := orderEntry.ToMapKey()
 
 		if _, exists := bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[orderMapKey]; !exists {
-			bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[orderMapKey] = orderEntry
+			bav._setDAOCoinLimitOrderEntryMappings(orderEntry)
 		}
 	}
 
@@ -3515,6 +3515,26 @@ func TestDAOCoinLimitOrder(t *testing.T) {
 		orderEntries, err = dbAdapter.GetAllDAOCoinLimitOrdersForThisTransactor(m1PKID.PKID, nil, nil)
 		require.NoError(err)
 		require.Equal(len(orderEntries), 2)
+
+		// Validate m1 can open an order on the other side of the m3 DAO coin
+		// order book as long as it doesn't cross their own existing orders.
+		exchangeRate, err = CalculateScaledExchangeRate(0.1)
+		require.NoError(err)
+
+		metadataM1 = DAOCoinLimitOrderMetadata{
+			BuyingDAOCoinCreatorPublicKey:             NewPublicKey(m3PkBytes),
+			SellingDAOCoinCreatorPublicKey:            &ZeroPublicKey,
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: exchangeRate,
+			QuantityToFillInBaseUnits:                 uint256.NewInt(100),
+			OperationType:                             DAOCoinLimitOrderOperationTypeBID,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+		}
+
+		_doDAOCoinLimitOrderTxnWithTestMeta(testMeta, feeRateNanosPerKb, m1Pub, m1Priv, metadataM1)
+
+		orderEntries, err = dbAdapter.GetAllDAOCoinLimitOrdersForThisTransactor(m1PKID.PKID, nil, nil)
+		require.NoError(err)
+		require.Equal(len(orderEntries), 3)
 	}
 
 	_executeAllTestRollbackAndFlush(testMeta)
@@ -0,0 +1,734 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Delegated Posters: Lets an account, typically an organization, authorize other public keys to
+// submit posts attributed to it. The owner authorizes a delegate with a DelegatedPoster transaction,
+// which stores a DelegatedPosterEntry scoped by DelegatedPosterPermissions and, optionally, an
+// expiration height. The delegate then submits a SubmitPost transaction signed with its own key that
+// sets DelegatedPostOwnerPublicKeyKey in its extra data to the owner's public key, and the post is
+// created with the owner as its poster. Consensus records the delegate in the post's extra data under
+// DelegatedPostDelegatePublicKeyKey. The permissions only ever cover posts: a delegate can't update
+// the owner's profile or submit any other transaction on its behalf.
+//
+// Unlike a derived key, a delegate keeps its own identity and pays its own fees, and its authorization
+// is revoked on its own: either the owner or the delegate can revoke it with a DelegatedPoster
+// transaction, which deletes the entry without affecting the owner's derived keys or its other
+// delegates. Authorizing a delegate that's already authorized replaces its permissions and expiration.
+
+//
+// TYPES: DelegatedPosterMetadata
+//
+
+type DelegatedPosterOperationType uint8
+
+const (
+	DelegatedPosterOperationTypeUnknown   DelegatedPosterOperationType = 0
+	DelegatedPosterOperationTypeAuthorize DelegatedPosterOperationType = 1
+	DelegatedPosterOperationTypeRevoke    DelegatedPosterOperationType = 2
+)
+
+func (operationType DelegatedPosterOperationType) String() string {
+	switch operationType {
+	case DelegatedPosterOperationTypeAuthorize:
+		return "Authorize"
+	case DelegatedPosterOperationTypeRevoke:
+		return "Revoke"
+	default:
+		return "Unknown"
+	}
+}
+
+// DelegatedPosterPermissions is a bitmask of what a delegate may do on behalf of the owner.
+type DelegatedPosterPermissions uint64
+
+const (
+	// DelegatedPosterPermissionCreatePosts allows the delegate to create posts, comments, and
+	// reposts attributed to the owner.
+	DelegatedPosterPermissionCreatePosts DelegatedPosterPermissions = 1 << 0
+	// DelegatedPosterPermissionEditPosts allows the delegate to edit and hide the owner's posts,
+	// including the ones the owner submitted itself.
+	DelegatedPosterPermissionEditPosts DelegatedPosterPermissions = 1 << 1
+
+	DelegatedPosterPermissionsAll = DelegatedPosterPermissionCreatePosts | DelegatedPosterPermissionEditPosts
+)
+
+func (permissions DelegatedPosterPermissions) Has(permission DelegatedPosterPermissions) bool {
+	return permissions&permission == permission
+}
+
+type DelegatedPosterMetadata struct {
+	OperationType DelegatedPosterOperationType
+	// The account the posts are attributed to. The transactor must be the owner to authorize a
+	// delegate, and either the owner or the delegate to revoke it.
+	OwnerPublicKey    []byte
+	DelegatePublicKey []byte
+	// Permissions and ExpirationBlockHeight are only set when authorizing. The authorization
+	// doesn't expire if ExpirationBlockHeight is zero.
+	Permissions           DelegatedPosterPermissions
+	ExpirationBlockHeight uint64
+}
+
+func (txnData *DelegatedPosterMetadata) GetTxnType() TxnType {
+	return TxnTypeDelegatedPoster
+}
+
+func (txnData *DelegatedPosterMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, byte(txnData.OperationType))
+	data = append(data, EncodeByteArray(txnData.OwnerPublicKey)...)
+	data = append(data, EncodeByteArray(txnData.DelegatePublicKey)...)
+	data = append(data, UintToBuf(uint64(txnData.Permissions))...)
+	data = append(data, UintToBuf(txnData.ExpirationBlockHeight)...)
+	return data, nil
+}
+
+func (txnData *DelegatedPosterMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	// OperationType
+	operationType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "DelegatedPosterMetadata.FromBytes: Problem reading OperationType: ")
+	}
+	txnData.OperationType = DelegatedPosterOperationType(operationType)
+
+	// OwnerPublicKey
+	if txnData.OwnerPublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "DelegatedPosterMetadata.FromBytes: Problem reading OwnerPublicKey: ")
+	}
+
+	// DelegatePublicKey
+	if txnData.DelegatePublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "DelegatedPosterMetadata.FromBytes: Problem reading DelegatePublicKey: ")
+	}
+
+	// Permissions
+	permissions, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DelegatedPosterMetadata.FromBytes: Problem reading Permissions: ")
+	}
+	txnData.Permissions = DelegatedPosterPermissions(permissions)
+
+	// ExpirationBlockHeight
+	if txnData.ExpirationBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "DelegatedPosterMetadata.FromBytes: Problem reading ExpirationBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (txnData *DelegatedPosterMetadata) New() DeSoTxnMetadata {
+	return &DelegatedPosterMetadata{}
+}
+
+//
+// TYPES: DelegatedPosterEntry
+//
+
+type DelegatedPosterEntry struct {
+	// The OwnerPKID and the DelegatePKID together are the primary key for a DelegatedPosterEntry.
+	OwnerPKID    *PKID
+	DelegatePKID *PKID
+	Permissions  DelegatedPosterPermissions
+	// The delegate can't post on behalf of the owner at or after this height. Zero means the
+	// authorization doesn't expire.
+	ExpirationBlockHeight uint64
+	isDeleted             bool
+}
+
+type DelegatedPosterKey struct {
+	OwnerPKID    PKID
+	DelegatePKID PKID
+}
+
+func (entry *DelegatedPosterEntry) Copy() *DelegatedPosterEntry {
+	return &DelegatedPosterEntry{
+		OwnerPKID:             entry.OwnerPKID.NewPKID(),
+		DelegatePKID:          entry.DelegatePKID.NewPKID(),
+		Permissions:           entry.Permissions,
+		ExpirationBlockHeight: entry.ExpirationBlockHeight,
+		isDeleted:             entry.isDeleted,
+	}
+}
+
+func (entry *DelegatedPosterEntry) ToMapKey() DelegatedPosterKey {
+	return DelegatedPosterKey{
+		OwnerPKID:    *entry.OwnerPKID,
+		DelegatePKID: *entry.DelegatePKID,
+	}
+}
+
+// IsActiveAtBlockHeight returns true if the authorization hasn't expired at the block height.
+func (entry *DelegatedPosterEntry) IsActiveAtBlockHeight(blockHeight uint64) bool {
+	return entry.ExpirationBlockHeight == 0 || blockHeight < entry.ExpirationBlockHeight
+}
+
+func (entry *DelegatedPosterEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.OwnerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.DelegatePKID, skipMetadata...)...)
+	data = append(data, UintToBuf(uint64(entry.Permissions))...)
+	data = append(data, UintToBuf(entry.ExpirationBlockHeight)...)
+	return data
+}
+
+func (entry *DelegatedPosterEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// OwnerPKID
+	if entry.OwnerPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "DelegatedPosterEntry.Decode: Problem reading OwnerPKID: ")
+	}
+
+	// DelegatePKID
+	if entry.DelegatePKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "DelegatedPosterEntry.Decode: Problem reading DelegatePKID: ")
+	}
+
+	// Permissions
+	permissions, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "DelegatedPosterEntry.Decode: Problem reading Permissions: ")
+	}
+	entry.Permissions = DelegatedPosterPermissions(permissions)
+
+	// ExpirationBlockHeight
+	if entry.ExpirationBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "DelegatedPosterEntry.Decode: Problem reading ExpirationBlockHeight: ")
+	}
+
+	return nil
+}
+
+func (entry *DelegatedPosterEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *DelegatedPosterEntry) GetEncoderType() EncoderType {
+	return EncoderTypeDelegatedPosterEntry
+}
+
+func (entry *DelegatedPosterEntry) IsDeleted() bool {
+	return entry.isDeleted
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForDelegatedPoster(ownerPKID *PKID, delegatePKID *PKID) []byte {
+	key := DBPrefixKeyForDelegatedPostersByOwner(ownerPKID)
+	key = append(key, delegatePKID.ToBytes()...)
+	return key
+}
+
+func DBPrefixKeyForDelegatedPostersByOwner(ownerPKID *PKID) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixDelegatedPosterByOwnerPKIDDelegatePKID...)
+	return append(prefixCopy, ownerPKID.ToBytes()...)
+}
+
+func DBGetDelegatedPosterEntry(
+	handle *badger.DB, snap *Snapshot, ownerPKID *PKID, delegatePKID *PKID,
+) (*DelegatedPosterEntry, error) {
+	var ret *DelegatedPosterEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetDelegatedPosterEntryWithTxn(txn, snap, ownerPKID, delegatePKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetDelegatedPosterEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, ownerPKID *PKID, delegatePKID *PKID,
+) (*DelegatedPosterEntry, error) {
+	// Retrieve DelegatedPosterEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForDelegatedPoster(ownerPKID, delegatePKID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetDelegatedPosterEntryWithTxn: problem retrieving DelegatedPosterEntry")
+	}
+
+	// Decode DelegatedPosterEntry from bytes.
+	entry := &DelegatedPosterEntry{}
+	rr := bytes.NewReader(entryBytes)
+	if exist, err := DecodeFromBytes(entry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetDelegatedPosterEntryWithTxn: problem decoding DelegatedPosterEntry")
+	}
+	return entry, nil
+}
+
+func DBGetDelegatedPosterEntriesForOwner(handle *badger.DB, ownerPKID *PKID) ([]*DelegatedPosterEntry, error) {
+	var ret []*DelegatedPosterEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetDelegatedPosterEntriesForOwnerWithTxn(txn, ownerPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetDelegatedPosterEntriesForOwnerWithTxn(txn *badger.Txn, ownerPKID *PKID) ([]*DelegatedPosterEntry, error) {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, DBPrefixKeyForDelegatedPostersByOwner(ownerPKID), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetDelegatedPosterEntriesForOwnerWithTxn: problem retrieving DelegatedPosterEntries")
+	}
+
+	var entries []*DelegatedPosterEntry
+	for _, entryBytes := range valsFound {
+		rr := bytes.NewReader(entryBytes)
+		entry, err := DecodeDeSoEncoder(&DelegatedPosterEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetDelegatedPosterEntriesForOwnerWithTxn: problem decoding DelegatedPosterEntry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutDelegatedPosterEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DelegatedPosterEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutDelegatedPosterEntryWithTxn: called with nil DelegatedPosterEntry")
+		return nil
+	}
+
+	key := DBKeyForDelegatedPoster(entry.OwnerPKID, entry.DelegatePKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutDelegatedPosterEntryWithTxn: problem storing DelegatedPosterEntry in index PrefixDelegatedPosterByOwnerPKIDDelegatePKID",
+		)
+	}
+	return nil
+}
+
+func DBDeleteDelegatedPosterEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *DelegatedPosterEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteDelegatedPosterEntryWithTxn: called with nil DelegatedPosterEntry")
+		return nil
+	}
+
+	key := DBKeyForDelegatedPoster(entry.OwnerPKID, entry.DelegatePKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteDelegatedPosterEntryWithTxn: problem deleting DelegatedPosterEntry from index PrefixDelegatedPosterByOwnerPKIDDelegatePKID",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateDelegatedPosterTxn(
+	transactorPublicKey []byte,
+	metadata *DelegatedPosterMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the DelegatedPoster fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Validate txn metadata.
+	if err := ValidateDelegatedPosterMetadata(transactorPublicKey, metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateDelegatedPosterTxn: invalid txn metadata: ")
+	}
+
+	// We don't need to make any tweaks to the amount because it's basically
+	// a standard "pay per kilobyte" transaction.
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateDelegatedPosterTxn: problem adding inputs: ")
+	}
+
+	// Sanity-check that the spendAmount is zero.
+	if err = amountEqualsAdditionalOutputs(spendAmount, additionalOutputs); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateDelegatedPosterTxn: %v", err)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectDelegatedPoster(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height. The previous entry is stored in a field of the
+	// UtxoOperation that only the compact encoding includes.
+	if blockHeight < bav.Params.ForkHeights.DelegatedPosterBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.UtxoOperationCompactEncodingBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDelegatedPosterBeforeBlockHeight, "_connectDelegatedPoster: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeDelegatedPoster {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectDelegatedPoster: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*DelegatedPosterMetadata)
+
+	// Validate the metadata and that the transactor is allowed to perform the operation.
+	if err := ValidateDelegatedPosterMetadata(txn.PublicKey, txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDelegatedPoster: ")
+	}
+	if txMeta.OperationType == DelegatedPosterOperationTypeAuthorize &&
+		txMeta.ExpirationBlockHeight != 0 && txMeta.ExpirationBlockHeight <= uint64(blockHeight) {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDelegatedPosterInvalidExpirationBlockHeight,
+			"_connectDelegatedPoster: expiration %d <= block height %d", txMeta.ExpirationBlockHeight, blockHeight)
+	}
+
+	ownerPKID := bav.GetPKIDForPublicKey(txMeta.OwnerPublicKey).PKID
+	delegatePKID := bav.GetPKIDForPublicKey(txMeta.DelegatePublicKey).PKID
+	prevEntry, err := bav.GetDelegatedPosterEntry(ownerPKID, delegatePKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDelegatedPoster: ")
+	}
+	if txMeta.OperationType == DelegatedPosterOperationTypeRevoke && prevEntry == nil {
+		return 0, 0, nil, errors.Wrapf(RuleErrorDelegatedPosterRevokingNonexistentAuthorization,
+			"_connectDelegatedPoster: owner %v, delegate %v",
+			PkToString(txMeta.OwnerPublicKey, bav.Params), PkToString(txMeta.DelegatePublicKey, bav.Params))
+	}
+
+	// Connect a basic transfer to get the total input and the
+	// total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectDelegatedPoster: ")
+	}
+	if verifySignatures {
+		// _connectBasicTransfer has already checked that the txn is signed
+		// by the top-level public key, which we take to be the transactor's
+		// public key.
+	}
+
+	var prevEntryCopy *DelegatedPosterEntry
+	if prevEntry != nil {
+		prevEntryCopy = prevEntry.Copy()
+		bav._deleteDelegatedPosterEntryMappings(prevEntry)
+	}
+	if txMeta.OperationType == DelegatedPosterOperationTypeAuthorize {
+		bav._setDelegatedPosterEntryMappings(&DelegatedPosterEntry{
+			OwnerPKID:             ownerPKID.NewPKID(),
+			DelegatePKID:          delegatePKID.NewPKID(),
+			Permissions:           txMeta.Permissions,
+			ExpirationBlockHeight: txMeta.ExpirationBlockHeight,
+		})
+	}
+
+	// Add a UTXO operation
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                     OperationTypeDelegatedPoster,
+		PrevDelegatedPosterEntry: prevEntryCopy,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectDelegatedPoster(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.DelegatedPosterBlockHeight {
+		return errors.Wrapf(RuleErrorDelegatedPosterBeforeBlockHeight, "_disconnectDelegatedPoster: ")
+	}
+
+	// Validate the last operation is a DelegatedPoster operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectDelegatedPoster: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeDelegatedPoster {
+		return fmt.Errorf(
+			"_disconnectDelegatedPoster: trying to revert %v but found %v",
+			OperationTypeDelegatedPoster,
+			utxoOpsForTxn[operationIndex].Type,
+		)
+	}
+	operationData, err := GetUtxoOperationData[DelegatedPosterOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDelegatedPoster: ")
+	}
+	txMeta := currentTxn.TxnMeta.(*DelegatedPosterMetadata)
+
+	// Delete the authorization set by the txn, if any, and restore the one it replaced.
+	ownerPKID := bav.GetPKIDForPublicKey(txMeta.OwnerPublicKey).PKID
+	delegatePKID := bav.GetPKIDForPublicKey(txMeta.DelegatePublicKey).PKID
+	currentEntry, err := bav.GetDelegatedPosterEntry(ownerPKID, delegatePKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectDelegatedPoster: ")
+	}
+	if txMeta.OperationType == DelegatedPosterOperationTypeAuthorize {
+		if currentEntry == nil {
+			return fmt.Errorf("_disconnectDelegatedPoster: no DelegatedPosterEntry for owner %v, delegate %v",
+				ownerPKID, delegatePKID)
+		}
+		bav._deleteDelegatedPosterEntryMappings(currentEntry)
+	} else if currentEntry != nil {
+		return fmt.Errorf("_disconnectDelegatedPoster: revoked DelegatedPosterEntry for owner %v, delegate %v "+
+			"exists", ownerPKID, delegatePKID)
+	}
+	if operationData.PrevDelegatedPosterEntry != nil {
+		bav._setDelegatedPosterEntryMappings(operationData.PrevDelegatedPosterEntry)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// ValidateDelegatedPosterMetadata checks the metadata of a DelegatedPoster txn and that the transactor
+// is allowed to perform its operation. It doesn't depend on the state, so it's shared by txn
+// construction and connection.
+func ValidateDelegatedPosterMetadata(transactorPublicKey []byte, metadata *DelegatedPosterMetadata) error {
+	if _, err := btcec.ParsePubKey(metadata.OwnerPublicKey); err != nil {
+		return errors.Wrapf(RuleErrorDelegatedPosterInvalidOwnerPublicKey, "ValidateDelegatedPosterMetadata: %v", err)
+	}
+	if _, err := btcec.ParsePubKey(metadata.DelegatePublicKey); err != nil {
+		return errors.Wrapf(RuleErrorDelegatedPosterInvalidDelegatePublicKey, "ValidateDelegatedPosterMetadata: %v", err)
+	}
+	if bytes.Equal(metadata.OwnerPublicKey, metadata.DelegatePublicKey) {
+		return RuleErrorDelegatedPosterCannotDelegateToSelf
+	}
+
+	switch metadata.OperationType {
+	case DelegatedPosterOperationTypeAuthorize:
+		if !bytes.Equal(transactorPublicKey, metadata.OwnerPublicKey) {
+			return RuleErrorDelegatedPosterAuthorizeNotByOwner
+		}
+		if metadata.Permissions == 0 || metadata.Permissions&^DelegatedPosterPermissionsAll != 0 {
+			return errors.Wrapf(RuleErrorDelegatedPosterInvalidPermissions,
+				"ValidateDelegatedPosterMetadata: %d", metadata.Permissions)
+		}
+	case DelegatedPosterOperationTypeRevoke:
+		if !bytes.Equal(transactorPublicKey, metadata.OwnerPublicKey) &&
+			!bytes.Equal(transactorPublicKey, metadata.DelegatePublicKey) {
+			return RuleErrorDelegatedPosterRevokeNotByOwnerOrDelegate
+		}
+		if metadata.Permissions != 0 {
+			return errors.Wrapf(RuleErrorDelegatedPosterInvalidPermissions,
+				"ValidateDelegatedPosterMetadata: revoking with permissions %d", metadata.Permissions)
+		}
+		if metadata.ExpirationBlockHeight != 0 {
+			return errors.Wrapf(RuleErrorDelegatedPosterInvalidExpirationBlockHeight,
+				"ValidateDelegatedPosterMetadata: revoking with expiration %d", metadata.ExpirationBlockHeight)
+		}
+	default:
+		return errors.Wrapf(RuleErrorDelegatedPosterInvalidOperationType,
+			"ValidateDelegatedPosterMetadata: %v", metadata.OperationType)
+	}
+	return nil
+}
+
+// _getDelegatedPostOwnerPublicKey returns the public key that a SubmitPost txn submitted by the delegate
+// on behalf of the owner attributes the post to. It errors if the delegate isn't authorized to create the
+// post, or to edit it if isModifyingPost is set.
+func (bav *UtxoView) _getDelegatedPostOwnerPublicKey(
+	delegatePublicKey []byte, ownerPublicKey []byte, isModifyingPost bool, blockHeight uint32,
+) ([]byte, error) {
+	if _, err := btcec.ParsePubKey(ownerPublicKey); err != nil || bytes.Equal(ownerPublicKey, delegatePublicKey) {
+		return nil, errors.Wrapf(RuleErrorSubmitPostInvalidDelegatedPostOwner,
+			"_getDelegatedPostOwnerPublicKey: %x", ownerPublicKey)
+	}
+	ownerPKID := bav.GetPKIDForPublicKey(ownerPublicKey).PKID
+	delegatePKID := bav.GetPKIDForPublicKey(delegatePublicKey).PKID
+	entry, err := bav.GetDelegatedPosterEntry(ownerPKID, delegatePKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getDelegatedPostOwnerPublicKey: ")
+	}
+	if entry == nil || !entry.IsActiveAtBlockHeight(uint64(blockHeight)) {
+		return nil, errors.Wrapf(RuleErrorSubmitPostDelegatedPosterNotAuthorized,
+			"_getDelegatedPostOwnerPublicKey: owner %v, delegate %v",
+			PkToString(ownerPublicKey, bav.Params), PkToString(delegatePublicKey, bav.Params))
+	}
+	requiredPermission := DelegatedPosterPermissionCreatePosts
+	if isModifyingPost {
+		requiredPermission = DelegatedPosterPermissionEditPosts
+	}
+	if !entry.Permissions.Has(requiredPermission) {
+		if isModifyingPost {
+			return nil, errors.Wrapf(RuleErrorSubmitPostDelegatedPosterNotAuthorizedToEditPosts,
+				"_getDelegatedPostOwnerPublicKey: owner %v, delegate %v",
+				PkToString(ownerPublicKey, bav.Params), PkToString(delegatePublicKey, bav.Params))
+		}
+		return nil, errors.Wrapf(RuleErrorSubmitPostDelegatedPosterNotAuthorized,
+			"_getDelegatedPostOwnerPublicKey: owner %v, delegate %v can't create posts",
+			PkToString(ownerPublicKey, bav.Params), PkToString(delegatePublicKey, bav.Params))
+	}
+	return ownerPublicKey, nil
+}
+
+func (bav *UtxoView) GetDelegatedPosterEntry(ownerPKID *PKID, delegatePKID *PKID) (*DelegatedPosterEntry, error) {
+	if ownerPKID == nil || delegatePKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetDelegatedPosterEntry: Called with nil ownerPKID or delegatePKID")
+	}
+
+	// First check the UtxoView.
+	mapKey := DelegatedPosterKey{OwnerPKID: *ownerPKID, DelegatePKID: *delegatePKID}
+	if entry, exists := bav.DelegatedPosterKeyToDelegatedPosterEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// If no DelegatedPosterEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbEntry, err := DBGetDelegatedPosterEntry(bav.Handle, bav.Snapshot, ownerPKID, delegatePKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDelegatedPosterEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the DelegatedPosterEntry from the db in the UtxoView.
+		bav._setDelegatedPosterEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetDelegatedPosterEntriesForOwner returns the authorizations of all of the owner's delegates, including
+// the expired ones, merging the entries in the view with the entries in the database.
+func (bav *UtxoView) GetDelegatedPosterEntriesForOwner(ownerPKID *PKID) ([]*DelegatedPosterEntry, error) {
+	if ownerPKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetDelegatedPosterEntriesForOwner: Called with nil ownerPKID")
+	}
+
+	// Load the entries from the database into the view. We don't overwrite the
+	// entries in the view since they're more recent than the database.
+	dbEntries, err := DBGetDelegatedPosterEntriesForOwner(bav.Handle, ownerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetDelegatedPosterEntriesForOwner: ")
+	}
+	for _, entry := range dbEntries {
+		if _, exists := bav.DelegatedPosterKeyToDelegatedPosterEntry[entry.ToMapKey()]; !exists {
+			bav._setDelegatedPosterEntryMappings(entry)
+		}
+	}
+
+	var entries []*DelegatedPosterEntry
+	for mapKey, entry := range bav.DelegatedPosterKeyToDelegatedPosterEntry {
+		if !entry.isDeleted && mapKey.OwnerPKID == *ownerPKID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (bav *UtxoView) _setDelegatedPosterEntryMappings(entry *DelegatedPosterEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setDelegatedPosterEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.DelegatedPosterKeyToDelegatedPosterEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteDelegatedPosterEntryMappings(entry *DelegatedPosterEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteDelegatedPosterEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setDelegatedPosterEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushDelegatedPosterEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, entryIter := range bav.DelegatedPosterKeyToDelegatedPosterEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(entry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushDelegatedPosterEntriesToDbWithTxn: DelegatedPosterEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(),
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if entry.isDeleted {
+			if err := DBDeleteDelegatedPosterEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDelegatedPosterEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutDelegatedPosterEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushDelegatedPosterEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package lib
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegatedPoster(t *testing.T) {
+	var err error
+
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	// DelegatedPoster txns require the compact UtxoOperation encoding.
+	setDelegatedPosterBlockHeight := func(blockHeight uint32) {
+		params.ForkHeights.DelegatedPosterBlockHeight = blockHeight
+		params.ForkHeights.UtxoOperationCompactEncodingBlockHeight = blockHeight
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}
+	defer func(prevForkHeights ForkHeights) {
+		params.ForkHeights = prevForkHeights
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}(params.ForkHeights)
+	setDelegatedPosterBlockHeight(math.MaxUint32)
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       chain.blockTip().Height + 1,
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	// m0 is the organization, and m1 and m2 are its potential delegates.
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e6)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+
+	authorize := func(delegatePkBytes []byte, permissions DelegatedPosterPermissions) *DelegatedPosterMetadata {
+		return &DelegatedPosterMetadata{
+			OperationType:     DelegatedPosterOperationTypeAuthorize,
+			OwnerPublicKey:    m0PkBytes,
+			DelegatePublicKey: delegatePkBytes,
+			Permissions:       permissions,
+		}
+	}
+	revoke := func(delegatePkBytes []byte) *DelegatedPosterMetadata {
+		return &DelegatedPosterMetadata{
+			OperationType:     DelegatedPosterOperationTypeRevoke,
+			OwnerPublicKey:    m0PkBytes,
+			DelegatePublicKey: delegatePkBytes,
+		}
+	}
+
+	{
+		// RuleErrorDelegatedPosterBeforeBlockHeight
+		err = _submitDelegatedPosterWithTestMeta(
+			testMeta, m0Pub, m0Priv, authorize(m1PkBytes, DelegatedPosterPermissionCreatePosts))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterBeforeBlockHeight)
+
+		setDelegatedPosterBlockHeight(uint32(1))
+	}
+	{
+		// RuleErrorDelegatedPosterAuthorizeNotByOwner
+		err = _submitDelegatedPosterWithTestMeta(
+			testMeta, m1Pub, m1Priv, authorize(m1PkBytes, DelegatedPosterPermissionCreatePosts))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterAuthorizeNotByOwner)
+	}
+	{
+		// RuleErrorDelegatedPosterCannotDelegateToSelf
+		err = _submitDelegatedPosterWithTestMeta(
+			testMeta, m0Pub, m0Priv, authorize(m0PkBytes, DelegatedPosterPermissionCreatePosts))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterCannotDelegateToSelf)
+	}
+	{
+		// RuleErrorDelegatedPosterInvalidDelegatePublicKey
+		err = _submitDelegatedPosterWithTestMeta(
+			testMeta, m0Pub, m0Priv, authorize(m1PkBytes[:10], DelegatedPosterPermissionCreatePosts))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterInvalidDelegatePublicKey)
+	}
+	{
+		// RuleErrorDelegatedPosterInvalidPermissions
+		err = _submitDelegatedPosterWithTestMeta(testMeta, m0Pub, m0Priv, authorize(m1PkBytes, 0))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterInvalidPermissions)
+		err = _submitDelegatedPosterWithTestMeta(testMeta, m0Pub, m0Priv, authorize(m1PkBytes, 1<<5))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterInvalidPermissions)
+	}
+	{
+		// RuleErrorDelegatedPosterInvalidOperationType
+		metadata := authorize(m1PkBytes, DelegatedPosterPermissionCreatePosts)
+		metadata.OperationType = DelegatedPosterOperationTypeUnknown
+		err = _submitDelegatedPosterWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterInvalidOperationType)
+	}
+	{
+		// RuleErrorDelegatedPosterInvalidExpirationBlockHeight
+		metadata := authorize(m1PkBytes, DelegatedPosterPermissionCreatePosts)
+		metadata.ExpirationBlockHeight = uint64(chain.blockTip().Height)
+		err = _submitDelegatedPosterWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterInvalidExpirationBlockHeight)
+	}
+	{
+		// RuleErrorDelegatedPosterRevokingNonexistentAuthorization
+		err = _submitDelegatedPosterWithTestMeta(testMeta, m0Pub, m0Priv, revoke(m1PkBytes))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterRevokingNonexistentAuthorization)
+	}
+	{
+		// RuleErrorSubmitPostDelegatedPosterNotAuthorized: m1 hasn't been authorized yet.
+		_, err = _submitDelegatedPostWithTestMeta(testMeta, m1Pub, m1Priv, m0PkBytes, nil, false)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubmitPostDelegatedPosterNotAuthorized)
+	}
+
+	// Happy path: m0 authorizes m1 to create posts, and m1 posts on behalf of m0.
+	require.NoError(t, _submitDelegatedPosterWithTestMeta(
+		testMeta, m0Pub, m0Priv, authorize(m1PkBytes, DelegatedPosterPermissionCreatePosts)))
+	entry, err := DBGetDelegatedPosterEntry(db, chain.snapshot, m0PKID, m1PKID)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.Equal(t, DelegatedPosterPermissionCreatePosts, entry.Permissions)
+	require.Zero(t, entry.ExpirationBlockHeight)
+
+	postTxn, err := _submitDelegatedPostWithTestMeta(testMeta, m1Pub, m1Priv, m0PkBytes, nil, false)
+	require.NoError(t, err)
+	postEntry := DBGetPostEntryByPostHash(db, chain.snapshot, postTxn.Hash())
+	require.NotNil(t, postEntry)
+	require.Equal(t, m0PkBytes, postEntry.PosterPublicKey)
+	require.Equal(t, m1PkBytes, postEntry.PostExtraData[DelegatedPostDelegatePublicKeyKey])
+	require.NotContains(t, postEntry.PostExtraData, DelegatedPostOwnerPublicKeyKey)
+
+	{
+		// RuleErrorSubmitPostDelegatedPosterNotAuthorizedToEditPosts
+		_, err = _submitDelegatedPostWithTestMeta(testMeta, m1Pub, m1Priv, m0PkBytes, postTxn.Hash()[:], true)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubmitPostDelegatedPosterNotAuthorizedToEditPosts)
+	}
+	{
+		// RuleErrorSubmitPostDelegatedPosterNotAuthorized: m2 isn't a delegate of m0.
+		_, err = _submitDelegatedPostWithTestMeta(testMeta, m2Pub, m2Priv, m0PkBytes, nil, false)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubmitPostDelegatedPosterNotAuthorized)
+	}
+	{
+		// RuleErrorSubmitPostInvalidDelegatedPostOwner
+		_, err = _submitDelegatedPostWithTestMeta(testMeta, m1Pub, m1Priv, m0PkBytes[:10], nil, false)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubmitPostInvalidDelegatedPostOwner)
+	}
+	{
+		// RuleErrorDelegatedPosterRevokeNotByOwnerOrDelegate
+		err = _submitDelegatedPosterWithTestMeta(testMeta, m2Pub, m2Priv, revoke(m1PkBytes))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorDelegatedPosterRevokeNotByOwnerOrDelegate)
+	}
+
+	// Happy path: m0 re-authorizes m1 to edit posts too, until an expiration, and m1 hides the post.
+	metadata := authorize(m1PkBytes, DelegatedPosterPermissionsAll)
+	metadata.ExpirationBlockHeight = uint64(chain.blockTip().Height) + 100
+	require.NoError(t, _submitDelegatedPosterWithTestMeta(testMeta, m0Pub, m0Priv, metadata))
+	entry, err = DBGetDelegatedPosterEntry(db, chain.snapshot, m0PKID, m1PKID)
+	require.NoError(t, err)
+	require.Equal(t, DelegatedPosterPermissionsAll, entry.Permissions)
+	require.Equal(t, metadata.ExpirationBlockHeight, entry.ExpirationBlockHeight)
+	require.True(t, entry.IsActiveAtBlockHeight(metadata.ExpirationBlockHeight-1))
+	require.False(t, entry.IsActiveAtBlockHeight(metadata.ExpirationBlockHeight))
+
+	_, err = _submitDelegatedPostWithTestMeta(testMeta, m1Pub, m1Priv, m0PkBytes, postTxn.Hash()[:], true)
+	require.NoError(t, err)
+	postEntry = DBGetPostEntryByPostHash(db, chain.snapshot, postTxn.Hash())
+	require.True(t, postEntry.IsHidden)
+	require.Equal(t, m0PkBytes, postEntry.PosterPublicKey)
+
+	// Happy path: m0 authorizes m2 as well, then m1 gives up its authorization and m0 revokes m2's. Revoking one
+	// delegate doesn't affect the other.
+	require.NoError(t, _submitDelegatedPosterWithTestMeta(
+		testMeta, m0Pub, m0Priv, authorize(m2PkBytes, DelegatedPosterPermissionCreatePosts)))
+	entries, err := DBGetDelegatedPosterEntriesForOwner(db, m0PKID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.NoError(t, _submitDelegatedPosterWithTestMeta(testMeta, m1Pub, m1Priv, revoke(m1PkBytes)))
+	_, err = _submitDelegatedPostWithTestMeta(testMeta, m1Pub, m1Priv, m0PkBytes, nil, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorSubmitPostDelegatedPosterNotAuthorized)
+	_, err = _submitDelegatedPostWithTestMeta(testMeta, m2Pub, m2Priv, m0PkBytes, nil, false)
+	require.NoError(t, err)
+
+	require.NoError(t, _submitDelegatedPosterWithTestMeta(testMeta, m0Pub, m0Priv, revoke(m2PkBytes)))
+	entries, err = DBGetDelegatedPosterEntriesForOwner(db, m0PKID)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	_executeAllTestRollbackAndFlush(testMeta)
+	entries, err = DBGetDelegatedPosterEntriesForOwner(db, m0PKID)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.Nil(t, DBGetPostEntryByPostHash(db, chain.snapshot, postTxn.Hash()))
+}
+
+func TestDelegatedPosterMetadataEncoding(t *testing.T) {
+	metadata := &DelegatedPosterMetadata{
+		OperationType:         DelegatedPosterOperationTypeAuthorize,
+		OwnerPublicKey:        m0PkBytes,
+		DelegatePublicKey:     m1PkBytes,
+		Permissions:           DelegatedPosterPermissionsAll,
+		ExpirationBlockHeight: 12345,
+	}
+	encodedBytes, err := metadata.ToBytes(false)
+	require.NoError(t, err)
+	decodedMetadata := &DelegatedPosterMetadata{}
+	require.NoError(t, decodedMetadata.FromBytes(encodedBytes))
+	require.Equal(t, metadata, decodedMetadata)
+}
+
+func _submitDelegatedPosterWithTestMeta(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *DelegatedPosterMetadata,
+) error {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, _, _, err := testMeta.chain.CreateDelegatedPosterTxn(
+		transactorPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		nil,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	blockHeight := testMeta.chain.blockTip().Height + 1
+	utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	utxoOps, totalInput, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return err
+	}
+	require.Equal(testMeta.t, totalInputMake, totalInput)
+	require.Equal(testMeta.t, OperationTypeDelegatedPoster, utxoOps[len(utxoOps)-1].Type)
+	require.NoError(testMeta.t, utxoView.FlushToDb(uint64(blockHeight)))
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return nil
+}
+
+func _submitDelegatedPostWithTestMeta(
+	testMeta *TestMeta,
+	delegatePublicKeyBase58Check string,
+	delegatePrivateKeyBase58Check string,
+	ownerPublicKey []byte,
+	postHashToModify []byte,
+	isHidden bool,
+) (*MsgDeSoTxn, error) {
+	// Record the delegate's prevBalance, since the delegate pays for the post.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, nil, delegatePublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	delegatePkBytes, _, err := Base58CheckDecode(delegatePublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	body, err := json.Marshal(&DeSoBodySchema{Body: "posted by a delegate"})
+	require.NoError(testMeta.t, err)
+	txn, totalInputMake, _, _, err := testMeta.chain.CreateSubmitPostTxn(
+		delegatePkBytes,
+		postHashToModify,
+		nil,
+		body,
+		nil,
+		false,
+		uint64(time.Now().UnixNano()),
+		map[string][]byte{DelegatedPostOwnerPublicKeyKey: ownerPublicKey},
+		isHidden,
+		testMeta.feeRateNanosPerKb,
+		nil,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, delegatePrivateKeyBase58Check)
+
+	// Connect the transaction.
+	blockHeight := testMeta.chain.blockTip().Height + 1
+	utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	utxoOps, totalInput, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return nil, err
+	}
+	require.Equal(testMeta.t, totalInputMake, totalInput)
+	require.Equal(testMeta.t, OperationTypeSubmitPost, utxoOps[len(utxoOps)-1].Type)
+	require.NoError(testMeta.t, utxoView.FlushToDb(uint64(blockHeight)))
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return txn, nil
+}
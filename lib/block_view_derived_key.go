@@ -481,15 +481,20 @@ func (bav *UtxoView) _disconnectAuthorizeDerivedKey(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 
+	operationData, err := GetUtxoOperationData[AuthorizeDerivedKeyOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAuthorizeDerivedKey: ")
+	}
+
 	txMeta := currentTxn.TxnMeta.(*AuthorizeDerivedKeyMetadata)
-	prevDerivedKeyEntry := utxoOpsForTxn[operationIndex].PrevDerivedKeyEntry
+	prevDerivedKeyEntry := operationData.PrevDerivedKeyEntry
 
 	// Sanity check that txn public key is valid. Assign this public key to ownerPublicKey.
 	var ownerPublicKey []byte
 	if len(currentTxn.PublicKey) != btcec.PubKeyBytesLenCompressed {
 		return fmt.Errorf("_disconnectAuthorizeDerivedKey invalid public key: %v", currentTxn.PublicKey)
 	}
-	_, err := btcec.ParsePubKey(currentTxn.PublicKey)
+	_, err = btcec.ParsePubKey(currentTxn.PublicKey)
 	if err != nil {
 		return fmt.Errorf("_disconnectAuthorizeDerivedKey invalid public key: %v", err)
 	}
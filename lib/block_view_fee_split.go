@@ -0,0 +1,355 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Fee Split
+//
+// After the cut-over to Proof of Stake, the fee of each transaction is split by the BMF, see computeBMF: the block
+// producer can claim the utility fee, log_2(fee), in its block reward, and the rest is burned. Starting at the
+// FeeRedistributionParamsBlockHeight, the ParamUpdater can set the FeeRedistributionBasisPoints global param to
+// let the block producer claim a share of the fees the BMF would burn as well, up to MaxFeeRedistributionBasisPoints.
+// Block producers and validators need to agree on the max block reward of a block before it's produced, so the
+// param is read from the snapshot GlobalParamsEntry, and a change takes effect with the epoch its snapshot is used.
+//
+// The realized split of each PoS block, i.e. the fees its transactions paid, the part of them the block reward
+// paid out, and the part that was burned, is recorded in a BlockFeeSplitEntry when the block is connected and
+// deleted when it's disconnected. GetBlockFeeSplitsInRange returns them for supply analytics. Like the other
+// indexes derived from the blocks, they aren't part of the state, a node only has the splits of the blocks it
+// connected itself, and they aren't recorded when running with Postgres.
+
+// computeFeeSplit splits a transaction fee into the part that's burned and the part that the block producer can
+// claim. The block producer can claim the utility fee computed by the BMF, plus feeRedistributionBasisPoints of the
+// fee the BMF burns.
+func computeFeeSplit(fee uint64, feeRedistributionBasisPoints uint64) (_burnFee uint64, _utilityFee uint64) {
+	burnFee, utilityFee := computeBMF(fee)
+	if feeRedistributionBasisPoints == 0 || burnFee == 0 {
+		return burnFee, utilityFee
+	}
+	if feeRedistributionBasisPoints > MaxBasisPoints {
+		feeRedistributionBasisPoints = MaxBasisPoints
+	}
+	// The product can overflow a uint64, so it's computed with big.Ints.
+	redistributedFee := big.NewInt(0).Mul(
+		big.NewInt(0).SetUint64(burnFee), big.NewInt(0).SetUint64(feeRedistributionBasisPoints))
+	redistributedFee.Div(redistributedFee, big.NewInt(int64(MaxBasisPoints)))
+	return burnFee - redistributedFee.Uint64(), utilityFee + redistributedFee.Uint64()
+}
+
+// GetFeeRedistributionBasisPoints returns the FeeRedistributionBasisPoints that apply to the fees of the block at
+// blockHeight, which is connected on top of the view.
+func (bav *UtxoView) GetFeeRedistributionBasisPoints(blockHeight uint64) (uint64, error) {
+	if blockHeight < uint64(bav.Params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight) ||
+		blockHeight < uint64(bav.Params.ForkHeights.FeeRedistributionParamsBlockHeight) {
+		return 0, nil
+	}
+	snapshotGlobalParamsEntry, err := bav.GetCurrentSnapshotGlobalParamsEntry()
+	if err != nil {
+		return 0, errors.Wrapf(err, "GetFeeRedistributionBasisPoints: ")
+	}
+	return snapshotGlobalParamsEntry.FeeRedistributionBasisPoints, nil
+}
+
+//
+// TYPES: BlockFeeSplitEntry
+//
+
+// BlockFeeSplitEntry records how the fees of a PoS block were split between the block producer and the burn.
+type BlockFeeSplitEntry struct {
+	BlockHeight uint64
+	BlockHash   *BlockHash
+	// TotalFeesNanos is the sum of the fees paid by the block's transactions, including the ones paid by the
+	// block producer itself, which it can't claim.
+	TotalFeesNanos uint64
+	// DistributedFeesNanos is the amount the block reward paid out.
+	DistributedFeesNanos uint64
+	// BurnedFeesNanos is the rest of TotalFeesNanos.
+	BurnedFeesNanos uint64
+	// FeeRedistributionBasisPoints is the value of the global param that applied to the block.
+	FeeRedistributionBasisPoints uint64
+
+	isDeleted bool
+}
+
+func (entry *BlockFeeSplitEntry) Copy() *BlockFeeSplitEntry {
+	var blockHash *BlockHash
+	if entry.BlockHash != nil {
+		blockHash = entry.BlockHash.NewBlockHash()
+	}
+	return &BlockFeeSplitEntry{
+		BlockHeight:                  entry.BlockHeight,
+		BlockHash:                    blockHash,
+		TotalFeesNanos:               entry.TotalFeesNanos,
+		DistributedFeesNanos:         entry.DistributedFeesNanos,
+		BurnedFeesNanos:              entry.BurnedFeesNanos,
+		FeeRedistributionBasisPoints: entry.FeeRedistributionBasisPoints,
+		isDeleted:                    entry.isDeleted,
+	}
+}
+
+func (entry *BlockFeeSplitEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.BlockHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.TotalFeesNanos)...)
+	data = append(data, UintToBuf(entry.DistributedFeesNanos)...)
+	data = append(data, UintToBuf(entry.BurnedFeesNanos)...)
+	data = append(data, UintToBuf(entry.FeeRedistributionBasisPoints)...)
+	return data
+}
+
+func (entry *BlockFeeSplitEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// BlockHeight
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockFeeSplitEntry.Decode: Problem reading BlockHeight: ")
+	}
+
+	// BlockHash
+	entry.BlockHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockFeeSplitEntry.Decode: Problem reading BlockHash: ")
+	}
+
+	// TotalFeesNanos
+	entry.TotalFeesNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockFeeSplitEntry.Decode: Problem reading TotalFeesNanos: ")
+	}
+
+	// DistributedFeesNanos
+	entry.DistributedFeesNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockFeeSplitEntry.Decode: Problem reading DistributedFeesNanos: ")
+	}
+
+	// BurnedFeesNanos
+	entry.BurnedFeesNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockFeeSplitEntry.Decode: Problem reading BurnedFeesNanos: ")
+	}
+
+	// FeeRedistributionBasisPoints
+	entry.FeeRedistributionBasisPoints, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockFeeSplitEntry.Decode: Problem reading FeeRedistributionBasisPoints: ")
+	}
+
+	return nil
+}
+
+func (entry *BlockFeeSplitEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *BlockFeeSplitEntry) GetEncoderType() EncoderType {
+	return EncoderTypeBlockFeeSplitEntry
+}
+
+// NewBlockFeeSplitEntry computes the realized fee split of a PoS block. The block reward pays out the fees the
+// block producer claimed, so the rest of the fees are burned.
+func NewBlockFeeSplitEntry(
+	block *MsgDeSoBlock,
+	blockHash *BlockHash,
+	feeRedistributionBasisPoints uint64,
+) (*BlockFeeSplitEntry, error) {
+	var totalFeesNanos, blockRewardNanos uint64
+	var err error
+	for _, txn := range block.Txns {
+		if txn.TxnMeta.GetTxnType() == TxnTypeBlockReward {
+			for _, output := range txn.TxOutputs {
+				blockRewardNanos, err = SafeUint64().Add(blockRewardNanos, output.AmountNanos)
+				if err != nil {
+					return nil, errors.Wrapf(err, "NewBlockFeeSplitEntry: Problem adding block reward: ")
+				}
+			}
+			continue
+		}
+		// An atomic transaction wrapper's fee is the sum of the fees of its transactions.
+		totalFeesNanos, err = SafeUint64().Add(totalFeesNanos, txn.TxnFeeNanos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewBlockFeeSplitEntry: Problem adding fees: ")
+		}
+	}
+	burnedFeesNanos, err := SafeUint64().Sub(totalFeesNanos, blockRewardNanos)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewBlockFeeSplitEntry: Block reward exceeds fees: ")
+	}
+	return &BlockFeeSplitEntry{
+		BlockHeight:                  block.Header.Height,
+		BlockHash:                    blockHash,
+		TotalFeesNanos:               totalFeesNanos,
+		DistributedFeesNanos:         blockRewardNanos,
+		BurnedFeesNanos:              burnedFeesNanos,
+		FeeRedistributionBasisPoints: feeRedistributionBasisPoints,
+	}, nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForBlockFeeSplit(blockHeight uint64) []byte {
+	data := append([]byte{}, Prefixes.PrefixBlockFeeSplitByHeight...)
+	data = append(data, EncodeUint64(blockHeight)...)
+	return data
+}
+
+// DBGetBlockFeeSplitsInRange returns the fee splits recorded for the blocks from startHeight to endHeight,
+// inclusive, ordered by block height.
+func DBGetBlockFeeSplitsInRange(handle *badger.DB, startHeight uint64, endHeight uint64) ([]*BlockFeeSplitEntry, error) {
+	var entries []*BlockFeeSplitEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = append([]byte{}, Prefixes.PrefixBlockFeeSplitByHeight...)
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		endKey := DBKeyForBlockFeeSplit(endHeight)
+		for iterator.Seek(DBKeyForBlockFeeSplit(startHeight)); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+			if bytes.Compare(iterator.Item().Key(), endKey) > 0 {
+				break
+			}
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := DecodeDeSoEncoder(&BlockFeeSplitEntry{}, bytes.NewReader(entryBytes))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetBlockFeeSplitsInRange: problem retrieving fee splits: ")
+	}
+	return entries, nil
+}
+
+func DBPutBlockFeeSplitWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *BlockFeeSplitEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutBlockFeeSplitWithTxn: called with nil entry")
+		return nil
+	}
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForBlockFeeSplit(entry.BlockHeight), EncodeToBytes(blockHeight, entry), eventManager,
+	); err != nil {
+		return errors.Wrapf(err, "DBPutBlockFeeSplitWithTxn: problem storing fee split: ")
+	}
+	return nil
+}
+
+func DBDeleteBlockFeeSplitWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *BlockFeeSplitEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	if err := DBDeleteWithTxn(txn, snap, DBKeyForBlockFeeSplit(entry.BlockHeight), eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteBlockFeeSplitWithTxn: problem deleting fee split: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setBlockFeeSplitMappings(entry *BlockFeeSplitEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setBlockFeeSplitMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.BlockHeightToBlockFeeSplitEntry[entry.BlockHeight] = entry
+}
+
+// _deleteBlockFeeSplitMappings deletes the fee split recorded for the block at blockHeight. It is called when the
+// block is disconnected.
+func (bav *UtxoView) _deleteBlockFeeSplitMappings(blockHeight uint64) {
+	bav._setBlockFeeSplitMappings(&BlockFeeSplitEntry{BlockHeight: blockHeight, isDeleted: true})
+}
+
+// GetBlockFeeSplitsInRange returns the fee splits of the PoS blocks from startHeight to endHeight, inclusive,
+// ordered by block height. The result only reflects the blocks this node recorded fee splits for, see the comment
+// at the top of this file.
+func (bav *UtxoView) GetBlockFeeSplitsInRange(startHeight uint64, endHeight uint64) ([]*BlockFeeSplitEntry, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("GetBlockFeeSplitsInRange: start height %d is greater than end height %d",
+			startHeight, endHeight)
+	}
+
+	// Merge the fee splits in the db with the ones in the UtxoView, which are more up to date.
+	dbEntries, err := DBGetBlockFeeSplitsInRange(bav.Handle, startHeight, endHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetBlockFeeSplitsInRange: ")
+	}
+	entries := make(map[uint64]*BlockFeeSplitEntry, len(dbEntries))
+	for _, entry := range dbEntries {
+		entries[entry.BlockHeight] = entry
+	}
+	for blockHeight, entry := range bav.BlockHeightToBlockFeeSplitEntry {
+		if blockHeight >= startHeight && blockHeight <= endHeight {
+			entries[blockHeight] = entry
+		}
+	}
+
+	var feeSplits []*BlockFeeSplitEntry
+	for _, entry := range entries {
+		if !entry.isDeleted {
+			feeSplits = append(feeSplits, entry.Copy())
+		}
+	}
+	sort.Slice(feeSplits, func(ii, jj int) bool {
+		return feeSplits[ii].BlockHeight < feeSplits[jj].BlockHeight
+	})
+	return feeSplits, nil
+}
+
+func (bav *UtxoView) _flushBlockFeeSplitEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, entry := range bav.BlockHeightToBlockFeeSplitEntry {
+		// Sanity-check that the entry matches the map key.
+		if entry.BlockHeight != mapKey {
+			return fmt.Errorf(
+				"_flushBlockFeeSplitEntriesToDbWithTxn: entry height %d doesn't match MapKey %d",
+				entry.BlockHeight, mapKey,
+			)
+		}
+
+		// A block at the same height on another fork overwrites the entry, so only the entries of disconnected
+		// blocks need to be deleted.
+		if entry.isDeleted {
+			if err := DBDeleteBlockFeeSplitWithTxn(txn, bav.Snapshot, entry, bav.EventManager, true); err != nil {
+				return errors.Wrapf(err, "_flushBlockFeeSplitEntriesToDbWithTxn: ")
+			}
+			continue
+		}
+		if err := DBPutBlockFeeSplitWithTxn(txn, bav.Snapshot, entry, blockHeight, bav.EventManager); err != nil {
+			return errors.Wrapf(err, "_flushBlockFeeSplitEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
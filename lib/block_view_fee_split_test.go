@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeFeeSplit(t *testing.T) {
+	require := require.New(t)
+
+	// Without redistribution, the split is the BMF.
+	burnFee, utilityFee := computeFeeSplit(1025, 0)
+	require.Equal(uint64(1015), burnFee)
+	require.Equal(uint64(10), utilityFee)
+
+	// With redistribution, the block producer gets a share of what the BMF burns, rounded down.
+	burnFee, utilityFee = computeFeeSplit(1025, 2500)
+	require.Equal(uint64(762), burnFee)
+	require.Equal(uint64(263), utilityFee)
+	burnFee, utilityFee = computeFeeSplit(0, 2500)
+	require.Zero(burnFee)
+	require.Zero(utilityFee)
+
+	// Large fees don't overflow.
+	burnFee, utilityFee = computeFeeSplit(math.MaxUint64, MaxBasisPoints)
+	require.Zero(burnFee)
+	require.Equal(uint64(math.MaxUint64), utilityFee)
+}
+
+func TestBlockFeeSplits(t *testing.T) {
+	require := require.New(t)
+
+	_, params, db := NewLowDifficultyBlockchain(t)
+
+	// A block with two txns whose fees sum to 1000, and a block reward that pays out 300 of them.
+	blockRewardTxn := &MsgDeSoTxn{
+		TxnMeta:   &BlockRewardMetadataa{},
+		TxOutputs: []*DeSoOutput{{PublicKey: m0PkBytes, AmountNanos: 200}, {PublicKey: m0PkBytes, AmountNanos: 100}},
+	}
+	newBlock := func(blockHeight uint64) *MsgDeSoBlock {
+		return &MsgDeSoBlock{
+			Header: &MsgDeSoHeader{Height: blockHeight},
+			Txns: []*MsgDeSoTxn{
+				blockRewardTxn,
+				{TxnMeta: &BasicTransferMetadata{}, TxnFeeNanos: 400},
+				{TxnMeta: &BasicTransferMetadata{}, TxnFeeNanos: 600},
+			},
+		}
+	}
+	blockHash := NewBlockHash(RandomBytes(HashSizeBytes))
+	feeSplitEntry, err := NewBlockFeeSplitEntry(newBlock(10), blockHash, 2500)
+	require.NoError(err)
+	require.Equal(&BlockFeeSplitEntry{
+		BlockHeight:                  10,
+		BlockHash:                    blockHash,
+		TotalFeesNanos:               1000,
+		DistributedFeesNanos:         300,
+		BurnedFeesNanos:              700,
+		FeeRedistributionBasisPoints: 2500,
+	}, feeSplitEntry)
+
+	// A block reward that exceeds the fees is an error.
+	invalidBlock := newBlock(11)
+	invalidBlock.Txns = invalidBlock.Txns[:1]
+	_, err = NewBlockFeeSplitEntry(invalidBlock, blockHash, 0)
+	require.Error(err)
+
+	// Record the splits of three blocks, and query them from the view and once they're flushed.
+	utxoView := NewUtxoView(db, params, nil, nil, nil)
+	for _, blockHeight := range []uint64{10, 11, 12} {
+		feeSplitEntry, err = NewBlockFeeSplitEntry(newBlock(blockHeight), blockHash, 0)
+		require.NoError(err)
+		utxoView._setBlockFeeSplitMappings(feeSplitEntry)
+	}
+	requireFeeSplitHeights := func(utxoView *UtxoView, startHeight uint64, endHeight uint64, expectedHeights []uint64) {
+		feeSplits, err := utxoView.GetBlockFeeSplitsInRange(startHeight, endHeight)
+		require.NoError(err)
+		var heights []uint64
+		for _, feeSplit := range feeSplits {
+			heights = append(heights, feeSplit.BlockHeight)
+		}
+		require.Equal(expectedHeights, heights)
+	}
+	requireFeeSplitHeights(utxoView, 0, 100, []uint64{10, 11, 12})
+	requireFeeSplitHeights(utxoView, 11, 12, []uint64{11, 12})
+	require.NoError(utxoView.FlushToDb(0))
+	utxoView = NewUtxoView(db, params, nil, nil, nil)
+	requireFeeSplitHeights(utxoView, 0, 100, []uint64{10, 11, 12})
+	requireFeeSplitHeights(utxoView, 10, 11, []uint64{10, 11})
+	requireFeeSplitHeights(utxoView, 13, 100, nil)
+	_, err = utxoView.GetBlockFeeSplitsInRange(12, 11)
+	require.Error(err)
+
+	// Disconnecting a block deletes its split.
+	utxoView._deleteBlockFeeSplitMappings(12)
+	requireFeeSplitHeights(utxoView, 0, 100, []uint64{10, 11})
+	require.NoError(utxoView.FlushToDb(0))
+	utxoView = NewUtxoView(db, params, nil, nil, nil)
+	requireFeeSplitHeights(utxoView, 0, 100, []uint64{10, 11})
+}
@@ -11,7 +11,6 @@ import (
 )
 
 func (bav *UtxoView) FlushToDb(blockHeight uint64) error {
-	// Make sure everything happens inside a single transaction.
 	var err error
 	if bav.Postgres != nil {
 		err = bav.Postgres.FlushView(bav, blockHeight)
@@ -20,9 +19,23 @@ func (bav *UtxoView) FlushToDb(blockHeight uint64) error {
 		}
 	}
 
-	err = bav.Handle.Update(func(txn *badger.Txn) error {
-		return bav.FlushToDbWithTxn(txn, blockHeight)
-	})
+	// Views that are too big to flush in a single transaction are flushed in batches. See
+	// block_view_flush_batching.go.
+	batches, err := bav.planFlushBatches(blockHeight)
+	if err != nil {
+		return err
+	}
+	if len(batches) > 1 {
+		err = bav.flushToDbInBatches(batches, blockHeight)
+	} else {
+		err = bav.Handle.Update(func(txn *badger.Txn) error {
+			return bav.FlushToDbWithTxn(txn, blockHeight)
+		})
+	}
+	// Whether or not the flush was committed, the hot entries it wrote can be cached again.
+	if bav.Snapshot != nil {
+		bav.Snapshot.StateCache.EndFlush(bav.Handle)
+	}
 	if err != nil {
 		return err
 	}
@@ -54,6 +67,11 @@ func (bav *UtxoView) FlushToDbWithTxn(txn *badger.Txn, blockHeight uint64) error
 	if bav.Snapshot == nil {
 		return nil
 	}
+	// The view's TipHash is the block whose state we just flushed, whether we connected or disconnected blocks.
+	err = bav.Snapshot.FlushStateCommitmentWithTxn(txn, bav.TipHash)
+	if err != nil {
+		return err
+	}
 	// Flush the ancestral records to the DB.
 	err = bav.Snapshot.FlushAncestralRecordsWithTxn(txn)
 	if err != nil {
@@ -66,142 +84,121 @@ func (bav *UtxoView) FlushToDbWithTxn(txn *badger.Txn, blockHeight uint64) error
 // calling PrepareAncestralRecordsFlush. This SHOULD ONLY be used when flushing the
 // view within a badger transaction that itself calls PrepareAncestralRecordsFlush
 // and defer StartAncestralRecordsFlush.
-func (bav *UtxoView) FlushToDBWithoutAncestralRecordsFlushWithTxn(txn *badger.Txn, blockHeight uint64) error {
+func (bav *UtxoView) FlushToDBWithoutAncestralRecordsFlushWithTxn(txn *badger.Txn, blockHeight uint64) (
+	_err error) {
 
-	// Only flush to BadgerDB if Postgres is disabled
-	if bav.Postgres == nil {
-		if err := bav._flushUtxosToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushProfileEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushPKIDEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushPostEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushLikeEntriesToDbWithTxn(txn); err != nil {
-			return err
-		}
-		if err := bav._flushFollowEntriesToDbWithTxn(txn); err != nil {
-			return err
-		}
-		if err := bav._flushDiamondEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushMessageEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushBalanceEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushDAOCoinBalanceEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushDeSoBalancesToDbWithTxn(txn); err != nil {
-			return err
-		}
-		if err := bav._flushForbiddenPubKeyEntriesToDbWithTxn(txn); err != nil {
-			return err
-		}
-		if err := bav._flushNFTEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushNFTBidEntriesToDbWithTxn(txn); err != nil {
-			return err
-		}
-		if err := bav._flushDerivedKeyEntryToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushAccessGroupEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushAccessGroupMembersToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushNewMessageEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		// Temporarily flush all DAO Coin Limit orders to badger
-		//if err := bav._flushDAOCoinLimitOrderEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		//	return err
-		//}
-		if err := bav._flushUserAssociationEntriesToDbWithTxn(txn, blockHeight); err != nil {
-			return err
-		}
-		if err := bav._flushPostAssociationEntriesToDbWithTxn(txn, blockHeight); err != nil {
+	span := StartTraceSpan("UtxoView.FlushToDb", bav.traceSpan)
+	span.SetAttributes(TraceAttribute{Key: TraceAttributeKeyBlockHeight, Value: blockHeight})
+	defer func() { EndTraceSpan(span, _err) }()
+
+	for _, step := range bav.getFlushSteps() {
+		if err := step.flush(bav, txn, blockHeight); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	// Always flush to BadgerDB.
-	if err := bav._flushBitcoinExchangeDataWithTxn(txn); err != nil {
-		return err
-	}
-	if err := bav._flushGlobalParamsEntryToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushAcceptedBidEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushRepostEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushMessagingGroupEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
+// utxoViewFlushStep flushes one kind of entry from the view to the DB.
+type utxoViewFlushStep struct {
+	name string
+	// badgerOnly steps are skipped if Postgres is enabled, since Postgres stores these entries instead.
+	badgerOnly bool
+	flush      func(bav *UtxoView, txn *badger.Txn, blockHeight uint64) error
+}
+
+func flushStepWithoutBlockHeight(
+	flush func(bav *UtxoView, txn *badger.Txn) error,
+) func(bav *UtxoView, txn *badger.Txn, blockHeight uint64) error {
+	return func(bav *UtxoView, txn *badger.Txn, _ uint64) error {
+		return flush(bav, txn)
 	}
+}
+
+// utxoViewFlushSteps are the steps of a UtxoView flush, in the order they're run.
+var utxoViewFlushSteps = []*utxoViewFlushStep{
+	{"Utxos", true, (*UtxoView)._flushUtxosToDbWithTxn},
+	{"ProfileEntries", true, (*UtxoView)._flushProfileEntriesToDbWithTxn},
+	{"PKIDEntries", true, (*UtxoView)._flushPKIDEntriesToDbWithTxn},
+	{"PostEntries", true, (*UtxoView)._flushPostEntriesToDbWithTxn},
+	{"LikeEntries", true, flushStepWithoutBlockHeight((*UtxoView)._flushLikeEntriesToDbWithTxn)},
+	{"FollowEntries", true, flushStepWithoutBlockHeight((*UtxoView)._flushFollowEntriesToDbWithTxn)},
+	{"FollowCountEntries", true, flushStepWithoutBlockHeight((*UtxoView)._flushFollowCountEntriesToDbWithTxn)},
+	{"DiamondEntries", true, (*UtxoView)._flushDiamondEntriesToDbWithTxn},
+	{"MessageEntries", true, (*UtxoView)._flushMessageEntriesToDbWithTxn},
+	{"BalanceEntries", true, (*UtxoView)._flushBalanceEntriesToDbWithTxn},
+	{"DAOCoinBalanceEntries", true, (*UtxoView)._flushDAOCoinBalanceEntriesToDbWithTxn},
+	{"DeSoBalances", true, flushStepWithoutBlockHeight((*UtxoView)._flushDeSoBalancesToDbWithTxn)},
+	{"ForbiddenPubKeyEntries", true, flushStepWithoutBlockHeight((*UtxoView)._flushForbiddenPubKeyEntriesToDbWithTxn)},
+	{"NFTEntries", true, (*UtxoView)._flushNFTEntriesToDbWithTxn},
+	{"NFTBidEntries", true, flushStepWithoutBlockHeight((*UtxoView)._flushNFTBidEntriesToDbWithTxn)},
+	{"DerivedKeyEntry", true, (*UtxoView)._flushDerivedKeyEntryToDbWithTxn},
+	{"AccessGroupEntries", true, (*UtxoView)._flushAccessGroupEntriesToDbWithTxn},
+	{"AccessGroupMembers", true, (*UtxoView)._flushAccessGroupMembersToDbWithTxn},
+	{"NewMessageEntries", true, (*UtxoView)._flushNewMessageEntriesToDbWithTxn},
 	// Temporarily flush all DAO Coin Limit orders to badger
-	if err := bav._flushDAOCoinLimitOrderEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushNonceEntriesToDbWithTxn(txn); err != nil {
-		return err
-	}
-	if err := bav._flushLockedBalanceEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushLockupYieldCurvePointEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushValidatorEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushValidatorBLSPublicKeyPKIDPairEntryMappingsWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushStakeEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushLockedStakeEntriesToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
+	//{"DAOCoinLimitOrderEntries", true, (*UtxoView)._flushDAOCoinLimitOrderEntriesToDbWithTxn},
+	{"UserAssociationEntries", true, (*UtxoView)._flushUserAssociationEntriesToDbWithTxn},
+	{"PostAssociationEntries", true, (*UtxoView)._flushPostAssociationEntriesToDbWithTxn},
+	{"PostAssociationCountEntries", true, flushStepWithoutBlockHeight((*UtxoView)._flushPostAssociationCountEntriesToDbWithTxn)},
+
+	{"BitcoinExchangeData", false, flushStepWithoutBlockHeight((*UtxoView)._flushBitcoinExchangeDataWithTxn)},
+	{"GlobalParamsEntry", false, (*UtxoView)._flushGlobalParamsEntryToDbWithTxn},
+	{"AcceptedBidEntries", false, (*UtxoView)._flushAcceptedBidEntriesToDbWithTxn},
+	{"RepostEntries", false, (*UtxoView)._flushRepostEntriesToDbWithTxn},
+	{"MessagingGroupEntries", false, (*UtxoView)._flushMessagingGroupEntriesToDbWithTxn},
+	// Temporarily flush all DAO Coin Limit orders to badger
+	{"DAOCoinLimitOrderEntries", false, (*UtxoView)._flushDAOCoinLimitOrderEntriesToDbWithTxn},
+	{"NonceEntries", false, flushStepWithoutBlockHeight((*UtxoView)._flushNonceEntriesToDbWithTxn)},
+	{"TxnReceipts", false, (*UtxoView)._flushTxnReceiptsToDbWithTxn},
+	{"StakingRewardStatements", false, (*UtxoView)._flushStakingRewardStatementsToDbWithTxn},
+	{"ValidatorPerformanceEntries", false, (*UtxoView)._flushValidatorPerformanceEntriesToDbWithTxn},
+	{"SoftForkDeploymentStateEntries", false, (*UtxoView)._flushSoftForkDeploymentStateEntriesToDbWithTxn},
+	{"LockedBalanceEntries", false, (*UtxoView)._flushLockedBalanceEntriesToDbWithTxn},
+	{"LockupYieldCurvePointEntries", false, (*UtxoView)._flushLockupYieldCurvePointEntriesToDbWithTxn},
+	{"ValidatorEntries", false, (*UtxoView)._flushValidatorEntriesToDbWithTxn},
+	{"ValidatorBLSPublicKeyPKIDPairEntryMappings", false, (*UtxoView)._flushValidatorBLSPublicKeyPKIDPairEntryMappingsWithTxn},
+	{"StakeEntries", false, (*UtxoView)._flushStakeEntriesToDbWithTxn},
+	{"LockedStakeEntries", false, (*UtxoView)._flushLockedStakeEntriesToDbWithTxn},
+	{"KeyValueRecordEntries", false, (*UtxoView)._flushKeyValueRecordEntriesToDbWithTxn},
+	{"LockupVestingScheduleEntries", false, (*UtxoView)._flushLockupVestingScheduleEntriesToDbWithTxn},
+	{"MessageReadStateEntries", false, (*UtxoView)._flushMessageReadStateEntriesToDbWithTxn},
+	{"NFTAvatarEntries", false, (*UtxoView)._flushNFTAvatarEntriesToDbWithTxn},
+	{"BridgeEventAnchorEntries", false, (*UtxoView)._flushBridgeEventAnchorEntriesToDbWithTxn},
+	{"DAOCoinBalanceChangeEntries", false, (*UtxoView)._flushDAOCoinBalanceChangeEntriesToDbWithTxn},
+	{"PKIDSwapEntries", false, (*UtxoView)._flushPKIDSwapEntriesToDbWithTxn},
+	{"DelegatedPosterEntries", false, (*UtxoView)._flushDelegatedPosterEntriesToDbWithTxn},
+	{"AnchorHashEntries", false, (*UtxoView)._flushAnchorHashEntriesToDbWithTxn},
+	{"AnchorHashRateLimitEntries", false, (*UtxoView)._flushAnchorHashRateLimitEntriesToDbWithTxn},
+	{"ContentTombstoneEntries", false, (*UtxoView)._flushContentTombstoneEntriesToDbWithTxn},
+	{"BlockFeeSplitEntries", false, (*UtxoView)._flushBlockFeeSplitEntriesToDbWithTxn},
+	{"SubscriptionEntries", false, (*UtxoView)._flushSubscriptionEntriesToDbWithTxn},
+	{"GlobalParamsHistoryEntries", false, (*UtxoView)._flushGlobalParamsHistoryEntriesToDbWithTxn},
 	// TODO: We may want to move this into a new FlushToDb function that only flushes
 	// entries set in the OnEpochEndHook. No sense in wasting a bunch of cycles flushing
 	// all the other entries which will always be nil/empty in the OnEpochEndHook.
-	if err := bav._flushCurrentEpochEntryToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushCurrentRandomSeedHashToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushSnapshotGlobalParamsEntryToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushSnapshotValidatorSetToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushSnapshotLeaderScheduleToDbWithTxn(txn, blockHeight); err != nil {
-		return err
-	}
-	if err := bav._flushSnapshotStakesToRewardToDbWithTxn(txn, blockHeight); err != nil {
-		return err
+	{"CurrentEpochEntry", false, (*UtxoView)._flushCurrentEpochEntryToDbWithTxn},
+	{"CurrentRandomSeedHash", false, (*UtxoView)._flushCurrentRandomSeedHashToDbWithTxn},
+	{"SnapshotGlobalParamsEntry", false, (*UtxoView)._flushSnapshotGlobalParamsEntryToDbWithTxn},
+	{"SnapshotValidatorSet", false, (*UtxoView)._flushSnapshotValidatorSetToDbWithTxn},
+	{"SnapshotLeaderSchedule", false, (*UtxoView)._flushSnapshotLeaderScheduleToDbWithTxn},
+	{"SnapshotStakesToReward", false, (*UtxoView)._flushSnapshotStakesToRewardToDbWithTxn},
+	{"SnapshotValidatorBLSPublicKeyPKIDPairEntry", false, (*UtxoView)._flushSnapshotValidatorBLSPublicKeyPKIDPairEntryToDbWithTxn},
+}
+
+// getFlushSteps returns the steps of the view's flush, in the order they're run.
+func (bav *UtxoView) getFlushSteps() []*utxoViewFlushStep {
+	// Only flush the badgerOnly steps to BadgerDB if Postgres is disabled.
+	if bav.Postgres == nil {
+		return utxoViewFlushSteps
 	}
-	if err := bav._flushSnapshotValidatorBLSPublicKeyPKIDPairEntryToDbWithTxn(txn, blockHeight); err != nil {
-		return err
+	var steps []*utxoViewFlushStep
+	for _, step := range utxoViewFlushSteps {
+		if !step.badgerOnly {
+			steps = append(steps, step)
+		}
 	}
-	return nil
+	return steps
 }
 
 func (bav *UtxoView) _flushUtxosToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
@@ -530,6 +527,26 @@ func (bav *UtxoView) _flushFollowEntriesToDbWithTxn(txn *badger.Txn) error {
 	return nil
 }
 
+func (bav *UtxoView) _flushFollowCountEntriesToDbWithTxn(txn *badger.Txn) error {
+	for _, followCountEntry := range bav.PKIDToFollowCountEntry {
+		if err := DbPutFollowCountEntryWithTxn(txn, followCountEntry); err != nil {
+			return errors.Wrapf(err, "_flushFollowCountEntriesToDbWithTxn: Problem putting follow counts "+
+				"for PKID %v: ", followCountEntry.PKID)
+		}
+	}
+	return nil
+}
+
+func (bav *UtxoView) _flushPostAssociationCountEntriesToDbWithTxn(txn *badger.Txn) error {
+	for _, countEntry := range bav.PostAssociationCountMapKeyToCountEntry {
+		if err := DbPutPostAssociationCountEntryWithTxn(txn, countEntry); err != nil {
+			return errors.Wrapf(err, "_flushPostAssociationCountEntriesToDbWithTxn: Problem putting count "+
+				"for post %v: ", countEntry.PostHash)
+		}
+	}
+	return nil
+}
+
 func (bav *UtxoView) _flushNFTEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
 
 	// Go through and delete all the entries so they can be added back fresh.
@@ -1445,6 +1462,24 @@ func (bav *UtxoView) _flushPostAssociationEntriesToDbWithTxn(txn *badger.Txn, bl
 	return nil
 }
 
+func (bav *UtxoView) _flushTxnReceiptsToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for txnHash, receipt := range bav.TxnHashToTxnReceipt {
+		if receipt.isDeleted {
+			// Receipts are only ever set once per block, so we only need to delete the ones
+			// that were tombstoned when their block was disconnected.
+			if err := DBDeleteTxnReceiptWithTxn(txn, bav.Snapshot, &txnHash, bav.EventManager, true); err != nil {
+				return fmt.Errorf("_flushTxnReceiptsToDbWithTxn: problem deleting receipt for txn %v: %v",
+					txnHash, err)
+			}
+		} else {
+			if err := DBPutTxnReceiptWithTxn(txn, bav.Snapshot, blockHeight, receipt, bav.EventManager); err != nil {
+				return fmt.Errorf("_flushTxnReceiptsToDbWithTxn: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
 func (bav *UtxoView) _flushNonceEntriesToDbWithTxn(txn *badger.Txn) error {
 	for _, nonceEntry := range bav.TransactorNonceMapKeyToTransactorNonceEntry {
 		// Delete the existing mappings in the db for this TransactorNonceEntry. They
@@ -0,0 +1,242 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Flush Batching
+//
+// FlushToDb used to write the whole view in a single badger transaction. Badger limits the number and the total
+// size of the writes in a transaction (see badger.DB.MaxBatchCount and badger.DB.MaxBatchSize), so flushing a view
+// that accumulated a very large number of entries failed with badger.ErrTxnTooBig. FlushToDb now splits such views
+// into batches along the flush steps, i.e. per kind of entry:
+//
+//  1. If the view doesn't hold enough entries to come close to the limits, it's flushed in a single transaction as
+//     before. Otherwise, planFlushBatches dry-runs the flush steps in transactions that are discarded, and starts a
+//     new batch whenever a step doesn't fit in the current one. The dry run doesn't touch the snapshot or fire any
+//     state syncer events.
+//  2. flushToDbInBatches commits the batches one after the other. The steps run in the same order as in a single
+//     transaction flush, and each batch is committed before the next one starts, so a step sees everything the
+//     steps before it wrote. The snapshot's state commitment and ancestral records are flushed last, in a
+//     transaction of their own.
+//
+// A flush that is split into batches isn't atomic, so flushToDbInBatches records its progress under
+// PrefixUtxoViewFlushInProgress in every transaction but the last one, which deletes the record. If the node
+// crashes partway through, the DB holds the batches that were committed along with the record of the interrupted
+// flush. The view that was being flushed is gone by then, so the flush can't be finished: NewServer refuses to start
+// from such a DB, and it has to be restored from a backup or resynced. A flush also refuses to start if an earlier
+// flush in the same process failed partway through. A single step that exceeds the limits on its own can't be
+// split, and still fails.
+
+// utxoViewFlushMaxWritesPerEntry is an upper bound on the number of writes a flush step makes for an entry in the
+// view. Views with fewer than MaxBatchCount / utxoViewFlushMaxWritesPerEntry entries are flushed in a single
+// transaction without a dry run.
+const utxoViewFlushMaxWritesPerEntry = 32
+
+// countFlushEntries returns the total number of entries in the view's maps.
+func (bav *UtxoView) countFlushEntries() int64 {
+	numEntries := int64(0)
+	viewValue := reflect.ValueOf(bav).Elem()
+	for ii := 0; ii < viewValue.NumField(); ii++ {
+		if field := viewValue.Field(ii); field.Kind() == reflect.Map {
+			numEntries += int64(field.Len())
+		}
+	}
+	return numEntries
+}
+
+// planFlushBatches splits the view's flush steps into batches that each fit in a single badger transaction. It
+// returns a single batch with all the steps if the view is small enough.
+func (bav *UtxoView) planFlushBatches(blockHeight uint64) ([][]*utxoViewFlushStep, error) {
+	steps := bav.getFlushSteps()
+	if bav.countFlushEntries()*utxoViewFlushMaxWritesPerEntry < bav.Handle.MaxBatchCount() {
+		return [][]*utxoViewFlushStep{steps}, nil
+	}
+
+	// The dry run flushes a copy of the view without the snapshot and the event manager, so that it has no side
+	// effects besides the writes to the discarded transactions.
+	dryRunView := *bav
+	dryRunView.Snapshot = nil
+	dryRunView.EventManager = nil
+
+	var batches [][]*utxoViewFlushStep
+	var batch []*utxoViewFlushStep
+	txn := bav.Handle.NewTransaction(true)
+	defer func() { txn.Discard() }()
+	for _, step := range steps {
+		err := step.flush(&dryRunView, txn, blockHeight)
+		if errors.Is(err, badger.ErrTxnTooBig) && len(batch) > 0 {
+			// The step doesn't fit in the current batch, so we start a new one with it.
+			batches = append(batches, batch)
+			batch = nil
+			txn.Discard()
+			txn = bav.Handle.NewTransaction(true)
+			err = step.flush(&dryRunView, txn, blockHeight)
+		}
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			return nil, errors.Wrapf(err, "UtxoView.planFlushBatches: Flush step %v doesn't fit in a single "+
+				"transaction", step.name)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "UtxoView.planFlushBatches: Problem dry-running flush step %v", step.name)
+		}
+		batch = append(batch, step)
+	}
+	return append(batches, batch), nil
+}
+
+// flushToDbInBatches flushes the view to the DB, committing a separate transaction for each batch.
+func (bav *UtxoView) flushToDbInBatches(batches [][]*utxoViewFlushStep, blockHeight uint64) (_err error) {
+	span := StartTraceSpan("UtxoView.FlushToDbInBatches", bav.traceSpan)
+	span.SetAttributes(TraceAttribute{Key: TraceAttributeKeyBlockHeight, Value: blockHeight})
+	defer func() { EndTraceSpan(span, _err) }()
+
+	if err := DBCheckNoUtxoViewFlushInProgress(bav.Handle); err != nil {
+		return errors.Wrapf(err, "UtxoView.flushToDbInBatches: ")
+	}
+	if bav.Snapshot != nil {
+		bav.Snapshot.PrepareAncestralRecordsFlush()
+	}
+
+	// The last transaction of the flush deletes the in-progress record that the ones before it set. It's the
+	// snapshot's transaction if we have a snapshot, and the last batch otherwise.
+	numTxns := len(batches)
+	if bav.Snapshot != nil {
+		numTxns++
+	}
+	updateFlushInProgress := func(txn *badger.Txn, numTxnsCommitted int) error {
+		if numTxnsCommitted == numTxns {
+			return DBDeleteUtxoViewFlushInProgressWithTxn(txn)
+		}
+		return DBPutUtxoViewFlushInProgressWithTxn(txn, &UtxoViewFlushInProgress{
+			TipHash:             bav.TipHash,
+			NumBatchesCommitted: uint64(numTxnsCommitted),
+			NumBatches:          uint64(numTxns),
+		})
+	}
+
+	glog.V(1).Infof("UtxoView.flushToDbInBatches: Flushing %d entries in %d batches",
+		bav.countFlushEntries(), len(batches))
+	startTime := time.Now()
+	for ii, batch := range batches {
+		err := bav.Handle.Update(func(txn *badger.Txn) error {
+			for _, step := range batch {
+				if err := step.flush(bav, txn, blockHeight); err != nil {
+					return errors.Wrapf(err, "Problem running flush step %v", step.name)
+				}
+			}
+			return updateFlushInProgress(txn, ii+1)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "UtxoView.flushToDbInBatches: Problem flushing batch %d of %d",
+				ii+1, len(batches))
+		}
+		glog.V(1).Infof("UtxoView.flushToDbInBatches: Flushed batch %d of %d (steps %v to %v) after %v",
+			ii+1, len(batches), batch[0].name, batch[len(batch)-1].name, time.Since(startTime))
+	}
+
+	if bav.Snapshot == nil {
+		return nil
+	}
+	err := bav.Handle.Update(func(txn *badger.Txn) error {
+		// The view's TipHash is the block whose state we just flushed, whether we connected or disconnected blocks.
+		if err := bav.Snapshot.FlushStateCommitmentWithTxn(txn, bav.TipHash); err != nil {
+			return err
+		}
+		if err := bav.Snapshot.FlushAncestralRecordsWithTxn(txn); err != nil {
+			return err
+		}
+		return updateFlushInProgress(txn, numTxns)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.flushToDbInBatches: Problem flushing snapshot")
+	}
+	return nil
+}
+
+// UtxoViewFlushInProgress is the record of a view flush that was split into batches and hasn't committed all of
+// them yet.
+type UtxoViewFlushInProgress struct {
+	// TipHash is the TipHash of the view being flushed.
+	TipHash *BlockHash
+	// NumBatchesCommitted is the number of the flush's transactions that were committed, out of NumBatches.
+	NumBatchesCommitted uint64
+	NumBatches          uint64
+}
+
+func DBGetUtxoViewFlushInProgressWithTxn(txn *badger.Txn) (*UtxoViewFlushInProgress, error) {
+	item, err := txn.Get(Prefixes.PrefixUtxoViewFlushInProgress)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetUtxoViewFlushInProgressWithTxn: Problem getting flush in progress")
+	}
+	flushBytes, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetUtxoViewFlushInProgressWithTxn: Problem copying flush in progress")
+	}
+	if len(flushBytes) != HashSizeBytes+16 {
+		return nil, errors.Errorf("DBGetUtxoViewFlushInProgressWithTxn: Invalid flush in progress length %d",
+			len(flushBytes))
+	}
+	return &UtxoViewFlushInProgress{
+		TipHash:             NewBlockHash(flushBytes[:HashSizeBytes]),
+		NumBatchesCommitted: DecodeUint64(flushBytes[HashSizeBytes : HashSizeBytes+8]),
+		NumBatches:          DecodeUint64(flushBytes[HashSizeBytes+8:]),
+	}, nil
+}
+
+func DBGetUtxoViewFlushInProgress(handle *badger.DB) (*UtxoViewFlushInProgress, error) {
+	var flushInProgress *UtxoViewFlushInProgress
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		flushInProgress, err = DBGetUtxoViewFlushInProgressWithTxn(txn)
+		return err
+	})
+	return flushInProgress, err
+}
+
+func DBPutUtxoViewFlushInProgressWithTxn(txn *badger.Txn, flushInProgress *UtxoViewFlushInProgress) error {
+	tipHash := &BlockHash{}
+	if flushInProgress.TipHash != nil {
+		tipHash = flushInProgress.TipHash
+	}
+	var flushBytes []byte
+	flushBytes = append(flushBytes, tipHash[:]...)
+	flushBytes = append(flushBytes, EncodeUint64(flushInProgress.NumBatchesCommitted)...)
+	flushBytes = append(flushBytes, EncodeUint64(flushInProgress.NumBatches)...)
+	if err := txn.Set(Prefixes.PrefixUtxoViewFlushInProgress, flushBytes); err != nil {
+		return errors.Wrapf(err, "DBPutUtxoViewFlushInProgressWithTxn: Problem setting flush in progress")
+	}
+	return nil
+}
+
+func DBDeleteUtxoViewFlushInProgressWithTxn(txn *badger.Txn) error {
+	if err := txn.Delete(Prefixes.PrefixUtxoViewFlushInProgress); err != nil {
+		return errors.Wrapf(err, "DBDeleteUtxoViewFlushInProgressWithTxn: Problem deleting flush in progress")
+	}
+	return nil
+}
+
+// DBCheckNoUtxoViewFlushInProgress returns an error if a view flush that was split into batches was interrupted
+// before committing all of them, in which case the DB holds part of the flush.
+func DBCheckNoUtxoViewFlushInProgress(handle *badger.DB) error {
+	flushInProgress, err := DBGetUtxoViewFlushInProgress(handle)
+	if err != nil {
+		return err
+	}
+	if flushInProgress != nil {
+		return fmt.Errorf("DBCheckNoUtxoViewFlushInProgress: The flush of the view at tip %v was interrupted "+
+			"after committing %d of its %d batches, so the DB is inconsistent. Restore the DB from a backup or "+
+			"resync the node", flushInProgress.TipHash, flushInProgress.NumBatchesCommitted,
+			flushInProgress.NumBatches)
+	}
+	return nil
+}
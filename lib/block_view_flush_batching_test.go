@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUtxoViewFlushBatching(t *testing.T) {
+	require := require.New(t)
+	setupTestDeSoEncoder(t)
+
+	// Open a DB with a small memtable, so that its transactions are limited to about 1,600 writes.
+	dir, err := os.MkdirTemp("", "badgerdb")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	opts := DefaultBadgerOptions(dir).WithMemTableSize(1 << 20).WithValueThreshold(1 << 10)
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	require.NoError(err)
+	defer db.Close()
+	params := NewTestParams(&DeSoTestnetParams)
+
+	newView := func(numEntries int) (*UtxoView, [][]byte) {
+		utxoView := NewUtxoView(db, &params, nil, nil, nil)
+		var publicKeys [][]byte
+		for ii := 0; ii < numEntries; ii++ {
+			publicKey := RandomBytes(int32(PublicKeyLenCompressed))
+			publicKeys = append(publicKeys, publicKey)
+			utxoView.PublicKeyToDeSoBalanceNanos[*NewPublicKey(publicKey)] = uint64(ii + 1)
+			utxoView.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(publicKey)] = &ForbiddenPubKeyEntry{
+				PubKey: publicKey,
+			}
+		}
+		return utxoView, publicKeys
+	}
+
+	// A small view is flushed in a single transaction.
+	utxoView, _ := newView(10)
+	batches, err := utxoView.planFlushBatches(0)
+	require.NoError(err)
+	require.Len(batches, 1)
+	require.Equal(utxoView.getFlushSteps(), batches[0])
+
+	// Each of the steps fits in a transaction, but not both of them, so they're split into separate batches.
+	utxoView, publicKeys := newView(600)
+	require.ErrorIs(db.Update(func(txn *badger.Txn) error {
+		return utxoView.FlushToDbWithTxn(txn, 0)
+	}), badger.ErrTxnTooBig)
+	batches, err = utxoView.planFlushBatches(0)
+	require.NoError(err)
+	require.Len(batches, 2)
+	require.Equal("DeSoBalances", batches[0][len(batches[0])-1].name)
+	require.Equal("ForbiddenPubKeyEntries", batches[1][0].name)
+	var batchedSteps []*utxoViewFlushStep
+	for _, batch := range batches {
+		batchedSteps = append(batchedSteps, batch...)
+	}
+	require.Equal(utxoView.getFlushSteps(), batchedSteps)
+
+	require.NoError(utxoView.FlushToDb(0))
+	for ii, publicKey := range publicKeys {
+		balanceNanos, err := DbGetDeSoBalanceNanosForPublicKey(db, nil, publicKey)
+		require.NoError(err)
+		require.Equal(uint64(ii+1), balanceNanos)
+		require.NotNil(DbGetForbiddenBlockSignaturePubKey(db, nil, publicKey))
+	}
+	// The flush deleted its in-progress record once all of its batches were committed.
+	flushInProgress, err := DBGetUtxoViewFlushInProgress(db)
+	require.NoError(err)
+	require.Nil(flushInProgress)
+	require.NoError(DBCheckNoUtxoViewFlushInProgress(db))
+
+	// After an interrupted flush, the DB is inconsistent, so batched flushes refuse to run.
+	interruptedFlush := &UtxoViewFlushInProgress{
+		TipHash:             NewBlockHash(RandomBytes(HashSizeBytes)),
+		NumBatchesCommitted: 1,
+		NumBatches:          2,
+	}
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return DBPutUtxoViewFlushInProgressWithTxn(txn, interruptedFlush)
+	}))
+	flushInProgress, err = DBGetUtxoViewFlushInProgress(db)
+	require.NoError(err)
+	require.Equal(interruptedFlush, flushInProgress)
+	require.Error(DBCheckNoUtxoViewFlushInProgress(db))
+	utxoView, _ = newView(600)
+	require.Error(utxoView.FlushToDb(0))
+	require.NoError(db.Update(DBDeleteUtxoViewFlushInProgressWithTxn))
+
+	// A step that doesn't fit in a transaction on its own can't be split.
+	utxoView, _ = newView(4000)
+	_, err = utxoView.planFlushBatches(0)
+	require.ErrorIs(err, badger.ErrTxnTooBig)
+	require.Error(utxoView.FlushToDb(0))
+}
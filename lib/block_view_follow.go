@@ -1,11 +1,15 @@
 package lib
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
-	"reflect"
 )
 
 func (bav *UtxoView) GetFollowEntryForFollowerPublicKeyCreatorPublicKey(followerPublicKey []byte, creatorPublicKey []byte) *FollowEntry {
@@ -165,6 +169,136 @@ func (bav *UtxoView) GetFollowEntriesForPublicKey(publicKey []byte, getEntriesFo
 	return followEntriesToReturn, nil
 }
 
+// GetFollowersPaginated returns up to limit PKIDs that follow pkid, sorted by PKID, starting after the cursor. A nil
+// cursor starts from the first follower, and the last PKID returned is the cursor for the next page. Only one page
+// of followers is read from the DB, and the follows in the view are merged into it.
+func (bav *UtxoView) GetFollowersPaginated(pkid *PKID, cursor *PKID, limit uint32) (
+	_followerPKIDs []*PKID, _err error) {
+
+	if limit == 0 {
+		return []*PKID{}, nil
+	}
+
+	// Collect the followers of pkid in the view that come after the cursor. Each follower deleted in the view may
+	// take up a spot in the page we read from the DB, so we read an extra follower for each of them.
+	viewFollowerPKIDToIsDeleted := make(map[PKID]bool)
+	dbLimit := limit
+	for _, followEntry := range bav.FollowKeyToFollowEntry {
+		if followEntry == nil || !followEntry.FollowedPKID.Eq(pkid) {
+			continue
+		}
+		if cursor != nil && bytes.Compare(followEntry.FollowerPKID[:], cursor[:]) <= 0 {
+			continue
+		}
+		viewFollowerPKIDToIsDeleted[*followEntry.FollowerPKID] = followEntry.isDeleted
+		if followEntry.isDeleted && dbLimit < math.MaxUint32 {
+			dbLimit++
+		}
+	}
+
+	var dbFollowerPKIDs []*PKID
+	if bav.Postgres != nil {
+		follows, err := bav.Postgres.GetFollowersPaginated(pkid, cursor, dbLimit)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetFollowersPaginated: Problem fetching followers from Postgres: ")
+		}
+		for _, follow := range follows {
+			dbFollowerPKIDs = append(dbFollowerPKIDs, follow.FollowerPKID)
+		}
+	} else {
+		var err error
+		dbFollowerPKIDs, err = DbGetPaginatedPKIDsFollowingYou(bav.Handle, pkid, cursor, dbLimit)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetFollowersPaginated: Problem fetching followers from db: ")
+		}
+	}
+
+	// The view takes precedence over the DB.
+	followerPKIDs := []*PKID{}
+	for _, dbFollowerPKID := range dbFollowerPKIDs {
+		if _, existsInView := viewFollowerPKIDToIsDeleted[*dbFollowerPKID]; !existsInView {
+			followerPKIDs = append(followerPKIDs, dbFollowerPKID)
+		}
+	}
+	for viewFollowerPKID, isDeleted := range viewFollowerPKIDToIsDeleted {
+		if !isDeleted {
+			followerPKIDs = append(followerPKIDs, viewFollowerPKID.NewPKID())
+		}
+	}
+	sort.Slice(followerPKIDs, func(ii, jj int) bool {
+		return bytes.Compare(followerPKIDs[ii][:], followerPKIDs[jj][:]) < 0
+	})
+	if uint32(len(followerPKIDs)) > limit {
+		followerPKIDs = followerPKIDs[:limit]
+	}
+	return followerPKIDs, nil
+}
+
+// GetFollowCountEntryForPKID returns the number of PKIDs that follow pkid and the number of PKIDs that pkid follows,
+// including the follows in the view.
+func (bav *UtxoView) GetFollowCountEntryForPKID(pkid *PKID) (*FollowCountEntry, error) {
+	if followCountEntry, exists := bav.PKIDToFollowCountEntry[*pkid]; exists {
+		return followCountEntry, nil
+	}
+
+	var followCountEntry *FollowCountEntry
+	if bav.Postgres != nil {
+		followerCount, followingCount, err := bav.Postgres.GetFollowCounts(pkid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetFollowCountEntryForPKID: Problem fetching counts from Postgres: ")
+		}
+		followCountEntry = &FollowCountEntry{
+			PKID:           pkid.NewPKID(),
+			FollowerCount:  followerCount,
+			FollowingCount: followingCount,
+		}
+	} else {
+		var err error
+		followCountEntry, err = DbGetFollowCountEntryForPKID(bav.Handle, pkid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetFollowCountEntryForPKID: Problem fetching counts from db: ")
+		}
+	}
+	bav.PKIDToFollowCountEntry[*pkid] = followCountEntry
+	return followCountEntry, nil
+}
+
+// _updateFollowCounts updates the following count of the follower and the follower count of the followed when a
+// follow is added or removed.
+func (bav *UtxoView) _updateFollowCounts(followerPKID *PKID, followedPKID *PKID, isFollowAdded bool) error {
+	followerCountEntry, err := bav.GetFollowCountEntryForPKID(followerPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_updateFollowCounts: ")
+	}
+	newFollowerCountEntry := *followerCountEntry
+	if isFollowAdded {
+		newFollowerCountEntry.FollowingCount++
+	} else if newFollowerCountEntry.FollowingCount == 0 {
+		return fmt.Errorf("_updateFollowCounts: FollowingCount of follower %v is already zero; this "+
+			"should never happen", followerPKID)
+	} else {
+		newFollowerCountEntry.FollowingCount--
+	}
+	bav.PKIDToFollowCountEntry[*followerPKID] = &newFollowerCountEntry
+
+	// We look up the followed's counts after setting the follower's, in case they're the same PKID.
+	followedCountEntry, err := bav.GetFollowCountEntryForPKID(followedPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_updateFollowCounts: ")
+	}
+	newFollowedCountEntry := *followedCountEntry
+	if isFollowAdded {
+		newFollowedCountEntry.FollowerCount++
+	} else if newFollowedCountEntry.FollowerCount == 0 {
+		return fmt.Errorf("_updateFollowCounts: FollowerCount of followed %v is already zero; this "+
+			"should never happen", followedPKID)
+	} else {
+		newFollowedCountEntry.FollowerCount--
+	}
+	bav.PKIDToFollowCountEntry[*followedPKID] = &newFollowedCountEntry
+	return nil
+}
+
 func (bav *UtxoView) _setFollowEntryMappings(followEntry *FollowEntry) {
 	// This function shouldn't be called with nil.
 	if followEntry == nil {
@@ -262,6 +396,9 @@ func (bav *UtxoView) _connectFollow(
 
 		// Now that we know that this is a valid unfollow entry, delete mapping.
 		bav._deleteFollowEntryMappings(existingFollowEntry)
+		if err = bav._updateFollowCounts(followerPKID.PKID, followedPKID.PKID, false); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectFollow: ")
+		}
 	} else {
 		if existingFollowEntry != nil && !existingFollowEntry.isDeleted {
 			// If this is a follow, a Follow entry *should not* exist.
@@ -276,6 +413,9 @@ func (bav *UtxoView) _connectFollow(
 			FollowedPKID: followedPKID.PKID,
 		}
 		bav._setFollowEntryMappings(followEntry)
+		if err = bav._updateFollowCounts(followerPKID.PKID, followedPKID.PKID, true); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectFollow: ")
+		}
 	}
 
 	// Add an operation to the list at the end indicating we've added a follow.
@@ -323,6 +463,9 @@ func (bav *UtxoView) _disconnectFollow(
 			FollowedPKID: followedPKID.PKID,
 		}
 		bav._setFollowEntryMappings(&followEntry)
+		if err := bav._updateFollowCounts(followerPKID.PKID, followedPKID.PKID, true); err != nil {
+			return errors.Wrapf(err, "_disconnectFollow: ")
+		}
 		return bav._disconnectBasicTransfer(
 			currentTxn, txnHash, utxoOpsForTxn[:operationIndex], blockHeight)
 	}
@@ -354,6 +497,9 @@ func (bav *UtxoView) _disconnectFollow(
 	// Now that we are confident the FollowEntry lines up with the transaction we're
 	// rolling back, delete the mappings.
 	bav._deleteFollowEntryMappings(followEntry)
+	if err := bav._updateFollowCounts(followerPKID.PKID, followedPKID.PKID, false); err != nil {
+		return errors.Wrapf(err, "_disconnectFollow: ")
+	}
 
 	// Now revert the basic transfer with the remaining operations. Cut off
 	// the FollowMessage operation at the end since we just reverted it.
@@ -1,7 +1,10 @@
 package lib
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"sort"
 	"testing"
 
 	"github.com/dgraph-io/badger/v3"
@@ -453,6 +456,29 @@ func TestFollowTxns(t *testing.T) {
 	registerOrTransfer("", m0Pub, m1Pub, m0Priv)
 	registerOrTransfer("", m0Pub, m1Pub, m0Priv)
 
+	// The follow counts and the paginated followers must match the follow mappings.
+	requireFollowCounts := func(publicKeyBase58Check string, followers [][]byte, followingCount uint64) {
+		pkid := DBGetPKIDEntryForPublicKey(db, chain.snapshot, _strToPk(t, publicKeyBase58Check)).PKID
+		followCountEntry, err := DbGetFollowCountEntryForPKID(db, pkid)
+		require.NoError(err)
+		require.Equal(uint64(len(followers)), followCountEntry.FollowerCount)
+		require.Equal(followingCount, followCountEntry.FollowingCount)
+
+		utxoView := NewUtxoView(db, params, nil, chain.snapshot, nil)
+		var cursor *PKID
+		var followerPks [][]byte
+		for {
+			followerPKIDs, err := utxoView.GetFollowersPaginated(pkid, cursor, 1)
+			require.NoError(err)
+			if len(followerPKIDs) == 0 {
+				break
+			}
+			cursor = followerPKIDs[0]
+			followerPks = append(followerPks, DBGetPublicKeyForPKID(db, chain.snapshot, cursor))
+		}
+		require.ElementsMatch(followers, followerPks)
+	}
+
 	// This function tests the final state of applying all transactions to the view.
 	testConnectedState := func() {
 
@@ -555,6 +581,11 @@ func TestFollowTxns(t *testing.T) {
 				require.Contains(m3Follows, followPks[i])
 			}
 		}
+
+		requireFollowCounts(m0Pub, nil, 0)
+		requireFollowCounts(m1Pub, followingM1, uint64(len(m1Follows)))
+		requireFollowCounts(m2Pub, followingM2, uint64(len(m2Follows)))
+		requireFollowCounts(m3Pub, followingM3, uint64(len(m3Follows)))
 	}
 	testConnectedState()
 
@@ -624,6 +655,10 @@ func TestFollowTxns(t *testing.T) {
 			require.NoError(err)
 			require.Equal(0, len(followPks))
 		}
+
+		for _, publicKeyBase58Check := range []string{m0Pub, m1Pub, m2Pub, m3Pub} {
+			requireFollowCounts(publicKeyBase58Check, nil, 0)
+		}
 	}
 
 	testDisconnectedState()
@@ -724,3 +759,96 @@ func TestFollowTxns(t *testing.T) {
 
 	testDisconnectedState()
 }
+
+func TestFollowCountsAndPaginatedFollowers(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	params := &DeSoTestnetParams
+
+	followedPKID := NewPKID(RandomBytes(int32(PublicKeyLenCompressed)))
+	var followerPKIDs []*PKID
+	for ii := 0; ii < 5; ii++ {
+		followerPKIDs = append(followerPKIDs, NewPKID(RandomBytes(int32(PublicKeyLenCompressed))))
+	}
+	sort.Slice(followerPKIDs, func(ii, jj int) bool {
+		return bytes.Compare(followerPKIDs[ii][:], followerPKIDs[jj][:]) < 0
+	})
+	follow := func(utxoView *UtxoView, followerPKID *PKID, isFollowAdded bool) {
+		followEntry := &FollowEntry{FollowerPKID: followerPKID, FollowedPKID: followedPKID}
+		if isFollowAdded {
+			utxoView._setFollowEntryMappings(followEntry)
+		} else {
+			utxoView._deleteFollowEntryMappings(followEntry)
+		}
+		require.NoError(utxoView._updateFollowCounts(followerPKID, followedPKID, isFollowAdded))
+	}
+	getAllFollowers := func(utxoView *UtxoView, limit uint32) []*PKID {
+		var allFollowerPKIDs []*PKID
+		var cursor *PKID
+		for {
+			page, err := utxoView.GetFollowersPaginated(followedPKID, cursor, limit)
+			require.NoError(err)
+			require.LessOrEqual(len(page), int(limit))
+			if len(page) == 0 {
+				return allFollowerPKIDs
+			}
+			allFollowerPKIDs = append(allFollowerPKIDs, page...)
+			cursor = page[len(page)-1]
+		}
+	}
+	requireCounts := func(pkid *PKID, followerCount uint64, followingCount uint64) {
+		followCountEntry, err := DbGetFollowCountEntryForPKID(db, pkid)
+		require.NoError(err)
+		require.Equal(followerCount, followCountEntry.FollowerCount)
+		require.Equal(followingCount, followCountEntry.FollowingCount)
+	}
+
+	// The first four followers follow and are flushed.
+	utxoView := NewUtxoView(db, params, nil, nil, nil)
+	for _, followerPKID := range followerPKIDs[:4] {
+		follow(utxoView, followerPKID, true)
+	}
+	require.NoError(utxoView.FlushToDb(0))
+	requireCounts(followedPKID, 4, 0)
+	requireCounts(followerPKIDs[0], 0, 1)
+	require.Equal(followerPKIDs[:4], getAllFollowers(NewUtxoView(db, params, nil, nil, nil), 3))
+
+	// Follows in the view are merged into the pages read from the DB.
+	utxoView = NewUtxoView(db, params, nil, nil, nil)
+	follow(utxoView, followerPKIDs[0], false)
+	follow(utxoView, followerPKIDs[1], false)
+	follow(utxoView, followerPKIDs[4], true)
+	followCountEntry, err := utxoView.GetFollowCountEntryForPKID(followedPKID)
+	require.NoError(err)
+	require.Equal(uint64(3), followCountEntry.FollowerCount)
+	requireCounts(followedPKID, 4, 0)
+	expectedFollowerPKIDs := []*PKID{followerPKIDs[2], followerPKIDs[3], followerPKIDs[4]}
+	for _, limit := range []uint32{1, 2, 10} {
+		require.Equal(expectedFollowerPKIDs, getAllFollowers(utxoView, limit))
+	}
+	require.NoError(utxoView.FlushToDb(0))
+	requireCounts(followedPKID, 3, 0)
+	requireCounts(followerPKIDs[0], 0, 0)
+
+	// Removing a follow that doesn't exist in the counts is an error.
+	require.Error(NewUtxoView(db, params, nil, nil, nil)._updateFollowCounts(
+		followerPKIDs[0], followedPKID, false))
+
+	// Rebuilding the counts from the follow mappings gives the same counts, and marks them as built.
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return DbPutFollowCountEntryWithTxn(txn, &FollowCountEntry{PKID: followedPKID, FollowerCount: 100})
+	}))
+	require.NoError(DbBuildFollowCountsIfMissing(db))
+	requireCounts(followedPKID, 3, 0)
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return DbPutFollowCountEntryWithTxn(txn, &FollowCountEntry{PKID: followedPKID, FollowerCount: 100})
+	}))
+	require.NoError(DbBuildFollowCountsIfMissing(db))
+	requireCounts(followedPKID, 100, 0)
+	require.NoError(DbRebuildFollowCounts(db))
+	requireCounts(followedPKID, 3, 0)
+	requireCounts(followerPKIDs[4], 0, 1)
+}
@@ -0,0 +1,432 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Global Params History
+//
+// The GlobalParamsEntry only holds the current global params, and the UtxoOperation of an UpdateGlobalParams only
+// holds the params it replaced, so there's no way to find out which params applied at a past height. Computing the
+// fees of historical transactions and reproducing old validation decisions needs them, so a GlobalParamsHistoryEntry
+// is recorded for each block height with UpdateGlobalParams transactions, holding the params in effect after the
+// block and the hashes of the transactions that updated them, in the order they were connected.
+// GetGlobalParamsHistory returns the entries, and GetGlobalParamsAtHeight returns the params in effect after a block.
+// Note that the PoS consensus rules read the params from the snapshot GlobalParamsEntry of the epoch, see
+// GetSnapshotGlobalParamsEntryByEpochNumber, so a change only applies to them once its snapshot is used.
+//
+// The entries are recorded when an UpdateGlobalParams is connected and deleted when it's disconnected. They're
+// derived from the blocks, so they aren't part of the state, and a node only has the history of the blocks it
+// connected itself. A node that predates the history or hypersynced starts it with a baseline entry, which has no
+// transaction hashes and holds the params at the height the node started recording, see
+// DbBuildGlobalParamsHistoryIfMissing and DbResetGlobalParamsHistory.
+
+//
+// TYPES: GlobalParamsHistoryEntry
+//
+
+// GlobalParamsHistoryEntry records the global params in effect after the block at BlockHeight.
+type GlobalParamsHistoryEntry struct {
+	BlockHeight uint64
+	// TxnHashes are the UpdateGlobalParams transactions of the block, in the order they were connected. A baseline
+	// entry has none.
+	TxnHashes         []*BlockHash
+	GlobalParamsEntry *GlobalParamsEntry
+
+	isDeleted bool
+}
+
+func (entry *GlobalParamsHistoryEntry) Copy() *GlobalParamsHistoryEntry {
+	var txnHashes []*BlockHash
+	for _, txnHash := range entry.TxnHashes {
+		txnHashes = append(txnHashes, txnHash.NewBlockHash())
+	}
+	var globalParamsEntry *GlobalParamsEntry
+	if entry.GlobalParamsEntry != nil {
+		globalParamsEntry = entry.GlobalParamsEntry.Copy()
+	}
+	return &GlobalParamsHistoryEntry{
+		BlockHeight:       entry.BlockHeight,
+		TxnHashes:         txnHashes,
+		GlobalParamsEntry: globalParamsEntry,
+		isDeleted:         entry.isDeleted,
+	}
+}
+
+// IsBaseline returns true if the entry marks the height the history starts at rather than a block that updated the
+// params.
+func (entry *GlobalParamsHistoryEntry) IsBaseline() bool {
+	return len(entry.TxnHashes) == 0
+}
+
+func (entry *GlobalParamsHistoryEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, UintToBuf(uint64(len(entry.TxnHashes)))...)
+	for _, txnHash := range entry.TxnHashes {
+		data = append(data, EncodeToBytes(blockHeight, txnHash, skipMetadata...)...)
+	}
+	data = append(data, EncodeToBytes(blockHeight, entry.GlobalParamsEntry, skipMetadata...)...)
+	return data
+}
+
+func (entry *GlobalParamsHistoryEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// BlockHeight
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "GlobalParamsHistoryEntry.Decode: Problem reading BlockHeight: ")
+	}
+
+	// TxnHashes
+	numTxnHashes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "GlobalParamsHistoryEntry.Decode: Problem reading len(TxnHashes): ")
+	}
+	entry.TxnHashes = nil
+	for ii := uint64(0); ii < numTxnHashes; ii++ {
+		txnHash, err := DecodeDeSoEncoder(&BlockHash{}, rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsHistoryEntry.Decode: Problem reading TxnHash: ")
+		}
+		entry.TxnHashes = append(entry.TxnHashes, txnHash)
+	}
+
+	// GlobalParamsEntry
+	entry.GlobalParamsEntry, err = DecodeDeSoEncoder(&GlobalParamsEntry{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "GlobalParamsHistoryEntry.Decode: Problem reading GlobalParamsEntry: ")
+	}
+
+	return nil
+}
+
+func (entry *GlobalParamsHistoryEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *GlobalParamsHistoryEntry) GetEncoderType() EncoderType {
+	return EncoderTypeGlobalParamsHistoryEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForGlobalParamsHistory(blockHeight uint64) []byte {
+	data := append([]byte{}, Prefixes.PrefixGlobalParamsHistoryByHeight...)
+	data = append(data, EncodeUint64(blockHeight)...)
+	return data
+}
+
+func DBGetGlobalParamsHistoryEntryWithTxn(txn *badger.Txn, blockHeight uint64) (*GlobalParamsHistoryEntry, error) {
+	entryBytes, err := DBGetWithTxn(txn, nil, DBKeyForGlobalParamsHistory(blockHeight))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetGlobalParamsHistoryEntryWithTxn: problem retrieving entry: ")
+	}
+	entry, err := DecodeDeSoEncoder(&GlobalParamsHistoryEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetGlobalParamsHistoryEntryWithTxn: problem decoding entry: ")
+	}
+	return entry, nil
+}
+
+func DBGetGlobalParamsHistoryEntry(handle *badger.DB, blockHeight uint64) (*GlobalParamsHistoryEntry, error) {
+	var entry *GlobalParamsHistoryEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		entry, err = DBGetGlobalParamsHistoryEntryWithTxn(txn, blockHeight)
+		return err
+	})
+	return entry, err
+}
+
+// DBGetGlobalParamsHistory returns all of the global params history entries, ordered by block height.
+func DBGetGlobalParamsHistory(handle *badger.DB) ([]*GlobalParamsHistoryEntry, error) {
+	var entries []*GlobalParamsHistoryEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = append([]byte{}, Prefixes.PrefixGlobalParamsHistoryByHeight...)
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(opts.Prefix); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := DecodeDeSoEncoder(&GlobalParamsHistoryEntry{}, bytes.NewReader(entryBytes))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetGlobalParamsHistory: problem retrieving history: ")
+	}
+	return entries, nil
+}
+
+func DBPutGlobalParamsHistoryEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *GlobalParamsHistoryEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutGlobalParamsHistoryEntryWithTxn: called with nil entry")
+		return nil
+	}
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForGlobalParamsHistory(entry.BlockHeight), EncodeToBytes(blockHeight, entry), eventManager,
+	); err != nil {
+		return errors.Wrapf(err, "DBPutGlobalParamsHistoryEntryWithTxn: problem storing entry: ")
+	}
+	return nil
+}
+
+func DBDeleteGlobalParamsHistoryEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *GlobalParamsHistoryEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	if err := DBDeleteWithTxn(
+		txn, snap, DBKeyForGlobalParamsHistory(entry.BlockHeight), eventManager, entryIsDeleted,
+	); err != nil {
+		return errors.Wrapf(err, "DBDeleteGlobalParamsHistoryEntryWithTxn: problem deleting entry: ")
+	}
+	return nil
+}
+
+// DbBuildGlobalParamsHistoryIfMissing starts the global params history of a node that predates it with a baseline
+// entry at tipHeight holding the params in the DB. It does nothing if the history already has entries.
+func DbBuildGlobalParamsHistoryIfMissing(handle *badger.DB, tipHeight uint64) error {
+	hasHistory := false
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = Prefixes.PrefixGlobalParamsHistoryByHeight
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		iterator.Seek(opts.Prefix)
+		hasHistory = iterator.ValidForPrefix(opts.Prefix)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbBuildGlobalParamsHistoryIfMissing: Problem checking for history: ")
+	}
+	if hasHistory {
+		return nil
+	}
+	return DbResetGlobalParamsHistory(handle, tipHeight)
+}
+
+// DbResetGlobalParamsHistory replaces the global params history with a baseline entry at blockHeight holding the
+// params in the DB. It's used when the params were written without the history, e.g. by a hypersync.
+func DbResetGlobalParamsHistory(handle *badger.DB, blockHeight uint64) error {
+	glog.Infof("DbResetGlobalParamsHistory: Starting global params history at height %d", blockHeight)
+	if err := handle.DropPrefix(Prefixes.PrefixGlobalParamsHistoryByHeight); err != nil {
+		return errors.Wrapf(err, "DbResetGlobalParamsHistory: Problem deleting existing history: ")
+	}
+	err := handle.Update(func(txn *badger.Txn) error {
+		baselineEntry := &GlobalParamsHistoryEntry{
+			BlockHeight:       blockHeight,
+			GlobalParamsEntry: DbGetGlobalParamsEntryWithTxn(txn, nil),
+		}
+		return DBPutGlobalParamsHistoryEntryWithTxn(txn, nil, baselineEntry, blockHeight, nil)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbResetGlobalParamsHistory: Problem writing baseline: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setGlobalParamsHistoryMappings(entry *GlobalParamsHistoryEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setGlobalParamsHistoryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.BlockHeightToGlobalParamsHistoryEntry[entry.BlockHeight] = entry
+}
+
+func (bav *UtxoView) _deleteGlobalParamsHistoryMappings(blockHeight uint64) {
+	bav._setGlobalParamsHistoryMappings(&GlobalParamsHistoryEntry{BlockHeight: blockHeight, isDeleted: true})
+}
+
+// _getGlobalParamsHistoryEntry returns the history entry of the block at blockHeight, or nil if the block has none.
+func (bav *UtxoView) _getGlobalParamsHistoryEntry(blockHeight uint64) (*GlobalParamsHistoryEntry, error) {
+	if entry, exists := bav.BlockHeightToGlobalParamsHistoryEntry[blockHeight]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+	entry, err := DBGetGlobalParamsHistoryEntry(bav.Handle, blockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getGlobalParamsHistoryEntry: ")
+	}
+	if entry != nil {
+		bav._setGlobalParamsHistoryMappings(entry)
+	}
+	return entry, nil
+}
+
+// _addGlobalParamsHistory records that the UpdateGlobalParams with txnHash set the params to globalParamsEntry in
+// the block at blockHeight. The history isn't part of the state, so a problem reading it is logged rather than
+// failing the txn, and the entry of the block is started over.
+func (bav *UtxoView) _addGlobalParamsHistory(
+	txnHash *BlockHash,
+	blockHeight uint64,
+	globalParamsEntry *GlobalParamsEntry,
+) {
+	entry, err := bav._getGlobalParamsHistoryEntry(blockHeight)
+	if err != nil {
+		glog.Errorf("_addGlobalParamsHistory: Problem reading history at height %d, starting it over: %v",
+			blockHeight, err)
+		entry = nil
+	}
+	// The entry is copied so that the entry in the parent view isn't modified.
+	newEntry := &GlobalParamsHistoryEntry{BlockHeight: blockHeight}
+	if entry != nil {
+		newEntry = entry.Copy()
+	}
+	newEntry.TxnHashes = append(newEntry.TxnHashes, txnHash.NewBlockHash())
+	newEntry.GlobalParamsEntry = globalParamsEntry.Copy()
+	bav._setGlobalParamsHistoryMappings(newEntry)
+}
+
+// _removeGlobalParamsHistory undoes _addGlobalParamsHistory for the UpdateGlobalParams with txnHash, restoring the
+// params of the block at blockHeight to prevGlobalParamsEntry. The history isn't part of the state, so if it can't
+// be read or doesn't have the txn, e.g. because the txn was connected before the node started recording the
+// history, it's left as is.
+func (bav *UtxoView) _removeGlobalParamsHistory(
+	txnHash *BlockHash,
+	blockHeight uint64,
+	prevGlobalParamsEntry *GlobalParamsEntry,
+) {
+	entry, err := bav._getGlobalParamsHistoryEntry(blockHeight)
+	if err != nil {
+		glog.Errorf("_removeGlobalParamsHistory: Problem reading history at height %d, leaving it as is: %v",
+			blockHeight, err)
+		return
+	}
+	if entry == nil || entry.IsBaseline() || !entry.TxnHashes[len(entry.TxnHashes)-1].IsEqual(txnHash) {
+		glog.V(1).Infof("_removeGlobalParamsHistory: History at height %d doesn't end with txn %v, "+
+			"leaving it as is", blockHeight, txnHash)
+		return
+	}
+	if len(entry.TxnHashes) == 1 {
+		bav._deleteGlobalParamsHistoryMappings(blockHeight)
+		return
+	}
+	newEntry := entry.Copy()
+	newEntry.TxnHashes = newEntry.TxnHashes[:len(newEntry.TxnHashes)-1]
+	newEntry.GlobalParamsEntry = prevGlobalParamsEntry.Copy()
+	bav._setGlobalParamsHistoryMappings(newEntry)
+}
+
+// GetGlobalParamsHistory returns the global params history entries, ordered by block height. The result only
+// reflects the blocks this node recorded the history for, see the comment at the top of this file.
+func (bav *UtxoView) GetGlobalParamsHistory() ([]*GlobalParamsHistoryEntry, error) {
+	// Merge the entries in the db with the ones in the UtxoView, which are more up to date.
+	dbEntries, err := DBGetGlobalParamsHistory(bav.Handle)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetGlobalParamsHistory: ")
+	}
+	entries := make(map[uint64]*GlobalParamsHistoryEntry, len(dbEntries))
+	for _, entry := range dbEntries {
+		entries[entry.BlockHeight] = entry
+	}
+	for blockHeight, entry := range bav.BlockHeightToGlobalParamsHistoryEntry {
+		entries[blockHeight] = entry
+	}
+
+	var history []*GlobalParamsHistoryEntry
+	for _, entry := range entries {
+		if !entry.isDeleted {
+			history = append(history, entry.Copy())
+		}
+	}
+	sort.Slice(history, func(ii, jj int) bool {
+		return history[ii].BlockHeight < history[jj].BlockHeight
+	})
+	return history, nil
+}
+
+// GetGlobalParamsAtHeight returns the global params in effect after the block at blockHeight, i.e. the ones set by
+// the last UpdateGlobalParams at or before blockHeight. It returns an error if the history starts after
+// blockHeight with a baseline, since the params before the baseline weren't recorded.
+func (bav *UtxoView) GetGlobalParamsAtHeight(blockHeight uint64) (*GlobalParamsEntry, error) {
+	history, err := bav.GetGlobalParamsHistory()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetGlobalParamsAtHeight: ")
+	}
+	// Without any history, the params have never been updated since the node started recording it.
+	if len(history) == 0 {
+		return bav.GlobalParamsEntry.Copy(), nil
+	}
+	// Find the first entry after blockHeight, the params are the ones of the entry before it.
+	index := sort.Search(len(history), func(ii int) bool {
+		return history[ii].BlockHeight > blockHeight
+	})
+	if index > 0 {
+		return history[index-1].GlobalParamsEntry.Copy(), nil
+	}
+	if history[0].IsBaseline() {
+		return nil, fmt.Errorf("GetGlobalParamsAtHeight: global params history starts at height %d, after "+
+			"height %d", history[0].BlockHeight, blockHeight)
+	}
+	// The history goes back to the first update, so the params were the initial ones.
+	return InitialGlobalParamsEntry.Copy(), nil
+}
+
+func (bav *UtxoView) _flushGlobalParamsHistoryEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, entry := range bav.BlockHeightToGlobalParamsHistoryEntry {
+		// Sanity-check that the entry matches the map key.
+		if entry.BlockHeight != mapKey {
+			return fmt.Errorf(
+				"_flushGlobalParamsHistoryEntriesToDbWithTxn: entry height %d doesn't match MapKey %d",
+				entry.BlockHeight, mapKey,
+			)
+		}
+
+		if entry.isDeleted {
+			if err := DBDeleteGlobalParamsHistoryEntryWithTxn(
+				txn, bav.Snapshot, entry, bav.EventManager, true,
+			); err != nil {
+				return errors.Wrapf(err, "_flushGlobalParamsHistoryEntriesToDbWithTxn: ")
+			}
+			continue
+		}
+		if err := DBPutGlobalParamsHistoryEntryWithTxn(
+			txn, bav.Snapshot, entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushGlobalParamsHistoryEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
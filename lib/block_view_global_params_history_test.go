@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalParamsHistory(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ExtraRegtestParamUpdaterKeys = make(map[PkMapKey]bool)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(MustBase58CheckDecode(moneyPkString))] = true
+	for ii := 0; ii < 2; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// The txns are connected as if they were in the next block.
+	updateCreateProfileFee := func(createProfileFeeNanos int64) (*MsgDeSoTxn, []*UtxoOperation, uint32) {
+		utxoOps, txn, blockHeight, err := _updateGlobalParamsEntry(
+			t, chain, db, params, 100 /*feeRateNanosPerKB*/, moneyPkString, moneyPrivString,
+			-1, -1, createProfileFeeNanos, -1, -1, true /*flushToDb*/)
+		require.NoError(err)
+		return txn, utxoOps, blockHeight
+	}
+	disconnect := func(txn *MsgDeSoTxn, utxoOps []*UtxoOperation, blockHeight uint32) {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(txn, txn.Hash(), utxoOps, blockHeight))
+		require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+	}
+	getHistory := func() []*GlobalParamsHistoryEntry {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		history, err := utxoView.GetGlobalParamsHistory()
+		require.NoError(err)
+		return history
+	}
+	getCreateProfileFeeAtHeight := func(blockHeight uint32) uint64 {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		globalParamsEntry, err := utxoView.GetGlobalParamsAtHeight(uint64(blockHeight))
+		require.NoError(err)
+		return globalParamsEntry.CreateProfileFeeNanos
+	}
+
+	// Two updates in one block are recorded in one entry, in order, and one in the next block in another.
+	txn1, _, height1 := updateCreateProfileFee(100)
+	txn2, utxoOps2, _ := updateCreateProfileFee(200)
+	_, err := miner.MineAndProcessSingleBlock(0, mempool)
+	require.NoError(err)
+	txn3, utxoOps3, height2 := updateCreateProfileFee(300)
+	require.Equal(height1+1, height2)
+
+	history := getHistory()
+	require.Len(history, 2)
+	require.Equal(uint64(height1), history[0].BlockHeight)
+	require.Len(history[0].TxnHashes, 2)
+	require.True(history[0].TxnHashes[0].IsEqual(txn1.Hash()))
+	require.True(history[0].TxnHashes[1].IsEqual(txn2.Hash()))
+	require.Equal(uint64(200), history[0].GlobalParamsEntry.CreateProfileFeeNanos)
+	require.Equal(uint64(height2), history[1].BlockHeight)
+	require.True(history[1].TxnHashes[0].IsEqual(txn3.Hash()))
+
+	// The params before the first update are the initial ones.
+	require.Equal(InitialGlobalParamsEntry.CreateProfileFeeNanos, getCreateProfileFeeAtHeight(height1-1))
+	require.Equal(uint64(200), getCreateProfileFeeAtHeight(height1))
+	require.Equal(uint64(300), getCreateProfileFeeAtHeight(height2))
+	require.Equal(uint64(300), getCreateProfileFeeAtHeight(height2+10))
+
+	// Disconnecting the updates removes them from the history.
+	disconnect(txn3, utxoOps3, height2)
+	disconnect(txn2, utxoOps2, height1)
+	history = getHistory()
+	require.Len(history, 1)
+	require.Len(history[0].TxnHashes, 1)
+	require.True(history[0].TxnHashes[0].IsEqual(txn1.Hash()))
+	require.Equal(uint64(100), history[0].GlobalParamsEntry.CreateProfileFeeNanos)
+	require.Equal(uint64(100), getCreateProfileFeeAtHeight(height2))
+
+	// An existing history is left as is.
+	require.NoError(DbBuildGlobalParamsHistoryIfMissing(db, uint64(height2)))
+	require.Len(getHistory(), 1)
+
+	// After a reset, the history starts with a baseline holding the params in the DB.
+	require.NoError(DbResetGlobalParamsHistory(db, uint64(height2)))
+	history = getHistory()
+	require.Len(history, 1)
+	require.True(history[0].IsBaseline())
+	require.Equal(uint64(100), getCreateProfileFeeAtHeight(height2))
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	_, err = utxoView.GetGlobalParamsAtHeight(uint64(height1))
+	require.Error(err)
+}
@@ -0,0 +1,641 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// SetKeyValueRecords: Writes a batch of key-value records into the namespace of the transactor's
+// PKID. Each PKID owns its namespace, so a record can only be written or deleted by its owner. A
+// record with an empty value deletes the existing record with the same key, if any. This gives
+// apps a place to store small pieces of on-chain data without overloading the ExtraData of the
+// transactor's profile.
+//
+// Records are bounded by DeSoParams.MaxKeyValueRecordKeyLengthBytes,
+// DeSoParams.MaxKeyValueRecordValueLengthBytes, and DeSoParams.MaxKeyValueRecordsPerTxn. On top of the
+// regular transaction fee, the transactor burns DeSoParams.KeyValueRecordFeeNanosPerByte for every byte
+// of key and value in the transaction, so that the cost of a record scales with the state it adds.
+
+//
+// TYPES: SetKeyValueRecordsMetadata
+//
+
+type KeyValueRecord struct {
+	Key []byte
+	// An empty Value deletes the record with the given Key.
+	Value []byte
+}
+
+type SetKeyValueRecordsMetadata struct {
+	Records []*KeyValueRecord
+}
+
+func (txnData *SetKeyValueRecordsMetadata) GetTxnType() TxnType {
+	return TxnTypeSetKeyValueRecords
+}
+
+func (txnData *SetKeyValueRecordsMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(txnData.Records)))...)
+	for _, record := range txnData.Records {
+		data = append(data, EncodeByteArray(record.Key)...)
+		data = append(data, EncodeByteArray(record.Value)...)
+	}
+	return data, nil
+}
+
+func (txnData *SetKeyValueRecordsMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	// Records
+	numRecords, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "SetKeyValueRecordsMetadata.FromBytes: Problem reading len(Records): ")
+	}
+	records, err := SafeMakeSliceWithLength[*KeyValueRecord](numRecords)
+	if err != nil {
+		return errors.Wrapf(err, "SetKeyValueRecordsMetadata.FromBytes: Problem creating Records slice: ")
+	}
+	for ii := range records {
+		record := &KeyValueRecord{}
+		if record.Key, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "SetKeyValueRecordsMetadata.FromBytes: Problem reading Key: ")
+		}
+		if record.Value, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "SetKeyValueRecordsMetadata.FromBytes: Problem reading Value: ")
+		}
+		records[ii] = record
+	}
+	txnData.Records = records
+
+	return nil
+}
+
+func (txnData *SetKeyValueRecordsMetadata) New() DeSoTxnMetadata {
+	return &SetKeyValueRecordsMetadata{}
+}
+
+//
+// TYPES: KeyValueRecordEntry
+//
+
+type KeyValueRecordEntry struct {
+	// The PKID of the transactor who wrote the record. The OwnerPKID and the Key
+	// together are the primary key for a KeyValueRecordEntry.
+	OwnerPKID *PKID
+	Key       []byte
+	Value     []byte
+	isDeleted bool
+}
+
+type KeyValueRecordMapKey struct {
+	OwnerPKID PKID
+	Key       string
+}
+
+func (keyValueRecordEntry *KeyValueRecordEntry) Copy() *KeyValueRecordEntry {
+	return &KeyValueRecordEntry{
+		OwnerPKID: keyValueRecordEntry.OwnerPKID.NewPKID(),
+		Key:       append([]byte{}, keyValueRecordEntry.Key...),
+		Value:     append([]byte{}, keyValueRecordEntry.Value...),
+		isDeleted: keyValueRecordEntry.isDeleted,
+	}
+}
+
+func (keyValueRecordEntry *KeyValueRecordEntry) ToMapKey() KeyValueRecordMapKey {
+	return KeyValueRecordMapKey{
+		OwnerPKID: *keyValueRecordEntry.OwnerPKID,
+		Key:       string(keyValueRecordEntry.Key),
+	}
+}
+
+func (keyValueRecordEntry *KeyValueRecordEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, keyValueRecordEntry.OwnerPKID, skipMetadata...)...)
+	data = append(data, EncodeByteArray(keyValueRecordEntry.Key)...)
+	data = append(data, EncodeByteArray(keyValueRecordEntry.Value)...)
+	return data
+}
+
+func (keyValueRecordEntry *KeyValueRecordEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// OwnerPKID
+	keyValueRecordEntry.OwnerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "KeyValueRecordEntry.Decode: Problem reading OwnerPKID: ")
+	}
+
+	// Key
+	keyValueRecordEntry.Key, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "KeyValueRecordEntry.Decode: Problem reading Key: ")
+	}
+
+	// Value
+	keyValueRecordEntry.Value, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "KeyValueRecordEntry.Decode: Problem reading Value: ")
+	}
+
+	return nil
+}
+
+func (keyValueRecordEntry *KeyValueRecordEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (keyValueRecordEntry *KeyValueRecordEntry) GetEncoderType() EncoderType {
+	return EncoderTypeKeyValueRecordEntry
+}
+
+func (keyValueRecordEntry *KeyValueRecordEntry) IsDeleted() bool {
+	return keyValueRecordEntry.isDeleted
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForKeyValueRecord(ownerPKID *PKID, key []byte) []byte {
+	dbKey := DBPrefixKeyForKeyValueRecordsByOwnerPKID(ownerPKID)
+	dbKey = append(dbKey, key...)
+	return dbKey
+}
+
+func DBPrefixKeyForKeyValueRecordsByOwnerPKID(ownerPKID *PKID) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixKeyValueRecordByOwnerPKIDAndKey...)
+	return append(prefixCopy, ownerPKID.ToBytes()...)
+}
+
+func DBGetKeyValueRecordEntry(handle *badger.DB, snap *Snapshot, ownerPKID *PKID, key []byte) (*KeyValueRecordEntry, error) {
+	var ret *KeyValueRecordEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetKeyValueRecordEntryWithTxn(txn, snap, ownerPKID, key)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetKeyValueRecordEntryWithTxn(txn *badger.Txn, snap *Snapshot, ownerPKID *PKID, key []byte) (*KeyValueRecordEntry, error) {
+	// Retrieve KeyValueRecordEntry from db.
+	keyValueRecordBytes, err := DBGetWithTxn(txn, snap, DBKeyForKeyValueRecord(ownerPKID, key))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetKeyValueRecordEntryWithTxn: problem retrieving KeyValueRecordEntry")
+	}
+
+	// Decode KeyValueRecordEntry from bytes.
+	keyValueRecordEntry := &KeyValueRecordEntry{}
+	rr := bytes.NewReader(keyValueRecordBytes)
+	if exist, err := DecodeFromBytes(keyValueRecordEntry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetKeyValueRecordEntryWithTxn: problem decoding KeyValueRecordEntry")
+	}
+	return keyValueRecordEntry, nil
+}
+
+func DBGetKeyValueRecordEntriesForOwner(handle *badger.DB, ownerPKID *PKID) ([]*KeyValueRecordEntry, error) {
+	var ret []*KeyValueRecordEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetKeyValueRecordEntriesForOwnerWithTxn(txn, ownerPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetKeyValueRecordEntriesForOwnerWithTxn(txn *badger.Txn, ownerPKID *PKID) ([]*KeyValueRecordEntry, error) {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, DBPrefixKeyForKeyValueRecordsByOwnerPKID(ownerPKID), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetKeyValueRecordEntriesForOwnerWithTxn: problem retrieving KeyValueRecordEntries")
+	}
+
+	var keyValueRecordEntries []*KeyValueRecordEntry
+	for _, keyValueRecordBytes := range valsFound {
+		rr := bytes.NewReader(keyValueRecordBytes)
+		keyValueRecordEntry, err := DecodeDeSoEncoder(&KeyValueRecordEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetKeyValueRecordEntriesForOwnerWithTxn: problem decoding KeyValueRecordEntry")
+		}
+		keyValueRecordEntries = append(keyValueRecordEntries, keyValueRecordEntry)
+	}
+	return keyValueRecordEntries, nil
+}
+
+func DBPutKeyValueRecordEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	keyValueRecordEntry *KeyValueRecordEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if keyValueRecordEntry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutKeyValueRecordEntryWithTxn: called with nil KeyValueRecordEntry")
+		return nil
+	}
+
+	key := DBKeyForKeyValueRecord(keyValueRecordEntry.OwnerPKID, keyValueRecordEntry.Key)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, keyValueRecordEntry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutKeyValueRecordEntryWithTxn: problem storing KeyValueRecordEntry in index PrefixKeyValueRecordByOwnerPKIDAndKey",
+		)
+	}
+	return nil
+}
+
+func DBDeleteKeyValueRecordEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	keyValueRecordEntry *KeyValueRecordEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if keyValueRecordEntry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteKeyValueRecordEntryWithTxn: called with nil KeyValueRecordEntry")
+		return nil
+	}
+
+	key := DBKeyForKeyValueRecord(keyValueRecordEntry.OwnerPKID, keyValueRecordEntry.Key)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteKeyValueRecordEntryWithTxn: problem deleting KeyValueRecordEntry from index PrefixKeyValueRecordByOwnerPKIDAndKey",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateSetKeyValueRecordsTxn(
+	transactorPublicKey []byte,
+	metadata *SetKeyValueRecordsMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the SetKeyValueRecords fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Validate txn metadata.
+	if err := ValidateSetKeyValueRecordsMetadata(bc.params, metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateSetKeyValueRecordsTxn: invalid txn metadata: ",
+		)
+	}
+
+	// The records fee is burned on top of the regular fee, so we add it to the spend amount.
+	recordsFeeNanos, err := GetKeyValueRecordsFeeNanos(bc.params, metadata)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateSetKeyValueRecordsTxn: problem computing records fee: ",
+		)
+	}
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransactionWithSubsidy(
+		txn, minFeeRateNanosPerKB, 0, mempool, recordsFeeNanos,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateSetKeyValueRecordsTxn: problem adding inputs: ",
+		)
+	}
+
+	// Sanity-check that the spendAmount is just the records fee.
+	if err = amountEqualsAdditionalOutputs(spendAmount-recordsFeeNanos, additionalOutputs); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateSetKeyValueRecordsTxn: %v", err)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectSetKeyValueRecords(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.KeyValueRecordsBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorKeyValueRecordsBeforeBlockHeight, "_connectSetKeyValueRecords: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeSetKeyValueRecords {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectSetKeyValueRecords: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*SetKeyValueRecordsMetadata)
+
+	// Validate the records.
+	if err := ValidateSetKeyValueRecordsMetadata(bav.Params, txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSetKeyValueRecords: ")
+	}
+
+	// Connect a basic transfer that burns the records fee to get the total input and
+	// the total output without considering the txn metadata.
+	recordsFeeNanos, err := GetKeyValueRecordsFeeNanos(bav.Params, txMeta)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSetKeyValueRecords: ")
+	}
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransferWithExtraSpend(
+		txn, txHash, blockHeight, recordsFeeNanos, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSetKeyValueRecords: ")
+	}
+	if verifySignatures {
+		// _connectBasicTransfer has already checked that the txn is signed
+		// by the top-level public key, which we take to be the owner's
+		// public key so there is no need to verify anything further.
+	}
+
+	// Convert TransactorPublicKey to OwnerPKID.
+	ownerPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if ownerPKIDEntry == nil || ownerPKIDEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorKeyValueRecordsInvalidOwnerPKID, "_connectSetKeyValueRecords: ")
+	}
+
+	// Set or delete each record, keeping track of the existing records so that
+	// we can restore them if we disconnect this txn.
+	var prevKeyValueRecordEntries []*KeyValueRecordEntry
+	for _, record := range txMeta.Records {
+		prevKeyValueRecordEntry, err := bav.GetKeyValueRecordEntry(ownerPKIDEntry.PKID, record.Key)
+		if err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectSetKeyValueRecords: ")
+		}
+		if prevKeyValueRecordEntry != nil {
+			prevKeyValueRecordEntries = append(prevKeyValueRecordEntries, prevKeyValueRecordEntry)
+			bav._deleteKeyValueRecordEntryMappings(prevKeyValueRecordEntry)
+		}
+		if len(record.Value) == 0 {
+			continue
+		}
+		bav._setKeyValueRecordEntryMappings(&KeyValueRecordEntry{
+			OwnerPKID: ownerPKIDEntry.PKID.NewPKID(),
+			Key:       append([]byte{}, record.Key...),
+			Value:     append([]byte{}, record.Value...),
+		})
+	}
+
+	// Add a UTXO operation
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:                      OperationTypeSetKeyValueRecords,
+		PrevKeyValueRecordEntries: prevKeyValueRecordEntries,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectSetKeyValueRecords(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.KeyValueRecordsBlockHeight {
+		return errors.Wrapf(RuleErrorKeyValueRecordsBeforeBlockHeight, "_disconnectSetKeyValueRecords: ")
+	}
+
+	// Validate the last operation is a SetKeyValueRecords operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectSetKeyValueRecords: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeSetKeyValueRecords {
+		return fmt.Errorf(
+			"_disconnectSetKeyValueRecords: trying to revert %v but found %v",
+			OperationTypeSetKeyValueRecords,
+			utxoOpsForTxn[operationIndex].Type,
+		)
+	}
+	operationData, err := GetUtxoOperationData[SetKeyValueRecordsOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectSetKeyValueRecords: ")
+	}
+	txMeta := currentTxn.TxnMeta.(*SetKeyValueRecordsMetadata)
+
+	// Convert TransactorPublicKey to OwnerPKID.
+	ownerPKIDEntry := bav.GetPKIDForPublicKey(currentTxn.PublicKey)
+	if ownerPKIDEntry == nil || ownerPKIDEntry.isDeleted {
+		return errors.Wrapf(RuleErrorKeyValueRecordsInvalidOwnerPKID, "_disconnectSetKeyValueRecords: ")
+	}
+
+	// Delete the records set by the txn and restore the records that existed before it.
+	for _, record := range txMeta.Records {
+		bav._deleteKeyValueRecordEntryMappings(&KeyValueRecordEntry{
+			OwnerPKID: ownerPKIDEntry.PKID.NewPKID(),
+			Key:       append([]byte{}, record.Key...),
+		})
+	}
+	for _, prevKeyValueRecordEntry := range operationData.PrevKeyValueRecordEntries {
+		if !prevKeyValueRecordEntry.OwnerPKID.Eq(ownerPKIDEntry.PKID) {
+			return fmt.Errorf("_disconnectSetKeyValueRecords: PrevKeyValueRecordEntry has OwnerPKID %v "+
+				"but the transactor has PKID %v", prevKeyValueRecordEntry.OwnerPKID, ownerPKIDEntry.PKID)
+		}
+		bav._setKeyValueRecordEntryMappings(prevKeyValueRecordEntry)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// ValidateSetKeyValueRecordsMetadata checks the records of a SetKeyValueRecords txn against the
+// limits in the params. It doesn't depend on the state, so it's shared by txn construction and
+// connection.
+func ValidateSetKeyValueRecordsMetadata(params *DeSoParams, metadata *SetKeyValueRecordsMetadata) error {
+	if len(metadata.Records) == 0 {
+		return RuleErrorKeyValueRecordsNoRecords
+	}
+	if uint64(len(metadata.Records)) > params.MaxKeyValueRecordsPerTxn {
+		return errors.Wrapf(RuleErrorKeyValueRecordsTooManyRecords,
+			"ValidateSetKeyValueRecordsMetadata: %d records > %d", len(metadata.Records), params.MaxKeyValueRecordsPerTxn)
+	}
+	keysSeen := make(map[string]bool, len(metadata.Records))
+	for _, record := range metadata.Records {
+		if len(record.Key) == 0 {
+			return RuleErrorKeyValueRecordKeyEmpty
+		}
+		if uint64(len(record.Key)) > params.MaxKeyValueRecordKeyLengthBytes {
+			return errors.Wrapf(RuleErrorKeyValueRecordKeyTooLong,
+				"ValidateSetKeyValueRecordsMetadata: %d bytes > %d", len(record.Key), params.MaxKeyValueRecordKeyLengthBytes)
+		}
+		if uint64(len(record.Value)) > params.MaxKeyValueRecordValueLengthBytes {
+			return errors.Wrapf(RuleErrorKeyValueRecordValueTooLong,
+				"ValidateSetKeyValueRecordsMetadata: %d bytes > %d", len(record.Value), params.MaxKeyValueRecordValueLengthBytes)
+		}
+		// Records are applied in order, so a repeated key would make all but the last
+		// write pointless and complicate disconnecting the txn.
+		if keysSeen[string(record.Key)] {
+			return RuleErrorKeyValueRecordDuplicateKey
+		}
+		keysSeen[string(record.Key)] = true
+	}
+	return nil
+}
+
+// GetKeyValueRecordsFeeNanos returns the fee that a SetKeyValueRecords txn burns for the records it
+// writes, on top of the regular txn fee.
+func GetKeyValueRecordsFeeNanos(params *DeSoParams, metadata *SetKeyValueRecordsMetadata) (uint64, error) {
+	numBytes := uint64(0)
+	for _, record := range metadata.Records {
+		// The lengths are bounded by ValidateSetKeyValueRecordsMetadata, but we check for overflow
+		// anyway since this function may be called with unvalidated metadata.
+		recordBytes, err := SafeUint64().Add(uint64(len(record.Key)), uint64(len(record.Value)))
+		if err != nil {
+			return 0, errors.Wrapf(err, "GetKeyValueRecordsFeeNanos: ")
+		}
+		if numBytes, err = SafeUint64().Add(numBytes, recordBytes); err != nil {
+			return 0, errors.Wrapf(err, "GetKeyValueRecordsFeeNanos: ")
+		}
+	}
+	feeNanos, err := SafeUint64().Mul(numBytes, params.KeyValueRecordFeeNanosPerByte)
+	if err != nil || feeNanos > math.MaxInt64 {
+		return 0, fmt.Errorf("GetKeyValueRecordsFeeNanos: fee overflows for %d bytes", numBytes)
+	}
+	return feeNanos, nil
+}
+
+func (bav *UtxoView) GetKeyValueRecordEntry(ownerPKID *PKID, key []byte) (*KeyValueRecordEntry, error) {
+	// First check the UtxoView.
+	mapKey := KeyValueRecordMapKey{OwnerPKID: *ownerPKID, Key: string(key)}
+	if keyValueRecordEntry, exists := bav.KeyValueRecordMapKeyToKeyValueRecordEntry[mapKey]; exists {
+		if keyValueRecordEntry.isDeleted {
+			return nil, nil
+		}
+		return keyValueRecordEntry, nil
+	}
+
+	// If no KeyValueRecordEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbKeyValueRecordEntry, err := DBGetKeyValueRecordEntry(bav.Handle, bav.Snapshot, ownerPKID, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetKeyValueRecordEntry: ")
+	}
+	if dbKeyValueRecordEntry != nil {
+		// Cache the KeyValueRecordEntry from the db in the UtxoView.
+		bav._setKeyValueRecordEntryMappings(dbKeyValueRecordEntry)
+	}
+	return dbKeyValueRecordEntry, nil
+}
+
+// GetKeyValueRecordEntriesForOwner returns all of the records in the namespace of the owner,
+// merging the records in the view with the records in the database.
+func (bav *UtxoView) GetKeyValueRecordEntriesForOwner(ownerPKID *PKID) ([]*KeyValueRecordEntry, error) {
+	// Load the records from the database into the view. We don't overwrite the
+	// records in the view since they're more recent than the database.
+	dbKeyValueRecordEntries, err := DBGetKeyValueRecordEntriesForOwner(bav.Handle, ownerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetKeyValueRecordEntriesForOwner: ")
+	}
+	for _, keyValueRecordEntry := range dbKeyValueRecordEntries {
+		if _, exists := bav.KeyValueRecordMapKeyToKeyValueRecordEntry[keyValueRecordEntry.ToMapKey()]; !exists {
+			bav._setKeyValueRecordEntryMappings(keyValueRecordEntry)
+		}
+	}
+
+	var keyValueRecordEntries []*KeyValueRecordEntry
+	for _, keyValueRecordEntry := range bav.KeyValueRecordMapKeyToKeyValueRecordEntry {
+		if !keyValueRecordEntry.isDeleted && keyValueRecordEntry.OwnerPKID.Eq(ownerPKID) {
+			keyValueRecordEntries = append(keyValueRecordEntries, keyValueRecordEntry)
+		}
+	}
+	return keyValueRecordEntries, nil
+}
+
+func (bav *UtxoView) _setKeyValueRecordEntryMappings(keyValueRecordEntry *KeyValueRecordEntry) {
+	// This function shouldn't be called with nil.
+	if keyValueRecordEntry == nil {
+		glog.Errorf("_setKeyValueRecordEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.KeyValueRecordMapKeyToKeyValueRecordEntry[keyValueRecordEntry.ToMapKey()] = keyValueRecordEntry
+}
+
+func (bav *UtxoView) _deleteKeyValueRecordEntryMappings(keyValueRecordEntry *KeyValueRecordEntry) {
+	// This function shouldn't be called with nil.
+	if keyValueRecordEntry == nil {
+		glog.Errorf("_deleteKeyValueRecordEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *keyValueRecordEntry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setKeyValueRecordEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushKeyValueRecordEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, keyValueRecordEntryIter := range bav.KeyValueRecordMapKeyToKeyValueRecordEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		keyValueRecordEntry := *keyValueRecordEntryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(keyValueRecordEntry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushKeyValueRecordEntriesToDbWithTxn: KeyValueRecordEntry key %v doesn't match MapKey %v",
+				keyValueRecordEntry.ToMapKey(),
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if keyValueRecordEntry.isDeleted {
+			if err := DBDeleteKeyValueRecordEntryWithTxn(
+				txn, bav.Snapshot, &keyValueRecordEntry, bav.EventManager, keyValueRecordEntry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushKeyValueRecordEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutKeyValueRecordEntryWithTxn(
+				txn, bav.Snapshot, &keyValueRecordEntry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushKeyValueRecordEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyValueRecords(t *testing.T) {
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	t.Run("flushToDB=false", func(t *testing.T) {
+		_testKeyValueRecords(t, false)
+	})
+	t.Run("flushToDB=true", func(t *testing.T) {
+		_testKeyValueRecords(t, true)
+	})
+}
+
+func _testKeyValueRecords(t *testing.T, flushToDB bool) {
+	var err error
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	setKeyValueRecordsBlockHeight := func(blockHeight uint32) {
+		params.ForkHeights.KeyValueRecordsBlockHeight = blockHeight
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}
+	defer setKeyValueRecordsBlockHeight(math.MaxUint32)
+
+	utxoView := func() *UtxoView {
+		newUtxoView, err := mempool.GetAugmentedUniversalView()
+		require.NoError(t, err)
+		return newUtxoView
+	}
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	blockHeight := uint64(chain.blockTip().Height + 1)
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       uint32(blockHeight),
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+
+	records := func(keyValues ...string) *SetKeyValueRecordsMetadata {
+		metadata := &SetKeyValueRecordsMetadata{}
+		for ii := 0; ii+1 < len(keyValues); ii += 2 {
+			metadata.Records = append(metadata.Records, &KeyValueRecord{
+				Key: []byte(keyValues[ii]), Value: []byte(keyValues[ii+1]),
+			})
+		}
+		return metadata
+	}
+	requireRecords := func(ownerPKID *PKID, keyValues ...string) {
+		keyValueRecordEntries, err := utxoView().GetKeyValueRecordEntriesForOwner(ownerPKID)
+		require.NoError(t, err)
+		sort.Slice(keyValueRecordEntries, func(ii, jj int) bool {
+			return bytes.Compare(keyValueRecordEntries[ii].Key, keyValueRecordEntries[jj].Key) < 0
+		})
+		var actualKeyValues []string
+		for _, keyValueRecordEntry := range keyValueRecordEntries {
+			actualKeyValues = append(actualKeyValues, string(keyValueRecordEntry.Key), string(keyValueRecordEntry.Value))
+		}
+		require.Equal(t, keyValues, actualKeyValues)
+	}
+
+	{
+		// RuleErrorKeyValueRecordsBeforeBlockHeight
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records("a", "1"), flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorKeyValueRecordsBeforeBlockHeight)
+
+		setKeyValueRecordsBlockHeight(uint32(1))
+	}
+	{
+		// RuleErrorKeyValueRecordsNoRecords
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records(), flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorKeyValueRecordsNoRecords)
+	}
+	{
+		// RuleErrorKeyValueRecordsTooManyRecords
+		metadata := &SetKeyValueRecordsMetadata{}
+		for ii := uint64(0); ii <= params.MaxKeyValueRecordsPerTxn; ii++ {
+			metadata.Records = append(metadata.Records, &KeyValueRecord{Key: UintToBuf(ii), Value: []byte("1")})
+		}
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, metadata, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorKeyValueRecordsTooManyRecords)
+	}
+	{
+		// RuleErrorKeyValueRecordKeyEmpty
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records("", "1"), flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorKeyValueRecordKeyEmpty)
+	}
+	{
+		// RuleErrorKeyValueRecordKeyTooLong
+		key := string(make([]byte, params.MaxKeyValueRecordKeyLengthBytes+1))
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records(key, "1"), flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorKeyValueRecordKeyTooLong)
+	}
+	{
+		// RuleErrorKeyValueRecordValueTooLong
+		value := string(make([]byte, params.MaxKeyValueRecordValueLengthBytes+1))
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records("a", value), flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorKeyValueRecordValueTooLong)
+	}
+	{
+		// RuleErrorKeyValueRecordDuplicateKey
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records("a", "1", "a", "2"), flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorKeyValueRecordDuplicateKey)
+	}
+	{
+		// Happy path: m0 sets two records.
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records("a", "1", "b", "2"), flushToDB)
+		require.NoError(t, err)
+		requireRecords(m0PKID, "a", "1", "b", "2")
+
+		keyValueRecordEntry, err := utxoView().GetKeyValueRecordEntry(m0PKID, []byte("b"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("2"), keyValueRecordEntry.Value)
+	}
+	{
+		// Happy path: m0 updates one record, deletes another, and adds a third.
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m0Pub, m0Priv, records("a", "3", "b", "", "c", "4"), flushToDB)
+		require.NoError(t, err)
+		requireRecords(m0PKID, "a", "3", "c", "4")
+
+		keyValueRecordEntry, err := utxoView().GetKeyValueRecordEntry(m0PKID, []byte("b"))
+		require.NoError(t, err)
+		require.Nil(t, keyValueRecordEntry)
+	}
+	{
+		// Happy path: m1 writes the same key into its own namespace.
+		_, err = _submitSetKeyValueRecordsTxn(testMeta, m1Pub, m1Priv, records("a", "5"), flushToDB)
+		require.NoError(t, err)
+		requireRecords(m0PKID, "a", "3", "c", "4")
+		requireRecords(m1PKID, "a", "5")
+	}
+
+	// Flush mempool to the db and test rollbacks.
+	require.NoError(t, mempool.universalUtxoView.FlushToDb(blockHeight))
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func _submitSetKeyValueRecordsTxn(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *SetKeyValueRecordsMetadata,
+	flushToDB bool,
+) (_fees uint64, _err error) {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, testMeta.mempool, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, changeAmountMake, feesMake, err := testMeta.chain.CreateSetKeyValueRecordsTxn(
+		transactorPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		testMeta.mempool,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return 0, err
+	}
+	recordsFeeNanos, err := GetKeyValueRecordsFeeNanos(testMeta.params, metadata)
+	require.NoError(testMeta.t, err)
+	require.Equal(testMeta.t, totalInputMake, changeAmountMake+feesMake+recordsFeeNanos)
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	utxoOps, totalInput, _, fees, err := testMeta.mempool.universalUtxoView.ConnectTransaction(
+		txn, txn.Hash(), testMeta.savedHeight, 0, true, false)
+	if err != nil {
+		return 0, err
+	}
+	require.Equal(testMeta.t, totalInput, totalInputMake)
+	require.Equal(testMeta.t, OperationTypeSetKeyValueRecords, utxoOps[len(utxoOps)-1].Type)
+	if flushToDB {
+		require.NoError(testMeta.t, testMeta.mempool.universalUtxoView.FlushToDb(uint64(testMeta.savedHeight)))
+	}
+	require.NoError(testMeta.t, testMeta.mempool.RegenerateReadOnlyView())
+
+	// The transactor pays the txn fee and burns the records fee.
+	require.Equal(
+		testMeta.t,
+		prevBalance-txn.TxnFeeNanos-recordsFeeNanos,
+		_getBalance(testMeta.t, testMeta.chain, testMeta.mempool, transactorPublicKeyBase58Check),
+	)
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return fees, nil
+}
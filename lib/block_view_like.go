@@ -219,6 +219,10 @@ func (bav *UtxoView) _disconnectLike(
 			"OperationTypeLike but found type %v",
 			utxoOpsForTxn[operationIndex].Type)
 	}
+	operationData, err := GetUtxoOperationData[LikeOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectLike: ")
+	}
 
 	// Now we know the txMeta is a Like
 	txMeta := currentTxn.TxnMeta.(*LikeMetadata)
@@ -234,7 +238,7 @@ func (bav *UtxoView) _disconnectLike(
 		// If this is an "unlike," we just need to add back the previous like entry and like
 		// like count. We do some sanity checks first though to be extra safe.
 
-		prevLikeEntry := utxoOpsForTxn[operationIndex].PrevLikeEntry
+		prevLikeEntry := operationData.PrevLikeEntry
 		// Sanity check: verify that the user on the likeEntry matches the transaction sender.
 		if !reflect.DeepEqual(prevLikeEntry.LikerPubKey, currentTxn.PublicKey) {
 			return fmt.Errorf("_disconnectLike: User public key on "+
@@ -252,7 +256,7 @@ func (bav *UtxoView) _disconnectLike(
 
 		// Set the like entry and like count to their previous state.
 		bav._setLikeEntryMappings(prevLikeEntry)
-		likedPostEntry.LikeCount = utxoOpsForTxn[operationIndex].PrevLikeCount
+		likedPostEntry.LikeCount = operationData.PrevLikeCount
 		bav._setPostEntryMappings(likedPostEntry)
 	} else {
 		// If this is a normal "like," we do some sanity checks and then delete the entry.
@@ -284,7 +288,7 @@ func (bav *UtxoView) _disconnectLike(
 		// Now that we're confident the FollowEntry lines up with the transaction we're
 		// rolling back, delete the mappings and set the like counter to its previous value.
 		bav._deleteLikeEntryMappings(likeEntry)
-		likedPostEntry.LikeCount = utxoOpsForTxn[operationIndex].PrevLikeCount
+		likedPostEntry.LikeCount = operationData.PrevLikeCount
 		bav._setPostEntryMappings(likedPostEntry)
 	}
 
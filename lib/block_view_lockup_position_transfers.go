@@ -0,0 +1,334 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Lockup Position Transfers: A CoinLockupTransfer moves locked coins from one PKID to another, but it was limited to
+// unvested LockedBalanceEntries without a vesting schedule. That rules out the OTC sale of a vesting position, which
+// is the most common kind of locked DAO coin position for teams and investors. From the
+// LockupPositionTransfersBlockHeight on, a CoinLockupTransfer can transfer any locked position with its lockup terms
+// intact:
+//   - A vested LockedBalanceEntry is selected with the LockupTransferVestingEndTimestampNanoSecsKey in the txn's
+//     ExtraData, and the coins are credited to the recipient's LockedBalanceEntry with the same
+//     UnlockTimestampNanoSecs and VestingEndTimestampNanoSecs. No two vested LockedBalanceEntries of a holder may
+//     overlap in time, so the recipient can't have any other vested LockedBalanceEntry for the profile that overlaps
+//     the transferred one. Because transfers never create new vesting intervals, this can't be used to fragment the
+//     recipient's vested LockedBalanceEntries any more than the profile owner's own vested lockups can.
+//   - An unvested LockedBalanceEntry with a LockupVestingScheduleEntry can only be transferred as a whole, and the
+//     schedule moves to the recipient along with the coins. Scheduled coins are never combined with other coins, so
+//     the recipient can't have a locked balance or a schedule for the same UnlockTimestampNanoSecs.
+//
+// The transfer restrictions of the profile apply to every position, as they always have.
+//
+// Holders' locked positions can be enumerated with GetLockedPositionsForHodlerPKID, which pairs each
+// LockedBalanceEntry with its vesting schedule, if it has one.
+
+//
+// TYPES: LockedPosition
+//
+
+// LockedPosition is a LockedBalanceEntry along with the LockupVestingScheduleEntry that governs it, if any.
+type LockedPosition struct {
+	LockedBalanceEntry   *LockedBalanceEntry
+	VestingScheduleEntry *LockupVestingScheduleEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBPrefixForLockedBalanceEntriesOnHodlerAndProfile(hodlerPKID *PKID, profilePKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixLockedBalanceEntry...)
+	key = append(key, hodlerPKID[:]...)
+	return append(key, profilePKID[:]...)
+}
+
+func DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKID(
+	handle *badger.DB,
+	hodlerPKID *PKID,
+	profilePKID *PKID,
+) (
+	_lockedBalanceEntries []*LockedBalanceEntry,
+	_err error,
+) {
+	if hodlerPKID == nil || profilePKID == nil {
+		return nil, errors.New("DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKID: " +
+			"called with nil hodlerPKID or profilePKID; this shouldn't happen")
+	}
+
+	var lockedBalanceEntries []*LockedBalanceEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		lockedBalanceEntries, err = DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKIDWithTxn(
+			txn, hodlerPKID, profilePKID)
+		return err
+	})
+	return lockedBalanceEntries, err
+}
+
+func DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKIDWithTxn(
+	txn *badger.Txn,
+	hodlerPKID *PKID,
+	profilePKID *PKID,
+) (
+	_lockedBalanceEntries []*LockedBalanceEntry,
+	_err error,
+) {
+	// Valid for prefix <prefix, hodler, profile>
+	prefixKey := DBPrefixForLockedBalanceEntriesOnHodlerAndProfile(hodlerPKID, profilePKID)
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefixKey
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	var lockedBalanceEntries []*LockedBalanceEntry
+	for iterator.Seek(prefixKey); iterator.ValidForPrefix(prefixKey); iterator.Next() {
+		lockedBalanceEntryBytes, err := iterator.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKIDWithTxn: "+
+				"error retrieving LockedBalanceEntry: ")
+		}
+		lockedBalanceEntry, err := DecodeDeSoEncoder(&LockedBalanceEntry{}, bytes.NewReader(lockedBalanceEntryBytes))
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKIDWithTxn: "+
+				"error decoding LockedBalanceEntry: ")
+		}
+
+		// Sanity check the locked balance entry as relevant.
+		if !lockedBalanceEntry.HODLerPKID.Eq(hodlerPKID) || !lockedBalanceEntry.ProfilePKID.Eq(profilePKID) {
+			return nil, errors.New("DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKIDWithTxn: " +
+				"found invalid LockedBalanceEntry; this shouldn't happen")
+		}
+		lockedBalanceEntries = append(lockedBalanceEntries, lockedBalanceEntry)
+	}
+	return lockedBalanceEntries, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKID returns the hodler's LockedBalanceEntries for the profile,
+// sorted by UnlockTimestampNanoSecs and then VestingEndTimestampNanoSecs.
+func (bav *UtxoView) GetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKID(hodlerPKID *PKID, profilePKID *PKID) (
+	[]*LockedBalanceEntry, error) {
+
+	// Pull entries from the db and cache the ones that aren't in the view yet.
+	dbLockedBalanceEntries, err := DBGetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKID(
+		bav.Handle, hodlerPKID, profilePKID)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKID")
+	}
+	for _, lockedBalanceEntry := range dbLockedBalanceEntries {
+		if _, exists := bav.LockedBalanceEntryKeyToLockedBalanceEntry[lockedBalanceEntry.ToMapKey()]; !exists {
+			bav._setLockedBalanceEntry(lockedBalanceEntry)
+		}
+	}
+
+	// Pull relevant entries from the view.
+	var lockedBalanceEntries []*LockedBalanceEntry
+	for _, lockedBalanceEntry := range bav.LockedBalanceEntryKeyToLockedBalanceEntry {
+		if lockedBalanceEntry.HODLerPKID.Eq(hodlerPKID) && lockedBalanceEntry.ProfilePKID.Eq(profilePKID) &&
+			!lockedBalanceEntry.isDeleted {
+			lockedBalanceEntries = append(lockedBalanceEntries, lockedBalanceEntry)
+		}
+	}
+	sort.Slice(lockedBalanceEntries, func(ii, jj int) bool {
+		if lockedBalanceEntries[ii].UnlockTimestampNanoSecs != lockedBalanceEntries[jj].UnlockTimestampNanoSecs {
+			return lockedBalanceEntries[ii].UnlockTimestampNanoSecs < lockedBalanceEntries[jj].UnlockTimestampNanoSecs
+		}
+		return lockedBalanceEntries[ii].VestingEndTimestampNanoSecs <
+			lockedBalanceEntries[jj].VestingEndTimestampNanoSecs
+	})
+	return lockedBalanceEntries, nil
+}
+
+// GetLockedPositionsForHodlerPKID returns the hodler's locked positions with a non-zero balance, along with their
+// vesting schedules. If profilePKID is nil, the positions of every profile are returned.
+func (bav *UtxoView) GetLockedPositionsForHodlerPKID(hodlerPKID *PKID, profilePKID *PKID) ([]*LockedPosition, error) {
+	var lockedBalanceEntries []*LockedBalanceEntry
+	var err error
+	if profilePKID == nil {
+		lockedBalanceEntries, err = bav.GetAllLockedBalanceEntriesForHodlerPKID(hodlerPKID)
+	} else {
+		lockedBalanceEntries, err = bav.GetAllLockedBalanceEntriesForHodlerPKIDAndProfilePKID(hodlerPKID, profilePKID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "GetLockedPositionsForHodlerPKID")
+	}
+
+	var lockedPositions []*LockedPosition
+	for _, lockedBalanceEntry := range lockedBalanceEntries {
+		if lockedBalanceEntry.BalanceBaseUnits.IsZero() {
+			continue
+		}
+		lockedPosition := &LockedPosition{LockedBalanceEntry: lockedBalanceEntry}
+		if lockedBalanceEntry.UnlockTimestampNanoSecs == lockedBalanceEntry.VestingEndTimestampNanoSecs {
+			lockedPosition.VestingScheduleEntry, err = bav.GetLockupVestingScheduleEntry(
+				lockedBalanceEntry.HODLerPKID, lockedBalanceEntry.ProfilePKID,
+				lockedBalanceEntry.UnlockTimestampNanoSecs)
+			if err != nil {
+				return nil, errors.Wrap(err, "GetLockedPositionsForHodlerPKID")
+			}
+		}
+		lockedPositions = append(lockedPositions, lockedPosition)
+	}
+	return lockedPositions, nil
+}
+
+//
+// CONNECT LOGIC
+//
+
+// _getLockupTransferVestingEndTimestampNanoSecs returns the VestingEndTimestampNanoSecs of the LockedBalanceEntry
+// the CoinLockupTransfer sources its coins from. It's the UnlockTimestampNanoSecs unless the txn selects a vested
+// LockedBalanceEntry in its ExtraData.
+func (bav *UtxoView) _getLockupTransferVestingEndTimestampNanoSecs(txn *MsgDeSoTxn,
+	txMeta *CoinLockupTransferMetadata, blockHeight uint32) (int64, error) {
+
+	vestingEndTimestampNanoSecs, hasVestingEndTimestamp, err := txn.GetExtraDataUint64(
+		LockupTransferVestingEndTimestampNanoSecsKey)
+	if err != nil {
+		return 0, errors.Wrapf(RuleErrorCoinLockupTransferInvalidVestingEndTimestamp, "%v", err)
+	}
+	if !hasVestingEndTimestamp {
+		return txMeta.UnlockTimestampNanoSecs, nil
+	}
+	if blockHeight < bav.Params.ForkHeights.LockupPositionTransfersBlockHeight {
+		return 0, RuleErrorCoinLockupTransferVestedPositionBeforeBlockHeight
+	}
+	if int64(vestingEndTimestampNanoSecs) < txMeta.UnlockTimestampNanoSecs {
+		return 0, errors.Wrapf(RuleErrorCoinLockupTransferInvalidVestingEndTimestamp,
+			"vesting end timestamp %d is before unlock timestamp %d", int64(vestingEndTimestampNanoSecs),
+			txMeta.UnlockTimestampNanoSecs)
+	}
+	return int64(vestingEndTimestampNanoSecs), nil
+}
+
+// _validateLockupPositionTransfer checks that the position can be transferred with its lockup terms intact, given
+// the sender's and receiver's LockedBalanceEntries before the transfer. It returns the sender's vesting schedule,
+// which must be moved to the receiver, or nil if the position doesn't have one.
+func (bav *UtxoView) _validateLockupPositionTransfer(txMeta *CoinLockupTransferMetadata,
+	senderLockedBalanceEntry *LockedBalanceEntry, receiverLockedBalanceEntry *LockedBalanceEntry) (
+	*LockupVestingScheduleEntry, error) {
+
+	// The receiver can't have a vested LockedBalanceEntry that overlaps the transferred one, other than the one
+	// with the same terms that the coins are credited to.
+	if receiverLockedBalanceEntry.UnlockTimestampNanoSecs != receiverLockedBalanceEntry.VestingEndTimestampNanoSecs {
+		overlappingLockedBalanceEntries, err := bav.GetLimitedVestedLockedBalanceEntriesOverTimeInterval(
+			receiverLockedBalanceEntry.HODLerPKID,
+			receiverLockedBalanceEntry.ProfilePKID,
+			receiverLockedBalanceEntry.UnlockTimestampNanoSecs,
+			receiverLockedBalanceEntry.VestingEndTimestampNanoSecs,
+			1)
+		if err != nil && errors.Is(err, RuleErrorCoinLockupViolatesVestingIntersectionLimit) {
+			return nil, RuleErrorCoinLockupTransferVestedPositionOverlap
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch vested locked balance entries")
+		}
+		for _, overlappingLockedBalanceEntry := range overlappingLockedBalanceEntries {
+			if overlappingLockedBalanceEntry.ToMapKey() != receiverLockedBalanceEntry.ToMapKey() {
+				return nil, RuleErrorCoinLockupTransferVestedPositionOverlap
+			}
+		}
+		return nil, nil
+	}
+
+	// Scheduled coins can only be transferred as a whole, to a receiver without other coins or a schedule for the
+	// same UnlockTimestampNanoSecs.
+	senderVestingScheduleEntry, err := bav.GetLockupVestingScheduleEntry(
+		senderLockedBalanceEntry.HODLerPKID, senderLockedBalanceEntry.ProfilePKID,
+		senderLockedBalanceEntry.UnlockTimestampNanoSecs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch sender lockupVestingScheduleEntry")
+	}
+	receiverVestingScheduleEntry, err := bav.GetLockupVestingScheduleEntry(
+		receiverLockedBalanceEntry.HODLerPKID, receiverLockedBalanceEntry.ProfilePKID,
+		receiverLockedBalanceEntry.UnlockTimestampNanoSecs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch receiver lockupVestingScheduleEntry")
+	}
+	if senderVestingScheduleEntry == nil {
+		if receiverVestingScheduleEntry != nil {
+			return nil, RuleErrorCoinLockupTransferOfVestingScheduleBalance
+		}
+		return nil, nil
+	}
+	if !txMeta.LockedCoinsToTransferBaseUnits.Eq(&senderLockedBalanceEntry.BalanceBaseUnits) {
+		return nil, errors.Wrapf(RuleErrorCoinLockupTransferOfVestingScheduleBalance,
+			"a position with a vesting schedule must be transferred as a whole")
+	}
+	if receiverVestingScheduleEntry != nil || !receiverLockedBalanceEntry.BalanceBaseUnits.IsZero() {
+		return nil, RuleErrorCoinLockupTransferVestingScheduleConflict
+	}
+	return senderVestingScheduleEntry, nil
+}
+
+// _moveLockupVestingScheduleEntry moves the vesting schedule to the hodler, replacing the original schedule with a
+// tombstone.
+func (bav *UtxoView) _moveLockupVestingScheduleEntry(vestingScheduleEntry *LockupVestingScheduleEntry,
+	hodlerPKID *PKID) {
+
+	movedVestingScheduleEntry := vestingScheduleEntry.Copy()
+	movedVestingScheduleEntry.HODLerPKID = hodlerPKID.NewPKID()
+	bav._deleteLockupVestingScheduleEntryMappings(vestingScheduleEntry)
+	bav._setLockupVestingScheduleEntryMappings(movedVestingScheduleEntry)
+}
+
+// _disconnectLockupPositionTransfer moves the vesting schedule of the transferred position back to the sender,
+// if the transfer moved one. Transfers can't be made to a receiver that already has a schedule for the
+// UnlockTimestampNanoSecs, so the receiver having one means it came from the sender.
+func (bav *UtxoView) _disconnectLockupPositionTransfer(prevSenderLockedBalanceEntry *LockedBalanceEntry,
+	prevReceiverLockedBalanceEntry *LockedBalanceEntry) error {
+
+	if prevReceiverLockedBalanceEntry.UnlockTimestampNanoSecs !=
+		prevReceiverLockedBalanceEntry.VestingEndTimestampNanoSecs {
+		return nil
+	}
+	receiverVestingScheduleEntry, err := bav.GetLockupVestingScheduleEntry(
+		prevReceiverLockedBalanceEntry.HODLerPKID, prevReceiverLockedBalanceEntry.ProfilePKID,
+		prevReceiverLockedBalanceEntry.UnlockTimestampNanoSecs)
+	if err != nil {
+		return errors.Wrap(err, "_disconnectLockupPositionTransfer failed to fetch lockupVestingScheduleEntry")
+	}
+	if receiverVestingScheduleEntry == nil {
+		return nil
+	}
+	senderVestingScheduleEntry, err := bav.GetLockupVestingScheduleEntry(
+		prevSenderLockedBalanceEntry.HODLerPKID, prevSenderLockedBalanceEntry.ProfilePKID,
+		prevSenderLockedBalanceEntry.UnlockTimestampNanoSecs)
+	if err != nil {
+		return errors.Wrap(err, "_disconnectLockupPositionTransfer failed to fetch lockupVestingScheduleEntry")
+	}
+	if senderVestingScheduleEntry != nil {
+		return fmt.Errorf("_disconnectLockupPositionTransfer: Found lockup vesting schedule entries for both " +
+			"the sender and the receiver; this shouldn't be possible")
+	}
+	bav._moveLockupVestingScheduleEntry(receiverVestingScheduleEntry, prevSenderLockedBalanceEntry.HODLerPKID)
+	return nil
+}
+
+// SetLockupTransferVestingEndTimestampExtraData selects the vested LockedBalanceEntry with the
+// vestingEndTimestampNanoSecs as the source of a CoinLockupTransfer, in the txn's ExtraData, which must not be nil.
+// Pass the ExtraData to CreateCoinLockupTransferTxn to transfer the vested position.
+func SetLockupTransferVestingEndTimestampExtraData(extraData map[string][]byte,
+	vestingEndTimestampNanoSecs int64) error {
+
+	if vestingEndTimestampNanoSecs < 0 {
+		return fmt.Errorf("SetLockupTransferVestingEndTimestampExtraData: Negative vesting end timestamp %d",
+			vestingEndTimestampNanoSecs)
+	}
+	if err := SetExtraDataUint64(extraData, LockupTransferVestingEndTimestampNanoSecsKey,
+		uint64(vestingEndTimestampNanoSecs)); err != nil {
+		return errors.Wrapf(err, "SetLockupTransferVestingEndTimestampExtraData: ")
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockupPositionTransfers(t *testing.T) {
+	require := require.New(t)
+
+	// Initialize test chain, miner, and testMeta.
+	testMeta := _setUpMinerAndTestMetaForTimestampBasedLockupTests(t)
+	testMeta.params.ForkHeights.LockupVestingSchedulesBlockHeight = uint32(11)
+	testMeta.params.ForkHeights.LockupPositionTransfersBlockHeight = uint32(20)
+
+	// Initialize m0, m1, m2, m3, m4, and paramUpdater.
+	_setUpProfilesAndMintM0M1DAOCoins(testMeta)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(testMeta.db, nil, m0PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(testMeta.db, nil, m2PkBytes).PKID
+	m3PKID := DBGetPKIDEntryForPublicKey(testMeta.db, nil, m3PkBytes).PKID
+
+	// The txns are connected as if they were in the next block, so mine blocks until the next block is at the height.
+	mineToBlockHeight := func(blockHeight uint32) {
+		for testMeta.chain.BlockTip().Height+1 < blockHeight {
+			_, err := testMeta.miner.MineAndProcessSingleBlock(0, testMeta.mempool)
+			require.NoError(err)
+		}
+		require.Equal(blockHeight, testMeta.chain.BlockTip().Height+1)
+	}
+	coinLockup := func(recipientPkBytes []byte, unlockTimestamp int64, vestingEndTimestamp int64,
+		extraData map[string][]byte, blockHeight uint32) {
+
+		mineToBlockHeight(blockHeight)
+		utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		txn, _, _, _, err := testMeta.chain.CreateCoinLockupTxn(m0PkBytes, m0PkBytes, recipientPkBytes,
+			unlockTimestamp, vestingEndTimestamp, uint256.NewInt(1000), extraData,
+			testMeta.feeRateNanosPerKb, nil, []*DeSoOutput{})
+		require.NoError(err)
+		_signTxn(t, txn, m0Priv)
+		_, _, _, _, err = utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+		require.NoError(err)
+		require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+	}
+	coinLockupTransfer := func(senderPub string, senderPriv string, recipientPkBytes []byte,
+		unlockTimestamp int64, vestingEndTimestamp int64, amount uint64, blockHeight uint32) (
+		*MsgDeSoTxn, []*UtxoOperation, error) {
+
+		mineToBlockHeight(blockHeight)
+		utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		senderPkBytes, _, err := Base58CheckDecode(senderPub)
+		require.NoError(err)
+		extraData := make(map[string][]byte)
+		if vestingEndTimestamp != unlockTimestamp {
+			require.NoError(SetLockupTransferVestingEndTimestampExtraData(extraData, vestingEndTimestamp))
+		}
+		txn, _, _, _, err := testMeta.chain.CreateCoinLockupTransferTxn(senderPkBytes, recipientPkBytes,
+			m0PkBytes, unlockTimestamp, uint256.NewInt(amount), extraData, testMeta.feeRateNanosPerKb, nil,
+			[]*DeSoOutput{})
+		require.NoError(err)
+		_signTxn(t, txn, senderPriv)
+		utxoOps, _, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+		return txn, utxoOps, nil
+	}
+	disconnect := func(txn *MsgDeSoTxn, utxoOps []*UtxoOperation, blockHeight uint32) {
+		utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(txn, txn.Hash(), utxoOps, blockHeight))
+		require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+	}
+	getLockedBalance := func(hodlerPKID *PKID, unlockTimestamp int64, vestingEndTimestamp int64) uint64 {
+		lockedBalanceEntry, err := DBGetLockedBalanceEntryForLockedBalanceEntryKey(testMeta.db, nil,
+			LockedBalanceEntryKey{
+				HODLerPKID:                  *hodlerPKID,
+				ProfilePKID:                 *m0PKID,
+				UnlockTimestampNanoSecs:     unlockTimestamp,
+				VestingEndTimestampNanoSecs: vestingEndTimestamp,
+			})
+		require.NoError(err)
+		if lockedBalanceEntry == nil {
+			return 0
+		}
+		return lockedBalanceEntry.BalanceBaseUnits.Uint64()
+	}
+	getVestingScheduleEntry := func(hodlerPKID *PKID, unlockTimestamp int64) *LockupVestingScheduleEntry {
+		vestingScheduleEntry, err := DBGetLockupVestingScheduleEntry(
+			testMeta.db, nil, hodlerPKID, m0PKID, unlockTimestamp)
+		require.NoError(err)
+		return vestingScheduleEntry
+	}
+
+	// m2 holds a vested position that unlocks from 1000 to 2000.
+	coinLockup(m2PkBytes, 1000, 2000, nil, 19)
+
+	// Vested positions can't be transferred before the fork height.
+	_, _, err := coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 1000, 2000, 400, 19)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferVestedPositionBeforeBlockHeight)
+
+	// The vesting end can't be before the unlock.
+	_, _, err = coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 1000, 999, 400, 20)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferInvalidVestingEndTimestamp)
+
+	// Without the vesting end, the transfer sources the unvested position, which m2 doesn't have.
+	_, _, err = coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 1000, 1000, 400, 20)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferInsufficientBalance)
+
+	// Part of the vested position is transferred with its terms intact, and the transfer can be disconnected.
+	txn, utxoOps, err := coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 1000, 2000, 400, 20)
+	require.NoError(err)
+	require.Equal(uint64(600), getLockedBalance(m2PKID, 1000, 2000))
+	require.Equal(uint64(400), getLockedBalance(m3PKID, 1000, 2000))
+	disconnect(txn, utxoOps, 20)
+	require.Equal(uint64(1000), getLockedBalance(m2PKID, 1000, 2000))
+	require.Equal(uint64(0), getLockedBalance(m3PKID, 1000, 2000))
+	_, _, err = coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 1000, 2000, 400, 20)
+	require.NoError(err)
+
+	// The receiver can't hold a vested position that overlaps the transferred one.
+	coinLockup(m4PkBytes, 1500, 2500, nil, 21)
+	_, _, err = coinLockupTransfer(m2Pub, m2Priv, m4PkBytes, 1000, 2000, 100, 21)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferVestedPositionOverlap)
+
+	// m2 holds a position with a vesting schedule at 5000.
+	vestingScheduleExtraData := make(map[string][]byte)
+	require.NoError(SetLockupVestingScheduleExtraData(vestingScheduleExtraData, 100, uint256.NewInt(10)))
+	coinLockup(m2PkBytes, 5000, 5000, vestingScheduleExtraData, 22)
+
+	// The scheduled position can only be transferred as a whole.
+	_, _, err = coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 5000, 5000, 999, 22)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferOfVestingScheduleBalance)
+
+	// The whole position moves to m3 along with its schedule, and moves back when the transfer is disconnected.
+	txn, utxoOps, err = coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 5000, 5000, 1000, 22)
+	require.NoError(err)
+	require.Equal(uint64(0), getLockedBalance(m2PKID, 5000, 5000))
+	require.Equal(uint64(1000), getLockedBalance(m3PKID, 5000, 5000))
+	require.Nil(getVestingScheduleEntry(m2PKID, 5000))
+	require.Equal(uint64(100), getVestingScheduleEntry(m3PKID, 5000).CliffBlockHeight)
+	disconnect(txn, utxoOps, 22)
+	require.Equal(uint64(1000), getLockedBalance(m2PKID, 5000, 5000))
+	require.Equal(uint64(0), getLockedBalance(m3PKID, 5000, 5000))
+	require.NotNil(getVestingScheduleEntry(m2PKID, 5000))
+	require.Nil(getVestingScheduleEntry(m3PKID, 5000))
+	_, _, err = coinLockupTransfer(m2Pub, m2Priv, m3PkBytes, 5000, 5000, 1000, 22)
+	require.NoError(err)
+
+	// Unscheduled coins can't be transferred into the scheduled position.
+	coinLockup(m4PkBytes, 5000, 5000, nil, 23)
+	_, _, err = coinLockupTransfer(m4Pub, m4Priv, m3PkBytes, 5000, 5000, 100, 23)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferOfVestingScheduleBalance)
+
+	// A scheduled position can't be transferred to a receiver with coins locked until the same time.
+	_, _, err = coinLockupTransfer(m3Pub, m3Priv, m4PkBytes, 5000, 5000, 1000, 23)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferVestingScheduleConflict)
+
+	// m3's locked positions are enumerated with their schedules.
+	utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	lockedPositions, err := utxoView.GetLockedPositionsForHodlerPKID(m3PKID, m0PKID)
+	require.NoError(err)
+	require.Len(lockedPositions, 2)
+	require.Equal(int64(2000), lockedPositions[0].LockedBalanceEntry.VestingEndTimestampNanoSecs)
+	require.Equal(uint64(400), lockedPositions[0].LockedBalanceEntry.BalanceBaseUnits.Uint64())
+	require.Nil(lockedPositions[0].VestingScheduleEntry)
+	require.Equal(int64(5000), lockedPositions[1].LockedBalanceEntry.UnlockTimestampNanoSecs)
+	require.NotNil(lockedPositions[1].VestingScheduleEntry)
+	allLockedPositions, err := utxoView.GetLockedPositionsForHodlerPKID(m3PKID, nil)
+	require.NoError(err)
+	require.Len(allLockedPositions, 2)
+
+	// m2's emptied positions aren't enumerated.
+	lockedPositions, err = utxoView.GetLockedPositionsForHodlerPKID(m2PKID, m0PKID)
+	require.NoError(err)
+	require.Len(lockedPositions, 1)
+	require.Equal(uint64(600), lockedPositions[0].LockedBalanceEntry.BalanceBaseUnits.Uint64())
+}
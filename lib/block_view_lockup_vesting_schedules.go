@@ -0,0 +1,409 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Lockup Vesting Schedules: An unvested CoinLockup releases all of its coins once a block's timestamp passes the
+// UnlockTimestampNanoSecs, and a vested CoinLockup releases them linearly between two timestamps. Neither fits
+// the team and token grant use case where nothing vests until a cliff and the coins are released at a fixed
+// rate after it. A CoinLockup can now carry a vesting schedule for this, given by the
+// LockupVestingCliffBlockHeightKey and LockupVestingReleaseRateBaseUnitsPerBlockKey in its ExtraData.
+//
+// The schedule is stored in a LockupVestingScheduleEntry keyed the same way as the unvested LockedBalanceEntry
+// it governs. The entry's coins still can't be unlocked before its UnlockTimestampNanoSecs, but from then on a
+// CoinUnlock only releases the amount that's vested at the block height: nothing before the CliffBlockHeight and
+// ReleaseRateBaseUnitsPerBlock for every block from the cliff on, up to the TotalBaseUnits that were locked.
+// Whatever was released by earlier unlocks is the difference between the TotalBaseUnits and the entry's balance.
+//
+// To keep this simple, a locked balance with a schedule is never combined with other coins. A CoinLockup with a
+// schedule must create a new LockedBalanceEntry, a CoinLockup can't add to an entry that has a schedule, and an
+// entry with a schedule can't be sent or received with a CoinLockupTransfer. Only the profile owner can lock up
+// coins with a schedule, for the same reasons only the profile owner can perform vested lockups. The schedule is
+// kept after its coins have all been unlocked, so a fully released LockedBalanceEntry can't be refilled with
+// coins the schedule would then misattribute.
+
+//
+// TYPES: LockupVestingScheduleEntry
+//
+
+type LockupVestingScheduleEntry struct {
+	HODLerPKID              *PKID
+	ProfilePKID             *PKID
+	UnlockTimestampNanoSecs int64
+
+	// CliffBlockHeight is the first block height at which any of the coins vest.
+	CliffBlockHeight uint64
+	// ReleaseRateBaseUnitsPerBlock is the number of coins that vest at every block height from the cliff on.
+	ReleaseRateBaseUnitsPerBlock uint256.Int
+	// TotalBaseUnits is the number of coins that were locked up with the schedule, including any yield.
+	TotalBaseUnits uint256.Int
+
+	isDeleted bool
+}
+
+type LockupVestingScheduleKey struct {
+	HODLerPKID              PKID
+	ProfilePKID             PKID
+	UnlockTimestampNanoSecs int64
+}
+
+func (vestingScheduleEntry *LockupVestingScheduleEntry) Copy() *LockupVestingScheduleEntry {
+	return &LockupVestingScheduleEntry{
+		HODLerPKID:                   vestingScheduleEntry.HODLerPKID.NewPKID(),
+		ProfilePKID:                  vestingScheduleEntry.ProfilePKID.NewPKID(),
+		UnlockTimestampNanoSecs:      vestingScheduleEntry.UnlockTimestampNanoSecs,
+		CliffBlockHeight:             vestingScheduleEntry.CliffBlockHeight,
+		ReleaseRateBaseUnitsPerBlock: *vestingScheduleEntry.ReleaseRateBaseUnitsPerBlock.Clone(),
+		TotalBaseUnits:               *vestingScheduleEntry.TotalBaseUnits.Clone(),
+		isDeleted:                    vestingScheduleEntry.isDeleted,
+	}
+}
+
+func (vestingScheduleEntry *LockupVestingScheduleEntry) ToMapKey() LockupVestingScheduleKey {
+	return LockupVestingScheduleKey{
+		HODLerPKID:              *vestingScheduleEntry.HODLerPKID,
+		ProfilePKID:             *vestingScheduleEntry.ProfilePKID,
+		UnlockTimestampNanoSecs: vestingScheduleEntry.UnlockTimestampNanoSecs,
+	}
+}
+
+func (vestingScheduleEntry *LockupVestingScheduleEntry) IsDeleted() bool {
+	return vestingScheduleEntry.isDeleted
+}
+
+// GetVestedBaseUnits returns the number of coins that are vested at the block height, whether or not they've
+// been unlocked yet.
+func (vestingScheduleEntry *LockupVestingScheduleEntry) GetVestedBaseUnits(blockHeight uint64) *uint256.Int {
+	if blockHeight < vestingScheduleEntry.CliffBlockHeight {
+		return uint256.NewInt(0)
+	}
+	numVestedBlocks := uint256.NewInt(blockHeight - vestingScheduleEntry.CliffBlockHeight + 1)
+	vestedBaseUnits, err := SafeUint256().Mul(&vestingScheduleEntry.ReleaseRateBaseUnitsPerBlock, numVestedBlocks)
+	if err != nil || vestedBaseUnits.Gt(&vestingScheduleEntry.TotalBaseUnits) {
+		return vestingScheduleEntry.TotalBaseUnits.Clone()
+	}
+	return vestedBaseUnits
+}
+
+// GetReleasableBaseUnits returns the number of coins of the LockedBalanceEntry that can be unlocked at the block
+// height, which are the vested coins that haven't been unlocked yet.
+func (vestingScheduleEntry *LockupVestingScheduleEntry) GetReleasableBaseUnits(
+	lockedBalanceEntry *LockedBalanceEntry, blockHeight uint64) (*uint256.Int, error) {
+
+	releasedBaseUnits, err := SafeUint256().Sub(
+		&vestingScheduleEntry.TotalBaseUnits, &lockedBalanceEntry.BalanceBaseUnits)
+	if err != nil {
+		return nil, errors.New("LockupVestingScheduleEntry.GetReleasableBaseUnits: locked balance " +
+			"exceeds the schedule's total; this shouldn't be possible")
+	}
+	vestedBaseUnits := vestingScheduleEntry.GetVestedBaseUnits(blockHeight)
+	if !vestedBaseUnits.Gt(releasedBaseUnits) {
+		return uint256.NewInt(0), nil
+	}
+	return uint256.NewInt(0).Sub(vestedBaseUnits, releasedBaseUnits), nil
+}
+
+// DeSoEncoder Interface Implementation for LockupVestingScheduleEntry
+
+func (vestingScheduleEntry *LockupVestingScheduleEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, vestingScheduleEntry.HODLerPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, vestingScheduleEntry.ProfilePKID, skipMetadata...)...)
+	data = append(data, IntToBuf(vestingScheduleEntry.UnlockTimestampNanoSecs)...)
+	data = append(data, UintToBuf(vestingScheduleEntry.CliffBlockHeight)...)
+	data = append(data, VariableEncodeUint256(&vestingScheduleEntry.ReleaseRateBaseUnitsPerBlock)...)
+	data = append(data, VariableEncodeUint256(&vestingScheduleEntry.TotalBaseUnits)...)
+	return data
+}
+
+func (vestingScheduleEntry *LockupVestingScheduleEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// HODLerPKID
+	vestingScheduleEntry.HODLerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrap(err, "LockupVestingScheduleEntry.Decode: Problem reading HODLerPKID")
+	}
+
+	// ProfilePKID
+	vestingScheduleEntry.ProfilePKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrap(err, "LockupVestingScheduleEntry.Decode: Problem reading ProfilePKID")
+	}
+
+	// UnlockTimestampNanoSecs
+	vestingScheduleEntry.UnlockTimestampNanoSecs, err = ReadVarint(rr)
+	if err != nil {
+		return errors.Wrap(err, "LockupVestingScheduleEntry.Decode: Problem reading UnlockTimestampNanoSecs")
+	}
+
+	// CliffBlockHeight
+	vestingScheduleEntry.CliffBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrap(err, "LockupVestingScheduleEntry.Decode: Problem reading CliffBlockHeight")
+	}
+
+	// ReleaseRateBaseUnitsPerBlock
+	releaseRateBaseUnitsPerBlock, err := VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrap(err, "LockupVestingScheduleEntry.Decode: Problem reading ReleaseRateBaseUnitsPerBlock")
+	}
+	if releaseRateBaseUnitsPerBlock != nil {
+		vestingScheduleEntry.ReleaseRateBaseUnitsPerBlock = *releaseRateBaseUnitsPerBlock
+	}
+
+	// TotalBaseUnits
+	totalBaseUnits, err := VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrap(err, "LockupVestingScheduleEntry.Decode: Problem reading TotalBaseUnits")
+	}
+	if totalBaseUnits != nil {
+		vestingScheduleEntry.TotalBaseUnits = *totalBaseUnits
+	}
+
+	return nil
+}
+
+func (vestingScheduleEntry *LockupVestingScheduleEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (vestingScheduleEntry *LockupVestingScheduleEntry) GetEncoderType() EncoderType {
+	return EncoderTypeLockupVestingScheduleEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForLockupVestingSchedule(hodlerPKID *PKID, profilePKID *PKID, unlockTimestampNanoSecs int64) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	key := append([]byte{}, Prefixes.PrefixLockupVestingScheduleByHODLerPKIDProfilePKIDUnlockTimestamp...)
+	key = append(key, hodlerPKID.ToBytes()...)
+	key = append(key, profilePKID.ToBytes()...)
+	return append(key, EncodeUint64(uint64(unlockTimestampNanoSecs))...)
+}
+
+func DBGetLockupVestingScheduleEntry(handle *badger.DB, snap *Snapshot, hodlerPKID *PKID, profilePKID *PKID,
+	unlockTimestampNanoSecs int64) (*LockupVestingScheduleEntry, error) {
+
+	var ret *LockupVestingScheduleEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetLockupVestingScheduleEntryWithTxn(txn, snap, hodlerPKID, profilePKID,
+			unlockTimestampNanoSecs)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetLockupVestingScheduleEntryWithTxn(txn *badger.Txn, snap *Snapshot, hodlerPKID *PKID, profilePKID *PKID,
+	unlockTimestampNanoSecs int64) (*LockupVestingScheduleEntry, error) {
+
+	// Retrieve LockupVestingScheduleEntry from db.
+	vestingScheduleBytes, err := DBGetWithTxn(txn, snap,
+		DBKeyForLockupVestingSchedule(hodlerPKID, profilePKID, unlockTimestampNanoSecs))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetLockupVestingScheduleEntryWithTxn: problem retrieving "+
+			"LockupVestingScheduleEntry")
+	}
+
+	// Decode LockupVestingScheduleEntry from bytes.
+	vestingScheduleEntry := &LockupVestingScheduleEntry{}
+	rr := bytes.NewReader(vestingScheduleBytes)
+	if exist, err := DecodeFromBytes(vestingScheduleEntry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetLockupVestingScheduleEntryWithTxn: problem decoding "+
+			"LockupVestingScheduleEntry")
+	}
+	return vestingScheduleEntry, nil
+}
+
+func DBPutLockupVestingScheduleEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	vestingScheduleEntry *LockupVestingScheduleEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if vestingScheduleEntry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutLockupVestingScheduleEntryWithTxn: called with nil LockupVestingScheduleEntry")
+		return nil
+	}
+
+	key := DBKeyForLockupVestingSchedule(vestingScheduleEntry.HODLerPKID, vestingScheduleEntry.ProfilePKID,
+		vestingScheduleEntry.UnlockTimestampNanoSecs)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, vestingScheduleEntry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutLockupVestingScheduleEntryWithTxn: problem storing "+
+			"LockupVestingScheduleEntry in index PrefixLockupVestingScheduleByHODLerPKIDProfilePKIDUnlockTimestamp")
+	}
+	return nil
+}
+
+func DBDeleteLockupVestingScheduleEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	vestingScheduleEntry *LockupVestingScheduleEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if vestingScheduleEntry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteLockupVestingScheduleEntryWithTxn: called with nil LockupVestingScheduleEntry")
+		return nil
+	}
+
+	key := DBKeyForLockupVestingSchedule(vestingScheduleEntry.HODLerPKID, vestingScheduleEntry.ProfilePKID,
+		vestingScheduleEntry.UnlockTimestampNanoSecs)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeleteLockupVestingScheduleEntryWithTxn: problem deleting "+
+			"LockupVestingScheduleEntry from index PrefixLockupVestingScheduleByHODLerPKIDProfilePKIDUnlockTimestamp")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// GetLockupVestingScheduleEntry returns the vesting schedule of the unvested LockedBalanceEntry with the given
+// HODLerPKID, ProfilePKID, and UnlockTimestampNanoSecs, or nil if the entry doesn't have a schedule.
+func (bav *UtxoView) GetLockupVestingScheduleEntry(hodlerPKID *PKID, profilePKID *PKID,
+	unlockTimestampNanoSecs int64) (*LockupVestingScheduleEntry, error) {
+
+	// First check the UtxoView.
+	mapKey := LockupVestingScheduleKey{
+		HODLerPKID:              *hodlerPKID,
+		ProfilePKID:             *profilePKID,
+		UnlockTimestampNanoSecs: unlockTimestampNanoSecs,
+	}
+	if vestingScheduleEntry, exists := bav.LockupVestingScheduleKeyToLockupVestingScheduleEntry[mapKey]; exists {
+		if vestingScheduleEntry.isDeleted {
+			return nil, nil
+		}
+		return vestingScheduleEntry, nil
+	}
+
+	// If no LockupVestingScheduleEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbVestingScheduleEntry, err := DBGetLockupVestingScheduleEntry(bav.Handle, bav.Snapshot, hodlerPKID,
+		profilePKID, unlockTimestampNanoSecs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetLockupVestingScheduleEntry: ")
+	}
+	if dbVestingScheduleEntry != nil {
+		// Cache the LockupVestingScheduleEntry from the db in the UtxoView.
+		bav._setLockupVestingScheduleEntryMappings(dbVestingScheduleEntry)
+	}
+	return dbVestingScheduleEntry, nil
+}
+
+func (bav *UtxoView) _setLockupVestingScheduleEntryMappings(vestingScheduleEntry *LockupVestingScheduleEntry) {
+	// This function shouldn't be called with nil.
+	if vestingScheduleEntry == nil {
+		glog.Errorf("_setLockupVestingScheduleEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.LockupVestingScheduleKeyToLockupVestingScheduleEntry[vestingScheduleEntry.ToMapKey()] = vestingScheduleEntry
+}
+
+func (bav *UtxoView) _deleteLockupVestingScheduleEntryMappings(vestingScheduleEntry *LockupVestingScheduleEntry) {
+	// This function shouldn't be called with nil.
+	if vestingScheduleEntry == nil {
+		glog.Errorf("_deleteLockupVestingScheduleEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *vestingScheduleEntry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setLockupVestingScheduleEntryMappings(&tombstoneEntry)
+}
+
+// _getLockupVestingScheduleFromTxn returns the cliff height and release rate of the vesting schedule in the
+// CoinLockup's ExtraData. The last return value is false if the txn doesn't have a schedule. Both keys must be
+// present for the txn to have a schedule.
+func _getLockupVestingScheduleFromTxn(txn *MsgDeSoTxn) (
+	_cliffBlockHeight uint64, _releaseRateBaseUnitsPerBlock *uint256.Int, _hasSchedule bool, _err error) {
+
+	cliffBlockHeight, hasCliffBlockHeight, err := txn.GetExtraDataUint64(LockupVestingCliffBlockHeightKey)
+	if err != nil {
+		return 0, nil, false, errors.Wrapf(RuleErrorCoinLockupVestingScheduleInvalid, "%v", err)
+	}
+	releaseRateBaseUnitsPerBlock, hasReleaseRate, err := txn.GetExtraDataUint256(
+		LockupVestingReleaseRateBaseUnitsPerBlockKey)
+	if err != nil {
+		return 0, nil, false, errors.Wrapf(RuleErrorCoinLockupVestingScheduleInvalid, "%v", err)
+	}
+	if hasCliffBlockHeight != hasReleaseRate {
+		return 0, nil, false, errors.Wrapf(RuleErrorCoinLockupVestingScheduleInvalid,
+			"both %v and %v must be set", LockupVestingCliffBlockHeightKey,
+			LockupVestingReleaseRateBaseUnitsPerBlockKey)
+	}
+	return cliffBlockHeight, releaseRateBaseUnitsPerBlock, hasCliffBlockHeight, nil
+}
+
+// SetLockupVestingScheduleExtraData sets the vesting schedule of a CoinLockup in the txn's ExtraData, which
+// must not be nil. Pass the ExtraData to CreateCoinLockupTxn to lock up coins with the schedule.
+func SetLockupVestingScheduleExtraData(extraData map[string][]byte, cliffBlockHeight uint64,
+	releaseRateBaseUnitsPerBlock *uint256.Int) error {
+
+	if err := SetExtraDataUint64(extraData, LockupVestingCliffBlockHeightKey, cliffBlockHeight); err != nil {
+		return errors.Wrapf(err, "SetLockupVestingScheduleExtraData: ")
+	}
+	if err := SetExtraDataUint256(extraData, LockupVestingReleaseRateBaseUnitsPerBlockKey,
+		releaseRateBaseUnitsPerBlock); err != nil {
+		return errors.Wrapf(err, "SetLockupVestingScheduleExtraData: ")
+	}
+	return nil
+}
+
+//
+// DB FLUSHES
+//
+
+func (bav *UtxoView) _flushLockupVestingScheduleEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, vestingScheduleEntryIter := range bav.LockupVestingScheduleKeyToLockupVestingScheduleEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		vestingScheduleEntry := *vestingScheduleEntryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(vestingScheduleEntry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushLockupVestingScheduleEntriesToDbWithTxn: LockupVestingScheduleEntry key %v "+
+					"doesn't match MapKey %v", vestingScheduleEntry.ToMapKey(), mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if vestingScheduleEntry.isDeleted {
+			if err := DBDeleteLockupVestingScheduleEntryWithTxn(
+				txn, bav.Snapshot, &vestingScheduleEntry, bav.EventManager, vestingScheduleEntry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushLockupVestingScheduleEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutLockupVestingScheduleEntryWithTxn(
+				txn, bav.Snapshot, &vestingScheduleEntry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushLockupVestingScheduleEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockupVestingSchedules(t *testing.T) {
+	require := require.New(t)
+
+	// Initialize test chain, miner, and testMeta.
+	testMeta := _setUpMinerAndTestMetaForTimestampBasedLockupTests(t)
+	testMeta.params.ForkHeights.LockupVestingSchedulesBlockHeight = uint32(20)
+
+	// Initialize m0, m1, m2, m3, m4, and paramUpdater.
+	_setUpProfilesAndMintM0M1DAOCoins(testMeta)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(testMeta.db, nil, m0PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(testMeta.db, nil, m2PkBytes).PKID
+	unlockTimestampNanoSecs := int64(1000)
+
+	vestingScheduleExtraData := func(cliffBlockHeight uint64, releaseRate uint64) map[string][]byte {
+		extraData := make(map[string][]byte)
+		require.NoError(SetLockupVestingScheduleExtraData(
+			extraData, cliffBlockHeight, uint256.NewInt(releaseRate)))
+		return extraData
+	}
+	// The txns are connected as if they were in the next block, so mine blocks until the next block is at the height.
+	mineToBlockHeight := func(blockHeight uint32) {
+		for testMeta.chain.BlockTip().Height+1 < blockHeight {
+			_, err := testMeta.miner.MineAndProcessSingleBlock(0, testMeta.mempool)
+			require.NoError(err)
+		}
+		require.Equal(blockHeight, testMeta.chain.BlockTip().Height+1)
+	}
+	coinLockup := func(transactorPub string, transactorPriv string, recipientPub string,
+		unlockTimestamp int64, vestingEndTimestamp int64, extraData map[string][]byte,
+		blockHeight uint32) (*MsgDeSoTxn, []*UtxoOperation, error) {
+
+		mineToBlockHeight(blockHeight)
+		utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		transactorPkBytes, _, err := Base58CheckDecode(transactorPub)
+		require.NoError(err)
+		recipientPkBytes, _, err := Base58CheckDecode(recipientPub)
+		require.NoError(err)
+		txn, _, _, _, err := testMeta.chain.CreateCoinLockupTxn(transactorPkBytes, m0PkBytes, recipientPkBytes,
+			unlockTimestamp, vestingEndTimestamp, uint256.NewInt(1000), extraData,
+			testMeta.feeRateNanosPerKb, nil, []*DeSoOutput{})
+		require.NoError(err)
+		_signTxn(t, txn, transactorPriv)
+		utxoOps, _, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		require.NoError(utxoView.FlushToDb(uint64(blockHeight)))
+		return txn, utxoOps, nil
+	}
+	coinUnlock := func(blockHeight uint32) error {
+		mineToBlockHeight(blockHeight)
+		utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		txn, _, _, _, err := testMeta.chain.CreateCoinUnlockTxn(
+			m2PkBytes, m0PkBytes, nil, testMeta.feeRateNanosPerKb, nil, []*DeSoOutput{})
+		require.NoError(err)
+		_signTxn(t, txn, m2Priv)
+		if _, _, _, _, err = utxoView.ConnectTransaction(
+			txn, txn.Hash(), blockHeight, unlockTimestampNanoSecs+1, true, false); err != nil {
+			return err
+		}
+		return utxoView.FlushToDb(uint64(blockHeight))
+	}
+	getLockedBalance := func() uint64 {
+		utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		lockedBalanceEntry, err := utxoView.GetLockedBalanceEntryForLockedBalanceEntryKey(LockedBalanceEntryKey{
+			HODLerPKID:                  *m2PKID,
+			ProfilePKID:                 *m0PKID,
+			UnlockTimestampNanoSecs:     unlockTimestampNanoSecs,
+			VestingEndTimestampNanoSecs: unlockTimestampNanoSecs,
+		})
+		require.NoError(err)
+		if lockedBalanceEntry == nil {
+			return 0
+		}
+		return lockedBalanceEntry.BalanceBaseUnits.Uint64()
+	}
+
+	// Schedules can't be used before the fork height.
+	_, _, err := coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+		vestingScheduleExtraData(30, 100), 19)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleBeforeBlockHeight)
+
+	// Invalid schedules are rejected.
+	{
+		// Only one of the keys is set.
+		extraData := vestingScheduleExtraData(30, 100)
+		delete(extraData, LockupVestingReleaseRateBaseUnitsPerBlockKey)
+		_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+			extraData, 20)
+		require.Error(err)
+		require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleInvalid)
+
+		// The lockup is vested.
+		_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs+1000,
+			vestingScheduleExtraData(30, 100), 20)
+		require.Error(err)
+		require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleOnVestedLockup)
+
+		// The release rate is zero.
+		_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+			vestingScheduleExtraData(30, 0), 20)
+		require.Error(err)
+		require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleZeroReleaseRate)
+
+		// The cliff isn't in the future.
+		_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+			vestingScheduleExtraData(20, 100), 20)
+		require.Error(err)
+		require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleCliffInPast)
+	}
+
+	// Lock up 1000 m0 coins for m2 with a cliff at block 30 that releases 300 coins per block, then disconnect
+	// and reconnect the lockup.
+	txn, utxoOps, err := coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+		vestingScheduleExtraData(30, 300), 20)
+	require.NoError(err)
+	{
+		utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+		require.NoError(utxoView.DisconnectTransaction(txn, txn.Hash(), utxoOps, 20))
+		require.NoError(utxoView.FlushToDb(20))
+		scheduleEntry, err := DBGetLockupVestingScheduleEntry(
+			testMeta.db, nil, m2PKID, m0PKID, unlockTimestampNanoSecs)
+		require.NoError(err)
+		require.Nil(scheduleEntry)
+		require.Equal(uint64(0), getLockedBalance())
+	}
+	_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+		vestingScheduleExtraData(30, 300), 20)
+	require.NoError(err)
+	require.Equal(uint64(1000), getLockedBalance())
+	scheduleEntry, err := DBGetLockupVestingScheduleEntry(testMeta.db, nil, m2PKID, m0PKID, unlockTimestampNanoSecs)
+	require.NoError(err)
+	require.Equal(uint64(30), scheduleEntry.CliffBlockHeight)
+	require.Equal(uint64(300), scheduleEntry.ReleaseRateBaseUnitsPerBlock.Uint64())
+	require.Equal(uint64(1000), scheduleEntry.TotalBaseUnits.Uint64())
+
+	// Other coins can't be combined with the scheduled coins.
+	_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs, nil, 21)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleConflict)
+	_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+		vestingScheduleExtraData(40, 100), 21)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleConflict)
+
+	// A schedule can't be added to an existing locked balance.
+	_, _, err = coinLockup(m0Pub, m0Priv, m3Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs, nil, 21)
+	require.NoError(err)
+	_, _, err = coinLockup(m0Pub, m0Priv, m3Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+		vestingScheduleExtraData(40, 100), 21)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleConflict)
+
+	// Only the profile owner can lock up coins with a schedule.
+	_daoCoinTransferTxnWithTestMeta(testMeta, testMeta.feeRateNanosPerKb, m0Pub, m0Priv, DAOCoinTransferMetadata{
+		ProfilePublicKey:       m0PkBytes,
+		DAOCoinToTransferNanos: *uint256.NewInt(1000),
+		ReceiverPublicKey:      m1PkBytes,
+	})
+	_, _, err = coinLockup(m1Pub, m1Priv, m4Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs,
+		vestingScheduleExtraData(40, 100), 21)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleInvalidTransactor)
+
+	// The scheduled coins can't be transferred.
+	_, _, _, err = _coinLockupTransfer(t, testMeta.chain, testMeta.db, testMeta.params, testMeta.feeRateNanosPerKb,
+		m2Pub, m2Priv, NewPublicKey(m4PkBytes), NewPublicKey(m0PkBytes), unlockTimestampNanoSecs,
+		uint256.NewInt(1))
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupTransferOfVestingScheduleBalance)
+
+	// Nothing can be unlocked before the cliff.
+	err = coinUnlock(29)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinUnlockNoUnlockableCoinsFound)
+	require.Equal(uint64(1000), getLockedBalance())
+
+	// The rate is released at the cliff and for every block after it.
+	require.NoError(coinUnlock(30))
+	require.Equal(uint64(700), getLockedBalance())
+	require.NoError(coinUnlock(31))
+	require.Equal(uint64(400), getLockedBalance())
+
+	// Nothing new is released within the same block.
+	err = coinUnlock(31)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinUnlockNoUnlockableCoinsFound)
+
+	// The rest of the coins are released once the total has vested.
+	require.NoError(coinUnlock(40))
+	require.Equal(uint64(0), getLockedBalance())
+	m2BalanceEntry := DBGetBalanceEntryForHODLerAndCreatorPKIDs(testMeta.db, nil, m2PKID, m0PKID, true)
+	require.Equal(uint64(1000), m2BalanceEntry.BalanceNanos.Uint64())
+
+	// The schedule is kept after the coins are unlocked, so the locked balance can't be refilled.
+	_, _, err = coinLockup(m0Pub, m0Priv, m2Pub, unlockTimestampNanoSecs, unlockTimestampNanoSecs, nil, 41)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorCoinLockupVestingScheduleConflict)
+}
+
+func TestLockupVestingScheduleEntryGetVestedBaseUnits(t *testing.T) {
+	scheduleEntry := &LockupVestingScheduleEntry{
+		CliffBlockHeight:             10,
+		ReleaseRateBaseUnitsPerBlock: *uint256.NewInt(30),
+		TotalBaseUnits:               *uint256.NewInt(100),
+	}
+	require.Equal(t, uint64(0), scheduleEntry.GetVestedBaseUnits(9).Uint64())
+	require.Equal(t, uint64(30), scheduleEntry.GetVestedBaseUnits(10).Uint64())
+	require.Equal(t, uint64(90), scheduleEntry.GetVestedBaseUnits(12).Uint64())
+	require.Equal(t, uint64(100), scheduleEntry.GetVestedBaseUnits(13).Uint64())
+
+	// An overflowing release saturates at the total.
+	scheduleEntry.ReleaseRateBaseUnitsPerBlock = *MaxUint256.Clone()
+	require.Equal(t, uint64(100), scheduleEntry.GetVestedBaseUnits(11).Uint64())
+}
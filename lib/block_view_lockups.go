@@ -1140,6 +1140,37 @@ func (bav *UtxoView) _connectCoinLockup(
 				PkToString(txn.PublicKey, bav.Params))
 	}
 
+	// Validate the vesting schedule, if the lockup has one. See the comment at the top of
+	// block_view_lockup_vesting_schedules.go for why these restrictions exist.
+	vestingCliffBlockHeight, vestingReleaseRateBaseUnitsPerBlock, hasVestingSchedule, err :=
+		_getLockupVestingScheduleFromTxn(txn)
+	if err != nil {
+		return 0, 0, nil, errors.Wrap(err, "_connectCoinLockup")
+	}
+	if hasVestingSchedule {
+		if blockHeight < bav.Params.ForkHeights.LockupVestingSchedulesBlockHeight {
+			return 0, 0, nil,
+				errors.Wrap(RuleErrorCoinLockupVestingScheduleBeforeBlockHeight, "_connectCoinLockup")
+		}
+		if txMeta.VestingEndTimestampNanoSecs != txMeta.UnlockTimestampNanoSecs {
+			return 0, 0, nil,
+				errors.Wrap(RuleErrorCoinLockupVestingScheduleOnVestedLockup, "_connectCoinLockup")
+		}
+		if !reflect.DeepEqual(txn.PublicKey, txMeta.ProfilePublicKey.ToBytes()) {
+			return 0, 0, nil,
+				errors.Wrap(RuleErrorCoinLockupVestingScheduleInvalidTransactor, "_connectCoinLockup")
+		}
+		if vestingReleaseRateBaseUnitsPerBlock.IsZero() {
+			return 0, 0, nil,
+				errors.Wrap(RuleErrorCoinLockupVestingScheduleZeroReleaseRate, "_connectCoinLockup")
+		}
+		if vestingCliffBlockHeight <= uint64(blockHeight) {
+			return 0, 0, nil,
+				errors.Wrapf(RuleErrorCoinLockupVestingScheduleCliffInPast, "_connectCoinLockup: cliff "+
+					"block height %d, current block height %d", vestingCliffBlockHeight, blockHeight)
+		}
+	}
+
 	// Determine the recipient PKID to use.
 	if len(txMeta.RecipientPublicKey) != btcec.PubKeyBytesLenCompressed {
 		return 0, 0, nil,
@@ -1328,6 +1359,21 @@ func (bav *UtxoView) _connectCoinLockup(
 			return 0, 0, nil, errors.Wrap(err, "_connectCoinLockup")
 		}
 
+		// (1.75) Verify that the lockup doesn't combine coins with a vesting schedule with any other coins.
+		if blockHeight >= bav.Params.ForkHeights.LockupVestingSchedulesBlockHeight {
+			existingVestingScheduleEntry, err := bav.GetLockupVestingScheduleEntry(
+				hodlerPKID, profilePKID, txMeta.UnlockTimestampNanoSecs)
+			if err != nil {
+				return 0, 0, nil,
+					errors.Wrap(err, "_connectCoinLockup failed to fetch lockupVestingScheduleEntry")
+			}
+			if existingVestingScheduleEntry != nil ||
+				(hasVestingSchedule && !lockedBalanceEntry.BalanceBaseUnits.IsZero()) {
+				return 0, 0, nil,
+					errors.Wrap(RuleErrorCoinLockupVestingScheduleConflict, "_connectCoinLockup")
+			}
+		}
+
 		// (2) Store the previous locked balance entry
 		previousLockedBalanceEntry = lockedBalanceEntry.Copy()
 
@@ -1346,6 +1392,18 @@ func (bav *UtxoView) _connectCoinLockup(
 		lockedBalanceEntry.BalanceBaseUnits = *newLockedBalanceEntryBalance
 		bav._setLockedBalanceEntry(lockedBalanceEntry)
 
+		// (5) Set the vesting schedule of the new locked balance entry in the view
+		if hasVestingSchedule {
+			bav._setLockupVestingScheduleEntryMappings(&LockupVestingScheduleEntry{
+				HODLerPKID:                   hodlerPKID.NewPKID(),
+				ProfilePKID:                  profilePKID.NewPKID(),
+				UnlockTimestampNanoSecs:      txMeta.UnlockTimestampNanoSecs,
+				CliffBlockHeight:             vestingCliffBlockHeight,
+				ReleaseRateBaseUnitsPerBlock: *vestingReleaseRateBaseUnitsPerBlock.Clone(),
+				TotalBaseUnits:               *lockupValue.Clone(),
+			})
+		}
+
 		// NOTE: While we could check for "global" overflow here, we let this occur on the unlock transaction instead.
 		//       Global overflow is where the yield causes fields like CoinEntry.CoinsInCirculationNanos to overflow.
 		//       Performing the check here would be redundant and may lead to worse UX in the case of coins being
@@ -1906,7 +1964,10 @@ func (bav *UtxoView) _disconnectCoinLockup(
 	}
 
 	// Sanity check the CoinLockup operation exists.
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[CoinLockupOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCoinLockup: ")
+	}
 	if operationData.PrevLockedBalanceEntry == nil || operationData.PrevLockedBalanceEntry.isDeleted {
 		return fmt.Errorf("_disconnectCoinLockup: Trying to revert OperationTypeCoinLockup " +
 			"but found nil or deleted previous locked balance entry")
@@ -1940,6 +2001,26 @@ func (bav *UtxoView) _disconnectCoinLockup(
 
 		// Reset the transactor's LockedBalanceEntry to what it was previously.
 		bav._setLockedBalanceEntry(operationData.PrevLockedBalanceEntry)
+
+		// Delete the vesting schedule if the lockup created one.
+		_, _, hasVestingSchedule, err := _getLockupVestingScheduleFromTxn(currentTxn)
+		if err != nil {
+			return errors.Wrap(err, "_disconnectCoinLockup")
+		}
+		if hasVestingSchedule {
+			vestingScheduleEntry, err := bav.GetLockupVestingScheduleEntry(
+				operationData.PrevLockedBalanceEntry.HODLerPKID,
+				operationData.PrevLockedBalanceEntry.ProfilePKID,
+				operationData.PrevLockedBalanceEntry.UnlockTimestampNanoSecs)
+			if err != nil {
+				return errors.Wrap(err, "_disconnectCoinLockup failed to fetch lockupVestingScheduleEntry")
+			}
+			if vestingScheduleEntry == nil {
+				return fmt.Errorf("_disconnectCoinLockup: Trying to revert a coin lockup with a vesting " +
+					"schedule but found nil lockup vesting schedule entry; this shouldn't be possible")
+			}
+			bav._deleteLockupVestingScheduleEntryMappings(vestingScheduleEntry)
+		}
 	} else {
 		// Delete any set locked balance entries.
 		for _, setLockedBalanceEntry := range operationData.SetLockedBalanceEntries {
@@ -1974,7 +2055,7 @@ func (bav *UtxoView) _disconnectCoinLockup(
 
 	// By here we only need to disconnect the basic transfer associated with the transaction.
 	basicTransferOps := utxoOpsForTxn[:operationIndex]
-	err := bav._disconnectBasicTransfer(currentTxn, txnHash, basicTransferOps, blockHeight)
+	err = bav._disconnectBasicTransfer(currentTxn, txnHash, basicTransferOps, blockHeight)
 	if err != nil {
 		return errors.Wrap(err, "_disconnectCoinLockup")
 	}
@@ -2146,7 +2227,10 @@ func (bav *UtxoView) _disconnectUpdateCoinLockupParams(
 	}
 
 	// Fetch the UpdateCoinLockupParams operation.
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[UpdateCoinLockupParamsOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUpdateCoinLockupParams: ")
+	}
 
 	// Grab the txn metadata.
 	txMeta := currentTxn.TxnMeta.(*UpdateCoinLockupParamsMetadata)
@@ -2206,7 +2290,7 @@ func (bav *UtxoView) _disconnectUpdateCoinLockupParams(
 
 	// By here we only need to disconnect the basic transfer associated with the transaction.
 	basicTransferOps := utxoOpsForTxn[:operationIndex]
-	err := bav._disconnectBasicTransfer(currentTxn, txnHash, basicTransferOps, blockHeight)
+	err = bav._disconnectBasicTransfer(currentTxn, txnHash, basicTransferOps, blockHeight)
 	if err != nil {
 		return errors.Wrap(err, "_disconnectUpdateCoinLockupParams")
 	}
@@ -2294,10 +2378,17 @@ func (bav *UtxoView) _connectCoinLockupTransfer(
 			"_connectCoinLockupTransfer")
 	}
 
+	// Determine the lockup terms of the transferred coins.
+	// See block_view_lockup_position_transfers.go for how vested positions are transferred.
+	vestingEndTimestampNanoSecs, err := bav._getLockupTransferVestingEndTimestampNanoSecs(txn, txMeta, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrap(err, "_connectCoinLockupTransfer")
+	}
+
 	// Fetch the sender's balance entries.
 	senderLockedBalanceEntry, err :=
 		bav.GetLockedBalanceEntryForHODLerPKIDProfilePKIDUnlockTimestampNanoSecsVestingEndTimestampNanoSecs(
-			senderPKID, profilePKID, txMeta.UnlockTimestampNanoSecs, txMeta.UnlockTimestampNanoSecs)
+			senderPKID, profilePKID, txMeta.UnlockTimestampNanoSecs, vestingEndTimestampNanoSecs)
 	if err != nil {
 		return 0, 0, nil,
 			errors.Wrap(err, "connectCoinLockupTransfer failed to fetch senderLockedBalanceEntry")
@@ -2307,7 +2398,7 @@ func (bav *UtxoView) _connectCoinLockupTransfer(
 			HODLerPKID:                  senderPKID,
 			ProfilePKID:                 profilePKID,
 			UnlockTimestampNanoSecs:     txMeta.UnlockTimestampNanoSecs,
-			VestingEndTimestampNanoSecs: txMeta.UnlockTimestampNanoSecs,
+			VestingEndTimestampNanoSecs: vestingEndTimestampNanoSecs,
 			BalanceBaseUnits:            *uint256.NewInt(0),
 		}
 	}
@@ -2329,7 +2420,7 @@ func (bav *UtxoView) _connectCoinLockupTransfer(
 			receiverPKID,
 			profilePKID,
 			txMeta.UnlockTimestampNanoSecs,
-			txMeta.UnlockTimestampNanoSecs)
+			vestingEndTimestampNanoSecs)
 	if err != nil {
 		return 0, 0, nil,
 			errors.Wrap(err, "connectCoinLockupTransfer failed to fetch receiverLockedBalanceEntry")
@@ -2339,12 +2430,36 @@ func (bav *UtxoView) _connectCoinLockupTransfer(
 			HODLerPKID:                  receiverPKID,
 			ProfilePKID:                 profilePKID,
 			UnlockTimestampNanoSecs:     txMeta.UnlockTimestampNanoSecs,
-			VestingEndTimestampNanoSecs: txMeta.UnlockTimestampNanoSecs,
+			VestingEndTimestampNanoSecs: vestingEndTimestampNanoSecs,
 			BalanceBaseUnits:            *uint256.NewInt(0),
 		}
 	}
 	prevReceiverLockedBalanceEntry := receiverLockedBalanceEntry.Copy()
 
+	// Locked balances with a vesting schedule can't be sent or received, unless the whole position is
+	// transferred along with its schedule.
+	var senderVestingScheduleEntry *LockupVestingScheduleEntry
+	if blockHeight >= bav.Params.ForkHeights.LockupPositionTransfersBlockHeight {
+		senderVestingScheduleEntry, err = bav._validateLockupPositionTransfer(
+			txMeta, prevSenderLockedBalanceEntry, receiverLockedBalanceEntry)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "_connectCoinLockupTransfer")
+		}
+	} else if blockHeight >= bav.Params.ForkHeights.LockupVestingSchedulesBlockHeight {
+		for _, lockedBalanceEntry := range []*LockedBalanceEntry{senderLockedBalanceEntry, receiverLockedBalanceEntry} {
+			vestingScheduleEntry, err := bav.GetLockupVestingScheduleEntry(
+				lockedBalanceEntry.HODLerPKID, profilePKID, txMeta.UnlockTimestampNanoSecs)
+			if err != nil {
+				return 0, 0, nil,
+					errors.Wrap(err, "connectCoinLockupTransfer failed to fetch lockupVestingScheduleEntry")
+			}
+			if vestingScheduleEntry != nil {
+				return 0, 0, nil,
+					errors.Wrap(RuleErrorCoinLockupTransferOfVestingScheduleBalance, "_connectCoinLockupTransfer")
+			}
+		}
+	}
+
 	// Fetch the transfer restrictions attached to the transfer.
 	transferRestrictionStatus := profileEntry.DAOCoinEntry.LockupTransferRestrictionStatus
 
@@ -2373,6 +2488,11 @@ func (bav *UtxoView) _connectCoinLockupTransfer(
 	bav._setLockedBalanceEntry(senderLockedBalanceEntry)
 	bav._setLockedBalanceEntry(receiverLockedBalanceEntry)
 
+	// Move the vesting schedule to the receiver along with the coins it governs.
+	if senderVestingScheduleEntry != nil {
+		bav._moveLockupVestingScheduleEntry(senderVestingScheduleEntry, receiverPKID)
+	}
+
 	// SAFEGUARD: Ensure no locked coins were printed by accident.
 	prevTotalBalance, err := SafeUint256().Add(
 		&prevSenderLockedBalanceEntry.BalanceBaseUnits,
@@ -2386,7 +2506,7 @@ func (bav *UtxoView) _connectCoinLockupTransfer(
 			senderPKID,
 			profilePKID,
 			txMeta.UnlockTimestampNanoSecs,
-			txMeta.UnlockTimestampNanoSecs)
+			vestingEndTimestampNanoSecs)
 	if err != nil {
 		return 0, 0, nil, errors.New("_connectCoinLockupTransfer" +
 			" cannot verify balance change safeguard check; cannot fetch new sender locked balance entry")
@@ -2396,7 +2516,7 @@ func (bav *UtxoView) _connectCoinLockupTransfer(
 			receiverPKID,
 			profilePKID,
 			txMeta.UnlockTimestampNanoSecs,
-			txMeta.UnlockTimestampNanoSecs)
+			vestingEndTimestampNanoSecs)
 	if err != nil {
 		return 0, 0, nil, errors.New("_connectCoinLockupTransfer" +
 			" cannot verify balance change safeguard check; cannot fetch new receiver locked balance entry")
@@ -2441,7 +2561,10 @@ func (bav *UtxoView) _disconnectCoinLockupTransfer(
 	}
 
 	// Sanity check the OperationTypeCoinLockupTransfer exists.
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[CoinLockupTransferOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCoinLockupTransfer: ")
+	}
 	if operationData.PrevSenderLockedBalanceEntry == nil || operationData.PrevSenderLockedBalanceEntry.isDeleted {
 		return fmt.Errorf("_disconnectCoinLockupTransfer: Trying to revert OperationTypeCoinLockupTransfer " +
 			"but found nil or deleted PrevSenderLockedBalanceEntry")
@@ -2457,7 +2580,7 @@ func (bav *UtxoView) _disconnectCoinLockupTransfer(
 			operationData.PrevSenderLockedBalanceEntry.HODLerPKID,
 			operationData.PrevSenderLockedBalanceEntry.ProfilePKID,
 			operationData.PrevSenderLockedBalanceEntry.UnlockTimestampNanoSecs,
-			operationData.PrevSenderLockedBalanceEntry.UnlockTimestampNanoSecs)
+			operationData.PrevSenderLockedBalanceEntry.VestingEndTimestampNanoSecs)
 	if err != nil {
 		return errors.Wrap(err, "_disconnectCoinLockupTransfer failed to fetch senderLockedBalanceEntry")
 	}
@@ -2475,7 +2598,7 @@ func (bav *UtxoView) _disconnectCoinLockupTransfer(
 			operationData.PrevReceiverLockedBalanceEntry.HODLerPKID,
 			operationData.PrevReceiverLockedBalanceEntry.ProfilePKID,
 			operationData.PrevReceiverLockedBalanceEntry.UnlockTimestampNanoSecs,
-			operationData.PrevReceiverLockedBalanceEntry.UnlockTimestampNanoSecs)
+			operationData.PrevReceiverLockedBalanceEntry.VestingEndTimestampNanoSecs)
 	if err != nil {
 		return errors.Wrap(err, "_disconnectCoinLockupTransfer failed to fetch receiverLockedBalanceEntry")
 	}
@@ -2504,6 +2627,14 @@ func (bav *UtxoView) _disconnectCoinLockupTransfer(
 	bav._setLockedBalanceEntry(operationData.PrevSenderLockedBalanceEntry)
 	bav._setLockedBalanceEntry(operationData.PrevReceiverLockedBalanceEntry)
 
+	// Move the vesting schedule back to the sender if the transfer moved it.
+	if blockHeight >= bav.Params.ForkHeights.LockupPositionTransfersBlockHeight {
+		if err = bav._disconnectLockupPositionTransfer(
+			operationData.PrevSenderLockedBalanceEntry, operationData.PrevReceiverLockedBalanceEntry); err != nil {
+			return errors.Wrap(err, "_disconnectCoinLockupTransfer")
+		}
+	}
+
 	// By here we only need to disconnect the basic transfer associated with the transaction.
 	basicTransferOps := utxoOpsForTxn[:operationIndex]
 	err = bav._disconnectBasicTransfer(currentTxn, txnHash, basicTransferOps, blockHeight)
@@ -2601,6 +2732,47 @@ func (bav *UtxoView) _connectCoinUnlock(
 	// Unlock all unvested unlockable locked balance entries.
 	var prevLockedBalanceEntries []*LockedBalanceEntry
 	for _, unlockableLockedBalanceEntry := range unvestedUnlockableLockedBalanceEntries {
+		// If the locked balance has a vesting schedule, only the coins that are vested and haven't
+		// been unlocked yet can be unlocked.
+		var vestingScheduleEntry *LockupVestingScheduleEntry
+		if blockHeight >= bav.Params.ForkHeights.LockupVestingSchedulesBlockHeight {
+			vestingScheduleEntry, err = bav.GetLockupVestingScheduleEntry(
+				unlockableLockedBalanceEntry.HODLerPKID,
+				unlockableLockedBalanceEntry.ProfilePKID,
+				unlockableLockedBalanceEntry.UnlockTimestampNanoSecs)
+			if err != nil {
+				return 0, 0, nil,
+					errors.Wrap(err, "_connectCoinUnlock failed to fetch lockupVestingScheduleEntry")
+			}
+		}
+		if vestingScheduleEntry != nil {
+			amountToUnlock, err := vestingScheduleEntry.GetReleasableBaseUnits(
+				unlockableLockedBalanceEntry, uint64(blockHeight))
+			if err != nil {
+				return 0, 0, nil, errors.Wrap(err, "_connectCoinUnlock")
+			}
+			if amountToUnlock.IsZero() {
+				continue
+			}
+			if amountToUnlock.Lt(&unlockableLockedBalanceEntry.BalanceBaseUnits) {
+				unlockedBalance, err = SafeUint256().Add(unlockedBalance, amountToUnlock)
+				if err != nil {
+					return 0, 0, nil,
+						errors.Wrap(RuleErrorCoinUnlockUnlockableCoinsOverflow, "_connectCoinUnlock")
+				}
+
+				// Append the LockedBalanceEntry in the event we rollback the transaction.
+				prevLockedBalanceEntries = append(prevLockedBalanceEntries, unlockableLockedBalanceEntry.Copy())
+
+				// Update the LockedBalanceEntry under the same key with the coins that haven't vested.
+				remainingLockedBalanceEntry := unlockableLockedBalanceEntry.Copy()
+				remainingLockedBalanceEntry.BalanceBaseUnits = *uint256.NewInt(0).Sub(
+					&remainingLockedBalanceEntry.BalanceBaseUnits, amountToUnlock)
+				bav._setLockedBalanceEntry(remainingLockedBalanceEntry)
+				continue
+			}
+		}
+
 		unlockedBalance, err =
 			SafeUint256().Add(unlockedBalance, &unlockableLockedBalanceEntry.BalanceBaseUnits)
 		if err != nil {
@@ -2663,6 +2835,13 @@ func (bav *UtxoView) _connectCoinUnlock(
 		}
 	}
 
+	// If every unlockable locked balance has a vesting schedule that hasn't released anything new,
+	// there's nothing to unlock.
+	if len(prevLockedBalanceEntries) == 0 {
+		return 0, 0, nil,
+			errors.Wrap(RuleErrorCoinUnlockNoUnlockableCoinsFound, "_connectCoinUnlock")
+	}
+
 	// Credit the transactor with either DAO coins or DeSo for this unlock.
 	prevTransactorBalanceEntry :=
 		bav._getBalanceEntryForHODLerPKIDAndCreatorPKID(hodlerPKID, profilePKID, true)
@@ -2768,7 +2947,10 @@ func (bav *UtxoView) _disconnectCoinUnlock(
 	}
 
 	// Sanity check the CoinUnlock operation exists.
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[CoinUnlockOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCoinUnlock: ")
+	}
 	if operationData.PrevLockedBalanceEntries == nil || len(operationData.PrevLockedBalanceEntries) == 0 {
 		return fmt.Errorf("_disconnectCoinUnlock: Trying to revert OperationTypeCoinUnlock " +
 			"but found nil or empty previous locked balance entries slice")
@@ -2855,7 +3037,7 @@ func (bav *UtxoView) _disconnectCoinUnlock(
 
 	// By here we only need to disconnect the basic transfer associated with the transaction.
 	basicTransferOps := utxoOpsForTxn[:operationIndex]
-	err := bav._disconnectBasicTransfer(currentTxn, txnHash, basicTransferOps, blockHeight)
+	err = bav._disconnectBasicTransfer(currentTxn, txnHash, basicTransferOps, blockHeight)
 	if err != nil {
 		return errors.Wrap(err, "_disconnectCoinUnlock")
 	}
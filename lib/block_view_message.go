@@ -303,15 +303,12 @@ func ReadMessageVersion(txn *MsgDeSoTxn) (_version uint8, _err error) {
 	}
 
 	// Check the version of the message by looking at the MessagesVersionString field in ExtraData.
-	var version uint64
-	var err error
-	if extraV, hasExtraV := txn.ExtraData[MessagesVersionString]; hasExtraV {
-		rr := bytes.NewReader(extraV)
-		version, err = ReadUvarint(rr)
-		if err != nil {
-			return 0, errors.Wrapf(RuleErrorPrivateMessageInvalidVersion,
-				"ReadMessageVersion: Problem reading message version from ExtraData, error: (%v)", err)
-		}
+	version, hasExtraV, err := txn.GetExtraDataUint64(MessagesVersionString)
+	if err != nil {
+		return 0, errors.Wrapf(RuleErrorPrivateMessageInvalidVersion,
+			"ReadMessageVersion: Problem reading message version from ExtraData, error: (%v)", err)
+	}
+	if hasExtraV {
 		if version < 0 || version > MessagesVersion3 {
 			return 0, errors.Wrapf(RuleErrorPrivateMessageInvalidVersion,
 				"ReadMessageVersion: Problem reading message version from ExtraData, expecting version "+
@@ -981,12 +978,16 @@ func (bav *UtxoView) _disconnectMessagingGroup(
 			"OperationTypeMessagingKey but found type %v",
 			utxoOpsForTxn[operationIndex].Type)
 	}
+	operationData, err := GetUtxoOperationData[MessagingKeyOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectMessagingGroup: ")
+	}
 
 	// Now we know the txMeta is MessagingGroupKey
 	txMeta := currentTxn.TxnMeta.(*MessagingGroupMetadata)
 
 	// Sanity check that the messaging public key and key name are valid
-	err := ValidateGroupPublicKeyAndName(txMeta.MessagingPublicKey, txMeta.MessagingGroupKeyName)
+	err = ValidateGroupPublicKeyAndName(txMeta.MessagingPublicKey, txMeta.MessagingGroupKeyName)
 	if err != nil {
 		return errors.Wrapf(err, "_disconnectMessagingGroup: failed validating the messaging "+
 			"public key and key name")
@@ -1005,7 +1006,7 @@ func (bav *UtxoView) _disconnectMessagingGroup(
 		return fmt.Errorf("_disconnectBasicTransfer: Error, this key was already deleted "+
 			"messagingKey: %v", messagingKey)
 	}
-	prevMessagingKeyEntry := utxoOpsForTxn[operationIndex].PrevMessagingKeyEntry
+	prevMessagingKeyEntry := operationData.PrevMessagingKeyEntry
 	// sanity check that the prev entry and current entry match
 	if prevMessagingKeyEntry != nil {
 		if !reflect.DeepEqual(messagingKeyEntry.MessagingPublicKey[:], prevMessagingKeyEntry.MessagingPublicKey[:]) ||
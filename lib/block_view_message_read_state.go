@@ -0,0 +1,546 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Message Read State: Records how far a member has read the conversation of an access group, so that
+// messaging clients can sync read state across devices. The conversation of an access group is the group
+// chat of that group, or, for DMs, the thread with the owner of that group. The read state is a watermark:
+// the member has read every message in the conversation with a timestamp at or before it.
+//
+// Read state is set with an extra-data convention on BasicTransfer transactions, the same way diamonds are
+// given. A BasicTransfer that sets MessageReadStateGroupOwnerPublicKeyKey, MessageReadStateGroupKeyNameKey,
+// and MessageReadStateWatermarkNanosKey in its extra data sets the transactor's watermark for that access
+// group. The transfer doesn't need any outputs, so updating the read state only costs the txn fee.
+//
+// A member can only set their own watermark, and the watermark can only move forward. We don't require the
+// member to be in the access group, since the reader of a DM isn't a member of the sender's group. Since the
+// read state of a member is keyed by the member's public key, it can't be used to affect anyone else's.
+
+//
+// TYPES: MessageReadStateEntry
+//
+
+type MessageReadStateEntry struct {
+	// The access group whose conversation was read. The AccessGroupOwnerPublicKey, the
+	// AccessGroupKeyName, and the MemberPublicKey together are the primary key for a
+	// MessageReadStateEntry.
+	AccessGroupOwnerPublicKey *PublicKey
+	AccessGroupKeyName        *GroupKeyName
+	// The member who read the conversation.
+	MemberPublicKey *PublicKey
+	// Every message in the conversation with a timestamp at or before the watermark has been read.
+	ReadWatermarkTimestampNanos uint64
+	isDeleted                   bool
+}
+
+type MessageReadStateKey struct {
+	AccessGroupId   AccessGroupId
+	MemberPublicKey PublicKey
+}
+
+func (entry *MessageReadStateEntry) Copy() *MessageReadStateEntry {
+	groupKeyName := *entry.AccessGroupKeyName
+	return &MessageReadStateEntry{
+		AccessGroupOwnerPublicKey:   NewPublicKey(entry.AccessGroupOwnerPublicKey.ToBytes()),
+		AccessGroupKeyName:          &groupKeyName,
+		MemberPublicKey:             NewPublicKey(entry.MemberPublicKey.ToBytes()),
+		ReadWatermarkTimestampNanos: entry.ReadWatermarkTimestampNanos,
+		isDeleted:                   entry.isDeleted,
+	}
+}
+
+func (entry *MessageReadStateEntry) GetAccessGroupId() *AccessGroupId {
+	return &AccessGroupId{
+		AccessGroupOwnerPublicKey: *entry.AccessGroupOwnerPublicKey,
+		AccessGroupKeyName:        *entry.AccessGroupKeyName,
+	}
+}
+
+func (entry *MessageReadStateEntry) ToMapKey() MessageReadStateKey {
+	return MessageReadStateKey{
+		AccessGroupId:   *entry.GetAccessGroupId(),
+		MemberPublicKey: *entry.MemberPublicKey,
+	}
+}
+
+func (entry *MessageReadStateEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.AccessGroupOwnerPublicKey, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.AccessGroupKeyName, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.MemberPublicKey, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.ReadWatermarkTimestampNanos)...)
+	return data
+}
+
+func (entry *MessageReadStateEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// AccessGroupOwnerPublicKey
+	entry.AccessGroupOwnerPublicKey, err = DecodeDeSoEncoder(&PublicKey{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "MessageReadStateEntry.Decode: Problem reading AccessGroupOwnerPublicKey: ")
+	}
+
+	// AccessGroupKeyName
+	entry.AccessGroupKeyName, err = DecodeDeSoEncoder(&GroupKeyName{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "MessageReadStateEntry.Decode: Problem reading AccessGroupKeyName: ")
+	}
+
+	// MemberPublicKey
+	entry.MemberPublicKey, err = DecodeDeSoEncoder(&PublicKey{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "MessageReadStateEntry.Decode: Problem reading MemberPublicKey: ")
+	}
+
+	// ReadWatermarkTimestampNanos
+	entry.ReadWatermarkTimestampNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MessageReadStateEntry.Decode: Problem reading ReadWatermarkTimestampNanos: ")
+	}
+
+	return nil
+}
+
+func (entry *MessageReadStateEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *MessageReadStateEntry) GetEncoderType() EncoderType {
+	return EncoderTypeMessageReadStateEntry
+}
+
+func (entry *MessageReadStateEntry) IsDeleted() bool {
+	return entry.isDeleted
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForMessageReadState(accessGroupId *AccessGroupId, memberPublicKey *PublicKey) []byte {
+	key := DBPrefixKeyForMessageReadStatesByAccessGroupId(accessGroupId)
+	key = append(key, memberPublicKey.ToBytes()...)
+	return key
+}
+
+func DBPrefixKeyForMessageReadStatesByAccessGroupId(accessGroupId *AccessGroupId) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixMessageReadStateByAccessGroupIdAndMember...)
+	prefixCopy = append(prefixCopy, accessGroupId.AccessGroupOwnerPublicKey.ToBytes()...)
+	return append(prefixCopy, accessGroupId.AccessGroupKeyName.ToBytes()...)
+}
+
+func DBGetMessageReadStateEntry(
+	handle *badger.DB, snap *Snapshot, accessGroupId *AccessGroupId, memberPublicKey *PublicKey,
+) (*MessageReadStateEntry, error) {
+	var ret *MessageReadStateEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetMessageReadStateEntryWithTxn(txn, snap, accessGroupId, memberPublicKey)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetMessageReadStateEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, accessGroupId *AccessGroupId, memberPublicKey *PublicKey,
+) (*MessageReadStateEntry, error) {
+	// Retrieve MessageReadStateEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForMessageReadState(accessGroupId, memberPublicKey))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetMessageReadStateEntryWithTxn: problem retrieving MessageReadStateEntry")
+	}
+
+	// Decode MessageReadStateEntry from bytes.
+	entry := &MessageReadStateEntry{}
+	rr := bytes.NewReader(entryBytes)
+	if exist, err := DecodeFromBytes(entry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetMessageReadStateEntryWithTxn: problem decoding MessageReadStateEntry")
+	}
+	return entry, nil
+}
+
+func DBGetMessageReadStateEntriesForAccessGroup(
+	handle *badger.DB, accessGroupId *AccessGroupId,
+) ([]*MessageReadStateEntry, error) {
+	var ret []*MessageReadStateEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetMessageReadStateEntriesForAccessGroupWithTxn(txn, accessGroupId)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetMessageReadStateEntriesForAccessGroupWithTxn(
+	txn *badger.Txn, accessGroupId *AccessGroupId,
+) ([]*MessageReadStateEntry, error) {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(
+		txn, DBPrefixKeyForMessageReadStatesByAccessGroupId(accessGroupId), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetMessageReadStateEntriesForAccessGroupWithTxn: problem retrieving MessageReadStateEntries")
+	}
+
+	var entries []*MessageReadStateEntry
+	for _, entryBytes := range valsFound {
+		rr := bytes.NewReader(entryBytes)
+		entry, err := DecodeDeSoEncoder(&MessageReadStateEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetMessageReadStateEntriesForAccessGroupWithTxn: problem decoding MessageReadStateEntry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutMessageReadStateEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *MessageReadStateEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutMessageReadStateEntryWithTxn: called with nil MessageReadStateEntry")
+		return nil
+	}
+
+	key := DBKeyForMessageReadState(entry.GetAccessGroupId(), entry.MemberPublicKey)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutMessageReadStateEntryWithTxn: problem storing MessageReadStateEntry in index PrefixMessageReadStateByAccessGroupIdAndMember",
+		)
+	}
+	return nil
+}
+
+func DBDeleteMessageReadStateEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *MessageReadStateEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteMessageReadStateEntryWithTxn: called with nil MessageReadStateEntry")
+		return nil
+	}
+
+	key := DBKeyForMessageReadState(entry.GetAccessGroupId(), entry.MemberPublicKey)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteMessageReadStateEntryWithTxn: problem deleting MessageReadStateEntry from index PrefixMessageReadStateByAccessGroupIdAndMember",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+// SetMessageReadStateExtraData sets the extra data keys that make a BasicTransfer set the transactor's
+// read watermark for the access group.
+func SetMessageReadStateExtraData(
+	extraData map[string][]byte, accessGroupId *AccessGroupId, readWatermarkTimestampNanos uint64,
+) error {
+	if err := SetExtraDataPublicKey(
+		extraData, MessageReadStateGroupOwnerPublicKeyKey, &accessGroupId.AccessGroupOwnerPublicKey); err != nil {
+		return errors.Wrapf(err, "SetMessageReadStateExtraData: ")
+	}
+	extraData[MessageReadStateGroupKeyNameKey] = append([]byte{}, AccessKeyNameDecode(&accessGroupId.AccessGroupKeyName)...)
+	if err := SetExtraDataUint64(extraData, MessageReadStateWatermarkNanosKey, readWatermarkTimestampNanos); err != nil {
+		return errors.Wrapf(err, "SetMessageReadStateExtraData: ")
+	}
+	return nil
+}
+
+// CreateMessageReadStateTxn creates a BasicTransfer that sets the transactor's read watermark for the
+// conversation of the access group.
+func (bc *Blockchain) CreateMessageReadStateTxn(
+	memberPublicKey []byte,
+	accessGroupId *AccessGroupId,
+	readWatermarkTimestampNanos uint64,
+	extraData map[string][]byte,
+	// Standard transaction fields
+	minFeeRateNanosPerKB uint64, mempool Mempool, additionalOutputs []*DeSoOutput) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _spendAmount uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	if accessGroupId == nil {
+		return nil, 0, 0, 0, 0, fmt.Errorf("Blockchain.CreateMessageReadStateTxn: accessGroupId is nil")
+	}
+
+	readStateExtraData := make(map[string][]byte)
+	if err := SetMessageReadStateExtraData(readStateExtraData, accessGroupId, readWatermarkTimestampNanos); err != nil {
+		return nil, 0, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateMessageReadStateTxn: ")
+	}
+	txn := &MsgDeSoTxn{
+		PublicKey: memberPublicKey,
+		TxnMeta:   &BasicTransferMetadata{},
+		TxOutputs: additionalOutputs,
+		ExtraData: mergeExtraData(extraData, readStateExtraData),
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	totalInput, spendAmount, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateMessageReadStateTxn: Problem adding inputs: ")
+	}
+	return txn, totalInput, spendAmount, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// _getMessageReadStateFromTxn returns the access group and read watermark set in the txn's extra data. If
+// none of the message read state keys are set, it returns false.
+func _getMessageReadStateFromTxn(txn *MsgDeSoTxn) (
+	_accessGroupId *AccessGroupId, _readWatermarkTimestampNanos uint64, _hasReadState bool, _err error) {
+
+	groupOwnerPublicKeyBytes, hasGroupOwnerPublicKey := txn.ExtraData[MessageReadStateGroupOwnerPublicKeyKey]
+	groupKeyNameBytes, hasGroupKeyName := txn.ExtraData[MessageReadStateGroupKeyNameKey]
+	_, hasWatermark := txn.ExtraData[MessageReadStateWatermarkNanosKey]
+	if !hasGroupOwnerPublicKey && !hasGroupKeyName && !hasWatermark {
+		return nil, 0, false, nil
+	}
+	if !hasGroupOwnerPublicKey || !hasGroupKeyName || !hasWatermark {
+		return nil, 0, false, RuleErrorMessageReadStateMissingField
+	}
+
+	if err := IsByteArrayValidPublicKey(groupOwnerPublicKeyBytes); err != nil {
+		return nil, 0, false, errors.Wrapf(RuleErrorMessageReadStateInvalidGroupOwnerPublicKey, "%v", err)
+	}
+	// We don't use ValidateAccessGroupPublicKeyAndName here since an empty key name is allowed. It
+	// refers to the owner's base group, which is what DMs sent to the owner's main key use.
+	if len(groupKeyNameBytes) > MaxAccessGroupKeyNameCharacters {
+		return nil, 0, false, errors.Wrapf(RuleErrorMessageReadStateInvalidGroupKeyName,
+			"%d characters > %d", len(groupKeyNameBytes), MaxAccessGroupKeyNameCharacters)
+	}
+	readWatermarkTimestampNanos, _, err := txn.GetExtraDataUint64(MessageReadStateWatermarkNanosKey)
+	if err != nil || readWatermarkTimestampNanos == 0 {
+		return nil, 0, false, RuleErrorMessageReadStateInvalidWatermark
+	}
+	accessGroupId := NewAccessGroupId(NewPublicKey(groupOwnerPublicKeyBytes), append([]byte{}, groupKeyNameBytes...))
+	return accessGroupId, readWatermarkTimestampNanos, true, nil
+}
+
+// _connectMessageReadState sets the transactor's read watermark if the BasicTransfer carries one in its extra
+// data. It returns the UtxoOperation needed to disconnect the change, or nil if the txn doesn't set a watermark.
+func (bav *UtxoView) _connectMessageReadState(txn *MsgDeSoTxn, blockHeight uint32) (*UtxoOperation, error) {
+	if blockHeight < bav.Params.ForkHeights.MessageReadStateBlockHeight ||
+		txn.TxnMeta.GetTxnType() != TxnTypeBasicTransfer {
+		return nil, nil
+	}
+	accessGroupId, readWatermarkTimestampNanos, hasReadState, err := _getMessageReadStateFromTxn(txn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_connectMessageReadState: ")
+	}
+	if !hasReadState {
+		return nil, nil
+	}
+
+	// The conversation has to exist for the watermark to mean anything.
+	exists, err := bav.GetAccessGroupExistenceWithAccessGroupId(accessGroupId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_connectMessageReadState: ")
+	}
+	if !exists {
+		return nil, errors.Wrapf(RuleErrorMessageReadStateAccessGroupDoesNotExist,
+			"_connectMessageReadState: access group %v", accessGroupId)
+	}
+
+	// The watermark can only move forward.
+	memberPublicKey := NewPublicKey(txn.PublicKey)
+	prevEntry, err := bav.GetReadState(accessGroupId, memberPublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_connectMessageReadState: ")
+	}
+	if prevEntry != nil && readWatermarkTimestampNanos <= prevEntry.ReadWatermarkTimestampNanos {
+		return nil, errors.Wrapf(RuleErrorMessageReadStateWatermarkNotIncreasing,
+			"_connectMessageReadState: watermark %d <= current watermark %d",
+			readWatermarkTimestampNanos, prevEntry.ReadWatermarkTimestampNanos)
+	}
+
+	var prevEntryCopy *MessageReadStateEntry
+	if prevEntry != nil {
+		prevEntryCopy = prevEntry.Copy()
+	}
+	groupKeyName := accessGroupId.AccessGroupKeyName
+	bav._setMessageReadStateEntryMappings(&MessageReadStateEntry{
+		AccessGroupOwnerPublicKey:   NewPublicKey(accessGroupId.AccessGroupOwnerPublicKey.ToBytes()),
+		AccessGroupKeyName:          &groupKeyName,
+		MemberPublicKey:             memberPublicKey,
+		ReadWatermarkTimestampNanos: readWatermarkTimestampNanos,
+	})
+	return &UtxoOperation{
+		Type:                      OperationTypeMessageReadState,
+		PrevMessageReadStateEntry: prevEntryCopy,
+	}, nil
+}
+
+// _disconnectMessageReadState reverts the read watermark set by the BasicTransfer.
+func (bav *UtxoView) _disconnectMessageReadState(currentTxn *MsgDeSoTxn, operation *UtxoOperation) error {
+	if operation.Type != OperationTypeMessageReadState {
+		return fmt.Errorf("_disconnectMessageReadState: trying to revert %v but found %v",
+			OperationTypeMessageReadState, operation.Type)
+	}
+	operationData, err := GetUtxoOperationData[MessageReadStateOperationData](operation)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectMessageReadState: ")
+	}
+	accessGroupId, _, hasReadState, err := _getMessageReadStateFromTxn(currentTxn)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectMessageReadState: ")
+	}
+	if !hasReadState {
+		return fmt.Errorf("_disconnectMessageReadState: found read state op on txn without read state")
+	}
+
+	memberPublicKey := NewPublicKey(currentTxn.PublicKey)
+	currentEntry, err := bav.GetReadState(accessGroupId, memberPublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectMessageReadState: ")
+	}
+	if currentEntry == nil {
+		return fmt.Errorf("_disconnectMessageReadState: no read state found for member %v and access group %v",
+			memberPublicKey, accessGroupId)
+	}
+	bav._deleteMessageReadStateEntryMappings(currentEntry)
+	if operationData.PrevMessageReadStateEntry != nil {
+		bav._setMessageReadStateEntryMappings(operationData.PrevMessageReadStateEntry)
+	}
+	return nil
+}
+
+// GetReadState returns the read watermark of the member for the conversation of the access group, or nil
+// if the member hasn't set one.
+func (bav *UtxoView) GetReadState(accessGroupId *AccessGroupId, memberPublicKey *PublicKey) (*MessageReadStateEntry, error) {
+	if accessGroupId == nil || memberPublicKey == nil {
+		return nil, fmt.Errorf("UtxoView.GetReadState: Called with nil accessGroupId or memberPublicKey")
+	}
+
+	// First check the UtxoView.
+	mapKey := MessageReadStateKey{AccessGroupId: *accessGroupId, MemberPublicKey: *memberPublicKey}
+	if entry, exists := bav.MessageReadStateKeyToMessageReadStateEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// If no MessageReadStateEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbEntry, err := DBGetMessageReadStateEntry(bav.Handle, bav.Snapshot, accessGroupId, memberPublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetReadState: ")
+	}
+	if dbEntry != nil {
+		// Cache the MessageReadStateEntry from the db in the UtxoView.
+		bav._setMessageReadStateEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetReadStatesForAccessGroup returns the read watermarks of every member who has set one for the
+// conversation of the access group, merging the entries in the view with the entries in the database.
+func (bav *UtxoView) GetReadStatesForAccessGroup(accessGroupId *AccessGroupId) ([]*MessageReadStateEntry, error) {
+	if accessGroupId == nil {
+		return nil, fmt.Errorf("UtxoView.GetReadStatesForAccessGroup: Called with nil accessGroupId")
+	}
+
+	// Load the entries from the database into the view. We don't overwrite the
+	// entries in the view since they're more recent than the database.
+	dbEntries, err := DBGetMessageReadStateEntriesForAccessGroup(bav.Handle, accessGroupId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetReadStatesForAccessGroup: ")
+	}
+	for _, entry := range dbEntries {
+		if _, exists := bav.MessageReadStateKeyToMessageReadStateEntry[entry.ToMapKey()]; !exists {
+			bav._setMessageReadStateEntryMappings(entry)
+		}
+	}
+
+	var entries []*MessageReadStateEntry
+	for mapKey, entry := range bav.MessageReadStateKeyToMessageReadStateEntry {
+		if !entry.isDeleted && mapKey.AccessGroupId == *accessGroupId {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (bav *UtxoView) _setMessageReadStateEntryMappings(entry *MessageReadStateEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setMessageReadStateEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.MessageReadStateKeyToMessageReadStateEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteMessageReadStateEntryMappings(entry *MessageReadStateEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteMessageReadStateEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setMessageReadStateEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushMessageReadStateEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, entryIter := range bav.MessageReadStateKeyToMessageReadStateEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(entry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushMessageReadStateEntriesToDbWithTxn: MessageReadStateEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(),
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if entry.isDeleted {
+			if err := DBDeleteMessageReadStateEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushMessageReadStateEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutMessageReadStateEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushMessageReadStateEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageReadState(t *testing.T) {
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	t.Run("flushToDB=false", func(t *testing.T) {
+		_testMessageReadState(t, false)
+	})
+	t.Run("flushToDB=true", func(t *testing.T) {
+		_testMessageReadState(t, true)
+	})
+}
+
+func _testMessageReadState(t *testing.T, flushToDB bool) {
+	var err error
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	params.ForkHeights.MessageReadStateBlockHeight = uint32(1)
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		params.ForkHeights.MessageReadStateBlockHeight = uint32(math.MaxUint32)
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}()
+
+	utxoView := func() *UtxoView {
+		newUtxoView, err := mempool.GetAugmentedUniversalView()
+		require.NoError(t, err)
+		return newUtxoView
+	}
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	blockHeight := uint64(chain.blockTip().Height + 1)
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       uint32(blockHeight),
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e6)
+
+	// m0 creates a group chat.
+	groupKeyName := []byte("group-chat")
+	{
+		prevBalance := _getBalance(t, chain, mempool, m0Pub)
+		txn, err := _createSignedAccessGroupTransaction(t, chain, mempool, m0Priv, m0PkBytes, m0PkBytes,
+			m3PkBytes, groupKeyName, AccessGroupOperationTypeCreate, nil)
+		require.NoError(t, err)
+		utxoOps, _, _, _, err := mempool.universalUtxoView.ConnectTransaction(
+			txn, txn.Hash(), testMeta.savedHeight, 0, true, false)
+		require.NoError(t, err)
+		testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+		testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+		testMeta.txns = append(testMeta.txns, txn)
+	}
+	groupChatId := NewAccessGroupId(NewPublicKey(m0PkBytes), groupKeyName)
+	// The DM thread with m0, from the perspective of the reader, is m0's base group.
+	dmThreadId := NewAccessGroupId(NewPublicKey(m0PkBytes), BaseGroupKeyName().ToBytes())
+
+	requireWatermark := func(accessGroupId *AccessGroupId, memberPkBytes []byte, watermark uint64) {
+		entry, err := utxoView().GetReadState(accessGroupId, NewPublicKey(memberPkBytes))
+		require.NoError(t, err)
+		if watermark == 0 {
+			require.Nil(t, entry)
+			return
+		}
+		require.NotNil(t, entry)
+		require.Equal(t, watermark, entry.ReadWatermarkTimestampNanos)
+	}
+
+	{
+		// RuleErrorMessageReadStateMissingField
+		extraData := map[string][]byte{MessageReadStateGroupOwnerPublicKeyKey: m0PkBytes}
+		_, err = _submitMessageReadStateTxn(testMeta, m1Pub, m1Priv, extraData, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageReadStateMissingField)
+	}
+	{
+		// RuleErrorMessageReadStateInvalidGroupOwnerPublicKey
+		extraData := make(map[string][]byte)
+		require.NoError(t, SetMessageReadStateExtraData(extraData, groupChatId, 100))
+		extraData[MessageReadStateGroupOwnerPublicKeyKey] = []byte{1, 2, 3}
+		_, err = _submitMessageReadStateTxn(testMeta, m1Pub, m1Priv, extraData, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageReadStateInvalidGroupOwnerPublicKey)
+	}
+	{
+		// RuleErrorMessageReadStateInvalidGroupKeyName
+		extraData := make(map[string][]byte)
+		require.NoError(t, SetMessageReadStateExtraData(extraData, groupChatId, 100))
+		extraData[MessageReadStateGroupKeyNameKey] = make([]byte, MaxAccessGroupKeyNameCharacters+1)
+		_, err = _submitMessageReadStateTxn(testMeta, m1Pub, m1Priv, extraData, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageReadStateInvalidGroupKeyName)
+	}
+	{
+		// RuleErrorMessageReadStateInvalidWatermark
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m1Pub, m1Priv, groupChatId, 0, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageReadStateInvalidWatermark)
+	}
+	{
+		// RuleErrorMessageReadStateAccessGroupDoesNotExist
+		missingGroupId := NewAccessGroupId(NewPublicKey(m0PkBytes), []byte("missing"))
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m1Pub, m1Priv, missingGroupId, 100, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageReadStateAccessGroupDoesNotExist)
+	}
+	{
+		// Happy path: m1 and m2 set their watermarks for the group chat, and m1 sets one for the DM thread.
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m1Pub, m1Priv, groupChatId, 100, flushToDB)
+		require.NoError(t, err)
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m2Pub, m2Priv, groupChatId, 200, flushToDB)
+		require.NoError(t, err)
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m1Pub, m1Priv, dmThreadId, 300, flushToDB)
+		require.NoError(t, err)
+		requireWatermark(groupChatId, m1PkBytes, 100)
+		requireWatermark(groupChatId, m2PkBytes, 200)
+		requireWatermark(dmThreadId, m1PkBytes, 300)
+		requireWatermark(dmThreadId, m2PkBytes, 0)
+
+		entries, err := utxoView().GetReadStatesForAccessGroup(groupChatId)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+	}
+	{
+		// RuleErrorMessageReadStateWatermarkNotIncreasing
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m1Pub, m1Priv, groupChatId, 100, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageReadStateWatermarkNotIncreasing)
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m1Pub, m1Priv, groupChatId, 50, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageReadStateWatermarkNotIncreasing)
+	}
+	{
+		// Happy path: m1 moves its group chat watermark forward.
+		_, err = _submitMessageReadStateTxnForGroup(testMeta, m1Pub, m1Priv, groupChatId, 400, flushToDB)
+		require.NoError(t, err)
+		requireWatermark(groupChatId, m1PkBytes, 400)
+		requireWatermark(groupChatId, m2PkBytes, 200)
+	}
+
+	// Flush mempool to the db and test rollbacks.
+	require.NoError(t, mempool.universalUtxoView.FlushToDb(blockHeight))
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func _submitMessageReadStateTxnForGroup(
+	testMeta *TestMeta,
+	memberPublicKeyBase58Check string,
+	memberPrivateKeyBase58Check string,
+	accessGroupId *AccessGroupId,
+	readWatermarkTimestampNanos uint64,
+	flushToDB bool,
+) (_fees uint64, _err error) {
+	extraData := make(map[string][]byte)
+	require.NoError(testMeta.t, SetMessageReadStateExtraData(extraData, accessGroupId, readWatermarkTimestampNanos))
+	return _submitMessageReadStateTxn(testMeta, memberPublicKeyBase58Check, memberPrivateKeyBase58Check, extraData, flushToDB)
+}
+
+func _submitMessageReadStateTxn(
+	testMeta *TestMeta,
+	memberPublicKeyBase58Check string,
+	memberPrivateKeyBase58Check string,
+	extraData map[string][]byte,
+	flushToDB bool,
+) (_fees uint64, _err error) {
+	// Record the member's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, testMeta.mempool, memberPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	memberPkBytes, _, err := Base58CheckDecode(memberPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction. We build the BasicTransfer by hand so that we can test malformed extra data.
+	txn := &MsgDeSoTxn{
+		PublicKey: memberPkBytes,
+		TxnMeta:   &BasicTransferMetadata{},
+		ExtraData: extraData,
+	}
+	totalInputMake, _, changeAmountMake, feesMake, err := testMeta.chain.AddInputsAndChangeToTransaction(
+		txn, testMeta.feeRateNanosPerKb, testMeta.mempool)
+	require.NoError(testMeta.t, err)
+	require.Equal(testMeta.t, totalInputMake, changeAmountMake+feesMake)
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, memberPrivateKeyBase58Check)
+
+	// The read state is validated after the fee has been spent, so we try the txn against a copy of the view
+	// first to keep failing txns from leaving a partial spend behind, the same way the mempool does.
+	if _, _, _, _, err = testMeta.mempool.universalUtxoView.CopyUtxoView().ConnectTransaction(
+		txn, txn.Hash(), testMeta.savedHeight, 0, true, false); err != nil {
+		return 0, err
+	}
+
+	// Connect the transaction.
+	utxoOps, totalInput, _, fees, err := testMeta.mempool.universalUtxoView.ConnectTransaction(
+		txn, txn.Hash(), testMeta.savedHeight, 0, true, false)
+	require.NoError(testMeta.t, err)
+	require.Equal(testMeta.t, totalInput, totalInputMake)
+	require.Equal(testMeta.t, OperationTypeMessageReadState, utxoOps[len(utxoOps)-1].Type)
+	if flushToDB {
+		require.NoError(testMeta.t, testMeta.mempool.universalUtxoView.FlushToDb(uint64(testMeta.savedHeight)))
+	}
+	require.NoError(testMeta.t, testMeta.mempool.RegenerateReadOnlyView())
+
+	// The member only pays the txn fee.
+	require.Equal(
+		testMeta.t,
+		prevBalance-txn.TxnFeeNanos,
+		_getBalance(testMeta.t, testMeta.chain, testMeta.mempool, memberPublicKeyBase58Check),
+	)
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return fees, nil
+}
@@ -684,6 +684,12 @@ func (bav *UtxoView) _connectNewMessage(
 			"RecipientAccessGroupOwnerPublicKey and RecipientAccessGroupKeyName are invalid")
 	}
 
+	// Validate the manifest of the message's off-chain attachment, if it has one.
+	attachmentManifest, err := bav._getMessageAttachmentManifestFromTxn(txn, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectNewMessage: ")
+	}
+
 	// Connect basic txn to get the total input and the total output without
 	// considering the transaction metadata.
 	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(txn, txHash, blockHeight, verifySignatures)
@@ -702,6 +708,7 @@ func (bav *UtxoView) _connectNewMessage(
 		EncryptedText:                      txMeta.EncryptedText,
 		TimestampNanos:                     txMeta.TimestampNanos,
 		ExtraData:                          txn.ExtraData,
+		AttachmentManifest:                 attachmentManifest,
 	}
 
 	var prevNewMessageEntry *NewMessageEntry
@@ -800,7 +807,10 @@ func (bav *UtxoView) _disconnectNewMessage(
 			"OperationTypeNewMessage but found type %v",
 			utxoOpsForTxn[operationIndex].Type)
 	}
-	prevUtxoOp := utxoOpsForTxn[operationIndex]
+	prevUtxoOp, err := GetUtxoOperationData[NewMessageOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectNewMessage: ")
+	}
 
 	txMeta := currentTxn.TxnMeta.(*NewMessageMetadata)
 
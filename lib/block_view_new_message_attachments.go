@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Message Attachments: Lets a NewMessage transaction anchor an encrypted attachment that's too large to put
+// on-chain. The client encrypts the attachment, splits the ciphertext into chunks, and stores the chunks
+// off-chain wherever it likes. The transaction then carries a manifest listing the content hash and size of
+// every chunk, in order, under MessageAttachmentManifestKey in its extra data.
+//
+// Consensus validates the manifest against the size limits in DeSoParams and stores it on the NewMessageEntry,
+// so that the recipient can fetch the chunks from any source, verify each of them against its hash, and
+// reassemble them in the order the sender committed to. Consensus never sees the chunks themselves.
+
+//
+// TYPES: MessageAttachmentManifest
+//
+
+type MessageAttachmentChunk struct {
+	// ContentHash is the sha256 hash of the encrypted bytes of the chunk.
+	ContentHash *BlockHash
+	// SizeBytes is the length of the encrypted bytes of the chunk.
+	SizeBytes uint64
+}
+
+type MessageAttachmentManifest struct {
+	// Chunks are listed in the order they are concatenated to reassemble the attachment.
+	Chunks []*MessageAttachmentChunk
+}
+
+func (manifest *MessageAttachmentManifest) TotalSizeBytes() uint64 {
+	totalSizeBytes := uint64(0)
+	for _, chunk := range manifest.Chunks {
+		// The sum can't overflow for a manifest that passed validation, but we saturate
+		// anyway so that an unvalidated manifest can't wrap around.
+		if totalSizeBytes+chunk.SizeBytes < totalSizeBytes {
+			return ^uint64(0)
+		}
+		totalSizeBytes += chunk.SizeBytes
+	}
+	return totalSizeBytes
+}
+
+// ToBytes encodes the manifest the way it's stored under MessageAttachmentManifestKey in a
+// NewMessage transaction's extra data.
+func (manifest *MessageAttachmentManifest) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(manifest.Chunks)))...)
+	for _, chunk := range manifest.Chunks {
+		data = append(data, chunk.ContentHash[:]...)
+		data = append(data, UintToBuf(chunk.SizeBytes)...)
+	}
+	return data
+}
+
+// FromBytes decodes a manifest encoded with ToBytes.
+func (manifest *MessageAttachmentManifest) FromBytes(rr *bytes.Reader) error {
+	numChunks, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MessageAttachmentManifest.FromBytes: Problem reading number of chunks")
+	}
+	// Each chunk takes at least HashSizeBytes + 1 bytes, so this bounds the allocation below by the
+	// size of the input.
+	if numChunks > uint64(rr.Len())/(HashSizeBytes+1) {
+		return errors.Errorf("MessageAttachmentManifest.FromBytes: Number of chunks %d exceeds remaining bytes", numChunks)
+	}
+	chunks := make([]*MessageAttachmentChunk, 0, numChunks)
+	for ii := uint64(0); ii < numChunks; ii++ {
+		contentHash := &BlockHash{}
+		if _, err = io.ReadFull(rr, contentHash[:]); err != nil {
+			return errors.Wrapf(err, "MessageAttachmentManifest.FromBytes: Problem reading ContentHash of chunk %d", ii)
+		}
+		sizeBytes, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MessageAttachmentManifest.FromBytes: Problem reading SizeBytes of chunk %d", ii)
+		}
+		chunks = append(chunks, &MessageAttachmentChunk{ContentHash: contentHash, SizeBytes: sizeBytes})
+	}
+	manifest.Chunks = chunks
+	return nil
+}
+
+func (manifest *MessageAttachmentManifest) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	return manifest.ToBytes()
+}
+
+func (manifest *MessageAttachmentManifest) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	if err := manifest.FromBytes(rr); err != nil {
+		return errors.Wrapf(err, "MessageAttachmentManifest.Decode: ")
+	}
+	return nil
+}
+
+func (manifest *MessageAttachmentManifest) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (manifest *MessageAttachmentManifest) GetEncoderType() EncoderType {
+	return EncoderTypeMessageAttachmentManifest
+}
+
+//
+// HELPERS
+//
+
+// SetMessageAttachmentManifestExtraData sets the extra data key that attaches the manifest to a
+// NewMessage transaction.
+func SetMessageAttachmentManifestExtraData(extraData map[string][]byte, manifest *MessageAttachmentManifest) error {
+	if extraData == nil {
+		return errors.New("SetMessageAttachmentManifestExtraData: extraData is nil")
+	}
+	if manifest == nil {
+		return errors.New("SetMessageAttachmentManifestExtraData: manifest is nil")
+	}
+	extraData[MessageAttachmentManifestKey] = manifest.ToBytes()
+	return nil
+}
+
+// ValidateMessageAttachmentManifest checks the manifest against the attachment size limits in params.
+func ValidateMessageAttachmentManifest(manifest *MessageAttachmentManifest, params *DeSoParams) error {
+	if len(manifest.Chunks) == 0 {
+		return errors.Wrapf(RuleErrorMessageAttachmentManifestEmpty, "ValidateMessageAttachmentManifest: ")
+	}
+	if uint64(len(manifest.Chunks)) > params.MaxMessageAttachmentChunks {
+		return errors.Wrapf(RuleErrorMessageAttachmentTooManyChunks, "ValidateMessageAttachmentManifest: "+
+			"Number of chunks (%d) exceeds max (%d)", len(manifest.Chunks), params.MaxMessageAttachmentChunks)
+	}
+	for ii, chunk := range manifest.Chunks {
+		if chunk.SizeBytes == 0 {
+			return errors.Wrapf(RuleErrorMessageAttachmentChunkEmpty, "ValidateMessageAttachmentManifest: "+
+				"Chunk %d is empty", ii)
+		}
+		if chunk.SizeBytes > params.MaxMessageAttachmentChunkSizeBytes {
+			return errors.Wrapf(RuleErrorMessageAttachmentChunkTooLarge, "ValidateMessageAttachmentManifest: "+
+				"Chunk %d size (%d) exceeds max (%d)", ii, chunk.SizeBytes, params.MaxMessageAttachmentChunkSizeBytes)
+		}
+	}
+	if totalSizeBytes := manifest.TotalSizeBytes(); totalSizeBytes > params.MaxMessageAttachmentTotalSizeBytes {
+		return errors.Wrapf(RuleErrorMessageAttachmentTotalSizeTooLarge, "ValidateMessageAttachmentManifest: "+
+			"Total size (%d) exceeds max (%d)", totalSizeBytes, params.MaxMessageAttachmentTotalSizeBytes)
+	}
+	return nil
+}
+
+// _getMessageAttachmentManifestFromTxn returns the validated attachment manifest of a NewMessage transaction,
+// or nil if the transaction doesn't carry one. Before the MessageAttachmentsBlockHeight the manifest key is
+// treated like any other extra data.
+func (bav *UtxoView) _getMessageAttachmentManifestFromTxn(txn *MsgDeSoTxn, blockHeight uint32) (
+	*MessageAttachmentManifest, error) {
+
+	if blockHeight < bav.Params.ForkHeights.MessageAttachmentsBlockHeight {
+		return nil, nil
+	}
+	manifestBytes, exists := txn.ExtraData[MessageAttachmentManifestKey]
+	if !exists {
+		return nil, nil
+	}
+	manifest := &MessageAttachmentManifest{}
+	rr := bytes.NewReader(manifestBytes)
+	if err := manifest.FromBytes(rr); err != nil {
+		return nil, errors.Wrapf(RuleErrorMessageAttachmentManifestInvalid, "_getMessageAttachmentManifestFromTxn: %v", err)
+	}
+	if rr.Len() != 0 {
+		return nil, errors.Wrapf(RuleErrorMessageAttachmentManifestInvalid, "_getMessageAttachmentManifestFromTxn: "+
+			"%d trailing bytes after manifest", rr.Len())
+	}
+	if err := ValidateMessageAttachmentManifest(manifest, bav.Params); err != nil {
+		return nil, errors.Wrapf(err, "_getMessageAttachmentManifestFromTxn: ")
+	}
+	return manifest, nil
+}
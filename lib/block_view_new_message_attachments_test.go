@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func _testMessageAttachmentManifest(chunkSizes ...uint64) *MessageAttachmentManifest {
+	manifest := &MessageAttachmentManifest{}
+	for ii, chunkSize := range chunkSizes {
+		contentHash := Sha256DoubleHash([]byte{byte(ii)})
+		manifest.Chunks = append(manifest.Chunks, &MessageAttachmentChunk{
+			ContentHash: contentHash,
+			SizeBytes:   chunkSize,
+		})
+	}
+	return manifest
+}
+
+func TestMessageAttachmentManifestEncoding(t *testing.T) {
+	require := require.New(t)
+
+	manifest := _testMessageAttachmentManifest(100, 200, 300)
+	require.Equal(uint64(600), manifest.TotalSizeBytes())
+
+	decodedManifest := &MessageAttachmentManifest{}
+	require.NoError(decodedManifest.FromBytes(bytes.NewReader(manifest.ToBytes())))
+	require.Equal(manifest, decodedManifest)
+
+	// A truncated manifest fails to decode.
+	manifestBytes := manifest.ToBytes()
+	require.Error((&MessageAttachmentManifest{}).FromBytes(bytes.NewReader(manifestBytes[:len(manifestBytes)-1])))
+
+	// A chunk count larger than the input could hold fails to decode without allocating.
+	require.Error((&MessageAttachmentManifest{}).FromBytes(bytes.NewReader(UintToBuf(math.MaxUint64))))
+}
+
+func TestValidateMessageAttachmentManifest(t *testing.T) {
+	params := &DeSoParams{
+		MaxMessageAttachmentChunks:         3,
+		MaxMessageAttachmentChunkSizeBytes: 100,
+		MaxMessageAttachmentTotalSizeBytes: 250,
+	}
+	testCases := []struct {
+		name          string
+		manifest      *MessageAttachmentManifest
+		expectedError RuleError
+	}{
+		{"valid", _testMessageAttachmentManifest(100, 100, 50), ""},
+		{"empty", _testMessageAttachmentManifest(), RuleErrorMessageAttachmentManifestEmpty},
+		{"too many chunks", _testMessageAttachmentManifest(1, 1, 1, 1), RuleErrorMessageAttachmentTooManyChunks},
+		{"empty chunk", _testMessageAttachmentManifest(100, 0), RuleErrorMessageAttachmentChunkEmpty},
+		{"chunk too large", _testMessageAttachmentManifest(101), RuleErrorMessageAttachmentChunkTooLarge},
+		{"total too large", _testMessageAttachmentManifest(100, 100, 51), RuleErrorMessageAttachmentTotalSizeTooLarge},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := ValidateMessageAttachmentManifest(testCase.manifest, params)
+			if testCase.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), testCase.expectedError)
+		})
+	}
+}
+
+func TestNewMessageWithAttachment(t *testing.T) {
+	var err error
+
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	params.ForkHeights.MessageReadStateBlockHeight = uint32(1)
+	params.ForkHeights.MessageAttachmentsBlockHeight = uint32(1)
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	defer func() {
+		params.ForkHeights.MessageReadStateBlockHeight = uint32(math.MaxUint32)
+		params.ForkHeights.MessageAttachmentsBlockHeight = uint32(math.MaxUint32)
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}()
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	blockHeight := uint64(chain.blockTip().Height + 1)
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       uint32(blockHeight),
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+
+	m0PublicKey := NewPublicKey(m0PkBytes)
+	m1PublicKey := NewPublicKey(m1PkBytes)
+	dmThreadKey := MakeDmThreadKey(*m0PublicKey, *BaseGroupKeyName(), *m1PublicKey, *BaseGroupKeyName())
+
+	// sendDm sends a DM from m0 to m1 with the given extra data, connecting it to the mempool's view.
+	sendDm := func(timestampNanos uint64, extraData map[string][]byte) error {
+		prevBalance := _getBalance(t, chain, mempool, m0Pub)
+		txn, totalInputMake, changeAmountMake, feesMake, err := chain.CreateNewMessageTxn(
+			m0PkBytes, *m0PublicKey, *BaseGroupKeyName(), *m0PublicKey, *m1PublicKey, *BaseGroupKeyName(), *m1PublicKey,
+			[]byte{1, 2, 3}, timestampNanos, NewMessageTypeDm, NewMessageOperationCreate, extraData,
+			testMeta.feeRateNanosPerKb, mempool, []*DeSoOutput{})
+		require.NoError(t, err)
+		require.Equal(t, totalInputMake, changeAmountMake+feesMake)
+		_signTxn(t, txn, m0Priv)
+
+		utxoOps, _, _, _, err := mempool.universalUtxoView.ConnectTransaction(
+			txn, txn.Hash(), testMeta.savedHeight, 0, true, false)
+		if err != nil {
+			return err
+		}
+		require.NoError(t, mempool.RegenerateReadOnlyView())
+		testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+		testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+		testMeta.txns = append(testMeta.txns, txn)
+		return nil
+	}
+	getDm := func(timestampNanos uint64) *NewMessageEntry {
+		utxoView, err := mempool.GetAugmentedUniversalView()
+		require.NoError(t, err)
+		messageEntries, err := utxoView.GetPaginatedMessageEntriesForDmThread(dmThreadKey, math.MaxUint64, 100)
+		require.NoError(t, err)
+		for _, messageEntry := range messageEntries {
+			if messageEntry.TimestampNanos == timestampNanos {
+				return messageEntry
+			}
+		}
+		return nil
+	}
+
+	{
+		// A malformed manifest is rejected.
+		extraData := map[string][]byte{MessageAttachmentManifestKey: {1, 2, 3}}
+		err = sendDm(1, extraData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageAttachmentManifestInvalid)
+	}
+	{
+		// A manifest that exceeds the limits is rejected.
+		extraData := make(map[string][]byte)
+		require.NoError(t, SetMessageAttachmentManifestExtraData(extraData,
+			_testMessageAttachmentManifest(params.MaxMessageAttachmentChunkSizeBytes+1)))
+		err = sendDm(1, extraData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorMessageAttachmentChunkTooLarge)
+	}
+	manifest := _testMessageAttachmentManifest(params.MaxMessageAttachmentChunkSizeBytes, 1000)
+	{
+		// A message with a valid manifest stores it on the NewMessageEntry, and a message without
+		// one has no manifest.
+		extraData := make(map[string][]byte)
+		require.NoError(t, SetMessageAttachmentManifestExtraData(extraData, manifest))
+		require.NoError(t, sendDm(1, extraData))
+		require.NoError(t, sendDm(2, nil))
+
+		messageEntry := getDm(1)
+		require.NotNil(t, messageEntry)
+		require.Equal(t, manifest, messageEntry.AttachmentManifest)
+		messageEntry = getDm(2)
+		require.NotNil(t, messageEntry)
+		require.Nil(t, messageEntry.AttachmentManifest)
+	}
+	{
+		// The manifest survives a round trip through the db.
+		require.NoError(t, mempool.universalUtxoView.FlushToDb(blockHeight))
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+		messageEntries, err := utxoView.GetPaginatedMessageEntriesForDmThread(dmThreadKey, math.MaxUint64, 100)
+		require.NoError(t, err)
+		require.Len(t, messageEntries, 2)
+		for _, messageEntry := range messageEntries {
+			if messageEntry.TimestampNanos == 1 {
+				require.Equal(t, manifest, messageEntry.AttachmentManifest)
+			} else {
+				require.Nil(t, messageEntry.AttachmentManifest)
+			}
+		}
+	}
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
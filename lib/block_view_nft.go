@@ -469,15 +469,13 @@ func (bav *UtxoView) _getBuyNowExtraData(txn *MsgDeSoTxn, blockHeight uint32) (
 	buyNowPrice := uint64(0)
 
 	// Only extract the BuyNowPriceKey value if we are past the BuyNowAndNFTSplitsBlockHeight
-	if val, exists := txn.ExtraData[BuyNowPriceKey]; exists &&
-		blockHeight >= bav.Params.ForkHeights.BuyNowAndNFTSplitsBlockHeight {
-		var bytesRead int
-		buyNowPrice, bytesRead = Uvarint(val)
-		if bytesRead <= 0 {
-			return false, 0, errors.New(
+	if blockHeight >= bav.Params.ForkHeights.BuyNowAndNFTSplitsBlockHeight {
+		var err error
+		buyNowPrice, isBuyNow, err = txn.GetExtraDataUint64(BuyNowPriceKey)
+		if err != nil {
+			return false, 0, errors.Wrapf(err,
 				"_getBuyNowExtraData: Problem reading bytes for BuyNowPriceNanos")
 		}
-		isBuyNow = true
 	}
 
 	return isBuyNow, buyNowPrice, nil
@@ -2175,7 +2173,10 @@ func (bav *UtxoView) _disconnectCreateNFT(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*CreateNFTMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[CreateNFTOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectCreateNFT: ")
+	}
 	operationIndex--
 
 	// Get the postEntry corresponding to this txn.
@@ -2226,7 +2227,10 @@ func (bav *UtxoView) _disconnectUpdateNFT(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*UpdateNFTMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[UpdateNFTOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUpdateNFT: ")
+	}
 	operationIndex--
 
 	// In order to disconnect an updated NFT, we need to do the following:
@@ -2291,7 +2295,10 @@ func (bav *UtxoView) _disconnectAcceptNFTBid(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*AcceptNFTBidMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[NFTSoldOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAcceptNFTBid: ")
+	}
 	operationIndex--
 
 	// We sometimes have some extra AddUtxo operations we need to remove
@@ -2320,7 +2327,7 @@ func (bav *UtxoView) _disconnectAcceptNFTBid(
 			}
 		}
 	}
-	if err := bav._helpDisconnectNFTSold(operationData, txMeta.NFTPostHash, blockHeight); err != nil {
+	if err := bav._helpDisconnectNFTSold(OperationTypeAcceptNFTBid, operationData, txMeta.NFTPostHash, blockHeight); err != nil {
 		return errors.Wrapf(err, "_disconnectAcceptNFTBid: ")
 	}
 
@@ -2332,8 +2339,8 @@ func (bav *UtxoView) _disconnectAcceptNFTBid(
 		currentTxn, txnHash, utxoOpsForTxn[:operationIndex+1], blockHeight)
 }
 
-func (bav *UtxoView) _helpDisconnectNFTSold(operationData *UtxoOperation, nftPostHash *BlockHash,
-	blockHeight uint32) error {
+func (bav *UtxoView) _helpDisconnectNFTSold(operationType OperationType, operationData *NFTSoldOperationData,
+	nftPostHash *BlockHash, blockHeight uint32) error {
 
 	// In order to disconnect the selling of an NFT, we need to do the following:
 
@@ -2391,7 +2398,7 @@ func (bav *UtxoView) _helpDisconnectNFTSold(operationData *UtxoOperation, nftPos
 		// (4) Revert spent bidder UTXOs.
 		// as transaction inputs as opposed to bidder inputs that are specified in the transaction metadata since the transactor
 		// and the bidder are the same in this scenario.
-		switch operationData.Type {
+		switch operationType {
 		case OperationTypeAcceptNFTBid:
 			// (4) Revert spent bidder UTXOs.
 			if operationData.NFTSpentUtxoEntries == nil || len(operationData.NFTSpentUtxoEntries) == 0 {
@@ -2418,7 +2425,7 @@ func (bav *UtxoView) _helpDisconnectNFTSold(operationData *UtxoOperation, nftPos
 					"but operation is of type OperationTypeNFTBid; this should never happen")
 			}
 		default:
-			return fmt.Errorf("_helpDisconnectNFTSold: Invalid Operation type: %s", operationData.Type.String())
+			return fmt.Errorf("_helpDisconnectNFTSold: Invalid Operation type: %s", operationType.String())
 		}
 	}
 	// (5) Revert the creator's CreatorCoinEntry if a previous one exists.
@@ -2483,7 +2490,10 @@ func (bav *UtxoView) _disconnectNFTBid(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*NFTBidMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[NFTSoldOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectNFTBid: ")
+	}
 	operationIndex--
 
 	// We sometimes have some extra AddUtxo operations we need to remove
@@ -2520,7 +2530,7 @@ func (bav *UtxoView) _disconnectNFTBid(
 
 		// We now know that this was a bid on a buy-now NFT and the underlying NFT was sold outright to the bidder.
 		// We go ahead an unsell the NFT.
-		if err := bav._helpDisconnectNFTSold(operationData, txMeta.NFTPostHash, blockHeight); err != nil {
+		if err := bav._helpDisconnectNFTSold(OperationTypeNFTBid, operationData, txMeta.NFTPostHash, blockHeight); err != nil {
 			return errors.Wrapf(err, "_disconnectNFTBid: ")
 		}
 	}
@@ -2564,7 +2574,10 @@ func (bav *UtxoView) _disconnectNFTTransfer(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*NFTTransferMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[NFTTransferOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectNFTTransfer: ")
+	}
 	operationIndex--
 
 	// Make sure that there is a prev NFT entry.
@@ -2630,7 +2643,10 @@ func (bav *UtxoView) _disconnectAcceptNFTTransfer(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*AcceptNFTTransferMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[NFTTransferOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectAcceptNFTTransfer: ")
+	}
 	operationIndex--
 
 	// Make sure that there is a prev NFT entry.
@@ -2696,7 +2712,10 @@ func (bav *UtxoView) _disconnectBurnNFT(
 			utxoOpsForTxn[operationIndex].Type)
 	}
 	txMeta := currentTxn.TxnMeta.(*BurnNFTMetadata)
-	operationData := utxoOpsForTxn[operationIndex]
+	operationData, err := GetUtxoOperationData[BurnNFTOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectBurnNFT: ")
+	}
 	operationIndex--
 
 	// Make sure that there is a prev NFT entry.
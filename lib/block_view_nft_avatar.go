@@ -0,0 +1,530 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// NFT Avatars: Lets a profile use an NFT it owns as its avatar, in a way that clients can verify
+// without trusting the profile. An UpdateProfile transaction that sets NFTAvatarPostHashKey and
+// NFTAvatarSerialNumberKey in its extra data references the NFT with that post hash and serial
+// number. Like the rest of the txn's extra data, the keys are merged into the ProfileEntry's extra
+// data. Setting NFTAvatarPostHashKey to an empty value removes the avatar.
+//
+// When the txn is connected, consensus checks that the profile currently owns the NFT and that the
+// NFT doesn't have a pending transfer, and indexes the reference by NFT in an NFTAvatarEntry. The
+// avatar stays verified only while the profile owns the NFT: transferring, selling, or burning the
+// NFT invalidates it, and GetNFTAvatarEntriesForNFT returns the profiles whose avatars a change of
+// the NFT's owner invalidates. References set before the NFTAvatarBlockHeight are never indexed,
+// so they never verify.
+
+//
+// TYPES: NFTAvatarEntry
+//
+
+type NFTAvatarEntry struct {
+	// The NFT referenced as the avatar. The NFTPostHash, the SerialNumber, and the ProfilePKID
+	// together are the primary key for an NFTAvatarEntry.
+	NFTPostHash  *BlockHash
+	SerialNumber uint64
+	// The profile that references the NFT as its avatar.
+	ProfilePKID *PKID
+	isDeleted   bool
+}
+
+type NFTAvatarKey struct {
+	NFTPostHash  BlockHash
+	SerialNumber uint64
+	ProfilePKID  PKID
+}
+
+func (entry *NFTAvatarEntry) Copy() *NFTAvatarEntry {
+	return &NFTAvatarEntry{
+		NFTPostHash:  entry.NFTPostHash.NewBlockHash(),
+		SerialNumber: entry.SerialNumber,
+		ProfilePKID:  entry.ProfilePKID.NewPKID(),
+		isDeleted:    entry.isDeleted,
+	}
+}
+
+func (entry *NFTAvatarEntry) ToMapKey() NFTAvatarKey {
+	return NFTAvatarKey{
+		NFTPostHash:  *entry.NFTPostHash,
+		SerialNumber: entry.SerialNumber,
+		ProfilePKID:  *entry.ProfilePKID,
+	}
+}
+
+func (entry *NFTAvatarEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.NFTPostHash, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.SerialNumber)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ProfilePKID, skipMetadata...)...)
+	return data
+}
+
+func (entry *NFTAvatarEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// NFTPostHash
+	entry.NFTPostHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTAvatarEntry.Decode: Problem reading NFTPostHash: ")
+	}
+
+	// SerialNumber
+	entry.SerialNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTAvatarEntry.Decode: Problem reading SerialNumber: ")
+	}
+
+	// ProfilePKID
+	entry.ProfilePKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "NFTAvatarEntry.Decode: Problem reading ProfilePKID: ")
+	}
+
+	return nil
+}
+
+func (entry *NFTAvatarEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *NFTAvatarEntry) GetEncoderType() EncoderType {
+	return EncoderTypeNFTAvatarEntry
+}
+
+func (entry *NFTAvatarEntry) IsDeleted() bool {
+	return entry.isDeleted
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForNFTAvatar(nftPostHash *BlockHash, serialNumber uint64, profilePKID *PKID) []byte {
+	key := DBPrefixKeyForNFTAvatarsByNFT(nftPostHash, serialNumber)
+	key = append(key, profilePKID.ToBytes()...)
+	return key
+}
+
+func DBPrefixKeyForNFTAvatarsByNFT(nftPostHash *BlockHash, serialNumber uint64) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixNFTAvatarByNFTAndProfilePKID...)
+	prefixCopy = append(prefixCopy, nftPostHash.ToBytes()...)
+	return append(prefixCopy, EncodeUint64(serialNumber)...)
+}
+
+func DBGetNFTAvatarEntry(
+	handle *badger.DB, snap *Snapshot, nftPostHash *BlockHash, serialNumber uint64, profilePKID *PKID,
+) (*NFTAvatarEntry, error) {
+	var ret *NFTAvatarEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetNFTAvatarEntryWithTxn(txn, snap, nftPostHash, serialNumber, profilePKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetNFTAvatarEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, nftPostHash *BlockHash, serialNumber uint64, profilePKID *PKID,
+) (*NFTAvatarEntry, error) {
+	// Retrieve NFTAvatarEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForNFTAvatar(nftPostHash, serialNumber, profilePKID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetNFTAvatarEntryWithTxn: problem retrieving NFTAvatarEntry")
+	}
+
+	// Decode NFTAvatarEntry from bytes.
+	entry := &NFTAvatarEntry{}
+	rr := bytes.NewReader(entryBytes)
+	if exist, err := DecodeFromBytes(entry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetNFTAvatarEntryWithTxn: problem decoding NFTAvatarEntry")
+	}
+	return entry, nil
+}
+
+func DBGetNFTAvatarEntriesForNFT(
+	handle *badger.DB, nftPostHash *BlockHash, serialNumber uint64,
+) ([]*NFTAvatarEntry, error) {
+	var ret []*NFTAvatarEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetNFTAvatarEntriesForNFTWithTxn(txn, nftPostHash, serialNumber)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetNFTAvatarEntriesForNFTWithTxn(
+	txn *badger.Txn, nftPostHash *BlockHash, serialNumber uint64,
+) ([]*NFTAvatarEntry, error) {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(
+		txn, DBPrefixKeyForNFTAvatarsByNFT(nftPostHash, serialNumber), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetNFTAvatarEntriesForNFTWithTxn: problem retrieving NFTAvatarEntries")
+	}
+
+	var entries []*NFTAvatarEntry
+	for _, entryBytes := range valsFound {
+		rr := bytes.NewReader(entryBytes)
+		entry, err := DecodeDeSoEncoder(&NFTAvatarEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetNFTAvatarEntriesForNFTWithTxn: problem decoding NFTAvatarEntry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutNFTAvatarEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *NFTAvatarEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutNFTAvatarEntryWithTxn: called with nil NFTAvatarEntry")
+		return nil
+	}
+
+	key := DBKeyForNFTAvatar(entry.NFTPostHash, entry.SerialNumber, entry.ProfilePKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutNFTAvatarEntryWithTxn: problem storing NFTAvatarEntry in index PrefixNFTAvatarByNFTAndProfilePKID",
+		)
+	}
+	return nil
+}
+
+func DBDeleteNFTAvatarEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *NFTAvatarEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteNFTAvatarEntryWithTxn: called with nil NFTAvatarEntry")
+		return nil
+	}
+
+	key := DBKeyForNFTAvatar(entry.NFTPostHash, entry.SerialNumber, entry.ProfilePKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteNFTAvatarEntryWithTxn: problem deleting NFTAvatarEntry from index PrefixNFTAvatarByNFTAndProfilePKID",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+// SetNFTAvatarExtraData sets the extra data keys that make an UpdateProfile txn reference the NFT as
+// the profile's avatar. If nftPostHash is nil, the keys remove the profile's avatar instead.
+func SetNFTAvatarExtraData(extraData map[string][]byte, nftPostHash *BlockHash, serialNumber uint64) error {
+	if nftPostHash == nil {
+		extraData[NFTAvatarPostHashKey] = []byte{}
+		delete(extraData, NFTAvatarSerialNumberKey)
+		return nil
+	}
+	extraData[NFTAvatarPostHashKey] = nftPostHash.ToBytes()
+	if err := SetExtraDataUint64(extraData, NFTAvatarSerialNumberKey, serialNumber); err != nil {
+		return errors.Wrapf(err, "SetNFTAvatarExtraData: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+// _getNFTAvatarFromExtraData returns the NFT referenced by the extra data. If none of the NFT avatar keys
+// are set, it returns false. If the extra data removes the avatar, it returns true and a nil post hash.
+func _getNFTAvatarFromExtraData(extraData map[string][]byte) (
+	_nftPostHash *BlockHash, _serialNumber uint64, _hasNFTAvatar bool, _err error) {
+
+	postHashBytes, hasPostHash := extraData[NFTAvatarPostHashKey]
+	_, hasSerialNumber := extraData[NFTAvatarSerialNumberKey]
+	if !hasPostHash && !hasSerialNumber {
+		return nil, 0, false, nil
+	}
+	if !hasPostHash {
+		return nil, 0, false, RuleErrorNFTAvatarMissingField
+	}
+	if len(postHashBytes) == 0 {
+		return nil, 0, true, nil
+	}
+	if !hasSerialNumber {
+		return nil, 0, false, RuleErrorNFTAvatarMissingField
+	}
+
+	if len(postHashBytes) != HashSizeBytes {
+		return nil, 0, false, errors.Wrapf(RuleErrorNFTAvatarInvalidPostHash,
+			"%d bytes != %d", len(postHashBytes), HashSizeBytes)
+	}
+	serialNumber, _, err := GetExtraDataUint64(extraData, NFTAvatarSerialNumberKey)
+	if err != nil || serialNumber == 0 {
+		return nil, 0, false, RuleErrorNFTAvatarInvalidSerialNumber
+	}
+	return NewBlockHash(postHashBytes), serialNumber, true, nil
+}
+
+// _connectNFTAvatar verifies the NFT avatar set by an UpdateProfile txn and moves the profile's entry in
+// the avatar index from its previous avatar to the new one. It returns the index entry of the previous
+// avatar, which is needed to disconnect the change, or nil if the profile didn't have one.
+func (bav *UtxoView) _connectNFTAvatar(
+	txn *MsgDeSoTxn, prevProfileEntry *ProfileEntry, newProfileEntry *ProfileEntry, blockHeight uint32,
+) (*NFTAvatarEntry, error) {
+	if blockHeight < bav.Params.ForkHeights.NFTAvatarBlockHeight {
+		return nil, nil
+	}
+	nftPostHash, serialNumber, hasNFTAvatar, err := _getNFTAvatarFromExtraData(txn.ExtraData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_connectNFTAvatar: ")
+	}
+	if !hasNFTAvatar {
+		return nil, nil
+	}
+
+	profilePKID := bav.GetPKIDForPublicKey(newProfileEntry.PublicKey).PKID
+	if nftPostHash != nil {
+		nftKey := MakeNFTKey(nftPostHash, serialNumber)
+		nftEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+		if nftEntry == nil || nftEntry.isDeleted {
+			return nil, errors.Wrapf(RuleErrorNFTAvatarNFTDoesNotExist,
+				"_connectNFTAvatar: post hash %v, serial number %d", nftPostHash, serialNumber)
+		}
+		if !nftEntry.OwnerPKID.Eq(profilePKID) {
+			return nil, errors.Wrapf(RuleErrorNFTAvatarNFTNotOwnedByProfile,
+				"_connectNFTAvatar: post hash %v, serial number %d", nftPostHash, serialNumber)
+		}
+		if nftEntry.IsPending {
+			return nil, errors.Wrapf(RuleErrorNFTAvatarNFTHasPendingTransfer,
+				"_connectNFTAvatar: post hash %v, serial number %d", nftPostHash, serialNumber)
+		}
+	}
+
+	// Remove the profile's previous avatar from the index. Avatars referenced before the fork or by
+	// malformed extra data were never indexed, so there's nothing to remove for them.
+	var prevEntryCopy *NFTAvatarEntry
+	if prevProfileEntry != nil {
+		prevPostHash, prevSerialNumber, _, err := _getNFTAvatarFromExtraData(prevProfileEntry.ExtraData)
+		if err == nil && prevPostHash != nil {
+			prevEntry, err := bav.GetNFTAvatarEntry(prevPostHash, prevSerialNumber, profilePKID)
+			if err != nil {
+				return nil, errors.Wrapf(err, "_connectNFTAvatar: ")
+			}
+			if prevEntry != nil {
+				prevEntryCopy = prevEntry.Copy()
+				bav._deleteNFTAvatarEntryMappings(prevEntry)
+			}
+		}
+	}
+
+	if nftPostHash != nil {
+		bav._setNFTAvatarEntryMappings(&NFTAvatarEntry{
+			NFTPostHash:  nftPostHash,
+			SerialNumber: serialNumber,
+			ProfilePKID:  profilePKID.NewPKID(),
+		})
+	}
+	return prevEntryCopy, nil
+}
+
+// _disconnectNFTAvatar reverts the changes to the avatar index made by an UpdateProfile txn.
+func (bav *UtxoView) _disconnectNFTAvatar(
+	currentTxn *MsgDeSoTxn, operationData *UpdateProfileOperationData, profilePKID *PKID, blockHeight uint32,
+) error {
+	if blockHeight < bav.Params.ForkHeights.NFTAvatarBlockHeight {
+		return nil
+	}
+	nftPostHash, serialNumber, hasNFTAvatar, err := _getNFTAvatarFromExtraData(currentTxn.ExtraData)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectNFTAvatar: ")
+	}
+	if !hasNFTAvatar {
+		return nil
+	}
+
+	if nftPostHash != nil {
+		currentEntry, err := bav.GetNFTAvatarEntry(nftPostHash, serialNumber, profilePKID)
+		if err != nil {
+			return errors.Wrapf(err, "_disconnectNFTAvatar: ")
+		}
+		// The entry doesn't exist if the txn was connected before the NFTAvatarBlockHeight.
+		if currentEntry != nil {
+			bav._deleteNFTAvatarEntryMappings(currentEntry)
+		}
+	}
+	if operationData.PrevNFTAvatarEntry != nil {
+		bav._setNFTAvatarEntryMappings(operationData.PrevNFTAvatarEntry)
+	}
+	return nil
+}
+
+// GetNFTAvatarEntry returns the index entry for the profile referencing the NFT as its avatar, or nil if
+// the profile doesn't reference it.
+func (bav *UtxoView) GetNFTAvatarEntry(
+	nftPostHash *BlockHash, serialNumber uint64, profilePKID *PKID,
+) (*NFTAvatarEntry, error) {
+	if nftPostHash == nil || profilePKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetNFTAvatarEntry: Called with nil nftPostHash or profilePKID")
+	}
+
+	// First check the UtxoView.
+	mapKey := NFTAvatarKey{NFTPostHash: *nftPostHash, SerialNumber: serialNumber, ProfilePKID: *profilePKID}
+	if entry, exists := bav.NFTAvatarKeyToNFTAvatarEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// If no NFTAvatarEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbEntry, err := DBGetNFTAvatarEntry(bav.Handle, bav.Snapshot, nftPostHash, serialNumber, profilePKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetNFTAvatarEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the NFTAvatarEntry from the db in the UtxoView.
+		bav._setNFTAvatarEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetNFTAvatarEntriesForNFT returns the index entries of every profile that references the NFT as its
+// avatar, merging the entries in the view with the entries in the database. At most one of them, the
+// one for the NFT's current owner, is verified.
+func (bav *UtxoView) GetNFTAvatarEntriesForNFT(nftPostHash *BlockHash, serialNumber uint64) ([]*NFTAvatarEntry, error) {
+	if nftPostHash == nil {
+		return nil, fmt.Errorf("UtxoView.GetNFTAvatarEntriesForNFT: Called with nil nftPostHash")
+	}
+
+	// Load the entries from the database into the view. We don't overwrite the
+	// entries in the view since they're more recent than the database.
+	dbEntries, err := DBGetNFTAvatarEntriesForNFT(bav.Handle, nftPostHash, serialNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetNFTAvatarEntriesForNFT: ")
+	}
+	for _, entry := range dbEntries {
+		if _, exists := bav.NFTAvatarKeyToNFTAvatarEntry[entry.ToMapKey()]; !exists {
+			bav._setNFTAvatarEntryMappings(entry)
+		}
+	}
+
+	var entries []*NFTAvatarEntry
+	for mapKey, entry := range bav.NFTAvatarKeyToNFTAvatarEntry {
+		if !entry.isDeleted && mapKey.NFTPostHash == *nftPostHash && mapKey.SerialNumber == serialNumber {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// GetVerifiedNFTAvatarForProfile returns the NFTEntry the profile uses as its avatar, or nil if the profile
+// doesn't have an avatar or no longer owns the NFT.
+func (bav *UtxoView) GetVerifiedNFTAvatarForProfile(profilePKID *PKID) (*NFTEntry, error) {
+	if profilePKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetVerifiedNFTAvatarForProfile: Called with nil profilePKID")
+	}
+	profileEntry := bav.GetProfileEntryForPKID(profilePKID)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return nil, nil
+	}
+	nftPostHash, serialNumber, _, err := _getNFTAvatarFromExtraData(profileEntry.ExtraData)
+	if err != nil || nftPostHash == nil {
+		return nil, nil
+	}
+
+	// The reference has to have been verified when it was set.
+	avatarEntry, err := bav.GetNFTAvatarEntry(nftPostHash, serialNumber, profilePKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetVerifiedNFTAvatarForProfile: ")
+	}
+	if avatarEntry == nil {
+		return nil, nil
+	}
+
+	// And the profile has to still own the NFT.
+	nftKey := MakeNFTKey(nftPostHash, serialNumber)
+	nftEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+	if nftEntry == nil || nftEntry.isDeleted || nftEntry.IsPending || !nftEntry.OwnerPKID.Eq(profilePKID) {
+		return nil, nil
+	}
+	return nftEntry, nil
+}
+
+func (bav *UtxoView) _setNFTAvatarEntryMappings(entry *NFTAvatarEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setNFTAvatarEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.NFTAvatarKeyToNFTAvatarEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteNFTAvatarEntryMappings(entry *NFTAvatarEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteNFTAvatarEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setNFTAvatarEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushNFTAvatarEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, entryIter := range bav.NFTAvatarKeyToNFTAvatarEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(entry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushNFTAvatarEntriesToDbWithTxn: NFTAvatarEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(),
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if entry.isDeleted {
+			if err := DBDeleteNFTAvatarEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushNFTAvatarEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutNFTAvatarEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushNFTAvatarEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
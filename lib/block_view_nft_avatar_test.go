@@ -0,0 +1,199 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTAvatar(t *testing.T) {
+	var err error
+
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	// Make m3 a paramUpdater for this test.
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(m3PkBytes)] = true
+
+	setNFTAvatarBlockHeight := func(blockHeight uint32) {
+		params.ForkHeights.NFTAvatarBlockHeight = blockHeight
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}
+	defer setNFTAvatarBlockHeight(params.ForkHeights.NFTAvatarBlockHeight)
+	setNFTAvatarBlockHeight(math.MaxUint32)
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       chain.blockTip().Height + 1,
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e6)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+
+	// Activate NFTs.
+	_updateGlobalParamsEntryWithTestMeta(testMeta, 10, m3Pub, m3Priv, -1, -1, -1, 0, 1000)
+
+	// m0 turns a post into an NFT with 2 copies.
+	_submitPostWithTestMeta(testMeta, 10, m0Pub, m0Priv, []byte{}, []byte{},
+		&DeSoBodySchema{Body: "m0 post"}, []byte{}, 1502947011*1e9, false)
+	postHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	_updateProfileWithTestMeta(testMeta, 10, m0Pub, m0Priv, []byte{}, "m0", "i am the m0", shortPic,
+		10*100, 1.25*100*100, false)
+	_createNFTWithTestMeta(testMeta, 10, m0Pub, m0Priv, postHash, 2, false, false, 0, 0, 0, 0, false, 0)
+
+	avatarExtraData := func(nftPostHash *BlockHash, serialNumber uint64) map[string][]byte {
+		extraData := make(map[string][]byte)
+		require.NoError(t, SetNFTAvatarExtraData(extraData, nftPostHash, serialNumber))
+		return extraData
+	}
+	verifiedAvatar := func(profilePKID *PKID) *NFTEntry {
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		nftEntry, err := utxoView.GetVerifiedNFTAvatarForProfile(profilePKID)
+		require.NoError(t, err)
+		return nftEntry
+	}
+	avatarEntriesForNFT := func(serialNumber uint64) []*NFTAvatarEntry {
+		entries, err := DBGetNFTAvatarEntriesForNFT(db, postHash, serialNumber)
+		require.NoError(t, err)
+		return entries
+	}
+
+	{
+		// Avatars set before the block height aren't checked or indexed, so they never verify.
+		require.NoError(t, _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0",
+			avatarExtraData(postHash, 1)))
+		require.Nil(t, verifiedAvatar(m0PKID))
+		require.Empty(t, avatarEntriesForNFT(1))
+
+		setNFTAvatarBlockHeight(uint32(1))
+	}
+	{
+		// RuleErrorNFTAvatarMissingField
+		extraData := avatarExtraData(postHash, 1)
+		delete(extraData, NFTAvatarSerialNumberKey)
+		err = _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0", extraData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTAvatarMissingField)
+	}
+	{
+		// RuleErrorNFTAvatarInvalidPostHash
+		extraData := avatarExtraData(postHash, 1)
+		extraData[NFTAvatarPostHashKey] = postHash[:10]
+		err = _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0", extraData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTAvatarInvalidPostHash)
+	}
+	{
+		// RuleErrorNFTAvatarInvalidSerialNumber
+		err = _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0", avatarExtraData(postHash, 0))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTAvatarInvalidSerialNumber)
+	}
+	{
+		// RuleErrorNFTAvatarNFTDoesNotExist
+		err = _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0", avatarExtraData(postHash, 3))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTAvatarNFTDoesNotExist)
+	}
+	{
+		// RuleErrorNFTAvatarNFTNotOwnedByProfile
+		err = _updateProfileNFTAvatarWithTestMeta(testMeta, m1Pub, m1Priv, "m1", avatarExtraData(postHash, 1))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTAvatarNFTNotOwnedByProfile)
+	}
+	{
+		// Happy path: m0 uses serial 1 as its avatar.
+		require.NoError(t, _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0",
+			avatarExtraData(postHash, 1)))
+		nftEntry := verifiedAvatar(m0PKID)
+		require.NotNil(t, nftEntry)
+		require.Equal(t, uint64(1), nftEntry.SerialNumber)
+		require.Len(t, avatarEntriesForNFT(1), 1)
+	}
+	{
+		// Happy path: m0 switches its avatar to serial 2, which moves its index entry.
+		require.NoError(t, _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0",
+			avatarExtraData(postHash, 2)))
+		require.Equal(t, uint64(2), verifiedAvatar(m0PKID).SerialNumber)
+		require.Empty(t, avatarEntriesForNFT(1))
+		require.Len(t, avatarEntriesForNFT(2), 1)
+	}
+	{
+		// Transferring the NFT invalidates the avatar. The index still finds the profile that referenced it.
+		_transferNFTWithTestMeta(testMeta, 10, m0Pub, m0Priv, m1Pub, postHash, 2, "")
+		require.Nil(t, verifiedAvatar(m0PKID))
+		entries := avatarEntriesForNFT(2)
+		require.Len(t, entries, 1)
+		require.Equal(t, m0PKID, entries[0].ProfilePKID)
+
+		// RuleErrorNFTAvatarNFTHasPendingTransfer
+		err = _updateProfileNFTAvatarWithTestMeta(testMeta, m1Pub, m1Priv, "m1", avatarExtraData(postHash, 2))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTAvatarNFTHasPendingTransfer)
+
+		// Once m1 accepts the transfer, it can use the NFT as its avatar.
+		_acceptNFTTransferWithTestMeta(testMeta, 10, m1Pub, m1Priv, postHash, 2)
+		require.NoError(t, _updateProfileNFTAvatarWithTestMeta(testMeta, m1Pub, m1Priv, "m1",
+			avatarExtraData(postHash, 2)))
+		require.Equal(t, uint64(2), verifiedAvatar(m1PKID).SerialNumber)
+		require.Nil(t, verifiedAvatar(m0PKID))
+		require.Len(t, avatarEntriesForNFT(2), 2)
+	}
+	{
+		// Happy path: m0 removes its avatar.
+		require.NoError(t, _updateProfileNFTAvatarWithTestMeta(testMeta, m0Pub, m0Priv, "m0",
+			avatarExtraData(nil, 0)))
+		entries := avatarEntriesForNFT(2)
+		require.Len(t, entries, 1)
+		require.Equal(t, m1PKID, entries[0].ProfilePKID)
+	}
+
+	_executeAllTestRollbackAndFlush(testMeta)
+	require.Empty(t, avatarEntriesForNFT(1))
+	require.Empty(t, avatarEntriesForNFT(2))
+}
+
+func _updateProfileNFTAvatarWithTestMeta(
+	testMeta *TestMeta,
+	updaterPkBase58Check string,
+	updaterPrivBase58Check string,
+	username string,
+	extraData map[string][]byte,
+) error {
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, nil, updaterPkBase58Check)
+
+	currentOps, currentTxn, _, err := _updateProfileWithExtraData(
+		testMeta.t, testMeta.chain, testMeta.db, testMeta.params,
+		testMeta.feeRateNanosPerKb, updaterPkBase58Check, updaterPrivBase58Check,
+		[]byte{}, username, "", shortPic, 10*100, 1.25*100*100, false, extraData)
+	if err != nil {
+		return err
+	}
+
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, currentOps)
+	testMeta.txns = append(testMeta.txns, currentTxn)
+	return nil
+}
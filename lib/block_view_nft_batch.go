@@ -0,0 +1,570 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/pkg/errors"
+)
+
+// NFTBatch: Applies one NFT operation to a contiguous range of serial numbers of an NFT in a single
+// transaction, so that a large edition can be minted, airdropped, claimed, or burned without one
+// transaction per serial. The supported operations are:
+//   - Mint: the poster of an NFT adds the serials NumNFTCopies+1 through LastSerialNumber to the NFT,
+//     up to MaxCopiesPerNFT in total. The new serials are owned by the poster and not for sale. Like
+//     CreateNFT, the transaction burns CreateNFTFeeNanos for every serial it mints.
+//   - Transfer: the owner of every serial in the range transfers them to the receiver, who must then
+//     accept them. This is the batch version of NFTTransfer.
+//   - AcceptTransfer: the receiver of pending transfers accepts every serial in the range. This is the
+//     batch version of AcceptNFTTransfer.
+//   - Burn: the owner of every serial in the range burns them. This is the batch version of BurnNFT.
+//
+// Every serial in the range is validated exactly like the corresponding single-serial transaction
+// would validate it, and the transaction fails if any of them fails. A transaction can operate on
+// at most DeSoParams.MaxNFTBatchSerialsPerTxn serials.
+
+//
+// TYPES: NFTBatchMetadata
+//
+
+type NFTBatchOperationType uint8
+
+const (
+	NFTBatchOperationTypeUnknown        NFTBatchOperationType = 0
+	NFTBatchOperationTypeMint           NFTBatchOperationType = 1
+	NFTBatchOperationTypeTransfer       NFTBatchOperationType = 2
+	NFTBatchOperationTypeAcceptTransfer NFTBatchOperationType = 3
+	NFTBatchOperationTypeBurn           NFTBatchOperationType = 4
+)
+
+func (operationType NFTBatchOperationType) String() string {
+	switch operationType {
+	case NFTBatchOperationTypeMint:
+		return "Mint"
+	case NFTBatchOperationTypeTransfer:
+		return "Transfer"
+	case NFTBatchOperationTypeAcceptTransfer:
+		return "AcceptTransfer"
+	case NFTBatchOperationTypeBurn:
+		return "Burn"
+	default:
+		return "Unknown"
+	}
+}
+
+type NFTBatchMetadata struct {
+	NFTPostHash   *BlockHash
+	OperationType NFTBatchOperationType
+	// The range of serial numbers the operation applies to, inclusive on both ends.
+	FirstSerialNumber uint64
+	LastSerialNumber  uint64
+	// ReceiverPublicKey and UnlockableText are only set for transfers. The same encrypted
+	// UnlockableText is set on every serial in the range.
+	ReceiverPublicKey []byte
+	UnlockableText    []byte
+}
+
+func (txnData *NFTBatchMetadata) GetTxnType() TxnType {
+	return TxnTypeNFTBatch
+}
+
+func (txnData *NFTBatchMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	if txnData.NFTPostHash == nil {
+		return nil, fmt.Errorf("NFTBatchMetadata.ToBytes: NFTPostHash is nil")
+	}
+	var data []byte
+	data = append(data, txnData.NFTPostHash[:]...)
+	data = append(data, byte(txnData.OperationType))
+	data = append(data, UintToBuf(txnData.FirstSerialNumber)...)
+	data = append(data, UintToBuf(txnData.LastSerialNumber)...)
+	data = append(data, EncodeByteArray(txnData.ReceiverPublicKey)...)
+	data = append(data, EncodeByteArray(txnData.UnlockableText)...)
+	return data, nil
+}
+
+func (txnData *NFTBatchMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	// NFTPostHash
+	nftPostHash := &BlockHash{}
+	if _, err = io.ReadFull(rr, nftPostHash[:]); err != nil {
+		return errors.Wrapf(err, "NFTBatchMetadata.FromBytes: Problem reading NFTPostHash: ")
+	}
+	txnData.NFTPostHash = nftPostHash
+
+	// OperationType
+	operationType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "NFTBatchMetadata.FromBytes: Problem reading OperationType: ")
+	}
+	txnData.OperationType = NFTBatchOperationType(operationType)
+
+	// FirstSerialNumber
+	if txnData.FirstSerialNumber, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTBatchMetadata.FromBytes: Problem reading FirstSerialNumber: ")
+	}
+
+	// LastSerialNumber
+	if txnData.LastSerialNumber, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "NFTBatchMetadata.FromBytes: Problem reading LastSerialNumber: ")
+	}
+
+	// ReceiverPublicKey
+	if txnData.ReceiverPublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "NFTBatchMetadata.FromBytes: Problem reading ReceiverPublicKey: ")
+	}
+
+	// UnlockableText
+	if txnData.UnlockableText, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "NFTBatchMetadata.FromBytes: Problem reading UnlockableText: ")
+	}
+
+	return nil
+}
+
+func (txnData *NFTBatchMetadata) New() DeSoTxnMetadata {
+	return &NFTBatchMetadata{}
+}
+
+// NumSerials returns the number of serial numbers in the range. It should only be called
+// on metadata that passed ValidateNFTBatchMetadata.
+func (txnData *NFTBatchMetadata) NumSerials() uint64 {
+	return txnData.LastSerialNumber - txnData.FirstSerialNumber + 1
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateNFTBatchTxn(
+	transactorPublicKey []byte,
+	metadata *NFTBatchMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the NFTBatch fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Validate txn metadata.
+	if err := ValidateNFTBatchMetadata(bc.params, metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateNFTBatchTxn: invalid txn metadata: ")
+	}
+
+	// Minting burns the NFT fee on top of the regular fee, so we add it to the spend amount.
+	var mintFeeNanos uint64
+	if metadata.OperationType == NFTBatchOperationTypeMint {
+		// If we have access to a mempool object, use it to get an augmented view that
+		// factors in pending param updates.
+		utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+		var err error
+		if !isInterfaceValueNil(mempool) {
+			if utxoView, err = mempool.GetAugmentedUniversalView(); err != nil {
+				return nil, 0, 0, 0, errors.Wrapf(err,
+					"Blockchain.CreateNFTBatchTxn: problem getting augmented UtxoView from mempool: ")
+			}
+		}
+		if mintFeeNanos, err = SafeUint64().Mul(
+			metadata.NumSerials(), utxoView.GetCurrentGlobalParamsEntry().CreateNFTFeeNanos); err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateNFTBatchTxn: problem computing mint fee: ")
+		}
+	}
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransactionWithSubsidy(
+		txn, minFeeRateNanosPerKB, 0, mempool, mintFeeNanos,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateNFTBatchTxn: problem adding inputs: ")
+	}
+
+	// Sanity-check that the spendAmount is just the mint fee.
+	if err = amountEqualsAdditionalOutputs(spendAmount-mintFeeNanos, additionalOutputs); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateNFTBatchTxn: %v", err)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectNFTBatch(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.NFTBatchBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTBatchBeforeBlockHeight, "_connectNFTBatch: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeNFTBatch {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectNFTBatch: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*NFTBatchMetadata)
+
+	// Validate the metadata.
+	if err := ValidateNFTBatchMetadata(bav.Params, txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectNFTBatch: ")
+	}
+
+	// Convert TransactorPublicKey to TransactorPKID.
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTBatchInvalidTransactorPKID, "_connectNFTBatch: ")
+	}
+
+	// Fetch the post of the NFT.
+	postEntry := bav.GetPostEntryForPostHash(txMeta.NFTPostHash)
+	if postEntry == nil || postEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorNFTBatchOnNonexistentPost, "_connectNFTBatch: ")
+	}
+
+	// Validate every serial in the range before we modify anything. For all operations but
+	// Mint, this gives us the NFTEntries that we'll update.
+	var prevNFTEntries []*NFTEntry
+	var receiverPKID *PKID
+	var mintFeeNanos uint64
+	var err error
+	switch txMeta.OperationType {
+	case NFTBatchOperationTypeMint:
+		if mintFeeNanos, err = bav._validateNFTBatchMint(txMeta, txn.PublicKey, postEntry); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTBatch: ")
+		}
+	case NFTBatchOperationTypeTransfer:
+		if receiverPKID, err = bav._validateNFTBatchTransferReceiver(txMeta, txn.PublicKey, postEntry); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTBatch: ")
+		}
+		fallthrough
+	default:
+		if prevNFTEntries, err = bav._getNFTBatchEntries(txMeta, transactorPKIDEntry.PKID); err != nil {
+			return 0, 0, nil, errors.Wrapf(err, "_connectNFTBatch: ")
+		}
+	}
+
+	// Connect a basic transfer, which burns the mint fee if there is one, to get the total input
+	// and the total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransferWithExtraSpend(
+		txn, txHash, blockHeight, mintFeeNanos, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectNFTBatch: ")
+	}
+	if verifySignatures {
+		// _connectBasicTransfer has already checked that the txn is signed
+		// by the top-level public key, which we take to be the poster's or
+		// the owner's public key so there is no need to verify anything further.
+	}
+
+	utxoOp := &UtxoOperation{
+		Type:           OperationTypeNFTBatch,
+		PrevNFTEntries: prevNFTEntries,
+	}
+	switch txMeta.OperationType {
+	case NFTBatchOperationTypeMint:
+		var extraData map[string][]byte
+		if blockHeight >= bav.Params.ForkHeights.ExtraDataOnEntriesBlockHeight {
+			extraData = txn.ExtraData
+		}
+		for serialNumber := txMeta.FirstSerialNumber; serialNumber <= txMeta.LastSerialNumber; serialNumber++ {
+			bav._setNFTEntryMappings(&NFTEntry{
+				OwnerPKID:    transactorPKIDEntry.PKID,
+				NFTPostHash:  txMeta.NFTPostHash,
+				SerialNumber: serialNumber,
+				ExtraData:    extraData,
+			})
+		}
+		prevPostEntry := &PostEntry{}
+		*prevPostEntry = *postEntry
+		postEntry.NumNFTCopies = txMeta.LastSerialNumber
+		bav._setPostEntryMappings(postEntry)
+		utxoOp.PrevPostEntry = prevPostEntry
+
+	case NFTBatchOperationTypeTransfer:
+		for _, prevNFTEntry := range prevNFTEntries {
+			newNFTEntry := *prevNFTEntry
+			newNFTEntry.LastOwnerPKID = prevNFTEntry.OwnerPKID
+			newNFTEntry.OwnerPKID = receiverPKID
+			newNFTEntry.UnlockableText = txMeta.UnlockableText
+			newNFTEntry.IsPending = true
+			bav._deleteNFTEntryMappings(prevNFTEntry)
+			bav._setNFTEntryMappings(&newNFTEntry)
+		}
+
+	case NFTBatchOperationTypeAcceptTransfer:
+		for _, prevNFTEntry := range prevNFTEntries {
+			newNFTEntry := *prevNFTEntry
+			newNFTEntry.IsPending = false
+			bav._deleteNFTEntryMappings(prevNFTEntry)
+			bav._setNFTEntryMappings(&newNFTEntry)
+		}
+
+	case NFTBatchOperationTypeBurn:
+		for _, prevNFTEntry := range prevNFTEntries {
+			bav._deleteNFTEntryMappings(prevNFTEntry)
+		}
+		prevPostEntry := &PostEntry{}
+		*prevPostEntry = *postEntry
+		postEntry.NumNFTCopiesBurned += txMeta.NumSerials()
+		bav._setPostEntryMappings(postEntry)
+		utxoOp.PrevPostEntry = prevPostEntry
+	}
+
+	// Add a UTXO operation
+	utxoOpsForTxn = append(utxoOpsForTxn, utxoOp)
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+// _validateNFTBatchMint checks that the transactor can mint the serials in the range onto the NFT and
+// returns the fee the mint burns.
+func (bav *UtxoView) _validateNFTBatchMint(
+	txMeta *NFTBatchMetadata, transactorPublicKey []byte, postEntry *PostEntry) (_mintFeeNanos uint64, _err error) {
+
+	globalParamsEntry := bav.GetCurrentGlobalParamsEntry()
+	if globalParamsEntry.MaxCopiesPerNFT == 0 {
+		return 0, fmt.Errorf("_validateNFTBatchMint: called with zero MaxCopiesPerNFT")
+	}
+	if !reflect.DeepEqual(postEntry.PosterPublicKey, transactorPublicKey) {
+		return 0, RuleErrorCreateNFTMustBeCalledByPoster
+	}
+	if !postEntry.IsNFT {
+		return 0, RuleErrorNFTBatchMintOnPostThatIsNotNFT
+	}
+	// Serials are numbered 1 through NumNFTCopies, so a mint has to continue where the NFT ends.
+	if txMeta.FirstSerialNumber != postEntry.NumNFTCopies+1 {
+		return 0, errors.Wrapf(RuleErrorNFTBatchMintSerialRangeNotNext, "_validateNFTBatchMint: "+
+			"FirstSerialNumber %d, NumNFTCopies %d", txMeta.FirstSerialNumber, postEntry.NumNFTCopies)
+	}
+	if txMeta.LastSerialNumber > globalParamsEntry.MaxCopiesPerNFT {
+		return 0, errors.Wrapf(RuleErrorTooManyNFTCopies, "_validateNFTBatchMint: "+
+			"LastSerialNumber %d, MaxCopiesPerNFT %d", txMeta.LastSerialNumber, globalParamsEntry.MaxCopiesPerNFT)
+	}
+	for serialNumber := txMeta.FirstSerialNumber; serialNumber <= txMeta.LastSerialNumber; serialNumber++ {
+		nftKey := MakeNFTKey(txMeta.NFTPostHash, serialNumber)
+		if nftEntry := bav.GetNFTEntryForNFTKey(&nftKey); nftEntry != nil && !nftEntry.isDeleted {
+			return 0, errors.Wrapf(RuleErrorNFTBatchMintSerialAlreadyExists, "_validateNFTBatchMint: "+
+				"serial %d", serialNumber)
+		}
+	}
+	mintFeeNanos, err := SafeUint64().Mul(txMeta.NumSerials(), globalParamsEntry.CreateNFTFeeNanos)
+	if err != nil {
+		return 0, errors.Wrapf(err, "_validateNFTBatchMint: error computing NFT fee")
+	}
+	return mintFeeNanos, nil
+}
+
+// _validateNFTBatchTransferReceiver checks the receiver and the unlockable text of a transfer and
+// returns the PKID of the receiver.
+func (bav *UtxoView) _validateNFTBatchTransferReceiver(
+	txMeta *NFTBatchMetadata, transactorPublicKey []byte, postEntry *PostEntry) (_receiverPKID *PKID, _err error) {
+
+	if reflect.DeepEqual(transactorPublicKey, txMeta.ReceiverPublicKey) {
+		return nil, RuleErrorNFTTransferCannotTransferToSelf
+	}
+	receiverPKIDEntry := bav.GetPKIDForPublicKey(txMeta.ReceiverPublicKey)
+	if receiverPKIDEntry == nil || receiverPKIDEntry.isDeleted {
+		return nil, fmt.Errorf("_validateNFTBatchTransferReceiver: Found nil or deleted PKID for receiver, "+
+			"this should never happen. Receiver pubkey: %v", PkToStringMainnet(txMeta.ReceiverPublicKey))
+	}
+	if postEntry.HasUnlockable && len(txMeta.UnlockableText) == 0 {
+		return nil, RuleErrorCannotTransferUnlockableNFTWithoutUnlockable
+	}
+	return receiverPKIDEntry.PKID, nil
+}
+
+// _getNFTBatchEntries returns the NFTEntries for the serials in the range of a Transfer, AcceptTransfer,
+// or Burn, checking that each of them can be transferred, accepted, or burned by the transactor.
+func (bav *UtxoView) _getNFTBatchEntries(txMeta *NFTBatchMetadata, transactorPKID *PKID) ([]*NFTEntry, error) {
+	nftEntries := make([]*NFTEntry, 0, txMeta.NumSerials())
+	for serialNumber := txMeta.FirstSerialNumber; serialNumber <= txMeta.LastSerialNumber; serialNumber++ {
+		nftKey := MakeNFTKey(txMeta.NFTPostHash, serialNumber)
+		nftEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+		isOwner := nftEntry != nil && !nftEntry.isDeleted && nftEntry.OwnerPKID.Eq(transactorPKID)
+
+		var ruleErr error
+		switch txMeta.OperationType {
+		case NFTBatchOperationTypeTransfer:
+			if nftEntry == nil || nftEntry.isDeleted {
+				ruleErr = RuleErrorCannotTransferNonExistentNFT
+			} else if !isOwner {
+				ruleErr = RuleErrorNFTTransferByNonOwner
+			} else if nftEntry.IsForSale {
+				ruleErr = RuleErrorCannotTransferForSaleNFT
+			}
+		case NFTBatchOperationTypeAcceptTransfer:
+			if nftEntry == nil || nftEntry.isDeleted {
+				ruleErr = RuleErrorCannotAcceptTransferOfNonExistentNFT
+			} else if !isOwner {
+				ruleErr = RuleErrorAcceptNFTTransferByNonOwner
+			} else if !nftEntry.IsPending {
+				ruleErr = RuleErrorAcceptNFTTransferForNonPendingNFT
+			} else if nftEntry.IsForSale {
+				return nil, fmt.Errorf("_getNFTBatchEntries: pending NFT %v serial %d is for sale; "+
+					"this should never happen", txMeta.NFTPostHash, serialNumber)
+			}
+		case NFTBatchOperationTypeBurn:
+			if nftEntry == nil || nftEntry.isDeleted {
+				ruleErr = RuleErrorCannotBurnNonExistentNFT
+			} else if !isOwner {
+				ruleErr = RuleErrorBurnNFTByNonOwner
+			} else if nftEntry.IsForSale {
+				ruleErr = RuleErrorCannotBurnNFTThatIsForSale
+			}
+		default:
+			return nil, errors.Wrapf(RuleErrorNFTBatchInvalidOperationType, "_getNFTBatchEntries: %v",
+				txMeta.OperationType)
+		}
+		if ruleErr != nil {
+			return nil, errors.Wrapf(ruleErr, "_getNFTBatchEntries: serial %d", serialNumber)
+		}
+		nftEntries = append(nftEntries, nftEntry)
+	}
+	return nftEntries, nil
+}
+
+func (bav *UtxoView) _disconnectNFTBatch(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.NFTBatchBlockHeight {
+		return errors.Wrapf(RuleErrorNFTBatchBeforeBlockHeight, "_disconnectNFTBatch: ")
+	}
+
+	// Validate the last operation is an NFTBatch operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectNFTBatch: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeNFTBatch {
+		return fmt.Errorf(
+			"_disconnectNFTBatch: trying to revert %v but found %v",
+			OperationTypeNFTBatch,
+			utxoOpsForTxn[operationIndex].Type,
+		)
+	}
+	operationData, err := GetUtxoOperationData[NFTBatchOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectNFTBatch: ")
+	}
+	txMeta := currentTxn.TxnMeta.(*NFTBatchMetadata)
+
+	switch txMeta.OperationType {
+	case NFTBatchOperationTypeMint:
+		// Delete the minted serials and restore the post.
+		if operationData.PrevPostEntry == nil {
+			return fmt.Errorf("_disconnectNFTBatch: PrevPostEntry is missing for mint")
+		}
+		for serialNumber := txMeta.FirstSerialNumber; serialNumber <= txMeta.LastSerialNumber; serialNumber++ {
+			nftKey := MakeNFTKey(txMeta.NFTPostHash, serialNumber)
+			currNFTEntry := bav.GetNFTEntryForNFTKey(&nftKey)
+			if currNFTEntry == nil || currNFTEntry.isDeleted {
+				return fmt.Errorf("_disconnectNFTBatch: minted NFT not found: %v, %d",
+					txMeta.NFTPostHash, serialNumber)
+			}
+			bav._deleteNFTEntryMappings(currNFTEntry)
+		}
+		bav._setPostEntryMappings(operationData.PrevPostEntry)
+
+	case NFTBatchOperationTypeTransfer, NFTBatchOperationTypeAcceptTransfer, NFTBatchOperationTypeBurn:
+		if uint64(len(operationData.PrevNFTEntries)) != txMeta.NumSerials() {
+			return fmt.Errorf("_disconnectNFTBatch: found %d PrevNFTEntries for %d serials",
+				len(operationData.PrevNFTEntries), txMeta.NumSerials())
+		}
+		for ii, prevNFTEntry := range operationData.PrevNFTEntries {
+			// Sanity check that the entries are in serial number order.
+			if !reflect.DeepEqual(prevNFTEntry.NFTPostHash, txMeta.NFTPostHash) ||
+				prevNFTEntry.SerialNumber != txMeta.FirstSerialNumber+uint64(ii) {
+				return fmt.Errorf("_disconnectNFTBatch: PrevNFTEntry %v doesn't match txMeta %v; "+
+					"this should never happen", prevNFTEntry, txMeta)
+			}
+			// Setting the previous entry overwrites the current one, or the tombstone of a burned one.
+			bav._setNFTEntryMappings(prevNFTEntry)
+		}
+		if txMeta.OperationType == NFTBatchOperationTypeBurn {
+			if operationData.PrevPostEntry == nil {
+				return fmt.Errorf("_disconnectNFTBatch: PrevPostEntry is missing for burn")
+			}
+			bav._setPostEntryMappings(operationData.PrevPostEntry)
+		}
+
+	default:
+		return errors.Wrapf(RuleErrorNFTBatchInvalidOperationType, "_disconnectNFTBatch: %v", txMeta.OperationType)
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// ValidateNFTBatchMetadata checks the operation and the serial range of an NFTBatch txn against the
+// limits in the params. It doesn't depend on the state, so it's shared by txn construction and
+// connection.
+func ValidateNFTBatchMetadata(params *DeSoParams, metadata *NFTBatchMetadata) error {
+	if metadata.NFTPostHash == nil {
+		return errors.Wrapf(RuleErrorNFTBatchOnNonexistentPost, "ValidateNFTBatchMetadata: NFTPostHash is nil")
+	}
+	switch metadata.OperationType {
+	case NFTBatchOperationTypeMint, NFTBatchOperationTypeTransfer,
+		NFTBatchOperationTypeAcceptTransfer, NFTBatchOperationTypeBurn:
+	default:
+		return errors.Wrapf(RuleErrorNFTBatchInvalidOperationType,
+			"ValidateNFTBatchMetadata: %d", metadata.OperationType)
+	}
+	if metadata.FirstSerialNumber == 0 || metadata.LastSerialNumber < metadata.FirstSerialNumber {
+		return errors.Wrapf(RuleErrorNFTBatchInvalidSerialRange,
+			"ValidateNFTBatchMetadata: %d-%d", metadata.FirstSerialNumber, metadata.LastSerialNumber)
+	}
+	if metadata.NumSerials() > params.MaxNFTBatchSerialsPerTxn {
+		return errors.Wrapf(RuleErrorNFTBatchTooManySerials,
+			"ValidateNFTBatchMetadata: %d serials > %d", metadata.NumSerials(), params.MaxNFTBatchSerialsPerTxn)
+	}
+	if metadata.OperationType != NFTBatchOperationTypeTransfer {
+		if len(metadata.ReceiverPublicKey) != 0 {
+			return RuleErrorNFTBatchUnexpectedReceiver
+		}
+		if len(metadata.UnlockableText) != 0 {
+			return RuleErrorNFTBatchUnexpectedUnlockableText
+		}
+		return nil
+	}
+	if len(metadata.ReceiverPublicKey) != btcec.PubKeyBytesLenCompressed {
+		return RuleErrorNFTTransferInvalidReceiverPubKeySize
+	}
+	if uint64(len(metadata.UnlockableText)) > params.MaxPrivateMessageLengthBytes {
+		return errors.Wrapf(RuleErrorUnlockableTextLengthExceedsMax, "ValidateNFTBatchMetadata: "+
+			"UnlockableTextLen = %d; Max length = %d", len(metadata.UnlockableText), params.MaxPrivateMessageLengthBytes)
+	}
+	return nil
+}
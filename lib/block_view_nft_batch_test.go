@@ -0,0 +1,290 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTBatch(t *testing.T) {
+	var err error
+
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	// Make m3 a paramUpdater for this test.
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(m3PkBytes)] = true
+
+	setNFTBatchBlockHeight := func(blockHeight uint32) {
+		params.ForkHeights.NFTBatchBlockHeight = blockHeight
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}
+	defer setNFTBatchBlockHeight(math.MaxUint32)
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       chain.blockTip().Height + 1,
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e6)
+
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+
+	// Activate NFTs with a fee of 10 nanos per copy.
+	createNFTFeeNanos := uint64(10)
+	_updateGlobalParamsEntryWithTestMeta(testMeta, 10, m3Pub, m3Priv, -1, -1, -1, int64(createNFTFeeNanos), 1000)
+
+	// m0 turns a post into an NFT with 5 copies.
+	_submitPostWithTestMeta(testMeta, 10, m0Pub, m0Priv, []byte{}, []byte{},
+		&DeSoBodySchema{Body: "m0 post"}, []byte{}, 1502947011*1e9, false)
+	postHash := testMeta.txns[len(testMeta.txns)-1].Hash()
+	_updateProfileWithTestMeta(testMeta, 10, m0Pub, m0Priv, []byte{}, "m0", "i am the m0", shortPic,
+		10*100, 1.25*100*100, false)
+	_createNFTWithTestMeta(testMeta, 10, m0Pub, m0Priv, postHash, 5, false, false, 0,
+		5*createNFTFeeNanos, 0, 0, false, 0)
+
+	batch := func(operationType NFTBatchOperationType, firstSerialNumber uint64, lastSerialNumber uint64) *NFTBatchMetadata {
+		return &NFTBatchMetadata{
+			NFTPostHash:       postHash,
+			OperationType:     operationType,
+			FirstSerialNumber: firstSerialNumber,
+			LastSerialNumber:  lastSerialNumber,
+		}
+	}
+	transferBatch := func(firstSerialNumber uint64, lastSerialNumber uint64) *NFTBatchMetadata {
+		metadata := batch(NFTBatchOperationTypeTransfer, firstSerialNumber, lastSerialNumber)
+		metadata.ReceiverPublicKey = m1PkBytes
+		return metadata
+	}
+	requireOwners := func(expectedOwners map[uint64]*PKID, expectedIsPending bool) {
+		for serialNumber, expectedOwner := range expectedOwners {
+			nftEntry := DBGetNFTEntryByPostHashSerialNumber(db, chain.snapshot, postHash, serialNumber)
+			require.NotNil(t, nftEntry, "serial %d", serialNumber)
+			require.Equal(t, expectedOwner, nftEntry.OwnerPKID, "serial %d", serialNumber)
+			require.Equal(t, expectedIsPending, nftEntry.IsPending, "serial %d", serialNumber)
+		}
+	}
+	serialRange := func(firstSerialNumber uint64, lastSerialNumber uint64, ownerPKID *PKID) map[uint64]*PKID {
+		owners := make(map[uint64]*PKID)
+		for serialNumber := firstSerialNumber; serialNumber <= lastSerialNumber; serialNumber++ {
+			owners[serialNumber] = ownerPKID
+		}
+		return owners
+	}
+
+	{
+		// RuleErrorNFTBatchBeforeBlockHeight
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, batch(NFTBatchOperationTypeMint, 6, 20))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTBatchBeforeBlockHeight)
+
+		setNFTBatchBlockHeight(uint32(1))
+	}
+	{
+		// RuleErrorNFTBatchInvalidOperationType
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, batch(NFTBatchOperationTypeUnknown, 1, 5))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTBatchInvalidOperationType)
+	}
+	{
+		// RuleErrorNFTBatchInvalidSerialRange
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, batch(NFTBatchOperationTypeBurn, 0, 5))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTBatchInvalidSerialRange)
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, batch(NFTBatchOperationTypeBurn, 5, 4))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTBatchInvalidSerialRange)
+	}
+	{
+		// RuleErrorNFTBatchTooManySerials
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv,
+			batch(NFTBatchOperationTypeMint, 6, 6+params.MaxNFTBatchSerialsPerTxn))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTBatchTooManySerials)
+	}
+	{
+		// RuleErrorNFTBatchUnexpectedReceiver
+		metadata := batch(NFTBatchOperationTypeBurn, 1, 5)
+		metadata.ReceiverPublicKey = m1PkBytes
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTBatchUnexpectedReceiver)
+	}
+	{
+		// RuleErrorCreateNFTMustBeCalledByPoster
+		err = _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, batch(NFTBatchOperationTypeMint, 6, 20))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorCreateNFTMustBeCalledByPoster)
+	}
+	{
+		// RuleErrorNFTBatchMintSerialRangeNotNext
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, batch(NFTBatchOperationTypeMint, 7, 20))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTBatchMintSerialRangeNotNext)
+	}
+	{
+		// RuleErrorTooManyNFTCopies
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, batch(NFTBatchOperationTypeMint, 6, 1001))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorTooManyNFTCopies)
+	}
+	{
+		// Happy path: m0 mints serials 6 through 20 and burns the NFT fee for each of them.
+		m0BalanceBefore := _getBalance(t, chain, nil, m0Pub)
+		require.NoError(t, _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, batch(NFTBatchOperationTypeMint, 6, 20)))
+		txnFeeNanos := testMeta.txns[len(testMeta.txns)-1].TxnFeeNanos
+		require.Equal(t, m0BalanceBefore-txnFeeNanos-15*createNFTFeeNanos, _getBalance(t, chain, nil, m0Pub))
+
+		require.Len(t, DBGetNFTEntriesForPostHash(db, postHash), 20)
+		require.Equal(t, uint64(20), DBGetPostEntryByPostHash(db, chain.snapshot, postHash).NumNFTCopies)
+		requireOwners(serialRange(1, 20, m0PKID), false)
+	}
+	{
+		// RuleErrorNFTTransferByNonOwner: m1 doesn't own any serials.
+		metadata := transferBatch(1, 10)
+		metadata.ReceiverPublicKey = m0PkBytes
+		err = _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorNFTTransferByNonOwner)
+	}
+	{
+		// RuleErrorCannotTransferNonExistentNFT: the range goes past the last serial.
+		err = _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, transferBatch(15, 21))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorCannotTransferNonExistentNFT)
+	}
+	{
+		// Happy path: m0 transfers serials 1 through 10 to m1.
+		require.NoError(t, _submitNFTBatchWithTestMeta(testMeta, m0Pub, m0Priv, transferBatch(1, 10)))
+		requireOwners(serialRange(1, 10, m1PKID), true)
+		requireOwners(serialRange(11, 20, m0PKID), false)
+	}
+	{
+		// RuleErrorAcceptNFTTransferByNonOwner: m1 doesn't own serial 11.
+		err = _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, batch(NFTBatchOperationTypeAcceptTransfer, 1, 11))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAcceptNFTTransferByNonOwner)
+		requireOwners(serialRange(1, 10, m1PKID), true)
+	}
+	{
+		// Happy path: m1 accepts serials 1 through 10.
+		require.NoError(t, _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, batch(NFTBatchOperationTypeAcceptTransfer, 1, 10)))
+		requireOwners(serialRange(1, 10, m1PKID), false)
+	}
+	{
+		// RuleErrorAcceptNFTTransferForNonPendingNFT
+		err = _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, batch(NFTBatchOperationTypeAcceptTransfer, 1, 10))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorAcceptNFTTransferForNonPendingNFT)
+	}
+	{
+		// RuleErrorBurnNFTByNonOwner: m1 doesn't own serial 11.
+		err = _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, batch(NFTBatchOperationTypeBurn, 6, 11))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorBurnNFTByNonOwner)
+	}
+	{
+		// Happy path: m1 burns serials 1 through 5.
+		require.NoError(t, _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, batch(NFTBatchOperationTypeBurn, 1, 5)))
+		require.Len(t, DBGetNFTEntriesForPostHash(db, postHash), 15)
+		postEntry := DBGetPostEntryByPostHash(db, chain.snapshot, postHash)
+		require.Equal(t, uint64(20), postEntry.NumNFTCopies)
+		require.Equal(t, uint64(5), postEntry.NumNFTCopiesBurned)
+		requireOwners(serialRange(6, 10, m1PKID), false)
+
+		// Burned serials can't be burned again.
+		err = _submitNFTBatchWithTestMeta(testMeta, m1Pub, m1Priv, batch(NFTBatchOperationTypeBurn, 5, 6))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorCannotBurnNonExistentNFT)
+	}
+
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func TestNFTBatchMetadataEncoding(t *testing.T) {
+	metadata := &NFTBatchMetadata{
+		NFTPostHash:       NewBlockHash(RandomBytes(HashSizeBytes)),
+		OperationType:     NFTBatchOperationTypeTransfer,
+		FirstSerialNumber: 6,
+		LastSerialNumber:  1005,
+		ReceiverPublicKey: m1PkBytes,
+		UnlockableText:    []byte("unlockable"),
+	}
+	metadataBytes, err := metadata.ToBytes(false)
+	require.NoError(t, err)
+	decodedMetadata := &NFTBatchMetadata{}
+	require.NoError(t, decodedMetadata.FromBytes(metadataBytes))
+	require.Equal(t, metadata, decodedMetadata)
+	require.Equal(t, uint64(1000), decodedMetadata.NumSerials())
+
+	// Truncated metadata fails to decode.
+	require.Error(t, (&NFTBatchMetadata{}).FromBytes(metadataBytes[:len(metadataBytes)-1]))
+}
+
+func _submitNFTBatchWithTestMeta(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *NFTBatchMetadata,
+) error {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, _, _, err := testMeta.chain.CreateNFTBatchTxn(
+		transactorPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		nil,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	blockHeight := testMeta.chain.blockTip().Height + 1
+	utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	utxoOps, totalInput, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return err
+	}
+	require.Equal(testMeta.t, totalInputMake, totalInput)
+	require.Equal(testMeta.t, OperationTypeNFTBatch, utxoOps[len(utxoOps)-1].Type)
+	require.NoError(testMeta.t, utxoView.FlushToDb(uint64(blockHeight)))
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return nil
+}
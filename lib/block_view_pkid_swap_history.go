@@ -0,0 +1,377 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// PKID Swap History
+//
+// A SwapIdentity transaction swaps the PKIDs of two public keys, so the public key that a PKID, and everything
+// attributed to it, belongs to changes over time. Consumers that attribute historical transactions to public keys,
+// such as the txindex, need to know which PKID a public key had at the time. To answer this, a PKIDSwapEntry is
+// recorded for each of the two PKIDs that a SwapIdentity swaps, holding the public keys and their PKIDs before the
+// swap. GetSwapHistory returns the swaps of a PKID, and ResolvePKIDAtHeight undoes the swaps after a height to find
+// the PKID that a public key had at that height.
+//
+// The swaps are recorded when a SwapIdentity is connected and deleted when it's disconnected. They're derived from
+// the blocks, so they aren't part of the state, and a node only has the swaps of the blocks it connected itself. A
+// node that hypersynced has no swaps for the blocks before its snapshot, and the swaps aren't recorded when running
+// with Postgres. The swaps of a block are ordered by transaction hash rather than by their position in the block,
+// which only matters if the same PKID is swapped more than once in a block.
+
+//
+// TYPES: PKIDSwapEntry
+//
+
+// PKIDSwapEntry records a SwapIdentity that swapped PKID. After the swap, FromPublicKey has ToPKID and
+// ToPublicKey has FromPKID.
+type PKIDSwapEntry struct {
+	// PKID is the PKID whose history this entry is part of. It's either FromPKID or ToPKID.
+	PKID          *PKID
+	FromPublicKey *PublicKey
+	ToPublicKey   *PublicKey
+	// FromPKID and ToPKID are the PKIDs of FromPublicKey and ToPublicKey before the swap.
+	FromPKID    *PKID
+	ToPKID      *PKID
+	BlockHeight uint64
+	TxnHash     *BlockHash
+
+	isDeleted bool
+}
+
+type PKIDSwapKey struct {
+	PKID        PKID
+	BlockHeight uint64
+	TxnHash     BlockHash
+}
+
+func (entry *PKIDSwapEntry) Copy() *PKIDSwapEntry {
+	return &PKIDSwapEntry{
+		PKID:          entry.PKID.NewPKID(),
+		FromPublicKey: NewPublicKey(entry.FromPublicKey.ToBytes()),
+		ToPublicKey:   NewPublicKey(entry.ToPublicKey.ToBytes()),
+		FromPKID:      entry.FromPKID.NewPKID(),
+		ToPKID:        entry.ToPKID.NewPKID(),
+		BlockHeight:   entry.BlockHeight,
+		TxnHash:       entry.TxnHash.NewBlockHash(),
+		isDeleted:     entry.isDeleted,
+	}
+}
+
+func (entry *PKIDSwapEntry) ToMapKey() PKIDSwapKey {
+	return PKIDSwapKey{
+		PKID:        *entry.PKID,
+		BlockHeight: entry.BlockHeight,
+		TxnHash:     *entry.TxnHash,
+	}
+}
+
+// isBefore returns true if the entry's swap happened before the other entry's swap.
+func (entry *PKIDSwapEntry) isBefore(other *PKIDSwapEntry) bool {
+	if entry.BlockHeight != other.BlockHeight {
+		return entry.BlockHeight < other.BlockHeight
+	}
+	return bytes.Compare(entry.TxnHash[:], other.TxnHash[:]) < 0
+}
+
+func (entry *PKIDSwapEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.PKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.FromPublicKey, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ToPublicKey, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.FromPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ToPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.BlockHeight)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.TxnHash, skipMetadata...)...)
+	return data
+}
+
+func (entry *PKIDSwapEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// PKID
+	entry.PKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "PKIDSwapEntry.Decode: Problem reading PKID: ")
+	}
+
+	// FromPublicKey
+	entry.FromPublicKey, err = DecodeDeSoEncoder(&PublicKey{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "PKIDSwapEntry.Decode: Problem reading FromPublicKey: ")
+	}
+
+	// ToPublicKey
+	entry.ToPublicKey, err = DecodeDeSoEncoder(&PublicKey{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "PKIDSwapEntry.Decode: Problem reading ToPublicKey: ")
+	}
+
+	// FromPKID
+	entry.FromPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "PKIDSwapEntry.Decode: Problem reading FromPKID: ")
+	}
+
+	// ToPKID
+	entry.ToPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "PKIDSwapEntry.Decode: Problem reading ToPKID: ")
+	}
+
+	// BlockHeight
+	entry.BlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "PKIDSwapEntry.Decode: Problem reading BlockHeight: ")
+	}
+
+	// TxnHash
+	entry.TxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "PKIDSwapEntry.Decode: Problem reading TxnHash: ")
+	}
+
+	return nil
+}
+
+func (entry *PKIDSwapEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *PKIDSwapEntry) GetEncoderType() EncoderType {
+	return EncoderTypePKIDSwapEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForPKIDSwap(entry *PKIDSwapEntry) []byte {
+	data := DBPrefixKeyForPKIDSwapsByPKID(entry.PKID)
+	data = append(data, EncodeUint64(entry.BlockHeight)...)
+	data = append(data, entry.TxnHash.ToBytes()...)
+	return data
+}
+
+func DBPrefixKeyForPKIDSwapsByPKID(pkid *PKID) []byte {
+	data := append([]byte{}, Prefixes.PrefixPKIDSwapByPKIDHeightTxnHash...)
+	data = append(data, pkid.ToBytes()...)
+	return data
+}
+
+// DBGetPKIDSwapsForPKID returns all the swaps recorded for the PKID, ordered by block height and then by
+// transaction hash.
+func DBGetPKIDSwapsForPKID(handle *badger.DB, pkid *PKID) ([]*PKIDSwapEntry, error) {
+	var entries []*PKIDSwapEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = DBPrefixKeyForPKIDSwapsByPKID(pkid)
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(opts.Prefix); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := DecodeDeSoEncoder(&PKIDSwapEntry{}, bytes.NewReader(entryBytes))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetPKIDSwapsForPKID: problem retrieving swaps: ")
+	}
+	return entries, nil
+}
+
+func DBPutPKIDSwapWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *PKIDSwapEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutPKIDSwapWithTxn: called with nil entry")
+		return nil
+	}
+	if err := DBSetWithTxn(txn, snap, DBKeyForPKIDSwap(entry), EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(err, "DBPutPKIDSwapWithTxn: problem storing swap: ")
+	}
+	return nil
+}
+
+func DBDeletePKIDSwapWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *PKIDSwapEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	if err := DBDeleteWithTxn(txn, snap, DBKeyForPKIDSwap(entry), eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(err, "DBDeletePKIDSwapWithTxn: problem deleting swap: ")
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setPKIDSwapMappings(entry *PKIDSwapEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setPKIDSwapMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.PKIDSwapKeyToPKIDSwapEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deletePKIDSwapMappings(entry *PKIDSwapEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deletePKIDSwapMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := entry.Copy()
+	tombstoneEntry.isDeleted = true
+	bav._setPKIDSwapMappings(tombstoneEntry)
+}
+
+// _getPKIDSwapEntries returns an entry for each of the PKIDs swapped by a SwapIdentity, given the PKIDs of the
+// public keys before the swap.
+func _getPKIDSwapEntries(
+	fromPublicKey []byte,
+	toPublicKey []byte,
+	fromPKID *PKID,
+	toPKID *PKID,
+	blockHeight uint64,
+	txnHash *BlockHash,
+) []*PKIDSwapEntry {
+	var entries []*PKIDSwapEntry
+	for _, pkid := range []*PKID{fromPKID, toPKID} {
+		entries = append(entries, &PKIDSwapEntry{
+			PKID:          pkid.NewPKID(),
+			FromPublicKey: NewPublicKey(fromPublicKey),
+			ToPublicKey:   NewPublicKey(toPublicKey),
+			FromPKID:      fromPKID.NewPKID(),
+			ToPKID:        toPKID.NewPKID(),
+			BlockHeight:   blockHeight,
+			TxnHash:       txnHash.NewBlockHash(),
+		})
+	}
+	return entries
+}
+
+// GetSwapHistory returns the swaps of the PKID, ordered from oldest to newest. The result only reflects the blocks
+// this node recorded swaps for, see the comment at the top of this file.
+func (bav *UtxoView) GetSwapHistory(pkid *PKID) ([]*PKIDSwapEntry, error) {
+	if pkid == nil {
+		return nil, errors.New("GetSwapHistory: called with nil PKID")
+	}
+
+	// Merge the swaps in the db with the ones in the UtxoView, which are more up to date.
+	dbEntries, err := DBGetPKIDSwapsForPKID(bav.Handle, pkid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetSwapHistory: ")
+	}
+	entries := make(map[PKIDSwapKey]*PKIDSwapEntry, len(dbEntries))
+	for _, entry := range dbEntries {
+		entries[entry.ToMapKey()] = entry
+	}
+	for mapKey, entry := range bav.PKIDSwapKeyToPKIDSwapEntry {
+		if mapKey.PKID.Eq(pkid) {
+			entries[mapKey] = entry
+		}
+	}
+
+	var swaps []*PKIDSwapEntry
+	for _, entry := range entries {
+		if !entry.isDeleted {
+			swaps = append(swaps, entry.Copy())
+		}
+	}
+	sort.Slice(swaps, func(ii, jj int) bool {
+		return swaps[ii].isBefore(swaps[jj])
+	})
+	return swaps, nil
+}
+
+// ResolvePKIDAtHeight returns the PKID that the public key had after the block at blockHeight was connected. It
+// starts from the public key's current PKID and undoes the swaps after blockHeight, newest first. The result only
+// reflects the blocks this node recorded swaps for, see the comment at the top of this file.
+func (bav *UtxoView) ResolvePKIDAtHeight(publicKey []byte, blockHeight uint64) (*PKID, error) {
+	pkidEntry := bav.GetPKIDForPublicKey(publicKey)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return nil, fmt.Errorf("ResolvePKIDAtHeight: no PKID for public key %v", PkToStringBoth(publicKey))
+	}
+	pkid := pkidEntry.PKID.NewPKID()
+
+	// Every swap of the public key's PKID swaps it away from the public key, so the latest swap of the PKID that
+	// hasn't been undone yet is the one that gave it to the public key. Undoing it gives the public key the PKID
+	// it had before, and so on until the swaps are at or before blockHeight.
+	var undoneSwap *PKIDSwapEntry
+	for {
+		swaps, err := bav.GetSwapHistory(pkid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ResolvePKIDAtHeight: ")
+		}
+		var lastSwap *PKIDSwapEntry
+		for _, swap := range swaps {
+			if swap.BlockHeight > blockHeight && (undoneSwap == nil || swap.isBefore(undoneSwap)) {
+				lastSwap = swap
+			}
+		}
+		if lastSwap == nil {
+			return pkid, nil
+		}
+		if bytes.Equal(lastSwap.FromPublicKey.ToBytes(), publicKey) && lastSwap.ToPKID.Eq(pkid) {
+			pkid = lastSwap.FromPKID.NewPKID()
+		} else if bytes.Equal(lastSwap.ToPublicKey.ToBytes(), publicKey) && lastSwap.FromPKID.Eq(pkid) {
+			pkid = lastSwap.ToPKID.NewPKID()
+		} else {
+			return nil, fmt.Errorf("ResolvePKIDAtHeight: swap %v at height %d doesn't give PKID %v to public key %v",
+				lastSwap.TxnHash, lastSwap.BlockHeight, PkToStringBoth(pkid[:]), PkToStringBoth(publicKey))
+		}
+		undoneSwap = lastSwap
+	}
+}
+
+func (bav *UtxoView) _flushPKIDSwapEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, entry := range bav.PKIDSwapKeyToPKIDSwapEntry {
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushPKIDSwapEntriesToDbWithTxn: entry key %v doesn't match MapKey %v", entry.ToMapKey(), mapKey,
+			)
+		}
+
+		// Swaps are only ever set once, so we only need to delete the ones that were tombstoned when their
+		// SwapIdentity was disconnected.
+		if entry.isDeleted {
+			if err := DBDeletePKIDSwapWithTxn(txn, bav.Snapshot, entry, bav.EventManager, true); err != nil {
+				return errors.Wrapf(err, "_flushPKIDSwapEntriesToDbWithTxn: ")
+			}
+			continue
+		}
+		if err := DBPutPKIDSwapWithTxn(txn, bav.Snapshot, entry, blockHeight, bav.EventManager); err != nil {
+			return errors.Wrapf(err, "_flushPKIDSwapEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIDSwapHistory(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+
+	// Mine two blocks to give the sender some DeSo, and make the sender a param updater so it can swap identities.
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(senderPkBytes)] = true
+
+	swapIdentity := func(fromPublicKey []byte, toPublicKey []byte) *MsgDeSoBlock {
+		txn, _, _, _, err := chain.CreateSwapIdentityTxn(senderPkBytes, fromPublicKey, toPublicKey, 10, mempool, nil)
+		require.NoError(err)
+		_signTxn(t, txn, senderPrivString)
+		_, err = mempool.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+		require.NoError(err)
+		block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+		require.Equal(2, len(block.Txns))
+		return block
+	}
+
+	// Swap m0 and m1, and then m1 and m2. After the first swap, m0 has m1's PKID and m1 has m0's PKID. After the
+	// second swap, m1 has m2's PKID and m2 has m0's PKID.
+	m0PKID := PublicKeyToPKID(m0PkBytes)
+	m1PKID := PublicKeyToPKID(m1PkBytes)
+	m2PKID := PublicKeyToPKID(m2PkBytes)
+	firstSwapBlock := swapIdentity(m0PkBytes, m1PkBytes)
+	secondSwapBlock := swapIdentity(m1PkBytes, m2PkBytes)
+	firstSwapHeight := uint64(firstSwapBlock.Header.Height)
+	secondSwapHeight := uint64(secondSwapBlock.Header.Height)
+
+	requireSwapHeights := func(utxoView *UtxoView, pkid *PKID, expectedHeights []uint64) {
+		swaps, err := utxoView.GetSwapHistory(pkid)
+		require.NoError(err)
+		var heights []uint64
+		for _, swap := range swaps {
+			require.Equal(pkid, swap.PKID)
+			heights = append(heights, swap.BlockHeight)
+		}
+		require.Equal(expectedHeights, heights)
+	}
+	requirePKIDAtHeight := func(utxoView *UtxoView, publicKey []byte, blockHeight uint64, expectedPKID *PKID) {
+		pkid, err := utxoView.ResolvePKIDAtHeight(publicKey, blockHeight)
+		require.NoError(err)
+		require.Equal(expectedPKID, pkid)
+	}
+
+	utxoView := NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	requireSwapHeights(utxoView, m0PKID, []uint64{firstSwapHeight, secondSwapHeight})
+	requireSwapHeights(utxoView, m1PKID, []uint64{firstSwapHeight})
+	requireSwapHeights(utxoView, m2PKID, []uint64{secondSwapHeight})
+	swaps, err := utxoView.GetSwapHistory(m2PKID)
+	require.NoError(err)
+	require.Equal(NewPublicKey(m1PkBytes), swaps[0].FromPublicKey)
+	require.Equal(NewPublicKey(m2PkBytes), swaps[0].ToPublicKey)
+	require.Equal(m0PKID, swaps[0].FromPKID)
+	require.Equal(m2PKID, swaps[0].ToPKID)
+	require.Equal(secondSwapBlock.Txns[1].Hash(), swaps[0].TxnHash)
+
+	requirePKIDAtHeight(utxoView, m0PkBytes, firstSwapHeight-1, m0PKID)
+	requirePKIDAtHeight(utxoView, m0PkBytes, firstSwapHeight, m1PKID)
+	requirePKIDAtHeight(utxoView, m1PkBytes, firstSwapHeight-1, m1PKID)
+	requirePKIDAtHeight(utxoView, m1PkBytes, firstSwapHeight, m0PKID)
+	requirePKIDAtHeight(utxoView, m1PkBytes, secondSwapHeight, m2PKID)
+	requirePKIDAtHeight(utxoView, m2PkBytes, firstSwapHeight, m2PKID)
+	requirePKIDAtHeight(utxoView, m2PkBytes, secondSwapHeight, m0PKID)
+	requirePKIDAtHeight(utxoView, m3PkBytes, 0, PublicKeyToPKID(m3PkBytes))
+
+	// Disconnecting the second swap deletes it from the history, both in the view and once it's flushed.
+	blockHash, err := secondSwapBlock.Header.Hash()
+	require.NoError(err)
+	txHashes, err := ComputeTransactionHashes(secondSwapBlock.Txns)
+	require.NoError(err)
+	utxoOps, err := GetUtxoOperationsForBlock(db, chain.snapshot, blockHash)
+	require.NoError(err)
+	require.NoError(utxoView.DisconnectBlock(secondSwapBlock, txHashes, utxoOps, 0))
+	requireSwapHeights(utxoView, m0PKID, []uint64{firstSwapHeight})
+	requireSwapHeights(utxoView, m2PKID, nil)
+	requirePKIDAtHeight(utxoView, m2PkBytes, secondSwapHeight, m2PKID)
+	require.NoError(utxoView.FlushToDb(0))
+	utxoView = NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	requireSwapHeights(utxoView, m0PKID, []uint64{firstSwapHeight})
+	requireSwapHeights(utxoView, m2PKID, nil)
+	requirePKIDAtHeight(utxoView, m1PkBytes, secondSwapHeight, m0PKID)
+	requirePKIDAtHeight(utxoView, m1PkBytes, firstSwapHeight-1, m1PKID)
+}
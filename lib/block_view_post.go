@@ -137,7 +137,11 @@ func (bav *UtxoView) GetPostEntryForPostHash(postHash *BlockHash) *PostEntry {
 		}
 		return nil
 	} else {
-		dbPostEntry := DBGetPostEntryByPostHash(bav.Handle, bav.Snapshot, postHash)
+		var dbPostEntry *PostEntry
+		bav.viewDB(func(txn *badger.Txn, snap *Snapshot) error {
+			dbPostEntry = DBGetPostEntryByPostHashWithTxn(txn, snap, postHash)
+			return nil
+		})
 		if dbPostEntry != nil {
 			bav._setPostEntryMappings(dbPostEntry)
 		}
@@ -381,6 +385,101 @@ func (bav *UtxoView) GetParentPostEntriesForPostEntry(postEntry *PostEntry, maxD
 	return parentPostEntries, iterations >= maxDepth
 }
 
+// PostThreadNode is a post in the tree of replies returned by GetPostThread.
+type PostThreadNode struct {
+	PostEntry *PostEntry
+	// NumReplies is the number of direct replies to the post, including the ones that were left out of
+	// Replies because of maxDepth or limitPerLevel.
+	NumReplies uint64
+	// Replies are the direct replies to the post that were retrieved, ordered by their timestamps.
+	Replies []*PostThreadNode
+}
+
+// GetPostThread returns the tree of replies under a post, down to maxDepth levels below it. The tree is
+// retrieved level by level using the comment index, and at most limitPerLevel replies are retrieved at each
+// level, taking the earliest replies to each of the posts of the level above in turn. Every node's NumReplies
+// counts all of its direct replies, so that a client can tell which posts have more replies to fetch, e.g. with
+// another call rooted at them. Hidden replies are included, but replies that are deleted in the view are not.
+func (bav *UtxoView) GetPostThread(postHash *BlockHash, maxDepth uint32, limitPerLevel uint32) (
+	*PostThreadNode, error) {
+
+	rootPostEntry := bav.GetPostEntryForPostHash(postHash)
+	if rootPostEntry == nil || rootPostEntry.isDeleted {
+		return nil, fmt.Errorf("GetPostThread: Post %v not found", postHash)
+	}
+
+	// Index the replies that are in the view, since some of them may not have been flushed yet.
+	viewReplyHashes := make(map[BlockHash][]*BlockHash)
+	for _, postEntry := range bav.PostHashToPostEntry {
+		if !postEntry.isDeleted && len(postEntry.ParentStakeID) == HashSizeBytes {
+			parentPostHash := *NewBlockHash(postEntry.ParentStakeID)
+			viewReplyHashes[parentPostHash] = append(viewReplyHashes[parentPostHash], postEntry.PostHash)
+		}
+	}
+
+	// getReplies returns the replies to a post from the DB and the view, ordered by their timestamps.
+	getReplies := func(parentPostHash *BlockHash) ([]*PostEntry, error) {
+		replyPostHashes := viewReplyHashes[*parentPostHash]
+		if bav.Postgres != nil {
+			for _, post := range bav.Postgres.GetComments(parentPostHash) {
+				replyPostHashes = append(replyPostHashes, post.PostHash)
+			}
+		} else {
+			dbReplyPostHashes, err := DBGetReplyPostHashesForPostHash(bav.Handle, bav.Snapshot, parentPostHash)
+			if err != nil {
+				return nil, errors.Wrapf(err, "GetPostThread: Problem fetching replies to post %v: ", parentPostHash)
+			}
+			replyPostHashes = append(replyPostHashes, dbReplyPostHashes...)
+		}
+
+		replies := []*PostEntry{}
+		seenPostHashes := make(map[BlockHash]bool)
+		for _, replyPostHash := range replyPostHashes {
+			if seenPostHashes[*replyPostHash] {
+				continue
+			}
+			seenPostHashes[*replyPostHash] = true
+			if replyPostEntry := bav.GetPostEntryForPostHash(replyPostHash); replyPostEntry != nil &&
+				!replyPostEntry.isDeleted {
+				replies = append(replies, replyPostEntry)
+			}
+		}
+		sort.Slice(replies, func(ii, jj int) bool {
+			if replies[ii].TimestampNanos != replies[jj].TimestampNanos {
+				return replies[ii].TimestampNanos < replies[jj].TimestampNanos
+			}
+			return bytes.Compare(replies[ii].PostHash[:], replies[jj].PostHash[:]) < 0
+		})
+		return replies, nil
+	}
+
+	root := &PostThreadNode{PostEntry: rootPostEntry}
+	level := []*PostThreadNode{root}
+	for depth := uint32(0); len(level) > 0; depth++ {
+		var nextLevel []*PostThreadNode
+		for _, node := range level {
+			replies, err := getReplies(node.PostEntry.PostHash)
+			if err != nil {
+				return nil, err
+			}
+			node.NumReplies = uint64(len(replies))
+			if depth >= maxDepth {
+				continue
+			}
+			for _, reply := range replies {
+				if uint32(len(nextLevel)) >= limitPerLevel {
+					break
+				}
+				replyNode := &PostThreadNode{PostEntry: reply}
+				node.Replies = append(node.Replies, replyNode)
+				nextLevel = append(nextLevel, replyNode)
+			}
+		}
+		level = nextLevel
+	}
+	return root, nil
+}
+
 // Just fetch all the posts from the db and join them with all the posts
 // in the mempool. Then sort them by their timestamp. This can be called
 // on an empty view or a view that already has a lot of transactions
@@ -766,6 +865,23 @@ func (bav *UtxoView) _connectSubmitPost(txn *MsgDeSoTxn, txHash *BlockHash, bloc
 		}
 	}
 
+	// The post is attributed to the transactor unless the transactor is a delegate posting on behalf
+	// of its owner. Only consensus sets the delegate recorded in the post's extra data.
+	posterPublicKey := txn.PublicKey
+	isDelegatedPost := false
+	if blockHeight >= bav.Params.ForkHeights.DelegatedPosterBlockHeight {
+		delete(extraData, DelegatedPostDelegatePublicKeyKey)
+		if ownerPublicKey, exists := extraData[DelegatedPostOwnerPublicKeyKey]; exists {
+			posterPublicKey, err = bav._getDelegatedPostOwnerPublicKey(
+				txn.PublicKey, ownerPublicKey, len(txMeta.PostHashToModify) != 0, blockHeight)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectSubmitPost: ")
+			}
+			isDelegatedPost = true
+			delete(extraData, DelegatedPostOwnerPublicKeyKey)
+		}
+	}
+
 	// At this point the inputs and outputs have been processed. Now we
 	// need to handle the metadata.
 
@@ -800,8 +916,9 @@ func (bav *UtxoView) _connectSubmitPost(txn *MsgDeSoTxn, txHash *BlockHash, bloc
 				"_connectSubmitPost: Post hash: %v", postHash)
 		}
 
-		// Post modification is only allowed by the original poster.
-		if !reflect.DeepEqual(txn.PublicKey, existingPostEntryy.PosterPublicKey) {
+		// Post modification is only allowed by the original poster, or by a delegate
+		// authorized to edit the original poster's posts.
+		if !reflect.DeepEqual(posterPublicKey, existingPostEntryy.PosterPublicKey) {
 
 			return 0, 0, nil, errors.Wrapf(
 				RuleErrorSubmitPostPostModificationNotAuthorized,
@@ -1013,10 +1130,15 @@ func (bav *UtxoView) _connectSubmitPost(txn *MsgDeSoTxn, txHash *BlockHash, bloc
 			}
 		}
 
+		// Record the delegate that submitted the post on behalf of the poster.
+		if isDelegatedPost {
+			extraData[DelegatedPostDelegatePublicKeyKey] = txn.PublicKey
+		}
+
 		// Set the post entry pointer to a brand new post.
 		newPostEntry = &PostEntry{
 			PostHash:                 postHash,
-			PosterPublicKey:          txn.PublicKey,
+			PosterPublicKey:          posterPublicKey,
 			ParentStakeID:            txMeta.ParentStakeID,
 			Body:                     txMeta.Body,
 			RepostedPostHash:         repostedPostHash,
@@ -1076,7 +1198,7 @@ func (bav *UtxoView) _connectSubmitPost(txn *MsgDeSoTxn, txHash *BlockHash, bloc
 	if verifySignatures {
 		// _connectBasicTransfer has already checked that the transaction is
 		// signed by the top-level public key, which we take to be the poster's
-		// public key.
+		// public key, or the public key of a delegate authorized by the poster.
 	}
 
 	// Set the mappings for the entry regardless of whether we modified it or
@@ -1096,6 +1218,11 @@ func (bav *UtxoView) _connectSubmitPost(txn *MsgDeSoTxn, txHash *BlockHash, bloc
 		bav._setRepostEntryMappings(newRepostEntry)
 	}
 
+	// Record a tombstone if the txn hid the post.
+	if bav.Postgres == nil && prevPostEntry != nil && !prevPostEntry.IsHidden && newPostEntry.IsHidden {
+		bav._setContentTombstoneMappings(_getPostContentTombstoneEntry(newPostEntry, uint64(blockHeight), txHash))
+	}
+
 	bodyObj := &DeSoBodySchema{}
 	var profilesMentioned []*ProfileEntry
 	if err = json.Unmarshal(newPostEntry.Body, &bodyObj); err == nil {
@@ -1226,11 +1353,14 @@ func (bav *UtxoView) _disconnectSubmitPost(
 		return fmt.Errorf("_disconnectSubmitPost: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	currentOperation := utxoOpsForTxn[operationIndex]
-	if currentOperation.Type != OperationTypeSubmitPost {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeSubmitPost {
 		return fmt.Errorf("_disconnectSubmitPost: Trying to revert "+
 			"OperationTypeSubmitPost but found type %v",
-			currentOperation.Type)
+			utxoOpsForTxn[operationIndex].Type)
+	}
+	currentOperation, err := GetUtxoOperationData[SubmitPostOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectSubmitPost: ")
 	}
 
 	// Now we know the txMeta is SubmitPost
@@ -1291,6 +1421,12 @@ func (bav *UtxoView) _disconnectSubmitPost(
 		bav._setRepostEntryMappings(currentOperation.PrevRepostEntry)
 	}
 
+	// Delete the tombstone if the txn hid the post.
+	prevPostEntry := currentOperation.PrevPostEntry
+	if bav.Postgres == nil && prevPostEntry != nil && !prevPostEntry.IsHidden && postEntry.IsHidden {
+		bav._deleteContentTombstoneMappings(_getPostContentTombstoneEntry(postEntry, uint64(blockHeight), txnHash))
+	}
+
 	// Now revert the basic transfer with the remaining operations. Cut off
 	// the SubmitPost operation at the end since we just reverted it.
 	return bav._disconnectBasicTransfer(
@@ -2206,3 +2206,84 @@ func TestFreezingPosts(t *testing.T) {
 	}
 	_executeAllTestRollbackAndFlush(testMeta)
 }
+
+func TestGetPostThread(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	for ii := 0; ii < 2; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	_doBasicTransferWithViewFlush(t, chain, db, params, senderPkString, m0Pub, senderPrivString, 1000, 11)
+	_doBasicTransferWithViewFlush(t, chain, db, params, senderPkString, m1Pub, senderPrivString, 1000, 11)
+
+	tstampNanos := uint64(1e18)
+	submitPost := func(pubKey string, privKey string, parentPostHash *BlockHash) *BlockHash {
+		var parentStakeID []byte
+		if parentPostHash != nil {
+			parentStakeID = parentPostHash[:]
+		}
+		tstampNanos++
+		_, txn, _, err := _submitPost(t, chain, db, params, 10, pubKey, privKey, []byte{}, parentStakeID,
+			&DeSoBodySchema{Body: "post"}, []byte{}, tstampNanos, false /*isHidden*/)
+		require.NoError(err)
+		return txn.Hash()
+	}
+
+	// The root post has three replies, the first of which has a chain of two replies under it.
+	rootPostHash := submitPost(m0Pub, m0Priv, nil)
+	reply1Hash := submitPost(m1Pub, m1Priv, rootPostHash)
+	reply2Hash := submitPost(m1Pub, m1Priv, rootPostHash)
+	reply3Hash := submitPost(m0Pub, m0Priv, rootPostHash)
+	reply11Hash := submitPost(m0Pub, m0Priv, reply1Hash)
+	reply111Hash := submitPost(m1Pub, m1Priv, reply11Hash)
+
+	requireNode := func(node *PostThreadNode, postHash *BlockHash, numReplies uint64, replyHashes ...*BlockHash) {
+		require.Equal(postHash, node.PostEntry.PostHash)
+		require.Equal(numReplies, node.NumReplies)
+		require.Len(node.Replies, len(replyHashes))
+		for ii, replyHash := range replyHashes {
+			require.Equal(replyHash, node.Replies[ii].PostEntry.PostHash)
+		}
+	}
+
+	utxoView := NewUtxoView(db, params, nil, chain.snapshot, nil)
+	thread, err := utxoView.GetPostThread(rootPostHash, 10, 10)
+	require.NoError(err)
+	requireNode(thread, rootPostHash, 3, reply1Hash, reply2Hash, reply3Hash)
+	requireNode(thread.Replies[0], reply1Hash, 1, reply11Hash)
+	requireNode(thread.Replies[0].Replies[0], reply11Hash, 1, reply111Hash)
+	requireNode(thread.Replies[0].Replies[0].Replies[0], reply111Hash, 0)
+	requireNode(thread.Replies[1], reply2Hash, 0)
+
+	// The depth and the per-level limit cut the tree, but the counts still include all the replies.
+	thread, err = utxoView.GetPostThread(rootPostHash, 1, 2)
+	require.NoError(err)
+	requireNode(thread, rootPostHash, 3, reply1Hash, reply2Hash)
+	requireNode(thread.Replies[0], reply1Hash, 1)
+
+	// A thread can be rooted at a reply.
+	thread, err = utxoView.GetPostThread(reply11Hash, 10, 10)
+	require.NoError(err)
+	requireNode(thread, reply11Hash, 1, reply111Hash)
+
+	// Replies that are deleted in the view are left out, and replies that are only in the view are included.
+	utxoView = NewUtxoView(db, params, nil, chain.snapshot, nil)
+	reply2Entry := *utxoView.GetPostEntryForPostHash(reply2Hash)
+	utxoView._deletePostEntryMappings(&reply2Entry)
+	reply4Hash := NewBlockHash(RandomBytes(HashSizeBytes))
+	utxoView._setPostEntryMappings(&PostEntry{
+		PostHash:        reply4Hash,
+		PosterPublicKey: m1PkBytes,
+		ParentStakeID:   rootPostHash[:],
+		TimestampNanos:  tstampNanos + 1,
+	})
+	thread, err = utxoView.GetPostThread(rootPostHash, 1, 10)
+	require.NoError(err)
+	requireNode(thread, rootPostHash, 3, reply1Hash, reply3Hash, reply4Hash)
+
+	_, err = utxoView.GetPostThread(NewBlockHash(RandomBytes(HashSizeBytes)), 1, 10)
+	require.Error(err)
+}
@@ -1,12 +1,14 @@
 package lib
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/davecgh/go-spew/spew"
 	ecdsa2 "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
 	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
@@ -157,7 +159,11 @@ func (bav *UtxoView) GetProfileEntryForUsername(nonLowercaseUsername []byte) *Pr
 		profileEntry, _ := bav.setProfileMappings(profile)
 		return profileEntry
 	} else {
-		dbProfileEntry := DBGetProfileEntryForUsername(bav.Handle, bav.Snapshot, nonLowercaseUsername)
+		var dbProfileEntry *ProfileEntry
+		bav.viewDB(func(txn *badger.Txn, snap *Snapshot) error {
+			dbProfileEntry = DBGetProfileEntryForUsernameWithTxn(txn, snap, nonLowercaseUsername)
+			return nil
+		})
 		if dbProfileEntry != nil {
 			bav._setProfileEntryMappings(dbProfileEntry)
 		}
@@ -196,7 +202,11 @@ func (bav *UtxoView) GetPKIDForPublicKey(publicKeyArg []byte) *PKIDEntry {
 		_, pkidEntry := bav.setProfileMappings(profile)
 		return pkidEntry
 	} else {
-		dbPKIDEntry := DBGetPKIDEntryForPublicKey(bav.Handle, bav.Snapshot, publicKey)
+		var dbPKIDEntry *PKIDEntry
+		bav.viewDB(func(txn *badger.Txn, snap *Snapshot) error {
+			dbPKIDEntry = DBGetPKIDEntryForPublicKeyWithTxn(txn, snap, publicKey)
+			return nil
+		})
 		if dbPKIDEntry != nil {
 			bav._setPKIDMappings(dbPKIDEntry)
 		}
@@ -238,7 +248,11 @@ func (bav *UtxoView) GetPublicKeyForPKID(pkidArg *PKID) []byte {
 		_, pkidEntry := bav.setProfileMappings(profile)
 		return pkidEntry.PublicKey
 	} else {
-		dbPublicKey := DBGetPublicKeyForPKID(bav.Handle, bav.Snapshot, pkid)
+		var dbPublicKey []byte
+		bav.viewDB(func(txn *badger.Txn, snap *Snapshot) error {
+			dbPublicKey = DBGetPublicKeyForPKIDWithTxn(txn, snap, pkid)
+			return nil
+		})
 		if len(dbPublicKey) != 0 {
 			bav._setPKIDMappings(&PKIDEntry{
 				PKID:      pkid,
@@ -302,7 +316,11 @@ func (bav *UtxoView) GetProfileEntryForPKID(pkid *PKID) *ProfileEntry {
 		profileEntry, _ := bav.setProfileMappings(profile)
 		return profileEntry
 	} else {
-		dbProfileEntry := DBGetProfileEntryForPKID(bav.Handle, bav.Snapshot, pkid)
+		var dbProfileEntry *ProfileEntry
+		bav.viewDB(func(txn *badger.Txn, snap *Snapshot) error {
+			dbProfileEntry = DBGetProfileEntryForPKIDWithTxn(txn, snap, pkid)
+			return nil
+		})
 		if dbProfileEntry != nil {
 			bav._setProfileEntryMappings(dbProfileEntry)
 		}
@@ -526,6 +544,81 @@ func (bav *UtxoView) GetProfilesForUsernamePrefixByCoinValue(usernamePrefix stri
 	return profileEntrys
 }
 
+// UsernameSearchResult is a single match returned by SearchUsernamesByPrefix.
+type UsernameSearchResult struct {
+	// LowercaseUsername is the normalized username. Profiles are looked up case-insensitively, so
+	// callers that need the original casing should fetch the profile for PKID.
+	LowercaseUsername string
+	PKID              *PKID
+}
+
+// SearchUsernamesByPrefix returns up to limit usernames starting with usernamePrefix, in lexicographic
+// order of the lowercase username. The search is case-insensitive. A limit of zero returns all matches.
+//
+// The DB side of the search is served by the PrefixProfileUsernameToPKID index, which is keyed by the
+// lowercase username and is kept up to date whenever profiles are connected or disconnected. Entries in
+// the view override the DB, so usernames that were changed or deleted in the view are handled correctly.
+func (bav *UtxoView) SearchUsernamesByPrefix(usernamePrefix string, limit int) ([]*UsernameSearchResult, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("SearchUsernamesByPrefix: limit must be non-negative, got %d", limit)
+	}
+	lowercaseUsernamePrefix := strings.ToLower(usernamePrefix)
+	// A prefix containing characters that can never be part of a username can't match anything.
+	if len(lowercaseUsernamePrefix) > 0 && !UsernameRegex.MatchString(lowercaseUsernamePrefix) {
+		return []*UsernameSearchResult{}, nil
+	}
+
+	// Gather the view's entries that match the prefix first. Each of them can remove at most one result
+	// from the DB, so we fetch that many extra results from the DB to make sure we still have enough.
+	viewEntries := make(map[string]*ProfileEntry)
+	for usernameMapKey, profileEntry := range bav.ProfileUsernameToProfileEntry {
+		lowercaseUsername := string(bytes.TrimRight(usernameMapKey[:], "\x00"))
+		if strings.HasPrefix(lowercaseUsername, lowercaseUsernamePrefix) {
+			viewEntries[lowercaseUsername] = profileEntry
+		}
+	}
+	numToFetch := 0
+	if limit > 0 {
+		numToFetch = limit + len(viewEntries)
+	}
+
+	pkidsByUsername := make(map[string]*PKID)
+	if bav.Postgres != nil {
+		for _, profile := range bav.Postgres.GetProfilesForUsernamePrefixByCoinValue(lowercaseUsernamePrefix, numToFetch) {
+			pkidsByUsername[strings.ToLower(profile.Username)] = profile.PKID
+		}
+	} else {
+		lowercaseUsernames, pkids, err := DBGetUsernamesByPrefix(
+			bav.Handle, bav.Snapshot, lowercaseUsernamePrefix, numToFetch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "SearchUsernamesByPrefix: ")
+		}
+		for ii, lowercaseUsername := range lowercaseUsernames {
+			pkidsByUsername[lowercaseUsername] = pkids[ii]
+		}
+	}
+
+	for lowercaseUsername, profileEntry := range viewEntries {
+		if profileEntry == nil || profileEntry.isDeleted {
+			delete(pkidsByUsername, lowercaseUsername)
+			continue
+		}
+		pkidsByUsername[lowercaseUsername] = bav.GetPKIDForPublicKey(profileEntry.PublicKey).PKID
+	}
+
+	results := make([]*UsernameSearchResult, 0, len(pkidsByUsername))
+	for lowercaseUsername, pkid := range pkidsByUsername {
+		results = append(results, &UsernameSearchResult{LowercaseUsername: lowercaseUsername, PKID: pkid})
+	}
+	sort.Slice(results, func(ii, jj int) bool {
+		return results[ii].LowercaseUsername < results[jj].LowercaseUsername
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
 func (bav *UtxoView) _connectUpdateProfile(
 	txn *MsgDeSoTxn, txHash *BlockHash, blockHeight uint32, verifySignatures bool,
 	ignoreUtxos bool) (
@@ -773,6 +866,12 @@ func (bav *UtxoView) _connectUpdateProfile(
 		// public key.
 	}
 
+	// Verify and index the NFT avatar if the txn sets one.
+	prevNFTAvatarEntry, err := bav._connectNFTAvatar(txn, prevProfileEntry, &newProfileEntry, blockHeight)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectUpdateProfile: ")
+	}
+
 	// Delete the old profile mappings. Not doing this could cause a username
 	// change to have outdated mappings, among other things.
 	if prevProfileEntry != nil {
@@ -782,11 +881,19 @@ func (bav *UtxoView) _connectUpdateProfile(
 	// Save the profile entry now that we've updated it or created it from scratch.
 	bav._setProfileEntryMappings(&newProfileEntry)
 
+	// Record a tombstone if the txn hid the profile.
+	if bav.Postgres == nil && prevProfileEntry != nil && !prevProfileEntry.IsHidden && newProfileEntry.IsHidden {
+		profilePKID := bav.GetPKIDForPublicKey(newProfileEntry.PublicKey).PKID
+		bav._setContentTombstoneMappings(_getProfileContentTombstoneEntry(
+			profilePKID, &newProfileEntry, txn.PublicKey, uint64(blockHeight), txHash))
+	}
+
 	// Add an operation to the list at the end indicating we've updated a profile.
 	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
 		Type:                               OperationTypeUpdateProfile,
 		PrevProfileEntry:                   prevProfileEntry,
 		ClobberedProfileBugDESOLockedNanos: clobberedProfileBugDeSoAdjustment,
+		PrevNFTAvatarEntry:                 prevNFTAvatarEntry,
 	})
 
 	return totalInput, totalOutput, utxoOpsForTxn, nil
@@ -894,6 +1001,14 @@ func (bav *UtxoView) _connectSwapIdentity(
 	bav._setPKIDMappings(&newFromPKIDEntry)
 	bav._setPKIDMappings(&newToPKIDEntry)
 
+	// Record the swap in the history of both PKIDs.
+	if bav.Postgres == nil {
+		for _, swapEntry := range _getPKIDSwapEntries(
+			fromPublicKey, toPublicKey, oldFromPKIDEntry.PKID, oldToPKIDEntry.PKID, uint64(blockHeight), txHash) {
+			bav._setPKIDSwapMappings(swapEntry)
+		}
+	}
+
 	// Postgres doesn't have a concept of PKID Mappings. Instead, we need to save an empty
 	// profile with the correct PKID and public key
 	if bav.Postgres != nil {
@@ -1038,11 +1153,14 @@ func (bav *UtxoView) _disconnectUpdateProfile(
 		return fmt.Errorf("_disconnectUpdateProfile: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	currentOperation := utxoOpsForTxn[operationIndex]
-	if currentOperation.Type != OperationTypeUpdateProfile {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeUpdateProfile {
 		return fmt.Errorf("_disconnectUpdateProfile: Trying to revert "+
 			"OperationTypeUpdateProfile but found type %v",
-			currentOperation.Type)
+			utxoOpsForTxn[operationIndex].Type)
+	}
+	currentOperation, err := GetUtxoOperationData[UpdateProfileOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUpdateProfile: ")
 	}
 
 	// Now we know the txMeta is UpdateProfile
@@ -1072,6 +1190,13 @@ func (bav *UtxoView) _disconnectUpdateProfile(
 			profileEntry)
 	}
 
+	// Revert the changes to the NFT avatar index.
+	if err := bav._disconnectNFTAvatar(
+		currentTxn, currentOperation, bav.GetPKIDForPublicKey(profilePublicKey).PKID, blockHeight,
+	); err != nil {
+		return errors.Wrapf(err, "_disconnectUpdateProfile: ")
+	}
+
 	// Now that we are confident the ProfileEntry lines up with the transaction we're
 	// rolling back, set the mappings to be equal to whatever we had previously.
 	// We need to do this to prevent a fetch from a db later on.
@@ -1083,6 +1208,14 @@ func (bav *UtxoView) _disconnectUpdateProfile(
 		bav._setProfileEntryMappings(currentOperation.PrevProfileEntry)
 	}
 
+	// Delete the tombstone if the txn hid the profile.
+	prevProfileEntry := currentOperation.PrevProfileEntry
+	if bav.Postgres == nil && prevProfileEntry != nil && !prevProfileEntry.IsHidden && profileEntry.IsHidden {
+		bav._deleteContentTombstoneMappings(_getProfileContentTombstoneEntry(
+			bav.GetPKIDForPublicKey(profilePublicKey).PKID, profileEntry, currentTxn.PublicKey,
+			uint64(blockHeight), txnHash))
+	}
+
 	// Now revert the basic transfer with the remaining operations. Cut off
 	// the UpdateProfile operation at the end since we just reverted it.
 	return bav._disconnectBasicTransfer(
@@ -1140,6 +1273,15 @@ func (bav *UtxoView) _disconnectSwapIdentity(
 	bav._setPKIDMappings(&newFromPKIDEntry)
 	bav._setPKIDMappings(&newToPKIDEntry)
 
+	// Delete the swap from the history of both PKIDs. The PKIDs the public keys had before the swap are the ones
+	// they have again now.
+	if bav.Postgres == nil {
+		for _, swapEntry := range _getPKIDSwapEntries(txMeta.FromPublicKey, txMeta.ToPublicKey,
+			newFromPKIDEntry.PKID, newToPKIDEntry.PKID, uint64(blockHeight), txnHash) {
+			bav._deletePKIDSwapMappings(swapEntry)
+		}
+	}
+
 	// Now revert the basic transfer with the remaining operations. Cut off
 	// the SwapIdentity operation at the end since we just reverted it.
 	return bav._disconnectBasicTransfer(
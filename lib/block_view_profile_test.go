@@ -3543,3 +3543,81 @@ func TestEthSignature(t *testing.T) {
 	// verify signature
 	require.NoError(VerifyEthPersonalSignature(ownerPublicKeyBytes, accessBytes, signature))
 }
+
+func TestSearchUsernamesByPrefix(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ForkHeights.UpdateProfileFixBlockHeight = 0
+
+	for ii := 0; ii < 4; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	// Fund the keys and create a profile for each of them.
+	_doBasicTransferWithViewFlush(t, chain, db, params, senderPkString, m0Pub, senderPrivString, 100, 11)
+	_doBasicTransferWithViewFlush(t, chain, db, params, senderPkString, m1Pub, senderPrivString, 100, 11)
+	_doBasicTransferWithViewFlush(t, chain, db, params, senderPkString, m2Pub, senderPrivString, 100, 11)
+	for _, testCase := range []struct {
+		pub      string
+		priv     string
+		username string
+	}{
+		{m0Pub, m0Priv, "Alice"},
+		{m1Pub, m1Priv, "alfred"},
+		{m2Pub, m2Priv, "bob"},
+	} {
+		_, _, _, err := _updateProfile(t, chain, db, params, 10, testCase.pub, testCase.priv,
+			[]byte{}, testCase.username, "", "", 0, 12500, false)
+		require.NoError(err)
+	}
+
+	usernames := func(results []*UsernameSearchResult) []string {
+		var ret []string
+		for _, result := range results {
+			ret = append(ret, result.LowercaseUsername)
+		}
+		return ret
+	}
+
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+
+	// The search is case-insensitive and sorted lexicographically.
+	results, err := utxoView.SearchUsernamesByPrefix("AL", 0)
+	require.NoError(err)
+	require.Equal([]string{"alfred", "alice"}, usernames(results))
+	require.Equal(DBGetPKIDForUsername(db, chain.snapshot, []byte("alice")), results[1].PKID)
+
+	// The limit is respected.
+	results, err = utxoView.SearchUsernamesByPrefix("al", 1)
+	require.NoError(err)
+	require.Equal([]string{"alfred"}, usernames(results))
+
+	// Profiles created by the seed txns show up too.
+	results, err = utxoView.SearchUsernamesByPrefix("b", 0)
+	require.NoError(err)
+	require.Equal([]string{"balajis", "bob"}, usernames(results))
+
+	// Prefixes that can't be part of a username match nothing.
+	results, err = utxoView.SearchUsernamesByPrefix("al!", 0)
+	require.NoError(err)
+	require.Empty(results)
+
+	// Deleting a profile in the view hides it from the search, even though it still exists in the DB.
+	alfredProfileEntry := utxoView.GetProfileEntryForUsername([]byte("alfred"))
+	require.NotNil(alfredProfileEntry)
+	utxoView._deleteProfileEntryMappings(alfredProfileEntry)
+	results, err = utxoView.SearchUsernamesByPrefix("al", 1)
+	require.NoError(err)
+	require.Equal([]string{"alice"}, usernames(results))
+
+	// Profiles that only exist in the view are found as well.
+	renamedProfileEntry := *alfredProfileEntry
+	renamedProfileEntry.Username = []byte("Albert")
+	utxoView._setProfileEntryMappings(&renamedProfileEntry)
+	results, err = utxoView.SearchUsernamesByPrefix("al", 0)
+	require.NoError(err)
+	require.Equal([]string{"albert", "alice"}, usernames(results))
+}
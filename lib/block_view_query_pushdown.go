@@ -0,0 +1,225 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Query Pushdown: Some read queries only need the first few entries of a large set in a specific order,
+// e.g. the newest posts, the largest holders of a coin, or the best-priced orders for a DAO coin pair.
+// Badger can only iterate its indexes in key order, so for these we load every entry into Go and sort
+// them in memory. Postgres can evaluate the query itself and only return the entries we need.
+//
+// A data source that can do this implements QueryPushdownBackend. The UtxoView methods below ask the
+// DbAdapter for one and fall back to loading every entry from Badger when there isn't one. Either way the
+// entries in the view take precedence over the ones in the data source, so the results reflect the view.
+//
+// To merge the view into a pushed-down query, we fetch limit + N entries from the data source, where N is
+// the number of entries in the view that could replace one of them. Each of those can push at most one
+// entry out of the results, so the entries we get back always include the first limit entries that the
+// view doesn't touch.
+
+type QueryPushdownBackend interface {
+	// GetTopPostsByTimestamp returns up to limit top-level posts that aren't hidden and have a timestamp
+	// below maxTimestampNanos, newest first.
+	GetTopPostsByTimestamp(maxTimestampNanos uint64, limit int) ([]*PostEntry, error)
+	// GetTopHoldersByBalance returns up to limit BalanceEntries with a non-zero balance of the creator's
+	// coins, largest balance first.
+	GetTopHoldersByBalance(creatorPKID *PKID, isDAOCoin bool, limit int) ([]*BalanceEntry, error)
+	// GetDAOCoinLimitOrdersByPrice returns up to limit orders buying buyingDAOCoinCreatorPKID and selling
+	// sellingDAOCoinCreatorPKID, best-priced first.
+	GetDAOCoinLimitOrdersByPrice(
+		buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID, limit int) ([]*DAOCoinLimitOrderEntry, error)
+}
+
+// GetTopPostsByTimestamp returns up to limit top-level posts that aren't hidden and have a timestamp
+// below maxTimestampNanos, newest first. Pass math.MaxUint64 to start from the newest post.
+func (bav *UtxoView) GetTopPostsByTimestamp(maxTimestampNanos uint64, limit int) ([]*PostEntry, error) {
+	return bav._getTopPostsByTimestamp(bav.GetDbAdapter().GetQueryPushdownBackend(), maxTimestampNanos, limit)
+}
+
+func (bav *UtxoView) _getTopPostsByTimestamp(
+	backend QueryPushdownBackend, maxTimestampNanos uint64, limit int) ([]*PostEntry, error) {
+
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var dbPostEntries []*PostEntry
+	var err error
+	if backend == nil {
+		_, _, dbPostEntries, err = DBGetAllPostsByTstamp(bav.Handle, bav.Snapshot, true)
+	} else {
+		dbPostEntries, err = backend.GetTopPostsByTimestamp(
+			maxTimestampNanos, _getPushdownLimit(limit, len(bav.PostHashToPostEntry)))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetTopPostsByTimestamp: Problem fetching posts: ")
+	}
+
+	var postEntries []*PostEntry
+	for _, postEntry := range dbPostEntries {
+		if _, inView := bav.PostHashToPostEntry[*postEntry.PostHash]; !inView {
+			postEntries = append(postEntries, postEntry)
+		}
+	}
+	for _, postEntry := range bav.PostHashToPostEntry {
+		postEntries = append(postEntries, postEntry)
+	}
+	postEntries = _filterEntries(postEntries, func(postEntry *PostEntry) bool {
+		return !postEntry.isDeleted && !postEntry.IsHidden && len(postEntry.ParentStakeID) == 0 &&
+			postEntry.TimestampNanos < maxTimestampNanos
+	})
+
+	// Newest first, breaking ties by post hash the same way the timestamp index does.
+	sort.Slice(postEntries, func(ii, jj int) bool {
+		if postEntries[ii].TimestampNanos != postEntries[jj].TimestampNanos {
+			return postEntries[ii].TimestampNanos > postEntries[jj].TimestampNanos
+		}
+		return bytes.Compare(postEntries[ii].PostHash[:], postEntries[jj].PostHash[:]) > 0
+	})
+	if len(postEntries) > limit {
+		postEntries = postEntries[:limit]
+	}
+	return postEntries, nil
+}
+
+// GetTopHoldersByBalance returns up to limit BalanceEntries with a non-zero balance of the creator's coins,
+// largest balance first.
+func (bav *UtxoView) GetTopHoldersByBalance(creatorPKID *PKID, isDAOCoin bool, limit int) ([]*BalanceEntry, error) {
+	return bav._getTopHoldersByBalance(bav.GetDbAdapter().GetQueryPushdownBackend(), creatorPKID, isDAOCoin, limit)
+}
+
+func (bav *UtxoView) _getTopHoldersByBalance(
+	backend QueryPushdownBackend, creatorPKID *PKID, isDAOCoin bool, limit int) ([]*BalanceEntry, error) {
+
+	if creatorPKID == nil {
+		return nil, errors.Errorf("GetTopHoldersByBalance: Called with nil creator PKID; this should never happen")
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	viewBalanceEntries := make(map[PKID]*BalanceEntry)
+	for _, balanceEntry := range bav.GetHODLerPKIDCreatorPKIDToBalanceEntryMap(isDAOCoin) {
+		if balanceEntry.CreatorPKID.Eq(creatorPKID) {
+			viewBalanceEntries[*balanceEntry.HODLerPKID] = balanceEntry
+		}
+	}
+
+	var dbBalanceEntries []*BalanceEntry
+	var err error
+	if backend == nil {
+		dbBalanceEntries, err = DbGetBalanceEntriesHodlingYou(bav.Handle, bav.Snapshot, creatorPKID, true, isDAOCoin)
+	} else {
+		dbBalanceEntries, err = backend.GetTopHoldersByBalance(
+			creatorPKID, isDAOCoin, _getPushdownLimit(limit, len(viewBalanceEntries)))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetTopHoldersByBalance: Problem fetching holders: ")
+	}
+
+	var balanceEntries []*BalanceEntry
+	for _, balanceEntry := range dbBalanceEntries {
+		if _, inView := viewBalanceEntries[*balanceEntry.HODLerPKID]; !inView {
+			balanceEntries = append(balanceEntries, balanceEntry)
+		}
+	}
+	for _, balanceEntry := range viewBalanceEntries {
+		balanceEntries = append(balanceEntries, balanceEntry)
+	}
+	balanceEntries = _filterEntries(balanceEntries, func(balanceEntry *BalanceEntry) bool {
+		return !balanceEntry.isDeleted && !balanceEntry.BalanceNanos.IsZero()
+	})
+
+	// Largest balance first, breaking ties by holder PKID.
+	sort.Slice(balanceEntries, func(ii, jj int) bool {
+		if !balanceEntries[ii].BalanceNanos.Eq(&balanceEntries[jj].BalanceNanos) {
+			return balanceEntries[ii].BalanceNanos.Gt(&balanceEntries[jj].BalanceNanos)
+		}
+		return bytes.Compare(balanceEntries[ii].HODLerPKID[:], balanceEntries[jj].HODLerPKID[:]) < 0
+	})
+	if len(balanceEntries) > limit {
+		balanceEntries = balanceEntries[:limit]
+	}
+	return balanceEntries, nil
+}
+
+// GetDAOCoinLimitOrdersByPrice returns up to limit orders buying buyingDAOCoinCreatorPKID and selling
+// sellingDAOCoinCreatorPKID, from the best matching order to the worst.
+func (bav *UtxoView) GetDAOCoinLimitOrdersByPrice(
+	buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID, limit int) ([]*DAOCoinLimitOrderEntry, error) {
+
+	return bav._getDAOCoinLimitOrdersByPrice(
+		bav.GetDbAdapter().GetQueryPushdownBackend(), buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID, limit)
+}
+
+func (bav *UtxoView) _getDAOCoinLimitOrdersByPrice(backend QueryPushdownBackend,
+	buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID, limit int) ([]*DAOCoinLimitOrderEntry, error) {
+
+	if buyingDAOCoinCreatorPKID == nil || sellingDAOCoinCreatorPKID == nil {
+		return nil, errors.Errorf("GetDAOCoinLimitOrdersByPrice: Called with nil coin PKID; this should never happen")
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	// The order book for the pair has every order in the view, including the deleted ones.
+	orderKeysInView := make(map[DAOCoinLimitOrderMapKey]bool)
+	var orderEntries []*DAOCoinLimitOrderEntry
+	if book := bav._getDAOCoinLimitOrderBook(buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID); book != nil {
+		orderKeysInView = book.orderKeysInView
+		for _, orderEntry := range book.ordersByKey {
+			orderEntries = append(orderEntries, orderEntry)
+		}
+	}
+
+	var dbOrderEntries []*DAOCoinLimitOrderEntry
+	var err error
+	if backend == nil {
+		dbOrderEntries, err = DBGetAllDAOCoinLimitOrdersForThisDAOCoinPair(
+			bav.Handle, buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID)
+	} else {
+		dbOrderEntries, err = backend.GetDAOCoinLimitOrdersByPrice(
+			buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID, _getPushdownLimit(limit, len(orderKeysInView)))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDAOCoinLimitOrdersByPrice: Problem fetching orders: ")
+	}
+	for _, orderEntry := range dbOrderEntries {
+		if !orderKeysInView[orderEntry.ToMapKey()] {
+			orderEntries = append(orderEntries, orderEntry)
+		}
+	}
+
+	sort.Slice(orderEntries, func(ii, jj int) bool {
+		return orderEntries[ii].IsBetterMatchingOrderThan(orderEntries[jj])
+	})
+	if len(orderEntries) > limit {
+		orderEntries = orderEntries[:limit]
+	}
+	return orderEntries, nil
+}
+
+// _filterEntries returns the entries for which keep returns true, reusing the entries slice.
+func _filterEntries[T any](entries []T, keep func(entry T) bool) []T {
+	filteredEntries := entries[:0]
+	for _, entry := range entries {
+		if keep(entry) {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
+// _getPushdownLimit returns the number of entries to fetch from a QueryPushdownBackend so that the results
+// can be merged with numEntriesInView entries from the view.
+func _getPushdownLimit(limit int, numEntriesInView int) int {
+	if limit > math.MaxInt32-numEntriesInView {
+		return math.MaxInt32
+	}
+	return limit + numEntriesInView
+}
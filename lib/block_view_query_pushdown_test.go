@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// badgerQueryPushdownBackend answers pushed-down queries from the entries flushed to a Badger DB by
+// sorting them in memory, which lets us check the view merging without Postgres.
+type badgerQueryPushdownBackend struct {
+	db     *badger.DB
+	params *DeSoParams
+}
+
+func (backend *badgerQueryPushdownBackend) GetTopPostsByTimestamp(
+	maxTimestampNanos uint64, limit int) ([]*PostEntry, error) {
+	return NewUtxoView(backend.db, backend.params, nil, nil, nil).
+		_getTopPostsByTimestamp(nil, maxTimestampNanos, limit)
+}
+
+func (backend *badgerQueryPushdownBackend) GetTopHoldersByBalance(
+	creatorPKID *PKID, isDAOCoin bool, limit int) ([]*BalanceEntry, error) {
+	return NewUtxoView(backend.db, backend.params, nil, nil, nil).
+		_getTopHoldersByBalance(nil, creatorPKID, isDAOCoin, limit)
+}
+
+func (backend *badgerQueryPushdownBackend) GetDAOCoinLimitOrdersByPrice(
+	buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID, limit int) ([]*DAOCoinLimitOrderEntry, error) {
+	return NewUtxoView(backend.db, backend.params, nil, nil, nil).
+		_getDAOCoinLimitOrdersByPrice(nil, buyingDAOCoinCreatorPKID, sellingDAOCoinCreatorPKID, limit)
+}
+
+func TestQueryPushdown(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	params := &DeSoTestnetParams
+	backend := &badgerQueryPushdownBackend{db: db, params: params}
+
+	newPost := func(timestampNanos uint64) *PostEntry {
+		return &PostEntry{
+			PostHash:        NewBlockHash(RandomBytes(HashSizeBytes)),
+			PosterPublicKey: m0PkBytes,
+			Body:            []byte("post"),
+			TimestampNanos:  timestampNanos,
+		}
+	}
+	creatorPKID := NewPKID(m0PkBytes)
+	newBalance := func(balanceNanos uint64) *BalanceEntry {
+		return &BalanceEntry{
+			HODLerPKID:   NewPKID(RandomBytes(int32(PublicKeyLenCompressed))),
+			CreatorPKID:  creatorPKID,
+			BalanceNanos: *uint256.NewInt(balanceNanos),
+		}
+	}
+	newOrder := func(scaledExchangeRate uint64, blockHeight uint32) *DAOCoinLimitOrderEntry {
+		return &DAOCoinLimitOrderEntry{
+			OrderID:                   NewBlockHash(RandomBytes(HashSizeBytes)),
+			TransactorPKID:            NewPKID(m1PkBytes),
+			BuyingDAOCoinCreatorPKID:  &ZeroPKID,
+			SellingDAOCoinCreatorPKID: creatorPKID,
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt(scaledExchangeRate),
+			QuantityToFillInBaseUnits:                 uint256.NewInt(100),
+			OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+			FillType:                                  DAOCoinLimitOrderFillTypeGoodTillCancelled,
+			BlockHeight:                               blockHeight,
+		}
+	}
+
+	// Flush some posts, balances, and orders to the DB, including ones that the queries skip.
+	utxoView := NewUtxoView(db, params, nil, nil, nil)
+	var posts []*PostEntry
+	for _, timestampNanos := range []uint64{1, 2, 3, 3, 4, 5, 6} {
+		posts = append(posts, newPost(timestampNanos))
+	}
+	hiddenPost := newPost(7)
+	hiddenPost.IsHidden = true
+	comment := newPost(8)
+	comment.ParentStakeID = posts[0].PostHash.ToBytes()
+	for _, postEntry := range append([]*PostEntry{hiddenPost, comment}, posts...) {
+		utxoView._setPostEntryMappings(postEntry)
+	}
+	var balances []*BalanceEntry
+	for _, balanceNanos := range []uint64{10, 20, 30, 30, 40, 50, 60} {
+		balances = append(balances, newBalance(balanceNanos))
+	}
+	for _, balanceEntry := range append([]*BalanceEntry{newBalance(0)}, balances...) {
+		utxoView._setBalanceEntryMappings(balanceEntry, true)
+	}
+	var orders []*DAOCoinLimitOrderEntry
+	for _, scaledExchangeRate := range []uint64{1, 2, 3, 3, 4, 5} {
+		orders = append(orders, newOrder(scaledExchangeRate, 1))
+	}
+	for _, orderEntry := range append([]*DAOCoinLimitOrderEntry{newOrder(3, 0)}, orders...) {
+		utxoView._setDAOCoinLimitOrderEntryMappings(orderEntry)
+	}
+	require.NoError(utxoView.FlushToDb(0))
+
+	// Change some of them in a new view. Each change moves an entry into or out of the first few results.
+	utxoView = NewUtxoView(db, params, nil, nil, nil)
+	utxoView._deletePostEntryMappings(posts[6])
+	hiddenPostCopy := *posts[5]
+	hiddenPostCopy.IsHidden = true
+	utxoView._setPostEntryMappings(&hiddenPostCopy)
+	utxoView._setPostEntryMappings(newPost(9))
+	utxoView._setPostEntryMappings(newPost(3))
+
+	balanceCopy := *balances[6]
+	balanceCopy.BalanceNanos = *uint256.NewInt(5)
+	utxoView._setBalanceEntryMappings(&balanceCopy, true)
+	utxoView._deleteBalanceEntryMappingsWithPKIDs(balances[5], balances[5].HODLerPKID, creatorPKID, true)
+	utxoView._setBalanceEntryMappings(newBalance(35), true)
+	// Creator coin balances don't show up in DAO coin queries.
+	utxoView._setBalanceEntryMappings(newBalance(100), false)
+
+	utxoView._deleteDAOCoinLimitOrderEntryMappings(orders[5])
+	utxoView._setDAOCoinLimitOrderEntryMappings(newOrder(3, 2))
+	utxoView._setDAOCoinLimitOrderEntryMappings(newOrder(6, 2))
+
+	// The pushed-down queries return the same results as sorting everything in memory.
+	for _, limit := range []int{0, 1, 3, 5, 100} {
+		for _, maxTimestampNanos := range []uint64{math.MaxUint64, 9, 4} {
+			expectedPosts, err := utxoView._getTopPostsByTimestamp(nil, maxTimestampNanos, limit)
+			require.NoError(err)
+			pushedDownPosts, err := utxoView._getTopPostsByTimestamp(backend, maxTimestampNanos, limit)
+			require.NoError(err)
+			require.Equal(expectedPosts, pushedDownPosts)
+		}
+
+		expectedBalances, err := utxoView._getTopHoldersByBalance(nil, creatorPKID, true, limit)
+		require.NoError(err)
+		pushedDownBalances, err := utxoView._getTopHoldersByBalance(backend, creatorPKID, true, limit)
+		require.NoError(err)
+		require.Equal(expectedBalances, pushedDownBalances)
+
+		expectedOrders, err := utxoView._getDAOCoinLimitOrdersByPrice(nil, &ZeroPKID, creatorPKID, limit)
+		require.NoError(err)
+		pushedDownOrders, err := utxoView._getDAOCoinLimitOrdersByPrice(backend, &ZeroPKID, creatorPKID, limit)
+		require.NoError(err)
+		require.Equal(expectedOrders, pushedDownOrders)
+	}
+
+	// Spot check the order of the results.
+	allPosts, err := utxoView._getTopPostsByTimestamp(backend, math.MaxUint64, 100)
+	require.NoError(err)
+	var timestamps []uint64
+	for _, postEntry := range allPosts {
+		timestamps = append(timestamps, postEntry.TimestampNanos)
+	}
+	require.Equal([]uint64{9, 4, 3, 3, 3, 2, 1}, timestamps)
+
+	topBalances, err := utxoView._getTopHoldersByBalance(backend, creatorPKID, true, 3)
+	require.NoError(err)
+	var balanceAmounts []uint64
+	for _, balanceEntry := range topBalances {
+		balanceAmounts = append(balanceAmounts, balanceEntry.BalanceNanos.Uint64())
+	}
+	require.Equal([]uint64{40, 35, 30}, balanceAmounts)
+
+	topOrders, err := utxoView._getDAOCoinLimitOrdersByPrice(backend, &ZeroPKID, creatorPKID, 5)
+	require.NoError(err)
+	var exchangeRates []uint64
+	var blockHeights []uint32
+	for _, orderEntry := range topOrders {
+		exchangeRates = append(exchangeRates, orderEntry.ScaledExchangeRateCoinsToSellPerCoinToBuy.Uint64())
+		blockHeights = append(blockHeights, orderEntry.BlockHeight)
+	}
+	require.Equal([]uint64{6, 4, 3, 3, 3}, exchangeRates)
+	require.Equal([]uint32{2, 1, 0, 1, 1}, blockHeights)
+}
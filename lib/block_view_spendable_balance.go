@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"bytes"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/pkg/errors"
+)
+
+// Spendable Balances: A public key's DESO balance includes the block rewards it was paid recently, which
+// consensus doesn't let it spend until they mature, and leaves out the DESO it has staked or unstaked but not
+// unlocked yet. Wallets that only show the balance end up showing DESO as available that the public key can't
+// spend. GetSpendableBalanceForPublicKey returns all of these amounts in one call.
+//
+// Before the cut-over to Proof of Stake, the maturity of block rewards is defined by the BlockRewardMaturity
+// param, see GetImmatureBlockRewardNanosForPublicKey. After the cut-over, it's the BlockRewardMaturityBlocks
+// global param, which the ParamUpdater can set starting at the BlockRewardMaturityParamsBlockHeight. It
+// defaults to 0, which means that block rewards can be spent as soon as they're paid out.
+
+type SpendableBalance struct {
+	// BalanceNanos is the DESO balance of the public key, including its immature block rewards.
+	BalanceNanos uint64
+	// ImmatureBlockRewardNanos is the part of BalanceNanos that was paid out as block rewards that
+	// haven't matured yet.
+	ImmatureBlockRewardNanos uint64
+	// SpendableBalanceNanos is BalanceNanos minus ImmatureBlockRewardNanos.
+	SpendableBalanceNanos uint64
+	// StakedNanos is the DESO the public key has staked with validators. It isn't part of BalanceNanos.
+	StakedNanos uint64
+	// LockedStakeNanos is the DESO the public key has unstaked but not unlocked yet. It isn't part of
+	// BalanceNanos.
+	LockedStakeNanos uint64
+}
+
+// GetSpendableBalanceForPublicKey returns the balance of the public key, broken down into what it can and
+// can't spend, as of the provided tip height. Computing the staked amounts scans every StakeEntry and
+// LockedStakeEntry, so this is meant for queries and shouldn't be called when connecting transactions.
+func (bav *UtxoView) GetSpendableBalanceForPublicKey(pkBytes []byte, atHeight uint32) (*SpendableBalance, error) {
+	balanceNanos, err := bav.GetDeSoBalanceNanosForPublicKey(pkBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetSpendableBalanceForPublicKey: ")
+	}
+	immatureBlockRewardNanos, err := bav.GetImmatureBlockRewardNanosForPublicKey(pkBytes, atHeight)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetSpendableBalanceForPublicKey: ")
+	}
+	spendableBalanceNanos, err := SafeUint64().Sub(balanceNanos, immatureBlockRewardNanos)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetSpendableBalanceForPublicKey: Immature block rewards (%d) exceed "+
+			"balance (%d)", immatureBlockRewardNanos, balanceNanos)
+	}
+	spendableBalance := &SpendableBalance{
+		BalanceNanos:             balanceNanos,
+		ImmatureBlockRewardNanos: immatureBlockRewardNanos,
+		SpendableBalanceNanos:    spendableBalanceNanos,
+	}
+
+	// Stakes are keyed by PKID. A deleted PKID entry can't have any stakes left.
+	pkidEntry := bav.GetPKIDForPublicKey(pkBytes)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return spendableBalance, nil
+	}
+	stakeEntries, err := bav.GetStakeEntriesForStakerPKID(pkidEntry.PKID)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetSpendableBalanceForPublicKey: Problem getting StakeEntries: ")
+	}
+	for _, stakeEntry := range stakeEntries {
+		spendableBalance.StakedNanos, err = _addUint256ToDeSoNanos(
+			spendableBalance.StakedNanos, stakeEntry.StakeAmountNanos)
+		if err != nil {
+			return nil, errors.Wrap(err, "GetSpendableBalanceForPublicKey: Problem adding StakeAmountNanos: ")
+		}
+	}
+	lockedStakeEntries, err := bav.GetLockedStakeEntriesForStakerPKID(pkidEntry.PKID)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetSpendableBalanceForPublicKey: Problem getting LockedStakeEntries: ")
+	}
+	for _, lockedStakeEntry := range lockedStakeEntries {
+		spendableBalance.LockedStakeNanos, err = _addUint256ToDeSoNanos(
+			spendableBalance.LockedStakeNanos, lockedStakeEntry.LockedAmountNanos)
+		if err != nil {
+			return nil, errors.Wrap(err, "GetSpendableBalanceForPublicKey: Problem adding LockedAmountNanos: ")
+		}
+	}
+	return spendableBalance, nil
+}
+
+func _addUint256ToDeSoNanos(nanos uint64, amount *uint256.Int) (uint64, error) {
+	if amount == nil {
+		return nanos, nil
+	}
+	if !amount.IsUint64() {
+		return 0, errors.Errorf("_addUint256ToDeSoNanos: Amount %v overflows uint64", amount)
+	}
+	return SafeUint64().Add(nanos, amount.Uint64())
+}
+
+// _getImmatureBlockRewardNanosForPublicKeyPoS sums the block rewards paid to the public key in the last
+// BlockRewardMaturityBlocks blocks, counting back from the tip of the view. Those rewards can't be spent yet.
+func (bav *UtxoView) _getImmatureBlockRewardNanosForPublicKeyPoS(pkBytes []byte, tipHeight uint32) (uint64, error) {
+	if tipHeight < bav.Params.ForkHeights.BlockRewardMaturityParamsBlockHeight {
+		return 0, nil
+	}
+	numImmatureBlocks := bav.GetCurrentGlobalParamsEntry().BlockRewardMaturityBlocks
+	immatureBlockRewards := uint64(0)
+	nextBlockHash := bav.TipHash
+	for ii := uint64(0); ii < numImmatureBlocks; ii++ {
+		// Don't look up the genesis block since it isn't in the DB.
+		if nextBlockHash == nil || nextBlockHash.String() == bav.Params.GenesisBlockHashHex {
+			break
+		}
+		block, err := GetBlock(nextBlockHash, bav.Handle, bav.Snapshot)
+		if err != nil {
+			return 0, errors.Wrapf(err, "_getImmatureBlockRewardNanosForPublicKeyPoS: Problem getting block %v",
+				nextBlockHash)
+		}
+		if len(block.Txns) > 0 && block.Txns[0].TxnMeta.GetTxnType() == TxnTypeBlockReward {
+			for _, output := range block.Txns[0].TxOutputs {
+				if !bytes.Equal(output.PublicKey, pkBytes) {
+					continue
+				}
+				immatureBlockRewards, err = SafeUint64().Add(immatureBlockRewards, output.AmountNanos)
+				if err != nil {
+					return 0, errors.Wrapf(err, "_getImmatureBlockRewardNanosForPublicKeyPoS: Problem adding "+
+						"block reward (%d) to immature block rewards (%d)", output.AmountNanos, immatureBlockRewards)
+				}
+			}
+		}
+		nextBlockHash = block.Header.PrevBlockHash
+	}
+	return immatureBlockRewards, nil
+}
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSpendableBalanceForPublicKey(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+
+	// Mine a few blocks to pay block rewards to the sender.
+	var blocks []*MsgDeSoBlock
+	for ii := 0; ii < 5; ii++ {
+		block, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+		blocks = append(blocks, block)
+	}
+	tipHeight := chain.blockTip().Height
+
+	{
+		// Before the cut-over to PoS, the spendable balance matches GetSpendableDeSoBalanceNanosForPublicKey.
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		spendableBalance, err := utxoView.GetSpendableBalanceForPublicKey(senderPkBytes, tipHeight)
+		require.NoError(err)
+		balanceNanos, err := utxoView.GetDeSoBalanceNanosForPublicKey(senderPkBytes)
+		require.NoError(err)
+		spendableBalanceNanos, err := utxoView.GetSpendableDeSoBalanceNanosForPublicKey(senderPkBytes, tipHeight)
+		require.NoError(err)
+		require.Equal(balanceNanos, spendableBalance.BalanceNanos)
+		require.Equal(spendableBalanceNanos, spendableBalance.SpendableBalanceNanos)
+		require.Equal(balanceNanos-spendableBalanceNanos, spendableBalance.ImmatureBlockRewardNanos)
+		require.Zero(spendableBalance.StakedNanos)
+		require.Zero(spendableBalance.LockedStakeNanos)
+	}
+	{
+		// After the cut-over to PoS, the block rewards of the last BlockRewardMaturityBlocks blocks are immature.
+		params.ForkHeights.BlockRewardMaturityParamsBlockHeight = 0
+		defer func() {
+			params.ForkHeights.BlockRewardMaturityParamsBlockHeight = uint32(math.MaxUint32)
+		}()
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		immatureBlockRewardNanos, err := utxoView._getImmatureBlockRewardNanosForPublicKeyPoS(senderPkBytes, tipHeight)
+		require.NoError(err)
+		require.Zero(immatureBlockRewardNanos)
+
+		utxoView.GlobalParamsEntry.BlockRewardMaturityBlocks = 3
+		expectedImmatureBlockRewardNanos := uint64(0)
+		for _, block := range blocks[len(blocks)-3:] {
+			for _, output := range block.Txns[0].TxOutputs {
+				expectedImmatureBlockRewardNanos += output.AmountNanos
+			}
+		}
+		require.NotZero(expectedImmatureBlockRewardNanos)
+		immatureBlockRewardNanos, err = utxoView._getImmatureBlockRewardNanosForPublicKeyPoS(senderPkBytes, tipHeight)
+		require.NoError(err)
+		require.Equal(expectedImmatureBlockRewardNanos, immatureBlockRewardNanos)
+
+		// Walking back further than the chain is long stops at the genesis block.
+		utxoView.GlobalParamsEntry.BlockRewardMaturityBlocks = MaxBlockRewardMaturityBlocks
+		_, err = utxoView._getImmatureBlockRewardNanosForPublicKeyPoS(senderPkBytes, tipHeight)
+		require.NoError(err)
+	}
+	{
+		// Staked and locked stake amounts are summed across validators, from both the db and the view.
+		senderPKID := NewPKID(senderPkBytes)
+		m0PKID := NewPKID(m0PkBytes)
+		m1PKID := NewPKID(m1PkBytes)
+		utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		utxoView._setStakeEntryMappings(&StakeEntry{
+			StakerPKID: senderPKID, ValidatorPKID: m0PKID, StakeAmountNanos: uint256.NewInt(100),
+		})
+		utxoView._setStakeEntryMappings(&StakeEntry{
+			StakerPKID: m1PKID, ValidatorPKID: m0PKID, StakeAmountNanos: uint256.NewInt(1000),
+		})
+		utxoView._setLockedStakeEntryMappings(&LockedStakeEntry{
+			StakerPKID: senderPKID, ValidatorPKID: m0PKID, LockedAmountNanos: uint256.NewInt(10),
+			LockedAtEpochNumber: 1,
+		})
+		require.NoError(utxoView.FlushToDb(uint64(tipHeight)))
+
+		utxoView = NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+		utxoView._setStakeEntryMappings(&StakeEntry{
+			StakerPKID: senderPKID, ValidatorPKID: m1PKID, StakeAmountNanos: uint256.NewInt(200),
+		})
+		utxoView._setLockedStakeEntryMappings(&LockedStakeEntry{
+			StakerPKID: senderPKID, ValidatorPKID: m0PKID, LockedAmountNanos: uint256.NewInt(20),
+			LockedAtEpochNumber: 2,
+		})
+		spendableBalance, err := utxoView.GetSpendableBalanceForPublicKey(senderPkBytes, tipHeight)
+		require.NoError(err)
+		require.Equal(uint64(300), spendableBalance.StakedNanos)
+		require.Equal(uint64(30), spendableBalance.LockedStakeNanos)
+
+		stakeEntries, err := utxoView.GetStakeEntriesForStakerPKID(senderPKID)
+		require.NoError(err)
+		require.Len(stakeEntries, 2)
+		lockedStakeEntries, err := utxoView.GetLockedStakeEntriesForStakerPKID(senderPKID)
+		require.NoError(err)
+		require.Len(lockedStakeEntries, 2)
+		require.Equal(uint64(1), lockedStakeEntries[0].LockedAtEpochNumber)
+	}
+}
@@ -33,6 +33,10 @@ import (
 // TYPES: StakeEntry
 //
 
+// StakingRewardMethod determines what happens to a stake's rewards when they're distributed at the end of an
+// epoch. With StakingRewardMethodRestake, the rewards are added to the StakeEntry's StakeAmountNanos, so they
+// compound without the staker having to claim and restake them. A staker can switch methods at any time with a
+// Stake transaction that stakes zero DESO to the same validator.
 type StakingRewardMethod = uint8
 
 const (
@@ -673,6 +677,34 @@ func DBGetStakeEntriesForValidatorPKID(handle *badger.DB, snap *Snapshot, valida
 	return stakeEntries, nil
 }
 
+// DBGetStakeEntriesForStakerPKID fetches the StakeEntries of a staker across all validators. StakeEntries
+// aren't indexed by staker, so this scans every StakeEntry in the db. It's meant for queries, and
+// shouldn't be called when connecting transactions.
+func DBGetStakeEntriesForStakerPKID(handle *badger.DB, snap *Snapshot, stakerPKID *PKID) ([]*StakeEntry, error) {
+	// Retrieve StakeEntries from db.
+	prefix := append([]byte{}, Prefixes.PrefixStakeByValidatorAndStaker...)
+	_, valsFound, err := EnumerateKeysForPrefixWithLimitOffsetOrder(
+		handle, prefix, 0, nil, false, NewSet([]string{}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetStakeEntriesForStakerPKID: problem retrieving StakeEntries: ")
+	}
+
+	// Decode StakeEntries from bytes, keeping the ones for this staker.
+	var stakeEntries []*StakeEntry
+	for _, stakeEntryBytes := range valsFound {
+		rr := bytes.NewReader(stakeEntryBytes)
+		stakeEntry, err := DecodeDeSoEncoder(&StakeEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetStakeEntriesForStakerPKID: problem decoding StakeEntry: ")
+		}
+		if stakeEntry.StakerPKID.Eq(stakerPKID) {
+			stakeEntries = append(stakeEntries, stakeEntry)
+		}
+	}
+	return stakeEntries, nil
+}
+
 func DBGetTopStakesForValidatorsByStakeAmount(
 	handle *badger.DB,
 	snap *Snapshot,
@@ -853,6 +885,41 @@ func DBGetLockedStakeEntriesInRange(
 	return ret, err
 }
 
+// DBGetLockedStakeEntriesForStakerPKID fetches the LockedStakeEntries of a staker across all validators.
+// Like DBGetStakeEntriesForStakerPKID, this scans every LockedStakeEntry in the db.
+func DBGetLockedStakeEntriesForStakerPKID(
+	handle *badger.DB,
+	snap *Snapshot,
+	stakerPKID *PKID,
+) ([]*LockedStakeEntry, error) {
+	// Retrieve LockedStakeEntries from db.
+	prefix := append([]byte{}, Prefixes.PrefixLockedStakeByValidatorAndStakerAndLockedAt...)
+	_, valsFound, err := EnumerateKeysForPrefixWithLimitOffsetOrder(
+		handle, prefix, 0, nil, false, NewSet([]string{}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "DBGetLockedStakeEntriesForStakerPKID: problem retrieving LockedStakeEntries: ",
+		)
+	}
+
+	// Decode LockedStakeEntries from bytes, keeping the ones for this staker.
+	var lockedStakeEntries []*LockedStakeEntry
+	for _, lockedStakeEntryBytes := range valsFound {
+		rr := bytes.NewReader(lockedStakeEntryBytes)
+		lockedStakeEntry, err := DecodeDeSoEncoder(&LockedStakeEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "DBGetLockedStakeEntriesForStakerPKID: problem decoding LockedStakeEntry: ",
+			)
+		}
+		if lockedStakeEntry.StakerPKID.Eq(stakerPKID) {
+			lockedStakeEntries = append(lockedStakeEntries, lockedStakeEntry)
+		}
+	}
+	return lockedStakeEntries, nil
+}
+
 func DBGetLockedStakeEntriesInRangeWithTxn(
 	txn *badger.Txn,
 	snap *Snapshot,
@@ -1488,14 +1555,17 @@ func (bav *UtxoView) _disconnectStake(
 		return fmt.Errorf("_disconnectStake: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	operationData := utxoOpsForTxn[operationIndex]
-	if operationData.Type != OperationTypeStake {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeStake {
 		return fmt.Errorf(
 			"_disconnectStake: trying to revert %v but found %v",
 			OperationTypeStake,
-			operationData.Type,
+			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
+	operationData, err := GetUtxoOperationData[StakeOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectStake: ")
+	}
 	txMeta := currentTxn.TxnMeta.(*StakeMetadata)
 
 	// Convert TransactorPublicKey to TransactorPKID.
@@ -1745,14 +1815,17 @@ func (bav *UtxoView) _disconnectUnstake(
 		return fmt.Errorf("_disconnectUnstake: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	operationData := utxoOpsForTxn[operationIndex]
-	if operationData.Type != OperationTypeUnstake {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeUnstake {
 		return fmt.Errorf(
 			"_disconnectUnstake: trying to revert %v but found %v",
 			OperationTypeUnstake,
-			operationData.Type,
+			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
+	operationData, err := GetUtxoOperationData[UnstakeOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUnstake: ")
+	}
 	txMeta := currentTxn.TxnMeta.(*UnstakeMetadata)
 
 	// Convert TransactorPublicKey to TransactorPKID.
@@ -1982,14 +2055,17 @@ func (bav *UtxoView) _disconnectUnlockStake(
 		return fmt.Errorf("_disconnectUnlockStake: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	operationData := utxoOpsForTxn[operationIndex]
-	if operationData.Type != OperationTypeUnlockStake {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeUnlockStake {
 		return fmt.Errorf(
 			"_disconnectUnlockStake: trying to revert %v but found %v",
 			OperationTypeUnlockStake,
-			operationData.Type,
+			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
+	operationData, err := GetUtxoOperationData[UnlockStakeOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUnlockStake: ")
+	}
 
 	// Convert TransactorPublicKey to TransactorPKID.
 	transactorPKIDEntry := bav.GetPKIDForPublicKey(currentTxn.PublicKey)
@@ -1999,7 +2075,6 @@ func (bav *UtxoView) _disconnectUnlockStake(
 
 	// Calculate the TotalUnlockedAmountNanos.
 	totalUnlockedAmountNanos := uint256.NewInt(0)
-	var err error
 	for _, prevLockedStakeEntry := range operationData.PrevLockedStakeEntries {
 		totalUnlockedAmountNanos, err = SafeUint256().Add(
 			totalUnlockedAmountNanos, prevLockedStakeEntry.LockedAmountNanos,
@@ -2496,6 +2571,45 @@ func (bav *UtxoView) GetStakeEntriesForValidatorPKID(validatorPKID *PKID) ([]*St
 	return stakeEntries, nil
 }
 
+// GetStakeEntriesForStakerPKID fetches the StakeEntries of a staker across all validators. It scans every
+// StakeEntry in the db, see DBGetStakeEntriesForStakerPKID.
+func (bav *UtxoView) GetStakeEntriesForStakerPKID(stakerPKID *PKID) ([]*StakeEntry, error) {
+	// Validate inputs.
+	if stakerPKID == nil {
+		return nil, errors.New("UtxoView.GetStakeEntriesForStakerPKID: nil StakerPKID provided as input")
+	}
+
+	// First, pull matching StakeEntries from the database and cache them in the UtxoView.
+	dbStakeEntries, err := DBGetStakeEntriesForStakerPKID(bav.Handle, bav.Snapshot, stakerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetStakeEntriesForStakerPKID: error retrieving StakeEntries from the db: ")
+	}
+	for _, stakeEntry := range dbStakeEntries {
+		// Cache results in the UtxoView.
+		if _, exists := bav.StakeMapKeyToStakeEntry[stakeEntry.ToMapKey()]; !exists {
+			bav._setStakeEntryMappings(stakeEntry)
+		}
+	}
+
+	// Then, pull matching StakeEntries from the UtxoView.
+	var stakeEntries []*StakeEntry
+	for _, stakeEntry := range bav.StakeMapKeyToStakeEntry {
+		if !stakeEntry.StakerPKID.Eq(stakerPKID) || stakeEntry.isDeleted {
+			continue
+		}
+		stakeEntries = append(stakeEntries, stakeEntry)
+	}
+
+	// Sort by ValidatorPKID so that the ordering is deterministic.
+	sort.Slice(stakeEntries, func(ii, jj int) bool {
+		return bytes.Compare(
+			stakeEntries[ii].ValidatorPKID.ToBytes(),
+			stakeEntries[jj].ValidatorPKID.ToBytes(),
+		) < 0
+	})
+	return stakeEntries, nil
+}
+
 // GetTopStakesForValidatorsByStakeAmount fetches the top n StakeEntries sorted by stake amount for
 // the given validators. The validatorPKIDs and limit parameters are strictly respected. If either has
 // 0 size, then no StakeEntries are returned.
@@ -2712,6 +2826,48 @@ func (bav *UtxoView) GetLockedStakeEntriesInRange(
 	return lockedStakeEntries, nil
 }
 
+// GetLockedStakeEntriesForStakerPKID fetches the LockedStakeEntries of a staker across all validators. It
+// scans every LockedStakeEntry in the db, see DBGetLockedStakeEntriesForStakerPKID.
+func (bav *UtxoView) GetLockedStakeEntriesForStakerPKID(stakerPKID *PKID) ([]*LockedStakeEntry, error) {
+	// Validate inputs.
+	if stakerPKID == nil {
+		return nil, errors.New("UtxoView.GetLockedStakeEntriesForStakerPKID: nil StakerPKID provided as input")
+	}
+
+	// First, pull matching LockedStakeEntries from the db and cache them in the UtxoView.
+	dbLockedStakeEntries, err := DBGetLockedStakeEntriesForStakerPKID(bav.Handle, bav.Snapshot, stakerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetLockedStakeEntriesForStakerPKID: ")
+	}
+	for _, lockedStakeEntry := range dbLockedStakeEntries {
+		// Cache results in the UtxoView.
+		if _, exists := bav.LockedStakeMapKeyToLockedStakeEntry[lockedStakeEntry.ToMapKey()]; !exists {
+			bav._setLockedStakeEntryMappings(lockedStakeEntry)
+		}
+	}
+
+	// Then, pull matching LockedStakeEntries from the UtxoView.
+	var lockedStakeEntries []*LockedStakeEntry
+	for _, lockedStakeEntry := range bav.LockedStakeMapKeyToLockedStakeEntry {
+		if !lockedStakeEntry.StakerPKID.Eq(stakerPKID) || lockedStakeEntry.isDeleted {
+			continue
+		}
+		lockedStakeEntries = append(lockedStakeEntries, lockedStakeEntry)
+	}
+
+	// Sort LockedStakeEntries by ValidatorPKID, then LockedAtEpochNumber ASC.
+	sort.Slice(lockedStakeEntries, func(ii, jj int) bool {
+		if cmp := bytes.Compare(
+			lockedStakeEntries[ii].ValidatorPKID.ToBytes(),
+			lockedStakeEntries[jj].ValidatorPKID.ToBytes(),
+		); cmp != 0 {
+			return cmp < 0
+		}
+		return lockedStakeEntries[ii].LockedAtEpochNumber < lockedStakeEntries[jj].LockedAtEpochNumber
+	})
+	return lockedStakeEntries, nil
+}
+
 func (bav *UtxoView) _setStakeEntryMappings(stakeEntry *StakeEntry) {
 	// This function shouldn't be called with nil.
 	if stakeEntry == nil {
@@ -0,0 +1,1021 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Subscriptions: Lets an account authorize a recipient to pull recurring payments of DESO or of a DAO
+// coin from it, e.g. to bill for a membership, without handing the recipient a derived key. The
+// subscriber creates the authorization with a Subscription transaction, which stores a SubscriptionEntry
+// with the coin, the most the recipient may claim in each period, the length of a period in blocks, and,
+// optionally, an expiration height. Periods are counted from the height at which the subscription was
+// created. The recipient then claims payments with Subscription transactions of its own, in as many
+// claims per period as it likes, as long as their sum doesn't exceed the max for the period. Amounts
+// that aren't claimed in a period don't roll over into the next one.
+//
+// Either the subscriber or the recipient can cancel the subscription, which deletes the entry. Creating
+// a subscription to a recipient that the subscriber is already subscribed to replaces the subscription,
+// and starts its periods over. Claims are paid from the subscriber's balance at the time of the claim, so
+// a claim fails if the subscriber no longer holds enough of the coin.
+
+//
+// TYPES: SubscriptionMetadata
+//
+
+type SubscriptionOperationType uint8
+
+const (
+	SubscriptionOperationTypeUnknown SubscriptionOperationType = 0
+	SubscriptionOperationTypeCreate  SubscriptionOperationType = 1
+	SubscriptionOperationTypeCancel  SubscriptionOperationType = 2
+	SubscriptionOperationTypeClaim   SubscriptionOperationType = 3
+)
+
+func (operationType SubscriptionOperationType) String() string {
+	switch operationType {
+	case SubscriptionOperationTypeCreate:
+		return "Create"
+	case SubscriptionOperationTypeCancel:
+		return "Cancel"
+	case SubscriptionOperationTypeClaim:
+		return "Claim"
+	default:
+		return "Unknown"
+	}
+}
+
+type SubscriptionMetadata struct {
+	OperationType SubscriptionOperationType
+	// The account that pays and the account that's paid. The transactor must be the subscriber to
+	// create a subscription, the recipient to claim a payment, and either of them to cancel it.
+	SubscriberPublicKey []byte
+	RecipientPublicKey  []byte
+	// DAOCoinCreatorPublicKey, MaxAmountPerPeriodBaseUnits, PeriodBlocks, and ExpirationBlockHeight are
+	// only set when creating a subscription. The subscription is paid in DESO if DAOCoinCreatorPublicKey
+	// is the ZeroPublicKey, and in the creator's DAO coin otherwise. The subscription doesn't expire if
+	// ExpirationBlockHeight is zero.
+	DAOCoinCreatorPublicKey     []byte
+	MaxAmountPerPeriodBaseUnits *uint256.Int
+	PeriodBlocks                uint64
+	ExpirationBlockHeight       uint64
+	// AmountBaseUnits is only set when claiming a payment.
+	AmountBaseUnits *uint256.Int
+}
+
+func (txnData *SubscriptionMetadata) GetTxnType() TxnType {
+	return TxnTypeSubscription
+}
+
+func (txnData *SubscriptionMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, byte(txnData.OperationType))
+	data = append(data, EncodeByteArray(txnData.SubscriberPublicKey)...)
+	data = append(data, EncodeByteArray(txnData.RecipientPublicKey)...)
+	data = append(data, EncodeByteArray(txnData.DAOCoinCreatorPublicKey)...)
+	data = append(data, VariableEncodeUint256(txnData.MaxAmountPerPeriodBaseUnits)...)
+	data = append(data, UintToBuf(txnData.PeriodBlocks)...)
+	data = append(data, UintToBuf(txnData.ExpirationBlockHeight)...)
+	data = append(data, VariableEncodeUint256(txnData.AmountBaseUnits)...)
+	return data, nil
+}
+
+func (txnData *SubscriptionMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	// OperationType
+	operationType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading OperationType: ")
+	}
+	txnData.OperationType = SubscriptionOperationType(operationType)
+
+	// SubscriberPublicKey
+	if txnData.SubscriberPublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading SubscriberPublicKey: ")
+	}
+
+	// RecipientPublicKey
+	if txnData.RecipientPublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading RecipientPublicKey: ")
+	}
+
+	// DAOCoinCreatorPublicKey
+	if txnData.DAOCoinCreatorPublicKey, err = DecodeByteArray(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading DAOCoinCreatorPublicKey: ")
+	}
+
+	// MaxAmountPerPeriodBaseUnits
+	if txnData.MaxAmountPerPeriodBaseUnits, err = VariableDecodeUint256(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading MaxAmountPerPeriodBaseUnits: ")
+	}
+
+	// PeriodBlocks
+	if txnData.PeriodBlocks, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading PeriodBlocks: ")
+	}
+
+	// ExpirationBlockHeight
+	if txnData.ExpirationBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading ExpirationBlockHeight: ")
+	}
+
+	// AmountBaseUnits
+	if txnData.AmountBaseUnits, err = VariableDecodeUint256(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionMetadata.FromBytes: Problem reading AmountBaseUnits: ")
+	}
+
+	return nil
+}
+
+func (txnData *SubscriptionMetadata) New() DeSoTxnMetadata {
+	return &SubscriptionMetadata{}
+}
+
+func (txnData *SubscriptionMetadata) isDESO() bool {
+	return bytes.Equal(txnData.DAOCoinCreatorPublicKey, ZeroPublicKey.ToBytes())
+}
+
+//
+// TYPES: SubscriptionEntry
+//
+
+type SubscriptionEntry struct {
+	// The RecipientPKID and the SubscriberPKID together are the primary key for a SubscriptionEntry.
+	RecipientPKID  *PKID
+	SubscriberPKID *PKID
+	// The ZeroPKID if the subscription is paid in DESO.
+	DAOCoinCreatorPKID          *PKID
+	MaxAmountPerPeriodBaseUnits *uint256.Int
+	PeriodBlocks                uint64
+	// The height the subscription was created at, which the periods are counted from.
+	StartBlockHeight uint64
+	// The recipient can't claim payments at or after this height. Zero means the subscription doesn't
+	// expire.
+	ExpirationBlockHeight uint64
+	// The period of the most recent claim, and the sum of the claims in it.
+	ClaimedPeriodIndex     uint64
+	ClaimedAmountBaseUnits *uint256.Int
+	isDeleted              bool
+}
+
+type SubscriptionKey struct {
+	RecipientPKID  PKID
+	SubscriberPKID PKID
+}
+
+func (entry *SubscriptionEntry) Copy() *SubscriptionEntry {
+	return &SubscriptionEntry{
+		RecipientPKID:               entry.RecipientPKID.NewPKID(),
+		SubscriberPKID:              entry.SubscriberPKID.NewPKID(),
+		DAOCoinCreatorPKID:          entry.DAOCoinCreatorPKID.NewPKID(),
+		MaxAmountPerPeriodBaseUnits: entry.MaxAmountPerPeriodBaseUnits.Clone(),
+		PeriodBlocks:                entry.PeriodBlocks,
+		StartBlockHeight:            entry.StartBlockHeight,
+		ExpirationBlockHeight:       entry.ExpirationBlockHeight,
+		ClaimedPeriodIndex:          entry.ClaimedPeriodIndex,
+		ClaimedAmountBaseUnits:      entry.ClaimedAmountBaseUnits.Clone(),
+		isDeleted:                   entry.isDeleted,
+	}
+}
+
+func (entry *SubscriptionEntry) ToMapKey() SubscriptionKey {
+	return SubscriptionKey{
+		RecipientPKID:  *entry.RecipientPKID,
+		SubscriberPKID: *entry.SubscriberPKID,
+	}
+}
+
+func (entry *SubscriptionEntry) IsDESO() bool {
+	return entry.DAOCoinCreatorPKID.IsZeroPKID()
+}
+
+// IsActiveAtBlockHeight returns true if the subscription hasn't expired at the block height.
+func (entry *SubscriptionEntry) IsActiveAtBlockHeight(blockHeight uint64) bool {
+	return entry.ExpirationBlockHeight == 0 || blockHeight < entry.ExpirationBlockHeight
+}
+
+// GetPeriodIndex returns the index of the period that the block height falls in.
+func (entry *SubscriptionEntry) GetPeriodIndex(blockHeight uint64) uint64 {
+	if blockHeight < entry.StartBlockHeight || entry.PeriodBlocks == 0 {
+		return 0
+	}
+	return (blockHeight - entry.StartBlockHeight) / entry.PeriodBlocks
+}
+
+// GetClaimableAmountBaseUnits returns how much more the recipient can claim in the period that the
+// block height falls in. It's zero if the subscription has expired.
+func (entry *SubscriptionEntry) GetClaimableAmountBaseUnits(blockHeight uint64) *uint256.Int {
+	if !entry.IsActiveAtBlockHeight(blockHeight) {
+		return uint256.NewInt(0)
+	}
+	// Only the claims in the current period count against its max.
+	claimedAmount := uint256.NewInt(0)
+	if entry.GetPeriodIndex(blockHeight) == entry.ClaimedPeriodIndex {
+		claimedAmount = entry.ClaimedAmountBaseUnits
+	}
+	if claimedAmount.Gt(entry.MaxAmountPerPeriodBaseUnits) {
+		return uint256.NewInt(0)
+	}
+	return uint256.NewInt(0).Sub(entry.MaxAmountPerPeriodBaseUnits, claimedAmount)
+}
+
+func (entry *SubscriptionEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeToBytes(blockHeight, entry.RecipientPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.SubscriberPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.DAOCoinCreatorPKID, skipMetadata...)...)
+	data = append(data, VariableEncodeUint256(entry.MaxAmountPerPeriodBaseUnits)...)
+	data = append(data, UintToBuf(entry.PeriodBlocks)...)
+	data = append(data, UintToBuf(entry.StartBlockHeight)...)
+	data = append(data, UintToBuf(entry.ExpirationBlockHeight)...)
+	data = append(data, UintToBuf(entry.ClaimedPeriodIndex)...)
+	data = append(data, VariableEncodeUint256(entry.ClaimedAmountBaseUnits)...)
+	return data
+}
+
+func (entry *SubscriptionEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// RecipientPKID
+	if entry.RecipientPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading RecipientPKID: ")
+	}
+
+	// SubscriberPKID
+	if entry.SubscriberPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading SubscriberPKID: ")
+	}
+
+	// DAOCoinCreatorPKID
+	if entry.DAOCoinCreatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading DAOCoinCreatorPKID: ")
+	}
+
+	// MaxAmountPerPeriodBaseUnits
+	if entry.MaxAmountPerPeriodBaseUnits, err = VariableDecodeUint256(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading MaxAmountPerPeriodBaseUnits: ")
+	}
+
+	// PeriodBlocks
+	if entry.PeriodBlocks, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading PeriodBlocks: ")
+	}
+
+	// StartBlockHeight
+	if entry.StartBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading StartBlockHeight: ")
+	}
+
+	// ExpirationBlockHeight
+	if entry.ExpirationBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading ExpirationBlockHeight: ")
+	}
+
+	// ClaimedPeriodIndex
+	if entry.ClaimedPeriodIndex, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading ClaimedPeriodIndex: ")
+	}
+
+	// ClaimedAmountBaseUnits
+	if entry.ClaimedAmountBaseUnits, err = VariableDecodeUint256(rr); err != nil {
+		return errors.Wrapf(err, "SubscriptionEntry.Decode: Problem reading ClaimedAmountBaseUnits: ")
+	}
+
+	return nil
+}
+
+func (entry *SubscriptionEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *SubscriptionEntry) GetEncoderType() EncoderType {
+	return EncoderTypeSubscriptionEntry
+}
+
+func (entry *SubscriptionEntry) IsDeleted() bool {
+	return entry.isDeleted
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForSubscription(recipientPKID *PKID, subscriberPKID *PKID) []byte {
+	key := DBPrefixKeyForSubscriptionsByRecipient(recipientPKID)
+	key = append(key, subscriberPKID.ToBytes()...)
+	return key
+}
+
+func DBPrefixKeyForSubscriptionsByRecipient(recipientPKID *PKID) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixSubscriptionByRecipientPKIDSubscriberPKID...)
+	return append(prefixCopy, recipientPKID.ToBytes()...)
+}
+
+func DBGetSubscriptionEntry(
+	handle *badger.DB, snap *Snapshot, recipientPKID *PKID, subscriberPKID *PKID,
+) (*SubscriptionEntry, error) {
+	var ret *SubscriptionEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetSubscriptionEntryWithTxn(txn, snap, recipientPKID, subscriberPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetSubscriptionEntryWithTxn(
+	txn *badger.Txn, snap *Snapshot, recipientPKID *PKID, subscriberPKID *PKID,
+) (*SubscriptionEntry, error) {
+	// Retrieve SubscriptionEntry from db.
+	entryBytes, err := DBGetWithTxn(txn, snap, DBKeyForSubscription(recipientPKID, subscriberPKID))
+	if err != nil {
+		// We don't want to error if the key isn't found. Instead, return nil.
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "DBGetSubscriptionEntryWithTxn: problem retrieving SubscriptionEntry")
+	}
+
+	// Decode SubscriptionEntry from bytes.
+	entry := &SubscriptionEntry{}
+	rr := bytes.NewReader(entryBytes)
+	if exist, err := DecodeFromBytes(entry, rr); !exist || err != nil {
+		return nil, errors.Wrapf(err, "DBGetSubscriptionEntryWithTxn: problem decoding SubscriptionEntry")
+	}
+	return entry, nil
+}
+
+func DBGetSubscriptionEntriesForRecipient(handle *badger.DB, recipientPKID *PKID) ([]*SubscriptionEntry, error) {
+	var ret []*SubscriptionEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		ret, innerErr = DBGetSubscriptionEntriesForRecipientWithTxn(txn, recipientPKID)
+		return innerErr
+	})
+	return ret, err
+}
+
+func DBGetSubscriptionEntriesForRecipientWithTxn(txn *badger.Txn, recipientPKID *PKID) ([]*SubscriptionEntry, error) {
+	_, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, DBPrefixKeyForSubscriptionsByRecipient(recipientPKID), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSubscriptionEntriesForRecipientWithTxn: problem retrieving SubscriptionEntries")
+	}
+
+	var entries []*SubscriptionEntry
+	for _, entryBytes := range valsFound {
+		rr := bytes.NewReader(entryBytes)
+		entry, err := DecodeDeSoEncoder(&SubscriptionEntry{}, rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DBGetSubscriptionEntriesForRecipientWithTxn: problem decoding SubscriptionEntry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func DBPutSubscriptionEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *SubscriptionEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutSubscriptionEntryWithTxn: called with nil SubscriptionEntry")
+		return nil
+	}
+
+	key := DBKeyForSubscription(entry.RecipientPKID, entry.SubscriberPKID)
+	if err := DBSetWithTxn(txn, snap, key, EncodeToBytes(blockHeight, entry), eventManager); err != nil {
+		return errors.Wrapf(
+			err, "DBPutSubscriptionEntryWithTxn: problem storing SubscriptionEntry in index PrefixSubscriptionByRecipientPKIDSubscriberPKID",
+		)
+	}
+	return nil
+}
+
+func DBDeleteSubscriptionEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *SubscriptionEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBDeleteSubscriptionEntryWithTxn: called with nil SubscriptionEntry")
+		return nil
+	}
+
+	key := DBKeyForSubscription(entry.RecipientPKID, entry.SubscriberPKID)
+	if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteSubscriptionEntryWithTxn: problem deleting SubscriptionEntry from index PrefixSubscriptionByRecipientPKIDSubscriberPKID",
+		)
+	}
+	return nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateSubscriptionTxn(
+	transactorPublicKey []byte,
+	metadata *SubscriptionMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the Subscription fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Validate txn metadata.
+	if err := ValidateSubscriptionMetadata(transactorPublicKey, metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateSubscriptionTxn: invalid txn metadata: ")
+	}
+
+	// We don't need to make any tweaks to the amount because a claim is paid
+	// from the subscriber's balance, not from the transactor's inputs.
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(err, "Blockchain.CreateSubscriptionTxn: problem adding inputs: ")
+	}
+
+	// Sanity-check that the spendAmount is zero.
+	if err = amountEqualsAdditionalOutputs(spendAmount, additionalOutputs); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateSubscriptionTxn: %v", err)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectSubscription(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height. The previous entry is stored in a field of the
+	// UtxoOperation that only the compact encoding includes.
+	if blockHeight < bav.Params.ForkHeights.SubscriptionBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.BalanceModelBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.UtxoOperationCompactEncodingBlockHeight {
+		return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionBeforeBlockHeight, "_connectSubscription: ")
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeSubscription {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectSubscription: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+	txMeta := txn.TxnMeta.(*SubscriptionMetadata)
+
+	// Validate the metadata and that the transactor is allowed to perform the operation.
+	if err := ValidateSubscriptionMetadata(txn.PublicKey, txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSubscription: ")
+	}
+
+	recipientPKID := bav.GetPKIDForPublicKey(txMeta.RecipientPublicKey).PKID
+	subscriberPKID := bav.GetPKIDForPublicKey(txMeta.SubscriberPublicKey).PKID
+	prevEntry, err := bav.GetSubscriptionEntry(recipientPKID, subscriberPKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSubscription: ")
+	}
+
+	// Build the entry that the txn leaves behind, if any, before connecting the basic
+	// transfer so that invalid txns fail early.
+	var newEntry *SubscriptionEntry
+	switch txMeta.OperationType {
+	case SubscriptionOperationTypeCreate:
+		if txMeta.ExpirationBlockHeight != 0 && txMeta.ExpirationBlockHeight <= uint64(blockHeight) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionInvalidExpirationBlockHeight,
+				"_connectSubscription: expiration %d <= block height %d", txMeta.ExpirationBlockHeight, blockHeight)
+		}
+		daoCoinCreatorPKID := ZeroPKID.NewPKID()
+		if !txMeta.isDESO() {
+			creatorProfileEntry := bav.GetProfileEntryForPublicKey(txMeta.DAOCoinCreatorPublicKey)
+			if creatorProfileEntry == nil || creatorProfileEntry.isDeleted {
+				return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionOnNonexistentProfile,
+					"_connectSubscription: DAO coin creator %v", PkToString(txMeta.DAOCoinCreatorPublicKey, bav.Params))
+			}
+			daoCoinCreatorPKID = bav.GetPKIDForPublicKey(txMeta.DAOCoinCreatorPublicKey).PKID.NewPKID()
+		}
+		newEntry = &SubscriptionEntry{
+			RecipientPKID:               recipientPKID.NewPKID(),
+			SubscriberPKID:              subscriberPKID.NewPKID(),
+			DAOCoinCreatorPKID:          daoCoinCreatorPKID,
+			MaxAmountPerPeriodBaseUnits: txMeta.MaxAmountPerPeriodBaseUnits.Clone(),
+			PeriodBlocks:                txMeta.PeriodBlocks,
+			StartBlockHeight:            uint64(blockHeight),
+			ExpirationBlockHeight:       txMeta.ExpirationBlockHeight,
+			ClaimedPeriodIndex:          0,
+			ClaimedAmountBaseUnits:      uint256.NewInt(0),
+		}
+
+	case SubscriptionOperationTypeCancel:
+		if prevEntry == nil {
+			return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionDoesNotExist,
+				"_connectSubscription: subscriber %v, recipient %v",
+				PkToString(txMeta.SubscriberPublicKey, bav.Params), PkToString(txMeta.RecipientPublicKey, bav.Params))
+		}
+
+	case SubscriptionOperationTypeClaim:
+		if prevEntry == nil {
+			return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionDoesNotExist,
+				"_connectSubscription: subscriber %v, recipient %v",
+				PkToString(txMeta.SubscriberPublicKey, bav.Params), PkToString(txMeta.RecipientPublicKey, bav.Params))
+		}
+		if !prevEntry.IsActiveAtBlockHeight(uint64(blockHeight)) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionExpired,
+				"_connectSubscription: expiration %d <= block height %d", prevEntry.ExpirationBlockHeight, blockHeight)
+		}
+		claimableAmount := prevEntry.GetClaimableAmountBaseUnits(uint64(blockHeight))
+		if txMeta.AmountBaseUnits.Gt(claimableAmount) {
+			return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionClaimExceedsMaxPerPeriod,
+				"_connectSubscription: claiming %v with %v left in the period", txMeta.AmountBaseUnits, claimableAmount)
+		}
+		if prevEntry.IsDESO() && !txMeta.AmountBaseUnits.IsUint64() {
+			return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionInvalidAmount,
+				"_connectSubscription: DESO amount %v overflows uint64", txMeta.AmountBaseUnits)
+		}
+		newEntry = prevEntry.Copy()
+		periodIndex := prevEntry.GetPeriodIndex(uint64(blockHeight))
+		if periodIndex != prevEntry.ClaimedPeriodIndex {
+			newEntry.ClaimedPeriodIndex = periodIndex
+			newEntry.ClaimedAmountBaseUnits = uint256.NewInt(0)
+		}
+		newEntry.ClaimedAmountBaseUnits = uint256.NewInt(0).Add(
+			newEntry.ClaimedAmountBaseUnits, txMeta.AmountBaseUnits)
+	}
+
+	// Connect a basic transfer to get the total input and the
+	// total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectSubscription: ")
+	}
+	if verifySignatures {
+		// _connectBasicTransfer has already checked that the txn is signed
+		// by the top-level public key, which we take to be the transactor's
+		// public key.
+	}
+
+	// Move the claimed payment from the subscriber to the recipient.
+	subscriptionUtxoOp := &UtxoOperation{Type: OperationTypeSubscription}
+	if txMeta.OperationType == SubscriptionOperationTypeClaim {
+		if prevEntry.IsDESO() {
+			spendUtxoOp, err := bav._spendBalance(
+				txMeta.AmountBaseUnits.Uint64(), txMeta.SubscriberPublicKey, blockHeight-1,
+			)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(RuleErrorSubscriptionInsufficientBalance, "_connectSubscription: %v", err)
+			}
+			addUtxoOp, err := bav._addBalance(txMeta.AmountBaseUnits.Uint64(), txMeta.RecipientPublicKey)
+			if err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectSubscription: ")
+			}
+			utxoOpsForTxn = append(utxoOpsForTxn, spendUtxoOp, addUtxoOp)
+		} else {
+			if err = bav._transferSubscriptionDAOCoins(prevEntry, txMeta, subscriptionUtxoOp); err != nil {
+				return 0, 0, nil, errors.Wrapf(err, "_connectSubscription: ")
+			}
+		}
+	}
+
+	if prevEntry != nil {
+		subscriptionUtxoOp.PrevSubscriptionEntry = prevEntry.Copy()
+		bav._deleteSubscriptionEntryMappings(prevEntry)
+	}
+	if newEntry != nil {
+		bav._setSubscriptionEntryMappings(newEntry)
+	}
+
+	// Add a UTXO operation
+	utxoOpsForTxn = append(utxoOpsForTxn, subscriptionUtxoOp)
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+// _transferSubscriptionDAOCoins moves a claimed payment of the subscription's DAO coin from the subscriber
+// to the recipient, and records the balances and the coin entry that it replaced in the UtxoOperation.
+func (bav *UtxoView) _transferSubscriptionDAOCoins(
+	entry *SubscriptionEntry, txMeta *SubscriptionMetadata, utxoOp *UtxoOperation,
+) error {
+	creatorPublicKey := bav.GetPublicKeyForPKID(entry.DAOCoinCreatorPKID)
+	creatorProfileEntry := bav.GetProfileEntryForPublicKey(creatorPublicKey)
+	if creatorProfileEntry == nil || creatorProfileEntry.isDeleted {
+		return errors.Wrapf(RuleErrorSubscriptionOnNonexistentProfile,
+			"_transferSubscriptionDAOCoins: DAO coin creator %v", PkToString(creatorPublicKey, bav.Params))
+	}
+
+	senderBalanceEntry, _, _ := bav.GetDAOCoinBalanceEntryForHODLerPubKeyAndCreatorPubKey(
+		txMeta.SubscriberPublicKey, creatorPublicKey)
+	if senderBalanceEntry == nil || senderBalanceEntry.isDeleted ||
+		txMeta.AmountBaseUnits.Gt(&senderBalanceEntry.BalanceNanos) {
+		return errors.Wrapf(RuleErrorSubscriptionInsufficientBalance,
+			"_transferSubscriptionDAOCoins: subscriber %v can't pay %v",
+			PkToString(txMeta.SubscriberPublicKey, bav.Params), txMeta.AmountBaseUnits)
+	}
+	if err := bav.IsValidDAOCoinTransfer(
+		creatorProfileEntry, txMeta.SubscriberPublicKey, txMeta.RecipientPublicKey,
+	); err != nil {
+		return errors.Wrapf(err, "_transferSubscriptionDAOCoins: ")
+	}
+
+	receiverBalanceEntry, _, _ := bav.GetDAOCoinBalanceEntryForHODLerPubKeyAndCreatorPubKey(
+		txMeta.RecipientPublicKey, creatorPublicKey)
+	var prevReceiverBalanceEntry *BalanceEntry
+	newReceiverBalanceEntry := &BalanceEntry{
+		HODLerPKID:   entry.RecipientPKID.NewPKID(),
+		CreatorPKID:  entry.DAOCoinCreatorPKID.NewPKID(),
+		BalanceNanos: *uint256.NewInt(0),
+	}
+	if receiverBalanceEntry != nil && !receiverBalanceEntry.isDeleted {
+		prevReceiverBalanceEntry = receiverBalanceEntry.Copy()
+		newReceiverBalanceEntry = receiverBalanceEntry.Copy()
+	}
+	prevSenderBalanceEntry := senderBalanceEntry.Copy()
+	newSenderBalanceEntry := senderBalanceEntry.Copy()
+	newSenderBalanceEntry.BalanceNanos = *uint256.NewInt(0).Sub(
+		&senderBalanceEntry.BalanceNanos, txMeta.AmountBaseUnits)
+	newReceiverBalanceEntry.BalanceNanos = *uint256.NewInt(0).Add(
+		&newReceiverBalanceEntry.BalanceNanos, txMeta.AmountBaseUnits)
+
+	bav._deleteDAOCoinBalanceEntryMappings(senderBalanceEntry, txMeta.SubscriberPublicKey, creatorPublicKey)
+	if receiverBalanceEntry != nil {
+		bav._deleteDAOCoinBalanceEntryMappings(receiverBalanceEntry, txMeta.RecipientPublicKey, creatorPublicKey)
+	}
+	bav._setDAOCoinBalanceEntryMappings(newReceiverBalanceEntry)
+	if !newSenderBalanceEntry.BalanceNanos.IsZero() {
+		bav._setDAOCoinBalanceEntryMappings(newSenderBalanceEntry)
+	}
+
+	// Update the number of holders of the coin.
+	prevCoinEntry := creatorProfileEntry.DAOCoinEntry
+	if prevReceiverBalanceEntry == nil || prevReceiverBalanceEntry.BalanceNanos.IsZero() {
+		creatorProfileEntry.DAOCoinEntry.NumberOfHolders++
+	}
+	if newSenderBalanceEntry.BalanceNanos.IsZero() {
+		creatorProfileEntry.DAOCoinEntry.NumberOfHolders--
+	}
+	bav._setProfileEntryMappings(creatorProfileEntry)
+
+	utxoOp.PrevSenderBalanceEntry = prevSenderBalanceEntry
+	utxoOp.PrevReceiverBalanceEntry = prevReceiverBalanceEntry
+	utxoOp.PrevCoinEntry = &prevCoinEntry
+	return nil
+}
+
+func (bav *UtxoView) _disconnectSubscription(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.SubscriptionBlockHeight {
+		return errors.Wrapf(RuleErrorSubscriptionBeforeBlockHeight, "_disconnectSubscription: ")
+	}
+
+	// Validate the last operation is a Subscription operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectSubscription: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeSubscription {
+		return fmt.Errorf(
+			"_disconnectSubscription: trying to revert %v but found %v",
+			OperationTypeSubscription,
+			utxoOpsForTxn[operationIndex].Type,
+		)
+	}
+	operationData, err := GetUtxoOperationData[SubscriptionOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectSubscription: ")
+	}
+	txMeta := currentTxn.TxnMeta.(*SubscriptionMetadata)
+
+	// Delete the subscription set by the txn, if any, and restore the one it replaced.
+	recipientPKID := bav.GetPKIDForPublicKey(txMeta.RecipientPublicKey).PKID
+	subscriberPKID := bav.GetPKIDForPublicKey(txMeta.SubscriberPublicKey).PKID
+	currentEntry, err := bav.GetSubscriptionEntry(recipientPKID, subscriberPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectSubscription: ")
+	}
+	if txMeta.OperationType == SubscriptionOperationTypeCancel {
+		if currentEntry != nil {
+			return fmt.Errorf("_disconnectSubscription: canceled SubscriptionEntry for recipient %v, "+
+				"subscriber %v exists", recipientPKID, subscriberPKID)
+		}
+	} else {
+		if currentEntry == nil {
+			return fmt.Errorf("_disconnectSubscription: no SubscriptionEntry for recipient %v, subscriber %v",
+				recipientPKID, subscriberPKID)
+		}
+		bav._deleteSubscriptionEntryMappings(currentEntry)
+	}
+	if operationData.PrevSubscriptionEntry != nil {
+		bav._setSubscriptionEntryMappings(operationData.PrevSubscriptionEntry)
+	}
+
+	// Return the claimed payment to the subscriber.
+	if txMeta.OperationType == SubscriptionOperationTypeClaim {
+		if operationData.PrevSubscriptionEntry == nil {
+			return fmt.Errorf("_disconnectSubscription: claim is missing its PrevSubscriptionEntry")
+		}
+		if operationData.PrevSubscriptionEntry.IsDESO() {
+			if operationIndex < 2 ||
+				utxoOpsForTxn[operationIndex-1].Type != OperationTypeAddBalance ||
+				utxoOpsForTxn[operationIndex-2].Type != OperationTypeSpendBalance {
+				return fmt.Errorf("_disconnectSubscription: claim is missing its balance operations")
+			}
+			addUtxoOp := utxoOpsForTxn[operationIndex-1]
+			if err = bav._unAddBalance(addUtxoOp.BalanceAmountNanos, addUtxoOp.BalancePublicKey); err != nil {
+				return errors.Wrapf(err, "_disconnectSubscription: ")
+			}
+			spendUtxoOp := utxoOpsForTxn[operationIndex-2]
+			if err = bav._unSpendBalance(spendUtxoOp.BalanceAmountNanos, spendUtxoOp.BalancePublicKey); err != nil {
+				return errors.Wrapf(err, "_disconnectSubscription: ")
+			}
+			operationIndex -= 2
+		} else if err = bav._revertSubscriptionDAOCoinTransfer(
+			operationData.PrevSubscriptionEntry, txMeta, operationData,
+		); err != nil {
+			return errors.Wrapf(err, "_disconnectSubscription: ")
+		}
+	}
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+// _revertSubscriptionDAOCoinTransfer restores the balances and the coin entry that a claimed payment of the
+// subscription's DAO coin replaced.
+func (bav *UtxoView) _revertSubscriptionDAOCoinTransfer(
+	entry *SubscriptionEntry, txMeta *SubscriptionMetadata, operationData *SubscriptionOperationData,
+) error {
+	if operationData.PrevSenderBalanceEntry == nil || operationData.PrevCoinEntry == nil {
+		return fmt.Errorf("_revertSubscriptionDAOCoinTransfer: claim is missing its previous balances")
+	}
+	creatorPublicKey := bav.GetPublicKeyForPKID(entry.DAOCoinCreatorPKID)
+	creatorProfileEntry := bav.GetProfileEntryForPublicKey(creatorPublicKey)
+	if creatorProfileEntry == nil || creatorProfileEntry.isDeleted {
+		return fmt.Errorf("_revertSubscriptionDAOCoinTransfer: DAO coin creator %v has no profile",
+			PkToString(creatorPublicKey, bav.Params))
+	}
+
+	senderBalanceEntry, _, _ := bav.GetDAOCoinBalanceEntryForHODLerPubKeyAndCreatorPubKey(
+		txMeta.SubscriberPublicKey, creatorPublicKey)
+	if senderBalanceEntry != nil {
+		bav._deleteDAOCoinBalanceEntryMappings(senderBalanceEntry, txMeta.SubscriberPublicKey, creatorPublicKey)
+	}
+	receiverBalanceEntry, _, _ := bav.GetDAOCoinBalanceEntryForHODLerPubKeyAndCreatorPubKey(
+		txMeta.RecipientPublicKey, creatorPublicKey)
+	if receiverBalanceEntry != nil {
+		bav._deleteDAOCoinBalanceEntryMappings(receiverBalanceEntry, txMeta.RecipientPublicKey, creatorPublicKey)
+	}
+	bav._setDAOCoinBalanceEntryMappings(operationData.PrevSenderBalanceEntry)
+	if operationData.PrevReceiverBalanceEntry != nil {
+		bav._setDAOCoinBalanceEntryMappings(operationData.PrevReceiverBalanceEntry)
+	}
+
+	creatorProfileEntry.DAOCoinEntry = *operationData.PrevCoinEntry
+	bav._setProfileEntryMappings(creatorProfileEntry)
+	return nil
+}
+
+// ValidateSubscriptionMetadata checks the metadata of a Subscription txn and that the transactor
+// is allowed to perform its operation. It doesn't depend on the state, so it's shared by txn
+// construction and connection.
+func ValidateSubscriptionMetadata(transactorPublicKey []byte, metadata *SubscriptionMetadata) error {
+	if _, err := btcec.ParsePubKey(metadata.SubscriberPublicKey); err != nil {
+		return errors.Wrapf(RuleErrorSubscriptionInvalidSubscriberPublicKey, "ValidateSubscriptionMetadata: %v", err)
+	}
+	if _, err := btcec.ParsePubKey(metadata.RecipientPublicKey); err != nil {
+		return errors.Wrapf(RuleErrorSubscriptionInvalidRecipientPublicKey, "ValidateSubscriptionMetadata: %v", err)
+	}
+	if bytes.Equal(metadata.SubscriberPublicKey, metadata.RecipientPublicKey) {
+		return RuleErrorSubscriptionCannotSubscribeToSelf
+	}
+	isZero := func(amount *uint256.Int) bool {
+		return amount == nil || amount.IsZero()
+	}
+
+	switch metadata.OperationType {
+	case SubscriptionOperationTypeCreate:
+		if !bytes.Equal(transactorPublicKey, metadata.SubscriberPublicKey) {
+			return RuleErrorSubscriptionCreateNotBySubscriber
+		}
+		if !metadata.isDESO() {
+			if _, err := btcec.ParsePubKey(metadata.DAOCoinCreatorPublicKey); err != nil {
+				return errors.Wrapf(RuleErrorSubscriptionInvalidDAOCoinCreatorPublicKey,
+					"ValidateSubscriptionMetadata: %v", err)
+			}
+		}
+		if isZero(metadata.MaxAmountPerPeriodBaseUnits) ||
+			(metadata.isDESO() && !metadata.MaxAmountPerPeriodBaseUnits.IsUint64()) {
+			return errors.Wrapf(RuleErrorSubscriptionInvalidAmount,
+				"ValidateSubscriptionMetadata: max per period %v", metadata.MaxAmountPerPeriodBaseUnits)
+		}
+		if metadata.PeriodBlocks == 0 {
+			return RuleErrorSubscriptionInvalidPeriodBlocks
+		}
+		if !isZero(metadata.AmountBaseUnits) {
+			return errors.Wrapf(RuleErrorSubscriptionInvalidAmount,
+				"ValidateSubscriptionMetadata: creating with amount %v", metadata.AmountBaseUnits)
+		}
+		return nil
+	case SubscriptionOperationTypeCancel:
+		if !bytes.Equal(transactorPublicKey, metadata.SubscriberPublicKey) &&
+			!bytes.Equal(transactorPublicKey, metadata.RecipientPublicKey) {
+			return RuleErrorSubscriptionCancelNotBySubscriberOrRecipient
+		}
+		if !isZero(metadata.AmountBaseUnits) {
+			return errors.Wrapf(RuleErrorSubscriptionInvalidAmount,
+				"ValidateSubscriptionMetadata: canceling with amount %v", metadata.AmountBaseUnits)
+		}
+	case SubscriptionOperationTypeClaim:
+		if !bytes.Equal(transactorPublicKey, metadata.RecipientPublicKey) {
+			return RuleErrorSubscriptionClaimNotByRecipient
+		}
+		if isZero(metadata.AmountBaseUnits) {
+			return errors.Wrapf(RuleErrorSubscriptionInvalidAmount, "ValidateSubscriptionMetadata: claiming zero")
+		}
+	default:
+		return errors.Wrapf(RuleErrorSubscriptionInvalidOperationType,
+			"ValidateSubscriptionMetadata: %v", metadata.OperationType)
+	}
+
+	// Only creating a subscription sets its terms.
+	if len(metadata.DAOCoinCreatorPublicKey) != 0 {
+		return errors.Wrapf(RuleErrorSubscriptionInvalidDAOCoinCreatorPublicKey,
+			"ValidateSubscriptionMetadata: %v with a DAO coin creator", metadata.OperationType)
+	}
+	if !isZero(metadata.MaxAmountPerPeriodBaseUnits) {
+		return errors.Wrapf(RuleErrorSubscriptionInvalidAmount,
+			"ValidateSubscriptionMetadata: %v with max per period %v",
+			metadata.OperationType, metadata.MaxAmountPerPeriodBaseUnits)
+	}
+	if metadata.PeriodBlocks != 0 {
+		return errors.Wrapf(RuleErrorSubscriptionInvalidPeriodBlocks,
+			"ValidateSubscriptionMetadata: %v with period %d", metadata.OperationType, metadata.PeriodBlocks)
+	}
+	if metadata.ExpirationBlockHeight != 0 {
+		return errors.Wrapf(RuleErrorSubscriptionInvalidExpirationBlockHeight,
+			"ValidateSubscriptionMetadata: %v with expiration %d", metadata.OperationType, metadata.ExpirationBlockHeight)
+	}
+	return nil
+}
+
+func (bav *UtxoView) GetSubscriptionEntry(recipientPKID *PKID, subscriberPKID *PKID) (*SubscriptionEntry, error) {
+	if recipientPKID == nil || subscriberPKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetSubscriptionEntry: Called with nil recipientPKID or subscriberPKID")
+	}
+
+	// First check the UtxoView.
+	mapKey := SubscriptionKey{RecipientPKID: *recipientPKID, SubscriberPKID: *subscriberPKID}
+	if entry, exists := bav.SubscriptionKeyToSubscriptionEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+
+	// If no SubscriptionEntry (either isDeleted or !isDeleted) was found
+	// in the UtxoView for the given key, check the database.
+	dbEntry, err := DBGetSubscriptionEntry(bav.Handle, bav.Snapshot, recipientPKID, subscriberPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetSubscriptionEntry: ")
+	}
+	if dbEntry != nil {
+		// Cache the SubscriptionEntry from the db in the UtxoView.
+		bav._setSubscriptionEntryMappings(dbEntry)
+	}
+	return dbEntry, nil
+}
+
+// GetSubscriptionEntriesForRecipient returns the subscriptions of all of the recipient's subscribers,
+// including the expired ones, merging the entries in the view with the entries in the database.
+func (bav *UtxoView) GetSubscriptionEntriesForRecipient(recipientPKID *PKID) ([]*SubscriptionEntry, error) {
+	if recipientPKID == nil {
+		return nil, fmt.Errorf("UtxoView.GetSubscriptionEntriesForRecipient: Called with nil recipientPKID")
+	}
+
+	// Load the entries from the database into the view. We don't overwrite the
+	// entries in the view since they're more recent than the database.
+	dbEntries, err := DBGetSubscriptionEntriesForRecipient(bav.Handle, recipientPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetSubscriptionEntriesForRecipient: ")
+	}
+	for _, entry := range dbEntries {
+		if _, exists := bav.SubscriptionKeyToSubscriptionEntry[entry.ToMapKey()]; !exists {
+			bav._setSubscriptionEntryMappings(entry)
+		}
+	}
+
+	var entries []*SubscriptionEntry
+	for mapKey, entry := range bav.SubscriptionKeyToSubscriptionEntry {
+		if !entry.isDeleted && mapKey.RecipientPKID == *recipientPKID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (bav *UtxoView) _setSubscriptionEntryMappings(entry *SubscriptionEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setSubscriptionEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.SubscriptionKeyToSubscriptionEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteSubscriptionEntryMappings(entry *SubscriptionEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteSubscriptionEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := *entry
+	tombstoneEntry.isDeleted = true
+	// Set the mappings to point to the tombstone entry.
+	bav._setSubscriptionEntryMappings(&tombstoneEntry)
+}
+
+func (bav *UtxoView) _flushSubscriptionEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	// Iterate through all the entries and either delete or update them depending on their
+	// isDeleted status.
+	for mapKeyIter, entryIter := range bav.SubscriptionKeyToSubscriptionEntry {
+		// Make a copy of the iterators since we make references to them below.
+		mapKey := mapKeyIter
+		entry := *entryIter
+
+		// Sanity-check that the entry matches the map key.
+		if !reflect.DeepEqual(entry.ToMapKey(), mapKey) {
+			return fmt.Errorf(
+				"_flushSubscriptionEntriesToDbWithTxn: SubscriptionEntry key %v doesn't match MapKey %v",
+				entry.ToMapKey(),
+				mapKey,
+			)
+		}
+
+		// Delete entries if they have isDeleted=true
+		if entry.isDeleted {
+			if err := DBDeleteSubscriptionEntryWithTxn(
+				txn, bav.Snapshot, &entry, bav.EventManager, entry.isDeleted,
+			); err != nil {
+				return errors.Wrapf(err, "_flushSubscriptionEntriesToDbWithTxn: ")
+			}
+		} else {
+			if err := DBPutSubscriptionEntryWithTxn(
+				txn, bav.Snapshot, &entry, blockHeight, bav.EventManager,
+			); err != nil {
+				return errors.Wrapf(err, "_flushSubscriptionEntriesToDbWithTxn: ")
+			}
+		}
+	}
+	return nil
+}
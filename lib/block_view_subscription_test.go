@@ -0,0 +1,327 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscription(t *testing.T) {
+	var err error
+
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	// Subscription txns require the compact UtxoOperation encoding.
+	setSubscriptionBlockHeight := func(blockHeight uint32) {
+		params.ForkHeights.SubscriptionBlockHeight = blockHeight
+		params.ForkHeights.UtxoOperationCompactEncodingBlockHeight = blockHeight
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}
+	defer func(prevForkHeights ForkHeights) {
+		params.ForkHeights = prevForkHeights
+		GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+		GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	}(params.ForkHeights)
+	params.ForkHeights.DAOCoinBlockHeight = uint32(0)
+	setSubscriptionBlockHeight(math.MaxUint32)
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       chain.blockTip().Height + 1,
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	// m0 is the subscriber. m1 is paid in DESO, and m3 is paid in m2's DAO coin.
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e6)
+	_registerOrTransferWithTestMeta(testMeta, "m3", senderPkString, m3Pub, senderPrivString, 1e6)
+	m0PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m0PkBytes).PKID
+	m1PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m1PkBytes).PKID
+	m2PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m2PkBytes).PKID
+	m3PKID := DBGetPKIDEntryForPublicKey(db, chain.snapshot, m3PkBytes).PKID
+
+	create := func(recipientPkBytes []byte, daoCoinCreatorPkBytes []byte, maxAmount uint64) *SubscriptionMetadata {
+		return &SubscriptionMetadata{
+			OperationType:               SubscriptionOperationTypeCreate,
+			SubscriberPublicKey:         m0PkBytes,
+			RecipientPublicKey:          recipientPkBytes,
+			DAOCoinCreatorPublicKey:     daoCoinCreatorPkBytes,
+			MaxAmountPerPeriodBaseUnits: uint256.NewInt(maxAmount),
+			PeriodBlocks:                100,
+		}
+	}
+	cancel := func(recipientPkBytes []byte) *SubscriptionMetadata {
+		return &SubscriptionMetadata{
+			OperationType:       SubscriptionOperationTypeCancel,
+			SubscriberPublicKey: m0PkBytes,
+			RecipientPublicKey:  recipientPkBytes,
+		}
+	}
+	claim := func(recipientPkBytes []byte, amount uint64) *SubscriptionMetadata {
+		return &SubscriptionMetadata{
+			OperationType:       SubscriptionOperationTypeClaim,
+			SubscriberPublicKey: m0PkBytes,
+			RecipientPublicKey:  recipientPkBytes,
+			AmountBaseUnits:     uint256.NewInt(amount),
+		}
+	}
+	deso := ZeroPublicKey.ToBytes()
+
+	{
+		// RuleErrorSubscriptionBeforeBlockHeight
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m1PkBytes, deso, 1000))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionBeforeBlockHeight)
+
+		setSubscriptionBlockHeight(uint32(1))
+	}
+	{
+		// RuleErrorSubscriptionCreateNotBySubscriber
+		err = _submitSubscriptionWithTestMeta(testMeta, m1Pub, m1Priv, create(m1PkBytes, deso, 1000))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionCreateNotBySubscriber)
+	}
+	{
+		// RuleErrorSubscriptionCannotSubscribeToSelf
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m0PkBytes, deso, 1000))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionCannotSubscribeToSelf)
+	}
+	{
+		// RuleErrorSubscriptionInvalidRecipientPublicKey
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m1PkBytes[:10], deso, 1000))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInvalidRecipientPublicKey)
+	}
+	{
+		// RuleErrorSubscriptionInvalidDAOCoinCreatorPublicKey
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m1PkBytes, nil, 1000))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInvalidDAOCoinCreatorPublicKey)
+	}
+	{
+		// RuleErrorSubscriptionOnNonexistentProfile
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m3PkBytes, m2PkBytes, 1000))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionOnNonexistentProfile)
+	}
+	{
+		// RuleErrorSubscriptionInvalidAmount
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m1PkBytes, deso, 0))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInvalidAmount)
+		metadata := create(m1PkBytes, deso, 1000)
+		metadata.MaxAmountPerPeriodBaseUnits = uint256.NewInt(0).Lsh(uint256.NewInt(1), 64)
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInvalidAmount)
+	}
+	{
+		// RuleErrorSubscriptionInvalidPeriodBlocks
+		metadata := create(m1PkBytes, deso, 1000)
+		metadata.PeriodBlocks = 0
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInvalidPeriodBlocks)
+	}
+	{
+		// RuleErrorSubscriptionInvalidExpirationBlockHeight
+		metadata := create(m1PkBytes, deso, 1000)
+		metadata.ExpirationBlockHeight = uint64(chain.blockTip().Height)
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInvalidExpirationBlockHeight)
+	}
+	{
+		// RuleErrorSubscriptionInvalidOperationType
+		metadata := create(m1PkBytes, deso, 1000)
+		metadata.OperationType = SubscriptionOperationTypeUnknown
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInvalidOperationType)
+	}
+	{
+		// RuleErrorSubscriptionDoesNotExist
+		err = _submitSubscriptionWithTestMeta(testMeta, m1Pub, m1Priv, claim(m1PkBytes, 100))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionDoesNotExist)
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, cancel(m1PkBytes))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionDoesNotExist)
+	}
+
+	// Happy path: m0 subscribes to m1 for up to 1000 nanos per period, and m1 claims 600 nanos in two claims.
+	require.NoError(t, _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m1PkBytes, deso, 1000)))
+	entry, err := DBGetSubscriptionEntry(db, chain.snapshot, m1PKID, m0PKID)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.True(t, entry.IsDESO())
+	require.Equal(t, uint64(chain.blockTip().Height)+1, entry.StartBlockHeight)
+	require.Equal(t, uint256.NewInt(1000), entry.GetClaimableAmountBaseUnits(entry.StartBlockHeight))
+
+	m0Balance := _getBalance(t, chain, nil, m0Pub)
+	require.NoError(t, _submitSubscriptionWithTestMeta(testMeta, m1Pub, m1Priv, claim(m1PkBytes, 400)))
+	require.NoError(t, _submitSubscriptionWithTestMeta(testMeta, m1Pub, m1Priv, claim(m1PkBytes, 200)))
+	require.Equal(t, m0Balance-600, _getBalance(t, chain, nil, m0Pub))
+	entry, err = DBGetSubscriptionEntry(db, chain.snapshot, m1PKID, m0PKID)
+	require.NoError(t, err)
+	require.Equal(t, uint256.NewInt(600), entry.ClaimedAmountBaseUnits)
+	require.Equal(t, uint256.NewInt(400), entry.GetClaimableAmountBaseUnits(entry.StartBlockHeight))
+
+	{
+		// RuleErrorSubscriptionClaimExceedsMaxPerPeriod
+		err = _submitSubscriptionWithTestMeta(testMeta, m1Pub, m1Priv, claim(m1PkBytes, 401))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionClaimExceedsMaxPerPeriod)
+	}
+	{
+		// RuleErrorSubscriptionClaimNotByRecipient
+		err = _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, claim(m1PkBytes, 100))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionClaimNotByRecipient)
+	}
+	{
+		// RuleErrorSubscriptionCancelNotBySubscriberOrRecipient
+		metadata := cancel(m1PkBytes)
+		err = _submitSubscriptionWithTestMeta(testMeta, m2Pub, m2Priv, metadata)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionCancelNotBySubscriberOrRecipient)
+	}
+
+	// The claimable amount resets in the next period, and nothing can be claimed once the subscription expires.
+	nextPeriodEntry := entry.Copy()
+	require.Equal(t, uint64(1), nextPeriodEntry.GetPeriodIndex(entry.StartBlockHeight+100))
+	require.Equal(t, uint256.NewInt(1000), nextPeriodEntry.GetClaimableAmountBaseUnits(entry.StartBlockHeight+100))
+	nextPeriodEntry.ExpirationBlockHeight = entry.StartBlockHeight + 100
+	require.True(t, nextPeriodEntry.GetClaimableAmountBaseUnits(entry.StartBlockHeight+100).IsZero())
+
+	// Happy path: m2 mints its DAO coin and gives some to m0, which subscribes to m3 in it.
+	_updateProfileWithTestMeta(testMeta, testMeta.feeRateNanosPerKb, m2Pub, m2Priv, []byte{}, "m2",
+		"i am the m2", shortPic, 10*100, 1.25*100*100, false)
+	_daoCoinTxnWithTestMeta(testMeta, testMeta.feeRateNanosPerKb, m2Pub, m2Priv, DAOCoinMetadata{
+		ProfilePublicKey: m2PkBytes,
+		OperationType:    DAOCoinOperationTypeMint,
+		CoinsToMintNanos: *uint256.NewInt(1e6),
+	})
+	_daoCoinTransferTxnWithTestMeta(testMeta, testMeta.feeRateNanosPerKb, m2Pub, m2Priv, DAOCoinTransferMetadata{
+		ProfilePublicKey:       m2PkBytes,
+		DAOCoinToTransferNanos: *uint256.NewInt(1000),
+		ReceiverPublicKey:      m0PkBytes,
+	})
+	require.NoError(t, _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, create(m3PkBytes, m2PkBytes, 5000)))
+	{
+		// RuleErrorSubscriptionInsufficientBalance
+		err = _submitSubscriptionWithTestMeta(testMeta, m3Pub, m3Priv, claim(m3PkBytes, 1001))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorSubscriptionInsufficientBalance)
+	}
+	require.NoError(t, _submitSubscriptionWithTestMeta(testMeta, m3Pub, m3Priv, claim(m3PkBytes, 1000)))
+	require.True(t, DBGetBalanceEntryForHODLerAndCreatorPKIDs(db, chain.snapshot, m0PKID, m2PKID, true).BalanceNanos.IsZero())
+	require.Equal(t, uint64(1000),
+		DBGetBalanceEntryForHODLerAndCreatorPKIDs(db, chain.snapshot, m3PKID, m2PKID, true).BalanceNanos.Uint64())
+	require.Equal(t, uint64(2), DBGetProfileEntryForPKID(db, chain.snapshot, m2PKID).DAOCoinEntry.NumberOfHolders)
+
+	// Happy path: the recipient cancels one subscription, and the subscriber the other.
+	entries, err := DBGetSubscriptionEntriesForRecipient(db, m3PKID)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NoError(t, _submitSubscriptionWithTestMeta(testMeta, m3Pub, m3Priv, cancel(m3PkBytes)))
+	require.NoError(t, _submitSubscriptionWithTestMeta(testMeta, m0Pub, m0Priv, cancel(m1PkBytes)))
+	entries, err = DBGetSubscriptionEntriesForRecipient(db, m3PKID)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	entry, err = DBGetSubscriptionEntry(db, chain.snapshot, m1PKID, m0PKID)
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	_executeAllTestRollbackAndFlush(testMeta)
+	entries, err = DBGetSubscriptionEntriesForRecipient(db, m1PKID)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.True(t, DBGetBalanceEntryForHODLerAndCreatorPKIDs(db, chain.snapshot, m3PKID, m2PKID, true).BalanceNanos.IsZero())
+}
+
+func TestSubscriptionMetadataEncoding(t *testing.T) {
+	metadata := &SubscriptionMetadata{
+		OperationType:               SubscriptionOperationTypeCreate,
+		SubscriberPublicKey:         m0PkBytes,
+		RecipientPublicKey:          m1PkBytes,
+		DAOCoinCreatorPublicKey:     m2PkBytes,
+		MaxAmountPerPeriodBaseUnits: uint256.NewInt(1000),
+		PeriodBlocks:                100,
+		ExpirationBlockHeight:       12345,
+	}
+	encodedBytes, err := metadata.ToBytes(false)
+	require.NoError(t, err)
+	decodedMetadata := &SubscriptionMetadata{}
+	require.NoError(t, decodedMetadata.FromBytes(encodedBytes))
+	require.Equal(t, metadata, decodedMetadata)
+}
+
+func _submitSubscriptionWithTestMeta(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *SubscriptionMetadata,
+) error {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, nil, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	transactorPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, _, _, err := testMeta.chain.CreateSubscriptionTxn(
+		transactorPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		nil,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	blockHeight := testMeta.chain.blockTip().Height + 1
+	utxoView := NewUtxoView(testMeta.db, testMeta.params, testMeta.chain.postgres, testMeta.chain.snapshot, nil)
+	utxoOps, totalInput, _, _, err := utxoView.ConnectTransaction(txn, txn.Hash(), blockHeight, 0, true, false)
+	if err != nil {
+		return err
+	}
+	require.Equal(testMeta.t, totalInputMake, totalInput)
+	require.Equal(testMeta.t, OperationTypeSubscription, utxoOps[len(utxoOps)-1].Type)
+	require.NoError(testMeta.t, utxoView.FlushToDb(uint64(blockHeight)))
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return nil
+}
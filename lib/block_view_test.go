@@ -1476,6 +1476,21 @@ func TestUpdateGlobalParams(t *testing.T) {
 }
 
 func TestUpdateGlobalParamsPoS(t *testing.T) {
+	// Allow the timeout back-off multiplier, the block reward maturity, and the fee redistribution to be
+	// set once the PoS global params are. The forks of the encoder migrations in between have to be enabled
+	// as well, so that the migrations stay in order.
+	DeSoTestnetParams.ForkHeights.PoSTimeoutBackoffParamsBlockHeight = 2
+	DeSoTestnetParams.ForkHeights.MessageReadStateBlockHeight = 2
+	DeSoTestnetParams.ForkHeights.MessageAttachmentsBlockHeight = 2
+	DeSoTestnetParams.ForkHeights.BlockRewardMaturityParamsBlockHeight = 2
+	DeSoTestnetParams.ForkHeights.FeeRedistributionParamsBlockHeight = 2
+	t.Cleanup(func() {
+		DeSoTestnetParams.ForkHeights.PoSTimeoutBackoffParamsBlockHeight = uint32(math.MaxUint32)
+		DeSoTestnetParams.ForkHeights.MessageReadStateBlockHeight = uint32(math.MaxUint32)
+		DeSoTestnetParams.ForkHeights.MessageAttachmentsBlockHeight = uint32(math.MaxUint32)
+		DeSoTestnetParams.ForkHeights.BlockRewardMaturityParamsBlockHeight = uint32(math.MaxUint32)
+		DeSoTestnetParams.ForkHeights.FeeRedistributionParamsBlockHeight = uint32(math.MaxUint32)
+	})
 	// Set pos block heights
 	setPoSBlockHeights(t, 2, 1000)
 	// Set up a blockchain
@@ -1855,6 +1870,133 @@ func TestUpdateGlobalParamsPoS(t *testing.T) {
 		utxoView := NewUtxoView(db, params, postgres, chain.snapshot, nil)
 		require.Equal(utxoView.GetCurrentGlobalParamsEntry().TimeoutIntervalMillisecondsPoS, uint64(5000))
 	}
+	{
+		// Timeout back-off multiplier global params test
+		// Make sure setting the multiplier too low fails. Anything below min should fail
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(t, chain, db, params, 1000,
+			moneyPkString,
+			moneyPrivString,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			map[string][]byte{
+				TimeoutBackoffMultiplierBasisPointsPoSKey: UintToBuf(MinTimeoutBackoffMultiplierBasisPointsPoS - 1),
+			},
+			true,
+			mempool)
+		require.ErrorIs(err, RuleErrorTimeoutBackoffMultiplierPoSTooLow)
+		// Make sure setting the multiplier too high fails. Anything above max should fail
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(t, chain, db, params, 1000,
+			moneyPkString,
+			moneyPrivString,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			map[string][]byte{
+				TimeoutBackoffMultiplierBasisPointsPoSKey: UintToBuf(MaxTimeoutBackoffMultiplierBasisPointsPoS + 1),
+			},
+			true,
+			mempool)
+		require.ErrorIs(err, RuleErrorTimeoutBackoffMultiplierPoSTooHigh)
+		// Make sure setting the multiplier to a reasonable value works. Make it 1.5x
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(t, chain, db, params, 1000,
+			moneyPkString,
+			moneyPrivString,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			map[string][]byte{
+				TimeoutBackoffMultiplierBasisPointsPoSKey: UintToBuf(15000),
+			},
+			true,
+			mempool)
+		require.NoError(err)
+		utxoView := NewUtxoView(db, params, postgres, chain.snapshot, nil)
+		require.Equal(utxoView.GetCurrentGlobalParamsEntry().TimeoutBackoffMultiplierBasisPointsPoS, uint64(15000))
+	}
+	{
+		// Block reward maturity global params test
+		// Make sure setting the maturity too high fails. Anything above max should fail
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(t, chain, db, params, 1000,
+			moneyPkString,
+			moneyPrivString,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			map[string][]byte{
+				BlockRewardMaturityBlocksKey: UintToBuf(MaxBlockRewardMaturityBlocks + 1),
+			},
+			true,
+			mempool)
+		require.ErrorIs(err, RuleErrorBlockRewardMaturityBlocksTooHigh)
+		// Make sure setting the maturity to a reasonable value works. Make it 100 blocks
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(t, chain, db, params, 1000,
+			moneyPkString,
+			moneyPrivString,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			map[string][]byte{
+				BlockRewardMaturityBlocksKey: UintToBuf(100),
+			},
+			true,
+			mempool)
+		require.NoError(err)
+		utxoView := NewUtxoView(db, params, postgres, chain.snapshot, nil)
+		require.Equal(utxoView.GetCurrentGlobalParamsEntry().BlockRewardMaturityBlocks, uint64(100))
+	}
+	{
+		// Fee redistribution global params test
+		// Make sure setting the redistribution too high fails. Anything above max should fail
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(t, chain, db, params, 1000,
+			moneyPkString,
+			moneyPrivString,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			map[string][]byte{
+				FeeRedistributionBasisPointsKey: UintToBuf(MaxFeeRedistributionBasisPoints + 1),
+			},
+			true,
+			mempool)
+		require.ErrorIs(err, RuleErrorFeeRedistributionBasisPointsTooHigh)
+		// Make sure setting the redistribution to a reasonable value works. Make it 25%
+		_, _, _, err = _updateGlobalParamsEntryWithMempool(t, chain, db, params, 1000,
+			moneyPkString,
+			moneyPrivString,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			-1,
+			map[string][]byte{
+				FeeRedistributionBasisPointsKey: UintToBuf(2500),
+			},
+			true,
+			mempool)
+		require.NoError(err)
+		utxoView := NewUtxoView(db, params, postgres, chain.snapshot, nil)
+		require.Equal(utxoView.GetCurrentGlobalParamsEntry().FeeRedistributionBasisPoints, uint64(2500))
+	}
 }
 
 func TestBalanceModelBasicTransfers(t *testing.T) {
@@ -1862,6 +2004,7 @@ func TestBalanceModelBasicTransfers(t *testing.T) {
 
 	t.Run("TestBasicTransfer", TestBasicTransfer)
 	t.Run("TestBasicTransferSignatures", TestBasicTransferSignatures)
+	t.Run("TestBatchBasicTransfer", TestBatchBasicTransfer)
 	t.Run("TestBlockRewardPatch", TestBlockRewardPatch)
 }
 
@@ -2137,6 +2280,65 @@ func TestBasicTransfer(t *testing.T) {
 	}
 }
 
+// TestBatchBasicTransfer checks that a batch of outputs is merged per recipient and paid in one signed txn.
+func TestBatchBasicTransfer(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	// Mine two blocks to give the sender some DeSo.
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	recipientPkBytes, _, err := Base58CheckDecode(recipientPkString)
+	require.NoError(err)
+
+	// A batch needs at least one output.
+	_, _, _, _, _, err = chain.CreateBatchBasicTransferTxn(senderPkBytes, nil, nil, 10, nil)
+	require.Error(err)
+	require.Contains(err.Error(), "Must have at least one output")
+
+	// Outputs to the same recipient are merged into one output.
+	txn, totalInput, spendAmount, changeAmount, fees, err := chain.CreateBatchBasicTransferTxn(
+		senderPkBytes,
+		[]*DeSoOutput{
+			{PublicKey: recipientPkBytes, AmountNanos: 10},
+			{PublicKey: m0PkBytes, AmountNanos: 20},
+			{PublicKey: recipientPkBytes, AmountNanos: 5},
+		},
+		nil,
+		10,
+		nil,
+	)
+	require.NoError(err)
+	require.Equal(totalInput, spendAmount+changeAmount+fees)
+	require.Equal(uint64(35), spendAmount)
+	require.Equal(recipientPkBytes, txn.TxOutputs[0].PublicKey)
+	require.Equal(uint64(15), txn.TxOutputs[0].AmountNanos)
+	require.Equal(m0PkBytes, txn.TxOutputs[1].PublicKey)
+	require.Equal(uint64(20), txn.TxOutputs[1].AmountNanos)
+
+	// The whole batch is covered by one signature.
+	_signTxn(t, txn, senderPrivString)
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	recipientBalanceBefore, err := utxoView.GetDeSoBalanceNanosForPublicKey(recipientPkBytes)
+	require.NoError(err)
+	m0BalanceBefore, err := utxoView.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+	require.NoError(err)
+	_, _, _, _, err = utxoView.ConnectTransaction(txn, txn.Hash(), chain.blockTip().Height+1, 0, true, false)
+	require.NoError(err)
+	recipientBalanceAfter, err := utxoView.GetDeSoBalanceNanosForPublicKey(recipientPkBytes)
+	require.NoError(err)
+	m0BalanceAfter, err := utxoView.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(recipientBalanceBefore+15, recipientBalanceAfter)
+	require.Equal(m0BalanceBefore+20, m0BalanceAfter)
+}
+
 // TestBasicTransferSignatures thoroughly tests all possible ways to sign a DeSo transaction.
 // There are three available signature schemas that are accepted by the DeSo blockchain:
 //
@@ -0,0 +1,233 @@
+package lib
+
+import (
+	"bytes"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// TxnReceiptStatus is the outcome of a transaction that was included in a block.
+type TxnReceiptStatus uint8
+
+const (
+	// TxnReceiptStatusSuccess means the transaction connected successfully. A block can only include transactions
+	// that connect, so this is currently the status of every receipt.
+	TxnReceiptStatusSuccess TxnReceiptStatus = 0
+)
+
+func (status TxnReceiptStatus) String() string {
+	switch status {
+	case TxnReceiptStatusSuccess:
+		return "Success"
+	default:
+		return "Unknown"
+	}
+}
+
+// TxnReceipt is a compact summary of the result of connecting a transaction in a block. Receipts are written for
+// every transaction when its block is connected and deleted when the block is disconnected, so clients can look
+// up the outcome of a transaction by its hash without re-decoding the block's UtxoOperations.
+//
+// Receipts are also written for the inner transactions of an atomic transaction wrapper. The inner transactions'
+// receipts point to the wrapper via AtomicTxnsWrapperTxnHash.
+type TxnReceipt struct {
+	TxnHash         *BlockHash
+	BlockHash       *BlockHash
+	BlockHeight     uint64
+	TxnIndexInBlock uint64
+	TxnType         TxnType
+	Status          TxnReceiptStatus
+
+	// FeeNanos is the fee paid by the transaction. After the PoS cutover, the fee is split into a burned portion
+	// and a utility portion that goes to the block producer. Before the PoS cutover, the whole fee is utility.
+	FeeNanos        uint64
+	BurnFeeNanos    uint64
+	UtilityFeeNanos uint64
+
+	// CreatedPostHash is set for SubmitPost transactions that create a new post.
+	CreatedPostHash *BlockHash
+	// NFTSerialNumbers are the serial numbers of the NFTs created or modified by NFT transactions.
+	NFTSerialNumbers []uint64
+
+	// AtomicTxnsWrapperTxnHash is set for the inner transactions of an atomic transaction wrapper.
+	AtomicTxnsWrapperTxnHash *BlockHash
+
+	isDeleted bool
+}
+
+func (receipt *TxnReceipt) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+
+	data = append(data, EncodeToBytes(blockHeight, receipt.TxnHash, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, receipt.BlockHash, skipMetadata...)...)
+	data = append(data, UintToBuf(receipt.BlockHeight)...)
+	data = append(data, UintToBuf(receipt.TxnIndexInBlock)...)
+	data = append(data, UintToBuf(uint64(receipt.TxnType))...)
+	data = append(data, UintToBuf(uint64(receipt.Status))...)
+	data = append(data, UintToBuf(receipt.FeeNanos)...)
+	data = append(data, UintToBuf(receipt.BurnFeeNanos)...)
+	data = append(data, UintToBuf(receipt.UtilityFeeNanos)...)
+	data = append(data, EncodeToBytes(blockHeight, receipt.CreatedPostHash, skipMetadata...)...)
+	data = append(data, EncodeUint64Array(receipt.NFTSerialNumbers)...)
+	data = append(data, EncodeToBytes(blockHeight, receipt.AtomicTxnsWrapperTxnHash, skipMetadata...)...)
+
+	return data
+}
+
+func (receipt *TxnReceipt) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	if receipt.TxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading TxnHash")
+	}
+	if receipt.BlockHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading BlockHash")
+	}
+	if receipt.BlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading BlockHeight")
+	}
+	if receipt.TxnIndexInBlock, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading TxnIndexInBlock")
+	}
+	txnType, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading TxnType")
+	}
+	receipt.TxnType = TxnType(txnType)
+	status, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading Status")
+	}
+	receipt.Status = TxnReceiptStatus(status)
+	if receipt.FeeNanos, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading FeeNanos")
+	}
+	if receipt.BurnFeeNanos, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading BurnFeeNanos")
+	}
+	if receipt.UtilityFeeNanos, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading UtilityFeeNanos")
+	}
+	if receipt.CreatedPostHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading CreatedPostHash")
+	}
+	if receipt.NFTSerialNumbers, err = DecodeUint64Array(rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading NFTSerialNumbers")
+	}
+	if receipt.AtomicTxnsWrapperTxnHash, err = DecodeDeSoEncoder(&BlockHash{}, rr); err != nil {
+		return errors.Wrapf(err, "TxnReceipt.Decode: Problem reading AtomicTxnsWrapperTxnHash")
+	}
+
+	return nil
+}
+
+func (receipt *TxnReceipt) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (receipt *TxnReceipt) GetEncoderType() EncoderType {
+	return EncoderTypeTxnReceipt
+}
+
+// newTxnReceipts constructs the receipts for a transaction connected at index txnIndex of a block at blockHeight,
+// which paid the given fees. After the PoS cut-over, the fees are split with feeRedistributionBasisPoints, see
+// computeFeeSplit. The BlockHash of the receipts is set once the block's hash is known. For atomic transaction
+// wrappers, the receipts of the inner transactions follow the wrapper's receipt.
+func (bav *UtxoView) newTxnReceipts(txn *MsgDeSoTxn, txnHash *BlockHash, txnIndex uint64, feeNanos uint64,
+	blockHeight uint64, feeRedistributionBasisPoints uint64) []*TxnReceipt {
+
+	receipt := bav.newTxnReceipt(txn, txnHash, txnIndex, feeNanos, blockHeight, feeRedistributionBasisPoints)
+	receipts := []*TxnReceipt{receipt}
+
+	if txnMeta, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata); ok {
+		for _, innerTxn := range txnMeta.Txns {
+			innerReceipt := bav.newTxnReceipt(
+				innerTxn, innerTxn.Hash(), txnIndex, innerTxn.TxnFeeNanos, blockHeight, feeRedistributionBasisPoints)
+			innerReceipt.AtomicTxnsWrapperTxnHash = txnHash
+			receipts = append(receipts, innerReceipt)
+		}
+	}
+	return receipts
+}
+
+func (bav *UtxoView) newTxnReceipt(txn *MsgDeSoTxn, txnHash *BlockHash, txnIndex uint64, feeNanos uint64,
+	blockHeight uint64, feeRedistributionBasisPoints uint64) *TxnReceipt {
+
+	receipt := &TxnReceipt{
+		TxnHash:         txnHash,
+		BlockHeight:     blockHeight,
+		TxnIndexInBlock: txnIndex,
+		TxnType:         txn.TxnMeta.GetTxnType(),
+		Status:          TxnReceiptStatusSuccess,
+		FeeNanos:        feeNanos,
+		UtilityFeeNanos: feeNanos,
+	}
+	if blockHeight >= uint64(bav.Params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight) {
+		receipt.BurnFeeNanos, receipt.UtilityFeeNanos = computeFeeSplit(feeNanos, feeRedistributionBasisPoints)
+	}
+
+	switch txnMeta := txn.TxnMeta.(type) {
+	case *SubmitPostMetadata:
+		// A SubmitPost without a PostHashToModify creates a new post, whose hash is the txn hash.
+		if len(txnMeta.PostHashToModify) == 0 {
+			receipt.CreatedPostHash = txnHash.NewBlockHash()
+		}
+	case *CreateNFTMetadata:
+		for serialNumber := uint64(1); serialNumber <= txnMeta.NumCopies; serialNumber++ {
+			receipt.NFTSerialNumbers = append(receipt.NFTSerialNumbers, serialNumber)
+		}
+	case *UpdateNFTMetadata:
+		receipt.NFTSerialNumbers = []uint64{txnMeta.SerialNumber}
+	case *NFTBidMetadata:
+		receipt.NFTSerialNumbers = []uint64{txnMeta.SerialNumber}
+	case *AcceptNFTBidMetadata:
+		receipt.NFTSerialNumbers = []uint64{txnMeta.SerialNumber}
+	case *NFTTransferMetadata:
+		receipt.NFTSerialNumbers = []uint64{txnMeta.SerialNumber}
+	case *AcceptNFTTransferMetadata:
+		receipt.NFTSerialNumbers = []uint64{txnMeta.SerialNumber}
+	case *BurnNFTMetadata:
+		receipt.NFTSerialNumbers = []uint64{txnMeta.SerialNumber}
+	}
+	return receipt
+}
+
+func (bav *UtxoView) _setTxnReceiptMappings(receipt *TxnReceipt) {
+	// This function shouldn't be called with nil.
+	if receipt == nil || receipt.TxnHash == nil {
+		glog.Errorf("_setTxnReceiptMappings: Called with nil receipt; this should never happen")
+		return
+	}
+	bav.TxnHashToTxnReceipt[*receipt.TxnHash] = receipt
+}
+
+func (bav *UtxoView) _deleteTxnReceiptMappings(txnHash *BlockHash) {
+	// This function shouldn't be called with nil.
+	if txnHash == nil {
+		glog.Errorf("_deleteTxnReceiptMappings: Called with nil txn hash; this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	bav._setTxnReceiptMappings(&TxnReceipt{TxnHash: txnHash.NewBlockHash(), isDeleted: true})
+}
+
+// GetTxnReceipt returns the receipt of the transaction with the given hash, or nil if the transaction isn't in a
+// block on the best chain, or was connected before this node stored receipts.
+func (bav *UtxoView) GetTxnReceipt(txnHash *BlockHash) (*TxnReceipt, error) {
+	if txnHash == nil {
+		return nil, errors.New("UtxoView.GetTxnReceipt: Called with nil txn hash")
+	}
+	if receipt, exists := bav.TxnHashToTxnReceipt[*txnHash]; exists {
+		if receipt.isDeleted {
+			return nil, nil
+		}
+		return receipt, nil
+	}
+
+	receipt, err := DBGetTxnReceipt(bav.Handle, bav.Snapshot, txnHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetTxnReceipt: ")
+	}
+	return receipt, nil
+}
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnReceipts(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+
+	// Mine two blocks to give the sender some DeSo.
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+
+	txn := _assembleBasicTransferTxnFullySigned(t, chain, 17, 0,
+		senderPkString, recipientPkString, senderPrivString, mempool)
+	_, err = mempool.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+	require.NoError(err)
+	block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	require.Equal(2, len(block.Txns))
+	blockHash, err := block.Header.Hash()
+	require.NoError(err)
+
+	// Every transaction in the block has a receipt.
+	utxoView := NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	txHashes, err := ComputeTransactionHashes(block.Txns)
+	require.NoError(err)
+	for txnIndex, txHash := range txHashes {
+		receipt, err := utxoView.GetTxnReceipt(txHash)
+		require.NoError(err)
+		require.NotNil(receipt)
+		require.Equal(txHash, receipt.TxnHash)
+		require.Equal(blockHash, receipt.BlockHash)
+		require.Equal(block.Header.Height, receipt.BlockHeight)
+		require.Equal(uint64(txnIndex), receipt.TxnIndexInBlock)
+		require.Equal(block.Txns[txnIndex].TxnMeta.GetTxnType(), receipt.TxnType)
+		require.Equal(TxnReceiptStatusSuccess, receipt.Status)
+	}
+	receipt, err := utxoView.GetTxnReceipt(txn.Hash())
+	require.NoError(err)
+	require.Equal(txn.TxnFeeNanos, receipt.FeeNanos)
+	require.Equal(txn.TxnFeeNanos, receipt.UtilityFeeNanos)
+	require.Equal(uint64(0), receipt.BurnFeeNanos)
+
+	// A transaction that isn't in a block has no receipt.
+	receipt, err = utxoView.GetTxnReceipt(NewBlockHash(RandomBytes(HashSizeBytes)))
+	require.NoError(err)
+	require.Nil(receipt)
+
+	// Disconnecting the block deletes its receipts.
+	utxoOps, err := GetUtxoOperationsForBlock(db, chain.snapshot, blockHash)
+	require.NoError(err)
+	require.NoError(utxoView.DisconnectBlock(block, txHashes, utxoOps, 0))
+	require.NoError(utxoView.FlushToDb(0))
+	utxoView = NewUtxoView(db, params, nil, chain.snapshot, chain.eventManager)
+	for _, txHash := range txHashes {
+		receipt, err = utxoView.GetTxnReceipt(txHash)
+		require.NoError(err)
+		require.Nil(receipt)
+	}
+}
@@ -136,8 +136,66 @@ const (
 	// EncoderTypeBlockNode represents a block node in the blockchain.
 	EncoderTypeBlockNode EncoderType = 52
 
+	// EncoderTypeTxnReceipt represents the receipt of a transaction connected in a block.
+	EncoderTypeTxnReceipt EncoderType = 53
+
+	// EncoderTypeStakingRewardStatementEntry represents the staking reward paid to a stake when an epoch completes.
+	EncoderTypeStakingRewardStatementEntry EncoderType = 54
+
+	// EncoderTypeKeyValueRecordEntry represents a key-value record written by a SetKeyValueRecords transaction.
+	EncoderTypeKeyValueRecordEntry EncoderType = 55
+
+	// EncoderTypeLockupVestingScheduleEntry represents the vesting schedule of an unvested LockedBalanceEntry.
+	EncoderTypeLockupVestingScheduleEntry EncoderType = 56
+
+	// EncoderTypeMessageReadStateEntry represents the read watermark of a member for an access group's conversation.
+	EncoderTypeMessageReadStateEntry EncoderType = 57
+
+	// EncoderTypeMessageAttachmentManifest represents the chunks of a NewMessageEntry's off-chain attachment.
+	EncoderTypeMessageAttachmentManifest EncoderType = 58
+
+	// EncoderTypeValidatorPerformanceEntry represents the consensus participation of a validator in an epoch.
+	EncoderTypeValidatorPerformanceEntry EncoderType = 59
+
+	// EncoderTypeSoftForkDeploymentStateEntry represents the state of a soft fork deployment in a signaling window.
+	EncoderTypeSoftForkDeploymentStateEntry EncoderType = 60
+
+	// EncoderTypeNFTAvatarEntry represents a profile referencing an NFT as its avatar.
+	EncoderTypeNFTAvatarEntry EncoderType = 61
+
+	// EncoderTypeBridgeEventAnchorEntry represents an external chain event anchored by the bridge operators.
+	EncoderTypeBridgeEventAnchorEntry EncoderType = 62
+
+	// EncoderTypeDAOCoinBalanceChangeEntry represents a holder's DAO coin balance after a block that changed it.
+	EncoderTypeDAOCoinBalanceChangeEntry EncoderType = 63
+
+	// EncoderTypePKIDSwapEntry represents a SwapIdentity transaction that swapped a PKID.
+	EncoderTypePKIDSwapEntry EncoderType = 64
+
+	// EncoderTypeDelegatedPosterEntry represents an account's authorization of another public key to post on its behalf.
+	EncoderTypeDelegatedPosterEntry EncoderType = 65
+
+	// EncoderTypeAnchorHashEntry represents the hash of off-chain content anchored by a public key.
+	EncoderTypeAnchorHashEntry EncoderType = 66
+
+	// EncoderTypeAnchorHashRateLimitEntry represents the number of hashes a public key anchored in its current window.
+	EncoderTypeAnchorHashRateLimitEntry EncoderType = 67
+
+	// EncoderTypeContentTombstoneEntry represents a transaction that hid a post or a profile.
+	EncoderTypeContentTombstoneEntry EncoderType = 68
+
+	// EncoderTypeBlockFeeSplitEntry represents how the fees of a PoS block were split between the block producer
+	// and the burn.
+	EncoderTypeBlockFeeSplitEntry EncoderType = 69
+
+	// EncoderTypeSubscriptionEntry represents an account's authorization of a recipient to claim recurring payments.
+	EncoderTypeSubscriptionEntry EncoderType = 70
+
+	// EncoderTypeGlobalParamsHistoryEntry represents the global params in effect after a block that updated them.
+	EncoderTypeGlobalParamsHistoryEntry EncoderType = 71
+
 	// EncoderTypeEndBlockView encoder type should be at the end and is used for automated tests.
-	EncoderTypeEndBlockView EncoderType = 53
+	EncoderTypeEndBlockView EncoderType = 72
 )
 
 // Txindex encoder types.
@@ -183,6 +241,7 @@ const (
 	EncoderTypeCoinLockupTransferTxindexMetadata     EncoderType = 1000038
 	EncoderTypeCoinUnlockTxindexMetadata             EncoderType = 1000039
 	EncoderTypeAtomicTxnsWrapperTxindexMetadata      EncoderType = 1000040
+	EncoderTypeExtractedTxindexMetadata              EncoderType = 1000041
 
 	// EncoderTypeEndTxIndex encoder type should be at the end and is used for automated tests.
 	EncoderTypeEndTxIndex EncoderType = 1000036
@@ -298,6 +357,44 @@ func (encoderType EncoderType) New() DeSoEncoder {
 		return &BLSPublicKeyPKIDPairEntry{}
 	case EncoderTypeBlockNode:
 		return &BlockNode{}
+	case EncoderTypeTxnReceipt:
+		return &TxnReceipt{}
+	case EncoderTypeStakingRewardStatementEntry:
+		return &StakingRewardStatementEntry{}
+	case EncoderTypeKeyValueRecordEntry:
+		return &KeyValueRecordEntry{}
+	case EncoderTypeLockupVestingScheduleEntry:
+		return &LockupVestingScheduleEntry{}
+	case EncoderTypeMessageReadStateEntry:
+		return &MessageReadStateEntry{}
+	case EncoderTypeMessageAttachmentManifest:
+		return &MessageAttachmentManifest{}
+	case EncoderTypeValidatorPerformanceEntry:
+		return &ValidatorPerformanceEntry{}
+	case EncoderTypeSoftForkDeploymentStateEntry:
+		return &SoftForkDeploymentStateEntry{}
+	case EncoderTypeNFTAvatarEntry:
+		return &NFTAvatarEntry{}
+	case EncoderTypeBridgeEventAnchorEntry:
+		return &BridgeEventAnchorEntry{}
+	case EncoderTypeDelegatedPosterEntry:
+		return &DelegatedPosterEntry{}
+	case EncoderTypeAnchorHashEntry:
+		return &AnchorHashEntry{}
+	case EncoderTypeAnchorHashRateLimitEntry:
+		return &AnchorHashRateLimitEntry{}
+	case EncoderTypeDAOCoinBalanceChangeEntry:
+		return &DAOCoinBalanceChangeEntry{}
+	case EncoderTypePKIDSwapEntry:
+		return &PKIDSwapEntry{}
+	case EncoderTypeContentTombstoneEntry:
+		return &ContentTombstoneEntry{}
+	case EncoderTypeBlockFeeSplitEntry:
+		return &BlockFeeSplitEntry{}
+	case EncoderTypeSubscriptionEntry:
+		return &SubscriptionEntry{}
+	case EncoderTypeGlobalParamsHistoryEntry:
+		return &GlobalParamsHistoryEntry{}
 	}
 
 	// Txindex encoder types
@@ -384,6 +481,8 @@ func (encoderType EncoderType) New() DeSoEncoder {
 		return &CoinUnlockTxindexMetadata{}
 	case EncoderTypeAtomicTxnsWrapperTxindexMetadata:
 		return &AtomicTxnsWrapperTxindexMetadata{}
+	case EncoderTypeExtractedTxindexMetadata:
+		return &ExtractedTxindexMetadata{}
 	default:
 		return nil
 	}
@@ -691,7 +790,15 @@ const (
 	OperationTypeStakeDistributionPayToBalance OperationType = 50
 	OperationTypeSetValidatorLastActiveAtEpoch OperationType = 51
 	OperationTypeAtomicTxnsWrapper             OperationType = 52
-	// NEXT_TAG = 53
+	OperationTypeSetKeyValueRecords            OperationType = 53
+	OperationTypeMessageReadState              OperationType = 54
+	OperationTypeNFTBatch                      OperationType = 55
+	OperationTypeBridgeEventAnchor             OperationType = 56
+	OperationTypeDelegatedPoster               OperationType = 57
+	OperationTypeRotateValidatorVotingKey      OperationType = 58
+	OperationTypeAnchorHash                    OperationType = 59
+	OperationTypeSubscription                  OperationType = 60
+	// NEXT_TAG = 61
 )
 
 func (op OperationType) String() string {
@@ -800,6 +907,22 @@ func (op OperationType) String() string {
 		return "OperationTypeStakeDistributionPayToBalance"
 	case OperationTypeAtomicTxnsWrapper:
 		return "OperationTypeAtomicTxnsWrapper"
+	case OperationTypeSetKeyValueRecords:
+		return "OperationTypeSetKeyValueRecords"
+	case OperationTypeMessageReadState:
+		return "OperationTypeMessageReadState"
+	case OperationTypeNFTBatch:
+		return "OperationTypeNFTBatch"
+	case OperationTypeBridgeEventAnchor:
+		return "OperationTypeBridgeEventAnchor"
+	case OperationTypeDelegatedPoster:
+		return "OperationTypeDelegatedPoster"
+	case OperationTypeRotateValidatorVotingKey:
+		return "OperationTypeRotateValidatorVotingKey"
+	case OperationTypeAnchorHash:
+		return "OperationTypeAnchorHash"
+	case OperationTypeSubscription:
+		return "OperationTypeSubscription"
 	}
 	return "OperationTypeUNKNOWN"
 }
@@ -1069,6 +1192,37 @@ type UtxoOperation struct {
 	// AtomicTxnsInnerUtxoOps transaction is non-zero. This will always occur, meaning we
 	// can deterministically encode and decode AtomicTxnsInnerUtxoOps.
 	AtomicTxnsInnerUtxoOps [][]*UtxoOperation
+
+	// PrevKeyValueRecordEntries is a slice of the KeyValueRecordEntries that existed
+	// prior to a SetKeyValueRecords txn. Records that didn't exist aren't included.
+	PrevKeyValueRecordEntries []*KeyValueRecordEntry
+
+	// PrevMessageReadStateEntry is the read watermark that a BasicTransfer carrying
+	// message read state replaced. It's nil if the member had no read watermark.
+	PrevMessageReadStateEntry *MessageReadStateEntry
+
+	// PrevNFTEntries are the NFTEntries that an NFTBatch txn transferred, accepted, or burned,
+	// in serial number order.
+	PrevNFTEntries []*NFTEntry
+
+	// PrevNFTAvatarEntry is the index entry for the NFT avatar that an UpdateProfile txn
+	// replaced. It's nil if the profile didn't have an indexed NFT avatar.
+	PrevNFTAvatarEntry *NFTAvatarEntry
+
+	// PrevDelegatedPosterEntry is the authorization that a DelegatedPoster txn replaced or
+	// revoked. It's nil if the delegate wasn't authorized. It's only included in the compact
+	// encoding, which DelegatedPoster txns require.
+	PrevDelegatedPosterEntry *DelegatedPosterEntry
+
+	// PrevAnchorHashRateLimitEntry is the rate limit window of the transactor before an AnchorHash
+	// txn counted against it. It's nil if the transactor had never anchored a hash. It's only
+	// included in the compact encoding, which AnchorHash txns require.
+	PrevAnchorHashRateLimitEntry *AnchorHashRateLimitEntry
+
+	// PrevSubscriptionEntry is the subscription that a Subscription txn created, canceled, or
+	// claimed a payment from replaced. It's nil if there was no subscription. It's only included
+	// in the compact encoding, which Subscription txns require.
+	PrevSubscriptionEntry *SubscriptionEntry
 }
 
 // FIXME: This hackIsRunningStateSyncer() call is a hack to get around the fact that
@@ -1083,6 +1237,12 @@ func hackIsRunningStateSyncer() bool {
 }
 
 func (op *UtxoOperation) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	// After the UtxoOperationCompactEncodingMigration, only the fields that are set are encoded.
+	// See utxo_operation_compact_encoding.go.
+	if MigrationTriggered(blockHeight, UtxoOperationCompactEncodingMigration) {
+		return op.rawEncodeCompactWithoutMetadata(blockHeight, skipMetadata...)
+	}
+
 	var data []byte
 	// Type
 	data = append(data, UintToBuf(uint64(op.Type))...)
@@ -1452,10 +1612,33 @@ func (op *UtxoOperation) RawEncodeWithoutMetadata(blockHeight uint64, skipMetada
 		}
 	}
 
+	if MigrationTriggered(blockHeight, KeyValueRecordsMigration) {
+		// PrevKeyValueRecordEntries
+		data = append(data, EncodeDeSoEncoderSlice(op.PrevKeyValueRecordEntries, blockHeight, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, MessageReadStateMigration) {
+		// PrevMessageReadStateEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevMessageReadStateEntry, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, NFTBatchMigration) {
+		// PrevNFTEntries
+		data = append(data, EncodeDeSoEncoderSlice(op.PrevNFTEntries, blockHeight, skipMetadata...)...)
+	}
+
+	if MigrationTriggered(blockHeight, NFTAvatarMigration) {
+		// PrevNFTAvatarEntry
+		data = append(data, EncodeToBytes(blockHeight, op.PrevNFTAvatarEntry, skipMetadata...)...)
+	}
+
 	return data
 }
 
 func (op *UtxoOperation) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	if MigrationTriggered(blockHeight, UtxoOperationCompactEncodingMigration) {
+		return op.rawDecodeCompactWithoutMetadata(blockHeight, rr)
+	}
 
 	// Type
 	typeUint64, err := ReadUvarint(rr)
@@ -2172,6 +2355,34 @@ func (op *UtxoOperation) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.
 		}
 	}
 
+	if MigrationTriggered(blockHeight, KeyValueRecordsMigration) {
+		// PrevKeyValueRecordEntries
+		if op.PrevKeyValueRecordEntries, err = DecodeDeSoEncoderSlice[*KeyValueRecordEntry](rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevKeyValueRecordEntries: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, MessageReadStateMigration) {
+		// PrevMessageReadStateEntry
+		if op.PrevMessageReadStateEntry, err = DecodeDeSoEncoder(&MessageReadStateEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevMessageReadStateEntry: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, NFTBatchMigration) {
+		// PrevNFTEntries
+		if op.PrevNFTEntries, err = DecodeDeSoEncoderSlice[*NFTEntry](rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevNFTEntries: ")
+		}
+	}
+
+	if MigrationTriggered(blockHeight, NFTAvatarMigration) {
+		// PrevNFTAvatarEntry
+		if op.PrevNFTAvatarEntry, err = DecodeDeSoEncoder(&NFTAvatarEntry{}, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading PrevNFTAvatarEntry: ")
+		}
+	}
+
 	return nil
 }
 
@@ -2181,6 +2392,11 @@ func (op *UtxoOperation) GetVersionByte(blockHeight uint64) byte {
 		AssociationsAndAccessGroupsMigration,
 		BalanceModelMigration,
 		ProofOfStake1StateSetupMigration,
+		KeyValueRecordsMigration,
+		MessageReadStateMigration,
+		NFTBatchMigration,
+		UtxoOperationCompactEncodingMigration,
+		NFTAvatarMigration,
 	)
 }
 
@@ -2476,6 +2692,10 @@ type NewMessageEntry struct {
 	// Extra data
 	ExtraData map[string][]byte
 
+	// AttachmentManifest lists the chunks of the message's encrypted attachment, which is stored
+	// off-chain. It's nil if the message has no attachment. See block_view_new_message_attachments.go.
+	AttachmentManifest *MessageAttachmentManifest
+
 	isDeleted bool
 }
 
@@ -2491,6 +2711,9 @@ func (message *NewMessageEntry) RawEncodeWithoutMetadata(blockHeight uint64, ski
 	data = append(data, EncodeByteArray(message.EncryptedText)...)
 	data = append(data, UintToBuf(message.TimestampNanos)...)
 	data = append(data, EncodeExtraData(message.ExtraData)...)
+	if MigrationTriggered(blockHeight, MessageAttachmentsMigration) {
+		data = append(data, EncodeToBytes(blockHeight, message.AttachmentManifest, skipMetadata...)...)
+	}
 	return data
 }
 
@@ -2554,11 +2777,17 @@ func (message *NewMessageEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr
 		return errors.Wrapf(err, "NewMessageEntry.Decode: problem decoding extra data")
 	}
 
+	if MigrationTriggered(blockHeight, MessageAttachmentsMigration) {
+		if message.AttachmentManifest, err = DecodeDeSoEncoder(&MessageAttachmentManifest{}, rr); err != nil {
+			return errors.Wrapf(err, "NewMessageEntry.Decode: problem decoding attachment manifest")
+		}
+	}
+
 	return nil
 }
 
 func (message *NewMessageEntry) GetVersionByte(blockHeight uint64) byte {
-	return 0
+	return GetMigrationVersion(blockHeight, MessageAttachmentsMigration)
 }
 
 func (message *NewMessageEntry) GetEncoderType() EncoderType {
@@ -3899,6 +4128,15 @@ func (fe *FollowEntry) IsDeleted() bool {
 	return fe.isDeleted
 }
 
+// FollowCountEntry stores the number of PKIDs that follow a PKID and the number of PKIDs it follows. The counts
+// are updated whenever a follow is connected or disconnected, so they can be read without scanning the follow
+// mappings.
+type FollowCountEntry struct {
+	PKID           *PKID
+	FollowerCount  uint64
+	FollowingCount uint64
+}
+
 func (fe *FollowEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
 	var data []byte
 	data = append(data, EncodeToBytes(blockHeight, fe.FollowerPKID, skipMetadata...)...)
@@ -4277,6 +4515,21 @@ type GlobalParamsEntry struct {
 
 	// TimeoutIntervalMillisecondsPoS is the time in milliseconds to wait before timing out a view.
 	TimeoutIntervalMillisecondsPoS uint64
+
+	// TimeoutBackoffMultiplierBasisPointsPoS is the multiplier, in basis points, that is applied to the
+	// timeout interval for every consecutive timeout. For example, a value of 20000 doubles the time we
+	// wait before timing out a view each time the previous view timed out.
+	TimeoutBackoffMultiplierBasisPointsPoS uint64
+
+	// BlockRewardMaturityBlocks is the number of blocks, counting back from the chain tip, whose block
+	// rewards can't be spent yet after the cut-over to Proof of Stake. A value of 0 means that block rewards
+	// can be spent as soon as they're paid out.
+	BlockRewardMaturityBlocks uint64
+
+	// FeeRedistributionBasisPoints is the share, in basis points, of the fees that the BMF burns that the
+	// block producer can claim in its block reward instead after the cut-over to Proof of Stake. A value
+	// of 0 means that everything but the utility fee is burned. See block_view_fee_split.go.
+	FeeRedistributionBasisPoints uint64
 }
 
 func (gp *GlobalParamsEntry) Copy() *GlobalParamsEntry {
@@ -4310,6 +4563,9 @@ func (gp *GlobalParamsEntry) Copy() *GlobalParamsEntry {
 		MaxTxnSizeBytesPoS:                             gp.MaxTxnSizeBytesPoS,
 		BlockProductionIntervalMillisecondsPoS:         gp.BlockProductionIntervalMillisecondsPoS,
 		TimeoutIntervalMillisecondsPoS:                 gp.TimeoutIntervalMillisecondsPoS,
+		TimeoutBackoffMultiplierBasisPointsPoS:         gp.TimeoutBackoffMultiplierBasisPointsPoS,
+		BlockRewardMaturityBlocks:                      gp.BlockRewardMaturityBlocks,
+		FeeRedistributionBasisPoints:                   gp.FeeRedistributionBasisPoints,
 	}
 }
 
@@ -4349,6 +4605,15 @@ func (gp *GlobalParamsEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMe
 		data = append(data, UintToBuf(gp.BlockProductionIntervalMillisecondsPoS)...)
 		data = append(data, UintToBuf(gp.TimeoutIntervalMillisecondsPoS)...)
 	}
+	if MigrationTriggered(blockHeight, PoSTimeoutBackoffParamsMigration) {
+		data = append(data, UintToBuf(gp.TimeoutBackoffMultiplierBasisPointsPoS)...)
+	}
+	if MigrationTriggered(blockHeight, BlockRewardMaturityParamsMigration) {
+		data = append(data, UintToBuf(gp.BlockRewardMaturityBlocks)...)
+	}
+	if MigrationTriggered(blockHeight, FeeRedistributionParamsMigration) {
+		data = append(data, UintToBuf(gp.FeeRedistributionBasisPoints)...)
+	}
 	return data
 }
 
@@ -4477,11 +4742,31 @@ func (gp *GlobalParamsEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *by
 			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading TimeoutIntervalMillisecondsPoS")
 		}
 	}
+	if MigrationTriggered(blockHeight, PoSTimeoutBackoffParamsMigration) {
+		gp.TimeoutBackoffMultiplierBasisPointsPoS, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading TimeoutBackoffMultiplierBasisPointsPoS")
+		}
+	}
+	if MigrationTriggered(blockHeight, BlockRewardMaturityParamsMigration) {
+		gp.BlockRewardMaturityBlocks, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading BlockRewardMaturityBlocks")
+		}
+	}
+	if MigrationTriggered(blockHeight, FeeRedistributionParamsMigration) {
+		gp.FeeRedistributionBasisPoints, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "GlobalParamsEntry.Decode: Problem reading FeeRedistributionBasisPoints")
+		}
+	}
 	return nil
 }
 
 func (gp *GlobalParamsEntry) GetVersionByte(blockHeight uint64) byte {
-	return GetMigrationVersion(blockHeight, BalanceModelMigration, ProofOfStake1StateSetupMigration)
+	return GetMigrationVersion(
+		blockHeight, BalanceModelMigration, ProofOfStake1StateSetupMigration, PoSTimeoutBackoffParamsMigration,
+		BlockRewardMaturityParamsMigration, FeeRedistributionParamsMigration)
 }
 
 func (gp *GlobalParamsEntry) GetEncoderType() EncoderType {
@@ -6491,6 +6776,37 @@ func (associationEntry *PostAssociationEntry) Eq(other *PostAssociationEntry) bo
 		bytes.Equal(associationEntry.AssociationValue, other.AssociationValue)
 }
 
+// PostAssociationCountEntry stores the number of associations on a post with an AssociationType and an
+// AssociationValue, e.g. the number of REACTION associations with the value LIKE. The counts are updated whenever
+// a post association is connected or disconnected, so reaction counts can be read without counting associations.
+type PostAssociationCountEntry struct {
+	PostHash *BlockHash
+	// AssociationType is lowercase, since association types are case-insensitive.
+	AssociationType  []byte
+	AssociationValue []byte
+	Count            uint64
+}
+
+type PostAssociationCountMapKey struct {
+	PostHash         BlockHash
+	AssociationType  string
+	AssociationValue string
+}
+
+func NewPostAssociationCountMapKey(
+	postHash *BlockHash, associationType []byte, associationValue []byte) PostAssociationCountMapKey {
+
+	return PostAssociationCountMapKey{
+		PostHash:         *postHash,
+		AssociationType:  string(bytes.ToLower(associationType)),
+		AssociationValue: string(associationValue),
+	}
+}
+
+func (countEntry *PostAssociationCountEntry) ToMapKey() PostAssociationCountMapKey {
+	return NewPostAssociationCountMapKey(countEntry.PostHash, countEntry.AssociationType, countEntry.AssociationValue)
+}
+
 type CreateUserAssociationTxindexMetadata struct {
 	TargetUserPublicKeyBase58Check string
 	AppPublicKeyBase58Check        string
@@ -83,6 +83,19 @@ type ValidatorEntry struct {
 	// JailedAtEpochNumber tracks when a validator was first jailed. This helps to verify
 	// that enough time (epochs) have passed before the validator is able to unjail themselves.
 	JailedAtEpochNumber uint64
+	// NextVotingPublicKey is the BLS PublicKey that a RotateValidatorVotingKey transaction
+	// set to replace the VotingPublicKey at the start of VotingKeyRotationEpochNumber. It's
+	// nil unless a rotation is pending. NextVotingAuthorization is the corresponding
+	// VotingAuthorization. See block_view_validator_voting_key_rotation.go.
+	NextVotingPublicKey     *bls.PublicKey
+	NextVotingAuthorization *bls.Signature
+	// PrevVotingPublicKey is the VotingPublicKey that a rotation replaced. It remains
+	// reserved for this validator through the transition epoch, i.e. the epoch in which the
+	// rotation took effect, and is nil otherwise.
+	PrevVotingPublicKey *bls.PublicKey
+	// VotingKeyRotationEpochNumber is the epoch at which the pending or most recent rotation
+	// took effect. It's zero if no rotation is pending or in its transition epoch.
+	VotingKeyRotationEpochNumber uint64
 
 	ExtraData map[string][]byte
 	isDeleted bool
@@ -148,6 +161,10 @@ func (validatorEntry *ValidatorEntry) Copy() *ValidatorEntry {
 		TotalStakeAmountNanos:               validatorEntry.TotalStakeAmountNanos.Clone(),
 		LastActiveAtEpochNumber:             validatorEntry.LastActiveAtEpochNumber,
 		JailedAtEpochNumber:                 validatorEntry.JailedAtEpochNumber,
+		NextVotingPublicKey:                 validatorEntry.NextVotingPublicKey.Copy(),
+		NextVotingAuthorization:             validatorEntry.NextVotingAuthorization.Copy(),
+		PrevVotingPublicKey:                 validatorEntry.PrevVotingPublicKey.Copy(),
+		VotingKeyRotationEpochNumber:        validatorEntry.VotingKeyRotationEpochNumber,
 		ExtraData:                           copyExtraData(validatorEntry.ExtraData),
 		isDeleted:                           validatorEntry.isDeleted,
 	}
@@ -171,6 +188,13 @@ func (validatorEntry *ValidatorEntry) RawEncodeWithoutMetadata(blockHeight uint6
 	data = append(data, UintToBuf(validatorEntry.LastActiveAtEpochNumber)...)
 	data = append(data, UintToBuf(validatorEntry.JailedAtEpochNumber)...)
 	data = append(data, EncodeExtraData(validatorEntry.ExtraData)...)
+
+	if MigrationTriggered(blockHeight, ValidatorVotingKeyRotationMigration) {
+		data = append(data, EncodeBLSPublicKey(validatorEntry.NextVotingPublicKey)...)
+		data = append(data, EncodeBLSSignature(validatorEntry.NextVotingAuthorization)...)
+		data = append(data, EncodeBLSPublicKey(validatorEntry.PrevVotingPublicKey)...)
+		data = append(data, UintToBuf(validatorEntry.VotingKeyRotationEpochNumber)...)
+	}
 	return data
 }
 
@@ -244,11 +268,37 @@ func (validatorEntry *ValidatorEntry) RawDecodeWithoutMetadata(blockHeight uint6
 		return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading ExtraData: ")
 	}
 
+	if MigrationTriggered(blockHeight, ValidatorVotingKeyRotationMigration) {
+		// NextVotingPublicKey
+		validatorEntry.NextVotingPublicKey, err = DecodeBLSPublicKey(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading NextVotingPublicKey: ")
+		}
+
+		// NextVotingAuthorization
+		validatorEntry.NextVotingAuthorization, err = DecodeBLSSignature(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading NextVotingAuthorization: ")
+		}
+
+		// PrevVotingPublicKey
+		validatorEntry.PrevVotingPublicKey, err = DecodeBLSPublicKey(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading PrevVotingPublicKey: ")
+		}
+
+		// VotingKeyRotationEpochNumber
+		validatorEntry.VotingKeyRotationEpochNumber, err = ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ValidatorEntry.Decode: Problem reading VotingKeyRotationEpochNumber: ")
+		}
+	}
+
 	return nil
 }
 
 func (validatorEntry *ValidatorEntry) GetVersionByte(blockHeight uint64) byte {
-	return 0
+	return GetMigrationVersion(blockHeight, ValidatorVotingKeyRotationMigration)
 }
 
 func (validatorEntry *ValidatorEntry) GetEncoderType() EncoderType {
@@ -263,6 +313,30 @@ func (validatorEntry *ValidatorEntry) ToBLSPublicKeyPKIDPairEntry() *BLSPublicKe
 	}
 }
 
+// ToBLSPublicKeyPKIDPairEntries returns a BLSPublicKeyPKIDPairEntry for each BLS PublicKey that
+// is reserved for this validator: the VotingPublicKey, plus the NextVotingPublicKey and the
+// PrevVotingPublicKey while a voting key rotation is in progress.
+func (validatorEntry *ValidatorEntry) ToBLSPublicKeyPKIDPairEntries() []*BLSPublicKeyPKIDPairEntry {
+	blsPublicKeyPKIDPairEntries := []*BLSPublicKeyPKIDPairEntry{validatorEntry.ToBLSPublicKeyPKIDPairEntry()}
+	for _, blsPublicKey := range []*bls.PublicKey{validatorEntry.NextVotingPublicKey, validatorEntry.PrevVotingPublicKey} {
+		if blsPublicKey == nil {
+			continue
+		}
+		blsPublicKeyPKIDPairEntries = append(blsPublicKeyPKIDPairEntries, &BLSPublicKeyPKIDPairEntry{
+			BLSPublicKey: blsPublicKey.Copy(),
+			PKID:         validatorEntry.ValidatorPKID.NewPKID(),
+			isDeleted:    validatorEntry.isDeleted,
+		})
+	}
+	return blsPublicKeyPKIDPairEntries
+}
+
+// HasVotingKeyRotationInProgress returns true if the validator has a pending voting key
+// rotation, or if its most recent rotation is still in its transition epoch.
+func (validatorEntry *ValidatorEntry) HasVotingKeyRotationInProgress() bool {
+	return validatorEntry.NextVotingPublicKey != nil || validatorEntry.PrevVotingPublicKey != nil
+}
+
 func (validatorEntry *ValidatorEntry) IsDeleted() bool {
 	return validatorEntry.isDeleted
 }
@@ -869,6 +943,25 @@ func DBUpdateValidatorWithTxn(
 		}
 	}
 
+	// Keep PrefixValidatorVotingKeyRotationByPKID in sync with whether the validator has a voting
+	// key rotation in progress, only writing to it when that changes.
+	dbEntryHasRotation := dbEntry != nil && dbEntry.HasVotingKeyRotationInProgress()
+	if validatorEntry.HasVotingKeyRotationInProgress() && !dbEntryHasRotation {
+		key = DBKeyForValidatorVotingKeyRotationByPKID(validatorEntry.ValidatorPKID)
+		if err := DBSetWithTxn(txn, snap, key, nil, eventManager); err != nil {
+			return errors.Wrapf(
+				err, "DBUpdateValidatorWithTxn: problem storing ValidatorEntry in index PrefixValidatorVotingKeyRotationByPKID",
+			)
+		}
+	} else if !validatorEntry.HasVotingKeyRotationInProgress() && dbEntryHasRotation {
+		key = DBKeyForValidatorVotingKeyRotationByPKID(validatorEntry.ValidatorPKID)
+		if err := DBDeleteWithTxn(txn, snap, key, eventManager, true); err != nil {
+			return errors.Wrapf(
+				err, "DBUpdateValidatorWithTxn: problem deleting ValidatorEntry from index PrefixValidatorVotingKeyRotationByPKID",
+			)
+		}
+	}
+
 	return nil
 }
 
@@ -909,6 +1002,16 @@ func DBDeleteValidatorWithTxn(txn *badger.Txn, snap *Snapshot, validatorPKID *PK
 		)
 	}
 
+	// Delete ValidatorEntry.PKID from PrefixValidatorVotingKeyRotationByPKID.
+	if validatorEntry.HasVotingKeyRotationInProgress() {
+		key = DBKeyForValidatorVotingKeyRotationByPKID(validatorPKID)
+		if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(
+				err, "DBDeleteValidatorWithTxn: problem deleting ValidatorEntry from index PrefixValidatorVotingKeyRotationByPKID",
+			)
+		}
+	}
+
 	return nil
 }
 
@@ -1318,6 +1421,18 @@ func (bav *UtxoView) _connectRegisterAsValidator(
 		prevExtraData = prevValidatorEntry.ExtraData
 	}
 
+	// Retain any voting key rotation that is in progress. The metadata validation
+	// guarantees that the VotingPublicKey isn't being changed while one is.
+	var nextVotingPublicKey, prevVotingPublicKey *bls.PublicKey
+	var nextVotingAuthorization *bls.Signature
+	votingKeyRotationEpochNumber := uint64(0)
+	if prevValidatorEntry != nil {
+		nextVotingPublicKey = prevValidatorEntry.NextVotingPublicKey
+		nextVotingAuthorization = prevValidatorEntry.NextVotingAuthorization
+		prevVotingPublicKey = prevValidatorEntry.PrevVotingPublicKey
+		votingKeyRotationEpochNumber = prevValidatorEntry.VotingKeyRotationEpochNumber
+	}
+
 	// Construct new ValidatorEntry from metadata.
 	currentValidatorEntry := &ValidatorEntry{
 		ValidatorPKID: transactorPKIDEntry.PKID,
@@ -1331,6 +1446,10 @@ func (bav *UtxoView) _connectRegisterAsValidator(
 		TotalStakeAmountNanos:               totalStakeAmountNanos,
 		LastActiveAtEpochNumber:             lastActiveAtEpochNumber,
 		JailedAtEpochNumber:                 jailedAtEpochNumber,
+		NextVotingPublicKey:                 nextVotingPublicKey,
+		NextVotingAuthorization:             nextVotingAuthorization,
+		PrevVotingPublicKey:                 prevVotingPublicKey,
+		VotingKeyRotationEpochNumber:        votingKeyRotationEpochNumber,
 		ExtraData:                           mergeExtraData(prevExtraData, txn.ExtraData),
 	}
 	// Set the ValidatorEntry.
@@ -1361,14 +1480,17 @@ func (bav *UtxoView) _disconnectRegisterAsValidator(
 		return fmt.Errorf("_disconnectRegisterAsValidator: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	operationData := utxoOpsForTxn[operationIndex]
-	if operationData.Type != OperationTypeRegisterAsValidator {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeRegisterAsValidator {
 		return fmt.Errorf(
 			"_disconnectRegisterAsValidator: trying to revert %v but found %v",
 			OperationTypeRegisterAsValidator,
-			operationData.Type,
+			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
+	operationData, err := GetUtxoOperationData[ValidatorOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectRegisterAsValidator: ")
+	}
 
 	// Convert TransactorPublicKey to TransactorPKID.
 	transactorPKIDEntry := bav.GetPKIDForPublicKey(currentTxn.PublicKey)
@@ -1583,14 +1705,17 @@ func (bav *UtxoView) _disconnectUnregisterAsValidator(
 		return fmt.Errorf("_disconnectUnregisterAsValidator: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	operationData := utxoOpsForTxn[operationIndex]
-	if operationData.Type != OperationTypeUnregisterAsValidator {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeUnregisterAsValidator {
 		return fmt.Errorf(
 			"_disconnectUnregisterAsValidator: trying to revert %v but found %v",
 			OperationTypeUnregisterAsValidator,
-			operationData.Type,
+			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
+	operationData, err := GetUtxoOperationData[UnregisterAsValidatorOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUnregisterAsValidator: ")
+	}
 
 	// Restore the PrevValidatorEntry. This must always exist.
 	prevValidatorEntry := operationData.PrevValidatorEntry
@@ -1760,14 +1885,17 @@ func (bav *UtxoView) _disconnectUnjailValidator(
 		return fmt.Errorf("_disconnectUnjailValidator: utxoOperations are missing")
 	}
 	operationIndex := len(utxoOpsForTxn) - 1
-	operationData := utxoOpsForTxn[operationIndex]
-	if operationData.Type != OperationTypeUnjailValidator {
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeUnjailValidator {
 		return fmt.Errorf(
 			"_disconnectUnjailValidator: trying to revert %v but found %v",
 			OperationTypeUnjailValidator,
-			operationData.Type,
+			utxoOpsForTxn[operationIndex].Type,
 		)
 	}
+	operationData, err := GetUtxoOperationData[ValidatorOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectUnjailValidator: ")
+	}
 
 	// Convert TransactorPublicKey to TransactorPKID.
 	transactorPKIDEntry := bav.GetPKIDForPublicKey(currentTxn.PublicKey)
@@ -1879,6 +2007,14 @@ func (bav *UtxoView) IsValidRegisterAsValidatorMetadata(
 		}
 	}
 
+	// Error if changing the VotingPublicKey while a voting key rotation is in progress. The
+	// VotingPublicKey can only change through the rotation until it has completed.
+	if validatorEntry != nil &&
+		validatorEntry.HasVotingKeyRotationInProgress() &&
+		!metadata.VotingPublicKey.Eq(validatorEntry.VotingPublicKey) {
+		return errors.Wrapf(RuleErrorValidatorVotingKeyRotationInProgress, "UtxoView.IsValidRegisterAsValidatorMetadata: ")
+	}
+
 	// Error if VotingPublicKey is already taken.
 	validatorBLSPublicKeyPKIDPairEntry, err := bav.GetBLSPublicKeyPKIDPairEntry(metadata.VotingPublicKey)
 	if validatorBLSPublicKeyPKIDPairEntry != nil {
@@ -1947,17 +2083,10 @@ func (bav *UtxoView) IsValidUnjailValidatorMetadata(transactorPublicKey []byte)
 		return errors.Wrapf(err, "UtxoView.IsValidUnjailValidatorMetadata: error retrieving CurrentEpochNumber: ")
 	}
 
-	// Retrieve the ValidatorJailEpochDuration from the current global params. It's safe to use the current global
-	// params here because the changes made to locked stake do not affect the PoS consensus until they are
-	// snapshotted.
-	currentGlobalParamsEntry := bav.GetCurrentGlobalParamsEntry()
-
 	// Calculate UnjailableAtEpochNumber.
-	unjailableAtEpochNumber, err := SafeUint64().Add(
-		validatorEntry.JailedAtEpochNumber, currentGlobalParamsEntry.ValidatorJailEpochDuration,
-	)
+	unjailableAtEpochNumber, err := bav.GetUnjailableAtEpochNumber(validatorEntry)
 	if err != nil {
-		return errors.Wrapf(err, "UtxoView.IsValidUnjailValidatorMetadata: error calculating UnjailableAtEpochNumber: ")
+		return errors.Wrapf(err, "UtxoView.IsValidUnjailValidatorMetadata: ")
 	}
 
 	// Validate sufficient epochs have elapsed for validator to be unjailed.
@@ -1968,6 +2097,29 @@ func (bav *UtxoView) IsValidUnjailValidatorMetadata(transactorPublicKey []byte)
 	return nil
 }
 
+// GetUnjailableAtEpochNumber returns the first epoch in which a jailed validator can submit an UnjailValidator
+// txn, i.e. JailedAtEpochNumber + ValidatorJailEpochDuration. Validator operators can use it to schedule the
+// unjail txn once their validator is back online, rather than retrying it until it stops failing with
+// RuleErrorUnjailingValidatorTooEarly.
+func (bav *UtxoView) GetUnjailableAtEpochNumber(validatorEntry *ValidatorEntry) (uint64, error) {
+	if validatorEntry == nil || validatorEntry.Status() != ValidatorStatusJailed {
+		return 0, errors.Wrapf(RuleErrorUnjailingNonjailedValidator, "UtxoView.GetUnjailableAtEpochNumber: ")
+	}
+
+	// Retrieve the ValidatorJailEpochDuration from the current global params. It's safe to use the current global
+	// params here because the changes made to locked stake do not affect the PoS consensus until they are
+	// snapshotted.
+	currentGlobalParamsEntry := bav.GetCurrentGlobalParamsEntry()
+
+	unjailableAtEpochNumber, err := SafeUint64().Add(
+		validatorEntry.JailedAtEpochNumber, currentGlobalParamsEntry.ValidatorJailEpochDuration,
+	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "UtxoView.GetUnjailableAtEpochNumber: error calculating UnjailableAtEpochNumber: ")
+	}
+	return unjailableAtEpochNumber, nil
+}
+
 func (bav *UtxoView) SanityCheckUnregisterAsValidatorTxn(
 	transactorPKID *PKID,
 	utxoOp *UtxoOperation,
@@ -2283,9 +2435,11 @@ func (bav *UtxoView) _setValidatorEntryMappings(validatorEntry *ValidatorEntry)
 	}
 	bav.ValidatorPKIDToValidatorEntry[*validatorEntry.ValidatorPKID] = validatorEntry
 
-	// We always construct the BLSPublicKeyPKIDPairEntry from the ValidatorEntry. This is to
+	// We always construct the BLSPublicKeyPKIDPairEntries from the ValidatorEntry. This is to
 	// ensure that the two always line up.
-	bav._setValidatorBLSPublicKeyPKIDPairEntryMappings(validatorEntry.ToBLSPublicKeyPKIDPairEntry())
+	for _, blsPublicKeyPKIDPairEntry := range validatorEntry.ToBLSPublicKeyPKIDPairEntries() {
+		bav._setValidatorBLSPublicKeyPKIDPairEntryMappings(blsPublicKeyPKIDPairEntry)
+	}
 }
 
 func (bav *UtxoView) _deleteValidatorEntryMappings(validatorEntry *ValidatorEntry) {
@@ -2632,5 +2786,8 @@ const RuleErrorValidatorDisablingExistingDelegatedStakers RuleError = "RuleError
 const RuleErrorVotingPublicKeyDuplicate RuleError = "RuleErrorVotingPublicKeyDuplicate"
 const RuleErrorUnjailingNonjailedValidator RuleError = "RuleErrorUnjailingNonjailedValidator"
 const RuleErrorUnjailingValidatorTooEarly RuleError = "RuleErrorUnjailingValidatorTooEarly"
+const RuleErrorValidatorVotingKeyRotationBeforeBlockHeight RuleError = "RuleErrorValidatorVotingKeyRotationBeforeBlockHeight"
+const RuleErrorValidatorVotingKeyRotationUnchangedKey RuleError = "RuleErrorValidatorVotingKeyRotationUnchangedKey"
+const RuleErrorValidatorVotingKeyRotationInProgress RuleError = "RuleErrorValidatorVotingKeyRotationInProgress"
 
 const MaxValidatorNumDomains int = 100
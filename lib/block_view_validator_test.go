@@ -1631,6 +1631,11 @@ func _testUnjailValidator(t *testing.T, flushToDB bool) {
 		require.NoError(t, err)
 		require.NotNil(t, validatorEntry)
 		require.Equal(t, validatorEntry.Status(), ValidatorStatusJailed)
+
+		// m0 can unjail himself once ValidatorJailEpochDuration=3 epochs have passed.
+		unjailableAtEpochNumber, err := utxoView().GetUnjailableAtEpochNumber(validatorEntry)
+		require.NoError(t, err)
+		require.Equal(t, unjailableAtEpochNumber, currentEpochNumber+3)
 	}
 	{
 		// m1 stakes with m0. Succeeds. You can stake to a jailed validator.
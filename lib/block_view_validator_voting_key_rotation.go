@@ -0,0 +1,469 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// RotateValidatorVotingKey: Lets a registered validator replace its BLS voting key without
+// unregistering, which would unstake all of the stake assigned to it. The transaction sets the
+// ValidatorEntry's NextVotingPublicKey, along with a VotingAuthorization for it, and the rotation
+// takes effect at the start of the next epoch: the epoch complete hook of the current epoch makes
+// the NextVotingPublicKey the validator's VotingPublicKey before the validator set is snapshotted.
+// The validator's stake, delegations, and status are untouched.
+//
+// Both keys are tracked while the rotation is in progress. From the time the transaction is
+// connected until the end of the transition epoch, i.e. the epoch in which the new key takes
+// effect, the replaced key remains reserved for the validator and maps to it in the
+// BLSPublicKeyPKIDPairEntries, including the snapshotted ones. This lets votes and blocks signed
+// with the old key around the epoch boundary still be attributed to the validator. The old key is
+// released at the end of the transition epoch.
+//
+// A validator can only have one rotation in progress at a time, and it can't change its
+// VotingPublicKey with a RegisterAsValidator transaction until the rotation has completed.
+
+//
+// TYPES: RotateValidatorVotingKeyMetadata
+//
+
+type RotateValidatorVotingKeyMetadata struct {
+	// VotingPublicKey is the BLS PublicKey that replaces the validator's VotingPublicKey
+	// at the start of the next epoch.
+	VotingPublicKey *bls.PublicKey
+	// VotingAuthorization is the BLS signature of the SHA256(TransactorPublicKey) by the new
+	// VotingPrivateKey. See CreateValidatorVotingAuthorizationPayload.
+	VotingAuthorization *bls.Signature
+}
+
+func (txnData *RotateValidatorVotingKeyMetadata) GetTxnType() TxnType {
+	return TxnTypeRotateValidatorVotingKey
+}
+
+func (txnData *RotateValidatorVotingKeyMetadata) ToBytes(preSignature bool) ([]byte, error) {
+	var data []byte
+	data = append(data, EncodeBLSPublicKey(txnData.VotingPublicKey)...)
+	data = append(data, EncodeBLSSignature(txnData.VotingAuthorization)...)
+	return data, nil
+}
+
+func (txnData *RotateValidatorVotingKeyMetadata) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+
+	// VotingPublicKey
+	txnData.VotingPublicKey, err = DecodeBLSPublicKey(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RotateValidatorVotingKeyMetadata.FromBytes: Problem reading VotingPublicKey: ")
+	}
+
+	// VotingAuthorization
+	txnData.VotingAuthorization, err = DecodeBLSSignature(rr)
+	if err != nil {
+		return errors.Wrapf(err, "RotateValidatorVotingKeyMetadata.FromBytes: Problem reading VotingAuthorization: ")
+	}
+
+	return nil
+}
+
+func (txnData *RotateValidatorVotingKeyMetadata) New() DeSoTxnMetadata {
+	return &RotateValidatorVotingKeyMetadata{}
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForValidatorVotingKeyRotationByPKID(validatorPKID *PKID) []byte {
+	key := append([]byte{}, Prefixes.PrefixValidatorVotingKeyRotationByPKID...)
+	key = append(key, validatorPKID.ToBytes()...)
+	return key
+}
+
+// DBGetValidatorPKIDsWithVotingKeyRotationInProgress returns the PKIDs of the validators in the
+// db that have a voting key rotation in progress.
+func DBGetValidatorPKIDsWithVotingKeyRotationInProgress(handle *badger.DB) ([]*PKID, error) {
+	prefix := Prefixes.PrefixValidatorVotingKeyRotationByPKID
+	keysFound, _ := EnumerateKeysForPrefix(handle, prefix, true)
+
+	var validatorPKIDs []*PKID
+	for _, keyFound := range keysFound {
+		if len(keyFound) != len(prefix)+PublicKeyLenCompressed {
+			return nil, fmt.Errorf(
+				"DBGetValidatorPKIDsWithVotingKeyRotationInProgress: invalid key length %d", len(keyFound),
+			)
+		}
+		validatorPKIDs = append(validatorPKIDs, NewPKID(keyFound[len(prefix):]))
+	}
+	return validatorPKIDs, nil
+}
+
+//
+// BLOCKCHAIN UTILS
+//
+
+func (bc *Blockchain) CreateRotateValidatorVotingKeyTxn(
+	transactorPublicKey []byte,
+	metadata *RotateValidatorVotingKeyMetadata,
+	extraData map[string][]byte,
+	minFeeRateNanosPerKB uint64,
+	mempool Mempool,
+	additionalOutputs []*DeSoOutput,
+) (
+	_txn *MsgDeSoTxn,
+	_totalInput uint64,
+	_changeAmount uint64,
+	_fees uint64,
+	_err error,
+) {
+	// Create a txn containing the RotateValidatorVotingKey fields.
+	txn := &MsgDeSoTxn{
+		PublicKey: transactorPublicKey,
+		TxnMeta:   metadata,
+		TxOutputs: additionalOutputs,
+		ExtraData: extraData,
+		// We wait to compute the signature until
+		// we've added all the inputs and change.
+	}
+
+	// Create a new UtxoView. If we have access to a mempool object, use
+	// it to get an augmented view that factors in pending transactions.
+	utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+	if !isInterfaceValueNil(mempool) {
+		var err error
+		utxoView, err = mempool.GetAugmentedUniversalView()
+		if err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(
+				err, "Blockchain.CreateRotateValidatorVotingKeyTxn: problem getting augmented utxo view from mempool: ",
+			)
+		}
+	}
+
+	// Validate txn metadata.
+	if err := utxoView.IsValidRotateValidatorVotingKeyMetadata(transactorPublicKey, metadata); err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateRotateValidatorVotingKeyTxn: invalid txn metadata: ",
+		)
+	}
+
+	// We don't need to make any tweaks to the amount because
+	// it's basically a standard "pay per kilobyte" transaction.
+	totalInput, spendAmount, changeAmount, fees, err := bc.AddInputsAndChangeToTransaction(
+		txn, minFeeRateNanosPerKB, mempool,
+	)
+	if err != nil {
+		return nil, 0, 0, 0, errors.Wrapf(
+			err, "Blockchain.CreateRotateValidatorVotingKeyTxn: problem adding inputs: ",
+		)
+	}
+
+	// Sanity-check that the spendAmount is zero.
+	if err = amountEqualsAdditionalOutputs(spendAmount, additionalOutputs); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("Blockchain.CreateRotateValidatorVotingKeyTxn: %v", err)
+	}
+	return txn, totalInput, changeAmount, fees, nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _connectRotateValidatorVotingKey(
+	txn *MsgDeSoTxn,
+	txHash *BlockHash,
+	blockHeight uint32,
+	verifySignatures bool,
+) (
+	_totalInput uint64,
+	_totalOutput uint64,
+	_utxoOps []*UtxoOperation,
+	_err error,
+) {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.ProofOfStake1StateSetupBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.ValidatorVotingKeyRotationBlockHeight {
+		return 0, 0, nil, errors.Wrapf(
+			RuleErrorValidatorVotingKeyRotationBeforeBlockHeight, "_connectRotateValidatorVotingKey: ",
+		)
+	}
+
+	// Validate the txn TxnType.
+	if txn.TxnMeta.GetTxnType() != TxnTypeRotateValidatorVotingKey {
+		return 0, 0, nil, fmt.Errorf(
+			"_connectRotateValidatorVotingKey: called with bad TxnType %s", txn.TxnMeta.GetTxnType().String(),
+		)
+	}
+
+	// Connect a basic transfer to get the total input and the
+	// total output without considering the txn metadata.
+	totalInput, totalOutput, utxoOpsForTxn, err := bav._connectBasicTransfer(
+		txn, txHash, blockHeight, verifySignatures,
+	)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRotateValidatorVotingKey: ")
+	}
+
+	// Grab the txn metadata.
+	txMeta := txn.TxnMeta.(*RotateValidatorVotingKeyMetadata)
+
+	// Validate the txn metadata.
+	if err = bav.IsValidRotateValidatorVotingKeyMetadata(txn.PublicKey, txMeta); err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRotateValidatorVotingKey: ")
+	}
+
+	// Convert TransactorPublicKey to TransactorPKID.
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(txn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorInvalidValidatorPKID, "_connectRotateValidatorVotingKey: ")
+	}
+
+	// Retrieve the existing ValidatorEntry that will be overwritten.
+	// This ValidatorEntry will be restored if we disconnect this txn.
+	prevValidatorEntry, err := bav.GetValidatorByPKID(transactorPKIDEntry.PKID)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRotateValidatorVotingKey: ")
+	}
+	if prevValidatorEntry == nil || prevValidatorEntry.isDeleted {
+		return 0, 0, nil, errors.Wrapf(RuleErrorValidatorNotFound, "_connectRotateValidatorVotingKey: ")
+	}
+
+	// Retrieve the CurrentEpochNumber.
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRotateValidatorVotingKey: error retrieving CurrentEpochNumber: ")
+	}
+	rotationEpochNumber, err := SafeUint64().Add(currentEpochNumber, 1)
+	if err != nil {
+		return 0, 0, nil, errors.Wrapf(err, "_connectRotateValidatorVotingKey: error calculating rotation epoch number: ")
+	}
+
+	// Copy the existing ValidatorEntry and set the pending rotation.
+	currentValidatorEntry := prevValidatorEntry.Copy()
+	currentValidatorEntry.NextVotingPublicKey = txMeta.VotingPublicKey
+	currentValidatorEntry.NextVotingAuthorization = txMeta.VotingAuthorization
+	currentValidatorEntry.VotingKeyRotationEpochNumber = rotationEpochNumber
+
+	// Merge ExtraData with existing ExtraData.
+	currentValidatorEntry.ExtraData = mergeExtraData(prevValidatorEntry.ExtraData, txn.ExtraData)
+
+	// Delete the PrevValidatorEntry.
+	bav._deleteValidatorEntryMappings(prevValidatorEntry)
+
+	// Set the CurrentValidatorEntry. This also reserves the NextVotingPublicKey for the validator.
+	bav._setValidatorEntryMappings(currentValidatorEntry)
+
+	// Add a UTXO operation
+	utxoOpsForTxn = append(utxoOpsForTxn, &UtxoOperation{
+		Type:               OperationTypeRotateValidatorVotingKey,
+		PrevValidatorEntry: prevValidatorEntry,
+	})
+	return totalInput, totalOutput, utxoOpsForTxn, nil
+}
+
+func (bav *UtxoView) _disconnectRotateValidatorVotingKey(
+	operationType OperationType,
+	currentTxn *MsgDeSoTxn,
+	txHash *BlockHash,
+	utxoOpsForTxn []*UtxoOperation,
+	blockHeight uint32,
+) error {
+	// Validate the starting block height.
+	if blockHeight < bav.Params.ForkHeights.ProofOfStake1StateSetupBlockHeight ||
+		blockHeight < bav.Params.ForkHeights.ValidatorVotingKeyRotationBlockHeight {
+		return errors.Wrapf(RuleErrorValidatorVotingKeyRotationBeforeBlockHeight, "_disconnectRotateValidatorVotingKey: ")
+	}
+
+	// Validate the last operation is a RotateValidatorVotingKey operation.
+	if len(utxoOpsForTxn) == 0 {
+		return fmt.Errorf("_disconnectRotateValidatorVotingKey: utxoOperations are missing")
+	}
+	operationIndex := len(utxoOpsForTxn) - 1
+	if utxoOpsForTxn[operationIndex].Type != OperationTypeRotateValidatorVotingKey {
+		return fmt.Errorf(
+			"_disconnectRotateValidatorVotingKey: trying to revert %v but found %v",
+			OperationTypeRotateValidatorVotingKey,
+			utxoOpsForTxn[operationIndex].Type,
+		)
+	}
+	operationData, err := GetUtxoOperationData[ValidatorOperationData](utxoOpsForTxn[operationIndex])
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectRotateValidatorVotingKey: ")
+	}
+
+	// Convert TransactorPublicKey to TransactorPKID.
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(currentTxn.PublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return errors.Wrapf(RuleErrorInvalidValidatorPKID, "_disconnectRotateValidatorVotingKey: ")
+	}
+
+	// Delete the current ValidatorEntry. This also releases the NextVotingPublicKey.
+	currentValidatorEntry, err := bav.GetValidatorByPKID(transactorPKIDEntry.PKID)
+	if err != nil {
+		return errors.Wrapf(err, "_disconnectRotateValidatorVotingKey: ")
+	}
+	if currentValidatorEntry == nil {
+		return fmt.Errorf(
+			"_disconnectRotateValidatorVotingKey: no ValidatorEntry found for %v", transactorPKIDEntry.PKID,
+		)
+	}
+	bav._deleteValidatorEntryMappings(currentValidatorEntry)
+
+	// Restore the PrevValidatorEntry.
+	prevValidatorEntry := operationData.PrevValidatorEntry
+	if prevValidatorEntry == nil {
+		return fmt.Errorf(
+			"_disconnectRotateValidatorVotingKey: no PrevValidatorEntry found for %v", transactorPKIDEntry.PKID,
+		)
+	}
+	bav._setValidatorEntryMappings(prevValidatorEntry)
+
+	// Disconnect the BasicTransfer.
+	return bav._disconnectBasicTransfer(
+		currentTxn, txHash, utxoOpsForTxn[:operationIndex], blockHeight,
+	)
+}
+
+func (bav *UtxoView) IsValidRotateValidatorVotingKeyMetadata(
+	transactorPublicKey []byte,
+	metadata *RotateValidatorVotingKeyMetadata,
+) error {
+	// Validate ValidatorPKID.
+	transactorPKIDEntry := bav.GetPKIDForPublicKey(transactorPublicKey)
+	if transactorPKIDEntry == nil || transactorPKIDEntry.isDeleted {
+		return errors.Wrapf(RuleErrorInvalidValidatorPKID, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+
+	// Validate ValidatorEntry exists.
+	validatorEntry, err := bav.GetValidatorByPKID(transactorPKIDEntry.PKID)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+	if validatorEntry == nil || validatorEntry.isDeleted {
+		return errors.Wrapf(RuleErrorValidatorNotFound, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+
+	// Validate VotingPublicKey.
+	if metadata.VotingPublicKey == nil {
+		return errors.Wrapf(RuleErrorValidatorMissingVotingPublicKey, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+	cutoverValidator, err := BuildProofOfStakeCutoverValidatorBLSPublicKey()
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: error building cutover validator for validation: ")
+	}
+	if metadata.VotingPublicKey.Eq(cutoverValidator) {
+		return errors.Wrapf(RuleErrorValidatorInvalidVotingPublicKey, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+
+	// Validate VotingAuthorization.
+	if metadata.VotingAuthorization == nil {
+		return errors.Wrapf(RuleErrorValidatorMissingVotingAuthorization, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+	votingAuthorizationPayload := CreateValidatorVotingAuthorizationPayload(transactorPublicKey)
+	isValidBLSSignature, err := metadata.VotingPublicKey.Verify(metadata.VotingAuthorization, votingAuthorizationPayload)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: error verifying VotingAuthorization: ")
+	}
+	if !isValidBLSSignature {
+		return errors.Wrapf(RuleErrorValidatorInvalidVotingAuthorization, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+
+	// Error if the VotingPublicKey isn't changing.
+	if metadata.VotingPublicKey.Eq(validatorEntry.VotingPublicKey) {
+		return errors.Wrapf(RuleErrorValidatorVotingKeyRotationUnchangedKey, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+
+	// Error if a rotation is already pending or in its transition epoch.
+	if validatorEntry.HasVotingKeyRotationInProgress() {
+		return errors.Wrapf(RuleErrorValidatorVotingKeyRotationInProgress, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+
+	// Error if VotingPublicKey is already taken, whether by another validator or by
+	// one that's rotating away from it.
+	validatorBLSPublicKeyPKIDPairEntry, err := bav.GetBLSPublicKeyPKIDPairEntry(metadata.VotingPublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+	if validatorBLSPublicKeyPKIDPairEntry != nil {
+		return errors.Wrapf(RuleErrorVotingPublicKeyDuplicate, "UtxoView.IsValidRotateValidatorVotingKeyMetadata: ")
+	}
+	return nil
+}
+
+// GetValidatorsWithVotingKeyRotationInProgress returns the validators with a pending voting key
+// rotation or one that's in its transition epoch, merging the db with the UtxoView. The
+// ValidatorEntries are sorted by ValidatorPKID.
+func (bav *UtxoView) GetValidatorsWithVotingKeyRotationInProgress() ([]*ValidatorEntry, error) {
+	// Cache the ValidatorEntries with a rotation in progress in the db in the UtxoView. Entries
+	// already in the UtxoView take precedence since they may have been updated.
+	dbValidatorPKIDs, err := DBGetValidatorPKIDsWithVotingKeyRotationInProgress(bav.Handle)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UtxoView.GetValidatorsWithVotingKeyRotationInProgress: ")
+	}
+	for _, validatorPKID := range dbValidatorPKIDs {
+		if _, err = bav.GetValidatorByPKID(validatorPKID); err != nil {
+			return nil, errors.Wrapf(err, "UtxoView.GetValidatorsWithVotingKeyRotationInProgress: ")
+		}
+	}
+
+	// Pull !isDeleted ValidatorEntries with a rotation in progress from the UtxoView.
+	var validatorEntries []*ValidatorEntry
+	for _, validatorEntry := range bav.ValidatorPKIDToValidatorEntry {
+		if !validatorEntry.isDeleted && validatorEntry.HasVotingKeyRotationInProgress() {
+			validatorEntries = append(validatorEntries, validatorEntry)
+		}
+	}
+	sort.Slice(validatorEntries, func(ii, jj int) bool {
+		return bytes.Compare(validatorEntries[ii].ValidatorPKID.ToBytes(), validatorEntries[jj].ValidatorPKID.ToBytes()) < 0
+	})
+	return validatorEntries, nil
+}
+
+// AdvanceValidatorVotingKeyRotations is run by the epoch complete hook for the current epoch. A
+// pending rotation that takes effect at the next epoch makes the NextVotingPublicKey the
+// validator's VotingPublicKey, and keeps the replaced key as its PrevVotingPublicKey for the
+// transition epoch. A rotation whose transition epoch is the current epoch releases the
+// PrevVotingPublicKey.
+func (bav *UtxoView) AdvanceValidatorVotingKeyRotations(blockHeight uint64) error {
+	if blockHeight < uint64(bav.Params.ForkHeights.ValidatorVotingKeyRotationBlockHeight) {
+		return nil
+	}
+
+	currentEpochNumber, err := bav.GetCurrentEpochNumber()
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.AdvanceValidatorVotingKeyRotations: error retrieving CurrentEpochNumber: ")
+	}
+
+	validatorEntries, err := bav.GetValidatorsWithVotingKeyRotationInProgress()
+	if err != nil {
+		return errors.Wrapf(err, "UtxoView.AdvanceValidatorVotingKeyRotations: ")
+	}
+	for _, prevValidatorEntry := range validatorEntries {
+		currentValidatorEntry := prevValidatorEntry.Copy()
+		if currentValidatorEntry.NextVotingPublicKey != nil &&
+			currentValidatorEntry.VotingKeyRotationEpochNumber <= currentEpochNumber+1 {
+			// The rotation takes effect at the next epoch.
+			currentValidatorEntry.PrevVotingPublicKey = currentValidatorEntry.VotingPublicKey
+			currentValidatorEntry.VotingPublicKey = currentValidatorEntry.NextVotingPublicKey
+			currentValidatorEntry.VotingAuthorization = currentValidatorEntry.NextVotingAuthorization
+			currentValidatorEntry.NextVotingPublicKey = nil
+			currentValidatorEntry.NextVotingAuthorization = nil
+		} else if currentValidatorEntry.NextVotingPublicKey == nil &&
+			currentValidatorEntry.VotingKeyRotationEpochNumber <= currentEpochNumber {
+			// The transition epoch is over.
+			currentValidatorEntry.PrevVotingPublicKey = nil
+			currentValidatorEntry.VotingKeyRotationEpochNumber = 0
+		} else {
+			continue
+		}
+
+		// Replace the ValidatorEntry. Deleting the previous one first releases any BLS PublicKey
+		// that is no longer reserved for the validator.
+		bav._deleteValidatorEntryMappings(prevValidatorEntry)
+		bav._setValidatorEntryMappings(currentValidatorEntry)
+	}
+	return nil
+}
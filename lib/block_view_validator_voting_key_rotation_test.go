@@ -0,0 +1,391 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateValidatorVotingKey(t *testing.T) {
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	t.Run("flushToDB=false", func(t *testing.T) {
+		_testRotateValidatorVotingKey(t, false)
+	})
+	t.Run("flushToDB=true", func(t *testing.T) {
+		_testRotateValidatorVotingKey(t, true)
+	})
+}
+
+func _testRotateValidatorVotingKey(t *testing.T, flushToDB bool) {
+	var validatorEntry *ValidatorEntry
+	var err error
+
+	testMeta := _setUpValidatorVotingKeyRotationTest(t)
+	params := testMeta.params
+	mempool := testMeta.mempool
+	m0PKID := DBGetPKIDEntryForPublicKey(testMeta.db, testMeta.chain.snapshot, m0PkBytes).PKID
+
+	utxoView := func() *UtxoView {
+		newUtxoView, err := mempool.GetAugmentedUniversalView()
+		require.NoError(t, err)
+		return newUtxoView
+	}
+	getBLSPublicKeyPKID := func(blsPublicKey *bls.PublicKey) *PKID {
+		blsPublicKeyPKIDPairEntry, err := utxoView().GetBLSPublicKeyPKIDPairEntry(blsPublicKey)
+		require.NoError(t, err)
+		if blsPublicKeyPKIDPairEntry == nil {
+			return nil
+		}
+		return blsPublicKeyPKIDPairEntry.PKID
+	}
+
+	// m0 and m1 register as validators, and m1 stakes with m0.
+	m0VotingPublicKey, m0VotingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m0PkBytes)
+	_, err = _submitRegisterAsValidatorTxn(testMeta, m0Pub, m0Priv, &RegisterAsValidatorMetadata{
+		Domains:             [][]byte{[]byte("m0.com:18000")},
+		VotingPublicKey:     m0VotingPublicKey,
+		VotingAuthorization: m0VotingAuthorization,
+	}, nil, flushToDB)
+	require.NoError(t, err)
+	m1VotingPublicKey, m1VotingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m1PkBytes)
+	_, err = _submitRegisterAsValidatorTxn(testMeta, m1Pub, m1Priv, &RegisterAsValidatorMetadata{
+		Domains:             [][]byte{[]byte("m1.com:18000")},
+		VotingPublicKey:     m1VotingPublicKey,
+		VotingAuthorization: m1VotingAuthorization,
+	}, nil, flushToDB)
+	require.NoError(t, err)
+	stakeMetadata := &StakeMetadata{
+		ValidatorPublicKey: NewPublicKey(m0PkBytes),
+		StakeAmountNanos:   uint256.NewInt(100),
+	}
+	_, err = _submitStakeTxn(testMeta, m1Pub, m1Priv, stakeMetadata, nil, flushToDB)
+	require.NoError(t, err)
+
+	newVotingPrivateKey, newVotingPublicKey, newVotingAuthorization := _generateVotingPrivateKeyPublicKeyAndAuthorization(t, m0PkBytes)
+	{
+		// RuleErrorValidatorVotingKeyRotationBeforeBlockHeight
+		params.ForkHeights.ValidatorVotingKeyRotationBlockHeight = math.MaxUint32
+		_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m0Pub, m0Priv, &RotateValidatorVotingKeyMetadata{
+			VotingPublicKey:     newVotingPublicKey,
+			VotingAuthorization: newVotingAuthorization,
+		}, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorVotingKeyRotationBeforeBlockHeight)
+		params.ForkHeights.ValidatorVotingKeyRotationBlockHeight = uint32(1)
+	}
+	{
+		// RuleErrorValidatorNotFound
+		votingPublicKey, votingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m2PkBytes)
+		_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m2Pub, m2Priv, &RotateValidatorVotingKeyMetadata{
+			VotingPublicKey:     votingPublicKey,
+			VotingAuthorization: votingAuthorization,
+		}, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorNotFound)
+	}
+	{
+		// RuleErrorValidatorMissingVotingPublicKey
+		_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m0Pub, m0Priv, &RotateValidatorVotingKeyMetadata{
+			VotingAuthorization: newVotingAuthorization,
+		}, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorMissingVotingPublicKey)
+	}
+	{
+		// RuleErrorValidatorInvalidVotingAuthorization: the authorization is for another transactor.
+		votingPublicKey, votingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m1PkBytes)
+		_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m0Pub, m0Priv, &RotateValidatorVotingKeyMetadata{
+			VotingPublicKey:     votingPublicKey,
+			VotingAuthorization: votingAuthorization,
+		}, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorInvalidVotingAuthorization)
+	}
+	{
+		// RuleErrorValidatorVotingKeyRotationUnchangedKey
+		_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m0Pub, m0Priv, &RotateValidatorVotingKeyMetadata{
+			VotingPublicKey:     m0VotingPublicKey,
+			VotingAuthorization: m0VotingAuthorization,
+		}, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorVotingKeyRotationUnchangedKey)
+	}
+	{
+		// m0 rotates its voting key. The new key takes effect at the next epoch, and both
+		// keys map to m0 in the meantime. m0 keeps its stake.
+		_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m0Pub, m0Priv, &RotateValidatorVotingKeyMetadata{
+			VotingPublicKey:     newVotingPublicKey,
+			VotingAuthorization: newVotingAuthorization,
+		}, flushToDB)
+		require.NoError(t, err)
+
+		validatorEntry, err = utxoView().GetValidatorByPKID(m0PKID)
+		require.NoError(t, err)
+		require.True(t, validatorEntry.VotingPublicKey.Eq(m0VotingPublicKey))
+		require.True(t, validatorEntry.NextVotingPublicKey.Eq(newVotingPublicKey))
+		require.True(t, validatorEntry.NextVotingAuthorization.Eq(newVotingAuthorization))
+		require.Nil(t, validatorEntry.PrevVotingPublicKey)
+		require.Equal(t, uint64(2), validatorEntry.VotingKeyRotationEpochNumber)
+		require.Equal(t, uint256.NewInt(100), validatorEntry.TotalStakeAmountNanos)
+		require.True(t, getBLSPublicKeyPKID(m0VotingPublicKey).Eq(m0PKID))
+		require.True(t, getBLSPublicKeyPKID(newVotingPublicKey).Eq(m0PKID))
+
+		validatorEntries, err := utxoView().GetValidatorsWithVotingKeyRotationInProgress()
+		require.NoError(t, err)
+		require.Len(t, validatorEntries, 1)
+		require.True(t, validatorEntries[0].ValidatorPKID.Eq(m0PKID))
+	}
+	{
+		// RuleErrorValidatorVotingKeyRotationInProgress
+		votingPublicKey, votingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m0PkBytes)
+		_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m0Pub, m0Priv, &RotateValidatorVotingKeyMetadata{
+			VotingPublicKey:     votingPublicKey,
+			VotingAuthorization: votingAuthorization,
+		}, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorVotingKeyRotationInProgress)
+
+		// m0 can't change its voting key by re-registering either.
+		_, err = _submitRegisterAsValidatorTxn(testMeta, m0Pub, m0Priv, &RegisterAsValidatorMetadata{
+			Domains:             [][]byte{[]byte("m0.com:18000")},
+			VotingPublicKey:     votingPublicKey,
+			VotingAuthorization: votingAuthorization,
+		}, nil, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorValidatorVotingKeyRotationInProgress)
+	}
+	{
+		// RuleErrorVotingPublicKeyDuplicate: m1 can't take the key m0 is rotating to.
+		_, err = _submitRegisterAsValidatorTxn(testMeta, m1Pub, m1Priv, &RegisterAsValidatorMetadata{
+			Domains:             [][]byte{[]byte("m1.com:18000")},
+			VotingPublicKey:     newVotingPublicKey,
+			VotingAuthorization: _generateVotingAuthorization(t, newVotingPrivateKey, m1PkBytes),
+		}, nil, flushToDB)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), RuleErrorVotingPublicKeyDuplicate)
+	}
+	{
+		// m0 updates its domains without changing its voting key. The rotation is retained.
+		_, err = _submitRegisterAsValidatorTxn(testMeta, m0Pub, m0Priv, &RegisterAsValidatorMetadata{
+			Domains:             [][]byte{[]byte("m0.org:18000")},
+			VotingPublicKey:     m0VotingPublicKey,
+			VotingAuthorization: m0VotingAuthorization,
+		}, nil, flushToDB)
+		require.NoError(t, err)
+
+		validatorEntry, err = utxoView().GetValidatorByPKID(m0PKID)
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("m0.org:18000")}, validatorEntry.Domains)
+		require.True(t, validatorEntry.NextVotingPublicKey.Eq(newVotingPublicKey))
+		require.True(t, getBLSPublicKeyPKID(newVotingPublicKey).Eq(m0PKID))
+	}
+
+	// Flush mempool to the db and test rollbacks.
+	require.NoError(t, mempool.universalUtxoView.FlushToDb(uint64(testMeta.savedHeight)))
+	_executeAllTestRollbackAndFlush(testMeta)
+}
+
+func TestValidatorVotingKeyRotationEpochTransition(t *testing.T) {
+	// Initialize balance model fork heights.
+	setBalanceModelBlockHeights(t)
+
+	testMeta := _setUpValidatorVotingKeyRotationTest(t)
+	db := testMeta.db
+	m0PKID := DBGetPKIDEntryForPublicKey(db, testMeta.chain.snapshot, m0PkBytes).PKID
+	blockHeight := uint64(testMeta.savedHeight)
+
+	getValidatorEntry := func() *ValidatorEntry {
+		validatorEntry, err := _newUtxoView(testMeta).GetValidatorByPKID(m0PKID)
+		require.NoError(t, err)
+		return validatorEntry
+	}
+	getBLSPublicKeyPKID := func(blsPublicKey *bls.PublicKey) *PKID {
+		blsPublicKeyPKIDPairEntry, err := _newUtxoView(testMeta).GetBLSPublicKeyPKIDPairEntry(blsPublicKey)
+		require.NoError(t, err)
+		if blsPublicKeyPKIDPairEntry == nil {
+			return nil
+		}
+		return blsPublicKeyPKIDPairEntry.PKID
+	}
+	advanceEpoch := func(epochNumber uint64) {
+		tmpUtxoView := _newUtxoView(testMeta)
+		require.NoError(t, tmpUtxoView.AdvanceValidatorVotingKeyRotations(blockHeight))
+		tmpUtxoView._setCurrentEpochEntry(&EpochEntry{EpochNumber: epochNumber, FinalBlockHeight: blockHeight + 10})
+		require.NoError(t, tmpUtxoView.FlushToDb(blockHeight))
+	}
+
+	// m0 registers as a validator and rotates its voting key in epoch 1.
+	oldVotingPublicKey, oldVotingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m0PkBytes)
+	_, err := _submitRegisterAsValidatorTxn(testMeta, m0Pub, m0Priv, &RegisterAsValidatorMetadata{
+		Domains:             [][]byte{[]byte("m0.com:18000")},
+		VotingPublicKey:     oldVotingPublicKey,
+		VotingAuthorization: oldVotingAuthorization,
+	}, nil, true)
+	require.NoError(t, err)
+	newVotingPublicKey, newVotingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m0PkBytes)
+	_, err = _submitRotateValidatorVotingKeyTxn(testMeta, m0Pub, m0Priv, &RotateValidatorVotingKeyMetadata{
+		VotingPublicKey:     newVotingPublicKey,
+		VotingAuthorization: newVotingAuthorization,
+	}, true)
+	require.NoError(t, err)
+
+	// At the end of epoch 1, the new key becomes m0's VotingPublicKey, and the old key
+	// remains reserved for m0 through the transition epoch.
+	advanceEpoch(2)
+	validatorEntry := getValidatorEntry()
+	require.True(t, validatorEntry.VotingPublicKey.Eq(newVotingPublicKey))
+	require.True(t, validatorEntry.VotingAuthorization.Eq(newVotingAuthorization))
+	require.Nil(t, validatorEntry.NextVotingPublicKey)
+	require.Nil(t, validatorEntry.NextVotingAuthorization)
+	require.True(t, validatorEntry.PrevVotingPublicKey.Eq(oldVotingPublicKey))
+	require.Equal(t, uint64(2), validatorEntry.VotingKeyRotationEpochNumber)
+	require.True(t, getBLSPublicKeyPKID(oldVotingPublicKey).Eq(m0PKID))
+	require.True(t, getBLSPublicKeyPKID(newVotingPublicKey).Eq(m0PKID))
+
+	// Both keys are snapshotted with the validator during the transition epoch.
+	tmpUtxoView := _newUtxoView(testMeta)
+	tmpUtxoView._setSnapshotValidatorSetEntry(validatorEntry, 2)
+	require.NoError(t, tmpUtxoView.FlushToDb(blockHeight))
+	for _, blsPublicKey := range []*bls.PublicKey{oldVotingPublicKey, newVotingPublicKey} {
+		snapshotValidatorEntry, err := _newUtxoView(testMeta).GetSnapshotValidatorEntryByBLSPublicKey(blsPublicKey, 2)
+		require.NoError(t, err)
+		require.True(t, snapshotValidatorEntry.ValidatorPKID.Eq(m0PKID))
+	}
+
+	// m0 can't start another rotation during the transition epoch.
+	votingPublicKey, votingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m0PkBytes)
+	err = _newUtxoView(testMeta).IsValidRotateValidatorVotingKeyMetadata(m0PkBytes, &RotateValidatorVotingKeyMetadata{
+		VotingPublicKey:     votingPublicKey,
+		VotingAuthorization: votingAuthorization,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorValidatorVotingKeyRotationInProgress)
+
+	// At the end of the transition epoch, the old key is released.
+	advanceEpoch(3)
+	validatorEntry = getValidatorEntry()
+	require.True(t, validatorEntry.VotingPublicKey.Eq(newVotingPublicKey))
+	require.Nil(t, validatorEntry.PrevVotingPublicKey)
+	require.Zero(t, validatorEntry.VotingKeyRotationEpochNumber)
+	require.Nil(t, getBLSPublicKeyPKID(oldVotingPublicKey))
+	require.True(t, getBLSPublicKeyPKID(newVotingPublicKey).Eq(m0PKID))
+	validatorEntries, err := _newUtxoView(testMeta).GetValidatorsWithVotingKeyRotationInProgress()
+	require.NoError(t, err)
+	require.Empty(t, validatorEntries)
+
+	// m0 can rotate again.
+	require.NoError(t, _newUtxoView(testMeta).IsValidRotateValidatorVotingKeyMetadata(m0PkBytes, &RotateValidatorVotingKeyMetadata{
+		VotingPublicKey:     votingPublicKey,
+		VotingAuthorization: votingAuthorization,
+	}))
+}
+
+func _setUpValidatorVotingKeyRotationTest(t *testing.T) *TestMeta {
+	// Initialize test chain and miner.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+
+	// Initialize PoS fork heights.
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = uint32(1)
+	params.ForkHeights.ValidatorVotingKeyRotationBlockHeight = uint32(1)
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+	chain.snapshot = nil
+
+	// Mine a few blocks to give the senderPkString some money.
+	for ii := 0; ii < 10; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(t, err)
+	}
+
+	// We build the testMeta obj after mining blocks so that we save the correct block height.
+	blockHeight := uint64(chain.blockTip().Height + 1)
+	testMeta := &TestMeta{
+		t:                 t,
+		chain:             chain,
+		params:            params,
+		db:                db,
+		mempool:           mempool,
+		miner:             miner,
+		savedHeight:       uint32(blockHeight),
+		feeRateNanosPerKb: uint64(101),
+	}
+
+	_registerOrTransferWithTestMeta(testMeta, "m0", senderPkString, m0Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m1", senderPkString, m1Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "m2", senderPkString, m2Pub, senderPrivString, 1e3)
+	_registerOrTransferWithTestMeta(testMeta, "", senderPkString, paramUpdaterPub, senderPrivString, 1e3)
+
+	// Seed a CurrentEpochEntry.
+	epochUtxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, chain.eventManager)
+	epochUtxoView._setCurrentEpochEntry(&EpochEntry{EpochNumber: 1, FinalBlockHeight: blockHeight + 10})
+	require.NoError(t, epochUtxoView.FlushToDb(blockHeight))
+
+	// ParamUpdater set MinFeeRateNanos.
+	params.ExtraRegtestParamUpdaterKeys[MakePkMapKey(paramUpdaterPkBytes)] = true
+	_updateGlobalParamsEntryWithExtraData(
+		testMeta,
+		testMeta.feeRateNanosPerKb,
+		paramUpdaterPub,
+		paramUpdaterPriv,
+		map[string][]byte{},
+	)
+	return testMeta
+}
+
+func _submitRotateValidatorVotingKeyTxn(
+	testMeta *TestMeta,
+	transactorPublicKeyBase58Check string,
+	transactorPrivateKeyBase58Check string,
+	metadata *RotateValidatorVotingKeyMetadata,
+	flushToDB bool,
+) (_fees uint64, _err error) {
+	// Record transactor's prevBalance.
+	prevBalance := _getBalance(testMeta.t, testMeta.chain, testMeta.mempool, transactorPublicKeyBase58Check)
+
+	// Convert PublicKeyBase58Check to PkBytes.
+	updaterPkBytes, _, err := Base58CheckDecode(transactorPublicKeyBase58Check)
+	require.NoError(testMeta.t, err)
+
+	// Create the transaction.
+	txn, totalInputMake, changeAmountMake, feesMake, err := testMeta.chain.CreateRotateValidatorVotingKeyTxn(
+		updaterPkBytes,
+		metadata,
+		nil,
+		testMeta.feeRateNanosPerKb,
+		testMeta.mempool,
+		[]*DeSoOutput{},
+	)
+	if err != nil {
+		return 0, err
+	}
+	require.Equal(testMeta.t, totalInputMake, changeAmountMake+feesMake)
+
+	// Sign the transaction now that its inputs are set up.
+	_signTxn(testMeta.t, txn, transactorPrivateKeyBase58Check)
+
+	// Connect the transaction.
+	utxoOps, totalInput, totalOutput, fees, err := testMeta.mempool.universalUtxoView.ConnectTransaction(
+		txn, txn.Hash(), testMeta.savedHeight, 0, true, false)
+	if err != nil {
+		return 0, err
+	}
+	require.Equal(testMeta.t, totalInput, totalOutput+fees)
+	require.Equal(testMeta.t, totalInput, totalInputMake)
+	require.Equal(testMeta.t, OperationTypeRotateValidatorVotingKey, utxoOps[len(utxoOps)-1].Type)
+	if flushToDB {
+		require.NoError(testMeta.t, testMeta.mempool.universalUtxoView.FlushToDb(uint64(testMeta.savedHeight)))
+	}
+	require.NoError(testMeta.t, testMeta.mempool.RegenerateReadOnlyView())
+
+	// Record the txn.
+	testMeta.expectedSenderBalances = append(testMeta.expectedSenderBalances, prevBalance)
+	testMeta.txnOps = append(testMeta.txnOps, utxoOps)
+	testMeta.txns = append(testMeta.txns, txn)
+	return fees, nil
+}
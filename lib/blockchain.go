@@ -20,6 +20,7 @@ import (
 	"github.com/decred/dcrd/container/lru"
 
 	"github.com/deso-protocol/core/collections"
+	"github.com/deso-protocol/core/consensus"
 
 	"github.com/deso-protocol/uint256"
 	"github.com/google/uuid"
@@ -601,6 +602,31 @@ type Blockchain struct {
 	//
 	checkpointBlockInfoLock sync.RWMutex
 
+	// blockCheckpoints maps block heights to the hash that the block at that height must have. It is seeded from
+	// DeSoParams.BlockCheckpoints and can be extended with AddBlockCheckpoints. See BlockCheckpoint.
+	blockCheckpoints map[uint64]*BlockHash
+	// blockCheckpointHeights holds the keys of blockCheckpoints in increasing order.
+	blockCheckpointHeights []uint64
+
+	// maxReorgDepth is the deepest PoW reorg that is applied without operator approval, or zero for no limit.
+	// pendingReorg is the latest reorg that was held for being deeper, and approvedReorgTipHash is the fork tip the
+	// operator approved a reorg to. See reorg_guard.go.
+	maxReorgDepth        uint64
+	pendingReorg         *PendingReorg
+	approvedReorgTipHash *BlockHash
+
+	// undoDataRetentionBlocks is the number of final blocks whose UtxoOperations are kept, or zero to keep the
+	// UtxoOperations of every block. See undo_data_pruning.go.
+	undoDataRetentionBlocks uint64
+
+	// aggregatedPublicKeyCache caches the aggregated BLS public keys of the signers of the QCs we validate, so that
+	// QCs signed by the same validators in the same epoch don't need their signers' keys re-aggregated.
+	aggregatedPublicKeyCache *consensus.AggregatedPublicKeyCache
+
+	// traceSpan is the span of the block that is being processed. It is only set while the ChainLock is held,
+	// and is the parent of the spans started by the views used to process the block.
+	traceSpan TraceSpan
+
 	timer *Timer
 }
 
@@ -1002,6 +1028,8 @@ func NewBlockchain(
 
 		checkpointSyncingProviders: checkpointSyncingProviders,
 
+		aggregatedPublicKeyCache: consensus.NewAggregatedPublicKeyCache(consensus.DefaultAggregatedPublicKeyCacheSize),
+
 		orphanList: list.New(),
 		timer:      timer,
 	}
@@ -1022,12 +1050,47 @@ func NewBlockchain(
 		return nil, errors.Wrapf(err, "NewBlockchain: ")
 	}
 
+	if err := ValidateSoftForkDeployments(params); err != nil {
+		return nil, errors.Wrapf(err, "NewBlockchain: ")
+	}
+
+	// Seed the checkpoints from the params. This also verifies that the chain we loaded from the db
+	// doesn't conflict with any of them.
+	if err := bc.addBlockCheckpointsNoLock(params.BlockCheckpoints); err != nil {
+		return nil, errors.Wrapf(err, "NewBlockchain: ")
+	}
+
 	// always update the checkpoint block info when creating a new blockchain
 	bc.updateCheckpointBlockInfo()
 
 	return bc, nil
 }
 
+// NewBlockchainFromNodeConfig creates a Blockchain with the tunables in the NodeConfig. The config's block
+// checkpoints aren't added; call AddBlockCheckpoints for that.
+func NewBlockchainFromNodeConfig(
+	config *NodeConfig,
+	timeSource chainlib.MedianTimeSource,
+	db *badger.DB,
+	postgres *Postgres,
+	eventManager *EventManager,
+	snapshot *Snapshot,
+) (*Blockchain, error) {
+	return NewBlockchain(
+		config.TrustedBlockProducerPublicKeys,
+		config.TrustedBlockProducerStartHeight,
+		config.MaxSyncBlockHeight,
+		config.Params,
+		timeSource,
+		db,
+		postgres,
+		eventManager,
+		snapshot,
+		IsNodeArchival(config.SyncType),
+		config.CheckpointSyncingProviders,
+	)
+}
+
 // log2FloorMasks defines the masks to use when quickly calculating
 // floor(log2(x)) in a constant log2(32) = 5 steps, where x is a uint32, using
 // shifts.  They are derived from (2^(2^x) - 1) * (2^(2^x)), for x in 4..0.
@@ -2040,6 +2103,11 @@ func (bc *Blockchain) processHeaderPoW(blockHeader *MsgDeSoHeader, headerHash *B
 		return false, false, HeaderErrorDuplicateHeader
 	}
 
+	// Reject the header if it conflicts with a checkpoint.
+	if err := bc.checkHeaderAgainstBlockCheckpoints(headerHash, blockHeader.Height); err != nil {
+		return false, false, errors.Wrapf(err, "processHeaderPoW: ")
+	}
+
 	// If we're here then it means we're processing a header we haven't
 	// seen before.
 
@@ -2118,6 +2186,12 @@ func (bc *Blockchain) processHeaderPoW(blockHeader *MsgDeSoHeader, headerHash *B
 		return false, false, HeaderErrorTimestampTooEarly
 	}
 
+	// Make sure the block timestamp is greater than the median time past of the
+	// previous block. See median_time_past.go.
+	if !bc.isBlockTimestampAfterMedianTimePast(blockHeader) {
+		return false, false, HeaderErrorTimestampNotAfterMedianTimePast
+	}
+
 	// Check that the proof of work beats the difficulty as calculated from
 	// the parent block. Note that if the parent block is in the block index
 	// then it has necessarily had its difficulty validated, and so using it to
@@ -2230,6 +2304,9 @@ func (bc *Blockchain) ProcessBlock(desoBlock *MsgDeSoBlock, verifySignatures boo
 		return false, false, nil, fmt.Errorf("ProcessBlock: Block is nil")
 	}
 
+	endTraceSpan := bc.startBlockTraceSpan("Blockchain.ProcessBlock", desoBlock)
+	defer func() { endTraceSpan(_err) }()
+
 	// If the block's height is after the PoS cut-over fork height, then we use the PoS block processing logic.
 	// Otherwise, fall back to the PoW logic.
 	if bc.params.IsPoSBlockHeight(desoBlock.Header.Height) {
@@ -2240,6 +2317,21 @@ func (bc *Blockchain) ProcessBlock(desoBlock *MsgDeSoBlock, verifySignatures boo
 	return isMainChain, isOrphan, nil, err
 }
 
+// startBlockTraceSpan starts the span that the processing of the block is traced under, and returns the
+// function that ends it. It must be called with the ChainLock held, and the span must be ended before the
+// ChainLock is released.
+func (bc *Blockchain) startBlockTraceSpan(name string, block *MsgDeSoBlock) func(err error) {
+	span := StartTraceSpan(name, nil)
+	if span.IsRecording() {
+		span.SetAttributes(blockTraceAttributes(block)...)
+	}
+	bc.traceSpan = span
+	return func(err error) {
+		bc.traceSpan = nil
+		EndTraceSpan(span, err)
+	}
+}
+
 func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures bool) (_isMainChain bool, _isOrphan bool, err error) {
 	// Only accept the block if its height is below the PoS cutover height.
 	if !bc.params.IsPoWBlockHeight(desoBlock.Header.Height) {
@@ -2485,7 +2577,7 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		// This is needed for disconnects, otherwise GetBlock() will fail (e.g. when we reorg).
 		if err == nil {
 			err = bc.db.Update(func(txn *badger.Txn) error {
-				if err := PutBlockWithTxn(txn, nil, desoBlock, bc.eventManager); err != nil {
+				if err := PutBlockWithTxn(txn, nil, desoBlock, GetBlockSegmentStore(bc.db), bc.eventManager); err != nil {
 					return errors.Wrapf(err, "ProcessBlock: Problem putting block with txns")
 				}
 				return nil
@@ -2504,7 +2596,8 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 			// 	set in PutBlockWithTxn. Block rewards are part of the state, and they should be identical to the ones
 			// 	we've fetched during Hypersync. Is there an edge-case where for some reason they're not identical? Or
 			// 	somehow ancestral records get corrupted?
-			if innerErr := PutBlockWithTxn(txn, bc.snapshot, desoBlock, bc.eventManager); innerErr != nil {
+			if innerErr := PutBlockWithTxn(
+				txn, bc.snapshot, desoBlock, GetBlockSegmentStore(bc.db), bc.eventManager); innerErr != nil {
 				return errors.Wrapf(err, "ProcessBlock: Problem calling PutBlock")
 			}
 
@@ -2589,6 +2682,7 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 				"not the current tip hash (%v)", bc.blockView.TipHash, currentTip.Hash)
 		}
 
+		bc.blockView.traceSpan = bc.traceSpan
 		utxoOpsForBlock, err := bc.blockView.ConnectBlock(desoBlock, txHashes, verifySignatures, nil, blockHeight)
 		if err != nil {
 			if IsRuleError(err) {
@@ -2739,6 +2833,10 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		// as in our in-memory node tree data structure (which is also stored on disk).
 		// Eventually, if enough work gets added to the block, then we'll
 		// add it via a reorg.
+	} else if bc.holdReorgForApproval(currentTip, nodeToValidate) {
+		// The block would trigger a reorg that is deeper than the max reorg depth, and
+		// the operator hasn't approved it. The block stays stored, like a block with less
+		// work, and the reorg is applied once the operator approves it.
 	} else {
 		// In this case the block is not attached to our tip and the cumulative work
 		// of the block is greater than our tip. This means we have a fork that has
@@ -2772,6 +2870,7 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 		// almost certainly be more efficient than doing a separate db call for each input
 		// and output
 		utxoView := NewUtxoView(bc.db, bc.params, bc.postgres, bc.snapshot, bc.eventManager)
+		utxoView.traceSpan = bc.traceSpan
 
 		// Verify that the utxo view is pointing to the current tip.
 		if *utxoView.TipHash != *currentTip.Hash {
@@ -3009,6 +3108,8 @@ func (bc *Blockchain) processBlockPoW(desoBlock *MsgDeSoBlock, verifySignatures
 	if bc.snapshot != nil {
 		bc.snapshot.FinishProcessBlock(bc.blockTip())
 	}
+	// Now that the tip may have moved, the undo data of more blocks may be final and past the retention.
+	bc.pruneUndoData()
 	// If we've made it this far, the block has been validated and we have either added
 	// the block to the tip, done nothing with it (because its cumwork isn't high enough)
 	// or added it via a reorg and the db and our in-memory data structures reflect this
@@ -5043,6 +5144,78 @@ func (bc *Blockchain) CreateBasicTransferTxnWithDiamonds(
 	return txn, totalInput, spendAmount, changeAmount, fees, nil
 }
 
+// CreateBatchBasicTransferTxn creates a single basic transfer that pays all of the outputs, e.g. for an airdrop.
+// A basic transfer can carry any number of outputs, so the whole batch is covered by one signature and, after
+// the balance model fork, one nonce, instead of a txn per recipient. Outputs to the same public key are merged
+// so that each recipient only takes up one output.
+func (bc *Blockchain) CreateBatchBasicTransferTxn(
+	senderPublicKey []byte,
+	outputs []*DeSoOutput,
+	extraData map[string][]byte,
+	// Standard transaction fields
+	minFeeRateNanosPerKB uint64, mempool Mempool) (
+	_txn *MsgDeSoTxn, _totalInput uint64, _spendAmount uint64, _changeAmount uint64, _fees uint64, _err error) {
+
+	if len(outputs) == 0 {
+		return nil, 0, 0, 0, 0, fmt.Errorf("CreateBatchBasicTransferTxn: Must have at least one output")
+	}
+
+	// Merge the outputs by public key, keeping the order in which each recipient first appears.
+	var mergedOutputs []*DeSoOutput
+	outputIndexByPublicKey := make(map[PublicKey]int)
+	for _, output := range outputs {
+		if len(output.PublicKey) != btcec.PubKeyBytesLenCompressed {
+			return nil, 0, 0, 0, 0, fmt.Errorf(
+				"CreateBatchBasicTransferTxn: Invalid output public key length %d", len(output.PublicKey))
+		}
+		outputIndex, exists := outputIndexByPublicKey[*NewPublicKey(output.PublicKey)]
+		if !exists {
+			outputIndexByPublicKey[*NewPublicKey(output.PublicKey)] = len(mergedOutputs)
+			mergedOutputs = append(mergedOutputs, &DeSoOutput{
+				PublicKey:   output.PublicKey,
+				AmountNanos: output.AmountNanos,
+			})
+			continue
+		}
+		mergedAmountNanos, err := SafeUint64().Add(mergedOutputs[outputIndex].AmountNanos, output.AmountNanos)
+		if err != nil {
+			return nil, 0, 0, 0, 0, errors.Wrapf(err,
+				"CreateBatchBasicTransferTxn: Problem merging outputs for public key %v: ",
+				PkToString(output.PublicKey, bc.params))
+		}
+		mergedOutputs[outputIndex].AmountNanos = mergedAmountNanos
+	}
+
+	// Build the basic transfer txn.
+	txn := &MsgDeSoTxn{
+		PublicKey: senderPublicKey,
+		TxnMeta:   &BasicTransferMetadata{},
+		TxOutputs: mergedOutputs,
+		ExtraData: extraData,
+		// TxInputs will be set below.
+		// This function does not compute a signature.
+	}
+
+	totalInput, spendAmount, changeAmount, fees, err :=
+		bc.AddInputsAndChangeToTransaction(txn, minFeeRateNanosPerKB, mempool)
+	if err != nil {
+		return nil, 0, 0, 0, 0, errors.Wrapf(
+			err, "CreateBatchBasicTransferTxn: Problem adding inputs: ")
+	}
+
+	// We want our transaction to have at least one input, even if it all
+	// goes to change. This ensures that the transaction will not be "replayable."
+	if len(txn.TxInputs) == 0 &&
+		bc.blockTip().Height+1 < bc.params.ForkHeights.BalanceModelBlockHeight {
+
+		return nil, 0, 0, 0, 0, fmt.Errorf(
+			"CreateBatchBasicTransferTxn: Txn must have at" +
+				" least one input but had zero inputs instead. Try increasing the fee rate.")
+	}
+
+	return txn, totalInput, spendAmount, changeAmount, fees, nil
+}
+
 func (bc *Blockchain) CreateMaxSpend(
 	senderPkBytes []byte, recipientPkBytes []byte, extraData map[string][]byte, minFeeRateNanosPerKB uint64,
 	mempool Mempool, additionalOutputs []*DeSoOutput) (
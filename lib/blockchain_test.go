@@ -249,7 +249,7 @@ func NewLowDifficultyBlockchainWithParamsAndDb(t *testing.T, params *DeSoParams,
 	// key have some DeSo
 	var snap *Snapshot
 	if !usePostgres {
-		snap, err, _, _ = NewSnapshot(db, SnapshotBlockHeightPeriod, false, false, &testParams, false, HypersyncDefaultMaxQueueSize, nil)
+		snap, err, _, _ = NewSnapshot(db, SnapshotBlockHeightPeriod, false, false, &testParams, false, HypersyncDefaultMaxQueueSize, HypersyncDefaultChunkApplyWorkers, nil)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -347,7 +347,7 @@ func NewTestMiner(t *testing.T, chain *Blockchain, params *DeSoParams, isSender
 		0, 10,
 		blockSignerSeed,
 		mempool, chain,
-		params, chain.postgres)
+		params, chain.postgres, nil, false)
 	require.NoError(err)
 
 	newMiner, err := NewDeSoMiner(minerPubKeys, 1 /*numThreads*/, blockProducer, params)
@@ -936,11 +936,10 @@ func _signTxnWithDerivedKeyAndType(t *testing.T, txn *MsgDeSoTxn, privKeyStrBase
 		require.NoError(err)
 		txn.Signature.SetSignature(txnSignature)
 	} else {
-		txBytes, err := txn.ToBytes(true /*preSignature*/)
+		_, txHash, err := ComputeTxnSignatureDigest(txn)
 		require.NoError(err)
-		txHash := Sha256DoubleHash(txBytes)[:]
 
-		desoSignature := SignRecoverable(txHash, privateKey)
+		desoSignature := SignRecoverable(txHash[:], privateKey)
 		txn.Signature = *desoSignature
 	}
 }
@@ -24,6 +24,7 @@ import (
 // - PoS Validator Timeout:     (0x02, view uint64, highQCView uint64)
 // - PoS Validator Handshake:   (0x04, peer's random nonce, our node's random nonce)
 // - PoS Random Seed Signature: (previous block's random seed hash)
+// - Snapshot State Root:       (0x04, snapshot height, block hash, state root, num chunks)
 
 type BLSSignatureOpCode byte
 
@@ -31,6 +32,7 @@ const (
 	BLSSignatureOpCodeValidatorVote         BLSSignatureOpCode = BLSSignatureOpCode(consensus.SignatureOpCodeValidatorVote)
 	BLSSignatureOpCodeValidatorTimeout      BLSSignatureOpCode = BLSSignatureOpCode(consensus.SignatureOpCodeValidatorTimeout)
 	BLSSignatureOpCodePoSValidatorHandshake BLSSignatureOpCode = 3
+	BLSSignatureOpCodeSnapshotStateRoot     BLSSignatureOpCode = 4
 )
 
 func GetAllBLSSignatureOpCodes() []BLSSignatureOpCode {
@@ -38,6 +40,7 @@ func GetAllBLSSignatureOpCodes() []BLSSignatureOpCode {
 		BLSSignatureOpCodeValidatorVote,
 		BLSSignatureOpCodeValidatorTimeout,
 		BLSSignatureOpCodePoSValidatorHandshake,
+		BLSSignatureOpCodeSnapshotStateRoot,
 	}
 }
 
@@ -88,6 +91,10 @@ func (keystore *BLSKeystore) GetSigner() *BLSSigner {
 
 type BLSSigner struct {
 	privateKey *bls.PrivateKey
+
+	// slashingProtectionDB is optional. When set, every vote and timeout signature is checked against
+	// and recorded in it before the signature is produced. See SlashingProtectionDB for details.
+	slashingProtectionDB *SlashingProtectionDB
 }
 
 func NewBLSSigner(privateKey *bls.PrivateKey) (*BLSSigner, error) {
@@ -97,6 +104,23 @@ func NewBLSSigner(privateKey *bls.PrivateKey) (*BLSSigner, error) {
 	return &BLSSigner{privateKey: privateKey}, nil
 }
 
+// SetSlashingProtectionDB attaches a SlashingProtectionDB to the signer. The database is bound to the
+// signer's public key, so attaching a database that was used by a different key fails.
+func (signer *BLSSigner) SetSlashingProtectionDB(slashingProtectionDB *SlashingProtectionDB) error {
+	if slashingProtectionDB == nil {
+		return errors.New("BLSSigner.SetSlashingProtectionDB: slashingProtectionDB cannot be nil")
+	}
+	if err := slashingProtectionDB.CheckAndSetPublicKey(signer.GetPublicKey()); err != nil {
+		return errors.Wrapf(err, "BLSSigner.SetSlashingProtectionDB: ")
+	}
+	signer.slashingProtectionDB = slashingProtectionDB
+	return nil
+}
+
+func (signer *BLSSigner) GetSlashingProtectionDB() *SlashingProtectionDB {
+	return signer.slashingProtectionDB
+}
+
 func (signer *BLSSigner) GetPublicKey() *bls.PublicKey {
 	return signer.privateKey.PublicKey()
 }
@@ -112,11 +136,21 @@ func (signer *BLSSigner) SignBlockProposal(view uint64, blockHash consensus.Bloc
 }
 
 func (signer *BLSSigner) SignValidatorVote(view uint64, blockHash consensus.BlockHash) (*bls.Signature, error) {
+	if signer.slashingProtectionDB != nil {
+		if err := signer.slashingProtectionDB.CheckAndRecordVote(view, blockHash); err != nil {
+			return nil, errors.Wrapf(err, "BLSSigner.SignValidatorVote: ")
+		}
+	}
 	payload := consensus.GetVoteSignaturePayload(view, blockHash)
 	return signer.privateKey.Sign(payload[:])
 }
 
 func (signer *BLSSigner) SignValidatorTimeout(view uint64, highQCView uint64) (*bls.Signature, error) {
+	if signer.slashingProtectionDB != nil {
+		if err := signer.slashingProtectionDB.CheckAndRecordTimeout(view, highQCView); err != nil {
+			return nil, errors.Wrapf(err, "BLSSigner.SignValidatorTimeout: ")
+		}
+	}
 	payload := consensus.GetTimeoutSignaturePayload(view, highQCView)
 	return signer.privateKey.Sign(payload[:])
 }
@@ -135,6 +169,19 @@ func (signer *BLSSigner) SignPoSValidatorHandshake(nonceSent uint64, nonceReceiv
 	return signer.privateKey.Sign(getPoSValidatorHandshakePayload(nonceSent, nonceReceived, tstampMicro))
 }
 
+func getSnapshotStateRootPayload(stateRoot *SnapshotStateRoot) []byte {
+	payload := []byte{byte(BLSSignatureOpCodeSnapshotStateRoot)}
+	payload = append(payload, UintToBuf(stateRoot.SnapshotBlockHeight)...)
+	payload = append(payload, stateRoot.CurrentEpochBlockHash.ToBytes()...)
+	payload = append(payload, stateRoot.StateRoot.ToBytes()...)
+	payload = append(payload, UintToBuf(stateRoot.NumChunks)...)
+	return payload
+}
+
+func (signer *BLSSigner) SignSnapshotStateRoot(stateRoot *SnapshotStateRoot) (*bls.Signature, error) {
+	return signer.privateKey.Sign(getSnapshotStateRootPayload(stateRoot))
+}
+
 //////////////////////////////////////////////////////////
 // BLS Verification
 //////////////////////////////////////////////////////////
@@ -163,3 +210,7 @@ func BLSVerifyPoSValidatorHandshake(
 	payload := getPoSValidatorHandshakePayload(nonceSent, nonceReceived, tstampMicro)
 	return _blsVerify(payload[:], signature, publicKey)
 }
+
+func BLSVerifySnapshotStateRoot(stateRoot *SnapshotStateRoot, signature *bls.Signature, publicKey *bls.PublicKey) (bool, error) {
+	return _blsVerify(getSnapshotStateRootPayload(stateRoot), signature, publicKey)
+}
@@ -42,10 +42,11 @@ func TestNewBLSKeystore(t *testing.T) {
 
 func TestUniqueBLSSignatureOpCodes(t *testing.T) {
 	opCodes := GetAllBLSSignatureOpCodes()
-	require.Len(t, opCodes, 3)
+	require.Len(t, opCodes, 4)
 	require.Contains(t, opCodes, BLSSignatureOpCodeValidatorVote)
 	require.Contains(t, opCodes, BLSSignatureOpCodeValidatorTimeout)
 	require.Contains(t, opCodes, BLSSignatureOpCodePoSValidatorHandshake)
+	require.Contains(t, opCodes, BLSSignatureOpCodeSnapshotStateRoot)
 
 	// Ensure no duplicates
 	uniqueOpCodes := make(map[BLSSignatureOpCode]struct{})
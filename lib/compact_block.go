@@ -0,0 +1,696 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/deso-protocol/go-deadlock"
+	"github.com/pkg/errors"
+)
+
+// Compact Blocks
+//
+// Relaying a new block with an INV costs the receiving node a round trip for the block, and the block carries every
+// transaction in it, even though the receiving node already has most of them in its mempool. With block times as
+// short as PoS makes them, that's most of the time it takes a block to reach the network. Compact block relay
+// announces a new block with a COMPACT_BLOCK that the receiving node can usually turn into the full block on its
+// own:
+//  1. When a node accepts a new block, it sends a COMPACT_BLOCK to each peer that sets the SFCompactBlocks service
+//     flag, and an INV to the others. The COMPACT_BLOCK has the block's header and BlockProducerInfo, the salted
+//     short ID of each of the block's transactions, and, in full, the transactions the peer can't have in its
+//     mempool, i.e. the block reward.
+//  2. The peer reconstructs the block from its mempool. If it has every transaction, it processes the block right
+//     away, without any round trip.
+//  3. Otherwise, the peer requests the transactions it's missing by index with a GET_BLOCK_TXNS, which the node
+//     answers with a BLOCK_TXNS, and processes the block once it has them.
+//
+// The peer checks the reconstructed block against the merkle root of its header, and falls back to requesting the
+// full block with GetBlocks if it doesn't match, e.g. because two transactions' short IDs collide, or if the node
+// doesn't answer its GET_BLOCK_TXNS in time. A peer that's still syncing, or that doesn't have the block's parent,
+// treats the COMPACT_BLOCK as an INV for the block.
+//
+// Short IDs are derived from a random salt picked for every block with TxnShortID, see txn_reconciliation.go, so
+// that an attacker can't craft transactions whose short IDs collide with the ones of a block.
+
+const (
+	// compactBlockTxnsTimeout is how long a peer waits for the BLOCK_TXNS answering its GET_BLOCK_TXNS before it
+	// requests the full block instead.
+	compactBlockTxnsTimeout = 10 * time.Second
+
+	// maxPendingCompactBlocksPerPeer is the number of compact blocks a node waits on the missing transactions of
+	// from a single peer. The full block is requested for the oldest one if another compact block comes in.
+	maxPendingCompactBlocksPerPeer = 8
+)
+
+// ==================================================================
+// Compact block messages
+// ==================================================================
+
+// CompactBlockPrefilledTxn is a transaction that a COMPACT_BLOCK carries in full.
+type CompactBlockPrefilledTxn struct {
+	// Index is the index of the transaction in the block.
+	Index uint64
+	Txn   *MsgDeSoTxn
+}
+
+// MsgDeSoCompactBlock announces a new block with the short IDs of its transactions. See the top of this file.
+type MsgDeSoCompactBlock struct {
+	Header            *MsgDeSoHeader
+	BlockProducerInfo *BlockProducerInfo
+	// Salt is the salt of the short IDs.
+	Salt uint64
+	// ShortIDs are the short IDs of the transactions of the block that aren't prefilled, in the order they appear
+	// in the block.
+	ShortIDs []uint64
+	// PrefilledTxns are the transactions of the block that are sent in full, in the order they appear in the block.
+	PrefilledTxns []*CompactBlockPrefilledTxn
+}
+
+// NewCompactBlock returns the compact block of blk, with short IDs derived from salt. The block reward is prefilled.
+func NewCompactBlock(blk *MsgDeSoBlock, salt uint64) (*MsgDeSoCompactBlock, error) {
+	if blk == nil || blk.Header == nil {
+		return nil, fmt.Errorf("NewCompactBlock: Block or header is nil")
+	}
+	compactBlock := &MsgDeSoCompactBlock{
+		Header:            blk.Header,
+		BlockProducerInfo: blk.BlockProducerInfo,
+		Salt:              salt,
+	}
+	for ii, txn := range blk.Txns {
+		if txn.TxnMeta != nil && txn.TxnMeta.GetTxnType() == TxnTypeBlockReward {
+			compactBlock.PrefilledTxns = append(compactBlock.PrefilledTxns, &CompactBlockPrefilledTxn{
+				Index: uint64(ii),
+				Txn:   txn,
+			})
+			continue
+		}
+		txnHash := txn.Hash()
+		if txnHash == nil {
+			return nil, fmt.Errorf("NewCompactBlock: Problem hashing txn %d", ii)
+		}
+		compactBlock.ShortIDs = append(compactBlock.ShortIDs, TxnShortID(salt, txnHash))
+	}
+	return compactBlock, nil
+}
+
+// NumTxns returns the number of transactions in the block.
+func (msg *MsgDeSoCompactBlock) NumTxns() uint64 {
+	return uint64(len(msg.ShortIDs) + len(msg.PrefilledTxns))
+}
+
+func (msg *MsgDeSoCompactBlock) GetMsgType() MsgType {
+	return MsgTypeCompactBlock
+}
+
+func (msg *MsgDeSoCompactBlock) ToBytes(preSignature bool) ([]byte, error) {
+	if msg.Header == nil {
+		return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Header is nil")
+	}
+	hdrBytes, err := msg.Header.ToBytes(preSignature)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompactBlock.ToBytes: Problem encoding header")
+	}
+	data := UintToBuf(uint64(len(hdrBytes)))
+	data = append(data, hdrBytes...)
+
+	blockProducerInfoBytes := []byte{}
+	if msg.BlockProducerInfo != nil {
+		blockProducerInfoBytes = msg.BlockProducerInfo.Serialize()
+	}
+	data = append(data, UintToBuf(uint64(len(blockProducerInfoBytes)))...)
+	data = append(data, blockProducerInfoBytes...)
+
+	data = append(data, UintToBuf(msg.Salt)...)
+	data = append(data, UintToBuf(uint64(len(msg.ShortIDs)))...)
+	for _, shortID := range msg.ShortIDs {
+		data = append(data, EncodeUint64(shortID)...)
+	}
+
+	data = append(data, UintToBuf(uint64(len(msg.PrefilledTxns)))...)
+	for _, prefilledTxn := range msg.PrefilledTxns {
+		if prefilledTxn == nil || prefilledTxn.Txn == nil {
+			return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Prefilled txn is nil")
+		}
+		data = append(data, UintToBuf(prefilledTxn.Index)...)
+		txnBytes, err := _encodeCompactBlockTxn(prefilledTxn.Txn, preSignature)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MsgDeSoCompactBlock.ToBytes: Problem encoding prefilled txn %d",
+				prefilledTxn.Index)
+		}
+		data = append(data, txnBytes...)
+	}
+	return data, nil
+}
+
+func (msg *MsgDeSoCompactBlock) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	hdrBytes, err := _readCompactBlockBytes(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading header")
+	}
+	header := NewMessage(MsgTypeHeader).(*MsgDeSoHeader)
+	if err = header.FromBytes(hdrBytes); err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem decoding header")
+	}
+
+	blockProducerInfoBytes, err := _readCompactBlockBytes(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading block producer info")
+	}
+	var blockProducerInfo *BlockProducerInfo
+	if len(blockProducerInfoBytes) > 0 {
+		blockProducerInfo = &BlockProducerInfo{}
+		if err = blockProducerInfo.Deserialize(blockProducerInfoBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem decoding block producer info")
+		}
+	}
+
+	salt, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading salt")
+	}
+	numShortIDs, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading number of short IDs")
+	}
+	// Every short ID takes eight bytes, which bounds the number of short IDs by the size of the message.
+	if numShortIDs > uint64(rr.Len())/8 {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Number of short IDs %d exceeds the remaining %d bytes",
+			numShortIDs, rr.Len())
+	}
+	shortIDs := make([]uint64, numShortIDs)
+	shortIDBytes := make([]byte, 8)
+	for ii := range shortIDs {
+		if _, err = io.ReadFull(rr, shortIDBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading short ID %d", ii)
+		}
+		shortIDs[ii] = DecodeUint64(shortIDBytes)
+	}
+
+	numPrefilledTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading number of prefilled txns")
+	}
+	// Every prefilled txn takes at least two bytes.
+	if numPrefilledTxns > uint64(rr.Len())/2 {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Number of prefilled txns %d exceeds the remaining "+
+			"%d bytes", numPrefilledTxns, rr.Len())
+	}
+	prefilledTxns := make([]*CompactBlockPrefilledTxn, 0, numPrefilledTxns)
+	for ii := uint64(0); ii < numPrefilledTxns; ii++ {
+		index, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading index of prefilled txn %d", ii)
+		}
+		txn, err := _readCompactBlockTxn(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Problem reading prefilled txn %d", ii)
+		}
+		prefilledTxns = append(prefilledTxns, &CompactBlockPrefilledTxn{Index: index, Txn: txn})
+	}
+
+	*msg = MsgDeSoCompactBlock{
+		Header:            header,
+		BlockProducerInfo: blockProducerInfo,
+		Salt:              salt,
+		ShortIDs:          shortIDs,
+		PrefilledTxns:     prefilledTxns,
+	}
+	return nil
+}
+
+func (msg *MsgDeSoCompactBlock) String() string {
+	return fmt.Sprintf("Header: %v, NumShortIDs: %d, NumPrefilledTxns: %d",
+		msg.Header, len(msg.ShortIDs), len(msg.PrefilledTxns))
+}
+
+// MsgDeSoGetBlockTxns requests the transactions of a compact block that the sender couldn't find in its mempool.
+type MsgDeSoGetBlockTxns struct {
+	BlockHash *BlockHash
+	// Indexes are the indexes of the transactions in the block, in increasing order.
+	Indexes []uint64
+}
+
+func (msg *MsgDeSoGetBlockTxns) GetMsgType() MsgType {
+	return MsgTypeGetBlockTxns
+}
+
+func (msg *MsgDeSoGetBlockTxns) ToBytes(preSignature bool) ([]byte, error) {
+	if msg.BlockHash == nil {
+		return nil, fmt.Errorf("MsgDeSoGetBlockTxns.ToBytes: BlockHash is nil")
+	}
+	data := append([]byte{}, msg.BlockHash[:]...)
+	data = append(data, UintToBuf(uint64(len(msg.Indexes)))...)
+	for _, index := range msg.Indexes {
+		data = append(data, UintToBuf(index)...)
+	}
+	return data, nil
+}
+
+func (msg *MsgDeSoGetBlockTxns) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	blockHash := &BlockHash{}
+	if _, err := io.ReadFull(rr, blockHash[:]); err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Problem reading block hash")
+	}
+	numIndexes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Problem reading number of indexes")
+	}
+	// Every index takes at least one byte.
+	if numIndexes > uint64(rr.Len()) {
+		return fmt.Errorf("MsgDeSoGetBlockTxns.FromBytes: Number of indexes %d exceeds the remaining %d bytes",
+			numIndexes, rr.Len())
+	}
+	indexes := make([]uint64, numIndexes)
+	for ii := range indexes {
+		if indexes[ii], err = ReadUvarint(rr); err != nil {
+			return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Problem reading index %d", ii)
+		}
+	}
+	*msg = MsgDeSoGetBlockTxns{BlockHash: blockHash, Indexes: indexes}
+	return nil
+}
+
+func (msg *MsgDeSoGetBlockTxns) String() string {
+	return fmt.Sprintf("BlockHash: %v, NumIndexes: %d", msg.BlockHash, len(msg.Indexes))
+}
+
+// MsgDeSoBlockTxns answers a MsgDeSoGetBlockTxns with the requested transactions, in the order they were requested.
+type MsgDeSoBlockTxns struct {
+	BlockHash *BlockHash
+	Txns      []*MsgDeSoTxn
+}
+
+func (msg *MsgDeSoBlockTxns) GetMsgType() MsgType {
+	return MsgTypeBlockTxns
+}
+
+func (msg *MsgDeSoBlockTxns) ToBytes(preSignature bool) ([]byte, error) {
+	if msg.BlockHash == nil {
+		return nil, fmt.Errorf("MsgDeSoBlockTxns.ToBytes: BlockHash is nil")
+	}
+	data := append([]byte{}, msg.BlockHash[:]...)
+	data = append(data, UintToBuf(uint64(len(msg.Txns)))...)
+	for ii, txn := range msg.Txns {
+		txnBytes, err := _encodeCompactBlockTxn(txn, preSignature)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MsgDeSoBlockTxns.ToBytes: Problem encoding txn %d", ii)
+		}
+		data = append(data, txnBytes...)
+	}
+	return data, nil
+}
+
+func (msg *MsgDeSoBlockTxns) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	blockHash := &BlockHash{}
+	if _, err := io.ReadFull(rr, blockHash[:]); err != nil {
+		return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Problem reading block hash")
+	}
+	numTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Problem reading number of txns")
+	}
+	// Every txn takes at least one byte.
+	if numTxns > uint64(rr.Len()) {
+		return fmt.Errorf("MsgDeSoBlockTxns.FromBytes: Number of txns %d exceeds the remaining %d bytes",
+			numTxns, rr.Len())
+	}
+	txns := make([]*MsgDeSoTxn, 0, numTxns)
+	for ii := uint64(0); ii < numTxns; ii++ {
+		txn, err := _readCompactBlockTxn(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Problem reading txn %d", ii)
+		}
+		txns = append(txns, txn)
+	}
+	*msg = MsgDeSoBlockTxns{BlockHash: blockHash, Txns: txns}
+	return nil
+}
+
+func (msg *MsgDeSoBlockTxns) String() string {
+	return fmt.Sprintf("BlockHash: %v, NumTxns: %d", msg.BlockHash, len(msg.Txns))
+}
+
+// _encodeCompactBlockTxn encodes a transaction prefixed with its length.
+func _encodeCompactBlockTxn(txn *MsgDeSoTxn, preSignature bool) ([]byte, error) {
+	if txn == nil {
+		return nil, fmt.Errorf("_encodeCompactBlockTxn: Txn is nil")
+	}
+	txnBytes, err := txn.ToBytes(preSignature)
+	if err != nil {
+		return nil, err
+	}
+	return append(UintToBuf(uint64(len(txnBytes))), txnBytes...), nil
+}
+
+func _readCompactBlockTxn(rr *bytes.Reader) (*MsgDeSoTxn, error) {
+	txnBytes, err := _readCompactBlockBytes(rr)
+	if err != nil {
+		return nil, err
+	}
+	txn := NewMessage(MsgTypeTxn).(*MsgDeSoTxn)
+	if err = txn.FromBytes(txnBytes); err != nil {
+		return nil, errors.Wrapf(err, "_readCompactBlockTxn: Problem decoding txn")
+	}
+	return txn, nil
+}
+
+// _readCompactBlockBytes reads a byte slice prefixed with its length.
+func _readCompactBlockBytes(rr *bytes.Reader) ([]byte, error) {
+	numBytes, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_readCompactBlockBytes: Problem reading length")
+	}
+	if numBytes > uint64(rr.Len()) {
+		return nil, fmt.Errorf("_readCompactBlockBytes: Length %d exceeds the remaining %d bytes",
+			numBytes, rr.Len())
+	}
+	data := make([]byte, numBytes)
+	if _, err = io.ReadFull(rr, data); err != nil {
+		return nil, errors.Wrapf(err, "_readCompactBlockBytes: Problem reading bytes")
+	}
+	return data, nil
+}
+
+// ==================================================================
+// Block reconstruction
+// ==================================================================
+
+// ReconstructCompactBlock builds the block of a compact block from its prefilled transactions and the transactions
+// of the mempool. It returns the block, with a nil transaction at each index that wasn't found in the mempool, and
+// the indexes of the missing transactions in increasing order. A short ID that matches more than one mempool
+// transaction is treated as missing.
+func ReconstructCompactBlock(msg *MsgDeSoCompactBlock, mempoolTxns []*MempoolTx) (
+	_blk *MsgDeSoBlock, _missingIndexes []uint64, _err error) {
+
+	if msg.Header == nil {
+		return nil, nil, fmt.Errorf("ReconstructCompactBlock: Header is nil")
+	}
+	numTxns := msg.NumTxns()
+	txns := make([]*MsgDeSoTxn, numTxns)
+	isPrefilled := make([]bool, numTxns)
+	for ii, prefilledTxn := range msg.PrefilledTxns {
+		if prefilledTxn.Index >= numTxns {
+			return nil, nil, fmt.Errorf("ReconstructCompactBlock: Prefilled txn %d has index %d but the block only "+
+				"has %d txns", ii, prefilledTxn.Index, numTxns)
+		}
+		if ii > 0 && prefilledTxn.Index <= msg.PrefilledTxns[ii-1].Index {
+			return nil, nil, fmt.Errorf("ReconstructCompactBlock: Prefilled txn %d has index %d, which isn't after "+
+				"the index %d of the previous one", ii, prefilledTxn.Index, msg.PrefilledTxns[ii-1].Index)
+		}
+		txns[prefilledTxn.Index] = prefilledTxn.Txn
+		isPrefilled[prefilledTxn.Index] = true
+	}
+
+	// Index the mempool by short ID. Short IDs that match more than one transaction map to nil.
+	mempoolTxnsByShortID := make(map[uint64]*MsgDeSoTxn, len(mempoolTxns))
+	for _, mempoolTx := range mempoolTxns {
+		if mempoolTx == nil || mempoolTx.Tx == nil || mempoolTx.Hash == nil {
+			continue
+		}
+		shortID := TxnShortID(msg.Salt, mempoolTx.Hash)
+		if existingTxn, exists := mempoolTxnsByShortID[shortID]; exists {
+			if existingTxn != nil && *existingTxn.Hash() != *mempoolTx.Hash {
+				mempoolTxnsByShortID[shortID] = nil
+			}
+			continue
+		}
+		mempoolTxnsByShortID[shortID] = mempoolTx.Tx
+	}
+
+	var missingIndexes []uint64
+	shortIDIndex := 0
+	for ii := uint64(0); ii < numTxns; ii++ {
+		if isPrefilled[ii] {
+			continue
+		}
+		txn := mempoolTxnsByShortID[msg.ShortIDs[shortIDIndex]]
+		shortIDIndex++
+		if txn == nil {
+			missingIndexes = append(missingIndexes, ii)
+			continue
+		}
+		txns[ii] = txn
+	}
+
+	return &MsgDeSoBlock{
+		Header:            msg.Header,
+		Txns:              txns,
+		BlockProducerInfo: msg.BlockProducerInfo,
+	}, missingIndexes, nil
+}
+
+// FillCompactBlockTxns fills the missing transactions of a reconstructed block with the transactions of a
+// BLOCK_TXNS, and checks the block against the merkle root of its header.
+func FillCompactBlockTxns(blk *MsgDeSoBlock, missingIndexes []uint64, txns []*MsgDeSoTxn) error {
+	if len(txns) != len(missingIndexes) {
+		return fmt.Errorf("FillCompactBlockTxns: Got %d txns for %d missing txns", len(txns), len(missingIndexes))
+	}
+	for ii, index := range missingIndexes {
+		if index >= uint64(len(blk.Txns)) || txns[ii] == nil {
+			return fmt.Errorf("FillCompactBlockTxns: Invalid txn for index %d", index)
+		}
+		blk.Txns[index] = txns[ii]
+	}
+	return CheckCompactBlockMerkleRoot(blk)
+}
+
+// CheckCompactBlockMerkleRoot returns an error if a reconstructed block is missing transactions, or its
+// transactions don't match the merkle root of its header.
+func CheckCompactBlockMerkleRoot(blk *MsgDeSoBlock) error {
+	for ii, txn := range blk.Txns {
+		if txn == nil {
+			return fmt.Errorf("CheckCompactBlockMerkleRoot: Block is missing txn %d", ii)
+		}
+	}
+	merkleRoot, _, err := ComputeMerkleRoot(blk.Txns)
+	if err != nil {
+		return errors.Wrapf(err, "CheckCompactBlockMerkleRoot: ")
+	}
+	if blk.Header.TransactionMerkleRoot == nil || *merkleRoot != *blk.Header.TransactionMerkleRoot {
+		return fmt.Errorf("CheckCompactBlockMerkleRoot: Merkle root %v doesn't match the header's %v",
+			merkleRoot, blk.Header.TransactionMerkleRoot)
+	}
+	return nil
+}
+
+// ==================================================================
+// Per-peer compact block state
+// ==================================================================
+
+// pendingCompactBlock is a compact block whose missing transactions were requested from the peer.
+type pendingCompactBlock struct {
+	block          *MsgDeSoBlock
+	missingIndexes []uint64
+	requestedAt    time.Time
+}
+
+// compactBlockState holds the compact blocks from a peer that are waiting on their missing transactions.
+type compactBlockState struct {
+	mtx     deadlock.Mutex
+	pending map[BlockHash]*pendingCompactBlock
+}
+
+func newCompactBlockState() *compactBlockState {
+	return &compactBlockState{pending: make(map[BlockHash]*pendingCompactBlock)}
+}
+
+// isPending returns true if the block is waiting on its missing transactions.
+func (state *compactBlockState) isPending(blockHash BlockHash) bool {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	_, exists := state.pending[blockHash]
+	return exists
+}
+
+// addPending adds a block that's waiting on its missing transactions. It returns the blocks that timed out, or that
+// were evicted to make room for the new block, so that the full blocks can be requested instead.
+func (state *compactBlockState) addPending(blockHash BlockHash, pending *pendingCompactBlock) (
+	_expiredBlockHashes []BlockHash) {
+
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+
+	var expiredBlockHashes []BlockHash
+	var oldestBlockHash *BlockHash
+	for pendingBlockHash, pendingBlock := range state.pending {
+		if pending.requestedAt.Sub(pendingBlock.requestedAt) >= compactBlockTxnsTimeout {
+			expiredBlockHashes = append(expiredBlockHashes, pendingBlockHash)
+			delete(state.pending, pendingBlockHash)
+			continue
+		}
+		if oldestBlockHash == nil || pendingBlock.requestedAt.Before(state.pending[*oldestBlockHash].requestedAt) {
+			blockHashCopy := pendingBlockHash
+			oldestBlockHash = &blockHashCopy
+		}
+	}
+	if len(state.pending) >= maxPendingCompactBlocksPerPeer && oldestBlockHash != nil {
+		expiredBlockHashes = append(expiredBlockHashes, *oldestBlockHash)
+		delete(state.pending, *oldestBlockHash)
+	}
+	state.pending[blockHash] = pending
+	return expiredBlockHashes
+}
+
+// finishPending removes the block and returns it, or returns nil if it isn't pending.
+func (state *compactBlockState) finishPending(blockHash BlockHash) *pendingCompactBlock {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	pending := state.pending[blockHash]
+	delete(state.pending, blockHash)
+	return pending
+}
+
+// ==================================================================
+// Server
+// ==================================================================
+
+// _relaysCompactBlocksWithPeer returns true if we announce new blocks to the peer with compact blocks rather than
+// INVs.
+func (srv *Server) _relaysCompactBlocksWithPeer(pp *Peer) bool {
+	return srv.compactBlockRelay && pp != nil && pp.serviceFlags.HasService(SFCompactBlocks)
+}
+
+// _newCompactBlockForRelay returns the compact block of a block we accepted, with a fresh salt.
+func (srv *Server) _newCompactBlockForRelay(blk *MsgDeSoBlock) (*MsgDeSoCompactBlock, error) {
+	salt, err := wire.RandomUint64()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Server._newCompactBlockForRelay: Problem generating salt")
+	}
+	return NewCompactBlock(blk, salt)
+}
+
+func (srv *Server) _handleCompactBlock(pp *Peer, msg *MsgDeSoCompactBlock, cid CorrelationID) {
+	if !srv._relaysCompactBlocksWithPeer(pp) {
+		srv.logger.V(1).Infof("Server._handleCompactBlock: Ignoring unexpected compact block from peer %v", pp)
+		return
+	}
+	if msg.Header == nil {
+		pp.Disconnect("Compact block header is nil")
+		return
+	}
+	blockHash, err := msg.Header.Hash()
+	if err != nil {
+		srv.logger.Errorf("Server._handleCompactBlock: Problem hashing header from peer %v: %v", pp, err)
+		pp.Disconnect("Problem hashing compact block header")
+		return
+	}
+	invVect := &InvVect{Type: InvTypeBlock, Hash: *blockHash}
+	pp.knownInventory.Add(*invVect, struct{}{})
+	if srv.blockchain.HasBlock(blockHash) || pp.compactBlocks.isPending(*blockHash) {
+		return
+	}
+
+	// A node that's still syncing, or that doesn't have the block's parent, can't process the block yet, so it
+	// treats the compact block as an INV and syncs the block the usual way. The FastHotStuffConsensus requests a
+	// missing parent itself.
+	isConsensusRunning := srv.fastHotStuffConsensus != nil && srv.fastHotStuffConsensus.IsRunning()
+	if srv.blockchain.isSyncing() ||
+		(!isConsensusRunning && !srv.blockchain.HasBlock(msg.Header.PrevBlockHash)) {
+		srv._handleInv(pp, &MsgDeSoInv{InvList: []*InvVect{invVect}})
+		return
+	}
+
+	var mempoolTxns []*MempoolTx
+	if mempool := srv.GetMempool(); mempool != nil {
+		mempoolTxns = mempool.GetTransactions()
+	}
+	blk, missingIndexes, err := ReconstructCompactBlock(msg, mempoolTxns)
+	if err != nil {
+		srv.logger.Errorf("Server._handleCompactBlock: Problem reconstructing block %v from peer %v: %v",
+			blockHash, pp, err)
+		pp.Disconnect("Invalid compact block")
+		return
+	}
+	if len(missingIndexes) == 0 {
+		srv.logger.V(1).Infof("Server._handleCompactBlock: [%v] Reconstructed block %v with %d txns from the "+
+			"mempool", cid, blockHash, len(blk.Txns))
+		srv._processCompactBlock(pp, blockHash, blk, cid)
+		return
+	}
+
+	srv.logger.V(1).Infof("Server._handleCompactBlock: [%v] Requesting %d of the %d txns of block %v from peer %v",
+		cid, len(missingIndexes), len(blk.Txns), blockHash, pp)
+	expiredBlockHashes := pp.compactBlocks.addPending(*blockHash, &pendingCompactBlock{
+		block:          blk,
+		missingIndexes: missingIndexes,
+		requestedAt:    time.Now(),
+	})
+	for _, expiredBlockHash := range expiredBlockHashes {
+		srv._requestFullBlock(pp, expiredBlockHash, cid)
+	}
+	pp.AddDeSoMessageWithCorrelationID(&MsgDeSoGetBlockTxns{
+		BlockHash: blockHash,
+		Indexes:   missingIndexes,
+	}, false, cid)
+}
+
+func (srv *Server) _handleGetBlockTxns(pp *Peer, msg *MsgDeSoGetBlockTxns) {
+	if msg.BlockHash == nil {
+		return
+	}
+	blk := srv.blockchain.GetBlock(msg.BlockHash)
+	if blk == nil {
+		srv.logger.V(1).Infof("Server._handleGetBlockTxns: Block %v requested by peer %v not found",
+			msg.BlockHash, pp)
+		return
+	}
+	response := &MsgDeSoBlockTxns{BlockHash: msg.BlockHash}
+	for _, index := range msg.Indexes {
+		if index >= uint64(len(blk.Txns)) {
+			srv.logger.Errorf("Server._handleGetBlockTxns: Peer %v requested txn %d of block %v, which only has "+
+				"%d txns", pp, index, msg.BlockHash, len(blk.Txns))
+			pp.Disconnect("Invalid GetBlockTxns index")
+			return
+		}
+		response.Txns = append(response.Txns, blk.Txns[index])
+	}
+	pp.AddDeSoMessage(response, false)
+}
+
+func (srv *Server) _handleBlockTxns(pp *Peer, msg *MsgDeSoBlockTxns, cid CorrelationID) {
+	if msg.BlockHash == nil {
+		return
+	}
+	pending := pp.compactBlocks.finishPending(*msg.BlockHash)
+	if pending == nil {
+		srv.logger.V(1).Infof("Server._handleBlockTxns: Ignoring txns of block %v from peer %v that we didn't "+
+			"request", msg.BlockHash, pp)
+		return
+	}
+	if err := FillCompactBlockTxns(pending.block, pending.missingIndexes, msg.Txns); err != nil {
+		srv.logger.V(1).Infof("Server._handleBlockTxns: [%v] Problem filling block %v from peer %v, requesting "+
+			"the full block: %v", cid, msg.BlockHash, pp, err)
+		srv._requestFullBlock(pp, *msg.BlockHash, cid)
+		return
+	}
+	srv._processCompactBlock(pp, msg.BlockHash, pending.block, cid)
+}
+
+// _processCompactBlock processes a block reconstructed from a compact block, or requests the full block if it
+// doesn't match its header.
+func (srv *Server) _processCompactBlock(pp *Peer, blockHash *BlockHash, blk *MsgDeSoBlock, cid CorrelationID) {
+	if err := CheckCompactBlockMerkleRoot(blk); err != nil {
+		srv.logger.V(1).Infof("Server._processCompactBlock: [%v] Block %v from peer %v doesn't match its "+
+			"header, requesting the full block: %v", cid, blockHash, pp, err)
+		srv._requestFullBlock(pp, *blockHash, cid)
+		return
+	}
+	// The peer announced the block, so it counts as requested.
+	pp.requestedBlocks[*blockHash] = true
+	srv._handleBlock(pp, blk, true, cid)
+}
+
+// _requestFullBlock requests a block that couldn't be reconstructed from its compact block.
+func (srv *Server) _requestFullBlock(pp *Peer, blockHash BlockHash, cid CorrelationID) {
+	if srv.blockchain.HasBlock(&blockHash) {
+		return
+	}
+	srv.RequestBlocksByHash(pp, []*BlockHash{&blockHash}, cid)
+}
@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactBlock(t *testing.T) {
+	require := require.New(t)
+
+	// A block with a block reward followed by ten basic transfers.
+	blk := createTestBlockVersion2(t, false)
+	blk.Txns = []*MsgDeSoTxn{{
+		TxnVersion: DeSoTxnVersion1,
+		TxnMeta:    &BlockRewardMetadataa{ExtraData: []byte{0x01}},
+		TxnNonce:   &DeSoNonce{},
+	}}
+	for ii := uint64(0); ii < 10; ii++ {
+		blk.Txns = append(blk.Txns, &MsgDeSoTxn{
+			TxnVersion:  DeSoTxnVersion1,
+			PublicKey:   m0PkBytes,
+			TxnMeta:     &BasicTransferMetadata{},
+			TxnFeeNanos: 100 + ii,
+			TxnNonce:    &DeSoNonce{ExpirationBlockHeight: 1000, PartialID: ii},
+		})
+	}
+	merkleRoot, _, err := ComputeMerkleRoot(blk.Txns)
+	require.NoError(err)
+	blk.Header.TransactionMerkleRoot = merkleRoot
+	blockHash, err := blk.Hash()
+	require.NoError(err)
+
+	newMempoolTxns := func(txns []*MsgDeSoTxn) []*MempoolTx {
+		mempoolTxns := []*MempoolTx{}
+		for _, txn := range txns {
+			mempoolTxns = append(mempoolTxns, &MempoolTx{Tx: txn, Hash: txn.Hash()})
+		}
+		return mempoolTxns
+	}
+
+	// The block reward is prefilled, and the other txns are sent as short IDs.
+	compactBlock, err := NewCompactBlock(blk, 12345)
+	require.NoError(err)
+	require.Len(compactBlock.PrefilledTxns, 1)
+	require.Equal(uint64(0), compactBlock.PrefilledTxns[0].Index)
+	require.Len(compactBlock.ShortIDs, 10)
+	require.Equal(uint64(11), compactBlock.NumTxns())
+
+	// The compact block survives a round trip through its encoding, and has the hash of the block.
+	compactBlockBytes, err := compactBlock.ToBytes(false)
+	require.NoError(err)
+	decodedCompactBlock := NewMessage(MsgTypeCompactBlock).(*MsgDeSoCompactBlock)
+	require.NoError(decodedCompactBlock.FromBytes(compactBlockBytes))
+	require.Equal(compactBlock.Salt, decodedCompactBlock.Salt)
+	require.Equal(compactBlock.ShortIDs, decodedCompactBlock.ShortIDs)
+	decodedBlockHash, err := decodedCompactBlock.Header.Hash()
+	require.NoError(err)
+	require.Equal(*blockHash, *decodedBlockHash)
+	blkBytes, err := blk.ToBytes(false)
+	require.NoError(err)
+	require.Less(len(compactBlockBytes), len(blkBytes))
+
+	// A mempool that has every txn reconstructs the block without any round trip.
+	reconstructedBlock, missingIndexes, err := ReconstructCompactBlock(decodedCompactBlock,
+		newMempoolTxns(blk.Txns[1:]))
+	require.NoError(err)
+	require.Empty(missingIndexes)
+	require.NoError(CheckCompactBlockMerkleRoot(reconstructedBlock))
+	reconstructedBlockHash, err := reconstructedBlock.Hash()
+	require.NoError(err)
+	require.Equal(*blockHash, *reconstructedBlockHash)
+
+	// A mempool that's missing some txns reconstructs the rest, and the missing ones are filled from a BLOCK_TXNS.
+	reconstructedBlock, missingIndexes, err = ReconstructCompactBlock(decodedCompactBlock,
+		newMempoolTxns(append([]*MsgDeSoTxn{blk.Txns[1]}, blk.Txns[4:9]...)))
+	require.NoError(err)
+	require.Equal([]uint64{2, 3, 9, 10}, missingIndexes)
+	require.Error(CheckCompactBlockMerkleRoot(reconstructedBlock))
+
+	blockTxnsMsg := &MsgDeSoBlockTxns{BlockHash: blockHash}
+	for _, index := range missingIndexes {
+		blockTxnsMsg.Txns = append(blockTxnsMsg.Txns, blk.Txns[index])
+	}
+	blockTxnsBytes, err := blockTxnsMsg.ToBytes(false)
+	require.NoError(err)
+	decodedBlockTxnsMsg := NewMessage(MsgTypeBlockTxns).(*MsgDeSoBlockTxns)
+	require.NoError(decodedBlockTxnsMsg.FromBytes(blockTxnsBytes))
+	require.Error(FillCompactBlockTxns(reconstructedBlock, missingIndexes, decodedBlockTxnsMsg.Txns[1:]))
+	require.NoError(FillCompactBlockTxns(reconstructedBlock, missingIndexes, decodedBlockTxnsMsg.Txns))
+
+	// Txns that are in the wrong place don't match the merkle root.
+	reconstructedBlock, missingIndexes, err = ReconstructCompactBlock(decodedCompactBlock, nil)
+	require.NoError(err)
+	require.Len(missingIndexes, 10)
+	wrongTxns := append([]*MsgDeSoTxn{}, blk.Txns[1:]...)
+	wrongTxns[0], wrongTxns[1] = wrongTxns[1], wrongTxns[0]
+	require.Error(FillCompactBlockTxns(reconstructedBlock, missingIndexes, wrongTxns))
+
+	// A GET_BLOCK_TXNS survives a round trip through its encoding.
+	getBlockTxnsMsg := &MsgDeSoGetBlockTxns{BlockHash: blockHash, Indexes: []uint64{2, 3, 9, 10}}
+	getBlockTxnsBytes, err := getBlockTxnsMsg.ToBytes(false)
+	require.NoError(err)
+	decodedGetBlockTxnsMsg := NewMessage(MsgTypeGetBlockTxns).(*MsgDeSoGetBlockTxns)
+	require.NoError(decodedGetBlockTxnsMsg.FromBytes(getBlockTxnsBytes))
+	require.Equal(getBlockTxnsMsg, decodedGetBlockTxnsMsg)
+
+	// A prefilled txn outside the block is rejected.
+	decodedCompactBlock.PrefilledTxns[0].Index = 11
+	_, _, err = ReconstructCompactBlock(decodedCompactBlock, nil)
+	require.Error(err)
+}
+
+func TestCompactBlockState(t *testing.T) {
+	require := require.New(t)
+
+	state := newCompactBlockState()
+	now := time.Now()
+
+	// A block that times out is returned when the next block is added.
+	require.Empty(state.addPending(BlockHash{0}, &pendingCompactBlock{requestedAt: now}))
+	require.True(state.isPending(BlockHash{0}))
+	require.Equal([]BlockHash{{0}}, state.addPending(BlockHash{1}, &pendingCompactBlock{
+		requestedAt: now.Add(compactBlockTxnsTimeout),
+	}))
+	require.False(state.isPending(BlockHash{0}))
+
+	// Once the peer has too many blocks pending, the oldest one is evicted.
+	for ii := byte(2); ii <= maxPendingCompactBlocksPerPeer; ii++ {
+		require.Empty(state.addPending(BlockHash{ii}, &pendingCompactBlock{
+			requestedAt: now.Add(compactBlockTxnsTimeout + time.Duration(ii)),
+		}))
+	}
+	require.Equal([]BlockHash{{1}}, state.addPending(BlockHash{100}, &pendingCompactBlock{
+		requestedAt: now.Add(compactBlockTxnsTimeout + time.Second),
+	}))
+
+	// A finished block is no longer pending.
+	require.NotNil(state.finishPending(BlockHash{100}))
+	require.Nil(state.finishPending(BlockHash{100}))
+	require.False(state.isPending(BlockHash{100}))
+}
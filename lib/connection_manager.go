@@ -33,8 +33,13 @@ type ConnectionManager struct {
 	// doesn't need a reference to the Server object. But for now we keep things lazy.
 	srv *Server
 
+	// logger is scoped to the connmgr component.
+	logger Logger
+
 	// The interfaces we listen on for new incoming connections.
 	listeners []net.Listener
+	// The dialer we use for outbound connections. If it is nil, peers are dialed directly.
+	dialer *PeerDialer
 	// The parameters we are initialized with.
 	params *DeSoParams
 
@@ -107,9 +112,16 @@ type ConnectionManager struct {
 	// stallTimeoutSeconds is how long we wait to receive responses from Peers
 	// for certain types of messages.
 	stallTimeoutSeconds uint64
+	// blockStallTimeoutSeconds is how long we wait for Peers to respond to GetBlocks
+	// messages.
+	blockStallTimeoutSeconds uint64
 
 	minFeeRateNanosPerKB uint64
 
+	// requestRateLimits are the budgets of the requests each Peer can send us. See
+	// peer_rate_limiter.go.
+	requestRateLimits map[MsgType]PeerRequestRateLimit
+
 	// More chans we might want.	modifyRebroadcastInv chan interface{}
 	shutdown int32
 }
@@ -117,19 +129,25 @@ type ConnectionManager struct {
 func NewConnectionManager(
 	_params *DeSoParams,
 	_listeners []net.Listener,
+	_dialer *PeerDialer,
 	_hyperSync bool,
 	_syncType NodeSyncType,
 	_stallTimeoutSeconds uint64,
+	_blockStallTimeoutSeconds uint64,
 	_minFeeRateNanosPerKB uint64,
+	_requestRateLimits map[MsgType]PeerRequestRateLimit,
 	_serverMessageQueue chan *ServerMessage,
-	_srv *Server) *ConnectionManager {
+	_srv *Server,
+	_logger Logger) *ConnectionManager {
 
 	ValidateHyperSyncFlags(_hyperSync, _syncType)
 
 	return &ConnectionManager{
 		srv:       _srv,
+		logger:    _logger,
 		params:    _params,
 		listeners: _listeners,
+		dialer:    _dialer,
 		// We keep track of the last N nonces we've sent in order to detect
 		// self connections.
 		sentNonces: *lru.NewSet[any](1000),
@@ -150,11 +168,13 @@ func NewConnectionManager(
 		outboundConnectionChan: make(chan *outboundConnection, 100),
 		inboundConnectionChan:  make(chan *inboundConnection, 100),
 
-		HyperSync:            _hyperSync,
-		SyncType:             _syncType,
-		serverMessageQueue:   _serverMessageQueue,
-		stallTimeoutSeconds:  _stallTimeoutSeconds,
-		minFeeRateNanosPerKB: _minFeeRateNanosPerKB,
+		HyperSync:                _hyperSync,
+		SyncType:                 _syncType,
+		serverMessageQueue:       _serverMessageQueue,
+		stallTimeoutSeconds:      _stallTimeoutSeconds,
+		blockStallTimeoutSeconds: _blockStallTimeoutSeconds,
+		minFeeRateNanosPerKB:     _minFeeRateNanosPerKB,
+		requestRateLimits:        _requestRateLimits,
 	}
 }
 
@@ -233,6 +253,12 @@ func (cmgr *ConnectionManager) IsAttemptedOutboundIpAddress(netAddr *wire.NetAdd
 	return cmgr.attemptedOutboundAddrs[addrmgr.NetAddressKey(netAddr)]
 }
 
+// IsReachableIpAddress returns true if the dialer can connect to the address. Onion addresses are only reachable
+// through a proxy.
+func (cmgr *ConnectionManager) IsReachableIpAddress(netAddr *wire.NetAddressV2) bool {
+	return cmgr.dialer.IsReachable(netAddr)
+}
+
 func (cmgr *ConnectionManager) AddAttemptedOutboundAddrs(netAddr *wire.NetAddressV2) {
 	cmgr.mtxAddrsMaps.Lock()
 	defer cmgr.mtxAddrsMaps.Unlock()
@@ -247,21 +273,21 @@ func (cmgr *ConnectionManager) RemoveAttemptedOutboundAddrs(netAddr *wire.NetAdd
 
 // DialPersistentOutboundConnection attempts to connect to a persistent peer.
 func (cmgr *ConnectionManager) DialPersistentOutboundConnection(persistentAddr *wire.NetAddressV2, attemptId uint64) (_attemptId uint64) {
-	glog.V(2).Infof("ConnectionManager.DialPersistentOutboundConnection: Connecting to peer  (IP=%v, Port=%v)",
+	cmgr.logger.V(2).Infof("ConnectionManager.DialPersistentOutboundConnection: Connecting to peer  (IP=%v, Port=%v)",
 		persistentAddr.ToLegacy().IP.String(), persistentAddr.Port)
 	return cmgr._dialOutboundConnection(persistentAddr, attemptId, true)
 }
 
 // DialOutboundConnection attempts to connect to a non-persistent peer.
 func (cmgr *ConnectionManager) DialOutboundConnection(addr *wire.NetAddressV2, attemptId uint64) {
-	glog.V(2).Infof("ConnectionManager.ConnectOutboundConnection: Connecting to peer (IP=%v, Port=%v)",
+	cmgr.logger.V(2).Infof("ConnectionManager.ConnectOutboundConnection: Connecting to peer (IP=%v, Port=%v)",
 		addr.ToLegacy().IP.String(), addr.Port)
 	cmgr._dialOutboundConnection(addr, attemptId, false)
 }
 
 // CloseAttemptedConnection closes an ongoing connection attempt.
 func (cmgr *ConnectionManager) CloseAttemptedConnection(attemptId uint64) {
-	glog.V(2).Infof("ConnectionManager.CloseAttemptedConnection: Closing connection attempt %d", attemptId)
+	cmgr.logger.V(2).Infof("ConnectionManager.CloseAttemptedConnection: Closing connection attempt %d", attemptId)
 	cmgr.mtxConnectionAttempts.Lock()
 	defer cmgr.mtxConnectionAttempts.Unlock()
 	if attempt, exists := cmgr.outboundConnectionAttempts[attemptId]; exists {
@@ -274,7 +300,7 @@ func (cmgr *ConnectionManager) CloseAttemptedConnection(attemptId uint64) {
 // connection attempt logic. It returns the attemptId of the attempt that was created.
 func (cmgr *ConnectionManager) _dialOutboundConnection(addr *wire.NetAddressV2, attemptId uint64, isPersistent bool) (_attemptId uint64) {
 	connectionAttempt := NewOutboundConnectionAttempt(attemptId, addr, isPersistent,
-		cmgr.params.DialTimeout, cmgr.outboundConnectionChan)
+		cmgr.dialer, cmgr.params.DialTimeout, cmgr.outboundConnectionChan)
 	cmgr.mtxConnectionAttempts.Lock()
 	cmgr.outboundConnectionAttempts[connectionAttempt.attemptId] = connectionAttempt
 	cmgr.mtxConnectionAttempts.Unlock()
@@ -296,10 +322,13 @@ func (cmgr *ConnectionManager) ConnectPeer(id uint64, conn net.Conn, na *wire.Ne
 	// At this point Conn is set so create a peer object to do a version negotiation.
 	peer := NewPeer(id, conn, isOutbound, na, isPersistent,
 		cmgr.stallTimeoutSeconds,
+		cmgr.blockStallTimeoutSeconds,
 		cmgr.minFeeRateNanosPerKB,
+		cmgr.requestRateLimits,
 		cmgr.params,
 		cmgr.srv.incomingMessages, cmgr, cmgr.srv, cmgr.SyncType,
-		cmgr.peerDisconnectedChan)
+		cmgr.peerDisconnectedChan,
+		cmgr.logger.WithComponent(LogComponentPeer).With(LogFieldPeerID(id)))
 
 	// Now we can add the peer to our data structures.
 	peer._logAddPeer()
@@ -323,7 +352,7 @@ func (cmgr *ConnectionManager) IsDuplicateInboundIPAddress(netAddr *wire.NetAddr
 	// nodes on a local machine.
 	// TODO: Should this be a flag?
 	if net.IP([]byte{127, 0, 0, 1}).Equal(netAddr.ToLegacy().IP) {
-		glog.V(1).Infof("ConnectionManager.IsDuplicateInboundIPAddress: Allowing " +
+		cmgr.logger.V(1).Infof("ConnectionManager.IsDuplicateInboundIPAddress: Allowing " +
 			"localhost IP address to connect")
 		return false
 	}
@@ -347,14 +376,14 @@ func (cmgr *ConnectionManager) _handleInboundConnections() {
 				if conn == nil {
 					return
 				}
-				glog.V(2).Infof("_handleInboundConnections: received connection from: local %v, remote %v",
+				cmgr.logger.V(2).Infof("_handleInboundConnections: received connection from: local %v, remote %v",
 					conn.LocalAddr().String(), conn.RemoteAddr().String())
 				if atomic.LoadInt32(&cmgr.shutdown) != 0 {
-					glog.Info("_handleInboundConnections: Ignoring connection due to shutdown")
+					cmgr.logger.Info("_handleInboundConnections: Ignoring connection due to shutdown")
 					return
 				}
 				if err != nil {
-					glog.Errorf("_handleInboundConnections: Can't accept connection: %v", err)
+					cmgr.logger.Errorf("_handleInboundConnections: Can't accept connection: %v", err)
 					continue
 				}
 
@@ -462,13 +491,13 @@ func (cmgr *ConnectionManager) SendMessage(msg DeSoMessage, peerId uint64) error
 	if peer == nil {
 		return fmt.Errorf("SendMessage: Peer with ID %d not found", peerId)
 	}
-	glog.V(1).Infof("SendMessage: Sending message %v to peer %d", msg.GetMsgType().String(), peerId)
+	cmgr.logger.V(1).Infof("SendMessage: Sending message %v to peer %d", msg.GetMsgType().String(), peerId)
 	peer.AddDeSoMessage(msg, false)
 	return nil
 }
 
 func (cmgr *ConnectionManager) CloseConnection(peerId uint64, disconnectReason string) {
-	glog.V(2).Infof("ConnectionManager.CloseConnection: Closing connection to peer (id= %v)", peerId)
+	cmgr.logger.V(2).Infof("ConnectionManager.CloseConnection: Closing connection to peer (id= %v)", peerId)
 
 	var peer *Peer
 	var ok bool
@@ -528,7 +557,7 @@ func (cmgr *ConnectionManager) _logOutboundPeerData() {
 	numOutboundPeers := int(atomic.LoadUint32(&cmgr.numOutboundPeers))
 	numInboundPeers := int(atomic.LoadUint32(&cmgr.numInboundPeers))
 	numPersistentPeers := int(atomic.LoadUint32(&cmgr.numPersistentPeers))
-	glog.V(1).Infof("Num peers: OUTBOUND(%d) INBOUND(%d) PERSISTENT(%d)", numOutboundPeers, numInboundPeers, numPersistentPeers)
+	cmgr.logger.V(1).Infof("Num peers: OUTBOUND(%d) INBOUND(%d) PERSISTENT(%d)", numOutboundPeers, numInboundPeers, numPersistentPeers)
 }
 
 func (cmgr *ConnectionManager) GetNumInboundPeers() uint32 {
@@ -544,26 +573,26 @@ func (cmgr *ConnectionManager) Stop() {
 	defer cmgr.mtxPeerMaps.Unlock()
 
 	if atomic.AddInt32(&cmgr.shutdown, 1) != 1 {
-		glog.Warningf("ConnectionManager.Stop is already in the process of " +
+		cmgr.logger.Warningf("ConnectionManager.Stop is already in the process of " +
 			"shutting down")
 		return
 	}
 	for id := range cmgr.outboundConnectionAttempts {
 		cmgr.CloseAttemptedConnection(id)
 	}
-	glog.Infof("ConnectionManager: Stopping, number of inbound peers (%v), number of outbound "+
+	cmgr.logger.Infof("ConnectionManager: Stopping, number of inbound peers (%v), number of outbound "+
 		"peers (%v), number of persistent peers (%v).", len(cmgr.inboundPeers), len(cmgr.outboundPeers),
 		len(cmgr.persistentPeers))
 	for _, peer := range cmgr.inboundPeers {
-		glog.V(1).Infof(CLog(Red, fmt.Sprintf("ConnectionManager.Stop: Inbound peer (%v)", peer)))
+		cmgr.logger.V(1).Infof(CLog(Red, fmt.Sprintf("ConnectionManager.Stop: Inbound peer (%v)", peer)))
 		peer.Disconnect("ConnectionManager.Stop: Stopping ConnectionManager")
 	}
 	for _, peer := range cmgr.outboundPeers {
-		glog.V(1).Infof("ConnectionManager.Stop: Outbound peer (%v)", peer)
+		cmgr.logger.V(1).Infof("ConnectionManager.Stop: Outbound peer (%v)", peer)
 		peer.Disconnect("ConnectionManager.Stop: Stopping ConnectionManager")
 	}
 	for _, peer := range cmgr.persistentPeers {
-		glog.V(1).Infof("ConnectionManager.Stop: Persistent peer (%v)", peer)
+		cmgr.logger.V(1).Infof("ConnectionManager.Stop: Persistent peer (%v)", peer)
 		peer.Disconnect("ConnectionManager.Stop: Stopping ConnectionManager")
 	}
 
@@ -596,7 +625,7 @@ func (cmgr *ConnectionManager) Start() {
 	// Accept inbound connections from peers on our listeners.
 	cmgr._handleInboundConnections()
 
-	glog.Infof("Full node socket initialized")
+	cmgr.logger.Infof("Full node socket initialized")
 
 	for {
 		// Log some data for each event.
@@ -605,10 +634,10 @@ func (cmgr *ConnectionManager) Start() {
 		select {
 		case oc := <-cmgr.outboundConnectionChan:
 			if oc.failed {
-				glog.V(2).Infof("ConnectionManager.Start: Failed to establish an outbound connection with "+
+				cmgr.logger.V(2).Infof("ConnectionManager.Start: Failed to establish an outbound connection with "+
 					"(id= %v)", oc.attemptId)
 			} else {
-				glog.V(2).Infof("ConnectionManager.Start: Successfully established an outbound connection with "+
+				cmgr.logger.V(2).Infof("ConnectionManager.Start: Successfully established an outbound connection with "+
 					"(addr= %v) (id= %v)", oc.connection.RemoteAddr(), oc.attemptId)
 			}
 			cmgr.mtxConnectionAttempts.Lock()
@@ -621,7 +650,7 @@ func (cmgr *ConnectionManager) Start() {
 				},
 			}
 		case ic := <-cmgr.inboundConnectionChan:
-			glog.V(2).Infof("ConnectionManager.Start: Successfully received an inbound connection from "+
+			cmgr.logger.V(2).Infof("ConnectionManager.Start: Successfully received an inbound connection from "+
 				"(addr= %v)", ic.connection.RemoteAddr())
 			cmgr.serverMessageQueue <- &ServerMessage{
 				Peer: nil,
@@ -635,7 +664,7 @@ func (cmgr *ConnectionManager) Start() {
 				// has already been called, since that is what's responsible for adding the peer
 				// to this queue in the first place.
 
-				glog.V(1).Infof("Done with peer (id=%v).", pp.ID)
+				cmgr.logger.V(1).Infof("Done with peer (id=%v).", pp.ID)
 
 				// Remove the peer from our data structures.
 				cmgr.removePeer(pp)
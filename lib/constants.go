@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -84,6 +85,10 @@ const (
 	// SnapshotBatchSize is the size in bytes of the snapshot batches sent to peers
 	SnapshotBatchSize uint32 = 100 << 20 // 100MB
 
+	// SnapshotChunkV2SizeBytes is the size in bytes after which a v2 snapshot chunk is cut. Every node must
+	// use the same value, because the chunk boundaries determine the snapshot state root.
+	SnapshotChunkV2SizeBytes uint32 = 4 << 20 // 4MB
+
 	// DatabaseCacheSize is used to save read operations when fetching records from the main Db.
 	DatabaseCacheSize uint32 = 1000000 // 1M
 
@@ -360,6 +365,102 @@ type ForkHeights struct {
 	// from PoW consensus to PoS consensus.
 	ProofOfStake2ConsensusCutoverBlockHeight uint32
 
+	// CanonicalTxnOrderingBlockHeight defines the height at which PoS blocks must order their
+	// transactions canonically by fee rate, nonce, and hash. See pos_transaction_ordering.go.
+	CanonicalTxnOrderingBlockHeight uint32
+
+	// KeyValueRecordsBlockHeight defines the height at which we begin accepting SetKeyValueRecords
+	// transactions, which write key-value records into the transactor's namespace.
+	KeyValueRecordsBlockHeight uint32
+
+	// LockupVestingSchedulesBlockHeight defines the height at which unvested CoinLockup
+	// transactions may attach a vesting schedule with a cliff height and a linear release
+	// rate, which CoinUnlock transactions enforce. See block_view_lockup_vesting_schedules.go.
+	LockupVestingSchedulesBlockHeight uint32
+
+	// PoSTimeoutBackoffParamsBlockHeight defines the height at which the multiplier used for the
+	// exponential back-off of PoS timeouts becomes a global param that the ParamUpdater can set.
+	PoSTimeoutBackoffParamsBlockHeight uint32
+
+	// MessageReadStateBlockHeight defines the height at which BasicTransfer transactions may carry
+	// a read watermark for a messaging conversation in their extra data, which consensus indexes
+	// per access group and member. See block_view_message_read_state.go.
+	MessageReadStateBlockHeight uint32
+
+	// MessageAttachmentsBlockHeight defines the height at which NewMessage transactions may carry
+	// a manifest of the chunks of an encrypted attachment stored off-chain, which consensus
+	// validates and stores on the NewMessageEntry. See block_view_new_message_attachments.go.
+	MessageAttachmentsBlockHeight uint32
+
+	// BlockRewardMaturityParamsBlockHeight defines the height at which the number of blocks for
+	// which a block reward stays unspendable after the cut-over to Proof of Stake becomes a global
+	// param that the ParamUpdater can set. See block_view_spendable_balance.go.
+	BlockRewardMaturityParamsBlockHeight uint32
+
+	// NFTBatchBlockHeight defines the height at which we begin accepting NFTBatch transactions,
+	// which mint, transfer, accept, or burn a contiguous range of serial numbers of an NFT at
+	// once. See block_view_nft_batch.go.
+	NFTBatchBlockHeight uint32
+
+	// UtxoOperationCompactEncodingBlockHeight defines the height at which UtxoOperations are
+	// stored in a compact encoding that only includes the fields that each operation sets.
+	// See utxo_operation_compact_encoding.go.
+	UtxoOperationCompactEncodingBlockHeight uint32
+
+	// NFTAvatarBlockHeight defines the height at which UpdateProfile transactions may reference an
+	// NFT the profile owns as its avatar in their extra data, which consensus verifies and indexes.
+	// See block_view_nft_avatar.go.
+	NFTAvatarBlockHeight uint32
+
+	// BridgeEventAnchorBlockHeight defines the height at which we begin accepting BridgeEventAnchor
+	// transactions, which record events of external chains attested by the bridge operators.
+	// See block_view_bridge_event_anchor.go.
+	BridgeEventAnchorBlockHeight uint32
+
+	// DelegatedPosterBlockHeight defines the height at which we begin accepting DelegatedPoster
+	// transactions, and at which SubmitPost transactions may be attributed to an account that
+	// authorized the transactor to post on its behalf. See block_view_delegated_poster.go.
+	DelegatedPosterBlockHeight uint32
+
+	// ValidatorVotingKeyRotationBlockHeight defines the height at which we begin accepting
+	// RotateValidatorVotingKey transactions, which let a registered validator replace its BLS
+	// voting key at the next epoch without unstaking. See block_view_validator_voting_key_rotation.go.
+	ValidatorVotingKeyRotationBlockHeight uint32
+
+	// AnchorHashBlockHeight defines the height at which we begin accepting AnchorHash transactions,
+	// which record the hash of off-chain content so that applications can prove when it existed.
+	// See block_view_anchor_hash.go.
+	AnchorHashBlockHeight uint32
+
+	// TxindexExtractedMetadataBlockHeight defines the height at which the metadata derived by
+	// registered TxindexMetadataExtractors starts being stored with each txn's TransactionMetadata.
+	// See txindex_metadata_extractors.go.
+	TxindexExtractedMetadataBlockHeight uint32
+
+	// MedianTimePastBlockHeight defines the height from which a block's timestamp must be greater
+	// than the median time past of its parent, for both PoW and PoS blocks. See median_time_past.go.
+	MedianTimePastBlockHeight uint32
+
+	// FeeRedistributionParamsBlockHeight defines the height at which the share of PoS transaction fees
+	// that the block producer can claim instead of burning becomes a global param that the ParamUpdater
+	// can set, and from which the realized fee split of each block is indexed. See block_view_fee_split.go.
+	FeeRedistributionParamsBlockHeight uint32
+
+	// SubscriptionBlockHeight defines the height at which we begin accepting Subscription transactions,
+	// which let an account authorize a recipient to claim up to a fixed amount of DESO or a DAO coin
+	// from it every period. See block_view_subscription.go.
+	SubscriptionBlockHeight uint32
+
+	// LockupPositionTransfersBlockHeight defines the height at which CoinLockupTransfer transactions
+	// can transfer vested LockedBalanceEntries and LockedBalanceEntries with a vesting schedule, keeping
+	// their lockup terms intact. See block_view_lockup_position_transfers.go.
+	LockupPositionTransfersBlockHeight uint32
+
+	// DeterministicTxnShuffleBlockHeight defines the height from which the transactions of PoW and PoS
+	// blocks must be ordered by the deterministic shuffle, in place of the canonical order. Networks
+	// choose whether to enforce it. See deterministic_txn_shuffle.go.
+	DeterministicTxnShuffleBlockHeight uint32
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -420,11 +521,22 @@ type MigrationHeight struct {
 }
 
 const (
-	DefaultMigration                     MigrationName = "DefaultMigration"
-	UnlimitedDerivedKeysMigration        MigrationName = "UnlimitedDerivedKeysMigration"
-	AssociationsAndAccessGroupsMigration MigrationName = "AssociationsAndAccessGroupsMigration"
-	BalanceModelMigration                MigrationName = "BalanceModelMigration"
-	ProofOfStake1StateSetupMigration     MigrationName = "ProofOfStake1StateSetupMigration"
+	DefaultMigration                      MigrationName = "DefaultMigration"
+	UnlimitedDerivedKeysMigration         MigrationName = "UnlimitedDerivedKeysMigration"
+	AssociationsAndAccessGroupsMigration  MigrationName = "AssociationsAndAccessGroupsMigration"
+	BalanceModelMigration                 MigrationName = "BalanceModelMigration"
+	ProofOfStake1StateSetupMigration      MigrationName = "ProofOfStake1StateSetupMigration"
+	KeyValueRecordsMigration              MigrationName = "KeyValueRecordsMigration"
+	PoSTimeoutBackoffParamsMigration      MigrationName = "PoSTimeoutBackoffParamsMigration"
+	MessageReadStateMigration             MigrationName = "MessageReadStateMigration"
+	MessageAttachmentsMigration           MigrationName = "MessageAttachmentsMigration"
+	BlockRewardMaturityParamsMigration    MigrationName = "BlockRewardMaturityParamsMigration"
+	NFTBatchMigration                     MigrationName = "NFTBatchMigration"
+	UtxoOperationCompactEncodingMigration MigrationName = "UtxoOperationCompactEncodingMigration"
+	NFTAvatarMigration                    MigrationName = "NFTAvatarMigration"
+	ValidatorVotingKeyRotationMigration   MigrationName = "ValidatorVotingKeyRotationMigration"
+	TxindexExtractedMetadataMigration     MigrationName = "TxindexExtractedMetadataMigration"
+	FeeRedistributionParamsMigration      MigrationName = "FeeRedistributionParamsMigration"
 )
 
 type EncoderMigrationHeights struct {
@@ -441,6 +553,39 @@ type EncoderMigrationHeights struct {
 
 	// This coincides with the ProofOfStake1StateSetupBlockHeight
 	ProofOfStake1StateSetupMigration MigrationHeight
+
+	// This coincides with the KeyValueRecordsBlockHeight
+	KeyValueRecordsMigration MigrationHeight
+
+	// This coincides with the PoSTimeoutBackoffParamsBlockHeight
+	PoSTimeoutBackoffParamsMigration MigrationHeight
+
+	// This coincides with the MessageReadStateBlockHeight
+	MessageReadStateMigration MigrationHeight
+
+	// This coincides with the MessageAttachmentsBlockHeight
+	MessageAttachmentsMigration MigrationHeight
+
+	// This coincides with the BlockRewardMaturityParamsBlockHeight
+	BlockRewardMaturityParamsMigration MigrationHeight
+
+	// This coincides with the NFTBatchBlockHeight
+	NFTBatchMigration MigrationHeight
+
+	// This coincides with the UtxoOperationCompactEncodingBlockHeight
+	UtxoOperationCompactEncodingMigration MigrationHeight
+
+	// This coincides with the NFTAvatarBlockHeight
+	NFTAvatarMigration MigrationHeight
+
+	// This coincides with the ValidatorVotingKeyRotationBlockHeight
+	ValidatorVotingKeyRotationMigration MigrationHeight
+
+	// This coincides with the TxindexExtractedMetadataBlockHeight
+	TxindexExtractedMetadataMigration MigrationHeight
+
+	// This coincides with the FeeRedistributionParamsBlockHeight
+	FeeRedistributionParamsMigration MigrationHeight
 }
 
 func GetEncoderMigrationHeights(forkHeights *ForkHeights) *EncoderMigrationHeights {
@@ -470,6 +615,61 @@ func GetEncoderMigrationHeights(forkHeights *ForkHeights) *EncoderMigrationHeigh
 			Height:  uint64(forkHeights.ProofOfStake1StateSetupBlockHeight),
 			Name:    ProofOfStake1StateSetupMigration,
 		},
+		KeyValueRecordsMigration: MigrationHeight{
+			Version: 5,
+			Height:  uint64(forkHeights.KeyValueRecordsBlockHeight),
+			Name:    KeyValueRecordsMigration,
+		},
+		PoSTimeoutBackoffParamsMigration: MigrationHeight{
+			Version: 6,
+			Height:  uint64(forkHeights.PoSTimeoutBackoffParamsBlockHeight),
+			Name:    PoSTimeoutBackoffParamsMigration,
+		},
+		MessageReadStateMigration: MigrationHeight{
+			Version: 7,
+			Height:  uint64(forkHeights.MessageReadStateBlockHeight),
+			Name:    MessageReadStateMigration,
+		},
+		MessageAttachmentsMigration: MigrationHeight{
+			Version: 8,
+			Height:  uint64(forkHeights.MessageAttachmentsBlockHeight),
+			Name:    MessageAttachmentsMigration,
+		},
+		BlockRewardMaturityParamsMigration: MigrationHeight{
+			Version: 9,
+			Height:  uint64(forkHeights.BlockRewardMaturityParamsBlockHeight),
+			Name:    BlockRewardMaturityParamsMigration,
+		},
+		NFTBatchMigration: MigrationHeight{
+			Version: 10,
+			Height:  uint64(forkHeights.NFTBatchBlockHeight),
+			Name:    NFTBatchMigration,
+		},
+		UtxoOperationCompactEncodingMigration: MigrationHeight{
+			Version: 11,
+			Height:  uint64(forkHeights.UtxoOperationCompactEncodingBlockHeight),
+			Name:    UtxoOperationCompactEncodingMigration,
+		},
+		NFTAvatarMigration: MigrationHeight{
+			Version: 12,
+			Height:  uint64(forkHeights.NFTAvatarBlockHeight),
+			Name:    NFTAvatarMigration,
+		},
+		ValidatorVotingKeyRotationMigration: MigrationHeight{
+			Version: 13,
+			Height:  uint64(forkHeights.ValidatorVotingKeyRotationBlockHeight),
+			Name:    ValidatorVotingKeyRotationMigration,
+		},
+		TxindexExtractedMetadataMigration: MigrationHeight{
+			Version: 14,
+			Height:  uint64(forkHeights.TxindexExtractedMetadataBlockHeight),
+			Name:    TxindexExtractedMetadataMigration,
+		},
+		FeeRedistributionParamsMigration: MigrationHeight{
+			Version: 15,
+			Height:  uint64(forkHeights.FeeRedistributionParamsBlockHeight),
+			Name:    FeeRedistributionParamsMigration,
+		},
 	}
 }
 
@@ -603,6 +803,20 @@ type DeSoParams struct {
 	// The expected hash of the genesis block. Should align with what one
 	// would get from actually hashing the provided genesis block.
 	GenesisBlockHashHex string
+	// BlockCheckpoints pin the hashes of known blocks on the canonical chain. Headers that conflict
+	// with a checkpoint are rejected, which protects fresh nodes from long-range fake chains. More
+	// checkpoints can be supplied by the node operator with --block-checkpoints-file. See
+	// BlockCheckpoint for the details.
+	BlockCheckpoints []BlockCheckpoint
+	// SoftForkDeployments are rule changes that activate once enough block producers signal for them,
+	// rather than at a fixed fork height. See soft_fork_deployments.go.
+	SoftForkDeployments []SoftForkDeployment
+	// The number of blocks in a soft fork signaling window. Deployments only change state at the start
+	// of a window.
+	SoftForkSignalingWindowBlocks uint64
+	// The share of the blocks in a signaling window, in basis points, that must signal for a deployment
+	// for it to lock in.
+	SoftForkActivationThresholdBasisPoints uint64
 	// How often we target a single block to be generated.
 	TimeBetweenBlocks time.Duration
 	// How many blocks between difficulty retargets.
@@ -642,6 +856,10 @@ type DeSoParams struct {
 	// to be before it is rejected.
 	MaxTstampOffsetSeconds uint64
 
+	// The number of blocks whose timestamps the median time past of a block is
+	// computed over, including the block itself.
+	MedianTimePastBlockCount uint32
+
 	// The maximum number of bytes that can be allocated to transactions in
 	// a block.
 	MaxBlockSizeBytesPoW uint64
@@ -679,6 +897,11 @@ type DeSoParams struct {
 	MaxPrivateMessageLengthBytes  uint64
 	MaxNewMessageLengthBytes      uint64
 
+	// Limits on the manifest of off-chain attachment chunks a NewMessage transaction may carry.
+	MaxMessageAttachmentChunks         uint64
+	MaxMessageAttachmentChunkSizeBytes uint64
+	MaxMessageAttachmentTotalSizeBytes uint64
+
 	StakeFeeBasisPoints         uint64
 	MaxPostBodyLengthBytes      uint64
 	MaxPostSubLengthBytes       uint64
@@ -686,6 +909,36 @@ type DeSoParams struct {
 	MaxCreatorBasisPoints       uint64
 	MaxNFTRoyaltyBasisPoints    uint64
 
+	// MaxNFTBatchSerialsPerTxn is the max number of serial numbers an NFTBatch transaction can
+	// operate on. Each serial is validated and updated individually, so this bounds the work and
+	// the size of the UtxoOperation of the transaction.
+	MaxNFTBatchSerialsPerTxn uint64
+
+	// Limits on the key-value records written by SetKeyValueRecords transactions.
+	MaxKeyValueRecordKeyLengthBytes   uint64
+	MaxKeyValueRecordValueLengthBytes uint64
+	MaxKeyValueRecordsPerTxn          uint64
+	// KeyValueRecordFeeNanosPerByte is burned for every byte of key and value written by a
+	// SetKeyValueRecords transaction, on top of the regular transaction fee.
+	KeyValueRecordFeeNanosPerByte uint64
+
+	// BridgeOperatorPublicKeys are the bridge operators whitelisted to submit and attest
+	// BridgeEventAnchor transactions. BridgeEventAnchorMinAttestations is the number of
+	// distinct operators that have to attest an event for it to be anchored.
+	BridgeOperatorPublicKeys         map[PkMapKey]bool
+	BridgeEventAnchorMinAttestations uint64
+	// MaxBridgeEventFieldLengthBytes bounds the deposit hash and the asset ID of an anchored
+	// event, which are opaque identifiers on the external chain.
+	MaxBridgeEventFieldLengthBytes uint64
+
+	// Limits on the content hashes anchored by AnchorHash transactions. A public key can anchor at
+	// most MaxAnchorHashesPerWindow hashes in each window of AnchorHashRateLimitWindowBlocks blocks,
+	// which keeps the cheap txn from being used to spam the index.
+	MaxAnchorHashContentHashLengthBytes uint64
+	MaxAnchorHashMimeTypeLengthBytes    uint64
+	AnchorHashRateLimitWindowBlocks     uint64
+	MaxAnchorHashesPerWindow            uint64
+
 	// A list of transactions to apply when initializing the chain. Useful in
 	// cases where we want to hard fork or reboot the chain with specific
 	// transactions applied.
@@ -826,6 +1079,11 @@ type DeSoParams struct {
 	// This is the initial value for the interval between timing out a view.
 	DefaultTimeoutIntervalMillisecondsPoS uint64
 
+	// DefaultTimeoutBackoffMultiplierBasisPointsPoS is the default value for
+	// GlobalParamsEntry.TimeoutBackoffMultiplierBasisPointsPoS. This is the initial value for the
+	// multiplier applied to the timeout interval for every consecutive timeout.
+	DefaultTimeoutBackoffMultiplierBasisPointsPoS uint64
+
 	// HandshakeTimeoutMicroSeconds is the timeout for the peer handshake certificate. The default value is 15 minutes.
 	HandshakeTimeoutMicroSeconds uint64
 
@@ -883,6 +1141,46 @@ var RegtestForkHeights = ForkHeights{
 
 	BlockRewardPatchBlockHeight: uint32(0),
 
+	CanonicalTxnOrderingBlockHeight: uint32(0),
+
+	KeyValueRecordsBlockHeight: uint32(0),
+
+	LockupVestingSchedulesBlockHeight: uint32(0),
+
+	PoSTimeoutBackoffParamsBlockHeight: uint32(0),
+
+	MessageReadStateBlockHeight: uint32(0),
+
+	MessageAttachmentsBlockHeight: uint32(0),
+
+	BlockRewardMaturityParamsBlockHeight: uint32(0),
+
+	NFTBatchBlockHeight: uint32(0),
+
+	UtxoOperationCompactEncodingBlockHeight: uint32(0),
+
+	NFTAvatarBlockHeight: uint32(0),
+
+	BridgeEventAnchorBlockHeight: uint32(0),
+
+	DelegatedPosterBlockHeight: uint32(0),
+
+	ValidatorVotingKeyRotationBlockHeight: uint32(0),
+
+	AnchorHashBlockHeight: uint32(0),
+
+	TxindexExtractedMetadataBlockHeight: uint32(0),
+
+	MedianTimePastBlockHeight: uint32(0),
+
+	FeeRedistributionParamsBlockHeight: uint32(0),
+
+	SubscriptionBlockHeight: uint32(0),
+
+	LockupPositionTransfersBlockHeight: uint32(0),
+
+	DeterministicTxnShuffleBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -960,6 +1258,22 @@ func (params *DeSoParams) GetFirstPoSBlockHeight() uint64 {
 	return uint64(params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight)
 }
 
+// IsCanonicalTxnOrderingBlockHeight returns true if blocks at the given height must have their
+// transactions in the canonical order. The rule only applies to PoS blocks, and not once the
+// deterministic shuffle is enforced.
+func (params *DeSoParams) IsCanonicalTxnOrderingBlockHeight(blockHeight uint64) bool {
+	return params.IsPoSBlockHeight(blockHeight) &&
+		blockHeight >= uint64(params.ForkHeights.CanonicalTxnOrderingBlockHeight) &&
+		!params.IsDeterministicTxnShuffleBlockHeight(blockHeight)
+}
+
+// IsDeterministicTxnShuffleBlockHeight returns true if blocks at the given height must have their
+// transactions in the deterministic shuffle order. The rule applies to PoW and PoS blocks, and it
+// takes precedence over the canonical order.
+func (params *DeSoParams) IsDeterministicTxnShuffleBlockHeight(blockHeight uint64) bool {
+	return blockHeight >= uint64(params.ForkHeights.DeterministicTxnShuffleBlockHeight)
+}
+
 func (params *DeSoParams) GetSnapshotBlockHeightPeriod(blockHeight uint64, currentSnapshotBlockHeightPeriod uint64) uint64 {
 	if blockHeight < uint64(params.ForkHeights.ProofOfStake1StateSetupBlockHeight) {
 		return params.DefaultPoWSnapshotBlockHeightPeriod
@@ -1093,6 +1407,46 @@ var MainnetForkHeights = ForkHeights{
 	// Tues July 2 2024 @ 12pm PST
 	LockupsBlockHeight: uint32(349167),
 
+	CanonicalTxnOrderingBlockHeight: uint32(math.MaxUint32),
+
+	KeyValueRecordsBlockHeight: uint32(math.MaxUint32),
+
+	LockupVestingSchedulesBlockHeight: uint32(math.MaxUint32),
+
+	PoSTimeoutBackoffParamsBlockHeight: uint32(math.MaxUint32),
+
+	MessageReadStateBlockHeight: uint32(math.MaxUint32),
+
+	MessageAttachmentsBlockHeight: uint32(math.MaxUint32),
+
+	BlockRewardMaturityParamsBlockHeight: uint32(math.MaxUint32),
+
+	NFTBatchBlockHeight: uint32(math.MaxUint32),
+
+	UtxoOperationCompactEncodingBlockHeight: uint32(math.MaxUint32),
+
+	NFTAvatarBlockHeight: uint32(math.MaxUint32),
+
+	BridgeEventAnchorBlockHeight: uint32(math.MaxUint32),
+
+	DelegatedPosterBlockHeight: uint32(math.MaxUint32),
+
+	ValidatorVotingKeyRotationBlockHeight: uint32(math.MaxUint32),
+
+	AnchorHashBlockHeight: uint32(math.MaxUint32),
+
+	TxindexExtractedMetadataBlockHeight: uint32(math.MaxUint32),
+
+	MedianTimePastBlockHeight: uint32(math.MaxUint32),
+
+	FeeRedistributionParamsBlockHeight: uint32(math.MaxUint32),
+
+	SubscriptionBlockHeight: uint32(math.MaxUint32),
+
+	LockupPositionTransfersBlockHeight: uint32(math.MaxUint32),
+
+	DeterministicTxnShuffleBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -1124,6 +1478,14 @@ var DeSoMainnetParams = DeSoParams{
 
 	GenesisBlock:        &GenesisBlock,
 	GenesisBlockHashHex: GenesisBlockHashHex,
+	// Checkpoints are added here as part of a release, once the corresponding blocks are deeply committed.
+	BlockCheckpoints: []BlockCheckpoint{},
+
+	// Deployments are added here as part of a release, before their StartBlockHeight.
+	SoftForkDeployments:                    []SoftForkDeployment{},
+	SoftForkSignalingWindowBlocks:          10000,
+	SoftForkActivationThresholdBasisPoints: 9000,
+
 	// This is used as the starting difficulty for the chain.
 	MinDifficultyTargetHex: "000001FFFF000000000000000000000000000000000000000000000000000000",
 
@@ -1213,6 +1575,9 @@ var DeSoMainnetParams = DeSoParams{
 	// Reject blocks that are more than two hours in the future.
 	MaxTstampOffsetSeconds: 2 * 60 * 60,
 
+	// Compute the median time past over the last eleven blocks, as Bitcoin does.
+	MedianTimePastBlockCount: 11,
+
 	// We use a max block size of 16MB. This translates to 100-200 posts per
 	// second depending on the size of the post, which should support around
 	// ten million active users. We compute this by taking Twitter, which averages
@@ -1249,6 +1614,12 @@ var DeSoMainnetParams = DeSoParams{
 	// data a new message is allowed to include in an NewMessage transaction.
 	MaxNewMessageLengthBytes: 10000,
 
+	// The attachment of a new message is stored off-chain in chunks of at most 4MB each,
+	// and may be at most 100MB in total.
+	MaxMessageAttachmentChunks:         64,
+	MaxMessageAttachmentChunkSizeBytes: 4 << 20,
+	MaxMessageAttachmentTotalSizeBytes: 100 << 20,
+
 	// Set the stake fee to 10%
 	StakeFeeBasisPoints: 10 * 100,
 	// TODO(performance): We're currently storing posts using HTML, which is
@@ -1264,6 +1635,23 @@ var DeSoMainnetParams = DeSoParams{
 	MaxCreatorBasisPoints:    100 * 100,
 	MaxNFTRoyaltyBasisPoints: 100 * 100,
 
+	MaxNFTBatchSerialsPerTxn: 1000,
+
+	MaxKeyValueRecordKeyLengthBytes:   128,
+	MaxKeyValueRecordValueLengthBytes: 10000,
+	MaxKeyValueRecordsPerTxn:          100,
+	KeyValueRecordFeeNanosPerByte:     10,
+
+	// No bridge operators are whitelisted until the bridge launches.
+	BridgeOperatorPublicKeys:         map[PkMapKey]bool{},
+	BridgeEventAnchorMinAttestations: 2,
+	MaxBridgeEventFieldLengthBytes:   128,
+
+	MaxAnchorHashContentHashLengthBytes: 64,
+	MaxAnchorHashMimeTypeLengthBytes:    128,
+	AnchorHashRateLimitWindowBlocks:     3600,
+	MaxAnchorHashesPerWindow:            100,
+
 	// Use a canonical set of seed transactions.
 	SeedTxns: SeedTxns,
 
@@ -1371,6 +1759,9 @@ var DeSoMainnetParams = DeSoParams{
 	// The interval between timing out a view.
 	DefaultTimeoutIntervalMillisecondsPoS: 30000,
 
+	// The multiplier applied to the timeout interval for every consecutive timeout.
+	DefaultTimeoutBackoffMultiplierBasisPointsPoS: 20000,
+
 	// The peer handshake certificate timeout.
 	HandshakeTimeoutMicroSeconds: uint64(900000000),
 
@@ -1496,6 +1887,46 @@ var TestnetForkHeights = ForkHeights{
 	// Wed May 1 2024 @ 12pm PT
 	LockupsBlockHeight: uint32(1113866),
 
+	CanonicalTxnOrderingBlockHeight: uint32(math.MaxUint32),
+
+	KeyValueRecordsBlockHeight: uint32(math.MaxUint32),
+
+	LockupVestingSchedulesBlockHeight: uint32(math.MaxUint32),
+
+	PoSTimeoutBackoffParamsBlockHeight: uint32(math.MaxUint32),
+
+	MessageReadStateBlockHeight: uint32(math.MaxUint32),
+
+	MessageAttachmentsBlockHeight: uint32(math.MaxUint32),
+
+	BlockRewardMaturityParamsBlockHeight: uint32(math.MaxUint32),
+
+	NFTBatchBlockHeight: uint32(math.MaxUint32),
+
+	UtxoOperationCompactEncodingBlockHeight: uint32(math.MaxUint32),
+
+	NFTAvatarBlockHeight: uint32(math.MaxUint32),
+
+	BridgeEventAnchorBlockHeight: uint32(math.MaxUint32),
+
+	DelegatedPosterBlockHeight: uint32(math.MaxUint32),
+
+	ValidatorVotingKeyRotationBlockHeight: uint32(math.MaxUint32),
+
+	AnchorHashBlockHeight: uint32(math.MaxUint32),
+
+	TxindexExtractedMetadataBlockHeight: uint32(math.MaxUint32),
+
+	MedianTimePastBlockHeight: uint32(math.MaxUint32),
+
+	FeeRedistributionParamsBlockHeight: uint32(math.MaxUint32),
+
+	SubscriptionBlockHeight: uint32(math.MaxUint32),
+
+	LockupPositionTransfersBlockHeight: uint32(math.MaxUint32),
+
+	DeterministicTxnShuffleBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -1553,6 +1984,13 @@ var DeSoTestnetParams = DeSoParams{
 
 	GenesisBlock:        &GenesisBlock,
 	GenesisBlockHashHex: GenesisBlockHashHex,
+	// Checkpoints are added here as part of a release, once the corresponding blocks are deeply committed.
+	BlockCheckpoints: []BlockCheckpoint{},
+
+	// Deployments are added here as part of a release, before their StartBlockHeight.
+	SoftForkDeployments:                    []SoftForkDeployment{},
+	SoftForkSignalingWindowBlocks:          10000,
+	SoftForkActivationThresholdBasisPoints: 9000,
 
 	// Use a faster block time in the testnet.
 	TimeBetweenBlocks: 1 * time.Minute,
@@ -1581,6 +2019,9 @@ var DeSoTestnetParams = DeSoParams{
 	// Reject blocks that are more than two hours in the future.
 	MaxTstampOffsetSeconds: 2 * 60 * 60,
 
+	// Compute the median time past over the last eleven blocks, as Bitcoin does.
+	MedianTimePastBlockCount: 11,
+
 	// We use a max block size of 1MB. This seems to work well for BTC and
 	// most of our data doesn't need to be stored on the blockchain anyway.
 	MaxBlockSizeBytesPoW: 1000000,
@@ -1612,6 +2053,12 @@ var DeSoTestnetParams = DeSoParams{
 	// data a new message is allowed to include in an NewMessage transaction.
 	MaxNewMessageLengthBytes: 10000,
 
+	// The attachment of a new message is stored off-chain in chunks of at most 4MB each,
+	// and may be at most 100MB in total.
+	MaxMessageAttachmentChunks:         64,
+	MaxMessageAttachmentChunkSizeBytes: 4 << 20,
+	MaxMessageAttachmentTotalSizeBytes: 100 << 20,
+
 	// Set the stake fee to 5%
 	StakeFeeBasisPoints: 5 * 100,
 	// TODO(performance): We're currently storing posts using HTML, which
@@ -1627,6 +2074,23 @@ var DeSoTestnetParams = DeSoParams{
 	MaxCreatorBasisPoints:    100 * 100,
 	MaxNFTRoyaltyBasisPoints: 100 * 100,
 
+	MaxNFTBatchSerialsPerTxn: 1000,
+
+	MaxKeyValueRecordKeyLengthBytes:   128,
+	MaxKeyValueRecordValueLengthBytes: 10000,
+	MaxKeyValueRecordsPerTxn:          100,
+	KeyValueRecordFeeNanosPerByte:     10,
+
+	// No bridge operators are whitelisted until the bridge launches.
+	BridgeOperatorPublicKeys:         map[PkMapKey]bool{},
+	BridgeEventAnchorMinAttestations: 2,
+	MaxBridgeEventFieldLengthBytes:   128,
+
+	MaxAnchorHashContentHashLengthBytes: 64,
+	MaxAnchorHashMimeTypeLengthBytes:    128,
+	AnchorHashRateLimitWindowBlocks:     3600,
+	MaxAnchorHashesPerWindow:            100,
+
 	// Use a canonical set of seed transactions.
 	SeedTxns: TestSeedTxns,
 
@@ -1706,6 +2170,9 @@ var DeSoTestnetParams = DeSoParams{
 	// The interval between timing out a view.
 	DefaultTimeoutIntervalMillisecondsPoS: 30000, // 30s TODO: verify this is a sane value.
 
+	// The multiplier applied to the timeout interval for every consecutive timeout.
+	DefaultTimeoutBackoffMultiplierBasisPointsPoS: 20000, // 2x
+
 	// The peer handshake certificate timeout.
 	HandshakeTimeoutMicroSeconds: uint64(900000000),
 
@@ -1788,10 +2255,45 @@ const (
 	MaxTxnSizeBytesPoSKey                             = "MaxTxnSizeBytesPoS"
 	BlockProductionIntervalPoSKey                     = "BlockProductionIntervalPoS"
 	TimeoutIntervalPoSKey                             = "TimeoutIntervalPoS"
+	TimeoutBackoffMultiplierBasisPointsPoSKey         = "TimeoutBackoffMultiplierBasisPointsPoS"
+	BlockRewardMaturityBlocksKey                      = "BlockRewardMaturityBlocks"
+	FeeRedistributionBasisPointsKey                   = "FeeRedistributionBasisPoints"
 
 	DiamondLevelKey    = "DiamondLevel"
 	DiamondPostHashKey = "DiamondPostHash"
 
+	// Keys in a CoinLockup transaction's extra data map. If present, the locked coins vest
+	// on the schedule they describe. See block_view_lockup_vesting_schedules.go.
+	LockupVestingCliffBlockHeightKey             = "LockupVestingCliffBlockHeight"
+	LockupVestingReleaseRateBaseUnitsPerBlockKey = "LockupVestingReleaseRateBaseUnitsPerBlock"
+
+	// Key in a CoinLockupTransfer transaction's extra data map. If present, the transfer sources the
+	// vested LockedBalanceEntry with this VestingEndTimestampNanoSecs. See
+	// block_view_lockup_position_transfers.go.
+	LockupTransferVestingEndTimestampNanoSecsKey = "LockupTransferVestingEndTimestampNanoSecs"
+
+	// Keys in a BasicTransfer transaction's extra data map. If present, the transactor's read
+	// watermark for the access group is set. See block_view_message_read_state.go.
+	MessageReadStateGroupOwnerPublicKeyKey = "MessageReadStateGroupOwnerPublicKey"
+	MessageReadStateGroupKeyNameKey        = "MessageReadStateGroupKeyName"
+	MessageReadStateWatermarkNanosKey      = "MessageReadStateWatermarkNanos"
+
+	// Key in a NewMessage transaction's extra data map. If present, it holds the encoded manifest of
+	// the message's off-chain attachment chunks. See block_view_new_message_attachments.go.
+	MessageAttachmentManifestKey = "MessageAttachmentManifest"
+
+	// Keys in an UpdateProfile transaction's extra data map. If present, they reference the NFT the
+	// profile uses as its avatar, which the profile must own. See block_view_nft_avatar.go.
+	NFTAvatarPostHashKey     = "NFTAvatarPostHash"
+	NFTAvatarSerialNumberKey = "NFTAvatarSerialNumber"
+
+	// Key in a SubmitPost transaction's extra data map. If present, the post is attributed to the
+	// owner with this public key, who must have authorized the transactor to post on its behalf.
+	// Consensus records the transactor in the post's extra data under DelegatedPostDelegatePublicKeyKey.
+	// See block_view_delegated_poster.go.
+	DelegatedPostOwnerPublicKeyKey    = "DelegatedPostOwnerPublicKey"
+	DelegatedPostDelegatePublicKeyKey = "DelegatedPostDelegatePublicKey"
+
 	// Atomic Transaction Keys
 	AtomicTxnsChainLength    = "AtmcChnLen"
 	NextAtomicTxnPreHash     = "NxtAtmcHsh"
@@ -1849,7 +2351,7 @@ const (
 
 // Defines values that may exist in a transaction's ExtraData map
 var (
-	PostExtraDataConsensusKeys = [2]string{RepostedPostHash, IsQuotedRepostKey}
+	PostExtraDataConsensusKeys = [3]string{RepostedPostHash, IsQuotedRepostKey, DelegatedPostDelegatePublicKeyKey}
 )
 
 var (
@@ -1923,6 +2425,17 @@ const (
 	// Min/MaxTimeoutIntervalMillisecondsPoS - Min/max value to which the timeout interval can be set.
 	MinTimeoutIntervalMillisecondsPoS = 1000  // 1s TODO: Verify this is a sane value.
 	MaxTimeoutIntervalMillisecondsPoS = 60000 // 60s TODO: Verify this is a sane value.
+	// Min/MaxTimeoutBackoffMultiplierBasisPointsPoS - Min/max value to which the timeout back-off multiplier can be
+	// set. The timeouts must not get shorter as they back off, and the max keeps the longest back-off, after
+	// consensus.maxConsecutiveTimeouts timeouts at the max timeout interval, within a time.Duration.
+	MinTimeoutBackoffMultiplierBasisPointsPoS = 10000 // 1x
+	MaxTimeoutBackoffMultiplierBasisPointsPoS = 30000 // 3x
+	// MaxBlockRewardMaturityBlocks - Max value to which the block reward maturity depth can be set. Computing
+	// the spendable balance of a public key reads this many blocks, so it has to stay small.
+	MaxBlockRewardMaturityBlocks = 1000
+	// MaxFeeRedistributionBasisPoints - Max value to which the share of the fees that would otherwise be burned,
+	// and that the block producer can claim instead, can be set. At least half of those fees are always burned.
+	MaxFeeRedistributionBasisPoints = 5000 // 50%
 
 	// DefaultMaxNonceExpirationBlockHeightOffset - default value to which the MaxNonceExpirationBlockHeightOffset
 	// is set to before specified by ParamUpdater.
@@ -0,0 +1,251 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Core Reader
+//
+// Indexers that run as plugins outside of the node need to read the blocks and the state the node stores, but the
+// Blockchain, the UtxoView, and the db_utils helpers change with every release. The CoreReader is the narrow,
+// versioned surface they read through instead: blocks by height or hash, entries by key, prefix iteration, and
+// decoding entries with the DB schema, see db_schema.go. Its types only hold integers, strings, byte slices, and
+// BlockHashes, so that it can be served to a plugin over RPC, e.g. gRPC, without exposing internal types.
+//
+// Compatibility is tracked by the CoreReaderAPIVersion:
+//   - Within a major version, methods and fields are only added, and the meaning of the existing ones doesn't
+//     change. Adding one bumps the minor version.
+//   - Anything else, such as removing a method or changing what it returns, bumps the major version.
+//
+// The keys and values the CoreReader returns are the ones stored in the DB, which are documented in
+// docs/db_schema.md. They're stable on their own: prefix IDs are never reused, and a DeSoEncoder stored in a value
+// carries its encoder version, so a plugin can decode entries written before and after an encoder migration.
+// DecodeEntry does this with the node's own schema.
+
+// CoreReaderAPIVersion is the version of the CoreReader API.
+type CoreReaderAPIVersion struct {
+	Major uint32
+	Minor uint32
+}
+
+// CurrentCoreReaderAPIVersion is the version of the CoreReader API this node implements.
+var CurrentCoreReaderAPIVersion = CoreReaderAPIVersion{Major: 1, Minor: 0}
+
+// IsCompatibleWith returns true if a plugin that requires the given version can use a CoreReader of this version.
+func (version CoreReaderAPIVersion) IsCompatibleWith(required CoreReaderAPIVersion) bool {
+	return version.Major == required.Major && version.Minor >= required.Minor
+}
+
+func (version CoreReaderAPIVersion) String() string {
+	return fmt.Sprintf("%d.%d", version.Major, version.Minor)
+}
+
+// CoreReaderBlock is a block read through a CoreReader.
+type CoreReaderBlock struct {
+	Hash   *BlockHash
+	Height uint64
+	// IsOnBestChain is false for a block that was orphaned or reorged out.
+	IsOnBestChain bool
+	// BlockBytes is the block in its network encoding. It can be decoded with MsgDeSoBlock.FromBytes.
+	BlockBytes []byte
+}
+
+// CoreReaderDecodedEntry is a DB entry decoded with the DB schema of its prefix.
+type CoreReaderDecodedEntry struct {
+	// PrefixName is the name of the entry's prefix in DBPrefixes, e.g. "PrefixPostHashToPostEntry".
+	PrefixName string
+	KeyFields  []*DBSchemaFieldValue
+	// ValueEncoder is set if the prefix stores a DeSoEncoder, in which case ValueFields is empty. It's nil if the
+	// stored DeSoEncoder is nil.
+	ValueEncoder DeSoEncoder
+	ValueFields  []*DBSchemaFieldValue
+}
+
+// CoreReader is the read-only API for indexer plugins. See the comment at the top of this file.
+type CoreReader interface {
+	// GetAPIVersion returns the version of the API the reader implements.
+	GetAPIVersion() CoreReaderAPIVersion
+
+	// GetTip returns the tip of the best chain, without the block's bytes.
+	GetTip() (*CoreReaderBlock, error)
+	// GetBlockByHeight returns the block at the height on the best chain, or nil if there's none or the node
+	// doesn't store it, e.g. because it hypersynced past it.
+	GetBlockByHeight(height uint64) (*CoreReaderBlock, error)
+	// GetBlockByHash returns the block with the hash, or nil if the node doesn't store it.
+	GetBlockByHash(blockHash *BlockHash) (*CoreReaderBlock, error)
+
+	// GetEntry returns the value stored under the key, or nil if there's none.
+	GetEntry(key []byte) ([]byte, error)
+	// IteratePrefix calls fn with each key under the prefix, and its value, in key order, starting at startKey if
+	// it's set. It stops once fn returns false or an error.
+	IteratePrefix(prefix []byte, startKey []byte, fn func(key []byte, value []byte) (bool, error)) error
+
+	// GetDBSchema returns the schema of every prefix, sorted by prefix.
+	GetDBSchema() []*DBPrefixSchema
+	// DecodeEntry decodes a key and its value with the schema of the key's prefix.
+	DecodeEntry(key []byte, value []byte) (*CoreReaderDecodedEntry, error)
+}
+
+// blockchainCoreReader is the CoreReader of a node, which reads from its Blockchain and DB.
+type blockchainCoreReader struct {
+	blockchain *Blockchain
+}
+
+// NewCoreReader returns a CoreReader that reads from the Blockchain and its DB.
+func NewCoreReader(blockchain *Blockchain) CoreReader {
+	return &blockchainCoreReader{blockchain: blockchain}
+}
+
+func (reader *blockchainCoreReader) GetAPIVersion() CoreReaderAPIVersion {
+	return CurrentCoreReaderAPIVersion
+}
+
+func (reader *blockchainCoreReader) GetTip() (*CoreReaderBlock, error) {
+	reader.blockchain.ChainLock.RLock()
+	defer reader.blockchain.ChainLock.RUnlock()
+
+	tipNode := reader.blockchain.blockTip()
+	if tipNode == nil {
+		return nil, fmt.Errorf("CoreReader.GetTip: Blockchain has no tip")
+	}
+	return &CoreReaderBlock{
+		Hash:          tipNode.Hash.NewBlockHash(),
+		Height:        uint64(tipNode.Height),
+		IsOnBestChain: true,
+	}, nil
+}
+
+func (reader *blockchainCoreReader) GetBlockByHeight(height uint64) (*CoreReaderBlock, error) {
+	reader.blockchain.ChainLock.RLock()
+	bestChain := reader.blockchain.bestChain
+	var blockHash *BlockHash
+	if height < uint64(len(bestChain)) {
+		blockHash = bestChain[height].Hash.NewBlockHash()
+	}
+	reader.blockchain.ChainLock.RUnlock()
+
+	if blockHash == nil {
+		return nil, nil
+	}
+	block, err := reader.GetBlockByHash(blockHash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CoreReader.GetBlockByHeight: ")
+	}
+	return block, nil
+}
+
+func (reader *blockchainCoreReader) GetBlockByHash(blockHash *BlockHash) (*CoreReaderBlock, error) {
+	if blockHash == nil {
+		return nil, fmt.Errorf("CoreReader.GetBlockByHash: Block hash is nil")
+	}
+	// The genesis block is stored under the hash of its header, which isn't the genesis block hash in the params,
+	// so we return it from the params.
+	params := reader.blockchain.params
+	var block *MsgDeSoBlock
+	var err error
+	if blockHash.String() == params.GenesisBlockHashHex {
+		block = params.GenesisBlock
+	} else {
+		block, err = GetBlock(blockHash, reader.blockchain.db, reader.blockchain.snapshot)
+	}
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "CoreReader.GetBlockByHash: Problem reading block %v: ", blockHash)
+	}
+	blockBytes, err := block.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CoreReader.GetBlockByHash: Problem encoding block %v: ", blockHash)
+	}
+	return &CoreReaderBlock{
+		Hash:          blockHash.NewBlockHash(),
+		Height:        block.Header.Height,
+		IsOnBestChain: reader.blockchain.GetBlockNodeWithHash(blockHash) != nil,
+		BlockBytes:    blockBytes,
+	}, nil
+}
+
+func (reader *blockchainCoreReader) GetEntry(key []byte) ([]byte, error) {
+	var value []byte
+	err := reader.blockchain.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "CoreReader.GetEntry: Problem reading key %x: ", key)
+	}
+	return value, nil
+}
+
+func (reader *blockchainCoreReader) IteratePrefix(
+	prefix []byte,
+	startKey []byte,
+	fn func(key []byte, value []byte) (bool, error),
+) error {
+	if len(startKey) > 0 && !bytes.HasPrefix(startKey, prefix) {
+		return fmt.Errorf("CoreReader.IteratePrefix: Start key %x isn't under prefix %x", startKey, prefix)
+	}
+	seekKey := prefix
+	if len(startKey) > 0 {
+		seekKey = startKey
+	}
+	return reader.blockchain.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(seekKey); iterator.ValidForPrefix(prefix); iterator.Next() {
+			key := iterator.Item().KeyCopy(nil)
+			value, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return errors.Wrapf(err, "CoreReader.IteratePrefix: Problem reading value of key %x: ", key)
+			}
+			shouldContinue, err := fn(key, value)
+			if err != nil {
+				return err
+			}
+			if !shouldContinue {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func (reader *blockchainCoreReader) GetDBSchema() []*DBPrefixSchema {
+	return GetDBSchema()
+}
+
+func (reader *blockchainCoreReader) DecodeEntry(key []byte, value []byte) (*CoreReaderDecodedEntry, error) {
+	schema := GetDBPrefixSchema(key)
+	if schema == nil {
+		return nil, fmt.Errorf("CoreReader.DecodeEntry: Key %x isn't under a known prefix", key)
+	}
+	keyFields, err := schema.DecodeKey(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CoreReader.DecodeEntry: ")
+	}
+	valueEncoder, valueFields, err := schema.DecodeValue(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CoreReader.DecodeEntry: ")
+	}
+	return &CoreReaderDecodedEntry{
+		PrefixName:   schema.Name,
+		KeyFields:    keyFields,
+		ValueEncoder: valueEncoder,
+		ValueFields:  valueFields,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoreReader(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	for ii := 0; ii < 3; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+	reader := NewCoreReader(chain)
+
+	// A plugin built against an older minor version can use the reader, one built against another major version
+	// or a newer minor version can't.
+	version := reader.GetAPIVersion()
+	require.Equal(CurrentCoreReaderAPIVersion, version)
+	require.True(version.IsCompatibleWith(CoreReaderAPIVersion{Major: version.Major, Minor: 0}))
+	require.False(version.IsCompatibleWith(CoreReaderAPIVersion{Major: version.Major, Minor: version.Minor + 1}))
+	require.False(version.IsCompatibleWith(CoreReaderAPIVersion{Major: version.Major + 1, Minor: 0}))
+
+	// Blocks are returned by height and by hash, in their network encoding.
+	tip, err := reader.GetTip()
+	require.NoError(err)
+	require.Equal(uint64(3), tip.Height)
+	require.True(tip.Hash.IsEqual(chain.BlockTip().Hash))
+	for height := uint64(0); height <= tip.Height; height++ {
+		block, err := reader.GetBlockByHeight(height)
+		require.NoError(err)
+		require.Equal(height, block.Height)
+		require.True(block.IsOnBestChain)
+		decodedBlock := &MsgDeSoBlock{}
+		require.NoError(decodedBlock.FromBytes(block.BlockBytes))
+		require.Equal(height, decodedBlock.Header.Height)
+		if height > 0 {
+			// The genesis block hash in the params isn't the hash of its header.
+			decodedBlockHash, err := decodedBlock.Hash()
+			require.NoError(err)
+			require.True(block.Hash.IsEqual(decodedBlockHash))
+		}
+
+		blockByHash, err := reader.GetBlockByHash(block.Hash)
+		require.NoError(err)
+		require.Equal(block, blockByHash)
+	}
+	block, err := reader.GetBlockByHeight(tip.Height + 1)
+	require.NoError(err)
+	require.Nil(block)
+	block, err = reader.GetBlockByHash(&BlockHash{})
+	require.NoError(err)
+	require.Nil(block)
+
+	// Entries are read by key and decoded with the DB schema.
+	senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+	require.NoError(err)
+	balanceNanos, err := DbGetDeSoBalanceNanosForPublicKey(db, chain.snapshot, senderPkBytes)
+	require.NoError(err)
+	require.NotZero(balanceNanos)
+	balanceKey := _dbKeyForPublicKeyToDeSoBalanceNanos(senderPkBytes)
+	balanceValue, err := reader.GetEntry(balanceKey)
+	require.NoError(err)
+	decodedEntry, err := reader.DecodeEntry(balanceKey, balanceValue)
+	require.NoError(err)
+	require.Equal("PrefixPublicKeyToDeSoBalanceNanos", decodedEntry.PrefixName)
+	require.Equal(senderPkBytes, decodedEntry.KeyFields[0].Bytes)
+	require.Nil(decodedEntry.ValueEncoder)
+	require.Equal(balanceNanos, binary.BigEndian.Uint64(decodedEntry.ValueFields[0].Bytes))
+	missingValue, err := reader.GetEntry(append(balanceKey, 0))
+	require.NoError(err)
+	require.Nil(missingValue)
+	_, err = reader.DecodeEntry([]byte{255}, nil)
+	require.Error(err)
+
+	// Iterating the prefix finds the entry, and it can start at the entry's key.
+	prefix := Prefixes.PrefixPublicKeyToDeSoBalanceNanos
+	var numEntries int
+	var foundBalance bool
+	require.NoError(reader.IteratePrefix(prefix, nil, func(key []byte, value []byte) (bool, error) {
+		numEntries++
+		if string(key) == string(balanceKey) {
+			foundBalance = true
+			require.Equal(balanceValue, value)
+		}
+		return true, nil
+	}))
+	require.True(foundBalance)
+	var firstKey []byte
+	require.NoError(reader.IteratePrefix(prefix, balanceKey, func(key []byte, value []byte) (bool, error) {
+		firstKey = key
+		return false, nil
+	}))
+	require.Equal(balanceKey, firstKey)
+	require.Error(reader.IteratePrefix(prefix, []byte{255}, func(key []byte, value []byte) (bool, error) {
+		return true, nil
+	}))
+
+	require.Equal(len(GetDBSchema()), len(reader.GetDBSchema()))
+}
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/deso-protocol/uint256"
+)
+
+// daoCoinLimitOrderBookKey identifies the side of the order book that a resting order sits on.
+// An order is stored in the book keyed by its own (buying, selling) coin pair, and an incoming
+// order is matched against the book with the reverse pair.
+type daoCoinLimitOrderBookKey struct {
+	BuyingDAOCoinCreatorPKID  PKID
+	SellingDAOCoinCreatorPKID PKID
+}
+
+// daoCoinLimitOrderBook indexes the DAOCoinLimitOrderEntries in a UtxoView for one side of a
+// DAO coin pair. It mirrors DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry and is kept in sync
+// with it by _setDAOCoinLimitOrderEntryMappings, so it never needs to be flushed.
+//
+// Live orders are grouped into price levels, which are kept in a max-heap by exchange rate.
+// This allows GetNextLimitOrdersToFill to visit the best orders first and stop as soon as the
+// transactor's quantity is filled, instead of scanning and sorting every order in the view.
+type daoCoinLimitOrderBook struct {
+	// The keys of all orders in the view for this side of the book, including deleted orders.
+	// These are skipped when fetching matching orders from the db.
+	orderKeysInView map[DAOCoinLimitOrderMapKey]bool
+
+	// Live (non-deleted) orders.
+	ordersByKey        map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry
+	ordersByTransactor map[PKID]map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry
+	priceLevels        map[uint256.Int]*daoCoinLimitOrderPriceLevel
+	priceLevelHeap     daoCoinLimitOrderPriceLevelHeap
+}
+
+// daoCoinLimitOrderPriceLevel holds all live orders in a book with the same exchange rate,
+// sorted from best to worst matching order, i.e. FIFO by block height.
+type daoCoinLimitOrderPriceLevel struct {
+	scaledExchangeRate uint256.Int
+	orders             []*DAOCoinLimitOrderEntry
+	heapIndex          int
+}
+
+// daoCoinLimitOrderPriceLevelHeap is a max-heap of price levels by exchange rate. It
+// implements heap.Interface.
+type daoCoinLimitOrderPriceLevelHeap []*daoCoinLimitOrderPriceLevel
+
+func (h daoCoinLimitOrderPriceLevelHeap) Len() int { return len(h) }
+
+func (h daoCoinLimitOrderPriceLevelHeap) Less(ii, jj int) bool {
+	return h[ii].scaledExchangeRate.Gt(&h[jj].scaledExchangeRate)
+}
+
+func (h daoCoinLimitOrderPriceLevelHeap) Swap(ii, jj int) {
+	h[ii], h[jj] = h[jj], h[ii]
+	h[ii].heapIndex = ii
+	h[jj].heapIndex = jj
+}
+
+func (h *daoCoinLimitOrderPriceLevelHeap) Push(x interface{}) {
+	level := x.(*daoCoinLimitOrderPriceLevel)
+	level.heapIndex = len(*h)
+	*h = append(*h, level)
+}
+
+func (h *daoCoinLimitOrderPriceLevelHeap) Pop() interface{} {
+	old := *h
+	level := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	level.heapIndex = -1
+	return level
+}
+
+func newDAOCoinLimitOrderBook() *daoCoinLimitOrderBook {
+	return &daoCoinLimitOrderBook{
+		orderKeysInView:    make(map[DAOCoinLimitOrderMapKey]bool),
+		ordersByKey:        make(map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry),
+		ordersByTransactor: make(map[PKID]map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry),
+		priceLevels:        make(map[uint256.Int]*daoCoinLimitOrderPriceLevel),
+	}
+}
+
+func (book *daoCoinLimitOrderBook) addOrder(order *DAOCoinLimitOrderEntry) {
+	orderKey := order.ToMapKey()
+	book.orderKeysInView[orderKey] = true
+	if order.isDeleted {
+		return
+	}
+
+	book.ordersByKey[orderKey] = order
+	transactorOrders, exists := book.ordersByTransactor[*order.TransactorPKID]
+	if !exists {
+		transactorOrders = make(map[DAOCoinLimitOrderMapKey]*DAOCoinLimitOrderEntry)
+		book.ordersByTransactor[*order.TransactorPKID] = transactorOrders
+	}
+	transactorOrders[orderKey] = order
+
+	level, exists := book.priceLevels[*order.ScaledExchangeRateCoinsToSellPerCoinToBuy]
+	if !exists {
+		level = &daoCoinLimitOrderPriceLevel{scaledExchangeRate: *order.ScaledExchangeRateCoinsToSellPerCoinToBuy}
+		book.priceLevels[level.scaledExchangeRate] = level
+		heap.Push(&book.priceLevelHeap, level)
+	}
+	insertIndex := sort.Search(len(level.orders), func(ii int) bool {
+		return !level.orders[ii].IsBetterMatchingOrderThan(order)
+	})
+	level.orders = append(level.orders, nil)
+	copy(level.orders[insertIndex+1:], level.orders[insertIndex:])
+	level.orders[insertIndex] = order
+}
+
+func (book *daoCoinLimitOrderBook) removeOrder(orderKey DAOCoinLimitOrderMapKey) {
+	delete(book.orderKeysInView, orderKey)
+	order, exists := book.ordersByKey[orderKey]
+	if !exists {
+		return
+	}
+
+	delete(book.ordersByKey, orderKey)
+	transactorOrders := book.ordersByTransactor[*order.TransactorPKID]
+	delete(transactorOrders, orderKey)
+	if len(transactorOrders) == 0 {
+		delete(book.ordersByTransactor, *order.TransactorPKID)
+	}
+
+	level := book.priceLevels[*order.ScaledExchangeRateCoinsToSellPerCoinToBuy]
+	// The price, block height, and order ID of an order never change, so the order is at the
+	// position it was inserted at.
+	removeIndex := sort.Search(len(level.orders), func(ii int) bool {
+		return !level.orders[ii].IsBetterMatchingOrderThan(order)
+	})
+	level.orders = append(level.orders[:removeIndex], level.orders[removeIndex+1:]...)
+	if len(level.orders) == 0 {
+		delete(book.priceLevels, level.scaledExchangeRate)
+		heap.Remove(&book.priceLevelHeap, level.heapIndex)
+	}
+}
+
+// forEachOrderFromBestToWorst calls fn on the live orders in the book that are worse matching
+// orders than lastSeenOrder, or on all live orders if lastSeenOrder is nil, from best to worst,
+// until fn returns false. The price levels are visited in order without popping them off the
+// heap, so the cost is proportional to the number of orders visited rather than the size of
+// the book. fn must not modify the book.
+func (book *daoCoinLimitOrderBook) forEachOrderFromBestToWorst(
+	lastSeenOrder *DAOCoinLimitOrderEntry, fn func(order *DAOCoinLimitOrderEntry) bool) {
+
+	if len(book.priceLevelHeap) == 0 {
+		return
+	}
+	// The next best price level is always the best of the children of the levels visited so
+	// far, so we track candidate heap indices in a second heap.
+	candidates := &daoCoinLimitOrderPriceLevelIndexHeap{levels: book.priceLevelHeap, indices: []int{0}}
+	for candidates.Len() > 0 {
+		levelIndex := heap.Pop(candidates).(int)
+		for _, childIndex := range []int{2*levelIndex + 1, 2*levelIndex + 2} {
+			if childIndex < len(book.priceLevelHeap) {
+				heap.Push(candidates, childIndex)
+			}
+		}
+
+		level := book.priceLevelHeap[levelIndex]
+		startIndex := 0
+		if lastSeenOrder != nil {
+			startIndex = sort.Search(len(level.orders), func(ii int) bool {
+				return lastSeenOrder.IsBetterMatchingOrderThan(level.orders[ii])
+			})
+		}
+		for _, order := range level.orders[startIndex:] {
+			if !fn(order) {
+				return
+			}
+		}
+	}
+}
+
+// daoCoinLimitOrderPriceLevelIndexHeap is a max-heap of indices into a
+// daoCoinLimitOrderPriceLevelHeap, ordered by the exchange rate of the level at each index.
+type daoCoinLimitOrderPriceLevelIndexHeap struct {
+	levels  daoCoinLimitOrderPriceLevelHeap
+	indices []int
+}
+
+func (h *daoCoinLimitOrderPriceLevelIndexHeap) Len() int { return len(h.indices) }
+
+func (h *daoCoinLimitOrderPriceLevelIndexHeap) Less(ii, jj int) bool {
+	return h.levels.Less(h.indices[ii], h.indices[jj])
+}
+
+func (h *daoCoinLimitOrderPriceLevelIndexHeap) Swap(ii, jj int) {
+	h.indices[ii], h.indices[jj] = h.indices[jj], h.indices[ii]
+}
+
+func (h *daoCoinLimitOrderPriceLevelIndexHeap) Push(x interface{}) {
+	h.indices = append(h.indices, x.(int))
+}
+
+func (h *daoCoinLimitOrderPriceLevelIndexHeap) Pop() interface{} {
+	index := h.indices[len(h.indices)-1]
+	h.indices = h.indices[:len(h.indices)-1]
+	return index
+}
+
+// _getDAOCoinLimitOrderBook returns the book that orders buying buyingDAOCoinCreatorPKID and
+// selling sellingDAOCoinCreatorPKID rest in, or nil if the view has no such orders.
+func (bav *UtxoView) _getDAOCoinLimitOrderBook(
+	buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID) *daoCoinLimitOrderBook {
+
+	return bav.daoCoinLimitOrderBooks[daoCoinLimitOrderBookKey{
+		BuyingDAOCoinCreatorPKID:  *buyingDAOCoinCreatorPKID,
+		SellingDAOCoinCreatorPKID: *sellingDAOCoinCreatorPKID,
+	}]
+}
+
+// _indexDAOCoinLimitOrderEntry updates the order books to reflect entry replacing whatever
+// entry the view currently has under the same key. It must be called before the entry is set
+// in DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry.
+func (bav *UtxoView) _indexDAOCoinLimitOrderEntry(entry *DAOCoinLimitOrderEntry) {
+	orderKey := entry.ToMapKey()
+	if existingEntry, exists := bav.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry[orderKey]; exists {
+		if book := bav._getDAOCoinLimitOrderBook(
+			existingEntry.BuyingDAOCoinCreatorPKID, existingEntry.SellingDAOCoinCreatorPKID); book != nil {
+			book.removeOrder(orderKey)
+		}
+	}
+
+	bookKey := daoCoinLimitOrderBookKey{
+		BuyingDAOCoinCreatorPKID:  *entry.BuyingDAOCoinCreatorPKID,
+		SellingDAOCoinCreatorPKID: *entry.SellingDAOCoinCreatorPKID,
+	}
+	book, exists := bav.daoCoinLimitOrderBooks[bookKey]
+	if !exists {
+		book = newDAOCoinLimitOrderBook()
+		bav.daoCoinLimitOrderBooks[bookKey] = book
+	}
+	book.addOrder(entry)
+}
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAOCoinLimitOrderBook(t *testing.T) {
+	require := require.New(t)
+	rng := rand.New(rand.NewSource(0))
+
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	newOrder := func() *DAOCoinLimitOrderEntry {
+		orderID := &BlockHash{}
+		rng.Read(orderID[:])
+		return &DAOCoinLimitOrderEntry{
+			OrderID:                   orderID,
+			TransactorPKID:            m0PKID,
+			BuyingDAOCoinCreatorPKID:  &ZeroPKID,
+			SellingDAOCoinCreatorPKID: m1PKID,
+			// Few distinct prices and block heights so that levels hold several orders.
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256.NewInt(uint64(rng.Intn(10) + 1)),
+			QuantityToFillInBaseUnits:                 uint256.NewInt(100),
+			OperationType:                             DAOCoinLimitOrderOperationTypeASK,
+			BlockHeight:                               uint32(rng.Intn(5)),
+		}
+	}
+	sortedOrders := func(book *daoCoinLimitOrderBook, lastSeenOrder *DAOCoinLimitOrderEntry) []*DAOCoinLimitOrderEntry {
+		orders := []*DAOCoinLimitOrderEntry{}
+		book.forEachOrderFromBestToWorst(lastSeenOrder, func(order *DAOCoinLimitOrderEntry) bool {
+			orders = append(orders, order)
+			return true
+		})
+		return orders
+	}
+
+	book := newDAOCoinLimitOrderBook()
+	liveOrders := []*DAOCoinLimitOrderEntry{}
+	for ii := 0; ii < 200; ii++ {
+		order := newOrder()
+		book.addOrder(order)
+		liveOrders = append(liveOrders, order)
+	}
+	// Delete some orders, and add some tombstones for orders that were never live.
+	for ii := 0; ii < 50; ii++ {
+		book.removeOrder(liveOrders[ii].ToMapKey())
+		deletedOrder := *liveOrders[ii]
+		deletedOrder.isDeleted = true
+		book.addOrder(&deletedOrder)
+	}
+	liveOrders = liveOrders[50:]
+	for ii := 0; ii < 10; ii++ {
+		deletedOrder := newOrder()
+		deletedOrder.isDeleted = true
+		book.addOrder(deletedOrder)
+	}
+	require.Len(book.orderKeysInView, 210)
+	require.Len(book.ordersByKey, 150)
+	require.Len(book.ordersByTransactor[*m0PKID], 150)
+
+	// The book visits the live orders in the same order as sorting them.
+	sort.Slice(liveOrders, func(ii, jj int) bool {
+		return liveOrders[ii].IsBetterMatchingOrderThan(liveOrders[jj])
+	})
+	require.Equal(liveOrders, sortedOrders(book, nil))
+
+	// Only orders worse than the last seen order are visited.
+	for _, lastSeenIndex := range []int{0, 17, 80, 149} {
+		require.Equal(liveOrders[lastSeenIndex+1:], sortedOrders(book, liveOrders[lastSeenIndex]))
+	}
+
+	// Stopping early doesn't visit any more orders.
+	visited := 0
+	book.forEachOrderFromBestToWorst(nil, func(order *DAOCoinLimitOrderEntry) bool {
+		visited++
+		return visited < 3
+	})
+	require.Equal(3, visited)
+
+	// Removing every order empties the price level heap.
+	for _, order := range liveOrders {
+		book.removeOrder(order.ToMapKey())
+	}
+	require.Empty(book.priceLevels)
+	require.Empty(book.priceLevelHeap)
+	require.Empty(book.ordersByTransactor)
+	require.Empty(sortedOrders(book, nil))
+}
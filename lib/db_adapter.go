@@ -35,6 +35,15 @@ func (bav *UtxoView) GetDbAdapter() *DbAdapter {
 	}
 }
 
+// GetQueryPushdownBackend returns the data source if it can evaluate sorted, paginated read queries itself,
+// and nil otherwise. Only Postgres can, so with Badger the caller has to load and sort the entries.
+func (adapter *DbAdapter) GetQueryPushdownBackend() QueryPushdownBackend {
+	if adapter.postgresDb != nil {
+		return adapter.postgresDb
+	}
+	return nil
+}
+
 //
 // Associations
 //
@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Data Encryption at Rest
+//
+// A node can encrypt its badger databases at rest, using badger's built-in AES encryption. This covers the chain DB,
+// the txindex, the mempool dumps, and the slashing protection DB, which between them hold the ciphertexts of users'
+// messages and the operator's keys. The operator supplies a master key, either in a file or through a
+// DataEncryptionKeyProvider that fetches it from a KMS, and the node installs it with SetDataEncryptionKey before
+// opening any DB. From then on, every DB opened with DefaultBadgerOptions or PerformanceBadgerOptions is encrypted.
+// Badger encrypts the data itself with data keys that it rotates on its own, and only uses the master key to encrypt
+// the data keys it stores in the DB's key registry.
+//
+// Encryption can only be turned on for a new data directory. Badger refuses to open a DB with a different master key
+// than the one it was created with, and that includes opening a DB created without encryption with a key, or the
+// other way around. The block bodies in the block segment store are public chain data, and aren't encrypted.
+
+const (
+	// DataEncryptionIndexCacheSize is the size of the cache of decrypted table indexes used by encrypted DBs. Badger
+	// decrypts a table's index every time it reads from the table if it isn't cached.
+	DataEncryptionIndexCacheSize = 256 << 20
+)
+
+// DataEncryptionKeyProvider fetches the master key used to encrypt the node's DBs. Embedders can implement it to
+// fetch the key from their KMS.
+type DataEncryptionKeyProvider interface {
+	GetDataEncryptionKey() ([]byte, error)
+}
+
+// dataEncryptionKeyFileProvider reads a hex-encoded key from a file.
+type dataEncryptionKeyFileProvider struct {
+	path string
+}
+
+// NewDataEncryptionKeyFileProvider returns a provider that reads the hex-encoded key stored in the file at path.
+func NewDataEncryptionKeyFileProvider(path string) DataEncryptionKeyProvider {
+	return &dataEncryptionKeyFileProvider{path: path}
+}
+
+func (provider *dataEncryptionKeyFileProvider) GetDataEncryptionKey() ([]byte, error) {
+	keyBytes, err := os.ReadFile(provider.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDataEncryptionKey: Problem reading key file %v", provider.path)
+	}
+	key, err := ParseDataEncryptionKeyHex(string(keyBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDataEncryptionKey: Invalid key in file %v", provider.path)
+	}
+	return key, nil
+}
+
+// dataEncryptionKeyCommandProvider runs a command that prints a hex-encoded key.
+type dataEncryptionKeyCommandProvider struct {
+	command string
+}
+
+// NewDataEncryptionKeyCommandProvider returns a provider that runs command with the shell and reads the hex-encoded
+// key it prints to stdout. This lets operators fetch the key from a KMS with its CLI, e.g. by decrypting a wrapped
+// key, without storing the key on disk.
+func NewDataEncryptionKeyCommandProvider(command string) DataEncryptionKeyProvider {
+	return &dataEncryptionKeyCommandProvider{command: command}
+}
+
+func (provider *dataEncryptionKeyCommandProvider) GetDataEncryptionKey() ([]byte, error) {
+	cmd := exec.Command("sh", "-c", provider.command)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDataEncryptionKey: Problem running key command")
+	}
+	key, err := ParseDataEncryptionKeyHex(string(output))
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDataEncryptionKey: Invalid key printed by key command")
+	}
+	return key, nil
+}
+
+// ParseDataEncryptionKeyHex parses a hex-encoded AES-128, AES-192, or AES-256 key, ignoring surrounding whitespace.
+func ParseDataEncryptionKeyHex(keyHex string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(keyHex))
+	if err != nil {
+		return nil, errors.Wrapf(err, "ParseDataEncryptionKeyHex: Problem decoding key")
+	}
+	if err = validateDataEncryptionKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func validateDataEncryptionKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return errors.Errorf("validateDataEncryptionKey: Key has length %d but should be 16, 24, or 32 bytes",
+			len(key))
+	}
+}
+
+// dataEncryptionKey is the master key used to encrypt the DBs opened by the node, or nil if they aren't encrypted.
+// The DBs are opened from many places with just a directory, so the key is kept here rather than threaded through
+// every caller.
+var (
+	dataEncryptionKeyLock sync.RWMutex
+	dataEncryptionKey     []byte
+)
+
+// SetDataEncryptionKey makes the DBs opened from now on be encrypted with key. Passing nil turns encryption off.
+func SetDataEncryptionKey(key []byte) error {
+	if key != nil {
+		if err := validateDataEncryptionKey(key); err != nil {
+			return errors.Wrapf(err, "SetDataEncryptionKey: Invalid key")
+		}
+	}
+	dataEncryptionKeyLock.Lock()
+	defer dataEncryptionKeyLock.Unlock()
+	dataEncryptionKey = append([]byte(nil), key...)
+	return nil
+}
+
+// LoadDataEncryptionKey fetches the key from provider and makes the DBs opened from now on be encrypted with it.
+func LoadDataEncryptionKey(provider DataEncryptionKeyProvider) error {
+	key, err := provider.GetDataEncryptionKey()
+	if err != nil {
+		return errors.Wrapf(err, "LoadDataEncryptionKey: ")
+	}
+	return SetDataEncryptionKey(key)
+}
+
+// IsDataEncryptionEnabled returns true if the DBs opened by the node are encrypted.
+func IsDataEncryptionEnabled() bool {
+	dataEncryptionKeyLock.RLock()
+	defer dataEncryptionKeyLock.RUnlock()
+	return dataEncryptionKey != nil
+}
+
+// withDataEncryption sets the encryption options on opts if a key has been set.
+func withDataEncryption(opts badger.Options) badger.Options {
+	dataEncryptionKeyLock.RLock()
+	defer dataEncryptionKeyLock.RUnlock()
+	if dataEncryptionKey == nil {
+		return opts
+	}
+	return opts.WithEncryptionKey(dataEncryptionKey).WithIndexCacheSize(DataEncryptionIndexCacheSize)
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataEncryption(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := os.MkdirTemp("", "badgerdb-data-encryption")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	keyHex := hex.EncodeToString(RandomBytes(32))
+	keyFile := filepath.Join(dir, "data_encryption_key")
+	require.NoError(os.WriteFile(keyFile, []byte(keyHex+"\n"), 0600))
+
+	// Keys must be hex-encoded AES keys.
+	_, err = ParseDataEncryptionKeyHex("not hex")
+	require.Error(err)
+	_, err = ParseDataEncryptionKeyHex(hex.EncodeToString(RandomBytes(20)))
+	require.Error(err)
+	require.Error(SetDataEncryptionKey(RandomBytes(20)))
+	commandKey, err := NewDataEncryptionKeyCommandProvider("echo " + keyHex).GetDataEncryptionKey()
+	require.NoError(err)
+	_, err = NewDataEncryptionKeyCommandProvider("exit 1").GetDataEncryptionKey()
+	require.Error(err)
+
+	require.NoError(LoadDataEncryptionKey(NewDataEncryptionKeyFileProvider(keyFile)))
+	defer SetDataEncryptionKey(nil)
+	require.True(IsDataEncryptionEnabled())
+
+	dbDir := filepath.Join(dir, "badgerdb")
+	openDB := func() (*badger.DB, error) {
+		opts := PerformanceBadgerOptions(dbDir)
+		opts.ValueDir = dbDir
+		opts.ValueThreshold = 0
+		return badger.Open(opts)
+	}
+	plaintext := []byte("a message ciphertext the operator doesn't want on disk in the clear")
+	db, err := openDB()
+	require.NoError(err)
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), plaintext)
+	}))
+	require.NoError(db.Close())
+
+	// Nothing in the data directory holds the plaintext.
+	entries, err := os.ReadDir(dbDir)
+	require.NoError(err)
+	for _, entry := range entries {
+		fileBytes, err := os.ReadFile(filepath.Join(dbDir, entry.Name()))
+		require.NoError(err)
+		require.False(bytes.Contains(fileBytes, plaintext), "plaintext found in %v", entry.Name())
+	}
+
+	// The DB can't be opened without the key.
+	require.NoError(SetDataEncryptionKey(nil))
+	require.False(IsDataEncryptionEnabled())
+	_, err = openDB()
+	require.Error(err)
+
+	// With the key, the DB reads back the value.
+	require.NoError(SetDataEncryptionKey(commandKey))
+	db, err = openDB()
+	require.NoError(err)
+	defer db.Close()
+	require.NoError(db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		require.Equal(plaintext, value)
+		return err
+	}))
+}
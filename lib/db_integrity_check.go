@@ -0,0 +1,492 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// DB Integrity Check
+//
+// A DB that was damaged by a crash, a full disk, or a node binary from another network or version usually isn't
+// noticed when the node opens it. The node fails later instead, often deep into a sync, with a decode error that
+// doesn't say what's wrong or how to fix it. CheckDBIntegrity is a fast pass over the DB that the node runs on
+// startup to catch these problems early:
+//   - Prefixes: every key is under a prefix in DBPrefixes, and the first few entries of every prefix decode with
+//     the prefix's schema, see db_schema.go.
+//   - Best chain: the best block hash is in the block index, the block index has the network's genesis block, and
+//     the best chain is continuous for the last DBIntegrityCheckBestChainDepth blocks.
+//   - Snapshot metadata: the hypersync snapshot metadata decodes and isn't ahead of the best chain, and the
+//     snapshot operations finished before the last shutdown.
+//   - Encoder migrations: the encoder migrations stored in the DB are the ones in the node's
+//     EncoderMigrationHeightsList, at the same heights.
+//
+// Every problem is returned as a DBIntegrityIssue with a suggested remediation rather than as an error, so that a
+// single report covers everything the operator has to fix. The check only reads a bounded number of entries, so
+// it takes about as long on a mainnet DB as on a new one.
+
+const (
+	// DBIntegrityCheckSampleEntriesPerPrefix is the number of entries of each prefix that are decoded.
+	DBIntegrityCheckSampleEntriesPerPrefix = 8
+	// DBIntegrityCheckBestChainDepth is the number of blocks of the best chain that are checked for continuity,
+	// starting from the tip.
+	DBIntegrityCheckBestChainDepth = 1000
+	// dbIntegrityCheckMaxTipSearchNodes is the number of block nodes, from the highest down, that are searched for
+	// the best block hash. The blocks above the best block are orphans and uncommitted PoS blocks, of which there
+	// are only a few.
+	dbIntegrityCheckMaxTipSearchNodes = 10000
+)
+
+// DBIntegrityCheckType is one of the checks that CheckDBIntegrity runs.
+type DBIntegrityCheckType uint8
+
+const (
+	DBIntegrityCheckPrefixes          DBIntegrityCheckType = 0
+	DBIntegrityCheckBestChain         DBIntegrityCheckType = 1
+	DBIntegrityCheckSnapshotMetadata  DBIntegrityCheckType = 2
+	DBIntegrityCheckEncoderMigrations DBIntegrityCheckType = 3
+)
+
+func (checkType DBIntegrityCheckType) String() string {
+	switch checkType {
+	case DBIntegrityCheckPrefixes:
+		return "PREFIXES"
+	case DBIntegrityCheckBestChain:
+		return "BEST_CHAIN"
+	case DBIntegrityCheckSnapshotMetadata:
+		return "SNAPSHOT_METADATA"
+	case DBIntegrityCheckEncoderMigrations:
+		return "ENCODER_MIGRATIONS"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// DBIntegrityIssueSeverity is how serious a DBIntegrityIssue is.
+type DBIntegrityIssueSeverity uint8
+
+const (
+	// DBIntegrityIssueWarning means the node can run, but something looks off or will be recovered from.
+	DBIntegrityIssueWarning DBIntegrityIssueSeverity = 0
+	// DBIntegrityIssueError means the node is expected to fail, or to compute a wrong state, with the DB.
+	DBIntegrityIssueError DBIntegrityIssueSeverity = 1
+)
+
+func (severity DBIntegrityIssueSeverity) String() string {
+	switch severity {
+	case DBIntegrityIssueWarning:
+		return "WARNING"
+	case DBIntegrityIssueError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// DBIntegrityIssue is a problem found by CheckDBIntegrity.
+type DBIntegrityIssue struct {
+	Check    DBIntegrityCheckType
+	Severity DBIntegrityIssueSeverity
+	// Prefix is the name of the prefix the issue is about in DBPrefixes, if any.
+	Prefix      string
+	Description string
+	// Remediation is what the operator can do to fix the issue.
+	Remediation string
+}
+
+func (issue *DBIntegrityIssue) String() string {
+	prefix := ""
+	if issue.Prefix != "" {
+		prefix = fmt.Sprintf(" [%v]", issue.Prefix)
+	}
+	return fmt.Sprintf("%v %v%v: %v Remediation: %v", issue.Severity, issue.Check, prefix, issue.Description,
+		issue.Remediation)
+}
+
+// DBIntegrityReport is the result of CheckDBIntegrity.
+type DBIntegrityReport struct {
+	// IsEmpty is true if the DB doesn't have a best chain yet, in which case only the prefixes are checked.
+	IsEmpty bool
+	// BestBlockHash and BestBlockHeight are the tip of the best chain, if the DB has one.
+	BestBlockHash   *BlockHash
+	BestBlockHeight uint64
+	// NumPrefixesChecked and NumEntriesChecked count the prefixes that had entries and the entries decoded.
+	NumPrefixesChecked uint64
+	NumEntriesChecked  uint64
+	// NumBlocksChecked is the number of blocks of the best chain that were checked for continuity.
+	NumBlocksChecked uint64
+	Issues           []*DBIntegrityIssue
+	Duration         time.Duration
+}
+
+// HasErrors returns true if the report has an issue with DBIntegrityIssueError severity.
+func (report *DBIntegrityReport) HasErrors() bool {
+	for _, issue := range report.Issues {
+		if issue.Severity == DBIntegrityIssueError {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the report for logging, with one issue per line.
+func (report *DBIntegrityReport) String() string {
+	var sb strings.Builder
+	if report.IsEmpty {
+		sb.WriteString("DB integrity check: DB has no best chain yet")
+	} else {
+		sb.WriteString(fmt.Sprintf("DB integrity check: best block %v at height %d", report.BestBlockHash,
+			report.BestBlockHeight))
+	}
+	sb.WriteString(fmt.Sprintf(", checked %d entries in %d prefixes and %d blocks in %v, found %d issues",
+		report.NumEntriesChecked, report.NumPrefixesChecked, report.NumBlocksChecked, report.Duration,
+		len(report.Issues)))
+	for _, issue := range report.Issues {
+		sb.WriteString("\n\t")
+		sb.WriteString(issue.String())
+	}
+	return sb.String()
+}
+
+func (report *DBIntegrityReport) addIssue(check DBIntegrityCheckType, severity DBIntegrityIssueSeverity,
+	prefix string, remediation string, descriptionFormat string, args ...interface{}) {
+
+	report.Issues = append(report.Issues, &DBIntegrityIssue{
+		Check:       check,
+		Severity:    severity,
+		Prefix:      prefix,
+		Description: fmt.Sprintf(descriptionFormat, args...),
+		Remediation: remediation,
+	})
+}
+
+const (
+	dbIntegrityRemediationResync       = "Stop the node, move the data directory aside, and resync into a new one."
+	dbIntegrityRemediationNewerVersion = "The DB was likely written by a newer version of the node. Run that " +
+		"version, or resync into a new data directory."
+	dbIntegrityRemediationWrongNetwork = "Check that the node is started with the same network flags, e.g. " +
+		"--testnet or --regtest, as the DB was created with. Otherwise, resync into a new data directory."
+	dbIntegrityRemediationRebuildTxindex = "Rebuild the txindex: stop the node, delete the badger/txindex " +
+		"directory in the data directory, and restart with --txindex."
+	dbIntegrityRemediationRescheduledMigration = "The migration was rescheduled since the DB was written. Check " +
+		"that the node is started with the same network flags as the DB was created with, and resync into a new " +
+		"data directory if the state checksum doesn't match after the migration."
+	dbIntegrityRemediationRecoverSnapshot = "The node recovers on its own by rolling back to the last snapshot " +
+		"when started with --force-checksum. Otherwise, the state checksum can't be trusted until the next " +
+		"snapshot epoch."
+)
+
+// CheckDBIntegrity runs the checks described at the top of this file on the DB. It only returns an error if the
+// DB can't be read at all.
+func CheckDBIntegrity(handle *badger.DB, params *DeSoParams) (*DBIntegrityReport, error) {
+	startTime := time.Now()
+	report := &DBIntegrityReport{}
+	err := handle.View(func(txn *badger.Txn) error {
+		if err := _checkDBIntegrityPrefixes(txn, report); err != nil {
+			return errors.Wrapf(err, "Problem checking prefixes")
+		}
+		if err := _checkDBIntegrityBestChain(txn, params, report); err != nil {
+			return errors.Wrapf(err, "Problem checking best chain")
+		}
+		if report.IsEmpty {
+			return nil
+		}
+		if err := _checkDBIntegritySnapshotMetadata(txn, report); err != nil {
+			return errors.Wrapf(err, "Problem checking snapshot metadata")
+		}
+		if err := _checkDBIntegrityEncoderMigrations(txn, params, report); err != nil {
+			return errors.Wrapf(err, "Problem checking encoder migrations")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "CheckDBIntegrity: ")
+	}
+	report.Duration = time.Since(startTime)
+	return report, nil
+}
+
+func _checkDBIntegrityPrefixes(txn *badger.Txn, report *DBIntegrityReport) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	for prefixID := 0; prefixID <= 255; prefixID++ {
+		prefix := []byte{byte(prefixID)}
+		iterator.Seek(prefix)
+		if !iterator.ValidForPrefix(prefix) {
+			continue
+		}
+		schema := GetDBPrefixSchema(prefix)
+		if schema == nil {
+			report.addIssue(DBIntegrityCheckPrefixes, DBIntegrityIssueError, "",
+				dbIntegrityRemediationNewerVersion, "Found key %x under prefix %d, which isn't in DBPrefixes.",
+				iterator.Item().Key(), prefixID)
+			continue
+		}
+		report.NumPrefixesChecked++
+
+		remediation := dbIntegrityRemediationResync
+		if schema.IsTxindex {
+			remediation = dbIntegrityRemediationRebuildTxindex
+		} else if schema.IsState {
+			remediation = fmt.Sprintf("Resync the prefix: export %v from a healthy node of the same version "+
+				"with ExportPrefix and import it with ImportPrefix, or resync into a new data directory.", schema.Name)
+		}
+		for numEntries := 0; numEntries < DBIntegrityCheckSampleEntriesPerPrefix &&
+			iterator.ValidForPrefix(prefix); numEntries++ {
+
+			item := iterator.Item()
+			key := item.KeyCopy(nil)
+			// Some prefixes mark that they've been built by setting the bare prefix with an empty value, e.g.
+			// PrefixPKIDToFollowCounts. The marker doesn't follow the prefix's schema.
+			if len(key) == 1 && item.ValueSize() == 0 {
+				iterator.Next()
+				continue
+			}
+			report.NumEntriesChecked++
+			if _, err := schema.DecodeKey(key); err != nil {
+				report.addIssue(DBIntegrityCheckPrefixes, DBIntegrityIssueError, schema.Name, remediation,
+					"Key %x doesn't match the prefix's schema: %v", key, err)
+				break
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return errors.Wrapf(err, "Problem reading value for key %x", key)
+			}
+			if _, _, err = schema.DecodeValue(value); err != nil {
+				report.addIssue(DBIntegrityCheckPrefixes, DBIntegrityIssueError, schema.Name, remediation,
+					"Value of key %x doesn't match the prefix's schema: %v", key, err)
+				break
+			}
+			iterator.Next()
+		}
+	}
+	return nil
+}
+
+func _checkDBIntegrityBestChain(txn *badger.Txn, params *DeSoParams, report *DBIntegrityReport) error {
+	bestBlockHash := _getBlockHashForPrefixWithTxn(txn, nil, Prefixes.PrefixBestDeSoBlockHash)
+	genesisBlockHash := MustDecodeHexBlockHash(params.GenesisBlockHashHex)
+	genesisNode := GetHeightHashToNodeInfoWithTxn(txn, nil, 0, genesisBlockHash, false)
+
+	if bestBlockHash == nil {
+		// A DB without a best block hash is expected to be new, in which case it doesn't have a block index.
+		prefix := Prefixes.PrefixHeightHashToNodeInfo
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		iterator.Seek(prefix)
+		if iterator.ValidForPrefix(prefix) {
+			report.addIssue(DBIntegrityCheckBestChain, DBIntegrityIssueError, "PrefixBestDeSoBlockHash",
+				dbIntegrityRemediationResync, "The DB has a block index, but no best block hash.")
+		} else {
+			report.IsEmpty = true
+		}
+		return nil
+	}
+	report.BestBlockHash = bestBlockHash
+
+	if genesisNode == nil {
+		report.addIssue(DBIntegrityCheckBestChain, DBIntegrityIssueError, "PrefixHeightHashToNodeInfo",
+			dbIntegrityRemediationWrongNetwork, "The block index doesn't have the genesis block %v of the %v "+
+				"network.", genesisBlockHash, params.NetworkType)
+	}
+
+	// The block index is keyed by height first, so we search for the best block from the highest block down.
+	prefix := Prefixes.PrefixHeightHashToNodeInfo
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	opts.Prefix = prefix
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+	var tipNode *BlockNode
+	numNodesSearched := 0
+	for iterator.Seek(append(append([]byte{}, prefix...), 0xff)); iterator.ValidForPrefix(prefix) &&
+		numNodesSearched < dbIntegrityCheckMaxTipSearchNodes; iterator.Next() {
+
+		numNodesSearched++
+		key := iterator.Item().Key()
+		if !bytes.Equal(key[len(key)-HashSizeBytes:], bestBlockHash[:]) {
+			continue
+		}
+		value, err := iterator.Item().ValueCopy(nil)
+		if err != nil {
+			return errors.Wrapf(err, "Problem reading block node %v", bestBlockHash)
+		}
+		if tipNode, err = DeserializeBlockNode(value); err != nil {
+			report.addIssue(DBIntegrityCheckBestChain, DBIntegrityIssueError, "PrefixHeightHashToNodeInfo",
+				dbIntegrityRemediationResync, "The block node of the best block %v doesn't decode: %v",
+				bestBlockHash, err)
+			return nil
+		}
+		break
+	}
+	if tipNode == nil {
+		report.addIssue(DBIntegrityCheckBestChain, DBIntegrityIssueError, "PrefixHeightHashToNodeInfo",
+			dbIntegrityRemediationResync, "The best block %v isn't in the top %d blocks of the block index.",
+			bestBlockHash, numNodesSearched)
+		return nil
+	}
+	report.BestBlockHeight = uint64(tipNode.Height)
+
+	// Walk back from the tip, checking that every block's parent is in the block index at the height below.
+	currentNode := tipNode
+	for report.NumBlocksChecked < DBIntegrityCheckBestChainDepth && currentNode.Height > 0 {
+		report.NumBlocksChecked++
+		if currentNode.Header == nil || currentNode.Header.PrevBlockHash == nil {
+			report.addIssue(DBIntegrityCheckBestChain, DBIntegrityIssueError, "PrefixHeightHashToNodeInfo",
+				dbIntegrityRemediationResync, "The block node of block %v at height %d has no header.",
+				currentNode.Hash, currentNode.Height)
+			return nil
+		}
+		parentNode := GetHeightHashToNodeInfoWithTxn(
+			txn, nil, currentNode.Height-1, currentNode.Header.PrevBlockHash, false)
+		if parentNode == nil {
+			report.addIssue(DBIntegrityCheckBestChain, DBIntegrityIssueError, "PrefixHeightHashToNodeInfo",
+				dbIntegrityRemediationResync, "The best chain is broken at height %d: the parent %v of block %v "+
+					"isn't in the block index.", currentNode.Height-1, currentNode.Header.PrevBlockHash,
+				currentNode.Hash)
+			return nil
+		}
+		currentNode = parentNode
+	}
+	if genesisNode != nil && currentNode.Height == 0 && !currentNode.Hash.IsEqual(genesisBlockHash) {
+		report.addIssue(DBIntegrityCheckBestChain, DBIntegrityIssueError, "PrefixHeightHashToNodeInfo",
+			dbIntegrityRemediationWrongNetwork, "The best chain starts at block %v rather than at the genesis "+
+				"block %v of the %v network.", currentNode.Hash, genesisBlockHash, params.NetworkType)
+	}
+	return nil
+}
+
+func _checkDBIntegritySnapshotMetadata(txn *badger.Txn, report *DBIntegrityReport) error {
+	prefix := "PrefixHypersyncSnapshotDBPrefix"
+
+	metadataBytes, err := _getDBIntegrityValue(txn, getMainDbPrefix(_prefixLastEpochMetadata))
+	if err != nil {
+		return err
+	}
+	if metadataBytes != nil {
+		metadata := &SnapshotEpochMetadata{}
+		if err = metadata.FromBytes(bytes.NewReader(metadataBytes)); err != nil {
+			report.addIssue(DBIntegrityCheckSnapshotMetadata, DBIntegrityIssueError, prefix,
+				dbIntegrityRemediationResync, "The snapshot epoch metadata doesn't decode: %v", err)
+		} else {
+			if metadata.SnapshotBlockHeight > report.BestBlockHeight {
+				report.addIssue(DBIntegrityCheckSnapshotMetadata, DBIntegrityIssueError, prefix,
+					dbIntegrityRemediationResync, "The snapshot height %d is above the best block height %d.",
+					metadata.SnapshotBlockHeight, report.BestBlockHeight)
+			}
+			if metadata.FirstSnapshotBlockHeight > metadata.SnapshotBlockHeight {
+				report.addIssue(DBIntegrityCheckSnapshotMetadata, DBIntegrityIssueError, prefix,
+					dbIntegrityRemediationResync, "The first snapshot height %d is above the snapshot height %d.",
+					metadata.FirstSnapshotBlockHeight, metadata.SnapshotBlockHeight)
+			}
+		}
+	}
+
+	statusBytes, err := _getDBIntegrityValue(txn, getMainDbPrefix(_prefixSnapshotStatus))
+	if err != nil {
+		return err
+	}
+	if statusBytes != nil {
+		status := &SnapshotStatus{}
+		if err = status.FromBytes(bytes.NewReader(statusBytes)); err != nil {
+			report.addIssue(DBIntegrityCheckSnapshotMetadata, DBIntegrityIssueError, prefix,
+				dbIntegrityRemediationResync, "The snapshot status doesn't decode: %v", err)
+		} else if status.CurrentBlockHeight > report.BestBlockHeight {
+			report.addIssue(DBIntegrityCheckSnapshotMetadata, DBIntegrityIssueWarning, prefix,
+				dbIntegrityRemediationRecoverSnapshot, "The snapshot status height %d is above the best block "+
+					"height %d.", status.CurrentBlockHeight, report.BestBlockHeight)
+		}
+	}
+
+	operationChannelStatusBytes, err := _getDBIntegrityValue(txn, getMainDbPrefix(_prefixOperationChannelStatus))
+	if err != nil {
+		return err
+	}
+	if operationChannelStatusBytes != nil {
+		stateSemaphore, err := ReadUvarint(bytes.NewReader(operationChannelStatusBytes))
+		if err != nil {
+			report.addIssue(DBIntegrityCheckSnapshotMetadata, DBIntegrityIssueError, prefix,
+				dbIntegrityRemediationResync, "The snapshot operation channel status doesn't decode: %v", err)
+		} else if stateSemaphore > 0 {
+			report.addIssue(DBIntegrityCheckSnapshotMetadata, DBIntegrityIssueWarning, prefix,
+				dbIntegrityRemediationRecoverSnapshot, "%d snapshot operations didn't finish before the last "+
+					"shutdown.", stateSemaphore)
+		}
+	}
+	return nil
+}
+
+func _checkDBIntegrityEncoderMigrations(txn *badger.Txn, params *DeSoParams, report *DBIntegrityReport) error {
+	prefix := "PrefixHypersyncSnapshotDBPrefix"
+
+	migrationBytes, err := _getDBIntegrityValue(txn, getMainDbPrefix(_prefixMigrationStatus))
+	if err != nil || migrationBytes == nil {
+		return err
+	}
+	// The migrations are stored by EncoderMigration.SaveMigrations. We skip the checksums, which can't be checked
+	// without recomputing them.
+	rr := bytes.NewReader(migrationBytes)
+	numMigrations, err := ReadUvarint(rr)
+	if err != nil {
+		report.addIssue(DBIntegrityCheckEncoderMigrations, DBIntegrityIssueError, prefix,
+			dbIntegrityRemediationResync, "The encoder migrations don't decode: %v", err)
+		return nil
+	}
+	for ii := uint64(0); ii < numMigrations; ii++ {
+		var blockHeight uint64
+		var version byte
+		if _, err = DecodeByteArray(rr); err == nil {
+			if blockHeight, err = ReadUvarint(rr); err == nil {
+				if version, err = rr.ReadByte(); err == nil {
+					_, err = ReadBoolByte(rr)
+				}
+			}
+		}
+		if err != nil {
+			report.addIssue(DBIntegrityCheckEncoderMigrations, DBIntegrityIssueError, prefix,
+				dbIntegrityRemediationResync, "Encoder migration %d doesn't decode: %v", ii, err)
+			return nil
+		}
+
+		var migrationHeight *MigrationHeight
+		for _, paramsMigrationHeight := range params.EncoderMigrationHeightsList {
+			if paramsMigrationHeight.Version == version {
+				migrationHeight = paramsMigrationHeight
+				break
+			}
+		}
+		if migrationHeight == nil {
+			report.addIssue(DBIntegrityCheckEncoderMigrations, DBIntegrityIssueError, prefix,
+				dbIntegrityRemediationNewerVersion, "The DB has encoder migration version %d, which the node "+
+					"doesn't know about.", version)
+		} else if migrationHeight.Height != blockHeight {
+			// The node keeps the height it stored, so the migration's checksum is computed at the old height.
+			report.addIssue(DBIntegrityCheckEncoderMigrations, DBIntegrityIssueWarning, prefix,
+				dbIntegrityRemediationRescheduledMigration, "Encoder migration %v (version %d) is at height %d in the DB, "+
+					"but at height %d in the node's params.", migrationHeight.Name, version, blockHeight,
+				migrationHeight.Height)
+		}
+	}
+	return nil
+}
+
+// _getDBIntegrityValue returns the value of the key, or nil if the key doesn't exist.
+func _getDBIntegrityValue(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem reading key %x", key)
+	}
+	return item.ValueCopy(nil)
+}
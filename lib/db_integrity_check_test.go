@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDBIntegrity(t *testing.T) {
+	require := require.New(t)
+
+	// A new DB has no best chain, and nothing to report.
+	emptyDb, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer emptyDb.Close()
+	report, err := CheckDBIntegrity(emptyDb, &DeSoTestnetParams)
+	require.NoError(err)
+	require.True(report.IsEmpty)
+	require.Empty(report.Issues)
+
+	// A chain with a few blocks mined has no issues.
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true)
+	for ii := 0; ii < 3; ii++ {
+		_, err = miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+	// The follow counts are marked as built, as they are on every node that has started once.
+	require.NoError(DbBuildFollowCountsIfMissing(db))
+
+	// The node checks the DB before the snapshot starts, so stop the snapshot to flush its operations.
+	chain.snapshot.Stop()
+	report, err = CheckDBIntegrity(db, params)
+	require.NoError(err)
+	require.False(report.IsEmpty)
+	require.Empty(report.Issues, report.String())
+	require.Equal(chain.BlockTip().Hash, report.BestBlockHash)
+	require.Equal(uint64(chain.BlockTip().Height), report.BestBlockHeight)
+	require.Equal(uint64(chain.BlockTip().Height), report.NumBlocksChecked)
+	require.NotZero(report.NumEntriesChecked)
+
+	// The DB doesn't have the genesis block of a network with another genesis block.
+	otherParams := *params
+	otherParams.GenesisBlockHashHex = hex.EncodeToString(RandomBytes(HashSizeBytes))
+	report, err = CheckDBIntegrity(db, &otherParams)
+	require.NoError(err)
+	require.Len(report.Issues, 1)
+	require.Equal(DBIntegrityCheckBestChain, report.Issues[0].Check)
+	require.Equal(dbIntegrityRemediationWrongNetwork, report.Issues[0].Remediation)
+
+	// Corrupt the DB: a key under an unknown prefix, a balance entry that doesn't decode, a txindex entry that
+	// doesn't decode, a hole in the best chain, and an unfinished snapshot operation.
+	unknownPrefix := byte(0)
+	for GetDBPrefixSchema([]byte{unknownPrefix}) != nil {
+		unknownPrefix++
+	}
+	tipNode := chain.BlockTip()
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set([]byte{unknownPrefix, 1, 2, 3}, []byte{4}); err != nil {
+			return err
+		}
+		balanceKey := append(append(append([]byte{}, Prefixes.PrefixHODLerPKIDCreatorPKIDToBalanceEntry...),
+			m0PkBytes[:PublicKeyLenCompressed-1]...), m1PkBytes[:PublicKeyLenCompressed-1]...)
+		if err := txn.Set(balanceKey, []byte{1, 2, 3}); err != nil {
+			return err
+		}
+		txindexKey := append(append([]byte{}, Prefixes.PrefixTransactionIDToMetadata...),
+			RandomBytes(HashSizeBytes)...)
+		if err := txn.Set(txindexKey, []byte{1, 2, 3}); err != nil {
+			return err
+		}
+		parentKey := _heightHashToNodeIndexKey(tipNode.Height-1, tipNode.Header.PrevBlockHash, false)
+		if err := txn.Delete(parentKey); err != nil {
+			return err
+		}
+		return txn.Set(getMainDbPrefix(_prefixOperationChannelStatus), UintToBuf(2))
+	}))
+	report, err = CheckDBIntegrity(db, params)
+	require.NoError(err)
+	require.True(report.HasErrors())
+	issuesByPrefix := make(map[string]*DBIntegrityIssue)
+	for _, issue := range report.Issues {
+		issuesByPrefix[issue.Prefix] = issue
+	}
+	require.Len(report.Issues, 5, report.String())
+
+	unknownPrefixIssue := issuesByPrefix[""]
+	require.Equal(DBIntegrityCheckPrefixes, unknownPrefixIssue.Check)
+	require.Equal(dbIntegrityRemediationNewerVersion, unknownPrefixIssue.Remediation)
+
+	balanceIssue := issuesByPrefix["PrefixHODLerPKIDCreatorPKIDToBalanceEntry"]
+	require.Equal(DBIntegrityIssueError, balanceIssue.Severity)
+	require.Contains(balanceIssue.Remediation, "export PrefixHODLerPKIDCreatorPKIDToBalanceEntry")
+
+	txindexIssue := issuesByPrefix["PrefixTransactionIDToMetadata"]
+	require.Equal(dbIntegrityRemediationRebuildTxindex, txindexIssue.Remediation)
+
+	bestChainIssue := issuesByPrefix["PrefixHeightHashToNodeInfo"]
+	require.Equal(DBIntegrityCheckBestChain, bestChainIssue.Check)
+	require.Contains(bestChainIssue.Description, tipNode.Header.PrevBlockHash.String())
+
+	snapshotIssue := issuesByPrefix["PrefixHypersyncSnapshotDBPrefix"]
+	require.Equal(DBIntegrityCheckSnapshotMetadata, snapshotIssue.Check)
+	require.Equal(DBIntegrityIssueWarning, snapshotIssue.Severity)
+}
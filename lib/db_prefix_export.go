@@ -0,0 +1,266 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Prefix Export
+//
+// ExportPrefix writes every entry stored under a prefix as JSON lines, one DBPrefixExportEntry per line, and
+// ImportPrefix writes such lines back into a DB. This lets an engineer move a single prefix, e.g. all DAO coin
+// limit orders, from one environment to another, or inspect it with jq and other standard tools.
+//
+// Every line has the raw key and value in hex, which is what ImportPrefix writes back, so an export round-trips
+// exactly. Every line also has the key and value decoded with the prefix's schema, see db_schema.go, so that the
+// export is readable. The decoded fields are informational: ImportPrefix ignores them, so editing them has no
+// effect. An entry that doesn't match its prefix's schema is still exported, with the DecodeError that the schema
+// returned.
+//
+// ImportPrefix writes the entries through DBSetWithTxn, so the ancestral records and the checksum are updated for
+// state prefixes if a snapshot is passed. It doesn't delete the entries that were already under the prefix.
+
+const (
+	// dbPrefixImportBatchSize is the number of entries ImportPrefix writes per badger transaction, which keeps
+	// imports of large prefixes under badger's transaction size limit.
+	dbPrefixImportBatchSize = 1000
+	// dbPrefixImportMaxLineBytes is the longest line ImportPrefix accepts.
+	dbPrefixImportMaxLineBytes = 64 << 20
+)
+
+// DBPrefixExportField is a decoded field of an exported key or value. Hashes and byte strings are hex-encoded,
+// public keys and PKIDs are Base58Check-encoded, uint256s are decimal strings, and the other integers are numbers.
+type DBPrefixExportField struct {
+	Name  string
+	Type  DBSchemaFieldType
+	Value interface{}
+}
+
+// DBPrefixExportEntry is a single line of a prefix export.
+type DBPrefixExportEntry struct {
+	// Prefix is the name of the prefix's field in DBPrefixes.
+	Prefix   string
+	KeyHex   string
+	ValueHex string
+
+	KeyFields []*DBPrefixExportField `json:",omitempty"`
+	// ValueEncoder and ValueEntry are set if the prefix's values are a DeSoEncoder, which is marshaled as is.
+	// Otherwise, ValueFields are the decoded fields of the value.
+	ValueEncoder string                 `json:",omitempty"`
+	ValueEntry   json.RawMessage        `json:",omitempty"`
+	ValueFields  []*DBPrefixExportField `json:",omitempty"`
+	// DecodeError is set if the key or value couldn't be decoded with the prefix's schema.
+	DecodeError string `json:",omitempty"`
+}
+
+// ExportPrefix writes every entry stored under the prefix to ww as JSON lines, in key order. It returns the number
+// of entries written.
+func ExportPrefix(handle *badger.DB, params *DeSoParams, prefixID byte, ww io.Writer) (_numEntries uint64, _err error) {
+	schema := GetDBPrefixSchema([]byte{prefixID})
+	if schema == nil {
+		return 0, fmt.Errorf("ExportPrefix: Prefix %d isn't in DBPrefixes", prefixID)
+	}
+
+	bufferedWriter := bufio.NewWriter(ww)
+	encoder := json.NewEncoder(bufferedWriter)
+	numEntries := uint64(0)
+	err := handle.View(func(txn *badger.Txn) error {
+		prefix := []byte{prefixID}
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			key := iterator.Item().KeyCopy(nil)
+			value, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return errors.Wrapf(err, "Problem reading value for key %x", key)
+			}
+			if err = encoder.Encode(newDBPrefixExportEntry(schema, params, key, value)); err != nil {
+				return errors.Wrapf(err, "Problem writing entry for key %x", key)
+			}
+			numEntries++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "ExportPrefix: Problem exporting prefix %v", schema.Name)
+	}
+	if err = bufferedWriter.Flush(); err != nil {
+		return 0, errors.Wrapf(err, "ExportPrefix: Problem flushing export of prefix %v", schema.Name)
+	}
+	return numEntries, nil
+}
+
+// ImportPrefix writes the entries of a prefix export read from rr into the DB. Every key must be stored under the
+// prefix that its line names. It returns the number of entries written. If it fails partway through, the entries
+// before the failing line may already have been written.
+func ImportPrefix(handle *badger.DB, snap *Snapshot, rr io.Reader) (_numEntries uint64, _err error) {
+	scanner := bufio.NewScanner(rr)
+	scanner.Buffer(nil, dbPrefixImportMaxLineBytes)
+
+	type importEntry struct {
+		key   []byte
+		value []byte
+	}
+	var batch []*importEntry
+	numEntries := uint64(0)
+	flushBatch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := handle.Update(func(txn *badger.Txn) error {
+			for _, entry := range batch {
+				if err := DBSetWithTxn(txn, snap, entry.key, entry.value, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		numEntries += uint64(len(batch))
+		batch = nil
+		return nil
+	}
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		exportEntry := &DBPrefixExportEntry{}
+		if err := json.Unmarshal(line, exportEntry); err != nil {
+			return numEntries, errors.Wrapf(err, "ImportPrefix: Problem parsing line %d", lineNumber)
+		}
+		schema := getDBPrefixSchemaByName(exportEntry.Prefix)
+		if schema == nil {
+			return numEntries, fmt.Errorf("ImportPrefix: Line %d has unknown prefix %v", lineNumber,
+				exportEntry.Prefix)
+		}
+		key, err := hex.DecodeString(exportEntry.KeyHex)
+		if err != nil {
+			return numEntries, errors.Wrapf(err, "ImportPrefix: Problem decoding key on line %d", lineNumber)
+		}
+		if len(key) == 0 || key[0] != schema.Prefix {
+			return numEntries, fmt.Errorf("ImportPrefix: Key %x on line %d isn't under prefix %v",
+				key, lineNumber, schema.Name)
+		}
+		value, err := hex.DecodeString(exportEntry.ValueHex)
+		if err != nil {
+			return numEntries, errors.Wrapf(err, "ImportPrefix: Problem decoding value on line %d", lineNumber)
+		}
+		batch = append(batch, &importEntry{key: key, value: value})
+		if len(batch) >= dbPrefixImportBatchSize {
+			if err = flushBatch(); err != nil {
+				return numEntries, errors.Wrapf(err, "ImportPrefix: Problem writing entries before line %d",
+					lineNumber)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return numEntries, errors.Wrapf(err, "ImportPrefix: Problem reading line %d", lineNumber+1)
+	}
+	if err := flushBatch(); err != nil {
+		return numEntries, errors.Wrapf(err, "ImportPrefix: Problem writing entries")
+	}
+	return numEntries, nil
+}
+
+func newDBPrefixExportEntry(schema *DBPrefixSchema, params *DeSoParams, key []byte, value []byte,
+) *DBPrefixExportEntry {
+	exportEntry := &DBPrefixExportEntry{
+		Prefix:   schema.Name,
+		KeyHex:   hex.EncodeToString(key),
+		ValueHex: hex.EncodeToString(value),
+	}
+	keyFieldValues, err := schema.DecodeKey(key)
+	if err != nil {
+		exportEntry.DecodeError = err.Error()
+		return exportEntry
+	}
+	exportEntry.KeyFields = newDBPrefixExportFields(keyFieldValues, params)
+
+	valueEncoder, valueFieldValues, err := schema.DecodeValue(value)
+	if err != nil {
+		exportEntry.DecodeError = err.Error()
+		return exportEntry
+	}
+	if valueEncoder != nil {
+		exportEntry.ValueEncoder = schema.ValueEncoderName
+		// Not every encoder marshals to JSON, e.g. if it has a map with struct keys, in which case the raw value
+		// has to do.
+		if valueEntry, err := json.Marshal(valueEncoder); err == nil {
+			exportEntry.ValueEntry = valueEntry
+		} else {
+			exportEntry.DecodeError = fmt.Sprintf("Problem marshaling %v: %v", schema.ValueEncoderName, err)
+		}
+	}
+	exportEntry.ValueFields = newDBPrefixExportFields(valueFieldValues, params)
+	return exportEntry
+}
+
+func newDBPrefixExportFields(fieldValues []*DBSchemaFieldValue, params *DeSoParams) []*DBPrefixExportField {
+	var exportFields []*DBPrefixExportField
+	for _, fieldValue := range fieldValues {
+		exportFields = append(exportFields, &DBPrefixExportField{
+			Name:  fieldValue.Field.Name,
+			Type:  fieldValue.Field.Type,
+			Value: formatDBSchemaFieldValue(fieldValue, params),
+		})
+	}
+	return exportFields
+}
+
+// formatDBSchemaFieldValue returns the readable form of a decoded field. The field was already decoded by the
+// schema, so its bytes are known to be well-formed.
+func formatDBSchemaFieldValue(fieldValue *DBSchemaFieldValue, params *DeSoParams) interface{} {
+	data := fieldValue.Bytes
+	switch fieldValue.Field.Type {
+	case DBSchemaFieldTypePublicKey, DBSchemaFieldTypePKID:
+		return PkToString(data, params)
+	case DBSchemaFieldTypeGroupKeyName:
+		return string(bytes.TrimRight(data, "\x00"))
+	case DBSchemaFieldTypeUint8:
+		return data[0]
+	case DBSchemaFieldTypeBool:
+		return data[0] != 0
+	case DBSchemaFieldTypeUint16:
+		return binary.BigEndian.Uint16(data)
+	case DBSchemaFieldTypeUint32:
+		return binary.BigEndian.Uint32(data)
+	case DBSchemaFieldTypeUint64:
+		return binary.BigEndian.Uint64(data)
+	case DBSchemaFieldTypeUvarint:
+		value, _ := ReadUvarint(bytes.NewReader(data))
+		return value
+	case DBSchemaFieldTypeFixedWidthUint256:
+		if value, err := FixedWidthDecodeUint256(bytes.NewReader(data)); err == nil {
+			return value.ToBig().String()
+		}
+	case DBSchemaFieldTypeVariableUint256:
+		if value, err := VariableDecodeUint256(bytes.NewReader(data)); err == nil && value != nil {
+			return value.ToBig().String()
+		}
+	case DBSchemaFieldTypeNullTerminatedBytes:
+		return hex.EncodeToString(data[:len(data)-1])
+	case DBSchemaFieldTypeByteArray:
+		if value, err := DecodeByteArray(bytes.NewReader(data)); err == nil {
+			return hex.EncodeToString(value)
+		}
+	case DBSchemaFieldTypeShortByteArray:
+		return hex.EncodeToString(data[1:])
+	}
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixExportImport(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	transactorPKID := NewPKID(m0PkBytes)
+	targetPKID := NewPKID(m1PkBytes)
+
+	// Store a couple of balance entries, a txindex entry with value fields, and an entry that doesn't match its
+	// prefix's schema.
+	balancePrefix := Prefixes.PrefixHODLerPKIDCreatorPKIDToBalanceEntry
+	balanceEntries := []*BalanceEntry{
+		{HODLerPKID: transactorPKID, CreatorPKID: targetPKID, BalanceNanos: *uint256.NewInt(10)},
+		{HODLerPKID: targetPKID, CreatorPKID: transactorPKID, BalanceNanos: *uint256.NewInt(20)},
+	}
+	diamondsPrefix := Prefixes.PrefixTxindexDiamondsByHeight
+	diamondsKey := append(append(append(append([]byte{}, diamondsPrefix...), EncodeUint64(5)...),
+		transactorPKID[:]...), RandomBytes(HashSizeBytes)...)
+	diamondsValue := append(append(append([]byte{}, targetPKID[:]...), EncodeUint64(2)...), EncodeUint64(1)...)
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		for _, balanceEntry := range balanceEntries {
+			key := append(append(append([]byte{}, balancePrefix...), balanceEntry.HODLerPKID[:]...),
+				balanceEntry.CreatorPKID[:]...)
+			if err := DBSetWithTxn(txn, nil, key, EncodeToBytes(0, balanceEntry), nil); err != nil {
+				return err
+			}
+		}
+		if err := DBSetWithTxn(txn, nil, append(append([]byte{}, balancePrefix...), 1, 2, 3), []byte{4}, nil); err != nil {
+			return err
+		}
+		return DBSetWithTxn(txn, nil, diamondsKey, diamondsValue, nil)
+	}))
+
+	// Every entry under the prefix is exported on its own line, decoded with the prefix's schema.
+	var export bytes.Buffer
+	numEntries, err := ExportPrefix(db, &DeSoTestnetParams, balancePrefix[0], &export)
+	require.NoError(err)
+	require.Equal(uint64(3), numEntries)
+	lines := strings.Split(strings.TrimSpace(export.String()), "\n")
+	require.Len(lines, 3)
+	var exportEntries []*DBPrefixExportEntry
+	for _, line := range lines {
+		exportEntry := &DBPrefixExportEntry{}
+		require.NoError(json.Unmarshal([]byte(line), exportEntry))
+		require.Equal("PrefixHODLerPKIDCreatorPKIDToBalanceEntry", exportEntry.Prefix)
+		exportEntries = append(exportEntries, exportEntry)
+	}
+	require.NotEmpty(exportEntries[0].DecodeError)
+	require.Empty(exportEntries[0].KeyFields)
+	for _, exportEntry := range exportEntries[1:] {
+		require.Empty(exportEntry.DecodeError)
+		require.Equal("BalanceEntry", exportEntry.ValueEncoder)
+		require.NotEmpty(exportEntry.ValueEntry)
+		require.Len(exportEntry.KeyFields, 2)
+		require.Equal("HODLerPKID", exportEntry.KeyFields[0].Name)
+	}
+	require.Contains([]interface{}{
+		PkToString(transactorPKID[:], &DeSoTestnetParams),
+		PkToString(targetPKID[:], &DeSoTestnetParams),
+	}, exportEntries[1].KeyFields[0].Value)
+
+	var diamondsExport bytes.Buffer
+	_, err = ExportPrefix(db, &DeSoTestnetParams, diamondsPrefix[0], &diamondsExport)
+	require.NoError(err)
+	diamondsExportEntry := &DBPrefixExportEntry{}
+	require.NoError(json.Unmarshal(diamondsExport.Bytes(), diamondsExportEntry))
+	require.Empty(diamondsExportEntry.ValueEncoder)
+	require.Len(diamondsExportEntry.ValueFields, 3)
+	require.Equal(float64(5), diamondsExportEntry.KeyFields[0].Value)
+	require.Equal(float64(1), diamondsExportEntry.ValueFields[2].Value)
+
+	// Importing the exports into another DB recreates the exact same entries.
+	otherDb, otherDir := GetTestBadgerDb()
+	defer os.RemoveAll(otherDir)
+	defer otherDb.Close()
+	numEntries, err = ImportPrefix(otherDb, nil, io.MultiReader(&export, &diamondsExport))
+	require.NoError(err)
+	require.Equal(uint64(4), numEntries)
+	for _, prefix := range [][]byte{balancePrefix, diamondsPrefix} {
+		keys, values := EnumerateKeysForPrefix(db, prefix, false)
+		otherKeys, otherValues := EnumerateKeysForPrefix(otherDb, prefix, false)
+		require.Equal(keys, otherKeys)
+		require.Equal(values, otherValues)
+	}
+
+	// Lines with an unknown prefix, or a key that isn't under the prefix they name, are rejected.
+	_, err = ImportPrefix(otherDb, nil, strings.NewReader(`{"Prefix":"PrefixUnknown","KeyHex":"00","ValueHex":""}`))
+	require.Error(err)
+	_, err = ImportPrefix(otherDb, nil, strings.NewReader(
+		`{"Prefix":"PrefixHODLerPKIDCreatorPKIDToBalanceEntry","KeyHex":"00","ValueHex":""}`))
+	require.Error(err)
+	_, err = ExportPrefix(db, &DeSoTestnetParams, 255, &export)
+	require.Error(err)
+}
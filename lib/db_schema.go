@@ -0,0 +1,1007 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The DB schema describes the layout of the keys and values stored under every prefix in DBPrefixes, so that
+// generic tooling such as block explorers, migrators, and debuggers can decode any entry in the DB without
+// reimplementing the key functions of each prefix. The schema of a prefix is a list of the fields of its key,
+// in order, and either the DeSoEncoder stored in its value or a list of the fields of its value.
+//
+// Every prefix must have a layout in dbPrefixSchemaLayouts. When adding a prefix, add its layout there and
+// regenerate the schema docs with:
+//
+//	go test ./lib -run TestDBSchema -update-db-schema
+
+// DBSchemaFieldType is the encoding of a single field of a key or value.
+type DBSchemaFieldType uint8
+
+const (
+	// DBSchemaFieldTypeBlockHash is a 32-byte hash, e.g. a block hash, txn hash, or post hash.
+	DBSchemaFieldTypeBlockHash DBSchemaFieldType = 0
+	// DBSchemaFieldTypePublicKey is a 33-byte compressed public key.
+	DBSchemaFieldTypePublicKey DBSchemaFieldType = 1
+	// DBSchemaFieldTypePKID is a 33-byte PKID.
+	DBSchemaFieldTypePKID DBSchemaFieldType = 2
+	// DBSchemaFieldTypeGroupKeyName is a 32-byte, zero-padded access group key name.
+	DBSchemaFieldTypeGroupKeyName DBSchemaFieldType = 3
+	DBSchemaFieldTypeUint8        DBSchemaFieldType = 4
+	DBSchemaFieldTypeBool         DBSchemaFieldType = 5
+	// DBSchemaFieldTypeUint16, DBSchemaFieldTypeUint32, and DBSchemaFieldTypeUint64 are big-endian, so that keys
+	// sort by them. Signed timestamps and durations are stored as their uint64 conversion.
+	DBSchemaFieldTypeUint16 DBSchemaFieldType = 6
+	DBSchemaFieldTypeUint32 DBSchemaFieldType = 7
+	DBSchemaFieldTypeUint64 DBSchemaFieldType = 8
+	// DBSchemaFieldTypeUvarint is a uint64 encoded with UintToBuf.
+	DBSchemaFieldTypeUvarint DBSchemaFieldType = 9
+	// DBSchemaFieldTypeFixedWidthUint256 is a uint256 encoded with FixedWidthEncodeUint256.
+	DBSchemaFieldTypeFixedWidthUint256 DBSchemaFieldType = 10
+	// DBSchemaFieldTypeVariableUint256 is a uint256 encoded with VariableEncodeUint256.
+	DBSchemaFieldTypeVariableUint256 DBSchemaFieldType = 11
+	// DBSchemaFieldTypeNullTerminatedBytes is a byte string followed by AssociationNullTerminator.
+	DBSchemaFieldTypeNullTerminatedBytes DBSchemaFieldType = 12
+	// DBSchemaFieldTypeByteArray is a byte string encoded with EncodeByteArray, i.e. prefixed with its length.
+	DBSchemaFieldTypeByteArray DBSchemaFieldType = 13
+	// DBSchemaFieldTypeShortByteArray is a byte string prefixed with its length as a single byte.
+	DBSchemaFieldTypeShortByteArray DBSchemaFieldType = 14
+	// DBSchemaFieldTypeBytes is a byte string of the field's Length, or, if its Length is zero, of whatever is left
+	// once the other fields of the key or value have been read. A key or value has at most one variable-length
+	// DBSchemaFieldTypeBytes field.
+	DBSchemaFieldTypeBytes DBSchemaFieldType = 15
+	// DBSchemaFieldTypeSerialized is the rest of the value, encoded with the ToBytes method of the Go type that
+	// the field is named after rather than with EncodeToBytes.
+	DBSchemaFieldTypeSerialized DBSchemaFieldType = 16
+)
+
+var dbSchemaFieldTypeNames = map[DBSchemaFieldType]string{
+	DBSchemaFieldTypeBlockHash:           "BlockHash",
+	DBSchemaFieldTypePublicKey:           "PublicKey",
+	DBSchemaFieldTypePKID:                "PKID",
+	DBSchemaFieldTypeGroupKeyName:        "GroupKeyName",
+	DBSchemaFieldTypeUint8:               "uint8",
+	DBSchemaFieldTypeBool:                "bool",
+	DBSchemaFieldTypeUint16:              "uint16",
+	DBSchemaFieldTypeUint32:              "uint32",
+	DBSchemaFieldTypeUint64:              "uint64",
+	DBSchemaFieldTypeUvarint:             "uvarint",
+	DBSchemaFieldTypeFixedWidthUint256:   "FixedWidthUint256",
+	DBSchemaFieldTypeVariableUint256:     "VariableUint256",
+	DBSchemaFieldTypeNullTerminatedBytes: "NullTerminatedBytes",
+	DBSchemaFieldTypeByteArray:           "ByteArray",
+	DBSchemaFieldTypeShortByteArray:      "ShortByteArray",
+	DBSchemaFieldTypeBytes:               "Bytes",
+	DBSchemaFieldTypeSerialized:          "Serialized",
+}
+
+func (fieldType DBSchemaFieldType) String() string {
+	if name, exists := dbSchemaFieldTypeNames[fieldType]; exists {
+		return name
+	}
+	return fmt.Sprintf("DBSchemaFieldType(%d)", uint8(fieldType))
+}
+
+func (fieldType DBSchemaFieldType) MarshalText() ([]byte, error) {
+	return []byte(fieldType.String()), nil
+}
+
+func (fieldType *DBSchemaFieldType) UnmarshalText(text []byte) error {
+	for candidateType, name := range dbSchemaFieldTypeNames {
+		if name == string(text) {
+			*fieldType = candidateType
+			return nil
+		}
+	}
+	return fmt.Errorf("DBSchemaFieldType.UnmarshalText: Unknown field type %v", string(text))
+}
+
+// Size returns the number of bytes a field of the type always takes, or zero if its size varies.
+func (fieldType DBSchemaFieldType) Size() int {
+	switch fieldType {
+	case DBSchemaFieldTypeBlockHash, DBSchemaFieldTypeGroupKeyName:
+		return HashSizeBytes
+	case DBSchemaFieldTypePublicKey, DBSchemaFieldTypePKID:
+		return PublicKeyLenCompressed
+	case DBSchemaFieldTypeUint8, DBSchemaFieldTypeBool:
+		return 1
+	case DBSchemaFieldTypeUint16:
+		return 2
+	case DBSchemaFieldTypeUint32:
+		return 4
+	case DBSchemaFieldTypeUint64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// DBSchemaField is a single field of a key or value.
+type DBSchemaField struct {
+	Name string
+	Type DBSchemaFieldType
+	// Length is the number of bytes of a DBSchemaFieldTypeBytes field, or zero if it takes the rest of the key
+	// or value.
+	Length int `json:",omitempty"`
+}
+
+func (field DBSchemaField) String() string {
+	switch {
+	case field.Type == DBSchemaFieldTypeBytes && field.Length > 0:
+		return fmt.Sprintf("%v [%d]byte", field.Name, field.Length)
+	case field.Type == DBSchemaFieldTypeBytes:
+		return fmt.Sprintf("%v []byte", field.Name)
+	case field.Type == DBSchemaFieldTypeSerialized:
+		return fmt.Sprintf("%v.ToBytes()", field.Name)
+	}
+	return fmt.Sprintf("%v %v", field.Name, field.Type)
+}
+
+func (field DBSchemaField) size() int {
+	if field.Type == DBSchemaFieldTypeBytes {
+		return field.Length
+	}
+	return field.Type.Size()
+}
+
+// DBPrefixSchema is the layout of the keys and values stored under a prefix.
+type DBPrefixSchema struct {
+	// Name is the name of the prefix's field in DBPrefixes.
+	Name        string
+	Prefix      byte
+	IsState     bool
+	IsCoreState bool
+	IsTxindex   bool
+
+	// KeyFields are the fields that follow the prefix in a key. A prefix without key fields holds a single entry.
+	KeyFields []DBSchemaField
+	// ValueEncoderType is set if the value is a DeSoEncoder encoded with EncodeToBytes, in which case
+	// ValueFields is empty. Otherwise, the value consists of the ValueFields, and is empty if there are none.
+	ValueEncoderType *EncoderType `json:",omitempty"`
+	ValueEncoderName string       `json:",omitempty"`
+	ValueFields      []DBSchemaField
+
+	// Description notes anything about the prefix that its layout doesn't capture.
+	Description string `json:",omitempty"`
+}
+
+// KeyLayout returns the layout of the prefix's keys, e.g. "<[33], HODLerPKID PKID, CreatorPKID PKID>".
+func (schema *DBPrefixSchema) KeyLayout() string {
+	fields := []string{fmt.Sprintf("[%d]", schema.Prefix)}
+	for _, field := range schema.KeyFields {
+		fields = append(fields, field.String())
+	}
+	return "<" + strings.Join(fields, ", ") + ">"
+}
+
+// ValueLayout returns the layout of the prefix's values, e.g. "<BalanceEntry>".
+func (schema *DBPrefixSchema) ValueLayout() string {
+	if schema.ValueEncoderType != nil {
+		return "<" + schema.ValueEncoderName + ">"
+	}
+	var fields []string
+	for _, field := range schema.ValueFields {
+		fields = append(fields, field.String())
+	}
+	return "<" + strings.Join(fields, ", ") + ">"
+}
+
+// DBSchemaFieldValue is the raw bytes of a field of a decoded key or value.
+type DBSchemaFieldValue struct {
+	Field DBSchemaField
+	Bytes []byte
+}
+
+// DecodeKey splits a key stored under the prefix into its fields.
+func (schema *DBPrefixSchema) DecodeKey(key []byte) ([]*DBSchemaFieldValue, error) {
+	if len(key) == 0 || key[0] != schema.Prefix {
+		return nil, fmt.Errorf("DBPrefixSchema.DecodeKey: Key %x isn't under prefix %v", key, schema.Name)
+	}
+	fieldValues, err := _decodeDBSchemaFields(schema.KeyFields, key[1:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBPrefixSchema.DecodeKey: Problem decoding key %x under prefix %v",
+			key, schema.Name)
+	}
+	return fieldValues, nil
+}
+
+// DecodeValue decodes a value stored under the prefix. It returns the DeSoEncoder stored in the value if the
+// prefix has a ValueEncoderType, and otherwise splits the value into its fields.
+func (schema *DBPrefixSchema) DecodeValue(value []byte) (DeSoEncoder, []*DBSchemaFieldValue, error) {
+	if schema.ValueEncoderType != nil {
+		encoder := schema.ValueEncoderType.New()
+		if exists, err := DecodeFromBytes(encoder, bytes.NewReader(value)); err != nil {
+			return nil, nil, errors.Wrapf(err, "DBPrefixSchema.DecodeValue: Problem decoding %v under prefix %v",
+				schema.ValueEncoderName, schema.Name)
+		} else if !exists {
+			return nil, nil, nil
+		}
+		return encoder, nil, nil
+	}
+	fieldValues, err := _decodeDBSchemaFields(schema.ValueFields, value)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "DBPrefixSchema.DecodeValue: Problem decoding value under prefix %v",
+			schema.Name)
+	}
+	return nil, fieldValues, nil
+}
+
+func _decodeDBSchemaFields(fields []DBSchemaField, data []byte) ([]*DBSchemaFieldValue, error) {
+	var fieldValues []*DBSchemaFieldValue
+	rr := bytes.NewReader(data)
+	for ii, field := range fields {
+		start := len(data) - rr.Len()
+		switch field.Type {
+		case DBSchemaFieldTypeUvarint:
+			if _, err := ReadUvarint(rr); err != nil {
+				return nil, errors.Wrapf(err, "Problem reading %v", field.Name)
+			}
+		case DBSchemaFieldTypeByteArray:
+			if _, err := DecodeByteArray(rr); err != nil {
+				return nil, errors.Wrapf(err, "Problem reading %v", field.Name)
+			}
+		case DBSchemaFieldTypeFixedWidthUint256:
+			if _, err := FixedWidthDecodeUint256(rr); err != nil {
+				return nil, errors.Wrapf(err, "Problem reading %v", field.Name)
+			}
+		case DBSchemaFieldTypeVariableUint256:
+			if _, err := VariableDecodeUint256(rr); err != nil {
+				return nil, errors.Wrapf(err, "Problem reading %v", field.Name)
+			}
+		case DBSchemaFieldTypeNullTerminatedBytes:
+			end := bytes.IndexByte(data[start:], AssociationNullTerminator)
+			if end < 0 {
+				return nil, fmt.Errorf("Field %v isn't null-terminated", field.Name)
+			}
+			rr.Seek(int64(start+end+1), io.SeekStart)
+		case DBSchemaFieldTypeShortByteArray:
+			length, err := rr.ReadByte()
+			if err != nil || rr.Len() < int(length) {
+				return nil, fmt.Errorf("Field %v is too short", field.Name)
+			}
+			rr.Seek(int64(length), io.SeekCurrent)
+		default:
+			size := field.size()
+			if size == 0 {
+				// A variable-length field takes whatever the fixed-size fields after it don't.
+				for _, nextField := range fields[ii+1:] {
+					if nextField.size() == 0 {
+						return nil, fmt.Errorf("Field %v is followed by the variable-length field %v",
+							field.Name, nextField.Name)
+					}
+					size -= nextField.size()
+				}
+				size += rr.Len()
+			}
+			if size < 0 || rr.Len() < size {
+				return nil, fmt.Errorf("Field %v is too short", field.Name)
+			}
+			rr.Seek(int64(size), io.SeekCurrent)
+		}
+		fieldValues = append(fieldValues, &DBSchemaFieldValue{
+			Field: field,
+			Bytes: data[start : len(data)-rr.Len()],
+		})
+	}
+	if rr.Len() > 0 {
+		return nil, fmt.Errorf("%d bytes are left over after the last field", rr.Len())
+	}
+	return fieldValues, nil
+}
+
+// dbPrefixSchemaLayout is the layout of a prefix in dbPrefixSchemaLayouts. The valueEncoder is an instance of the
+// DeSoEncoder stored in the prefix's values, if there is one.
+type dbPrefixSchemaLayout struct {
+	keyFields    []DBSchemaField
+	valueEncoder DeSoEncoder
+	valueFields  []DBSchemaField
+	description  string
+}
+
+// The fields that appear under many prefixes.
+var (
+	dbSchemaBlockHash      = DBSchemaField{Name: "BlockHash", Type: DBSchemaFieldTypeBlockHash}
+	dbSchemaTxnHash        = DBSchemaField{Name: "TxnHash", Type: DBSchemaFieldTypeBlockHash}
+	dbSchemaPostHash       = DBSchemaField{Name: "PostHash", Type: DBSchemaFieldTypeBlockHash}
+	dbSchemaPublicKey      = DBSchemaField{Name: "PublicKey", Type: DBSchemaFieldTypePublicKey}
+	dbSchemaPKID           = DBSchemaField{Name: "PKID", Type: DBSchemaFieldTypePKID}
+	dbSchemaBlockHeight    = DBSchemaField{Name: "BlockHeight", Type: DBSchemaFieldTypeUint64}
+	dbSchemaEpochNumber    = DBSchemaField{Name: "EpochNumber", Type: DBSchemaFieldTypeUint64}
+	dbSchemaSnapshotEpoch  = DBSchemaField{Name: "SnapshotAtEpochNumber", Type: DBSchemaFieldTypeUint64}
+	dbSchemaSerialNumber   = DBSchemaField{Name: "SerialNumber", Type: DBSchemaFieldTypeUint64}
+	dbSchemaValidatorPKID  = DBSchemaField{Name: "ValidatorPKID", Type: DBSchemaFieldTypePKID}
+	dbSchemaStakerPKID     = DBSchemaField{Name: "StakerPKID", Type: DBSchemaFieldTypePKID}
+	dbSchemaHODLerPKID     = DBSchemaField{Name: "HODLerPKID", Type: DBSchemaFieldTypePKID}
+	dbSchemaCreatorPKID    = DBSchemaField{Name: "CreatorPKID", Type: DBSchemaFieldTypePKID}
+	dbSchemaTransactorPKID = DBSchemaField{Name: "TransactorPKID", Type: DBSchemaFieldTypePKID}
+	dbSchemaAppPKID        = DBSchemaField{Name: "AppPKID", Type: DBSchemaFieldTypePKID}
+	dbSchemaGroupOwnerPK   = DBSchemaField{Name: "AccessGroupOwnerPublicKey", Type: DBSchemaFieldTypePublicKey}
+	dbSchemaGroupKeyName   = DBSchemaField{Name: "AccessGroupKeyName", Type: DBSchemaFieldTypeGroupKeyName}
+	dbSchemaAssocType      = DBSchemaField{Name: "AssociationType", Type: DBSchemaFieldTypeNullTerminatedBytes}
+	dbSchemaAssocValue     = DBSchemaField{Name: "AssociationValue", Type: DBSchemaFieldTypeNullTerminatedBytes}
+	dbSchemaAssociationID  = DBSchemaField{Name: "AssociationID", Type: DBSchemaFieldTypeBlockHash}
+	dbSchemaOrderID        = DBSchemaField{Name: "OrderID", Type: DBSchemaFieldTypeBlockHash}
+	dbSchemaStakeAmount    = DBSchemaField{Name: "TotalStakeAmountNanos", Type: DBSchemaFieldTypeFixedWidthUint256}
+	dbSchemaUint64Value    = DBSchemaField{Name: "Value", Type: DBSchemaFieldTypeUint64}
+	dbSchemaBLSPublicKey   = DBSchemaField{Name: "BLSPublicKey", Type: DBSchemaFieldTypeBytes}
+)
+
+// dbSchemaFields is shorthand for the fields of a layout.
+func dbSchemaFields(fields ...DBSchemaField) []DBSchemaField {
+	return fields
+}
+
+// dbSchemaNamed returns a copy of the field with another name.
+func dbSchemaNamed(name string, field DBSchemaField) DBSchemaField {
+	field.Name = name
+	return field
+}
+
+// dbPrefixSchemaLayouts maps the name of each field in DBPrefixes to the layout of its keys and values. The
+// layouts follow the key functions of each prefix, which take precedence over the comments in DBPrefixes.
+var dbPrefixSchemaLayouts = map[string]dbPrefixSchemaLayout{
+	"PrefixBlockHashToBlock": {
+		keyFields:   dbSchemaFields(dbSchemaBlockHash),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "MsgDeSoBlock", Type: DBSchemaFieldTypeSerialized}),
+	},
+	"PrefixHeightHashToNodeInfo": {
+		keyFields:   dbSchemaFields(DBSchemaField{Name: "Height", Type: DBSchemaFieldTypeUint32}, dbSchemaBlockHash),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "BlockNode", Type: DBSchemaFieldTypeSerialized}),
+		description: "The value is encoded with SerializeBlockNode.",
+	},
+	"PrefixBitcoinHeightHashToNodeInfo": {
+		keyFields:   dbSchemaFields(DBSchemaField{Name: "Height", Type: DBSchemaFieldTypeUint32}, dbSchemaBlockHash),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "BlockNode", Type: DBSchemaFieldTypeSerialized}),
+		description: "The value is encoded with SerializeBlockNode.",
+	},
+	"PrefixBestDeSoBlockHash": {
+		valueFields: dbSchemaFields(dbSchemaBlockHash),
+	},
+	"PrefixBestBitcoinHeaderHash": {
+		valueFields: dbSchemaFields(dbSchemaBlockHash),
+	},
+	"PrefixUtxoKeyToUtxoEntry": {
+		keyFields:    dbSchemaFields(dbSchemaNamed("TxID", dbSchemaBlockHash), DBSchemaField{Name: "Index", Type: DBSchemaFieldTypeUint32}),
+		valueEncoder: &UtxoEntry{},
+	},
+	"PrefixPubKeyUtxoKey": {
+		keyFields: dbSchemaFields(dbSchemaPublicKey, dbSchemaNamed("TxID", dbSchemaBlockHash),
+			DBSchemaField{Name: "Index", Type: DBSchemaFieldTypeUint32}),
+	},
+	"PrefixUtxoNumEntries": {
+		valueFields: dbSchemaFields(dbSchemaNamed("NumEntries", dbSchemaUint64Value)),
+	},
+	"PrefixBlockHashToUtxoOperations": {
+		keyFields:    dbSchemaFields(dbSchemaBlockHash),
+		valueEncoder: &UtxoOperationBundle{},
+	},
+	"PrefixNanosPurchased": {
+		valueFields: dbSchemaFields(dbSchemaNamed("NanosPurchased", dbSchemaUint64Value)),
+	},
+	"PrefixUSDCentsPerBitcoinExchangeRate": {
+		valueFields: dbSchemaFields(dbSchemaNamed("USDCentsPerBitcoin", dbSchemaUint64Value)),
+	},
+	"PrefixGlobalParams": {
+		valueEncoder: &GlobalParamsEntry{},
+	},
+	"PrefixBitcoinBurnTxIDs": {
+		keyFields: dbSchemaFields(dbSchemaNamed("BitcoinTxID", dbSchemaBlockHash)),
+	},
+	"PrefixPublicKeyTimestampToPrivateMessage": {
+		keyFields:    dbSchemaFields(dbSchemaPublicKey, DBSchemaField{Name: "TstampNanos", Type: DBSchemaFieldTypeUint64}),
+		valueEncoder: &MessageEntry{},
+	},
+	"PrefixTransactionIndexTip": {
+		valueFields: dbSchemaFields(dbSchemaBlockHash),
+	},
+	"PrefixTransactionIDToMetadata": {
+		keyFields:    dbSchemaFields(dbSchemaTxnHash),
+		valueEncoder: &TransactionMetadata{},
+	},
+	"PrefixPublicKeyIndexToTransactionIDs": {
+		keyFields:   dbSchemaFields(dbSchemaPublicKey, DBSchemaField{Name: "Index", Type: DBSchemaFieldTypeUint32}),
+		valueFields: dbSchemaFields(dbSchemaTxnHash),
+	},
+	"PrefixPublicKeyToNextIndex": {
+		keyFields:   dbSchemaFields(dbSchemaPublicKey),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "NextIndex", Type: DBSchemaFieldTypeUvarint}),
+	},
+	"PrefixPostHashToPostEntry": {
+		keyFields:    dbSchemaFields(dbSchemaPostHash),
+		valueEncoder: &PostEntry{},
+	},
+	"PrefixPosterPublicKeyPostHash": {
+		keyFields: dbSchemaFields(dbSchemaNamed("PosterPublicKey", dbSchemaPublicKey), dbSchemaPostHash),
+	},
+	"PrefixTstampNanosPostHash": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "TstampNanos", Type: DBSchemaFieldTypeUint64}, dbSchemaPostHash),
+	},
+	"PrefixCreatorBpsPostHash": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "CreatorBasisPoints", Type: DBSchemaFieldTypeUint64}, dbSchemaPostHash),
+	},
+	"PrefixMultipleBpsPostHash": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "StakeMultipleBasisPoints", Type: DBSchemaFieldTypeUint64}, dbSchemaPostHash),
+	},
+	"PrefixCommentParentStakeIDToPostHash": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "ParentStakeID", Type: DBSchemaFieldTypeBytes},
+			DBSchemaField{Name: "TstampNanos", Type: DBSchemaFieldTypeUint64}, dbSchemaPostHash),
+	},
+	"PrefixPKIDToProfileEntry": {
+		keyFields:    dbSchemaFields(dbSchemaPKID),
+		valueEncoder: &ProfileEntry{},
+	},
+	"PrefixProfileUsernameToPKID": {
+		keyFields:   dbSchemaFields(DBSchemaField{Name: "LowercaseUsername", Type: DBSchemaFieldTypeBytes}),
+		valueFields: dbSchemaFields(dbSchemaPKID),
+	},
+	"PrefixCreatorDeSoLockedNanosCreatorPKID": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "DeSoLockedNanos", Type: DBSchemaFieldTypeUint64}, dbSchemaCreatorPKID),
+	},
+	"PrefixStakeIDTypeAmountStakeIDIndex": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "StakeIDType", Type: DBSchemaFieldTypeUint8},
+			DBSchemaField{Name: "AmountNanos", Type: DBSchemaFieldTypeUint64},
+			DBSchemaField{Name: "StakeID", Type: DBSchemaFieldTypeBytes}),
+		description: "Unused. No entries are written under this prefix.",
+	},
+	"PrefixFollowerPKIDToFollowedPKID": {
+		keyFields: dbSchemaFields(dbSchemaNamed("FollowerPKID", dbSchemaPKID), dbSchemaNamed("FollowedPKID", dbSchemaPKID)),
+	},
+	"PrefixFollowedPKIDToFollowerPKID": {
+		keyFields: dbSchemaFields(dbSchemaNamed("FollowedPKID", dbSchemaPKID), dbSchemaNamed("FollowerPKID", dbSchemaPKID)),
+	},
+	"PrefixLikerPubKeyToLikedPostHash": {
+		keyFields: dbSchemaFields(dbSchemaNamed("LikerPublicKey", dbSchemaPublicKey), dbSchemaNamed("LikedPostHash", dbSchemaPostHash)),
+	},
+	"PrefixLikedPostHashToLikerPubKey": {
+		keyFields: dbSchemaFields(dbSchemaNamed("LikedPostHash", dbSchemaPostHash), dbSchemaNamed("LikerPublicKey", dbSchemaPublicKey)),
+	},
+	"PrefixHODLerPKIDCreatorPKIDToBalanceEntry": {
+		keyFields:    dbSchemaFields(dbSchemaHODLerPKID, dbSchemaCreatorPKID),
+		valueEncoder: &BalanceEntry{},
+	},
+	"PrefixCreatorPKIDHODLerPKIDToBalanceEntry": {
+		keyFields:    dbSchemaFields(dbSchemaCreatorPKID, dbSchemaHODLerPKID),
+		valueEncoder: &BalanceEntry{},
+	},
+	"PrefixPosterPublicKeyTimestampPostHash": {
+		keyFields: dbSchemaFields(dbSchemaNamed("PosterPublicKey", dbSchemaPublicKey),
+			DBSchemaField{Name: "TstampNanos", Type: DBSchemaFieldTypeUint64}, dbSchemaPostHash),
+	},
+	"PrefixPublicKeyToPKID": {
+		keyFields:    dbSchemaFields(dbSchemaPublicKey),
+		valueEncoder: &PKIDEntry{},
+	},
+	"PrefixPKIDToPublicKey": {
+		keyFields:   dbSchemaFields(dbSchemaPKID),
+		valueFields: dbSchemaFields(dbSchemaPublicKey),
+	},
+	"PrefixMempoolTxnHashToMsgDeSoTxn": {
+		keyFields:   dbSchemaFields(DBSchemaField{Name: "TimeAddedUnixNanos", Type: DBSchemaFieldTypeUint64}, dbSchemaTxnHash),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "MsgDeSoTxn", Type: DBSchemaFieldTypeSerialized}),
+	},
+	"PrefixReposterPubKeyRepostedPostHashToRepostPostHash": {
+		keyFields: dbSchemaFields(dbSchemaNamed("ReposterPublicKey", dbSchemaPublicKey),
+			dbSchemaNamed("RepostedPostHash", dbSchemaPostHash), dbSchemaNamed("RepostPostHash", dbSchemaPostHash)),
+	},
+	"PrefixDiamondReceiverPKIDDiamondSenderPKIDPostHash": {
+		keyFields: dbSchemaFields(dbSchemaNamed("ReceiverPKID", dbSchemaPKID), dbSchemaNamed("SenderPKID", dbSchemaPKID),
+			dbSchemaNamed("DiamondPostHash", dbSchemaPostHash)),
+		valueEncoder: &DiamondEntry{},
+	},
+	"PrefixDiamondSenderPKIDDiamondReceiverPKIDPostHash": {
+		keyFields: dbSchemaFields(dbSchemaNamed("SenderPKID", dbSchemaPKID), dbSchemaNamed("ReceiverPKID", dbSchemaPKID),
+			dbSchemaNamed("DiamondPostHash", dbSchemaPostHash)),
+		valueEncoder: &DiamondEntry{},
+	},
+	"PrefixForbiddenBlockSignaturePubKeys": {
+		keyFields: dbSchemaFields(dbSchemaPublicKey),
+	},
+	"PrefixRepostedPostHashReposterPubKey": {
+		keyFields: dbSchemaFields(dbSchemaNamed("RepostedPostHash", dbSchemaPostHash), dbSchemaNamed("ReposterPublicKey", dbSchemaPublicKey)),
+	},
+	"PrefixRepostedPostHashReposterPubKeyRepostPostHash": {
+		keyFields: dbSchemaFields(dbSchemaNamed("RepostedPostHash", dbSchemaPostHash),
+			dbSchemaNamed("ReposterPublicKey", dbSchemaPublicKey), dbSchemaNamed("RepostPostHash", dbSchemaPostHash)),
+	},
+	"PrefixDiamondedPostHashDiamonderPKIDDiamondLevel": {
+		keyFields: dbSchemaFields(dbSchemaNamed("DiamondPostHash", dbSchemaPostHash), dbSchemaNamed("SenderPKID", dbSchemaPKID),
+			DBSchemaField{Name: "DiamondLevel", Type: DBSchemaFieldTypeUint64}),
+	},
+	"PrefixPostHashSerialNumberToNFTEntry": {
+		keyFields:    dbSchemaFields(dbSchemaNamed("NFTPostHash", dbSchemaPostHash), dbSchemaSerialNumber),
+		valueEncoder: &NFTEntry{},
+	},
+	"PrefixPKIDIsForSaleBidAmountNanosPostHashSerialNumberToNFTEntry": {
+		keyFields: dbSchemaFields(dbSchemaNamed("OwnerPKID", dbSchemaPKID), DBSchemaField{Name: "IsForSale", Type: DBSchemaFieldTypeBool},
+			DBSchemaField{Name: "BidAmountNanos", Type: DBSchemaFieldTypeUint64}, dbSchemaNamed("NFTPostHash", dbSchemaPostHash),
+			dbSchemaSerialNumber),
+		valueEncoder: &NFTEntry{},
+	},
+	"PrefixPostHashSerialNumberBidNanosBidderPKID": {
+		keyFields: dbSchemaFields(dbSchemaNamed("NFTPostHash", dbSchemaPostHash), dbSchemaSerialNumber,
+			DBSchemaField{Name: "BidAmountNanos", Type: DBSchemaFieldTypeUint64}, dbSchemaNamed("BidderPKID", dbSchemaPKID)),
+	},
+	"PrefixBidderPKIDPostHashSerialNumberToBidNanos": {
+		keyFields: dbSchemaFields(dbSchemaNamed("BidderPKID", dbSchemaPKID), dbSchemaNamed("NFTPostHash", dbSchemaPostHash),
+			dbSchemaSerialNumber),
+		valueFields: dbSchemaFields(dbSchemaNamed("BidAmountNanos", dbSchemaUint64Value)),
+	},
+	"PrefixPublicKeyToDeSoBalanceNanos": {
+		keyFields:   dbSchemaFields(dbSchemaPublicKey),
+		valueFields: dbSchemaFields(dbSchemaNamed("BalanceNanos", dbSchemaUint64Value)),
+	},
+	"PrefixPublicKeyBlockHashToBlockReward": {
+		keyFields:   dbSchemaFields(dbSchemaPublicKey, dbSchemaBlockHash),
+		valueFields: dbSchemaFields(dbSchemaNamed("BlockRewardNanos", dbSchemaUint64Value)),
+		description: "Deprecated as of the PoS cut-over, since block rewards no longer need to mature.",
+	},
+	"PrefixPostHashSerialNumberToAcceptedBidEntries": {
+		keyFields:    dbSchemaFields(dbSchemaNamed("NFTPostHash", dbSchemaPostHash), dbSchemaSerialNumber),
+		valueEncoder: &NFTBidEntryBundle{},
+	},
+	"PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry": {
+		keyFields:    dbSchemaFields(dbSchemaHODLerPKID, dbSchemaCreatorPKID),
+		valueEncoder: &BalanceEntry{},
+	},
+	"PrefixCreatorPKIDHODLerPKIDToDAOCoinBalanceEntry": {
+		keyFields:    dbSchemaFields(dbSchemaCreatorPKID, dbSchemaHODLerPKID),
+		valueEncoder: &BalanceEntry{},
+	},
+	"PrefixMessagingGroupEntriesByOwnerPubKeyAndGroupKeyName": {
+		keyFields:    dbSchemaFields(dbSchemaNamed("OwnerPublicKey", dbSchemaPublicKey), dbSchemaNamed("GroupKeyName", dbSchemaGroupKeyName)),
+		valueEncoder: &MessagingGroupEntry{},
+	},
+	"PrefixMessagingGroupMetadataByMemberPubKeyAndGroupMessagingPubKey": {
+		keyFields: dbSchemaFields(dbSchemaNamed("MemberPublicKey", dbSchemaPublicKey),
+			dbSchemaNamed("GroupMessagingPublicKey", dbSchemaPublicKey)),
+		valueEncoder: &MessagingGroupEntry{},
+	},
+	"PrefixAuthorizeDerivedKey": {
+		keyFields:    dbSchemaFields(dbSchemaNamed("OwnerPublicKey", dbSchemaPublicKey), dbSchemaNamed("DerivedPublicKey", dbSchemaPublicKey)),
+		valueEncoder: &DerivedKeyEntry{},
+	},
+	"PrefixDAOCoinLimitOrder": {
+		keyFields: dbSchemaFields(dbSchemaNamed("BuyingDAOCoinCreatorPKID", dbSchemaPKID),
+			dbSchemaNamed("SellingDAOCoinCreatorPKID", dbSchemaPKID),
+			DBSchemaField{Name: "ScaledExchangeRateCoinsToSellPerCoinToBuy", Type: DBSchemaFieldTypeVariableUint256},
+			DBSchemaField{Name: "MaxUint32MinusBlockHeight", Type: DBSchemaFieldTypeUint32}, dbSchemaOrderID),
+		valueEncoder: &DAOCoinLimitOrderEntry{},
+	},
+	"PrefixDAOCoinLimitOrderByTransactorPKID": {
+		keyFields: dbSchemaFields(dbSchemaTransactorPKID, dbSchemaNamed("BuyingDAOCoinCreatorPKID", dbSchemaPKID),
+			dbSchemaNamed("SellingDAOCoinCreatorPKID", dbSchemaPKID), dbSchemaOrderID),
+		valueEncoder: &DAOCoinLimitOrderEntry{},
+	},
+	"PrefixDAOCoinLimitOrderByOrderID": {
+		keyFields:    dbSchemaFields(dbSchemaOrderID),
+		valueEncoder: &DAOCoinLimitOrderEntry{},
+	},
+	"PrefixUserAssociationByID": {
+		keyFields:    dbSchemaFields(dbSchemaAssociationID),
+		valueEncoder: &UserAssociationEntry{},
+	},
+	"PrefixUserAssociationByTransactor": {
+		keyFields: dbSchemaFields(dbSchemaTransactorPKID, dbSchemaAssocType, dbSchemaAssocValue,
+			dbSchemaNamed("TargetUserPKID", dbSchemaPKID), dbSchemaAppPKID),
+		valueEncoder: &BlockHash{},
+	},
+	"PrefixUserAssociationByTargetUser": {
+		keyFields: dbSchemaFields(dbSchemaNamed("TargetUserPKID", dbSchemaPKID), dbSchemaAssocType, dbSchemaAssocValue,
+			dbSchemaTransactorPKID, dbSchemaAppPKID),
+		valueEncoder: &BlockHash{},
+	},
+	"PrefixUserAssociationByUsers": {
+		keyFields: dbSchemaFields(dbSchemaTransactorPKID, dbSchemaNamed("TargetUserPKID", dbSchemaPKID), dbSchemaAssocType,
+			dbSchemaAssocValue, dbSchemaAppPKID),
+		valueEncoder: &BlockHash{},
+	},
+	"PrefixPostAssociationByID": {
+		keyFields:    dbSchemaFields(dbSchemaAssociationID),
+		valueEncoder: &PostAssociationEntry{},
+	},
+	"PrefixPostAssociationByTransactor": {
+		keyFields: dbSchemaFields(dbSchemaTransactorPKID, dbSchemaAssocType, dbSchemaAssocValue, dbSchemaPostHash,
+			dbSchemaAppPKID),
+		valueEncoder: &BlockHash{},
+	},
+	"PrefixPostAssociationByPost": {
+		keyFields: dbSchemaFields(dbSchemaPostHash, dbSchemaAssocType, dbSchemaAssocValue, dbSchemaTransactorPKID,
+			dbSchemaAppPKID),
+		valueEncoder: &BlockHash{},
+	},
+	"PrefixPostAssociationByType": {
+		keyFields: dbSchemaFields(dbSchemaAssocType, dbSchemaAssocValue, dbSchemaPostHash, dbSchemaTransactorPKID,
+			dbSchemaAppPKID),
+		valueEncoder: &BlockHash{},
+	},
+	"PrefixAccessGroupEntriesByAccessGroupId": {
+		keyFields:    dbSchemaFields(dbSchemaGroupOwnerPK, dbSchemaGroupKeyName),
+		valueEncoder: &AccessGroupEntry{},
+	},
+	"PrefixAccessGroupMembershipIndex": {
+		keyFields: dbSchemaFields(dbSchemaNamed("AccessGroupMemberPublicKey", dbSchemaPublicKey), dbSchemaGroupOwnerPK,
+			dbSchemaGroupKeyName),
+		valueEncoder: &AccessGroupMemberEntry{},
+	},
+	"PrefixAccessGroupMemberEnumerationIndex": {
+		keyFields: dbSchemaFields(dbSchemaGroupOwnerPK, dbSchemaGroupKeyName,
+			dbSchemaNamed("AccessGroupMemberPublicKey", dbSchemaPublicKey)),
+		valueEncoder: &AccessGroupMemberEnumerationEntry{},
+	},
+	"PrefixGroupChatMessagesIndex": {
+		keyFields: dbSchemaFields(dbSchemaGroupOwnerPK, dbSchemaGroupKeyName,
+			DBSchemaField{Name: "TimestampNanos", Type: DBSchemaFieldTypeUint64}),
+		valueEncoder: &NewMessageEntry{},
+	},
+	"PrefixDmMessagesIndex": {
+		keyFields: dbSchemaFields(dbSchemaNamed("MinorAccessGroupOwnerPublicKey", dbSchemaGroupOwnerPK),
+			dbSchemaNamed("MinorAccessGroupKeyName", dbSchemaGroupKeyName),
+			dbSchemaNamed("MajorAccessGroupOwnerPublicKey", dbSchemaGroupOwnerPK),
+			dbSchemaNamed("MajorAccessGroupKeyName", dbSchemaGroupKeyName),
+			DBSchemaField{Name: "TimestampNanos", Type: DBSchemaFieldTypeUint64}),
+		valueEncoder: &NewMessageEntry{},
+	},
+	"PrefixDmThreadIndex": {
+		keyFields: dbSchemaFields(dbSchemaNamed("UserAccessGroupOwnerPublicKey", dbSchemaGroupOwnerPK),
+			dbSchemaNamed("UserAccessGroupKeyName", dbSchemaGroupKeyName),
+			dbSchemaNamed("PartyAccessGroupOwnerPublicKey", dbSchemaGroupOwnerPK),
+			dbSchemaNamed("PartyAccessGroupKeyName", dbSchemaGroupKeyName)),
+		valueEncoder: &DmThreadEntry{},
+	},
+	"PrefixNoncePKIDIndex": {
+		keyFields: dbSchemaFields(dbSchemaNamed("ExpirationBlockHeight", dbSchemaBlockHeight), dbSchemaPKID,
+			DBSchemaField{Name: "PartialID", Type: DBSchemaFieldTypeUint64}),
+	},
+	"PrefixTxnHashToTxn": {
+		keyFields:    dbSchemaFields(dbSchemaTxnHash),
+		valueEncoder: &MsgDeSoTxn{},
+		description:  "Only emitted to the state syncer for mempool txns. No entries are written to the DB.",
+	},
+	"PrefixTxnHashToUtxoOps": {
+		keyFields:    dbSchemaFields(dbSchemaTxnHash),
+		valueEncoder: &UtxoOperationBundle{},
+		description:  "Only emitted to the state syncer for mempool txns. No entries are written to the DB.",
+	},
+	"PrefixValidatorByPKID": {
+		keyFields:    dbSchemaFields(dbSchemaValidatorPKID),
+		valueEncoder: &ValidatorEntry{},
+	},
+	"PrefixValidatorByStatusAndStakeAmount": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "Status", Type: DBSchemaFieldTypeUint8}, dbSchemaStakeAmount,
+			dbSchemaValidatorPKID),
+	},
+	"PrefixStakeByValidatorAndStaker": {
+		keyFields:    dbSchemaFields(dbSchemaValidatorPKID, dbSchemaStakerPKID),
+		valueEncoder: &StakeEntry{},
+	},
+	"PrefixStakeByStakeAmount": {
+		keyFields: dbSchemaFields(dbSchemaNamed("StakeAmountNanos", dbSchemaStakeAmount), dbSchemaValidatorPKID,
+			dbSchemaStakerPKID),
+	},
+	"PrefixLockedStakeByValidatorAndStakerAndLockedAt": {
+		keyFields: dbSchemaFields(dbSchemaValidatorPKID, dbSchemaStakerPKID,
+			dbSchemaNamed("LockedAtEpochNumber", dbSchemaEpochNumber)),
+		valueEncoder: &LockedStakeEntry{},
+	},
+	"PrefixCurrentEpoch": {
+		valueEncoder: &EpochEntry{},
+	},
+	"PrefixCurrentRandomSeedHash": {
+		valueFields: dbSchemaFields(DBSchemaField{Name: "RandomSeedHash", Type: DBSchemaFieldTypeBytes, Length: 32}),
+	},
+	"PrefixSnapshotGlobalParamsEntry": {
+		keyFields:    dbSchemaFields(dbSchemaSnapshotEpoch),
+		valueEncoder: &GlobalParamsEntry{},
+	},
+	"PrefixSnapshotValidatorSetByPKID": {
+		keyFields:    dbSchemaFields(dbSchemaSnapshotEpoch, dbSchemaValidatorPKID),
+		valueEncoder: &ValidatorEntry{},
+	},
+	"PrefixSnapshotValidatorSetByStakeAmount": {
+		keyFields: dbSchemaFields(dbSchemaSnapshotEpoch, dbSchemaStakeAmount, dbSchemaValidatorPKID),
+	},
+	"PrefixSnapshotLeaderSchedule": {
+		keyFields:    dbSchemaFields(dbSchemaSnapshotEpoch, DBSchemaField{Name: "LeaderIndex", Type: DBSchemaFieldTypeUint16}),
+		valueEncoder: &PKID{},
+	},
+	"PrefixSnapshotStakeToRewardByValidatorAndStaker": {
+		keyFields:    dbSchemaFields(dbSchemaSnapshotEpoch, dbSchemaValidatorPKID, dbSchemaStakerPKID),
+		valueEncoder: &StakeEntry{},
+	},
+	"PrefixLockedBalanceEntry": {
+		keyFields: dbSchemaFields(dbSchemaHODLerPKID, dbSchemaNamed("ProfilePKID", dbSchemaPKID),
+			DBSchemaField{Name: "VestedLockedBalanceEntriesKeyByte", Type: DBSchemaFieldTypeUint8},
+			DBSchemaField{Name: "UnlockTimestampNanoSecs", Type: DBSchemaFieldTypeUint64},
+			DBSchemaField{Name: "VestingEndTimestampNanoSecs", Type: DBSchemaFieldTypeUint64}),
+		valueEncoder: &LockedBalanceEntry{},
+	},
+	"PrefixLockupYieldCurvePointByProfilePKIDAndDurationNanoSecs": {
+		keyFields: dbSchemaFields(dbSchemaNamed("ProfilePKID", dbSchemaPKID),
+			DBSchemaField{Name: "LockupDurationNanoSecs", Type: DBSchemaFieldTypeUint64}),
+		valueEncoder: &LockupYieldCurvePoint{},
+	},
+	"PrefixValidatorBLSPublicKeyPKIDPairEntry": {
+		keyFields:    dbSchemaFields(dbSchemaBLSPublicKey),
+		valueEncoder: &BLSPublicKeyPKIDPairEntry{},
+	},
+	"PrefixSnapshotValidatorBLSPublicKeyPKIDPairEntry": {
+		keyFields:    dbSchemaFields(dbSchemaSnapshotEpoch, dbSchemaBLSPublicKey),
+		valueEncoder: &BLSPublicKeyPKIDPairEntry{},
+	},
+	"PrefixHypersyncSnapshotDBPrefix": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "SnapshotPrefix", Type: DBSchemaFieldTypeUint8},
+			DBSchemaField{Name: "SnapshotKey", Type: DBSchemaFieldTypeBytes}),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "SnapshotValue", Type: DBSchemaFieldTypeBytes}),
+		description: "Holds the hypersync snapshot's own prefixes, which are listed at the top of snapshot.go.",
+	},
+	"PrefixReplicationCursor": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "Role", Type: DBSchemaFieldTypeBytes}),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "SessionId", Type: DBSchemaFieldTypeBytes, Length: 16},
+			DBSchemaField{Name: "NextSequence", Type: DBSchemaFieldTypeUint64}),
+		description: `The role is either "primary" or "replica".`,
+	},
+	"PrefixTxnHashToTxnReceipt": {
+		keyFields:    dbSchemaFields(dbSchemaTxnHash),
+		valueEncoder: &TxnReceipt{},
+	},
+	"PrefixStakingRewardStatementByStakerEpochValidator": {
+		keyFields:    dbSchemaFields(dbSchemaStakerPKID, dbSchemaEpochNumber, dbSchemaValidatorPKID),
+		valueEncoder: &StakingRewardStatementEntry{},
+	},
+	"PrefixStakingRewardStatementByEpochValidatorStaker": {
+		keyFields:    dbSchemaFields(dbSchemaEpochNumber, dbSchemaValidatorPKID, dbSchemaStakerPKID),
+		valueEncoder: &StakingRewardStatementEntry{},
+	},
+	"PrefixStateCommitmentNode": {
+		keyFields: dbSchemaFields(dbSchemaNamed("NodeHash", dbSchemaBlockHash)),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "NodeType", Type: DBSchemaFieldTypeUint8},
+			dbSchemaNamed("LeftOrKeyHash", dbSchemaBlockHash), dbSchemaNamed("RightOrValueHash", dbSchemaBlockHash)),
+	},
+	"PrefixStateCommitmentRoot": {
+		valueFields: dbSchemaFields(dbSchemaNamed("StateRoot", dbSchemaBlockHash)),
+	},
+	"PrefixStateCommitmentRootByBlockHash": {
+		keyFields:   dbSchemaFields(dbSchemaBlockHash),
+		valueFields: dbSchemaFields(dbSchemaNamed("StateRoot", dbSchemaBlockHash)),
+	},
+	"PrefixPKIDToFollowCounts": {
+		keyFields: dbSchemaFields(dbSchemaPKID),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "FollowerCount", Type: DBSchemaFieldTypeUvarint},
+			DBSchemaField{Name: "FollowingCount", Type: DBSchemaFieldTypeUvarint}),
+		description: "The bare prefix is set, with an empty value, once the counts have been built.",
+	},
+	"PrefixKeyValueRecordByOwnerPKIDAndKey": {
+		keyFields:    dbSchemaFields(dbSchemaNamed("OwnerPKID", dbSchemaPKID), DBSchemaField{Name: "Key", Type: DBSchemaFieldTypeBytes}),
+		valueEncoder: &KeyValueRecordEntry{},
+	},
+	"PrefixUsernameHistoryByUsernameAndHeight": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "LowercaseUsername", Type: DBSchemaFieldTypeByteArray},
+			dbSchemaBlockHeight),
+		valueFields: dbSchemaFields(dbSchemaPKID),
+		description: "The value is empty if the username was released.",
+	},
+	"PrefixUsernameHistoryByHeightAndUsername": {
+		keyFields: dbSchemaFields(dbSchemaBlockHeight,
+			DBSchemaField{Name: "LowercaseUsername", Type: DBSchemaFieldTypeByteArray}),
+	},
+	"PrefixTxindexDiamondsByReceiverLevelHeight": {
+		keyFields: dbSchemaFields(dbSchemaNamed("ReceiverPKID", dbSchemaPKID),
+			DBSchemaField{Name: "DiamondLevel", Type: DBSchemaFieldTypeUint64}, dbSchemaBlockHeight,
+			dbSchemaNamed("SenderPKID", dbSchemaPKID), dbSchemaNamed("DiamondPostHash", dbSchemaPostHash)),
+	},
+	"PrefixTxindexDiamondsBySenderHeight": {
+		keyFields: dbSchemaFields(dbSchemaNamed("SenderPKID", dbSchemaPKID), dbSchemaBlockHeight,
+			dbSchemaNamed("DiamondPostHash", dbSchemaPostHash)),
+		valueFields: dbSchemaFields(dbSchemaNamed("ReceiverPKID", dbSchemaPKID),
+			DBSchemaField{Name: "DiamondLevel", Type: DBSchemaFieldTypeUint64}),
+	},
+	"PrefixTxindexDiamondsByHeight": {
+		keyFields: dbSchemaFields(dbSchemaBlockHeight, dbSchemaNamed("SenderPKID", dbSchemaPKID),
+			dbSchemaNamed("DiamondPostHash", dbSchemaPostHash)),
+		valueFields: dbSchemaFields(dbSchemaNamed("ReceiverPKID", dbSchemaPKID),
+			DBSchemaField{Name: "DiamondLevel", Type: DBSchemaFieldTypeUint64},
+			DBSchemaField{Name: "PrevDiamondLevel", Type: DBSchemaFieldTypeUint64}),
+	},
+	"PrefixTxindexPostDiamondCounts": {
+		keyFields: dbSchemaFields(dbSchemaNamed("DiamondPostHash", dbSchemaPostHash),
+			DBSchemaField{Name: "DiamondLevel", Type: DBSchemaFieldTypeUint64}),
+		valueFields: dbSchemaFields(dbSchemaNamed("Count", dbSchemaUint64Value)),
+	},
+	"PrefixLockupVestingScheduleByHODLerPKIDProfilePKIDUnlockTimestamp": {
+		keyFields: dbSchemaFields(dbSchemaHODLerPKID, dbSchemaNamed("ProfilePKID", dbSchemaPKID),
+			DBSchemaField{Name: "UnlockTimestampNanoSecs", Type: DBSchemaFieldTypeUint64}),
+		valueEncoder: &LockupVestingScheduleEntry{},
+	},
+	"PrefixMessageReadStateByAccessGroupIdAndMember": {
+		keyFields: dbSchemaFields(dbSchemaGroupOwnerPK, dbSchemaGroupKeyName,
+			dbSchemaNamed("MemberPublicKey", dbSchemaPublicKey)),
+		valueEncoder: &MessageReadStateEntry{},
+	},
+	"PrefixValidatorPerformanceByValidatorEpoch": {
+		keyFields:    dbSchemaFields(dbSchemaValidatorPKID, dbSchemaEpochNumber),
+		valueEncoder: &ValidatorPerformanceEntry{},
+	},
+	"PrefixValidatorPerformanceByEpochValidator": {
+		keyFields:    dbSchemaFields(dbSchemaEpochNumber, dbSchemaValidatorPKID),
+		valueEncoder: &ValidatorPerformanceEntry{},
+	},
+	"PrefixSoftForkDeploymentStateByNameWindow": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "DeploymentName", Type: DBSchemaFieldTypeShortByteArray},
+			dbSchemaNamed("WindowStartBlockHeight", dbSchemaBlockHeight)),
+		valueEncoder: &SoftForkDeploymentStateEntry{},
+	},
+	"PrefixBlockHashToBlockSegmentLocation": {
+		keyFields:   dbSchemaFields(dbSchemaBlockHash),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "BlockSegmentLocation", Type: DBSchemaFieldTypeSerialized}),
+	},
+	"PrefixNFTAvatarByNFTAndProfilePKID": {
+		keyFields: dbSchemaFields(dbSchemaNamed("NFTPostHash", dbSchemaPostHash), dbSchemaSerialNumber,
+			dbSchemaNamed("ProfilePKID", dbSchemaPKID)),
+		valueEncoder: &NFTAvatarEntry{},
+	},
+	"PrefixBridgeEventAnchorByChainIDAndDepositHash": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "ChainID", Type: DBSchemaFieldTypeUint64},
+			DBSchemaField{Name: "DepositHash", Type: DBSchemaFieldTypeBytes}),
+		valueEncoder: &BridgeEventAnchorEntry{},
+	},
+	"PrefixPeerAccessListEntry": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "ListType", Type: DBSchemaFieldTypeUint8},
+			DBSchemaField{Name: "TargetType", Type: DBSchemaFieldTypeUint8}, DBSchemaField{Name: "Target", Type: DBSchemaFieldTypeBytes}),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "PeerAccessEntry", Type: DBSchemaFieldTypeSerialized}),
+	},
+	"PrefixTxnTypeBlockMetrics": {
+		keyFields:   dbSchemaFields(dbSchemaBlockHeight),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "BlockTxnTypeMetrics", Type: DBSchemaFieldTypeSerialized}),
+	},
+	"PrefixDAOCoinBalanceChangeByCreatorHODLerHeight": {
+		keyFields:    dbSchemaFields(dbSchemaCreatorPKID, dbSchemaHODLerPKID, dbSchemaBlockHeight),
+		valueEncoder: &DAOCoinBalanceChangeEntry{},
+	},
+	"PrefixPKIDSwapByPKIDHeightTxnHash": {
+		keyFields:    dbSchemaFields(dbSchemaPKID, dbSchemaBlockHeight, dbSchemaTxnHash),
+		valueEncoder: &PKIDSwapEntry{},
+	},
+	"PrefixDelegatedPosterByOwnerPKIDDelegatePKID": {
+		keyFields: dbSchemaFields(dbSchemaNamed("OwnerPKID", dbSchemaPKID),
+			dbSchemaNamed("DelegatePKID", dbSchemaPKID)),
+		valueEncoder: &DelegatedPosterEntry{},
+	},
+	"PrefixUndoDataPrunedBlockHeight": {
+		valueFields: dbSchemaFields(dbSchemaBlockHeight),
+	},
+	"PrefixValidatorVotingKeyRotationByPKID": {
+		keyFields: dbSchemaFields(dbSchemaValidatorPKID),
+	},
+	"PrefixAnchorHashByContentHashAnchorerPKID": {
+		keyFields: dbSchemaFields(DBSchemaField{Name: "ContentHash", Type: DBSchemaFieldTypeByteArray},
+			dbSchemaNamed("AnchorerPKID", dbSchemaPKID)),
+		valueEncoder: &AnchorHashEntry{},
+	},
+	"PrefixAnchorHashRateLimitByPKID": {
+		keyFields:    dbSchemaFields(dbSchemaNamed("AnchorerPKID", dbSchemaPKID)),
+		valueEncoder: &AnchorHashRateLimitEntry{},
+	},
+	"PrefixContentTombstoneByHeightTxnHash": {
+		keyFields:    dbSchemaFields(dbSchemaBlockHeight, dbSchemaTxnHash),
+		valueEncoder: &ContentTombstoneEntry{},
+	},
+	"PrefixBlockFeeSplitByHeight": {
+		keyFields:    dbSchemaFields(dbSchemaBlockHeight),
+		valueEncoder: &BlockFeeSplitEntry{},
+	},
+	"PrefixSubscriptionByRecipientPKIDSubscriberPKID": {
+		keyFields: dbSchemaFields(dbSchemaNamed("RecipientPKID", dbSchemaPKID),
+			dbSchemaNamed("SubscriberPKID", dbSchemaPKID)),
+		valueEncoder: &SubscriptionEntry{},
+	},
+	"PrefixPostAssociationCountsByPostTypeValue": {
+		keyFields:   dbSchemaFields(dbSchemaPostHash, dbSchemaAssocType, dbSchemaAssocValue),
+		valueFields: dbSchemaFields(DBSchemaField{Name: "Count", Type: DBSchemaFieldTypeUvarint}),
+		description: "The bare prefix is set, with an empty value, once the counts have been built.",
+	},
+	"PrefixGlobalParamsHistoryByHeight": {
+		keyFields:    dbSchemaFields(dbSchemaBlockHeight),
+		valueEncoder: &GlobalParamsHistoryEntry{},
+	},
+	"PrefixUtxoViewFlushInProgress": {
+		valueFields: dbSchemaFields(dbSchemaNamed("TipHash", dbSchemaBlockHash),
+			DBSchemaField{Name: "NumBatchesCommitted", Type: DBSchemaFieldTypeUint64},
+			DBSchemaField{Name: "NumBatches", Type: DBSchemaFieldTypeUint64}),
+	},
+}
+
+var (
+	dbSchema         []*DBPrefixSchema
+	dbSchemaByPrefix map[byte]*DBPrefixSchema
+	dbSchemaByName   map[string]*DBPrefixSchema
+)
+
+func init() {
+	dbSchemaByPrefix = make(map[byte]*DBPrefixSchema)
+	dbSchemaByName = make(map[string]*DBPrefixSchema)
+	prefixElements := reflect.ValueOf(Prefixes).Elem()
+	structFields := prefixElements.Type()
+	for ii := 0; ii < structFields.NumField(); ii++ {
+		structField := structFields.Field(ii)
+		layout, exists := dbPrefixSchemaLayouts[structField.Name]
+		if !exists {
+			panic(any(fmt.Errorf("%v has no layout in dbPrefixSchemaLayouts", structField.Name)))
+		}
+		schema := &DBPrefixSchema{
+			Name:        structField.Name,
+			Prefix:      prefixElements.Field(ii).Bytes()[0],
+			IsState:     structField.Tag.Get("is_state") == "true",
+			IsCoreState: structField.Tag.Get("core_state") == "true",
+			IsTxindex:   structField.Tag.Get("is_txindex") == "true",
+			KeyFields:   layout.keyFields,
+			ValueFields: layout.valueFields,
+			Description: layout.description,
+		}
+		if layout.valueEncoder != nil {
+			encoderType := layout.valueEncoder.GetEncoderType()
+			schema.ValueEncoderType = &encoderType
+			schema.ValueEncoderName = reflect.TypeOf(layout.valueEncoder).Elem().Name()
+		}
+		dbSchema = append(dbSchema, schema)
+		dbSchemaByPrefix[schema.Prefix] = schema
+		dbSchemaByName[schema.Name] = schema
+	}
+	if len(dbSchema) != len(dbPrefixSchemaLayouts) {
+		panic(any(fmt.Errorf("dbPrefixSchemaLayouts has layouts for prefixes that aren't in DBPrefixes")))
+	}
+	sort.Slice(dbSchema, func(ii, jj int) bool {
+		return dbSchema[ii].Prefix < dbSchema[jj].Prefix
+	})
+}
+
+// GetDBSchema returns the schema of every prefix in DBPrefixes, sorted by prefix. The schemas are shared, so they
+// must not be modified.
+func GetDBSchema() []*DBPrefixSchema {
+	return dbSchema
+}
+
+// GetDBPrefixSchema returns the schema of the prefix that the key is stored under, or nil if there isn't one.
+func GetDBPrefixSchema(key []byte) *DBPrefixSchema {
+	if len(key) == 0 {
+		return nil
+	}
+	return dbSchemaByPrefix[key[0]]
+}
+
+// getDBPrefixSchemaByName returns the schema of the prefix with the name, or nil if there isn't one.
+func getDBPrefixSchemaByName(name string) *DBPrefixSchema {
+	return dbSchemaByName[name]
+}
+
+// WriteDBSchemaMarkdown writes the schema of every prefix as a markdown document.
+func WriteDBSchemaMarkdown(ww io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("# DB Schema\n\n")
+	buf.WriteString("The layout of the keys and values stored under every prefix of the DB. Integers in keys are ")
+	buf.WriteString("big-endian, and the\nfield types are described in lib/db_schema.go. ")
+	buf.WriteString("This file is generated by `go test ./lib -run TestDBSchema -update-db-schema`.\n\n")
+	buf.WriteString("| Prefix | Name | Kind | Key | Value | Notes |\n")
+	buf.WriteString("|---|---|---|---|---|---|\n")
+	for _, schema := range dbSchema {
+		var kinds []string
+		if schema.IsState {
+			kinds = append(kinds, "state")
+		}
+		if schema.IsCoreState {
+			kinds = append(kinds, "core state")
+		}
+		if schema.IsTxindex {
+			kinds = append(kinds, "txindex")
+		}
+		fmt.Fprintf(&buf, "| %d | %v | %v | `%v` | `%v` | %v |\n", schema.Prefix, schema.Name,
+			strings.Join(kinds, ", "), schema.KeyLayout(), schema.ValueLayout(), schema.Description)
+	}
+	_, err := ww.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+var updateDBSchema = flag.Bool("update-db-schema", false,
+	"Regenerate the DB schema docs instead of checking that they're up to date.")
+
+const dbSchemaDocsFile = "../docs/db_schema.md"
+
+func TestDBSchema(t *testing.T) {
+	require := require.New(t)
+
+	// Every prefix has a schema that agrees with its tags and with the encoders that hypersync and the encoder
+	// migrations use. Blocks and block nodes are the exception, since they're stored with their own serialization
+	// rather than with EncodeToBytes.
+	require.Len(GetDBSchema(), len(dbPrefixSchemaLayouts))
+	for ii, schema := range GetDBSchema() {
+		if ii > 0 {
+			require.Less(GetDBSchema()[ii-1].Prefix, schema.Prefix)
+		}
+		require.Equal(schema, GetDBPrefixSchema([]byte{schema.Prefix, 1, 2, 3}))
+		require.Equal(StatePrefixes.StatePrefixesMap[schema.Prefix], schema.IsState, schema.Name)
+		require.Equal(StatePrefixes.CoreStatePrefixesMap[schema.Prefix], schema.IsCoreState, schema.Name)
+		require.Equal(isTxIndexKey([]byte{schema.Prefix}), schema.IsTxindex, schema.Name)
+		if schema.ValueEncoderType != nil {
+			require.Empty(schema.ValueFields, schema.Name)
+		}
+		numVariableLengthFields := 0
+		for _, field := range schema.KeyFields {
+			require.NotEqual(DBSchemaFieldTypeSerialized, field.Type, schema.Name)
+			if field.Type == DBSchemaFieldTypeBytes && field.Length == 0 {
+				numVariableLengthFields++
+			}
+		}
+		require.LessOrEqual(numVariableLengthFields, 1, schema.Name)
+
+		if !schema.IsState && !schema.IsCoreState {
+			continue
+		}
+		_, encoder := StatePrefixToDeSoEncoder([]byte{schema.Prefix})
+		switch {
+		case schema.Prefix == Prefixes.PrefixBlockHashToBlock[0] || schema.Prefix == Prefixes.PrefixHeightHashToNodeInfo[0]:
+			require.NotNil(encoder)
+			require.Nil(schema.ValueEncoderType)
+		case encoder == nil:
+			require.Nil(schema.ValueEncoderType, schema.Name)
+		default:
+			require.NotNil(schema.ValueEncoderType, schema.Name)
+			require.Equal(encoder.GetEncoderType(), *schema.ValueEncoderType, schema.Name)
+		}
+	}
+	require.Nil(GetDBPrefixSchema(nil))
+
+	// Keys built by the key functions decode into their fields.
+	requireKeyFields := func(key []byte, expectedFields ...[]byte) {
+		schema := GetDBPrefixSchema(key)
+		require.NotNil(schema)
+		fieldValues, err := schema.DecodeKey(key)
+		require.NoError(err)
+		require.Len(fieldValues, len(expectedFields))
+		for ii, fieldValue := range fieldValues {
+			require.Equal(schema.KeyFields[ii], fieldValue.Field)
+			require.Equal(expectedFields[ii], fieldValue.Bytes, fieldValue.Field.Name)
+		}
+	}
+	transactorPKID := NewPKID(m0PkBytes)
+	targetPKID := NewPKID(m1PkBytes)
+	appPKID := NewPKID(m2PkBytes)
+	postHash := &BlockHash{1}
+	requireKeyFields(_DbKeyForUtxoKey(&UtxoKey{TxID: *postHash, Index: 7}), postHash[:], []byte{0, 0, 0, 7})
+	requireKeyFields(_dbKeyForCommentParentStakeIDToPostHash(m0PkBytes, 5, postHash),
+		m0PkBytes, EncodeUint64(5), postHash[:])
+	requireKeyFields(DBKeyForUserAssociationByTransactor(&UserAssociationEntry{
+		TransactorPKID:   transactorPKID,
+		TargetUserPKID:   targetPKID,
+		AppPKID:          appPKID,
+		AssociationType:  []byte("ENDORSEMENT"),
+		AssociationValue: []byte("Go"),
+	}), transactorPKID[:], []byte("endorsement\x00"), []byte("Go\x00"), targetPKID[:], appPKID[:])
+	exchangeRate := uint256.NewInt(1000)
+	requireKeyFields(DBKeyForDAOCoinLimitOrder(&DAOCoinLimitOrderEntry{
+		OrderID:                   postHash,
+		BuyingDAOCoinCreatorPKID:  transactorPKID,
+		SellingDAOCoinCreatorPKID: targetPKID,
+		ScaledExchangeRateCoinsToSellPerCoinToBuy: exchangeRate,
+		BlockHeight: 10,
+	}), transactorPKID[:], targetPKID[:], VariableEncodeUint256(exchangeRate), _EncodeUint32(1<<32-1-10), postHash[:])
+	stakeAmount := uint256.NewInt(5000)
+	requireKeyFields(DBKeyForValidatorByStatusAndStakeAmount(&ValidatorEntry{
+		ValidatorPKID:         transactorPKID,
+		TotalStakeAmountNanos: stakeAmount,
+	}), []byte{byte(ValidatorStatusActive)}, FixedWidthEncodeUint256(stakeAmount), transactorPKID[:])
+	requireKeyFields(_dbKeyForUsernameHistoryByUsernameAndHeight([]byte("alice"), 12),
+		EncodeByteArray([]byte("alice")), EncodeUint64(12))
+	requireKeyFields(DBKeyForSoftForkDeploymentState(&SoftForkDeploymentStateEntry{
+		DeploymentName:         "fork",
+		WindowStartBlockHeight: 100,
+	}), []byte("\x04fork"), EncodeUint64(100))
+	requireKeyFields(Prefixes.PrefixCurrentEpoch)
+
+	// Keys that don't match the layout don't decode.
+	schema := GetDBPrefixSchema(Prefixes.PrefixUtxoKeyToUtxoEntry)
+	for _, invalidKey := range [][]byte{
+		nil,
+		Prefixes.PrefixPubKeyUtxoKey,
+		_DbKeyForUtxoKey(&UtxoKey{})[:HashSizeBytes],
+		append(_DbKeyForUtxoKey(&UtxoKey{}), 0),
+	} {
+		_, err := schema.DecodeKey(invalidKey)
+		require.Error(err)
+	}
+	_, err := GetDBPrefixSchema(Prefixes.PrefixUserAssociationByTransactor).DecodeKey(
+		append(append([]byte{}, Prefixes.PrefixUserAssociationByTransactor...), transactorPKID[:]...))
+	require.Error(err)
+
+	// Values decode into their encoder or their fields.
+	balanceEntry := &BalanceEntry{HODLerPKID: transactorPKID, CreatorPKID: targetPKID, BalanceNanos: *uint256.NewInt(10)}
+	encoder, fieldValues, err := GetDBPrefixSchema(Prefixes.PrefixHODLerPKIDCreatorPKIDToBalanceEntry).DecodeValue(
+		EncodeToBytes(0, balanceEntry))
+	require.NoError(err)
+	require.Nil(fieldValues)
+	require.Equal(balanceEntry.BalanceNanos, encoder.(*BalanceEntry).BalanceNanos)
+	value := append(append(append([]byte{}, targetPKID[:]...), EncodeUint64(2)...), EncodeUint64(1)...)
+	encoder, fieldValues, err = GetDBPrefixSchema(Prefixes.PrefixTxindexDiamondsByHeight).DecodeValue(value)
+	require.NoError(err)
+	require.Nil(encoder)
+	require.Len(fieldValues, 3)
+	require.Equal(targetPKID[:], fieldValues[0].Bytes)
+	require.Equal(EncodeUint64(1), fieldValues[2].Bytes)
+	_, _, err = GetDBPrefixSchema(Prefixes.PrefixTxindexDiamondsByHeight).DecodeValue(value[1:])
+	require.Error(err)
+
+	// The docs are generated from the schema.
+	var docs bytes.Buffer
+	require.NoError(WriteDBSchemaMarkdown(&docs))
+	if *updateDBSchema {
+		require.NoError(os.WriteFile(dbSchemaDocsFile, docs.Bytes(), 0644))
+	}
+	existingDocs, err := os.ReadFile(dbSchemaDocsFile)
+	require.NoError(err)
+	require.Equal(string(existingDocs), docs.String(),
+		"%v is out of date; regenerate it with -update-db-schema", dbSchemaDocsFile)
+}
@@ -604,7 +604,220 @@ type DBPrefixes struct {
 	// When reading and writing data to this prefixes, please acquire the snapshotDbMutex in the snapshot.
 	PrefixHypersyncSnapshotDBPrefix []byte `prefix_id:"[97]"`
 
-	// NEXT_TAG: 98
+	// PrefixReplicationCursor stores the replication cursors of read replicas and of their primary. See the
+	// comment at the top of replication.go.
+	// Prefix, <"primary" | "replica"> -> <SessionId [16]byte, NextSequence uint64>
+	PrefixReplicationCursor []byte `prefix_id:"[98]"`
+
+	// PrefixTxnHashToTxnReceipt stores the receipts of the transactions connected in blocks on the best chain.
+	// Receipts are derived from the blocks, so they aren't part of the state.
+	// Prefix, <TxnHash [32]byte> -> <TxnReceipt>
+	PrefixTxnHashToTxnReceipt []byte `prefix_id:"[99]"`
+
+	// PrefixStakingRewardStatementByStakerEpochValidator: Retrieve the staking reward statements of a staker.
+	// Statements are derived from the reward distribution at the end of each epoch, so they aren't part of the state.
+	// Prefix, <StakerPKID [33]byte>, <EpochNumber uint64>, <ValidatorPKID [33]byte> -> *StakingRewardStatementEntry
+	PrefixStakingRewardStatementByStakerEpochValidator []byte `prefix_id:"[100]"`
+
+	// PrefixStakingRewardStatementByEpochValidatorStaker: Retrieve the staking reward statements of an epoch,
+	// optionally filtered by validator.
+	// Prefix, <EpochNumber uint64>, <ValidatorPKID [33]byte>, <StakerPKID [33]byte> -> *StakingRewardStatementEntry
+	PrefixStakingRewardStatementByEpochValidatorStaker []byte `prefix_id:"[101]"`
+
+	// PrefixStateCommitmentNode stores the nodes of the state commitment trie by their hash. See the comment at
+	// the top of state_commitment.go. The trie is derived from the state, so it isn't part of the state.
+	// Prefix, <NodeHash [32]byte> -> <NodeType byte, LeftOrKeyHash [32]byte, RightOrValueHash [32]byte>
+	PrefixStateCommitmentNode []byte `prefix_id:"[102]"`
+
+	// PrefixStateCommitmentRoot stores the current root of the state commitment trie.
+	// Prefix -> <StateRoot [32]byte>
+	PrefixStateCommitmentRoot []byte `prefix_id:"[103]"`
+
+	// PrefixStateCommitmentRootByBlockHash stores the root of the state commitment trie after each block was flushed.
+	// Prefix, <BlockHash [32]byte> -> <StateRoot [32]byte>
+	PrefixStateCommitmentRootByBlockHash []byte `prefix_id:"[104]"`
+
+	// PrefixPKIDToFollowCounts stores the number of followers of each PKID and the number of PKIDs it follows. The
+	// counts are derived from the follow mappings, so they aren't part of the state. The bare prefix is set once the
+	// counts have been built for all of the follows in the DB. See DbBuildFollowCountsIfMissing.
+	// Prefix, <PKID [33]byte> -> <FollowerCount uvarint, FollowingCount uvarint>
+	// Prefix -> <>
+	PrefixPKIDToFollowCounts []byte `prefix_id:"[105]"`
+
+	// PrefixKeyValueRecordByOwnerPKIDAndKey: Retrieve a key-value record written by a SetKeyValueRecords
+	// transaction. Each PKID owns the namespace of records keyed by its PKID, so all of the records of an owner
+	// can be fetched with a prefix scan.
+	// Prefix, <OwnerPKID [33]byte>, <Key []byte> -> *KeyValueRecordEntry
+	PrefixKeyValueRecordByOwnerPKIDAndKey []byte `prefix_id:"[106]" is_state:"true" core_state:"true"`
+
+	// PrefixUsernameHistoryByUsernameAndHeight: The txindex keeps a history of which PKID held each username, so
+	// that a username can be resolved as of any block height even after it's changed or released. A record is
+	// written at every height where the holder of the username changed, and the value is empty if the username
+	// was released. The username is lowercased and length-prefixed so that one username isn't a prefix of another.
+	// A txindex that was built before this prefix existed only has the history of the blocks it attached since.
+	// Prefix, <Username []byte>, <BlockHeight uint64> -> <PKID [33]byte>
+	PrefixUsernameHistoryByUsernameAndHeight []byte `prefix_id:"[107]" is_txindex:"true"`
+
+	// PrefixUsernameHistoryByHeightAndUsername indexes the username history records by the height they were
+	// written at, so that the records of a block can be deleted when the txindex detaches it.
+	// Prefix, <BlockHeight uint64>, <Username []byte> -> <>
+	PrefixUsernameHistoryByHeightAndUsername []byte `prefix_id:"[108]" is_txindex:"true"`
+
+	// PrefixTxindexDiamondsByReceiverLevelHeight: The txindex keeps a record of every diamond txn so that block
+	// explorers can page through the diamonds a PKID has received or given. A record is written for each diamond
+	// level a sender gives on a post, so upgrading a diamond adds a record at the new level rather than replacing
+	// the old one. The level and height are big-endian so the records are sorted by level and then by height.
+	// A txindex that was built before this prefix existed only has the diamonds of the blocks it attached since.
+	// Prefix, <ReceiverPKID [33]byte>, <DiamondLevel uint64>, <BlockHeight uint64>, <SenderPKID [33]byte>,
+	// 		<DiamondPostHash [32]byte> -> <>
+	PrefixTxindexDiamondsByReceiverLevelHeight []byte `prefix_id:"[109]" is_txindex:"true"`
+
+	// PrefixTxindexDiamondsBySenderHeight indexes the diamond records by their sender, sorted by height.
+	// Prefix, <SenderPKID [33]byte>, <BlockHeight uint64>, <DiamondPostHash [32]byte> ->
+	// 		<ReceiverPKID [33]byte>, <DiamondLevel uint64>
+	PrefixTxindexDiamondsBySenderHeight []byte `prefix_id:"[110]" is_txindex:"true"`
+
+	// PrefixTxindexDiamondsByHeight indexes the diamond records by the height they were written at, so that the
+	// records of a block can be deleted and the post diamond counts reverted when the txindex detaches it.
+	// Prefix, <BlockHeight uint64>, <SenderPKID [33]byte>, <DiamondPostHash [32]byte> ->
+	// 		<ReceiverPKID [33]byte>, <DiamondLevel uint64>, <PrevDiamondLevel uint64>
+	PrefixTxindexDiamondsByHeight []byte `prefix_id:"[111]" is_txindex:"true"`
+
+	// PrefixTxindexPostDiamondCounts stores the number of senders whose diamond on a post is at each level. It's
+	// updated as the txindex attaches and detaches diamond txns, so it's always consistent with the diamond records.
+	// Prefix, <DiamondPostHash [32]byte>, <DiamondLevel uint64> -> <Count uint64>
+	PrefixTxindexPostDiamondCounts []byte `prefix_id:"[112]" is_txindex:"true"`
+
+	// PrefixLockupVestingScheduleByHODLerPKIDProfilePKIDUnlockTimestamp: Retrieve the vesting schedule of an
+	// unvested LockedBalanceEntry, which limits how much of the entry can be unlocked by block height.
+	// Prefix, <HODLerPKID [33]byte>, <ProfilePKID [33]byte>, <UnlockTimestampNanoSecs int64> -> *LockupVestingScheduleEntry
+	PrefixLockupVestingScheduleByHODLerPKIDProfilePKIDUnlockTimestamp []byte `prefix_id:"[113]" is_state:"true" core_state:"true"`
+
+	// PrefixMessageReadStateByAccessGroupIdAndMember: Retrieve the read watermark of a member for the conversation
+	// of an access group. All of the read watermarks for an access group can be fetched with a prefix scan, which is
+	// useful for showing which members of a group chat have read a message.
+	// Prefix, <AccessGroupOwnerPublicKey [33]byte>, <AccessGroupKeyName [32]byte>, <MemberPublicKey [33]byte> -> *MessageReadStateEntry
+	PrefixMessageReadStateByAccessGroupIdAndMember []byte `prefix_id:"[114]" is_state:"true" core_state:"true"`
+
+	// PrefixValidatorPerformanceByValidatorEpoch: Retrieve the consensus participation of a validator across epochs.
+	// Performance entries are derived from the blocks connected in each epoch, so they aren't part of the state.
+	// Prefix, <ValidatorPKID [33]byte>, <EpochNumber uint64> -> *ValidatorPerformanceEntry
+	PrefixValidatorPerformanceByValidatorEpoch []byte `prefix_id:"[115]"`
+
+	// PrefixValidatorPerformanceByEpochValidator: Retrieve the consensus participation of every validator in an epoch.
+	// Prefix, <EpochNumber uint64>, <ValidatorPKID [33]byte> -> *ValidatorPerformanceEntry
+	PrefixValidatorPerformanceByEpochValidator []byte `prefix_id:"[116]"`
+
+	// PrefixSoftForkDeploymentStateByNameWindow: Retrieve the state and signals of a soft fork deployment in each
+	// signaling window. See soft_fork_deployments.go.
+	// Prefix, <DeploymentNameLength uint8>, <DeploymentName>, <WindowStartBlockHeight uint64> -> *SoftForkDeploymentStateEntry
+	PrefixSoftForkDeploymentStateByNameWindow []byte `prefix_id:"[117]" is_state:"true" core_state:"true"`
+
+	// PrefixBlockHashToBlockSegmentLocation: Retrieve where a block's bytes are stored when block bodies are kept in
+	// a BlockSegmentStore instead of under PrefixBlockHashToBlock. The location is specific to this node's segment
+	// files, so it isn't part of the state.
+	// Prefix, <BlockHash [32]byte> -> <BlockSegmentLocation>
+	PrefixBlockHashToBlockSegmentLocation []byte `prefix_id:"[118]"`
+
+	// PrefixNFTAvatarByNFTAndProfilePKID: Retrieve the profiles that reference an NFT as their avatar. A profile's
+	// avatar is only verified while the profile owns the NFT. See block_view_nft_avatar.go.
+	// Prefix, <NFTPostHash [32]byte>, <SerialNumber uint64>, <ProfilePKID [33]byte> -> *NFTAvatarEntry
+	PrefixNFTAvatarByNFTAndProfilePKID []byte `prefix_id:"[119]" is_state:"true" core_state:"true"`
+
+	// PrefixBridgeEventAnchorByChainIDAndDepositHash: Retrieve an external chain event anchored by a
+	// BridgeEventAnchor transaction. An event can only be anchored once, and all of the events of an
+	// external chain can be fetched with a prefix scan. See block_view_bridge_event_anchor.go.
+	// Prefix, <ChainID uint64>, <DepositHash []byte> -> *BridgeEventAnchorEntry
+	PrefixBridgeEventAnchorByChainIDAndDepositHash []byte `prefix_id:"[120]" is_state:"true" core_state:"true"`
+
+	// PrefixPeerAccessListEntry: Retrieve the ban and allow entries the node operator has added for peers. The
+	// entries are node-local configuration, so they aren't part of the state. See peer_access_list.go.
+	// Prefix, <ListType uint8>, <TargetType uint8>, <Target> -> <PeerAccessEntry>
+	PrefixPeerAccessListEntry []byte `prefix_id:"[121]"`
+
+	// PrefixTxnTypeBlockMetrics: Retrieve the per-TxnType transaction metrics of a recent block. Only the blocks in
+	// the node's metrics window are kept, and they aren't part of the state. See txn_type_metrics.go.
+	// Prefix, <BlockHeight uint64> -> <BlockTxnTypeMetrics>
+	PrefixTxnTypeBlockMetrics []byte `prefix_id:"[122]"`
+
+	// PrefixDAOCoinBalanceChangeByCreatorHODLerHeight: Retrieve the DAO coin balances of a holder after each block
+	// that changed them. The changes are derived from the blocks, so they aren't part of the state. See
+	// block_view_dao_coin_balance_history.go.
+	// Prefix, <CreatorPKID [33]byte>, <HODLerPKID [33]byte>, <BlockHeight uint64> -> *DAOCoinBalanceChangeEntry
+	PrefixDAOCoinBalanceChangeByCreatorHODLerHeight []byte `prefix_id:"[123]"`
+
+	// PrefixPKIDSwapByPKIDHeightTxnHash: Retrieve the SwapIdentity transactions that swapped a PKID. The swaps are
+	// derived from the blocks, so they aren't part of the state. See block_view_pkid_swap_history.go.
+	// Prefix, <PKID [33]byte>, <BlockHeight uint64>, <TxnHash [32]byte> -> *PKIDSwapEntry
+	PrefixPKIDSwapByPKIDHeightTxnHash []byte `prefix_id:"[124]"`
+
+	// PrefixDelegatedPosterByOwnerPKIDDelegatePKID: Retrieve an account's authorization of a delegate to submit
+	// posts attributed to it. All of the delegates of an account can be fetched with a prefix scan. See
+	// block_view_delegated_poster.go.
+	// Prefix, <OwnerPKID [33]byte>, <DelegatePKID [33]byte> -> *DelegatedPosterEntry
+	PrefixDelegatedPosterByOwnerPKIDDelegatePKID []byte `prefix_id:"[125]" is_state:"true" core_state:"true"`
+
+	// PrefixUndoDataPrunedBlockHeight: Retrieve the height up to which the UtxoOperations of main chain blocks have
+	// been pruned. The pruning progress is specific to this node, so it isn't part of the state. See
+	// undo_data_pruning.go.
+	// Prefix -> <BlockHeight uint64>
+	PrefixUndoDataPrunedBlockHeight []byte `prefix_id:"[126]"`
+
+	// PrefixValidatorVotingKeyRotationByPKID: Retrieve the validators with a voting key rotation in progress,
+	// which are advanced at the end of every epoch. See block_view_validator_voting_key_rotation.go.
+	// Prefix, <ValidatorPKID [33]byte> -> nil
+	PrefixValidatorVotingKeyRotationByPKID []byte `prefix_id:"[127]" is_state:"true"`
+
+	// PrefixAnchorHashByContentHashAnchorerPKID: Retrieve the anchor of off-chain content by a public key. Each
+	// public key can anchor a content hash once, and all of the anchors of a content hash can be fetched with a
+	// prefix scan. See block_view_anchor_hash.go.
+	// Prefix, <ContentHash []byte>, <AnchorerPKID [33]byte> -> *AnchorHashEntry
+	PrefixAnchorHashByContentHashAnchorerPKID []byte `prefix_id:"[128]" is_state:"true" core_state:"true"`
+
+	// PrefixAnchorHashRateLimitByPKID: Retrieve the number of hashes a public key has anchored in its current
+	// rate limit window. See block_view_anchor_hash.go.
+	// Prefix, <AnchorerPKID [33]byte> -> *AnchorHashRateLimitEntry
+	PrefixAnchorHashRateLimitByPKID []byte `prefix_id:"[129]" is_state:"true" core_state:"true"`
+
+	// PrefixContentTombstoneByHeightTxnHash: Retrieve the transactions that hid posts and profiles, so consumers can
+	// enumerate the entries hidden since a height. The tombstones are derived from the blocks, so they aren't part of
+	// the state. See block_view_content_tombstone.go.
+	// Prefix, <BlockHeight uint64>, <TxnHash [32]byte> -> *ContentTombstoneEntry
+	PrefixContentTombstoneByHeightTxnHash []byte `prefix_id:"[130]"`
+
+	// PrefixBlockFeeSplitByHeight: Retrieve how the fees of a PoS block were split between the block producer and
+	// the burn. The splits are derived from the blocks, so they aren't part of the state. See block_view_fee_split.go.
+	// Prefix, <BlockHeight uint64> -> *BlockFeeSplitEntry
+	PrefixBlockFeeSplitByHeight []byte `prefix_id:"[131]"`
+
+	// PrefixSubscriptionByRecipientPKIDSubscriberPKID: Retrieve an account's authorization of a recipient to claim
+	// recurring payments from it. All of the subscribers of a recipient can be fetched with a prefix scan. See
+	// block_view_subscription.go.
+	// Prefix, <RecipientPKID [33]byte>, <SubscriberPKID [33]byte> -> *SubscriptionEntry
+	PrefixSubscriptionByRecipientPKIDSubscriberPKID []byte `prefix_id:"[132]" is_state:"true" core_state:"true"`
+
+	// PrefixPostAssociationCountsByPostTypeValue stores the number of associations on each post with each
+	// AssociationType and AssociationValue, e.g. the number of likes of a post. The AssociationType is lowercase.
+	// The counts are derived from the post associations, so they aren't part of the state. The bare prefix is set
+	// once the counts have been built for all of the post associations in the DB. See
+	// DbBuildPostAssociationCountsIfMissing.
+	// Prefix, <PostHash [32]byte>, <AssociationType + NULL TERMINATOR byte>,
+	//   <AssociationValue + NULL TERMINATOR byte> -> <Count uvarint>
+	// Prefix -> <>
+	PrefixPostAssociationCountsByPostTypeValue []byte `prefix_id:"[133]"`
+
+	// PrefixGlobalParamsHistoryByHeight: Retrieve the global params in effect after a block that updated them. The
+	// history is derived from the blocks, so it isn't part of the state. See block_view_global_params_history.go.
+	// Prefix, <BlockHeight uint64> -> *GlobalParamsHistoryEntry
+	PrefixGlobalParamsHistoryByHeight []byte `prefix_id:"[134]"`
+
+	// PrefixUtxoViewFlushInProgress: Retrieve the view flush that was split into batches and hasn't committed all of
+	// its batches yet. A node that finds it on startup has a DB that holds part of a flush. The flush progress is
+	// specific to this node, so it isn't part of the state. See block_view_flush_batching.go.
+	// Prefix -> <TipHash [32]byte>, <NumBatchesCommitted uint64>, <NumBatches uint64>
+	PrefixUtxoViewFlushInProgress []byte `prefix_id:"[135]"`
+
+	// NEXT_TAG: 136
 }
 
 // DecodeStateKey decodes a state key into a DeSoEncoder type. This is useful for encoders which don't have a stored
@@ -904,6 +1117,39 @@ func StatePrefixToDeSoEncoder(prefix []byte) (_isEncoder bool, _encoder DeSoEnco
 	} else if bytes.Equal(prefix, Prefixes.PrefixSnapshotValidatorBLSPublicKeyPKIDPairEntry) {
 		// prefix_id:"[96]"
 		return true, &BLSPublicKeyPKIDPairEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixKeyValueRecordByOwnerPKIDAndKey) {
+		// prefix_id:"[106]"
+		return true, &KeyValueRecordEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixLockupVestingScheduleByHODLerPKIDProfilePKIDUnlockTimestamp) {
+		// prefix_id:"[113]"
+		return true, &LockupVestingScheduleEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixMessageReadStateByAccessGroupIdAndMember) {
+		// prefix_id:"[114]"
+		return true, &MessageReadStateEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixSoftForkDeploymentStateByNameWindow) {
+		// prefix_id:"[117]"
+		return true, &SoftForkDeploymentStateEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixNFTAvatarByNFTAndProfilePKID) {
+		// prefix_id:"[119]"
+		return true, &NFTAvatarEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixBridgeEventAnchorByChainIDAndDepositHash) {
+		// prefix_id:"[120]"
+		return true, &BridgeEventAnchorEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixDelegatedPosterByOwnerPKIDDelegatePKID) {
+		// prefix_id:"[125]"
+		return true, &DelegatedPosterEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixValidatorVotingKeyRotationByPKID) {
+		// prefix_id:"[127]"
+		return false, nil
+	} else if bytes.Equal(prefix, Prefixes.PrefixAnchorHashByContentHashAnchorerPKID) {
+		// prefix_id:"[128]"
+		return true, &AnchorHashEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixAnchorHashRateLimitByPKID) {
+		// prefix_id:"[129]"
+		return true, &AnchorHashRateLimitEntry{}
+	} else if bytes.Equal(prefix, Prefixes.PrefixSubscriptionByRecipientPKIDSubscriberPKID) {
+		// prefix_id:"[132]"
+		return true, &SubscriptionEntry{}
 	}
 
 	return true, nil
@@ -1139,6 +1385,7 @@ func DBSetWithTxn(txn *badger.Txn, snap *Snapshot, key []byte, value []byte, eve
 		}
 		// Now save the newest record to cache.
 		snap.DatabaseCache.Put(keyString, value)
+		snap.StateCache.Invalidate(key)
 
 		if !snap.disableChecksum {
 			// We have to remove the previous value from the state checksum.
@@ -1149,6 +1396,9 @@ func DBSetWithTxn(txn *badger.Txn, snap *Snapshot, key []byte, value []byte, eve
 			// We also add the new record to the checksum.
 			snap.AddChecksumBytes(key, value)
 		}
+		if snap.StateCommitment != nil {
+			snap.StateCommitment.recordSet(key, value)
+		}
 	}
 
 	// If we have an event manager, we fire off the on db transaction event.
@@ -1182,6 +1432,9 @@ func DBGetWithTxn(txn *badger.Txn, snap *Snapshot, key []byte) ([]byte, error) {
 		if val, exists := snap.DatabaseCache.Get(keyString); exists {
 			return val, nil
 		}
+		if val, exists := snap.StateCache.Get(key); exists {
+			return val, nil
+		}
 	}
 
 	// If record doesn't exist in cache, we get it from the DB.
@@ -1194,6 +1447,10 @@ func DBGetWithTxn(txn *badger.Txn, snap *Snapshot, key []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	// Hot entries are cached on read, so that we don't go to disk for them again.
+	if isState {
+		snap.StateCache.Put(txn, key, itemData)
+	}
 	return itemData, nil
 }
 
@@ -1238,11 +1495,15 @@ func DBDeleteWithTxn(txn *badger.Txn, snap *Snapshot, key []byte, eventManager *
 		}
 		// Now delete the past record from the cache.
 		snap.DatabaseCache.Delete(keyString)
+		snap.StateCache.Invalidate(key)
 		// We have to remove the previous value from the state checksum.
 		// Because checksum is commutative, we can safely remove the past value here.
 		if !snap.disableChecksum {
 			snap.RemoveChecksumBytes(key, ancestralValue)
 		}
+		if snap.StateCommitment != nil {
+			snap.StateCommitment.recordDelete(key)
+		}
 	}
 	// If we have an event manager, and the entry's isDeleted==true (i.e. it isn't going to be re-inserted later on in the
 	// same transaction), we fire off the on db transaction event.
@@ -4038,6 +4299,213 @@ func DbGetPubKeysFollowingYou(handle *badger.DB, snap *Snapshot, yourPubKey []by
 	return followPubKeys, nil
 }
 
+// DbGetPaginatedPKIDsFollowingYou returns up to limit PKIDs that follow yourPKID, in increasing order, starting after
+// startFollowerPKID. A nil startFollowerPKID starts from the first follower. Only the requested page is read from the
+// DB, so this is cheap even for PKIDs with many followers.
+func DbGetPaginatedPKIDsFollowingYou(handle *badger.DB, yourPKID *PKID, startFollowerPKID *PKID, limit uint32) (
+	_pkids []*PKID, _err error) {
+
+	prefix := _dbSeekPrefixForPKIDsFollowingYou(yourPKID)
+	startKey := prefix
+	if startFollowerPKID != nil {
+		startKey = _dbKeyForFollowedToFollowerMapping(yourPKID, startFollowerPKID)
+	}
+
+	var keysFound [][]byte
+	err := handle.View(func(txn *badger.Txn) error {
+		// We fetch one extra key in case the first key is the start key, which we skip.
+		keysFound = _enumeratePaginatedLimitedKeysForPrefixWithTxn(txn, prefix, startKey, limit+1)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DbGetPaginatedPKIDsFollowingYou: Problem fetching followers: ")
+	}
+	if startFollowerPKID != nil && len(keysFound) > 0 && bytes.Equal(keysFound[0], startKey) {
+		keysFound = keysFound[1:]
+	}
+	if uint32(len(keysFound)) > limit {
+		keysFound = keysFound[:limit]
+	}
+
+	pkidsFollowingYou := []*PKID{}
+	for _, keyBytes := range keysFound {
+		// We must slice off the first byte and followedPKID to get the followerPKID.
+		followerPKID := &PKID{}
+		copy(followerPKID[:], keyBytes[1+btcec.PubKeyBytesLenCompressed:])
+		pkidsFollowingYou = append(pkidsFollowingYou, followerPKID)
+	}
+	return pkidsFollowingYou, nil
+}
+
+// -------------------------------------------------------------------------------------
+// Follow count functions
+// 		<prefix_id, PKID [33]byte> -> <FollowerCount uvarint, FollowingCount uvarint>
+// -------------------------------------------------------------------------------------
+
+// followCountsRebuildBatchSize is the number of PKIDs whose counts are written per badger transaction when the
+// follow counts are rebuilt.
+const followCountsRebuildBatchSize = 1000
+
+func _dbKeyForFollowCountEntry(pkid *PKID) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	prefixCopy := append([]byte{}, Prefixes.PrefixPKIDToFollowCounts...)
+	return append(prefixCopy, pkid[:]...)
+}
+
+// DbGetFollowCountEntryForPKIDWithTxn returns the follow counts of the PKID. PKIDs that have never been part of a
+// follow have zero counts.
+func DbGetFollowCountEntryForPKIDWithTxn(txn *badger.Txn, pkid *PKID) (*FollowCountEntry, error) {
+	followCountEntry := &FollowCountEntry{PKID: pkid.NewPKID()}
+	countBytes, err := DBGetWithTxn(txn, nil, _dbKeyForFollowCountEntry(pkid))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return followCountEntry, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DbGetFollowCountEntryForPKIDWithTxn: Problem getting counts: ")
+	}
+
+	rr := bytes.NewReader(countBytes)
+	if followCountEntry.FollowerCount, err = ReadUvarint(rr); err != nil {
+		return nil, errors.Wrapf(err, "DbGetFollowCountEntryForPKIDWithTxn: Problem reading FollowerCount: ")
+	}
+	if followCountEntry.FollowingCount, err = ReadUvarint(rr); err != nil {
+		return nil, errors.Wrapf(err, "DbGetFollowCountEntryForPKIDWithTxn: Problem reading FollowingCount: ")
+	}
+	return followCountEntry, nil
+}
+
+func DbGetFollowCountEntryForPKID(handle *badger.DB, pkid *PKID) (*FollowCountEntry, error) {
+	var followCountEntry *FollowCountEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		followCountEntry, err = DbGetFollowCountEntryForPKIDWithTxn(txn, pkid)
+		return err
+	})
+	return followCountEntry, err
+}
+
+// DbPutFollowCountEntryWithTxn sets the follow counts of a PKID. The key is deleted once both counts are zero. The
+// counts aren't DeSoEncoders, so unlike the follow mappings they aren't passed to the state syncer.
+func DbPutFollowCountEntryWithTxn(txn *badger.Txn, followCountEntry *FollowCountEntry) error {
+	key := _dbKeyForFollowCountEntry(followCountEntry.PKID)
+	if followCountEntry.FollowerCount == 0 && followCountEntry.FollowingCount == 0 {
+		return errors.Wrapf(DBDeleteWithTxn(txn, nil, key, nil, true),
+			"DbPutFollowCountEntryWithTxn: Problem deleting counts: ")
+	}
+	value := append(UintToBuf(followCountEntry.FollowerCount), UintToBuf(followCountEntry.FollowingCount)...)
+	return errors.Wrapf(DBSetWithTxn(txn, nil, key, value, nil), "DbPutFollowCountEntryWithTxn: Problem setting counts: ")
+}
+
+// DbBuildFollowCountsIfMissing builds the follow counts from the follow mappings unless they've already been built.
+// Once built, the counts are kept up to date by the UtxoView as follows are connected and disconnected, so this only
+// does work the first time a node that predates the counts starts.
+func DbBuildFollowCountsIfMissing(handle *badger.DB) error {
+	isBuilt := false
+	err := handle.View(func(txn *badger.Txn) error {
+		_, err := DBGetWithTxn(txn, nil, Prefixes.PrefixPKIDToFollowCounts)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		isBuilt = err == nil
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbBuildFollowCountsIfMissing: Problem checking for follow counts: ")
+	}
+	if isBuilt {
+		return nil
+	}
+	return DbRebuildFollowCounts(handle)
+}
+
+// DbRebuildFollowCounts replaces the follow counts with counts computed from the follow mappings. It's used when the
+// follow mappings were written without the counts, e.g. by a hypersync.
+func DbRebuildFollowCounts(handle *badger.DB) error {
+	glog.Infof("DbRebuildFollowCounts: Building follow counts from the follow mappings")
+	if err := handle.DropPrefix(Prefixes.PrefixPKIDToFollowCounts); err != nil {
+		return errors.Wrapf(err, "DbRebuildFollowCounts: Problem deleting existing follow counts: ")
+	}
+
+	// The followed-to-follower mappings give us the follower counts, and the follower-to-followed mappings give us
+	// the following counts.
+	if err := _dbBuildFollowCountsFromMappings(handle, Prefixes.PrefixFollowedPKIDToFollowerPKID,
+		func(followCountEntry *FollowCountEntry, count uint64) {
+			followCountEntry.FollowerCount = count
+		}); err != nil {
+		return errors.Wrapf(err, "DbRebuildFollowCounts: Problem counting followers: ")
+	}
+	if err := _dbBuildFollowCountsFromMappings(handle, Prefixes.PrefixFollowerPKIDToFollowedPKID,
+		func(followCountEntry *FollowCountEntry, count uint64) {
+			followCountEntry.FollowingCount = count
+		}); err != nil {
+		return errors.Wrapf(err, "DbRebuildFollowCounts: Problem counting following: ")
+	}
+
+	// Mark the counts as built.
+	if err := handle.Update(func(txn *badger.Txn) error {
+		return DBSetWithTxn(txn, nil, Prefixes.PrefixPKIDToFollowCounts, []byte{}, nil)
+	}); err != nil {
+		return errors.Wrapf(err, "DbRebuildFollowCounts: Problem marking follow counts as built: ")
+	}
+	glog.Infof("DbRebuildFollowCounts: Finished building follow counts")
+	return nil
+}
+
+// _dbBuildFollowCountsFromMappings counts the mappings under mappingPrefix for each PKID that comes first in the
+// mapping keys, and sets the count on the PKID's FollowCountEntry.
+func _dbBuildFollowCountsFromMappings(handle *badger.DB, mappingPrefix []byte,
+	setCount func(followCountEntry *FollowCountEntry, count uint64)) error {
+
+	var pkids []*PKID
+	var counts []uint64
+	flushCounts := func() error {
+		err := handle.Update(func(txn *badger.Txn) error {
+			for ii, pkid := range pkids {
+				followCountEntry, err := DbGetFollowCountEntryForPKIDWithTxn(txn, pkid)
+				if err != nil {
+					return err
+				}
+				setCount(followCountEntry, counts[ii])
+				if err = DbPutFollowCountEntryWithTxn(txn, followCountEntry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		pkids, counts = nil, nil
+		return err
+	}
+
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = mappingPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		// The mapping keys are sorted by the first PKID, so all of the mappings of a PKID are next to each other.
+		for it.Seek(mappingPrefix); it.ValidForPrefix(mappingPrefix); it.Next() {
+			pkid := &PKID{}
+			copy(pkid[:], it.Item().Key()[len(mappingPrefix):])
+			if len(pkids) > 0 && pkids[len(pkids)-1].Eq(pkid) {
+				counts[len(counts)-1]++
+				continue
+			}
+			if len(pkids) >= followCountsRebuildBatchSize {
+				if err := flushCounts(); err != nil {
+					return err
+				}
+			}
+			pkids = append(pkids, pkid)
+			counts = append(counts, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flushCounts()
+}
+
 // -------------------------------------------------------------------------------------
 // Diamonds mapping functions
 //  <prefix_id, DiamondReceiverPKID [33]byte, DiamondSenderPKID [33]byte, posthash> -> <[]byte{DiamondLevel}>
@@ -4836,6 +5304,51 @@ func DeleteUtxoOperationsForBlockWithTxn(txn *badger.Txn, snap *Snapshot, blockH
 	return DBDeleteWithTxn(txn, snap, _DbKeyForUtxoOps(blockHash), eventManager, entryIsDeleted)
 }
 
+func _dbKeyForTxnReceipt(txnHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxnHashToTxnReceipt...), txnHash[:]...)
+}
+
+func DBGetTxnReceiptWithTxn(txn *badger.Txn, snap *Snapshot, txnHash *BlockHash) (*TxnReceipt, error) {
+	receiptBytes, err := DBGetWithTxn(txn, snap, _dbKeyForTxnReceipt(txnHash))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetTxnReceiptWithTxn: Problem getting receipt")
+	}
+
+	receipt := &TxnReceipt{}
+	rr := bytes.NewReader(receiptBytes)
+	if exists, err := DecodeFromBytes(receipt, rr); !exists || err != nil {
+		return nil, errors.Wrapf(err, "DBGetTxnReceiptWithTxn: Problem decoding receipt")
+	}
+	return receipt, nil
+}
+
+func DBGetTxnReceipt(handle *badger.DB, snap *Snapshot, txnHash *BlockHash) (*TxnReceipt, error) {
+	var receipt *TxnReceipt
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		receipt, err = DBGetTxnReceiptWithTxn(txn, snap, txnHash)
+		return err
+	})
+	return receipt, err
+}
+
+func DBPutTxnReceiptWithTxn(txn *badger.Txn, snap *Snapshot, blockHeight uint64, receipt *TxnReceipt,
+	eventManager *EventManager) error {
+
+	return errors.Wrap(DBSetWithTxn(txn, snap, _dbKeyForTxnReceipt(receipt.TxnHash),
+		EncodeToBytes(blockHeight, receipt), eventManager), "DBPutTxnReceiptWithTxn: Problem setting receipt")
+}
+
+func DBDeleteTxnReceiptWithTxn(txn *badger.Txn, snap *Snapshot, txnHash *BlockHash, eventManager *EventManager,
+	entryIsDeleted bool) error {
+
+	return errors.Wrap(DBDeleteWithTxn(txn, snap, _dbKeyForTxnReceipt(txnHash), eventManager, entryIsDeleted),
+		"DBDeleteTxnReceiptWithTxn: Problem deleting receipt")
+}
+
 func blockNodeProofOfStakeCutoverMigrationTriggered(height uint32) bool {
 	return height >= GlobalDeSoParams.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight
 }
@@ -5005,6 +5518,7 @@ func PublicKeyBlockHashToBlockRewardKey(publicKey []byte, blockHash *BlockHash)
 	return key
 }
 
+// GetBlockWithTxn only reads blocks stored in Badger. Use GetBlock to also read blocks in a BlockSegmentStore.
 func GetBlockWithTxn(txn *badger.Txn, snap *Snapshot, blockHash *BlockHash) *MsgDeSoBlock {
 	hashKey := BlockHashToBlockKey(blockHash)
 
@@ -5023,9 +5537,23 @@ func GetBlockWithTxn(txn *badger.Txn, snap *Snapshot, blockHash *BlockHash) *Msg
 
 func GetBlock(blockHash *BlockHash, handle *badger.DB, snap *Snapshot) (*MsgDeSoBlock, error) {
 	hashKey := BlockHashToBlockKey(blockHash)
+	blockStore := GetBlockSegmentStore(handle)
 	var blockRet *MsgDeSoBlock
 	err := handle.View(func(txn *badger.Txn) error {
-		blockBytes, err := DBGetWithTxn(txn, snap, hashKey)
+		var blockBytes []byte
+		var err error
+		// Blocks stored before the segment store was enabled are still in Badger.
+		var location *BlockSegmentLocation
+		if blockStore != nil {
+			if location, err = DBGetBlockSegmentLocationWithTxn(txn, blockHash); err != nil {
+				return err
+			}
+		}
+		if location != nil {
+			blockBytes, err = blockStore.Read(location)
+		} else {
+			blockBytes, err = DBGetWithTxn(txn, snap, hashKey)
+		}
 		if err != nil {
 			return err
 		}
@@ -5044,7 +5572,10 @@ func GetBlock(blockHash *BlockHash, handle *badger.DB, snap *Snapshot) (*MsgDeSo
 	return blockRet, nil
 }
 
-func PutBlockHashToBlockWithTxn(txn *badger.Txn, snap *Snapshot, block *MsgDeSoBlock, eventManager *EventManager) error {
+// PutBlockHashToBlockWithTxn stores the block under the <blockHash> -> <serialized block> index. If blockStore is
+// non-nil, the block's bytes are appended to it instead and only their location is stored in Badger.
+func PutBlockHashToBlockWithTxn(txn *badger.Txn, snap *Snapshot, block *MsgDeSoBlock, blockStore *BlockSegmentStore,
+	eventManager *EventManager) error {
 	if block.Header == nil {
 		return fmt.Errorf("PutBlockHashToBlockWithTxn: Header was nil in block %v", block)
 	}
@@ -5057,6 +5588,9 @@ func PutBlockHashToBlockWithTxn(txn *badger.Txn, snap *Snapshot, block *MsgDeSoB
 	if err != nil {
 		return err
 	}
+	if blockStore != nil {
+		return putBlockHashToBlockSegmentWithTxn(txn, blockStore, blockHash, block.Header.Height, data, eventManager)
+	}
 	// First check to see if the block is already in the db.
 	if _, err = DBGetWithTxn(txn, snap, blockKey); err == nil {
 		// err == nil means the block already exists in the db so
@@ -5070,12 +5604,13 @@ func PutBlockHashToBlockWithTxn(txn *badger.Txn, snap *Snapshot, block *MsgDeSoB
 	return nil
 }
 
-func PutBlockWithTxn(txn *badger.Txn, snap *Snapshot, desoBlock *MsgDeSoBlock, eventManager *EventManager) error {
+func PutBlockWithTxn(txn *badger.Txn, snap *Snapshot, desoBlock *MsgDeSoBlock, blockStore *BlockSegmentStore,
+	eventManager *EventManager) error {
 	blockHash, err := desoBlock.Header.Hash()
 	if err != nil {
 		return errors.Wrapf(err, "PutBlockWithTxn: Problem hashing header: ")
 	}
-	if err = PutBlockHashToBlockWithTxn(txn, snap, desoBlock, eventManager); err != nil {
+	if err = PutBlockHashToBlockWithTxn(txn, snap, desoBlock, blockStore, eventManager); err != nil {
 		return errors.Wrap(err, "PutBlockWithTxn: Problem putting block hash to block")
 	}
 	blockRewardTxn := desoBlock.Txns[0]
@@ -5106,7 +5641,7 @@ func PutBlockWithTxn(txn *badger.Txn, snap *Snapshot, desoBlock *MsgDeSoBlock, e
 
 func PutBlock(handle *badger.DB, snap *Snapshot, desoBlock *MsgDeSoBlock, eventManager *EventManager) error {
 	err := handle.Update(func(txn *badger.Txn) error {
-		return PutBlockWithTxn(txn, snap, desoBlock, eventManager)
+		return PutBlockWithTxn(txn, snap, desoBlock, nil, eventManager)
 	})
 
 	return err
@@ -5324,7 +5859,7 @@ func InitDbWithDeSoGenesisBlock(params *DeSoParams, handle *badger.DB,
 			return errors.Wrapf(err, "InitDbWithGenesisBlock: Problem putting genesis block hash into db for block chain")
 		}
 		// Add the genesis block to the (hash -> block) index.
-		if err := PutBlockWithTxn(txn, snap, genesisBlock, eventManager); err != nil {
+		if err := PutBlockWithTxn(txn, snap, genesisBlock, nil, eventManager); err != nil {
 			return errors.Wrapf(err, "InitDbWithGenesisBlock: Problem putting genesis block into db")
 		}
 		// Add the genesis block to the (height, hash -> node info) index in the db.
@@ -5341,6 +5876,9 @@ func InitDbWithDeSoGenesisBlock(params *DeSoParams, handle *badger.DB,
 		if snap == nil {
 			return nil
 		}
+		if err := snap.FlushStateCommitmentWithTxn(txn, blockHash); err != nil {
+			return errors.Wrapf(err, "InitDbWithGenesisBlock: Problem flushing state commitment")
+		}
 		if err := snap.FlushAncestralRecordsWithTxn(txn); err != nil {
 			return errors.Wrapf(err, "InitDbWithGenesisBlock: Problem flushing ancestral records")
 		}
@@ -7091,6 +7629,10 @@ type TransactionMetadata struct {
 	CoinLockupTransferTxindexMetadata     *CoinLockupTransferTxindexMetadata     `json:",omitempty"`
 	CoinUnlockTxindexMetadata             *CoinUnlockTxindexMetadata             `json:",omitempty"`
 	AtomicTxnsWrapperTxindexMetadata      *AtomicTxnsWrapperTxindexMetadata      `json:",omitempty"`
+
+	// ExtractedTxindexMetadata holds the output of the registered TxindexMetadataExtractors, in the
+	// order they were registered. See txindex_metadata_extractors.go.
+	ExtractedTxindexMetadata []*ExtractedTxindexMetadata `json:",omitempty"`
 }
 
 func (txnMeta *TransactionMetadata) GetEncoderForTxType(txnType TxnType) DeSoEncoder {
@@ -7272,6 +7814,14 @@ func (txnMeta *TransactionMetadata) RawEncodeWithoutMetadata(blockHeight uint64,
 		data = append(data, EncodeToBytes(blockHeight, txnMeta.AtomicTxnsWrapperTxindexMetadata, skipMetadata...)...)
 	}
 
+	if MigrationTriggered(blockHeight, TxindexExtractedMetadataMigration) {
+		// encoding ExtractedTxindexMetadata
+		data = append(data, UintToBuf(uint64(len(txnMeta.ExtractedTxindexMetadata)))...)
+		for _, extractedMetadata := range txnMeta.ExtractedTxindexMetadata {
+			data = append(data, EncodeToBytes(blockHeight, extractedMetadata, skipMetadata...)...)
+		}
+	}
+
 	return data
 }
 
@@ -7552,11 +8102,27 @@ func (txnMeta *TransactionMetadata) RawDecodeWithoutMetadata(blockHeight uint64,
 		}
 	}
 
+	if MigrationTriggered(blockHeight, TxindexExtractedMetadataMigration) {
+		// decoding ExtractedTxindexMetadata
+		numExtractedMetadata, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "TransactionMetadata.Decode: Problem reading len ExtractedTxindexMetadata")
+		}
+		for ii := uint64(0); ii < numExtractedMetadata; ii++ {
+			extractedMetadata, err := DecodeDeSoEncoder(&ExtractedTxindexMetadata{}, rr)
+			if err != nil {
+				return errors.Wrapf(err, "TransactionMetadata.Decode: Problem reading ExtractedTxindexMetadata")
+			}
+			txnMeta.ExtractedTxindexMetadata = append(txnMeta.ExtractedTxindexMetadata, extractedMetadata)
+		}
+	}
+
 	return nil
 }
 
 func (txnMeta *TransactionMetadata) GetVersionByte(blockHeight uint64) byte {
-	return GetMigrationVersion(blockHeight, AssociationsAndAccessGroupsMigration, ProofOfStake1StateSetupMigration)
+	return GetMigrationVersion(blockHeight, AssociationsAndAccessGroupsMigration, ProofOfStake1StateSetupMigration,
+		TxindexExtractedMetadataMigration)
 }
 
 func (txnMeta *TransactionMetadata) GetEncoderType() EncoderType {
@@ -7770,6 +8336,416 @@ func DbGetTxindexFullTransactionByTxID(txindexDBHandle *badger.DB, snap *Snapsho
 	return txnFound, txnMeta
 }
 
+func _dbKeyForUsernameHistoryByUsername(lowercaseUsername []byte) []byte {
+	return append(append([]byte{}, Prefixes.PrefixUsernameHistoryByUsernameAndHeight...),
+		EncodeByteArray(lowercaseUsername)...)
+}
+
+func _dbKeyForUsernameHistoryByUsernameAndHeight(lowercaseUsername []byte, blockHeight uint64) []byte {
+	return append(_dbKeyForUsernameHistoryByUsername(lowercaseUsername), EncodeUint64(blockHeight)...)
+}
+
+func _dbKeyForUsernameHistoryByHeight(blockHeight uint64) []byte {
+	return append(append([]byte{}, Prefixes.PrefixUsernameHistoryByHeightAndUsername...),
+		EncodeUint64(blockHeight)...)
+}
+
+func _dbKeyForUsernameHistoryByHeightAndUsername(blockHeight uint64, lowercaseUsername []byte) []byte {
+	return append(_dbKeyForUsernameHistoryByHeight(blockHeight), EncodeByteArray(lowercaseUsername)...)
+}
+
+// DbPutTxindexUsernameHistoryWithTxn records that the username was held by the PKID as of the block height. A nil
+// PKID records that the username was released. Writing a record for a username and height that already has one
+// overwrites it, so the record reflects the state at the end of the block.
+func DbPutTxindexUsernameHistoryWithTxn(txn *badger.Txn, snap *Snapshot, username []byte, blockHeight uint64,
+	pkid *PKID, eventManager *EventManager) error {
+
+	lowercaseUsername := []byte(strings.ToLower(string(username)))
+	var pkidBytes []byte
+	if pkid != nil {
+		pkidBytes = pkid.ToBytes()
+	}
+	if err := DBSetWithTxn(txn, snap, _dbKeyForUsernameHistoryByUsernameAndHeight(lowercaseUsername, blockHeight),
+		pkidBytes, eventManager); err != nil {
+		return errors.Wrapf(err, "DbPutTxindexUsernameHistoryWithTxn: Problem putting username history record")
+	}
+	if err := DBSetWithTxn(txn, snap, _dbKeyForUsernameHistoryByHeightAndUsername(blockHeight, lowercaseUsername),
+		[]byte{}, eventManager); err != nil {
+		return errors.Wrapf(err, "DbPutTxindexUsernameHistoryWithTxn: Problem putting username history height index")
+	}
+	return nil
+}
+
+// DbDeleteTxindexUsernameHistoryForHeightWithTxn deletes all of the username history records written at the block
+// height. It's called when the txindex detaches a block.
+func DbDeleteTxindexUsernameHistoryForHeightWithTxn(txn *badger.Txn, snap *Snapshot, blockHeight uint64,
+	eventManager *EventManager, entryIsDeleted bool) error {
+
+	heightPrefix := _dbKeyForUsernameHistoryByHeight(blockHeight)
+	keysFound, _, err := _enumerateKeysForPrefixWithTxn(txn, heightPrefix, true)
+	if err != nil {
+		return errors.Wrapf(err, "DbDeleteTxindexUsernameHistoryForHeightWithTxn: Problem enumerating records")
+	}
+	for _, keyFound := range keysFound {
+		lowercaseUsername, err := DecodeByteArray(bytes.NewReader(keyFound[len(heightPrefix):]))
+		if err != nil {
+			return errors.Wrapf(err, "DbDeleteTxindexUsernameHistoryForHeightWithTxn: Problem decoding username")
+		}
+		if err = DBDeleteWithTxn(txn, snap, _dbKeyForUsernameHistoryByUsernameAndHeight(lowercaseUsername, blockHeight),
+			eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(err, "DbDeleteTxindexUsernameHistoryForHeightWithTxn: Problem deleting record")
+		}
+		if err = DBDeleteWithTxn(txn, snap, keyFound, eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(err, "DbDeleteTxindexUsernameHistoryForHeightWithTxn: Problem deleting height index")
+		}
+	}
+	return nil
+}
+
+// DbGetTxindexPKIDForUsernameAtHeightWithTxn returns the PKID that held the username as of the block height, i.e.
+// after the block at that height was connected. It returns nil if the username wasn't held by anyone at the time.
+func DbGetTxindexPKIDForUsernameAtHeightWithTxn(txn *badger.Txn, username []byte, blockHeight uint64) (*PKID, error) {
+	lowercaseUsername := []byte(strings.ToLower(string(username)))
+	usernamePrefix := _dbKeyForUsernameHistoryByUsername(lowercaseUsername)
+
+	// Seek backwards from the height to find the latest record at or before it.
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	opts.Prefix = usernamePrefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	it.Seek(_dbKeyForUsernameHistoryByUsernameAndHeight(lowercaseUsername, blockHeight))
+	if !it.ValidForPrefix(usernamePrefix) {
+		return nil, nil
+	}
+	pkidBytes, err := it.Item().ValueCopy(nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DbGetTxindexPKIDForUsernameAtHeightWithTxn: Problem reading record")
+	}
+	if len(pkidBytes) == 0 {
+		return nil, nil
+	}
+	return NewPKID(pkidBytes), nil
+}
+
+func DbGetTxindexPKIDForUsernameAtHeight(handle *badger.DB, username []byte, blockHeight uint64) (*PKID, error) {
+	var pkid *PKID
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		pkid, err = DbGetTxindexPKIDForUsernameAtHeightWithTxn(txn, username, blockHeight)
+		return err
+	})
+	return pkid, err
+}
+
+// TxindexDiamondRecord is a diamond txn as recorded by the txindex. PrevDiamondLevel is the level of the sender's
+// diamond on the post before the txn, and is only set on the records returned for a block height.
+type TxindexDiamondRecord struct {
+	SenderPKID       *PKID
+	ReceiverPKID     *PKID
+	DiamondPostHash  *BlockHash
+	DiamondLevel     int64
+	PrevDiamondLevel int64
+	BlockHeight      uint64
+}
+
+func _dbKeyForTxindexDiamondsByReceiver(receiverPKID *PKID) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxindexDiamondsByReceiverLevelHeight...), receiverPKID[:]...)
+}
+
+func _dbKeyForTxindexDiamondsByReceiverAndLevel(receiverPKID *PKID, diamondLevel int64) []byte {
+	return append(_dbKeyForTxindexDiamondsByReceiver(receiverPKID), EncodeUint64(uint64(diamondLevel))...)
+}
+
+func _dbKeyForTxindexDiamondByReceiver(record *TxindexDiamondRecord) []byte {
+	key := _dbKeyForTxindexDiamondsByReceiverAndLevel(record.ReceiverPKID, record.DiamondLevel)
+	key = append(key, EncodeUint64(record.BlockHeight)...)
+	key = append(key, record.SenderPKID[:]...)
+	return append(key, record.DiamondPostHash[:]...)
+}
+
+func _dbKeyForTxindexDiamondsBySender(senderPKID *PKID) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxindexDiamondsBySenderHeight...), senderPKID[:]...)
+}
+
+func _dbKeyForTxindexDiamondBySender(record *TxindexDiamondRecord) []byte {
+	key := append(_dbKeyForTxindexDiamondsBySender(record.SenderPKID), EncodeUint64(record.BlockHeight)...)
+	return append(key, record.DiamondPostHash[:]...)
+}
+
+func _dbKeyForTxindexDiamondsByHeight(blockHeight uint64) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxindexDiamondsByHeight...), EncodeUint64(blockHeight)...)
+}
+
+func _dbKeyForTxindexDiamondByHeight(record *TxindexDiamondRecord) []byte {
+	key := append(_dbKeyForTxindexDiamondsByHeight(record.BlockHeight), record.SenderPKID[:]...)
+	return append(key, record.DiamondPostHash[:]...)
+}
+
+func _dbKeyForTxindexPostDiamondCounts(postHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxindexPostDiamondCounts...), postHash[:]...)
+}
+
+func _dbKeyForTxindexPostDiamondCount(postHash *BlockHash, diamondLevel int64) []byte {
+	return append(_dbKeyForTxindexPostDiamondCounts(postHash), EncodeUint64(uint64(diamondLevel))...)
+}
+
+// _dbAddToTxindexPostDiamondCountWithTxn adds delta to the number of senders whose diamond on the post is at the
+// level. The count is deleted once it drops to zero.
+func _dbAddToTxindexPostDiamondCountWithTxn(txn *badger.Txn, snap *Snapshot, postHash *BlockHash,
+	diamondLevel int64, delta int64, eventManager *EventManager) error {
+
+	if diamondLevel <= 0 {
+		return nil
+	}
+	key := _dbKeyForTxindexPostDiamondCount(postHash, diamondLevel)
+	var count uint64
+	countBytes, err := DBGetWithTxn(txn, snap, key)
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return errors.Wrapf(err, "_dbAddToTxindexPostDiamondCountWithTxn: Problem getting count")
+	}
+	if err == nil {
+		count = DecodeUint64(countBytes)
+	}
+	if delta < 0 && count < uint64(-delta) {
+		return fmt.Errorf("_dbAddToTxindexPostDiamondCountWithTxn: Count %d for post %v at level %d "+
+			"would go below zero", count, postHash, diamondLevel)
+	}
+	count = uint64(int64(count) + delta)
+	if count == 0 {
+		return DBDeleteWithTxn(txn, snap, key, eventManager, true)
+	}
+	return DBSetWithTxn(txn, snap, key, EncodeUint64(count), eventManager)
+}
+
+func _decodeTxindexDiamondRecordByHeight(key []byte, value []byte) (*TxindexDiamondRecord, error) {
+	heightPrefixLen := len(Prefixes.PrefixTxindexDiamondsByHeight) + 8
+	if len(key) != heightPrefixLen+PublicKeyLenCompressed+HashSizeBytes ||
+		len(value) != PublicKeyLenCompressed+16 {
+		return nil, fmt.Errorf("_decodeTxindexDiamondRecordByHeight: Invalid key length %d or value length %d",
+			len(key), len(value))
+	}
+	postHash := &BlockHash{}
+	copy(postHash[:], key[heightPrefixLen+PublicKeyLenCompressed:])
+	return &TxindexDiamondRecord{
+		SenderPKID:       NewPKID(key[heightPrefixLen : heightPrefixLen+PublicKeyLenCompressed]),
+		ReceiverPKID:     NewPKID(value[:PublicKeyLenCompressed]),
+		DiamondPostHash:  postHash,
+		DiamondLevel:     int64(DecodeUint64(value[PublicKeyLenCompressed : PublicKeyLenCompressed+8])),
+		PrevDiamondLevel: int64(DecodeUint64(value[PublicKeyLenCompressed+8:])),
+		BlockHeight:      DecodeUint64(key[len(Prefixes.PrefixTxindexDiamondsByHeight):heightPrefixLen]),
+	}, nil
+}
+
+// DbPutTxindexDiamondWithTxn records a diamond txn and moves the sender's diamond on the post from the record's
+// PrevDiamondLevel to its DiamondLevel in the post's diamond counts. If the sender already gave a diamond on the
+// post earlier in the same block, the earlier record is replaced, so a block has at most one record per sender
+// and post.
+func DbPutTxindexDiamondWithTxn(txn *badger.Txn, snap *Snapshot, record *TxindexDiamondRecord,
+	eventManager *EventManager) error {
+
+	recordToPut := *record
+	existingValue, err := DBGetWithTxn(txn, snap, _dbKeyForTxindexDiamondByHeight(record))
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem getting existing record")
+	}
+	if err == nil {
+		existingRecord, err := _decodeTxindexDiamondRecordByHeight(_dbKeyForTxindexDiamondByHeight(record),
+			existingValue)
+		if err != nil {
+			return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem decoding existing record")
+		}
+		if err = DBDeleteWithTxn(txn, snap, _dbKeyForTxindexDiamondByReceiver(existingRecord),
+			eventManager, true); err != nil {
+			return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem deleting existing record")
+		}
+		recordToPut.PrevDiamondLevel = existingRecord.PrevDiamondLevel
+	}
+
+	if err = _dbAddToTxindexPostDiamondCountWithTxn(txn, snap, record.DiamondPostHash,
+		record.PrevDiamondLevel, -1, eventManager); err != nil {
+		return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem decrementing previous level count")
+	}
+	if err = _dbAddToTxindexPostDiamondCountWithTxn(txn, snap, record.DiamondPostHash,
+		record.DiamondLevel, 1, eventManager); err != nil {
+		return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem incrementing level count")
+	}
+
+	if err = DBSetWithTxn(txn, snap, _dbKeyForTxindexDiamondByReceiver(&recordToPut), []byte{},
+		eventManager); err != nil {
+		return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem putting receiver index")
+	}
+	senderValue := append(append([]byte{}, recordToPut.ReceiverPKID[:]...),
+		EncodeUint64(uint64(recordToPut.DiamondLevel))...)
+	if err = DBSetWithTxn(txn, snap, _dbKeyForTxindexDiamondBySender(&recordToPut), senderValue,
+		eventManager); err != nil {
+		return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem putting sender index")
+	}
+	heightValue := append(append([]byte{}, senderValue...), EncodeUint64(uint64(recordToPut.PrevDiamondLevel))...)
+	if err = DBSetWithTxn(txn, snap, _dbKeyForTxindexDiamondByHeight(&recordToPut), heightValue,
+		eventManager); err != nil {
+		return errors.Wrapf(err, "DbPutTxindexDiamondWithTxn: Problem putting height index")
+	}
+	return nil
+}
+
+// DbDeleteTxindexDiamondsForHeightWithTxn deletes all of the diamond records written at the block height and
+// reverts the post diamond counts they changed. It's called when the txindex detaches a block.
+func DbDeleteTxindexDiamondsForHeightWithTxn(txn *badger.Txn, snap *Snapshot, blockHeight uint64,
+	eventManager *EventManager, entryIsDeleted bool) error {
+
+	keysFound, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, _dbKeyForTxindexDiamondsByHeight(blockHeight),
+		false)
+	if err != nil {
+		return errors.Wrapf(err, "DbDeleteTxindexDiamondsForHeightWithTxn: Problem enumerating records")
+	}
+	for ii, keyFound := range keysFound {
+		record, err := _decodeTxindexDiamondRecordByHeight(keyFound, valsFound[ii])
+		if err != nil {
+			return errors.Wrapf(err, "DbDeleteTxindexDiamondsForHeightWithTxn: Problem decoding record")
+		}
+		if err = _dbAddToTxindexPostDiamondCountWithTxn(txn, snap, record.DiamondPostHash,
+			record.DiamondLevel, -1, eventManager); err != nil {
+			return errors.Wrapf(err, "DbDeleteTxindexDiamondsForHeightWithTxn: Problem decrementing level count")
+		}
+		if err = _dbAddToTxindexPostDiamondCountWithTxn(txn, snap, record.DiamondPostHash,
+			record.PrevDiamondLevel, 1, eventManager); err != nil {
+			return errors.Wrapf(err, "DbDeleteTxindexDiamondsForHeightWithTxn: Problem restoring previous level count")
+		}
+		for _, key := range [][]byte{
+			_dbKeyForTxindexDiamondByReceiver(record),
+			_dbKeyForTxindexDiamondBySender(record),
+			keyFound,
+		} {
+			if err = DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+				return errors.Wrapf(err, "DbDeleteTxindexDiamondsForHeightWithTxn: Problem deleting record")
+			}
+		}
+	}
+	return nil
+}
+
+// DbGetTxindexDiamondsReceived returns up to limit of the diamonds the PKID received, sorted by level and then by
+// height, starting after the startAfter record. A diamondLevel of zero returns the diamonds of every level, and a
+// nil startAfter starts from the first record.
+func DbGetTxindexDiamondsReceived(handle *badger.DB, receiverPKID *PKID, diamondLevel int64,
+	startAfter *TxindexDiamondRecord, limit uint32) (_records []*TxindexDiamondRecord, _err error) {
+
+	prefix := _dbKeyForTxindexDiamondsByReceiver(receiverPKID)
+	if diamondLevel > 0 {
+		prefix = _dbKeyForTxindexDiamondsByReceiverAndLevel(receiverPKID, diamondLevel)
+	}
+	startKey := prefix
+	if startAfter != nil {
+		startKey = _dbKeyForTxindexDiamondByReceiver(startAfter)
+	}
+
+	var keysFound [][]byte
+	err := handle.View(func(txn *badger.Txn) error {
+		// We fetch one extra key in case the first key is the start key, which we skip.
+		keysFound = _enumeratePaginatedLimitedKeysForPrefixWithTxn(txn, prefix, startKey, limit+1)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DbGetTxindexDiamondsReceived: Problem fetching records: ")
+	}
+	if startAfter != nil && len(keysFound) > 0 && bytes.Equal(keysFound[0], startKey) {
+		keysFound = keysFound[1:]
+	}
+	if uint32(len(keysFound)) > limit {
+		keysFound = keysFound[:limit]
+	}
+
+	receiverPrefixLen := len(Prefixes.PrefixTxindexDiamondsByReceiverLevelHeight) + PublicKeyLenCompressed
+	records := []*TxindexDiamondRecord{}
+	for _, keyBytes := range keysFound {
+		rest := keyBytes[receiverPrefixLen:]
+		if len(rest) != 16+PublicKeyLenCompressed+HashSizeBytes {
+			return nil, fmt.Errorf("DbGetTxindexDiamondsReceived: Invalid key length %d", len(keyBytes))
+		}
+		postHash := &BlockHash{}
+		copy(postHash[:], rest[16+PublicKeyLenCompressed:])
+		records = append(records, &TxindexDiamondRecord{
+			SenderPKID:      NewPKID(rest[16 : 16+PublicKeyLenCompressed]),
+			ReceiverPKID:    receiverPKID.NewPKID(),
+			DiamondPostHash: postHash,
+			DiamondLevel:    int64(DecodeUint64(rest[:8])),
+			BlockHeight:     DecodeUint64(rest[8:16]),
+		})
+	}
+	return records, nil
+}
+
+// DbGetTxindexDiamondsGiven returns up to limit of the diamonds the PKID gave, sorted by height, starting after the
+// startAfter record. A nil startAfter starts from the first record.
+func DbGetTxindexDiamondsGiven(handle *badger.DB, senderPKID *PKID, startAfter *TxindexDiamondRecord,
+	limit uint32) (_records []*TxindexDiamondRecord, _err error) {
+
+	prefix := _dbKeyForTxindexDiamondsBySender(senderPKID)
+	startKey := prefix
+	if startAfter != nil {
+		startKey = _dbKeyForTxindexDiamondBySender(startAfter)
+	}
+
+	records := []*TxindexDiamondRecord{}
+	err := handle.View(func(txn *badger.Txn) error {
+		// We fetch one extra key in case the first key is the start key, which we skip.
+		keyLen := len(prefix) + 8 + HashSizeBytes
+		keysFound, valsFound, err := DBGetPaginatedKeysAndValuesForPrefixWithTxn(
+			txn, startKey, prefix, keyLen, int(limit)+1, false, true)
+		if err != nil {
+			return err
+		}
+		for ii, keyBytes := range keysFound {
+			if startAfter != nil && ii == 0 && bytes.Equal(keyBytes, startKey) {
+				continue
+			}
+			if uint32(len(records)) >= limit {
+				break
+			}
+			rest := keyBytes[len(prefix):]
+			if len(valsFound[ii]) != PublicKeyLenCompressed+8 {
+				return fmt.Errorf("Invalid value length %d", len(valsFound[ii]))
+			}
+			postHash := &BlockHash{}
+			copy(postHash[:], rest[8:])
+			records = append(records, &TxindexDiamondRecord{
+				SenderPKID:      senderPKID.NewPKID(),
+				ReceiverPKID:    NewPKID(valsFound[ii][:PublicKeyLenCompressed]),
+				DiamondPostHash: postHash,
+				DiamondLevel:    int64(DecodeUint64(valsFound[ii][PublicKeyLenCompressed:])),
+				BlockHeight:     DecodeUint64(rest[:8]),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DbGetTxindexDiamondsGiven: Problem fetching records: ")
+	}
+	return records, nil
+}
+
+// DbGetTxindexPostDiamondCounts returns the number of senders whose diamond on the post is at each level. Levels
+// that no sender's diamond is at are left out.
+func DbGetTxindexPostDiamondCounts(handle *badger.DB, postHash *BlockHash) (map[int64]uint64, error) {
+	prefix := _dbKeyForTxindexPostDiamondCounts(postHash)
+	counts := make(map[int64]uint64)
+	err := handle.View(func(txn *badger.Txn) error {
+		keysFound, valsFound, err := _enumerateKeysForPrefixWithTxn(txn, prefix, false)
+		if err != nil {
+			return err
+		}
+		for ii, keyBytes := range keysFound {
+			counts[int64(DecodeUint64(keyBytes[len(prefix):]))] = DecodeUint64(valsFound[ii])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DbGetTxindexPostDiamondCounts: Problem fetching counts: ")
+	}
+	return counts, nil
+}
+
 // =======================================================================================
 // DeSo app code start
 // =======================================================================================
@@ -8255,6 +9231,20 @@ func DBGetCommentPostHashesForParentStakeID(
 	return tstampsFetched, commentPostHashes, commentEntriesFetched, nil
 }
 
+// DBGetReplyPostHashesForPostHash returns the hashes of the direct replies to a post, ordered by their
+// timestamps. Replies are comments whose ParentStakeID is the post's hash, which the comment index stores
+// extended to the length of a public key.
+func DBGetReplyPostHashesForPostHash(handle *badger.DB, snap *Snapshot, postHash *BlockHash) (
+	_replyPostHashes []*BlockHash, _err error) {
+
+	extendedStakeID := append(append([]byte{}, postHash[:]...), 0x00)
+	_, replyPostHashes, _, err := DBGetCommentPostHashesForParentStakeID(handle, snap, extendedStakeID, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetReplyPostHashesForPostHash: ")
+	}
+	return replyPostHashes, nil
+}
+
 // =======================================================================================
 // NFTEntry db functions
 // =======================================================================================
@@ -9593,6 +10583,33 @@ func DBGetProfilesByUsernamePrefixAndDeSoLocked(db *badger.DB,
 	return profilesFound, nil
 }
 
+// DBGetUsernamesByPrefix scans the PrefixProfileUsernameToPKID index for lowercase usernames starting with
+// lowercaseUsernamePrefix. Since the index is keyed by the lowercase username, badger's lexicographic key
+// ordering makes it a prefix index, and the results are returned in lexicographic order. If numToFetch is
+// zero, all matching usernames are returned.
+func DBGetUsernamesByPrefix(handle *badger.DB, snap *Snapshot, lowercaseUsernamePrefix string, numToFetch int) (
+	_lowercaseUsernames []string, _pkids []*PKID, _err error) {
+
+	prefix := _dbKeyForProfileUsernameToPKID([]byte(lowercaseUsernamePrefix))
+	keysFound, valsFound, err := DBGetPaginatedKeysAndValuesForPrefix(
+		handle, prefix, prefix, 0, numToFetch, false, true)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "DBGetUsernamesByPrefix: ")
+	}
+
+	var lowercaseUsernames []string
+	var pkids []*PKID
+	for ii, keyBytes := range keysFound {
+		if len(valsFound[ii]) != btcec.PubKeyBytesLenCompressed {
+			continue
+		}
+		lowercaseUsernames = append(lowercaseUsernames,
+			string(keyBytes[len(Prefixes.PrefixProfileUsernameToPKID):]))
+		pkids = append(pkids, PublicKeyToPKID(valsFound[ii]))
+	}
+	return lowercaseUsernames, pkids, nil
+}
+
 // DBGetPaginatedProfilesByDeSoLocked returns up to 'numToFetch' profiles from the db.
 func DBGetPaginatedProfilesByDeSoLocked(
 	db *badger.DB, snap *Snapshot, startDeSoLockedNanos uint64,
@@ -10144,9 +11161,11 @@ func PerformanceBadgerOptions(dir string) badger.Options {
 	return opts
 }
 
+// DefaultBadgerOptions are the options every DB opened by the node starts from. They encrypt the DB if a key
+// was set with SetDataEncryptionKey.
 func DefaultBadgerOptions(dir string) badger.Options {
 	opts := badger.DefaultOptions(dir).WithLoggingLevel(badger.WARNING)
-	return opts
+	return withDataEncryption(opts)
 }
 
 // ---------------------------------------------
@@ -10934,6 +11953,224 @@ func DBDeletePostAssociationWithTxn(txn *badger.Txn, snap *Snapshot, association
 	return nil
 }
 
+// -------------------------------------------------------------------------------------
+// Post association count functions
+// 		<prefix_id, PostHash [32]byte, AssociationType + NULL, AssociationValue + NULL> -> <Count uvarint>
+// -------------------------------------------------------------------------------------
+
+// postAssociationCountsRebuildBatchSize is the number of counts written per badger transaction when the post
+// association counts are rebuilt.
+const postAssociationCountsRebuildBatchSize = 1000
+
+// _dbPrefixForPostAssociationCounts returns the prefix of the counts of a post, or of the counts of a post with an
+// AssociationType if associationType isn't empty.
+func _dbPrefixForPostAssociationCounts(postHash *BlockHash, associationType []byte) []byte {
+	// Make a copy to avoid multiple calls to this function re-using the same slice.
+	key := append([]byte{}, Prefixes.PrefixPostAssociationCountsByPostTypeValue...)
+	key = append(key, postHash.ToBytes()...)
+	if len(associationType) > 0 {
+		key = append(key, bytes.ToLower(associationType)...)
+		key = append(key, AssociationNullTerminator)
+	}
+	return key
+}
+
+func _dbKeyForPostAssociationCountEntry(postHash *BlockHash, associationType []byte, associationValue []byte) []byte {
+	key := _dbPrefixForPostAssociationCounts(postHash, associationType)
+	key = append(key, associationValue...)
+	return append(key, AssociationNullTerminator)
+}
+
+// _decodePostAssociationCountEntry decodes a count stored under PrefixPostAssociationCountsByPostTypeValue.
+func _decodePostAssociationCountEntry(key []byte, value []byte) (*PostAssociationCountEntry, error) {
+	prefixLen := len(Prefixes.PrefixPostAssociationCountsByPostTypeValue)
+	if len(key) < prefixLen+HashSizeBytes {
+		return nil, fmt.Errorf("_decodePostAssociationCountEntry: Key %x is too short", key)
+	}
+	postHash := NewBlockHash(key[prefixLen : prefixLen+HashSizeBytes])
+	fields := bytes.Split(key[prefixLen+HashSizeBytes:], []byte{AssociationNullTerminator})
+	if len(fields) != 3 || len(fields[2]) != 0 {
+		return nil, fmt.Errorf("_decodePostAssociationCountEntry: Key %x doesn't have a type and a value", key)
+	}
+	count, err := ReadUvarint(bytes.NewReader(value))
+	if err != nil {
+		return nil, errors.Wrapf(err, "_decodePostAssociationCountEntry: Problem reading Count: ")
+	}
+	return &PostAssociationCountEntry{
+		PostHash:         postHash,
+		AssociationType:  fields[0],
+		AssociationValue: fields[1],
+		Count:            count,
+	}, nil
+}
+
+// DbGetPostAssociationCountEntryWithTxn returns the number of associations on the post with the AssociationType and
+// the AssociationValue. Posts without such associations have a zero count.
+func DbGetPostAssociationCountEntryWithTxn(txn *badger.Txn, postHash *BlockHash, associationType []byte,
+	associationValue []byte) (*PostAssociationCountEntry, error) {
+
+	countEntry := &PostAssociationCountEntry{
+		PostHash:         postHash.NewBlockHash(),
+		AssociationType:  bytes.ToLower(associationType),
+		AssociationValue: append([]byte{}, associationValue...),
+	}
+	countBytes, err := DBGetWithTxn(txn, nil, _dbKeyForPostAssociationCountEntry(postHash, associationType,
+		associationValue))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return countEntry, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DbGetPostAssociationCountEntryWithTxn: Problem getting count: ")
+	}
+	if countEntry.Count, err = ReadUvarint(bytes.NewReader(countBytes)); err != nil {
+		return nil, errors.Wrapf(err, "DbGetPostAssociationCountEntryWithTxn: Problem reading Count: ")
+	}
+	return countEntry, nil
+}
+
+func DbGetPostAssociationCountEntry(handle *badger.DB, postHash *BlockHash, associationType []byte,
+	associationValue []byte) (*PostAssociationCountEntry, error) {
+
+	var countEntry *PostAssociationCountEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		countEntry, err = DbGetPostAssociationCountEntryWithTxn(txn, postHash, associationType, associationValue)
+		return err
+	})
+	return countEntry, err
+}
+
+// DbGetPostAssociationCountEntriesForPost returns the nonzero counts of the post, sorted by AssociationType and
+// AssociationValue. If associationType isn't empty, only the counts with that AssociationType are returned.
+func DbGetPostAssociationCountEntriesForPost(handle *badger.DB, postHash *BlockHash, associationType []byte) (
+	[]*PostAssociationCountEntry, error) {
+
+	prefix := _dbPrefixForPostAssociationCounts(postHash, associationType)
+	keysFound, valsFound := _enumerateKeysForPrefix(handle, prefix, false)
+	var countEntries []*PostAssociationCountEntry
+	for ii, keyBytes := range keysFound {
+		countEntry, err := _decodePostAssociationCountEntry(keyBytes, valsFound[ii])
+		if err != nil {
+			return nil, errors.Wrapf(err, "DbGetPostAssociationCountEntriesForPost: ")
+		}
+		countEntries = append(countEntries, countEntry)
+	}
+	return countEntries, nil
+}
+
+// DbPutPostAssociationCountEntryWithTxn sets a post association count. The key is deleted once the count is zero.
+// Like the follow counts, the counts aren't DeSoEncoders, so they aren't passed to the state syncer.
+func DbPutPostAssociationCountEntryWithTxn(txn *badger.Txn, countEntry *PostAssociationCountEntry) error {
+	key := _dbKeyForPostAssociationCountEntry(countEntry.PostHash, countEntry.AssociationType,
+		countEntry.AssociationValue)
+	if countEntry.Count == 0 {
+		return errors.Wrapf(DBDeleteWithTxn(txn, nil, key, nil, true),
+			"DbPutPostAssociationCountEntryWithTxn: Problem deleting count: ")
+	}
+	return errors.Wrapf(DBSetWithTxn(txn, nil, key, UintToBuf(countEntry.Count), nil),
+		"DbPutPostAssociationCountEntryWithTxn: Problem setting count: ")
+}
+
+// DbBuildPostAssociationCountsIfMissing builds the post association counts from the post associations unless
+// they've already been built. Once built, the counts are kept up to date by the UtxoView as post associations are
+// connected and disconnected, so this only does work the first time a node that predates the counts starts.
+func DbBuildPostAssociationCountsIfMissing(handle *badger.DB) error {
+	isBuilt := false
+	err := handle.View(func(txn *badger.Txn) error {
+		_, err := DBGetWithTxn(txn, nil, Prefixes.PrefixPostAssociationCountsByPostTypeValue)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		isBuilt = err == nil
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbBuildPostAssociationCountsIfMissing: Problem checking for counts: ")
+	}
+	if isBuilt {
+		return nil
+	}
+	return DbRebuildPostAssociationCounts(handle)
+}
+
+// DbRebuildPostAssociationCounts replaces the post association counts with counts computed from the post
+// associations. It's used when the post associations were written without the counts, e.g. by a hypersync.
+func DbRebuildPostAssociationCounts(handle *badger.DB) error {
+	glog.Infof("DbRebuildPostAssociationCounts: Building post association counts from the post associations")
+	if err := handle.DropPrefix(Prefixes.PrefixPostAssociationCountsByPostTypeValue); err != nil {
+		return errors.Wrapf(err, "DbRebuildPostAssociationCounts: Problem deleting existing counts: ")
+	}
+
+	var countKeys [][]byte
+	var counts []uint64
+	flushCounts := func() error {
+		err := handle.Update(func(txn *badger.Txn) error {
+			for ii, countKey := range countKeys {
+				if err := DBSetWithTxn(txn, nil, countKey, UintToBuf(counts[ii]), nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		countKeys, counts = nil, nil
+		return err
+	}
+
+	// The PrefixPostAssociationByPost keys start with the PostHash, the lowercase AssociationType, and the
+	// AssociationValue, which is the layout of the count keys. Since they're sorted, all of the associations of a
+	// count are next to each other.
+	mappingPrefix := Prefixes.PrefixPostAssociationByPost
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = mappingPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(mappingPrefix); it.ValidForPrefix(mappingPrefix); it.Next() {
+			key := it.Item().Key()
+			typeStart := len(mappingPrefix) + HashSizeBytes
+			typeEnd := bytes.IndexByte(key[typeStart:], AssociationNullTerminator)
+			if typeEnd < 0 {
+				return fmt.Errorf("Post association key %x doesn't have a type", key)
+			}
+			valueStart := typeStart + typeEnd + 1
+			valueEnd := bytes.IndexByte(key[valueStart:], AssociationNullTerminator)
+			if valueEnd < 0 {
+				return fmt.Errorf("Post association key %x doesn't have a value", key)
+			}
+			countKey := append(append([]byte{}, Prefixes.PrefixPostAssociationCountsByPostTypeValue...),
+				key[len(mappingPrefix):valueStart+valueEnd+1]...)
+			if len(countKeys) > 0 && bytes.Equal(countKeys[len(countKeys)-1], countKey) {
+				counts[len(counts)-1]++
+				continue
+			}
+			if len(countKeys) >= postAssociationCountsRebuildBatchSize {
+				if err := flushCounts(); err != nil {
+					return err
+				}
+			}
+			countKeys = append(countKeys, countKey)
+			counts = append(counts, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "DbRebuildPostAssociationCounts: Problem counting post associations: ")
+	}
+	if err = flushCounts(); err != nil {
+		return errors.Wrapf(err, "DbRebuildPostAssociationCounts: Problem writing counts: ")
+	}
+
+	// Mark the counts as built.
+	if err = handle.Update(func(txn *badger.Txn) error {
+		return DBSetWithTxn(txn, nil, Prefixes.PrefixPostAssociationCountsByPostTypeValue, []byte{}, nil)
+	}); err != nil {
+		return errors.Wrapf(err, "DbRebuildPostAssociationCounts: Problem marking counts as built: ")
+	}
+	glog.Infof("DbRebuildPostAssociationCounts: Finished building post association counts")
+	return nil
+}
+
 // -------------------------------------------------------------------------------------
 // Lockup DB Operations
 // -------------------------------------------------------------------------------------
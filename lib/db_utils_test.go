@@ -606,6 +606,153 @@ func TestFollows(t *testing.T) {
 	}
 }
 
+func TestTxindexUsernameHistory(t *testing.T) {
+	require := require.New(t)
+
+	// Create a test db and clean up the files at the end.
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	pkid1 := NewPKID(RandomBytes(33))
+	pkid2 := NewPKID(RandomBytes(33))
+
+	putRecord := func(username string, blockHeight uint64, pkid *PKID) {
+		require.NoError(db.Update(func(txn *badger.Txn) error {
+			return DbPutTxindexUsernameHistoryWithTxn(txn, nil, []byte(username), blockHeight, pkid, nil)
+		}))
+	}
+	requirePKID := func(username string, blockHeight uint64, expectedPKID *PKID) {
+		pkid, err := DbGetTxindexPKIDForUsernameAtHeight(db, []byte(username), blockHeight)
+		require.NoError(err)
+		require.Equal(expectedPKID, pkid)
+	}
+
+	// pkid1 claims "alice" at height 10 and releases it in favor of "alice2" at height 20. pkid2 claims
+	// "alice" at height 20 too.
+	putRecord("Alice", 10, pkid1)
+	putRecord("alice", 20, nil)
+	putRecord("alice2", 20, pkid1)
+	putRecord("alice", 20, pkid2)
+
+	// Lookups are case-insensitive and resolve to the holder as of the height.
+	requirePKID("alice", 9, nil)
+	requirePKID("ALICE", 10, pkid1)
+	requirePKID("alice", 19, pkid1)
+	requirePKID("alice", 20, pkid2)
+	requirePKID("alice", 1000, pkid2)
+	requirePKID("alice2", 19, nil)
+	requirePKID("alice2", 20, pkid1)
+	// A username that's a prefix of another doesn't match its records.
+	requirePKID("alic", 1000, nil)
+
+	// pkid2 releases "alice" at height 30.
+	putRecord("alice", 30, nil)
+	requirePKID("alice", 30, nil)
+	requirePKID("alice", 29, pkid2)
+
+	// Detaching a block deletes the records written at its height.
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return DbDeleteTxindexUsernameHistoryForHeightWithTxn(txn, nil, 20, nil, false)
+	}))
+	requirePKID("alice", 25, pkid1)
+	requirePKID("alice2", 25, nil)
+	requirePKID("alice", 30, nil)
+}
+
+func TestTxindexDiamonds(t *testing.T) {
+	require := require.New(t)
+
+	// Create a test db and clean up the files at the end.
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	senderPKID1 := NewPKID(RandomBytes(33))
+	senderPKID2 := NewPKID(RandomBytes(33))
+	receiverPKID := NewPKID(RandomBytes(33))
+	postHash1 := NewBlockHash(RandomBytes(32))
+	postHash2 := NewBlockHash(RandomBytes(32))
+
+	putDiamond := func(senderPKID *PKID, postHash *BlockHash, prevLevel int64, level int64, blockHeight uint64) {
+		require.NoError(db.Update(func(txn *badger.Txn) error {
+			return DbPutTxindexDiamondWithTxn(txn, nil, &TxindexDiamondRecord{
+				SenderPKID:       senderPKID,
+				ReceiverPKID:     receiverPKID,
+				DiamondPostHash:  postHash,
+				DiamondLevel:     level,
+				PrevDiamondLevel: prevLevel,
+				BlockHeight:      blockHeight,
+			}, nil)
+		}))
+	}
+	requireCounts := func(postHash *BlockHash, expectedCounts map[int64]uint64) {
+		counts, err := DbGetTxindexPostDiamondCounts(db, postHash)
+		require.NoError(err)
+		require.Equal(expectedCounts, counts)
+	}
+
+	// senderPKID1 gives a level 1 diamond on post 1 at height 10 and upgrades it to level 3 at height 20.
+	// senderPKID2 gives level 2 diamonds on both posts at height 15, and upgrades the one on post 2 twice at
+	// height 20.
+	putDiamond(senderPKID1, postHash1, 0, 1, 10)
+	putDiamond(senderPKID2, postHash1, 0, 2, 15)
+	putDiamond(senderPKID2, postHash2, 0, 2, 15)
+	putDiamond(senderPKID1, postHash1, 1, 3, 20)
+	putDiamond(senderPKID2, postHash2, 2, 3, 20)
+	putDiamond(senderPKID2, postHash2, 3, 4, 20)
+
+	requireCounts(postHash1, map[int64]uint64{2: 1, 3: 1})
+	requireCounts(postHash2, map[int64]uint64{4: 1})
+
+	// The diamonds received are sorted by level and then by height. An upgrade within a block replaces the
+	// block's earlier record.
+	received, err := DbGetTxindexDiamondsReceived(db, receiverPKID, 0, nil, 100)
+	require.NoError(err)
+	require.Len(received, 5)
+	require.Equal([]int64{1, 2, 2, 3, 4}, []int64{received[0].DiamondLevel, received[1].DiamondLevel,
+		received[2].DiamondLevel, received[3].DiamondLevel, received[4].DiamondLevel})
+	require.Equal(senderPKID1, received[0].SenderPKID)
+	require.Equal(uint64(10), received[0].BlockHeight)
+	require.Equal(postHash1, received[3].DiamondPostHash)
+
+	// The diamonds received can be filtered by level and paged through.
+	received, err = DbGetTxindexDiamondsReceived(db, receiverPKID, 2, nil, 1)
+	require.NoError(err)
+	require.Len(received, 1)
+	require.Equal(uint64(15), received[0].BlockHeight)
+	received, err = DbGetTxindexDiamondsReceived(db, receiverPKID, 2, received[0], 5)
+	require.NoError(err)
+	require.Len(received, 1)
+	require.Equal(int64(2), received[0].DiamondLevel)
+	received, err = DbGetTxindexDiamondsReceived(db, receiverPKID, 2, received[0], 5)
+	require.NoError(err)
+	require.Empty(received)
+
+	// The diamonds given are sorted by height.
+	given, err := DbGetTxindexDiamondsGiven(db, senderPKID2, nil, 2)
+	require.NoError(err)
+	require.Len(given, 2)
+	require.Equal(uint64(15), given[0].BlockHeight)
+	require.Equal(receiverPKID, given[0].ReceiverPKID)
+	given, err = DbGetTxindexDiamondsGiven(db, senderPKID2, given[1], 2)
+	require.NoError(err)
+	require.Len(given, 1)
+	require.Equal(uint64(20), given[0].BlockHeight)
+	require.Equal(int64(4), given[0].DiamondLevel)
+
+	// Detaching a block deletes the records written at its height and reverts the counts.
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return DbDeleteTxindexDiamondsForHeightWithTxn(txn, nil, 20, nil, false)
+	}))
+	requireCounts(postHash1, map[int64]uint64{1: 1, 2: 1})
+	requireCounts(postHash2, map[int64]uint64{2: 1})
+	received, err = DbGetTxindexDiamondsReceived(db, receiverPKID, 0, nil, 100)
+	require.NoError(err)
+	require.Len(received, 3)
+	given, err = DbGetTxindexDiamondsGiven(db, senderPKID2, nil, 100)
+	require.NoError(err)
+	require.Len(given, 2)
+}
+
 func TestEncodeUint16(t *testing.T) {
 	for _, num := range []uint16{0, 5819, math.MaxUint16} {
 		// Encode to bytes.
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"bytes"
+	"math/bits"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Deterministic Transaction Shuffle
+//
+// A block producer that is free to order the transactions of its block can front-run, back-run, or sandwich the
+// transactions it sees in the mempool. The deterministic shuffle takes that freedom away: the non-block-reward
+// transactions of a block are ordered
+//
+//  1. By fee band, highest first. A transaction's fee band is the bit length of its fee rate in nanos per KB, so
+//     each band holds fee rates within a factor of two of each other, see GetTxnShuffleFeeBand. Paying a higher fee
+//     still gets a transaction in earlier, but only by moving it to a higher band.
+//  2. Within a fee band, by the double SHA-256 of the previous block hash followed by the transaction hash, lowest
+//     first. The previous block hash isn't known until the previous block is produced, so neither the transactor
+//     nor the block producer can pick where a transaction lands within its band.
+//  3. By transaction hash, lowest first. Two different transactions only tie here if they're the same transaction.
+//
+// The fee rate is the fee paid by the transaction, or by the inner transactions of an atomic txns wrapper, times 1000
+// divided by its size. Transactions from before the balance model don't set TxnFeeNanos and fall in fee band zero.
+//
+// Block producers can opt into the shuffle with the --block-producer-deterministic-txn-shuffle flag. Networks that
+// choose to enforce it set the DeterministicTxnShuffleBlockHeight fork, from which ConnectBlock rejects PoW and PoS
+// blocks whose transactions aren't in shuffle order. The shuffle replaces the canonical order, see
+// pos_transaction_ordering.go, on such networks.
+//
+// As with the canonical order, a transaction that depends on another one in the same block must also sort after it.
+// The block producers sort their candidate transactions before greedily connecting them, which skips a transaction
+// whose dependency sorts after it, leaving it for a later block.
+
+// txnShuffleOrderKey holds the fields of a transaction that determine its position in the shuffle order.
+type txnShuffleOrderKey struct {
+	feeBand     uint64
+	shuffleHash *BlockHash
+	hash        *BlockHash
+}
+
+// GetTxnShuffleFeeBand returns the fee band of a fee rate in nanos per KB: zero for a zero fee rate, and otherwise n
+// for fee rates in [2^(n-1), 2^n).
+func GetTxnShuffleFeeBand(feeRateNanosPerKB uint64) uint64 {
+	return uint64(bits.Len64(feeRateNanosPerKB))
+}
+
+// computeTxnShuffleFeeRateNanosPerKB returns the fee rate the shuffle order uses for a txn of the given size.
+func computeTxnShuffleFeeRateNanosPerKB(txn *MsgDeSoTxn, txnSizeBytes uint64) uint64 {
+	if txnSizeBytes == 0 {
+		return 0
+	}
+	hi, lo := bits.Mul64(_getTxnFeeNanos(txn), 1000)
+	if hi >= txnSizeBytes {
+		// The fee rate doesn't fit in a uint64. Such a txn can't connect anyway.
+		return 0
+	}
+	feeRateNanosPerKB, _ := bits.Div64(hi, lo, txnSizeBytes)
+	return feeRateNanosPerKB
+}
+
+// computeTxnShuffleHash returns the hash that orders txns within a fee band of a block building on prevBlockHash.
+func computeTxnShuffleHash(prevBlockHash *BlockHash, txnHash *BlockHash) *BlockHash {
+	seed := make([]byte, 0, 2*HashSizeBytes)
+	if prevBlockHash != nil {
+		seed = append(seed, prevBlockHash[:]...)
+	} else {
+		seed = append(seed, ZeroBlockHash[:]...)
+	}
+	seed = append(seed, txnHash[:]...)
+	return Sha256DoubleHash(seed)
+}
+
+func newTxnShuffleOrderKey(txn *MsgDeSoTxn, txnHash *BlockHash, prevBlockHash *BlockHash) (*txnShuffleOrderKey, error) {
+	if txn == nil {
+		return nil, errors.New("newTxnShuffleOrderKey: txn cannot be nil")
+	}
+	if txnHash == nil {
+		txnHash = txn.Hash()
+		if txnHash == nil {
+			return nil, errors.New("newTxnShuffleOrderKey: Problem hashing txn")
+		}
+	}
+	txnBytes, err := txn.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "newTxnShuffleOrderKey: Problem serializing txn")
+	}
+	return &txnShuffleOrderKey{
+		feeBand:     GetTxnShuffleFeeBand(computeTxnShuffleFeeRateNanosPerKB(txn, uint64(len(txnBytes)))),
+		shuffleHash: computeTxnShuffleHash(prevBlockHash, txnHash),
+		hash:        txnHash,
+	}, nil
+}
+
+// compareTxnShuffleOrderKeys returns -1 if a must come before b in a block, 1 if a must come after b, and 0 if a and
+// b are the same transaction.
+func compareTxnShuffleOrderKeys(a *txnShuffleOrderKey, b *txnShuffleOrderKey) int {
+	if a.feeBand > b.feeBand {
+		return -1
+	} else if a.feeBand < b.feeBand {
+		return 1
+	}
+	if cmp := bytes.Compare(a.shuffleHash[:], b.shuffleHash[:]); cmp != 0 {
+		return cmp
+	}
+	return bytes.Compare(a.hash[:], b.hash[:])
+}
+
+// SortMempoolTxnsDeterministicShuffle returns a copy of the mempool transactions sorted in the shuffle order of a
+// block building on prevBlockHash. The input slice is not modified. The size and hash cached in each MempoolTx are
+// used, so no transaction needs to be re-serialized.
+func SortMempoolTxnsDeterministicShuffle(mempoolTxns []*MempoolTx, prevBlockHash *BlockHash) []*MempoolTx {
+	sortedTxns := make([]*MempoolTx, 0, len(mempoolTxns))
+	keys := make(map[*MempoolTx]*txnShuffleOrderKey, len(mempoolTxns))
+	for _, mempoolTx := range mempoolTxns {
+		if mempoolTx == nil || mempoolTx.Tx == nil || mempoolTx.Hash == nil {
+			continue
+		}
+		keys[mempoolTx] = &txnShuffleOrderKey{
+			feeBand: GetTxnShuffleFeeBand(
+				computeTxnShuffleFeeRateNanosPerKB(mempoolTx.Tx, mempoolTx.TxSizeBytes)),
+			shuffleHash: computeTxnShuffleHash(prevBlockHash, mempoolTx.Hash),
+			hash:        mempoolTx.Hash,
+		}
+		sortedTxns = append(sortedTxns, mempoolTx)
+	}
+	sort.SliceStable(sortedTxns, func(ii, jj int) bool {
+		return compareTxnShuffleOrderKeys(keys[sortedTxns[ii]], keys[sortedTxns[jj]]) < 0
+	})
+	return sortedTxns
+}
+
+// ValidateDeterministicTxnShuffleOrder verifies that the transactions of a block building on prevBlockHash are in
+// strictly increasing shuffle order. The transactions must not include the block reward. txnHashes is optional; when
+// provided, it must be the same length as txns and contain their hashes.
+func ValidateDeterministicTxnShuffleOrder(txns []*MsgDeSoTxn, txnHashes []*BlockHash, prevBlockHash *BlockHash) error {
+	if txnHashes != nil && len(txnHashes) != len(txns) {
+		return errors.Errorf("ValidateDeterministicTxnShuffleOrder: Got %d txn hashes for %d txns",
+			len(txnHashes), len(txns))
+	}
+	var prevKey *txnShuffleOrderKey
+	for ii, txn := range txns {
+		var txnHash *BlockHash
+		if txnHashes != nil {
+			txnHash = txnHashes[ii]
+		}
+		key, err := newTxnShuffleOrderKey(txn, txnHash, prevBlockHash)
+		if err != nil {
+			return errors.Wrapf(err, "ValidateDeterministicTxnShuffleOrder: Problem computing key for txn #%d", ii)
+		}
+		if prevKey != nil && compareTxnShuffleOrderKeys(prevKey, key) >= 0 {
+			return errors.Wrapf(RuleErrorBlockTxnsNotInShuffleOrder,
+				"ValidateDeterministicTxnShuffleOrder: Txn %v at index %d must come before txn %v",
+				key.hash, ii, prevKey.hash)
+		}
+		prevKey = key
+	}
+	return nil
+}
+
+// shouldUseDeterministicTxnShuffle returns true if a block producer should order the transactions of a block at the
+// height by the deterministic shuffle: always if the network enforces it, and otherwise if the producer opted into
+// it, unless the network enforces the canonical order instead.
+func shouldUseDeterministicTxnShuffle(params *DeSoParams, blockHeight uint64, isOptedIn bool) bool {
+	if params.IsDeterministicTxnShuffleBlockHeight(blockHeight) {
+		return true
+	}
+	return isOptedIn && !params.IsCanonicalTxnOrderingBlockHeight(blockHeight)
+}
+
+const (
+	RuleErrorBlockTxnsNotInShuffleOrder RuleError = "RuleErrorBlockTxnsNotInShuffleOrder"
+)
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterministicTxnShuffleOrder(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(uint64(0), GetTxnShuffleFeeBand(0))
+	require.Equal(uint64(1), GetTxnShuffleFeeBand(1))
+	require.Equal(uint64(10), GetTxnShuffleFeeBand(1000))
+	require.Equal(uint64(10), GetTxnShuffleFeeBand(1023))
+	require.Equal(uint64(11), GetTxnShuffleFeeBand(1024))
+
+	newTxn := func(feeNanos uint64, partialID uint64) *MsgDeSoTxn {
+		txn := &MsgDeSoTxn{
+			TxnVersion:  DeSoTxnVersion1,
+			TxInputs:    []*DeSoInput{},
+			TxOutputs:   []*DeSoOutput{},
+			TxnFeeNanos: feeNanos,
+			TxnNonce: &DeSoNonce{
+				ExpirationBlockHeight: 10,
+				PartialID:             partialID,
+			},
+			TxnMeta:   &BasicTransferMetadata{},
+			PublicKey: m0PkBytes,
+		}
+		_signTxn(t, txn, m0Priv)
+		return txn
+	}
+	// The high fee txns are in the same fee band, as are the zero fee txns.
+	highFeeTxns := []*MsgDeSoTxn{newTxn(200000, 1), newTxn(210000, 2), newTxn(220000, 3)}
+	var zeroFeeTxns []*MsgDeSoTxn
+	for ii := uint64(0); ii < 8; ii++ {
+		zeroFeeTxns = append(zeroFeeTxns, newTxn(0, 10+ii))
+	}
+	var mempoolTxns []*MempoolTx
+	for _, txn := range append(append([]*MsgDeSoTxn{}, zeroFeeTxns...), highFeeTxns...) {
+		mempoolTx, err := NewMempoolTx(txn, time.Now(), 1)
+		require.NoError(err)
+		mempoolTxns = append(mempoolTxns, mempoolTx)
+	}
+	sortTxns := func(prevBlockHash *BlockHash) []*MsgDeSoTxn {
+		var txns []*MsgDeSoTxn
+		for _, mempoolTx := range SortMempoolTxnsDeterministicShuffle(mempoolTxns, prevBlockHash) {
+			txns = append(txns, mempoolTx.Tx)
+		}
+		return txns
+	}
+
+	// The higher fee band comes first, and the sorted txns validate.
+	prevBlockHash := Sha256DoubleHash([]byte("prev block"))
+	sortedTxns := sortTxns(prevBlockHash)
+	require.Len(sortedTxns, len(mempoolTxns))
+	require.ElementsMatch(highFeeTxns, sortedTxns[:len(highFeeTxns)])
+	require.NoError(ValidateDeterministicTxnShuffleOrder(sortedTxns, nil, prevBlockHash))
+	// The input slice is left untouched.
+	require.Equal(zeroFeeTxns[0].Hash(), mempoolTxns[0].Hash)
+
+	// Any swap of two adjacent txns is rejected.
+	for ii := 0; ii < len(sortedTxns)-1; ii++ {
+		reordered := append([]*MsgDeSoTxn{}, sortedTxns...)
+		reordered[ii], reordered[ii+1] = reordered[ii+1], reordered[ii]
+		err := ValidateDeterministicTxnShuffleOrder(reordered, nil, prevBlockHash)
+		require.Error(err)
+		require.Contains(err.Error(), RuleErrorBlockTxnsNotInShuffleOrder)
+	}
+	require.Error(ValidateDeterministicTxnShuffleOrder(
+		[]*MsgDeSoTxn{sortedTxns[0], sortedTxns[0]}, nil, prevBlockHash))
+
+	// Another previous block hash shuffles the txns within their fee bands differently.
+	otherPrevBlockHash := Sha256DoubleHash([]byte("other prev block"))
+	otherSortedTxns := sortTxns(otherPrevBlockHash)
+	require.ElementsMatch(highFeeTxns, otherSortedTxns[:len(highFeeTxns)])
+	require.NotEqual(sortedTxns, otherSortedTxns)
+	require.NoError(ValidateDeterministicTxnShuffleOrder(otherSortedTxns, nil, otherPrevBlockHash))
+	require.Error(ValidateDeterministicTxnShuffleOrder(sortedTxns, nil, otherPrevBlockHash))
+}
+
+func TestIsDeterministicTxnShuffleBlockHeight(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 10
+	params.ForkHeights.CanonicalTxnOrderingBlockHeight = 10
+	params.ForkHeights.DeterministicTxnShuffleBlockHeight = 20
+
+	// Block producers that opt in only use the shuffle where the canonical order isn't enforced.
+	require.True(shouldUseDeterministicTxnShuffle(&params, 5, true))
+	require.False(shouldUseDeterministicTxnShuffle(&params, 5, false))
+	require.True(params.IsCanonicalTxnOrderingBlockHeight(15))
+	require.False(shouldUseDeterministicTxnShuffle(&params, 15, true))
+
+	// Once the shuffle is enforced, it replaces the canonical order.
+	require.False(params.IsDeterministicTxnShuffleBlockHeight(19))
+	require.True(params.IsDeterministicTxnShuffleBlockHeight(20))
+	require.False(params.IsCanonicalTxnOrderingBlockHeight(20))
+	require.True(shouldUseDeterministicTxnShuffle(&params, 20, false))
+}
+
+func TestDeterministicTxnShuffleBlockProducer(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	params.ForkHeights.DeterministicTxnShuffleBlockHeight = 0
+	for ii := 0; ii < 2; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+
+	// Queue transfers that each spend the change of the previous one.
+	txnHashes := make(map[BlockHash]bool)
+	for ii := 0; ii < 5; ii++ {
+		txn := _assembleBasicTransferTxnFullySigned(t, chain, 1000, 10, senderPkString, recipientPkString,
+			senderPrivString, mempool)
+		_, err := mempool.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+		require.NoError(err)
+		txnHashes[*txn.Hash()] = true
+	}
+
+	// The blocks produced while the shuffle is enforced connect, and a transfer that sorts before the one it
+	// depends on is left for a later block.
+	numTxns := len(txnHashes)
+	for ii := 0; ii < numTxns && len(txnHashes) > 0; ii++ {
+		block, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+		require.NoError(ValidateDeterministicTxnShuffleOrder(block.Txns[1:], nil, block.Header.PrevBlockHash))
+		for _, txn := range block.Txns[1:] {
+			delete(txnHashes, *txn.Hash())
+		}
+	}
+	require.Empty(txnHashes)
+}
@@ -0,0 +1,229 @@
+package lib
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The encoder golden file holds the canonical encoding of a representative instance of every DeSoEncoder at every
+// one of its versions. The encodings of entries are consensus-critical, since they're hashed into the state
+// checksum and stored in the DB, so TestEncoderGoldenFiles fails if any of them changes.
+//
+// When adding a new encoder or a new encoder version, regenerate the golden file with:
+//
+//	go test ./lib -run TestEncoderGoldenFiles -update-encoder-golden
+//
+// and check in the new entries. The existing entries must never change.
+var updateEncoderGolden = flag.Bool("update-encoder-golden", false,
+	"Regenerate the encoder golden file instead of checking the encodings against it.")
+
+const encoderGoldenFile = "testdata/encoder_golden.json"
+
+type encoderGoldenEntry struct {
+	EncoderType EncoderType `json:"encoderType"`
+	Name        string      `json:"name"`
+	Version     byte        `json:"version"`
+	Encoding    string      `json:"encoding"`
+}
+
+// encoderGoldenInstances are the hand-built instances of the encoders that can't be filled in with random data,
+// since only certain configurations of them encode properly.
+var encoderGoldenInstances = map[EncoderType]func() DeSoEncoder{
+	EncoderTypeBlock: func() DeSoEncoder {
+		return &MsgDeSoBlock{Header: &MsgDeSoHeader{
+			Version:               HeaderVersion1,
+			PrevBlockHash:         &BlockHash{1},
+			TransactionMerkleRoot: &BlockHash{2},
+			TstampNanoSecs:        1700000000000000000,
+			Height:                10,
+			Nonce:                 20,
+		}}
+	},
+	EncoderTypeTxn: func() DeSoEncoder {
+		return &MsgDeSoTxn{
+			TxInputs:  []*DeSoInput{{TxID: BlockHash{1}, Index: 2}},
+			TxOutputs: []*DeSoOutput{{PublicKey: m0PkBytes, AmountNanos: 100}},
+			TxnMeta:   &BasicTransferMetadata{},
+			PublicKey: m1PkBytes,
+			ExtraData: map[string][]byte{"key": {1, 2, 3}},
+		}
+	},
+	EncoderTypeBlockNode: func() DeSoEncoder {
+		return &BlockNode{
+			Hash:             &BlockHash{1},
+			Height:           10,
+			DifficultyTarget: &BlockHash{2},
+			CumWork:          big.NewInt(1000),
+			Header:           &MsgDeSoHeader{Version: HeaderVersion1, Height: 10},
+			Status:           StatusHeaderValidated,
+		}
+	},
+	EncoderTypeStateChangeEntry: func() DeSoEncoder {
+		return &StateChangeEntry{
+			OperationType: DbOperationTypeUpsert,
+			KeyBytes:      []byte{1, 2, 3},
+			EncoderBytes:  []byte{4, 5, 6},
+			EncoderType:   EncoderTypePostEntry,
+			BlockHeight:   10,
+		}
+	},
+}
+
+// newEncoderGoldenInstance returns the representative instance of the encoder type. Unless it's hand-built, the
+// instance is filled in with random data from a source seeded with the encoder type, so that it's the same on
+// every run and doesn't change when other encoders are added.
+func newEncoderGoldenInstance(encoderType EncoderType) DeSoEncoder {
+	if newInstance, exists := encoderGoldenInstances[encoderType]; exists {
+		return newInstance()
+	}
+	encoder := encoderType.New()
+	_fillEncoderGoldenValue(rand.New(rand.NewSource(int64(encoderType))), reflect.ValueOf(encoder).Elem(), 0)
+	return encoder
+}
+
+// encoderGoldenMaxDepth bounds how deep _fillEncoderGoldenValue allocates pointers and slices, since some of the
+// encoders are recursive types.
+const encoderGoldenMaxDepth = 4
+
+var desoEncoderType = reflect.TypeOf((*DeSoEncoder)(nil)).Elem()
+
+// _isNestedEncoderGoldenType returns true if the type is a pointer to an encoder struct, i.e. an entry rather than
+// a BlockHash, PKID, or PublicKey.
+func _isNestedEncoderGoldenType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Ptr && typ.Elem().Kind() == reflect.Struct && typ.Implements(desoEncoderType)
+}
+
+// _fillEncoderGoldenValue fills in the exported fields of value with random data. Interfaces, maps, and nested
+// entries are left empty, since they can't be filled in generically, and the nested entries have golden
+// encodings of their own.
+func _fillEncoderGoldenValue(rng *rand.Rand, value reflect.Value, depth int) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			if depth >= encoderGoldenMaxDepth || _isNestedEncoderGoldenType(value.Type()) {
+				return
+			}
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		_fillEncoderGoldenValue(rng, value.Elem(), depth+1)
+	case reflect.Struct:
+		for ii := 0; ii < value.NumField(); ii++ {
+			if value.Field(ii).CanSet() {
+				_fillEncoderGoldenValue(rng, value.Field(ii), depth)
+			}
+		}
+	case reflect.Array:
+		for ii := 0; ii < value.Len(); ii++ {
+			_fillEncoderGoldenValue(rng, value.Index(ii), depth)
+		}
+	case reflect.Slice:
+		if depth >= encoderGoldenMaxDepth || _isNestedEncoderGoldenType(value.Type().Elem()) {
+			return
+		}
+		value.Set(reflect.MakeSlice(value.Type(), 2, 2))
+		for ii := 0; ii < value.Len(); ii++ {
+			_fillEncoderGoldenValue(rng, value.Index(ii), depth+1)
+		}
+	case reflect.String:
+		value.SetString(fmt.Sprintf("golden-%d", rng.Uint32()))
+	case reflect.Bool:
+		value.SetBool(rng.Intn(2) == 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value.SetUint(rng.Uint64() >> (64 - value.Type().Bits()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value.SetInt(rng.Int63() >> (64 - value.Type().Bits()))
+	case reflect.Float32, reflect.Float64:
+		value.SetFloat(float64(rng.Uint32()) / 4)
+	}
+}
+
+// _getEncoderGoldenEntries encodes the representative instance of every encoder at every one of its versions.
+func _getEncoderGoldenEntries(t *testing.T) []*encoderGoldenEntry {
+	// Encode with the mainnet migration heights, using a fresh copy of them since other tests modify them.
+	oldParams := GlobalDeSoParams
+	defer func() { GlobalDeSoParams = oldParams }()
+	GlobalDeSoParams = DeSoMainnetParams
+	GlobalDeSoParams.EncoderMigrationHeights = GetEncoderMigrationHeights(&DeSoMainnetParams.ForkHeights)
+	GlobalDeSoParams.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&DeSoMainnetParams.ForkHeights)
+
+	var entries []*encoderGoldenEntry
+	for _, encoder := range _getAllDeSoEncoders(t) {
+		encoderType := encoder.GetEncoderType()
+		encodedVersions := make(map[byte]bool)
+		for _, migration := range GlobalDeSoParams.EncoderMigrationHeightsList {
+			version := encoder.GetVersionByte(migration.Height)
+			if encodedVersions[version] {
+				continue
+			}
+			encodedVersions[version] = true
+			entries = append(entries, &encoderGoldenEntry{
+				EncoderType: encoderType,
+				Name:        reflect.TypeOf(encoder).Elem().Name(),
+				Version:     version,
+				Encoding:    hex.EncodeToString(EncodeToBytes(migration.Height, newEncoderGoldenInstance(encoderType))),
+			})
+		}
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		if entries[ii].EncoderType != entries[jj].EncoderType {
+			return entries[ii].EncoderType < entries[jj].EncoderType
+		}
+		return entries[ii].Version < entries[jj].Version
+	})
+	return entries
+}
+
+func TestEncoderGoldenFiles(t *testing.T) {
+	require := require.New(t)
+
+	entries := _getEncoderGoldenEntries(t)
+	if *updateEncoderGolden {
+		entriesJSON, err := json.MarshalIndent(entries, "", "  ")
+		require.NoError(err)
+		require.NoError(os.MkdirAll(filepath.Dir(encoderGoldenFile), 0755))
+		require.NoError(os.WriteFile(encoderGoldenFile, append(entriesJSON, '\n'), 0644))
+		return
+	}
+
+	// The encodings must be deterministic, or they can't be compared against the golden file.
+	require.Equal(entries, _getEncoderGoldenEntries(t))
+
+	goldenJSON, err := os.ReadFile(encoderGoldenFile)
+	require.NoError(err)
+	var goldenEntries []*encoderGoldenEntry
+	require.NoError(json.Unmarshal(goldenJSON, &goldenEntries))
+	goldenEncodings := make(map[string]string)
+	for _, goldenEntry := range goldenEntries {
+		goldenEncodings[fmt.Sprintf("%s v%d", goldenEntry.Name, goldenEntry.Version)] = goldenEntry.Encoding
+	}
+
+	for _, entry := range entries {
+		key := fmt.Sprintf("%s v%d", entry.Name, entry.Version)
+		goldenEncoding, exists := goldenEncodings[key]
+		if !exists {
+			t.Errorf("%s (encoder type %d) has no golden encoding; regenerate %s with -update-encoder-golden",
+				key, entry.EncoderType, encoderGoldenFile)
+			continue
+		}
+		delete(goldenEncodings, key)
+		if goldenEncoding != entry.Encoding {
+			t.Errorf("%s (encoder type %d) encoding changed:\n  golden: %s\n  actual: %s",
+				key, entry.EncoderType, goldenEncoding, entry.Encoding)
+		}
+	}
+	// Encoders and encoder versions can't be removed either, since existing entries were encoded with them.
+	for key := range goldenEncodings {
+		t.Errorf("%s has a golden encoding but is no longer encoded", key)
+	}
+}
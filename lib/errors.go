@@ -242,6 +242,10 @@ const (
 	RuleErrorBlockProductionIntervalPoSTooHigh                 RuleError = "RuleErrorBlockProductionIntervalPoSTooHigh"
 	RuleErrorTimeoutIntervalPoSTooLow                          RuleError = "RuleErrorTimeoutIntervalPoSTooLow"
 	RuleErrorTimeoutIntervalPoSTooHigh                         RuleError = "RuleErrorTimeoutIntervalPoSTooHigh"
+	RuleErrorTimeoutBackoffMultiplierPoSTooLow                 RuleError = "RuleErrorTimeoutBackoffMultiplierPoSTooLow"
+	RuleErrorTimeoutBackoffMultiplierPoSTooHigh                RuleError = "RuleErrorTimeoutBackoffMultiplierPoSTooHigh"
+	RuleErrorBlockRewardMaturityBlocksTooHigh                  RuleError = "RuleErrorBlockRewardMaturityBlocksTooHigh"
+	RuleErrorFeeRedistributionBasisPointsTooHigh               RuleError = "RuleErrorFeeRedistributionBasisPointsTooHigh"
 
 	// DeSo Diamonds
 	RuleErrorBasicTransferHasDiamondPostHashWithoutDiamondLevel   RuleError = "RuleErrorBasicTransferHasDiamondPostHashWithoutDiamondLevel"
@@ -551,6 +555,18 @@ const (
 	RuleErrorUpdateCoinLockupParamsDeletingNonExistentPoint             RuleError = "RuleErrorUpdateCoinLockupParamsDeletingNonExistentPoint"
 	RuleErrorUpdateCoinLockupParamsUpdatingNonExistentProfile           RuleError = "RuleErrorUpdateCoinLockupParamsUpdatingNonExistentProfile"
 	RuleErrorUpdateCoinLockupParamsUpdatingPermanentTransferRestriction RuleError = "RuleErrorUpdateCoinLockupParamsUpdatingPermanentTransferRestriction"
+	RuleErrorCoinLockupVestingScheduleBeforeBlockHeight                 RuleError = "RuleErrorCoinLockupVestingScheduleBeforeBlockHeight"
+	RuleErrorCoinLockupVestingScheduleInvalid                           RuleError = "RuleErrorCoinLockupVestingScheduleInvalid"
+	RuleErrorCoinLockupVestingScheduleOnVestedLockup                    RuleError = "RuleErrorCoinLockupVestingScheduleOnVestedLockup"
+	RuleErrorCoinLockupVestingScheduleInvalidTransactor                 RuleError = "RuleErrorCoinLockupVestingScheduleInvalidTransactor"
+	RuleErrorCoinLockupVestingScheduleCliffInPast                       RuleError = "RuleErrorCoinLockupVestingScheduleCliffInPast"
+	RuleErrorCoinLockupVestingScheduleZeroReleaseRate                   RuleError = "RuleErrorCoinLockupVestingScheduleZeroReleaseRate"
+	RuleErrorCoinLockupVestingScheduleConflict                          RuleError = "RuleErrorCoinLockupVestingScheduleConflict"
+	RuleErrorCoinLockupTransferOfVestingScheduleBalance                 RuleError = "RuleErrorCoinLockupTransferOfVestingScheduleBalance"
+	RuleErrorCoinLockupTransferVestedPositionBeforeBlockHeight          RuleError = "RuleErrorCoinLockupTransferVestedPositionBeforeBlockHeight"
+	RuleErrorCoinLockupTransferInvalidVestingEndTimestamp               RuleError = "RuleErrorCoinLockupTransferInvalidVestingEndTimestamp"
+	RuleErrorCoinLockupTransferVestedPositionOverlap                    RuleError = "RuleErrorCoinLockupTransferVestedPositionOverlap"
+	RuleErrorCoinLockupTransferVestingScheduleConflict                  RuleError = "RuleErrorCoinLockupTransferVestingScheduleConflict"
 
 	// Atomic Transactions
 	RuleErrorAtomicTxnsRequiresWrapper                       RuleError = "RuleErrorAtomicTxnsRequiresWrapper"
@@ -569,16 +585,120 @@ const (
 	RuleErrorAtomicTxnsHasNonAtomicInnerTxn                  RuleError = "RuleErrorAtomicTxnsHasNonAtomicInnerTxn"
 	RuleErrorAtomicTxnsHasBrokenChain                        RuleError = "RuleErrorAtomicTxnsHasBrokenChain"
 
+	// Key-Value Records
+	RuleErrorKeyValueRecordsBeforeBlockHeight RuleError = "RuleErrorKeyValueRecordsBeforeBlockHeight"
+	RuleErrorKeyValueRecordsNoRecords         RuleError = "RuleErrorKeyValueRecordsNoRecords"
+	RuleErrorKeyValueRecordsTooManyRecords    RuleError = "RuleErrorKeyValueRecordsTooManyRecords"
+	RuleErrorKeyValueRecordKeyEmpty           RuleError = "RuleErrorKeyValueRecordKeyEmpty"
+	RuleErrorKeyValueRecordKeyTooLong         RuleError = "RuleErrorKeyValueRecordKeyTooLong"
+	RuleErrorKeyValueRecordValueTooLong       RuleError = "RuleErrorKeyValueRecordValueTooLong"
+	RuleErrorKeyValueRecordDuplicateKey       RuleError = "RuleErrorKeyValueRecordDuplicateKey"
+	RuleErrorKeyValueRecordsInvalidOwnerPKID  RuleError = "RuleErrorKeyValueRecordsInvalidOwnerPKID"
+
+	// Message Read State
+	RuleErrorMessageReadStateMissingField               RuleError = "RuleErrorMessageReadStateMissingField"
+	RuleErrorMessageReadStateInvalidGroupOwnerPublicKey RuleError = "RuleErrorMessageReadStateInvalidGroupOwnerPublicKey"
+	RuleErrorMessageReadStateInvalidGroupKeyName        RuleError = "RuleErrorMessageReadStateInvalidGroupKeyName"
+	RuleErrorMessageReadStateInvalidWatermark           RuleError = "RuleErrorMessageReadStateInvalidWatermark"
+	RuleErrorMessageReadStateAccessGroupDoesNotExist    RuleError = "RuleErrorMessageReadStateAccessGroupDoesNotExist"
+	RuleErrorMessageReadStateWatermarkNotIncreasing     RuleError = "RuleErrorMessageReadStateWatermarkNotIncreasing"
+
+	// Message Attachments
+	RuleErrorMessageAttachmentManifestInvalid   RuleError = "RuleErrorMessageAttachmentManifestInvalid"
+	RuleErrorMessageAttachmentManifestEmpty     RuleError = "RuleErrorMessageAttachmentManifestEmpty"
+	RuleErrorMessageAttachmentTooManyChunks     RuleError = "RuleErrorMessageAttachmentTooManyChunks"
+	RuleErrorMessageAttachmentChunkEmpty        RuleError = "RuleErrorMessageAttachmentChunkEmpty"
+	RuleErrorMessageAttachmentChunkTooLarge     RuleError = "RuleErrorMessageAttachmentChunkTooLarge"
+	RuleErrorMessageAttachmentTotalSizeTooLarge RuleError = "RuleErrorMessageAttachmentTotalSizeTooLarge"
+
+	// NFT Batch
+	RuleErrorNFTBatchBeforeBlockHeight        RuleError = "RuleErrorNFTBatchBeforeBlockHeight"
+	RuleErrorNFTBatchInvalidOperationType     RuleError = "RuleErrorNFTBatchInvalidOperationType"
+	RuleErrorNFTBatchInvalidSerialRange       RuleError = "RuleErrorNFTBatchInvalidSerialRange"
+	RuleErrorNFTBatchTooManySerials           RuleError = "RuleErrorNFTBatchTooManySerials"
+	RuleErrorNFTBatchUnexpectedReceiver       RuleError = "RuleErrorNFTBatchUnexpectedReceiver"
+	RuleErrorNFTBatchUnexpectedUnlockableText RuleError = "RuleErrorNFTBatchUnexpectedUnlockableText"
+	RuleErrorNFTBatchOnNonexistentPost        RuleError = "RuleErrorNFTBatchOnNonexistentPost"
+	RuleErrorNFTBatchMintOnPostThatIsNotNFT   RuleError = "RuleErrorNFTBatchMintOnPostThatIsNotNFT"
+	RuleErrorNFTBatchMintSerialRangeNotNext   RuleError = "RuleErrorNFTBatchMintSerialRangeNotNext"
+	RuleErrorNFTBatchMintSerialAlreadyExists  RuleError = "RuleErrorNFTBatchMintSerialAlreadyExists"
+	RuleErrorNFTBatchInvalidTransactorPKID    RuleError = "RuleErrorNFTBatchInvalidTransactorPKID"
+
+	// NFT Avatars
+	RuleErrorNFTAvatarMissingField          RuleError = "RuleErrorNFTAvatarMissingField"
+	RuleErrorNFTAvatarInvalidPostHash       RuleError = "RuleErrorNFTAvatarInvalidPostHash"
+	RuleErrorNFTAvatarInvalidSerialNumber   RuleError = "RuleErrorNFTAvatarInvalidSerialNumber"
+	RuleErrorNFTAvatarNFTDoesNotExist       RuleError = "RuleErrorNFTAvatarNFTDoesNotExist"
+	RuleErrorNFTAvatarNFTNotOwnedByProfile  RuleError = "RuleErrorNFTAvatarNFTNotOwnedByProfile"
+	RuleErrorNFTAvatarNFTHasPendingTransfer RuleError = "RuleErrorNFTAvatarNFTHasPendingTransfer"
+
+	// Bridge Event Anchors
+	RuleErrorBridgeEventAnchorBeforeBlockHeight      RuleError = "RuleErrorBridgeEventAnchorBeforeBlockHeight"
+	RuleErrorBridgeEventAnchorTransactorNotOperator  RuleError = "RuleErrorBridgeEventAnchorTransactorNotOperator"
+	RuleErrorBridgeEventAnchorInvalidChainID         RuleError = "RuleErrorBridgeEventAnchorInvalidChainID"
+	RuleErrorBridgeEventAnchorInvalidDepositHash     RuleError = "RuleErrorBridgeEventAnchorInvalidDepositHash"
+	RuleErrorBridgeEventAnchorAssetIDTooLong         RuleError = "RuleErrorBridgeEventAnchorAssetIDTooLong"
+	RuleErrorBridgeEventAnchorInvalidAmount          RuleError = "RuleErrorBridgeEventAnchorInvalidAmount"
+	RuleErrorBridgeEventAnchorTooFewAttestations     RuleError = "RuleErrorBridgeEventAnchorTooFewAttestations"
+	RuleErrorBridgeEventAnchorAttestationNotOperator RuleError = "RuleErrorBridgeEventAnchorAttestationNotOperator"
+	RuleErrorBridgeEventAnchorDuplicateAttestation   RuleError = "RuleErrorBridgeEventAnchorDuplicateAttestation"
+	RuleErrorBridgeEventAnchorInvalidAttestationSig  RuleError = "RuleErrorBridgeEventAnchorInvalidAttestationSig"
+	RuleErrorBridgeEventAnchorEventAlreadyAnchored   RuleError = "RuleErrorBridgeEventAnchorEventAlreadyAnchored"
+
+	// Delegated Posters
+	RuleErrorDelegatedPosterBeforeBlockHeight                  RuleError = "RuleErrorDelegatedPosterBeforeBlockHeight"
+	RuleErrorDelegatedPosterInvalidOwnerPublicKey              RuleError = "RuleErrorDelegatedPosterInvalidOwnerPublicKey"
+	RuleErrorDelegatedPosterInvalidDelegatePublicKey           RuleError = "RuleErrorDelegatedPosterInvalidDelegatePublicKey"
+	RuleErrorDelegatedPosterCannotDelegateToSelf               RuleError = "RuleErrorDelegatedPosterCannotDelegateToSelf"
+	RuleErrorDelegatedPosterInvalidOperationType               RuleError = "RuleErrorDelegatedPosterInvalidOperationType"
+	RuleErrorDelegatedPosterInvalidPermissions                 RuleError = "RuleErrorDelegatedPosterInvalidPermissions"
+	RuleErrorDelegatedPosterInvalidExpirationBlockHeight       RuleError = "RuleErrorDelegatedPosterInvalidExpirationBlockHeight"
+	RuleErrorDelegatedPosterAuthorizeNotByOwner                RuleError = "RuleErrorDelegatedPosterAuthorizeNotByOwner"
+	RuleErrorDelegatedPosterRevokeNotByOwnerOrDelegate         RuleError = "RuleErrorDelegatedPosterRevokeNotByOwnerOrDelegate"
+	RuleErrorDelegatedPosterRevokingNonexistentAuthorization   RuleError = "RuleErrorDelegatedPosterRevokingNonexistentAuthorization"
+	RuleErrorSubmitPostInvalidDelegatedPostOwner               RuleError = "RuleErrorSubmitPostInvalidDelegatedPostOwner"
+	RuleErrorSubmitPostDelegatedPosterNotAuthorized            RuleError = "RuleErrorSubmitPostDelegatedPosterNotAuthorized"
+	RuleErrorSubmitPostDelegatedPosterNotAuthorizedToEditPosts RuleError = "RuleErrorSubmitPostDelegatedPosterNotAuthorizedToEditPosts"
+
+	// Anchor Hashes
+	RuleErrorAnchorHashBeforeBlockHeight  RuleError = "RuleErrorAnchorHashBeforeBlockHeight"
+	RuleErrorAnchorHashInvalidContentHash RuleError = "RuleErrorAnchorHashInvalidContentHash"
+	RuleErrorAnchorHashInvalidMimeType    RuleError = "RuleErrorAnchorHashInvalidMimeType"
+	RuleErrorAnchorHashAlreadyAnchored    RuleError = "RuleErrorAnchorHashAlreadyAnchored"
+	RuleErrorAnchorHashRateLimitExceeded  RuleError = "RuleErrorAnchorHashRateLimitExceeded"
+
+	// Subscriptions
+	RuleErrorSubscriptionBeforeBlockHeight                RuleError = "RuleErrorSubscriptionBeforeBlockHeight"
+	RuleErrorSubscriptionInvalidOperationType             RuleError = "RuleErrorSubscriptionInvalidOperationType"
+	RuleErrorSubscriptionInvalidSubscriberPublicKey       RuleError = "RuleErrorSubscriptionInvalidSubscriberPublicKey"
+	RuleErrorSubscriptionInvalidRecipientPublicKey        RuleError = "RuleErrorSubscriptionInvalidRecipientPublicKey"
+	RuleErrorSubscriptionCannotSubscribeToSelf            RuleError = "RuleErrorSubscriptionCannotSubscribeToSelf"
+	RuleErrorSubscriptionInvalidDAOCoinCreatorPublicKey   RuleError = "RuleErrorSubscriptionInvalidDAOCoinCreatorPublicKey"
+	RuleErrorSubscriptionOnNonexistentProfile             RuleError = "RuleErrorSubscriptionOnNonexistentProfile"
+	RuleErrorSubscriptionInvalidAmount                    RuleError = "RuleErrorSubscriptionInvalidAmount"
+	RuleErrorSubscriptionInvalidPeriodBlocks              RuleError = "RuleErrorSubscriptionInvalidPeriodBlocks"
+	RuleErrorSubscriptionInvalidExpirationBlockHeight     RuleError = "RuleErrorSubscriptionInvalidExpirationBlockHeight"
+	RuleErrorSubscriptionCreateNotBySubscriber            RuleError = "RuleErrorSubscriptionCreateNotBySubscriber"
+	RuleErrorSubscriptionCancelNotBySubscriberOrRecipient RuleError = "RuleErrorSubscriptionCancelNotBySubscriberOrRecipient"
+	RuleErrorSubscriptionClaimNotByRecipient              RuleError = "RuleErrorSubscriptionClaimNotByRecipient"
+	RuleErrorSubscriptionDoesNotExist                     RuleError = "RuleErrorSubscriptionDoesNotExist"
+	RuleErrorSubscriptionExpired                          RuleError = "RuleErrorSubscriptionExpired"
+	RuleErrorSubscriptionClaimExceedsMaxPerPeriod         RuleError = "RuleErrorSubscriptionClaimExceedsMaxPerPeriod"
+	RuleErrorSubscriptionInsufficientBalance              RuleError = "RuleErrorSubscriptionInsufficientBalance"
+
 	HeaderErrorDuplicateHeader                                                   RuleError = "HeaderErrorDuplicateHeader"
 	HeaderErrorNilPrevHash                                                       RuleError = "HeaderErrorNilPrevHash"
 	HeaderErrorInvalidParent                                                     RuleError = "HeaderErrorInvalidParent"
 	HeaderErrorBlockTooFarInTheFuture                                            RuleError = "HeaderErrorBlockTooFarInTheFuture"
 	HeaderErrorTimestampTooEarly                                                 RuleError = "HeaderErrorTimestampTooEarly"
+	HeaderErrorTimestampNotAfterMedianTimePast                                   RuleError = "HeaderErrorTimestampNotAfterMedianTimePast"
 	HeaderErrorBlockDifficultyAboveTarget                                        RuleError = "HeaderErrorBlockDifficultyAboveTarget"
 	HeaderErrorHeightInvalid                                                     RuleError = "HeaderErrorHeightInvalid"
 	HeaderErrorDifficultyBitsNotConsistentWithTargetDifficultyComputedFromParent RuleError = "HeaderErrorDifficultyBitsNotConsistentWithTargetDifficultyComputedFromParent"
 	HeaderErrorBlockHeightAfterProofOfStakeCutover                               RuleError = "HeaderErrorBlockHeightAfterProofOfStakeCutover"
 	HeaderErrorBestChainIsAtProofOfStakeCutover                                  RuleError = "HeaderErrorBestChainIsAtProofOfStakeCutover"
+	HeaderErrorConflictsWithCheckpoint                                           RuleError = "HeaderErrorConflictsWithCheckpoint"
+	HeaderErrorForkBeforeCheckpoint                                              RuleError = "HeaderErrorForkBeforeCheckpoint"
 
 	TxErrorTooLarge                                 RuleError = "TxErrorTooLarge"
 	TxErrorDuplicate                                RuleError = "TxErrorDuplicate"
@@ -592,8 +712,12 @@ const (
 	TxErrorNoNonceAfterBalanceModelBlockHeight      RuleError = "TxErrorNoNonceAfterBalanceModelBlockHeight"
 
 	// Mempool
-	MempoolErrorNotRunning          RuleError = "MempoolErrorNotRunning"
-	MempoolFailedReplaceByHigherFee RuleError = "MempoolFailedReplaceByHigherFee"
+	MempoolErrorNotRunning             RuleError = "MempoolErrorNotRunning"
+	MempoolFailedReplaceByHigherFee    RuleError = "MempoolFailedReplaceByHigherFee"
+	MempoolErrorNonceQueueFull         RuleError = "MempoolErrorNonceQueueFull"
+	MempoolErrorBatchRejected          RuleError = "MempoolErrorBatchRejected"
+	MempoolErrorAugmentedViewStale     RuleError = "MempoolErrorAugmentedViewStale"
+	MempoolErrorPublicKeyQuotaExceeded RuleError = "MempoolErrorPublicKeyQuotaExceeded"
 )
 
 func (e RuleError) Error() string {
@@ -0,0 +1,526 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/deso-protocol/uint256"
+	"github.com/pkg/errors"
+)
+
+// ExtraData Schemas
+//
+// Transactions and most entries carry an ExtraData map[string][]byte that is opaque to the encoders. Many of its
+// keys are well-known, however, and have a fixed encoding: global param values are uvarints, derived and messaging
+// keys are compressed public keys, and so on. An ExtraDataSchema records the encoding of a well-known key, and the
+// ExtraDataSchemaRegistry maps keys to their schemas. The typed accessors below, e.g. GetExtraDataUint64 and
+// MsgDeSoTxn.SetExtraDataPublicKey, use the registry so that a key is always read and written with the same codec,
+// instead of every call site parsing the raw bytes by hand.
+//
+// The codecs decode values exactly the way the consensus code always has, e.g. a uint64 is read with Uvarint and
+// any trailing bytes are ignored. This lets consensus code use the accessors without changing which transactions
+// are valid. Keys that aren't registered can still be read and written directly through the map.
+//
+// Validators are hooks that run on a value after it has been decoded successfully. Use them for checks that apply
+// everywhere a key is used, e.g. bounds on a value, and keep checks that depend on the transaction type in the
+// code that connects the transaction.
+
+// ExtraDataValueType is the codec used for the values of an ExtraData key.
+type ExtraDataValueType uint8
+
+const (
+	// ExtraDataValueTypeUint64 values are encoded with UintToBuf.
+	ExtraDataValueTypeUint64 ExtraDataValueType = 0
+	// ExtraDataValueTypePublicKey values are 33-byte compressed public keys.
+	ExtraDataValueTypePublicKey ExtraDataValueType = 1
+	// ExtraDataValueTypeString values are UTF-8 strings.
+	ExtraDataValueTypeString ExtraDataValueType = 2
+	// ExtraDataValueTypeUint256 values are encoded with VariableEncodeUint256.
+	ExtraDataValueTypeUint256 ExtraDataValueType = 3
+)
+
+func (valueType ExtraDataValueType) String() string {
+	switch valueType {
+	case ExtraDataValueTypeUint64:
+		return "Uint64"
+	case ExtraDataValueTypePublicKey:
+		return "PublicKey"
+	case ExtraDataValueTypeString:
+		return "String"
+	case ExtraDataValueTypeUint256:
+		return "Uint256"
+	default:
+		return fmt.Sprintf("ExtraDataValueType(%d)", uint8(valueType))
+	}
+}
+
+// ExtraDataValidatorFunc is run on the raw bytes of a value after they have been decoded successfully.
+type ExtraDataValidatorFunc func(key string, value []byte) error
+
+// ExtraDataSchema describes how the values of a well-known ExtraData key are encoded.
+type ExtraDataSchema struct {
+	Key       string
+	ValueType ExtraDataValueType
+	// Validators run in the order they were added.
+	Validators []ExtraDataValidatorFunc
+}
+
+// validate checks that value is a valid encoding of the schema's type and runs the schema's validators.
+func (schema *ExtraDataSchema) validate(value []byte) error {
+	var err error
+	switch schema.ValueType {
+	case ExtraDataValueTypeUint64:
+		_, err = decodeExtraDataUint64(schema.Key, value)
+	case ExtraDataValueTypePublicKey:
+		_, err = decodeExtraDataPublicKey(schema.Key, value)
+	case ExtraDataValueTypeString:
+		_, err = decodeExtraDataString(schema.Key, value)
+	case ExtraDataValueTypeUint256:
+		_, err = decodeExtraDataUint256(schema.Key, value)
+	default:
+		err = fmt.Errorf("unknown value type %v for key %v", schema.ValueType, schema.Key)
+	}
+	if err != nil {
+		return err
+	}
+	for _, validator := range schema.Validators {
+		if err = validator(schema.Key, value); err != nil {
+			return errors.Wrapf(err, "invalid value for key %v", schema.Key)
+		}
+	}
+	return nil
+}
+
+// ExtraDataSchemaRegistry maps ExtraData keys to their schemas. It is safe for concurrent use.
+type ExtraDataSchemaRegistry struct {
+	mtx     sync.RWMutex
+	schemas map[string]*ExtraDataSchema
+}
+
+func NewExtraDataSchemaRegistry() *ExtraDataSchemaRegistry {
+	return &ExtraDataSchemaRegistry{
+		schemas: make(map[string]*ExtraDataSchema),
+	}
+}
+
+// Register adds a schema for key. Registering the same key twice with the same type is a no-op, so that packages
+// can register the keys they use without coordinating. Registering it with a different type is an error.
+func (registry *ExtraDataSchemaRegistry) Register(key string, valueType ExtraDataValueType) error {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+
+	if existingSchema, exists := registry.schemas[key]; exists {
+		if existingSchema.ValueType != valueType {
+			return fmt.Errorf("ExtraDataSchemaRegistry.Register: Key %v is already registered with type %v, "+
+				"cannot register it with type %v", key, existingSchema.ValueType, valueType)
+		}
+		return nil
+	}
+	registry.schemas[key] = &ExtraDataSchema{Key: key, ValueType: valueType}
+	return nil
+}
+
+// AddValidator adds a validation hook to the schema of key, which must already be registered.
+func (registry *ExtraDataSchemaRegistry) AddValidator(key string, validator ExtraDataValidatorFunc) error {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+
+	schema, exists := registry.schemas[key]
+	if !exists {
+		return fmt.Errorf("ExtraDataSchemaRegistry.AddValidator: Key %v is not registered", key)
+	}
+	// Copy the validators so that a schema returned by GetSchema is never modified.
+	schema.Validators = append(append([]ExtraDataValidatorFunc{}, schema.Validators...), validator)
+	return nil
+}
+
+// GetSchema returns the schema registered for key, if any. The returned schema must not be modified.
+func (registry *ExtraDataSchemaRegistry) GetSchema(key string) (*ExtraDataSchema, bool) {
+	registry.mtx.RLock()
+	defer registry.mtx.RUnlock()
+
+	schema, exists := registry.schemas[key]
+	if !exists {
+		return nil, false
+	}
+	schemaCopy := *schema
+	return &schemaCopy, true
+}
+
+// Validate checks every registered key present in extraData against its schema. Keys that aren't registered are
+// ignored. Keys are checked in sorted order so that the error returned is deterministic.
+func (registry *ExtraDataSchemaRegistry) Validate(extraData map[string][]byte) error {
+	keys := make([]string, 0, len(extraData))
+	for key := range extraData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		schema, exists := registry.GetSchema(key)
+		if !exists {
+			continue
+		}
+		if err := schema.validate(extraData[key]); err != nil {
+			return errors.Wrapf(err, "ExtraDataSchemaRegistry.Validate: ")
+		}
+	}
+	return nil
+}
+
+// getTypedSchema returns the schema of key, or an error if key is registered with a type other than valueType.
+// Keys that aren't registered are allowed so that the accessors can be used for ad-hoc keys as well.
+func (registry *ExtraDataSchemaRegistry) getTypedSchema(key string, valueType ExtraDataValueType) (
+	*ExtraDataSchema, error) {
+
+	schema, exists := registry.GetSchema(key)
+	if !exists {
+		return &ExtraDataSchema{Key: key, ValueType: valueType}, nil
+	}
+	if schema.ValueType != valueType {
+		return nil, fmt.Errorf("key %v is registered with type %v, not %v", key, schema.ValueType, valueType)
+	}
+	return schema, nil
+}
+
+// ExtraDataSchemas is the registry used by the typed accessors. It comes with the well-known keys from
+// constants.go already registered.
+var ExtraDataSchemas = newDefaultExtraDataSchemaRegistry()
+
+func newDefaultExtraDataSchemaRegistry() *ExtraDataSchemaRegistry {
+	registry := NewExtraDataSchemaRegistry()
+	uint64Keys := []string{
+		// Global params.
+		USDCentsPerBitcoinKey,
+		MinNetworkFeeNanosPerKBKey,
+		CreateProfileFeeNanosKey,
+		CreateNFTFeeNanosKey,
+		MaxCopiesPerNFTKey,
+		MaxNonceExpirationBlockHeightOffsetKey,
+		StakeLockupEpochDurationKey,
+		ValidatorJailEpochDurationKey,
+		LeaderScheduleMaxNumValidatorsKey,
+		ValidatorSetMaxNumValidatorsKey,
+		StakingRewardsMaxNumStakesKey,
+		StakingRewardsAPYBasisPointsKey,
+		EpochDurationNumBlocksKey,
+		JailInactiveValidatorGracePeriodEpochsKey,
+		FeeBucketGrowthRateBasisPointsKey,
+		MempoolMaxSizeBytesKey,
+		MempoolFeeEstimatorNumMempoolBlocksKey,
+		MempoolFeeEstimatorNumPastBlocksKey,
+		MempoolCongestionFactorBasisPointsKey,
+		MempoolPastBlocksCongestionFactorBasisPointsKey,
+		MempoolPriorityPercentileBasisPointsKey,
+		MempoolPastBlocksPriorityPercentileBasisPointsKey,
+		MaxBlockSizeBytesPoSKey,
+		SoftMaxBlockSizeBytesPoSKey,
+		MaxTxnSizeBytesPoSKey,
+		BlockProductionIntervalPoSKey,
+		TimeoutIntervalPoSKey,
+		TimeoutBackoffMultiplierBasisPointsPoSKey,
+		BlockRewardMaturityBlocksKey,
+		FeeRedistributionBasisPointsKey,
+		// Other transactions.
+		AtomicTxnsChainLength,
+		BuyNowPriceKey,
+		MessagesVersionString,
+		LockupVestingCliffBlockHeightKey,
+		LockupTransferVestingEndTimestampNanoSecsKey,
+		MessageReadStateWatermarkNanosKey,
+		NFTAvatarSerialNumberKey,
+	}
+	publicKeyKeys := []string{
+		ForbiddenBlockSignaturePubKeyKey,
+		DerivedPublicKey,
+		MessagingPublicKey,
+		SenderMessagingPublicKey,
+		RecipientMessagingPublicKey,
+		MessageReadStateGroupOwnerPublicKeyKey,
+	}
+	stringKeys := []string{
+		CoinCategoryExtraDataKey,
+	}
+	uint256Keys := []string{
+		LockupVestingReleaseRateBaseUnitsPerBlockKey,
+	}
+	for _, key := range uint64Keys {
+		registry.mustRegister(key, ExtraDataValueTypeUint64)
+	}
+	for _, key := range publicKeyKeys {
+		registry.mustRegister(key, ExtraDataValueTypePublicKey)
+	}
+	for _, key := range stringKeys {
+		registry.mustRegister(key, ExtraDataValueTypeString)
+	}
+	for _, key := range uint256Keys {
+		registry.mustRegister(key, ExtraDataValueTypeUint256)
+	}
+	return registry
+}
+
+func (registry *ExtraDataSchemaRegistry) mustRegister(key string, valueType ExtraDataValueType) {
+	if err := registry.Register(key, valueType); err != nil {
+		panic(err)
+	}
+}
+
+// ========================
+//	Codecs
+// ========================
+
+func decodeExtraDataUint64(key string, value []byte) (uint64, error) {
+	decodedValue, bytesRead := Uvarint(value)
+	if bytesRead <= 0 {
+		return 0, fmt.Errorf("unable to decode %v as uint64", key)
+	}
+	return decodedValue, nil
+}
+
+func decodeExtraDataPublicKey(key string, value []byte) (*PublicKey, error) {
+	if len(value) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("unable to decode %v as public key: length %d should be %d",
+			key, len(value), btcec.PubKeyBytesLenCompressed)
+	}
+	return NewPublicKey(value), nil
+}
+
+func decodeExtraDataString(key string, value []byte) (string, error) {
+	if !utf8.Valid(value) {
+		return "", fmt.Errorf("unable to decode %v as string: invalid UTF-8", key)
+	}
+	return string(value), nil
+}
+
+func decodeExtraDataUint256(key string, value []byte) (*uint256.Int, error) {
+	rr := bytes.NewReader(value)
+	decodedValue, err := VariableDecodeUint256(rr)
+	if err != nil || decodedValue == nil || rr.Len() != 0 {
+		return nil, fmt.Errorf("unable to decode %v as uint256", key)
+	}
+	return decodedValue, nil
+}
+
+// ========================
+//	Typed Accessors
+// ========================
+
+// getExtraDataValue returns the value of key in extraData after checking it against the schema for valueType.
+func getExtraDataValue(extraData map[string][]byte, key string, valueType ExtraDataValueType) (
+	_value []byte, _exists bool, _err error) {
+
+	value, exists := extraData[key]
+	if !exists {
+		return nil, false, nil
+	}
+	schema, err := ExtraDataSchemas.getTypedSchema(key, valueType)
+	if err != nil {
+		return nil, true, err
+	}
+	if err = schema.validate(value); err != nil {
+		return nil, true, err
+	}
+	return value, true, nil
+}
+
+// setExtraDataValue sets key in extraData, which must not be nil, after checking value against the schema for
+// valueType.
+func setExtraDataValue(extraData map[string][]byte, key string, valueType ExtraDataValueType, value []byte) error {
+	schema, err := ExtraDataSchemas.getTypedSchema(key, valueType)
+	if err != nil {
+		return err
+	}
+	if err = schema.validate(value); err != nil {
+		return err
+	}
+	extraData[key] = value
+	return nil
+}
+
+// GetExtraDataUint64 decodes the uint64 stored under key. The second return value is false if key isn't present.
+func GetExtraDataUint64(extraData map[string][]byte, key string) (_value uint64, _exists bool, _err error) {
+	value, exists, err := getExtraDataValue(extraData, key, ExtraDataValueTypeUint64)
+	if err != nil || !exists {
+		return 0, exists, err
+	}
+	decodedValue, err := decodeExtraDataUint64(key, value)
+	return decodedValue, true, err
+}
+
+// GetExtraDataPublicKey decodes the public key stored under key. The second return value is false if key isn't
+// present.
+func GetExtraDataPublicKey(extraData map[string][]byte, key string) (_value *PublicKey, _exists bool, _err error) {
+	value, exists, err := getExtraDataValue(extraData, key, ExtraDataValueTypePublicKey)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	decodedValue, err := decodeExtraDataPublicKey(key, value)
+	return decodedValue, true, err
+}
+
+// GetExtraDataString decodes the string stored under key. The second return value is false if key isn't present.
+func GetExtraDataString(extraData map[string][]byte, key string) (_value string, _exists bool, _err error) {
+	value, exists, err := getExtraDataValue(extraData, key, ExtraDataValueTypeString)
+	if err != nil || !exists {
+		return "", exists, err
+	}
+	decodedValue, err := decodeExtraDataString(key, value)
+	return decodedValue, true, err
+}
+
+// GetExtraDataUint256 decodes the uint256 stored under key. The second return value is false if key isn't
+// present.
+func GetExtraDataUint256(extraData map[string][]byte, key string) (_value *uint256.Int, _exists bool, _err error) {
+	value, exists, err := getExtraDataValue(extraData, key, ExtraDataValueTypeUint256)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	decodedValue, err := decodeExtraDataUint256(key, value)
+	return decodedValue, true, err
+}
+
+// SetExtraDataUint64 encodes value under key. extraData must not be nil.
+func SetExtraDataUint64(extraData map[string][]byte, key string, value uint64) error {
+	return setExtraDataValue(extraData, key, ExtraDataValueTypeUint64, UintToBuf(value))
+}
+
+// SetExtraDataPublicKey encodes value under key. extraData must not be nil.
+func SetExtraDataPublicKey(extraData map[string][]byte, key string, value *PublicKey) error {
+	if value == nil {
+		return fmt.Errorf("SetExtraDataPublicKey: Public key for %v cannot be nil", key)
+	}
+	return setExtraDataValue(extraData, key, ExtraDataValueTypePublicKey, value.ToBytes())
+}
+
+// SetExtraDataString encodes value under key. extraData must not be nil.
+func SetExtraDataString(extraData map[string][]byte, key string, value string) error {
+	return setExtraDataValue(extraData, key, ExtraDataValueTypeString, []byte(value))
+}
+
+// SetExtraDataUint256 encodes value under key. extraData must not be nil.
+func SetExtraDataUint256(extraData map[string][]byte, key string, value *uint256.Int) error {
+	if value == nil {
+		return fmt.Errorf("SetExtraDataUint256: Value for %v cannot be nil", key)
+	}
+	return setExtraDataValue(extraData, key, ExtraDataValueTypeUint256, VariableEncodeUint256(value))
+}
+
+// ValidateExtraData checks every well-known key in extraData against its schema in ExtraDataSchemas.
+func ValidateExtraData(extraData map[string][]byte) error {
+	return ExtraDataSchemas.Validate(extraData)
+}
+
+// The typed accessors on MsgDeSoTxn and on the entries allocate the ExtraData map when setting a value on a nil map.
+
+func (txn *MsgDeSoTxn) GetExtraDataUint64(key string) (_value uint64, _exists bool, _err error) {
+	return GetExtraDataUint64(txn.ExtraData, key)
+}
+
+func (txn *MsgDeSoTxn) GetExtraDataPublicKey(key string) (_value *PublicKey, _exists bool, _err error) {
+	return GetExtraDataPublicKey(txn.ExtraData, key)
+}
+
+func (txn *MsgDeSoTxn) GetExtraDataString(key string) (_value string, _exists bool, _err error) {
+	return GetExtraDataString(txn.ExtraData, key)
+}
+
+func (txn *MsgDeSoTxn) GetExtraDataUint256(key string) (_value *uint256.Int, _exists bool, _err error) {
+	return GetExtraDataUint256(txn.ExtraData, key)
+}
+
+func (txn *MsgDeSoTxn) SetExtraDataUint64(key string, value uint64) error {
+	if txn.ExtraData == nil {
+		txn.ExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataUint64(txn.ExtraData, key, value)
+}
+
+func (txn *MsgDeSoTxn) SetExtraDataPublicKey(key string, value *PublicKey) error {
+	if txn.ExtraData == nil {
+		txn.ExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataPublicKey(txn.ExtraData, key, value)
+}
+
+func (txn *MsgDeSoTxn) SetExtraDataString(key string, value string) error {
+	if txn.ExtraData == nil {
+		txn.ExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataString(txn.ExtraData, key, value)
+}
+
+func (txn *MsgDeSoTxn) SetExtraDataUint256(key string, value *uint256.Int) error {
+	if txn.ExtraData == nil {
+		txn.ExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataUint256(txn.ExtraData, key, value)
+}
+
+func (pe *PostEntry) GetExtraDataUint64(key string) (_value uint64, _exists bool, _err error) {
+	return GetExtraDataUint64(pe.PostExtraData, key)
+}
+
+func (pe *PostEntry) GetExtraDataPublicKey(key string) (_value *PublicKey, _exists bool, _err error) {
+	return GetExtraDataPublicKey(pe.PostExtraData, key)
+}
+
+func (pe *PostEntry) GetExtraDataString(key string) (_value string, _exists bool, _err error) {
+	return GetExtraDataString(pe.PostExtraData, key)
+}
+
+func (pe *PostEntry) SetExtraDataUint64(key string, value uint64) error {
+	if pe.PostExtraData == nil {
+		pe.PostExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataUint64(pe.PostExtraData, key, value)
+}
+
+func (pe *PostEntry) SetExtraDataPublicKey(key string, value *PublicKey) error {
+	if pe.PostExtraData == nil {
+		pe.PostExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataPublicKey(pe.PostExtraData, key, value)
+}
+
+func (pe *PostEntry) SetExtraDataString(key string, value string) error {
+	if pe.PostExtraData == nil {
+		pe.PostExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataString(pe.PostExtraData, key, value)
+}
+
+func (pe *ProfileEntry) GetExtraDataUint64(key string) (_value uint64, _exists bool, _err error) {
+	return GetExtraDataUint64(pe.ExtraData, key)
+}
+
+func (pe *ProfileEntry) GetExtraDataPublicKey(key string) (_value *PublicKey, _exists bool, _err error) {
+	return GetExtraDataPublicKey(pe.ExtraData, key)
+}
+
+func (pe *ProfileEntry) GetExtraDataString(key string) (_value string, _exists bool, _err error) {
+	return GetExtraDataString(pe.ExtraData, key)
+}
+
+func (pe *ProfileEntry) SetExtraDataUint64(key string, value uint64) error {
+	if pe.ExtraData == nil {
+		pe.ExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataUint64(pe.ExtraData, key, value)
+}
+
+func (pe *ProfileEntry) SetExtraDataPublicKey(key string, value *PublicKey) error {
+	if pe.ExtraData == nil {
+		pe.ExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataPublicKey(pe.ExtraData, key, value)
+}
+
+func (pe *ProfileEntry) SetExtraDataString(key string, value string) error {
+	if pe.ExtraData == nil {
+		pe.ExtraData = make(map[string][]byte)
+	}
+	return SetExtraDataString(pe.ExtraData, key, value)
+}
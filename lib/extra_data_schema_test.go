@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtraDataTypedAccessors(t *testing.T) {
+	require := require.New(t)
+
+	txn := &MsgDeSoTxn{}
+
+	// Getters on a nil map report the key as missing.
+	_, exists, err := txn.GetExtraDataUint64(BuyNowPriceKey)
+	require.NoError(err)
+	require.False(exists)
+
+	// Values round trip through the setters and getters.
+	require.NoError(txn.SetExtraDataUint64(BuyNowPriceKey, 12345))
+	require.Equal(UintToBuf(12345), txn.ExtraData[BuyNowPriceKey])
+	buyNowPrice, exists, err := txn.GetExtraDataUint64(BuyNowPriceKey)
+	require.NoError(err)
+	require.True(exists)
+	require.Equal(uint64(12345), buyNowPrice)
+
+	derivedPublicKey := NewPublicKey(m1PkBytes)
+	require.NoError(txn.SetExtraDataPublicKey(DerivedPublicKey, derivedPublicKey))
+	decodedPublicKey, exists, err := txn.GetExtraDataPublicKey(DerivedPublicKey)
+	require.NoError(err)
+	require.True(exists)
+	require.Equal(derivedPublicKey, decodedPublicKey)
+
+	releaseRate := uint256.NewInt(0).Lsh(uint256.NewInt(1), 100)
+	require.NoError(txn.SetExtraDataUint256(LockupVestingReleaseRateBaseUnitsPerBlockKey, releaseRate))
+	decodedReleaseRate, exists, err := txn.GetExtraDataUint256(LockupVestingReleaseRateBaseUnitsPerBlockKey)
+	require.NoError(err)
+	require.True(exists)
+	require.True(releaseRate.Eq(decodedReleaseRate))
+
+	profileEntry := &ProfileEntry{}
+	require.NoError(profileEntry.SetExtraDataString(CoinCategoryExtraDataKey, "music"))
+	category, exists, err := profileEntry.GetExtraDataString(CoinCategoryExtraDataKey)
+	require.NoError(err)
+	require.True(exists)
+	require.Equal("music", category)
+
+	// Registered keys can only be accessed with their own type.
+	require.Error(txn.SetExtraDataString(BuyNowPriceKey, "12345"))
+	_, _, err = txn.GetExtraDataString(BuyNowPriceKey)
+	require.Error(err)
+
+	// Malformed values are reported by the getters and by ValidateExtraData.
+	txn.ExtraData[DerivedPublicKey] = m1PkBytes[:10]
+	_, exists, err = txn.GetExtraDataPublicKey(DerivedPublicKey)
+	require.Error(err)
+	require.True(exists)
+	require.Error(ValidateExtraData(txn.ExtraData))
+	txn.ExtraData[DerivedPublicKey] = m1PkBytes
+	require.NoError(ValidateExtraData(txn.ExtraData))
+
+	// Unregistered keys can be used with any type and are ignored by ValidateExtraData.
+	postEntry := &PostEntry{}
+	require.NoError(postEntry.SetExtraDataUint64("CustomKey", 7))
+	customValue, exists, err := postEntry.GetExtraDataUint64("CustomKey")
+	require.NoError(err)
+	require.True(exists)
+	require.Equal(uint64(7), customValue)
+	postEntry.PostExtraData["OtherKey"] = []byte{0xff}
+	require.NoError(ValidateExtraData(postEntry.PostExtraData))
+}
+
+func TestExtraDataSchemaRegistry(t *testing.T) {
+	require := require.New(t)
+
+	registry := NewExtraDataSchemaRegistry()
+	require.NoError(registry.Register("Amount", ExtraDataValueTypeUint64))
+	// Registering a key again with the same type is allowed, but not with another type.
+	require.NoError(registry.Register("Amount", ExtraDataValueTypeUint64))
+	require.Error(registry.Register("Amount", ExtraDataValueTypeString))
+
+	// Validators can only be added to registered keys.
+	errTooLarge := errors.New("amount too large")
+	require.Error(registry.AddValidator("Unknown", func(key string, value []byte) error { return nil }))
+	require.NoError(registry.AddValidator("Amount", func(key string, value []byte) error {
+		if amount, _ := Uvarint(value); amount > 100 {
+			return errTooLarge
+		}
+		return nil
+	}))
+
+	require.NoError(registry.Validate(map[string][]byte{"Amount": UintToBuf(100)}))
+	err := registry.Validate(map[string][]byte{"Amount": UintToBuf(101)})
+	require.ErrorIs(err, errTooLarge)
+	// Values that can't be decoded fail before the validators run.
+	require.Error(registry.Validate(map[string][]byte{"Amount": {}}))
+
+	schema, exists := registry.GetSchema("Amount")
+	require.True(exists)
+	require.Equal(ExtraDataValueTypeUint64, schema.ValueType)
+	require.Len(schema.Validators, 1)
+}
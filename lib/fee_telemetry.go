@@ -0,0 +1,366 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fee Telemetry
+//
+// A node's fee estimate only reflects the transactions in its own mempool, which can be skewed by the peers it
+// happens to be connected to, or by a burst of transactions submitted directly to it. To give wallets a fee
+// suggestion that reflects the network as a whole, nodes that set the SFFeeTelemetry service flag share a summary
+// of their mempool with each other every fee telemetry interval. The summary is a FEE_TELEMETRY message with the
+// size of the mempool, the fee rates at FeeTelemetryPercentilesBasisPoints of its bytes, and the node's own fee
+// estimate.
+//
+// The FeeTelemetryAggregator keeps the latest summary from each peer. The network-wide estimate is the median of
+// each value across our own summary and the recent summaries of the peers whose tip is close to ours, so that a
+// few peers reporting bogus fees can't move it. With fewer than feeTelemetryMinPeerSummaries such summaries, the
+// estimate is our own summary. The summaries are advisory, they're never used for consensus, and a peer that
+// sends them more often than the interval has them ignored.
+
+const (
+	// DefaultFeeTelemetryIntervalSeconds is the default interval between the summaries a node sends its peers.
+	DefaultFeeTelemetryIntervalSeconds = 60
+
+	// feeTelemetryStaleIntervalMultiple is the number of fee telemetry intervals after which a peer's summary is
+	// no longer used.
+	feeTelemetryStaleIntervalMultiple = 3
+
+	// feeTelemetryMinPeerSummaries is the number of peer summaries needed to aggregate a network-wide estimate.
+	feeTelemetryMinPeerSummaries = 3
+
+	// feeTelemetryMaxTipHeightDiff is how far a peer's tip can be from ours for its summary to be used. A peer
+	// that's syncing doesn't have a meaningful mempool.
+	feeTelemetryMaxTipHeightDiff = 10
+)
+
+// FeeTelemetryPercentilesBasisPoints are the percentiles of the mempool's bytes, ordered by fee rate, at which a
+// summary reports the fee rate. The 5000 basis points percentile is the fee rate that half of the mempool's bytes
+// pay at most.
+var FeeTelemetryPercentilesBasisPoints = []uint64{1000, 2500, 5000, 7500, 9000}
+
+// ==================================================================
+// Fee telemetry message
+// ==================================================================
+
+// MsgDeSoFeeTelemetry is a summary of a node's mempool that it shares with its peers.
+type MsgDeSoFeeTelemetry struct {
+	// TipHeight is the height of the block the node's mempool is built on.
+	TipHeight      uint64
+	NumTxns        uint64
+	TotalSizeBytes uint64
+	// FeeRatePercentilesNanosPerKB holds the fee rate at each of FeeTelemetryPercentilesBasisPoints, in order.
+	// They're zero if the mempool is empty.
+	FeeRatePercentilesNanosPerKB []uint64
+	// EstimatedFeeRateNanosPerKB is the fee rate the node's fee estimator suggests.
+	EstimatedFeeRateNanosPerKB uint64
+}
+
+func (msg *MsgDeSoFeeTelemetry) GetMsgType() MsgType {
+	return MsgTypeFeeTelemetry
+}
+
+func (msg *MsgDeSoFeeTelemetry) ToBytes(preSignature bool) ([]byte, error) {
+	if len(msg.FeeRatePercentilesNanosPerKB) != len(FeeTelemetryPercentilesBasisPoints) {
+		return nil, fmt.Errorf("MsgDeSoFeeTelemetry.ToBytes: Expected %d fee rate percentiles, got %d",
+			len(FeeTelemetryPercentilesBasisPoints), len(msg.FeeRatePercentilesNanosPerKB))
+	}
+	data := UintToBuf(msg.TipHeight)
+	data = append(data, UintToBuf(msg.NumTxns)...)
+	data = append(data, UintToBuf(msg.TotalSizeBytes)...)
+	data = append(data, UintToBuf(uint64(len(msg.FeeRatePercentilesNanosPerKB)))...)
+	for _, feeRate := range msg.FeeRatePercentilesNanosPerKB {
+		data = append(data, UintToBuf(feeRate)...)
+	}
+	data = append(data, UintToBuf(msg.EstimatedFeeRateNanosPerKB)...)
+	return data, nil
+}
+
+func (msg *MsgDeSoFeeTelemetry) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	tipHeight, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoFeeTelemetry.FromBytes: Problem reading tip height")
+	}
+	numTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoFeeTelemetry.FromBytes: Problem reading number of txns")
+	}
+	totalSizeBytes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoFeeTelemetry.FromBytes: Problem reading total size")
+	}
+	numPercentiles, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoFeeTelemetry.FromBytes: Problem reading number of percentiles")
+	}
+	if numPercentiles != uint64(len(FeeTelemetryPercentilesBasisPoints)) {
+		return fmt.Errorf("MsgDeSoFeeTelemetry.FromBytes: Expected %d fee rate percentiles, got %d",
+			len(FeeTelemetryPercentilesBasisPoints), numPercentiles)
+	}
+	feeRatePercentiles := make([]uint64, numPercentiles)
+	for ii := range feeRatePercentiles {
+		if feeRatePercentiles[ii], err = ReadUvarint(rr); err != nil {
+			return errors.Wrapf(err, "MsgDeSoFeeTelemetry.FromBytes: Problem reading fee rate percentile %d", ii)
+		}
+		if ii > 0 && feeRatePercentiles[ii] < feeRatePercentiles[ii-1] {
+			return fmt.Errorf("MsgDeSoFeeTelemetry.FromBytes: Fee rate percentile %d is lower than the one "+
+				"before it", ii)
+		}
+	}
+	estimatedFeeRate, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoFeeTelemetry.FromBytes: Problem reading estimated fee rate")
+	}
+	*msg = MsgDeSoFeeTelemetry{
+		TipHeight:                    tipHeight,
+		NumTxns:                      numTxns,
+		TotalSizeBytes:               totalSizeBytes,
+		FeeRatePercentilesNanosPerKB: feeRatePercentiles,
+		EstimatedFeeRateNanosPerKB:   estimatedFeeRate,
+	}
+	return nil
+}
+
+func (msg *MsgDeSoFeeTelemetry) String() string {
+	return fmt.Sprintf("TipHeight: %d, NumTxns: %d, TotalSizeBytes: %d, FeeRatePercentiles: %v, "+
+		"EstimatedFeeRate: %d", msg.TipHeight, msg.NumTxns, msg.TotalSizeBytes, msg.FeeRatePercentilesNanosPerKB,
+		msg.EstimatedFeeRateNanosPerKB)
+}
+
+// NewFeeTelemetrySummary summarizes the transactions of a mempool built on the block at tipHeight.
+func NewFeeTelemetrySummary(
+	mempoolTxns []*MempoolTx,
+	tipHeight uint64,
+	estimatedFeeRateNanosPerKB uint64,
+) *MsgDeSoFeeTelemetry {
+	summary := &MsgDeSoFeeTelemetry{
+		TipHeight:                    tipHeight,
+		FeeRatePercentilesNanosPerKB: make([]uint64, len(FeeTelemetryPercentilesBasisPoints)),
+		EstimatedFeeRateNanosPerKB:   estimatedFeeRateNanosPerKB,
+	}
+	var txns []*MempoolTx
+	for _, txn := range mempoolTxns {
+		if txn == nil || txn.TxSizeBytes == 0 {
+			continue
+		}
+		txns = append(txns, txn)
+		summary.TotalSizeBytes += txn.TxSizeBytes
+	}
+	summary.NumTxns = uint64(len(txns))
+	if len(txns) == 0 {
+		return summary
+	}
+	sort.Slice(txns, func(ii, jj int) bool {
+		return txns[ii].FeePerKB < txns[jj].FeePerKB
+	})
+
+	// The fee rate at a percentile is the fee rate of the txn that the percentile's byte falls in.
+	var cumulativeSizeBytes uint64
+	txnIndex := 0
+	for ii, percentileBasisPoints := range FeeTelemetryPercentilesBasisPoints {
+		percentileSizeBytes := summary.TotalSizeBytes * percentileBasisPoints / MaxBasisPoints
+		for txnIndex < len(txns)-1 && cumulativeSizeBytes+txns[txnIndex].TxSizeBytes <= percentileSizeBytes {
+			cumulativeSizeBytes += txns[txnIndex].TxSizeBytes
+			txnIndex++
+		}
+		summary.FeeRatePercentilesNanosPerKB[ii] = txns[txnIndex].FeePerKB
+	}
+	return summary
+}
+
+// ==================================================================
+// Fee telemetry aggregator
+// ==================================================================
+
+// NetworkFeeEstimate is a fee estimate aggregated from our own mempool summary and our peers'.
+type NetworkFeeEstimate struct {
+	// NumPeerSummaries is the number of peer summaries the estimate was aggregated from. It's zero if there
+	// weren't enough of them, in which case the estimate is our own summary.
+	NumPeerSummaries int
+	// FeeRatePercentilesNanosPerKB holds the median fee rate at each of FeeTelemetryPercentilesBasisPoints.
+	FeeRatePercentilesNanosPerKB []uint64
+	// EstimatedFeeRateNanosPerKB is the median of the fee rates the nodes' fee estimators suggest.
+	EstimatedFeeRateNanosPerKB uint64
+}
+
+// FeeTelemetryAggregator keeps the latest mempool summary from each of our peers, and aggregates them into a
+// network-wide fee estimate.
+//
+// The methods are safe to call on a nil FeeTelemetryAggregator, which doesn't keep any summaries.
+type FeeTelemetryAggregator struct {
+	mtx sync.Mutex
+	// interval is how often peers are expected to send their summaries.
+	interval      time.Duration
+	peerSummaries map[uint64]*peerFeeTelemetry
+}
+
+type peerFeeTelemetry struct {
+	summary    *MsgDeSoFeeTelemetry
+	receivedAt time.Time
+}
+
+func NewFeeTelemetryAggregator(interval time.Duration) *FeeTelemetryAggregator {
+	return &FeeTelemetryAggregator{
+		interval:      interval,
+		peerSummaries: make(map[uint64]*peerFeeTelemetry),
+	}
+}
+
+// AddPeerSummary records the latest summary of a peer. It returns false, and ignores the summary, if the peer
+// sent its previous summary less than half an interval ago.
+func (agg *FeeTelemetryAggregator) AddPeerSummary(peerID uint64, summary *MsgDeSoFeeTelemetry, now time.Time) bool {
+	if agg == nil || summary == nil {
+		return false
+	}
+	agg.mtx.Lock()
+	defer agg.mtx.Unlock()
+
+	if prevTelemetry, exists := agg.peerSummaries[peerID]; exists && now.Sub(prevTelemetry.receivedAt) < agg.interval/2 {
+		return false
+	}
+	agg.peerSummaries[peerID] = &peerFeeTelemetry{summary: summary, receivedAt: now}
+	return true
+}
+
+// RemovePeer forgets the summary of a peer that disconnected.
+func (agg *FeeTelemetryAggregator) RemovePeer(peerID uint64) {
+	if agg == nil {
+		return
+	}
+	agg.mtx.Lock()
+	defer agg.mtx.Unlock()
+
+	delete(agg.peerSummaries, peerID)
+}
+
+// GetNetworkFeeEstimate aggregates our own summary with the recent summaries of the peers whose tip is close to
+// ours. It returns nil if localSummary is nil.
+func (agg *FeeTelemetryAggregator) GetNetworkFeeEstimate(localSummary *MsgDeSoFeeTelemetry, now time.Time) *NetworkFeeEstimate {
+	if localSummary == nil {
+		return nil
+	}
+	summaries := []*MsgDeSoFeeTelemetry{localSummary}
+	if agg != nil {
+		agg.mtx.Lock()
+		for peerID, peerTelemetry := range agg.peerSummaries {
+			if now.Sub(peerTelemetry.receivedAt) > feeTelemetryStaleIntervalMultiple*agg.interval {
+				delete(agg.peerSummaries, peerID)
+				continue
+			}
+			tipHeight := peerTelemetry.summary.TipHeight
+			if tipHeight+feeTelemetryMaxTipHeightDiff < localSummary.TipHeight ||
+				localSummary.TipHeight+feeTelemetryMaxTipHeightDiff < tipHeight {
+				continue
+			}
+			summaries = append(summaries, peerTelemetry.summary)
+		}
+		agg.mtx.Unlock()
+	}
+	if len(summaries)-1 < feeTelemetryMinPeerSummaries {
+		summaries = summaries[:1]
+	}
+
+	estimate := &NetworkFeeEstimate{
+		NumPeerSummaries:             len(summaries) - 1,
+		FeeRatePercentilesNanosPerKB: make([]uint64, len(FeeTelemetryPercentilesBasisPoints)),
+	}
+	values := make([]uint64, len(summaries))
+	for ii := range FeeTelemetryPercentilesBasisPoints {
+		for jj, summary := range summaries {
+			values[jj] = summary.FeeRatePercentilesNanosPerKB[ii]
+		}
+		estimate.FeeRatePercentilesNanosPerKB[ii] = _feeTelemetryMedian(values)
+	}
+	for jj, summary := range summaries {
+		values[jj] = summary.EstimatedFeeRateNanosPerKB
+	}
+	estimate.EstimatedFeeRateNanosPerKB = _feeTelemetryMedian(values)
+	return estimate
+}
+
+// _feeTelemetryMedian returns the median of values, rounding down to the lower of the two middle values. It sorts
+// values in place.
+func _feeTelemetryMedian(values []uint64) uint64 {
+	sort.Slice(values, func(ii, jj int) bool {
+		return values[ii] < values[jj]
+	})
+	return values[(len(values)-1)/2]
+}
+
+// ==================================================================
+// Server
+// ==================================================================
+
+// _sharesFeeTelemetryWithPeer returns true if we exchange mempool summaries with the peer.
+func (srv *Server) _sharesFeeTelemetryWithPeer(pp *Peer) bool {
+	return srv.feeTelemetryInterval > 0 && pp.serviceFlags.HasService(SFFeeTelemetry)
+}
+
+// _startFeeTelemetry must be run inside a goroutine. It sends a summary of our mempool to each peer that shares
+// fee telemetry every feeTelemetryInterval, until the Server shuts down.
+func (srv *Server) _startFeeTelemetry() {
+	if srv.feeTelemetryInterval == 0 {
+		return
+	}
+
+	for {
+		time.Sleep(srv.feeTelemetryInterval)
+		if atomic.LoadInt32(&srv.shutdown) >= 1 {
+			break
+		}
+		summary := srv._getLocalFeeTelemetrySummary()
+		if summary == nil {
+			continue
+		}
+		for _, pp := range srv.cmgr.GetAllPeers() {
+			if srv._sharesFeeTelemetryWithPeer(pp) {
+				pp.AddDeSoMessage(summary, false)
+			}
+		}
+	}
+}
+
+// _getLocalFeeTelemetrySummary returns the summary of our mempool, or nil if it isn't running.
+func (srv *Server) _getLocalFeeTelemetrySummary() *MsgDeSoFeeTelemetry {
+	mempool := srv.GetMempool()
+	if mempool == nil || !mempool.IsRunning() {
+		return nil
+	}
+	return NewFeeTelemetrySummary(mempool.GetTransactions(), mempool.GetMempoolTipBlockHeight(),
+		mempool.EstimateFeeRate(0))
+}
+
+func (srv *Server) _handleFeeTelemetry(pp *Peer, msg *MsgDeSoFeeTelemetry) {
+	if !srv._sharesFeeTelemetryWithPeer(pp) {
+		srv.logger.V(1).Infof("Server._handleFeeTelemetry: Ignoring unexpected fee telemetry from peer %v", pp)
+		return
+	}
+	if !srv.feeTelemetry.AddPeerSummary(pp.ID, msg, time.Now()) {
+		srv.logger.V(1).Infof("Server._handleFeeTelemetry: Ignoring fee telemetry sent too soon by peer %v", pp)
+	}
+}
+
+// GetNetworkFeeEstimate returns a fee estimate aggregated from the mempool summaries of our peers and our own. It
+// returns nil if our mempool isn't running.
+func (srv *Server) GetNetworkFeeEstimate() *NetworkFeeEstimate {
+	return srv.feeTelemetry.GetNetworkFeeEstimate(srv._getLocalFeeTelemetrySummary(), time.Now())
+}
+
+// EstimateNetworkFeeRate returns the fee rate to suggest to wallets, which is the network-wide estimate, but at
+// least minFeeRateNanosPerKB.
+func (srv *Server) EstimateNetworkFeeRate(minFeeRateNanosPerKB uint64) uint64 {
+	estimate := srv.GetNetworkFeeEstimate()
+	if estimate == nil || estimate.EstimatedFeeRateNanosPerKB < minFeeRateNanosPerKB {
+		return minFeeRateNanosPerKB
+	}
+	return estimate.EstimatedFeeRateNanosPerKB
+}
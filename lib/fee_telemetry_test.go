@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeTelemetrySummary(t *testing.T) {
+	require := require.New(t)
+
+	// An empty mempool has zero fee rates.
+	summary := NewFeeTelemetrySummary(nil, 10, 1000)
+	require.Zero(summary.NumTxns)
+	require.Equal([]uint64{0, 0, 0, 0, 0}, summary.FeeRatePercentilesNanosPerKB)
+
+	// The percentiles are weighted by the size of the txns: the large txn paying 3000 holds most of the bytes.
+	mempoolTxns := []*MempoolTx{
+		{TxSizeBytes: 700, FeePerKB: 3000},
+		{TxSizeBytes: 100, FeePerKB: 1000},
+		{TxSizeBytes: 100, FeePerKB: 2000},
+		{TxSizeBytes: 100, FeePerKB: 9000},
+	}
+	summary = NewFeeTelemetrySummary(mempoolTxns, 10, 2500)
+	require.Equal(uint64(4), summary.NumTxns)
+	require.Equal(uint64(1000), summary.TotalSizeBytes)
+	require.Equal([]uint64{2000, 3000, 3000, 3000, 9000}, summary.FeeRatePercentilesNanosPerKB)
+
+	// The summary survives a round trip through the wire.
+	data, err := summary.ToBytes(false)
+	require.NoError(err)
+	decodedSummary := &MsgDeSoFeeTelemetry{}
+	require.NoError(decodedSummary.FromBytes(data))
+	require.Equal(summary, decodedSummary)
+
+	// A summary with decreasing percentiles is rejected.
+	summary.FeeRatePercentilesNanosPerKB[4] = 1
+	data, err = summary.ToBytes(false)
+	require.NoError(err)
+	require.Error(decodedSummary.FromBytes(data))
+}
+
+func TestFeeTelemetryAggregator(t *testing.T) {
+	require := require.New(t)
+
+	newSummary := func(tipHeight uint64, feeRate uint64) *MsgDeSoFeeTelemetry {
+		return &MsgDeSoFeeTelemetry{
+			TipHeight:                    tipHeight,
+			FeeRatePercentilesNanosPerKB: []uint64{feeRate, feeRate, feeRate, feeRate, feeRate},
+			EstimatedFeeRateNanosPerKB:   feeRate,
+		}
+	}
+	interval := time.Minute
+	now := time.Now()
+	agg := NewFeeTelemetryAggregator(interval)
+	localSummary := newSummary(100, 1000)
+
+	// With too few peers, the estimate is our own.
+	require.True(agg.AddPeerSummary(1, newSummary(100, 2000), now))
+	require.True(agg.AddPeerSummary(2, newSummary(100, 3000), now))
+	estimate := agg.GetNetworkFeeEstimate(localSummary, now)
+	require.Zero(estimate.NumPeerSummaries)
+	require.Equal(uint64(1000), estimate.EstimatedFeeRateNanosPerKB)
+
+	// A peer can't send summaries more often than the interval.
+	require.False(agg.AddPeerSummary(2, newSummary(100, 4000), now.Add(interval/4)))
+
+	// The estimate is the median, so a peer reporting a bogus fee rate doesn't move it.
+	require.True(agg.AddPeerSummary(3, newSummary(100, 1000000), now))
+	estimate = agg.GetNetworkFeeEstimate(localSummary, now)
+	require.Equal(3, estimate.NumPeerSummaries)
+	require.Equal(uint64(2000), estimate.EstimatedFeeRateNanosPerKB)
+	require.Equal(uint64(2000), estimate.FeeRatePercentilesNanosPerKB[2])
+
+	// Peers that are syncing or disconnected aren't used.
+	require.True(agg.AddPeerSummary(4, newSummary(50, 5000), now))
+	agg.RemovePeer(3)
+	estimate = agg.GetNetworkFeeEstimate(localSummary, now)
+	require.Zero(estimate.NumPeerSummaries)
+
+	// Stale summaries aren't used.
+	require.True(agg.AddPeerSummary(3, newSummary(100, 3000), now.Add(interval)))
+	require.True(agg.AddPeerSummary(5, newSummary(100, 3000), now.Add(interval)))
+	estimate = agg.GetNetworkFeeEstimate(localSummary, now.Add(feeTelemetryStaleIntervalMultiple*interval+time.Second))
+	require.Zero(estimate.NumPeerSummaries)
+
+	// A nil aggregator only uses our own summary.
+	var nilAgg *FeeTelemetryAggregator
+	require.False(nilAgg.AddPeerSummary(1, localSummary, now))
+	require.Equal(uint64(1000), nilAgg.GetNetworkFeeEstimate(localSummary, now).EstimatedFeeRateNanosPerKB)
+	require.Nil(nilAgg.GetNetworkFeeEstimate(nil, now))
+}
@@ -0,0 +1,332 @@
+package lib
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Genesis Builder
+//
+// A network is defined by its genesis block, the seed balances that are credited when the genesis block is
+// connected, and the seed txns that are connected right after them. For mainnet and testnet these are hardcoded
+// in constants.go as Go values and txn hex. The GenesisBuilder generates them from a GenesisSpec instead, so that
+// private networks and devnets can describe their starting state declaratively:
+//   - Seed balances are credited to public keys in the genesis block.
+//   - Profiles are created with UpdateProfile seed txns.
+//   - Validators are registered and stake to themselves with RegisterAsValidator and Stake seed txns. Their stake
+//     is spent from their seed balance.
+//   - Global params are set with an UpdateGlobalParams seed txn from a param updater. If they set a minimum
+//     network fee, the txn pays it from the param updater's seed balance.
+//
+// Seed txns are connected without verifying signatures, so the builder doesn't need any private keys, and the
+// output only depends on the spec. Building the same spec twice produces the same genesis block hash.
+
+// DefaultGenesisMessage is the ExtraData of the genesis block reward when the spec doesn't have one.
+const DefaultGenesisMessage = "DeSo devnet genesis"
+
+// GenesisSpec describes the starting state of a network.
+type GenesisSpec struct {
+	// TstampNanoSecs is the timestamp of the genesis block.
+	TstampNanoSecs int64
+	// Message is put in the ExtraData of the genesis block reward. It defaults to DefaultGenesisMessage.
+	Message string
+
+	SeedBalances []*GenesisSeedBalance
+	Profiles     []*GenesisProfile
+	Validators   []*GenesisValidator
+
+	// GlobalParams maps the ExtraData keys of an UpdateGlobalParams txn, e.g. MinNetworkFeeNanosPerKBKey, to their
+	// values. They're set by ParamUpdaterPublicKeyBase58Check, which must be a param updater at the genesis block.
+	GlobalParams                     map[string]uint64
+	ParamUpdaterPublicKeyBase58Check string
+}
+
+type GenesisSeedBalance struct {
+	PublicKeyBase58Check string
+	AmountNanos          uint64
+}
+
+type GenesisProfile struct {
+	PublicKeyBase58Check string
+	Username             string
+	Description          string
+	ProfilePic           string
+	CreatorBasisPoints   uint64
+}
+
+// GenesisValidator is a validator that's registered at genesis. The VotingAuthorization is the signature of
+// CreateValidatorVotingAuthorizationPayload for the validator's public key by its voting private key. If
+// StakeAmountNanos is set, the validator stakes that much to itself.
+type GenesisValidator struct {
+	PublicKeyBase58Check                string
+	Domains                             []string
+	DisableDelegatedStake               bool
+	DelegatedStakeCommissionBasisPoints uint64
+	VotingPublicKey                     *bls.PublicKey
+	VotingAuthorization                 *bls.Signature
+	StakeAmountNanos                    uint64
+}
+
+// Genesis is the output of the GenesisBuilder. Apply sets it on the params of the network.
+type Genesis struct {
+	GenesisBlock        *MsgDeSoBlock
+	GenesisBlockHashHex string
+	SeedBalances        []*DeSoOutput
+	SeedTxns            []string
+}
+
+// Apply sets the genesis block, seed balances, and seed txns of the params.
+func (genesis *Genesis) Apply(params *DeSoParams) {
+	params.GenesisBlock = genesis.GenesisBlock
+	params.GenesisBlockHashHex = genesis.GenesisBlockHashHex
+	params.SeedBalances = genesis.SeedBalances
+	params.SeedTxns = genesis.SeedTxns
+}
+
+type GenesisBuilder struct {
+	params *DeSoParams
+	spec   *GenesisSpec
+}
+
+// NewGenesisBuilder creates a GenesisBuilder for a network with the params. The params are only read, and the
+// network's fork heights decide which seed txns are allowed at genesis.
+func NewGenesisBuilder(params *DeSoParams, spec *GenesisSpec) (*GenesisBuilder, error) {
+	if params == nil {
+		return nil, fmt.Errorf("NewGenesisBuilder: Params must be set")
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("NewGenesisBuilder: Spec must be set")
+	}
+	return &GenesisBuilder{
+		params: params,
+		spec:   spec,
+	}, nil
+}
+
+// Build generates the genesis from the spec. It connects the seed balances and txns to an in-memory db before
+// returning, so a spec that the network would reject fails here rather than when a node starts.
+func (builder *GenesisBuilder) Build() (*Genesis, error) {
+	seedBalances, err := builder.buildSeedBalances()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GenesisBuilder.Build: ")
+	}
+	seedTxns, err := builder.buildSeedTxns()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GenesisBuilder.Build: ")
+	}
+
+	message := builder.spec.Message
+	if message == "" {
+		message = DefaultGenesisMessage
+	}
+	genesisBlock := &MsgDeSoBlock{
+		Header: &MsgDeSoHeader{
+			Version:        0,
+			PrevBlockHash:  &BlockHash{},
+			TstampNanoSecs: builder.spec.TstampNanoSecs,
+			Height:         uint64(0),
+			Nonce:          uint64(0),
+		},
+		Txns: []*MsgDeSoTxn{
+			{
+				TxInputs:  []*DeSoInput{},
+				TxOutputs: seedBalances,
+				TxnMeta: &BlockRewardMetadataa{
+					ExtraData: []byte(message),
+				},
+			},
+		},
+	}
+	genesisBlock.Header.TransactionMerkleRoot, _, err = ComputeMerkleRoot(genesisBlock.Txns)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GenesisBuilder.Build: Problem computing merkle root")
+	}
+	genesisBlockHash, err := genesisBlock.Header.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GenesisBuilder.Build: Problem hashing genesis block")
+	}
+
+	genesis := &Genesis{
+		GenesisBlock:        genesisBlock,
+		GenesisBlockHashHex: genesisBlockHash.String(),
+		SeedBalances:        seedBalances,
+		SeedTxns:            seedTxns,
+	}
+	if err = builder.verify(genesis); err != nil {
+		return nil, errors.Wrapf(err, "GenesisBuilder.Build: ")
+	}
+	return genesis, nil
+}
+
+func (builder *GenesisBuilder) buildSeedBalances() ([]*DeSoOutput, error) {
+	var seedBalances []*DeSoOutput
+	for ii, seedBalance := range builder.spec.SeedBalances {
+		publicKey, err := builder.decodePublicKey(seedBalance.PublicKeyBase58Check)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Seed balance %d: ", ii)
+		}
+		seedBalances = append(seedBalances, &DeSoOutput{
+			PublicKey:   publicKey,
+			AmountNanos: seedBalance.AmountNanos,
+		})
+	}
+	return seedBalances, nil
+}
+
+// buildSeedTxns creates the profiles first, then the validators, and sets the global params last, so that the
+// profiles and validators aren't subject to fees the global params introduce.
+func (builder *GenesisBuilder) buildSeedTxns() ([]string, error) {
+	var txns []*MsgDeSoTxn
+
+	for ii, profile := range builder.spec.Profiles {
+		publicKey, err := builder.decodePublicKey(profile.PublicKeyBase58Check)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Profile %d: ", ii)
+		}
+		txns = append(txns, &MsgDeSoTxn{
+			PublicKey: publicKey,
+			TxnMeta: &UpdateProfileMetadata{
+				NewUsername:                 []byte(profile.Username),
+				NewDescription:              []byte(profile.Description),
+				NewProfilePic:               []byte(profile.ProfilePic),
+				NewCreatorBasisPoints:       profile.CreatorBasisPoints,
+				NewStakeMultipleBasisPoints: 1.25 * 100 * 100,
+			},
+		})
+	}
+
+	if len(builder.spec.Validators) > 0 &&
+		builder.params.ForkHeights.ProofOfStake1StateSetupBlockHeight > 0 {
+		return nil, fmt.Errorf("Validators can only be registered at genesis if " +
+			"ProofOfStake1StateSetupBlockHeight is zero")
+	}
+	for ii, validator := range builder.spec.Validators {
+		publicKey, err := builder.decodePublicKey(validator.PublicKeyBase58Check)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Validator %d: ", ii)
+		}
+		var domains [][]byte
+		for _, domain := range validator.Domains {
+			domains = append(domains, []byte(domain))
+		}
+		txns = append(txns, &MsgDeSoTxn{
+			PublicKey: publicKey,
+			TxnMeta: &RegisterAsValidatorMetadata{
+				Domains:                             domains,
+				DisableDelegatedStake:               validator.DisableDelegatedStake,
+				DelegatedStakeCommissionBasisPoints: validator.DelegatedStakeCommissionBasisPoints,
+				VotingPublicKey:                     validator.VotingPublicKey,
+				VotingAuthorization:                 validator.VotingAuthorization,
+			},
+		})
+		if validator.StakeAmountNanos > 0 {
+			txns = append(txns, &MsgDeSoTxn{
+				PublicKey: publicKey,
+				TxnMeta: &StakeMetadata{
+					ValidatorPublicKey: NewPublicKey(publicKey),
+					RewardMethod:       StakingRewardMethodPayToBalance,
+					StakeAmountNanos:   uint256.NewInt(validator.StakeAmountNanos),
+				},
+			})
+		}
+	}
+
+	if len(builder.spec.GlobalParams) > 0 {
+		updaterPublicKey, err := builder.decodePublicKey(builder.spec.ParamUpdaterPublicKeyBase58Check)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Param updater: ")
+		}
+		extraData := make(map[string][]byte)
+		for key, value := range builder.spec.GlobalParams {
+			extraData[key] = UintToBuf(value)
+		}
+		txns = append(txns, &MsgDeSoTxn{
+			PublicKey: updaterPublicKey,
+			TxnMeta:   &UpdateGlobalParamsMetadata{},
+			ExtraData: extraData,
+		})
+	}
+
+	var seedTxns []string
+	for ii, txn := range txns {
+		// Seed txns don't have inputs, so they need a nonce to be unique under the balance model.
+		if builder.params.ForkHeights.BalanceModelBlockHeight == 0 {
+			txn.TxnVersion = DeSoTxnVersion1
+			txn.TxnNonce = &DeSoNonce{
+				ExpirationBlockHeight: 1,
+				PartialID:             uint64(ii),
+			}
+		}
+		if txn.TxnMeta.GetTxnType() == TxnTypeUpdateGlobalParams {
+			if err := builder.setGlobalParamsTxnFee(txn); err != nil {
+				return nil, errors.Wrapf(err, "Problem setting fee of seed txn %d", ii)
+			}
+		}
+		txnBytes, err := txn.ToBytes(false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Problem serializing seed txn %d", ii)
+		}
+		seedTxns = append(seedTxns, hex.EncodeToString(txnBytes))
+	}
+	return seedTxns, nil
+}
+
+// setGlobalParamsTxnFee sets the fee of the UpdateGlobalParams txn. The minimum network fee is checked after the
+// txn is connected, so if the txn sets one, it has to pay it itself, and the param updater needs a seed balance.
+func (builder *GenesisBuilder) setGlobalParamsTxnFee(txn *MsgDeSoTxn) error {
+	minFeeRateNanosPerKB := builder.spec.GlobalParams[MinNetworkFeeNanosPerKBKey]
+	if minFeeRateNanosPerKB == 0 {
+		return nil
+	}
+	if builder.params.ForkHeights.BalanceModelBlockHeight > 0 {
+		return fmt.Errorf("The minimum network fee can only be set at genesis if BalanceModelBlockHeight is zero")
+	}
+	// The fee changes the size of the txn, so we recompute it until it covers the size it ends up with.
+	for {
+		txnBytes, err := txn.ToBytes(false)
+		if err != nil {
+			return err
+		}
+		feeNanos := (uint64(len(txnBytes))*minFeeRateNanosPerKB + 999) / 1000
+		if feeNanos <= txn.TxnFeeNanos {
+			return nil
+		}
+		txn.TxnFeeNanos = feeNanos
+	}
+}
+
+// verify initializes an in-memory db with the genesis to check that all of the seed txns connect.
+func (builder *GenesisBuilder) verify(genesis *Genesis) error {
+	opts := DefaultBadgerOptions("").WithInMemory(true)
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	if err != nil {
+		return errors.Wrapf(err, "Problem opening db to verify genesis")
+	}
+	defer db.Close()
+
+	params := *builder.params
+	genesis.Apply(&params)
+	if err = InitDbWithDeSoGenesisBlock(&params, db, nil, nil, nil); err != nil {
+		return errors.Wrapf(err, "Problem connecting genesis")
+	}
+	return nil
+}
+
+func (builder *GenesisBuilder) decodePublicKey(publicKeyBase58Check string) ([]byte, error) {
+	publicKey, _, err := Base58CheckDecode(publicKeyBase58Check)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem decoding public key %v", publicKeyBase58Check)
+	}
+	if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("Public key %v has length %d, expected %d", publicKeyBase58Check,
+			len(publicKey), btcec.PubKeyBytesLenCompressed)
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenesisBuilder(t *testing.T) {
+	require := require.New(t)
+	setupTestDeSoEncoder(t)
+
+	// Start a network with the balance model and PoS txns enabled at genesis.
+	params := DeSoTestnetParams
+	params.EnableRegtest(false)
+	params.ForkHeights.BalanceModelBlockHeight = 0
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = 0
+	params.EncoderMigrationHeights = GetEncoderMigrationHeights(&params.ForkHeights)
+	params.EncoderMigrationHeightsList = GetEncoderMigrationHeightsList(&params.ForkHeights)
+
+	paramUpdaterPkString := "tBCKVERmG9nZpHTk2AVPqknWc1Mw9HHAnqrTpW1RnXpXMQ4PsQgnmV"
+	votingPublicKey, votingAuthorization := _generateVotingPublicKeyAndAuthorization(t, m0PkBytes)
+	spec := &GenesisSpec{
+		TstampNanoSecs: SecondsToNanoSeconds(1700000000),
+		SeedBalances: []*GenesisSeedBalance{
+			{PublicKeyBase58Check: m0Pub, AmountNanos: 1e12},
+			{PublicKeyBase58Check: m1Pub, AmountNanos: 5e11},
+			{PublicKeyBase58Check: paramUpdaterPkString, AmountNanos: 1e6},
+		},
+		Profiles: []*GenesisProfile{
+			{PublicKeyBase58Check: m1Pub, Username: "devnet", Description: "A devnet profile", CreatorBasisPoints: 1000},
+		},
+		Validators: []*GenesisValidator{
+			{
+				PublicKeyBase58Check: m0Pub,
+				Domains:              []string{"m0.deso.dev:18000"},
+				VotingPublicKey:      votingPublicKey,
+				VotingAuthorization:  votingAuthorization,
+				StakeAmountNanos:     1e11,
+			},
+		},
+		GlobalParams: map[string]uint64{
+			MinNetworkFeeNanosPerKBKey: 1000,
+			CreateProfileFeeNanosKey:   10,
+		},
+		ParamUpdaterPublicKeyBase58Check: paramUpdaterPkString,
+	}
+	builder, err := NewGenesisBuilder(&params, spec)
+	require.NoError(err)
+	genesis, err := builder.Build()
+	require.NoError(err)
+	require.Len(genesis.SeedBalances, 3)
+	require.Len(genesis.SeedTxns, 4)
+
+	// Building the same spec again produces the same genesis.
+	otherGenesis, err := builder.Build()
+	require.NoError(err)
+	require.Equal(genesis.GenesisBlockHashHex, otherGenesis.GenesisBlockHashHex)
+	require.Equal(genesis.SeedTxns, otherGenesis.SeedTxns)
+
+	// Start a chain from the genesis and check its state.
+	genesis.Apply(&params)
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	chain, err := NewBlockchain(nil, 0, 0, &params, blockchain.NewMedianTime(), db, nil, nil, nil, false, nil)
+	require.NoError(err)
+	require.Equal(genesis.GenesisBlockHashHex, chain.BlockTip().Hash.String())
+
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	m0Balance, err := utxoView.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(1e12-1e11), m0Balance)
+
+	profileEntry := utxoView.GetProfileEntryForUsername([]byte("devnet"))
+	require.NotNil(profileEntry)
+	require.Equal(m1PkBytes, profileEntry.PublicKey)
+	require.Equal(uint64(1000), profileEntry.CreatorCoinEntry.CreatorBasisPoints)
+
+	validatorEntry, err := utxoView.GetValidatorByPublicKey(NewPublicKey(m0PkBytes))
+	require.NoError(err)
+	require.NotNil(validatorEntry)
+	require.Equal(uint64(1e11), validatorEntry.TotalStakeAmountNanos.Uint64())
+	require.True(validatorEntry.VotingPublicKey.Eq(votingPublicKey))
+
+	globalParams := utxoView.GetCurrentGlobalParamsEntry()
+	require.Equal(uint64(1000), globalParams.MinimumNetworkFeeNanosPerKB)
+	require.Equal(uint64(10), globalParams.CreateProfileFeeNanos)
+
+	// A spec that the network would reject fails to build.
+	_, err = NewGenesisBuilder(&params, nil)
+	require.Error(err)
+	badSpecs := []*GenesisSpec{
+		{SeedBalances: []*GenesisSeedBalance{{PublicKeyBase58Check: "not-a-public-key", AmountNanos: 1}}},
+		{Profiles: []*GenesisProfile{{PublicKeyBase58Check: m1Pub, Username: "not a username"}}},
+		{Validators: []*GenesisValidator{{PublicKeyBase58Check: m0Pub, Domains: []string{"m0.deso.dev:18000"},
+			VotingPublicKey: votingPublicKey, VotingAuthorization: votingAuthorization, StakeAmountNanos: 1}}},
+		{GlobalParams: map[string]uint64{MinNetworkFeeNanosPerKBKey: 1000}, ParamUpdaterPublicKeyBase58Check: m0Pub},
+	}
+	for _, badSpec := range badSpecs {
+		builder, err = NewGenesisBuilder(&params, badSpec)
+		require.NoError(err)
+		_, err = builder.Build()
+		require.Error(err)
+	}
+
+	// Validators can't be registered before the PoS txns are enabled.
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = 1
+	builder, err = NewGenesisBuilder(&params, spec)
+	require.NoError(err)
+	_, err = builder.Build()
+	require.Error(err)
+	require.Contains(err.Error(), "ProofOfStake1StateSetupBlockHeight")
+}
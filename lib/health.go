@@ -0,0 +1,258 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Health
+//
+// The Server reports its health as a NodeHealth, which describes how far along the node is in syncing and
+// whether it's ready to serve traffic. A node is ready once its chain is fully current and, unless networking is
+// disabled, it's connected to at least one peer. Embedding applications can call Server.GetHealth directly, and
+// the HealthServer serves the same status over HTTP for load balancers and orchestrators.
+//
+// Endpoints:
+//   - GET /health: returns the NodeHealth with a 200, as long as the node is up. Meant for liveness probes.
+//   - GET /health/ready: returns the NodeHealth with a 200 if the node is ready and a 503 if it isn't. Meant for
+//     readiness probes.
+//
+// These endpoints are read-only and don't require authentication, so unlike the admin RPC the HealthServer can
+// listen on any address.
+
+const (
+	HealthRoutePathHealth = "/health"
+	HealthRoutePathReady  = "/health/ready"
+
+	healthReadHeaderTimeout = 10 * time.Second
+)
+
+// NodeHealth is a snapshot of the node's sync progress and readiness.
+type NodeHealth struct {
+	// Ready is true if the node is ready to serve traffic. If it isn't, NotReadyReasons explains why.
+	Ready           bool
+	NotReadyReasons []string
+
+	// ChainState is the SyncState of the chain, e.g. FULLY_CURRENT.
+	ChainState          string
+	HeaderTipHeight     uint64
+	BlockTipHeight      uint64
+	BlocksBehindHeaders uint64
+
+	// HypersyncProgressPercent is how much of the snapshot we've downloaded, from 0 to 100. It's only set while
+	// the node is hypersyncing.
+	HypersyncInProgress      bool
+	HypersyncProgressPercent float64
+
+	MempoolNumTxns uint64
+	NumPeers       uint64
+
+	// LastBlockTimestampNanoSecs is the timestamp of the block tip, and LastBlockAgeSeconds is how long ago it was.
+	LastBlockTimestampNanoSecs int64
+	LastBlockAgeSeconds        float64
+}
+
+// HealthProvider is implemented by the Server. The HealthServer only depends on this interface so that it can
+// serve the health of anything that reports it.
+type HealthProvider interface {
+	GetHealth() *NodeHealth
+}
+
+// GetHealth returns the current health of the node.
+func (srv *Server) GetHealth() *NodeHealth {
+	health := &NodeHealth{}
+
+	srv.blockchain.ChainLock.RLock()
+	syncState := srv.blockchain.chainState()
+	headerTip := srv.blockchain.headerTip()
+	blockTip := srv.blockchain.blockTip()
+	srv.blockchain.ChainLock.RUnlock()
+
+	health.ChainState = syncState.String()
+	if headerTip != nil {
+		health.HeaderTipHeight = uint64(headerTip.Height)
+	}
+	if blockTip != nil {
+		health.BlockTipHeight = uint64(blockTip.Height)
+	}
+	if blockTip != nil && blockTip.Header != nil {
+		health.LastBlockTimestampNanoSecs = blockTip.Header.TstampNanoSecs
+		health.LastBlockAgeSeconds = time.Since(time.Unix(0, blockTip.Header.TstampNanoSecs)).Seconds()
+	}
+	if health.HeaderTipHeight > health.BlockTipHeight {
+		health.BlocksBehindHeaders = health.HeaderTipHeight - health.BlockTipHeight
+	}
+
+	if syncState == SyncStateSyncingSnapshot {
+		health.HypersyncInProgress = true
+		health.HypersyncProgressPercent = srv.HyperSyncProgress.getProgressPercent()
+	}
+
+	// Report the size of the mempool that's in use at the current block height.
+	if srv.params.IsPoSBlockHeight(health.BlockTipHeight) {
+		if srv.posMempool != nil && srv.posMempool.IsRunning() {
+			health.MempoolNumTxns = srv.posMempool.txnRegister.Count()
+		}
+	} else if srv.mempool != nil {
+		health.MempoolNumTxns = uint64(srv.mempool.Count())
+	}
+
+	if srv.networkManager != nil {
+		for _, remoteNode := range srv.networkManager.GetAllRemoteNodes().GetAll() {
+			if remoteNode.IsHandshakeCompleted() {
+				health.NumPeers++
+			}
+		}
+	}
+
+	health.setReadiness(!srv.DisableNetworking)
+	return health
+}
+
+// setReadiness sets Ready and NotReadyReasons from the rest of the health. Peers are only required if
+// requirePeers is true.
+func (health *NodeHealth) setReadiness(requirePeers bool) {
+	health.NotReadyReasons = []string{}
+	if health.ChainState != SyncStateFullyCurrent.String() {
+		health.NotReadyReasons = append(health.NotReadyReasons,
+			fmt.Sprintf("chain state is %v", health.ChainState))
+	}
+	if requirePeers && health.NumPeers == 0 {
+		health.NotReadyReasons = append(health.NotReadyReasons, "not connected to any peers")
+	}
+	health.Ready = len(health.NotReadyReasons) == 0
+}
+
+// getProgressPercent returns how much of the snapshot we've downloaded, from 0 to 100. In the v2 format this is
+// the fraction of chunks received, and otherwise it's the fraction of state prefixes that are complete.
+func (progress *SyncProgress) getProgressPercent() float64 {
+	if progress.UseFormatV2 {
+		if progress.StateRoot == nil || progress.StateRoot.NumChunks == 0 {
+			return 0
+		}
+		return 100 * float64(progress.NumChunksReceived) / float64(progress.StateRoot.NumChunks)
+	}
+	if len(StatePrefixes.StatePrefixesList) == 0 {
+		return 0
+	}
+	numCompletedPrefixes := 0
+	for _, prefixProgress := range progress.PrefixProgress {
+		if !prefixProgress.Completed {
+			continue
+		}
+		for _, prefix := range StatePrefixes.StatePrefixesList {
+			if reflect.DeepEqual(prefix, prefixProgress.Prefix) {
+				numCompletedPrefixes++
+				break
+			}
+		}
+	}
+	return 100 * float64(numCompletedPrefixes) / float64(len(StatePrefixes.StatePrefixesList))
+}
+
+type HealthServer struct {
+	listenAddr     string
+	healthProvider HealthProvider
+
+	listener   net.Listener
+	httpServer *http.Server
+	waitGroup  sync.WaitGroup
+}
+
+// NewHealthServer creates a HealthServer that serves the health of the provider on the listen address, e.g.
+// 0.0.0.0:17011.
+func NewHealthServer(listenAddr string, healthProvider HealthProvider) (*HealthServer, error) {
+	if _, _, err := net.SplitHostPort(listenAddr); err != nil {
+		return nil, errors.Wrapf(err, "NewHealthServer: Listen address %v must be in the form host:port", listenAddr)
+	}
+	if isInterfaceValueNil(healthProvider) {
+		return nil, fmt.Errorf("NewHealthServer: HealthProvider must be set")
+	}
+	return &HealthServer{
+		listenAddr:     listenAddr,
+		healthProvider: healthProvider,
+	}, nil
+}
+
+// Start begins serving requests in the background.
+func (hs *HealthServer) Start() error {
+	var err error
+	hs.listener, err = net.Listen("tcp", hs.listenAddr)
+	if err != nil {
+		return errors.Wrapf(err, "HealthServer.Start: Problem listening on %v", hs.listenAddr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(HealthRoutePathHealth, hs.getHealth)
+	mux.HandleFunc(HealthRoutePathReady, hs.getReady)
+	hs.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: healthReadHeaderTimeout,
+	}
+
+	hs.waitGroup.Add(1)
+	go func() {
+		defer hs.waitGroup.Done()
+		if err := hs.httpServer.Serve(hs.listener); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("HealthServer: Problem serving requests: %v", err)
+		}
+	}()
+	glog.Infof("HealthServer.Start: Listening on %v", hs.listener.Addr())
+	return nil
+}
+
+// Stop closes the listener and waits for the server to exit.
+func (hs *HealthServer) Stop() {
+	if hs.httpServer == nil {
+		return
+	}
+	if err := hs.httpServer.Close(); err != nil {
+		glog.Errorf("HealthServer.Stop: Problem closing server: %v", err)
+	}
+	hs.waitGroup.Wait()
+}
+
+// Addr returns the address the server is listening on. It is only set once the server has started.
+func (hs *HealthServer) Addr() net.Addr {
+	if hs.listener == nil {
+		return nil
+	}
+	return hs.listener.Addr()
+}
+
+func (hs *HealthServer) getHealth(ww http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		ww.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	hs.writeJSON(ww, http.StatusOK, hs.healthProvider.GetHealth())
+}
+
+func (hs *HealthServer) getReady(ww http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		ww.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	health := hs.healthProvider.GetHealth()
+	statusCode := http.StatusOK
+	if !health.Ready {
+		statusCode = http.StatusServiceUnavailable
+	}
+	hs.writeJSON(ww, statusCode, health)
+}
+
+func (hs *HealthServer) writeJSON(ww http.ResponseWriter, statusCode int, res interface{}) {
+	ww.Header().Set("Content-Type", "application/json")
+	ww.WriteHeader(statusCode)
+	if err := json.NewEncoder(ww).Encode(res); err != nil {
+		glog.Errorf("HealthServer: Problem encoding response: %v", err)
+	}
+}
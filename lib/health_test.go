@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testHealthProvider struct {
+	health *NodeHealth
+}
+
+func (provider *testHealthProvider) GetHealth() *NodeHealth {
+	return provider.health
+}
+
+func TestNodeHealthReadiness(t *testing.T) {
+	require := require.New(t)
+
+	health := &NodeHealth{ChainState: SyncStateSyncingBlocks.String()}
+	health.setReadiness(true)
+	require.False(health.Ready)
+	require.Equal([]string{"chain state is SYNCING_BLOCKS", "not connected to any peers"}, health.NotReadyReasons)
+
+	// Peers aren't required when networking is disabled.
+	health = &NodeHealth{ChainState: SyncStateFullyCurrent.String()}
+	health.setReadiness(false)
+	require.True(health.Ready)
+	require.Empty(health.NotReadyReasons)
+
+	health = &NodeHealth{ChainState: SyncStateFullyCurrent.String(), NumPeers: 1}
+	health.setReadiness(true)
+	require.True(health.Ready)
+}
+
+func TestSyncProgressPercent(t *testing.T) {
+	require := require.New(t)
+
+	// In the v2 format, progress is the fraction of chunks received.
+	progress := &SyncProgress{UseFormatV2: true}
+	require.Equal(float64(0), progress.getProgressPercent())
+	progress.StateRoot = &SnapshotStateRoot{NumChunks: 8}
+	progress.NumChunksReceived = 2
+	require.Equal(float64(25), progress.getProgressPercent())
+
+	// Otherwise, progress is the fraction of state prefixes that are complete.
+	progress = &SyncProgress{}
+	for ii, prefix := range StatePrefixes.StatePrefixesList {
+		progress.PrefixProgress = append(progress.PrefixProgress, &SyncPrefixProgress{
+			Prefix:    prefix,
+			Completed: ii%2 == 0,
+		})
+	}
+	numPrefixes := len(StatePrefixes.StatePrefixesList)
+	require.Equal(100*float64((numPrefixes+1)/2)/float64(numPrefixes), progress.getProgressPercent())
+}
+
+func TestHealthServer(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewHealthServer("no-port", &testHealthProvider{})
+	require.Error(err)
+	_, err = NewHealthServer("127.0.0.1:0", nil)
+	require.Error(err)
+
+	provider := &testHealthProvider{health: &NodeHealth{
+		Ready:           false,
+		NotReadyReasons: []string{"chain state is SYNCING_HEADERS"},
+		ChainState:      SyncStateSyncingHeaders.String(),
+		HeaderTipHeight: 10,
+	}}
+	healthServer, err := NewHealthServer("127.0.0.1:0", provider)
+	require.NoError(err)
+	require.NoError(healthServer.Start())
+	defer healthServer.Stop()
+	baseURL := "http://" + healthServer.Addr().String()
+
+	getHealth := func(path string) (int, *NodeHealth) {
+		res, err := http.Get(baseURL + path)
+		require.NoError(err)
+		defer res.Body.Close()
+		health := &NodeHealth{}
+		require.NoError(json.NewDecoder(res.Body).Decode(health))
+		return res.StatusCode, health
+	}
+
+	// The health endpoint always responds with a 200, and the ready endpoint only does once the node is ready.
+	statusCode, health := getHealth(HealthRoutePathHealth)
+	require.Equal(http.StatusOK, statusCode)
+	require.Equal(provider.health, health)
+	statusCode, health = getHealth(HealthRoutePathReady)
+	require.Equal(http.StatusServiceUnavailable, statusCode)
+	require.Equal(provider.health, health)
+
+	provider.health = &NodeHealth{Ready: true, NotReadyReasons: []string{}, ChainState: SyncStateFullyCurrent.String()}
+	statusCode, health = getHealth(HealthRoutePathReady)
+	require.Equal(http.StatusOK, statusCode)
+	require.True(health.Ready)
+
+	// Only GET requests are allowed.
+	res, err := http.Post(baseURL+HealthRoutePathHealth, "application/json", nil)
+	require.NoError(err)
+	res.Body.Close()
+	require.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestServerGetHealth(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+
+	srv := &Server{
+		blockchain:        chain,
+		params:            params,
+		mempool:           mempool,
+		DisableNetworking: true,
+		logger:            NewLogger(nil, LogComponentServer),
+	}
+	health := srv.GetHealth()
+	require.Equal(chain.ChainState().String(), health.ChainState)
+	require.Equal(uint64(chain.BlockTip().Height), health.BlockTipHeight)
+	require.Equal(uint64(chain.HeaderTip().Height), health.HeaderTipHeight)
+	require.Equal(chain.BlockTip().Header.TstampNanoSecs, health.LastBlockTimestampNanoSecs)
+	require.Equal(health.ChainState == SyncStateFullyCurrent.String(), health.Ready)
+}
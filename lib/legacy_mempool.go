@@ -118,6 +118,9 @@ type DeSoMempool struct {
 	// Stops the mempool's services.
 	quit    chan struct{}
 	stopped bool
+	// dumperWaitGroup lets Stop wait for a periodic mempool dump that's in progress, so that
+	// it doesn't race with the final dump.
+	dumperWaitGroup deadlock.WaitGroup
 
 	// A reference to a blockchain object that can be used to validate transactions before
 	// adding them to the pool.
@@ -209,6 +212,13 @@ type DeSoMempool struct {
 	// This field isn't reset with ResetPool. It requires an explicit call to
 	// UpdateReadOnlyView.
 	readOnlyUtxoViewSequenceNumber int64
+	// When the readOnlyUtxoView was last updated, and the height of the block tip
+	// at the time. They're reported with the view by GetAugmentedView.
+	//
+	// These fields aren't reset with ResetPool. They require an explicit call to
+	// UpdateReadOnlyView.
+	readOnlyUtxoViewGeneratedAt time.Time
+	readOnlyUtxoViewBlockHeight uint64
 	// The total number of times we've called processTransaction. Used to
 	// determine whether we should update the readOnlyUtxoView.
 	//
@@ -357,6 +367,8 @@ func (mp *DeSoMempool) resetPool(newPool *DeSoMempool) {
 	// - runReadOnlyUtxoView bool
 	// - readOnlyUtxoView *UtxoView
 	// - readOnlyUtxoViewSequenceNumber int64
+	// - readOnlyUtxoViewGeneratedAt time.Time
+	// - readOnlyUtxoViewBlockHeight uint64
 	// - totalProcessTransactionCalls int64
 	// - readOnlyUniversalTransactionList    []*MempoolTx
 	// - readOnlyUniversalTransactionMap map[BlockHash]*MempoolTx
@@ -954,6 +966,62 @@ func (mp *DeSoMempool) GetAugmentedUniversalView() (*UtxoView, error) {
 	return newView, nil
 }
 
+// GetAugmentedView returns a copy of the read-only view that meets the requirements
+// of opts, or a view filtered to the transactions of opts.PublicKey. The generation
+// of the view is the readOnlyUtxoViewSequenceNumber. A nil opts accepts any view.
+func (mp *DeSoMempool) GetAugmentedView(opts *AugmentedViewOptions) (*AugmentedView, error) {
+	if opts == nil {
+		opts = &AugmentedViewOptions{}
+	}
+	state, err := waitForAugmentedView(mp.getAugmentedViewState, opts, 100*time.Millisecond)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DeSoMempool.GetAugmentedView: ")
+	}
+
+	if len(opts.PublicKey) == 0 {
+		return &AugmentedView{
+			View:        state.view.CopyUtxoView(),
+			Generation:  state.generation,
+			BlockHeight: state.blockHeight,
+			GeneratedAt: state.generatedAt,
+		}, nil
+	}
+
+	// Build the filtered view from the block tip and the read-only transaction list,
+	// which is ordered by time added.
+	blockView := NewUtxoView(mp.bc.db, mp.bc.params, mp.bc.postgres, mp.bc.snapshot, mp.bc.eventManager)
+	maxTxnConnects := uint64(LegacyMempoolAugmentedViewMaxTxnConnects)
+	if opts.MaxTxnConnects != 0 && opts.MaxTxnConnects < maxTxnConnects {
+		maxTxnConnects = opts.MaxTxnConnects
+	}
+	augmentedView, err := buildFilteredAugmentedView(
+		blockView, uint64(mp.bc.blockTip().Height), mp.readOnlyUniversalTransactionList, opts.PublicKey,
+		maxTxnConnects)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DeSoMempool.GetAugmentedView: ")
+	}
+	augmentedView.Generation = state.generation
+	return augmentedView, nil
+}
+
+// GetAugmentedViewGeneration returns the generation of the read-only view.
+func (mp *DeSoMempool) GetAugmentedViewGeneration() uint64 {
+	return uint64(atomic.LoadInt64(&mp.readOnlyUtxoViewSequenceNumber))
+}
+
+func (mp *DeSoMempool) getAugmentedViewState() (*augmentedViewState, error) {
+	if mp.stopped {
+		return nil, errors.Wrapf(MempoolErrorNotRunning, "Mempool is closed")
+	}
+	return &augmentedViewState{
+		view:              mp.readOnlyUtxoView,
+		generation:        uint64(atomic.LoadInt64(&mp.readOnlyUtxoViewSequenceNumber)),
+		blockHeight:       mp.readOnlyUtxoViewBlockHeight,
+		generatedAt:       mp.readOnlyUtxoViewGeneratedAt,
+		latestBlockHeight: mp.GetMempoolTipBlockHeight(),
+	}, nil
+}
+
 func (mp *DeSoMempool) FetchTransaction(txHash *BlockHash) *MempoolTx {
 	if mempoolTx, exists := mp.readOnlyUniversalTransactionMap[*txHash]; exists {
 		return mempoolTx
@@ -1202,6 +1270,28 @@ func ComputeTransactionMetadata(
 	blockHeight uint64,
 ) *TransactionMetadata {
 
+	txnMeta := _computeTransactionMetadata(txn, utxoView, blockHash, totalNanosPurchasedBefore,
+		usdCentsPerBitcoinBefore, totalInput, totalOutput, fees, txnIndexInBlock, utxoOps, blockHeight)
+
+	// Add the metadata derived by the extractors registered by the embedder on top of the built-in metadata.
+	txnMeta.ExtractedTxindexMetadata = ExtractTxindexMetadata(txn, txnMeta, utxoView, utxoOps, blockHeight)
+	return txnMeta
+}
+
+func _computeTransactionMetadata(
+	txn *MsgDeSoTxn,
+	utxoView *UtxoView,
+	blockHash *BlockHash,
+	totalNanosPurchasedBefore uint64,
+	usdCentsPerBitcoinBefore uint64,
+	totalInput uint64,
+	totalOutput uint64,
+	fees uint64,
+	txnIndexInBlock uint64,
+	utxoOps []*UtxoOperation,
+	blockHeight uint64,
+) *TransactionMetadata {
+
 	var err error
 	txnMeta := &TransactionMetadata{
 		TxnIndexInBlock: txnIndexInBlock,
@@ -1371,7 +1461,16 @@ func ComputeTransactionMetadata(
 				hex.EncodeToString(txn.Hash()[:])
 		}
 
-		// PosterPublicKeyBase58Check = TransactorPublicKeyBase58Check
+		// PosterPublicKeyBase58Check = TransactorPublicKeyBase58Check, unless the
+		// transactor posted on behalf of the owner in DelegatedPostOwnerPublicKeyKey.
+		// DelegatedPostOwnerPublicKeyBase58Check is in AffectedPublicKeys
+		if ownerPublicKey, exists := txn.ExtraData[DelegatedPostOwnerPublicKeyKey]; exists &&
+			len(ownerPublicKey) == btcec.PubKeyBytesLenCompressed {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(ownerPublicKey, utxoView.Params),
+				Metadata:             "DelegatedPostOwnerPublicKeyBase58Check",
+			})
+		}
 
 		// If ParentPostHashHex is set then get the parent posts public key and
 		// mark it as affected. We only check this if PostHashToModify is not set
@@ -1752,6 +1851,46 @@ func ComputeTransactionMetadata(
 			NFTPostHashHex: hex.EncodeToString(realTxMeta.NFTPostHash[:]),
 			SerialNumber:   realTxMeta.SerialNumber,
 		}
+	case TxnTypeNFTBatch:
+		realTxMeta := txn.TxnMeta.(*NFTBatchMetadata)
+
+		if realTxMeta.OperationType == NFTBatchOperationTypeTransfer {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(realTxMeta.ReceiverPublicKey, utxoView.Params),
+				Metadata:             "NFTTransferRecipientPublicKeyBase58Check",
+			})
+		}
+	case TxnTypeDelegatedPoster:
+		realTxMeta := txn.TxnMeta.(*DelegatedPosterMetadata)
+
+		// The owner and the delegate are both in AffectedPublicKeys. One of them is the transactor.
+		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(realTxMeta.OwnerPublicKey, utxoView.Params),
+			Metadata:             "DelegatedPostOwnerPublicKeyBase58Check",
+		}, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(realTxMeta.DelegatePublicKey, utxoView.Params),
+			Metadata:             "DelegatePublicKeyBase58Check",
+		})
+	case TxnTypeSubscription:
+		realTxMeta := txn.TxnMeta.(*SubscriptionMetadata)
+
+		// The subscriber and the recipient are both in AffectedPublicKeys. One of them is the transactor.
+		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(realTxMeta.SubscriberPublicKey, utxoView.Params),
+			Metadata:             "SubscriberPublicKeyBase58Check",
+		}, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(realTxMeta.RecipientPublicKey, utxoView.Params),
+			Metadata:             "SubscriptionRecipientPublicKeyBase58Check",
+		})
+	case TxnTypeBridgeEventAnchor:
+		realTxMeta := txn.TxnMeta.(*BridgeEventAnchorMetadata)
+
+		for _, attestation := range realTxMeta.Attestations {
+			txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+				PublicKeyBase58Check: PkToString(attestation.OperatorPublicKey, utxoView.Params),
+				Metadata:             "BridgeOperatorPublicKeyBase58Check",
+			})
+		}
 	case TxnTypeBasicTransfer:
 		diamondLevelBytes, hasDiamondLevel := txn.ExtraData[DiamondLevelKey]
 		diamondPostHash, hasDiamondPostHash := txn.ExtraData[DiamondPostHashKey]
@@ -2033,6 +2172,11 @@ func ComputeTransactionMetadata(
 		txindexMetadata, affectedPublicKeys := utxoView.CreateUnjailValidatorTxindexMetadata(utxoOps[len(utxoOps)-1], txn)
 		txnMeta.UnjailValidatorTxindexMetadata = txindexMetadata
 		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, affectedPublicKeys...)
+	case TxnTypeRotateValidatorVotingKey:
+		txnMeta.AffectedPublicKeys = append(txnMeta.AffectedPublicKeys, &AffectedPublicKey{
+			PublicKeyBase58Check: PkToString(txn.PublicKey, utxoView.Params),
+			Metadata:             "RotatedValidatorPublicKeyBase58Check",
+		})
 	case TxnTypeCoinLockup:
 		realTxMeta := txn.TxnMeta.(*CoinLockupMetadata)
 		profilePublicKey := realTxMeta.ProfilePublicKey.ToBytes()
@@ -2454,7 +2598,17 @@ func (mp *DeSoMempool) processTransaction(
 // ProcessTransaction is the main function called by outside services to potentially
 // add a transaction to the mempool. It will try to add the txn to the main pool, and
 // then try to add it as an unconnected txn if that fails.
-func (mp *DeSoMempool) ProcessTransaction(tx *MsgDeSoTxn, allowUnconnectedTxn bool, rateLimit bool, peerID uint64, verifySignatures bool) ([]*MempoolTx, error) {
+func (mp *DeSoMempool) ProcessTransaction(tx *MsgDeSoTxn, allowUnconnectedTxn bool, rateLimit bool, peerID uint64, verifySignatures bool) (
+	_mempoolTxs []*MempoolTx, _err error) {
+
+	span := StartTraceSpan("DeSoMempool.ProcessTransaction", nil)
+	defer func() {
+		if span.IsRecording() {
+			span.SetAttributes(txnTraceAttributes(tx, tx.Hash())...)
+		}
+		EndTraceSpan(span, _err)
+	}()
+
 	// Protect concurrent access.
 	mp.mtx.Lock()
 	defer mp.mtx.Unlock()
@@ -2667,6 +2821,8 @@ func (mp *DeSoMempool) regenerateReadOnlyView() error {
 
 	mp.readOnlyUniversalTransactionList = newTxnList
 	mp.readOnlyUniversalTransactionMap = txMap
+	mp.readOnlyUtxoViewGeneratedAt = time.Now()
+	mp.readOnlyUtxoViewBlockHeight = uint64(mp.bc.blockTip().Height)
 
 	atomic.AddInt64(&mp.readOnlyUtxoViewSequenceNumber, 1)
 	return nil
@@ -2701,7 +2857,9 @@ func (mp *DeSoMempool) WaitForTxnValidation(_ *BlockHash) error {
 func (mp *DeSoMempool) StartMempoolDBDumper() {
 	// If we were instructed to dump txns to the db, then do so periodically
 	// Note this acquired a very minimal lock on the universalTransactionList
+	mp.dumperWaitGroup.Add(1)
 	go func() {
+		defer mp.dumperWaitGroup.Done()
 	out:
 		for {
 			select {
@@ -2771,9 +2929,11 @@ func (mp *DeSoMempool) LoadTxnsFromDB() {
 	glog.V(1).Infof("LoadTxnsFromDB: Loaded %v txns in %v seconds", len(dbMempoolTxnsOrderedByTime), endTime.Sub(startTime).Seconds())
 }
 
+// Stop stops the mempool's services and waits for any mempool dump that's in progress to finish.
 func (mp *DeSoMempool) Stop() {
 	close(mp.quit)
 	mp.stopped = true
+	mp.dumperWaitGroup.Wait()
 }
 
 // Create a new pool with no transactions in it.
@@ -0,0 +1,288 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// This file contains read-only query methods on the DeSoMempool that are useful for
+// introspecting the pool from the REST or gRPC layer. Unlike the readOnly views, these
+// methods take the mempool's read lock and look at the live pool, which means the
+// results always reflect the current state of the pool at the time of the call.
+
+// MempoolTxnStatus describes how far a transaction has made it through validation.
+type MempoolTxnStatus uint8
+
+const (
+	// MempoolTxnStatusValidated means the txn connected to the mempool's view and is
+	// eligible for inclusion in a block.
+	MempoolTxnStatusValidated MempoolTxnStatus = 0
+	// MempoolTxnStatusUnconnected means the txn is being held because it spends inputs
+	// that are not yet known to the mempool.
+	MempoolTxnStatusUnconnected MempoolTxnStatus = 1
+)
+
+func (status MempoolTxnStatus) String() string {
+	switch status {
+	case MempoolTxnStatusValidated:
+		return "VALIDATED"
+	case MempoolTxnStatusUnconnected:
+		return "UNCONNECTED"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", uint8(status))
+	}
+}
+
+// MempoolTxnFilter restricts the txns returned by ListTransactions. Zero values mean
+// "no restriction" for every field.
+type MempoolTxnFilter struct {
+	// If set, only txns whose transactor is this public key are returned.
+	PublicKey []byte
+	// If set, only txns of one of these types are returned.
+	TxnTypes []TxnType
+	// Bounds on the fee rate of the txn, inclusive. A MaxFeeRateNanosPerKB of zero
+	// means the fee rate is unbounded from above.
+	MinFeeRateNanosPerKB uint64
+	MaxFeeRateNanosPerKB uint64
+	// If true, txns that are waiting on missing inputs are returned as well.
+	IncludeUnconnected bool
+	// The maximum number of txns to return. Zero means no limit.
+	Limit int
+}
+
+// MempoolTxnSummary is a snapshot of a single txn in the mempool.
+type MempoolTxnSummary struct {
+	Hash              *BlockHash
+	TxnType           TxnType
+	PublicKey         []byte
+	FeeNanos          uint64
+	FeeRateNanosPerKB uint64
+	SizeBytes         uint64
+	Added             time.Time
+	TimeInPool        time.Duration
+	// The block height the txn was validated at. Zero for unconnected txns.
+	Height uint32
+	Status MempoolTxnStatus
+}
+
+// MempoolTxnDetail is the full view of a single txn in the mempool, including the
+// other pool txns it depends on and the pool txns that depend on it.
+type MempoolTxnDetail struct {
+	*MempoolTxnSummary
+	Txn *MsgDeSoTxn
+	// Pool txns that must be mined before this one. These are the txns whose outputs
+	// this txn spends, plus any earlier txns from the same transactor.
+	DependsOn []*BlockHash
+	// Pool txns that can't be mined until this one is.
+	Dependents []*BlockHash
+}
+
+func (filter *MempoolTxnFilter) matches(summary *MempoolTxnSummary) bool {
+	if filter == nil {
+		return true
+	}
+	if len(filter.PublicKey) != 0 && !bytes.Equal(filter.PublicKey, summary.PublicKey) {
+		return false
+	}
+	if len(filter.TxnTypes) != 0 {
+		typeMatches := false
+		for _, txnType := range filter.TxnTypes {
+			if txnType == summary.TxnType {
+				typeMatches = true
+				break
+			}
+		}
+		if !typeMatches {
+			return false
+		}
+	}
+	if summary.FeeRateNanosPerKB < filter.MinFeeRateNanosPerKB {
+		return false
+	}
+	if filter.MaxFeeRateNanosPerKB != 0 && summary.FeeRateNanosPerKB > filter.MaxFeeRateNanosPerKB {
+		return false
+	}
+	return true
+}
+
+func _mempoolTxToSummary(mempoolTx *MempoolTx, now time.Time) *MempoolTxnSummary {
+	return &MempoolTxnSummary{
+		Hash:              mempoolTx.Hash,
+		TxnType:           mempoolTx.Tx.TxnMeta.GetTxnType(),
+		PublicKey:         mempoolTx.Tx.PublicKey,
+		FeeNanos:          mempoolTx.Fee,
+		FeeRateNanosPerKB: mempoolTx.FeePerKB,
+		SizeBytes:         mempoolTx.TxSizeBytes,
+		Added:             mempoolTx.Added,
+		TimeInPool:        now.Sub(mempoolTx.Added),
+		Height:            mempoolTx.Height,
+		Status:            MempoolTxnStatusValidated,
+	}
+}
+
+func _unconnectedTxToSummary(unconnectedTx *UnconnectedTx, now time.Time) (*MempoolTxnSummary, error) {
+	txn := unconnectedTx.tx
+	txnBytes, err := txn.ToBytes(false)
+	if err != nil {
+		return nil, fmt.Errorf("_unconnectedTxToSummary: Problem serializing txn: %v", err)
+	}
+	// The fee of an unconnected txn can't be computed from its inputs since they aren't known
+	// yet, so we fall back to the fee declared on the txn. This is zero for UTXO model txns.
+	feeRate := uint64(0)
+	if len(txnBytes) != 0 {
+		feeRate = txn.TxnFeeNanos * 1000 / uint64(len(txnBytes))
+	}
+	added := unconnectedTx.expiration.Add(-UnconnectedTxnExpirationInterval)
+	return &MempoolTxnSummary{
+		Hash:              txn.Hash(),
+		TxnType:           txn.TxnMeta.GetTxnType(),
+		PublicKey:         txn.PublicKey,
+		FeeNanos:          txn.TxnFeeNanos,
+		FeeRateNanosPerKB: feeRate,
+		SizeBytes:         uint64(len(txnBytes)),
+		Added:             added,
+		TimeInPool:        now.Sub(added),
+		Status:            MempoolTxnStatusUnconnected,
+	}, nil
+}
+
+// ListTransactions returns a summary of every txn in the pool that matches the filter,
+// ordered by the time the txns were added. A nil filter matches every validated txn.
+func (mp *DeSoMempool) ListTransactions(filter *MempoolTxnFilter) ([]*MempoolTxnSummary, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	now := time.Now()
+	summaries := []*MempoolTxnSummary{}
+	for _, mempoolTx := range mp.poolMap {
+		summary := _mempoolTxToSummary(mempoolTx, now)
+		if filter.matches(summary) {
+			summaries = append(summaries, summary)
+		}
+	}
+	if filter != nil && filter.IncludeUnconnected {
+		for _, unconnectedTx := range mp.unconnectedTxns {
+			summary, err := _unconnectedTxToSummary(unconnectedTx, now)
+			if err != nil {
+				return nil, fmt.Errorf("ListTransactions: %v", err)
+			}
+			if filter.matches(summary) {
+				summaries = append(summaries, summary)
+			}
+		}
+	}
+
+	// Sort by time added, breaking ties on the hash so the order is deterministic.
+	sort.Slice(summaries, func(ii, jj int) bool {
+		if !summaries[ii].Added.Equal(summaries[jj].Added) {
+			return summaries[ii].Added.Before(summaries[jj].Added)
+		}
+		return bytes.Compare(summaries[ii].Hash[:], summaries[jj].Hash[:]) < 0
+	})
+	if filter != nil && filter.Limit > 0 && len(summaries) > filter.Limit {
+		summaries = summaries[:filter.Limit]
+	}
+	return summaries, nil
+}
+
+// GetTransactionDetail returns the detail view of the txn with the given hash, or nil
+// if the txn is not in the pool.
+func (mp *DeSoMempool) GetTransactionDetail(txnHash *BlockHash) (*MempoolTxnDetail, error) {
+	if txnHash == nil {
+		return nil, fmt.Errorf("GetTransactionDetail: Txn hash is nil")
+	}
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	now := time.Now()
+	if mempoolTx, exists := mp.poolMap[*txnHash]; exists {
+		summary := _mempoolTxToSummary(mempoolTx, now)
+		// Recompute the fee rate from the txn itself for balance model txns, which
+		// carry their fee explicitly.
+		if mempoolTx.Tx.TxnFeeNanos != 0 {
+			feeRate, err := mempoolTx.Tx.ComputeFeeRatePerKBNanos()
+			if err == nil {
+				summary.FeeRateNanosPerKB = feeRate
+			}
+		}
+		dependsOn, dependents := mp._getMempoolTxDependencies(mempoolTx)
+		return &MempoolTxnDetail{
+			MempoolTxnSummary: summary,
+			Txn:               mempoolTx.Tx,
+			DependsOn:         dependsOn,
+			Dependents:        dependents,
+		}, nil
+	}
+	if unconnectedTx, exists := mp.unconnectedTxns[*txnHash]; exists {
+		summary, err := _unconnectedTxToSummary(unconnectedTx, now)
+		if err != nil {
+			return nil, fmt.Errorf("GetTransactionDetail: %v", err)
+		}
+		// An unconnected txn depends on whichever of its inputs are already in the pool.
+		// Nothing in the pool can depend on it since it hasn't been connected.
+		dependsOn := []*BlockHash{}
+		seen := make(map[BlockHash]bool)
+		for _, txIn := range unconnectedTx.tx.TxInputs {
+			if _, inPool := mp.poolMap[txIn.TxID]; inPool && !seen[txIn.TxID] {
+				seen[txIn.TxID] = true
+				dependsOn = append(dependsOn, txIn.TxID.NewBlockHash())
+			}
+		}
+		return &MempoolTxnDetail{
+			MempoolTxnSummary: summary,
+			Txn:               unconnectedTx.tx,
+			DependsOn:         dependsOn,
+			Dependents:        []*BlockHash{},
+		}, nil
+	}
+	return nil, nil
+}
+
+// _getMempoolTxDependencies returns the pool txns that the given txn depends on and the
+// pool txns that depend on it. Must be called with the read lock held.
+func (mp *DeSoMempool) _getMempoolTxDependencies(mempoolTx *MempoolTx) (
+	_dependsOn []*BlockHash, _dependents []*BlockHash) {
+
+	dependsOnSet := make(map[BlockHash]bool)
+	for _, txIn := range mempoolTx.Tx.TxInputs {
+		if _, inPool := mp.poolMap[txIn.TxID]; inPool {
+			dependsOnSet[txIn.TxID] = true
+		}
+	}
+	dependentsSet := make(map[BlockHash]bool)
+	for _, otherTx := range mp.poolMap {
+		if *otherTx.Hash == *mempoolTx.Hash {
+			continue
+		}
+		for _, txIn := range otherTx.Tx.TxInputs {
+			if txIn.TxID == *mempoolTx.Hash {
+				dependentsSet[*otherTx.Hash] = true
+				break
+			}
+		}
+		// In the balance model, txns from the same transactor are applied in the order
+		// they were added, so earlier txns are dependencies and later txns are dependents.
+		if len(mempoolTx.Tx.TxInputs) == 0 && len(otherTx.Tx.TxInputs) == 0 &&
+			bytes.Equal(otherTx.Tx.PublicKey, mempoolTx.Tx.PublicKey) {
+			if otherTx.Added.Before(mempoolTx.Added) {
+				dependsOnSet[*otherTx.Hash] = true
+			} else if otherTx.Added.After(mempoolTx.Added) {
+				dependentsSet[*otherTx.Hash] = true
+			}
+		}
+	}
+	return _sortedBlockHashesFromSet(dependsOnSet), _sortedBlockHashesFromSet(dependentsSet)
+}
+
+func _sortedBlockHashesFromSet(hashSet map[BlockHash]bool) []*BlockHash {
+	hashes := make([]*BlockHash, 0, len(hashSet))
+	for hash := range hashSet {
+		hashes = append(hashes, hash.NewBlockHash())
+	}
+	sort.Slice(hashes, func(ii, jj int) bool {
+		return bytes.Compare(hashes[ii][:], hashes[jj][:]) < 0
+	})
+	return hashes
+}
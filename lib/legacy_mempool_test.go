@@ -447,3 +447,113 @@ func TestMempoolAugmentedUtxoViewTransactionChain(t *testing.T) {
 		mp.Stop()
 	})
 }
+
+func TestMempoolListTransactionsAndGetTransactionDetail(t *testing.T) {
+	require := require.New(t)
+
+	chain, _, senderPkBytes, recipientPkBytes := _setupFiveBlocks(t)
+
+	// txn1 sends 1 DeSo to the recipient and the rest back to the sender as change.
+	txn1 := _assembleBasicTransferTxnFullySigned(t, chain, 1, 0,
+		senderPkString, recipientPkString, senderPrivString, nil)
+	txn1Hash := txn1.Hash()
+	changeOutput := txn1.TxOutputs[1]
+
+	// txn2 spends the change of txn1.
+	txn2 := &MsgDeSoTxn{
+		TxInputs: []*DeSoInput{{TxID: *txn1Hash, Index: 1}},
+		TxOutputs: []*DeSoOutput{
+			{PublicKey: recipientPkBytes, AmountNanos: 1},
+			{PublicKey: senderPkBytes, AmountNanos: changeOutput.AmountNanos - 1},
+		},
+		PublicKey: senderPkBytes,
+		TxnMeta:   &BasicTransferMetadata{},
+	}
+	_signTxn(t, txn2, senderPrivString)
+	txn2Hash := txn2.Hash()
+
+	// txn3 spends the change of txn2, which we hold back so txn3 is unconnected.
+	txn3 := &MsgDeSoTxn{
+		TxInputs: []*DeSoInput{{TxID: *txn2Hash, Index: 1}},
+		TxOutputs: []*DeSoOutput{
+			{PublicKey: recipientPkBytes, AmountNanos: 1},
+			{PublicKey: senderPkBytes, AmountNanos: changeOutput.AmountNanos - 2},
+		},
+		PublicKey: senderPkBytes,
+		TxnMeta:   &BasicTransferMetadata{},
+	}
+	_signTxn(t, txn3, senderPrivString)
+	txn3Hash := txn3.Hash()
+
+	mp := NewDeSoMempool(
+		chain, 0, /* rateLimitFeeRateNanosPerKB */
+		0 /* minFeeRateNanosPerKB */, "", true,
+		"" /*dataDir*/, "", true)
+	t.Cleanup(func() {
+		if !mp.stopped {
+			mp.Stop()
+		}
+	})
+	_, err := mp.processTransaction(txn1, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+	require.NoError(err)
+	_, err = mp.processTransaction(txn3, true /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+	require.NoError(err)
+
+	// Only txn1 is validated.
+	summaries, err := mp.ListTransactions(nil)
+	require.NoError(err)
+	require.Len(summaries, 1)
+	require.Equal(*txn1Hash, *summaries[0].Hash)
+	require.Equal(MempoolTxnStatusValidated, summaries[0].Status)
+	require.Equal(TxnTypeBasicTransfer, summaries[0].TxnType)
+	require.Equal(senderPkBytes, summaries[0].PublicKey)
+	require.True(summaries[0].TimeInPool >= 0)
+
+	// Including unconnected txns returns txn3 as well.
+	summaries, err = mp.ListTransactions(&MempoolTxnFilter{IncludeUnconnected: true})
+	require.NoError(err)
+	require.Len(summaries, 2)
+	require.Equal(MempoolTxnStatusUnconnected, summaries[1].Status)
+	require.Equal(*txn3Hash, *summaries[1].Hash)
+
+	// Filters on public key, txn type, fee rate, and limit.
+	summaries, err = mp.ListTransactions(&MempoolTxnFilter{PublicKey: recipientPkBytes, IncludeUnconnected: true})
+	require.NoError(err)
+	require.Len(summaries, 0)
+	summaries, err = mp.ListTransactions(&MempoolTxnFilter{TxnTypes: []TxnType{TxnTypeSubmitPost}})
+	require.NoError(err)
+	require.Len(summaries, 0)
+	summaries, err = mp.ListTransactions(&MempoolTxnFilter{MinFeeRateNanosPerKB: 1, IncludeUnconnected: true})
+	require.NoError(err)
+	require.Len(summaries, 0)
+	summaries, err = mp.ListTransactions(&MempoolTxnFilter{IncludeUnconnected: true, Limit: 1})
+	require.NoError(err)
+	require.Len(summaries, 1)
+	require.Equal(*txn1Hash, *summaries[0].Hash)
+
+	// Add txn2, which connects txn3 as well.
+	_, err = mp.processTransaction(txn2, false /*allowUnconnectedTxn*/, false /*rateLimit*/, 0 /*peerID*/, true /*verifySignatures*/)
+	require.NoError(err)
+	summaries, err = mp.ListTransactions(&MempoolTxnFilter{IncludeUnconnected: true})
+	require.NoError(err)
+	require.Len(summaries, 3)
+	for _, summary := range summaries {
+		require.Equal(MempoolTxnStatusValidated, summary.Status)
+	}
+
+	// txn2 depends on txn1 and txn3 depends on txn2.
+	detail, err := mp.GetTransactionDetail(txn2Hash)
+	require.NoError(err)
+	require.Equal(txn2, detail.Txn)
+	require.Equal([]*BlockHash{txn1Hash}, detail.DependsOn)
+	require.Equal([]*BlockHash{txn3Hash}, detail.Dependents)
+	detail, err = mp.GetTransactionDetail(txn1Hash)
+	require.NoError(err)
+	require.Len(detail.DependsOn, 0)
+	require.Equal([]*BlockHash{txn2Hash}, detail.Dependents)
+
+	// A txn that isn't in the pool returns nil.
+	detail, err = mp.GetTransactionDetail(&BlockHash{})
+	require.NoError(err)
+	require.Nil(detail)
+}
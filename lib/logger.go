@@ -0,0 +1,321 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Structured Logging
+//
+// The networking and consensus code used to log everything through glog's global functions, so there was no way
+// to tell the logs of one subsystem from another's other than by the text of the messages. A Logger is scoped to
+// a component, e.g. "peer" or "consensus", and can carry fields, e.g. a peer's ID or a block's hash, that are
+// added to every message it logs. The Server creates the loggers from the node's LogConfig and passes them to the
+// subsystems through their constructors.
+//
+// Operators can set the minimum level of a component with --log-component-levels. For example,
+// "peer=warning,connmgr=warning" hides everything but the warnings and errors of the peers and the connection
+// manager, and "consensus=debug" shows all of the consensus engine's verbose logs regardless of glog's -v flag.
+// Components without a level log at the info level, and their verbose logs follow -v as before.
+//
+// In the text format, messages are written through glog, prefixed with the component and followed by the fields.
+// In the JSON format, each message is written to stderr as a single JSON object, so they can be filtered by any
+// of their fields with standard tools.
+
+// LogLevel is the severity of a log message. Verbose messages, i.e. the ones logged through Logger.V, are at
+// the debug level.
+type LogLevel uint8
+
+const (
+	LogLevelDebug   LogLevel = 0
+	LogLevelInfo    LogLevel = 1
+	LogLevelWarning LogLevel = 2
+	LogLevelError   LogLevel = 3
+)
+
+func (level LogLevel) String() string {
+	switch level {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarning:
+		return "warning"
+	case LogLevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseLogLevel(levelStr string) (LogLevel, error) {
+	for _, level := range []LogLevel{LogLevelDebug, LogLevelInfo, LogLevelWarning, LogLevelError} {
+		if strings.EqualFold(levelStr, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("ParseLogLevel: Unknown log level %v", levelStr)
+}
+
+// LogFormat is how log messages are written.
+type LogFormat uint8
+
+const (
+	LogFormatText LogFormat = 0
+	LogFormatJSON LogFormat = 1
+)
+
+func (format LogFormat) String() string {
+	switch format {
+	case LogFormatText:
+		return "text"
+	case LogFormatJSON:
+		return "json"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseLogFormat(formatStr string) (LogFormat, error) {
+	for _, format := range []LogFormat{LogFormatText, LogFormatJSON} {
+		if strings.EqualFold(formatStr, format.String()) {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("ParseLogFormat: Unknown log format %v", formatStr)
+}
+
+// The components of the loggers created by the Server.
+const (
+	LogComponentServer            = "server"
+	LogComponentPeer              = "peer"
+	LogComponentConnectionManager = "connmgr"
+	LogComponentNetworkManager    = "netmgr"
+	LogComponentConsensus         = "consensus"
+)
+
+// LogField is a key-value pair added to every message logged by a Logger.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+func LogFieldPeerID(peerID uint64) LogField {
+	return LogField{Key: "peer_id", Value: peerID}
+}
+
+func LogFieldBlockHash(blockHash *BlockHash) LogField {
+	if blockHash == nil {
+		return LogField{Key: "block_hash", Value: ""}
+	}
+	return LogField{Key: "block_hash", Value: blockHash.String()}
+}
+
+// LogConfig is the configuration shared by all of a node's loggers.
+type LogConfig struct {
+	Format LogFormat
+	// ComponentLevels is the minimum level of the messages logged by each component. Components without a
+	// level log at the info level, and their verbose messages follow glog's -v flag.
+	ComponentLevels map[string]LogLevel
+
+	// output is where JSON messages are written.
+	output     io.Writer
+	outputLock sync.Mutex
+}
+
+// NewLogConfig parses the --log-format and --log-component-levels flags. componentLevels is a comma-separated
+// list of component=level pairs, e.g. "peer=warning,consensus=debug".
+func NewLogConfig(format string, componentLevels string) (*LogConfig, error) {
+	config := &LogConfig{
+		Format:          LogFormatText,
+		ComponentLevels: make(map[string]LogLevel),
+		output:          os.Stderr,
+	}
+	if format != "" {
+		var err error
+		if config.Format, err = ParseLogFormat(format); err != nil {
+			return nil, errors.Wrapf(err, "NewLogConfig: ")
+		}
+	}
+	for _, componentLevel := range strings.Split(componentLevels, ",") {
+		componentLevel = strings.TrimSpace(componentLevel)
+		if componentLevel == "" {
+			continue
+		}
+		component, levelStr, found := strings.Cut(componentLevel, "=")
+		if !found || component == "" {
+			return nil, fmt.Errorf("NewLogConfig: Component level %v should be of the form component=level",
+				componentLevel)
+		}
+		level, err := ParseLogLevel(levelStr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewLogConfig: ")
+		}
+		config.ComponentLevels[component] = level
+	}
+	return config, nil
+}
+
+// Logger logs the messages of a component. Its methods mirror glog's, so that logger.Infof and
+// logger.V(1).Infof can be used in place of glog.Infof and glog.V(1).Infof.
+type Logger interface {
+	// With returns a logger that adds the fields to every message, after the logger's own fields.
+	With(fields ...LogField) Logger
+	// WithComponent returns a logger for another component that shares the logger's config, without its fields.
+	WithComponent(component string) Logger
+	// V returns a logger whose Info and Infof messages are verbose messages at the given glog verbosity level.
+	V(level glog.Level) Logger
+
+	Info(args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type componentLogger struct {
+	config    *LogConfig
+	component string
+	fields    []LogField
+	verbosity glog.Level
+}
+
+// NewLogger returns a logger for the component. A nil config logs in the text format, with no component levels.
+func NewLogger(config *LogConfig, component string) Logger {
+	if config == nil {
+		config = &LogConfig{
+			Format:          LogFormatText,
+			ComponentLevels: make(map[string]LogLevel),
+			output:          os.Stderr,
+		}
+	}
+	return &componentLogger{
+		config:    config,
+		component: component,
+	}
+}
+
+func (logger *componentLogger) With(fields ...LogField) Logger {
+	newLogger := *logger
+	newLogger.fields = append(append([]LogField{}, logger.fields...), fields...)
+	return &newLogger
+}
+
+func (logger *componentLogger) WithComponent(component string) Logger {
+	return NewLogger(logger.config, component)
+}
+
+func (logger *componentLogger) V(level glog.Level) Logger {
+	newLogger := *logger
+	newLogger.verbosity = level
+	return &newLogger
+}
+
+func (logger *componentLogger) Info(args ...interface{}) {
+	if level := logger.infoLevel(); logger.isEnabled(level) {
+		logger.log(level, fmt.Sprint(args...))
+	}
+}
+
+func (logger *componentLogger) Infof(format string, args ...interface{}) {
+	if level := logger.infoLevel(); logger.isEnabled(level) {
+		logger.log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (logger *componentLogger) Warningf(format string, args ...interface{}) {
+	if logger.isEnabled(LogLevelWarning) {
+		logger.log(LogLevelWarning, fmt.Sprintf(format, args...))
+	}
+}
+
+func (logger *componentLogger) Error(args ...interface{}) {
+	if logger.isEnabled(LogLevelError) {
+		logger.log(LogLevelError, fmt.Sprint(args...))
+	}
+}
+
+func (logger *componentLogger) Errorf(format string, args ...interface{}) {
+	if logger.isEnabled(LogLevelError) {
+		logger.log(LogLevelError, fmt.Sprintf(format, args...))
+	}
+}
+
+func (logger *componentLogger) infoLevel() LogLevel {
+	if logger.verbosity > 0 {
+		return LogLevelDebug
+	}
+	return LogLevelInfo
+}
+
+// isEnabled returns whether the logger logs messages at the level. It's checked before the message is formatted,
+// so that verbose messages cost little when they're disabled.
+func (logger *componentLogger) isEnabled(level LogLevel) bool {
+	minLevel, hasMinLevel := logger.config.ComponentLevels[logger.component]
+	if !hasMinLevel {
+		if level == LogLevelDebug {
+			return bool(glog.V(logger.verbosity))
+		}
+		return true
+	}
+	return level >= minLevel
+}
+
+// logDepth is the number of frames between the code calling the logger and the call to glog, so that glog
+// reports the caller's file and line.
+const logDepth = 2
+
+func (logger *componentLogger) log(level LogLevel, msg string) {
+	if logger.config.Format == LogFormatJSON {
+		logger.logJSON(level, msg)
+		return
+	}
+
+	var line strings.Builder
+	line.WriteString("[" + logger.component + "] " + msg)
+	for _, field := range logger.fields {
+		line.WriteString(fmt.Sprintf(" %s=%v", field.Key, field.Value))
+	}
+	switch level {
+	case LogLevelError:
+		glog.ErrorDepth(logDepth, line.String())
+	case LogLevelWarning:
+		glog.WarningDepth(logDepth, line.String())
+	default:
+		glog.InfoDepth(logDepth, line.String())
+	}
+}
+
+func (logger *componentLogger) logJSON(level LogLevel, msg string) {
+	entry := make(map[string]interface{}, len(logger.fields)+4)
+	for _, field := range logger.fields {
+		entry[field.Key] = field.Value
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["component"] = logger.component
+	entry["msg"] = msg
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		// If a field can't be marshaled, the fields are logged with their string representations instead.
+		for key, value := range entry {
+			entry[key] = fmt.Sprintf("%v", value)
+		}
+		if entryBytes, err = json.Marshal(entry); err != nil {
+			return
+		}
+	}
+
+	logger.config.outputLock.Lock()
+	defer logger.config.outputLock.Unlock()
+	logger.config.output.Write(append(entryBytes, '\n'))
+}
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogConfig(t *testing.T) {
+	require := require.New(t)
+
+	config, err := NewLogConfig("", "")
+	require.NoError(err)
+	require.Equal(LogFormatText, config.Format)
+	require.Empty(config.ComponentLevels)
+
+	config, err = NewLogConfig("JSON", " peer=warning, consensus=debug ,")
+	require.NoError(err)
+	require.Equal(LogFormatJSON, config.Format)
+	require.Equal(map[string]LogLevel{
+		LogComponentPeer:      LogLevelWarning,
+		LogComponentConsensus: LogLevelDebug,
+	}, config.ComponentLevels)
+
+	_, err = NewLogConfig("xml", "")
+	require.Error(err)
+	_, err = NewLogConfig("text", "peer")
+	require.Error(err)
+	_, err = NewLogConfig("text", "=info")
+	require.Error(err)
+	_, err = NewLogConfig("text", "peer=loud")
+	require.Error(err)
+}
+
+func TestLoggerJSONOutput(t *testing.T) {
+	require := require.New(t)
+
+	config, err := NewLogConfig("json", "peer=warning,consensus=debug")
+	require.NoError(err)
+	var output bytes.Buffer
+	config.output = &output
+	readEntries := func() []map[string]interface{} {
+		var entries []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			entry := make(map[string]interface{})
+			require.NoError(json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+		output.Reset()
+		return entries
+	}
+
+	// The peer's info messages are filtered out, and its fields are added to the warnings.
+	blockHash := &BlockHash{1, 2, 3}
+	peerLogger := NewLogger(config, LogComponentPeer).With(LogFieldPeerID(7))
+	peerLogger.Infof("connected")
+	peerLogger.V(2).Infof("received message")
+	peerLogger.With(LogFieldBlockHash(blockHash)).Warningf("bad block at height %d", 10)
+	entries := readEntries()
+	require.Len(entries, 1)
+	require.Equal("warning", entries[0]["level"])
+	require.Equal(LogComponentPeer, entries[0]["component"])
+	require.Equal("bad block at height 10", entries[0]["msg"])
+	require.Equal(float64(7), entries[0]["peer_id"])
+	require.Equal(blockHash.String(), entries[0]["block_hash"])
+	require.NotEmpty(entries[0]["time"])
+
+	// The consensus logs its verbose messages at the debug level, and a logger for another component
+	// doesn't keep the fields.
+	consensusLogger := peerLogger.WithComponent(LogComponentConsensus)
+	consensusLogger.V(3).Infof("timeout for view %d", 5)
+	consensusLogger.Error("failed")
+	entries = readEntries()
+	require.Len(entries, 2)
+	require.Equal("debug", entries[0]["level"])
+	require.Equal("timeout for view 5", entries[0]["msg"])
+	require.NotContains(entries[0], "peer_id")
+	require.Equal("error", entries[1]["level"])
+	require.Equal("failed", entries[1]["msg"])
+
+	// Components without a level log their info messages.
+	NewLogger(config, LogComponentServer).Info("started")
+	entries = readEntries()
+	require.Len(entries, 1)
+	require.Equal("info", entries[0]["level"])
+	require.Equal(LogComponentServer, entries[0]["component"])
+}
@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"sort"
+	"time"
+)
+
+// Median Time Past
+//
+// The median time past (MTP) of a block is the median of the timestamps of the block and of the blocks right before
+// it, MedianTimePastBlockCount blocks in all. Unlike the timestamp of any single block, it can't be moved by a
+// minority of block producers, and it only moves forward as the chain grows. From the MedianTimePastBlockHeight on,
+// a block's timestamp must be greater than the MTP of its parent. For PoW blocks this is implied by the rule that
+// timestamps increase from block to block. For PoS blocks, whose timestamps only have to be at least their parent's,
+// it keeps a run of blocks from sharing the same timestamp.
+//
+// The MTP is only a lower bound on a block's timestamp. The checks that reject blocks too far in the future measure
+// the drift from the node's own clock, so block producers that date a run of blocks in the future can't use the MTP
+// to move the upper bound forward.
+
+// CalcMedianTimePastNanoSecs returns the median of the timestamps of node and of the numBlocks-1 blocks before it.
+// Fewer timestamps are used if the chain is shorter than numBlocks, or if the ancestors of node aren't loaded.
+func CalcMedianTimePastNanoSecs(node *BlockNode, numBlocks uint32) int64 {
+	if numBlocks == 0 {
+		numBlocks = 1
+	}
+	var timestamps []int64
+	for iterNode := node; iterNode != nil && uint32(len(timestamps)) < numBlocks; iterNode = iterNode.Parent {
+		if iterNode.Header == nil {
+			break
+		}
+		timestamps = append(timestamps, iterNode.Header.TstampNanoSecs)
+	}
+	if len(timestamps) == 0 {
+		return 0
+	}
+	sort.Slice(timestamps, func(ii, jj int) bool {
+		return timestamps[ii] < timestamps[jj]
+	})
+	return timestamps[len(timestamps)/2]
+}
+
+// GetMedianTimePast returns the median time past of the tip of the best chain.
+func (bc *Blockchain) GetMedianTimePast() time.Time {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	return time.Unix(0, CalcMedianTimePastNanoSecs(bc.blockTip(), bc.params.MedianTimePastBlockCount))
+}
+
+// getMedianTimePastOfParent returns the median time past of the parent of a header, or false if the parent isn't in
+// the block index.
+func (bc *Blockchain) getMedianTimePastOfParent(header *MsgDeSoHeader) (_medianTimePastNanoSecs int64, _exists bool) {
+	if header.PrevBlockHash == nil {
+		return 0, false
+	}
+	parentNode, exists := bc.blockIndexByHash.Get(*header.PrevBlockHash)
+	if !exists {
+		return 0, false
+	}
+	return CalcMedianTimePastNanoSecs(parentNode, bc.params.MedianTimePastBlockCount), true
+}
+
+// isBlockTimestampAfterMedianTimePast returns false if the header is at or after the MedianTimePastBlockHeight and
+// its timestamp isn't greater than the median time past of its parent.
+func (bc *Blockchain) isBlockTimestampAfterMedianTimePast(header *MsgDeSoHeader) bool {
+	if header.Height < uint64(bc.params.ForkHeights.MedianTimePastBlockHeight) {
+		return true
+	}
+	medianTimePastNanoSecs, exists := bc.getMedianTimePastOfParent(header)
+	if !exists {
+		return true
+	}
+	return header.TstampNanoSecs > medianTimePastNanoSecs
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalcMedianTimePastNanoSecs(t *testing.T) {
+	require := require.New(t)
+
+	// Build a chain whose timestamps are out of order.
+	timestamps := []int64{10, 50, 20, 40, 30, 70, 60}
+	var tip *BlockNode
+	for ii, timestamp := range timestamps {
+		tip = NewBlockNode(tip, NewBlockHash(RandomBytes(32)), uint32(ii), nil, nil,
+			&MsgDeSoHeader{TstampNanoSecs: timestamp}, StatusHeaderValidated)
+	}
+
+	require.Equal(int64(0), CalcMedianTimePastNanoSecs(nil, 11))
+	require.Equal(int64(60), CalcMedianTimePastNanoSecs(tip, 1))
+	// The median of 30, 70, and 60.
+	require.Equal(int64(60), CalcMedianTimePastNanoSecs(tip, 3))
+	// The median of 40, 30, 70, and 60 is the upper one of the two middle timestamps.
+	require.Equal(int64(60), CalcMedianTimePastNanoSecs(tip, 4))
+	// The chain is shorter than the number of blocks, so all of its timestamps are used.
+	require.Equal(int64(40), CalcMedianTimePastNanoSecs(tip, 11))
+}
+
+func TestMedianTimePastTimestampValidation(t *testing.T) {
+	require := require.New(t)
+
+	bc, params, _ := NewTestBlockchain(t)
+	defer func(prevForkHeight uint32) {
+		params.ForkHeights.MedianTimePastBlockHeight = prevForkHeight
+	}(params.ForkHeights.MedianTimePastBlockHeight)
+	params.ForkHeights.MedianTimePastBlockHeight = 0
+	mempool, miner := NewTestMiner(t, bc, params, true)
+	for ii := 0; ii < 5; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0, mempool)
+		require.NoError(err)
+	}
+	tip := bc.BlockTip()
+	medianTimePastNanoSecs := CalcMedianTimePastNanoSecs(tip, params.MedianTimePastBlockCount)
+	require.Equal(time.Unix(0, medianTimePastNanoSecs), bc.GetMedianTimePast())
+	require.Less(medianTimePastNanoSecs, tip.Header.TstampNanoSecs)
+
+	// Add a run of blocks that share their parent's timestamp, as PoS blocks may.
+	for ii := 0; ii < int(params.MedianTimePastBlockCount); ii++ {
+		header := &MsgDeSoHeader{
+			PrevBlockHash:  tip.Hash,
+			TstampNanoSecs: tip.Header.TstampNanoSecs,
+			Height:         uint64(tip.Height + 1),
+		}
+		tip = NewBlockNode(tip, NewBlockHash(RandomBytes(32)), tip.Height+1, nil, nil, header, StatusHeaderValidated)
+		bc.blockIndexByHash.Set(*tip.Hash, tip)
+	}
+	header := &MsgDeSoHeader{
+		PrevBlockHash:  tip.Hash,
+		TstampNanoSecs: tip.Header.TstampNanoSecs,
+		Height:         uint64(tip.Height + 1),
+	}
+
+	// The timestamp is at least its parent's, but not greater than the median time past.
+	require.Equal(RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast,
+		bc.isBlockTimestampValidRelativeToParentPoS(header))
+	header.TstampNanoSecs++
+	require.NoError(bc.isBlockTimestampValidRelativeToParentPoS(header))
+
+	// The rule only applies from the fork height on.
+	header.TstampNanoSecs--
+	params.ForkHeights.MedianTimePastBlockHeight = math.MaxUint32
+	require.NoError(bc.isBlockTimestampValidRelativeToParentPoS(header))
+
+	// A run of blocks dated in the future moves the median time past forward, but the drift of the next block
+	// is still measured from the node's clock, so the run can't ratchet the upper bound forward.
+	params.ForkHeights.MedianTimePastBlockHeight = 0
+	maxOffsetNanoSecs := SecondsToNanoSeconds(int64(params.MaxTstampOffsetSeconds))
+	for ii := 0; ii < int(params.MedianTimePastBlockCount); ii++ {
+		header := &MsgDeSoHeader{
+			PrevBlockHash:  tip.Hash,
+			TstampNanoSecs: time.Now().UnixNano() + int64(ii+1)*maxOffsetNanoSecs,
+			Height:         uint64(tip.Height + 1),
+		}
+		tip = NewBlockNode(tip, NewBlockHash(RandomBytes(32)), tip.Height+1, nil, nil, header, StatusHeaderValidated)
+		bc.blockIndexByHash.Set(*tip.Hash, tip)
+	}
+	medianTimePastNanoSecs = CalcMedianTimePastNanoSecs(tip, params.MedianTimePastBlockCount)
+	require.Greater(medianTimePastNanoSecs, time.Now().UnixNano()+maxOffsetNanoSecs)
+	header = &MsgDeSoHeader{
+		PrevBlockHash:  tip.Hash,
+		TstampNanoSecs: medianTimePastNanoSecs + 1,
+		Height:         uint64(tip.Height + 1),
+	}
+	require.True(bc.isBlockTimestampAfterMedianTimePast(header))
+	_, _, err := bc.processHeaderPoW(header, NewBlockHash(RandomBytes(32)))
+	require.Equal(HeaderErrorBlockTooFarInTheFuture, err)
+}
@@ -0,0 +1,305 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/pkg/errors"
+)
+
+// Message Envelopes: Reference implementations of the encryption used by DMs V3, so that every client lays out
+// encrypted payloads the same way. Consensus never decrypts anything, so none of this is enforced on-chain, but a
+// client that doesn't follow it produces messages and member keys that other clients can't read.
+//
+// Every payload is wrapped in a MessageEnvelope, which records the envelope version, what the payload is, and the
+// public key it was encrypted to, ahead of the ECIES ciphertext produced by EncryptBytesWithPublicKey. Keys are
+// used as follows:
+//   - A DM between two users is encrypted to the public key of a shared key that both of them can derive from
+//     their own access private key and the other's access public key. See DeriveMessagingSharedPrivateKey.
+//   - A group message is encrypted to the access group's public key.
+//   - Every member of an access group gets the group's private key wrapped to the public key of the member's own
+//     access group, and the wrapped key is what goes in the member's EncryptedKey. See WrapAccessGroupKey.
+//
+// When members are removed from a group, they still hold the group's private key, so the owner should rotate it
+// with RotateAccessGroupKey. Messages sent before the rotation stay readable with the old key only.
+//
+// Payloads that were encrypted before envelopes existed are raw ECIES ciphertexts, which always start with 0x04,
+// the prefix of the uncompressed ephemeral public key. DecodeMessageEnvelope decodes them as envelopes with
+// MessageEnvelopeVersionLegacy, which is why no envelope version can ever be 0x04.
+
+type MessageEnvelopeVersion byte
+
+const (
+	// MessageEnvelopeVersionLegacy is a raw ECIES ciphertext without an envelope. It's only ever decoded.
+	MessageEnvelopeVersionLegacy MessageEnvelopeVersion = 0
+	// MessageEnvelopeVersion1 is an ECIES ciphertext encrypted with EncryptBytesWithPublicKey.
+	MessageEnvelopeVersion1 MessageEnvelopeVersion = 1
+
+	// messageEnvelopeLegacyPrefix is the first byte of every legacy ciphertext.
+	messageEnvelopeLegacyPrefix = 0x04
+)
+
+type MessageEnvelopeType byte
+
+const (
+	MessageEnvelopeTypeUnknown        MessageEnvelopeType = 0
+	MessageEnvelopeTypeDirectMessage  MessageEnvelopeType = 1
+	MessageEnvelopeTypeGroupMessage   MessageEnvelopeType = 2
+	MessageEnvelopeTypeAccessGroupKey MessageEnvelopeType = 3
+)
+
+func (envelopeType MessageEnvelopeType) String() string {
+	switch envelopeType {
+	case MessageEnvelopeTypeDirectMessage:
+		return "DirectMessage"
+	case MessageEnvelopeTypeGroupMessage:
+		return "GroupMessage"
+	case MessageEnvelopeTypeAccessGroupKey:
+		return "AccessGroupKey"
+	default:
+		return "Unknown"
+	}
+}
+
+type MessageEnvelope struct {
+	Version MessageEnvelopeVersion
+	Type    MessageEnvelopeType
+	// RecipientPublicKey is the public key the payload was encrypted to, so that a client that holds several
+	// access keys knows which one decrypts it. It's nil for legacy envelopes.
+	RecipientPublicKey *PublicKey
+	Ciphertext         []byte
+}
+
+// ToBytes encodes the envelope as <Version byte><Type byte><RecipientPublicKey 33 bytes><Ciphertext>. The
+// ciphertext runs to the end, so the encoding is only as long as it needs to be.
+func (envelope *MessageEnvelope) ToBytes() ([]byte, error) {
+	if envelope.Version == MessageEnvelopeVersionLegacy {
+		return append([]byte{}, envelope.Ciphertext...), nil
+	}
+	if envelope.Version != MessageEnvelopeVersion1 {
+		return nil, fmt.Errorf("MessageEnvelope.ToBytes: Unsupported version %d", envelope.Version)
+	}
+	if envelope.RecipientPublicKey == nil {
+		return nil, fmt.Errorf("MessageEnvelope.ToBytes: RecipientPublicKey must be set")
+	}
+	var data []byte
+	data = append(data, byte(envelope.Version), byte(envelope.Type))
+	data = append(data, envelope.RecipientPublicKey.ToBytes()...)
+	data = append(data, envelope.Ciphertext...)
+	return data, nil
+}
+
+// DecodeMessageEnvelope decodes an envelope encoded with ToBytes, or a legacy ciphertext.
+func DecodeMessageEnvelope(data []byte) (*MessageEnvelope, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("DecodeMessageEnvelope: Envelope is empty")
+	}
+	if data[0] == messageEnvelopeLegacyPrefix {
+		return &MessageEnvelope{
+			Version:    MessageEnvelopeVersionLegacy,
+			Type:       MessageEnvelopeTypeUnknown,
+			Ciphertext: append([]byte{}, data...),
+		}, nil
+	}
+	rr := bytes.NewReader(data)
+	header := make([]byte, 2+PublicKeyLenCompressed)
+	if _, err := io.ReadFull(rr, header); err != nil {
+		return nil, errors.Wrapf(err, "DecodeMessageEnvelope: Problem reading header")
+	}
+	envelope := &MessageEnvelope{
+		Version:            MessageEnvelopeVersion(header[0]),
+		Type:               MessageEnvelopeType(header[1]),
+		RecipientPublicKey: NewPublicKey(header[2:]),
+		Ciphertext:         data[len(header):],
+	}
+	if envelope.Version != MessageEnvelopeVersion1 {
+		return nil, fmt.Errorf("DecodeMessageEnvelope: Unsupported version %d", envelope.Version)
+	}
+	if envelope.Type == MessageEnvelopeTypeUnknown || envelope.Type > MessageEnvelopeTypeAccessGroupKey {
+		return nil, fmt.Errorf("DecodeMessageEnvelope: Unknown type %d", envelope.Type)
+	}
+	return envelope, nil
+}
+
+// EncryptMessageEnvelope encrypts the plaintext to the recipient public key, and encodes it in an envelope of the
+// latest version.
+func EncryptMessageEnvelope(envelopeType MessageEnvelopeType, plaintext []byte, recipientPublicKeyBytes []byte) (
+	[]byte, error) {
+
+	recipientPublicKey, err := btcec.ParsePubKey(recipientPublicKeyBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "EncryptMessageEnvelope: Problem parsing recipient public key")
+	}
+	ciphertext, err := EncryptBytesWithPublicKey(plaintext, recipientPublicKey.ToECDSA())
+	if err != nil {
+		return nil, errors.Wrapf(err, "EncryptMessageEnvelope: Problem encrypting plaintext")
+	}
+	envelope := &MessageEnvelope{
+		Version:            MessageEnvelopeVersion1,
+		Type:               envelopeType,
+		RecipientPublicKey: NewPublicKey(recipientPublicKey.SerializeCompressed()),
+		Ciphertext:         ciphertext,
+	}
+	return envelope.ToBytes()
+}
+
+// DecryptMessageEnvelope decodes the envelope and decrypts it with the recipient private key. The envelope must be
+// of the expected type, unless it's a legacy envelope, which doesn't record its type.
+func DecryptMessageEnvelope(expectedType MessageEnvelopeType, envelopeBytes []byte,
+	recipientPrivateKey *btcec.PrivateKey) ([]byte, error) {
+
+	envelope, err := DecodeMessageEnvelope(envelopeBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DecryptMessageEnvelope: ")
+	}
+	if envelope.Version != MessageEnvelopeVersionLegacy {
+		if envelope.Type != expectedType {
+			return nil, fmt.Errorf("DecryptMessageEnvelope: Envelope has type %v but expected %v",
+				envelope.Type, expectedType)
+		}
+		recipientPublicKey := NewPublicKey(recipientPrivateKey.PubKey().SerializeCompressed())
+		if *envelope.RecipientPublicKey != *recipientPublicKey {
+			return nil, fmt.Errorf("DecryptMessageEnvelope: Envelope was encrypted to %v, not to the given key %v",
+				PkToStringBoth(envelope.RecipientPublicKey.ToBytes()), PkToStringBoth(recipientPublicKey.ToBytes()))
+		}
+	}
+	plaintext, err := DecryptBytesWithPrivateKey(envelope.Ciphertext, recipientPrivateKey.ToECDSA())
+	if err != nil {
+		return nil, errors.Wrapf(err, "DecryptMessageEnvelope: Problem decrypting ciphertext")
+	}
+	return plaintext, nil
+}
+
+// DeriveMessagingSharedPrivateKey derives the private key that two users share for DMs from one user's access
+// private key and the other's access public key. Both users derive the same key: it's the sha256 of their ECDH
+// shared secret.
+func DeriveMessagingSharedPrivateKey(privateKey *btcec.PrivateKey, publicKeyBytes []byte) (*btcec.PrivateKey, error) {
+	publicKey, err := btcec.ParsePubKey(publicKeyBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DeriveMessagingSharedPrivateKey: Problem parsing public key")
+	}
+	sharedSecret := sha256.Sum256(GenerateSharedSecret(privateKey, publicKey))
+	sharedPrivateKey, _ := btcec.PrivKeyFromBytes(sharedSecret[:])
+	return sharedPrivateKey, nil
+}
+
+// EncryptDirectMessage encrypts a DM from the sender to the recipient.
+func EncryptDirectMessage(plaintext []byte, senderAccessPrivateKey *btcec.PrivateKey,
+	recipientAccessPublicKey []byte) ([]byte, error) {
+
+	sharedPrivateKey, err := DeriveMessagingSharedPrivateKey(senderAccessPrivateKey, recipientAccessPublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "EncryptDirectMessage: ")
+	}
+	return EncryptMessageEnvelope(
+		MessageEnvelopeTypeDirectMessage, plaintext, sharedPrivateKey.PubKey().SerializeCompressed())
+}
+
+// DecryptDirectMessage decrypts a DM with the access private key of one of its parties and the access public key
+// of the other, which works for both the sender and the recipient.
+func DecryptDirectMessage(envelopeBytes []byte, accessPrivateKey *btcec.PrivateKey,
+	otherPartyAccessPublicKey []byte) ([]byte, error) {
+
+	sharedPrivateKey, err := DeriveMessagingSharedPrivateKey(accessPrivateKey, otherPartyAccessPublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DecryptDirectMessage: ")
+	}
+	return DecryptMessageEnvelope(MessageEnvelopeTypeDirectMessage, envelopeBytes, sharedPrivateKey)
+}
+
+// EncryptGroupMessage encrypts a message to an access group.
+func EncryptGroupMessage(plaintext []byte, accessGroupPublicKey []byte) ([]byte, error) {
+	return EncryptMessageEnvelope(MessageEnvelopeTypeGroupMessage, plaintext, accessGroupPublicKey)
+}
+
+// DecryptGroupMessage decrypts a message to an access group with the group's private key, which members get with
+// UnwrapAccessGroupKey.
+func DecryptGroupMessage(envelopeBytes []byte, accessGroupPrivateKey *btcec.PrivateKey) ([]byte, error) {
+	return DecryptMessageEnvelope(MessageEnvelopeTypeGroupMessage, envelopeBytes, accessGroupPrivateKey)
+}
+
+// WrapAccessGroupKey wraps the access group's private key to the public key of a member's access group. The result
+// goes in the member's EncryptedKey.
+func WrapAccessGroupKey(accessGroupPrivateKey *btcec.PrivateKey, memberAccessPublicKey []byte) ([]byte, error) {
+	return EncryptMessageEnvelope(
+		MessageEnvelopeTypeAccessGroupKey, accessGroupPrivateKey.Serialize(), memberAccessPublicKey)
+}
+
+// UnwrapAccessGroupKey recovers the access group's private key from a member's EncryptedKey, with the private key of
+// the member's access group.
+func UnwrapAccessGroupKey(encryptedKey []byte, memberAccessPrivateKey *btcec.PrivateKey) (*btcec.PrivateKey, error) {
+	accessGroupPrivateKeyBytes, err := DecryptMessageEnvelope(
+		MessageEnvelopeTypeAccessGroupKey, encryptedKey, memberAccessPrivateKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "UnwrapAccessGroupKey: ")
+	}
+	if len(accessGroupPrivateKeyBytes) != btcec.PrivKeyBytesLen {
+		return nil, fmt.Errorf("UnwrapAccessGroupKey: Key has length %d but should be %d",
+			len(accessGroupPrivateKeyBytes), btcec.PrivKeyBytesLen)
+	}
+	accessGroupPrivateKey, _ := btcec.PrivKeyFromBytes(accessGroupPrivateKeyBytes)
+	return accessGroupPrivateKey, nil
+}
+
+// AccessGroupMemberAccessKey identifies a member of an access group, along with the public key of the member's
+// access group that the group's private key is wrapped to.
+type AccessGroupMemberAccessKey struct {
+	MemberPublicKey []byte
+	MemberKeyName   []byte
+	AccessPublicKey []byte
+}
+
+// NewAccessGroupMemberWithWrappedKey returns the AccessGroupMember to add to or update in an access group, with the
+// group's private key wrapped to the member.
+func NewAccessGroupMemberWithWrappedKey(accessGroupPrivateKey *btcec.PrivateKey,
+	member *AccessGroupMemberAccessKey) (*AccessGroupMember, error) {
+
+	encryptedKey, err := WrapAccessGroupKey(accessGroupPrivateKey, member.AccessPublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewAccessGroupMemberWithWrappedKey: Problem wrapping key for member %v",
+			PkToStringBoth(member.MemberPublicKey))
+	}
+	return &AccessGroupMember{
+		AccessGroupMemberPublicKey: member.MemberPublicKey,
+		AccessGroupMemberKeyName:   member.MemberKeyName,
+		EncryptedKey:               encryptedKey,
+		ExtraData:                  make(map[string][]byte),
+	}, nil
+}
+
+// AccessGroupKeyRotation is a new key pair for an access group, wrapped to each of its remaining members.
+type AccessGroupKeyRotation struct {
+	// AccessGroupPrivateKey is the new private key. The owner isn't a member of its own group, so it has to keep
+	// the key itself to keep reading the group's messages.
+	AccessGroupPrivateKey *btcec.PrivateKey
+	AccessGroupPublicKey  []byte
+	// Members are the remaining members, with the new key wrapped to each of them.
+	Members []*AccessGroupMember
+}
+
+// RotateAccessGroupKey creates a new key pair for an access group after members were removed from it. Applying the
+// rotation takes three transactions, in order:
+//  1. An AccessGroupMembers transaction that removes the members.
+//  2. An AccessGroup update that sets the group's public key to AccessGroupPublicKey.
+//  3. An AccessGroupMembers update that sets the EncryptedKey of the remaining members to the ones in Members.
+func RotateAccessGroupKey(remainingMembers []*AccessGroupMemberAccessKey) (*AccessGroupKeyRotation, error) {
+	accessGroupPrivateKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrapf(err, "RotateAccessGroupKey: Problem generating key")
+	}
+	rotation := &AccessGroupKeyRotation{
+		AccessGroupPrivateKey: accessGroupPrivateKey,
+		AccessGroupPublicKey:  accessGroupPrivateKey.PubKey().SerializeCompressed(),
+	}
+	for _, member := range remainingMembers {
+		accessGroupMember, err := NewAccessGroupMemberWithWrappedKey(accessGroupPrivateKey, member)
+		if err != nil {
+			return nil, errors.Wrapf(err, "RotateAccessGroupKey: ")
+		}
+		rotation.Members = append(rotation.Members, accessGroupMember)
+	}
+	return rotation, nil
+}
@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageEnvelope(t *testing.T) {
+	require := require.New(t)
+
+	recipientPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	recipientPublicKey := recipientPrivateKey.PubKey().SerializeCompressed()
+	otherPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+
+	envelopeBytes, err := EncryptMessageEnvelope(MessageEnvelopeTypeGroupMessage, []byte("hello"), recipientPublicKey)
+	require.NoError(err)
+	envelope, err := DecodeMessageEnvelope(envelopeBytes)
+	require.NoError(err)
+	require.Equal(MessageEnvelopeVersion1, envelope.Version)
+	require.Equal(MessageEnvelopeTypeGroupMessage, envelope.Type)
+	require.Equal(NewPublicKey(recipientPublicKey), envelope.RecipientPublicKey)
+	reencodedBytes, err := envelope.ToBytes()
+	require.NoError(err)
+	require.Equal(envelopeBytes, reencodedBytes)
+
+	plaintext, err := DecryptMessageEnvelope(MessageEnvelopeTypeGroupMessage, envelopeBytes, recipientPrivateKey)
+	require.NoError(err)
+	require.Equal([]byte("hello"), plaintext)
+
+	// The envelope has to be of the expected type, and decrypted with the key it was encrypted to.
+	_, err = DecryptMessageEnvelope(MessageEnvelopeTypeDirectMessage, envelopeBytes, recipientPrivateKey)
+	require.Error(err)
+	_, err = DecryptMessageEnvelope(MessageEnvelopeTypeGroupMessage, envelopeBytes, otherPrivateKey)
+	require.Error(err)
+
+	// Raw ECIES ciphertexts decode as legacy envelopes.
+	legacyCiphertext, err := EncryptBytesWithPublicKey([]byte("legacy"), recipientPrivateKey.PubKey().ToECDSA())
+	require.NoError(err)
+	envelope, err = DecodeMessageEnvelope(legacyCiphertext)
+	require.NoError(err)
+	require.Equal(MessageEnvelopeVersionLegacy, envelope.Version)
+	require.Nil(envelope.RecipientPublicKey)
+	plaintext, err = DecryptMessageEnvelope(MessageEnvelopeTypeGroupMessage, legacyCiphertext, recipientPrivateKey)
+	require.NoError(err)
+	require.Equal([]byte("legacy"), plaintext)
+
+	// Malformed envelopes are rejected.
+	for _, malformedBytes := range [][]byte{
+		{},
+		{byte(MessageEnvelopeVersion1), byte(MessageEnvelopeTypeGroupMessage)},
+		append([]byte{5, byte(MessageEnvelopeTypeGroupMessage)}, envelopeBytes[2:]...),
+		append([]byte{byte(MessageEnvelopeVersion1), 9}, envelopeBytes[2:]...),
+	} {
+		_, err = DecodeMessageEnvelope(malformedBytes)
+		require.Error(err)
+	}
+}
+
+func TestDirectMessageEnvelope(t *testing.T) {
+	require := require.New(t)
+
+	senderPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	recipientPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	senderPublicKey := senderPrivateKey.PubKey().SerializeCompressed()
+	recipientPublicKey := recipientPrivateKey.PubKey().SerializeCompressed()
+
+	// Both parties derive the same shared key.
+	senderSharedKey, err := DeriveMessagingSharedPrivateKey(senderPrivateKey, recipientPublicKey)
+	require.NoError(err)
+	recipientSharedKey, err := DeriveMessagingSharedPrivateKey(recipientPrivateKey, senderPublicKey)
+	require.NoError(err)
+	require.Equal(senderSharedKey.Serialize(), recipientSharedKey.Serialize())
+
+	envelopeBytes, err := EncryptDirectMessage([]byte("gm"), senderPrivateKey, recipientPublicKey)
+	require.NoError(err)
+	plaintext, err := DecryptDirectMessage(envelopeBytes, recipientPrivateKey, senderPublicKey)
+	require.NoError(err)
+	require.Equal([]byte("gm"), plaintext)
+	plaintext, err = DecryptDirectMessage(envelopeBytes, senderPrivateKey, recipientPublicKey)
+	require.NoError(err)
+	require.Equal([]byte("gm"), plaintext)
+
+	// A third party can't read it.
+	otherPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	_, err = DecryptDirectMessage(envelopeBytes, otherPrivateKey, senderPublicKey)
+	require.Error(err)
+}
+
+func TestAccessGroupKeyRotation(t *testing.T) {
+	require := require.New(t)
+
+	var memberPrivateKeys []*btcec.PrivateKey
+	var members []*AccessGroupMemberAccessKey
+	for ii := 0; ii < 3; ii++ {
+		memberPrivateKey, err := btcec.NewPrivateKey()
+		require.NoError(err)
+		memberPrivateKeys = append(memberPrivateKeys, memberPrivateKey)
+		members = append(members, &AccessGroupMemberAccessKey{
+			MemberPublicKey: RandomBytes(int32(PublicKeyLenCompressed)),
+			MemberKeyName:   BaseGroupKeyName().ToBytes(),
+			AccessPublicKey: memberPrivateKey.PubKey().SerializeCompressed(),
+		})
+	}
+
+	// Every member can unwrap the group key and read group messages.
+	oldGroupPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	oldMessage, err := EncryptGroupMessage([]byte("before"), oldGroupPrivateKey.PubKey().SerializeCompressed())
+	require.NoError(err)
+	for ii, member := range members {
+		accessGroupMember, err := NewAccessGroupMemberWithWrappedKey(oldGroupPrivateKey, member)
+		require.NoError(err)
+		require.Equal(member.MemberPublicKey, accessGroupMember.AccessGroupMemberPublicKey)
+		groupPrivateKey, err := UnwrapAccessGroupKey(accessGroupMember.EncryptedKey, memberPrivateKeys[ii])
+		require.NoError(err)
+		plaintext, err := DecryptGroupMessage(oldMessage, groupPrivateKey)
+		require.NoError(err)
+		require.Equal([]byte("before"), plaintext)
+	}
+
+	// After the last member is removed, the new key is only wrapped to the remaining members.
+	rotation, err := RotateAccessGroupKey(members[:2])
+	require.NoError(err)
+	require.Len(rotation.Members, 2)
+	require.NotEqual(oldGroupPrivateKey.Serialize(), rotation.AccessGroupPrivateKey.Serialize())
+	newMessage, err := EncryptGroupMessage([]byte("after"), rotation.AccessGroupPublicKey)
+	require.NoError(err)
+	for ii, accessGroupMember := range rotation.Members {
+		groupPrivateKey, err := UnwrapAccessGroupKey(accessGroupMember.EncryptedKey, memberPrivateKeys[ii])
+		require.NoError(err)
+		plaintext, err := DecryptGroupMessage(newMessage, groupPrivateKey)
+		require.NoError(err)
+		require.Equal([]byte("after"), plaintext)
+	}
+	_, err = DecryptGroupMessage(newMessage, oldGroupPrivateKey)
+	require.Error(err)
+
+	// A wrapped key isn't a group message.
+	_, err = DecryptGroupMessage(rotation.Members[0].EncryptedKey, memberPrivateKeys[0])
+	require.Error(err)
+}
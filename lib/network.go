@@ -108,7 +108,23 @@ const (
 	MsgTypeValidatorVote    MsgType = 20
 	MsgTypeValidatorTimeout MsgType = 21
 
-	// NEXT_TAG = 23
+	// Transaction reconciliation messages. See txn_reconciliation.go.
+	MsgTypeReconcileTxnsRequest MsgType = 23
+	MsgTypeReconcileTxnsSketch  MsgType = 24
+	MsgTypeReconcileTxnsDiff    MsgType = 25
+
+	// MsgTypeValidatorHeartbeat is sent by a validator to its standbys. See pos_validator_standby.go.
+	MsgTypeValidatorHeartbeat MsgType = 26
+
+	// Compact block relay messages. See compact_block.go.
+	MsgTypeCompactBlock MsgType = 27
+	MsgTypeGetBlockTxns MsgType = 28
+	MsgTypeBlockTxns    MsgType = 29
+
+	// MsgTypeFeeTelemetry carries a summary of a peer's mempool fees. See fee_telemetry.go.
+	MsgTypeFeeTelemetry MsgType = 30
+
+	// NEXT_TAG = 31
 
 	// Below are control messages used to signal to the Server from other parts of
 	// the code but not actually sent among peers.
@@ -173,6 +189,22 @@ func (msgType MsgType) String() string {
 		return "VALIDATOR_VOTE"
 	case MsgTypeValidatorTimeout:
 		return "VALIDATOR_TIMEOUT"
+	case MsgTypeReconcileTxnsRequest:
+		return "RECONCILE_TXNS_REQUEST"
+	case MsgTypeReconcileTxnsSketch:
+		return "RECONCILE_TXNS_SKETCH"
+	case MsgTypeReconcileTxnsDiff:
+		return "RECONCILE_TXNS_DIFF"
+	case MsgTypeValidatorHeartbeat:
+		return "VALIDATOR_HEARTBEAT"
+	case MsgTypeCompactBlock:
+		return "COMPACT_BLOCK"
+	case MsgTypeGetBlockTxns:
+		return "GET_BLOCK_TXNS"
+	case MsgTypeBlockTxns:
+		return "BLOCK_TXNS"
+	case MsgTypeFeeTelemetry:
+		return "FEE_TELEMETRY"
 	case MsgTypeMempool:
 		return "MEMPOOL"
 	case MsgTypeAddr:
@@ -275,8 +307,15 @@ const (
 	TxnTypeCoinLockupTransfer           TxnType = 42
 	TxnTypeCoinUnlock                   TxnType = 43
 	TxnTypeAtomicTxnsWrapper            TxnType = 44
-
-	// NEXT_ID = 44
+	TxnTypeSetKeyValueRecords           TxnType = 45
+	TxnTypeNFTBatch                     TxnType = 46
+	TxnTypeBridgeEventAnchor            TxnType = 47
+	TxnTypeDelegatedPoster              TxnType = 48
+	TxnTypeRotateValidatorVotingKey     TxnType = 49
+	TxnTypeAnchorHash                   TxnType = 50
+	TxnTypeSubscription                 TxnType = 51
+
+	// NEXT_ID = 52
 )
 
 type TxnString string
@@ -327,6 +366,13 @@ const (
 	TxnStringCoinLockupTransfer           TxnString = "COIN_LOCKUP_TRANSFER"
 	TxnStringCoinUnlock                   TxnString = "COIN_UNLOCK"
 	TxnStringAtomicTxnsWrapper            TxnString = "ATOMIC_TXNS_WRAPPER"
+	TxnStringSetKeyValueRecords           TxnString = "SET_KEY_VALUE_RECORDS"
+	TxnStringNFTBatch                     TxnString = "NFT_BATCH"
+	TxnStringBridgeEventAnchor            TxnString = "BRIDGE_EVENT_ANCHOR"
+	TxnStringDelegatedPoster              TxnString = "DELEGATED_POSTER"
+	TxnStringRotateValidatorVotingKey     TxnString = "ROTATE_VALIDATOR_VOTING_KEY"
+	TxnStringAnchorHash                   TxnString = "ANCHOR_HASH"
+	TxnStringSubscription                 TxnString = "SUBSCRIPTION"
 )
 
 var (
@@ -341,7 +387,8 @@ var (
 		TxnTypeAccessGroup, TxnTypeAccessGroupMembers, TxnTypeNewMessage, TxnTypeRegisterAsValidator,
 		TxnTypeUnregisterAsValidator, TxnTypeStake, TxnTypeUnstake, TxnTypeUnlockStake, TxnTypeUnjailValidator,
 		TxnTypeCoinLockup, TxnTypeUpdateCoinLockupParams, TxnTypeCoinLockupTransfer, TxnTypeCoinUnlock,
-		TxnTypeAtomicTxnsWrapper,
+		TxnTypeAtomicTxnsWrapper, TxnTypeSetKeyValueRecords, TxnTypeNFTBatch, TxnTypeBridgeEventAnchor,
+		TxnTypeDelegatedPoster, TxnTypeRotateValidatorVotingKey, TxnTypeAnchorHash, TxnTypeSubscription,
 	}
 	AllTxnString = []TxnString{
 		TxnStringUnset, TxnStringBlockReward, TxnStringBasicTransfer, TxnStringBitcoinExchange, TxnStringPrivateMessage,
@@ -354,7 +401,8 @@ var (
 		TxnStringAccessGroup, TxnStringAccessGroupMembers, TxnStringNewMessage, TxnStringRegisterAsValidator,
 		TxnStringUnregisterAsValidator, TxnStringStake, TxnStringUnstake, TxnStringUnlockStake, TxnStringUnjailValidator,
 		TxnStringCoinLockup, TxnStringUpdateCoinLockupParams, TxnStringCoinLockupTransfer, TxnStringCoinUnlock,
-		TxnStringAtomicTxnsWrapper,
+		TxnStringAtomicTxnsWrapper, TxnStringSetKeyValueRecords, TxnStringNFTBatch, TxnStringBridgeEventAnchor,
+		TxnStringDelegatedPoster, TxnStringRotateValidatorVotingKey, TxnStringAnchorHash, TxnStringSubscription,
 	}
 )
 
@@ -456,6 +504,20 @@ func (txnType TxnType) GetTxnString() TxnString {
 		return TxnStringCoinUnlock
 	case TxnTypeAtomicTxnsWrapper:
 		return TxnStringAtomicTxnsWrapper
+	case TxnTypeSetKeyValueRecords:
+		return TxnStringSetKeyValueRecords
+	case TxnTypeNFTBatch:
+		return TxnStringNFTBatch
+	case TxnTypeBridgeEventAnchor:
+		return TxnStringBridgeEventAnchor
+	case TxnTypeDelegatedPoster:
+		return TxnStringDelegatedPoster
+	case TxnTypeRotateValidatorVotingKey:
+		return TxnStringRotateValidatorVotingKey
+	case TxnTypeAnchorHash:
+		return TxnStringAnchorHash
+	case TxnTypeSubscription:
+		return TxnStringSubscription
 	default:
 		return TxnStringUndefined
 	}
@@ -551,6 +613,20 @@ func GetTxnTypeFromString(txnString TxnString) TxnType {
 		return TxnTypeCoinUnlock
 	case TxnStringAtomicTxnsWrapper:
 		return TxnTypeAtomicTxnsWrapper
+	case TxnStringSetKeyValueRecords:
+		return TxnTypeSetKeyValueRecords
+	case TxnStringNFTBatch:
+		return TxnTypeNFTBatch
+	case TxnStringBridgeEventAnchor:
+		return TxnTypeBridgeEventAnchor
+	case TxnStringDelegatedPoster:
+		return TxnTypeDelegatedPoster
+	case TxnStringRotateValidatorVotingKey:
+		return TxnTypeRotateValidatorVotingKey
+	case TxnStringAnchorHash:
+		return TxnTypeAnchorHash
+	case TxnStringSubscription:
+		return TxnTypeSubscription
 	default:
 		// TxnTypeUnset means we couldn't find a matching txn type
 		return TxnTypeUnset
@@ -654,6 +730,20 @@ func NewTxnMetadata(txType TxnType) (DeSoTxnMetadata, error) {
 		return (&CoinUnlockMetadata{}).New(), nil
 	case TxnTypeAtomicTxnsWrapper:
 		return (&AtomicTxnsWrapperMetadata{}).New(), nil
+	case TxnTypeSetKeyValueRecords:
+		return (&SetKeyValueRecordsMetadata{}).New(), nil
+	case TxnTypeNFTBatch:
+		return (&NFTBatchMetadata{}).New(), nil
+	case TxnTypeBridgeEventAnchor:
+		return (&BridgeEventAnchorMetadata{}).New(), nil
+	case TxnTypeDelegatedPoster:
+		return (&DelegatedPosterMetadata{}).New(), nil
+	case TxnTypeRotateValidatorVotingKey:
+		return (&RotateValidatorVotingKeyMetadata{}).New(), nil
+	case TxnTypeAnchorHash:
+		return (&AnchorHashMetadata{}).New(), nil
+	case TxnTypeSubscription:
+		return (&SubscriptionMetadata{}).New(), nil
 	default:
 		return nil, fmt.Errorf("NewTxnMetadata: Unrecognized TxnType: %v; make sure you add the new type of transaction to NewTxnMetadata", txType)
 	}
@@ -817,6 +907,22 @@ func NewMessage(msgType MsgType) DeSoMessage {
 		return &MsgDeSoValidatorVote{}
 	case MsgTypeValidatorTimeout:
 		return &MsgDeSoValidatorTimeout{}
+	case MsgTypeReconcileTxnsRequest:
+		return &MsgDeSoReconcileTxnsRequest{}
+	case MsgTypeReconcileTxnsSketch:
+		return &MsgDeSoReconcileTxnsSketch{}
+	case MsgTypeReconcileTxnsDiff:
+		return &MsgDeSoReconcileTxnsDiff{}
+	case MsgTypeValidatorHeartbeat:
+		return &MsgDeSoValidatorHeartbeat{}
+	case MsgTypeCompactBlock:
+		return &MsgDeSoCompactBlock{}
+	case MsgTypeGetBlockTxns:
+		return &MsgDeSoGetBlockTxns{}
+	case MsgTypeBlockTxns:
+		return &MsgDeSoBlockTxns{}
+	case MsgTypeFeeTelemetry:
+		return &MsgDeSoFeeTelemetry{}
 	case MsgTypeMempool:
 		return &MsgDeSoMempool{}
 	case MsgTypeGetHeaders:
@@ -1667,6 +1773,18 @@ const (
 	SFArchivalNode ServiceFlag = 1 << 2
 	// SFPosValidator is a flag used to indicate that the peer is running a PoS validator.
 	SFPosValidator ServiceFlag = 1 << 3
+	// SFHyperSyncV2 is a flag used to indicate that the peer serves hyper sync snapshots in the v2 format,
+	// where each chunk comes with a Merkle proof against the snapshot state root.
+	SFHyperSyncV2 ServiceFlag = 1 << 4
+	// SFTxnReconciliation is a flag used to indicate that the peer reconciles transactions with sketches rather
+	// than flooding INVs for them. See txn_reconciliation.go.
+	SFTxnReconciliation ServiceFlag = 1 << 5
+	// SFCompactBlocks is a flag used to indicate that the peer announces and accepts new blocks as compact blocks,
+	// which it reconstructs from its mempool. See compact_block.go.
+	SFCompactBlocks ServiceFlag = 1 << 6
+	// SFFeeTelemetry is a flag used to indicate that the peer shares summaries of its mempool fees, which are
+	// aggregated into a network-wide fee estimate. See fee_telemetry.go.
+	SFFeeTelemetry ServiceFlag = 1 << 7
 )
 
 func (sf ServiceFlag) HasService(serviceFlag ServiceFlag) bool {
@@ -3066,11 +3184,22 @@ func AddEncoderMetadataToMsgDeSoBlockBytes(blockBytes []byte, blockHeight uint64
 type MsgDeSoGetSnapshot struct {
 	// SnapshotStartKey is the db key from which we want to start fetching the data.
 	SnapshotStartKey []byte
+
+	// SnapshotFormatVersion is the version of the snapshot format we're requesting. Zero means the
+	// original format, where chunks are fetched by SnapshotStartKey. In SnapshotFormatVersion2,
+	// chunks are fetched by ChunkIndex instead. The v2 fields are appended to the end of the
+	// message, and are only encoded for v2 requests, so that v1 messages are unchanged.
+	SnapshotFormatVersion uint64
+	ChunkIndex            uint64
 }
 
 func (msg *MsgDeSoGetSnapshot) ToBytes(preSignature bool) ([]byte, error) {
 	data := []byte{}
 	data = append(data, EncodeByteArray(msg.SnapshotStartKey)...)
+	if msg.SnapshotFormatVersion >= SnapshotFormatVersion2 {
+		data = append(data, UintToBuf(msg.SnapshotFormatVersion)...)
+		data = append(data, UintToBuf(msg.ChunkIndex)...)
+	}
 
 	return data, nil
 }
@@ -3087,6 +3216,18 @@ func (msg *MsgDeSoGetSnapshot) FromBytes(data []byte) error {
 	if len(msg.SnapshotStartKey) == 0 {
 		return fmt.Errorf("MsgDeSoGetSnapshot.FromBytes: Received an empty SnapshotStartKey")
 	}
+	// Messages from v1 peers end here.
+	if rr.Len() == 0 {
+		return nil
+	}
+	msg.SnapshotFormatVersion, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetSnapshot.FromBytes: Error reading snapshot format version")
+	}
+	msg.ChunkIndex, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetSnapshot.FromBytes: Error reading chunk index")
+	}
 	return nil
 }
 
@@ -3111,6 +3252,13 @@ type MsgDeSoSnapshotData struct {
 
 	// Prefix indicates the db prefix of the current snapshot chunk.
 	Prefix []byte
+
+	// StateRoot, ChunkIndex, and ChunkMerkleProof are set in responses to SnapshotFormatVersion2
+	// requests. ChunkMerkleProof proves that the chunk at ChunkIndex is committed to by StateRoot.
+	// The v2 fields are appended to the end of the message, and are only encoded if StateRoot is set.
+	StateRoot        *SnapshotStateRoot
+	ChunkIndex       uint64
+	ChunkMerkleProof []*BlockHash
 }
 
 func (msg *MsgDeSoSnapshotData) ToBytes(preSignature bool) ([]byte, error) {
@@ -3131,6 +3279,15 @@ func (msg *MsgDeSoSnapshotData) ToBytes(preSignature bool) ([]byte, error) {
 	data = append(data, UintToBuf(uint64(len(msg.Prefix)))...)
 	data = append(data, msg.Prefix...)
 
+	if msg.StateRoot != nil {
+		data = append(data, msg.StateRoot.ToBytes()...)
+		data = append(data, UintToBuf(msg.ChunkIndex)...)
+		data = append(data, UintToBuf(uint64(len(msg.ChunkMerkleProof)))...)
+		for _, proofHash := range msg.ChunkMerkleProof {
+			data = append(data, proofHash.ToBytes()...)
+		}
+	}
+
 	return data, nil
 }
 
@@ -3174,6 +3331,34 @@ func (msg *MsgDeSoSnapshotData) FromBytes(data []byte) error {
 		return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding prefix")
 	}
 
+	// Messages in the v1 snapshot format end here.
+	if rr.Len() == 0 {
+		return nil
+	}
+	msg.StateRoot = &SnapshotStateRoot{}
+	if err = msg.StateRoot.FromBytes(rr); err != nil {
+		return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding state root")
+	}
+	msg.ChunkIndex, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding chunk index")
+	}
+	proofLen, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding length of ChunkMerkleProof")
+	}
+	msg.ChunkMerkleProof, err = SafeMakeSliceWithLengthAndCapacity[*BlockHash](0, proofLen)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem creating slice for ChunkMerkleProof")
+	}
+	for ; proofLen > 0; proofLen-- {
+		proofHash, err := ReadBlockHash(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoSnapshotData.FromBytes: Problem decoding ChunkMerkleProof")
+		}
+		msg.ChunkMerkleProof = append(msg.ChunkMerkleProof, proofHash)
+	}
+
 	return nil
 }
 
@@ -4038,15 +4223,48 @@ func (msg *MsgDeSoTxn) Copy() (*MsgDeSoTxn, error) {
 	return newTxn, nil
 }
 
-func (msg *MsgDeSoTxn) Sign(privKey *btcec.PrivateKey) (*ecdsa2.Signature, error) {
-	// Serialize the transaction without the signature portion.
+// ComputeTxnSignatureDigest returns the bytes that a transaction's signer commits to, i.e. the transaction
+// serialized without its signature, along with their double SHA256 hash, which is the digest that the ECDSA
+// signature is computed over. The digest is the same for every TxnType and transaction version.
+//
+// Transactions signed with a derived key use the same digest, with one caveat for each of the two ways of
+// identifying the derived key:
+//   - If the derived public key is passed in ExtraData under the DerivedPublicKey key, it must be set in
+//     ExtraData before the digest is computed, since ExtraData is part of the signed bytes. The signature must be
+//     encoded in the standard DER format, i.e. with the 0x30 header magic.
+//   - If the signature uses the DeSo-DER encoding instead, nothing is added to the transaction. The signature is
+//     computed over the digest with SignRecoverable, and its header magic carries the public key recovery id.
+//
+// Block rewards, BitcoinExchange transactions, and atomic transaction wrappers aren't signed, so an error is
+// returned for them. The transactions inside an atomic wrapper are each signed on their own.
+func ComputeTxnSignatureDigest(txn *MsgDeSoTxn) (_preSignatureBytes []byte, _digest *BlockHash, _err error) {
+	if txn.TxnMeta == nil {
+		return nil, nil, fmt.Errorf("ComputeTxnSignatureDigest: Transaction is missing TxnMeta")
+	}
+	switch txnType := txn.TxnMeta.GetTxnType(); txnType {
+	case TxnTypeBlockReward, TxnTypeBitcoinExchange, TxnTypeAtomicTxnsWrapper:
+		return nil, nil, fmt.Errorf("ComputeTxnSignatureDigest: %v transactions aren't signed", txnType)
+	}
+	return txn.signatureDigest()
+}
+
+// signatureDigest serializes the transaction without its signature and hashes the result. See the comment on
+// ComputeTxnSignatureDigest.
+func (msg *MsgDeSoTxn) signatureDigest() (_preSignatureBytes []byte, _digest *BlockHash, _err error) {
 	txnBytes, err := msg.ToBytes(true /*preSignature*/)
 	if err != nil {
-		return nil, err
+		return nil, nil, errors.Wrapf(err, "MsgDeSoTxn.signatureDigest: Problem serializing txn without signature: ")
 	}
+	return txnBytes, Sha256DoubleHash(txnBytes), nil
+}
+
+func (msg *MsgDeSoTxn) Sign(privKey *btcec.PrivateKey) (*ecdsa2.Signature, error) {
 	// Compute a hash of the transaction bytes without the signature
 	// portion and sign it with the passed private key.
-	txnSignatureHash := Sha256DoubleHash(txnBytes)
+	_, txnSignatureHash, err := msg.signatureDigest()
+	if err != nil {
+		return nil, err
+	}
 	return ecdsa2.Sign(privKey, txnSignatureHash[:]), nil
 }
 
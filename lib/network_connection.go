@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"github.com/btcsuite/btcd/addrmgr"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/golang/glog"
 	"net"
@@ -20,6 +21,8 @@ type outboundConnection struct {
 	connection   net.Conn
 	isPersistent bool
 	failed       bool
+	// dialLatency is how long it took to establish the connection. It's zero if the connection failed.
+	dialLatency time.Duration
 }
 
 func (oc *outboundConnection) GetConnectionType() ConnectionType {
@@ -81,6 +84,8 @@ type OutboundConnectionAttempt struct {
 	// If isPersistent is true, we will retry connecting to the peer until we are successful. Each time such connection
 	// fails, we will sleep according to exponential backoff. Otherwise, we will only attempt to connect to the peer once.
 	isPersistent bool
+	// dialer is used to dial the peer, possibly through a proxy. If it is nil, the peer is dialed directly.
+	dialer *PeerDialer
 	// dialTimeout is the amount of time we will wait before timing out an individual connection attempt.
 	dialTimeout time.Duration
 	// timeoutUnit is the unit of time we will use to calculate the exponential backoff delay. The initial timeout is
@@ -105,12 +110,13 @@ const (
 )
 
 func NewOutboundConnectionAttempt(attemptId uint64, netAddr *wire.NetAddressV2, isPersistent bool,
-	dialTimeout time.Duration, connectionChan chan *outboundConnection) *OutboundConnectionAttempt {
+	dialer *PeerDialer, dialTimeout time.Duration, connectionChan chan *outboundConnection) *OutboundConnectionAttempt {
 
 	return &OutboundConnectionAttempt{
 		attemptId:      attemptId,
 		netAddr:        netAddr,
 		isPersistent:   isPersistent,
+		dialer:         dialer,
 		dialTimeout:    dialTimeout,
 		timeoutUnit:    time.Second,
 		exitChan:       make(chan bool),
@@ -156,6 +162,7 @@ out:
 				oca.retryCount++
 			}
 
+			dialStart := time.Now()
 			conn := oca.attemptOutboundConnection()
 			if conn == nil && oca.isPersistent {
 				break
@@ -170,6 +177,7 @@ out:
 				connection:   conn,
 				isPersistent: oca.isPersistent,
 				failed:       false,
+				dialLatency:  time.Since(dialStart),
 			}
 			return
 		}
@@ -202,17 +210,12 @@ func (oca *OutboundConnectionAttempt) SetTimeoutUnit(timeoutUnit time.Duration)
 // Otherwise, it will return nil.
 func (oca *OutboundConnectionAttempt) attemptOutboundConnection() net.Conn {
 	// If the peer is not persistent, update the addrmgr.
-	glog.V(1).Infof("Attempting to connect to addr: %v:%v", oca.netAddr.ToLegacy().IP.String(), oca.netAddr.Port)
+	glog.V(1).Infof("Attempting to connect to addr: %v", addrmgr.NetAddressKey(oca.netAddr))
 
-	var err error
-	tcpAddr := net.TCPAddr{
-		IP:   oca.netAddr.ToLegacy().IP,
-		Port: int(oca.netAddr.Port),
-	}
-	conn, err := net.DialTimeout(tcpAddr.Network(), tcpAddr.String(), oca.dialTimeout)
+	conn, err := oca.dialer.Dial(oca.netAddr, oca.dialTimeout)
 	if err != nil {
 		// If we failed to connect to this peer, get a new address and try again.
-		glog.V(2).Infof("Connection to addr (%v) failed: %v", tcpAddr, err)
+		glog.V(2).Infof("Connection to addr (%v) failed: %v", addrmgr.NetAddressKey(oca.netAddr), err)
 		return nil
 	}
 
@@ -128,13 +128,13 @@ func TestOutboundConnectionAttempt(t *testing.T) {
 	sl.start()
 
 	connectionChan := make(chan *outboundConnection, 100)
-	attempt := NewOutboundConnectionAttempt(0, sl.addr, false, timeoutDuration, connectionChan)
+	attempt := NewOutboundConnectionAttempt(0, sl.addr, false, nil, timeoutDuration, connectionChan)
 	attempt.Start()
 	verifyOutboundConnectionSelect(t, connectionChan, 2*timeoutDuration, sl, 0, false, false)
 	t.Log("TestOutboundConnectionAttempt #1 | Happy path, non-persistent | PASS")
 
 	sl.stop()
-	attemptFailed := NewOutboundConnectionAttempt(1, sl.addr, false, timeoutDuration, connectionChan)
+	attemptFailed := NewOutboundConnectionAttempt(1, sl.addr, false, nil, timeoutDuration, connectionChan)
 	attemptFailed.Start()
 	verifyOutboundConnectionSelect(t, connectionChan, 2*timeoutDuration, sl, 1, false, true)
 	t.Log("TestOutboundConnectionAttempt #2 | Failed connection, non-persistent | PASS")
@@ -142,13 +142,13 @@ func TestOutboundConnectionAttempt(t *testing.T) {
 	sl2 := newSimpleListener(t)
 	sl2.start()
 
-	attemptPersistent := NewOutboundConnectionAttempt(2, sl2.addr, true, timeoutDuration, connectionChan)
+	attemptPersistent := NewOutboundConnectionAttempt(2, sl2.addr, true, nil, timeoutDuration, connectionChan)
 	attemptPersistent.Start()
 	verifyOutboundConnectionSelect(t, connectionChan, 2*timeoutDuration, sl2, 2, true, false)
 	t.Log("TestOutboundConnectionAttempt #3 | Happy path, persistent | PASS")
 
 	sl2.stop()
-	attemptPersistentDelay := NewOutboundConnectionAttempt(3, sl2.addr, true, timeoutDuration, connectionChan)
+	attemptPersistentDelay := NewOutboundConnectionAttempt(3, sl2.addr, true, nil, timeoutDuration, connectionChan)
 	attemptPersistentDelay.SetTimeoutUnit(timeoutDuration)
 	attemptPersistentDelay.Start()
 	time.Sleep(timeoutDuration)
@@ -158,7 +158,7 @@ func TestOutboundConnectionAttempt(t *testing.T) {
 	t.Log("TestOutboundConnectionAttempt #4 | Failed connection, persistent, delayed | PASS")
 
 	sl2.stop()
-	attemptPersistentCancel := NewOutboundConnectionAttempt(4, sl2.addr, true, timeoutDuration, connectionChan)
+	attemptPersistentCancel := NewOutboundConnectionAttempt(4, sl2.addr, true, nil, timeoutDuration, connectionChan)
 	attemptPersistentCancel.Start()
 	time.Sleep(timeoutDuration)
 	attemptPersistentCancel.Stop()
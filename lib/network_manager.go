@@ -15,7 +15,6 @@ import (
 	"github.com/deso-protocol/core/bls"
 	"github.com/deso-protocol/core/collections"
 	"github.com/deso-protocol/core/consensus"
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -50,6 +49,9 @@ type NetworkManager struct {
 	cmgr     *ConnectionManager
 	keystore *BLSKeystore
 
+	// logger is scoped to the netmgr component.
+	logger Logger
+
 	// configs
 	minTxFeeRateNanosPerKB uint64
 	nodeServices           ServiceFlag
@@ -75,6 +77,14 @@ type NetworkManager struct {
 	// we need to connect to a new outbound peer, it chooses one of the addresses
 	// it's aware of at random and provides it to us.
 	AddrMgr *addrmgr.AddrManager
+	// addrQuality keeps the connection history of the addresses we dial, and is used to bias the addresses we
+	// pick from the AddrMgr toward the ones we've had good connections to. It can be nil, in which case we
+	// dial the addresses the AddrMgr gives us as is.
+	addrQuality *AddrQualityTracker
+	// accessList holds the peers the node operator has banned or allowed. It's checked before we accept an
+	// inbound connection, before we dial an outbound one, and once a validator's public key is known after the
+	// handshake. It can be nil, in which case every peer is allowed.
+	accessList *PeerAccessList
 
 	// When --connect-ips is set, we don't connect to anything from the addrmgr.
 	connectIps []string
@@ -113,6 +123,8 @@ func NewNetworkManager(
 	cmgr *ConnectionManager,
 	blsKeystore *BLSKeystore,
 	addrMgr *addrmgr.AddrManager,
+	addrQuality *AddrQualityTracker,
+	accessList *PeerAccessList,
 	connectIps []string,
 	targetNonValidatorOutboundRemoteNodes uint32,
 	targetNonValidatorInboundRemoteNodes uint32,
@@ -120,6 +132,7 @@ func NewNetworkManager(
 	peerConnectionRefreshIntervalMillis uint64,
 	minTxFeeRateNanosPerKB uint64,
 	nodeServices ServiceFlag,
+	logger Logger,
 ) *NetworkManager {
 
 	return &NetworkManager{
@@ -129,8 +142,11 @@ func NewNetworkManager(
 		cmgr:                                  cmgr,
 		keystore:                              blsKeystore,
 		AddrMgr:                               addrMgr,
+		addrQuality:                           addrQuality,
+		accessList:                            accessList,
 		minTxFeeRateNanosPerKB:                minTxFeeRateNanosPerKB,
 		nodeServices:                          nodeServices,
+		logger:                                logger,
 		AllRemoteNodes:                        collections.NewConcurrentMap[RemoteNodeId, *RemoteNode](),
 		ValidatorInboundIndex:                 collections.NewConcurrentMap[bls.SerializedPublicKey, *RemoteNode](),
 		ValidatorOutboundIndex:                collections.NewConcurrentMap[bls.SerializedPublicKey, *RemoteNode](),
@@ -154,6 +170,10 @@ func (nm *NetworkManager) Start() {
 		return
 	}
 
+	// Make sure the addresses we've connected to successfully before are known to the AddrMgr, so that
+	// we can find good peers quickly after a restart.
+	nm.addGoodAddressesToAddrMgr()
+
 	// Start the NetworkManager goroutines. The startGroup is used to ensure that all goroutines have started before
 	// exiting the context of this function.
 	nm.startGroup.Add(3)
@@ -171,6 +191,30 @@ func (nm *NetworkManager) Stop() {
 		nm.exitGroup.Wait()
 	}
 	nm.DisconnectAll()
+	if nm.addrQuality != nil {
+		if err := nm.addrQuality.Save(); err != nil {
+			nm.logger.Errorf("NetworkManager.Stop: Problem saving address quality history: %v", err)
+		}
+	}
+}
+
+// addGoodAddressesToAddrMgr adds the highest scoring addresses from the address quality history to the AddrMgr.
+func (nm *NetworkManager) addGoodAddressesToAddrMgr() {
+	if nm.addrQuality == nil || nm.AddrMgr == nil {
+		return
+	}
+	var netAddrs []*wire.NetAddressV2
+	for _, addrKey := range nm.addrQuality.GetGoodAddresses(int(nm.targetNonValidatorOutboundRemoteNodes) * 4) {
+		netAddr, err := nm.ConvertIPStringToNetAddress(addrKey)
+		if err != nil {
+			nm.logger.V(2).Infof("NetworkManager.addGoodAddressesToAddrMgr: Problem parsing addr %v: %v", addrKey, err)
+			continue
+		}
+		netAddrs = append(netAddrs, netAddr)
+	}
+	if len(netAddrs) != 0 {
+		nm.AddrMgr.AddAddresses(netAddrs, netAddrs[0])
+	}
 }
 
 // ###########################
@@ -212,6 +256,12 @@ func (nm *NetworkManager) startNonValidatorConnector() {
 			nm.refreshNonValidatorOutboundIndex()
 			nm.refreshNonValidatorInboundIndex()
 			nm.connectNonValidators()
+			if nm.addrQuality != nil {
+				if err := nm.addrQuality.MaybeSave(); err != nil {
+					nm.logger.Errorf("NetworkManager.startNonValidatorConnector: Problem saving address "+
+						"quality history: %v", err)
+				}
+			}
 		}
 	}
 }
@@ -228,6 +278,12 @@ func (nm *NetworkManager) startRemoteNodeCleanup() {
 			return
 		case <-time.After(nm.peerConnectionRefreshInterval):
 			nm.Cleanup()
+			if nm.accessList != nil {
+				if err := nm.accessList.PruneExpired(); err != nil {
+					nm.logger.Errorf("NetworkManager.startRemoteNodeCleanup: Problem pruning expired peer "+
+						"access list entries: %v", err)
+				}
+			}
 		}
 	}
 
@@ -252,7 +308,7 @@ func (nm *NetworkManager) _handleVersionMessage(origin *Peer, desoMsg DeSoMessag
 	var verMsg *MsgDeSoVersion
 	var ok bool
 	if verMsg, ok = desoMsg.(*MsgDeSoVersion); !ok {
-		glog.Errorf("NetworkManager.handleVersionMessage: Disconnecting RemoteNode with id: (%v) "+
+		nm.logger.Errorf("NetworkManager.handleVersionMessage: Disconnecting RemoteNode with id: (%v) "+
 			"error casting version message", origin.ID)
 		nm.Disconnect(rn, "error casting version message")
 		return
@@ -262,7 +318,7 @@ func (nm *NetworkManager) _handleVersionMessage(origin *Peer, desoMsg DeSoMessag
 	msgNonce := verMsg.Nonce
 	if nm.usedNonces.Contains(msgNonce) {
 		nm.usedNonces.Delete(msgNonce)
-		glog.Errorf("NetworkManager.handleVersionMessage: Disconnecting RemoteNode with id: (%v) "+
+		nm.logger.Errorf("NetworkManager.handleVersionMessage: Disconnecting RemoteNode with id: (%v) "+
 			"nonce collision, nonce (%v)", origin.ID, msgNonce)
 		nm.Disconnect(rn, "nonce collision")
 		return
@@ -271,7 +327,7 @@ func (nm *NetworkManager) _handleVersionMessage(origin *Peer, desoMsg DeSoMessag
 	// Call HandleVersionMessage on the RemoteNode.
 	responseNonce := uint64(RandInt64(math.MaxInt64))
 	if err := rn.HandleVersionMessage(verMsg, responseNonce); err != nil {
-		glog.Errorf("NetworkManager.handleVersionMessage: Requesting PeerDisconnect for id: (%v) "+
+		nm.logger.Errorf("NetworkManager.handleVersionMessage: Requesting PeerDisconnect for id: (%v) "+
 			"error handling version message: %v", origin.ID, err)
 		nm.Disconnect(rn, fmt.Sprintf("error handling version message: %v", err))
 		return
@@ -295,7 +351,7 @@ func (nm *NetworkManager) _handleVerackMessage(origin *Peer, desoMsg DeSoMessage
 	var vrkMsg *MsgDeSoVerack
 	var ok bool
 	if vrkMsg, ok = desoMsg.(*MsgDeSoVerack); !ok {
-		glog.Errorf("NetworkManager.handleVerackMessage: Disconnecting RemoteNode with id: (%v) "+
+		nm.logger.Errorf("NetworkManager.handleVerackMessage: Disconnecting RemoteNode with id: (%v) "+
 			"error casting verack message", origin.ID)
 		nm.Disconnect(rn, "error casting verack message")
 		return
@@ -303,7 +359,7 @@ func (nm *NetworkManager) _handleVerackMessage(origin *Peer, desoMsg DeSoMessage
 
 	// Call HandleVerackMessage on the RemoteNode.
 	if err := rn.HandleVerackMessage(vrkMsg); err != nil {
-		glog.Errorf("NetworkManager.handleVerackMessage: Requesting PeerDisconnect for id: (%v) "+
+		nm.logger.Errorf("NetworkManager.handleVerackMessage: Requesting PeerDisconnect for id: (%v) "+
 			"error handling verack message: %v", origin.ID, err)
 		nm.Disconnect(rn, fmt.Sprintf("error handling verack message: %v", err))
 		return
@@ -319,7 +375,7 @@ func (nm *NetworkManager) _handleDisconnectedPeerMessage(origin *Peer, desoMsg D
 		return
 	}
 
-	glog.V(2).Infof("NetworkManager._handleDisconnectedPeerMessage: Handling disconnected peer message for "+
+	nm.logger.V(2).Infof("NetworkManager._handleDisconnectedPeerMessage: Handling disconnected peer message for "+
 		"id=%v", origin.ID)
 	nm.DisconnectById(NewRemoteNodeId(origin.ID), "peer disconnected")
 }
@@ -343,14 +399,14 @@ func (nm *NetworkManager) _handleNewConnectionMessage(origin *Peer, desoMsg DeSo
 	case ConnectionTypeInbound:
 		remoteNode, err = nm.processInboundConnection(msg.Connection)
 		if err != nil {
-			glog.Errorf("NetworkManager.handleNewConnectionMessage: Problem handling inbound connection: %v", err)
+			nm.logger.Errorf("NetworkManager.handleNewConnectionMessage: Problem handling inbound connection: %v", err)
 			nm.cleanupFailedInboundConnection(remoteNode, msg.Connection)
 			return
 		}
 	case ConnectionTypeOutbound:
 		remoteNode, err = nm.processOutboundConnection(msg.Connection)
 		if err != nil {
-			glog.Errorf("NetworkManager.handleNewConnectionMessage: Problem handling outbound connection: %v", err)
+			nm.logger.Errorf("NetworkManager.handleNewConnectionMessage: Problem handling outbound connection: %v", err)
 			nm.cleanupFailedOutboundConnection(msg.Connection)
 			return
 		}
@@ -370,6 +426,12 @@ func (nm *NetworkManager) processInboundConnection(conn Connection) (*RemoteNode
 		return nil, fmt.Errorf("NetworkManager.handleInboundConnection: Connection is not an inboundConnection")
 	}
 
+	// Reject the connection if the node operator has banned the address, or hasn't allowed it.
+	if err := nm.checkAddrAccess(ic.connection.RemoteAddr().String()); err != nil {
+		return nil, errors.Wrapf(err, "NetworkManager.handleInboundConnection: Rejecting INBOUND peer (%s)",
+			ic.connection.RemoteAddr().String())
+	}
+
 	// If we want to limit inbound connections to one per IP address, check to make sure this address isn't already connected.
 	if nm.limitOneInboundRemoteNodePerIP &&
 		nm.isDuplicateInboundIPAddress(ic.connection.RemoteAddr()) {
@@ -405,6 +467,9 @@ func (nm *NetworkManager) processOutboundConnection(conn Connection) (*RemoteNod
 	}
 
 	if oc.failed {
+		if !oc.isPersistent && nm.addrQuality != nil {
+			nm.addrQuality.RecordFailure(oc.address)
+		}
 		return nil, fmt.Errorf("NetworkManager.handleOutboundConnection: Failed to connect to peer (%s:%v)",
 			oc.address.Addr.String(), oc.address.Port)
 	}
@@ -412,6 +477,9 @@ func (nm *NetworkManager) processOutboundConnection(conn Connection) (*RemoteNod
 	if !oc.isPersistent {
 		nm.AddrMgr.Connected(oc.address)
 		nm.AddrMgr.Good(oc.address)
+		if nm.addrQuality != nil {
+			nm.addrQuality.RecordSuccess(oc.address, oc.dialLatency)
+		}
 	}
 
 	na, err := nm.ConvertIPStringToNetAddress(oc.connection.RemoteAddr().String())
@@ -450,7 +518,7 @@ func (nm *NetworkManager) processOutboundConnection(conn Connection) (*RemoteNod
 // cleaning up the RemoteNode and the connection. Most of the time, the RemoteNode will be nil, but if the RemoteNode
 // was successfully created, we will disconnect it.
 func (nm *NetworkManager) cleanupFailedInboundConnection(remoteNode *RemoteNode, connection Connection) {
-	glog.V(2).Infof("NetworkManager.cleanupFailedInboundConnection: Cleaning up failed inbound connection")
+	nm.logger.V(2).Infof("NetworkManager.cleanupFailedInboundConnection: Cleaning up failed inbound connection")
 	if remoteNode != nil {
 		nm.Disconnect(remoteNode, "cleaning up failed inbound connection")
 	}
@@ -464,7 +532,7 @@ func (nm *NetworkManager) cleanupFailedOutboundConnection(connection Connection)
 	if !ok {
 		return
 	}
-	glog.V(2).Infof("NetworkManager.cleanupFailedOutboundConnection: Cleaning up failed outbound connection")
+	nm.logger.V(2).Infof("NetworkManager.cleanupFailedOutboundConnection: Cleaning up failed outbound connection")
 
 	// Find the RemoteNode associated with the connection. It should almost always exist, since we create the RemoteNode
 	// as we're attempting to connect to the address.
@@ -543,14 +611,14 @@ func (nm *NetworkManager) refreshValidatorIndices() {
 		// set, we check that the non-validator's public key is not already present in the validator indices.
 		if rn.IsOutbound() {
 			if _, ok := nm.GetValidatorOutboundIndex().Get(pk.Serialize()); ok {
-				glog.V(2).Infof("NetworkManager.refreshValidatorIndices: Disconnecting Validator RemoteNode "+
+				nm.logger.V(2).Infof("NetworkManager.refreshValidatorIndices: Disconnecting Validator RemoteNode "+
 					"(%v) has validator public key (%v) that is already present in validator index", rn, pk)
 				nm.Disconnect(rn, "outbound - validator public key already present in validator index")
 				continue
 			}
 		} else {
 			if _, ok := nm.GetValidatorInboundIndex().Get(pk.Serialize()); ok {
-				glog.V(2).Infof("NetworkManager.refreshValidatorIndices: Disconnecting Validator RemoteNode "+
+				nm.logger.V(2).Infof("NetworkManager.refreshValidatorIndices: Disconnecting Validator RemoteNode "+
 					"(%v) has validator public key (%v) that is already present in validator index", rn, pk)
 				nm.Disconnect(rn, "inbound - validator public key already present in validator index")
 				continue
@@ -603,20 +671,20 @@ func (nm *NetworkManager) connectValidators() {
 		// Choose a random domain from the validator's domain list.
 		randDomain, err := collections.RandomElement(validator.GetDomains())
 		if err != nil {
-			glog.V(2).Infof("NetworkManager.connectValidators: Problem getting random domain for "+
+			nm.logger.V(2).Infof("NetworkManager.connectValidators: Problem getting random domain for "+
 				"validator (pk= %v): (error= %v)", validator.GetPublicKey().Serialize(), err)
 			continue
 		}
 
 		// Log the connection attempt
-		glog.V(2).Infof(
+		nm.logger.V(2).Infof(
 			"NetworkManager.connectValidators: Connecting to validator (pk= %v) (domain=%v)",
 			validator.GetPublicKey().Serialize(),
 			string(randDomain),
 		)
 
 		if err := nm.CreateValidatorConnection(string(randDomain), publicKey); err != nil {
-			glog.V(2).Infof("NetworkManager.connectValidators: Problem connecting to validator %v: %v",
+			nm.logger.V(2).Infof("NetworkManager.connectValidators: Problem connecting to validator %v: %v",
 				string(randDomain), err)
 			continue
 		}
@@ -669,7 +737,7 @@ func (nm *NetworkManager) refreshNonValidatorOutboundIndex() {
 		if excessiveOutboundRemoteNodes == 0 {
 			break
 		}
-		glog.V(2).Infof("NetworkManager.refreshNonValidatorOutboundIndex: Disconnecting attempted remote "+
+		nm.logger.V(2).Infof("NetworkManager.refreshNonValidatorOutboundIndex: Disconnecting attempted remote "+
 			"node (id=%v) due to excess outbound RemoteNodes", rn.GetId())
 		nm.Disconnect(rn, "excess attempted outbound RemoteNodes")
 		excessiveOutboundRemoteNodes--
@@ -679,7 +747,7 @@ func (nm *NetworkManager) refreshNonValidatorOutboundIndex() {
 		if excessiveOutboundRemoteNodes == 0 {
 			break
 		}
-		glog.V(2).Infof("NetworkManager.refreshNonValidatorOutboundIndex: Disconnecting connected remote "+
+		nm.logger.V(2).Infof("NetworkManager.refreshNonValidatorOutboundIndex: Disconnecting connected remote "+
 			"node (id=%v) due to excess outbound RemoteNodes", rn.GetId())
 		nm.Disconnect(rn, "excess connected outbound RemoteNodes")
 		excessiveOutboundRemoteNodes--
@@ -719,7 +787,7 @@ func (nm *NetworkManager) refreshNonValidatorInboundIndex() {
 		if excessiveInboundRemoteNodes == 0 {
 			break
 		}
-		glog.V(2).Infof("NetworkManager.refreshNonValidatorInboundIndex: Disconnecting inbound remote "+
+		nm.logger.V(2).Infof("NetworkManager.refreshNonValidatorInboundIndex: Disconnecting inbound remote "+
 			"node (id=%v) due to excess inbound RemoteNodes", rn.GetId())
 		nm.Disconnect(rn, "excess inbound RemoteNodes")
 		excessiveInboundRemoteNodes--
@@ -736,10 +804,10 @@ func (nm *NetworkManager) connectNonValidators() {
 			continue
 		}
 
-		glog.Infof("NetworkManager.initiatePersistentConnections: Connecting to connectIp: %v", connectIp)
+		nm.logger.Infof("NetworkManager.initiatePersistentConnections: Connecting to connectIp: %v", connectIp)
 		id, err := nm.CreateNonValidatorPersistentOutboundConnection(connectIp)
 		if err != nil {
-			glog.Errorf("NetworkManager.initiatePersistentConnections: Problem connecting "+
+			nm.logger.Errorf("NetworkManager.initiatePersistentConnections: Problem connecting "+
 				"to connectIp %v: %v", connectIp, err)
 			continue
 		}
@@ -784,20 +852,33 @@ func (nm *NetworkManager) connectNonValidators() {
 		// Attempt to connect to the address.
 		nm.AddrMgr.Attempt(addr)
 		if err := nm.createNonValidatorOutboundConnection(addr); err != nil {
-			glog.V(2).Infof("NetworkManager.connectNonValidators: Problem creating non-validator outbound "+
+			nm.logger.V(2).Infof("NetworkManager.connectNonValidators: Problem creating non-validator outbound "+
 				"connection to addr: %v; err: %v", addr, err)
 		}
 	}
 }
 
-// getRandomUnconnectedAddress returns a random address from the address manager that we are not already connected to.
+// getRandomUnconnectedAddress returns an address from the address manager that we are not already connected to. If
+// we have an address quality history, we sample a few random candidates and return the highest scoring one.
+// Otherwise, we return the first random candidate.
 func (nm *NetworkManager) getRandomUnconnectedAddress() *wire.NetAddressV2 {
-	for tries := 0; tries < 100; tries++ {
+	numCandidates := 1
+	if nm.addrQuality != nil {
+		numCandidates = addrQualityNumCandidates
+	}
+	var candidates []*wire.NetAddressV2
+	seenCandidates := make(map[string]bool)
+	for tries := 0; tries < 100 && len(candidates) < numCandidates; tries++ {
 		addr := nm.AddrMgr.GetAddress()
 		if addr == nil {
 			break
 		}
 
+		// Skip addresses that we can't dial, such as .onion addresses when no proxy is configured.
+		if !nm.cmgr.IsReachableIpAddress(addr.NetAddress()) {
+			continue
+		}
+
 		if nm.cmgr.IsConnectedOutboundIpAddress(addr.NetAddress()) {
 			continue
 		}
@@ -806,16 +887,31 @@ func (nm *NetworkManager) getRandomUnconnectedAddress() *wire.NetAddressV2 {
 			continue
 		}
 
+		if nm.checkNetAddrAccess(addr.NetAddress()) != nil {
+			continue
+		}
+
 		// We can only have one outbound address per /16. This is similar to
 		// Bitcoin and we do it to prevent Sybil attacks.
 		if nm.cmgr.IsFromRedundantOutboundIPAddress(addr.NetAddress()) {
 			continue
 		}
 
-		return addr.NetAddress()
+		addrKey := addrmgr.NetAddressKey(addr.NetAddress())
+		if seenCandidates[addrKey] {
+			continue
+		}
+		seenCandidates[addrKey] = true
+		candidates = append(candidates, addr.NetAddress())
 	}
 
-	return nil
+	if len(candidates) == 0 {
+		return nil
+	}
+	if nm.addrQuality == nil {
+		return candidates[0]
+	}
+	return nm.addrQuality.SelectBest(candidates)
 }
 
 // ###########################
@@ -830,6 +926,14 @@ func (nm *NetworkManager) CreateValidatorConnection(ipStr string, publicKey *bls
 	if netAddr == nil || publicKey == nil {
 		return fmt.Errorf("NetworkManager.CreateValidatorConnection: netAddr or public key is nil")
 	}
+	if err = nm.checkNetAddrAccess(netAddr); err != nil {
+		return errors.Wrapf(err, "NetworkManager.CreateValidatorConnection: ")
+	}
+	if nm.accessList != nil {
+		if err = nm.accessList.CheckPublicKey(publicKey); err != nil {
+			return errors.Wrapf(err, "NetworkManager.CreateValidatorConnection: ")
+		}
+	}
 
 	// Check if we've already dialed an outbound connection to this validator.
 	if _, ok := nm.GetValidatorOutboundIndex().Get(publicKey.Serialize()); ok {
@@ -855,6 +959,9 @@ func (nm *NetworkManager) CreateNonValidatorPersistentOutboundConnection(ipStr s
 	if netAddr == nil {
 		return 0, fmt.Errorf("NetworkManager.CreateNonValidatorPersistentOutboundConnection: netAddr is nil")
 	}
+	if err = nm.checkNetAddrAccess(netAddr); err != nil {
+		return 0, errors.Wrapf(err, "NetworkManager.CreateNonValidatorPersistentOutboundConnection: ")
+	}
 
 	remoteNode := nm.newRemoteNode(nil, true, true)
 	if err := remoteNode.DialPersistentOutboundConnection(netAddr); err != nil {
@@ -878,6 +985,9 @@ func (nm *NetworkManager) createNonValidatorOutboundConnection(netAddr *wire.Net
 	if netAddr == nil {
 		return fmt.Errorf("NetworkManager.CreateNonValidatorOutboundConnection: netAddr is nil")
 	}
+	if err := nm.checkNetAddrAccess(netAddr); err != nil {
+		return errors.Wrapf(err, "NetworkManager.CreateNonValidatorOutboundConnection: ")
+	}
 
 	remoteNode := nm.newRemoteNode(nil, true, false)
 	if err := remoteNode.DialOutboundConnection(netAddr); err != nil {
@@ -929,7 +1039,7 @@ func (nm *NetworkManager) AttachOutboundConnection(
 func (nm *NetworkManager) DisconnectAll() {
 	allRemoteNodes := nm.GetAllRemoteNodes().GetAll()
 	for _, rn := range allRemoteNodes {
-		glog.V(2).Infof("NetworkManager.DisconnectAll: Disconnecting from remote node (id=%v)", rn.GetId())
+		nm.logger.V(2).Infof("NetworkManager.DisconnectAll: Disconnecting from remote node (id=%v)", rn.GetId())
 		nm.Disconnect(rn, "disconnecting all remote nodes")
 	}
 }
@@ -950,6 +1060,7 @@ func (nm *NetworkManager) newRemoteNode(validatorPublicKey *bls.PublicKey, isOut
 		nm.minTxFeeRateNanosPerKB,
 		latestBlockHeight,
 		nm.nodeServices,
+		nm.logger.With(LogFieldPeerID(id)),
 	)
 }
 
@@ -976,7 +1087,7 @@ func (nm *NetworkManager) Disconnect(rn *RemoteNode, disconnectReason string) {
 	if rn == nil {
 		return
 	}
-	glog.V(2).Infof("NetworkManager.Disconnect: Disconnecting from remote "+
+	nm.logger.V(2).Infof("NetworkManager.Disconnect: Disconnecting from remote "+
 		"node id=%v for reason %v", rn.GetId(), disconnectReason)
 	rn.Disconnect(disconnectReason)
 	nm.removeRemoteNodeFromIndexer(rn)
@@ -1051,7 +1162,7 @@ func (nm *NetworkManager) Cleanup() {
 	allRemoteNodes := nm.GetAllRemoteNodes().GetAll()
 	for _, rn := range allRemoteNodes {
 		if rn.IsTimedOut() {
-			glog.V(2).Infof("NetworkManager.Cleanup: Disconnecting from remote node (id=%v)", rn.GetId())
+			nm.logger.V(2).Infof("NetworkManager.Cleanup: Disconnecting from remote node (id=%v)", rn.GetId())
 			nm.Disconnect(rn, "cleanup")
 		}
 	}
@@ -1245,7 +1356,7 @@ func (nm *NetworkManager) GetAllNonValidators() []*RemoteNode {
 func (nm *NetworkManager) InitiateHandshake(rn *RemoteNode) {
 	nonce := uint64(RandInt64(math.MaxInt64))
 	if err := rn.InitiateHandshake(nonce); err != nil {
-		glog.Errorf("NetworkManager.InitiateHandshake: Error initiating handshake: %v", err)
+		nm.logger.Errorf("NetworkManager.InitiateHandshake: Error initiating handshake: %v", err)
 		nm.Disconnect(rn, fmt.Sprintf("error initiating handshake: %v", err))
 	}
 	nm.usedNonces.Put(nonce)
@@ -1262,13 +1373,23 @@ func (nm *NetworkManager) handleHandshakeComplete(remoteNode *RemoteNode) {
 		return
 	}
 
+	// Now that we know the remote node's validator public key, make sure the node operator hasn't banned it.
+	if nm.accessList != nil {
+		if err := nm.accessList.CheckPublicKey(remoteNode.GetValidatorPublicKey()); err != nil {
+			nm.logger.V(1).Infof("NetworkManager.handleHandshakeComplete: Rejecting remote node (id=%v): %v",
+				remoteNode.GetId(), err)
+			nm.Disconnect(remoteNode, "public key rejected by peer access list")
+			return
+		}
+	}
+
 	if remoteNode.GetNegotiatedProtocolVersion().Before(ProtocolVersion2) {
 		nm.ProcessCompletedHandshake(remoteNode)
 		return
 	}
 
 	if err := nm.handleHandshakeCompletePoSMessage(remoteNode); err != nil {
-		glog.Errorf("NetworkManager.handleHandshakeComplete: Error handling PoS handshake peer message: %v, "+
+		nm.logger.Errorf("NetworkManager.handleHandshakeComplete: Error handling PoS handshake peer message: %v, "+
 			"remoteNodePk (%s)", err, remoteNode.GetValidatorPublicKey().Serialize())
 		nm.Disconnect(remoteNode, fmt.Sprintf("error handling PoS handshake peer message: %v", err))
 		return
@@ -1302,7 +1423,7 @@ func (nm *NetworkManager) handleHandshakeCompletePoSMessage(remoteNode *RemoteNo
 	existingValidator, ok := nm.GetValidatorOutboundIndex().Get(validatorPk.Serialize())
 	if ok && remoteNode.GetId() != existingValidator.GetId() {
 		if remoteNode.IsPersistent() && !existingValidator.IsPersistent() {
-			glog.Errorf("NetworkManager.handleHandshakeCompletePoSMessage: Outbound RemoteNode with duplicate validator public key. "+
+			nm.logger.Errorf("NetworkManager.handleHandshakeCompletePoSMessage: Outbound RemoteNode with duplicate validator public key. "+
 				"Existing validator id: %v, new validator id: %v, ip old: %v, ip new: %v",
 				existingValidator.GetId().ToUint64(), remoteNode.GetId().ToUint64(),
 				existingValidator.GetNetAddress(), remoteNode.GetNetAddress())
@@ -1315,6 +1436,91 @@ func (nm *NetworkManager) handleHandshakeCompletePoSMessage(remoteNode *RemoteNo
 	return nil
 }
 
+// ###########################
+// ## Peer Access List
+// ###########################
+
+// AddPeerAccessEntry adds a ban or allow entry to the peer access list, and disconnects the remote nodes that
+// the list no longer allows.
+func (nm *NetworkManager) AddPeerAccessEntry(entry *PeerAccessEntry) error {
+	if nm.accessList == nil {
+		return fmt.Errorf("NetworkManager.AddPeerAccessEntry: Peer access list is not initialized")
+	}
+	if err := nm.accessList.AddEntry(entry); err != nil {
+		return errors.Wrapf(err, "NetworkManager.AddPeerAccessEntry: ")
+	}
+	nm.disconnectRejectedRemoteNodes()
+	return nil
+}
+
+// RemovePeerAccessEntry removes the entry with the given list type and target from the peer access list. It
+// returns false if there was no such entry. Removing an allow entry can leave a remote node off of a non-empty
+// allowlist, so we disconnect the remote nodes the list no longer allows here too.
+func (nm *NetworkManager) RemovePeerAccessEntry(listType PeerAccessListType, target string) (bool, error) {
+	if nm.accessList == nil {
+		return false, fmt.Errorf("NetworkManager.RemovePeerAccessEntry: Peer access list is not initialized")
+	}
+	removed, err := nm.accessList.RemoveEntry(listType, target)
+	if err != nil {
+		return false, errors.Wrapf(err, "NetworkManager.RemovePeerAccessEntry: ")
+	}
+	if removed {
+		nm.disconnectRejectedRemoteNodes()
+	}
+	return removed, nil
+}
+
+// GetPeerAccessEntries returns the entries of the peer access list that haven't expired.
+func (nm *NetworkManager) GetPeerAccessEntries() []*PeerAccessEntry {
+	if nm.accessList == nil {
+		return nil
+	}
+	return nm.accessList.GetEntries()
+}
+
+// disconnectRejectedRemoteNodes disconnects the remote nodes whose address or validator public key isn't allowed
+// by the peer access list.
+func (nm *NetworkManager) disconnectRejectedRemoteNodes() {
+	for _, rn := range nm.GetAllRemoteNodes().GetAll() {
+		err := nm.checkNetAddrAccess(rn.GetNetAddress())
+		if err == nil {
+			err = nm.accessList.CheckPublicKey(rn.GetValidatorPublicKey())
+		}
+		if err != nil {
+			nm.logger.V(1).Infof("NetworkManager.disconnectRejectedRemoteNodes: Disconnecting remote node (id=%v): %v",
+				rn.GetId(), err)
+			nm.Disconnect(rn, "rejected by peer access list")
+		}
+	}
+}
+
+// checkAddrAccess returns an error if the peer access list doesn't allow connections with addrStr, which is an
+// address in host:port form, such as the one returned by net.Conn.RemoteAddr.
+func (nm *NetworkManager) checkAddrAccess(addrStr string) error {
+	if nm.accessList == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addrStr)
+	if err != nil {
+		host = addrStr
+	}
+	return nm.accessList.CheckIP(net.ParseIP(host))
+}
+
+// checkNetAddrAccess returns an error if the peer access list doesn't allow connections with netAddr.
+func (nm *NetworkManager) checkNetAddrAccess(netAddr *wire.NetAddressV2) error {
+	if nm.accessList == nil {
+		return nil
+	}
+	var ip net.IP
+	if netAddr != nil {
+		if legacyAddr := netAddr.ToLegacy(); legacyAddr != nil {
+			ip = legacyAddr.IP
+		}
+	}
+	return nm.accessList.CheckIP(ip)
+}
+
 // ###########################
 // ## Helper Functions
 // ###########################
@@ -1360,14 +1566,14 @@ func (nm *NetworkManager) isDuplicateInboundIPAddress(addr net.Addr) bool {
 		// Return true in case we have an error. We do this because it
 		// will result in the peer connection not being accepted, which
 		// is desired in this case.
-		glog.Warningf(errors.Wrapf(err,
+		nm.logger.Warningf(errors.Wrapf(err,
 			"NetworkManager.isDuplicateInboundIPAddress: Problem parsing "+
 				"net.Addr to wire.NetAddressV2 so marking as redundant and not "+
 				"making connection").Error())
 		return true
 	}
 	if netAddr == nil {
-		glog.Warningf("NetworkManager.isDuplicateInboundIPAddress: " +
+		nm.logger.Warningf("NetworkManager.isDuplicateInboundIPAddress: " +
 			"address was nil after parsing so marking as redundant and not " +
 			"making connection")
 		return true
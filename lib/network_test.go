@@ -1814,3 +1814,73 @@ func TestTxnJsonSerializationSimple(t *testing.T) {
 	require.NoError(t, txn2.UnmarshalJSON(bb))
 	require.Equal(t, txn1, txn2)
 }
+
+func TestComputeTxnSignatureDigest(t *testing.T) {
+	require := require.New(t)
+
+	ownerPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	derivedPrivateKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	newTxn := func(txnVersion DeSoTxnVersion) *MsgDeSoTxn {
+		return &MsgDeSoTxn{
+			TxnVersion: txnVersion,
+			TxOutputs: []*DeSoOutput{{
+				PublicKey:   pkForTesting1,
+				AmountNanos: 100,
+			}},
+			TxnMeta:     &BasicTransferMetadata{},
+			PublicKey:   ownerPrivateKey.PubKey().SerializeCompressed(),
+			ExtraData:   map[string][]byte{"key": []byte("value")},
+			TxnFeeNanos: 10,
+			TxnNonce:    &DeSoNonce{ExpirationBlockHeight: 100, PartialID: 7},
+		}
+	}
+
+	for _, txnVersion := range []DeSoTxnVersion{DeSoTxnVersion0, DeSoTxnVersion1} {
+		// The digest is the hash of the transaction without its signature, and signing doesn't change it.
+		txn := newTxn(txnVersion)
+		preSignatureBytes, digest, err := ComputeTxnSignatureDigest(txn)
+		require.NoError(err)
+		txnBytes, err := txn.ToBytes(true /*preSignature*/)
+		require.NoError(err)
+		require.Equal(txnBytes, preSignatureBytes)
+		require.Equal(Sha256DoubleHash(txnBytes), digest)
+
+		txnSignature, err := txn.Sign(ownerPrivateKey)
+		require.NoError(err)
+		txn.Signature.SetSignature(txnSignature)
+		_, signedDigest, err := ComputeTxnSignatureDigest(txn)
+		require.NoError(err)
+		require.Equal(digest, signedDigest)
+		require.True(txn.Signature.Verify(digest[:], ownerPrivateKey.PubKey()))
+
+		// With a DeSo-DER signature, the derived key is recovered from the signature over the same digest.
+		txn = newTxn(txnVersion)
+		_, derivedDigest, err := ComputeTxnSignatureDigest(txn)
+		require.NoError(err)
+		require.Equal(digest, derivedDigest)
+		txn.Signature = *SignRecoverable(derivedDigest[:], derivedPrivateKey)
+		derivedPkBytes, isDerived, err := IsDerivedSignature(txn, 0)
+		require.NoError(err)
+		require.True(isDerived)
+		require.Equal(derivedPrivateKey.PubKey().SerializeCompressed(), derivedPkBytes)
+
+		// With the derived key in ExtraData, the ExtraData is part of the digest.
+		txn = newTxn(txnVersion)
+		txn.ExtraData[DerivedPublicKey] = derivedPrivateKey.PubKey().SerializeCompressed()
+		_, extraDataDigest, err := ComputeTxnSignatureDigest(txn)
+		require.NoError(err)
+		require.NotEqual(digest, extraDataDigest)
+		txnSignature, err = txn.Sign(derivedPrivateKey)
+		require.NoError(err)
+		txn.Signature.SetSignature(txnSignature)
+		require.True(txn.Signature.Verify(extraDataDigest[:], derivedPrivateKey.PubKey()))
+	}
+
+	// Transactions that aren't signed don't have a digest.
+	_, _, err = ComputeTxnSignatureDigest(&MsgDeSoTxn{TxnMeta: &BlockRewardMetadataa{}})
+	require.Error(err)
+	_, _, err = ComputeTxnSignatureDigest(&MsgDeSoTxn{})
+	require.Error(err)
+}
@@ -0,0 +1,463 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/pkg/errors"
+)
+
+// NodeConfig holds the tunables that a node is started with. It is what NewServer and NewBlockchainFromNodeConfig
+// are configured with, so that programs that embed core can configure a node without going through the command
+// line flags in cmd. The dependencies of a node, such as its DB, listeners, and keystore, are passed to the
+// constructors separately.
+//
+// A NodeConfig is usually created with a NodeConfigBuilder, which starts from the same defaults as the command
+// line flags and validates the config when it's built. A NodeConfig that's created or modified by hand should be
+// checked with Validate before it's used.
+type NodeConfig struct {
+	Params  *DeSoParams
+	Regtest bool
+
+	// Data directories. The MempoolDumpDir and StateChangeDir are optional.
+	DataDir        string
+	MempoolDumpDir string
+	StateChangeDir string
+
+	// Peers
+	ConnectIPs                          []string
+	TargetOutboundPeers                 uint32
+	MaxInboundPeers                     uint32
+	LimitOneInboundConnectionPerIP      bool
+	PeerConnectionRefreshIntervalMillis uint64
+	StallTimeoutSeconds                 uint64
+	BlockStallTimeoutSeconds            uint64
+	DisableNetworking                   bool
+	ReadOnlyMode                        bool
+	IgnoreInboundPeerInvMessages        bool
+	// PeerRequestRateLimits is a comma-separated list of type=rate:burst entries that override the default
+	// budgets of the requests each peer can send. See NewPeerRequestRateLimits.
+	PeerRequestRateLimits string
+	// TxnReconciliationIntervalMillis is how often transactions are reconciled with each outbound peer that
+	// supports it, or zero to flood transactions to every peer. See txn_reconciliation.go.
+	TxnReconciliationIntervalMillis uint64
+	// CompactBlockRelay announces new blocks with compact blocks to the peers that support them, which reconstruct
+	// the blocks from their mempools. See compact_block.go.
+	CompactBlockRelay bool
+	// FeeTelemetryIntervalSeconds is how often a summary of the mempool's fees is shared with the peers that
+	// support it, or zero to neither share nor aggregate fee telemetry. See fee_telemetry.go.
+	FeeTelemetryIntervalSeconds uint64
+	// TxnMessageWorkers is the number of workers that process the INVs, transaction bundles, and other transaction
+	// relay messages received from peers. See server_message_lanes.go.
+	TxnMessageWorkers uint64
+
+	// Sync
+	HyperSync                       bool
+	SyncType                        NodeSyncType
+	MaxSyncBlockHeight              uint32
+	SnapshotBlockHeightPeriod       uint64
+	HypersyncMaxQueueSize           uint32
+	HypersyncChunkApplyWorkers      uint32
+	DisableEncoderMigrations        bool
+	ForceChecksum                   bool
+	ContinuousChecksum              bool
+	StateCommitment                 bool
+	TrustedSnapshotSignerPublicKeys []string
+	CheckpointSyncingProviders      []string
+	BlockCheckpoints                []BlockCheckpoint
+	// MaxReorgDepth is the deepest PoW reorg that is applied without operator approval, or zero for no limit.
+	MaxReorgDepth uint64
+	// StateCacheMaxBytes is the size of the cache of hot state entries, or zero to disable it. See state_cache.go.
+	StateCacheMaxBytes uint64
+	// UndoDataRetentionBlocks is the number of final blocks whose UtxoOperations are kept, or zero to keep the
+	// UtxoOperations of every block. See undo_data_pruning.go.
+	UndoDataRetentionBlocks uint64
+
+	// Fees and mempool
+	RateLimitFeerateNanosPerKB                 uint64
+	MinFeeRateNanosPerKB                       uint64
+	MempoolBackupIntervalMillis                uint64
+	MempoolMaxValidationViewConnects           uint64
+	TransactionValidationRefreshIntervalMillis uint64
+	MempoolMaxSizeBytes                        uint64
+	MempoolMaxQueuedTxnsPerPublicKey           uint64
+	MempoolValidationWorkers                   uint64
+	// MempoolNonLocalTxnTTLSeconds is how long a transaction relayed by a peer can stay in the PoS mempool, or zero
+	// for no limit. MempoolLocalTxnRebroadcastIntervalSeconds is how often the transactions submitted to this node
+	// are rebroadcast to peers until they're confirmed, or zero to never rebroadcast them.
+	MempoolNonLocalTxnTTLSeconds              uint64
+	MempoolLocalTxnRebroadcastIntervalSeconds uint64
+	// MempoolPublicKeyQuota limits the transactions a single public key can hold in the PoS mempool. See
+	// pos_mempool_public_key_quota.go.
+	MempoolPublicKeyQuota          PublicKeyQuota
+	RunReadOnlyUtxoViewUpdater     bool
+	StateSyncerMempoolTxnSyncLimit uint64
+	// StateChangeFileMaxSizeBytes is the size at which the committed state change file is rotated, or zero to
+	// never rotate it.
+	StateChangeFileMaxSizeBytes uint64
+
+	// Mining and block production. If NumMiningThreads is zero, the miner uses one thread per CPU.
+	MinerPublicKeys                 []string
+	NumMiningThreads                uint64
+	MaxBlockTemplatesToCache        uint64
+	MinBlockUpdateIntervalSeconds   uint64
+	BlockCypherAPIKey               string
+	BlockProducerSeed               string
+	TrustedBlockProducerPublicKeys  []string
+	TrustedBlockProducerStartHeight uint64
+	// BlockInclusionExcludedTxnTypes, BlockInclusionExcludedPublicKeys, and BlockInclusionMinFeeRates filter the
+	// transactions the node includes in the PoS blocks it produces. See NewBlockInclusionFilter.
+	BlockInclusionExcludedTxnTypes   []string
+	BlockInclusionExcludedPublicKeys []string
+	BlockInclusionMinFeeRates        string
+	// BlockProducerDeterministicTxnShuffle orders the transactions of the PoW and PoS blocks the node produces by
+	// the deterministic shuffle, even if the network doesn't enforce it. See deterministic_txn_shuffle.go.
+	BlockProducerDeterministicTxnShuffle bool
+
+	// Logging. LogFormat is "text" or "json", and LogComponentLevels is a comma-separated list of component=level
+	// pairs. See logger.go.
+	LogFormat          string
+	LogComponentLevels string
+}
+
+// DefaultNodeConfig returns the config of a node on the network of params, with the same defaults as the command
+// line flags.
+func DefaultNodeConfig(params *DeSoParams) *NodeConfig {
+	config := &NodeConfig{
+		Params:                              params,
+		TargetOutboundPeers:                 8,
+		MaxInboundPeers:                     125,
+		LimitOneInboundConnectionPerIP:      true,
+		PeerConnectionRefreshIntervalMillis: 10000,
+		StallTimeoutSeconds:                 900,
+		BlockStallTimeoutSeconds:            60,
+		TxnReconciliationIntervalMillis:     DefaultTxnReconciliationIntervalMillis,
+		CompactBlockRelay:                   true,
+		FeeTelemetryIntervalSeconds:         DefaultFeeTelemetryIntervalSeconds,
+		TxnMessageWorkers:                   DefaultTxnMessageWorkers,
+
+		HyperSync:                  true,
+		SyncType:                   NodeSyncTypeAny,
+		SnapshotBlockHeightPeriod:  DefaultSnapshotEpochPeriodPoS,
+		HypersyncMaxQueueSize:      HypersyncDefaultMaxQueueSize,
+		HypersyncChunkApplyWorkers: HypersyncDefaultChunkApplyWorkers,
+		UndoDataRetentionBlocks:    DefaultUndoDataRetentionBlocks,
+
+		MinFeeRateNanosPerKB:                       1000,
+		MempoolBackupIntervalMillis:                30000,
+		MempoolMaxValidationViewConnects:           10000,
+		TransactionValidationRefreshIntervalMillis: 10,
+		MempoolMaxQueuedTxnsPerPublicKey:           16,
+		MempoolValidationWorkers:                   PosMempoolDefaultValidationWorkers,
+		MempoolLocalTxnRebroadcastIntervalSeconds:  60,
+		RunReadOnlyUtxoViewUpdater:                 true,
+		StateSyncerMempoolTxnSyncLimit:             10000,
+
+		MaxBlockTemplatesToCache:      100,
+		MinBlockUpdateIntervalSeconds: 10,
+
+		LogFormat: LogFormatText.String(),
+	}
+	if params != nil {
+		config.DataDir = filepath.Join(GetDataDir(params), DBVersionString)
+		switch params.NetworkType {
+		case NetworkType_MAINNET:
+			config.CheckpointSyncingProviders = []string{DefaultMainnetCheckpointProvider}
+		case NetworkType_TESTNET:
+			config.CheckpointSyncingProviders = []string{DefaultTestnetCheckpointProvider}
+		}
+	}
+	return config
+}
+
+// Validate returns an error if the config can't be used to start a node.
+func (config *NodeConfig) Validate() error {
+	if config.Params == nil {
+		return fmt.Errorf("NodeConfig.Validate: Params must be set")
+	}
+	if config.DataDir == "" {
+		return fmt.Errorf("NodeConfig.Validate: DataDir must be set")
+	}
+	if err := validateHyperSyncFlags(config.HyperSync, config.SyncType); err != nil {
+		return errors.Wrapf(err, "NodeConfig.Validate: ")
+	}
+	if config.HyperSync && config.SnapshotBlockHeightPeriod == 0 {
+		return fmt.Errorf("NodeConfig.Validate: SnapshotBlockHeightPeriod must be non-zero when HyperSync is set")
+	}
+	if config.ContinuousChecksum && !config.HyperSync {
+		return fmt.Errorf("NodeConfig.Validate: ContinuousChecksum requires HyperSync")
+	}
+	if config.StateCommitment && !config.HyperSync {
+		return fmt.Errorf("NodeConfig.Validate: StateCommitment requires HyperSync")
+	}
+	if config.StateCacheMaxBytes > 0 && !config.HyperSync {
+		return fmt.Errorf("NodeConfig.Validate: StateCacheMaxBytes requires HyperSync")
+	}
+	for _, provider := range config.CheckpointSyncingProviders {
+		if _, err := url.ParseRequestURI(provider); err != nil {
+			return fmt.Errorf("NodeConfig.Validate: Invalid checkpoint syncing provider URL %v", provider)
+		}
+	}
+	for _, publicKeyString := range config.TrustedSnapshotSignerPublicKeys {
+		if publicKey, err := (&bls.PublicKey{}).FromString(publicKeyString); err != nil || publicKey == nil {
+			return fmt.Errorf("NodeConfig.Validate: Invalid trusted snapshot signer public key %v", publicKeyString)
+		}
+	}
+	for _, publicKeyString := range config.TrustedBlockProducerPublicKeys {
+		if _, _, err := Base58CheckDecode(publicKeyString); err != nil {
+			return fmt.Errorf("NodeConfig.Validate: Invalid trusted block producer public key %v", publicKeyString)
+		}
+	}
+	for _, publicKeyString := range config.MinerPublicKeys {
+		if _, _, err := Base58CheckDecode(publicKeyString); err != nil {
+			return fmt.Errorf("NodeConfig.Validate: Invalid miner public key %v", publicKeyString)
+		}
+	}
+	if _, err := NewBlockInclusionFilter(config.BlockInclusionExcludedTxnTypes, config.BlockInclusionExcludedPublicKeys,
+		config.BlockInclusionMinFeeRates); err != nil {
+		return errors.Wrapf(err, "NodeConfig.Validate: ")
+	}
+	if _, err := NewPeerRequestRateLimits(config.PeerRequestRateLimits); err != nil {
+		return errors.Wrapf(err, "NodeConfig.Validate: ")
+	}
+	if _, err := NewLogConfig(config.LogFormat, config.LogComponentLevels); err != nil {
+		return errors.Wrapf(err, "NodeConfig.Validate: ")
+	}
+	return nil
+}
+
+// NodeConfigBuilder builds a NodeConfig, starting from DefaultNodeConfig. Each setter sets a group of related
+// tunables, and Build validates the result. For tunables without a setter, modify the NodeConfig returned by
+// Build and call Validate again.
+type NodeConfigBuilder struct {
+	config NodeConfig
+}
+
+func NewNodeConfigBuilder(params *DeSoParams) *NodeConfigBuilder {
+	return &NodeConfigBuilder{config: *DefaultNodeConfig(params)}
+}
+
+func (builder *NodeConfigBuilder) SetRegtest(regtest bool) *NodeConfigBuilder {
+	builder.config.Regtest = regtest
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetDataDirs(dataDir string, mempoolDumpDir string, stateChangeDir string) *NodeConfigBuilder {
+	builder.config.DataDir = dataDir
+	builder.config.MempoolDumpDir = mempoolDumpDir
+	builder.config.StateChangeDir = stateChangeDir
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetPeers(connectIPs []string, targetOutboundPeers uint32, maxInboundPeers uint32,
+	limitOneInboundConnectionPerIP bool) *NodeConfigBuilder {
+
+	builder.config.ConnectIPs = connectIPs
+	builder.config.TargetOutboundPeers = targetOutboundPeers
+	builder.config.MaxInboundPeers = maxInboundPeers
+	builder.config.LimitOneInboundConnectionPerIP = limitOneInboundConnectionPerIP
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetPeerTimeouts(peerConnectionRefreshIntervalMillis uint64,
+	stallTimeoutSeconds uint64, blockStallTimeoutSeconds uint64) *NodeConfigBuilder {
+
+	builder.config.PeerConnectionRefreshIntervalMillis = peerConnectionRefreshIntervalMillis
+	builder.config.StallTimeoutSeconds = stallTimeoutSeconds
+	builder.config.BlockStallTimeoutSeconds = blockStallTimeoutSeconds
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetPeerRequestRateLimits(peerRequestRateLimits string) *NodeConfigBuilder {
+	builder.config.PeerRequestRateLimits = peerRequestRateLimits
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetTxnReconciliation(txnReconciliationIntervalMillis uint64) *NodeConfigBuilder {
+	builder.config.TxnReconciliationIntervalMillis = txnReconciliationIntervalMillis
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetCompactBlockRelay(compactBlockRelay bool) *NodeConfigBuilder {
+	builder.config.CompactBlockRelay = compactBlockRelay
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetFeeTelemetry(feeTelemetryIntervalSeconds uint64) *NodeConfigBuilder {
+	builder.config.FeeTelemetryIntervalSeconds = feeTelemetryIntervalSeconds
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetTxnMessageWorkers(txnMessageWorkers uint64) *NodeConfigBuilder {
+	builder.config.TxnMessageWorkers = txnMessageWorkers
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetNetworkingModes(disableNetworking bool, readOnlyMode bool,
+	ignoreInboundPeerInvMessages bool) *NodeConfigBuilder {
+
+	builder.config.DisableNetworking = disableNetworking
+	builder.config.ReadOnlyMode = readOnlyMode
+	builder.config.IgnoreInboundPeerInvMessages = ignoreInboundPeerInvMessages
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetHyperSync(hyperSync bool, syncType NodeSyncType, snapshotBlockHeightPeriod uint64,
+	hypersyncMaxQueueSize uint32, hypersyncChunkApplyWorkers uint32) *NodeConfigBuilder {
+
+	builder.config.HyperSync = hyperSync
+	builder.config.SyncType = syncType
+	builder.config.SnapshotBlockHeightPeriod = snapshotBlockHeightPeriod
+	builder.config.HypersyncMaxQueueSize = hypersyncMaxQueueSize
+	builder.config.HypersyncChunkApplyWorkers = hypersyncChunkApplyWorkers
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetStateVerification(forceChecksum bool, continuousChecksum bool,
+	stateCommitment bool, trustedSnapshotSignerPublicKeys []string) *NodeConfigBuilder {
+
+	builder.config.ForceChecksum = forceChecksum
+	builder.config.ContinuousChecksum = continuousChecksum
+	builder.config.StateCommitment = stateCommitment
+	builder.config.TrustedSnapshotSignerPublicKeys = trustedSnapshotSignerPublicKeys
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetSyncLimits(maxSyncBlockHeight uint32, disableEncoderMigrations bool) *NodeConfigBuilder {
+	builder.config.MaxSyncBlockHeight = maxSyncBlockHeight
+	builder.config.DisableEncoderMigrations = disableEncoderMigrations
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetCheckpoints(checkpointSyncingProviders []string,
+	blockCheckpoints []BlockCheckpoint) *NodeConfigBuilder {
+
+	builder.config.CheckpointSyncingProviders = checkpointSyncingProviders
+	builder.config.BlockCheckpoints = blockCheckpoints
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetMaxReorgDepth(maxReorgDepth uint64) *NodeConfigBuilder {
+	builder.config.MaxReorgDepth = maxReorgDepth
+	return builder
+}
+
+// SetUndoDataRetention sets the number of final blocks whose UtxoOperations are kept. Archival nodes keep the
+// UtxoOperations of every block regardless of the retention.
+func (builder *NodeConfigBuilder) SetUndoDataRetention(undoDataRetentionBlocks uint64, archivalUndoData bool) *NodeConfigBuilder {
+	builder.config.UndoDataRetentionBlocks = undoDataRetentionBlocks
+	if archivalUndoData {
+		builder.config.UndoDataRetentionBlocks = 0
+	}
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetStateCache(stateCacheMaxBytes uint64) *NodeConfigBuilder {
+	builder.config.StateCacheMaxBytes = stateCacheMaxBytes
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetFees(rateLimitFeerateNanosPerKB uint64, minFeeRateNanosPerKB uint64) *NodeConfigBuilder {
+	builder.config.RateLimitFeerateNanosPerKB = rateLimitFeerateNanosPerKB
+	builder.config.MinFeeRateNanosPerKB = minFeeRateNanosPerKB
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetMempool(mempoolBackupIntervalMillis uint64, mempoolMaxValidationViewConnects uint64,
+	transactionValidationRefreshIntervalMillis uint64, mempoolMaxSizeBytes uint64,
+	mempoolMaxQueuedTxnsPerPublicKey uint64, mempoolValidationWorkers uint64) *NodeConfigBuilder {
+
+	builder.config.MempoolBackupIntervalMillis = mempoolBackupIntervalMillis
+	builder.config.MempoolMaxValidationViewConnects = mempoolMaxValidationViewConnects
+	builder.config.TransactionValidationRefreshIntervalMillis = transactionValidationRefreshIntervalMillis
+	builder.config.MempoolMaxSizeBytes = mempoolMaxSizeBytes
+	builder.config.MempoolMaxQueuedTxnsPerPublicKey = mempoolMaxQueuedTxnsPerPublicKey
+	builder.config.MempoolValidationWorkers = mempoolValidationWorkers
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetMempoolLocalTxns(mempoolNonLocalTxnTTLSeconds uint64,
+	mempoolLocalTxnRebroadcastIntervalSeconds uint64) *NodeConfigBuilder {
+
+	builder.config.MempoolNonLocalTxnTTLSeconds = mempoolNonLocalTxnTTLSeconds
+	builder.config.MempoolLocalTxnRebroadcastIntervalSeconds = mempoolLocalTxnRebroadcastIntervalSeconds
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetMempoolPublicKeyQuota(maxTxnsPerPublicKey uint64, maxBytesPerPublicKey uint64,
+	burstTxnsPerPublicKey uint64, burstBytesPerPublicKey uint64) *NodeConfigBuilder {
+
+	builder.config.MempoolPublicKeyQuota = PublicKeyQuota{
+		MaxTxns:    maxTxnsPerPublicKey,
+		MaxBytes:   maxBytesPerPublicKey,
+		BurstTxns:  burstTxnsPerPublicKey,
+		BurstBytes: burstBytesPerPublicKey,
+	}
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetStateSyncerMempoolTxnSyncLimit(stateSyncerMempoolTxnSyncLimit uint64) *NodeConfigBuilder {
+	builder.config.StateSyncerMempoolTxnSyncLimit = stateSyncerMempoolTxnSyncLimit
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetStateChangeFileMaxSizeBytes(stateChangeFileMaxSizeBytes uint64) *NodeConfigBuilder {
+	builder.config.StateChangeFileMaxSizeBytes = stateChangeFileMaxSizeBytes
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetMining(minerPublicKeys []string, numMiningThreads uint64) *NodeConfigBuilder {
+	builder.config.MinerPublicKeys = minerPublicKeys
+	builder.config.NumMiningThreads = numMiningThreads
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetBlockProducer(maxBlockTemplatesToCache uint64, minBlockUpdateIntervalSeconds uint64,
+	blockCypherAPIKey string, blockProducerSeed string) *NodeConfigBuilder {
+
+	builder.config.MaxBlockTemplatesToCache = maxBlockTemplatesToCache
+	builder.config.MinBlockUpdateIntervalSeconds = minBlockUpdateIntervalSeconds
+	builder.config.BlockCypherAPIKey = blockCypherAPIKey
+	builder.config.BlockProducerSeed = blockProducerSeed
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetTrustedBlockProducers(trustedBlockProducerPublicKeys []string,
+	trustedBlockProducerStartHeight uint64) *NodeConfigBuilder {
+
+	builder.config.TrustedBlockProducerPublicKeys = trustedBlockProducerPublicKeys
+	builder.config.TrustedBlockProducerStartHeight = trustedBlockProducerStartHeight
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetBlockInclusionFilter(excludedTxnTypes []string, excludedPublicKeys []string,
+	minFeeRates string) *NodeConfigBuilder {
+
+	builder.config.BlockInclusionExcludedTxnTypes = excludedTxnTypes
+	builder.config.BlockInclusionExcludedPublicKeys = excludedPublicKeys
+	builder.config.BlockInclusionMinFeeRates = minFeeRates
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetBlockProducerDeterministicTxnShuffle(blockProducerDeterministicTxnShuffle bool,
+) *NodeConfigBuilder {
+	builder.config.BlockProducerDeterministicTxnShuffle = blockProducerDeterministicTxnShuffle
+	return builder
+}
+
+func (builder *NodeConfigBuilder) SetLogging(logFormat string, logComponentLevels string) *NodeConfigBuilder {
+	builder.config.LogFormat = logFormat
+	builder.config.LogComponentLevels = logComponentLevels
+	return builder
+}
+
+// Build returns a copy of the config, or an error if it isn't valid.
+func (builder *NodeConfigBuilder) Build() (*NodeConfig, error) {
+	config := builder.config
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "NodeConfigBuilder.Build: ")
+	}
+	return &config, nil
+}
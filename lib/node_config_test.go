@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeConfigBuilder(t *testing.T) {
+	require := require.New(t)
+
+	// The defaults are valid, and match the defaults of the command line flags.
+	config, err := NewNodeConfigBuilder(&DeSoTestnetParams).Build()
+	require.NoError(err)
+	require.Equal(&DeSoTestnetParams, config.Params)
+	require.True(config.HyperSync)
+	require.Equal(NodeSyncType(NodeSyncTypeAny), config.SyncType)
+	require.Equal(uint32(8), config.TargetOutboundPeers)
+	require.Equal(uint64(1000), config.MinFeeRateNanosPerKB)
+	require.Equal([]string{DefaultTestnetCheckpointProvider}, config.CheckpointSyncingProviders)
+	require.NotEmpty(config.DataDir)
+
+	// Setters only change their own group of tunables, and built configs don't change with the builder.
+	builder := NewNodeConfigBuilder(&DeSoTestnetParams).
+		SetDataDirs("/tmp/deso", "/tmp/deso-mempool", "").
+		SetPeers([]string{"127.0.0.1:18000"}, 2, 10, false).
+		SetMempool(1000, 500, 20, 1<<20, 4, 8)
+	config, err = builder.Build()
+	require.NoError(err)
+	require.Equal("/tmp/deso", config.DataDir)
+	require.Equal([]string{"127.0.0.1:18000"}, config.ConnectIPs)
+	require.False(config.LimitOneInboundConnectionPerIP)
+	require.Equal(uint64(1<<20), config.MempoolMaxSizeBytes)
+	require.Equal(uint64(8), config.MempoolValidationWorkers)
+	require.Equal(uint64(900), config.StallTimeoutSeconds)
+	builder.SetFees(0, 5000)
+	require.Equal(uint64(1000), config.MinFeeRateNanosPerKB)
+
+	// Invalid configs are rejected.
+	_, err = NewNodeConfigBuilder(nil).Build()
+	require.Error(err)
+	_, err = NewNodeConfigBuilder(&DeSoTestnetParams).SetHyperSync(true, "not-a-sync-type", 1000, 0, 0).Build()
+	require.Error(err)
+	_, err = NewNodeConfigBuilder(&DeSoTestnetParams).
+		SetHyperSync(false, NodeSyncTypeHyperSyncArchival, 1000, 0, 0).Build()
+	require.Error(err)
+	_, err = NewNodeConfigBuilder(&DeSoTestnetParams).
+		SetHyperSync(false, NodeSyncTypeBlockSync, 1000, 0, 0).
+		SetStateVerification(false, false, true, nil).Build()
+	require.Error(err)
+	_, err = NewNodeConfigBuilder(&DeSoTestnetParams).
+		SetHyperSync(false, NodeSyncTypeBlockSync, 1000, 0, 0).
+		SetStateCache(1 << 20).Build()
+	require.Error(err)
+	_, err = NewNodeConfigBuilder(&DeSoTestnetParams).SetCheckpoints([]string{"not a url"}, nil).Build()
+	require.Error(err)
+	_, err = NewNodeConfigBuilder(&DeSoTestnetParams).SetMining([]string{"not a public key"}, 1).Build()
+	require.Error(err)
+	_, err = NewNodeConfigBuilder(&DeSoTestnetParams).
+		SetStateVerification(false, false, false, []string{"not a bls key"}).Build()
+	require.Error(err)
+
+	// Configs that are modified by hand are validated with Validate.
+	config, err = NewNodeConfigBuilder(&DeSoTestnetParams).Build()
+	require.NoError(err)
+	config.SnapshotBlockHeightPeriod = 0
+	require.Error(config.Validate())
+}
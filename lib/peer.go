@@ -12,7 +12,6 @@ import (
 	"github.com/hashicorp/golang-lru/v2"
 
 	"github.com/btcsuite/btcd/wire"
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -32,6 +31,8 @@ type ExpectedResponse struct {
 type DeSoMessageMeta struct {
 	DeSoMessage DeSoMessage
 	Inbound     bool
+	// CorrelationID is the ID of the inbound message that caused this one to be queued, if any.
+	CorrelationID CorrelationID
 }
 
 // Peer is an object that holds all of the state for a connection to another node.
@@ -57,6 +58,9 @@ type Peer struct {
 	LastPingNonce  uint64
 	LastPingTime   time.Time
 	LastPingMicros int64
+	// AvgPingMicros is a moving average of the peer's ping latencies, weighted towards the recent ones. It's
+	// zero until the peer answers its first ping.
+	AvgPingMicros int64
 
 	// Connection info.
 	cmgr                *ConnectionManager
@@ -64,8 +68,12 @@ type Peer struct {
 	isOutbound          bool
 	isPersistent        bool
 	stallTimeoutSeconds uint64
-	Params              *DeSoParams
-	MessageChan         chan *ServerMessage
+	// blockStallTimeoutSeconds is how long the peer has to reply to a GetBlocks request. It's shorter than
+	// stallTimeoutSeconds so that a peer that stalls on blocks is dropped, and the blocks requested from
+	// another peer, before it holds up the sync for long.
+	blockStallTimeoutSeconds uint64
+	Params                   *DeSoParams
+	MessageChan              chan *ServerMessage
 
 	// A pointer to the Server
 	srv *Server
@@ -108,6 +116,9 @@ type Peer struct {
 	// being sent is limited to a multiple of the number of Peers we have.
 	blocksToSendMtx deadlock.Mutex
 	blocksToSend    map[BlockHash]bool
+	// requestRateLimiter limits how often the peer can send us GetHeaders, GetBlocks,
+	// and GetSnapshot requests. It's nil if the peer's requests aren't limited.
+	requestRateLimiter *peerRequestRateLimiter
 
 	// Inventory stuff.
 	// The inventory that we know the peer already has.
@@ -119,6 +130,12 @@ type Peer struct {
 	// Whether we have sent a MEMPOOL message to the peer to request INV messages.
 	// This makes sure that we only ever send one MEMPOOL message to the peer.
 	hasReceivedMempoolMessage bool
+	// txnReconciliation holds the transactions we'll announce to the peer in the next
+	// reconciliation round, if we reconcile transactions with the peer. See txn_reconciliation.go.
+	txnReconciliation *txnReconciliationState
+	// compactBlocks holds the compact blocks from the peer that are waiting on the transactions we requested
+	// from it. See compact_block.go.
+	compactBlocks *compactBlockState
 
 	// We process GetTransaction requests in a separate loop. This allows us
 	// to ensure that the responses are ordered.
@@ -135,6 +152,9 @@ type Peer struct {
 	// then we'll only hypersync from this peer.
 	syncType NodeSyncType
 
+	// logger is scoped to the peer component and adds the peer's ID to every message.
+	logger Logger
+
 	// startGroup ensures that all the Peer's go routines are started when we call Start().
 	startGroup sync.WaitGroup
 }
@@ -144,9 +164,16 @@ func (pp *Peer) GetId() uint64 {
 }
 
 func (pp *Peer) AddDeSoMessage(desoMessage DeSoMessage, inbound bool) {
+	pp.AddDeSoMessageWithCorrelationID(desoMessage, inbound, "")
+}
+
+// AddDeSoMessageWithCorrelationID is like AddDeSoMessage, but attributes the message to the inbound
+// message with the given CorrelationID, so that processing or sending it shows up under that ID in the logs.
+func (pp *Peer) AddDeSoMessageWithCorrelationID(desoMessage DeSoMessage, inbound bool, cid CorrelationID) {
 	// Don't add any more messages if the peer is disconnected
 	if pp.disconnected != 0 {
-		glog.Errorf("AddDeSoMessage: Not enqueueing message %v because peer is disconnecting", desoMessage.GetMsgType())
+		pp.logger.Errorf("AddDeSoMessage: [%v] Not enqueueing message %v because peer is disconnecting",
+			cid, desoMessage.GetMsgType())
 		return
 	}
 
@@ -154,8 +181,9 @@ func (pp *Peer) AddDeSoMessage(desoMessage DeSoMessage, inbound bool) {
 	defer pp.mtxMessageQueue.Unlock()
 
 	pp.messageQueue = append(pp.messageQueue, &DeSoMessageMeta{
-		DeSoMessage: desoMessage,
-		Inbound:     inbound,
+		DeSoMessage:   desoMessage,
+		Inbound:       inbound,
+		CorrelationID: cid,
 	})
 }
 
@@ -178,7 +206,7 @@ func (pp *Peer) MaybeDequeueDeSoMessage() *DeSoMessageMeta {
 // This call blocks on the Peer's queue.
 func (pp *Peer) HandleGetTransactionsMsg(getTxnMsg *MsgDeSoGetTransactions) {
 	// Get all the transactions we have from the mempool.
-	glog.V(1).Infof("Peer._handleGetTransactions: Processing "+
+	pp.logger.V(1).Infof("Peer._handleGetTransactions: Processing "+
 		"MsgDeSoGetTransactions message with %v txns from peer %v",
 		len(getTxnMsg.HashList), pp)
 
@@ -193,6 +221,11 @@ func (pp *Peer) HandleGetTransactionsMsg(getTxnMsg *MsgDeSoGetTransactions) {
 		if mempoolTx == nil || !mempoolTx.IsValidated() {
 			continue
 		}
+		// Don't send transactions whose TxnType the operator has paused.
+		if pp.srv.txnRelayFilter.IsTxnPaused(mempoolTx.Tx) {
+			continue
+		}
+		pp.srv.txnSubmissionTracker.RecordRequest(pp.ID, txHash, time.Now())
 
 		mempoolTxs = append(mempoolTxs, mempoolTx)
 	}
@@ -214,7 +247,7 @@ func (pp *Peer) HandleGetTransactionsMsg(getTxnMsg *MsgDeSoGetTransactions) {
 	// we had available from the request. It should also be below the limit
 	// for number of transactions since the request itself was below the
 	// limit. So push the bundle to the Peer.
-	glog.V(2).Infof("Peer._handleGetTransactions: Sending txn bundle with size %v to peer %v",
+	pp.logger.V(2).Infof("Peer._handleGetTransactions: Sending txn bundle with size %v to peer %v",
 		len(txnList), pp)
 
 	// Now we must enqueue the transactions in a transaction bundle. The type of transaction
@@ -239,7 +272,7 @@ func (pp *Peer) HandleTransactionBundleMessage(msg *MsgDeSoTransactionBundle) {
 	// from multiple peers they'll be processed all at once, potentially interleaving with
 	// one another.
 
-	glog.V(1).Infof("Received TransactionBundle "+
+	pp.logger.V(1).Infof("Received TransactionBundle "+
 		"message of size %v from Peer %v", len(msg.Transactions), pp)
 
 	pp._processTransactionsAndMaybeRemoveRequests(msg.Transactions)
@@ -253,7 +286,7 @@ func (pp *Peer) HandleTransactionBundleMessageV2(msg *MsgDeSoTransactionBundleV2
 	// from multiple peers they'll be processed all at once, potentially interleaving with
 	// one another.
 
-	glog.V(2).Infof("Received TransactionBundleV2 "+
+	pp.logger.V(2).Infof("Received TransactionBundleV2 "+
 		"message of size %v from Peer %v", len(msg.Transactions), pp)
 
 	pp._processTransactionsAndMaybeRemoveRequests(msg.Transactions)
@@ -263,7 +296,7 @@ func (pp *Peer) HandleTransactionBundleMessageV2(msg *MsgDeSoTransactionBundleV2
 
 func (pp *Peer) _processTransactionsAndMaybeRemoveRequests(transactions []*MsgDeSoTxn) {
 	transactionsToRelay := pp.srv._processTransactions(pp, transactions)
-	glog.V(2).Infof("Server._handleTransactionBundle: Accepted %v txns from Peer %v",
+	pp.logger.V(2).Infof("Server._handleTransactionBundle: Accepted %v txns from Peer %v",
 		len(transactionsToRelay), pp)
 
 	_ = transactionsToRelay
@@ -286,13 +319,17 @@ func (pp *Peer) HelpHandleInv(msg *MsgDeSoInv) {
 
 	// Iterate through the message. Gather the transactions and the
 	// blocks we don't already have into separate inventory lists.
-	glog.V(1).Infof("Server._handleInv: Processing INV message of size %v from peer %v", len(msg.InvList), pp)
+	pp.logger.V(1).Infof("Server._handleInv: Processing INV message of size %v from peer %v", len(msg.InvList), pp)
 	txHashList := []*BlockHash{}
 	blockHashList := []*BlockHash{}
 
 	for _, invVect := range msg.InvList {
 		// No matter what, add the inv to the peer's known inventory.
 		pp.knownInventory.Add(*invVect, struct{}{})
+		// If we submitted this transaction, the announcement tells us that it's spreading.
+		if invVect.Type == InvTypeTx {
+			pp.srv.txnSubmissionTracker.RecordAnnouncement(pp.ID, &invVect.Hash, time.Now())
+		}
 
 		// If this is a hash we are currently processing, no need to do anything.
 		// This check serves to fill the gap between the time when we've decided
@@ -358,7 +395,7 @@ func (pp *Peer) HelpHandleInv(msg *MsgDeSoInv) {
 			HashList: txHashList,
 		}, false /*inbound*/)
 	} else {
-		glog.V(1).Infof("Server._handleInv: Not sending GET_TRANSACTIONS because no new hashes")
+		pp.logger.V(1).Infof("Server._handleInv: Not sending GET_TRANSACTIONS because no new hashes")
 	}
 
 	// If the peer has sent us any block hashes that are new to us then send
@@ -385,7 +422,7 @@ func (pp *Peer) HandleInv(msg *MsgDeSoInv) {
 	// Ignore invs while we're still syncing and before we've requested
 	// all mempool transactions from one of our peers to bootstrap.
 	if pp.srv.blockchain.isSyncing() {
-		glog.V(1).Infof("Server._handleInv: Ignoring INV while syncing from Peer %v", pp)
+		pp.logger.V(1).Infof("Server._handleInv: Ignoring INV while syncing from Peer %v", pp)
 		return
 	}
 
@@ -397,11 +434,11 @@ func (pp *Peer) HandleInv(msg *MsgDeSoInv) {
 	pp.HelpHandleInv(msg)
 }
 
-func (pp *Peer) HandleGetBlocks(msg *MsgDeSoGetBlocks) {
+func (pp *Peer) HandleGetBlocks(msg *MsgDeSoGetBlocks, cid CorrelationID) {
 	// Nothing to do if the request is empty.
 	if len(msg.HashList) == 0 {
-		glog.V(1).Infof("Server._handleGetBlocks: Received empty GetBlocks "+
-			"request. No response needed for Peer %v", pp)
+		pp.logger.V(1).Infof("Server._handleGetBlocks: [%v] Received empty GetBlocks "+
+			"request. No response needed for Peer %v", cid, pp)
 		return
 	}
 
@@ -415,8 +452,8 @@ func (pp *Peer) HandleGetBlocks(msg *MsgDeSoGetBlocks) {
 			if blockToSend == nil {
 				// Don't ask us for blocks before verifying that we have them with a
 				// GetHeaders request.
-				glog.Errorf("Server._handleGetBlocks: Disconnecting peer %v because "+
-					"she asked for a block with hash %v that we don't have", pp, msg.HashList[0])
+				pp.logger.Errorf("Server._handleGetBlocks: [%v] Disconnecting peer %v because "+
+					"she asked for a block with hash %v that we don't have", cid, pp, msg.HashList[0])
 				pp.Disconnect("handleGetBlocks - requested block with hash we don't have. protocolV2")
 				return
 			}
@@ -424,7 +461,9 @@ func (pp *Peer) HandleGetBlocks(msg *MsgDeSoGetBlocks) {
 		}
 		allBlocks.TipHash = pp.srv.blockchain.blockTip().Hash
 		allBlocks.TipHeight = uint64(pp.srv.blockchain.blockTip().Height)
-		pp.AddDeSoMessage(&allBlocks, false)
+		pp.logger.V(1).Infof("Server._handleGetBlocks: [%v] Sending bundle of %d blocks to Peer %v",
+			cid, len(allBlocks.Blocks), pp)
+		pp.AddDeSoMessageWithCorrelationID(&allBlocks, false, cid)
 
 	} else {
 		// For each block the Peer has requested, fetch it and queue it to
@@ -444,12 +483,12 @@ func (pp *Peer) HandleGetBlocks(msg *MsgDeSoGetBlocks) {
 			if blockToSend == nil {
 				// Don't ask us for blocks before verifying that we have them with a
 				// GetHeaders request.
-				glog.Errorf("Server._handleGetBlocks: Disconnecting peer %v because "+
-					"she asked for a block with hash %v that we don't have", pp, msg.HashList[0])
+				pp.logger.Errorf("Server._handleGetBlocks: [%v] Disconnecting peer %v because "+
+					"she asked for a block with hash %v that we don't have", cid, pp, msg.HashList[0])
 				pp.Disconnect("handleGetBlocks - requested block with hash we don't have. protocol < v2")
 				return
 			}
-			pp.AddDeSoMessage(blockToSend, false)
+			pp.AddDeSoMessageWithCorrelationID(blockToSend, false, cid)
 		}
 	}
 }
@@ -466,7 +505,7 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 
 	// Make sure this peer can only request one snapshot chunk at a time.
 	if pp.snapshotChunkRequestInFlight {
-		glog.V(1).Infof("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v"+
+		pp.logger.V(1).Infof("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v"+
 			"because he already requested a GetSnapshot", pp)
 		pp.Disconnect("handleGetSnapshot - peer already requested a snapshot chunk")
 		return
@@ -476,7 +515,7 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 
 	// Ignore GetSnapshot requests and disconnect the peer if we're not a hypersync node.
 	if pp.srv.snapshot == nil {
-		glog.Errorf("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v "+
+		pp.logger.Errorf("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v "+
 			"and disconnecting because node doesn't support HyperSync", pp)
 		pp.Disconnect("handleGetSnapshot - peer doesn't support HyperSync")
 		return
@@ -486,7 +525,7 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 	// blockchain state is fully current.
 	if pp.srv.blockchain.isSyncing() {
 		chainState := pp.srv.blockchain.chainState()
-		glog.V(1).Infof("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v"+
+		pp.logger.V(1).Infof("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v"+
 			"because node is syncing with ChainState (%v)", pp, chainState)
 		pp.AddDeSoMessage(&MsgDeSoSnapshotData{
 			SnapshotMetadata:  nil,
@@ -499,7 +538,7 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 
 	// Make sure that the start key and prefix provided in the message are valid.
 	if len(msg.SnapshotStartKey) == 0 || len(msg.GetPrefix()) == 0 {
-		glog.Errorf("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v "+
+		pp.logger.Errorf("Peer.HandleGetSnapshot: Ignoring GetSnapshot from Peer %v "+
 			"because SnapshotStartKey or Prefix are empty", pp)
 		pp.Disconnect("handleGetSnapshot - empty SnapshotStartKey or Prefix")
 		return
@@ -507,6 +546,11 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 
 	// FIXME: Any restrictions on how many snapshots a peer can request?
 
+	if msg.SnapshotFormatVersion >= SnapshotFormatVersion2 {
+		pp.handleGetSnapshotV2(msg)
+		return
+	}
+
 	// Get the snapshot chunk from the database. This operation can happen concurrently with updates
 	// to the main DB or the ancestral records DB, and we don't want to slow down any of these updates.
 	// Because of that, we will detect whenever concurrent access takes place with the concurrencyFault
@@ -536,26 +580,63 @@ func (pp *Peer) HandleGetSnapshot(msg *MsgDeSoGetSnapshot) {
 		snapshotDataMsg.SnapshotChunkFull = false
 	}
 	if err != nil {
-		glog.Errorf("Peer.HandleGetSnapshot: something went wrong during fetching "+
+		pp.logger.Errorf("Peer.HandleGetSnapshot: something went wrong during fetching "+
 			"snapshot chunk for peer (%v), error (%v)", pp, err)
 		return
 	}
 
 	pp.AddDeSoMessage(snapshotDataMsg, false)
 
-	glog.V(2).Infof("Server._handleGetSnapshot: Sending a SnapshotChunk message to peer (%v) "+
+	pp.logger.V(2).Infof("Server._handleGetSnapshot: Sending a SnapshotChunk message to peer (%v) "+
 		"with SnapshotHeight (%v) and CurrentEpochChecksumBytes (%v) and Snapshotdata length (%v)", pp,
 		pp.srv.snapshot.CurrentEpochSnapshotMetadata.SnapshotBlockHeight,
 		snapshotDataMsg.SnapshotMetadata, len(snapshotDataMsg.SnapshotChunk))
 }
 
+// handleGetSnapshotV2 responds to a GetSnapshot request in the v2 snapshot format, where the peer asks
+// for a chunk by its index, and we send the chunk along with its Merkle proof against our state root.
+func (pp *Peer) handleGetSnapshotV2(msg *MsgDeSoGetSnapshot) {
+	stateRoot, err := pp.srv.snapshot.GetSnapshotStateRoot()
+	if err != nil {
+		pp.logger.Errorf("Peer.handleGetSnapshotV2: Problem computing state root for peer (%v), error (%v)", pp, err)
+		return
+	}
+	if msg.ChunkIndex >= stateRoot.NumChunks {
+		pp.logger.Errorf("Peer.handleGetSnapshotV2: Ignoring GetSnapshot from Peer %v and disconnecting "+
+			"because chunk index (%v) is out of range, snapshot has (%v) chunks", pp, msg.ChunkIndex,
+			stateRoot.NumChunks)
+		pp.Disconnect("handleGetSnapshotV2 - chunk index out of range")
+		return
+	}
+
+	prefix, chunk, stateRoot, proof, err := pp.srv.snapshot.GetSnapshotChunkV2(msg.ChunkIndex)
+	if err != nil {
+		pp.logger.Errorf("Peer.handleGetSnapshotV2: something went wrong during fetching "+
+			"snapshot chunk (%v) for peer (%v), error (%v)", msg.ChunkIndex, pp, err)
+		return
+	}
+
+	pp.AddDeSoMessage(&MsgDeSoSnapshotData{
+		SnapshotMetadata:  pp.srv.snapshot.CurrentEpochSnapshotMetadata,
+		SnapshotChunk:     chunk,
+		SnapshotChunkFull: false,
+		Prefix:            prefix,
+		StateRoot:         stateRoot,
+		ChunkIndex:        msg.ChunkIndex,
+		ChunkMerkleProof:  proof,
+	}, false)
+
+	pp.logger.V(2).Infof("Peer.handleGetSnapshotV2: Sending chunk (%v) of %v to peer (%v) with Snapshotdata length (%v)",
+		msg.ChunkIndex, stateRoot, pp, len(chunk))
+}
+
 func (pp *Peer) cleanupMessageProcessor() {
 	pp.mtxMessageQueue.Lock()
 	defer pp.mtxMessageQueue.Unlock()
 
 	// We assume that no more elements will be added to the message queue once this function
 	// is called.
-	glog.Infof("StartDeSoMessageProcessor: Cleaning up message queue for peer: %v", pp)
+	pp.logger.Infof("StartDeSoMessageProcessor: Cleaning up message queue for peer: %v", pp)
 	pp.messageQueue = nil
 	// Set a few more things to nil just to make sure the garbage collector doesn't
 	// get confused when freeing up this Peer's memory. This is to fix a bug where
@@ -568,11 +649,11 @@ func (pp *Peer) cleanupMessageProcessor() {
 
 func (pp *Peer) StartDeSoMessageProcessor() {
 	pp.startGroup.Done()
-	glog.Infof("StartDeSoMessageProcessor: Starting for peer %v", pp)
+	pp.logger.Infof("StartDeSoMessageProcessor: Starting for peer %v", pp)
 	for {
 		if pp.disconnected != 0 {
 			pp.cleanupMessageProcessor()
-			glog.Infof("StartDeSoMessageProcessor: Stopping because peer disconnected: %v", pp)
+			pp.logger.Infof("StartDeSoMessageProcessor: Stopping because peer disconnected: %v", pp)
 			return
 		}
 		msgToProcess := pp.MaybeDequeueDeSoMessage()
@@ -586,45 +667,46 @@ func (pp *Peer) StartDeSoMessageProcessor() {
 			switch msgToProcess.DeSoMessage.GetMsgType() {
 			case MsgTypeGetTransactions:
 				msg := msgToProcess.DeSoMessage.(*MsgDeSoGetTransactions)
-				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
+				pp.logger.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
 					"num hashes %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), len(msg.HashList), pp)
 				pp.HandleGetTransactionsMsg(msg)
 			case MsgTypeTransactionBundle:
 				msg := msgToProcess.DeSoMessage.(*MsgDeSoTransactionBundle)
-				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
+				pp.logger.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
 					"num txns %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), len(msg.Transactions), pp)
 				pp.HandleTransactionBundleMessage(msg)
 			case MsgTypeTransactionBundleV2:
-				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of "+
+				pp.logger.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of "+
 					"type %v with num txns %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(),
 					len(msgToProcess.DeSoMessage.(*MsgDeSoTransactionBundleV2).Transactions), pp)
 				pp.HandleTransactionBundleMessageV2(msgToProcess.DeSoMessage.(*MsgDeSoTransactionBundleV2))
 
 			case MsgTypeInv:
 				msg := msgToProcess.DeSoMessage.(*MsgDeSoInv)
-				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
+				pp.logger.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
 					"num invs %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), len(msg.InvList), pp)
 				pp.HandleInv(msg)
 
 			case MsgTypeGetBlocks:
 				msg := msgToProcess.DeSoMessage.(*MsgDeSoGetBlocks)
-				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with "+
-					"num hashes %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), len(msg.HashList), pp)
-				pp.HandleGetBlocks(msg)
+				pp.logger.V(1).Infof("StartDeSoMessageProcessor: [%v] RECEIVED message of type %v with "+
+					"num hashes %v from peer %v", msgToProcess.CorrelationID, msgToProcess.DeSoMessage.GetMsgType(),
+					len(msg.HashList), pp)
+				pp.HandleGetBlocks(msg, msgToProcess.CorrelationID)
 
 			case MsgTypeGetSnapshot:
 				msg := msgToProcess.DeSoMessage.(*MsgDeSoGetSnapshot)
-				glog.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with start key %v "+
+				pp.logger.V(1).Infof("StartDeSoMessageProcessor: RECEIVED message of type %v with start key %v "+
 					"and prefix %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), msg.SnapshotStartKey, msg.GetPrefix(), pp)
 
 				pp.HandleGetSnapshot(msg)
 			default:
-				glog.Errorf("StartDeSoMessageProcessor: ERROR RECEIVED message of "+
+				pp.logger.Errorf("StartDeSoMessageProcessor: ERROR RECEIVED message of "+
 					"type %v from peer %v", msgToProcess.DeSoMessage.GetMsgType(), pp)
 			}
 		} else {
-			glog.V(1).Infof("StartDeSoMessageProcessor: SENDING message of "+
-				"type %v to peer %v", msgToProcess.DeSoMessage.GetMsgType(), pp)
+			pp.logger.V(1).Infof("StartDeSoMessageProcessor: [%v] SENDING message of "+
+				"type %v to peer %v", msgToProcess.CorrelationID, msgToProcess.DeSoMessage.GetMsgType(), pp)
 			pp.QueueMessage(msgToProcess.DeSoMessage)
 		}
 	}
@@ -632,37 +714,44 @@ func (pp *Peer) StartDeSoMessageProcessor() {
 
 // NewPeer creates a new Peer object.
 func NewPeer(_id uint64, _conn net.Conn, _isOutbound bool, _netAddr *wire.NetAddressV2,
-	_isPersistent bool, _stallTimeoutSeconds uint64,
+	_isPersistent bool, _stallTimeoutSeconds uint64, _blockStallTimeoutSeconds uint64,
 	_minFeeRateNanosPerKB uint64,
+	_requestRateLimits map[MsgType]PeerRequestRateLimit,
 	params *DeSoParams,
 	messageChan chan *ServerMessage,
 	_cmgr *ConnectionManager, _srv *Server,
 	_syncType NodeSyncType,
-	peerDisconnectedChan chan *Peer) *Peer {
+	peerDisconnectedChan chan *Peer,
+	_logger Logger) *Peer {
 
 	knownInventoryCache, _ := lru.New[InvVect, struct{}](maxKnownInventory)
 
 	pp := Peer{
-		ID:                     _id,
-		cmgr:                   _cmgr,
-		srv:                    _srv,
-		Conn:                   _conn,
-		addrStr:                _conn.RemoteAddr().String(),
-		netAddr:                _netAddr,
-		isOutbound:             _isOutbound,
-		isPersistent:           _isPersistent,
-		outputQueueChan:        make(chan DeSoMessage),
-		peerDisconnectedChan:   peerDisconnectedChan,
-		quit:                   make(chan interface{}),
-		knownInventory:         knownInventoryCache,
-		blocksToSend:           make(map[BlockHash]bool),
-		stallTimeoutSeconds:    _stallTimeoutSeconds,
-		minTxFeeRateNanosPerKB: _minFeeRateNanosPerKB,
-		knownAddressesMap:      make(map[string]bool),
-		Params:                 params,
-		MessageChan:            messageChan,
-		requestedBlocks:        make(map[BlockHash]bool),
-		syncType:               _syncType,
+		ID:                       _id,
+		cmgr:                     _cmgr,
+		srv:                      _srv,
+		Conn:                     _conn,
+		addrStr:                  _conn.RemoteAddr().String(),
+		netAddr:                  _netAddr,
+		isOutbound:               _isOutbound,
+		isPersistent:             _isPersistent,
+		outputQueueChan:          make(chan DeSoMessage),
+		peerDisconnectedChan:     peerDisconnectedChan,
+		quit:                     make(chan interface{}),
+		knownInventory:           knownInventoryCache,
+		txnReconciliation:        newTxnReconciliationState(),
+		compactBlocks:            newCompactBlockState(),
+		blocksToSend:             make(map[BlockHash]bool),
+		requestRateLimiter:       newPeerRequestRateLimiter(_requestRateLimits, time.Now()),
+		stallTimeoutSeconds:      _stallTimeoutSeconds,
+		blockStallTimeoutSeconds: _blockStallTimeoutSeconds,
+		minTxFeeRateNanosPerKB:   _minFeeRateNanosPerKB,
+		knownAddressesMap:        make(map[string]bool),
+		Params:                   params,
+		MessageChan:              messageChan,
+		requestedBlocks:          make(map[BlockHash]bool),
+		syncType:                 _syncType,
+		logger:                   _logger,
 	}
 
 	// TODO: Before, we would give each Peer its own Logger object. Now we
@@ -720,7 +809,16 @@ const (
 
 	// pingInterval is the interval of time to wait in between sending ping
 	// messages.
-	pingInterval = 2 * time.Minute
+	pingInterval = 1 * time.Minute
+
+	// pongTimeout is how long a peer has to answer a ping. A connection that died
+	// without being closed is detected when its pong times out, well before the
+	// idleTimeout.
+	pongTimeout = 30 * time.Second
+
+	// avgPingWeight is the weight of the previous average in AvgPingMicros. Each
+	// new ping latency contributes 1/avgPingWeight of the new average.
+	avgPingWeight = 8
 
 	// idleTimeout is the duration of inactivity before we time out a peer.
 	idleTimeout = 5 * time.Minute
@@ -730,7 +828,7 @@ const (
 // message.
 func (pp *Peer) HandlePingMsg(msg *MsgDeSoPing) {
 	// Include nonce from ping so pong can be identified.
-	glog.V(2).Infof("Peer.HandlePingMsg: Received ping from peer %v: %v", pp, msg)
+	pp.logger.V(2).Infof("Peer.HandlePingMsg: Received ping from peer %v: %v", pp, msg)
 	// Queue up a pong message.
 	pp.QueueMessage(&MsgDeSoPong{Nonce: msg.Nonce})
 }
@@ -745,20 +843,35 @@ func (pp *Peer) HandlePongMsg(msg *MsgDeSoPong) {
 	// and overlapping pings will be ignored. It is unlikely to occur
 	// without large usage of the ping call since we ping infrequently
 	// enough that if they overlap we would have timed out the peer.
-	glog.V(2).Infof("Peer.HandlePongMsg: Received pong from peer %v: %v", msg, pp)
+	pp.logger.V(2).Infof("Peer.HandlePongMsg: Received pong from peer %v: %v", msg, pp)
 	pp.StatsMtx.Lock()
 	defer pp.StatsMtx.Unlock()
 	if pp.LastPingNonce != 0 && msg.Nonce == pp.LastPingNonce {
 		pp.LastPingMicros = time.Since(pp.LastPingTime).Nanoseconds()
 		pp.LastPingMicros /= 1000 // convert to usec.
 		pp.LastPingNonce = 0
-		glog.V(2).Infof("Peer.HandlePongMsg: LastPingMicros(%d) from Peer %v", pp.LastPingMicros, pp)
+		if pp.AvgPingMicros == 0 {
+			pp.AvgPingMicros = pp.LastPingMicros
+		} else {
+			pp.AvgPingMicros += (pp.LastPingMicros - pp.AvgPingMicros) / avgPingWeight
+		}
+		pp.logger.V(2).Infof("Peer.HandlePongMsg: LastPingMicros(%d), AvgPingMicros(%d) from Peer %v",
+			pp.LastPingMicros, pp.AvgPingMicros, pp)
 	}
 }
 
+// AveragePingMicros returns the moving average of the peer's ping latencies, or zero if the
+// peer hasn't answered a ping yet.
+func (pp *Peer) AveragePingMicros() int64 {
+	pp.StatsMtx.RLock()
+	defer pp.StatsMtx.RUnlock()
+
+	return pp.AvgPingMicros
+}
+
 func (pp *Peer) PingHandler() {
 	pp.startGroup.Done()
-	glog.V(1).Infof("Peer.PingHandler: Starting ping handler for Peer %v", pp)
+	pp.logger.V(1).Infof("Peer.PingHandler: Starting ping handler for Peer %v", pp)
 	pingTicker := time.NewTicker(pingInterval)
 	defer pingTicker.Stop()
 
@@ -766,10 +879,10 @@ out:
 	for {
 		select {
 		case <-pingTicker.C:
-			glog.V(2).Infof("Peer.PingHandler: Initiating ping for Peer %v", pp)
+			pp.logger.V(2).Infof("Peer.PingHandler: Initiating ping for Peer %v", pp)
 			nonce, err := wire.RandomUint64()
 			if err != nil {
-				glog.Errorf("Not sending ping to Peer %v: %v", pp, err)
+				pp.logger.Errorf("Not sending ping to Peer %v: %v", pp, err)
 				continue
 			}
 			// Update the ping stats when we initiate a ping.
@@ -843,6 +956,10 @@ func (pp *Peer) _handleOutExpectedResponse(msg DeSoMessage) {
 	// If we're sending the peer a GetBlocks message, we expect to receive the
 	// blocks at minimum within a few seconds of each other.
 	stallTimeout := time.Duration(int64(pp.stallTimeoutSeconds) * int64(time.Second))
+	blockStallTimeout := time.Duration(int64(pp.blockStallTimeoutSeconds) * int64(time.Second))
+	if blockStallTimeout == 0 {
+		blockStallTimeout = stallTimeout
+	}
 	switch msg.GetMsgType() {
 	case MsgTypeGetBlocks:
 		getBlocks := msg.(*MsgDeSoGetBlocks)
@@ -851,8 +968,16 @@ func (pp *Peer) _handleOutExpectedResponse(msg DeSoMessage) {
 			// Note there isn't really a way in the current code for us to request more
 			// blocks in a single bundle that we should expect in a single response, so
 			// we should be ok.
+			//
+			// The bundle arrives in a single message, so we give the peer one blockStallTimeout for
+			// every MaxBlocksInFlight blocks in it, up to the stallTimeout.
+			numBatches := 1 + len(getBlocks.HashList)/MaxBlocksInFlight
+			bundleTimeout := time.Duration(numBatches) * blockStallTimeout
+			if bundleTimeout > stallTimeout {
+				bundleTimeout = stallTimeout
+			}
 			pp._addExpectedResponse(&ExpectedResponse{
-				TimeExpected: time.Now().Add(stallTimeout),
+				TimeExpected: time.Now().Add(bundleTimeout),
 				MessageType:  MsgTypeBlockBundle,
 			})
 		} else {
@@ -860,11 +985,18 @@ func (pp *Peer) _handleOutExpectedResponse(msg DeSoMessage) {
 			for ii := range getBlocks.HashList {
 				pp._addExpectedResponse(&ExpectedResponse{
 					TimeExpected: time.Now().Add(
-						stallTimeout + time.Duration(int64(ii)*int64(stallTimeout))),
+						blockStallTimeout + time.Duration(int64(ii)*int64(blockStallTimeout))),
 					MessageType: MsgTypeBlock,
 				})
 			}
 		}
+	case MsgTypePing:
+		// If we're sending a Ping message, the Peer should respond with a Pong. If it
+		// doesn't, the connection is most likely dead.
+		pp._addExpectedResponse(&ExpectedResponse{
+			TimeExpected: time.Now().Add(pongTimeout),
+			MessageType:  MsgTypePong,
+		})
 	case MsgTypeGetHeaders:
 		// If we're sending a GetHeaders message, the Peer should respond within
 		// a few seconds with a HeaderBundle.
@@ -894,7 +1026,7 @@ func (pp *Peer) _handleOutExpectedResponse(msg DeSoMessage) {
 				isSrvNil := pp.srv == nil
 				isBlockchainNil := isSrvNil && pp.srv.blockchain == nil
 				isBlockTipNil := !isSrvNil && !isBlockchainNil && pp.srv.blockchain.blockTip() == nil
-				glog.Errorf(
+				pp.logger.Errorf(
 					"Peer._handleOutExpectedResponse: Recovered from panic: %v.\nsrv is nil: %t\nsrv.Blockchain is nil: %t\n,srv.Blockchain.BlockTip is nil: %t", r, isSrvNil, isBlockchainNil, isBlockTipNil)
 			}
 		}()
@@ -960,7 +1092,7 @@ func (pp *Peer) SetNegotiatedProtocolVersion(negotiatedProtocolVersion ProtocolV
 
 func (pp *Peer) outHandler() {
 	pp.startGroup.Done()
-	glog.V(1).Infof("Peer.outHandler: Starting outHandler for Peer %v", pp)
+	pp.logger.V(1).Infof("Peer.outHandler: Starting outHandler for Peer %v", pp)
 	stallTicker := time.NewTicker(time.Second)
 out:
 	for {
@@ -1021,9 +1153,9 @@ out:
 			}
 
 			// If we have a problem sending a message to a peer then disconnect them.
-			glog.V(3).Infof("Writing Message: (%v)", msg)
+			pp.logger.V(3).Infof("Writing Message: (%v)", msg)
 			if err := pp.WriteDeSoMessage(msg); err != nil {
-				glog.Errorf("Peer.outHandler: Problem sending message to peer: %v: %v", pp, err)
+				pp.logger.Errorf("Peer.outHandler: Problem sending message to peer: %v: %v", pp, err)
 				pp.Disconnect("outHandler - problem sending message to peer")
 			}
 		case <-stallTicker.C:
@@ -1039,7 +1171,7 @@ out:
 			firstEntry := pp.expectedResponses[0]
 			nowTime := time.Now()
 			if nowTime.After(firstEntry.TimeExpected) {
-				glog.Errorf("Peer.outHandler: Peer %v took too long to response to "+
+				pp.logger.Errorf("Peer.outHandler: Peer %v took too long to response to "+
 					"reqest. Expected MsgType=%v at time %v but it is now time %v",
 					pp, firstEntry.MessageType, firstEntry.TimeExpected, nowTime)
 				pp.Disconnect(fmt.Sprintf(
@@ -1052,7 +1184,7 @@ out:
 		}
 	}
 
-	glog.V(1).Infof("Peer.outHandler: Quitting outHandler for Peer %v", pp)
+	pp.logger.V(1).Infof("Peer.outHandler: Quitting outHandler for Peer %v", pp)
 }
 
 func (pp *Peer) _maybeAddBlocksToSend(msg DeSoMessage) error {
@@ -1138,7 +1270,8 @@ func (pp *Peer) _handleInExpectedResponse(rmsg DeSoMessage) error {
 		msgType == MsgTypeHeaderBundle ||
 		msgType == MsgTypeTransactionBundle ||
 		msgType == MsgTypeTransactionBundleV2 ||
-		msgType == MsgTypeSnapshotData {
+		msgType == MsgTypeSnapshotData ||
+		msgType == MsgTypePong {
 
 		expectedResponse := pp._removeEarliestExpectedResponse(msgType)
 		if expectedResponse == nil {
@@ -1146,7 +1279,7 @@ func (pp *Peer) _handleInExpectedResponse(rmsg DeSoMessage) error {
 			// requested it so disconnect the Peer in this case.
 			errRet := fmt.Errorf("_handleInExpectedResponse: Received unsolicited message "+
 				"of type %v %v from peer %v -- disconnecting", msgType, rmsg, pp)
-			glog.V(1).Infof(errRet.Error())
+			pp.logger.V(1).Infof(errRet.Error())
 			// TODO: Removing this check so we can inject transactions into the node.
 			//return errRet
 		}
@@ -1162,12 +1295,12 @@ func (pp *Peer) _handleInExpectedResponse(rmsg DeSoMessage) error {
 // goroutine.
 func (pp *Peer) inHandler() {
 	pp.startGroup.Done()
-	glog.V(1).Infof("Peer.inHandler: Starting inHandler for Peer %v", pp)
+	pp.logger.V(1).Infof("Peer.inHandler: Starting inHandler for Peer %v", pp)
 
 	// The timer is stopped when a new message is received and reset after it
 	// is processed.
 	idleTimer := time.AfterFunc(idleTimeout, func() {
-		glog.V(1).Infof("Peer.inHandler: Peer %v no answer for %v -- disconnecting", pp, idleTimeout)
+		pp.logger.V(1).Infof("Peer.inHandler: Peer %v no answer for %v -- disconnecting", pp, idleTimeout)
 		pp.Disconnect("inHandler - no answer for idleTimeout")
 	})
 
@@ -1179,7 +1312,7 @@ out:
 		rmsg, err := pp.ReadDeSoMessage()
 		idleTimer.Stop()
 		if err != nil {
-			glog.Errorf("Peer.inHandler: Can't read message from peer %v: %v", pp, err)
+			pp.logger.Errorf("Peer.inHandler: Can't read message from peer %v: %v", pp, err)
 
 			break out
 		}
@@ -1202,16 +1335,31 @@ out:
 		// If we receive a control message from a Peer then that Peer is misbehaving
 		// and we should disconnect. Control messages should never originate from Peers.
 		if IsControlMessage(rmsg.GetMsgType()) {
-			glog.Errorf("Peer.inHandler: Received control message of type %v from "+
+			pp.logger.Errorf("Peer.inHandler: Received control message of type %v from "+
 				"Peer %v; this should never happen. Disconnecting the Peer", rmsg.GetMsgType(), pp)
 			break out
 		}
 
+		// Drop requests that are over the Peer's budget, and disconnect the Peer if
+		// she keeps sending them.
+		if allowed, isAbusive := pp.requestRateLimiter.allowRequest(rmsg.GetMsgType(), time.Now()); !allowed {
+			if isAbusive {
+				pp.Disconnect("inHandler - request rate limit exceeded")
+				pp.logger.Errorf("Peer.inHandler: Disconnecting Peer %v because she keeps exceeding "+
+					"her rate limit for %v requests", pp, rmsg.GetMsgType())
+				break out
+			}
+			pp.logger.V(1).Infof("Peer.inHandler: Dropping %v request from Peer %v because it exceeds "+
+				"her rate limit", rmsg.GetMsgType(), pp)
+			idleTimer.Reset(idleTimeout)
+			continue
+		}
+
 		// Potentially adjust blocksToSend to account for blocks the Peer is
 		// currently requesting from us. Disconnect the Peer if she's requesting too many
 		// blocks now.
 		if err := pp._maybeAddBlocksToSend(rmsg); err != nil {
-			glog.Errorf(err.Error())
+			pp.logger.Errorf(err.Error())
 			break out
 		}
 
@@ -1229,17 +1377,19 @@ out:
 		case *MsgDeSoDisconnectedPeer, *MsgDeSoQuit:
 
 			// We should never receive control messages from a Peer. Disconnect if we do.
-			glog.Errorf("Peer.inHandler: Received control message of type %v from "+
+			pp.logger.Errorf("Peer.inHandler: Received control message of type %v from "+
 				"Peer %v which should never happen -- disconnecting", msg.GetMsgType(), pp)
 			break out
 
 		default:
 			// All other messages just forward back to the Server to handle them.
-			//glog.V(2).Infof("Peer.inHandler: Received message of type %v from %v", rmsg.GetMsgType(), pp)
-			pp.MessageChan <- &ServerMessage{
-				Peer: pp,
-				Msg:  msg,
-			}
+			cid := NewCorrelationID(pp.ID)
+			pp.logger.V(2).Infof("Peer.inHandler: [%v] Received message of type %v from %v", cid, rmsg.GetMsgType(), pp)
+			pp._forwardMessageToServer(&ServerMessage{
+				Peer:          pp,
+				Msg:           msg,
+				CorrelationID: cid,
+			})
 		}
 
 		// A message was received so reset the idle timer.
@@ -1252,11 +1402,11 @@ out:
 	// Disconnect the Peer if it isn't already.
 	pp.Disconnect("inHandler - done processing messages")
 
-	glog.V(1).Infof("Peer.inHandler: done for peer: %v", pp)
+	pp.logger.V(1).Infof("Peer.inHandler: done for peer: %v", pp)
 }
 
 func (pp *Peer) Start() {
-	glog.Infof("Peer.Start: Starting peer %v", pp)
+	pp.logger.Infof("Peer.Start: Starting peer %v", pp)
 	// The protocol has been negotiated successfully so start processing input
 	// and output messages.
 	pp.startGroup.Add(4)
@@ -1276,7 +1426,7 @@ func (pp *Peer) IsSyncCandidate() bool {
 	weRequireHypersync := (pp.syncType == NodeSyncTypeHyperSync ||
 		pp.syncType == NodeSyncTypeHyperSyncArchival)
 	if weRequireHypersync && !nodeSupportsHypersync {
-		glog.Infof("IsSyncCandidate: Rejecting node as sync candidate "+
+		pp.logger.Infof("IsSyncCandidate: Rejecting node as sync candidate "+
 			"because weRequireHypersync=true but nodeSupportsHypersync=false "+
 			"localAddr (%v), isFullNode (%v), "+
 			"nodeSupportsHypersync (%v), --sync-type (%v), weRequireHypersync (%v), "+
@@ -1291,7 +1441,7 @@ func (pp *Peer) IsSyncCandidate() bool {
 	weRequireArchival := IsNodeArchival(pp.syncType)
 	nodeIsArchival := (pp.serviceFlags & SFArchivalNode) != 0
 	if weRequireArchival && !nodeIsArchival {
-		glog.Infof("IsSyncCandidate: Rejecting node as sync candidate "+
+		pp.logger.Infof("IsSyncCandidate: Rejecting node as sync candidate "+
 			"because weRequireArchival=true but nodeIsArchival=false "+
 			"localAddr (%v), isFullNode (%v), "+
 			"nodeIsArchival (%v), --sync-type (%v), weRequireArchival (%v), "+
@@ -1319,7 +1469,7 @@ func (pp *Peer) WriteDeSoMessage(msg DeSoMessage) error {
 	// Useful for debugging.
 	// TODO: This may be too verbose
 	messageSeq := atomic.AddUint64(&pp.totalMessages, 1)
-	glog.V(3).Infof("SENDING( seq=%d ) message of type: %v to peer %v: %v",
+	pp.logger.V(3).Infof("SENDING( seq=%d ) message of type: %v to peer %v: %v",
 		messageSeq, msg.GetMsgType(), pp, msg)
 
 	return nil
@@ -1329,7 +1479,7 @@ func (pp *Peer) ReadDeSoMessage() (DeSoMessage, error) {
 	msg, payload, err := ReadMessage(pp.Conn, pp.Params.NetworkType)
 	if err != nil {
 		err := errors.Wrapf(err, "ReadDeSoMessage: ")
-		glog.Error(err)
+		pp.logger.Error(err)
 		return nil, err
 	}
 
@@ -1340,7 +1490,7 @@ func (pp *Peer) ReadDeSoMessage() (DeSoMessage, error) {
 
 	// Useful for debugging.
 	messageSeq := atomic.AddUint64(&pp.totalMessages, 1)
-	glog.V(3).Infof("RECEIVED( seq=%d ) message of type: %v from peer %v: %v",
+	pp.logger.V(3).Infof("RECEIVED( seq=%d ) message of type: %v from peer %v: %v",
 		messageSeq, msg.GetMsgType(), pp, msg)
 
 	return msg, nil
@@ -1351,15 +1501,15 @@ func (pp *Peer) ReadDeSoMessage() (DeSoMessage, error) {
 // Disconnect closes a peer's network connection.
 func (pp *Peer) Disconnect(reason string) {
 	// Only run the logic the first time Disconnect is called.
-	glog.V(0).Infof(CLog(Yellow, "Peer.Disconnect: Starting for Peer %v with reason: %v"), pp, reason)
+	pp.logger.V(0).Infof(CLog(Yellow, "Peer.Disconnect: Starting for Peer %v with reason: %v"), pp, reason)
 	if atomic.LoadInt32(&pp.disconnected) != 0 {
-		glog.V(1).Infof("Peer.Disconnect: Disconnect call ignored since it was already called before for Peer %v", pp)
+		pp.logger.V(1).Infof("Peer.Disconnect: Disconnect call ignored since it was already called before for Peer %v", pp)
 		return
 	}
 	atomic.AddInt32(&pp.disconnected, 1)
 	pp.disconnectReason = reason
 
-	glog.V(2).Infof("Peer.Disconnect: Running Disconnect for the first time for Peer %v", pp)
+	pp.logger.V(2).Infof("Peer.Disconnect: Running Disconnect for the first time for Peer %v", pp)
 
 	// Close the connection object.
 	pp.Conn.Close()
@@ -1385,7 +1535,7 @@ func (pp *Peer) _logVersionSuccess() {
 		persistentStr = "NON-PERSISTENT"
 	}
 	logStr := fmt.Sprintf("SUCCESS version negotiation for (%s) (%s) peer (%v).", inboundStr, persistentStr, pp)
-	glog.V(1).Info(logStr)
+	pp.logger.V(1).Info(logStr)
 }
 
 func (pp *Peer) _logAddPeer() {
@@ -1398,5 +1548,5 @@ func (pp *Peer) _logAddPeer() {
 		persistentStr = "NON-PERSISTENT"
 	}
 	logStr := fmt.Sprintf("ADDING (%s) (%s) peer (%v)", inboundStr, persistentStr, pp)
-	glog.V(1).Info(logStr)
+	pp.logger.V(1).Info(logStr)
 }
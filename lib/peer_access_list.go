@@ -0,0 +1,502 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// The PeerAccessList lets node operators ban and allow peers by IP address, by subnet, and by validator BLS
+// public key. Entries are stored in the DB under PrefixPeerAccessListEntry so they survive restarts, and they
+// can be given an expiry time after which they're ignored and eventually pruned. The NetworkManager checks
+// addresses against the list before accepting an inbound connection and before dialing an outbound one, and
+// checks validator public keys once the handshake has told us what they are.
+//
+// The rules are applied in the following order:
+//   - A target that matches an allow entry is always accepted. This lets operators carve an exception out of
+//     a banned subnet.
+//   - A target that matches a ban entry is rejected.
+//   - If there is at least one allow entry of the target's kind (address or public key), the list acts as an
+//     allowlist and every other target of that kind is rejected.
+//   - Otherwise, the target is accepted.
+
+// PeerAccessListType is whether an entry bans or allows its target.
+type PeerAccessListType uint8
+
+const (
+	PeerAccessListTypeBan   PeerAccessListType = 0
+	PeerAccessListTypeAllow PeerAccessListType = 1
+)
+
+func (listType PeerAccessListType) String() string {
+	switch listType {
+	case PeerAccessListTypeBan:
+		return "ban"
+	case PeerAccessListTypeAllow:
+		return "allow"
+	default:
+		return fmt.Sprintf("PeerAccessListType(%d)", uint8(listType))
+	}
+}
+
+// PeerAccessTargetType is the kind of target an entry matches.
+type PeerAccessTargetType uint8
+
+const (
+	// PeerAccessTargetTypeIP matches a single IP address.
+	PeerAccessTargetTypeIP PeerAccessTargetType = 0
+	// PeerAccessTargetTypeSubnet matches every IP address in a CIDR subnet.
+	PeerAccessTargetTypeSubnet PeerAccessTargetType = 1
+	// PeerAccessTargetTypePublicKey matches a validator by the BLS public key it presents in the handshake.
+	PeerAccessTargetTypePublicKey PeerAccessTargetType = 2
+)
+
+func (targetType PeerAccessTargetType) String() string {
+	switch targetType {
+	case PeerAccessTargetTypeIP:
+		return "ip"
+	case PeerAccessTargetTypeSubnet:
+		return "subnet"
+	case PeerAccessTargetTypePublicKey:
+		return "public_key"
+	default:
+		return fmt.Sprintf("PeerAccessTargetType(%d)", uint8(targetType))
+	}
+}
+
+// PeerAccessEntry is a single ban or allow rule.
+type PeerAccessEntry struct {
+	ListType   PeerAccessListType
+	TargetType PeerAccessTargetType
+	// Target is the canonical form of the target: the IP address as returned by net.IP.String, the subnet
+	// as returned by net.IPNet.String, or the BLS public key as returned by bls.PublicKey.ToString.
+	Target string
+	// CreatedAt is when the entry was added. ExpiresAt is when it stops applying. A zero ExpiresAt
+	// means the entry never expires.
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Reason    string
+}
+
+// NewPeerAccessEntry creates an entry for target, which can be an IP address, a CIDR subnet, or a BLS
+// public key. A duration of zero creates an entry that never expires.
+func NewPeerAccessEntry(
+	listType PeerAccessListType,
+	target string,
+	duration time.Duration,
+	reason string,
+) (*PeerAccessEntry, error) {
+	if listType != PeerAccessListTypeBan && listType != PeerAccessListTypeAllow {
+		return nil, fmt.Errorf("NewPeerAccessEntry: Unknown list type %v", listType)
+	}
+	if duration < 0 {
+		return nil, fmt.Errorf("NewPeerAccessEntry: Duration %v is negative", duration)
+	}
+	targetType, canonicalTarget, err := ParsePeerAccessTarget(target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewPeerAccessEntry: ")
+	}
+	now := time.Now()
+	entry := &PeerAccessEntry{
+		ListType:   listType,
+		TargetType: targetType,
+		Target:     canonicalTarget,
+		CreatedAt:  now,
+		Reason:     reason,
+	}
+	if duration != 0 {
+		entry.ExpiresAt = now.Add(duration)
+	}
+	return entry, nil
+}
+
+// ParsePeerAccessTarget figures out whether target is an IP address, a CIDR subnet, or a BLS public key, and
+// returns its canonical form. BLS public keys are given as hex strings, optionally prefixed with 0x.
+func ParsePeerAccessTarget(target string) (PeerAccessTargetType, string, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return 0, "", fmt.Errorf("ParsePeerAccessTarget: Target is empty")
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		return PeerAccessTargetTypeIP, ip.String(), nil
+	}
+	if strings.Contains(target, "/") {
+		_, subnet, err := net.ParseCIDR(target)
+		if err != nil {
+			return 0, "", errors.Wrapf(err, "ParsePeerAccessTarget: Problem parsing subnet %v", target)
+		}
+		return PeerAccessTargetTypeSubnet, subnet.String(), nil
+	}
+	publicKey, err := (&bls.PublicKey{}).FromString(target)
+	if err != nil || publicKey == nil {
+		return 0, "", fmt.Errorf("ParsePeerAccessTarget: Target %v is not an IP address, a subnet, "+
+			"or a BLS public key", target)
+	}
+	return PeerAccessTargetTypePublicKey, publicKey.ToString(), nil
+}
+
+// IsExpired returns true if the entry has an expiry time that is at or before now.
+func (entry *PeerAccessEntry) IsExpired(now time.Time) bool {
+	return !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt)
+}
+
+func (entry *PeerAccessEntry) isAddressEntry() bool {
+	return entry.TargetType == PeerAccessTargetTypeIP || entry.TargetType == PeerAccessTargetTypeSubnet
+}
+
+// matchesIP returns true if the entry is an address entry that covers ip.
+func (entry *PeerAccessEntry) matchesIP(ip net.IP) bool {
+	switch entry.TargetType {
+	case PeerAccessTargetTypeIP:
+		return ip.Equal(net.ParseIP(entry.Target))
+	case PeerAccessTargetTypeSubnet:
+		_, subnet, err := net.ParseCIDR(entry.Target)
+		return err == nil && subnet.Contains(ip)
+	default:
+		return false
+	}
+}
+
+func (entry *PeerAccessEntry) ToBytes() []byte {
+	var data []byte
+	data = append(data, byte(entry.ListType))
+	data = append(data, byte(entry.TargetType))
+	data = append(data, EncodeByteArray([]byte(entry.Target))...)
+	data = append(data, UintToBuf(timeToUnixNanos(entry.CreatedAt))...)
+	data = append(data, UintToBuf(timeToUnixNanos(entry.ExpiresAt))...)
+	data = append(data, EncodeByteArray([]byte(entry.Reason))...)
+	return data
+}
+
+func (entry *PeerAccessEntry) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	listType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "PeerAccessEntry.FromBytes: Problem reading ListType")
+	}
+	entry.ListType = PeerAccessListType(listType)
+	targetType, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "PeerAccessEntry.FromBytes: Problem reading TargetType")
+	}
+	entry.TargetType = PeerAccessTargetType(targetType)
+	target, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "PeerAccessEntry.FromBytes: Problem reading Target")
+	}
+	entry.Target = string(target)
+	createdAt, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "PeerAccessEntry.FromBytes: Problem reading CreatedAt")
+	}
+	entry.CreatedAt = unixNanosToTime(createdAt)
+	expiresAt, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "PeerAccessEntry.FromBytes: Problem reading ExpiresAt")
+	}
+	entry.ExpiresAt = unixNanosToTime(expiresAt)
+	reason, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "PeerAccessEntry.FromBytes: Problem reading Reason")
+	}
+	entry.Reason = string(reason)
+	return nil
+}
+
+// timeToUnixNanos and unixNanosToTime map the zero time to 0 and back, so that entries that never expire
+// round trip through the DB.
+func timeToUnixNanos(tt time.Time) uint64 {
+	if tt.IsZero() {
+		return 0
+	}
+	return uint64(tt.UnixNano())
+}
+
+func unixNanosToTime(nanos uint64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
+
+// PeerAccessList holds the ban and allow entries in memory and writes them through to the DB. It is safe for
+// concurrent use.
+type PeerAccessList struct {
+	mtx sync.RWMutex
+
+	// db is where the entries are persisted. If it's nil, the entries are kept in memory only.
+	db *badger.DB
+	// entries maps the DB key of each entry to the entry.
+	entries map[string]*PeerAccessEntry
+}
+
+// NewPeerAccessList creates a list that persists its entries to db. If db is nil, the entries are kept in
+// memory only. Any entries previously saved to db are loaded.
+func NewPeerAccessList(db *badger.DB) (*PeerAccessList, error) {
+	accessList := &PeerAccessList{
+		db:      db,
+		entries: make(map[string]*PeerAccessEntry),
+	}
+	if db == nil {
+		return accessList, nil
+	}
+	entries, err := DBGetPeerAccessEntries(db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewPeerAccessList: Problem loading peer access list")
+	}
+	for _, entry := range entries {
+		accessList.entries[string(DBKeyForPeerAccessEntry(entry.ListType, entry.TargetType, entry.Target))] = entry
+	}
+	return accessList, nil
+}
+
+// AddEntry adds entry to the list, replacing any entry with the same list type and target.
+func (accessList *PeerAccessList) AddEntry(entry *PeerAccessEntry) error {
+	if entry == nil {
+		return fmt.Errorf("PeerAccessList.AddEntry: Entry is nil")
+	}
+	key := DBKeyForPeerAccessEntry(entry.ListType, entry.TargetType, entry.Target)
+
+	accessList.mtx.Lock()
+	defer accessList.mtx.Unlock()
+
+	if accessList.db != nil {
+		err := accessList.db.Update(func(txn *badger.Txn) error {
+			return DBPutPeerAccessEntryWithTxn(txn, entry)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "PeerAccessList.AddEntry: ")
+		}
+	}
+	accessList.entries[string(key)] = entry
+	return nil
+}
+
+// RemoveEntry removes the entry with the given list type and target. Target is parsed the same way as in
+// NewPeerAccessEntry. It returns false if there was no such entry.
+func (accessList *PeerAccessList) RemoveEntry(listType PeerAccessListType, target string) (bool, error) {
+	targetType, canonicalTarget, err := ParsePeerAccessTarget(target)
+	if err != nil {
+		return false, errors.Wrapf(err, "PeerAccessList.RemoveEntry: ")
+	}
+	key := DBKeyForPeerAccessEntry(listType, targetType, canonicalTarget)
+
+	accessList.mtx.Lock()
+	defer accessList.mtx.Unlock()
+
+	if _, exists := accessList.entries[string(key)]; !exists {
+		return false, nil
+	}
+	if accessList.db != nil {
+		err = accessList.db.Update(func(txn *badger.Txn) error {
+			return DBDeletePeerAccessEntryWithTxn(txn, listType, targetType, canonicalTarget)
+		})
+		if err != nil {
+			return false, errors.Wrapf(err, "PeerAccessList.RemoveEntry: ")
+		}
+	}
+	delete(accessList.entries, string(key))
+	return true, nil
+}
+
+// GetEntries returns a copy of the entries that haven't expired, sorted by list type, target type, and target.
+func (accessList *PeerAccessList) GetEntries() []*PeerAccessEntry {
+	accessList.mtx.RLock()
+	defer accessList.mtx.RUnlock()
+
+	now := time.Now()
+	var entries []*PeerAccessEntry
+	for _, entry := range accessList.entries {
+		if entry.IsExpired(now) {
+			continue
+		}
+		entryCopy := *entry
+		entries = append(entries, &entryCopy)
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		if entries[ii].ListType != entries[jj].ListType {
+			return entries[ii].ListType < entries[jj].ListType
+		}
+		if entries[ii].TargetType != entries[jj].TargetType {
+			return entries[ii].TargetType < entries[jj].TargetType
+		}
+		return entries[ii].Target < entries[jj].Target
+	})
+	return entries
+}
+
+// PruneExpired deletes the entries that have expired from the list and from the DB.
+func (accessList *PeerAccessList) PruneExpired() error {
+	accessList.mtx.Lock()
+	defer accessList.mtx.Unlock()
+
+	now := time.Now()
+	var expiredKeys []string
+	for key, entry := range accessList.entries {
+		if entry.IsExpired(now) {
+			expiredKeys = append(expiredKeys, key)
+		}
+	}
+	if len(expiredKeys) == 0 {
+		return nil
+	}
+	if accessList.db != nil {
+		err := accessList.db.Update(func(txn *badger.Txn) error {
+			for _, key := range expiredKeys {
+				entry := accessList.entries[key]
+				if err := DBDeletePeerAccessEntryWithTxn(txn, entry.ListType, entry.TargetType, entry.Target); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "PeerAccessList.PruneExpired: ")
+		}
+	}
+	for _, key := range expiredKeys {
+		delete(accessList.entries, key)
+	}
+	glog.V(1).Infof("PeerAccessList.PruneExpired: Pruned %d expired entries", len(expiredKeys))
+	return nil
+}
+
+// CheckIP returns an error if connections to or from ip aren't allowed. A nil ip, such as the IP of a
+// Tor address, doesn't match any address entry.
+func (accessList *PeerAccessList) CheckIP(ip net.IP) error {
+	accessList.mtx.RLock()
+	defer accessList.mtx.RUnlock()
+
+	now := time.Now()
+	var banEntry *PeerAccessEntry
+	hasAllowEntries := false
+	for _, entry := range accessList.entries {
+		if !entry.isAddressEntry() || entry.IsExpired(now) {
+			continue
+		}
+		if entry.ListType == PeerAccessListTypeAllow {
+			hasAllowEntries = true
+		}
+		if ip == nil || !entry.matchesIP(ip) {
+			continue
+		}
+		if entry.ListType == PeerAccessListTypeAllow {
+			return nil
+		}
+		banEntry = entry
+	}
+	if banEntry != nil {
+		return fmt.Errorf("PeerAccessList.CheckIP: IP %v is banned by %v %v (reason: %v)",
+			ip, banEntry.TargetType, banEntry.Target, banEntry.Reason)
+	}
+	if hasAllowEntries {
+		return fmt.Errorf("PeerAccessList.CheckIP: IP %v is not on the allowlist", ip)
+	}
+	return nil
+}
+
+// CheckPublicKey returns an error if connections with the validator with publicKey aren't allowed. A nil
+// publicKey, as presented by a non-validator, is always allowed.
+func (accessList *PeerAccessList) CheckPublicKey(publicKey *bls.PublicKey) error {
+	if publicKey == nil {
+		return nil
+	}
+	target := publicKey.ToString()
+
+	accessList.mtx.RLock()
+	defer accessList.mtx.RUnlock()
+
+	now := time.Now()
+	isBanned := false
+	hasAllowEntries := false
+	for _, entry := range accessList.entries {
+		if entry.TargetType != PeerAccessTargetTypePublicKey || entry.IsExpired(now) {
+			continue
+		}
+		if entry.ListType == PeerAccessListTypeAllow {
+			hasAllowEntries = true
+		}
+		if entry.Target != target {
+			continue
+		}
+		if entry.ListType == PeerAccessListTypeAllow {
+			return nil
+		}
+		isBanned = true
+	}
+	if isBanned {
+		return fmt.Errorf("PeerAccessList.CheckPublicKey: Public key %v is banned", publicKey.ToAbbreviatedString())
+	}
+	if hasAllowEntries {
+		return fmt.Errorf("PeerAccessList.CheckPublicKey: Public key %v is not on the allowlist",
+			publicKey.ToAbbreviatedString())
+	}
+	return nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForPeerAccessEntry(listType PeerAccessListType, targetType PeerAccessTargetType, target string) []byte {
+	data := append([]byte{}, Prefixes.PrefixPeerAccessListEntry...)
+	data = append(data, byte(listType), byte(targetType))
+	data = append(data, []byte(target)...)
+	return data
+}
+
+func DBGetPeerAccessEntries(handle *badger.DB) ([]*PeerAccessEntry, error) {
+	var entries []*PeerAccessEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = Prefixes.PrefixPeerAccessListEntry
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(opts.Prefix); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry := &PeerAccessEntry{}
+			if err = entry.FromBytes(entryBytes); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetPeerAccessEntries: Problem retrieving entries")
+	}
+	return entries, nil
+}
+
+func DBPutPeerAccessEntryWithTxn(txn *badger.Txn, entry *PeerAccessEntry) error {
+	key := DBKeyForPeerAccessEntry(entry.ListType, entry.TargetType, entry.Target)
+	if err := txn.Set(key, entry.ToBytes()); err != nil {
+		return errors.Wrapf(err, "DBPutPeerAccessEntryWithTxn: Problem setting entry")
+	}
+	return nil
+}
+
+func DBDeletePeerAccessEntryWithTxn(
+	txn *badger.Txn,
+	listType PeerAccessListType,
+	targetType PeerAccessTargetType,
+	target string,
+) error {
+	if err := txn.Delete(DBKeyForPeerAccessEntry(listType, targetType, target)); err != nil {
+		return errors.Wrapf(err, "DBDeletePeerAccessEntryWithTxn: Problem deleting entry")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeerAccessTarget(t *testing.T) {
+	require := require.New(t)
+
+	targetType, target, err := ParsePeerAccessTarget(" 1.2.3.4 ")
+	require.NoError(err)
+	require.Equal(PeerAccessTargetTypeIP, targetType)
+	require.Equal("1.2.3.4", target)
+
+	targetType, target, err = ParsePeerAccessTarget("10.1.2.3/16")
+	require.NoError(err)
+	require.Equal(PeerAccessTargetTypeSubnet, targetType)
+	require.Equal("10.1.0.0/16", target)
+
+	targetType, target, err = ParsePeerAccessTarget("2001:db8::1")
+	require.NoError(err)
+	require.Equal(PeerAccessTargetTypeIP, targetType)
+	require.Equal("2001:db8::1", target)
+
+	publicKey := _generateRandomBLSPrivateKey(t).PublicKey()
+	targetType, target, err = ParsePeerAccessTarget(publicKey.ToString()[2:])
+	require.NoError(err)
+	require.Equal(PeerAccessTargetTypePublicKey, targetType)
+	require.Equal(publicKey.ToString(), target)
+
+	for _, badTarget := range []string{"", "10.1.2.3/99", "not a peer"} {
+		_, _, err = ParsePeerAccessTarget(badTarget)
+		require.Error(err, badTarget)
+	}
+}
+
+func TestPeerAccessList(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	accessList, err := NewPeerAccessList(db)
+	require.NoError(err)
+
+	addEntry := func(listType PeerAccessListType, target string, duration time.Duration) {
+		entry, err := NewPeerAccessEntry(listType, target, duration, "test")
+		require.NoError(err)
+		require.NoError(accessList.AddEntry(entry))
+	}
+
+	// An empty list allows everything.
+	require.NoError(accessList.CheckIP(net.ParseIP("10.1.2.3")))
+	require.NoError(accessList.CheckIP(nil))
+	bannedPublicKey := _generateRandomBLSPrivateKey(t).PublicKey()
+	otherPublicKey := _generateRandomBLSPrivateKey(t).PublicKey()
+	require.NoError(accessList.CheckPublicKey(bannedPublicKey))
+
+	// Bans apply to single IPs, subnets, and public keys.
+	addEntry(PeerAccessListTypeBan, "1.2.3.4", 0)
+	addEntry(PeerAccessListTypeBan, "10.1.0.0/16", 0)
+	addEntry(PeerAccessListTypeBan, bannedPublicKey.ToString(), 0)
+	require.Error(accessList.CheckIP(net.ParseIP("1.2.3.4")))
+	require.Error(accessList.CheckIP(net.ParseIP("10.1.2.3")))
+	require.NoError(accessList.CheckIP(net.ParseIP("10.2.2.3")))
+	require.Error(accessList.CheckPublicKey(bannedPublicKey))
+	require.NoError(accessList.CheckPublicKey(otherPublicKey))
+	require.NoError(accessList.CheckPublicKey(nil))
+
+	// An allow entry carves an exception out of a banned subnet, and turns the address list into an allowlist.
+	addEntry(PeerAccessListTypeAllow, "10.1.2.3", 0)
+	require.NoError(accessList.CheckIP(net.ParseIP("10.1.2.3")))
+	require.Error(accessList.CheckIP(net.ParseIP("10.1.2.4")))
+	require.Error(accessList.CheckIP(net.ParseIP("10.2.2.3")))
+	require.Error(accessList.CheckIP(nil))
+	// The public key list isn't affected by address allow entries.
+	require.NoError(accessList.CheckPublicKey(otherPublicKey))
+
+	// Expired entries are ignored, and pruned.
+	addEntry(PeerAccessListTypeBan, "5.6.7.8", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	require.Len(accessList.GetEntries(), 4)
+	require.NoError(accessList.PruneExpired())
+	dbEntries, err := DBGetPeerAccessEntries(db)
+	require.NoError(err)
+	require.Len(dbEntries, 4)
+
+	// The entries survive a restart.
+	reloaded, err := NewPeerAccessList(db)
+	require.NoError(err)
+	reloadedEntries := reloaded.GetEntries()
+	require.Len(reloadedEntries, 4)
+	for ii, entry := range accessList.GetEntries() {
+		require.Equal(entry.ListType, reloadedEntries[ii].ListType)
+		require.Equal(entry.Target, reloadedEntries[ii].Target)
+		require.True(entry.CreatedAt.Equal(reloadedEntries[ii].CreatedAt))
+	}
+	require.Error(reloaded.CheckIP(net.ParseIP("1.2.3.4")))
+
+	// Removing the allow entry restores the previous behavior.
+	removed, err := reloaded.RemoveEntry(PeerAccessListTypeAllow, "10.1.2.3")
+	require.NoError(err)
+	require.True(removed)
+	removed, err = reloaded.RemoveEntry(PeerAccessListTypeAllow, "10.1.2.3")
+	require.NoError(err)
+	require.False(removed)
+	require.Error(reloaded.CheckIP(net.ParseIP("10.1.2.3")))
+	require.NoError(reloaded.CheckIP(net.ParseIP("10.2.2.3")))
+	dbEntries, err = DBGetPeerAccessEntries(db)
+	require.NoError(err)
+	require.Len(dbEntries, 3)
+
+	// Entries round trip through their byte encoding.
+	entry, err := NewPeerAccessEntry(PeerAccessListTypeBan, "1.2.3.4", time.Hour, "spam")
+	require.NoError(err)
+	decodedEntry := &PeerAccessEntry{}
+	require.NoError(decodedEntry.FromBytes(entry.ToBytes()))
+	require.Equal(entry.Target, decodedEntry.Target)
+	require.Equal(entry.Reason, decodedEntry.Reason)
+	require.True(entry.ExpiresAt.Equal(decodedEntry.ExpiresAt))
+
+	// In-memory lists work without a DB.
+	inMemory, err := NewPeerAccessList(nil)
+	require.NoError(err)
+	banEntry, err := NewPeerAccessEntry(PeerAccessListTypeBan, bannedPublicKey.ToString(), 0, "")
+	require.NoError(err)
+	require.NoError(inMemory.AddEntry(banEntry))
+	require.Error(inMemory.CheckPublicKey(bannedPublicKey))
+}
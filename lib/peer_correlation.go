@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// CorrelationID identifies an inbound peer message in the logs. The Peer assigns one to every message it
+// forwards to the Server, and the ID is carried along to the goroutines that handle the message and to the
+// messages we send because of it. For example, a GetBlocks message, the blocks we send in response, and, on
+// the other node, the validation of those blocks and the next GetBlocks it sends all log the ID of the message
+// that caused them. Grepping the logs for an ID follows a single sync conversation across goroutines.
+//
+// IDs have the form <peer ID>-<sequence number>, and the sequence number is unique across all peers for the
+// lifetime of the process. The zero value means that there's no inbound message to attribute the work to, e.g.
+// for requests we make on our own.
+type CorrelationID string
+
+// correlationIDCounter is the sequence number of the last CorrelationID we assigned.
+var correlationIDCounter uint64
+
+// NewCorrelationID assigns a new CorrelationID to a message received from the peer with the given ID.
+func NewCorrelationID(peerID uint64) CorrelationID {
+	return CorrelationID(fmt.Sprintf("%d-%d", peerID, atomic.AddUint64(&correlationIDCounter, 1)))
+}
+
+func (cid CorrelationID) String() string {
+	if cid == "" {
+		return "none"
+	}
+	return string(cid)
+}
@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCorrelationID(t *testing.T) {
+	require := require.New(t)
+
+	cid1 := NewCorrelationID(7)
+	cid2 := NewCorrelationID(7)
+	cid3 := NewCorrelationID(8)
+
+	// IDs are prefixed with the peer ID and never repeat, even across peers.
+	require.True(strings.HasPrefix(cid1.String(), "7-"))
+	require.True(strings.HasPrefix(cid2.String(), "7-"))
+	require.True(strings.HasPrefix(cid3.String(), "8-"))
+	require.NotEqual(cid1, cid2)
+	require.NotEqual(strings.TrimPrefix(cid2.String(), "7-"), strings.TrimPrefix(cid3.String(), "8-"))
+
+	// The zero value means there's no message to attribute the work to.
+	require.Equal("none", CorrelationID("").String())
+}
@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// PeerDialer opens the outbound connections to peers. By default, peers are dialed directly. Operators that want to
+// hide their node's IP address can route outbound connections through a SOCKS5 proxy, such as a local Tor daemon:
+//   - The global proxy is used for all outbound connections.
+//   - The onion proxy is used for .onion addresses. If it isn't set, .onion addresses are dialed through the global
+//     proxy. If neither is set, .onion addresses are unreachable, and the address manager's .onion addresses are
+//     skipped when picking peers to connect to.
+//   - A per-peer proxy overrides the other proxies for the peer with the given address.
+//
+// Note that the proxies only apply to outbound connections. Inbound connections are accepted on the node's listeners
+// as usual, so an operator running a Tor hidden service should bind the listeners to localhost.
+type PeerDialer struct {
+	proxyDialer      proxy.Dialer
+	onionProxyDialer proxy.Dialer
+	// peerProxyDialers maps an address key, as returned by addrmgr.NetAddressKey, to the proxy for that peer.
+	peerProxyDialers map[string]proxy.Dialer
+}
+
+// NewPeerDialer creates a PeerDialer. The proxy addresses are host:port strings, and an empty address means no
+// proxy. The username and password authenticate to the global proxy, and are ignored if empty. Tor uses the
+// credentials to isolate streams, so different credentials result in different circuits. peerProxies are
+// "peerHost:peerPort=proxyHost:proxyPort" strings.
+func NewPeerDialer(proxyAddr string, proxyUser string, proxyPass string, onionProxyAddr string,
+	peerProxies []string, addrMgr *addrmgr.AddrManager, params *DeSoParams) (*PeerDialer, error) {
+
+	pd := &PeerDialer{
+		peerProxyDialers: make(map[string]proxy.Dialer),
+	}
+
+	var err error
+	if proxyAddr != "" {
+		var auth *proxy.Auth
+		if proxyUser != "" || proxyPass != "" {
+			auth = &proxy.Auth{User: proxyUser, Password: proxyPass}
+		}
+		if pd.proxyDialer, err = newSOCKS5Dialer(proxyAddr, auth); err != nil {
+			return nil, errors.Wrapf(err, "NewPeerDialer: Problem creating proxy dialer")
+		}
+	}
+	if onionProxyAddr != "" {
+		if pd.onionProxyDialer, err = newSOCKS5Dialer(onionProxyAddr, nil); err != nil {
+			return nil, errors.Wrapf(err, "NewPeerDialer: Problem creating onion proxy dialer")
+		}
+	}
+	for _, peerProxy := range peerProxies {
+		peerAddr, peerProxyAddr, found := strings.Cut(peerProxy, "=")
+		if !found || peerAddr == "" || peerProxyAddr == "" {
+			return nil, errors.Errorf("NewPeerDialer: Peer proxy %v must be in the form "+
+				"peerHost:peerPort=proxyHost:proxyPort", peerProxy)
+		}
+		netAddr, err := IPToNetAddr(peerAddr, addrMgr, params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewPeerDialer: Problem parsing peer address %v", peerAddr)
+		}
+		peerProxyDialer, err := newSOCKS5Dialer(peerProxyAddr, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewPeerDialer: Problem creating proxy dialer for peer %v", peerAddr)
+		}
+		pd.peerProxyDialers[addrmgr.NetAddressKey(netAddr)] = peerProxyDialer
+	}
+	return pd, nil
+}
+
+func newSOCKS5Dialer(proxyAddr string, auth *proxy.Auth) (proxy.Dialer, error) {
+	if _, _, err := net.SplitHostPort(proxyAddr); err != nil {
+		return nil, errors.Wrapf(err, "newSOCKS5Dialer: Proxy address %v must be in the form host:port", proxyAddr)
+	}
+	return proxy.SOCKS5("tcp", proxyAddr, auth, proxy.Direct)
+}
+
+// isOnionAddress returns true if the address is a Tor hidden service.
+func isOnionAddress(netAddr *wire.NetAddressV2) bool {
+	return netAddr.IsTorV3() || addrmgr.IsOnionCatTor(netAddr.ToLegacy())
+}
+
+// getDialer returns the proxy to dial the address through, or nil if the address should be dialed directly. It
+// returns false if the address cannot be reached.
+func (pd *PeerDialer) getDialer(netAddr *wire.NetAddressV2) (_dialer proxy.Dialer, _reachable bool) {
+	if pd == nil {
+		return nil, !isOnionAddress(netAddr)
+	}
+	if peerProxyDialer, exists := pd.peerProxyDialers[addrmgr.NetAddressKey(netAddr)]; exists {
+		return peerProxyDialer, true
+	}
+	if isOnionAddress(netAddr) {
+		if pd.onionProxyDialer != nil {
+			return pd.onionProxyDialer, true
+		}
+		return pd.proxyDialer, pd.proxyDialer != nil
+	}
+	return pd.proxyDialer, true
+}
+
+// IsReachable returns true if the dialer can connect to the address.
+func (pd *PeerDialer) IsReachable(netAddr *wire.NetAddressV2) bool {
+	_, reachable := pd.getDialer(netAddr)
+	return reachable
+}
+
+// Dial connects to the address, giving up after timeout. It is safe to call Dial on a nil PeerDialer, in which case
+// the address is dialed directly.
+func (pd *PeerDialer) Dial(netAddr *wire.NetAddressV2, timeout time.Duration) (net.Conn, error) {
+	dialer, reachable := pd.getDialer(netAddr)
+	if !reachable {
+		return nil, errors.Errorf("PeerDialer.Dial: Address %v is a .onion address but no proxy is configured",
+			addrmgr.NetAddressKey(netAddr))
+	}
+
+	// For .onion addresses, this passes the hostname to the proxy, which resolves it.
+	addr := addrmgr.NetAddressKey(netAddr)
+	if dialer == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+
+	// The SOCKS5 dialer waits for the proxy to connect to the peer, which for Tor can take a while, so the timeout
+	// covers the whole handshake.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, errors.New("PeerDialer.Dial: Proxy dialer does not support timeouts")
+	}
+	conn, err := contextDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "PeerDialer.Dial: Problem dialing %v through proxy", addr)
+	}
+	return conn, nil
+}
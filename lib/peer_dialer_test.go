@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestSOCKS5Proxy starts a minimal SOCKS5 proxy that accepts unauthenticated CONNECT requests,
+// reports each requested host:port on requestedAddrChan, and echoes back whatever the client sends.
+func startTestSOCKS5Proxy(t *testing.T, requestedAddrChan chan string) net.Listener {
+	ll, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := ll.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				// Greeting: version, number of methods, methods. We reply with "no authentication".
+				greeting := make([]byte, 3)
+				if _, err := io.ReadFull(conn, greeting); err != nil {
+					return
+				}
+				if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+					return
+				}
+				// Request: version, CONNECT, reserved, address type, address, port. The address is either an IPv4
+				// address or a length-prefixed domain name.
+				header := make([]byte, 4)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				var host string
+				switch header[3] {
+				case 0x01:
+					ip := make([]byte, 4)
+					if _, err := io.ReadFull(conn, ip); err != nil {
+						return
+					}
+					host = net.IP(ip).String()
+				case 0x03:
+					hostLen := make([]byte, 1)
+					if _, err := io.ReadFull(conn, hostLen); err != nil {
+						return
+					}
+					hostBytes := make([]byte, hostLen[0])
+					if _, err := io.ReadFull(conn, hostBytes); err != nil {
+						return
+					}
+					host = string(hostBytes)
+				default:
+					return
+				}
+				portBytes := make([]byte, 2)
+				if _, err := io.ReadFull(conn, portBytes); err != nil {
+					return
+				}
+				port := int(portBytes[0])<<8 | int(portBytes[1])
+				requestedAddrChan <- net.JoinHostPort(host, strconv.Itoa(port))
+				if _, err := conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+					return
+				}
+				io.Copy(conn, conn)
+			}(conn)
+		}
+	}()
+	return ll
+}
+
+func TestPeerDialer(t *testing.T) {
+	require := require.New(t)
+	params := &DeSoTestnetParams
+	addrMgr := addrmgr.New("", net.LookupIP)
+
+	ipAddr, err := IPToNetAddr("127.0.0.1:17000", addrMgr, params)
+	require.NoError(err)
+	otherIpAddr, err := IPToNetAddr("127.0.0.2:17000", addrMgr, params)
+	require.NoError(err)
+	onionAddr := wire.NetAddressV2FromBytes(time.Now(), 0, RandomBytes(wire.TorV3Size), 17000)
+	require.True(isOnionAddress(onionAddr))
+	require.False(isOnionAddress(ipAddr))
+
+	// The address manager parses .onion hosts into the same address.
+	parsedOnionAddr, err := IPToNetAddr(addrmgr.NetAddressKey(onionAddr), addrMgr, params)
+	require.NoError(err)
+	require.Equal(addrmgr.NetAddressKey(onionAddr), addrmgr.NetAddressKey(parsedOnionAddr))
+
+	// Without a proxy, IP addresses are dialed directly and .onion addresses are unreachable.
+	var nilDialer *PeerDialer
+	require.True(nilDialer.IsReachable(ipAddr))
+	require.False(nilDialer.IsReachable(onionAddr))
+	noProxyDialer, err := NewPeerDialer("", "", "", "", nil, addrMgr, params)
+	require.NoError(err)
+	require.True(noProxyDialer.IsReachable(ipAddr))
+	require.False(noProxyDialer.IsReachable(onionAddr))
+	_, err = noProxyDialer.Dial(onionAddr, time.Second)
+	require.Error(err)
+
+	// Invalid proxy configurations are rejected.
+	_, err = NewPeerDialer("127.0.0.1", "", "", "", nil, addrMgr, params)
+	require.Error(err)
+	_, err = NewPeerDialer("", "", "", "", []string{"127.0.0.1:17000"}, addrMgr, params)
+	require.Error(err)
+
+	requestedAddrChan := make(chan string, 10)
+	proxyListener := startTestSOCKS5Proxy(t, requestedAddrChan)
+	defer proxyListener.Close()
+	proxyAddr := proxyListener.Addr().String()
+
+	dialAndEcho := func(dialer *PeerDialer, netAddr *wire.NetAddressV2) {
+		conn, err := dialer.Dial(netAddr, time.Second)
+		require.NoError(err)
+		defer conn.Close()
+		require.Equal(addrmgr.NetAddressKey(netAddr), <-requestedAddrChan)
+		_, err = conn.Write([]byte("deso"))
+		require.NoError(err)
+		reply := make([]byte, 4)
+		_, err = io.ReadFull(conn, reply)
+		require.NoError(err)
+		require.Equal("deso", string(reply))
+	}
+
+	// With an onion proxy, .onion addresses go through the proxy, and the proxy resolves the hostname.
+	onionProxyDialer, err := NewPeerDialer("", "", "", proxyAddr, nil, addrMgr, params)
+	require.NoError(err)
+	require.True(onionProxyDialer.IsReachable(onionAddr))
+	dialAndEcho(onionProxyDialer, onionAddr)
+	dialer, _ := onionProxyDialer.getDialer(ipAddr)
+	require.Nil(dialer)
+
+	// With a per-peer proxy, only that peer goes through the proxy.
+	peerProxyDialer, err := NewPeerDialer("", "", "", "", []string{"127.0.0.2:17000=" + proxyAddr}, addrMgr, params)
+	require.NoError(err)
+	dialAndEcho(peerProxyDialer, otherIpAddr)
+	dialer, _ = peerProxyDialer.getDialer(ipAddr)
+	require.Nil(dialer)
+	require.False(peerProxyDialer.IsReachable(onionAddr))
+
+	// With a global proxy, every address goes through the proxy.
+	globalProxyDialer, err := NewPeerDialer(proxyAddr, "", "", "", nil, addrMgr, params)
+	require.NoError(err)
+	dialAndEcho(globalProxyDialer, ipAddr)
+	dialAndEcho(globalProxyDialer, onionAddr)
+}
@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeerRequestRateLimit is the budget a peer has for one type of request: it can send RequestsPerSecond requests
+// on average, and up to Burst requests at once. A RequestsPerSecond of zero means the requests aren't limited.
+type PeerRequestRateLimit struct {
+	RequestsPerSecond float64
+	Burst             uint64
+}
+
+const (
+	// peerRequestRateLimitViolationWindow and peerRequestRateLimitMaxViolations define sustained abuse: a peer
+	// whose requests are dropped for exceeding their budget peerRequestRateLimitMaxViolations times within one
+	// window is disconnected. Well-behaved peers wait for a reply before sending their next request, so they
+	// should only ever exceed their budget by a few requests.
+	peerRequestRateLimitViolationWindow = time.Minute
+	peerRequestRateLimitMaxViolations   = 50
+)
+
+// DefaultPeerRequestRateLimits returns the budgets of the requests that are expensive to serve. Serving a
+// GetSnapshot request reads up to SnapshotBatchSize bytes of state, so its budget is the tightest, but its burst
+// still leaves room for a peer that pipelines HypersyncDefaultMaxQueueSize requests.
+func DefaultPeerRequestRateLimits() map[MsgType]PeerRequestRateLimit {
+	return map[MsgType]PeerRequestRateLimit{
+		MsgTypeGetHeaders:  {RequestsPerSecond: 10, Burst: 100},
+		MsgTypeGetBlocks:   {RequestsPerSecond: 10, Burst: 100},
+		MsgTypeGetSnapshot: {RequestsPerSecond: 5, Burst: 40},
+	}
+}
+
+// NewPeerRequestRateLimits returns the default budgets, overridden by limits, which is a comma-separated list of
+// type=rate:burst entries, e.g. "get_snapshot=2:20,get_blocks=0:0". The types are get_headers, get_blocks, and
+// get_snapshot, and a rate of zero disables the limit of a type.
+func NewPeerRequestRateLimits(limits string) (map[MsgType]PeerRequestRateLimit, error) {
+	rateLimits := DefaultPeerRequestRateLimits()
+	for _, limit := range strings.Split(limits, ",") {
+		limit = strings.TrimSpace(limit)
+		if limit == "" {
+			continue
+		}
+		msgTypeStr, budget, found := strings.Cut(limit, "=")
+		rateStr, burstStr, hasBurst := strings.Cut(budget, ":")
+		if !found || !hasBurst {
+			return nil, fmt.Errorf("NewPeerRequestRateLimits: Limit %v should be of the form type=rate:burst", limit)
+		}
+		msgType := MsgTypeUnset
+		for rateLimitedMsgType := range rateLimits {
+			if strings.EqualFold(msgTypeStr, rateLimitedMsgType.String()) {
+				msgType = rateLimitedMsgType
+			}
+		}
+		if msgType == MsgTypeUnset {
+			return nil, fmt.Errorf("NewPeerRequestRateLimits: Unknown request type %v; must be one of "+
+				"get_headers, get_blocks, or get_snapshot", msgTypeStr)
+		}
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate < 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return nil, fmt.Errorf("NewPeerRequestRateLimits: Invalid rate %v for %v", rateStr, msgTypeStr)
+		}
+		burst, err := strconv.ParseUint(burstStr, 10, 64)
+		if err != nil || (rate > 0 && burst == 0) {
+			return nil, fmt.Errorf("NewPeerRequestRateLimits: Invalid burst %v for %v", burstStr, msgTypeStr)
+		}
+		rateLimits[msgType] = PeerRequestRateLimit{RequestsPerSecond: rate, Burst: burst}
+	}
+	return rateLimits, nil
+}
+
+// peerRequestTokenBucket holds the tokens a peer has left for one type of request. It starts full, and refills at
+// the rate of its budget.
+type peerRequestTokenBucket struct {
+	limit      PeerRequestRateLimit
+	tokens     float64
+	lastRefill time.Time
+}
+
+func (bucket *peerRequestTokenBucket) take(now time.Time) bool {
+	if elapsed := now.Sub(bucket.lastRefill); elapsed > 0 {
+		bucket.tokens = math.Min(float64(bucket.limit.Burst),
+			bucket.tokens+elapsed.Seconds()*bucket.limit.RequestsPerSecond)
+		bucket.lastRefill = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// peerRequestRateLimiter enforces a peer's request budgets, so that a single aggressive peer can't exhaust the
+// resources of a node that serves headers, blocks, and hypersync snapshots. It's only used by the peer's
+// inHandler, so it isn't safe for concurrent use.
+type peerRequestRateLimiter struct {
+	buckets map[MsgType]*peerRequestTokenBucket
+
+	violationWindowStart time.Time
+	numViolations        uint64
+}
+
+// newPeerRequestRateLimiter returns a limiter that enforces the limits, or nil if limits is nil. A nil limiter
+// allows every request.
+func newPeerRequestRateLimiter(limits map[MsgType]PeerRequestRateLimit, now time.Time) *peerRequestRateLimiter {
+	if limits == nil {
+		return nil
+	}
+	limiter := &peerRequestRateLimiter{
+		buckets:              make(map[MsgType]*peerRequestTokenBucket),
+		violationWindowStart: now,
+	}
+	for msgType, limit := range limits {
+		if limit.RequestsPerSecond == 0 {
+			continue
+		}
+		limiter.buckets[msgType] = &peerRequestTokenBucket{
+			limit:      limit,
+			tokens:     float64(limit.Burst),
+			lastRefill: now,
+		}
+	}
+	return limiter
+}
+
+// allowRequest takes a token for a request of msgType received at now. It returns false if the request is over
+// budget and should be dropped, and isAbusive is true once the peer has gone over budget too often and should be
+// disconnected.
+func (limiter *peerRequestRateLimiter) allowRequest(msgType MsgType, now time.Time) (_allowed bool, _isAbusive bool) {
+	if limiter == nil {
+		return true, false
+	}
+	bucket, exists := limiter.buckets[msgType]
+	if !exists || bucket.take(now) {
+		return true, false
+	}
+	if now.Sub(limiter.violationWindowStart) >= peerRequestRateLimitViolationWindow {
+		limiter.violationWindowStart = now
+		limiter.numViolations = 0
+	}
+	limiter.numViolations++
+	return false, limiter.numViolations >= peerRequestRateLimitMaxViolations
+}
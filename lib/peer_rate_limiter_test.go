@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPeerRequestRateLimits(t *testing.T) {
+	require := require.New(t)
+
+	limits, err := NewPeerRequestRateLimits("")
+	require.NoError(err)
+	require.Equal(DefaultPeerRequestRateLimits(), limits)
+
+	limits, err = NewPeerRequestRateLimits(" get_snapshot=0.5:3, GET_BLOCKS=0:0")
+	require.NoError(err)
+	require.Equal(PeerRequestRateLimit{RequestsPerSecond: 0.5, Burst: 3}, limits[MsgTypeGetSnapshot])
+	require.Equal(PeerRequestRateLimit{}, limits[MsgTypeGetBlocks])
+	require.Equal(DefaultPeerRequestRateLimits()[MsgTypeGetHeaders], limits[MsgTypeGetHeaders])
+
+	for _, invalidLimits := range []string{
+		"get_snapshot", "get_snapshot=1", "get_transactions=1:1", "get_snapshot=-1:1", "get_snapshot=inf:1",
+		"get_snapshot=1:0", "get_snapshot=1:x",
+	} {
+		_, err = NewPeerRequestRateLimits(invalidLimits)
+		require.Error(err, invalidLimits)
+	}
+}
+
+func TestPeerRequestRateLimiter(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1700000000, 0)
+	limiter := newPeerRequestRateLimiter(map[MsgType]PeerRequestRateLimit{
+		MsgTypeGetSnapshot: {RequestsPerSecond: 2, Burst: 4},
+		MsgTypeGetBlocks:   {},
+	}, now)
+
+	// The burst is allowed at once, and then the bucket refills at the rate.
+	for ii := 0; ii < 4; ii++ {
+		allowed, isAbusive := limiter.allowRequest(MsgTypeGetSnapshot, now)
+		require.True(allowed)
+		require.False(isAbusive)
+	}
+	allowed, isAbusive := limiter.allowRequest(MsgTypeGetSnapshot, now)
+	require.False(allowed)
+	require.False(isAbusive)
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = limiter.allowRequest(MsgTypeGetSnapshot, now)
+	require.True(allowed)
+	allowed, _ = limiter.allowRequest(MsgTypeGetSnapshot, now)
+	require.False(allowed)
+
+	// Unlimited and unlisted request types are always allowed.
+	for ii := 0; ii < 1000; ii++ {
+		allowed, _ = limiter.allowRequest(MsgTypeGetBlocks, now)
+		require.True(allowed)
+		allowed, _ = limiter.allowRequest(MsgTypeGetHeaders, now)
+		require.True(allowed)
+	}
+
+	// Violations within a window add up until the peer is abusive, and a new window starts over. The peer
+	// already has two violations.
+	for ii := 3; ii < peerRequestRateLimitMaxViolations; ii++ {
+		_, isAbusive = limiter.allowRequest(MsgTypeGetSnapshot, now)
+		require.False(isAbusive)
+	}
+	_, isAbusive = limiter.allowRequest(MsgTypeGetSnapshot, now)
+	require.True(isAbusive)
+	now = now.Add(peerRequestRateLimitViolationWindow)
+	_, isAbusive = limiter.allowRequest(MsgTypeGetSnapshot, now)
+	require.False(isAbusive)
+
+	// A nil limiter allows everything.
+	limiter = newPeerRequestRateLimiter(nil, now)
+	require.Nil(limiter)
+	allowed, isAbusive = limiter.allowRequest(MsgTypeGetSnapshot, now)
+	require.True(allowed)
+	require.False(isAbusive)
+}
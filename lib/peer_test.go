@@ -1 +1,98 @@
 package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerExpectedResponseTimeouts(t *testing.T) {
+	require := require.New(t)
+
+	newPeer := func(protocolVersion ProtocolVersionType) *Peer {
+		return &Peer{
+			NegotiatedProtocolVersion: protocolVersion,
+			stallTimeoutSeconds:       900,
+			blockStallTimeoutSeconds:  60,
+			logger:                    NewLogger(nil, LogComponentPeer),
+		}
+	}
+	requireTimeout := func(response *ExpectedResponse, msgType MsgType, timeout time.Duration) {
+		require.Equal(msgType, response.MessageType)
+		require.WithinDuration(time.Now().Add(timeout), response.TimeExpected, time.Second)
+	}
+	newGetBlocks := func(numBlocks int) *MsgDeSoGetBlocks {
+		getBlocks := &MsgDeSoGetBlocks{}
+		for ii := 0; ii < numBlocks; ii++ {
+			getBlocks.HashList = append(getBlocks.HashList, &BlockHash{})
+		}
+		return getBlocks
+	}
+
+	// A ping expects a pong within the pongTimeout, and the pong clears it.
+	pp := newPeer(ProtocolVersion2)
+	pp._handleOutExpectedResponse(&MsgDeSoPing{Nonce: 1})
+	require.Len(pp.expectedResponses, 1)
+	requireTimeout(pp.expectedResponses[0], MsgTypePong, pongTimeout)
+	require.NoError(pp._handleInExpectedResponse(&MsgDeSoPong{Nonce: 1}))
+	require.Empty(pp.expectedResponses)
+
+	// Block bundles get one block stall timeout per MaxBlocksInFlight blocks, up to the stall timeout.
+	pp._handleOutExpectedResponse(newGetBlocks(10))
+	pp._handleOutExpectedResponse(newGetBlocks(4 * MaxBlocksInFlight))
+	pp._handleOutExpectedResponse(newGetBlocks(MaxBlocksInFlightPoS))
+	require.Len(pp.expectedResponses, 3)
+	requireTimeout(pp.expectedResponses[0], MsgTypeBlockBundle, time.Minute)
+	requireTimeout(pp.expectedResponses[1], MsgTypeBlockBundle, 5*time.Minute)
+	requireTimeout(pp.expectedResponses[2], MsgTypeBlockBundle, 15*time.Minute)
+
+	// Before ProtocolVersion2, each block gets a block stall timeout after the previous one.
+	pp = newPeer(ProtocolVersion1)
+	pp._handleOutExpectedResponse(newGetBlocks(3))
+	require.Len(pp.expectedResponses, 3)
+	for ii, response := range pp.expectedResponses {
+		requireTimeout(response, MsgTypeBlock, time.Duration(ii+1)*time.Minute)
+	}
+
+	// Without a block stall timeout, blocks use the stall timeout.
+	pp = newPeer(ProtocolVersion2)
+	pp.blockStallTimeoutSeconds = 0
+	pp._handleOutExpectedResponse(newGetBlocks(10))
+	requireTimeout(pp.expectedResponses[0], MsgTypeBlockBundle, 15*time.Minute)
+}
+
+func TestPeerPingLatency(t *testing.T) {
+	require := require.New(t)
+
+	newPeerWithPing := func(id uint64, pingMicros ...int64) *Peer {
+		pp := &Peer{ID: id, logger: NewLogger(nil, LogComponentPeer)}
+		for ii, micros := range pingMicros {
+			pp.LastPingNonce = uint64(ii + 1)
+			pp.LastPingTime = time.Now().Add(-time.Duration(micros) * time.Microsecond)
+			pp.HandlePongMsg(&MsgDeSoPong{Nonce: uint64(ii + 1)})
+		}
+		return pp
+	}
+
+	// The average starts at the first latency and moves towards the new ones.
+	pp := newPeerWithPing(1)
+	require.Zero(pp.AveragePingMicros())
+	pp = newPeerWithPing(1, 80000, 160000)
+	require.InDelta(90000, pp.AveragePingMicros(), 1000)
+
+	// A pong for another ping is ignored.
+	pp.LastPingNonce = 5
+	pp.LastPingTime = time.Now().Add(-time.Second)
+	pp.HandlePongMsg(&MsgDeSoPong{Nonce: 4})
+	require.InDelta(90000, pp.AveragePingMicros(), 1000)
+
+	// Peers that have answered a ping are preferred, fastest first.
+	require.Nil(_lowestLatencyPeer(nil))
+	noPingPeer := newPeerWithPing(2)
+	slowPeer := newPeerWithPing(3, 500000)
+	fastPeer := newPeerWithPing(4, 20000)
+	require.Equal(noPingPeer, _lowestLatencyPeer([]*Peer{noPingPeer}))
+	require.Equal(slowPeer, _lowestLatencyPeer([]*Peer{noPingPeer, slowPeer}))
+	require.Equal(fastPeer, _lowestLatencyPeer([]*Peer{slowPeer, noPingPeer, fastPeer}))
+}
@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// Block Inclusion Filters
+//
+// A block proposer chooses which transactions go into the blocks it produces. By default, the PosBlockProducer
+// includes every transaction in the mempool that connects, in Fee-Time order. The BlockInclusionFilter lets the
+// operator of a validator narrow that down declaratively, from the node's config:
+//   - ExcludedTxnTypes are never included, e.g. to keep a TxnType the validator doesn't want to process out of
+//     its blocks.
+//   - Transactions signed by ExcludedPublicKeys are never included.
+//   - A transaction must pay at least the minimum fee rate of its TxnType, if one is set, or else the default
+//     minimum fee rate. This lets a validator charge more than the network's minimum fee for the blocks it
+//     produces, overall or for specific TxnTypes.
+//
+// An atomic transaction wrapper is excluded if any of its inner transactions is excluded, and must pay the highest
+// minimum fee rate of its inner transactions' TxnTypes, with the fee rate computed from the fees of all of its inner
+// transactions over the size of the wrapper.
+//
+// The filter is purely a local block production policy. It doesn't change the consensus rules, so blocks from
+// other producers that include filtered transactions are validated as usual, and filtered transactions are still
+// accepted into the mempool and relayed. The filter is immutable once created, and its methods are safe to call
+// on a nil BlockInclusionFilter, which doesn't filter anything.
+
+const (
+	// BlockInclusionDefaultMinFeeRateKey is the key of the default minimum fee rate in the min fee rate overrides.
+	BlockInclusionDefaultMinFeeRateKey = "default"
+)
+
+// BlockInclusionFilter holds the rules that decide which mempool transactions the PosBlockProducer includes in the
+// blocks it produces. See the top of this file.
+type BlockInclusionFilter struct {
+	excludedTxnTypes   map[TxnType]struct{}
+	excludedPublicKeys map[PublicKey]struct{}
+	// defaultMinFeeRateNanosPerKB applies to the TxnTypes without an entry in minFeeRateNanosPerKBByTxnType.
+	defaultMinFeeRateNanosPerKB   uint64
+	minFeeRateNanosPerKBByTxnType map[TxnType]uint64
+}
+
+// NewBlockInclusionFilter parses a BlockInclusionFilter. The TxnTypes are TxnStrings, e.g. "NFT_BID", and the
+// public keys are Base58Check-encoded. minFeeRates is a comma-separated list of type=rate entries with the minimum
+// fee rate in nanos per KB of each TxnType, e.g. "default=2000,NFT_BID=5000", where the default entry applies to
+// every other TxnType. It returns nil if the filter doesn't filter anything.
+func NewBlockInclusionFilter(excludedTxnTypes []string, excludedPublicKeys []string, minFeeRates string) (
+	*BlockInclusionFilter, error) {
+
+	filter := &BlockInclusionFilter{
+		excludedTxnTypes:              make(map[TxnType]struct{}),
+		excludedPublicKeys:            make(map[PublicKey]struct{}),
+		minFeeRateNanosPerKBByTxnType: make(map[TxnType]uint64),
+	}
+	for _, txnString := range excludedTxnTypes {
+		if strings.TrimSpace(txnString) == "" {
+			continue
+		}
+		txnType, err := _parseBlockInclusionTxnType(txnString)
+		if err != nil {
+			return nil, err
+		}
+		filter.excludedTxnTypes[txnType] = struct{}{}
+	}
+	for _, publicKeyString := range excludedPublicKeys {
+		publicKeyString = strings.TrimSpace(publicKeyString)
+		if publicKeyString == "" {
+			continue
+		}
+		publicKeyBytes, _, err := Base58CheckDecode(publicKeyString)
+		if err != nil || len(publicKeyBytes) != btcec.PubKeyBytesLenCompressed {
+			return nil, fmt.Errorf("NewBlockInclusionFilter: Invalid excluded public key %v", publicKeyString)
+		}
+		filter.excludedPublicKeys[*NewPublicKey(publicKeyBytes)] = struct{}{}
+	}
+	for _, minFeeRate := range strings.Split(minFeeRates, ",") {
+		minFeeRate = strings.TrimSpace(minFeeRate)
+		if minFeeRate == "" {
+			continue
+		}
+		txnString, rateStr, found := strings.Cut(minFeeRate, "=")
+		if !found {
+			return nil, fmt.Errorf("NewBlockInclusionFilter: Min fee rate %v should be of the form type=rate",
+				minFeeRate)
+		}
+		rate, err := strconv.ParseUint(strings.TrimSpace(rateStr), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("NewBlockInclusionFilter: Invalid min fee rate %v for %v", rateStr, txnString)
+		}
+		if strings.EqualFold(strings.TrimSpace(txnString), BlockInclusionDefaultMinFeeRateKey) {
+			filter.defaultMinFeeRateNanosPerKB = rate
+			continue
+		}
+		txnType, err := _parseBlockInclusionTxnType(txnString)
+		if err != nil {
+			return nil, err
+		}
+		filter.minFeeRateNanosPerKBByTxnType[txnType] = rate
+	}
+
+	if len(filter.excludedTxnTypes) == 0 && len(filter.excludedPublicKeys) == 0 &&
+		filter.defaultMinFeeRateNanosPerKB == 0 && len(filter.minFeeRateNanosPerKBByTxnType) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+func _parseBlockInclusionTxnType(txnString string) (TxnType, error) {
+	txnType := GetTxnTypeFromString(TxnString(strings.ToUpper(strings.TrimSpace(txnString))))
+	// Block rewards are added by the block producer itself, so they can't be filtered.
+	if txnType == TxnTypeUnset || txnType == TxnTypeBlockReward {
+		return TxnTypeUnset, fmt.Errorf("NewBlockInclusionFilter: TxnType %v can't be filtered", txnString)
+	}
+	return txnType, nil
+}
+
+// IsTxnExcluded returns true if the txn, whose encoding is txnSizeBytes long, shouldn't be included in the blocks
+// we produce.
+func (filter *BlockInclusionFilter) IsTxnExcluded(txn *MsgDeSoTxn, txnSizeBytes uint64) bool {
+	if filter == nil || txn == nil || txn.TxnMeta == nil {
+		return false
+	}
+	innerTxns := []*MsgDeSoTxn{txn}
+	if txnMeta, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata); ok {
+		innerTxns = txnMeta.Txns
+	}
+
+	minFeeRateNanosPerKB := uint64(0)
+	for _, innerTxn := range innerTxns {
+		if innerTxn == nil || innerTxn.TxnMeta == nil {
+			continue
+		}
+		txnType := innerTxn.TxnMeta.GetTxnType()
+		if _, isExcluded := filter.excludedTxnTypes[txnType]; isExcluded {
+			return true
+		}
+		if publicKey := NewPublicKey(innerTxn.PublicKey); publicKey != nil {
+			if _, isExcluded := filter.excludedPublicKeys[*publicKey]; isExcluded {
+				return true
+			}
+		}
+		txnTypeMinFeeRateNanosPerKB, hasOverride := filter.minFeeRateNanosPerKBByTxnType[txnType]
+		if !hasOverride {
+			txnTypeMinFeeRateNanosPerKB = filter.defaultMinFeeRateNanosPerKB
+		}
+		if txnTypeMinFeeRateNanosPerKB > minFeeRateNanosPerKB {
+			minFeeRateNanosPerKB = txnTypeMinFeeRateNanosPerKB
+		}
+	}
+	if minFeeRateNanosPerKB == 0 {
+		return false
+	}
+
+	// The txn must pay at least minFeeRateNanosPerKB for each of its bytes, rounded up.
+	minFeeNanosTimesKB, err := SafeUint64().Mul(minFeeRateNanosPerKB, txnSizeBytes)
+	if err != nil {
+		return true
+	}
+	minFeeNanos := minFeeNanosTimesKB / 1000
+	if minFeeNanosTimesKB%1000 != 0 {
+		minFeeNanos++
+	}
+	return _getTxnFeeNanos(txn) < minFeeNanos
+}
+
+// String returns a summary of the filter for logging.
+func (filter *BlockInclusionFilter) String() string {
+	if filter == nil {
+		return "<none>"
+	}
+	var excludedTxnTypes []string
+	for txnType := range filter.excludedTxnTypes {
+		excludedTxnTypes = append(excludedTxnTypes, txnType.String())
+	}
+	sort.Strings(excludedTxnTypes)
+	var minFeeRates []string
+	for txnType, rate := range filter.minFeeRateNanosPerKBByTxnType {
+		minFeeRates = append(minFeeRates, fmt.Sprintf("%v=%d", txnType, rate))
+	}
+	sort.Strings(minFeeRates)
+	return fmt.Sprintf("ExcludedTxnTypes: %v, NumExcludedPublicKeys: %d, DefaultMinFeeRateNanosPerKB: %d, "+
+		"MinFeeRates: %v", excludedTxnTypes, len(filter.excludedPublicKeys), filter.defaultMinFeeRateNanosPerKB,
+		minFeeRates)
+}
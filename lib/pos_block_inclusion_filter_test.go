@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockInclusionFilter(t *testing.T) {
+	require := require.New(t)
+
+	// A filter that doesn't filter anything is nil, and a nil filter doesn't exclude anything.
+	filter, err := NewBlockInclusionFilter([]string{""}, nil, " ")
+	require.NoError(err)
+	require.Nil(filter)
+	require.False(filter.IsTxnExcluded(&MsgDeSoTxn{TxnMeta: &BasicTransferMetadata{}}, 100))
+
+	// Invalid TxnTypes, public keys, and min fee rates are rejected.
+	_, err = NewBlockInclusionFilter([]string{"NOT_A_TXN_TYPE"}, nil, "")
+	require.Error(err)
+	_, err = NewBlockInclusionFilter([]string{"BLOCK_REWARD"}, nil, "")
+	require.Error(err)
+	_, err = NewBlockInclusionFilter(nil, []string{"not a public key"}, "")
+	require.Error(err)
+	_, err = NewBlockInclusionFilter(nil, nil, "default")
+	require.Error(err)
+	_, err = NewBlockInclusionFilter(nil, nil, "NFT_BID=-1")
+	require.Error(err)
+
+	filter, err = NewBlockInclusionFilter([]string{"nft_bid"}, []string{m1Pub}, "default=1000, BASIC_TRANSFER=3000")
+	require.NoError(err)
+	require.NotNil(filter)
+
+	newTxn := func(publicKey []byte, txnMeta DeSoTxnMetadata, feeNanos uint64) *MsgDeSoTxn {
+		return &MsgDeSoTxn{PublicKey: publicKey, TxnMeta: txnMeta, TxnFeeNanos: feeNanos}
+	}
+
+	// Excluded TxnTypes and public keys are excluded whatever their fee.
+	require.True(filter.IsTxnExcluded(newTxn(m0PkBytes, &NFTBidMetadata{}, 1e9), 100))
+	require.True(filter.IsTxnExcluded(newTxn(m1PkBytes, &SubmitPostMetadata{}, 1e9), 100))
+
+	// A TxnType with its own min fee rate must pay it, and every other TxnType must pay the default.
+	require.True(filter.IsTxnExcluded(newTxn(m0PkBytes, &BasicTransferMetadata{}, 299), 100))
+	require.False(filter.IsTxnExcluded(newTxn(m0PkBytes, &BasicTransferMetadata{}, 300), 100))
+	require.True(filter.IsTxnExcluded(newTxn(m0PkBytes, &SubmitPostMetadata{}, 99), 100))
+	require.False(filter.IsTxnExcluded(newTxn(m0PkBytes, &SubmitPostMetadata{}, 100), 100))
+	// The min fee is rounded up.
+	require.True(filter.IsTxnExcluded(newTxn(m0PkBytes, &SubmitPostMetadata{}, 100), 101))
+	require.False(filter.IsTxnExcluded(newTxn(m0PkBytes, &SubmitPostMetadata{}, 101), 101))
+
+	// An atomic txns wrapper is excluded if any inner txn is, and must pay the highest min fee rate of its inner
+	// txns with the fees of all of them.
+	newWrapper := func(innerTxns ...*MsgDeSoTxn) *MsgDeSoTxn {
+		return &MsgDeSoTxn{PublicKey: ZeroPublicKey.ToBytes(), TxnMeta: &AtomicTxnsWrapperMetadata{Txns: innerTxns}}
+	}
+	require.True(filter.IsTxnExcluded(newWrapper(
+		newTxn(m0PkBytes, &SubmitPostMetadata{}, 1e9), newTxn(m1PkBytes, &SubmitPostMetadata{}, 1e9)), 200))
+	require.True(filter.IsTxnExcluded(newWrapper(
+		newTxn(m0PkBytes, &SubmitPostMetadata{}, 300), newTxn(m0PkBytes, &BasicTransferMetadata{}, 299)), 200))
+	require.False(filter.IsTxnExcluded(newWrapper(
+		newTxn(m0PkBytes, &SubmitPostMetadata{}, 300), newTxn(m0PkBytes, &BasicTransferMetadata{}, 300)), 200))
+}
@@ -29,6 +29,14 @@ type PosBlockProducer struct {
 	proposerVotingPublicKey        *bls.PublicKey
 	previousBlockTimestampNanoSecs int64
 	mockBlockSignature             *bls.Signature
+	// txnRelayFilter holds the TxnTypes that we don't include in the blocks we produce. It may be nil.
+	txnRelayFilter *TxnRelayFilter
+	// inclusionFilter holds the operator's rules for which transactions we include in the blocks we produce. It
+	// may be nil.
+	inclusionFilter *BlockInclusionFilter
+	// deterministicTxnShuffle orders the txns of the blocks we produce by the deterministic shuffle even if the
+	// network doesn't enforce it, as long as it doesn't enforce the canonical order. See deterministic_txn_shuffle.go.
+	deterministicTxnShuffle bool
 }
 
 func NewPosBlockProducer(
@@ -37,6 +45,9 @@ func NewPosBlockProducer(
 	proposerPublicKey *PublicKey,
 	proposerVotingPublicKey *bls.PublicKey,
 	previousBlockTimestampNanoSecs int64,
+	txnRelayFilter *TxnRelayFilter,
+	inclusionFilter *BlockInclusionFilter,
+	deterministicTxnShuffle bool,
 ) *PosBlockProducer {
 	return &PosBlockProducer{
 		mp:                             mp,
@@ -44,6 +55,9 @@ func NewPosBlockProducer(
 		proposerPublicKey:              proposerPublicKey,
 		proposerVotingPublicKey:        proposerVotingPublicKey,
 		previousBlockTimestampNanoSecs: previousBlockTimestampNanoSecs,
+		txnRelayFilter:                 txnRelayFilter,
+		inclusionFilter:                inclusionFilter,
+		deterministicTxnShuffle:        deterministicTxnShuffle,
 	}
 }
 
@@ -237,6 +251,12 @@ func (pbp *PosBlockProducer) createBlockWithoutHeader(
 	blockRewardTxn.TxnMeta = &BlockRewardMetadataa{
 		ExtraData: UintToBuf(extraNonce),
 	}
+	// Signal for the soft fork deployments that are currently accepting signals.
+	softForkSignalBits, err := latestBlockView.GetSoftForkSignalBitsForBlockHeight(newBlockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error computing soft fork signal bits: ")
+	}
+	SetSoftForkSignalBits(blockRewardTxn, softForkSignalBits)
 	blockRewardTxnSizeBytes, err := blockRewardTxn.ToBytes(true)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error computing block reward txn size: ")
@@ -283,6 +303,89 @@ func (pbp *PosBlockProducer) createBlockWithoutHeader(
 	return block, nil
 }
 
+// BlockPreview is the result of a block construction dry run. It describes the block that a proposer would
+// produce from the current mempool, so that validators can monitor their pipeline and tune their mempool
+// policies without producing a block.
+type BlockPreview struct {
+	BlockHeight uint64
+	// Txns are the candidate transactions in the order they'd be included in the block, excluding the block
+	// reward txn.
+	Txns []*MsgDeSoTxn
+	// TotalFeesNanos is the sum of the fees paid by the Txns, and BlockRewardNanos is the part of them that
+	// the proposer would receive in the block reward txn, i.e. the utility fees of the txns it didn't submit.
+	TotalFeesNanos   uint64
+	BlockRewardNanos uint64
+	// SizeBytes is the estimated size of the block, and SizeUtilization is SizeBytes / SoftMaxBlockSizeBytes.
+	SizeBytes             uint64
+	SoftMaxBlockSizeBytes uint64
+	SizeUtilization       float64
+	// ConstructionTime is how long it took to connect the candidate transactions, and ComputeUtilization is
+	// ConstructionTime / BlockProductionInterval. A block whose compute utilization approaches 1 can't be
+	// produced within its view.
+	ConstructionTime        time.Duration
+	BlockProductionInterval time.Duration
+	ComputeUtilization      float64
+}
+
+// PreviewBlock constructs the transactions of a block at newBlockHeight like CreateUnsignedBlock does, and
+// reports on them instead of returning a block. headerSizeEstimate is the estimated size of the block's header.
+func (pbp *PosBlockProducer) PreviewBlock(latestBlockView *UtxoView, newBlockHeight uint64,
+	headerSizeEstimate uint64) (*BlockPreview, error) {
+
+	startTime := time.Now()
+	newBlockTimestampNanoSecs := _maxInt64(startTime.UnixNano(), pbp.previousBlockTimestampNanoSecs+1)
+	block, err := pbp.createBlockWithoutHeader(latestBlockView, newBlockHeight, newBlockTimestampNanoSecs,
+		headerSizeEstimate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "PosBlockProducer.PreviewBlock: Problem creating block: ")
+	}
+	constructionTime := time.Since(startTime)
+
+	preview := &BlockPreview{
+		BlockHeight:           newBlockHeight,
+		Txns:                  block.Txns[1:],
+		BlockRewardNanos:      block.Txns[0].TxOutputs[0].AmountNanos,
+		SizeBytes:             headerSizeEstimate,
+		SoftMaxBlockSizeBytes: latestBlockView.GetSoftMaxBlockSizeBytesPoS(),
+		ConstructionTime:      constructionTime,
+		BlockProductionInterval: time.Duration(
+			latestBlockView.GetCurrentGlobalParamsEntry().BlockProductionIntervalMillisecondsPoS) * time.Millisecond,
+	}
+	for _, txn := range block.Txns {
+		txnBytes, err := txn.ToBytes(false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "PosBlockProducer.PreviewBlock: Problem getting transaction size: ")
+		}
+		preview.SizeBytes += uint64(len(txnBytes))
+	}
+	for _, txn := range preview.Txns {
+		preview.TotalFeesNanos, err = SafeUint64().Add(preview.TotalFeesNanos, _getTxnFeeNanos(txn))
+		if err != nil {
+			return nil, errors.Wrapf(err, "PosBlockProducer.PreviewBlock: Problem computing total fees: ")
+		}
+	}
+	if preview.SoftMaxBlockSizeBytes > 0 {
+		preview.SizeUtilization = float64(preview.SizeBytes) / float64(preview.SoftMaxBlockSizeBytes)
+	}
+	if preview.BlockProductionInterval > 0 {
+		preview.ComputeUtilization = float64(preview.ConstructionTime) / float64(preview.BlockProductionInterval)
+	}
+	return preview, nil
+}
+
+// _getTxnFeeNanos returns the fee paid by a txn. The fees of an atomic txns wrapper are paid by its inner txns.
+func _getTxnFeeNanos(txn *MsgDeSoTxn) uint64 {
+	txnMeta, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata)
+	if !ok {
+		return txn.TxnFeeNanos
+	}
+	feeNanos := uint64(0)
+	for _, innerTxn := range txnMeta.Txns {
+		feeNanos += innerTxn.TxnFeeNanos
+	}
+	return feeNanos
+}
+
 // getBlockTransactions is used to retrieve fee-time ordered transactions from the mempool.
 func (pbp *PosBlockProducer) getBlockTransactions(
 	blockProducerPublicKey *PublicKey,
@@ -298,11 +401,25 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 ) {
 	// Get Fee-Time ordered transactions from the mempool
 	feeTimeTxns := pbp.mp.GetTransactions()
+	// After the canonical txn ordering fork, the block's transactions must be in canonical order. We sort the
+	// candidates before connecting them so that the subset we end up including is also canonically ordered.
+	// The same goes for the deterministic shuffle, which is seeded by the hash of the block we build on.
+	if shouldUseDeterministicTxnShuffle(pbp.params, newBlockHeight, pbp.deterministicTxnShuffle) {
+		feeTimeTxns = SortMempoolTxnsDeterministicShuffle(feeTimeTxns, latestBlockView.TipHash)
+	} else if pbp.params.IsCanonicalTxnOrderingBlockHeight(newBlockHeight) {
+		feeTimeTxns = SortMempoolTxnsCanonicalOrder(feeTimeTxns)
+	}
 	// Try to connect transactions one by one.
 	blocksTxns := []*MsgDeSoTxn{}
 	maxUtilityFee := uint64(0)
 	currentBlockSize := uint64(0)
 
+	// The share of the fees the block producer can claim depends on a global param.
+	feeRedistributionBasisPoints, err := latestBlockView.GetFeeRedistributionBasisPoints(newBlockHeight)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "Error getting fee redistribution basis points: ")
+	}
+
 	// Create an instance of SafeUtxoView to connect transactions to.
 	safeUtxoView := NewSafeUtxoView(latestBlockView)
 
@@ -312,6 +429,10 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 		if currentBlockSize > softMaxBlockSizeBytes {
 			break
 		}
+		// Skip over transactions whose TxnType the operator has paused.
+		if pbp.txnRelayFilter.IsTxnPaused(txn.Tx) {
+			continue
+		}
 		txnBytes, err := txn.Tx.ToBytes(false)
 		if err != nil {
 			return nil, 0, errors.Wrapf(err, "Error getting transaction size: ")
@@ -322,6 +443,10 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 		if currentBlockSize+uint64(len(txnBytes)) > hardMaxBlockSizeBytes {
 			continue
 		}
+		// Skip over transactions that the operator's inclusion filter excludes.
+		if pbp.inclusionFilter.IsTxnExcluded(txn.Tx, uint64(len(txnBytes))) {
+			continue
+		}
 
 		// Connect the transaction to the SafeUtxoView to test if it connects.
 		_, _, _, fees, err := safeUtxoView.ConnectTransaction(
@@ -360,8 +485,8 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 					errors.Wrapf(err, "error filtering out block reward recipient fees")
 			}
 		}
-		// Compute BMF for the transaction.
-		_, utilityFee := computeBMF(fees)
+		// Compute the utility fee for the transaction.
+		_, utilityFee := computeFeeSplit(fees, feeRedistributionBasisPoints)
 		maxUtilityFee, err = SafeUint64().Add(maxUtilityFee, utilityFee)
 		if err != nil {
 			return nil, 0, errors.Wrapf(err, "Error computing max utility fee: ")
@@ -1,8 +1,10 @@
 package lib
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -32,7 +34,7 @@ func TestCreateBlockTemplate(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	defer mempool.Stop()
@@ -56,7 +58,7 @@ func TestCreateBlockTemplate(t *testing.T) {
 	_, err = seedSignature.FromBytes(Sha256DoubleHash([]byte("seed")).ToBytes())
 	require.NoError(err)
 	m0Pk := NewPublicKey(m0PubBytes)
-	pbp := NewPosBlockProducer(mempool, params, m0Pk, pub, time.Now().UnixNano())
+	pbp := NewPosBlockProducer(mempool, params, m0Pk, pub, time.Now().UnixNano(), nil, nil, false)
 	mockQC := &QuorumCertificate{
 		BlockHash:      NewBlockHash(RandomBytes(32)),
 		ProposedInView: 1,
@@ -105,7 +107,7 @@ func TestCreateBlockWithoutHeader(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	defer mempool.Stop()
@@ -124,7 +126,7 @@ func TestCreateBlockWithoutHeader(t *testing.T) {
 
 	// Test cases where the block producer is the transactor for the mempool txns
 	{
-		pbp := NewPosBlockProducer(mempool, params, NewPublicKey(m0PubBytes), blsPubKey, time.Now().UnixNano())
+		pbp := NewPosBlockProducer(mempool, params, NewPublicKey(m0PubBytes), blsPubKey, time.Now().UnixNano(), nil, nil, false)
 		txns, _, err := pbp.getBlockTransactions(
 			NewPublicKey(m0PubBytes), latestBlockView, 3, 0, 50000, 50000)
 		require.NoError(err)
@@ -150,7 +152,7 @@ func TestCreateBlockWithoutHeader(t *testing.T) {
 
 	// Test cases where the block producer is not the transactor for the mempool txns
 	{
-		pbp := NewPosBlockProducer(mempool, params, NewPublicKey(m1PubBytes), blsPubKey, time.Now().UnixNano())
+		pbp := NewPosBlockProducer(mempool, params, NewPublicKey(m1PubBytes), blsPubKey, time.Now().UnixNano(), nil, nil, false)
 		txns, maxUtilityFee, err := pbp.getBlockTransactions(
 			NewPublicKey(m1PubBytes), latestBlockView, 3, 0, 50000, 50000)
 		require.NoError(err)
@@ -198,7 +200,7 @@ func TestGetBlockTransactions(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100000,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100000, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	defer mempool.Stop()
@@ -212,10 +214,78 @@ func TestGetBlockTransactions(t *testing.T) {
 		_wrappedPosMempoolAddTransaction(t, mempool, txn)
 	}
 
-	pbp := NewPosBlockProducer(mempool, params, NewPublicKey(m1PubBytes), nil, time.Now().UnixNano())
-	_testProduceBlockNoSizeLimit(t, mempool, pbp, latestBlockView, 3,
+	pbp := NewPosBlockProducer(mempool, params, NewPublicKey(m1PubBytes), nil, time.Now().UnixNano(), nil, nil, false)
+	txns, maxUtilityFee := _testProduceBlockNoSizeLimit(t, mempool, pbp, latestBlockView, 3,
 		len(passingTxns), 0, 0)
 
+	// A preview of the block reports on the same transactions.
+	{
+		headerSizeEstimate := uint64(200)
+		preview, err := pbp.PreviewBlock(latestBlockView, 3, headerSizeEstimate)
+		require.NoError(err)
+		require.Equal(uint64(3), preview.BlockHeight)
+		require.Equal(txns, preview.Txns)
+		require.Equal(maxUtilityFee, preview.BlockRewardNanos)
+		totalFeesNanos := uint64(0)
+		for _, txn := range txns {
+			totalFeesNanos += txn.TxnFeeNanos
+		}
+		require.Equal(totalFeesNanos, preview.TotalFeesNanos)
+		require.Less(preview.BlockRewardNanos, preview.TotalFeesNanos)
+		require.Greater(preview.SizeBytes, headerSizeEstimate)
+		require.Equal(float64(preview.SizeBytes)/float64(latestBlockView.GetSoftMaxBlockSizeBytesPoS()),
+			preview.SizeUtilization)
+		require.Equal(float64(preview.ConstructionTime)/float64(preview.BlockProductionInterval),
+			preview.ComputeUtilization)
+	}
+
+	// Transactions whose TxnType is paused aren't included in the block.
+	{
+		txnRelayFilter := NewTxnRelayFilter()
+		txnRelayFilter.PauseTxnTypes([]TxnType{TxnTypeBasicTransfer})
+		pausedPbp := NewPosBlockProducer(mempool, params, NewPublicKey(m1PubBytes), nil, time.Now().UnixNano(), txnRelayFilter, nil, false)
+		txns, _, err := pausedPbp.getBlockTransactions(NewPublicKey(m1PubBytes), latestBlockView, 3, 0, 50000, 50000)
+		require.NoError(err)
+		require.Empty(txns)
+	}
+
+	// Transactions that the inclusion filter excludes aren't included in the block.
+	{
+		newFilteredPbp := func(excludedPublicKeys []string, minFeeRates string) *PosBlockProducer {
+			inclusionFilter, err := NewBlockInclusionFilter(nil, excludedPublicKeys, minFeeRates)
+			require.NoError(err)
+			return NewPosBlockProducer(mempool, params, NewPublicKey(m1PubBytes), nil, time.Now().UnixNano(), nil,
+				inclusionFilter, false)
+		}
+		txns, _, err := newFilteredPbp([]string{m0Pub}, "").getBlockTransactions(
+			NewPublicKey(m1PubBytes), latestBlockView, 3, 0, 50000, 50000)
+		require.NoError(err)
+		require.Empty(txns)
+
+		// Only the transactions paying at least the minimum fee rate are included. The minimum is the median fee
+		// rate of the transactions in the mempool.
+		feeRatesNanosPerKB := []uint64{}
+		for _, txn := range passingTxns {
+			txnBytes, err := txn.ToBytes(false)
+			require.NoError(err)
+			feeRatesNanosPerKB = append(feeRatesNanosPerKB, txn.TxnFeeNanos*1000/uint64(len(txnBytes)))
+		}
+		sort.Slice(feeRatesNanosPerKB, func(ii, jj int) bool {
+			return feeRatesNanosPerKB[ii] < feeRatesNanosPerKB[jj]
+		})
+		minFeeRateNanosPerKB := feeRatesNanosPerKB[len(feeRatesNanosPerKB)/2]
+		txns, _, err = newFilteredPbp(nil, fmt.Sprintf("BASIC_TRANSFER=%d", minFeeRateNanosPerKB)).getBlockTransactions(
+			NewPublicKey(m1PubBytes), latestBlockView, 3, 0, 50000, 50000)
+		require.NoError(err)
+		require.NotEmpty(txns)
+		require.Less(len(txns), len(passingTxns))
+		for _, txn := range txns {
+			txnBytes, err := txn.ToBytes(false)
+			require.NoError(err)
+			require.GreaterOrEqual(txn.TxnFeeNanos*1000, minFeeRateNanosPerKB*uint64(len(txnBytes)))
+		}
+	}
+
 	// Now test the case where we have a bunch of transactions that don't pass.
 	// A failing transaction will try to send an excessive balance in a basic transfer.
 	failingTxns := []*MsgDeSoTxn{}
@@ -272,7 +342,7 @@ func TestGetBlockTransactions(t *testing.T) {
 	// be returned in the same order as the transaction from getBlockTransactions.
 	testMempool := NewPosMempool()
 	require.NoError(testMempool.Init(
-		params, globalParams, latestBlockView, 2, "", true, mempoolBackupIntervalMillis, nil, 10000, 100000,
+		params, globalParams, latestBlockView, 2, "", true, mempoolBackupIntervalMillis, nil, 10000, 100000, 0, 0, 0, 0,
 	))
 	require.NoError(testMempool.Start())
 	defer testMempool.Stop()
@@ -59,6 +59,11 @@ func (bc *Blockchain) processHeaderPoS(header *MsgDeSoHeader, verifySignatures b
 		return true, false, nil
 	}
 
+	// Reject the header if it conflicts with a checkpoint.
+	if err := bc.checkHeaderAgainstBlockCheckpoints(headerHash, header.Height); err != nil {
+		return false, false, errors.Wrapf(err, "processHeaderPoS: ")
+	}
+
 	// If the incoming header is part of a reorg that uncommits the committed tip from the best chain,
 	// then we exit early. Such headers are invalid and should not be synced.
 	committedBlockchainTip, _ := bc.GetCommittedTip()
@@ -241,6 +246,9 @@ func (bc *Blockchain) ProcessBlockPoS(block *MsgDeSoBlock, currentView uint64, v
 		return false, false, nil, fmt.Errorf("ProcessBlockPoS: Block is nil")
 	}
 
+	endTraceSpan := bc.startBlockTraceSpan("Blockchain.ProcessBlockPoS", block)
+	defer func() { endTraceSpan(_err) }()
+
 	return bc.processBlockPoS(block, currentView, verifySignatures)
 }
 
@@ -539,7 +547,7 @@ func (bc *Blockchain) processOrphanBlockPoS(block *MsgDeSoBlock) error {
 	}
 
 	// Okay now we have the validator set ordered by stake, we can validate the QC.
-	if err = bc.isValidPoSQuorumCertificate(block, validatorsByStake); err != nil {
+	if err = bc.isValidPoSQuorumCertificate(block, validatorsByStake, epochEntrySnapshotAtEpochNumber); err != nil {
 		// If we hit an error, we know that the QC is invalid, and we'll never accept this block,
 		// As a spam-prevention measure, we just throw away this block and don't store it.
 		return nil
@@ -637,9 +645,13 @@ func (bc *Blockchain) validateLeaderAndQC(
 			// to transient badger issues. We return false for failed spam prevention check and the error.
 			return false, errors.Wrap(err, "validateLeaderAndQC: Problem getting validator set")
 		}
+		snapshotEpochNumber, err := parentUtxoView.GetCurrentSnapshotEpochNumber()
+		if err != nil {
+			return false, errors.Wrap(err, "validateLeaderAndQC: Problem getting snapshot epoch number")
+		}
 
 		// Validate the block's QC. If it's invalid, we return true for failed spam prevention check.
-		if err = bc.isValidPoSQuorumCertificate(block, validatorsByStake); err != nil {
+		if err = bc.isValidPoSQuorumCertificate(block, validatorsByStake, snapshotEpochNumber); err != nil {
 			return false, nil
 		}
 	}
@@ -763,6 +775,7 @@ func (bc *Blockchain) validateAndIndexBlockPoS(block *MsgDeSoBlock, parentUtxoVi
 	})
 
 	// If we fail to connect the block, then it means the block is invalid. We should store it as ValidateFailed.
+	parentUtxoView.traceSpan = bc.traceSpan
 	if _, err = parentUtxoView.ConnectBlock(block, txHashes, verifySignatures, nil, block.Header.Height); err != nil {
 		// If it doesn't connect, we want to mark it as ValidateFailed.
 		return bc.storeValidateFailedBlockWithWrappedError(block, err)
@@ -887,7 +900,7 @@ func (bc *Blockchain) isValidBlockHeaderPoS(header *MsgDeSoHeader) error {
 }
 
 // isBlockTimestampValidRelativeToParentPoS validates that the block's timestamp is
-// greater than its parent's timestamp.
+// greater than its parent's timestamp, and greater than its parent's median time past.
 func (bc *Blockchain) isBlockTimestampValidRelativeToParentPoS(header *MsgDeSoHeader) error {
 	// Validate that the timestamp is not less than its parent.
 	parentBlockNode, exists := bc.blockIndexByHash.Get(*header.PrevBlockHash)
@@ -899,6 +912,9 @@ func (bc *Blockchain) isBlockTimestampValidRelativeToParentPoS(header *MsgDeSoHe
 	if header.TstampNanoSecs < parentBlockNode.Header.TstampNanoSecs {
 		return RuleErrorPoSBlockTstampNanoSecsTooOld
 	}
+	if !bc.isBlockTimestampAfterMedianTimePast(header) {
+		return RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast
+	}
 	return nil
 }
 
@@ -939,7 +955,7 @@ func (bc *Blockchain) isBlockTimestampTooFarInFuturePoS(header *MsgDeSoHeader) (
 		return false, errors.Wrapf(err, "isBlockTimestampTooFarInFuturePoS: Problem getting snapshot global params")
 	}
 
-	return header.TstampNanoSecs > time.Now().UnixNano()+snapshotGlobalParams.BlockTimestampDriftNanoSecs, nil
+	return header.TstampNanoSecs > currentTstampNanoSecs+snapshotGlobalParams.BlockTimestampDriftNanoSecs, nil
 }
 
 // isProperlyFormedBlockPoS validates the block at a surface level and makes
@@ -1262,9 +1278,16 @@ func (bav *UtxoView) hasValidBlockProposerPoS(block *MsgDeSoBlock) (_isValidBloc
 // isValidPoSQuorumCertificate validates that the QC of this block is valid, meaning a super majority
 // of the validator set has voted (or timed out). It special cases the first block after the PoS cutover
 // by overriding the validator set used to validate the high QC in the first block after the PoS cutover.
-func (bc *Blockchain) isValidPoSQuorumCertificate(block *MsgDeSoBlock, validatorSet []*ValidatorEntry) error {
+// snapshotEpochNumber is the epoch the validator set was snapshotted at, and is used to look up the
+// aggregated public keys of the QC's signers in the Blockchain's aggregatedPublicKeyCache.
+func (bc *Blockchain) isValidPoSQuorumCertificate(
+	block *MsgDeSoBlock,
+	validatorSet []*ValidatorEntry,
+	snapshotEpochNumber uint64,
+) error {
 	highQCValidators := toConsensusValidators(validatorSet)
 	aggregateQCValidators := highQCValidators
+	aggregatedPublicKeyCache := bc.aggregatedPublicKeyCache
 
 	voteQC := block.Header.ValidatorsVoteQC
 	timeoutAggregateQC := block.Header.ValidatorsTimeoutAggregateQC
@@ -1285,19 +1308,25 @@ func (bc *Blockchain) isValidPoSQuorumCertificate(block *MsgDeSoBlock, validator
 				return errors.Wrapf(err, "isValidPoSQuorumCertificate: Problem building PoS cutover validator")
 			}
 			highQCValidators = []consensus.Validator{posCutoverValidator}
+			// The synthetic high QC isn't signed by the epoch's validator set, so it isn't worth caching.
+			aggregatedPublicKeyCache = nil
 		}
 	}
 
 	// Validate the timeout aggregate QC.
 	if !timeoutAggregateQC.isEmpty() {
-		if !consensus.IsValidSuperMajorityAggregateQuorumCertificate(timeoutAggregateQC, aggregateQCValidators, highQCValidators) {
+		if !consensus.IsValidSuperMajorityAggregateQuorumCertificateWithCache(
+			timeoutAggregateQC, aggregateQCValidators, highQCValidators, snapshotEpochNumber, aggregatedPublicKeyCache,
+		) {
 			return RuleErrorInvalidTimeoutQC
 		}
 		return nil
 	}
 
 	// Validate the vote QC.
-	if !consensus.IsValidSuperMajorityQuorumCertificate(voteQC, highQCValidators) {
+	if !consensus.IsValidSuperMajorityQuorumCertificateWithCache(
+		voteQC, highQCValidators, snapshotEpochNumber, aggregatedPublicKeyCache,
+	) {
 		return RuleErrorInvalidVoteQC
 	}
 
@@ -1517,7 +1546,8 @@ func (bc *Blockchain) upsertBlockAndBlockNodeToDB(block *MsgDeSoBlock, blockNode
 	// Store the block in badger
 	err := bc.db.Update(func(txn *badger.Txn) error {
 		if storeFullBlock {
-			if innerErr := PutBlockHashToBlockWithTxn(txn, bc.snapshot, block, bc.eventManager); innerErr != nil {
+			if innerErr := PutBlockHashToBlockWithTxn(
+				txn, bc.snapshot, block, GetBlockSegmentStore(bc.db), bc.eventManager); innerErr != nil {
 				return errors.Wrapf(innerErr, "upsertBlockAndBlockNodeToDB: Problem calling PutBlockHashToBlockWithTxn")
 			}
 		}
@@ -1725,6 +1755,7 @@ func (bc *Blockchain) commitBlockPoS(blockHash *BlockHash, verifySignatures bool
 		return errors.Wrapf(err, "commitBlockPoS: Problem initializing UtxoView: ")
 	}
 	utxoView := utxoViewAndUtxoOps.UtxoView
+	utxoView.traceSpan = bc.traceSpan
 	utxoOps := utxoViewAndUtxoOps.UtxoOps
 	block := utxoViewAndUtxoOps.Block
 	// Put the block in the db
@@ -1788,6 +1819,9 @@ func (bc *Blockchain) commitBlockPoS(blockHash *BlockHash, verifySignatures bool
 		if bc.snapshot == nil {
 			return nil
 		}
+		if innerErr := bc.snapshot.FlushStateCommitmentWithTxn(txn, blockNode.Hash); innerErr != nil {
+			return errors.Wrapf(innerErr, "commitBlockPoS: Problem flushing state commitment")
+		}
 		if innerErr := bc.snapshot.FlushAncestralRecordsWithTxn(txn); innerErr != nil {
 			return errors.Wrapf(innerErr, "commitBlockPoS: Problem flushing ancestral records")
 		}
@@ -1826,6 +1860,8 @@ func (bc *Blockchain) commitBlockPoS(blockHash *BlockHash, verifySignatures bool
 	}
 	bc.snapshotCache.LoadCacheAtSnapshotAtEpochNumber(
 		snapshotEpochNumber, currentEpochNumber, bc.db, bc.snapshot, bc.params)
+	// Committing the block makes it final, so the undo data of an older block may now be past the retention.
+	bc.pruneUndoData()
 	// TODO: What else do we need to do in here?
 	return nil
 }
@@ -2124,6 +2160,7 @@ const (
 	RuleErrorNilPrevBlockHash                                   RuleError = "RuleErrorNilPrevBlockHash"
 	RuleErrorPoSBlockTstampNanoSecsTooOld                       RuleError = "RuleErrorPoSBlockTstampNanoSecsTooOld"
 	RuleErrorPoSBlockTstampNanoSecsInFuture                     RuleError = "RuleErrorPoSBlockTstampNanoSecsInFuture"
+	RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast       RuleError = "RuleErrorPoSBlockTstampNanoSecsNotAfterMedianTimePast"
 	RuleErrorInvalidPoSBlockHeaderVersion                       RuleError = "RuleErrorInvalidPoSBlockHeaderVersion"
 	RuleErrorNoTimeoutOrVoteQC                                  RuleError = "RuleErrorNoTimeoutOrVoteQC"
 	RuleErrorBothTimeoutAndVoteQC                               RuleError = "RuleErrorBothTimeoutAndVoteQC"
@@ -937,7 +937,7 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		},
 	}
 	// Empty QC for both vote and timeout should fail
-	err := bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+	err := bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 	require.Error(t, err)
 	require.Equal(t, err, RuleErrorInvalidVoteQC)
 
@@ -959,11 +959,11 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		},
 	}
 	desoBlock.Header.ValidatorsVoteQC = voteQC
-	err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+	err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 	require.NoError(t, err)
 
 	// Empty validator set should fail
-	err = bc.isValidPoSQuorumCertificate(desoBlock, []*ValidatorEntry{})
+	err = bc.isValidPoSQuorumCertificate(desoBlock, []*ValidatorEntry{}, 0)
 	require.Error(t, err)
 	require.Equal(t, err, RuleErrorInvalidVoteQC)
 
@@ -971,13 +971,13 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 	{
 		// Zero stake amount
 		validatorSet[0].TotalStakeAmountNanos = uint256.NewInt(0)
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil stake amount
 		validatorSet[0].TotalStakeAmountNanos = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
@@ -985,14 +985,14 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		validatorSet[0].TotalStakeAmountNanos = uint256.NewInt(3)
 		// Nil voting public key
 		validatorSet[0].VotingPublicKey = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Reset voting public key
 		validatorSet[0].VotingPublicKey = m1VotingPrivateKey.PublicKey()
 		// Nil validator entry
-		err = bc.isValidPoSQuorumCertificate(desoBlock, append(validatorSet, nil))
+		err = bc.isValidPoSQuorumCertificate(desoBlock, append(validatorSet, nil), 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 	}
@@ -1001,41 +1001,41 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		// Malformed vote QC should fail
 		// Nil vote QC
 		desoBlock.Header.ValidatorsVoteQC = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// View is 0
 		desoBlock.Header.ValidatorsVoteQC = voteQC
 		voteQC.ProposedInView = 0
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil block hash
 		voteQC.ProposedInView = 6
 		voteQC.BlockHash = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil signers list
 		voteQC.ValidatorsVoteAggregatedSignature.SignersList = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil Signature
 		voteQC.ValidatorsVoteAggregatedSignature.SignersList = signersList1And2
 		voteQC.ValidatorsVoteAggregatedSignature.Signature = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil aggregate signature
 		voteQC.BlockHash = hash1
 		voteQC.ValidatorsVoteAggregatedSignature = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 		// Reset the ValidatorsVoteAggregatedSignature
@@ -1049,21 +1049,21 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		// No supermajority in vote QC
 		voteQC.ValidatorsVoteAggregatedSignature.SignersList = bitset.NewBitset().FromBytes([]byte{0x1}) // 0b0001, which represents validator 1
 		voteQC.ValidatorsVoteAggregatedSignature.Signature = vote1Signature
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 	}
 	{
 		// Only having signature for validator 1 should fail even if signers list has validator 2
 		voteQC.ValidatorsVoteAggregatedSignature.SignersList = bitset.NewBitset().FromBytes([]byte{0x3}) // 0b0010, which represents validator 1 and 2
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Having 1 and 3 in signers list, but including signature for 2 should fail
 		voteQC.ValidatorsVoteAggregatedSignature.SignersList = bitset.NewBitset().Set(0, true).Set(2, true) // represents validator 1 and 3
 		voteQC.ValidatorsVoteAggregatedSignature.Signature = aggregateSig
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
@@ -1095,7 +1095,7 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 	desoBlock.Header.ValidatorsVoteQC = nil
 	// Set the timeout qc to the timeout qc constructed above
 	desoBlock.Header.ValidatorsTimeoutAggregateQC = timeoutQC
-	err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+	err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 	require.NoError(t, err)
 
 	{
@@ -1104,55 +1104,55 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		// timeout QC is interpreted as empty
 		// View = 0
 		timeoutQC.TimedOutView = 0
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil high QC
 		timeoutQC.TimedOutView = 8
 		timeoutQC.ValidatorsHighQC = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// High QC has view of 0
 		timeoutQC.ValidatorsHighQC = voteQC
 		timeoutQC.ValidatorsHighQC.ProposedInView = 0
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// No high QC views
 		timeoutQC.ValidatorsHighQC.ProposedInView = 6
 		timeoutQC.ValidatorsTimeoutHighQCViews = []uint64{}
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil high QC block hash
 		timeoutQC.ValidatorsTimeoutHighQCViews = []uint64{6, 5}
 		timeoutQC.ValidatorsHighQC.BlockHash = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil high QC signers list
 		timeoutQC.ValidatorsHighQC.BlockHash = hash1
 		timeoutQC.ValidatorsHighQC.ValidatorsVoteAggregatedSignature.SignersList = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil high QC signature
 		timeoutQC.ValidatorsHighQC.ValidatorsVoteAggregatedSignature.SignersList = signersList1And2
 		timeoutQC.ValidatorsHighQC.ValidatorsVoteAggregatedSignature.Signature = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
 		// Nil High QC Aggregated signature
 		timeoutQC.ValidatorsHighQC.ValidatorsVoteAggregatedSignature = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidVoteQC)
 
@@ -1162,13 +1162,13 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 			Signature:   aggregateSig,
 		}
 
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.NoError(t, err)
 	}
 	{
 		// Timed out view is not exactly one greater than high QC view
 		timeoutQC.ValidatorsHighQC.ProposedInView = 7
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 	}
@@ -1176,13 +1176,13 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		// Invalid validator set tests
 		// Zero stake amount
 		validatorSet[0].TotalStakeAmountNanos = uint256.NewInt(0)
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 
 		// Nil stake amount
 		validatorSet[0].TotalStakeAmountNanos = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 
@@ -1190,14 +1190,14 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		validatorSet[0].TotalStakeAmountNanos = uint256.NewInt(3)
 		// Nil voting public key
 		validatorSet[0].VotingPublicKey = nil
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 
 		// Reset voting public key
 		validatorSet[0].VotingPublicKey = m1VotingPrivateKey.PublicKey()
 		// Nil validator entry
-		err = bc.isValidPoSQuorumCertificate(desoBlock, append(validatorSet, nil))
+		err = bc.isValidPoSQuorumCertificate(desoBlock, append(validatorSet, nil), 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 	}
@@ -1206,7 +1206,7 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 		// No supermajority test
 		timeoutQC.ValidatorsTimeoutAggregatedSignature.SignersList = bitset.NewBitset().FromBytes([]byte{0x1}) // 0b0001, which represents validator 1
 		timeoutQC.ValidatorsTimeoutAggregatedSignature.Signature = timeout1Signature
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 	}
@@ -1214,14 +1214,14 @@ func TestIsValidPoSQuorumCertificate(t *testing.T) {
 	{
 		// Only having signature for validator 1 should fail even if signers list has validator 2
 		timeoutQC.ValidatorsTimeoutAggregatedSignature.SignersList = bitset.NewBitset().FromBytes([]byte{0x3}) // 0b0010, which represents validator 1 and 2
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 
 		// Having 1 and 3 in signers list, but including signature for 2 should fail
 		timeoutQC.ValidatorsTimeoutAggregatedSignature.SignersList = bitset.NewBitset().Set(0, true).Set(2, true) // represents validator 1 and 3
 		timeoutQC.ValidatorsTimeoutAggregatedSignature.Signature = timeoutAggSig
-		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet)
+		err = bc.isValidPoSQuorumCertificate(desoBlock, validatorSet, 0)
 		require.Error(t, err)
 		require.Equal(t, err, RuleErrorInvalidTimeoutQC)
 	}
@@ -2859,13 +2859,13 @@ func NewTestPoSBlockchainWithValidators(t *testing.T) *TestMeta {
 	mempool := NewPosMempool()
 	require.NoError(t, mempool.Init(
 		params, _testGetDefaultGlobalParams(), latestBlockView, 11, _dbDirSetup(t), false,
-		mempoolBackupIntervalMillis, nil, 10000, 100,
+		mempoolBackupIntervalMillis, nil, 10000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(t, mempool.Start())
 	require.True(t, mempool.IsRunning())
 	priv := _generateRandomBLSPrivateKey(t)
 	m0Pk := NewPublicKey(m0PubBytes)
-	posBlockProducer := NewPosBlockProducer(mempool, params, m0Pk, priv.PublicKey(), time.Now().UnixNano())
+	posBlockProducer := NewPosBlockProducer(mempool, params, m0Pk, priv.PublicKey(), time.Now().UnixNano(), nil, nil, false)
 	// TODO: do we need to update the encoder migration stuff for global params. Probably.
 	testMeta.mempool = nil
 	testMeta.posMempool = mempool
@@ -8,7 +8,6 @@ import (
 	"github.com/deso-protocol/core/bls"
 	"github.com/deso-protocol/core/collections"
 	"github.com/deso-protocol/core/consensus"
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +19,11 @@ type FastHotStuffConsensus struct {
 	mempool               Mempool
 	params                *DeSoParams
 	signer                *BLSSigner
+	txnRelayFilter        *TxnRelayFilter
+	inclusionFilter       *BlockInclusionFilter
+	// deterministicTxnShuffle is passed to the PosBlockProducers we create.
+	deterministicTxnShuffle bool
+	logger                  Logger
 }
 
 func NewFastHotStuffConsensus(
@@ -28,14 +32,22 @@ func NewFastHotStuffConsensus(
 	blockchain *Blockchain,
 	mempool Mempool,
 	signer *BLSSigner,
+	txnRelayFilter *TxnRelayFilter,
+	inclusionFilter *BlockInclusionFilter,
+	deterministicTxnShuffle bool,
+	logger Logger,
 ) *FastHotStuffConsensus {
 	return &FastHotStuffConsensus{
-		networkManager:        networkManager,
-		blockchain:            blockchain,
-		fastHotStuffEventLoop: consensus.NewFastHotStuffEventLoop(),
-		mempool:               mempool,
-		params:                params,
-		signer:                signer,
+		networkManager:          networkManager,
+		blockchain:              blockchain,
+		fastHotStuffEventLoop:   consensus.NewFastHotStuffEventLoop(),
+		mempool:                 mempool,
+		params:                  params,
+		signer:                  signer,
+		txnRelayFilter:          txnRelayFilter,
+		inclusionFilter:         inclusionFilter,
+		deterministicTxnShuffle: deterministicTxnShuffle,
+		logger:                  logger,
 	}
 }
 
@@ -43,7 +55,7 @@ func NewFastHotStuffConsensus(
 // blockchain state. This should only be called once the blockchain has synced, the node is
 // ready to join the validator network, and the node is able to validate blocks in the steady state.
 func (fc *FastHotStuffConsensus) Start() error {
-	glog.V(2).Infof("FastHotStuffConsensus.Start: Started running FastHotStuffConsensus.")
+	fc.logger.V(2).Infof("FastHotStuffConsensus.Start: Started running FastHotStuffConsensus.")
 
 	// Hold the consensus' write lock for thread-safety.
 	fc.lock.Lock()
@@ -109,6 +121,13 @@ func (fc *FastHotStuffConsensus) Start() error {
 		time.Duration(currentSnapshotGlobalParams.BlockProductionIntervalMillisecondsPoS)
 	timeoutBaseDuration := time.Millisecond * time.Duration(currentSnapshotGlobalParams.TimeoutIntervalMillisecondsPoS)
 
+	// Set the timeout back-off from the global params.
+	err = fc.fastHotStuffEventLoop.SetTimeoutBackoffMultiplier(
+		currentSnapshotGlobalParams.TimeoutBackoffMultiplierBasisPointsPoS)
+	if err != nil {
+		return errors.Errorf("FastHotStuffConsensus.Start: Error setting timeout back-off multiplier: %v", err)
+	}
+
 	// Refresh the checkpoint block info, so we can get tha latest view.
 	fc.blockchain.updateCheckpointBlockInfo()
 	checkpointBlockInfo := fc.blockchain.GetCheckpointBlockInfo()
@@ -137,10 +156,10 @@ func (fc *FastHotStuffConsensus) Start() error {
 	// Update the validator connections in the NetworkManager. This is a best effort operation. If it fails,
 	// we log the error and continue.
 	if err = fc.updateActiveValidatorConnections(); err != nil {
-		glog.Errorf("FastHotStuffConsensus.tryProcessBlockAsNewTip: Error updating validator connections: %v", err)
+		fc.logger.Errorf("FastHotStuffConsensus.tryProcessBlockAsNewTip: Error updating validator connections: %v", err)
 	}
 
-	glog.V(2).Infof("FastHotStuffConsensus.Start: Successfully started running FastHotStuffConsensus.")
+	fc.logger.V(2).Infof("FastHotStuffConsensus.Start: Successfully started running FastHotStuffConsensus.")
 
 	return nil
 }
@@ -161,8 +180,8 @@ func (fc *FastHotStuffConsensus) Stop() {
 // construct a block at a certain block height. This function validates the block proposal signal,
 // constructs, processes locally, and then broadcasts the block.
 func (fc *FastHotStuffConsensus) HandleLocalBlockProposalEvent(event *consensus.FastHotStuffEvent) error {
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalBlockProposalEvent: %s", event.ToString())
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalBlockProposalEvent: %s", fc.fastHotStuffEventLoop.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalBlockProposalEvent: %s", event.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalBlockProposalEvent: %s", fc.fastHotStuffEventLoop.ToString())
 
 	// Hold a read and write lock on the consensus. This is because we need to check
 	// the current view of the consensus event loop, and to update the blockchain.
@@ -181,7 +200,7 @@ func (fc *FastHotStuffConsensus) HandleLocalBlockProposalEvent(event *consensus.
 
 	// Handle the event as a block proposal event for a regular block
 	if err := fc.handleBlockProposalEvent(event, consensus.FastHotStuffEventTypeConstructVoteQC); err != nil {
-		glog.Errorf("FastHotStuffConsensus.HandleLocalBlockProposalEvent: Error proposing block: %v", err)
+		fc.logger.Errorf("FastHotStuffConsensus.HandleLocalBlockProposalEvent: Error proposing block: %v", err)
 		return errors.Wrapf(err, "FastHotStuffConsensus.HandleLocalBlockProposalEvent: ")
 	}
 
@@ -193,8 +212,8 @@ func (fc *FastHotStuffConsensus) HandleLocalBlockProposalEvent(event *consensus.
 // construct a timeout block at a certain block height. This function validates the timeout block proposal
 // signal, constructs, processes locally, and then broadcasts the block.
 func (fc *FastHotStuffConsensus) HandleLocalTimeoutBlockProposalEvent(event *consensus.FastHotStuffEvent) error {
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutBlockProposalEvent: %s", event.ToString())
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutBlockProposalEvent: %s", fc.fastHotStuffEventLoop.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutBlockProposalEvent: %s", event.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutBlockProposalEvent: %s", fc.fastHotStuffEventLoop.ToString())
 
 	// Hold a read and write lock on the consensus. This is because we need to check
 	// the current view of the consensus event loop, and to update the blockchain.
@@ -213,7 +232,7 @@ func (fc *FastHotStuffConsensus) HandleLocalTimeoutBlockProposalEvent(event *con
 
 	// Handle the event as a block proposal event for a timeout block
 	if err := fc.handleBlockProposalEvent(event, consensus.FastHotStuffEventTypeConstructTimeoutQC); err != nil {
-		glog.Errorf("FastHotStuffConsensus.HandleLocalTimeoutBlockProposalEvent: Error proposing block: %v", err)
+		fc.logger.Errorf("FastHotStuffConsensus.HandleLocalTimeoutBlockProposalEvent: Error proposing block: %v", err)
 		return errors.Wrapf(err, "FastHotStuffConsensus.HandleLocalTimeoutBlockProposalEvent: ")
 	}
 
@@ -348,8 +367,8 @@ func (fc *FastHotStuffConsensus) handleBlockProposalEvent(
 // 3. Process the vote in the consensus module
 // 4. Broadcast the vote msg to the network
 func (fc *FastHotStuffConsensus) HandleLocalVoteEvent(event *consensus.FastHotStuffEvent) error {
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalVoteEvent: %s", event.ToString())
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalVoteEvent: %s", fc.fastHotStuffEventLoop.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalVoteEvent: %s", event.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalVoteEvent: %s", fc.fastHotStuffEventLoop.ToString())
 
 	// Hold a read lock on the consensus. This is because we need to check the
 	// current view and block height of the consensus module.
@@ -412,8 +431,8 @@ func (fc *FastHotStuffConsensus) HandleLocalVoteEvent(event *consensus.FastHotSt
 // HandleValidatorVote is called when we receive a validator vote message from a peer. This function processes
 // the vote locally in the FastHotStuffEventLoop.
 func (fc *FastHotStuffConsensus) HandleValidatorVote(pp *Peer, msg *MsgDeSoValidatorVote) error {
-	glog.V(2).Infof("FastHotStuffConsensus.HandleValidatorVote: %s", msg.ToString())
-	glog.V(2).Infof("FastHotStuffConsensus.HandleValidatorVote: %s", fc.fastHotStuffEventLoop.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleValidatorVote: %s", msg.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleValidatorVote: %s", fc.fastHotStuffEventLoop.ToString())
 
 	// No need to hold a lock on the consensus because this function is a pass-through
 	// for the FastHotStuffEventLoop which guarantees thread-safety for its callers
@@ -422,7 +441,7 @@ func (fc *FastHotStuffConsensus) HandleValidatorVote(pp *Peer, msg *MsgDeSoValid
 	if err := fc.fastHotStuffEventLoop.ProcessValidatorVote(msg); err != nil {
 		// If we can't process the vote locally, then it must somehow be malformed, stale,
 		// or a duplicate vote/timeout for the same view.
-		glog.Errorf("FastHotStuffConsensus.HandleValidatorVote: Error processing vote msg: %v", err)
+		fc.logger.Errorf("FastHotStuffConsensus.HandleValidatorVote: Error processing vote msg: %v", err)
 		return errors.Wrapf(err, "FastHotStuffConsensus.HandleValidatorVote: Error processing vote msg: ")
 	}
 
@@ -440,8 +459,8 @@ func (fc *FastHotStuffConsensus) HandleValidatorVote(pp *Peer, msg *MsgDeSoValid
 // 3. Process the timeout in the consensus module
 // 4. Broadcast the timeout msg to the network
 func (fc *FastHotStuffConsensus) HandleLocalTimeoutEvent(event *consensus.FastHotStuffEvent) error {
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutEvent: %s", event.ToString())
-	glog.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutEvent: %s", fc.fastHotStuffEventLoop.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutEvent: %s", event.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutEvent: %s", fc.fastHotStuffEventLoop.ToString())
 
 	// Hold a read lock on the consensus. This is because we need to check the
 	// current view and block height of the consensus module.
@@ -528,7 +547,7 @@ func (fc *FastHotStuffConsensus) HandleLocalTimeoutEvent(event *consensus.FastHo
 	// Broadcast the block to the validator network
 	validators := fc.networkManager.GetConnectedValidators()
 	for _, validator := range validators {
-		glog.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutEvent: Broadcasting "+
+		fc.logger.V(2).Infof("FastHotStuffConsensus.HandleLocalTimeoutEvent: Broadcasting "+
 			"timeout msg %v to validator ID=%v pubkey=%v addr=%v",
 			timeoutMsg.ToString(),
 			validator.GetId(),
@@ -542,9 +561,9 @@ func (fc *FastHotStuffConsensus) HandleLocalTimeoutEvent(event *consensus.FastHo
 // HandleValidatorTimeout is called when we receive a validator timeout message from a peer. This function
 // processes the timeout locally in the FastHotStuffEventLoop.
 func (fc *FastHotStuffConsensus) HandleValidatorTimeout(pp *Peer, msg *MsgDeSoValidatorTimeout) ([]*BlockHash, error) {
-	glog.V(2).Infof("FastHotStuffConsensus.HandleValidatorTimeout: %s [%v %v]", msg.ToString(),
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleValidatorTimeout: %s [%v %v]", msg.ToString(),
 		msg.VotingPublicKey.ToString(), msg.TimedOutView)
-	glog.V(2).Infof("FastHotStuffConsensus.HandleValidatorTimeout: %s", fc.fastHotStuffEventLoop.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleValidatorTimeout: %s", fc.fastHotStuffEventLoop.ToString())
 
 	// Hold a write lock on the consensus, since we need to update the timeout message in the
 	// FastHotStuffEventLoop.
@@ -567,7 +586,7 @@ func (fc *FastHotStuffConsensus) HandleValidatorTimeout(pp *Peer, msg *MsgDeSoVa
 	if err := fc.fastHotStuffEventLoop.ProcessValidatorTimeout(msg); err != nil {
 		// If we can't process the timeout locally, then it must somehow be malformed, stale,
 		// or a duplicate vote/timeout for the same view.
-		glog.Errorf("FastHotStuffConsensus.HandleValidatorTimeout: Error processing timeout msg: %v", err)
+		fc.logger.Errorf("FastHotStuffConsensus.HandleValidatorTimeout: Error processing timeout msg: %v", err)
 		return nil, errors.Wrapf(err, "FastHotStuffConsensus.HandleValidatorTimeout: Error processing timeout msg: ")
 	}
 
@@ -576,8 +595,8 @@ func (fc *FastHotStuffConsensus) HandleValidatorTimeout(pp *Peer, msg *MsgDeSoVa
 }
 
 func (fc *FastHotStuffConsensus) HandleBlock(pp *Peer, msg *MsgDeSoBlock) (missingBlockHashes []*BlockHash, _err error) {
-	glog.V(2).Infof("FastHotStuffConsensus.HandleBlock: Received block: \n%s", msg.String())
-	glog.V(2).Infof("FastHotStuffConsensus.HandleBlock: %s", fc.fastHotStuffEventLoop.ToString())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleBlock: Received block: \n%s", msg.String())
+	fc.logger.V(2).Infof("FastHotStuffConsensus.HandleBlock: %s", fc.fastHotStuffEventLoop.ToString())
 
 	// Hold a lock on the consensus, because we will need to mutate the Blockchain
 	// and the FastHotStuffEventLoop data structures.
@@ -702,6 +721,12 @@ func (fc *FastHotStuffConsensus) tryProcessBlockAsNewTip(block *MsgDeSoBlock) ([
 	if err != nil {
 		return nil, errors.Errorf("Error fetching snapshot global params: %v", err)
 	}
+	// Update the timeout back-off before processing the tip, which reschedules the next timeout.
+	if err = fc.fastHotStuffEventLoop.SetTimeoutBackoffMultiplier(
+		globalParams.TimeoutBackoffMultiplierBasisPointsPoS,
+	); err != nil {
+		return nil, errors.Errorf("Error setting timeout back-off multiplier: %v", err)
+	}
 	// Pass the new tip and safe blocks to the FastHotStuffEventLoop
 	if err = fc.fastHotStuffEventLoop.ProcessTipBlock(
 		tipBlockWithValidators[0],
@@ -715,7 +740,7 @@ func (fc *FastHotStuffConsensus) tryProcessBlockAsNewTip(block *MsgDeSoBlock) ([
 	// Update the validator connections in the NetworkManager. This is a best effort operation. If it fails,
 	// we log the error and continue.
 	if err = fc.updateActiveValidatorConnections(); err != nil {
-		glog.Errorf("FastHotStuffConsensus.tryProcessBlockAsNewTip: Error updating validator connections: %v", err)
+		fc.logger.Errorf("FastHotStuffConsensus.tryProcessBlockAsNewTip: Error updating validator connections: %v", err)
 	}
 
 	// Happy path. The block was processed successfully and applied as the new tip. Nothing left to do.
@@ -889,6 +914,9 @@ func (fc *FastHotStuffConsensus) createBlockProducer(bav *UtxoView, previousBloc
 		blockProducerPublicKey,
 		blockProducerBlsPublicKey,
 		previousBlockTimestampNanoSecs,
+		fc.txnRelayFilter,
+		fc.inclusionFilter,
+		fc.deterministicTxnShuffle,
 	)
 	return blockProducer, nil
 }
@@ -1003,7 +1031,7 @@ func (fc *FastHotStuffConsensus) logBlockProposal(block *MsgDeSoBlock, blockHash
 		aggQCHighQCViews = fmt.Sprint(block.Header.ValidatorsTimeoutAggregateQC.GetHighQCViews())
 	}
 
-	glog.Infof(
+	fc.logger.Infof(
 		"\n==================================== YOU PROPOSED A NEW FAST-HOTSTUFF BLOCK! ===================================="+
 			"\n  Timestamp: %d, View: %d, Height: %d, BlockHash: %v"+
 			"\n  Proposer Voting PKey: %s"+
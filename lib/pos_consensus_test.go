@@ -27,6 +27,7 @@ func TestFastHotStuffConsensusHandleLocalVoteEvent(t *testing.T) {
 	fastHotStuffConsensus := FastHotStuffConsensus{
 		lock:           sync.RWMutex{},
 		networkManager: _createMockNetworkManagerForConsensus(),
+		logger:         NewLogger(nil, LogComponentConsensus),
 		blockchain: &Blockchain{
 			params: &DeSoTestnetParams,
 		},
@@ -106,6 +107,7 @@ func TestFastHotStuffConsensusHandleLocalTimeoutEvent(t *testing.T) {
 	fastHotStuffConsensus := FastHotStuffConsensus{
 		lock:           sync.RWMutex{},
 		networkManager: _createMockNetworkManagerForConsensus(),
+		logger:         NewLogger(nil, LogComponentConsensus),
 		signer: &BLSSigner{
 			privateKey: blsPrivateKey,
 		},
@@ -209,5 +211,6 @@ func _createMockNetworkManagerForConsensus() *NetworkManager {
 		ValidatorInboundIndex:     collections.NewConcurrentMap[bls.SerializedPublicKey, *RemoteNode](),
 		NonValidatorOutboundIndex: collections.NewConcurrentMap[RemoteNodeId, *RemoteNode](),
 		NonValidatorInboundIndex:  collections.NewConcurrentMap[RemoteNodeId, *RemoteNode](),
+		logger:                    NewLogger(nil, LogComponentNetworkManager),
 	}
 }
@@ -37,6 +37,7 @@ func (bav *UtxoView) IsLastBlockInCurrentEpoch(blockHeight uint64) (bool, error)
 // operations have been applied in the epoch.
 // - Jail all inactive validators from the current snapshot validator set.
 // - Reward all snapshotted stakes from the current snapshot validator set.
+// - Advance all validators' voting key rotations.
 //
 // Step 2: Create snapshots of the current state. Snapshotting operations here should only create new
 // snapshot state. They should have no other side effects that mutate the existing state of the view.
@@ -118,6 +119,15 @@ func (bav *UtxoView) runEpochCompleteStateTransition(blockHeight uint64, blockTi
 		return nil, errors.Wrapf(err, "runEpochCompleteStateTransition: problem rewarding snapshot stakes: ")
 	}
 
+	// Advance the validators' voting key rotations, so that the validator set snapshotted at the end
+	// of this epoch has the voting keys that take effect at the next epoch. This is an O(n) operation
+	// in the number of validators with a rotation in progress.
+	//
+	// Note, this will only run if we are past the ValidatorVotingKeyRotationBlockHeight fork height.
+	if err = bav.AdvanceValidatorVotingKeyRotations(blockHeight); err != nil {
+		return nil, errors.Wrapf(err, "runEpochCompleteStateTransition: problem advancing validator voting key rotations: ")
+	}
+
 	// TODO: To prevent the state from bloating, we should delete nonces periodically.
 	// We used to do that here but it was causing badger seeks to be slow due to a bug
 	// in badger whereby deleting keys slows down seeks. Eventually, we should go back
@@ -793,6 +793,78 @@ func TestStakingRewardDistribution(t *testing.T) {
 		require.Equal(t, validatorEntry.TotalStakeAmountNanos.Uint64(), uint64(200+50))
 	}
 
+	{
+		// Test that a reward statement was recorded for each stake, with the commission withheld.
+		utxoView := _newUtxoView(testMeta)
+		m2Statements, err := utxoView.GetStakingRewardStatementsForStaker(m2PKID, nil, 10)
+		require.NoError(t, err)
+		require.Len(t, m2Statements, 1)
+		rewardEpochNumber := m2Statements[0].EpochNumber
+		require.Equal(t, m2Statements[0].ValidatorPKID, m0PKID)
+		require.Equal(t, m2Statements[0].StakeAmountNanos, uint256.NewInt(100))
+		require.Equal(t, m2Statements[0].RewardNanos, uint64(8))
+		require.Equal(t, m2Statements[0].CommissionNanos, uint64(2))
+		require.Equal(t, m2Statements[0].RewardMethod, StakingRewardMethodRestake)
+
+		m3Statements, err := utxoView.GetStakingRewardStatementsForStaker(m3PKID, nil, 10)
+		require.NoError(t, err)
+		require.Len(t, m3Statements, 1)
+		require.Equal(t, m3Statements[0].RewardNanos, uint64(4))
+		require.Equal(t, m3Statements[0].CommissionNanos, uint64(1))
+		require.Equal(t, m3Statements[0].RewardMethod, StakingRewardMethodPayToBalance)
+
+		// The validator's statements include its own stake, which pays no commission, and the stake delegated to it.
+		m0Statements, err := utxoView.GetStakingRewardStatementsForEpochAndValidator(rewardEpochNumber, m0PKID, nil, 10)
+		require.NoError(t, err)
+		require.Len(t, m0Statements, 2)
+		stakerRewards := make(map[PKID]uint64)
+		var totalCommissionNanos uint64
+		for _, statement := range m0Statements {
+			stakerRewards[*statement.StakerPKID] = statement.RewardNanos
+			totalCommissionNanos += statement.CommissionNanos
+		}
+		require.Equal(t, stakerRewards[*m0PKID], uint64(42))
+		require.Equal(t, stakerRewards[*m2PKID], uint64(8))
+		require.Equal(t, totalCommissionNanos, uint64(2))
+
+		// Statements can be paginated.
+		firstPage, err := utxoView.GetStakingRewardStatementsForEpochAndValidator(rewardEpochNumber, m0PKID, nil, 1)
+		require.NoError(t, err)
+		require.Len(t, firstPage, 1)
+		require.Equal(t, firstPage[0].StakerPKID, m0Statements[0].StakerPKID)
+		secondPage, err := utxoView.GetStakingRewardStatementsForEpochAndValidator(
+			rewardEpochNumber, m0PKID, firstPage[0], 1)
+		require.NoError(t, err)
+		require.Len(t, secondPage, 1)
+		require.Equal(t, secondPage[0].StakerPKID, m0Statements[1].StakerPKID)
+		thirdPage, err := utxoView.GetStakingRewardStatementsForEpochAndValidator(
+			rewardEpochNumber, m0PKID, secondPage[0], 1)
+		require.NoError(t, err)
+		require.Empty(t, thirdPage)
+
+		// Deleting the epoch's statements in the view hides them, and statements set in the view are merged with
+		// the statements in the db.
+		require.NoError(t, utxoView._deleteStakingRewardStatementsForEpoch(rewardEpochNumber))
+		m0Statements, err = utxoView.GetStakingRewardStatementsForEpochAndValidator(rewardEpochNumber, m0PKID, nil, 10)
+		require.NoError(t, err)
+		require.Empty(t, m0Statements)
+		utxoView._setStakingRewardStatementMappings(&StakingRewardStatementEntry{
+			EpochNumber:      rewardEpochNumber + 1,
+			ValidatorPKID:    m0PKID,
+			StakerPKID:       m2PKID,
+			StakeAmountNanos: uint256.NewInt(108),
+			RewardNanos:      9,
+			CommissionNanos:  2,
+		})
+		m2Statements, err = _newUtxoView(testMeta).GetStakingRewardStatementsForStaker(m2PKID, nil, 10)
+		require.NoError(t, err)
+		require.Len(t, m2Statements, 1)
+		m2Statements, err = utxoView.GetStakingRewardStatementsForStaker(m2PKID, nil, 10)
+		require.NoError(t, err)
+		require.Len(t, m2Statements, 1)
+		require.Equal(t, m2Statements[0].EpochNumber, rewardEpochNumber+1)
+	}
+
 	{
 		// Test that snapshot stakes have not changed.
 		snapshotStakeEntries, err := _newUtxoView(testMeta).GetAllSnapshotStakesToReward()
@@ -0,0 +1,471 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Epoch Export
+//
+// Auditors and supply dashboards want a record of the chain's economics at regular intervals, and epoch
+// boundaries are a natural place to take one. The EpochExporter listens for committed blocks and, whenever a
+// block completes an epoch, builds an EpochExport with the total DESO supply broken down by where it is held,
+// the staked totals, the validator set, and the fees burned during the epoch. It hands the export to one or
+// more EpochExportSinks.
+//
+// The state in an export is the committed state after the epoch's final block, which includes the staking
+// rewards paid out for the epoch. Every supply total requires a scan over a prefix of the db, so the exporter
+// opens a read transaction when the block is committed, which pins the db at that point, and does the scans in
+// the background. This keeps the exports consistent without slowing down block processing.
+//
+// Fee burn totals are accumulated from the blocks the exporter sees, so they're only complete for epochs whose
+// every block was committed while the exporter was running. Each export says whether its totals are complete.
+//
+// Sinks are pluggable: FileEpochExportSink writes each export to a JSON file and WebhookEpochExportSink posts it
+// to a URL. An embedding application can implement EpochExportSink to upload exports to S3 or any other store.
+
+const (
+	// epochExportQueueSize is the number of exports that can wait for the background worker. Epochs last
+	// much longer than an export takes, so the queue only fills up if the sinks are stuck.
+	epochExportQueueSize = 8
+	// epochExportMaxAttempts is the number of times we try to hand an export to a sink before giving up.
+	epochExportMaxAttempts = 3
+	// epochExportRetryInterval is how long we wait between attempts.
+	epochExportRetryInterval = 5 * time.Second
+	// webhookEpochExportSinkTimeout bounds each request made by a WebhookEpochExportSink.
+	webhookEpochExportSinkTimeout = 30 * time.Second
+)
+
+// EpochExportValidator is a registered validator at the end of an epoch.
+type EpochExportValidator struct {
+	ValidatorPKIDBase58Check string
+	Status                   string
+	TotalStakeAmountNanos    uint64
+	LastActiveAtEpochNumber  uint64
+}
+
+// EpochExport is a summary of the chain's economics at the end of an epoch.
+type EpochExport struct {
+	EpochNumber                 uint64
+	FinalBlockHeight            uint64
+	FinalBlockHashHex           string
+	FinalBlockTimestampNanoSecs int64
+
+	// TotalSupplyNanos is the sum of the DESO held in the places below.
+	TotalSupplyNanos uint64
+	// SpendableBalanceNanos is the DESO in public key balances.
+	SpendableBalanceNanos uint64
+	// StakedNanos is the DESO staked with validators, and LockedStakeNanos is the DESO that has been unstaked
+	// but not yet unlocked.
+	StakedNanos      uint64
+	LockedStakeNanos uint64
+	// LockedBalanceNanos is the DESO in coin lockups.
+	LockedBalanceNanos uint64
+	// CreatorCoinReserveNanos is the DESO locked in creator coin reserves.
+	CreatorCoinReserveNanos uint64
+
+	// Validators are all of the registered validators, largest stake first.
+	Validators []*EpochExportValidator
+
+	// FeeBurnNanos is the amount of transaction fees burned during the epoch. Fees are only burned after the
+	// PoS cutover. FeeBurnIsComplete is false if the exporter didn't see every block in the epoch.
+	FeeBurnNanos      uint64
+	FeeBurnIsComplete bool
+}
+
+// EpochExportSink receives each EpochExport. Exports are delivered from a single background goroutine, in epoch
+// order. If ExportEpoch returns an error, the export is retried a few times before it is dropped.
+type EpochExportSink interface {
+	ExportEpoch(export *EpochExport) error
+}
+
+// epochFeeTracker accumulates the fees burned in the blocks of an epoch as they're committed.
+type epochFeeTracker struct {
+	epochNumber uint64
+	// initialBlockHeight is only known if we saw the epoch start.
+	initialBlockHeight      uint64
+	hasInitialBlockHeight   bool
+	numBlocks               uint64
+	feeBurnNanos            uint64
+	hasFeeBurnNanosOverflow bool
+}
+
+type epochExportJob struct {
+	export *EpochExport
+	// txn is a read transaction opened right after the epoch's final block was committed.
+	txn *badger.Txn
+}
+
+type EpochExporter struct {
+	db     *badger.DB
+	params *DeSoParams
+	sinks  []EpochExportSink
+
+	// feeTracker is only accessed from the block committed handler, which the blockchain calls from one
+	// goroutine at a time.
+	feeTracker *epochFeeTracker
+
+	jobs      chan *epochExportJob
+	quit      chan struct{}
+	waitGroup sync.WaitGroup
+}
+
+func NewEpochExporter(db *badger.DB, params *DeSoParams, sinks ...EpochExportSink) (*EpochExporter, error) {
+	if db == nil || params == nil {
+		return nil, fmt.Errorf("NewEpochExporter: db and params must be set")
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("NewEpochExporter: at least one sink must be set")
+	}
+	return &EpochExporter{
+		db:     db,
+		params: params,
+		sinks:  sinks,
+		jobs:   make(chan *epochExportJob, epochExportQueueSize),
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// RegisterWithEventManager subscribes the exporter to the blocks committed by the provided EventManager. It
+// must be called before the node starts processing blocks, or the fee burn totals of the first epoch will be
+// incomplete.
+func (exporter *EpochExporter) RegisterWithEventManager(eventManager *EventManager) {
+	eventManager.OnBlockCommitted(exporter._handleBlockCommitted)
+}
+
+// Start starts the background worker that builds the exports and hands them to the sinks.
+func (exporter *EpochExporter) Start() {
+	exporter.waitGroup.Add(1)
+	go func() {
+		defer exporter.waitGroup.Done()
+		for {
+			select {
+			case <-exporter.quit:
+				return
+			case job := <-exporter.jobs:
+				exporter._runJob(job)
+			}
+		}
+	}()
+	glog.Infof("EpochExporter.Start: Exporting epochs to %d sink(s)", len(exporter.sinks))
+}
+
+// Stop waits for the export in progress, if any, and drops the exports that haven't started.
+func (exporter *EpochExporter) Stop() {
+	close(exporter.quit)
+	exporter.waitGroup.Wait()
+	for {
+		select {
+		case job := <-exporter.jobs:
+			job.txn.Discard()
+		default:
+			return
+		}
+	}
+}
+
+func (exporter *EpochExporter) _handleBlockCommitted(event *BlockEvent) {
+	if event.Block == nil || event.Block.Header == nil {
+		return
+	}
+	blockHeight := event.Block.Header.Height
+	if blockHeight < uint64(exporter.params.ForkHeights.ProofOfStake1StateSetupBlockHeight) {
+		return
+	}
+
+	// The block has been flushed, so the db has the epoch that follows it.
+	currentEpochEntry, err := DBGetCurrentEpochEntry(exporter.db, nil)
+	if err != nil {
+		glog.Errorf("EpochExporter._handleBlockCommitted: Problem getting current epoch entry: %v", err)
+		return
+	}
+	if currentEpochEntry == nil {
+		return
+	}
+	isFinalBlockInEpoch := currentEpochEntry.InitialBlockHeight == blockHeight+1 && currentEpochEntry.EpochNumber > 0
+
+	// Add the block to the fees of its epoch.
+	blockEpochNumber := currentEpochEntry.EpochNumber
+	if isFinalBlockInEpoch {
+		blockEpochNumber--
+	}
+	if exporter.feeTracker == nil || exporter.feeTracker.epochNumber != blockEpochNumber {
+		exporter.feeTracker = &epochFeeTracker{epochNumber: blockEpochNumber}
+		if !isFinalBlockInEpoch {
+			exporter.feeTracker.initialBlockHeight = currentEpochEntry.InitialBlockHeight
+			exporter.feeTracker.hasInitialBlockHeight = true
+		}
+	}
+	exporter.feeTracker.numBlocks++
+	if blockHeight >= uint64(exporter.params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight) {
+		blockFeeBurnNanos, err := computeBlockFeeBurnNanos(event.Block)
+		if err == nil {
+			exporter.feeTracker.feeBurnNanos, err = SafeUint64().Add(exporter.feeTracker.feeBurnNanos, blockFeeBurnNanos)
+		}
+		if err != nil {
+			glog.Errorf("EpochExporter._handleBlockCommitted: Problem computing fee burn for block %d: %v",
+				blockHeight, err)
+			exporter.feeTracker.hasFeeBurnNanosOverflow = true
+		}
+	}
+	if !isFinalBlockInEpoch {
+		return
+	}
+
+	tracker := exporter.feeTracker
+	// The next block starts the epoch we just read from the db.
+	exporter.feeTracker = &epochFeeTracker{
+		epochNumber:           currentEpochEntry.EpochNumber,
+		initialBlockHeight:    currentEpochEntry.InitialBlockHeight,
+		hasInitialBlockHeight: true,
+	}
+
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		glog.Errorf("EpochExporter._handleBlockCommitted: Problem hashing block %d: %v", blockHeight, err)
+		return
+	}
+	export := &EpochExport{
+		EpochNumber:                 blockEpochNumber,
+		FinalBlockHeight:            blockHeight,
+		FinalBlockHashHex:           blockHash.String(),
+		FinalBlockTimestampNanoSecs: event.Block.Header.TstampNanoSecs,
+		FeeBurnNanos:                tracker.feeBurnNanos,
+		FeeBurnIsComplete: tracker.hasInitialBlockHeight && !tracker.hasFeeBurnNanosOverflow &&
+			blockHeight >= tracker.initialBlockHeight && tracker.numBlocks == blockHeight-tracker.initialBlockHeight+1,
+	}
+	job := &epochExportJob{export: export, txn: exporter.db.NewTransaction(false)}
+	select {
+	case exporter.jobs <- job:
+	default:
+		job.txn.Discard()
+		glog.Errorf("EpochExporter._handleBlockCommitted: Dropping export of epoch %d because the queue is full",
+			blockEpochNumber)
+	}
+}
+
+func (exporter *EpochExporter) _runJob(job *epochExportJob) {
+	err := job.export._populateFromDbWithTxn(job.txn, exporter.params)
+	job.txn.Discard()
+	if err != nil {
+		glog.Errorf("EpochExporter._runJob: Problem building export of epoch %d: %v", job.export.EpochNumber, err)
+		return
+	}
+
+	for _, sink := range exporter.sinks {
+		for attempt := 1; ; attempt++ {
+			err = sink.ExportEpoch(job.export)
+			if err == nil {
+				break
+			}
+			if attempt == epochExportMaxAttempts {
+				glog.Errorf("EpochExporter._runJob: Giving up on exporting epoch %d to %T: %v",
+					job.export.EpochNumber, sink, err)
+				break
+			}
+			glog.Warningf("EpochExporter._runJob: Problem exporting epoch %d to %T, retrying: %v",
+				job.export.EpochNumber, sink, err)
+			select {
+			case <-exporter.quit:
+				return
+			case <-time.After(epochExportRetryInterval):
+			}
+		}
+	}
+	glog.Infof("EpochExporter._runJob: Exported epoch %d", job.export.EpochNumber)
+}
+
+// computeBlockFeeBurnNanos returns the fees burned in a PoS block. See NewBlockFeeSplitEntry.
+func computeBlockFeeBurnNanos(block *MsgDeSoBlock) (uint64, error) {
+	feeSplitEntry, err := NewBlockFeeSplitEntry(block, nil, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "computeBlockFeeBurnNanos: ")
+	}
+	return feeSplitEntry.BurnedFeesNanos, nil
+}
+
+// _populateFromDbWithTxn fills in the supply totals and the validator set from the db.
+func (export *EpochExport) _populateFromDbWithTxn(txn *badger.Txn, params *DeSoParams) error {
+	safeUint64 := SafeUint64()
+	var err error
+
+	// Balances are stored as big-endian uint64s.
+	err = _iterateEpochExportPrefixWithTxn(txn, Prefixes.PrefixPublicKeyToDeSoBalanceNanos, func(value []byte) error {
+		var innerErr error
+		export.SpendableBalanceNanos, innerErr = safeUint64.Add(export.SpendableBalanceNanos, DecodeUint64(value))
+		return innerErr
+	})
+	if err != nil {
+		return errors.Wrapf(err, "EpochExport._populateFromDbWithTxn: Problem summing balances: ")
+	}
+
+	// Every stake is included in its validator's total, so we don't need to scan the stake entries.
+	err = _iterateEpochExportPrefixWithTxn(txn, Prefixes.PrefixValidatorByPKID, func(value []byte) error {
+		validatorEntry, err := DecodeDeSoEncoder(&ValidatorEntry{}, bytes.NewReader(value))
+		if err != nil {
+			return err
+		}
+		if !validatorEntry.TotalStakeAmountNanos.IsUint64() {
+			return fmt.Errorf("stake of validator %v overflows uint64", validatorEntry.ValidatorPKID)
+		}
+		totalStakeAmountNanos := validatorEntry.TotalStakeAmountNanos.Uint64()
+		export.StakedNanos, err = safeUint64.Add(export.StakedNanos, totalStakeAmountNanos)
+		if err != nil {
+			return err
+		}
+		export.Validators = append(export.Validators, &EpochExportValidator{
+			ValidatorPKIDBase58Check: PkToString(validatorEntry.ValidatorPKID.ToBytes(), params),
+			Status:                   validatorEntry.Status().ToString(),
+			TotalStakeAmountNanos:    totalStakeAmountNanos,
+			LastActiveAtEpochNumber:  validatorEntry.LastActiveAtEpochNumber,
+		})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "EpochExport._populateFromDbWithTxn: Problem summing stake: ")
+	}
+	sort.SliceStable(export.Validators, func(ii, jj int) bool {
+		return export.Validators[ii].TotalStakeAmountNanos > export.Validators[jj].TotalStakeAmountNanos
+	})
+
+	err = _iterateEpochExportPrefixWithTxn(txn, Prefixes.PrefixLockedStakeByValidatorAndStakerAndLockedAt, func(value []byte) error {
+		lockedStakeEntry, err := DecodeDeSoEncoder(&LockedStakeEntry{}, bytes.NewReader(value))
+		if err != nil {
+			return err
+		}
+		if !lockedStakeEntry.LockedAmountNanos.IsUint64() {
+			return fmt.Errorf("locked stake of staker %v overflows uint64", lockedStakeEntry.StakerPKID)
+		}
+		export.LockedStakeNanos, err = safeUint64.Add(export.LockedStakeNanos, lockedStakeEntry.LockedAmountNanos.Uint64())
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "EpochExport._populateFromDbWithTxn: Problem summing locked stake: ")
+	}
+
+	// DESO lockups are the ones whose profile is the ZeroPKID.
+	err = _iterateEpochExportPrefixWithTxn(txn, Prefixes.PrefixLockedBalanceEntry, func(value []byte) error {
+		lockedBalanceEntry, err := DecodeDeSoEncoder(&LockedBalanceEntry{}, bytes.NewReader(value))
+		if err != nil {
+			return err
+		}
+		if !lockedBalanceEntry.ProfilePKID.IsZeroPKID() {
+			return nil
+		}
+		if !lockedBalanceEntry.BalanceBaseUnits.IsUint64() {
+			return fmt.Errorf("locked balance of %v overflows uint64", lockedBalanceEntry.HODLerPKID)
+		}
+		export.LockedBalanceNanos, err = safeUint64.Add(export.LockedBalanceNanos, lockedBalanceEntry.BalanceBaseUnits.Uint64())
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "EpochExport._populateFromDbWithTxn: Problem summing locked balances: ")
+	}
+
+	err = _iterateEpochExportPrefixWithTxn(txn, Prefixes.PrefixPKIDToProfileEntry, func(value []byte) error {
+		profileEntry, err := DecodeDeSoEncoder(&ProfileEntry{}, bytes.NewReader(value))
+		if err != nil {
+			return err
+		}
+		export.CreatorCoinReserveNanos, err = safeUint64.Add(
+			export.CreatorCoinReserveNanos, profileEntry.CreatorCoinEntry.DeSoLockedNanos)
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "EpochExport._populateFromDbWithTxn: Problem summing creator coin reserves: ")
+	}
+
+	for _, amountNanos := range []uint64{export.SpendableBalanceNanos, export.StakedNanos, export.LockedStakeNanos,
+		export.LockedBalanceNanos, export.CreatorCoinReserveNanos} {
+		export.TotalSupplyNanos, err = safeUint64.Add(export.TotalSupplyNanos, amountNanos)
+		if err != nil {
+			return errors.Wrapf(err, "EpochExport._populateFromDbWithTxn: Problem summing total supply: ")
+		}
+	}
+	return nil
+}
+
+func _iterateEpochExportPrefixWithTxn(txn *badger.Txn, prefix []byte, handleValue func(value []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+	for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+		value, err := iterator.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err = handleValue(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileEpochExportSink writes each export to <dir>/epoch-<EpochNumber>.json.
+type FileEpochExportSink struct {
+	dir string
+}
+
+func NewFileEpochExportSink(dir string) (*FileEpochExportSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "NewFileEpochExportSink: Problem creating directory %v", dir)
+	}
+	return &FileEpochExportSink{dir: dir}, nil
+}
+
+func (sink *FileEpochExportSink) ExportEpoch(export *EpochExport) error {
+	exportBytes, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "FileEpochExportSink.ExportEpoch: Problem encoding export: ")
+	}
+	// Write to a temporary file first so that readers never see a partial export.
+	path := filepath.Join(sink.dir, fmt.Sprintf("epoch-%d.json", export.EpochNumber))
+	if err = os.WriteFile(path+".tmp", exportBytes, 0600); err != nil {
+		return errors.Wrapf(err, "FileEpochExportSink.ExportEpoch: Problem writing %v", path)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return errors.Wrapf(err, "FileEpochExportSink.ExportEpoch: Problem renaming %v", path)
+	}
+	return nil
+}
+
+// WebhookEpochExportSink posts each export to a URL as JSON. Any status other than 2xx is an error.
+type WebhookEpochExportSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookEpochExportSink(url string) *WebhookEpochExportSink {
+	return &WebhookEpochExportSink{
+		url:    url,
+		client: &http.Client{Timeout: webhookEpochExportSinkTimeout},
+	}
+}
+
+func (sink *WebhookEpochExportSink) ExportEpoch(export *EpochExport) error {
+	exportBytes, err := json.Marshal(export)
+	if err != nil {
+		return errors.Wrapf(err, "WebhookEpochExportSink.ExportEpoch: Problem encoding export: ")
+	}
+	resp, err := sink.client.Post(sink.url, "application/json", bytes.NewReader(exportBytes))
+	if err != nil {
+		return errors.Wrapf(err, "WebhookEpochExportSink.ExportEpoch: Problem posting export: ")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("WebhookEpochExportSink.ExportEpoch: Webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
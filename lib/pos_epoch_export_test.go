@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+type channelEpochExportSink struct {
+	exports chan *EpochExport
+}
+
+func (sink *channelEpochExportSink) ExportEpoch(export *EpochExport) error {
+	sink.exports <- export
+	return nil
+}
+
+func TestEpochExporter(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	params := DeSoTestnetParams
+	params.ForkHeights.ProofOfStake1StateSetupBlockHeight = 1
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 1
+
+	exportDir := filepath.Join(dir, "epoch-exports")
+	fileSink, err := NewFileEpochExportSink(exportDir)
+	require.NoError(err)
+	channelSink := &channelEpochExportSink{exports: make(chan *EpochExport, 10)}
+	exporter, err := NewEpochExporter(db, &params, fileSink, channelSink)
+	require.NoError(err)
+	eventManager := NewEventManager()
+	exporter.RegisterWithEventManager(eventManager)
+	exporter.Start()
+	defer exporter.Stop()
+
+	// Each block pays 100 nanos in fees and 10 nanos in block rewards, so it burns 90 nanos.
+	newBlock := func(height uint64) *MsgDeSoBlock {
+		return &MsgDeSoBlock{
+			Header: &MsgDeSoHeader{Version: HeaderVersion1, Height: height, TstampNanoSecs: int64(height)},
+			Txns: []*MsgDeSoTxn{
+				{
+					TxOutputs: []*DeSoOutput{{PublicKey: m0PkBytes, AmountNanos: 10}},
+					TxnMeta:   &BlockRewardMetadataa{},
+				},
+				{
+					PublicKey:   m1PkBytes,
+					TxnFeeNanos: 100,
+					TxnMeta:     &BasicTransferMetadata{},
+				},
+			},
+		}
+	}
+	setCurrentEpoch := func(epochNumber uint64, initialBlockHeight uint64) {
+		utxoView := NewUtxoView(db, &params, nil, nil, nil)
+		utxoView._setCurrentEpochEntry(&EpochEntry{
+			EpochNumber:        epochNumber,
+			InitialBlockHeight: initialBlockHeight,
+			FinalBlockHeight:   initialBlockHeight + 2,
+		})
+		require.NoError(utxoView.FlushToDb(initialBlockHeight))
+	}
+	commitBlock := func(height uint64) {
+		eventManager.blockCommitted(&BlockEvent{Block: newBlock(height)})
+	}
+
+	// Put DESO in each of the places the export counts.
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	utxoView.PublicKeyToDeSoBalanceNanos[*NewPublicKey(m0PkBytes)] = 1000
+	utxoView.PublicKeyToDeSoBalanceNanos[*NewPublicKey(m1PkBytes)] = 500
+	m0PKID, m1PKID := NewPKID(m0PkBytes), NewPKID(m1PkBytes)
+	for _, validatorEntry := range []*ValidatorEntry{
+		{ValidatorPKID: m0PKID, TotalStakeAmountNanos: uint256.NewInt(200), LastActiveAtEpochNumber: 3},
+		{ValidatorPKID: m1PKID, TotalStakeAmountNanos: uint256.NewInt(300), LastActiveAtEpochNumber: 2},
+	} {
+		validatorEntry.VotingPublicKey = _generateRandomBLSPrivateKey(t).PublicKey()
+		utxoView._setValidatorEntryMappings(validatorEntry)
+	}
+	utxoView._setLockedStakeEntryMappings(&LockedStakeEntry{
+		StakerPKID:          m1PKID,
+		ValidatorPKID:       m0PKID,
+		LockedAmountNanos:   uint256.NewInt(40),
+		LockedAtEpochNumber: 2,
+	})
+	utxoView._setLockedBalanceEntry(&LockedBalanceEntry{
+		HODLerPKID:       m0PKID,
+		ProfilePKID:      ZeroPKID.NewPKID(),
+		BalanceBaseUnits: *uint256.NewInt(30),
+	})
+	// Lockups of other coins don't count.
+	utxoView._setLockedBalanceEntry(&LockedBalanceEntry{
+		HODLerPKID:       m0PKID,
+		ProfilePKID:      m1PKID,
+		BalanceBaseUnits: *uint256.NewInt(1000000),
+	})
+	utxoView._setProfileEntryMappings(&ProfileEntry{
+		PublicKey:        m0PkBytes,
+		Username:         []byte("m0"),
+		CreatorCoinEntry: CoinEntry{DeSoLockedNanos: 7},
+	})
+	require.NoError(utxoView.FlushToDb(0))
+
+	// The exporter sees all of epoch 3, which ends with block 12.
+	setCurrentEpoch(3, 10)
+	commitBlock(10)
+	commitBlock(11)
+	setCurrentEpoch(4, 13)
+	commitBlock(12)
+
+	var export *EpochExport
+	select {
+	case export = <-channelSink.exports:
+	case <-time.After(10 * time.Second):
+		require.Fail("timed out waiting for the export of epoch 3")
+	}
+	blockHash, err := newBlock(12).Hash()
+	require.NoError(err)
+	require.Equal(&EpochExport{
+		EpochNumber:                 3,
+		FinalBlockHeight:            12,
+		FinalBlockHashHex:           blockHash.String(),
+		FinalBlockTimestampNanoSecs: 12,
+		TotalSupplyNanos:            1000 + 500 + 200 + 300 + 40 + 30 + 7,
+		SpendableBalanceNanos:       1500,
+		StakedNanos:                 500,
+		LockedStakeNanos:            40,
+		LockedBalanceNanos:          30,
+		CreatorCoinReserveNanos:     7,
+		Validators: []*EpochExportValidator{
+			{
+				ValidatorPKIDBase58Check: PkToString(m1PkBytes, &params),
+				Status:                   ValidatorStatusActive.ToString(),
+				TotalStakeAmountNanos:    300,
+				LastActiveAtEpochNumber:  2,
+			},
+			{
+				ValidatorPKIDBase58Check: PkToString(m0PkBytes, &params),
+				Status:                   ValidatorStatusActive.ToString(),
+				TotalStakeAmountNanos:    200,
+				LastActiveAtEpochNumber:  3,
+			},
+		},
+		FeeBurnNanos:      270,
+		FeeBurnIsComplete: true,
+	}, export)
+
+	// The file sink writes the same export.
+	exportBytes, err := os.ReadFile(filepath.Join(exportDir, "epoch-3.json"))
+	require.NoError(err)
+	fileExport := &EpochExport{}
+	require.NoError(json.Unmarshal(exportBytes, fileExport))
+	require.Equal(export, fileExport)
+
+	// The exporter misses block 13, so the fee burn of epoch 4 is incomplete.
+	commitBlock(14)
+	setCurrentEpoch(5, 16)
+	commitBlock(15)
+	select {
+	case export = <-channelSink.exports:
+	case <-time.After(10 * time.Second):
+		require.Fail("timed out waiting for the export of epoch 4")
+	}
+	require.Equal(uint64(4), export.EpochNumber)
+	require.Equal(uint64(180), export.FeeBurnNanos)
+	require.False(export.FeeBurnIsComplete)
+
+	// Blocks in the middle of an epoch don't trigger an export.
+	commitBlock(16)
+	select {
+	case export = <-channelSink.exports:
+		require.Fail("unexpected export of epoch %d", export.EpochNumber)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
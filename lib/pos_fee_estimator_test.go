@@ -25,7 +25,7 @@ func TestFeeEstimator(t *testing.T) {
 
 	mempool := NewPosMempool()
 	err := mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 10000, 100, 0, 0, 0, 0,
 	)
 	require.NoError(t, err)
 	require.NoError(t, mempool.Start())
@@ -3,6 +3,7 @@ package lib
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
@@ -35,6 +36,8 @@ type Mempool interface {
 	UpdateGlobalParams(globalParams *GlobalParamsEntry)
 
 	GetAugmentedUniversalView() (*UtxoView, error)
+	GetAugmentedView(opts *AugmentedViewOptions) (*AugmentedView, error)
+	GetAugmentedViewGeneration() uint64
 	GetAugmentedUtxoViewForPublicKey(pk []byte, optionalTx *MsgDeSoTxn) (*UtxoView, error)
 	BlockUntilReadOnlyViewRegenerated()
 	WaitForTxnValidation(txHash *BlockHash) error
@@ -139,6 +142,9 @@ type PosMempool struct {
 	// facilitating a "replace by higher fee" feature. This feature gives users the ability to replace their existing
 	// mempool transaction with a new transaction having the same nonce but higher fee.
 	nonceTracker *NonceTracker
+	// nonceQueue holds transactions whose nonces expire too far in the future to be added to the mempool yet. They
+	// are promoted into the mempool once the block height catches up with their nonces.
+	nonceQueue *NonceQueue
 
 	// readOnlyLatestBlockView is used to check if a transaction has a valid nonce before being added to the mempool.
 	// The readOnlyLatestBlockView should be updated whenever a new block is added to the blockchain via UpdateLatestBlock.
@@ -153,6 +159,10 @@ type PosMempool struct {
 	// it. This allows the backend to display the current state of the blockchain including the mempool.
 	// The augmentedReadOnlyLatestBlockView is updated every 10 milliseconds to reflect the latest state of the mempool.
 	augmentedReadOnlyLatestBlockView *UtxoView
+	// augmentedReadOnlyLatestBlockViewGeneratedAt is when the augmentedReadOnlyLatestBlockView was last updated, and
+	// augmentedReadOnlyLatestBlockViewBlockHeight is the height of the block it's built on.
+	augmentedReadOnlyLatestBlockViewGeneratedAt time.Time
+	augmentedReadOnlyLatestBlockViewBlockHeight uint64
 	// augmentedReadOnlyLatestBlockViewMutex is used to protect the augmentedLatestBlockView from concurrent access.
 	augmentedReadOnlyLatestBlockViewMutex sync.RWMutex
 	// Signals that the mempool is now in the stopped state.
@@ -177,7 +187,7 @@ type PosMempool struct {
 
 	// augmentedLatestBlockViewSequenceNumber is the sequence number of the augmentedLatestBlockView. It is incremented
 	// every time augmentedLatestBlockView is updated. It can be used by obtainers of the augmentedLatestBlockView to
-	// wait until a particular transaction has been connected.
+	// wait until a particular transaction has been connected. It's the generation of the view in GetAugmentedView.
 	augmentedLatestBlockViewSequenceNumber int64
 
 	// recentBlockTxnCache is an LRU KV cache used to track the transaction that have been included in blocks.
@@ -188,6 +198,46 @@ type PosMempool struct {
 	// recentRejectedTxnCache is a cache to store the txns that were recently rejected so that we can return better
 	// errors for them.
 	recentRejectedTxnCache lru.Map[BlockHash, error]
+
+	// maxSizeBytes is the node operator's memory budget for the mempool, in bytes. The mempool never grows beyond
+	// the smaller of maxSizeBytes and the network-wide GlobalParamsEntry.MempoolMaxSizeBytes. A value of 0 means
+	// that only the GlobalParamsEntry limit applies.
+	maxSizeBytes uint64
+
+	// evictionStats tracks the transactions that were evicted because the mempool exceeded its size limit.
+	evictionStats MempoolEvictionStats
+
+	// validationWorkerSemaphore bounds the number of transactions that are pre-checked at the same time outside of
+	// the mempool's lock. See pos_mempool_admission.go.
+	validationWorkerSemaphore chan struct{}
+
+	// localTxns holds the transactions that were submitted to this node, as opposed to relayed by peers. See
+	// pos_mempool_local_txns.go.
+	localTxns map[BlockHash]*MsgDeSoTxn
+	// localTxnDroppedHandlers are called when a local transaction leaves the mempool without being confirmed.
+	localTxnDroppedHandlers []LocalTxnDroppedHandler
+	// nonLocalTxnTTL is how long a transaction relayed by a peer can stay in the mempool before it expires. A value
+	// of 0 means that relayed transactions don't expire.
+	nonLocalTxnTTL time.Duration
+
+	// publicKeyQuota limits the transactions a single public key can hold in the mempool, and publicKeyUsageTracker
+	// tracks what each public key holds. See pos_mempool_public_key_quota.go.
+	publicKeyQuota        PublicKeyQuota
+	publicKeyUsageTracker *PublicKeyUsageTracker
+}
+
+// MempoolEvictionStats summarizes the transactions evicted from the PosMempool because it ran out of space. The
+// counters are cumulative since the mempool was initialized.
+type MempoolEvictionStats struct {
+	// EvictedTxnCount is the number of transactions evicted.
+	EvictedTxnCount uint64
+	// EvictedTxnSizeBytes is the total size of the transactions evicted.
+	EvictedTxnSizeBytes uint64
+	// EvictionCount is the number of times the mempool had to evict transactions to get back under its limit.
+	EvictionCount uint64
+	// LastEvictedFeeRateNanosPerKB is the highest fee rate among the transactions evicted in the most recent
+	// eviction. Transactions paying less than this are at risk of being evicted again while the mempool is full.
+	LastEvictedFeeRateNanosPerKB uint64
 }
 
 func NewPosMempool() *PosMempool {
@@ -196,6 +246,8 @@ func NewPosMempool() *PosMempool {
 		txnRegister:  NewTransactionRegister(),
 		feeEstimator: NewPoSFeeEstimator(),
 		nonceTracker: NewNonceTracker(),
+		nonceQueue:   NewNonceQueue(0),
+		localTxns:    make(map[BlockHash]*MsgDeSoTxn),
 		quit:         make(chan interface{}),
 	}
 }
@@ -211,6 +263,10 @@ func (mp *PosMempool) Init(
 	feeEstimatorPastBlocks []*MsgDeSoBlock,
 	maxValidationViewConnects uint64,
 	transactionValidationRefreshIntervalMillis uint64,
+	maxSizeBytes uint64,
+	maxQueuedTxnsPerPublicKey uint64,
+	validationWorkers uint64,
+	nonLocalTxnTTLSeconds uint64,
 ) error {
 	mp.Lock()
 	defer mp.Unlock()
@@ -226,6 +282,8 @@ func (mp *PosMempool) Init(
 	if readOnlyLatestBlockView != nil {
 		mp.readOnlyLatestBlockView = readOnlyLatestBlockView.CopyUtxoView()
 		mp.augmentedReadOnlyLatestBlockView = readOnlyLatestBlockView.CopyUtxoView()
+		mp.augmentedReadOnlyLatestBlockViewGeneratedAt = time.Now()
+		mp.augmentedReadOnlyLatestBlockViewBlockHeight = latestBlockHeight
 		mp.validateTransactionsReadOnlyLatestBlockView = readOnlyLatestBlockView.CopyUtxoView()
 	}
 	mp.latestBlockHeight = latestBlockHeight
@@ -234,6 +292,13 @@ func (mp *PosMempool) Init(
 	mp.mempoolBackupIntervalMillis = mempoolBackupIntervalMillis
 	mp.maxValidationViewConnects = maxValidationViewConnects
 	mp.transactionValidationRefreshIntervalMillis = transactionValidationRefreshIntervalMillis
+	mp.maxSizeBytes = maxSizeBytes
+	mp.evictionStats = MempoolEvictionStats{}
+	if validationWorkers == 0 {
+		validationWorkers = PosMempoolDefaultValidationWorkers
+	}
+	mp.validationWorkerSemaphore = make(chan struct{}, validationWorkers)
+	mp.nonLocalTxnTTL = time.Duration(nonLocalTxnTTLSeconds) * time.Second
 	mp.recentBlockTxnCache = *lru.NewSet[BlockHash](100000)           // cache 100K latest txns from blocks.
 	mp.recentRejectedTxnCache = *lru.NewMap[BlockHash, error](100000) // cache 100K rejected txns.
 
@@ -241,6 +306,9 @@ func (mp *PosMempool) Init(
 	mp.txnRegister = NewTransactionRegister()
 	mp.txnRegister.Init(mp.globalParams)
 	mp.nonceTracker = NewNonceTracker()
+	mp.nonceQueue = NewNonceQueue(maxQueuedTxnsPerPublicKey)
+	mp.publicKeyUsageTracker = NewPublicKeyUsageTracker()
+	mp.localTxns = make(map[BlockHash]*MsgDeSoTxn)
 
 	// Initialize the fee estimator
 	err = mp.feeEstimator.Init(mp.txnRegister, feeEstimatorPastBlocks, mp.globalParams)
@@ -278,9 +346,10 @@ func (mp *PosMempool) Start() error {
 		}
 	}
 
-	mp.startGroup.Add(1)
-	mp.exitGroup.Add(1)
+	mp.startGroup.Add(2)
+	mp.exitGroup.Add(2)
 	mp.startTransactionValidationRoutine()
+	mp.startTransactionExpirationRoutine()
 	mp.startGroup.Wait()
 	mp.status = PosMempoolStatusRunning
 
@@ -326,9 +395,12 @@ func (mp *PosMempool) Stop() {
 		}
 	}
 
-	// Reset the transaction register, the ledger, and the nonce tracker.
+	// Reset the transaction register, the ledger, the nonce tracker, and the nonce queue.
 	mp.txnRegister.Reset()
 	mp.nonceTracker.Reset()
+	mp.nonceQueue.Reset()
+	mp.publicKeyUsageTracker.Reset()
+	mp.localTxns = make(map[BlockHash]*MsgDeSoTxn)
 	mp.feeEstimator = NewPoSFeeEstimator()
 	mp.status = PosMempoolStatusNotInitialized
 }
@@ -371,7 +443,7 @@ func (mp *PosMempool) OnBlockConnected(block *MsgDeSoBlock) {
 		mp.addTxnHashToRecentBlockCache(*txnHash)
 
 		// Remove the transaction from the mempool.
-		if err := mp.removeTransactionNoLock(existingTxn, true); err != nil {
+		if err := mp.removeTransactionNoLock(existingTxn, true, MempoolTxnRemovalReasonConfirmed); err != nil {
 			glog.Errorf("PosMempool.OnBlockConnected: Problem removing transaction from mempool: %v", err)
 		}
 	}
@@ -436,53 +508,23 @@ func (mp *PosMempool) OnBlockDisconnected(block *MsgDeSoBlock) {
 
 // AddTransaction validates a MsgDeSoTxn transaction and adds it to the mempool if it is valid.
 // If the mempool overflows as a result of adding the transaction, the mempool is pruned.
-func (mp *PosMempool) AddTransaction(txn *MsgDeSoTxn, txnTimestamp time.Time) error {
+func (mp *PosMempool) AddTransaction(txn *MsgDeSoTxn, txnTimestamp time.Time) (_err error) {
+	span := StartTraceSpan("PosMempool.AddTransaction", nil)
+	defer func() {
+		if span.IsRecording() && txn != nil {
+			span.SetAttributes(txnTraceAttributes(txn, txn.Hash())...)
+		}
+		EndTraceSpan(span, _err)
+	}()
+
 	if txn == nil {
 		return fmt.Errorf("PosMempool.AddTransaction: Cannot add a nil transaction")
 	}
 
-	// If the transaction is already in the transaction register, then we return an error.
-	if mp.txnRegister.GetTransaction(txn.Hash()) != nil {
-		return errors.New("PosMempool.AddTransaction: Transaction already in mempool")
-	}
-
-	// Acquire the mempool lock for all operations related to adding the transaction
-	// TODO: Do we need to wrap all of our validation logic in a write-lock? We should revisit
-	// this later and try to pull as much as we can out of the critical section here. The reason
-	// we added this lock is because checkTransactionSanity was calling ValidateTransactionNonce
-	// on the readOnly view, which was causing a modification of the view's PKID map at the same
-	// time as another thread was reading from it. This lock solves the issue but may not be the
-	// most optimal.
-	mp.Lock()
-	defer mp.Unlock()
-
-	// First, validate that the transaction is properly formatted according to BalanceModel. We acquire a read lock on
-	// the mempool. This allows multiple goroutines to safely perform transaction validation concurrently.
-	if err := mp.checkTransactionSanity(txn, false); err != nil {
-		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying transaction")
-	}
-
-	// If we get this far, it means that the transaction is valid. We can now add it to the mempool.
-	if !mp.IsRunning() {
-		return errors.Wrapf(MempoolErrorNotRunning, "PosMempool.AddTransaction: ")
-	}
-
-	// Construct the MempoolTx from the MsgDeSoTxn.
-	mempoolTx, err := NewMempoolTx(txn, txnTimestamp, mp.latestBlockHeight)
-	if err != nil {
-		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem constructing MempoolTx")
-	}
-
-	// Add the transaction to the mempool and then prune if needed.
-	if err := mp.addTransactionNoLock(mempoolTx, true); err != nil {
-		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem adding transaction to mempool")
-	}
-
-	if err := mp.pruneNoLock(); err != nil {
-		glog.Errorf("PosMempool.AddTransaction: Problem pruning mempool: %v", err)
-	}
-
-	return nil
+	// Run the checks that don't depend on the mempool's state outside of the write lock, so that transactions
+	// arriving at the same time are pre-checked in parallel. See pos_mempool_admission.go.
+	preCheck := mp.preCheckTransaction(txn)
+	return mp.admitPreCheckedTransaction(preCheck, txnTimestamp)
 }
 
 func (mp *PosMempool) addTxnHashToRecentBlockCache(txnHash BlockHash) {
@@ -496,10 +538,21 @@ func (mp *PosMempool) isTxnHashInRecentBlockCache(txnHash BlockHash) bool {
 	return mp.recentBlockTxnCache.Contains(txnHash)
 }
 
+// checkTransactionSanity runs every admission check on the transaction: the stateless pre-checks and the nonce checks
+// against the latest block view. The caller must hold the mempool's write lock. Note that it doesn't verify the
+// signature, which AddTransaction does in its pre-check phase.
 func (mp *PosMempool) checkTransactionSanity(txn *MsgDeSoTxn, expectInnerAtomicTxn bool) error {
-	// If the txn is an atomic, we need to check the transaction sanity for each txn as well as verify the wrapper.
+	if err := _preCheckPosMempoolTransaction(
+		txn, expectInnerAtomicTxn, mp.params, mp.globalParams, mp.latestBlockHeight); err != nil {
+		return err
+	}
+	return mp.checkTransactionStateNoLock(txn)
+}
+
+// checkTransactionStateNoLock runs the admission checks that read the latest block view. They're kept out of the
+// pre-check phase because reading the view can modify its caches, so they must run under the mempool's write lock.
+func (mp *PosMempool) checkTransactionStateNoLock(txn *MsgDeSoTxn) error {
 	if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
-		// First verify the wrapper.
 		atomicTxnsWrapper, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata)
 		if !ok {
 			return fmt.Errorf(
@@ -509,45 +562,14 @@ func (mp *PosMempool) checkTransactionSanity(txn *MsgDeSoTxn, expectInnerAtomicT
 		if err := mp.readOnlyLatestBlockView._verifyAtomicTxnsSize(txn, mp.latestBlockHeight); err != nil {
 			return errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying atomic txn size")
 		}
-		// Verify the wrapper.
-		if err := _verifyAtomicTxnsWrapper(txn); err != nil {
-			return errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying atomic txn wrapper")
-		}
-
-		// Verify the chain of transactions to make sure they are not tampered with.
-		if err := _verifyAtomicTxnsChain(atomicTxnsWrapper); err != nil {
-			return errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying atomic txn chain")
-		}
-		// Okay we've verified the wrapper and the chain of transactions. Now we need to verify each transaction.
 		for _, innerTxn := range atomicTxnsWrapper.Txns {
-			if err := mp.checkTransactionSanity(innerTxn, true); err != nil {
+			if err := mp.checkTransactionStateNoLock(innerTxn); err != nil {
 				return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
 			}
 		}
-		// Return early so we do not assess the rest of the validation checks on the wrapper.
 		return nil
 	}
 
-	// If the txn is supposed to be an inner txn in an atomic wrapper, we need to make sure it is properly formed.
-	// If the txn is NOT supposed to an inner txn in an atomic wrapper, we need to make sure it does not have
-	// the extra data fields that are only allowed in atomic txns.
-	isInnerAtomicTxn := txn.IsAtomicTxnsInnerTxn()
-	if isInnerAtomicTxn != expectInnerAtomicTxn {
-		return fmt.Errorf(
-			"PosMempool.AddTransaction: expected txn to be atomic: %v, got: %v",
-			expectInnerAtomicTxn,
-			isInnerAtomicTxn,
-		)
-	}
-
-	if err := CheckTransactionSanity(txn, uint32(mp.latestBlockHeight), mp.params); err != nil {
-		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
-	}
-
-	if err := ValidateDeSoTxnSanityBalanceModel(txn, mp.latestBlockHeight, mp.params, mp.globalParams); err != nil {
-		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
-	}
-
 	if err := mp.readOnlyLatestBlockView.ValidateTransactionNonce(txn, mp.latestBlockHeight); err != nil {
 		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction nonce")
 	}
@@ -639,6 +661,7 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 			mp.removeNonces(innerTxnsWithNoncesAdded)
 			return errors.Wrapf(err, "PosMempool.addTransactionNoLock: Problem adding txn to register")
 		}
+		mp.publicKeyUsageTracker.AddTxn(txn)
 		// Emit a persist event only for the wrapper transaction.
 		mp.persistMempoolAddEvent(txn, persistToDb)
 		return nil
@@ -657,15 +680,16 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 
 	// If we've determined that this transaction is meant to replace an existing one, we remove the existing transaction now.
 	if existingTxn != nil {
-		if err = mp.removeTransactionNoLock(existingTxn, true); err != nil {
+		if err = mp.removeTransactionNoLock(existingTxn, true, MempoolTxnRemovalReasonReplaced); err != nil {
 			recoveryErr := mp.txnRegister.RemoveTransaction(txn)
 			return errors.Wrapf(err, "PosMempool.AddTransaction: Problem removing old transaction from mempool during "+
 				"replacement with higher fee. Recovery error: %v", recoveryErr)
 		}
 	}
 
-	// At this point the transaction is in the mempool. We can now update the nonce tracker.
+	// At this point the transaction is in the mempool. We can now update the nonce tracker and the public key usage.
 	mp.nonceTracker.AddTxnByPublicKeyNonce(txn, *userPk, *txn.Tx.TxnNonce)
+	mp.publicKeyUsageTracker.AddTxn(txn)
 
 	// Emit an event for the newly added transaction.
 	mp.persistMempoolAddEvent(txn, persistToDb)
@@ -709,17 +733,19 @@ func (mp *PosMempool) RemoveTransaction(txnHash *BlockHash) error {
 		return nil
 	}
 
-	return mp.removeTransactionNoLock(txn, true)
+	return mp.removeTransactionNoLock(txn, true, MempoolTxnRemovalReasonRemoved)
 }
 
-func (mp *PosMempool) removeTransaction(txn *MempoolTx, persistToDb bool) error {
+func (mp *PosMempool) removeTransaction(txn *MempoolTx, persistToDb bool, reason MempoolTxnRemovalReason) error {
 	mp.Lock()
 	defer mp.Unlock()
 
-	return mp.removeTransactionNoLock(txn, persistToDb)
+	return mp.removeTransactionNoLock(txn, persistToDb, reason)
 }
 
-func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool) error {
+// removeTransactionNoLock removes the transaction from the mempool. The reason is used to tell whether a local
+// transaction was dropped or confirmed.
+func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool, reason MempoolTxnRemovalReason) error {
 	// First, sanity check our reserved balance.
 	userPk := NewPublicKey(txn.Tx.PublicKey)
 
@@ -727,6 +753,7 @@ func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool)
 	if err := mp.txnRegister.RemoveTransaction(txn); err != nil {
 		return errors.Wrapf(err, "PosMempool.removeTransactionNoLock: Problem removing txn from register")
 	}
+	mp.publicKeyUsageTracker.RemoveTxn(txn)
 
 	if txn.Tx.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
 		// For atomic transactions, we remove the nonces of the inner txns, but not the wrapper txn.
@@ -752,6 +779,9 @@ func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool)
 		mp.persister.EnqueueEvent(event)
 	}
 
+	// If the transaction was submitted locally, stop tracking it and let the handlers know if it was dropped.
+	mp.untrackLocalTransactionNoLock(txn, reason)
+
 	return nil
 }
 
@@ -850,7 +880,7 @@ func (mp *PosMempool) validateTransactions() error {
 			mp.recentRejectedTxnCache.Put(*txn.Hash, err)
 
 			// Try to remove the transaction with a lock.
-			mp.removeTransaction(txn, true)
+			mp.removeTransaction(txn, true, MempoolTxnRemovalReasonInvalid)
 
 			continue
 		}
@@ -866,35 +896,76 @@ func (mp *PosMempool) validateTransactions() error {
 	// have been connected.
 	mp.augmentedReadOnlyLatestBlockViewMutex.Lock()
 	mp.augmentedReadOnlyLatestBlockView = validationView
-	mp.augmentedReadOnlyLatestBlockViewMutex.Unlock()
+	mp.augmentedReadOnlyLatestBlockViewGeneratedAt = time.Now()
+	mp.augmentedReadOnlyLatestBlockViewBlockHeight = nextBlockHeight - 1
 
-	// Increment the augmentedLatestBlockViewSequenceNumber.
+	// Increment the augmentedLatestBlockViewSequenceNumber. We do this while holding the lock so that the
+	// sequence number always matches the view in GetAugmentedView.
 	atomic.AddInt64(&mp.augmentedLatestBlockViewSequenceNumber, 1)
+	mp.augmentedReadOnlyLatestBlockViewMutex.Unlock()
 
 	return nil
 }
 
 // pruneNoLock removes transactions from the mempool until the mempool size is below the maximum allowed size. The transactions
-// are removed in lowest to highest Fee-Time priority, i.e. opposite way that transactions are ordered in
-// GetTransactions().
+// are removed in order of lowest to highest ancestor-package fee rate, as described in TransactionRegister.PruneToSize.
 func (mp *PosMempool) pruneNoLock() error {
-	if mp.txnRegister.Size() < mp.globalParams.MempoolMaxSizeBytes {
+	maxSizeBytes := mp.getMaxSizeBytesNoLock()
+	if mp.txnRegister.Size() < maxSizeBytes {
 		return nil
 	}
 
-	prunedTxns, err := mp.txnRegister.PruneToSize(mp.globalParams.MempoolMaxSizeBytes)
+	prunedTxns, err := mp.txnRegister.PruneToSize(maxSizeBytes)
 	if err != nil {
 		return errors.Wrapf(err, "PosMempool.pruneNoLock: Problem pruning mempool")
 	}
+	if len(prunedTxns) == 0 {
+		return nil
+	}
+	mp.evictionStats.EvictionCount++
+	mp.evictionStats.LastEvictedFeeRateNanosPerKB = 0
 	for _, prunedTxn := range prunedTxns {
-		if err := mp.removeTransactionNoLock(prunedTxn, true); err != nil {
+		mp.evictionStats.EvictedTxnCount++
+		mp.evictionStats.EvictedTxnSizeBytes += prunedTxn.TxSizeBytes
+		if prunedTxn.FeePerKB > mp.evictionStats.LastEvictedFeeRateNanosPerKB {
+			mp.evictionStats.LastEvictedFeeRateNanosPerKB = prunedTxn.FeePerKB
+		}
+		if err := mp.removeTransactionNoLock(prunedTxn, true, MempoolTxnRemovalReasonEvicted); err != nil {
 			// We should never get to here since the transaction was already pruned from the TransactionRegister.
 			glog.Errorf("PosMempool.pruneNoLock: Problem removing transaction from mempool: %v", err)
 		}
 	}
+	glog.V(1).Infof("PosMempool.pruneNoLock: Evicted %d txns to stay within %d bytes, highest evicted fee rate: %d",
+		len(prunedTxns), maxSizeBytes, mp.evictionStats.LastEvictedFeeRateNanosPerKB)
 	return nil
 }
 
+// getMaxSizeBytesNoLock returns the maximum size of the mempool in bytes, which is the smaller of the node's memory
+// budget and the GlobalParamsEntry limit.
+func (mp *PosMempool) getMaxSizeBytesNoLock() uint64 {
+	maxSizeBytes := mp.globalParams.MempoolMaxSizeBytes
+	if mp.maxSizeBytes > 0 && mp.maxSizeBytes < maxSizeBytes {
+		maxSizeBytes = mp.maxSizeBytes
+	}
+	return maxSizeBytes
+}
+
+// GetEvictionStats returns a copy of the mempool's eviction counters.
+func (mp *PosMempool) GetEvictionStats() MempoolEvictionStats {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	return mp.evictionStats
+}
+
+// GetSizeBytes returns the total size of the transactions in the mempool, in bytes.
+func (mp *PosMempool) GetSizeBytes() uint64 {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	return mp.txnRegister.Size()
+}
+
 func (mp *PosMempool) rebucketTransactionRegisterNoLock() error {
 	// Check if the global params haven't changed in a way that requires rebucketing the
 	// transaction register
@@ -911,7 +982,7 @@ func (mp *PosMempool) rebucketTransactionRegisterNoLock() error {
 	for _, txn := range mp.txnRegister.GetFeeTimeTransactions() {
 		txnInNewRegister := newTxnRegister.GetTransaction(txn.Hash)
 		if txnInNewRegister == nil {
-			mp.removeTransactionNoLock(txn, true)
+			mp.removeTransactionNoLock(txn, true, MempoolTxnRemovalReasonEvicted)
 		}
 	}
 
@@ -938,6 +1009,9 @@ func (mp *PosMempool) UpdateLatestBlock(blockView *UtxoView, blockHeight uint64)
 		mp.validateTransactionsReadOnlyLatestBlockView = blockView.CopyUtxoView()
 	}
 	mp.latestBlockHeight = blockHeight
+
+	// Now that the block height has advanced, some queued transactions may be valid.
+	mp.promoteQueuedTransactionsNoLock()
 }
 
 // UpdateGlobalParams updates the global params in the mempool. Changing GlobalParamsEntry can impact the validity of
@@ -980,6 +1054,114 @@ func (mp *PosMempool) UpdateGlobalParams(globalParams *GlobalParamsEntry) {
 		glog.Errorf("PosMempool.UpdateGlobalParams: Problem updating fee estimator global params: %v", err)
 		return
 	}
+
+	// The MaxNonceExpirationBlockHeightOffset may have increased, so some queued transactions may be valid.
+	mp.promoteQueuedTransactionsNoLock()
+}
+
+// queueTransactionNoLock adds a transaction whose nonce expires too far in the future to the nonce queue. The
+// transaction must pass all sanity checks other than the nonce expiration offset, and its nonce must become valid
+// within another MaxNonceExpirationBlockHeightOffset blocks.
+func (mp *PosMempool) queueTransactionNoLock(txn *MsgDeSoTxn, txnTimestamp time.Time) error {
+	if !mp.IsRunning() {
+		return errors.Wrapf(MempoolErrorNotRunning, "PosMempool.queueTransactionNoLock: ")
+	}
+	if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper || txn.IsAtomicTxnsInnerTxn() {
+		return errors.Wrapf(TxErrorNonceExpirationBlockHeightOffsetExceeded,
+			"PosMempool.queueTransactionNoLock: Atomic transactions can't be queued")
+	}
+
+	maxNonceExpirationBlockHeightOffset := mp.globalParams.MaxNonceExpirationBlockHeightOffset
+	if txn.TxnNonce.ExpirationBlockHeight > mp.latestBlockHeight+2*maxNonceExpirationBlockHeightOffset {
+		return errors.Wrapf(TxErrorNonceExpirationBlockHeightOffsetExceeded, "PosMempool.queueTransactionNoLock: "+
+			"Nonce expiration block height %d is too far in the future to queue the transaction at block height %d",
+			txn.TxnNonce.ExpirationBlockHeight, mp.latestBlockHeight)
+	}
+
+	// Run the sanity checks again without the nonce expiration offset limit, so that we only queue transactions
+	// that will be accepted once the gap to their nonce is closed.
+	globalParamsWithoutOffset := *mp.globalParams
+	globalParamsWithoutOffset.MaxNonceExpirationBlockHeightOffset = 0
+	if err := CheckTransactionSanity(txn, uint32(mp.latestBlockHeight), mp.params); err != nil {
+		return errors.Wrapf(err, "PosMempool.queueTransactionNoLock: Problem validating transaction sanity")
+	}
+	if err := ValidateDeSoTxnSanityBalanceModel(
+		txn, mp.latestBlockHeight, mp.params, &globalParamsWithoutOffset); err != nil {
+		return errors.Wrapf(err, "PosMempool.queueTransactionNoLock: Problem validating transaction sanity")
+	}
+	if err := mp.readOnlyLatestBlockView.ValidateTransactionNonce(txn, mp.latestBlockHeight); err != nil {
+		return errors.Wrapf(err, "PosMempool.queueTransactionNoLock: Problem validating transaction nonce")
+	}
+
+	mempoolTx, err := NewMempoolTx(txn, txnTimestamp, mp.latestBlockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "PosMempool.queueTransactionNoLock: Problem constructing MempoolTx")
+	}
+	userPk := NewPublicKey(txn.PublicKey)
+	if userPk == nil {
+		return fmt.Errorf("PosMempool.queueTransactionNoLock: Problem parsing transaction public key")
+	}
+	if _, err = mp.nonceQueue.AddTxn(*userPk, mempoolTx); err != nil {
+		return errors.Wrapf(err, "PosMempool.queueTransactionNoLock: Problem queueing transaction")
+	}
+	return nil
+}
+
+// promoteQueuedTransactionsNoLock moves the queued transactions whose nonces are now within the
+// MaxNonceExpirationBlockHeightOffset of the latest block height into the mempool. Transactions that are no longer
+// valid are dropped.
+func (mp *PosMempool) promoteQueuedTransactionsNoLock() {
+	if mp.nonceQueue.Count() == 0 {
+		return
+	}
+
+	maxExpirationBlockHeight := uint64(math.MaxUint64)
+	if mp.globalParams.MaxNonceExpirationBlockHeightOffset != 0 &&
+		mp.latestBlockHeight <= math.MaxUint64-mp.globalParams.MaxNonceExpirationBlockHeightOffset {
+		maxExpirationBlockHeight = mp.latestBlockHeight + mp.globalParams.MaxNonceExpirationBlockHeightOffset
+	}
+
+	promotedTxns := mp.nonceQueue.PopTxnsWithExpirationAtMost(maxExpirationBlockHeight)
+	for _, queuedTxn := range promotedTxns {
+		if err := mp.checkTransactionSanity(queuedTxn.Tx, false); err != nil {
+			glog.V(1).Infof("PosMempool.promoteQueuedTransactionsNoLock: Dropping queued transaction %v: %v",
+				queuedTxn.Hash, err)
+			continue
+		}
+		mempoolTx, err := NewMempoolTx(queuedTxn.Tx, queuedTxn.Added, mp.latestBlockHeight)
+		if err != nil {
+			glog.V(1).Infof("PosMempool.promoteQueuedTransactionsNoLock: Dropping queued transaction %v: %v",
+				queuedTxn.Hash, err)
+			continue
+		}
+		if err = mp.checkPublicKeyQuotaNoLock(mempoolTx); err != nil {
+			glog.V(1).Infof("PosMempool.promoteQueuedTransactionsNoLock: Dropping queued transaction %v: %v",
+				queuedTxn.Hash, err)
+			continue
+		}
+		if err = mp.addTransactionNoLock(mempoolTx, true); err != nil {
+			glog.V(1).Infof("PosMempool.promoteQueuedTransactionsNoLock: Dropping queued transaction %v: %v",
+				queuedTxn.Hash, err)
+		}
+	}
+
+	if len(promotedTxns) > 0 {
+		if err := mp.pruneNoLock(); err != nil {
+			glog.Errorf("PosMempool.promoteQueuedTransactionsNoLock: Problem pruning mempool: %v", err)
+		}
+	}
+}
+
+// GetQueuedTransactions returns the transactions waiting in the nonce queue for the block height to catch up with
+// their nonces. These transactions aren't in the mempool yet.
+func (mp *PosMempool) GetQueuedTransactions() []*MempoolTx {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	if !mp.IsRunning() {
+		return nil
+	}
+	return mp.nonceQueue.GetTxns()
 }
 
 // Implementation of the Mempool interface
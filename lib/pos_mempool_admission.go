@@ -0,0 +1,348 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Parallel Transaction Admission
+//
+// Adding a transaction to the PosMempool used to run every check under the mempool's write lock, so a burst of
+// transactions was validated one at a time no matter how many cores the node had. Most of that work doesn't depend
+// on the mempool's state: the sanity checks, the fee checks, and verifying the signature only read the transaction,
+// the params, the global params, and the block height. AddTransaction now splits admission in two phases:
+//
+//  1. The pre-check phase runs those checks against a snapshot of the global params and the block height, without
+//     holding the write lock. The number of pre-checks running at the same time is bounded by the mempool's
+//     validation workers, so a burst can't starve the rest of the node of CPU.
+//  2. The admission phase takes the write lock, runs the checks that read the latest block view, such as the nonce
+//     checks, and inserts the transaction. If a block was connected or the global params changed since the snapshot
+//     was taken, the pre-checks that depend on them are run again under the lock before the transaction is admitted.
+//
+// The signature check in the pre-check phase only verifies that the signature is valid for the key that signed the
+// transaction. Whether a derived key is authorized to sign for its owner depends on the state, and is checked when
+// the transaction is connected to the validation view, as before.
+
+const (
+	// PosMempoolDefaultValidationWorkers is the default number of transactions the PosMempool pre-checks at the
+	// same time.
+	PosMempoolDefaultValidationWorkers = 4
+)
+
+// posMempoolPreCheck is the result of the pre-check phase of a transaction's admission.
+type posMempoolPreCheck struct {
+	txn *MsgDeSoTxn
+	// The snapshot of the mempool the pre-checks ran against.
+	globalParams      *GlobalParamsEntry
+	latestBlockHeight uint64
+	// Whether the transaction was already in the mempool when the pre-check phase started. We skip the pre-checks
+	// of such transactions.
+	alreadyInMempool bool
+	// The error returned by the pre-checks, if any.
+	err error
+}
+
+// preCheckTransaction runs the pre-check phase of the transaction's admission. It only holds the mempool's read
+// lock long enough to take a snapshot of the global params and the block height.
+func (mp *PosMempool) preCheckTransaction(txn *MsgDeSoTxn) *posMempoolPreCheck {
+	mp.RLock()
+	preCheck := &posMempoolPreCheck{
+		txn:               txn,
+		globalParams:      mp.globalParams,
+		latestBlockHeight: mp.latestBlockHeight,
+	}
+	// Skip transactions that are already in the mempool before doing any expensive work.
+	preCheck.alreadyInMempool = mp.txnRegister.GetTransaction(txn.Hash()) != nil
+	params := mp.params
+	validationWorkerSemaphore := mp.validationWorkerSemaphore
+	mp.RUnlock()
+
+	if preCheck.alreadyInMempool {
+		return preCheck
+	}
+
+	// Wait for a validation worker to free up. The semaphore is only nil if the mempool was never initialized, in
+	// which case admission fails below anyway.
+	if validationWorkerSemaphore != nil {
+		validationWorkerSemaphore <- struct{}{}
+		defer func() { <-validationWorkerSemaphore }()
+	}
+
+	if err := _verifyPosMempoolTransactionSignatures(txn, preCheck.latestBlockHeight); err != nil {
+		preCheck.err = errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying transaction")
+		return preCheck
+	}
+	if err := _preCheckPosMempoolTransaction(
+		txn, false, params, preCheck.globalParams, preCheck.latestBlockHeight); err != nil {
+		preCheck.err = err
+	}
+	return preCheck
+}
+
+// admitPreCheckedTransaction runs the admission phase of a transaction that went through preCheckTransaction.
+func (mp *PosMempool) admitPreCheckedTransaction(preCheck *posMempoolPreCheck, txnTimestamp time.Time) error {
+	mp.Lock()
+	defer mp.Unlock()
+
+	return mp.admitPreCheckedTransactionNoLock(preCheck, txnTimestamp)
+}
+
+func (mp *PosMempool) admitPreCheckedTransactionNoLock(preCheck *posMempoolPreCheck, txnTimestamp time.Time) error {
+	txn := preCheck.txn
+
+	// The transaction may also have been added by someone else while we were pre-checking it.
+	if preCheck.alreadyInMempool || mp.txnRegister.GetTransaction(txn.Hash()) != nil {
+		return errors.New("PosMempool.AddTransaction: Transaction already in mempool")
+	}
+
+	// A transaction that failed the pre-checks for a reason unrelated to the snapshot can be rejected right away.
+	// Otherwise, if the snapshot is stale, the pre-checks that depend on it have to run again.
+	if mp.globalParams != preCheck.globalParams || mp.latestBlockHeight != preCheck.latestBlockHeight {
+		if !_isPreCheckErrorStateless(preCheck.err) {
+			preCheck.err = _preCheckPosMempoolTransaction(txn, false, mp.params, mp.globalParams, mp.latestBlockHeight)
+		}
+	}
+	if preCheck.err != nil {
+		// If the transaction's nonce expires too far in the future, queue it until the block height catches up.
+		if errors.Is(preCheck.err, TxErrorNonceExpirationBlockHeightOffsetExceeded) && mp.nonceQueue.IsEnabled() {
+			return mp.queueTransactionNoLock(txn, txnTimestamp)
+		}
+		if _isPreCheckErrorStateless(preCheck.err) {
+			return preCheck.err
+		}
+		return errors.Wrapf(preCheck.err, "PosMempool.AddTransaction: Problem verifying transaction")
+	}
+
+	if err := mp.checkTransactionStateNoLock(txn); err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying transaction")
+	}
+
+	// If we get this far, it means that the transaction is valid. We can now add it to the mempool.
+	if !mp.IsRunning() {
+		return errors.Wrapf(MempoolErrorNotRunning, "PosMempool.AddTransaction: ")
+	}
+
+	// Construct the MempoolTx from the MsgDeSoTxn.
+	mempoolTx, err := NewMempoolTx(txn, txnTimestamp, mp.latestBlockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem constructing MempoolTx")
+	}
+
+	// Make sure the transaction doesn't put its public key over its quota. See pos_mempool_public_key_quota.go.
+	if err := mp.checkPublicKeyQuotaNoLock(mempoolTx); err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: ")
+	}
+
+	// Add the transaction to the mempool and then prune if needed.
+	if err := mp.addTransactionNoLock(mempoolTx, true); err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem adding transaction to mempool")
+	}
+
+	if err := mp.pruneNoLock(); err != nil {
+		glog.Errorf("PosMempool.AddTransaction: Problem pruning mempool: %v", err)
+	}
+
+	return nil
+}
+
+// AddTransactions adds a batch of transactions to the mempool. The transactions are pre-checked in parallel on the
+// mempool's validation workers, and then admitted in order under a single acquisition of the write lock, so that a
+// transaction can depend on an earlier one in the batch. The returned slice holds the error of each transaction,
+// which is nil if the transaction was added.
+func (mp *PosMempool) AddTransactions(txns []*MsgDeSoTxn, txnTimestamp time.Time) []error {
+	preChecks := mp.preCheckTransactions(txns)
+
+	mp.Lock()
+	defer mp.Unlock()
+
+	errs := make([]error, len(txns))
+	for ii, preCheck := range preChecks {
+		if preCheck.txn == nil {
+			errs[ii] = preCheck.err
+			continue
+		}
+		errs[ii] = mp.admitPreCheckedTransactionNoLock(preCheck, txnTimestamp)
+	}
+	return errs
+}
+
+// preCheckTransactions runs the pre-check phase of each transaction's admission in parallel on the mempool's
+// validation workers. A nil transaction gets a pre-check with an error and no transaction.
+func (mp *PosMempool) preCheckTransactions(txns []*MsgDeSoTxn) []*posMempoolPreCheck {
+	preChecks := make([]*posMempoolPreCheck, len(txns))
+
+	// Start one goroutine per validation worker, and hand the transactions out to them.
+	mp.RLock()
+	numWorkers := cap(mp.validationWorkerSemaphore)
+	mp.RUnlock()
+	if numWorkers == 0 {
+		numWorkers = PosMempoolDefaultValidationWorkers
+	}
+	txnIndexes := make(chan int, len(txns))
+	for ii, txn := range txns {
+		if txn == nil {
+			preChecks[ii] = &posMempoolPreCheck{
+				err: fmt.Errorf("PosMempool.AddTransactions: Cannot add a nil transaction"),
+			}
+			continue
+		}
+		txnIndexes <- ii
+	}
+	close(txnIndexes)
+	var preCheckGroup sync.WaitGroup
+	for ii := 0; ii < numWorkers && ii < len(txns); ii++ {
+		preCheckGroup.Add(1)
+		go func() {
+			defer preCheckGroup.Done()
+			for txnIndex := range txnIndexes {
+				preChecks[txnIndex] = mp.preCheckTransaction(txns[txnIndex])
+			}
+		}()
+	}
+	preCheckGroup.Wait()
+	return preChecks
+}
+
+// _preCheckPosMempoolTransaction runs the admission checks that only depend on the transaction, the params, the
+// global params, and the block height. It's safe to call without holding the mempool's lock.
+func _preCheckPosMempoolTransaction(
+	txn *MsgDeSoTxn,
+	expectInnerAtomicTxn bool,
+	params *DeSoParams,
+	globalParams *GlobalParamsEntry,
+	latestBlockHeight uint64,
+) error {
+	// If the txn is an atomic, we need to check the transaction sanity for each txn as well as verify the wrapper.
+	if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+		// First verify the wrapper.
+		atomicTxnsWrapper, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata)
+		if !ok {
+			return fmt.Errorf(
+				"PosMempool.AddTransaction: Problem verifying atomic txn wrapper - casting metadata failed")
+		}
+		// Verify the wrapper.
+		if err := _verifyAtomicTxnsWrapper(txn); err != nil {
+			return errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying atomic txn wrapper")
+		}
+
+		// Verify the chain of transactions to make sure they are not tampered with.
+		if err := _verifyAtomicTxnsChain(atomicTxnsWrapper); err != nil {
+			return errors.Wrapf(err, "PosMempool.AddTransaction: Problem verifying atomic txn chain")
+		}
+		// Okay we've verified the wrapper and the chain of transactions. Now we need to verify each transaction.
+		for _, innerTxn := range atomicTxnsWrapper.Txns {
+			if err := _preCheckPosMempoolTransaction(
+				innerTxn, true, params, globalParams, latestBlockHeight); err != nil {
+				return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
+			}
+		}
+		// Return early so we do not assess the rest of the validation checks on the wrapper.
+		return nil
+	}
+
+	// If the txn is supposed to be an inner txn in an atomic wrapper, we need to make sure it is properly formed.
+	// If the txn is NOT supposed to an inner txn in an atomic wrapper, we need to make sure it does not have
+	// the extra data fields that are only allowed in atomic txns.
+	isInnerAtomicTxn := txn.IsAtomicTxnsInnerTxn()
+	if isInnerAtomicTxn != expectInnerAtomicTxn {
+		return fmt.Errorf(
+			"PosMempool.AddTransaction: expected txn to be atomic: %v, got: %v",
+			expectInnerAtomicTxn,
+			isInnerAtomicTxn,
+		)
+	}
+
+	if err := CheckTransactionSanity(txn, uint32(latestBlockHeight), params); err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
+	}
+
+	if err := ValidateDeSoTxnSanityBalanceModel(txn, latestBlockHeight, params, globalParams); err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
+	}
+
+	return nil
+}
+
+// posMempoolSignatureError marks a pre-check error that doesn't depend on the mempool's snapshot, so it doesn't need
+// to be rechecked when the snapshot goes stale.
+type posMempoolSignatureError struct {
+	err error
+}
+
+func (sigErr *posMempoolSignatureError) Error() string {
+	return sigErr.err.Error()
+}
+
+func (sigErr *posMempoolSignatureError) Unwrap() error {
+	return sigErr.err
+}
+
+func _isPreCheckErrorStateless(err error) bool {
+	var sigErr *posMempoolSignatureError
+	return errors.As(err, &sigErr)
+}
+
+// _verifyPosMempoolTransactionSignatures verifies the signature of the transaction, or of each of its inner
+// transactions if it's an atomic transaction wrapper, without reading any state.
+func _verifyPosMempoolTransactionSignatures(txn *MsgDeSoTxn, latestBlockHeight uint64) error {
+	if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+		atomicTxnsWrapper, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata)
+		if !ok {
+			return fmt.Errorf(
+				"_verifyPosMempoolTransactionSignatures: Problem verifying atomic txn wrapper - casting metadata failed")
+		}
+		for _, innerTxn := range atomicTxnsWrapper.Txns {
+			if err := _verifyPosMempoolTransactionSignatures(innerTxn, latestBlockHeight); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := _verifyTxnSignatureStateless(txn, uint32(latestBlockHeight)); err != nil {
+		return &posMempoolSignatureError{err: err}
+	}
+	return nil
+}
+
+// _verifyTxnSignatureStateless verifies that the transaction is signed by its public key or, if it's signed with a
+// derived key, by that derived key. Unlike UtxoView._verifySignature, it doesn't check that the derived key is
+// authorized by the owner, since that depends on the state.
+func _verifyTxnSignatureStateless(txn *MsgDeSoTxn, blockHeight uint32) error {
+	if txn.Signature.Sign == nil {
+		return fmt.Errorf("_verifyTxnSignatureStateless: Transaction signature is empty")
+	}
+	txBytes, err := txn.ToBytes(true /*preSignature*/)
+	if err != nil {
+		return errors.Wrapf(err, "_verifyTxnSignatureStateless: Problem serializing txn without signature: ")
+	}
+	txHash := Sha256DoubleHash(txBytes)
+
+	signingPkBytes := txn.PublicKey
+	derivedPkBytes, isDerived, err := IsDerivedSignature(txn, blockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "_verifyTxnSignatureStateless: Something went wrong while checking for "+
+			"derived key signature")
+	}
+	if isDerived {
+		signingPkBytes = derivedPkBytes
+	}
+	signingPk, err := btcec.ParsePubKey(signingPkBytes)
+	if err != nil {
+		if isDerived {
+			return fmt.Errorf("%v %v", RuleErrorDerivedKeyInvalidExtraData, RuleErrorDerivedKeyInvalidRecoveryId)
+		}
+		return errors.Wrapf(err, "_verifyTxnSignatureStateless: Problem parsing owner public key: ")
+	}
+	if !txn.Signature.Verify(txHash[:], signingPk) {
+		if isDerived {
+			return errors.Wrapf(RuleErrorDerivedKeyNotAuthorized, "Signature check failed: ")
+		}
+		return RuleErrorInvalidTransactionSignature
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Augmented Views
+//
+// The augmented view is the latest block view with the mempool's transactions connected to it. It's what the backend
+// uses to show the state of the blockchain including the transactions that haven't been mined yet. The mempool
+// regenerates it in the background, so a copy of it can be taken without waiting on the mempool's lock, but it can
+// lag behind the mempool. GetAugmentedView makes the lag explicit:
+//
+//   - Every augmented view has a generation, which the mempool increments each time it regenerates the view. A
+//     caller that has seen generation N, e.g. right before submitting a transaction, can ask for a view of at least
+//     generation N+1 to be sure that the view was regenerated after the transaction was added.
+//   - A caller can bound how long ago the view was generated, and require it to be built on the mempool's latest
+//     block. If the current view doesn't meet the requirements, the call waits for the mempool to regenerate it, for
+//     at most the MaxWait of the call, and fails with MempoolErrorAugmentedViewStale otherwise.
+//   - A caller can ask for a view filtered to the transactions of a public key. Only the public key's mempool
+//     transactions are connected to the latest block view, which lets a wallet preview its own pending state without
+//     the transactions of other users. Transactions of other public keys that the public key's transactions depend on
+//     aren't connected, so the public key's transactions that depend on them are left out. Building a filtered view
+//     connects transactions on the caller's time, so the number of transactions it connects is capped.
+//
+// GetAugmentedUniversalView is GetAugmentedView without any requirements.
+
+const (
+	// LegacyMempoolAugmentedViewMaxTxnConnects is the most transactions the DeSoMempool connects to build a filtered
+	// augmented view. The PosMempool uses its maxValidationViewConnects instead.
+	LegacyMempoolAugmentedViewMaxTxnConnects = 10000
+)
+
+// AugmentedViewOptions are the requirements of a call to GetAugmentedView. The zero value accepts any view.
+type AugmentedViewOptions struct {
+	// MinGeneration is the oldest generation of the augmented view that the caller accepts.
+	MinGeneration uint64
+	// MaxAge is how long ago the augmented view may have been generated. Zero means that the view can be of any age.
+	MaxAge time.Duration
+	// RequireLatestBlock requires the augmented view to be built on the mempool's latest block.
+	RequireLatestBlock bool
+	// MaxWait is how long the call can wait for the mempool to regenerate the augmented view if the current one
+	// doesn't meet the requirements above. Zero means that the call fails right away.
+	MaxWait time.Duration
+
+	// PublicKey filters the view to the transactions of the public key if it's set. The requirements above apply to
+	// the mempool's augmented view, and the filtered view is built from the mempool's transactions once they're met.
+	PublicKey []byte
+	// MaxTxnConnects is the most transactions that are connected to build a filtered view. It's capped by the
+	// mempool's own limit, which also applies if it's zero.
+	MaxTxnConnects uint64
+}
+
+// AugmentedView is a copy of an augmented view of the mempool that the caller is free to modify.
+type AugmentedView struct {
+	View *UtxoView
+	// Generation is the generation of the mempool's augmented view. A filtered view has the generation of the
+	// mempool's augmented view at the time it was built.
+	Generation uint64
+	// BlockHeight is the height of the block that the view is built on.
+	BlockHeight uint64
+	// GeneratedAt is when the view was generated. A filtered view is generated by the call.
+	GeneratedAt time.Time
+
+	// IsFiltered is true if the view only has the transactions of AugmentedViewOptions.PublicKey connected.
+	IsFiltered bool
+	// NumTxnsConnected is the number of the public key's transactions that were connected to a filtered view.
+	NumTxnsConnected uint64
+	// NumTxnsSkipped is the number of the public key's transactions that failed to connect to a filtered view, e.g.
+	// because they depend on the transactions of another public key.
+	NumTxnsSkipped uint64
+	// IsTruncated is true if the public key has more transactions than MaxTxnConnects allowed to be connected.
+	IsTruncated bool
+}
+
+// augmentedViewState is the mempool's current augmented view, and the height of the mempool's latest block.
+type augmentedViewState struct {
+	view              *UtxoView
+	generation        uint64
+	blockHeight       uint64
+	generatedAt       time.Time
+	latestBlockHeight uint64
+}
+
+func (opts *AugmentedViewOptions) isSatisfiedBy(state *augmentedViewState, now time.Time) bool {
+	if state.generation < opts.MinGeneration {
+		return false
+	}
+	if opts.MaxAge != 0 && now.Sub(state.generatedAt) > opts.MaxAge {
+		return false
+	}
+	if opts.RequireLatestBlock && state.blockHeight < state.latestBlockHeight {
+		return false
+	}
+	return true
+}
+
+// waitForAugmentedView polls the mempool's augmented view until it meets the requirements of opts, or MaxWait runs
+// out.
+func waitForAugmentedView(
+	getState func() (*augmentedViewState, error), opts *AugmentedViewOptions, pollInterval time.Duration,
+) (*augmentedViewState, error) {
+	deadline := time.Now().Add(opts.MaxWait)
+	for {
+		state, err := getState()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if opts.isSatisfiedBy(state, now) {
+			return state, nil
+		}
+		if !now.Before(deadline) {
+			return nil, errors.Wrapf(MempoolErrorAugmentedViewStale,
+				"waitForAugmentedView: Generation %d at height %d generated %v ago doesn't meet the requirements "+
+					"(min generation %d, max age %v, latest block %v at height %d)",
+				state.generation, state.blockHeight, now.Sub(state.generatedAt), opts.MinGeneration, opts.MaxAge,
+				opts.RequireLatestBlock, state.latestBlockHeight)
+		}
+		sleepDuration := pollInterval
+		if remaining := deadline.Sub(now); remaining < sleepDuration {
+			sleepDuration = remaining
+		}
+		time.Sleep(sleepDuration)
+	}
+}
+
+// buildFilteredAugmentedView connects the mempool transactions of publicKey, in the order they're given, to a copy of
+// the block view at blockHeight. Transactions that fail to connect are skipped.
+func buildFilteredAugmentedView(
+	blockView *UtxoView,
+	blockHeight uint64,
+	mempoolTxns []*MempoolTx,
+	publicKey []byte,
+	maxTxnConnects uint64,
+) (*AugmentedView, error) {
+	augmentedView := &AugmentedView{
+		BlockHeight: blockHeight,
+		GeneratedAt: time.Now(),
+		IsFiltered:  true,
+	}
+	// The SafeUtxoView leaves the view unchanged if a transaction fails to connect.
+	safeUtxoView := NewSafeUtxoView(blockView)
+	for _, mempoolTx := range mempoolTxns {
+		if mempoolTx == nil || mempoolTx.Tx == nil || !bytes.Equal(mempoolTx.Tx.PublicKey, publicKey) {
+			continue
+		}
+		if augmentedView.NumTxnsConnected+augmentedView.NumTxnsSkipped >= maxTxnConnects {
+			augmentedView.IsTruncated = true
+			break
+		}
+		_, _, _, _, err := safeUtxoView.ConnectTransaction(
+			mempoolTx.Tx, mempoolTx.Hash, uint32(blockHeight+1), augmentedView.GeneratedAt.UnixNano(), false, false,
+		)
+		if err != nil {
+			augmentedView.NumTxnsSkipped++
+			continue
+		}
+		augmentedView.NumTxnsConnected++
+	}
+	augmentedView.View = safeUtxoView.GetUtxoView()
+	return augmentedView, nil
+}
+
+// GetAugmentedView returns a copy of the mempool's augmented view that meets the requirements of opts, or a view
+// filtered to the transactions of opts.PublicKey. A nil opts accepts any view.
+func (mp *PosMempool) GetAugmentedView(opts *AugmentedViewOptions) (*AugmentedView, error) {
+	if opts == nil {
+		opts = &AugmentedViewOptions{}
+	}
+	pollInterval := time.Duration(mp.transactionValidationRefreshIntervalMillis/5) * time.Millisecond
+	if pollInterval == 0 {
+		pollInterval = time.Millisecond
+	}
+	state, err := waitForAugmentedView(mp.getAugmentedViewState, opts, pollInterval)
+	if err != nil {
+		return nil, errors.Wrapf(err, "PosMempool.GetAugmentedView: ")
+	}
+
+	if len(opts.PublicKey) == 0 {
+		return &AugmentedView{
+			View:        state.view.CopyUtxoView(),
+			Generation:  state.generation,
+			BlockHeight: state.blockHeight,
+			GeneratedAt: state.generatedAt,
+		}, nil
+	}
+
+	// Build the filtered view from the latest block view and the mempool's transactions in Fee-Time order.
+	mp.RLock()
+	if !mp.IsRunning() {
+		mp.RUnlock()
+		return nil, errors.Wrapf(MempoolErrorNotRunning, "PosMempool.GetAugmentedView: ")
+	}
+	blockView := mp.readOnlyLatestBlockView
+	blockHeight := mp.latestBlockHeight
+	mempoolTxns := mp.getTransactionsNoLock()
+	maxTxnConnects := mp.maxValidationViewConnects
+	mp.RUnlock()
+
+	if blockView == nil {
+		return nil, errors.New("PosMempool.GetAugmentedView: Latest block view is nil")
+	}
+	if opts.MaxTxnConnects != 0 && opts.MaxTxnConnects < maxTxnConnects {
+		maxTxnConnects = opts.MaxTxnConnects
+	}
+	augmentedView, err := buildFilteredAugmentedView(blockView, blockHeight, mempoolTxns, opts.PublicKey, maxTxnConnects)
+	if err != nil {
+		return nil, errors.Wrapf(err, "PosMempool.GetAugmentedView: ")
+	}
+	augmentedView.Generation = state.generation
+	return augmentedView, nil
+}
+
+// GetAugmentedViewGeneration returns the generation of the mempool's current augmented view.
+func (mp *PosMempool) GetAugmentedViewGeneration() uint64 {
+	return uint64(atomic.LoadInt64(&mp.augmentedLatestBlockViewSequenceNumber))
+}
+
+func (mp *PosMempool) getAugmentedViewState() (*augmentedViewState, error) {
+	if !mp.IsRunning() {
+		return nil, MempoolErrorNotRunning
+	}
+	latestBlockHeight := mp.GetMempoolTipBlockHeight()
+	mp.augmentedReadOnlyLatestBlockViewMutex.RLock()
+	defer mp.augmentedReadOnlyLatestBlockViewMutex.RUnlock()
+	return &augmentedViewState{
+		view:              mp.augmentedReadOnlyLatestBlockView,
+		generation:        uint64(atomic.LoadInt64(&mp.augmentedLatestBlockViewSequenceNumber)),
+		blockHeight:       mp.augmentedReadOnlyLatestBlockViewBlockHeight,
+		generatedAt:       mp.augmentedReadOnlyLatestBlockViewGeneratedAt,
+		latestBlockHeight: latestBlockHeight,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Transaction Batch Submission
+//
+// Wallets that construct multi-step flows, such as creating a profile and then posting from it, end up with a chain
+// of transactions where each one depends on the state left behind by the previous ones. Submitting them one at a
+// time costs a round trip per transaction, and leaves the wallet to clean up if a transaction in the middle of the
+// chain is rejected after the earlier ones were admitted. ProcessTransactionBatch takes the whole chain at once:
+//
+//  1. Every transaction in the batch is pre-checked in parallel, as in AddTransactions.
+//  2. The batch is connected in order to a copy of the augmented view, so that a transaction that depends on an
+//     earlier one in the batch is validated against the state the earlier one leaves behind.
+//  3. If every transaction passed, the batch is admitted in order under a single acquisition of the write lock. If a
+//     transaction fails to be admitted at this point, the transactions of the batch admitted before it are removed.
+//
+// If any transaction fails, none of the batch is admitted. The result of the failing transaction holds its error, and
+// the results of the other transactions hold MempoolErrorBatchRejected.
+//
+// The batch is atomic only with respect to admission. Once admitted, its transactions are ordinary mempool
+// transactions: they can still be evicted, replaced, or dropped by the validation routine independently of each
+// other. Note that the augmented view is regenerated by the validation routine, so it may not reflect transactions
+// admitted in the last few milliseconds.
+
+// MempoolTxnBatchResult is the result of a transaction submitted through ProcessTransactionBatch.
+type MempoolTxnBatchResult struct {
+	// TxnHash is the hash of the transaction. It's nil if the transaction was nil.
+	TxnHash *BlockHash
+	// Err is nil if the transaction was admitted to the mempool.
+	Err error
+	// FeeRateNanosPerKB is the fee rate the mempool assigned to the transaction, which determines its position in the
+	// Fee-Time ordering. It's 0 if the transaction wasn't admitted.
+	FeeRateNanosPerKB uint64
+}
+
+// ProcessTransactionBatch validates a batch of transactions, in which each transaction can depend on the ones before
+// it, and admits the whole batch to the mempool if every transaction is valid. It returns a result for each
+// transaction, in the order of the batch.
+func (mp *PosMempool) ProcessTransactionBatch(txns []*MsgDeSoTxn) []*MempoolTxnBatchResult {
+	txnTimestamp := time.Now()
+	results := make([]*MempoolTxnBatchResult, len(txns))
+	for ii, txn := range txns {
+		results[ii] = &MempoolTxnBatchResult{}
+		if txn != nil {
+			results[ii].TxnHash = txn.Hash()
+		}
+	}
+	if len(txns) == 0 {
+		return results
+	}
+
+	// Phase 1: pre-check every transaction.
+	preChecks := mp.preCheckTransactions(txns)
+	for ii, preCheck := range preChecks {
+		if preCheck.txn == nil {
+			return _rejectMempoolTxnBatch(results, ii, preCheck.err)
+		}
+		if preCheck.alreadyInMempool {
+			return _rejectMempoolTxnBatch(results, ii,
+				errors.New("PosMempool.ProcessTransactionBatch: Transaction already in mempool"))
+		}
+		if preCheck.err != nil {
+			return _rejectMempoolTxnBatch(results, ii,
+				errors.Wrapf(preCheck.err, "PosMempool.ProcessTransactionBatch: Problem verifying transaction"))
+		}
+	}
+
+	// Phase 2: connect the batch in order to a copy of the augmented view.
+	augmentedView, err := mp.GetAugmentedUniversalView()
+	if err != nil {
+		return _rejectMempoolTxnBatch(results, 0,
+			errors.Wrapf(err, "PosMempool.ProcessTransactionBatch: Problem getting augmented view"))
+	}
+	mp.RLock()
+	nextBlockHeight := mp.latestBlockHeight + 1
+	mp.RUnlock()
+	nextBlockTimestamp := txnTimestamp.UnixNano()
+	for ii, txn := range txns {
+		_, _, _, _, err = augmentedView.ConnectTransaction(
+			txn, results[ii].TxnHash, uint32(nextBlockHeight), nextBlockTimestamp, true, false)
+		if err != nil {
+			return _rejectMempoolTxnBatch(results, ii,
+				errors.Wrapf(err, "PosMempool.ProcessTransactionBatch: Problem connecting transaction"))
+		}
+	}
+
+	// Phase 3: admit the batch under the write lock.
+	mp.Lock()
+	defer mp.Unlock()
+
+	var admittedTxns []*MempoolTx
+	for ii, preCheck := range preChecks {
+		err = mp.admitBatchTransactionNoLock(preCheck, txnTimestamp)
+		var mempoolTx *MempoolTx
+		if err == nil {
+			mempoolTx = mp.txnRegister.GetTransaction(results[ii].TxnHash)
+			if mempoolTx == nil {
+				err = errors.New("PosMempool.ProcessTransactionBatch: Transaction was evicted while admitting the batch")
+			}
+		}
+		if err != nil {
+			// Roll back the transactions of the batch admitted so far.
+			for _, admittedTxn := range admittedTxns {
+				if mp.txnRegister.GetTransaction(admittedTxn.Hash) == nil {
+					continue
+				}
+				if removeErr := mp.removeTransactionNoLock(
+					admittedTxn, true, MempoolTxnRemovalReasonRemoved); removeErr != nil {
+					glog.Errorf("PosMempool.ProcessTransactionBatch: Problem rolling back transaction %v: %v",
+						admittedTxn.Hash, removeErr)
+				}
+			}
+			return _rejectMempoolTxnBatch(results, ii, err)
+		}
+		admittedTxns = append(admittedTxns, mempoolTx)
+		results[ii].FeeRateNanosPerKB = mempoolTx.FeePerKB
+	}
+	return results
+}
+
+// admitBatchTransactionNoLock admits a pre-checked transaction of a batch. Unlike AddTransaction, it doesn't queue a
+// transaction whose nonce expires too far in the future, since the rest of the batch couldn't be admitted until the
+// queued transaction is promoted.
+func (mp *PosMempool) admitBatchTransactionNoLock(preCheck *posMempoolPreCheck, txnTimestamp time.Time) error {
+	// If the snapshot went stale since the batch was pre-checked, check the transaction again against the latest
+	// global params and block height, so that admitPreCheckedTransactionNoLock doesn't have to.
+	if mp.globalParams != preCheck.globalParams || mp.latestBlockHeight != preCheck.latestBlockHeight {
+		if err := _preCheckPosMempoolTransaction(
+			preCheck.txn, false, mp.params, mp.globalParams, mp.latestBlockHeight); err != nil {
+			return errors.Wrapf(err, "PosMempool.ProcessTransactionBatch: Problem verifying transaction")
+		}
+		preCheck.globalParams = mp.globalParams
+		preCheck.latestBlockHeight = mp.latestBlockHeight
+	}
+	return mp.admitPreCheckedTransactionNoLock(preCheck, txnTimestamp)
+}
+
+// _rejectMempoolTxnBatch sets the error of the failed transaction's result, and marks the results of the other
+// transactions of the batch as rejected along with it.
+func _rejectMempoolTxnBatch(
+	results []*MempoolTxnBatchResult,
+	failedTxnIndex int,
+	err error,
+) []*MempoolTxnBatchResult {
+	for ii, result := range results {
+		result.FeeRateNanosPerKB = 0
+		if ii == failedTxnIndex {
+			result.Err = err
+			continue
+		}
+		result.Err = errors.Wrapf(MempoolErrorBatchRejected,
+			"PosMempool.ProcessTransactionBatch: Transaction %v of the batch failed", failedTxnIndex)
+	}
+	return results
+}
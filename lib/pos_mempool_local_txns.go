@@ -0,0 +1,250 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Local Transactions
+//
+// The PosMempool tells apart the transactions that were submitted to this node, e.g. through the node's API, from
+// the transactions that were relayed by peers. A node operator cares a lot more about the former: if a local
+// transaction is evicted from the mempools of the node's peers, or the inv for it is lost, it may never make it into
+// a block, and the user who submitted it is left waiting.
+//
+//   - Local transactions are rebroadcast to all peers periodically until they're confirmed or they leave the
+//     mempool, e.g. because their nonce expired. The Server runs the rebroadcast, see
+//     Server._startLocalTxnRebroadcaster.
+//   - Transactions relayed by peers expire after the mempool's non-local transaction TTL, so that transactions no
+//     one cares about don't linger in the mempool until their nonce expires. Local transactions never expire this
+//     way.
+//   - When a local transaction leaves the mempool without being confirmed, the handlers registered with
+//     OnLocalTxnDropped are called with the reason it was dropped.
+//
+// Whether a transaction is local isn't persisted, so local transactions are treated as relayed transactions once
+// the node restarts.
+
+const (
+	// PosMempoolTxnExpirationIntervalMillis is how often the PosMempool looks for expired transactions.
+	PosMempoolTxnExpirationIntervalMillis = 1000
+)
+
+// MempoolTxnRemovalReason describes why a transaction was removed from the PosMempool.
+type MempoolTxnRemovalReason uint8
+
+const (
+	// MempoolTxnRemovalReasonRemoved is used when the transaction was removed through RemoveTransaction.
+	MempoolTxnRemovalReasonRemoved MempoolTxnRemovalReason = 0
+	// MempoolTxnRemovalReasonConfirmed is used when the transaction was included in a block.
+	MempoolTxnRemovalReasonConfirmed MempoolTxnRemovalReason = 1
+	// MempoolTxnRemovalReasonReplaced is used when the transaction was replaced by one with the same nonce and a
+	// higher fee.
+	MempoolTxnRemovalReasonReplaced MempoolTxnRemovalReason = 2
+	// MempoolTxnRemovalReasonInvalid is used when the transaction no longer connects to the latest block view, e.g.
+	// because its nonce expired or its inputs were spent.
+	MempoolTxnRemovalReasonInvalid MempoolTxnRemovalReason = 3
+	// MempoolTxnRemovalReasonEvicted is used when the transaction was evicted because the mempool ran out of space
+	// or its fee no longer meets the global params.
+	MempoolTxnRemovalReasonEvicted MempoolTxnRemovalReason = 4
+	// MempoolTxnRemovalReasonExpired is used when a transaction relayed by a peer outlived the non-local
+	// transaction TTL.
+	MempoolTxnRemovalReasonExpired MempoolTxnRemovalReason = 5
+)
+
+func (reason MempoolTxnRemovalReason) String() string {
+	switch reason {
+	case MempoolTxnRemovalReasonRemoved:
+		return "Removed"
+	case MempoolTxnRemovalReasonConfirmed:
+		return "Confirmed"
+	case MempoolTxnRemovalReasonReplaced:
+		return "Replaced"
+	case MempoolTxnRemovalReasonInvalid:
+		return "Invalid"
+	case MempoolTxnRemovalReasonEvicted:
+		return "Evicted"
+	case MempoolTxnRemovalReasonExpired:
+		return "Expired"
+	default:
+		return fmt.Sprintf("MempoolTxnRemovalReason(%d)", uint8(reason))
+	}
+}
+
+// LocalTxnDroppedEvent is passed to the LocalTxnDroppedHandlers when a local transaction leaves the mempool without
+// being confirmed.
+type LocalTxnDroppedEvent struct {
+	Txn     *MsgDeSoTxn
+	TxnHash *BlockHash
+	Reason  MempoolTxnRemovalReason
+	// Err is the error the transaction failed validation with, if the reason is MempoolTxnRemovalReasonInvalid.
+	Err error
+}
+
+// LocalTxnDroppedHandler is called with the mempool's lock held, so it must not call back into the mempool.
+type LocalTxnDroppedHandler func(event *LocalTxnDroppedEvent)
+
+// OnLocalTxnDropped registers a handler that is called whenever a local transaction is dropped.
+func (mp *PosMempool) OnLocalTxnDropped(handler LocalTxnDroppedHandler) {
+	mp.Lock()
+	defer mp.Unlock()
+
+	mp.localTxnDroppedHandlers = append(mp.localTxnDroppedHandlers, handler)
+}
+
+// AddLocalTransaction adds a transaction that was submitted to this node to the mempool, and tracks it as a local
+// transaction. If the transaction was already relayed to us by a peer, it's tracked as a local transaction from now
+// on, even though AddLocalTransaction returns an error because it's already in the mempool.
+func (mp *PosMempool) AddLocalTransaction(txn *MsgDeSoTxn, txnTimestamp time.Time) error {
+	if txn == nil {
+		return fmt.Errorf("PosMempool.AddLocalTransaction: Cannot add a nil transaction")
+	}
+	txnHash := txn.Hash()
+
+	preCheck := mp.preCheckTransaction(txn)
+
+	mp.Lock()
+	defer mp.Unlock()
+
+	// We start tracking the transaction before it's admitted, so that we notice if it's evicted right away.
+	_, wasLocal := mp.localTxns[*txnHash]
+	mp.localTxns[*txnHash] = txn
+	if err := mp.admitPreCheckedTransactionNoLock(preCheck, txnTimestamp); err != nil {
+		if !wasLocal && mp.txnRegister.GetTransaction(txnHash) == nil {
+			delete(mp.localTxns, *txnHash)
+		}
+		return err
+	}
+	return nil
+}
+
+// IsLocalTransaction returns true if the transaction with the given hash was submitted to this node and hasn't left
+// the mempool since.
+func (mp *PosMempool) IsLocalTransaction(txnHash *BlockHash) bool {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	_, isLocal := mp.localTxns[*txnHash]
+	return isLocal
+}
+
+// GetLocalTransactions returns the local transactions in the mempool ordered by the Fee-Time algorithm. Local
+// transactions waiting in the nonce queue aren't returned, since they can't be relayed yet.
+func (mp *PosMempool) GetLocalTransactions() []*MempoolTx {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	if !mp.IsRunning() || len(mp.localTxns) == 0 {
+		return nil
+	}
+
+	var localTxns []*MempoolTx
+	for _, txn := range mp.getTransactionsNoLock() {
+		if _, isLocal := mp.localTxns[*txn.Hash]; isLocal {
+			localTxns = append(localTxns, txn)
+		}
+	}
+	return localTxns
+}
+
+// untrackLocalTransactionNoLock stops tracking the transaction as a local transaction once it's removed from the
+// mempool, and calls the LocalTxnDroppedHandlers unless the transaction was confirmed.
+func (mp *PosMempool) untrackLocalTransactionNoLock(txn *MempoolTx, reason MempoolTxnRemovalReason) {
+	if _, isLocal := mp.localTxns[*txn.Hash]; !isLocal {
+		return
+	}
+	delete(mp.localTxns, *txn.Hash)
+	if reason == MempoolTxnRemovalReasonConfirmed {
+		return
+	}
+
+	event := &LocalTxnDroppedEvent{
+		Txn:     txn.Tx,
+		TxnHash: txn.Hash,
+		Reason:  reason,
+	}
+	if reason == MempoolTxnRemovalReasonInvalid {
+		event.Err, _ = mp.recentRejectedTxnCache.Get(*txn.Hash)
+	}
+	glog.V(1).Infof("PosMempool.untrackLocalTransactionNoLock: Local transaction %v was dropped: %v, error: %v",
+		txn.Hash, reason, event.Err)
+	for _, handler := range mp.localTxnDroppedHandlers {
+		handler(event)
+	}
+}
+
+// startTransactionExpirationRoutine runs expireTransactions every PosMempoolTxnExpirationIntervalMillis
+// milliseconds.
+func (mp *PosMempool) startTransactionExpirationRoutine() {
+	go func() {
+		mp.startGroup.Done()
+		for {
+			select {
+			case <-time.After(PosMempoolTxnExpirationIntervalMillis * time.Millisecond):
+				mp.expireTransactions(time.Now())
+			case <-mp.quit:
+				mp.exitGroup.Done()
+				return
+			}
+		}
+	}()
+}
+
+// expireTransactions removes the transactions relayed by peers that were added to the mempool more than the
+// non-local transaction TTL before the given time. It also stops tracking local transactions that were dropped from
+// the nonce queue before they made it into the mempool.
+func (mp *PosMempool) expireTransactions(now time.Time) {
+	mp.Lock()
+	defer mp.Unlock()
+
+	if !mp.IsRunning() {
+		return
+	}
+
+	if mp.nonLocalTxnTTL > 0 {
+		var expiredTxns []*MempoolTx
+		for _, txn := range mp.getTransactionsNoLock() {
+			if _, isLocal := mp.localTxns[*txn.Hash]; isLocal {
+				continue
+			}
+			if now.Sub(txn.Added) > mp.nonLocalTxnTTL {
+				expiredTxns = append(expiredTxns, txn)
+			}
+		}
+		for _, txn := range expiredTxns {
+			if err := mp.removeTransactionNoLock(txn, true, MempoolTxnRemovalReasonExpired); err != nil {
+				glog.Errorf("PosMempool.expireTransactions: Problem removing transaction %v: %v", txn.Hash, err)
+			}
+		}
+		if len(expiredTxns) > 0 {
+			glog.V(1).Infof("PosMempool.expireTransactions: Expired %d transactions older than %v",
+				len(expiredTxns), mp.nonLocalTxnTTL)
+		}
+	}
+
+	// Queued transactions are dropped without going through removeTransactionNoLock, so we look for local
+	// transactions that are neither in the mempool nor in the nonce queue.
+	for txnHash, txn := range mp.localTxns {
+		if mp.txnRegister.GetTransaction(&txnHash) != nil || mp.isTransactionQueuedNoLock(txn) {
+			continue
+		}
+		txnHashCopy := txnHash
+		mp.untrackLocalTransactionNoLock(&MempoolTx{Tx: txn, Hash: &txnHashCopy}, MempoolTxnRemovalReasonRemoved)
+	}
+}
+
+// isTransactionQueuedNoLock returns true if the transaction is waiting in the nonce queue.
+func (mp *PosMempool) isTransactionQueuedNoLock(txn *MsgDeSoTxn) bool {
+	userPk := NewPublicKey(txn.PublicKey)
+	if userPk == nil {
+		return false
+	}
+	txnHash := txn.Hash()
+	for _, queuedTxn := range mp.nonceQueue.GetTxnsByPublicKey(*userPk) {
+		if queuedTxn.Hash.IsEqual(txnHash) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// NonceQueue is a helper struct that holds transactions that can't enter the pos mempool yet because their nonce
+// expires too far in the future. A transaction's DeSoNonce.ExpirationBlockHeight can be at most
+// GlobalParamsEntry.MaxNonceExpirationBlockHeightOffset blocks above the current block height. Wallets that submit
+// a burst of transactions to a node that's a few blocks ahead of ours, or that space out the expirations of their
+// nonces, would otherwise have those transactions rejected outright.
+//
+// The queue is ordered by nonce for each public key, lowest ExpirationBlockHeight first. Once the chain advances far
+// enough that the gap to a queued transaction's nonce is closed, the pos mempool promotes the transaction out of the
+// queue, validates it, and adds it to the mempool. The number of queued transactions per public key is limited.
+// The queue isn't persisted, so queued transactions are lost when the node restarts.
+type NonceQueue struct {
+	sync.RWMutex
+
+	// queuedTxnsByPublicKey holds each public key's queued transactions, sorted by nonce.
+	queuedTxnsByPublicKey map[PublicKey][]*MempoolTx
+	// maxQueuedTxnsPerPublicKey is the maximum number of transactions queued for a single public key. If it is 0,
+	// transactions are never queued.
+	maxQueuedTxnsPerPublicKey uint64
+	count                     uint64
+}
+
+func NewNonceQueue(maxQueuedTxnsPerPublicKey uint64) *NonceQueue {
+	return &NonceQueue{
+		queuedTxnsByPublicKey:     make(map[PublicKey][]*MempoolTx),
+		maxQueuedTxnsPerPublicKey: maxQueuedTxnsPerPublicKey,
+	}
+}
+
+// isLowerNonce orders nonces by ExpirationBlockHeight, breaking ties by PartialID.
+func isLowerNonce(nonce *DeSoNonce, other *DeSoNonce) bool {
+	if nonce.ExpirationBlockHeight != other.ExpirationBlockHeight {
+		return nonce.ExpirationBlockHeight < other.ExpirationBlockHeight
+	}
+	return nonce.PartialID < other.PartialID
+}
+
+// IsEnabled returns true if the queue accepts transactions.
+func (nq *NonceQueue) IsEnabled() bool {
+	return nq.maxQueuedTxnsPerPublicKey > 0
+}
+
+// AddTxn queues a transaction for the given public key. If the public key already has a queued transaction with the
+// same nonce, it is replaced as long as the new transaction pays at least as high a fee rate. If the public key's
+// queue is full, the transaction with the highest nonce is evicted to make room, unless the new transaction has the
+// highest nonce, in which case it is rejected. The replaced or evicted transaction, if any, is returned.
+func (nq *NonceQueue) AddTxn(pk PublicKey, txn *MempoolTx) (_removedTxn *MempoolTx, _err error) {
+	nq.Lock()
+	defer nq.Unlock()
+
+	if !nq.IsEnabled() {
+		return nil, errors.Wrapf(MempoolErrorNonceQueueFull, "NonceQueue.AddTxn: Nonce queue is disabled")
+	}
+
+	queuedTxns := nq.queuedTxnsByPublicKey[pk]
+	index := sort.Search(len(queuedTxns), func(ii int) bool {
+		return !isLowerNonce(queuedTxns[ii].Tx.TxnNonce, txn.Tx.TxnNonce)
+	})
+
+	// Replace the queued transaction with the same nonce.
+	if index < len(queuedTxns) && *queuedTxns[index].Tx.TxnNonce == *txn.Tx.TxnNonce {
+		existingTxn := queuedTxns[index]
+		if existingTxn.Hash.IsEqual(txn.Hash) {
+			return nil, errors.Errorf("NonceQueue.AddTxn: Transaction %v already queued", txn.Hash)
+		}
+		if existingTxn.FeePerKB > txn.FeePerKB {
+			return nil, errors.Wrapf(MempoolFailedReplaceByHigherFee, "NonceQueue.AddTxn: Problem replacing "+
+				"queued transaction by higher fee failed. New transaction has lower fee.")
+		}
+		queuedTxns[index] = txn
+		return existingTxn, nil
+	}
+
+	var evictedTxn *MempoolTx
+	if uint64(len(queuedTxns)) >= nq.maxQueuedTxnsPerPublicKey {
+		if index == len(queuedTxns) {
+			return nil, errors.Wrapf(MempoolErrorNonceQueueFull, "NonceQueue.AddTxn: Public key already has %d "+
+				"queued transactions with lower nonces", len(queuedTxns))
+		}
+		evictedTxn = queuedTxns[len(queuedTxns)-1]
+		queuedTxns = queuedTxns[:len(queuedTxns)-1]
+		nq.count--
+	}
+
+	queuedTxns = append(queuedTxns, nil)
+	copy(queuedTxns[index+1:], queuedTxns[index:])
+	queuedTxns[index] = txn
+	nq.queuedTxnsByPublicKey[pk] = queuedTxns
+	nq.count++
+	return evictedTxn, nil
+}
+
+// PopTxnsWithExpirationAtMost removes and returns all queued transactions whose nonce expires at or before
+// maxExpirationBlockHeight. The transactions of each public key are returned in nonce order.
+func (nq *NonceQueue) PopTxnsWithExpirationAtMost(maxExpirationBlockHeight uint64) []*MempoolTx {
+	nq.Lock()
+	defer nq.Unlock()
+
+	var poppedTxns []*MempoolTx
+	for pk, queuedTxns := range nq.queuedTxnsByPublicKey {
+		numReady := sort.Search(len(queuedTxns), func(ii int) bool {
+			return queuedTxns[ii].Tx.TxnNonce.ExpirationBlockHeight > maxExpirationBlockHeight
+		})
+		if numReady == 0 {
+			continue
+		}
+		poppedTxns = append(poppedTxns, queuedTxns[:numReady]...)
+		nq.count -= uint64(numReady)
+		if numReady == len(queuedTxns) {
+			delete(nq.queuedTxnsByPublicKey, pk)
+		} else {
+			nq.queuedTxnsByPublicKey[pk] = queuedTxns[numReady:]
+		}
+	}
+	return poppedTxns
+}
+
+// GetTxnsByPublicKey returns the transactions queued for the given public key, sorted by nonce.
+func (nq *NonceQueue) GetTxnsByPublicKey(pk PublicKey) []*MempoolTx {
+	nq.RLock()
+	defer nq.RUnlock()
+
+	return append([]*MempoolTx{}, nq.queuedTxnsByPublicKey[pk]...)
+}
+
+// GetTxns returns all queued transactions.
+func (nq *NonceQueue) GetTxns() []*MempoolTx {
+	nq.RLock()
+	defer nq.RUnlock()
+
+	txns := make([]*MempoolTx, 0, nq.count)
+	for _, queuedTxns := range nq.queuedTxnsByPublicKey {
+		txns = append(txns, queuedTxns...)
+	}
+	return txns
+}
+
+// Count returns the number of queued transactions.
+func (nq *NonceQueue) Count() uint64 {
+	nq.RLock()
+	defer nq.RUnlock()
+
+	return nq.count
+}
+
+func (nq *NonceQueue) Reset() {
+	nq.Lock()
+	defer nq.Unlock()
+
+	nq.queuedTxnsByPublicKey = make(map[PublicKey][]*MempoolTx)
+	nq.count = 0
+}
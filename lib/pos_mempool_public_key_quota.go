@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Public Key Quotas
+//
+// The PosMempool evicts the transactions with the lowest fee rate once it reaches its size limit, so a single public
+// key that floods the mempool with transactions paying a slightly higher fee rate than everyone else can push out
+// every other user's transactions. The public key quota limits how much of the mempool a single public key can hold:
+//
+//   - A public key can hold at most MaxTxns transactions and MaxBytes bytes of transactions in the mempool. A
+//     transaction that would put its public key over either limit is rejected when it's admitted, with
+//     MempoolErrorPublicKeyQuotaExceeded. A transaction that replaces one of the public key's transactions by
+//     paying a higher fee only counts the difference.
+//   - While the mempool is less than PosMempoolPublicKeyQuotaBurstUtilizationBasisPoints full, a public key can go
+//     over its limits by another BurstTxns transactions and BurstBytes bytes. This lets a user submit a burst of
+//     transactions when there's room for them, without letting them hold on to that room once the mempool fills up.
+//
+// An atomic transaction counts towards the public key of its first inner transaction. The quota is enforced when a
+// transaction is admitted or promoted from the nonce queue, but not when the mempool is loaded from disk or the
+// transactions of a disconnected block are added back, so a public key can be over its quota in those cases. A zero
+// limit means no limit.
+
+const (
+	// PosMempoolPublicKeyQuotaBurstUtilizationBasisPoints is how full the PosMempool can be, as a fraction of its
+	// maximum size, for public keys to use their burst allowance.
+	PosMempoolPublicKeyQuotaBurstUtilizationBasisPoints = 5000
+)
+
+// PublicKeyQuota limits the transactions a single public key can hold in the PosMempool.
+type PublicKeyQuota struct {
+	MaxTxns    uint64
+	MaxBytes   uint64
+	BurstTxns  uint64
+	BurstBytes uint64
+}
+
+// IsEnabled returns true if the quota limits either the number of transactions or bytes.
+func (quota PublicKeyQuota) IsEnabled() bool {
+	return quota.MaxTxns > 0 || quota.MaxBytes > 0
+}
+
+// PublicKeyUsage is the number of transactions and bytes a public key holds in the PosMempool.
+type PublicKeyUsage struct {
+	NumTxns  uint64
+	NumBytes uint64
+}
+
+// PublicKeyUsageTracker tracks the PublicKeyUsage of every public key with transactions in the PosMempool. It's
+// only accessed with the mempool's lock held.
+type PublicKeyUsageTracker struct {
+	usageByPublicKey map[PublicKey]*PublicKeyUsage
+	// publicKeyByTxnHash is the public key each tracked transaction counts towards, so that a transaction is only
+	// counted once, and is uncounted from the right public key.
+	publicKeyByTxnHash map[BlockHash]PublicKey
+}
+
+func NewPublicKeyUsageTracker() *PublicKeyUsageTracker {
+	return &PublicKeyUsageTracker{
+		usageByPublicKey:   make(map[PublicKey]*PublicKeyUsage),
+		publicKeyByTxnHash: make(map[BlockHash]PublicKey),
+	}
+}
+
+// AddTxn counts the transaction towards its public key, if it isn't counted already.
+func (tracker *PublicKeyUsageTracker) AddTxn(txn *MempoolTx) {
+	if txn == nil || txn.Hash == nil {
+		return
+	}
+	if _, exists := tracker.publicKeyByTxnHash[*txn.Hash]; exists {
+		return
+	}
+	publicKey := getPublicKeyQuotaPublicKey(txn.Tx)
+	if publicKey == nil {
+		return
+	}
+	usage, exists := tracker.usageByPublicKey[*publicKey]
+	if !exists {
+		usage = &PublicKeyUsage{}
+		tracker.usageByPublicKey[*publicKey] = usage
+	}
+	usage.NumTxns++
+	usage.NumBytes += txn.TxSizeBytes
+	tracker.publicKeyByTxnHash[*txn.Hash] = *publicKey
+}
+
+// RemoveTxn stops counting the transaction towards its public key, if it's counted.
+func (tracker *PublicKeyUsageTracker) RemoveTxn(txn *MempoolTx) {
+	if txn == nil || txn.Hash == nil {
+		return
+	}
+	publicKey, exists := tracker.publicKeyByTxnHash[*txn.Hash]
+	if !exists {
+		return
+	}
+	delete(tracker.publicKeyByTxnHash, *txn.Hash)
+	usage := tracker.usageByPublicKey[publicKey]
+	usage.NumTxns--
+	usage.NumBytes -= txn.TxSizeBytes
+	if usage.NumTxns == 0 {
+		delete(tracker.usageByPublicKey, publicKey)
+	}
+}
+
+// GetUsage returns the usage of the public key, which is zero if it has no transactions in the mempool.
+func (tracker *PublicKeyUsageTracker) GetUsage(publicKey PublicKey) PublicKeyUsage {
+	if usage, exists := tracker.usageByPublicKey[publicKey]; exists {
+		return *usage
+	}
+	return PublicKeyUsage{}
+}
+
+// countsTowards returns true if the transaction is counted towards the public key.
+func (tracker *PublicKeyUsageTracker) countsTowards(txn *MempoolTx, publicKey PublicKey) bool {
+	if txn == nil || txn.Hash == nil {
+		return false
+	}
+	txnPublicKey, exists := tracker.publicKeyByTxnHash[*txn.Hash]
+	return exists && txnPublicKey == publicKey
+}
+
+func (tracker *PublicKeyUsageTracker) Reset() {
+	tracker.usageByPublicKey = make(map[PublicKey]*PublicKeyUsage)
+	tracker.publicKeyByTxnHash = make(map[BlockHash]PublicKey)
+}
+
+// getPublicKeyQuotaPublicKey returns the public key the transaction counts towards. Atomic transactions are signed
+// by the ZeroPublicKey, so they count towards the public key of their first inner transaction instead.
+func getPublicKeyQuotaPublicKey(txn *MsgDeSoTxn) *PublicKey {
+	if txn == nil || txn.TxnMeta == nil {
+		return nil
+	}
+	if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+		atomicTxnsWrapper, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata)
+		if !ok || len(atomicTxnsWrapper.Txns) == 0 || atomicTxnsWrapper.Txns[0] == nil {
+			return nil
+		}
+		return NewPublicKey(atomicTxnsWrapper.Txns[0].PublicKey)
+	}
+	return NewPublicKey(txn.PublicKey)
+}
+
+// SetPublicKeyQuota sets the limits on the transactions a single public key can hold in the mempool. It only
+// applies to transactions admitted from now on.
+func (mp *PosMempool) SetPublicKeyQuota(quota PublicKeyQuota) {
+	mp.Lock()
+	defer mp.Unlock()
+
+	mp.publicKeyQuota = quota
+}
+
+// GetPublicKeyUsage returns the number of transactions and bytes the public key holds in the mempool.
+func (mp *PosMempool) GetPublicKeyUsage(publicKey []byte) PublicKeyUsage {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	if mp.publicKeyUsageTracker == nil || NewPublicKey(publicKey) == nil {
+		return PublicKeyUsage{}
+	}
+	return mp.publicKeyUsageTracker.GetUsage(*NewPublicKey(publicKey))
+}
+
+// checkPublicKeyQuotaNoLock returns an error if adding the transaction to the mempool would put its public key over
+// the public key quota.
+func (mp *PosMempool) checkPublicKeyQuotaNoLock(txn *MempoolTx) error {
+	quota := mp.publicKeyQuota
+	if !quota.IsEnabled() {
+		return nil
+	}
+	publicKey := getPublicKeyQuotaPublicKey(txn.Tx)
+	if publicKey == nil {
+		return nil
+	}
+	usage := mp.publicKeyUsageTracker.GetUsage(*publicKey)
+
+	// A transaction that replaces another one of the public key's transactions only adds its size difference.
+	if txn.Tx.TxnMeta.GetTxnType() != TxnTypeAtomicTxnsWrapper && txn.Tx.TxnNonce != nil {
+		replacedTxn := mp.nonceTracker.GetTxnByPublicKeyNonce(*NewPublicKey(txn.Tx.PublicKey), *txn.Tx.TxnNonce)
+		if replacedTxn != nil && mp.publicKeyUsageTracker.countsTowards(replacedTxn, *publicKey) {
+			usage.NumTxns--
+			usage.NumBytes -= replacedTxn.TxSizeBytes
+		}
+	}
+
+	// The burst allowance only applies while the mempool has plenty of room.
+	maxTxns, maxBytes := quota.MaxTxns, quota.MaxBytes
+	maxSizeBytes := mp.getMaxSizeBytesNoLock()
+	if mp.txnRegister.Size() < maxSizeBytes/10000*PosMempoolPublicKeyQuotaBurstUtilizationBasisPoints {
+		maxTxns += quota.BurstTxns
+		maxBytes += quota.BurstBytes
+	}
+
+	if quota.MaxTxns > 0 && usage.NumTxns+1 > maxTxns {
+		return errors.Wrapf(MempoolErrorPublicKeyQuotaExceeded, "PosMempool.checkPublicKeyQuotaNoLock: Public key "+
+			"already has %d transactions in the mempool, the limit is %d", usage.NumTxns, maxTxns)
+	}
+	if quota.MaxBytes > 0 && usage.NumBytes+txn.TxSizeBytes > maxBytes {
+		return errors.Wrapf(MempoolErrorPublicKeyQuotaExceeded, "PosMempool.checkPublicKeyQuotaNoLock: Public key "+
+			"already has %d bytes of transactions in the mempool, adding %d bytes would exceed the limit of %d",
+			usage.NumBytes, txn.TxSizeBytes, maxBytes)
+	}
+	return nil
+}
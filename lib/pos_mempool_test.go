@@ -22,7 +22,7 @@ func TestPosMempoolStart(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		&params, globalParams, nil, 0, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100,
+		&params, globalParams, nil, 0, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	require.True(mempool.IsRunning())
@@ -50,7 +50,7 @@ func TestPosMempoolRestartWithTransactions(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	require.True(mempool.IsRunning())
@@ -69,7 +69,7 @@ func TestPosMempoolRestartWithTransactions(t *testing.T) {
 
 	newPool := NewPosMempool()
 	require.NoError(newPool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100),
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0),
 	)
 	require.NoError(newPool.Start())
 	require.True(newPool.IsRunning())
@@ -104,7 +104,7 @@ func TestPosMempoolPrune(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	require.True(mempool.IsRunning())
@@ -122,14 +122,19 @@ func TestPosMempoolPrune(t *testing.T) {
 		_wrappedPosMempoolAddTransaction(t, mempool, txn)
 	}
 
+	// Transactions are evicted by ancestor-package fee rate. The two highest fee txns, both from m0, always survive.
+	// The third survivor is either m0's 1776 txn, whose package includes the two txns above, or m1's 1852 txn. The
+	// two packages have fee rates within a couple percent of each other, and the txns carry random extra data whose
+	// signature length varies by a byte, so which one wins depends on the exact txn sizes.
 	fetchedTxns := mempool.GetTransactions()
 	require.Equal(3, len(fetchedTxns))
 	require.Equal(uint64(1974), fetchedTxns[0].Tx.TxnFeeNanos)
 	require.Equal(uint64(1931), fetchedTxns[1].Tx.TxnFeeNanos)
-	require.Equal(uint64(1776), fetchedTxns[2].Tx.TxnFeeNanos)
+	require.Contains([]uint64{1776, 1852}, fetchedTxns[2].Tx.TxnFeeNanos)
 	require.Equal(uint64(1974), mempool.GetTransaction(fetchedTxns[0].Hash).Tx.TxnFeeNanos)
 	require.Equal(uint64(1931), mempool.GetTransaction(fetchedTxns[1].Hash).Tx.TxnFeeNanos)
-	require.Equal(uint64(1776), mempool.GetTransaction(fetchedTxns[2].Hash).Tx.TxnFeeNanos)
+	require.Equal(fetchedTxns[2].Tx.TxnFeeNanos, mempool.GetTransaction(fetchedTxns[2].Hash).Tx.TxnFeeNanos)
+	require.Equal(uint64(7), mempool.GetEvictionStats().EvictedTxnCount)
 
 	// Remove one transaction.
 	_wrappedPosMempoolRemoveTransaction(t, mempool, fetchedTxns[0].Hash)
@@ -140,7 +145,7 @@ func TestPosMempoolPrune(t *testing.T) {
 
 	newPool := NewPosMempool()
 	require.NoError(newPool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(newPool.Start())
 	require.True(newPool.IsRunning())
@@ -175,6 +180,125 @@ func TestPosMempoolPrune(t *testing.T) {
 	require.False(newPool.IsRunning())
 }
 
+func TestPosMempoolMemoryBudget(t *testing.T) {
+	require := require.New(t)
+	seed := int64(994)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+	maxSizeBytes := uint64(500)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, maxSizeBytes, 0, 0, 0,
+	))
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+	require.Equal(MempoolEvictionStats{}, mempool.GetEvictionStats())
+
+	addedSizeBytes := uint64(0)
+	for ii := 0; ii < 10; ii++ {
+		txn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+		txnBytes, err := txn.ToBytes(false)
+		require.NoError(err)
+		addedSizeBytes += uint64(len(txnBytes))
+		_wrappedPosMempoolAddTransaction(t, mempool, txn)
+	}
+
+	// The node's budget is far below the global param, so it is the one that applies.
+	require.LessOrEqual(mempool.GetSizeBytes(), maxSizeBytes)
+	remainingTxns := mempool.GetTransactions()
+	require.Less(len(remainingTxns), 10)
+
+	// Every evicted transaction is accounted for in the eviction stats, and since all transactions come from the
+	// same public key, the evicted transactions pay a lower fee rate than those that remain.
+	evictionStats := mempool.GetEvictionStats()
+	require.Equal(uint64(10-len(remainingTxns)), evictionStats.EvictedTxnCount)
+	require.Equal(addedSizeBytes-mempool.GetSizeBytes(), evictionStats.EvictedTxnSizeBytes)
+	require.NotZero(evictionStats.EvictionCount)
+	for _, txn := range remainingTxns {
+		require.GreaterOrEqual(txn.FeePerKB, evictionStats.LastEvictedFeeRateNanosPerKB)
+	}
+	mempool.Stop()
+	require.False(mempool.IsRunning())
+}
+
+func TestPosMempoolNonceQueue(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1077)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	globalParams.MaxNonceExpirationBlockHeightOffset = 10
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m0Pk := NewPublicKey(m0PubBytes)
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 2, 0, 0,
+	))
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+
+	// At block height 2, nonces can expire at most at block height 12. Transactions with nonces expiring within
+	// another 10 blocks are queued rather than rejected.
+	txn20 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 20, 25)
+	txn21 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 21, 25)
+	txn30 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 30, 25)
+	require.NoError(mempool.AddTransaction(txn20, time.Now()))
+	require.NoError(mempool.AddTransaction(txn21, time.Now()))
+	require.ErrorIs(mempool.AddTransaction(txn30, time.Now()), TxErrorNonceExpirationBlockHeightOffsetExceeded)
+	require.Equal(0, len(mempool.GetTransactions()))
+	require.Equal(2, len(mempool.GetQueuedTransactions()))
+
+	// The queue for m0 is full. A transaction with a lower nonce evicts the one with the highest nonce, while a
+	// transaction with a higher nonce is rejected.
+	txn19 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 19, 25)
+	txn22 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 22, 25)
+	require.NoError(mempool.AddTransaction(txn19, time.Now()))
+	require.ErrorIs(mempool.AddTransaction(txn22, time.Now()), MempoolErrorNonceQueueFull)
+	queuedTxns := mempool.nonceQueue.GetTxnsByPublicKey(*m0Pk)
+	require.Equal(2, len(queuedTxns))
+	require.True(queuedTxns[0].Hash.IsEqual(txn19.Hash()))
+	require.True(queuedTxns[1].Hash.IsEqual(txn20.Hash()))
+
+	// Once the block height reaches 9, the nonce expiring at 19 is valid and its transaction is promoted into the
+	// mempool, while the other one stays in the queue.
+	mempool.UpdateLatestBlock(latestBlockView, 9)
+	require.Equal(1, len(mempool.GetTransactions()))
+	require.True(mempool.IsTransactionInPool(txn19.Hash()))
+	require.Equal(1, len(mempool.GetQueuedTransactions()))
+	require.Equal(true, _checkPosMempoolIntegrity(t, mempool))
+
+	mempool.UpdateLatestBlock(latestBlockView, 10)
+	require.Equal(2, len(mempool.GetTransactions()))
+	require.True(mempool.IsTransactionInPool(txn20.Hash()))
+	require.Equal(0, len(mempool.GetQueuedTransactions()))
+	require.Equal(true, _checkPosMempoolIntegrity(t, mempool))
+
+	mempool.Stop()
+	require.False(mempool.IsRunning())
+}
+
 func TestPosMempoolUpdateGlobalParams(t *testing.T) {
 	require := require.New(t)
 	seed := int64(995)
@@ -195,7 +319,7 @@ func TestPosMempoolUpdateGlobalParams(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	require.True(mempool.IsRunning())
@@ -226,7 +350,7 @@ func TestPosMempoolUpdateGlobalParams(t *testing.T) {
 
 	newPool := NewPosMempool()
 	require.NoError(newPool.Init(
-		params, newGlobalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100,
+		params, newGlobalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(newPool.Start())
 	require.True(newPool.IsRunning())
@@ -257,7 +381,7 @@ func TestPosMempoolReplaceWithHigherFee(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
 	))
 	require.NoError(mempool.Start())
 	require.True(mempool.IsRunning())
@@ -315,6 +439,96 @@ func TestPosMempoolReplaceWithHigherFee(t *testing.T) {
 	require.False(mempool.IsRunning())
 }
 
+func TestPosMempoolLocalTransactions(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1081)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+
+	// Relayed transactions expire after a minute.
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 60,
+	))
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+	var droppedEvents []*LocalTxnDroppedEvent
+	mempool.OnLocalTxnDropped(func(event *LocalTxnDroppedEvent) {
+		droppedEvents = append(droppedEvents, event)
+	})
+
+	localTxn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	require.NoError(mempool.AddLocalTransaction(localTxn, time.Now()))
+	relayedTxn := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25)
+	_wrappedPosMempoolAddTransaction(t, mempool, relayedTxn)
+	require.True(mempool.IsLocalTransaction(localTxn.Hash()))
+	require.False(mempool.IsLocalTransaction(relayedTxn.Hash()))
+	localTxns := mempool.GetLocalTransactions()
+	require.Equal(1, len(localTxns))
+	require.Equal(localTxn, localTxns[0].Tx)
+
+	// A local transaction that is replaced by a relayed one with a higher fee is dropped.
+	replacementTxn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	replacementTxn.TxnFeeNanos = localTxn.TxnFeeNanos + 1000
+	*replacementTxn.TxnNonce = *localTxn.TxnNonce
+	_signTxn(t, replacementTxn, m0Priv)
+	_wrappedPosMempoolAddTransaction(t, mempool, replacementTxn)
+	require.False(mempool.IsLocalTransaction(localTxn.Hash()))
+	require.False(mempool.IsLocalTransaction(replacementTxn.Hash()))
+	require.Equal(1, len(droppedEvents))
+	require.Equal(localTxn, droppedEvents[0].Txn)
+	require.Equal(MempoolTxnRemovalReasonReplaced, droppedEvents[0].Reason)
+
+	// Once the TTL passes, the relayed transactions expire and the local ones stay.
+	localTxn2 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	require.NoError(mempool.AddLocalTransaction(localTxn2, time.Now()))
+	require.Equal(3, len(mempool.GetTransactions()))
+	mempool.expireTransactions(time.Now().Add(30 * time.Second))
+	require.Equal(3, len(mempool.GetTransactions()))
+	mempool.expireTransactions(time.Now().Add(2 * time.Minute))
+	require.Equal(1, len(mempool.GetTransactions()))
+	require.True(mempool.IsTransactionInPool(localTxn2.Hash()))
+	require.Equal(1, len(droppedEvents))
+	require.Equal(true, _checkPosMempoolIntegrity(t, mempool))
+
+	// A local transaction that is included in a block is confirmed, not dropped.
+	mempool.OnBlockConnected(&MsgDeSoBlock{Header: &MsgDeSoHeader{}, Txns: []*MsgDeSoTxn{localTxn2}})
+	require.Equal(0, len(mempool.GetTransactions()))
+	require.False(mempool.IsLocalTransaction(localTxn2.Hash()))
+	require.Equal(1, len(droppedEvents))
+
+	// A local transaction that is removed from the mempool is dropped.
+	localTxn3 := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25)
+	require.NoError(mempool.AddLocalTransaction(localTxn3, time.Now()))
+	_wrappedPosMempoolRemoveTransaction(t, mempool, localTxn3.Hash())
+	require.Equal(2, len(droppedEvents))
+	require.Equal(MempoolTxnRemovalReasonRemoved, droppedEvents[1].Reason)
+	require.Nil(mempool.GetLocalTransactions())
+
+	// A local transaction that fails to be added isn't tracked, while a relayed transaction that is submitted again
+	// locally is.
+	expiredTxn := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 1, 25)
+	require.Error(mempool.AddLocalTransaction(expiredTxn, time.Now()))
+	require.False(mempool.IsLocalTransaction(expiredTxn.Hash()))
+	_wrappedPosMempoolAddTransaction(t, mempool, localTxn3)
+	require.Error(mempool.AddLocalTransaction(localTxn3, time.Now()))
+	require.True(mempool.IsLocalTransaction(localTxn3.Hash()))
+	mempool.Stop()
+	require.False(mempool.IsRunning())
+}
+
 func TestPosMempoolTransactionValidation(t *testing.T) {
 	seed := int64(1073)
 	rand := rand.New(rand.NewSource(seed))
@@ -333,7 +547,7 @@ func TestPosMempoolTransactionValidation(t *testing.T) {
 
 	mempool := NewPosMempool()
 	require.NoError(t, mempool.Init(
-		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 100, 10,
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 100, 10, 0, 0, 0, 0,
 	))
 	require.NoError(t, mempool.Start())
 	require.True(t, mempool.IsRunning())
@@ -344,12 +558,23 @@ func TestPosMempoolTransactionValidation(t *testing.T) {
 		PublicKey:   m1PubBytes,
 		AmountNanos: 1000,
 	}}
+	// This spends more than m0's balance, so it should fail when it's connected to the validation view.
+	overspendOutput := []*DeSoOutput{{
+		PublicKey:   m1PubBytes,
+		AmountNanos: 1e9,
+	}}
 	txn1 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25, output)
-	// This should fail signature verification.
-	txn2 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m1Priv, 100, 25, output)
+	txn2 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25, overspendOutput)
 	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
 	_wrappedPosMempoolAddTransaction(t, mempool, txn2)
 
+	// A transaction with an invalid signature is rejected before it's admitted to the mempool.
+	badSignatureTxn := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m1Priv, 100, 25, output)
+	err := mempool.AddTransaction(badSignatureTxn, time.Now())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), RuleErrorInvalidTransactionSignature)
+	require.Nil(t, mempool.GetTransaction(badSignatureTxn.Hash()))
+
 	// Wait for the validation routine to finish.
 	mempool.BlockUntilReadOnlyViewRegenerated()
 	mempool.BlockUntilReadOnlyViewRegenerated()
@@ -375,8 +600,8 @@ func TestPosMempoolTransactionValidation(t *testing.T) {
 	}
 
 	for ii := 0; ii < 10; ii++ {
-		// Make sure the transaction fails the signature verification.
-		txn := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m1Priv, 100, 25, output)
+		// Make sure the transaction fails when it's connected to the validation view.
+		txn := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25, overspendOutput)
 		failingTxns = append(failingTxns, txn)
 		_wrappedPosMempoolAddTransaction(t, mempool, txn)
 	}
@@ -405,6 +630,306 @@ func TestPosMempoolTransactionValidation(t *testing.T) {
 	mempool.Stop()
 }
 
+func TestPosMempoolAddTransactions(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1091)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 3, 0,
+	))
+	require.Equal(3, cap(mempool.validationWorkerSemaphore))
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+
+	// Build a batch of valid transactions, with a transaction signed by the wrong key, a duplicate, and a nil
+	// transaction mixed in.
+	var txns []*MsgDeSoTxn
+	for ii := 0; ii < 20; ii++ {
+		pk, priv := m0PubBytes, m0Priv
+		if ii%2 == 1 {
+			pk, priv = m1PubBytes, m1Priv
+		}
+		txns = append(txns, _generateTestTxn(t, rand, feeMin, feeMax, pk, priv, 100, 0))
+	}
+	badSignatureTxn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m1Priv, 100, 0)
+	txns = append(txns, badSignatureTxn, txns[0], nil)
+
+	errs := mempool.AddTransactions(txns, time.Now())
+	require.Len(errs, len(txns))
+	for ii := 0; ii < 20; ii++ {
+		require.NoError(errs[ii])
+		require.NotNil(mempool.GetTransaction(txns[ii].Hash()))
+	}
+	require.Error(errs[20])
+	require.Contains(errs[20].Error(), RuleErrorInvalidTransactionSignature)
+	require.Nil(mempool.GetTransaction(badSignatureTxn.Hash()))
+	require.Error(errs[21])
+	require.Contains(errs[21].Error(), "Transaction already in mempool")
+	require.Error(errs[22])
+	require.Equal(20, len(mempool.GetTransactions()))
+	require.True(_checkPosMempoolIntegrity(t, mempool))
+
+	mempool.Stop()
+	require.False(mempool.IsRunning())
+}
+
+func TestPosMempoolProcessTransactionBatch(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1092)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	m2PubBytes, _, _ := Base58CheckDecode(m2Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 3, 0,
+	))
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+
+	// m2 has no balance, so its transaction can only connect after m0's transfer to it.
+	fundM2Txn := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 0,
+		[]*DeSoOutput{{PublicKey: m2PubBytes, AmountNanos: 50000}})
+	m2Txn := _generateTestTxn(t, rand, feeMin, feeMax, m2PubBytes, m2Priv, 100, 0)
+	results := mempool.ProcessTransactionBatch([]*MsgDeSoTxn{m2Txn})
+	require.Len(results, 1)
+	require.Error(results[0].Err)
+	require.Nil(mempool.GetTransaction(m2Txn.Hash()))
+	results = mempool.ProcessTransactionBatch([]*MsgDeSoTxn{fundM2Txn, m2Txn})
+	require.Len(results, 2)
+	for ii, txn := range []*MsgDeSoTxn{fundM2Txn, m2Txn} {
+		require.NoError(results[ii].Err)
+		require.Equal(txn.Hash(), results[ii].TxnHash)
+		mempoolTx := mempool.GetTransaction(txn.Hash())
+		require.NotNil(mempoolTx)
+		require.NotZero(results[ii].FeeRateNanosPerKB)
+		require.Equal(mempoolTx.FeePerKB, results[ii].FeeRateNanosPerKB)
+	}
+
+	// If a transaction of the batch fails, none of the batch is admitted.
+	m1Txn := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 0)
+	overspendTxn := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 0,
+		[]*DeSoOutput{{PublicKey: m1PubBytes, AmountNanos: 1000000}})
+	results = mempool.ProcessTransactionBatch([]*MsgDeSoTxn{m1Txn, overspendTxn})
+	require.Len(results, 2)
+	require.ErrorIs(results[0].Err, MempoolErrorBatchRejected)
+	require.Zero(results[0].FeeRateNanosPerKB)
+	require.Error(results[1].Err)
+	require.NotErrorIs(results[1].Err, MempoolErrorBatchRejected)
+	require.Nil(mempool.GetTransaction(m1Txn.Hash()))
+	require.Nil(mempool.GetTransaction(overspendTxn.Hash()))
+
+	// A batch with a transaction signed by the wrong key, or a transaction already in the mempool, is rejected too.
+	badSignatureTxn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m1Priv, 100, 0)
+	results = mempool.ProcessTransactionBatch([]*MsgDeSoTxn{m1Txn, badSignatureTxn})
+	require.Contains(results[1].Err.Error(), RuleErrorInvalidTransactionSignature)
+	require.ErrorIs(results[0].Err, MempoolErrorBatchRejected)
+	results = mempool.ProcessTransactionBatch([]*MsgDeSoTxn{m1Txn, fundM2Txn, nil})
+	require.Contains(results[1].Err.Error(), "Transaction already in mempool")
+	require.Nil(results[2].TxnHash)
+	require.Nil(mempool.GetTransaction(m1Txn.Hash()))
+	require.Equal(2, len(mempool.GetTransactions()))
+	require.True(_checkPosMempoolIntegrity(t, mempool))
+
+	mempool.Stop()
+	require.False(mempool.IsRunning())
+}
+
+func TestPosMempoolAugmentedView(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1103)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	m0InitialBalance, err := latestBlockView.GetDeSoBalanceNanosForPublicKey(m0PubBytes)
+	require.NoError(err)
+	m1InitialBalance, err := latestBlockView.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	dir := _dbDirSetup(t)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 100, 10, 0, 0, 0, 0,
+	))
+	require.NoError(mempool.Start())
+	defer mempool.Stop()
+
+	// m0 sends m1 two transfers and m1 sends m0 one.
+	txn1 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25,
+		[]*DeSoOutput{{PublicKey: m1PubBytes, AmountNanos: 1000}})
+	txn2 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25,
+		[]*DeSoOutput{{PublicKey: m1PubBytes, AmountNanos: 2000}})
+	txn3 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25,
+		[]*DeSoOutput{{PublicKey: m0PubBytes, AmountNanos: 500}})
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn2)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn3)
+	generation := mempool.GetAugmentedViewGeneration()
+
+	// A view generated after the transactions were added has all of them connected. The validation routine may
+	// have been running while they were added, so we wait for the generation after the next one.
+	augmentedView, err := mempool.GetAugmentedView(&AugmentedViewOptions{
+		MinGeneration: generation + 2,
+		MaxAge:        time.Minute,
+		MaxWait:       5 * time.Second,
+	})
+	require.NoError(err)
+	require.False(augmentedView.IsFiltered)
+	require.Greater(augmentedView.Generation, generation)
+	require.Equal(uint64(2), augmentedView.BlockHeight)
+	m0Balance, err := augmentedView.View.GetDeSoBalanceNanosForPublicKey(m0PubBytes)
+	require.NoError(err)
+	require.Equal(m0InitialBalance-3000+500-txn1.TxnFeeNanos-txn2.TxnFeeNanos, m0Balance)
+
+	// A view that can't meet the requirements in time is stale.
+	_, err = mempool.GetAugmentedView(&AugmentedViewOptions{MinGeneration: augmentedView.Generation + 1000})
+	require.Error(err)
+	require.Contains(err.Error(), MempoolErrorAugmentedViewStale)
+	_, err = mempool.GetAugmentedView(&AugmentedViewOptions{
+		MinGeneration: augmentedView.Generation + 1000,
+		MaxWait:       20 * time.Millisecond,
+	})
+	require.Error(err)
+	require.Contains(err.Error(), MempoolErrorAugmentedViewStale)
+
+	// A view filtered to m0 only has m0's transactions connected.
+	augmentedView, err = mempool.GetAugmentedView(&AugmentedViewOptions{PublicKey: m0PubBytes})
+	require.NoError(err)
+	require.True(augmentedView.IsFiltered)
+	require.Equal(uint64(2), augmentedView.NumTxnsConnected)
+	require.Equal(uint64(0), augmentedView.NumTxnsSkipped)
+	require.False(augmentedView.IsTruncated)
+	m0Balance, err = augmentedView.View.GetDeSoBalanceNanosForPublicKey(m0PubBytes)
+	require.NoError(err)
+	require.Equal(m0InitialBalance-3000-txn1.TxnFeeNanos-txn2.TxnFeeNanos, m0Balance)
+	m1Balance, err := augmentedView.View.GetDeSoBalanceNanosForPublicKey(m1PubBytes)
+	require.NoError(err)
+	require.Equal(m1InitialBalance+3000, m1Balance)
+
+	// The number of transactions connected to a filtered view is capped.
+	augmentedView, err = mempool.GetAugmentedView(&AugmentedViewOptions{PublicKey: m0PubBytes, MaxTxnConnects: 1})
+	require.NoError(err)
+	require.Equal(uint64(1), augmentedView.NumTxnsConnected)
+	require.True(augmentedView.IsTruncated)
+
+	// Once the mempool moves to a new block, a view that requires the latest block waits for the view to be
+	// regenerated on it.
+	mempool.UpdateLatestBlock(latestBlockView, 3)
+	augmentedView, err = mempool.GetAugmentedView(&AugmentedViewOptions{
+		RequireLatestBlock: true,
+		MaxWait:            5 * time.Second,
+	})
+	require.NoError(err)
+	require.Equal(uint64(3), augmentedView.BlockHeight)
+}
+
+func TestPosMempoolPublicKeyQuota(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1109)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempoolBackupIntervalMillis := uint64(30000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, mempoolBackupIntervalMillis, nil, 1000, 100, 0, 0, 0, 0,
+	))
+	mempool.SetPublicKeyQuota(PublicKeyQuota{MaxTxns: 2, BurstTxns: 1})
+	require.NoError(mempool.Start())
+	defer mempool.Stop()
+
+	// While the mempool is mostly empty, m0 can add its two transactions and one more from its burst allowance.
+	var m0Txns []*MsgDeSoTxn
+	for ii := 0; ii < 3; ii++ {
+		txn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+		_wrappedPosMempoolAddTransaction(t, mempool, txn)
+		m0Txns = append(m0Txns, txn)
+	}
+	require.Equal(uint64(3), mempool.GetPublicKeyUsage(m0PubBytes).NumTxns)
+	txn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	err := mempool.AddTransaction(txn, time.Now())
+	require.Error(err)
+	require.Contains(err.Error(), MempoolErrorPublicKeyQuotaExceeded)
+
+	// Other public keys aren't affected, and m0 can still replace its transactions with ones paying a higher fee.
+	m1Txn := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25)
+	_wrappedPosMempoolAddTransaction(t, mempool, m1Txn)
+	replacementTxn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	replacementTxn.TxnFeeNanos = m0Txns[2].TxnFeeNanos + 1000
+	*replacementTxn.TxnNonce = *m0Txns[2].TxnNonce
+	_signTxn(t, replacementTxn, m0Priv)
+	_wrappedPosMempoolAddTransaction(t, mempool, replacementTxn)
+	require.Equal(uint64(3), mempool.GetPublicKeyUsage(m0PubBytes).NumTxns)
+	require.Equal(uint64(1), mempool.GetPublicKeyUsage(m1PubBytes).NumTxns)
+
+	// Removing a transaction frees up room for m0, but not the burst allowance once the mempool is more than half
+	// full.
+	require.NoError(mempool.RemoveTransaction(replacementTxn.Hash()))
+	require.Equal(uint64(2), mempool.GetPublicKeyUsage(m0PubBytes).NumTxns)
+	mempool.Lock()
+	mempool.maxSizeBytes = mempool.txnRegister.Size() * 3 / 2
+	mempool.Unlock()
+	err = mempool.AddTransaction(txn, time.Now())
+	require.Error(err)
+	require.Contains(err.Error(), MempoolErrorPublicKeyQuotaExceeded)
+	mempool.Lock()
+	mempool.maxSizeBytes = 0
+	mempool.Unlock()
+	_wrappedPosMempoolAddTransaction(t, mempool, txn)
+
+	// The quota can also limit the bytes a public key holds.
+	m1Usage := mempool.GetPublicKeyUsage(m1PubBytes)
+	mempool.SetPublicKeyQuota(PublicKeyQuota{MaxBytes: m1Usage.NumBytes})
+	err = mempool.AddTransaction(_generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25), time.Now())
+	require.Error(err)
+	require.Contains(err.Error(), MempoolErrorPublicKeyQuotaExceeded)
+	require.Equal(m1Usage, mempool.GetPublicKeyUsage(m1PubBytes))
+}
+
 func _posTestBlockchainSetup(t *testing.T) (_params *DeSoParams, _db *badger.DB) {
 	return _posTestBlockchainSetupWithBalances(t, 200000, 200000)
 }
@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/core/consensus"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// SlashingProtectionDirName is the name of the folder, relative to the node's data directory, in which
+// the slashing protection database is stored.
+const SlashingProtectionDirName = "slashing_protection"
+
+// The slashing protection database uses its own tiny key space, independent of the chain DB prefixes.
+//   - <prefixSlashingProtectionVote, view uint64> -> <blockHash [32]byte>
+//   - <prefixSlashingProtectionTimeout, view uint64> -> <highQCView uint64>
+//   - <prefixSlashingProtectionPublicKey> -> <BLS public key bytes>
+var (
+	prefixSlashingProtectionVote      = []byte{0}
+	prefixSlashingProtectionTimeout   = []byte{1}
+	prefixSlashingProtectionPublicKey = []byte{2}
+)
+
+// SlashingProtectionDB is a local store that records every vote and timeout message the validator's
+// BLS key has signed. The BLSSigner consults it before producing any vote or timeout signature so that
+// the validator never signs two conflicting messages for the same view, even across restarts or if the
+// same key is accidentally loaded on two machines sharing the same data directory.
+//
+// Every record is written with SyncWrites enabled and is persisted before the signature is released.
+// The invariants enforced are:
+//   - At most one block hash is ever voted on for a given view.
+//   - At most one high QC view is ever used in a timeout for a given view.
+//
+// Re-signing an identical message is allowed, which keeps retries after a crash idempotent.
+type SlashingProtectionDB struct {
+	lock sync.Mutex
+	db   *badger.DB
+	dir  string
+}
+
+// OpenSlashingProtectionDB opens the slashing protection database located in dataDir. If the database
+// does not exist yet, OpenSlashingProtectionDB refuses to create it unless allowCreate is true. Starting
+// a validator without its slashing protection history is exactly how double-signs happen in practice,
+// e.g. when a node is migrated to a new machine and the old data directory is left behind, so the
+// operator has to explicitly opt in to starting with an empty history.
+func OpenSlashingProtectionDB(dataDir string, allowCreate bool) (*SlashingProtectionDB, error) {
+	dir := filepath.Join(dataDir, SlashingProtectionDirName)
+	if _, err := os.Stat(dir); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "OpenSlashingProtectionDB: Problem checking for directory %v", dir)
+		}
+		if !allowCreate {
+			return nil, errors.Errorf("OpenSlashingProtectionDB: No slashing protection database found at %v. "+
+				"If this validator has never signed messages before, or you have verified that no other node "+
+				"is running with the same key, restart with --pos-validator-allow-new-slashing-protection-db", dir)
+		}
+		glog.Warningf(CLog(Yellow, "OpenSlashingProtectionDB: Creating a new slashing protection database at %v"), dir)
+	}
+
+	opts := DefaultBadgerOptions(dir)
+	opts.SyncWrites = true
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "OpenSlashingProtectionDB: Problem opening badger DB at %v", dir)
+	}
+	return &SlashingProtectionDB{db: db, dir: dir}, nil
+}
+
+// Close closes the underlying badger DB.
+func (spdb *SlashingProtectionDB) Close() error {
+	spdb.lock.Lock()
+	defer spdb.lock.Unlock()
+	return spdb.db.Close()
+}
+
+// CheckAndSetPublicKey binds the database to a single BLS public key. If the database was previously
+// used with a different key, an error is returned, since its history says nothing about what the new
+// key has signed.
+func (spdb *SlashingProtectionDB) CheckAndSetPublicKey(publicKey *bls.PublicKey) error {
+	if publicKey == nil {
+		return errors.New("SlashingProtectionDB.CheckAndSetPublicKey: publicKey cannot be nil")
+	}
+	spdb.lock.Lock()
+	defer spdb.lock.Unlock()
+
+	publicKeyBytes := publicKey.ToBytes()
+	return spdb.db.Update(func(txn *badger.Txn) error {
+		existingPublicKeyBytes, err := _slashingProtectionGet(txn, prefixSlashingProtectionPublicKey)
+		if err != nil {
+			return errors.Wrapf(err, "SlashingProtectionDB.CheckAndSetPublicKey: ")
+		}
+		if existingPublicKeyBytes == nil {
+			return txn.Set(prefixSlashingProtectionPublicKey, publicKeyBytes)
+		}
+		if !bytes.Equal(existingPublicKeyBytes, publicKeyBytes) {
+			return errors.Errorf("SlashingProtectionDB.CheckAndSetPublicKey: Database at %v belongs to "+
+				"BLS public key 0x%v, not %v", spdb.dir, hex.EncodeToString(existingPublicKeyBytes), publicKey.ToString())
+		}
+		return nil
+	})
+}
+
+// CheckAndRecordVote verifies that signing a vote for (view, blockHash) cannot conflict with any
+// vote signed in the past and durably records it. It must be called before the vote is signed.
+func (spdb *SlashingProtectionDB) CheckAndRecordVote(view uint64, blockHash consensus.BlockHash) error {
+	if isInterfaceValueNil(blockHash) {
+		return errors.New("SlashingProtectionDB.CheckAndRecordVote: blockHash cannot be nil")
+	}
+	spdb.lock.Lock()
+	defer spdb.lock.Unlock()
+
+	blockHashValue := blockHash.GetValue()
+	key := append(append([]byte{}, prefixSlashingProtectionVote...), EncodeUint64(view)...)
+	return spdb.db.Update(func(txn *badger.Txn) error {
+		existingBlockHashBytes, err := _slashingProtectionGet(txn, key)
+		if err != nil {
+			return errors.Wrapf(err, "SlashingProtectionDB.CheckAndRecordVote: ")
+		}
+		if existingBlockHashBytes == nil {
+			return txn.Set(key, blockHashValue[:])
+		}
+		if !bytes.Equal(existingBlockHashBytes, blockHashValue[:]) {
+			return errors.Errorf("SlashingProtectionDB.CheckAndRecordVote: Refusing to sign vote for block %v "+
+				"at view %d; already signed a vote for block %v at this view", NewBlockHash(blockHashValue[:]),
+				view, NewBlockHash(existingBlockHashBytes))
+		}
+		return nil
+	})
+}
+
+// CheckAndRecordTimeout verifies that signing a timeout for (view, highQCView) cannot conflict with any
+// timeout signed in the past and durably records it. It must be called before the timeout is signed.
+func (spdb *SlashingProtectionDB) CheckAndRecordTimeout(view uint64, highQCView uint64) error {
+	spdb.lock.Lock()
+	defer spdb.lock.Unlock()
+
+	key := append(append([]byte{}, prefixSlashingProtectionTimeout...), EncodeUint64(view)...)
+	return spdb.db.Update(func(txn *badger.Txn) error {
+		existingHighQCViewBytes, err := _slashingProtectionGet(txn, key)
+		if err != nil {
+			return errors.Wrapf(err, "SlashingProtectionDB.CheckAndRecordTimeout: ")
+		}
+		if existingHighQCViewBytes == nil {
+			return txn.Set(key, EncodeUint64(highQCView))
+		}
+		if existingHighQCView := DecodeUint64(existingHighQCViewBytes); existingHighQCView != highQCView {
+			return errors.Errorf("SlashingProtectionDB.CheckAndRecordTimeout: Refusing to sign timeout with "+
+				"high QC view %d at view %d; already signed a timeout with high QC view %d at this view",
+				highQCView, view, existingHighQCView)
+		}
+		return nil
+	})
+}
+
+// GetSignedVoteBlockHash returns the block hash the validator voted for at the given view, or nil
+// if it has not voted at that view.
+func (spdb *SlashingProtectionDB) GetSignedVoteBlockHash(view uint64) (*BlockHash, error) {
+	spdb.lock.Lock()
+	defer spdb.lock.Unlock()
+
+	var blockHash *BlockHash
+	key := append(append([]byte{}, prefixSlashingProtectionVote...), EncodeUint64(view)...)
+	err := spdb.db.View(func(txn *badger.Txn) error {
+		blockHashBytes, err := _slashingProtectionGet(txn, key)
+		if err != nil || blockHashBytes == nil {
+			return err
+		}
+		blockHash = NewBlockHash(blockHashBytes)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "SlashingProtectionDB.GetSignedVoteBlockHash: ")
+	}
+	return blockHash, nil
+}
+
+func _slashingProtectionGet(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlashingProtectionDB(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := os.MkdirTemp("", "badgerdb-slashing-protection")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Opening a missing database without explicitly allowing its creation fails.
+	_, err = OpenSlashingProtectionDB(dir, false)
+	require.Error(err)
+
+	spdb, err := OpenSlashingProtectionDB(dir, true)
+	require.NoError(err)
+
+	blsPrivateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	signer, err := NewBLSSigner(blsPrivateKey)
+	require.NoError(err)
+	require.NoError(signer.SetSlashingProtectionDB(spdb))
+
+	blockHash1 := NewBlockHash(RandomBytes(32))
+	blockHash2 := NewBlockHash(RandomBytes(32))
+
+	// Voting for a block at a view succeeds, and re-signing the same vote is idempotent.
+	_, err = signer.SignValidatorVote(5, blockHash1)
+	require.NoError(err)
+	_, err = signer.SignValidatorVote(5, blockHash1)
+	require.NoError(err)
+
+	// Voting for a different block at the same view is refused. Block proposals go through the same check.
+	_, err = signer.SignValidatorVote(5, blockHash2)
+	require.Error(err)
+	_, err = signer.SignBlockProposal(5, blockHash2)
+	require.Error(err)
+
+	// Voting at a different view is fine.
+	_, err = signer.SignValidatorVote(6, blockHash2)
+	require.NoError(err)
+
+	// Timeouts with the same high QC view are idempotent, and conflicting ones are refused.
+	_, err = signer.SignValidatorTimeout(7, 4)
+	require.NoError(err)
+	_, err = signer.SignValidatorTimeout(7, 4)
+	require.NoError(err)
+	_, err = signer.SignValidatorTimeout(7, 3)
+	require.Error(err)
+
+	// The history survives a restart.
+	require.NoError(spdb.Close())
+	spdb, err = OpenSlashingProtectionDB(dir, false)
+	require.NoError(err)
+	defer spdb.Close()
+
+	signedBlockHash, err := spdb.GetSignedVoteBlockHash(5)
+	require.NoError(err)
+	require.Equal(blockHash1, signedBlockHash)
+	signedBlockHash, err = spdb.GetSignedVoteBlockHash(8)
+	require.NoError(err)
+	require.Nil(signedBlockHash)
+
+	restartedSigner, err := NewBLSSigner(blsPrivateKey)
+	require.NoError(err)
+	require.NoError(restartedSigner.SetSlashingProtectionDB(spdb))
+	_, err = restartedSigner.SignValidatorVote(5, blockHash2)
+	require.Error(err)
+
+	// The database cannot be reused by a different key.
+	otherBLSPrivateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	otherSigner, err := NewBLSSigner(otherBLSPrivateKey)
+	require.NoError(err)
+	require.Error(otherSigner.SetSlashingProtectionDB(spdb))
+}
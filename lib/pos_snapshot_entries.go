@@ -184,6 +184,9 @@ func MergeGlobalParamEntryDefaults(globalParamsEntry *GlobalParamsEntry, params
 	if globalParamsEntryCopy.TimeoutIntervalMillisecondsPoS == 0 {
 		globalParamsEntryCopy.TimeoutIntervalMillisecondsPoS = params.DefaultTimeoutIntervalMillisecondsPoS
 	}
+	if globalParamsEntryCopy.TimeoutBackoffMultiplierBasisPointsPoS == 0 {
+		globalParamsEntryCopy.TimeoutBackoffMultiplierBasisPointsPoS = params.DefaultTimeoutBackoffMultiplierBasisPointsPoS
+	}
 
 	// Return the merged result.
 	return globalParamsEntryCopy
@@ -410,7 +413,11 @@ func (bav *UtxoView) _setSnapshotValidatorSetEntry(validatorEntry *ValidatorEntr
 	}
 	bav.SnapshotValidatorSet[mapKey] = validatorEntry.Copy()
 
-	bav._setSnapshotValidatorBLSPublicKeyPKIDPairEntry(validatorEntry.ToBLSPublicKeyPKIDPairEntry(), snapshotAtEpochNumber)
+	// Snapshot every BLS PublicKey reserved for the validator, so that both of its keys map
+	// to it while a voting key rotation is in progress.
+	for _, blsPublicKeyPKIDPairEntry := range validatorEntry.ToBLSPublicKeyPKIDPairEntries() {
+		bav._setSnapshotValidatorBLSPublicKeyPKIDPairEntry(blsPublicKeyPKIDPairEntry, snapshotAtEpochNumber)
+	}
 }
 
 func (bav *UtxoView) _deleteSnapshotValidatorSetEntry(validatorEntry *ValidatorEntry, snapshotAtEpochNumber uint64) {
@@ -0,0 +1,442 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+//
+// TYPES: StakingRewardStatementEntry
+//
+
+// StakingRewardStatementEntry records the staking reward paid out to a single snapshot stake when an epoch
+// completes. RewardNanos is the portion of the reward that went to the staker, after the validator's commission
+// was withheld. CommissionNanos is the portion that was withheld and paid to the validator. A validator's total
+// commission for an epoch is the sum of CommissionNanos across the statements for the validator in that epoch.
+//
+// Statements are derived from the PoS reward distribution, so they aren't part of the state. They are written
+// when the final block of an epoch is connected and deleted if that block is disconnected.
+type StakingRewardStatementEntry struct {
+	EpochNumber   uint64
+	ValidatorPKID *PKID
+	StakerPKID    *PKID
+	// RewardMethod is the snapshotted stake's reward method, which determines whether RewardNanos was
+	// restaked or paid to the staker's wallet.
+	RewardMethod StakingRewardMethod
+	// StakeAmountNanos is the snapshotted stake amount the reward was computed from.
+	StakeAmountNanos *uint256.Int
+	RewardNanos      uint64
+	CommissionNanos  uint64
+
+	isDeleted bool
+}
+
+type StakingRewardStatementMapKey struct {
+	EpochNumber   uint64
+	ValidatorPKID PKID
+	StakerPKID    PKID
+}
+
+func (statement *StakingRewardStatementEntry) Copy() *StakingRewardStatementEntry {
+	return &StakingRewardStatementEntry{
+		EpochNumber:      statement.EpochNumber,
+		ValidatorPKID:    statement.ValidatorPKID.NewPKID(),
+		StakerPKID:       statement.StakerPKID.NewPKID(),
+		RewardMethod:     statement.RewardMethod,
+		StakeAmountNanos: statement.StakeAmountNanos.Clone(),
+		RewardNanos:      statement.RewardNanos,
+		CommissionNanos:  statement.CommissionNanos,
+		isDeleted:        statement.isDeleted,
+	}
+}
+
+func (statement *StakingRewardStatementEntry) ToMapKey() StakingRewardStatementMapKey {
+	return StakingRewardStatementMapKey{
+		EpochNumber:   statement.EpochNumber,
+		ValidatorPKID: *statement.ValidatorPKID,
+		StakerPKID:    *statement.StakerPKID,
+	}
+}
+
+func (statement *StakingRewardStatementEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(statement.EpochNumber)...)
+	data = append(data, EncodeToBytes(blockHeight, statement.ValidatorPKID, skipMetadata...)...)
+	data = append(data, EncodeToBytes(blockHeight, statement.StakerPKID, skipMetadata...)...)
+	data = append(data, statement.RewardMethod)
+	data = append(data, VariableEncodeUint256(statement.StakeAmountNanos)...)
+	data = append(data, UintToBuf(statement.RewardNanos)...)
+	data = append(data, UintToBuf(statement.CommissionNanos)...)
+	return data
+}
+
+func (statement *StakingRewardStatementEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// EpochNumber
+	statement.EpochNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "StakingRewardStatementEntry.Decode: Problem reading EpochNumber: ")
+	}
+
+	// ValidatorPKID
+	statement.ValidatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "StakingRewardStatementEntry.Decode: Problem reading ValidatorPKID: ")
+	}
+
+	// StakerPKID
+	statement.StakerPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "StakingRewardStatementEntry.Decode: Problem reading StakerPKID: ")
+	}
+
+	// RewardMethod
+	statement.RewardMethod, err = rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "StakingRewardStatementEntry.Decode: Problem reading RewardMethod: ")
+	}
+
+	// StakeAmountNanos
+	statement.StakeAmountNanos, err = VariableDecodeUint256(rr)
+	if err != nil {
+		return errors.Wrapf(err, "StakingRewardStatementEntry.Decode: Problem reading StakeAmountNanos: ")
+	}
+
+	// RewardNanos
+	statement.RewardNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "StakingRewardStatementEntry.Decode: Problem reading RewardNanos: ")
+	}
+
+	// CommissionNanos
+	statement.CommissionNanos, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "StakingRewardStatementEntry.Decode: Problem reading CommissionNanos: ")
+	}
+
+	return nil
+}
+
+func (statement *StakingRewardStatementEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (statement *StakingRewardStatementEntry) GetEncoderType() EncoderType {
+	return EncoderTypeStakingRewardStatementEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForStakingRewardStatementByStaker(statement *StakingRewardStatementEntry) []byte {
+	data := DBPrefixKeyForStakingRewardStatementsByStaker(statement.StakerPKID)
+	data = append(data, EncodeUint64(statement.EpochNumber)...)
+	data = append(data, statement.ValidatorPKID.ToBytes()...)
+	return data
+}
+
+func DBPrefixKeyForStakingRewardStatementsByStaker(stakerPKID *PKID) []byte {
+	data := append([]byte{}, Prefixes.PrefixStakingRewardStatementByStakerEpochValidator...)
+	data = append(data, stakerPKID.ToBytes()...)
+	return data
+}
+
+func DBKeyForStakingRewardStatementByEpochAndValidator(statement *StakingRewardStatementEntry) []byte {
+	data := DBPrefixKeyForStakingRewardStatementsByEpochAndValidator(statement.EpochNumber, statement.ValidatorPKID)
+	data = append(data, statement.StakerPKID.ToBytes()...)
+	return data
+}
+
+func DBPrefixKeyForStakingRewardStatementsByEpoch(epochNumber uint64) []byte {
+	data := append([]byte{}, Prefixes.PrefixStakingRewardStatementByEpochValidatorStaker...)
+	data = append(data, EncodeUint64(epochNumber)...)
+	return data
+}
+
+func DBPrefixKeyForStakingRewardStatementsByEpochAndValidator(epochNumber uint64, validatorPKID *PKID) []byte {
+	data := DBPrefixKeyForStakingRewardStatementsByEpoch(epochNumber)
+	data = append(data, validatorPKID.ToBytes()...)
+	return data
+}
+
+// DBGetStakingRewardStatements returns up to limit statements under the prefix with keys strictly after
+// lastSeenKey, in ascending key order. Keys in keysToSkip are ignored. A limit of 0 means no limit.
+func DBGetStakingRewardStatements(
+	handle *badger.DB,
+	prefix []byte,
+	lastSeenKey []byte,
+	limit int,
+	keysToSkip *Set[string],
+) ([]*StakingRewardStatementEntry, error) {
+	var statements []*StakingRewardStatementEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		startKey := prefix
+		if lastSeenKey != nil {
+			startKey = lastSeenKey
+		}
+		for iterator.Seek(startKey); iterator.ValidForPrefix(prefix); iterator.Next() {
+			if limit > 0 && len(statements) >= limit {
+				break
+			}
+			key := iterator.Item().Key()
+			if bytes.Equal(key, lastSeenKey) || keysToSkip.Includes(string(key)) {
+				continue
+			}
+			statementBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			statement, err := DecodeDeSoEncoder(&StakingRewardStatementEntry{}, bytes.NewReader(statementBytes))
+			if err != nil {
+				return err
+			}
+			statements = append(statements, statement)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetStakingRewardStatements: problem retrieving statements: ")
+	}
+	return statements, nil
+}
+
+func DBPutStakingRewardStatementWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	statement *StakingRewardStatementEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if statement == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutStakingRewardStatementWithTxn: called with nil statement")
+		return nil
+	}
+
+	statementBytes := EncodeToBytes(blockHeight, statement)
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForStakingRewardStatementByStaker(statement), statementBytes, eventManager,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBPutStakingRewardStatementWithTxn: problem storing statement in index PrefixStakingRewardStatementByStakerEpochValidator: ",
+		)
+	}
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForStakingRewardStatementByEpochAndValidator(statement), statementBytes, eventManager,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBPutStakingRewardStatementWithTxn: problem storing statement in index PrefixStakingRewardStatementByEpochValidatorStaker: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteStakingRewardStatementWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	statement *StakingRewardStatementEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if statement == nil {
+		return nil
+	}
+
+	if err := DBDeleteWithTxn(
+		txn, snap, DBKeyForStakingRewardStatementByStaker(statement), eventManager, entryIsDeleted,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteStakingRewardStatementWithTxn: problem deleting statement from index PrefixStakingRewardStatementByStakerEpochValidator: ",
+		)
+	}
+	if err := DBDeleteWithTxn(
+		txn, snap, DBKeyForStakingRewardStatementByEpochAndValidator(statement), eventManager, entryIsDeleted,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteStakingRewardStatementWithTxn: problem deleting statement from index PrefixStakingRewardStatementByEpochValidatorStaker: ",
+		)
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setStakingRewardStatementMappings(statement *StakingRewardStatementEntry) {
+	// This function shouldn't be called with nil.
+	if statement == nil {
+		glog.Errorf("_setStakingRewardStatementMappings: called with nil statement, this should never happen")
+		return
+	}
+	bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry[statement.ToMapKey()] = statement
+}
+
+func (bav *UtxoView) _deleteStakingRewardStatementMappings(statement *StakingRewardStatementEntry) {
+	// This function shouldn't be called with nil.
+	if statement == nil {
+		glog.Errorf("_deleteStakingRewardStatementMappings: called with nil statement, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneStatement := statement.Copy()
+	tombstoneStatement.isDeleted = true
+	bav._setStakingRewardStatementMappings(tombstoneStatement)
+}
+
+// _deleteStakingRewardStatementsForEpoch deletes all statements recorded for the epoch. It is called when the
+// final block of the epoch is disconnected.
+func (bav *UtxoView) _deleteStakingRewardStatementsForEpoch(epochNumber uint64) error {
+	dbStatements, err := DBGetStakingRewardStatements(
+		bav.Handle, DBPrefixKeyForStakingRewardStatementsByEpoch(epochNumber), nil, 0, NewSet([]string{}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "_deleteStakingRewardStatementsForEpoch: ")
+	}
+	for _, statement := range dbStatements {
+		if _, exists := bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry[statement.ToMapKey()]; !exists {
+			bav._deleteStakingRewardStatementMappings(statement)
+		}
+	}
+	for mapKey, statement := range bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry {
+		if mapKey.EpochNumber == epochNumber {
+			bav._deleteStakingRewardStatementMappings(statement)
+		}
+	}
+	return nil
+}
+
+// GetStakingRewardStatementsForStaker returns the staker's reward statements across all epochs and validators,
+// ordered by epoch and then by validator. Pass the last statement of the previous page as lastSeenStatement to
+// fetch the next page, or nil to fetch the first page.
+func (bav *UtxoView) GetStakingRewardStatementsForStaker(
+	stakerPKID *PKID,
+	lastSeenStatement *StakingRewardStatementEntry,
+	limit int,
+) ([]*StakingRewardStatementEntry, error) {
+	if stakerPKID == nil {
+		return nil, errors.New("GetStakingRewardStatementsForStaker: called with nil StakerPKID")
+	}
+	statements, err := bav._getStakingRewardStatements(
+		DBPrefixKeyForStakingRewardStatementsByStaker(stakerPKID),
+		DBKeyForStakingRewardStatementByStaker,
+		lastSeenStatement,
+		limit,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetStakingRewardStatementsForStaker: ")
+	}
+	return statements, nil
+}
+
+// GetStakingRewardStatementsForEpochAndValidator returns the reward statements of every stake delegated to the
+// validator in the epoch, ordered by staker. Pagination works as in GetStakingRewardStatementsForStaker.
+func (bav *UtxoView) GetStakingRewardStatementsForEpochAndValidator(
+	epochNumber uint64,
+	validatorPKID *PKID,
+	lastSeenStatement *StakingRewardStatementEntry,
+	limit int,
+) ([]*StakingRewardStatementEntry, error) {
+	if validatorPKID == nil {
+		return nil, errors.New("GetStakingRewardStatementsForEpochAndValidator: called with nil ValidatorPKID")
+	}
+	statements, err := bav._getStakingRewardStatements(
+		DBPrefixKeyForStakingRewardStatementsByEpochAndValidator(epochNumber, validatorPKID),
+		DBKeyForStakingRewardStatementByEpochAndValidator,
+		lastSeenStatement,
+		limit,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetStakingRewardStatementsForEpochAndValidator: ")
+	}
+	return statements, nil
+}
+
+// _getStakingRewardStatements merges the statements in the UtxoView with the statements in the db for one of the
+// statement indexes. dbKeyFunc returns a statement's key in the index, which determines the order of the results.
+func (bav *UtxoView) _getStakingRewardStatements(
+	prefix []byte,
+	dbKeyFunc func(*StakingRewardStatementEntry) []byte,
+	lastSeenStatement *StakingRewardStatementEntry,
+	limit int,
+) ([]*StakingRewardStatementEntry, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("_getStakingRewardStatements: invalid limit %d", limit)
+	}
+	var lastSeenKey []byte
+	if lastSeenStatement != nil {
+		lastSeenKey = dbKeyFunc(lastSeenStatement)
+	}
+
+	// Collect the statements in the UtxoView that fall in the requested page. Statements in the UtxoView,
+	// including deleted ones, are skipped when reading from the db since the UtxoView is more up to date.
+	utxoViewStatements := make(map[string]*StakingRewardStatementEntry)
+	dbKeysToSkip := NewSet([]string{})
+	for _, statement := range bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry {
+		dbKey := dbKeyFunc(statement)
+		if !bytes.HasPrefix(dbKey, prefix) {
+			continue
+		}
+		dbKeysToSkip.Add(string(dbKey))
+		if !statement.isDeleted && (lastSeenKey == nil || bytes.Compare(dbKey, lastSeenKey) > 0) {
+			utxoViewStatements[string(dbKey)] = statement
+		}
+	}
+
+	// The db returns at most limit statements that aren't in the UtxoView, so the first limit statements of
+	// the merged results are the requested page.
+	dbStatements, err := DBGetStakingRewardStatements(bav.Handle, prefix, lastSeenKey, limit, dbKeysToSkip)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getStakingRewardStatements: ")
+	}
+
+	statements := dbStatements
+	for _, statement := range utxoViewStatements {
+		statements = append(statements, statement)
+	}
+	sort.Slice(statements, func(ii, jj int) bool {
+		return bytes.Compare(dbKeyFunc(statements[ii]), dbKeyFunc(statements[jj])) < 0
+	})
+	if limit > 0 && len(statements) > limit {
+		statements = statements[:limit]
+	}
+	return statements, nil
+}
+
+func (bav *UtxoView) _flushStakingRewardStatementsToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, statement := range bav.StakingRewardStatementMapKeyToStakingRewardStatementEntry {
+		// Sanity-check that the entry matches the map key.
+		if statement.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushStakingRewardStatementsToDbWithTxn: statement key %v doesn't match MapKey %v",
+				statement.ToMapKey(), mapKey,
+			)
+		}
+
+		// Statements are only ever set once per epoch, so we only need to delete the ones that were
+		// tombstoned when the final block of their epoch was disconnected.
+		if statement.isDeleted {
+			if err := DBDeleteStakingRewardStatementWithTxn(txn, bav.Snapshot, statement, bav.EventManager, true); err != nil {
+				return errors.Wrapf(err, "_flushStakingRewardStatementsToDbWithTxn: ")
+			}
+			continue
+		}
+		if err := DBPutStakingRewardStatementWithTxn(txn, bav.Snapshot, statement, blockHeight, bav.EventManager); err != nil {
+			return errors.Wrapf(err, "_flushStakingRewardStatementsToDbWithTxn: ")
+		}
+	}
+	return nil
+}
@@ -88,6 +88,17 @@ func (bav *UtxoView) DistributeStakingRewardsToSnapshotStakes(blockHeight uint64
 			continue
 		}
 
+		// Record the reward statement for the stake.
+		bav._setStakingRewardStatementMappings(&StakingRewardStatementEntry{
+			EpochNumber:      currentEpochEntry.EpochNumber,
+			ValidatorPKID:    snapshotStakeEntry.ValidatorPKID.NewPKID(),
+			StakerPKID:       snapshotStakeEntry.StakerPKID.NewPKID(),
+			RewardMethod:     snapshotStakeEntry.RewardMethod,
+			StakeAmountNanos: snapshotStakeEntry.StakeAmountNanos.Clone(),
+			RewardNanos:      stakerRewardNanos,
+			CommissionNanos:  validatorCommissionNanos,
+		})
+
 		// Reward the staker their portion of the staking reward.
 		if stakerRewardNanos > 0 {
 			var utxoOperation *UtxoOperation
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Canonical Transaction Ordering
+//
+// Starting at CanonicalTxnOrderingBlockHeight, the non-block-reward transactions in every PoS block must
+// appear in a canonical order that any validator can recompute from the block itself:
+//
+//  1. By fee rate in nanos per KB, highest first. The fee rate is computed with
+//     MsgDeSoTxn.ComputeFeeRatePerKBNanos, the same way the mempool computes it.
+//  2. By nonce, lowest ExpirationBlockHeight first, then lowest PartialID first. Transactions
+//     without a nonce sort as if their nonce were zero.
+//  3. By transaction hash, lowest first.
+//
+// The block reward transaction is always first and is excluded from the ordering. Since every key in
+// the ordering is derived from the transaction bytes, a block producer can no longer reorder transactions
+// to extract value without the reordering being detected by every validator in ConnectBlock.
+//
+// Note that a transaction that depends on another transaction in the same block, e.g. a post made by an
+// account created earlier in the block, must also sort after it. The PosBlockProducer handles this by
+// sorting the candidate transactions canonically before greedily connecting them, which skips any
+// transaction whose dependency would sort after it.
+
+// canonicalTxnOrderKey holds the fields of a transaction that determine its position in the canonical order.
+type canonicalTxnOrderKey struct {
+	feeRateNanosPerKB     uint64
+	expirationBlockHeight uint64
+	partialID             uint64
+	hash                  *BlockHash
+}
+
+func newCanonicalTxnOrderKey(txn *MsgDeSoTxn, txnHash *BlockHash) (*canonicalTxnOrderKey, error) {
+	if txn == nil {
+		return nil, errors.New("newCanonicalTxnOrderKey: txn cannot be nil")
+	}
+	if txnHash == nil {
+		txnHash = txn.Hash()
+		if txnHash == nil {
+			return nil, errors.New("newCanonicalTxnOrderKey: Problem hashing txn")
+		}
+	}
+	feeRateNanosPerKB, err := txn.ComputeFeeRatePerKBNanos()
+	if err != nil {
+		return nil, errors.Wrapf(err, "newCanonicalTxnOrderKey: Problem computing fee rate")
+	}
+	key := &canonicalTxnOrderKey{
+		feeRateNanosPerKB: feeRateNanosPerKB,
+		hash:              txnHash,
+	}
+	if txn.TxnNonce != nil {
+		key.expirationBlockHeight = txn.TxnNonce.ExpirationBlockHeight
+		key.partialID = txn.TxnNonce.PartialID
+	}
+	return key, nil
+}
+
+// compareCanonicalTxnOrderKeys returns -1 if a must come before b in a block, 1 if a must come after b,
+// and 0 if a and b are the same transaction.
+func compareCanonicalTxnOrderKeys(a *canonicalTxnOrderKey, b *canonicalTxnOrderKey) int {
+	if a.feeRateNanosPerKB > b.feeRateNanosPerKB {
+		return -1
+	} else if a.feeRateNanosPerKB < b.feeRateNanosPerKB {
+		return 1
+	}
+	if a.expirationBlockHeight < b.expirationBlockHeight {
+		return -1
+	} else if a.expirationBlockHeight > b.expirationBlockHeight {
+		return 1
+	}
+	if a.partialID < b.partialID {
+		return -1
+	} else if a.partialID > b.partialID {
+		return 1
+	}
+	return bytes.Compare(a.hash[:], b.hash[:])
+}
+
+// CompareTxnsCanonicalOrder compares two transactions according to the canonical intra-block ordering.
+// It returns -1 if txnA must come before txnB, 1 if txnA must come after txnB, and 0 if they are the same.
+func CompareTxnsCanonicalOrder(txnA *MsgDeSoTxn, txnB *MsgDeSoTxn) (int, error) {
+	keyA, err := newCanonicalTxnOrderKey(txnA, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "CompareTxnsCanonicalOrder: Problem computing key for txnA")
+	}
+	keyB, err := newCanonicalTxnOrderKey(txnB, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "CompareTxnsCanonicalOrder: Problem computing key for txnB")
+	}
+	return compareCanonicalTxnOrderKeys(keyA, keyB), nil
+}
+
+// SortMempoolTxnsCanonicalOrder returns a copy of the provided mempool transactions sorted in the canonical
+// intra-block order. The input slice is not modified. MempoolTx already caches the fee rate and hash, so
+// no transaction needs to be re-serialized.
+func SortMempoolTxnsCanonicalOrder(mempoolTxns []*MempoolTx) []*MempoolTx {
+	sortedTxns := make([]*MempoolTx, 0, len(mempoolTxns))
+	keys := make(map[*MempoolTx]*canonicalTxnOrderKey, len(mempoolTxns))
+	for _, mempoolTx := range mempoolTxns {
+		if mempoolTx == nil || mempoolTx.Tx == nil || mempoolTx.Hash == nil {
+			continue
+		}
+		key := &canonicalTxnOrderKey{
+			feeRateNanosPerKB: mempoolTx.FeePerKB,
+			hash:              mempoolTx.Hash,
+		}
+		if mempoolTx.Tx.TxnNonce != nil {
+			key.expirationBlockHeight = mempoolTx.Tx.TxnNonce.ExpirationBlockHeight
+			key.partialID = mempoolTx.Tx.TxnNonce.PartialID
+		}
+		keys[mempoolTx] = key
+		sortedTxns = append(sortedTxns, mempoolTx)
+	}
+	sort.SliceStable(sortedTxns, func(ii, jj int) bool {
+		return compareCanonicalTxnOrderKeys(keys[sortedTxns[ii]], keys[sortedTxns[jj]]) < 0
+	})
+	return sortedTxns
+}
+
+// ValidateCanonicalTxnOrder verifies that the provided transactions are in strictly increasing canonical
+// order. The transactions must not include the block reward. txnHashes is optional; when provided, it must
+// be the same length as txns and contain their hashes, which saves rehashing every transaction.
+func ValidateCanonicalTxnOrder(txns []*MsgDeSoTxn, txnHashes []*BlockHash) error {
+	if txnHashes != nil && len(txnHashes) != len(txns) {
+		return errors.Errorf("ValidateCanonicalTxnOrder: Got %d txn hashes for %d txns", len(txnHashes), len(txns))
+	}
+	var prevKey *canonicalTxnOrderKey
+	for ii, txn := range txns {
+		var txnHash *BlockHash
+		if txnHashes != nil {
+			txnHash = txnHashes[ii]
+		}
+		key, err := newCanonicalTxnOrderKey(txn, txnHash)
+		if err != nil {
+			return errors.Wrapf(err, "ValidateCanonicalTxnOrder: Problem computing key for txn #%d", ii)
+		}
+		if prevKey != nil && compareCanonicalTxnOrderKeys(prevKey, key) >= 0 {
+			return errors.Wrapf(RuleErrorBlockTxnsNotInCanonicalOrder,
+				"ValidateCanonicalTxnOrder: Txn %v at index %d must come before txn %v", key.hash, ii, prevKey.hash)
+		}
+		prevKey = key
+	}
+	return nil
+}
+
+const (
+	RuleErrorBlockTxnsNotInCanonicalOrder RuleError = "RuleErrorBlockTxnsNotInCanonicalOrder"
+)
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalTxnOrder(t *testing.T) {
+	require := require.New(t)
+
+	newTxn := func(feeNanos uint64, expirationBlockHeight uint64, partialID uint64) *MsgDeSoTxn {
+		txn := &MsgDeSoTxn{
+			TxnVersion:  DeSoTxnVersion1,
+			TxInputs:    []*DeSoInput{},
+			TxOutputs:   []*DeSoOutput{},
+			TxnFeeNanos: feeNanos,
+			TxnNonce: &DeSoNonce{
+				ExpirationBlockHeight: expirationBlockHeight,
+				PartialID:             partialID,
+			},
+			TxnMeta:   &BasicTransferMetadata{},
+			PublicKey: m0PkBytes,
+		}
+		_signTxn(t, txn, m0Priv)
+		return txn
+	}
+
+	// Signature lengths vary slightly, so the zero-fee transactions are used to test the nonce tie-breaks
+	// since their fee rate is always exactly zero.
+	highFee := newTxn(200000, 10, 1)
+	midFee := newTxn(100000, 1, 1)
+	zeroFeeEarlyNonce := newTxn(0, 5, 7)
+	zeroFeeLateNonceLowPartialID := newTxn(0, 6, 1)
+	zeroFeeLateNonceHighPartialID := newTxn(0, 6, 2)
+	expectedOrder := []*MsgDeSoTxn{
+		highFee, midFee, zeroFeeEarlyNonce, zeroFeeLateNonceLowPartialID, zeroFeeLateNonceHighPartialID,
+	}
+
+	// The expected order validates.
+	require.NoError(ValidateCanonicalTxnOrder(expectedOrder, nil))
+
+	// Any swap of two adjacent transactions is rejected.
+	for ii := 0; ii < len(expectedOrder)-1; ii++ {
+		reordered := append([]*MsgDeSoTxn{}, expectedOrder...)
+		reordered[ii], reordered[ii+1] = reordered[ii+1], reordered[ii]
+		err := ValidateCanonicalTxnOrder(reordered, nil)
+		require.Error(err)
+		require.Contains(err.Error(), RuleErrorBlockTxnsNotInCanonicalOrder)
+	}
+
+	// Duplicate transactions are never in canonical order.
+	require.Error(ValidateCanonicalTxnOrder([]*MsgDeSoTxn{highFee, highFee}, nil))
+
+	// Comparison is consistent with the validation above.
+	cmp, err := CompareTxnsCanonicalOrder(highFee, zeroFeeEarlyNonce)
+	require.NoError(err)
+	require.Equal(-1, cmp)
+	cmp, err = CompareTxnsCanonicalOrder(zeroFeeLateNonceHighPartialID, zeroFeeLateNonceLowPartialID)
+	require.NoError(err)
+	require.Equal(1, cmp)
+
+	// Sorting mempool transactions in reverse order recovers the canonical order.
+	var mempoolTxns []*MempoolTx
+	for ii := len(expectedOrder) - 1; ii >= 0; ii-- {
+		mempoolTx, err := NewMempoolTx(expectedOrder[ii], time.Now(), 1)
+		require.NoError(err)
+		mempoolTxns = append(mempoolTxns, mempoolTx)
+	}
+	sortedTxns := SortMempoolTxnsCanonicalOrder(mempoolTxns)
+	require.Len(sortedTxns, len(expectedOrder))
+	for ii := range expectedOrder {
+		require.Equal(expectedOrder[ii].Hash(), sortedTxns[ii].Hash)
+	}
+	// The input slice is left untouched.
+	require.Equal(expectedOrder[len(expectedOrder)-1].Hash(), mempoolTxns[0].Hash)
+}
+
+func TestIsCanonicalTxnOrderingBlockHeight(t *testing.T) {
+	params := DeSoTestnetParams
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 10
+	params.ForkHeights.CanonicalTxnOrderingBlockHeight = 20
+
+	require.False(t, params.IsCanonicalTxnOrderingBlockHeight(5))
+	require.False(t, params.IsCanonicalTxnOrderingBlockHeight(19))
+	require.True(t, params.IsCanonicalTxnOrderingBlockHeight(20))
+
+	// The rule never applies to PoW blocks, even if the fork height is lower than the PoS cutover.
+	params.ForkHeights.CanonicalTxnOrderingBlockHeight = 0
+	require.False(t, params.IsCanonicalTxnOrderingBlockHeight(9))
+	require.True(t, params.IsCanonicalTxnOrderingBlockHeight(10))
+}
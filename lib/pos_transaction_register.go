@@ -2,6 +2,7 @@ package lib
 
 import (
 	"bytes"
+	"container/heap"
 	"fmt"
 	"math"
 	"math/big"
@@ -320,10 +321,11 @@ func (tr *TransactionRegister) GetTransaction(hash *BlockHash) *MempoolTx {
 	return tr.txnMembership[*hash]
 }
 
-// PruneToSize removes transactions from the end of the register until the size of the register shrinks to the desired
-// number of bytes. The returned transactions, _prunedTxns, are ordered by lowest-to-highest priority, i.e. first
-// transaction will have the smallest fee, last transaction will have the highest fee. Returns _err = nil if no
-// transactions were pruned.
+// PruneToSize evicts transactions from the register until the size of the register shrinks to the desired number of
+// bytes. Transactions are evicted in order of lowest-to-highest ancestor-package fee rate, as described in
+// getTransactionsToPrune, and the returned transactions, _prunedTxns, are in the order they were evicted. If all
+// transactions come from the same public key, this is exactly the reverse Fee-Time order.
+// Returns _err = nil if no transactions were pruned.
 func (tr *TransactionRegister) PruneToSize(maxSizeBytes uint64) (_prunedTxns []*MempoolTx, _err error) {
 	tr.Lock()
 	defer tr.Unlock()
@@ -354,43 +356,64 @@ func (tr *TransactionRegister) PruneToSize(maxSizeBytes uint64) (_prunedTxns []*
 	return prunedTxns, nil
 }
 
+// getTransactionsToPrune selects at least minPrunedBytes worth of transactions to evict from the register, ordered
+// by ancestor-package fee rate. The caller must hold a lock on the register.
+//
+// The ancestors of a transaction are all transactions from the same public key that precede it in Fee-Time order,
+// i.e. the transactions that a block producer would include before it. The ancestor package of a transaction is the
+// transaction together with its ancestors, and the package fee rate is the size-weighted average fee rate of the
+// package. Only the last transaction of each public key is ever a candidate for eviction, so a transaction is never
+// evicted while a transaction that depends on it is kept. Among the candidates, the one whose package has the lowest
+// fee rate is evicted first, with ties broken by lowest Fee-Time priority. This keeps a cheap transaction from a
+// public key whose other transactions pay a high fee rate in the mempool over an isolated transaction with a slightly
+// higher fee rate, which is what maximizes the fees of the transactions that remain.
 func (tr *TransactionRegister) getTransactionsToPrune(minPrunedBytes uint64) (_prunedTxns []*MempoolTx, _err error) {
 	if minPrunedBytes == 0 {
 		return nil, nil
 	}
 
-	prunedBytes := uint64(0)
-	prunedTxns := []*MempoolTx{}
-
-	// Find the FeeTime bucket at the end of the Set. It'll have the smallest fee among the buckets in the register.
-	// We iterate in reverse order, starting from the end, so that we drop transactions ordered by least-to-highest priority.
-	it := tr.feeTimeBucketSet.Iterator()
-	it.End()
-	// Iterate through the buckets in reverse order so that we drop transactions ordered by least-to-highest priority.
-	for it.Prev() {
-		bucket, ok := it.Value().(*FeeTimeBucket)
+	// Group the transactions into ancestor packages by public key. Each package keeps its transactions in Fee-Time
+	// order, so the last transaction in a package is the one that is a candidate for eviction.
+	packagesByPublicKey := make(map[string]*ancestorTxnPackage)
+	packages := &ancestorTxnPackageHeap{}
+	feeTimeIndex := 0
+	it := tr.GetFeeTimeIterator()
+	for it.Next() {
+		txn, ok := it.Value()
 		if !ok {
 			return nil, fmt.Errorf("TransactionRegister.getTransactionsToPrune: " +
-				"Error casting value of FeeTimeBucket")
+				"Error casting value of MempoolTx")
 		}
+		var publicKey []byte
+		if txn.Tx != nil {
+			publicKey = txn.Tx.PublicKey
+		}
+		pkg, exists := packagesByPublicKey[string(publicKey)]
+		if !exists {
+			pkg = newAncestorTxnPackage()
+			packagesByPublicKey[string(publicKey)] = pkg
+			*packages = append(*packages, pkg)
+		}
+		pkg.push(txn, feeTimeIndex)
+		feeTimeIndex++
+	}
+	heap.Init(packages)
 
-		// Iterate through the transactions in the current FeeTime bucket. We iterate in reverse order, starting from the
-		// end, so that we drop transactions ordered by least-to-highest priority.
-		bucketIt := bucket.GetIterator()
-		bucketIt.End()
-		for bucketIt.Prev() {
-			txn, ok := bucketIt.Value().(*MempoolTx)
-			if !ok {
-				return nil, fmt.Errorf("TransactionRegister.getTransactionsToPrune: " +
-					"Error casting value of MempoolTx")
-			}
-			// Add the transaction to the prunedTxns list.
-			prunedTxns = append(prunedTxns, txn)
-			prunedBytes += txn.TxSizeBytes
-			// If we've pruned sufficiently many bytes, we can return early.
-			if prunedBytes >= minPrunedBytes {
-				return prunedTxns, nil
-			}
+	prunedBytes := uint64(0)
+	prunedTxns := []*MempoolTx{}
+	for packages.Len() > 0 {
+		pkg := heap.Pop(packages).(*ancestorTxnPackage)
+		txn := pkg.pop()
+		// Add the transaction to the prunedTxns list.
+		prunedTxns = append(prunedTxns, txn)
+		prunedBytes += txn.TxSizeBytes
+		// If we've pruned sufficiently many bytes, we can return early.
+		if prunedBytes >= minPrunedBytes {
+			return prunedTxns, nil
+		}
+		// The package of the next transaction from the same public key is now a candidate for eviction.
+		if !pkg.empty() {
+			heap.Push(packages, pkg)
 		}
 	}
 
@@ -399,6 +422,90 @@ func (tr *TransactionRegister) getTransactionsToPrune(minPrunedBytes uint64) (_p
 	return prunedTxns, nil
 }
 
+// ancestorTxnPackage is the ancestor package of the last transaction from a single public key, as used by
+// getTransactionsToPrune.
+type ancestorTxnPackage struct {
+	// txns are the transactions in the package, ordered by Fee-Time.
+	txns []*MempoolTx
+	// feeTimeIndices are the positions of txns in the Fee-Time order of the whole register.
+	feeTimeIndices []int
+	// totalSizeBytes is the total size of the transactions in the package.
+	totalSizeBytes uint64
+	// totalWeightedFeeRate is the sum of FeePerKB * TxSizeBytes over the transactions in the package. Dividing it by
+	// totalSizeBytes gives the package fee rate in nanos per KB.
+	totalWeightedFeeRate *big.Int
+}
+
+func newAncestorTxnPackage() *ancestorTxnPackage {
+	return &ancestorTxnPackage{
+		totalWeightedFeeRate: big.NewInt(0),
+	}
+}
+
+func (pkg *ancestorTxnPackage) push(txn *MempoolTx, feeTimeIndex int) {
+	pkg.txns = append(pkg.txns, txn)
+	pkg.feeTimeIndices = append(pkg.feeTimeIndices, feeTimeIndex)
+	pkg.totalSizeBytes += txn.TxSizeBytes
+	pkg.totalWeightedFeeRate.Add(pkg.totalWeightedFeeRate, _ancestorTxnWeightedFeeRate(txn))
+}
+
+func (pkg *ancestorTxnPackage) pop() *MempoolTx {
+	lastIndex := len(pkg.txns) - 1
+	txn := pkg.txns[lastIndex]
+	pkg.txns = pkg.txns[:lastIndex]
+	pkg.feeTimeIndices = pkg.feeTimeIndices[:lastIndex]
+	pkg.totalSizeBytes -= txn.TxSizeBytes
+	pkg.totalWeightedFeeRate.Sub(pkg.totalWeightedFeeRate, _ancestorTxnWeightedFeeRate(txn))
+	return txn
+}
+
+func (pkg *ancestorTxnPackage) empty() bool {
+	return len(pkg.txns) == 0
+}
+
+// lastFeeTimeIndex returns the position of the package's eviction candidate in the Fee-Time order of the register.
+func (pkg *ancestorTxnPackage) lastFeeTimeIndex() int {
+	return pkg.feeTimeIndices[len(pkg.feeTimeIndices)-1]
+}
+
+func _ancestorTxnWeightedFeeRate(txn *MempoolTx) *big.Int {
+	weightedFeeRate := big.NewInt(0).SetUint64(txn.FeePerKB)
+	return weightedFeeRate.Mul(weightedFeeRate, big.NewInt(0).SetUint64(txn.TxSizeBytes))
+}
+
+// ancestorTxnPackageHeap is a min-heap of ancestorTxnPackage objects. The package with the lowest fee rate is at the
+// top of the heap. Among packages with equal fee rates, the one whose eviction candidate has the lowest Fee-Time
+// priority is at the top.
+type ancestorTxnPackageHeap []*ancestorTxnPackage
+
+func (h ancestorTxnPackageHeap) Len() int { return len(h) }
+
+func (h ancestorTxnPackageHeap) Less(ii, jj int) bool {
+	// Compare totalWeightedFeeRate_ii / totalSizeBytes_ii with totalWeightedFeeRate_jj / totalSizeBytes_jj by
+	// cross-multiplying, which avoids any rounding.
+	lhs := big.NewInt(0).Mul(h[ii].totalWeightedFeeRate, big.NewInt(0).SetUint64(h[jj].totalSizeBytes))
+	rhs := big.NewInt(0).Mul(h[jj].totalWeightedFeeRate, big.NewInt(0).SetUint64(h[ii].totalSizeBytes))
+	if cmp := lhs.Cmp(rhs); cmp != 0 {
+		return cmp < 0
+	}
+	return h[ii].lastFeeTimeIndex() > h[jj].lastFeeTimeIndex()
+}
+
+func (h ancestorTxnPackageHeap) Swap(ii, jj int) { h[ii], h[jj] = h[jj], h[ii] }
+
+func (h *ancestorTxnPackageHeap) Push(x interface{}) {
+	*h = append(*h, x.(*ancestorTxnPackage))
+}
+
+func (h *ancestorTxnPackageHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	pkg := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return pkg
+}
+
 // FeeTimeIterator is an iterator over the transactions in a TransactionRegister. The iterator goes through all transactions
 // as ordered by Fee-Time.
 type FeeTimeIterator struct {
@@ -254,6 +254,59 @@ func TestTransactionRegisterPrune(t *testing.T) {
 	require.Equal(len(txnPool), len(txnRegister.GetFeeTimeTransactions()))
 }
 
+func TestTransactionRegisterPruneByAncestorFeeRate(t *testing.T) {
+	require := require.New(t)
+	globalParams := _testGetDefaultGlobalParams()
+
+	newTxn := func(publicKey []byte, feePerKB uint64, added int64) *MempoolTx {
+		return &MempoolTx{
+			Tx: &MsgDeSoTxn{
+				TxnVersion: DeSoTxnVersion1,
+				TxnMeta:    &BasicTransferMetadata{},
+				PublicKey:  publicKey,
+				TxnNonce:   &DeSoNonce{},
+			},
+			FeePerKB:    feePerKB,
+			Added:       time.UnixMicro(added),
+			Hash:        NewBlockHash(RandomBytes(32)),
+			TxSizeBytes: 100,
+		}
+	}
+
+	// m0 has a high fee rate txn and a low fee rate txn, while m1 has a single txn with a fee rate in between.
+	m0HighFee := newTxn(m0PkBytes, 10000, 1)
+	m0LowFee := newTxn(m0PkBytes, 1500, 2)
+	m1MidFee := newTxn(m1PkBytes, 3000, 3)
+
+	txnRegister := NewTransactionRegister()
+	txnRegister.Init(globalParams)
+	for _, txn := range []*MempoolTx{m0HighFee, m0LowFee, m1MidFee} {
+		require.NoError(txnRegister.AddTransaction(txn))
+	}
+
+	// In pure Fee-Time order, m0LowFee would be evicted first. Its ancestor package also contains m0HighFee, though,
+	// so its package fee rate of 5750 beats m1MidFee's 3000, and m1MidFee is evicted first. m0HighFee is never evicted
+	// before m0LowFee since m0LowFee comes after it in Fee-Time order.
+	txns, err := txnRegister.PruneToSize(0)
+	require.NoError(err)
+	require.Len(txns, 3)
+	require.Equal(m1MidFee.Hash, txns[0].Hash)
+	require.Equal(m0LowFee.Hash, txns[1].Hash)
+	require.Equal(m0HighFee.Hash, txns[2].Hash)
+	require.True(txnRegister.Empty())
+
+	// Pruning a single transaction's worth of bytes only evicts m1MidFee.
+	for _, txn := range []*MempoolTx{m0HighFee, m0LowFee, m1MidFee} {
+		require.NoError(txnRegister.AddTransaction(txn))
+	}
+	txns, err = txnRegister.PruneToSize(txnRegister.Size() - 1)
+	require.NoError(err)
+	require.Len(txns, 1)
+	require.Equal(m1MidFee.Hash, txns[0].Hash)
+	require.True(txnRegister.Includes(m0HighFee))
+	require.True(txnRegister.Includes(m0LowFee))
+}
+
 func TestTransactionRegisterWithRemoves(t *testing.T) {
 	seed := int64(88)
 	testCases := 1000
@@ -0,0 +1,618 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/deso-protocol/core/collections/bitset"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+//
+// TYPES: ValidatorPerformanceEntry
+//
+
+// ValidatorPerformanceEntry records how a validator in the snapshot validator set participated in consensus during
+// an epoch. Every block connected in the epoch adds to the entries of the validators in the snapshot validator set:
+//   - NumBlocksEligible counts the blocks that could have included the validator's vote or timeout.
+//   - NumVotesIncluded and NumTimeoutsIncluded count the blocks whose QC or timeout QC the validator signed.
+//   - NumBlocksProposed counts the blocks the validator proposed.
+//   - NumMissedLeaderSlots counts the views in which the validator was the leader and the view timed out
+//     instead, as evidenced by a timeout QC.
+//
+// Entries are derived from the blocks, so they aren't part of the state. They are updated when a block is connected
+// and reverted when it is disconnected, so delegators can evaluate validators without a third-party indexer.
+type ValidatorPerformanceEntry struct {
+	EpochNumber          uint64
+	ValidatorPKID        *PKID
+	NumBlocksEligible    uint64
+	NumVotesIncluded     uint64
+	NumTimeoutsIncluded  uint64
+	NumBlocksProposed    uint64
+	NumMissedLeaderSlots uint64
+
+	isDeleted bool
+}
+
+type ValidatorPerformanceMapKey struct {
+	EpochNumber   uint64
+	ValidatorPKID PKID
+}
+
+func (entry *ValidatorPerformanceEntry) Copy() *ValidatorPerformanceEntry {
+	return &ValidatorPerformanceEntry{
+		EpochNumber:          entry.EpochNumber,
+		ValidatorPKID:        entry.ValidatorPKID.NewPKID(),
+		NumBlocksEligible:    entry.NumBlocksEligible,
+		NumVotesIncluded:     entry.NumVotesIncluded,
+		NumTimeoutsIncluded:  entry.NumTimeoutsIncluded,
+		NumBlocksProposed:    entry.NumBlocksProposed,
+		NumMissedLeaderSlots: entry.NumMissedLeaderSlots,
+		isDeleted:            entry.isDeleted,
+	}
+}
+
+func (entry *ValidatorPerformanceEntry) ToMapKey() ValidatorPerformanceMapKey {
+	return ValidatorPerformanceMapKey{
+		EpochNumber:   entry.EpochNumber,
+		ValidatorPKID: *entry.ValidatorPKID,
+	}
+}
+
+// UptimeBasisPoints is the share of the eligible blocks that included the validator's vote or timeout, in basis
+// points. It is 0 if there were no eligible blocks.
+func (entry *ValidatorPerformanceEntry) UptimeBasisPoints() uint64 {
+	if entry.NumBlocksEligible == 0 {
+		return 0
+	}
+	return (entry.NumVotesIncluded + entry.NumTimeoutsIncluded) * MaxBasisPoints / entry.NumBlocksEligible
+}
+
+func (entry *ValidatorPerformanceEntry) isEmpty() bool {
+	return entry.NumBlocksEligible == 0 && entry.NumVotesIncluded == 0 && entry.NumTimeoutsIncluded == 0 &&
+		entry.NumBlocksProposed == 0 && entry.NumMissedLeaderSlots == 0
+}
+
+func (entry *ValidatorPerformanceEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(entry.EpochNumber)...)
+	data = append(data, EncodeToBytes(blockHeight, entry.ValidatorPKID, skipMetadata...)...)
+	data = append(data, UintToBuf(entry.NumBlocksEligible)...)
+	data = append(data, UintToBuf(entry.NumVotesIncluded)...)
+	data = append(data, UintToBuf(entry.NumTimeoutsIncluded)...)
+	data = append(data, UintToBuf(entry.NumBlocksProposed)...)
+	data = append(data, UintToBuf(entry.NumMissedLeaderSlots)...)
+	return data
+}
+
+func (entry *ValidatorPerformanceEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	var err error
+
+	// EpochNumber
+	entry.EpochNumber, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorPerformanceEntry.Decode: Problem reading EpochNumber: ")
+	}
+
+	// ValidatorPKID
+	entry.ValidatorPKID, err = DecodeDeSoEncoder(&PKID{}, rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorPerformanceEntry.Decode: Problem reading ValidatorPKID: ")
+	}
+
+	// NumBlocksEligible
+	entry.NumBlocksEligible, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorPerformanceEntry.Decode: Problem reading NumBlocksEligible: ")
+	}
+
+	// NumVotesIncluded
+	entry.NumVotesIncluded, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorPerformanceEntry.Decode: Problem reading NumVotesIncluded: ")
+	}
+
+	// NumTimeoutsIncluded
+	entry.NumTimeoutsIncluded, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorPerformanceEntry.Decode: Problem reading NumTimeoutsIncluded: ")
+	}
+
+	// NumBlocksProposed
+	entry.NumBlocksProposed, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorPerformanceEntry.Decode: Problem reading NumBlocksProposed: ")
+	}
+
+	// NumMissedLeaderSlots
+	entry.NumMissedLeaderSlots, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ValidatorPerformanceEntry.Decode: Problem reading NumMissedLeaderSlots: ")
+	}
+
+	return nil
+}
+
+func (entry *ValidatorPerformanceEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *ValidatorPerformanceEntry) GetEncoderType() EncoderType {
+	return EncoderTypeValidatorPerformanceEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForValidatorPerformanceByValidator(entry *ValidatorPerformanceEntry) []byte {
+	data := DBPrefixKeyForValidatorPerformanceByValidator(entry.ValidatorPKID)
+	data = append(data, EncodeUint64(entry.EpochNumber)...)
+	return data
+}
+
+func DBPrefixKeyForValidatorPerformanceByValidator(validatorPKID *PKID) []byte {
+	data := append([]byte{}, Prefixes.PrefixValidatorPerformanceByValidatorEpoch...)
+	data = append(data, validatorPKID.ToBytes()...)
+	return data
+}
+
+func DBKeyForValidatorPerformanceByEpoch(entry *ValidatorPerformanceEntry) []byte {
+	data := DBPrefixKeyForValidatorPerformanceByEpoch(entry.EpochNumber)
+	data = append(data, entry.ValidatorPKID.ToBytes()...)
+	return data
+}
+
+func DBPrefixKeyForValidatorPerformanceByEpoch(epochNumber uint64) []byte {
+	data := append([]byte{}, Prefixes.PrefixValidatorPerformanceByEpochValidator...)
+	data = append(data, EncodeUint64(epochNumber)...)
+	return data
+}
+
+func DBGetValidatorPerformanceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	epochNumber uint64,
+	validatorPKID *PKID,
+) (*ValidatorPerformanceEntry, error) {
+	key := DBKeyForValidatorPerformanceByEpoch(&ValidatorPerformanceEntry{
+		EpochNumber:   epochNumber,
+		ValidatorPKID: validatorPKID,
+	})
+	entryBytes, err := DBGetWithTxn(txn, snap, key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetValidatorPerformanceEntryWithTxn: problem retrieving entry: ")
+	}
+	entry, err := DecodeDeSoEncoder(&ValidatorPerformanceEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetValidatorPerformanceEntryWithTxn: problem decoding entry: ")
+	}
+	return entry, nil
+}
+
+func DBGetValidatorPerformanceEntry(
+	handle *badger.DB,
+	snap *Snapshot,
+	epochNumber uint64,
+	validatorPKID *PKID,
+) (*ValidatorPerformanceEntry, error) {
+	var entry *ValidatorPerformanceEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		entry, innerErr = DBGetValidatorPerformanceEntryWithTxn(txn, snap, epochNumber, validatorPKID)
+		return innerErr
+	})
+	return entry, err
+}
+
+// DBGetValidatorPerformanceEntries returns up to limit entries under the prefix with keys strictly after
+// lastSeenKey, in ascending key order. Keys in keysToSkip are ignored. A limit of 0 means no limit.
+func DBGetValidatorPerformanceEntries(
+	handle *badger.DB,
+	prefix []byte,
+	lastSeenKey []byte,
+	limit int,
+	keysToSkip *Set[string],
+) ([]*ValidatorPerformanceEntry, error) {
+	var entries []*ValidatorPerformanceEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		startKey := prefix
+		if lastSeenKey != nil {
+			startKey = lastSeenKey
+		}
+		for iterator.Seek(startKey); iterator.ValidForPrefix(prefix); iterator.Next() {
+			if limit > 0 && len(entries) >= limit {
+				break
+			}
+			key := iterator.Item().Key()
+			if bytes.Equal(key, lastSeenKey) || keysToSkip.Includes(string(key)) {
+				continue
+			}
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := DecodeDeSoEncoder(&ValidatorPerformanceEntry{}, bytes.NewReader(entryBytes))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetValidatorPerformanceEntries: problem retrieving entries: ")
+	}
+	return entries, nil
+}
+
+func DBPutValidatorPerformanceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ValidatorPerformanceEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutValidatorPerformanceEntryWithTxn: called with nil entry")
+		return nil
+	}
+
+	entryBytes := EncodeToBytes(blockHeight, entry)
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForValidatorPerformanceByValidator(entry), entryBytes, eventManager,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBPutValidatorPerformanceEntryWithTxn: problem storing entry in index PrefixValidatorPerformanceByValidatorEpoch: ",
+		)
+	}
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForValidatorPerformanceByEpoch(entry), entryBytes, eventManager,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBPutValidatorPerformanceEntryWithTxn: problem storing entry in index PrefixValidatorPerformanceByEpochValidator: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteValidatorPerformanceEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *ValidatorPerformanceEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+
+	if err := DBDeleteWithTxn(
+		txn, snap, DBKeyForValidatorPerformanceByValidator(entry), eventManager, entryIsDeleted,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteValidatorPerformanceEntryWithTxn: problem deleting entry from index PrefixValidatorPerformanceByValidatorEpoch: ",
+		)
+	}
+	if err := DBDeleteWithTxn(
+		txn, snap, DBKeyForValidatorPerformanceByEpoch(entry), eventManager, entryIsDeleted,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteValidatorPerformanceEntryWithTxn: problem deleting entry from index PrefixValidatorPerformanceByEpochValidator: ",
+		)
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setValidatorPerformanceEntryMappings(entry *ValidatorPerformanceEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setValidatorPerformanceEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.ValidatorPerformanceMapKeyToValidatorPerformanceEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteValidatorPerformanceEntryMappings(entry *ValidatorPerformanceEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteValidatorPerformanceEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := entry.Copy()
+	tombstoneEntry.isDeleted = true
+	bav._setValidatorPerformanceEntryMappings(tombstoneEntry)
+}
+
+// GetValidatorPerformanceEntry returns the validator's performance in the epoch, or nil if no block connected in
+// the epoch had the validator in its snapshot validator set.
+func (bav *UtxoView) GetValidatorPerformanceEntry(
+	epochNumber uint64, validatorPKID *PKID) (*ValidatorPerformanceEntry, error) {
+
+	if validatorPKID == nil {
+		return nil, errors.New("GetValidatorPerformanceEntry: called with nil ValidatorPKID")
+	}
+	mapKey := ValidatorPerformanceMapKey{EpochNumber: epochNumber, ValidatorPKID: *validatorPKID}
+	if entry, exists := bav.ValidatorPerformanceMapKeyToValidatorPerformanceEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+	entry, err := DBGetValidatorPerformanceEntry(bav.Handle, bav.Snapshot, epochNumber, validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetValidatorPerformanceEntry: ")
+	}
+	if entry != nil {
+		bav._setValidatorPerformanceEntryMappings(entry)
+	}
+	return entry, nil
+}
+
+// GetValidatorPerformanceEntriesForValidator returns the validator's performance entries across all epochs,
+// ordered by epoch. Pass the last entry of the previous page as lastSeenEntry to fetch the next page, or nil to
+// fetch the first page.
+func (bav *UtxoView) GetValidatorPerformanceEntriesForValidator(
+	validatorPKID *PKID,
+	lastSeenEntry *ValidatorPerformanceEntry,
+	limit int,
+) ([]*ValidatorPerformanceEntry, error) {
+	if validatorPKID == nil {
+		return nil, errors.New("GetValidatorPerformanceEntriesForValidator: called with nil ValidatorPKID")
+	}
+	entries, err := bav._getValidatorPerformanceEntries(
+		DBPrefixKeyForValidatorPerformanceByValidator(validatorPKID),
+		DBKeyForValidatorPerformanceByValidator,
+		lastSeenEntry,
+		limit,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetValidatorPerformanceEntriesForValidator: ")
+	}
+	return entries, nil
+}
+
+// GetValidatorPerformanceEntriesForEpoch returns the performance entries of every validator in the epoch, ordered
+// by validator. Pagination works as in GetValidatorPerformanceEntriesForValidator.
+func (bav *UtxoView) GetValidatorPerformanceEntriesForEpoch(
+	epochNumber uint64,
+	lastSeenEntry *ValidatorPerformanceEntry,
+	limit int,
+) ([]*ValidatorPerformanceEntry, error) {
+	entries, err := bav._getValidatorPerformanceEntries(
+		DBPrefixKeyForValidatorPerformanceByEpoch(epochNumber),
+		DBKeyForValidatorPerformanceByEpoch,
+		lastSeenEntry,
+		limit,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetValidatorPerformanceEntriesForEpoch: ")
+	}
+	return entries, nil
+}
+
+// _getValidatorPerformanceEntries merges the entries in the UtxoView with the entries in the db for one of the
+// performance indexes, as in _getStakingRewardStatements.
+func (bav *UtxoView) _getValidatorPerformanceEntries(
+	prefix []byte,
+	dbKeyFunc func(*ValidatorPerformanceEntry) []byte,
+	lastSeenEntry *ValidatorPerformanceEntry,
+	limit int,
+) ([]*ValidatorPerformanceEntry, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("_getValidatorPerformanceEntries: invalid limit %d", limit)
+	}
+	var lastSeenKey []byte
+	if lastSeenEntry != nil {
+		lastSeenKey = dbKeyFunc(lastSeenEntry)
+	}
+
+	utxoViewEntries := make(map[string]*ValidatorPerformanceEntry)
+	dbKeysToSkip := NewSet([]string{})
+	for _, entry := range bav.ValidatorPerformanceMapKeyToValidatorPerformanceEntry {
+		dbKey := dbKeyFunc(entry)
+		if !bytes.HasPrefix(dbKey, prefix) {
+			continue
+		}
+		dbKeysToSkip.Add(string(dbKey))
+		if !entry.isDeleted && (lastSeenKey == nil || bytes.Compare(dbKey, lastSeenKey) > 0) {
+			utxoViewEntries[string(dbKey)] = entry
+		}
+	}
+
+	dbEntries, err := DBGetValidatorPerformanceEntries(bav.Handle, prefix, lastSeenKey, limit, dbKeysToSkip)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getValidatorPerformanceEntries: ")
+	}
+
+	entries := dbEntries
+	for _, entry := range utxoViewEntries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(ii, jj int) bool {
+		return bytes.Compare(dbKeyFunc(entries[ii]), dbKeyFunc(entries[jj])) < 0
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// _updateValidatorPerformanceForBlock adds the block's participation to the performance entries of the validators
+// in the snapshot validator set for the epoch, or subtracts it if isConnect is false. snapshotValidators must be
+// the snapshot validator set sorted by stake, which is the order of the QC signers lists.
+//
+// Like the staking reward statements, this assumes that a block is disconnected against the same epoch and
+// snapshot validator set it was connected against.
+func (bav *UtxoView) _updateValidatorPerformanceForBlock(
+	header *MsgDeSoHeader,
+	snapshotValidators []*ValidatorEntry,
+	epochNumber uint64,
+	isConnect bool,
+) error {
+	deltas := make(map[PKID]*ValidatorPerformanceEntry)
+	getDelta := func(validatorPKID *PKID) *ValidatorPerformanceEntry {
+		if _, exists := deltas[*validatorPKID]; !exists {
+			deltas[*validatorPKID] = &ValidatorPerformanceEntry{
+				EpochNumber:   epochNumber,
+				ValidatorPKID: validatorPKID.NewPKID(),
+			}
+		}
+		return deltas[*validatorPKID]
+	}
+
+	// Votes and timeouts.
+	isTimeoutBlock := header.ValidatorsVoteQC.isEmpty()
+	var signersList *bitset.Bitset
+	if !isTimeoutBlock {
+		signersList = header.ValidatorsVoteQC.ValidatorsVoteAggregatedSignature.SignersList
+	} else if !header.ValidatorsTimeoutAggregateQC.isEmpty() {
+		signersList = header.ValidatorsTimeoutAggregateQC.ValidatorsTimeoutAggregatedSignature.SignersList
+	}
+	for ii, validator := range snapshotValidators {
+		delta := getDelta(validator.ValidatorPKID)
+		delta.NumBlocksEligible++
+		if signersList == nil || !signersList.Get(ii) {
+			continue
+		}
+		if isTimeoutBlock {
+			delta.NumTimeoutsIncluded++
+		} else {
+			delta.NumVotesIncluded++
+		}
+	}
+
+	// Proposals.
+	for _, validator := range snapshotValidators {
+		if header.ProposerVotingPublicKey != nil && validator.VotingPublicKey.Eq(header.ProposerVotingPublicKey) {
+			getDelta(validator.ValidatorPKID).NumBlocksProposed++
+			break
+		}
+	}
+
+	// Missed leader slots. The views between the view of the block's QC and the block's own view timed out.
+	// Their leaders are consecutive in the leader schedule, see hasValidBlockProposerPoS.
+	if isTimeoutBlock && !header.ValidatorsTimeoutAggregateQC.isEmpty() {
+		currentEpochEntry, err := bav.GetCurrentEpochEntry()
+		if err != nil {
+			return errors.Wrapf(err, "_updateValidatorPerformanceForBlock: Problem getting current epoch entry: ")
+		}
+		leaders, err := bav.GetCurrentSnapshotLeaderSchedule()
+		if err != nil {
+			return errors.Wrapf(err, "_updateValidatorPerformanceForBlock: Problem getting leader schedule: ")
+		}
+		if currentEpochEntry != nil && len(leaders) > 0 && header.Height >= currentEpochEntry.InitialBlockHeight {
+			heightDiff := header.Height - currentEpochEntry.InitialBlockHeight
+			// Views before the start of the epoch belong to the previous epoch's leader schedule.
+			firstTimedOutView := header.GetQC().GetView() + 1
+			if firstTimedOutView < currentEpochEntry.InitialView+heightDiff {
+				firstTimedOutView = currentEpochEntry.InitialView + heightDiff
+			}
+			if header.GetView() > firstTimedOutView {
+				numTimedOutViews := header.GetView() - firstTimedOutView
+				numLeaders := uint64(len(leaders))
+				firstLeaderIndex := currentEpochEntry.InitialLeaderIndexOffset +
+					(firstTimedOutView - currentEpochEntry.InitialView) - heightDiff
+				// Every leader misses numTimedOutViews / numLeaders slots, and the first
+				// numTimedOutViews % numLeaders after the first leader miss one more.
+				for ii := uint64(0); ii < numTimedOutViews && ii < numLeaders; ii++ {
+					numMissedSlots := numTimedOutViews / numLeaders
+					if ii < numTimedOutViews%numLeaders {
+						numMissedSlots++
+					}
+					getDelta(leaders[(firstLeaderIndex+ii)%numLeaders]).NumMissedLeaderSlots += numMissedSlots
+				}
+			}
+		}
+	}
+
+	for _, delta := range deltas {
+		if err := bav._applyValidatorPerformanceDelta(delta, isConnect); err != nil {
+			return errors.Wrapf(err, "_updateValidatorPerformanceForBlock: ")
+		}
+	}
+	return nil
+}
+
+// _applyValidatorPerformanceDelta adds the counts in delta to the validator's entry for the epoch, or subtracts
+// them if isConnect is false. Entries whose counts all drop to zero are deleted.
+func (bav *UtxoView) _applyValidatorPerformanceDelta(delta *ValidatorPerformanceEntry, isConnect bool) error {
+	prevEntry, err := bav.GetValidatorPerformanceEntry(delta.EpochNumber, delta.ValidatorPKID)
+	if err != nil {
+		return errors.Wrapf(err, "_applyValidatorPerformanceDelta: ")
+	}
+	entry := &ValidatorPerformanceEntry{EpochNumber: delta.EpochNumber, ValidatorPKID: delta.ValidatorPKID.NewPKID()}
+	if prevEntry != nil {
+		entry = prevEntry.Copy()
+	}
+
+	counts := []struct {
+		count *uint64
+		delta uint64
+	}{
+		{&entry.NumBlocksEligible, delta.NumBlocksEligible},
+		{&entry.NumVotesIncluded, delta.NumVotesIncluded},
+		{&entry.NumTimeoutsIncluded, delta.NumTimeoutsIncluded},
+		{&entry.NumBlocksProposed, delta.NumBlocksProposed},
+		{&entry.NumMissedLeaderSlots, delta.NumMissedLeaderSlots},
+	}
+	for _, count := range counts {
+		if isConnect {
+			*count.count, err = SafeUint64().Add(*count.count, count.delta)
+		} else {
+			*count.count, err = SafeUint64().Sub(*count.count, count.delta)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "_applyValidatorPerformanceDelta: Problem updating performance of validator %v "+
+				"in epoch %d", delta.ValidatorPKID, delta.EpochNumber)
+		}
+	}
+
+	if entry.isEmpty() {
+		bav._deleteValidatorPerformanceEntryMappings(entry)
+	} else {
+		bav._setValidatorPerformanceEntryMappings(entry)
+	}
+	return nil
+}
+
+func (bav *UtxoView) _flushValidatorPerformanceEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, entry := range bav.ValidatorPerformanceMapKeyToValidatorPerformanceEntry {
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushValidatorPerformanceEntriesToDbWithTxn: entry key %v doesn't match MapKey %v",
+				entry.ToMapKey(), mapKey,
+			)
+		}
+
+		// Delete the existing entry from the db, then put the entry if it isn't deleted.
+		if err := DBDeleteValidatorPerformanceEntryWithTxn(txn, bav.Snapshot, entry, bav.EventManager, entry.isDeleted); err != nil {
+			return errors.Wrapf(err, "_flushValidatorPerformanceEntriesToDbWithTxn: ")
+		}
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutValidatorPerformanceEntryWithTxn(txn, bav.Snapshot, entry, blockHeight, bav.EventManager); err != nil {
+			return errors.Wrapf(err, "_flushValidatorPerformanceEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/core/collections/bitset"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatorPerformance(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	params := &DeSoTestnetParams
+
+	// Three validators, sorted by PKID so that the per-epoch results come back in this order.
+	var validators []*ValidatorEntry
+	for ii := 0; ii < 3; ii++ {
+		validators = append(validators, &ValidatorEntry{
+			ValidatorPKID:   NewPKID(RandomBytes(int32(PublicKeyLenCompressed))),
+			VotingPublicKey: _generateRandomBLSPrivateKey(t).PublicKey(),
+		})
+	}
+	sort.Slice(validators, func(ii, jj int) bool {
+		return bytes.Compare(validators[ii].ValidatorPKID[:], validators[jj].ValidatorPKID[:]) < 0
+	})
+	v0, v1, v2 := validators[0].ValidatorPKID, validators[1].ValidatorPKID, validators[2].ValidatorPKID
+
+	// Epoch 5 starts at height 100 and view 100, and uses the leader schedule snapshotted at epoch 3.
+	newUtxoView := func() *UtxoView {
+		utxoView := NewUtxoView(db, params, nil, nil, nil)
+		utxoView._setCurrentEpochEntry(&EpochEntry{
+			EpochNumber:        5,
+			InitialBlockHeight: 100,
+			InitialView:        100,
+			FinalBlockHeight:   199,
+		})
+		for ii, validator := range validators {
+			utxoView._setSnapshotLeaderScheduleValidator(validator.ValidatorPKID, uint16(ii), 3)
+		}
+		utxoView.HasFullSnapshotLeaderScheduleByEpoch[3] = true
+		return utxoView
+	}
+	newSignature := func(signers ...int) *AggregatedBLSSignature {
+		signersList := bitset.NewBitset()
+		for _, signer := range signers {
+			signersList.Set(signer, true)
+		}
+		return &AggregatedBLSSignature{SignersList: signersList, Signature: &bls.Signature{}}
+	}
+
+	// The first block in the epoch has a QC signed by v0 and v1, and is proposed by v0.
+	voteBlockHeader := &MsgDeSoHeader{
+		Version:                 HeaderVersion2,
+		Height:                  100,
+		ProposedInView:          100,
+		ProposerVotingPublicKey: validators[0].VotingPublicKey,
+		ValidatorsVoteQC: &QuorumCertificate{
+			BlockHash:                         &BlockHash{},
+			ProposedInView:                    99,
+			ValidatorsVoteAggregatedSignature: newSignature(0, 1),
+		},
+	}
+	// The second block has a timeout QC signed by v0 and v2. Views 101 to 104 timed out, so the leaders
+	// v0, v1, v2, v0 missed their slots, and v1 proposed the block in view 105.
+	timeoutBlockHeader := &MsgDeSoHeader{
+		Version:                 HeaderVersion2,
+		Height:                  101,
+		ProposedInView:          105,
+		ProposerVotingPublicKey: validators[1].VotingPublicKey,
+		ValidatorsTimeoutAggregateQC: &TimeoutAggregateQuorumCertificate{
+			TimedOutView: 104,
+			ValidatorsHighQC: &QuorumCertificate{
+				BlockHash:                         &BlockHash{},
+				ProposedInView:                    100,
+				ValidatorsVoteAggregatedSignature: newSignature(0, 1),
+			},
+			ValidatorsTimeoutHighQCViews:         []uint64{100, 100},
+			ValidatorsTimeoutAggregatedSignature: newSignature(0, 2),
+		},
+	}
+
+	utxoView := newUtxoView()
+	require.NoError(utxoView._updateValidatorPerformanceForBlock(voteBlockHeader, validators, 5, true))
+	require.NoError(utxoView._updateValidatorPerformanceForBlock(timeoutBlockHeader, validators, 5, true))
+	require.NoError(utxoView.FlushToDb(101))
+
+	expectedEntries := []*ValidatorPerformanceEntry{
+		{
+			EpochNumber: 5, ValidatorPKID: v0, NumBlocksEligible: 2, NumVotesIncluded: 1, NumTimeoutsIncluded: 1,
+			NumBlocksProposed: 1, NumMissedLeaderSlots: 2,
+		},
+		{
+			EpochNumber: 5, ValidatorPKID: v1, NumBlocksEligible: 2, NumVotesIncluded: 1,
+			NumBlocksProposed: 1, NumMissedLeaderSlots: 1,
+		},
+		{
+			EpochNumber: 5, ValidatorPKID: v2, NumBlocksEligible: 2, NumTimeoutsIncluded: 1,
+			NumMissedLeaderSlots: 1,
+		},
+	}
+
+	// Query the flushed entries by epoch, with and without pagination.
+	utxoView = newUtxoView()
+	entries, err := utxoView.GetValidatorPerformanceEntriesForEpoch(5, nil, 0)
+	require.NoError(err)
+	require.Equal(expectedEntries, entries)
+	require.Equal([]uint64{10000, 5000, 5000}, []uint64{
+		entries[0].UptimeBasisPoints(), entries[1].UptimeBasisPoints(), entries[2].UptimeBasisPoints(),
+	})
+	firstPage, err := utxoView.GetValidatorPerformanceEntriesForEpoch(5, nil, 2)
+	require.NoError(err)
+	require.Equal(expectedEntries[:2], firstPage)
+	secondPage, err := utxoView.GetValidatorPerformanceEntriesForEpoch(5, firstPage[1], 2)
+	require.NoError(err)
+	require.Equal(expectedEntries[2:], secondPage)
+	entries, err = utxoView.GetValidatorPerformanceEntriesForEpoch(6, nil, 0)
+	require.NoError(err)
+	require.Empty(entries)
+
+	// Entries in the view are merged with the entries in the db.
+	epoch4Entry := &ValidatorPerformanceEntry{EpochNumber: 4, ValidatorPKID: v0, NumBlocksEligible: 1}
+	utxoView._setValidatorPerformanceEntryMappings(epoch4Entry)
+	entries, err = utxoView.GetValidatorPerformanceEntriesForValidator(v0, nil, 0)
+	require.NoError(err)
+	require.Equal([]*ValidatorPerformanceEntry{epoch4Entry, expectedEntries[0]}, entries)
+	entries, err = utxoView.GetValidatorPerformanceEntriesForValidator(v0, epoch4Entry, 0)
+	require.NoError(err)
+	require.Equal(expectedEntries[:1], entries)
+	entry, err := utxoView.GetValidatorPerformanceEntry(5, v2)
+	require.NoError(err)
+	require.Equal(expectedEntries[2], entry)
+	entry, err = utxoView.GetValidatorPerformanceEntry(4, v2)
+	require.NoError(err)
+	require.Nil(entry)
+
+	// Disconnecting the blocks in reverse order removes the entries.
+	utxoView = newUtxoView()
+	require.NoError(utxoView._updateValidatorPerformanceForBlock(timeoutBlockHeader, validators, 5, false))
+	entries, err = utxoView.GetValidatorPerformanceEntriesForEpoch(5, nil, 0)
+	require.NoError(err)
+	require.Equal([]*ValidatorPerformanceEntry{
+		{EpochNumber: 5, ValidatorPKID: v0, NumBlocksEligible: 1, NumVotesIncluded: 1, NumBlocksProposed: 1},
+		{EpochNumber: 5, ValidatorPKID: v1, NumBlocksEligible: 1, NumVotesIncluded: 1},
+		{EpochNumber: 5, ValidatorPKID: v2, NumBlocksEligible: 1},
+	}, entries)
+	require.NoError(utxoView._updateValidatorPerformanceForBlock(voteBlockHeader, validators, 5, false))
+	require.NoError(utxoView.FlushToDb(101))
+
+	entries, err = newUtxoView().GetValidatorPerformanceEntriesForEpoch(5, nil, 0)
+	require.NoError(err)
+	require.Empty(entries)
+	entries, err = newUtxoView().GetValidatorPerformanceEntriesForValidator(v0, nil, 0)
+	require.NoError(err)
+	require.Empty(entries)
+
+	// Disconnecting a block that was never connected fails instead of underflowing.
+	require.Error(newUtxoView()._updateValidatorPerformanceForBlock(voteBlockHeader, validators, 5, false))
+}
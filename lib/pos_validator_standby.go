@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/deso-protocol/go-deadlock"
+	"github.com/pkg/errors"
+)
+
+// Validator Standby
+//
+// A validator can run a hot standby: a second node started with the same BLS key that syncs the chain and runs the
+// consensus alongside the primary, but doesn't sign any vote, timeout, or block proposal. If the primary goes
+// silent, the standby takes over signing, so that the validator doesn't miss the rest of the epoch.
+//
+// The standby tracks the primary's liveness with heartbeats. A node that signs for its validator sends a
+// VALIDATOR_HEARTBEAT every validatorHeartbeatInterval to each peer that completed the handshake with the
+// validator's own BLS public key, which only a node holding the same key can do. The standby connects to the
+// primary, e.g. with --connect-ips, and takes over once it hasn't received a heartbeat for its takeover timeout
+// while its consensus is running.
+//
+// The primary and the standby share the validator's slashing protection database, e.g. on a network file system.
+// The standby opens it when it takes over, and consults it before signing anything, so that it never signs a
+// message that conflicts with one the primary signed. The database can only be opened by one process at a time,
+// which fences off the primary: the standby can't take over while the primary's process is still running, even if
+// the heartbeats stopped because the two nodes were partitioned, and a primary that's restarted after the standby
+// took over fails to start. Once a standby has taken over, it keeps signing until it's restarted.
+
+const (
+	// validatorHeartbeatInterval is how often a node that signs for its validator sends heartbeats to its standbys.
+	validatorHeartbeatInterval = time.Second
+
+	// DefaultValidatorStandbyTakeoverTimeoutSeconds is the default time without a heartbeat from the primary after
+	// which a standby takes over.
+	DefaultValidatorStandbyTakeoverTimeoutSeconds = 30
+
+	// minValidatorHeartbeatsPerTakeoverTimeout is the minimum number of heartbeats the primary sends during a
+	// standby's takeover timeout, so that a few delayed heartbeats don't make the standby take over.
+	minValidatorHeartbeatsPerTakeoverTimeout = 5
+)
+
+// ValidatorStandby tracks the liveness of the primary on a standby node, and takes over signing from it once it
+// goes silent.
+type ValidatorStandby struct {
+	mtx deadlock.Mutex
+
+	signer                       *BLSSigner
+	slashingProtectionDataDir    string
+	allowNewSlashingProtectionDB bool
+	takeoverTimeout              time.Duration
+
+	// lastHeartbeatTime is when we last received a heartbeat from the primary, or when the standby was created if
+	// we haven't received one yet.
+	lastHeartbeatTime time.Time
+	// slashingProtectionDB is opened when the standby takes over. It's nil until then.
+	slashingProtectionDB *SlashingProtectionDB
+	// isActive is set to 1 once the standby has taken over.
+	isActive int32
+}
+
+// NewValidatorStandby creates the standby of the validator with the signer's key. The slashing protection database
+// it shares with the primary is located in slashingProtectionDataDir. The signer must not have a slashing protection
+// database attached, since the standby attaches the shared one when it takes over.
+func NewValidatorStandby(signer *BLSSigner, slashingProtectionDataDir string, allowNewSlashingProtectionDB bool,
+	takeoverTimeout time.Duration, now time.Time) (*ValidatorStandby, error) {
+
+	if signer == nil {
+		return nil, errors.New("NewValidatorStandby: signer cannot be nil")
+	}
+	if signer.GetSlashingProtectionDB() != nil {
+		return nil, errors.New("NewValidatorStandby: signer already has a slashing protection database")
+	}
+	if takeoverTimeout < minValidatorHeartbeatsPerTakeoverTimeout*validatorHeartbeatInterval {
+		return nil, fmt.Errorf("NewValidatorStandby: Takeover timeout %v must be at least %v",
+			takeoverTimeout, minValidatorHeartbeatsPerTakeoverTimeout*validatorHeartbeatInterval)
+	}
+	return &ValidatorStandby{
+		signer:                       signer,
+		slashingProtectionDataDir:    slashingProtectionDataDir,
+		allowNewSlashingProtectionDB: allowNewSlashingProtectionDB,
+		takeoverTimeout:              takeoverTimeout,
+		lastHeartbeatTime:            now,
+	}, nil
+}
+
+// IsActive returns true once the standby has taken over signing from the primary.
+func (standby *ValidatorStandby) IsActive() bool {
+	return atomic.LoadInt32(&standby.isActive) == 1
+}
+
+// RecordHeartbeat records a heartbeat received from the primary.
+func (standby *ValidatorStandby) RecordHeartbeat(now time.Time) {
+	standby.mtx.Lock()
+	defer standby.mtx.Unlock()
+
+	if now.After(standby.lastHeartbeatTime) {
+		standby.lastHeartbeatTime = now
+	}
+}
+
+// MaybeTakeOver takes over signing from the primary if we haven't received a heartbeat from it for the takeover
+// timeout. Before the standby signs anything, it opens the slashing protection database it shares with the primary
+// and attaches it to the signer. If the database can't be opened, e.g. because the primary's process still holds
+// it, an error is returned and the standby stays inactive, so that MaybeTakeOver can be retried.
+func (standby *ValidatorStandby) MaybeTakeOver(now time.Time) (_tookOver bool, _err error) {
+	standby.mtx.Lock()
+	defer standby.mtx.Unlock()
+
+	if standby.IsActive() || now.Sub(standby.lastHeartbeatTime) < standby.takeoverTimeout {
+		return false, nil
+	}
+
+	slashingProtectionDB, err := OpenSlashingProtectionDB(
+		standby.slashingProtectionDataDir, standby.allowNewSlashingProtectionDB)
+	if err != nil {
+		return false, errors.Wrapf(err, "ValidatorStandby.MaybeTakeOver: Problem opening slashing protection database")
+	}
+	if err = standby.signer.SetSlashingProtectionDB(slashingProtectionDB); err != nil {
+		// Release the database so that the primary can open it if it comes back.
+		if closeErr := slashingProtectionDB.Close(); closeErr != nil {
+			err = errors.Wrapf(err, "also failed to close slashing protection database: %v", closeErr)
+		}
+		return false, errors.Wrapf(err, "ValidatorStandby.MaybeTakeOver: ")
+	}
+	standby.slashingProtectionDB = slashingProtectionDB
+	atomic.StoreInt32(&standby.isActive, 1)
+	return true, nil
+}
+
+// GetSlashingProtectionDB returns the slashing protection database the standby opened when it took over, or nil if
+// it hasn't taken over.
+func (standby *ValidatorStandby) GetSlashingProtectionDB() *SlashingProtectionDB {
+	standby.mtx.Lock()
+	defer standby.mtx.Unlock()
+	return standby.slashingProtectionDB
+}
+
+// ==================================================================
+// Heartbeat message
+// ==================================================================
+
+// MsgDeSoValidatorHeartbeat is sent by a node that signs for its validator to the standbys of the validator. It's
+// only accepted from a peer that completed the handshake with the receiver's own BLS public key, so it isn't signed.
+type MsgDeSoValidatorHeartbeat struct {
+	// TstampNanoSecs is when the heartbeat was sent, according to the sender's clock.
+	TstampNanoSecs uint64
+	// CurrentView is the sender's current consensus view.
+	CurrentView uint64
+}
+
+func (msg *MsgDeSoValidatorHeartbeat) GetMsgType() MsgType {
+	return MsgTypeValidatorHeartbeat
+}
+
+func (msg *MsgDeSoValidatorHeartbeat) ToBytes(preSignature bool) ([]byte, error) {
+	data := UintToBuf(msg.TstampNanoSecs)
+	data = append(data, UintToBuf(msg.CurrentView)...)
+	return data, nil
+}
+
+func (msg *MsgDeSoValidatorHeartbeat) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	tstampNanoSecs, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoValidatorHeartbeat.FromBytes: Problem reading TstampNanoSecs")
+	}
+	currentView, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoValidatorHeartbeat.FromBytes: Problem reading CurrentView")
+	}
+	*msg = MsgDeSoValidatorHeartbeat{TstampNanoSecs: tstampNanoSecs, CurrentView: currentView}
+	return nil
+}
+
+func (msg *MsgDeSoValidatorHeartbeat) String() string {
+	return fmt.Sprintf("TstampNanoSecs: %d, CurrentView: %d", msg.TstampNanoSecs, msg.CurrentView)
+}
+
+// ==================================================================
+// Server integration
+// ==================================================================
+
+// SetValidatorStandby makes the node a standby of its validator. It must be called before the Server is started.
+func (srv *Server) SetValidatorStandby(standby *ValidatorStandby) {
+	srv.validatorStandby = standby
+}
+
+// GetValidatorStandby returns the node's ValidatorStandby, or nil if the node isn't a standby.
+func (srv *Server) GetValidatorStandby() *ValidatorStandby {
+	return srv.validatorStandby
+}
+
+// _isSigningForValidator returns true if the node is a validator that signs votes, timeouts, and block proposals,
+// i.e. if it isn't a standby that has yet to take over.
+func (srv *Server) _isSigningForValidator() bool {
+	if srv.fastHotStuffConsensus == nil {
+		return false
+	}
+	return srv.validatorStandby == nil || srv.validatorStandby.IsActive()
+}
+
+// _startValidatorHeartbeats must be run inside a goroutine. Until the Server shuts down, it sends heartbeats to the
+// validator's standbys while the node signs for the validator, and takes over from the primary if the node is a
+// standby whose primary has gone silent.
+func (srv *Server) _startValidatorHeartbeats() {
+	if srv.fastHotStuffConsensus == nil {
+		return
+	}
+
+	for {
+		time.Sleep(validatorHeartbeatInterval)
+		if atomic.LoadInt32(&srv.shutdown) >= 1 {
+			break
+		}
+
+		if !srv._isSigningForValidator() {
+			srv._maybeTakeOverFromPrimary()
+			continue
+		}
+		srv._sendValidatorHeartbeats()
+	}
+}
+
+// _maybeTakeOverFromPrimary makes a standby take over signing if its primary has gone silent. A standby doesn't take
+// over until its consensus is running, since it can't sign anything useful before it has synced the chain.
+func (srv *Server) _maybeTakeOverFromPrimary() {
+	if !srv.fastHotStuffConsensus.IsRunning() {
+		return
+	}
+	tookOver, err := srv.validatorStandby.MaybeTakeOver(time.Now())
+	if err != nil {
+		srv.logger.Errorf("Server._maybeTakeOverFromPrimary: Primary is silent but standby can't take over yet: %v", err)
+		return
+	}
+	if tookOver {
+		srv.logger.Warningf(CLog(Yellow, "Server._maybeTakeOverFromPrimary: No heartbeat from the primary "+
+			"validator; standby has taken over signing"))
+	}
+}
+
+// _sendValidatorHeartbeats sends a heartbeat to each connected peer that completed the handshake with our own BLS
+// public key, i.e. to the validator's standbys.
+func (srv *Server) _sendValidatorHeartbeats() {
+	publicKey := srv.fastHotStuffConsensus.signer.GetPublicKey()
+	heartbeat := &MsgDeSoValidatorHeartbeat{
+		TstampNanoSecs: uint64(time.Now().UnixNano()),
+	}
+	if srv.fastHotStuffConsensus.IsRunning() {
+		heartbeat.CurrentView = srv.fastHotStuffConsensus.fastHotStuffEventLoop.GetCurrentView()
+	}
+	for _, rn := range srv.networkManager.GetAllRemoteNodes().GetAll() {
+		if !rn.IsHandshakeCompleted() || rn.GetValidatorPublicKey() == nil ||
+			!rn.GetValidatorPublicKey().Eq(publicKey) {
+			continue
+		}
+		if err := srv.networkManager.SendMessage(rn, heartbeat); err != nil {
+			srv.logger.V(1).Infof("Server._sendValidatorHeartbeats: Problem sending heartbeat to %v: %v", rn, err)
+		}
+	}
+}
+
+func (srv *Server) _handleValidatorHeartbeat(pp *Peer, msg *MsgDeSoValidatorHeartbeat) {
+	if srv.fastHotStuffConsensus == nil {
+		return
+	}
+	rn := srv.networkManager.GetRemoteNodeFromPeer(pp)
+	if rn == nil || rn.GetValidatorPublicKey() == nil ||
+		!rn.GetValidatorPublicKey().Eq(srv.fastHotStuffConsensus.signer.GetPublicKey()) {
+		srv.logger.V(1).Infof("Server._handleValidatorHeartbeat: Ignoring heartbeat from peer %v that "+
+			"doesn't hold our validator key", pp)
+		return
+	}
+
+	// If we're signing too, then two nodes are signing for the validator at once. The slashing protection database
+	// keeps a standby from taking over while its primary holds it, so this means the two nodes don't share it.
+	if srv._isSigningForValidator() {
+		srv.logger.Errorf(CLog(Red, fmt.Sprintf("Server._handleValidatorHeartbeat: Peer %v is also signing for "+
+			"our validator (%v). Make sure the nodes share the slashing protection database.", pp, msg)))
+		return
+	}
+	srv.validatorStandby.RecordHeartbeat(time.Now())
+}
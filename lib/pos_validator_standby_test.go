@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatorStandby(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := os.MkdirTemp("", "badgerdb-validator-standby")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	blsPrivateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	signer, err := NewBLSSigner(blsPrivateKey)
+	require.NoError(err)
+
+	// The takeover timeout has to leave room for a few missed heartbeats.
+	startTime := time.Unix(1700000000, 0)
+	_, err = NewValidatorStandby(signer, dir, false, validatorHeartbeatInterval, startTime)
+	require.Error(err)
+
+	takeoverTimeout := 10 * time.Second
+	standby, err := NewValidatorStandby(signer, dir, false, takeoverTimeout, startTime)
+	require.NoError(err)
+	require.False(standby.IsActive())
+
+	// The standby doesn't take over while it receives heartbeats from the primary.
+	tookOver, err := standby.MaybeTakeOver(startTime.Add(takeoverTimeout - time.Second))
+	require.NoError(err)
+	require.False(tookOver)
+	standby.RecordHeartbeat(startTime.Add(takeoverTimeout - time.Second))
+	tookOver, err = standby.MaybeTakeOver(startTime.Add(takeoverTimeout + time.Second))
+	require.NoError(err)
+	require.False(tookOver)
+
+	// Once the primary goes silent, the standby can't take over without the primary's slashing protection database.
+	silentTime := startTime.Add(3 * takeoverTimeout)
+	_, err = standby.MaybeTakeOver(silentTime)
+	require.Error(err)
+	require.False(standby.IsActive())
+
+	// Nor can it take over while the primary holds the database.
+	primarySlashingProtectionDB, err := OpenSlashingProtectionDB(dir, true)
+	require.NoError(err)
+	blockHash := NewBlockHash(RandomBytes(32))
+	require.NoError(primarySlashingProtectionDB.CheckAndRecordVote(5, blockHash))
+	_, err = standby.MaybeTakeOver(silentTime)
+	require.Error(err)
+	require.False(standby.IsActive())
+	require.Nil(signer.GetSlashingProtectionDB())
+
+	// Once the primary releases the database, the standby takes over and signs consistently with the primary.
+	require.NoError(primarySlashingProtectionDB.Close())
+	tookOver, err = standby.MaybeTakeOver(silentTime)
+	require.NoError(err)
+	require.True(tookOver)
+	require.True(standby.IsActive())
+	require.Equal(standby.GetSlashingProtectionDB(), signer.GetSlashingProtectionDB())
+	_, err = signer.SignValidatorVote(5, NewBlockHash(RandomBytes(32)))
+	require.Error(err)
+	_, err = signer.SignValidatorVote(5, blockHash)
+	require.NoError(err)
+
+	// Taking over is one-way.
+	tookOver, err = standby.MaybeTakeOver(silentTime.Add(takeoverTimeout))
+	require.NoError(err)
+	require.False(tookOver)
+	require.NoError(standby.GetSlashingProtectionDB().Close())
+}
+
+func TestValidatorHeartbeatMessage(t *testing.T) {
+	require := require.New(t)
+
+	heartbeat := &MsgDeSoValidatorHeartbeat{
+		TstampNanoSecs: uint64(time.Now().UnixNano()),
+		CurrentView:    12345,
+	}
+	heartbeatBytes, err := heartbeat.ToBytes(false)
+	require.NoError(err)
+	decodedHeartbeat := NewMessage(MsgTypeValidatorHeartbeat)
+	require.NoError(decodedHeartbeat.FromBytes(heartbeatBytes))
+	require.Equal(heartbeat, decodedHeartbeat)
+	require.Equal(MessageLaneConsensus, GetMessageLane(MsgTypeValidatorHeartbeat))
+}
@@ -3403,6 +3403,24 @@ func (postgres *Postgres) GetPostsForPublicKey(publicKey []byte, startTime uint6
 	return posts
 }
 
+// GetTopPostsByTimestamp serves the QueryPushdownBackend. It returns the newest top-level posts with a
+// timestamp below maxTimestampNanos, newest first.
+func (postgres *Postgres) GetTopPostsByTimestamp(maxTimestampNanos uint64, limit int) ([]*PostEntry, error) {
+	var posts []*PGPost
+	err := postgres.db.Model(&posts).
+		Where("timestamp < ?", maxTimestampNanos).
+		Where("hidden IS NOT TRUE").Where("parent_post_hash IS NULL").
+		OrderExpr("timestamp DESC, post_hash DESC").Limit(limit).Select()
+	if err != nil {
+		return nil, err
+	}
+	var postEntries []*PostEntry
+	for _, post := range posts {
+		postEntries = append(postEntries, post.NewPostEntry())
+	}
+	return postEntries, nil
+}
+
 //
 // Comments
 //
@@ -3501,6 +3519,33 @@ func (postgres *Postgres) GetFollowers(pkid *PKID) []*PGFollow {
 	return follows
 }
 
+// GetFollowersPaginated returns up to limit follows of pkid, ordered by follower PKID, with follower PKIDs greater
+// than startFollowerPKID. A nil startFollowerPKID starts from the first follower.
+func (postgres *Postgres) GetFollowersPaginated(pkid *PKID, startFollowerPKID *PKID, limit uint32) ([]*PGFollow, error) {
+	var follows []*PGFollow
+	query := postgres.db.Model(&follows).Where("followed_pkid = ?", pkid)
+	if startFollowerPKID != nil {
+		query = query.Where("follower_pkid > ?", startFollowerPKID)
+	}
+	if err := query.Order("follower_pkid ASC").Limit(int(limit)).Select(); err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+// GetFollowCounts returns the number of PKIDs that follow pkid and the number of PKIDs that pkid follows.
+func (postgres *Postgres) GetFollowCounts(pkid *PKID) (_followerCount uint64, _followingCount uint64, _err error) {
+	followerCount, err := postgres.db.Model((*PGFollow)(nil)).Where("followed_pkid = ?", pkid).Count()
+	if err != nil {
+		return 0, 0, err
+	}
+	followingCount, err := postgres.db.Model((*PGFollow)(nil)).Where("follower_pkid = ?", pkid).Count()
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(followerCount), uint64(followingCount), nil
+}
+
 func (postgres *Postgres) GetDiamond(senderPkid *PKID, receiverPkid *PKID, postHash *BlockHash) *PGDiamond {
 	diamond := PGDiamond{
 		SenderPKID:      senderPkid,
@@ -3560,6 +3605,38 @@ func (postgres *Postgres) GetCreatorCoinHolders(pkid *PKID) []*PGCreatorCoinBala
 	return holdings
 }
 
+// GetTopHoldersByBalance serves the QueryPushdownBackend. It returns the holders of the creator's coins
+// with a non-zero balance, largest balance first.
+func (postgres *Postgres) GetTopHoldersByBalance(creatorPkid *PKID, isDAOCoin bool, limit int) ([]*BalanceEntry, error) {
+	var balanceEntries []*BalanceEntry
+	if isDAOCoin {
+		// DAO coin balances are stored as hex strings without leading zeros, so a longer string is
+		// always a larger balance.
+		var holders []*PGDAOCoinBalance
+		err := postgres.db.Model(&holders).
+			Where("creator_pkid = ?", creatorPkid).Where("balance_nanos != '0x0'").
+			OrderExpr("length(balance_nanos) DESC, balance_nanos DESC, holder_pkid ASC").Limit(limit).Select()
+		if err != nil {
+			return nil, err
+		}
+		for _, holder := range holders {
+			balanceEntries = append(balanceEntries, holder.NewBalanceEntry())
+		}
+	} else {
+		var holders []*PGCreatorCoinBalance
+		err := postgres.db.Model(&holders).
+			Where("creator_pkid = ?", creatorPkid).Where("balance_nanos > 0").
+			OrderExpr("balance_nanos DESC, holder_pkid ASC").Limit(limit).Select()
+		if err != nil {
+			return nil, err
+		}
+		for _, holder := range holders {
+			balanceEntries = append(balanceEntries, holder.NewBalanceEntry())
+		}
+	}
+	return balanceEntries, nil
+}
+
 //
 // DAO Coins
 //
@@ -3680,6 +3757,38 @@ func (postgres *Postgres) GetAllDAOCoinLimitOrdersForThisDAOCoinPair(
 	return outputOrders, nil
 }
 
+// GetDAOCoinLimitOrdersByPrice serves the QueryPushdownBackend. It returns the orders for the DAO coin
+// pair, best-priced first.
+func (postgres *Postgres) GetDAOCoinLimitOrdersByPrice(
+	buyingDAOCoinCreatorPKID *PKID, sellingDAOCoinCreatorPKID *PKID, limit int) ([]*DAOCoinLimitOrderEntry, error) {
+
+	var orders []*PGDAOCoinLimitOrder
+
+	// Exchange rates are left-padded to 32 hex characters but can be up to 64 characters long, so we
+	// compare their lengths before comparing them as strings.
+	err := postgres.db.Model(&orders).
+		Where("buying_dao_coin_creator_pkid = ?", buyingDAOCoinCreatorPKID).
+		Where("selling_dao_coin_creator_pkid = ?", sellingDAOCoinCreatorPKID).
+		OrderExpr("length(scaled_exchange_rate_coins_to_sell_per_coin_to_buy) DESC").
+		Order("scaled_exchange_rate_coins_to_sell_per_coin_to_buy DESC"). // Best-priced first
+		Order("block_height ASC").                                        // Then oldest first (FIFO)
+		Order("order_id DESC").                                           // Then match BadgerDB ordering
+		Limit(limit).
+		Select()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var outputOrders []*DAOCoinLimitOrderEntry
+
+	for _, order := range orders {
+		outputOrders = append(outputOrders, order.ToDAOCoinLimitOrderEntry())
+	}
+
+	return outputOrders, nil
+}
+
 func (postgres *Postgres) GetAllDAOCoinLimitOrdersForThisTransactor(transactorPKID *PKID) ([]*DAOCoinLimitOrderEntry, error) {
 	var orders []*PGDAOCoinLimitOrder
 
@@ -4332,6 +4441,55 @@ func (postgres *Postgres) GetPostAssociationByAttributes(associationEntry *PostA
 	return pgAssociation.ToPostAssociationEntry(), nil
 }
 
+// GetPostAssociationCount returns the number of associations on the post with the AssociationType and the
+// AssociationValue.
+func (postgres *Postgres) GetPostAssociationCount(
+	postHash *BlockHash, associationType []byte, associationValue []byte,
+) (uint64, error) {
+	count, err := postgres.db.Model((*PGPostAssociation)(nil)).
+		Where("post_hash = ?", postHash).
+		Where("LOWER(association_type) = ?", string(bytes.ToLower(associationType))).
+		Where("association_value = ?", string(associationValue)).
+		Count()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(count), nil
+}
+
+// GetPostAssociationCounts returns the number of associations on the post with each AssociationType and
+// AssociationValue. If associationType isn't empty, only the counts with that AssociationType are returned.
+func (postgres *Postgres) GetPostAssociationCounts(
+	postHash *BlockHash, associationType []byte,
+) ([]*PostAssociationCountEntry, error) {
+	var rows []struct {
+		AssociationType  string
+		AssociationValue string
+		Count            uint64
+	}
+	query := postgres.db.Model((*PGPostAssociation)(nil)).
+		ColumnExpr("LOWER(association_type) AS association_type").
+		ColumnExpr("association_value").
+		ColumnExpr("COUNT(*) AS count").
+		Where("post_hash = ?", postHash)
+	if len(associationType) > 0 {
+		query = query.Where("LOWER(association_type) = ?", string(bytes.ToLower(associationType)))
+	}
+	if err := query.GroupExpr("LOWER(association_type), association_value").Select(&rows); err != nil {
+		return nil, err
+	}
+	var countEntries []*PostAssociationCountEntry
+	for _, row := range rows {
+		countEntries = append(countEntries, &PostAssociationCountEntry{
+			PostHash:         postHash.NewBlockHash(),
+			AssociationType:  []byte(row.AssociationType),
+			AssociationValue: []byte(row.AssociationValue),
+			Count:            row.Count,
+		})
+	}
+	return countEntries, nil
+}
+
 func (postgres *Postgres) GetUserAssociationsByAttributes(
 	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
 ) ([]*UserAssociationEntry, []byte, error) {
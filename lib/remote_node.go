@@ -9,7 +9,6 @@ import (
 
 	"github.com/btcsuite/btcd/wire"
 	"github.com/deso-protocol/core/bls"
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/sha3"
 )
@@ -122,6 +121,9 @@ type RemoteNode struct {
 	// verackTimeExpected is the latest time by which we expect to receive a Verack message from the peer.
 	// If the Verack message is not received by this time, the connection will be terminated.
 	verackTimeExpected *time.Time
+
+	// logger is the NetworkManager's logger, with the RemoteNode's id added to every message.
+	logger Logger
 }
 
 // HandshakeMetadata stores the information received from the peer during the Version and Verack exchange.
@@ -168,6 +170,7 @@ func NewRemoteNode(
 	minTxFeeRateNanosPerKB uint64,
 	latestBlockHeight uint64,
 	nodeServices ServiceFlag,
+	logger Logger,
 ) *RemoteNode {
 	return &RemoteNode{
 		id:                     id,
@@ -183,6 +186,7 @@ func NewRemoteNode(
 		minTxFeeRateNanosPerKB: minTxFeeRateNanosPerKB,
 		latestBlockHeight:      latestBlockHeight,
 		nodeServices:           nodeServices,
+		logger:                 logger,
 	}
 }
 
@@ -393,7 +397,7 @@ func (rn *RemoteNode) Disconnect(disconnectReason string) {
 	if rn.connectionStatus == RemoteNodeStatus_Terminated {
 		return
 	}
-	glog.V(2).Infof("RemoteNode.Disconnect: Disconnecting from peer (id= %d, status= %v)",
+	rn.logger.V(2).Infof("RemoteNode.Disconnect: Disconnecting from peer (id= %d, status= %v)",
 		rn.id, rn.connectionStatus)
 
 	id := rn.GetId().ToUint64()
@@ -770,7 +774,7 @@ func (rn *RemoteNode) _logVersionSuccess() {
 		persistentStr = "NON-PERSISTENT"
 	}
 	logStr := fmt.Sprintf("SUCCESS version negotiation for (%s) (%s) id=(%v).", inboundStr, persistentStr, rn.id.ToUint64())
-	glog.V(1).Info(logStr)
+	rn.logger.V(1).Info(logStr)
 }
 
 func GetVerackHandshakePayload(nonceReceived uint64, nonceSent uint64, tstampMicro uint64) [32]byte {
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Reorg Guard
+//
+// Exchanges credit deposits once they have enough confirmations, so a deep reorg can undo deposits they've
+// already credited. The reorg guard is a safety valve for them: when the node is started with a max reorg depth,
+// a PoW reorg that would disconnect more than that many blocks isn't applied automatically. Instead, the fork's
+// blocks are stored without being connected, and the reorg is held as the pending reorg until the operator looks
+// into it and approves it with ApprovePendingReorg, e.g. through the admin RPC.
+//
+// PoS blocks don't need the guard. Once a PoS block is committed according to the Fast HotStuff commit rule, the
+// chain never reorgs past it, so committed PoS blocks are final. GetBlockConfirmationStatus reports whether a
+// block is final under these rules, which is what an exchange should wait for before crediting a deposit.
+
+// PendingReorg describes a reorg that was held because it was deeper than the max reorg depth.
+type PendingReorg struct {
+	// ForkTipHashHex is the hash of the highest block on the fork that the reorg would switch to.
+	ForkTipHashHex string
+	ForkTipHeight  uint64
+	// CommonAncestorHashHex is the hash of the last block that the fork and the main chain have in common.
+	CommonAncestorHashHex string
+	CommonAncestorHeight  uint64
+	CurrentTipHashHex     string
+	CurrentTipHeight      uint64
+	// Depth is the number of main chain blocks that the reorg would disconnect.
+	Depth uint64
+}
+
+// BlockConfirmationStatus describes how settled a block is.
+type BlockConfirmationStatus struct {
+	BlockHashHex string
+	Height       uint64
+	IsMainChain  bool
+	// Confirmations is the number of main chain blocks from the block to the tip, counting the block itself. It's
+	// zero for blocks that aren't on the main chain.
+	Confirmations uint64
+	// IsCommitted is set for PoS blocks that have been committed according to the Fast HotStuff commit rule.
+	IsCommitted bool
+	// IsFinal is set for blocks that the chain won't reorg past without operator approval: committed PoS blocks,
+	// PoW blocks once the chain has committed a PoS block, and PoW blocks with more confirmations than the max
+	// reorg depth.
+	IsFinal bool
+}
+
+// SetMaxReorgDepth sets the deepest PoW reorg that is applied without operator approval. A max reorg depth of
+// zero means reorgs of any depth are applied.
+func (bc *Blockchain) SetMaxReorgDepth(maxReorgDepth uint64) {
+	bc.ChainLock.Lock()
+	defer bc.ChainLock.Unlock()
+	bc.maxReorgDepth = maxReorgDepth
+}
+
+// GetPendingReorg returns the reorg that is waiting for operator approval, or nil if there is none.
+func (bc *Blockchain) GetPendingReorg() *PendingReorg {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+	if bc.pendingReorg == nil {
+		return nil
+	}
+	pendingReorg := *bc.pendingReorg
+	return &pendingReorg
+}
+
+// ApprovePendingReorg applies the pending reorg, which must switch to the fork with the given tip. The tip is
+// checked so that the operator can't approve a different reorg than the one they looked into. Blocks that extend
+// the approved fork are also applied, so the approval holds until the node switches to the fork.
+func (bc *Blockchain) ApprovePendingReorg(forkTipHash *BlockHash) error {
+	bc.ChainLock.Lock()
+	if bc.pendingReorg == nil {
+		bc.ChainLock.Unlock()
+		return fmt.Errorf("ApprovePendingReorg: There is no pending reorg")
+	}
+	if bc.pendingReorg.ForkTipHashHex != forkTipHash.String() {
+		pendingForkTipHashHex := bc.pendingReorg.ForkTipHashHex
+		bc.ChainLock.Unlock()
+		return fmt.Errorf("ApprovePendingReorg: The pending reorg is to fork tip %v, not %v",
+			pendingForkTipHashHex, forkTipHash)
+	}
+	bc.approvedReorgTipHash = forkTipHash.NewBlockHash()
+	bc.ChainLock.Unlock()
+
+	// The fork tip was stored but not connected when the reorg was held, so processing it again applies the reorg.
+	forkTip, err := GetBlock(forkTipHash, bc.db, bc.snapshot)
+	if err != nil {
+		return errors.Wrapf(err, "ApprovePendingReorg: Problem fetching fork tip %v", forkTipHash)
+	}
+	isMainChain, _, _, err := bc.ProcessBlock(forkTip, true /*verifySignatures*/)
+	if err != nil {
+		return errors.Wrapf(err, "ApprovePendingReorg: Problem applying reorg to fork tip %v", forkTipHash)
+	}
+	if !isMainChain {
+		return fmt.Errorf("ApprovePendingReorg: Fork tip %v is not on the main chain after the reorg", forkTipHash)
+	}
+	glog.Infof("ApprovePendingReorg: Applied approved reorg to fork tip %v", forkTipHash)
+	return nil
+}
+
+// holdReorgForApproval returns true if the reorg from the current tip to the new tip is deeper than the max reorg
+// depth and hasn't been approved, in which case it's recorded as the pending reorg. It also clears the approval
+// once an approved reorg goes through. It must be called with the ChainLock held.
+func (bc *Blockchain) holdReorgForApproval(currentTip *BlockNode, newTip *BlockNode) bool {
+	if bc.maxReorgDepth == 0 {
+		return false
+	}
+	commonAncestor, _, attachBlocks := GetReorgBlocks(currentTip, newTip)
+	depth := uint64(currentTip.Height - commonAncestor.Height)
+	if depth <= bc.maxReorgDepth {
+		return false
+	}
+	if bc.approvedReorgTipHash != nil {
+		for _, attachBlock := range attachBlocks {
+			if attachBlock.Hash.IsEqual(bc.approvedReorgTipHash) {
+				bc.approvedReorgTipHash = nil
+				bc.pendingReorg = nil
+				return false
+			}
+		}
+	}
+
+	bc.pendingReorg = &PendingReorg{
+		ForkTipHashHex:        newTip.Hash.String(),
+		ForkTipHeight:         uint64(newTip.Height),
+		CommonAncestorHashHex: commonAncestor.Hash.String(),
+		CommonAncestorHeight:  uint64(commonAncestor.Height),
+		CurrentTipHashHex:     currentTip.Hash.String(),
+		CurrentTipHeight:      uint64(currentTip.Height),
+		Depth:                 depth,
+	}
+	glog.Errorf("holdReorgForApproval: Holding reorg of %d blocks from tip %v at height %d to fork tip %v at "+
+		"height %d, which is deeper than the max reorg depth of %d. The reorg won't be applied until it's approved "+
+		"by the operator.", depth, currentTip.Hash, currentTip.Height, newTip.Hash, newTip.Height, bc.maxReorgDepth)
+	return true
+}
+
+// GetBlockConfirmationStatus returns the confirmation status of the block with the given hash.
+func (bc *Blockchain) GetBlockConfirmationStatus(blockHash *BlockHash) (*BlockConfirmationStatus, error) {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	blockNode, exists := bc.blockIndexByHash.Get(*blockHash)
+	if !exists {
+		return nil, fmt.Errorf("GetBlockConfirmationStatus: Block %v not found", blockHash)
+	}
+	status := &BlockConfirmationStatus{
+		BlockHashHex: blockHash.String(),
+		Height:       uint64(blockNode.Height),
+	}
+	if _, status.IsMainChain = bc.bestChainMap[*blockHash]; !status.IsMainChain {
+		return status, nil
+	}
+	tip := bc.blockTip()
+	status.Confirmations = uint64(tip.Height-blockNode.Height) + 1
+
+	if bc.params.IsPoSBlockHeight(uint64(blockNode.Height)) {
+		status.IsCommitted = blockNode.Status&StatusBlockCommitted != 0
+		status.IsFinal = status.IsCommitted
+		return status, nil
+	}
+	// Once a PoS block is committed, none of the PoW blocks before it can be reorged.
+	committedTip, _ := bc.GetCommittedTip()
+	if committedTip != nil && bc.params.IsPoSBlockHeight(uint64(committedTip.Height)) {
+		status.IsFinal = true
+		return status, nil
+	}
+	// A reorg that disconnects the block disconnects at least as many blocks as the block has confirmations.
+	status.IsFinal = bc.maxReorgDepth > 0 && status.Confirmations > bc.maxReorgDepth
+	return status, nil
+}
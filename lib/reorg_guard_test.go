@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgGuard(t *testing.T) {
+	require := require.New(t)
+	setupTestDeSoEncoder(t)
+
+	params := NewTestParams(&DeSoTestnetParams)
+	sim, err := NewReorgSimulator(&params, []string{senderPkString})
+	require.NoError(err)
+	defer sim.Stop()
+
+	mainNode, err := sim.NewNode()
+	require.NoError(err)
+	_, err = mainNode.MineBlocks(6, nil)
+	require.NoError(err)
+	mainNode.Chain.SetMaxReorgDepth(2)
+	mainTip := mainNode.Chain.BlockTip()
+
+	// Blocks deeper than the max reorg depth are final, the others aren't.
+	status, err := mainNode.Chain.GetBlockConfirmationStatus(mainTip.Hash)
+	require.NoError(err)
+	require.Equal(&BlockConfirmationStatus{
+		BlockHashHex: mainTip.Hash.String(), Height: 6, IsMainChain: true, Confirmations: 1,
+	}, status)
+	status, err = mainNode.Chain.GetBlockConfirmationStatus(mainNode.Chain.bestChain[4].Hash)
+	require.NoError(err)
+	require.Equal(uint64(3), status.Confirmations)
+	require.True(status.IsFinal)
+	_, err = mainNode.Chain.GetBlockConfirmationStatus(NewBlockHash(RandomBytes(HashSizeBytes)))
+	require.Error(err)
+
+	// A reorg of two blocks is applied.
+	shallowBranch, err := sim.BuildBranch(mainNode, 4, 3, nil)
+	require.NoError(err)
+	require.NoError(sim.Reorg(mainNode, shallowBranch))
+	require.Nil(mainNode.Chain.GetPendingReorg())
+	status, err = mainNode.Chain.GetBlockConfirmationStatus(mainTip.Hash)
+	require.NoError(err)
+	require.False(status.IsMainChain)
+	require.Zero(status.Confirmations)
+
+	// A reorg of four blocks is held, even as the fork grows.
+	mainTip = mainNode.Chain.BlockTip()
+	deepBranch, err := sim.BuildBranch(mainNode, 3, 6, nil)
+	require.NoError(err)
+	require.Error(sim.Reorg(mainNode, deepBranch))
+	require.True(mainNode.Chain.BlockTip().Hash.IsEqual(mainTip.Hash))
+	pendingReorg := mainNode.Chain.GetPendingReorg()
+	require.NotNil(pendingReorg)
+	forkTipHash, err := deepBranch.Blocks[len(deepBranch.Blocks)-1].Hash()
+	require.NoError(err)
+	require.Equal(&PendingReorg{
+		ForkTipHashHex:        forkTipHash.String(),
+		ForkTipHeight:         9,
+		CommonAncestorHashHex: mainNode.Chain.bestChain[3].Hash.String(),
+		CommonAncestorHeight:  3,
+		CurrentTipHashHex:     mainTip.Hash.String(),
+		CurrentTipHeight:      7,
+		Depth:                 4,
+	}, pendingReorg)
+
+	// Only the pending reorg can be approved, and approving it applies it.
+	require.Error(mainNode.Chain.ApprovePendingReorg(mainTip.Hash))
+	require.NoError(mainNode.Chain.ApprovePendingReorg(forkTipHash))
+	require.True(mainNode.Chain.BlockTip().Hash.IsEqual(forkTipHash))
+	require.Nil(mainNode.Chain.GetPendingReorg())
+	require.NoError(CompareChainStates(mainNode.Chain, deepBranch.Node.Chain))
+	require.Error(mainNode.Chain.ApprovePendingReorg(forkTipHash))
+}
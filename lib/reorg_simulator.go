@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	chainlib "github.com/btcsuite/btcd/blockchain"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// Reorg Simulator
+//
+// The ReorgSimulator makes it easy to test how a chain, and anything built on top of it, handles reorgs. It runs
+// any number of in-memory PoW nodes that share the same params. A test can mine a main chain on one node, then
+// build a competing branch that forks off of it at some height with BuildBranch, and feed the branch to the
+// first node with Reorg. Since the branch is mined on a fresh node that never saw the blocks it replaces, the
+// state of that node is what the reorged node should converge to, and CompareChainStates checks that the two
+// match.
+//
+// The params must have a difficulty that's low enough to mine blocks quickly, like the regtest params. The
+// simulator is meant for tests and devnets, and it exports everything that embedders need to test their own
+// reorg handling. Blocks are built from the mempool's read-only view, so callers that add txns from a hook should
+// set ReadOnlyUtxoViewRegenerationIntervalTxns to 1 for the txns to land in the next block.
+
+// ReorgSimulatorNode is an in-memory chain with its own mempool and miner.
+type ReorgSimulatorNode struct {
+	Chain   *Blockchain
+	Mempool *DeSoMempool
+	Miner   *DeSoMiner
+
+	db            *badger.DB
+	blockProducer *DeSoBlockProducer
+}
+
+// ReorgSimulatorBranch is a branch built by BuildBranch. Node is the node the branch was mined on, and Blocks are
+// the blocks of the branch after the fork point.
+type ReorgSimulatorBranch struct {
+	Node   *ReorgSimulatorNode
+	Blocks []*MsgDeSoBlock
+}
+
+type ReorgSimulator struct {
+	params          *DeSoParams
+	minerPublicKeys []string
+	nodes           []*ReorgSimulatorNode
+}
+
+// NewReorgSimulator creates a ReorgSimulator whose nodes use the params and pay their block rewards to the miner
+// public keys, which must be Base58Check encoded.
+func NewReorgSimulator(params *DeSoParams, minerPublicKeys []string) (*ReorgSimulator, error) {
+	if params == nil {
+		return nil, fmt.Errorf("NewReorgSimulator: Params must be set")
+	}
+	if len(minerPublicKeys) == 0 {
+		return nil, fmt.Errorf("NewReorgSimulator: Must have at least one miner public key")
+	}
+	return &ReorgSimulator{
+		params:          params,
+		minerPublicKeys: minerPublicKeys,
+	}, nil
+}
+
+// NewNode creates a node that only has the genesis block. The node is stopped by Stop.
+func (sim *ReorgSimulator) NewNode() (*ReorgSimulatorNode, error) {
+	opts := DefaultBadgerOptions("").WithInMemory(true)
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.NewNode: Problem opening db")
+	}
+	node := &ReorgSimulatorNode{db: db}
+	// Track the node right away so that Stop cleans it up even if we fail below.
+	sim.nodes = append(sim.nodes, node)
+
+	eventManager := NewEventManager()
+	node.Chain, err = NewBlockchain(nil, 0, 0, sim.params, chainlib.NewMedianTime(), db,
+		nil, eventManager, nil, false, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.NewNode: Problem creating blockchain")
+	}
+	node.Mempool = NewDeSoMempool(node.Chain, 0, /* rateLimitFeeRateNanosPerKB */
+		0 /* minFeeRateNanosPerKB */, "", true, "" /*dataDir*/, "", true)
+	// Keep the mempool in sync with the chain the same way the Server does, so that it follows reorgs too.
+	eventManager.OnBlockConnected(func(event *BlockEvent) {
+		node.Mempool.UpdateAfterConnectBlock(event.Block)
+	})
+	eventManager.OnBlockDisconnected(func(event *BlockEvent) {
+		node.Mempool.UpdateAfterDisconnectBlock(event.Block)
+	})
+	node.blockProducer, err = NewDeSoBlockProducer(0, 10, "", node.Mempool, node.Chain,
+		sim.params, nil, nil, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.NewNode: Problem creating block producer")
+	}
+	node.Miner, err = NewDeSoMiner(sim.minerPublicKeys, 1 /*numThreads*/, node.blockProducer, sim.params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.NewNode: Problem creating miner")
+	}
+	return node, nil
+}
+
+// BuildBranch creates a node that has the base node's best chain up to and including the fork height, and mines
+// depth blocks on top of it. The hook, if set, is called before each block is mined, so that it can add txns to
+// the branch node's mempool. To replace the base node's chain, the branch has to end up with more work than it,
+// which for low difficulty params means it has to be longer.
+func (sim *ReorgSimulator) BuildBranch(base *ReorgSimulatorNode, forkHeight uint64, depth int,
+	beforeEachBlock func(branchNode *ReorgSimulatorNode, blockIndex int) error) (*ReorgSimulatorBranch, error) {
+
+	forkBlocks, err := base.GetBestChainBlocks(1, forkHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.BuildBranch: Problem getting blocks before the fork")
+	}
+	branchNode, err := sim.NewNode()
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.BuildBranch: ")
+	}
+	if err = branchNode.ProcessBlocks(forkBlocks); err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.BuildBranch: Problem processing blocks before the fork")
+	}
+	branchBlocks, err := branchNode.MineBlocks(depth, beforeEachBlock)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReorgSimulator.BuildBranch: Problem mining branch")
+	}
+	return &ReorgSimulatorBranch{
+		Node:   branchNode,
+		Blocks: branchBlocks,
+	}, nil
+}
+
+// Reorg feeds the branch's blocks to the target node and checks that the target's tip is now the tip of the
+// branch.
+func (sim *ReorgSimulator) Reorg(target *ReorgSimulatorNode, branch *ReorgSimulatorBranch) error {
+	if len(branch.Blocks) == 0 {
+		return fmt.Errorf("ReorgSimulator.Reorg: Branch has no blocks")
+	}
+	if err := target.ProcessBlocks(branch.Blocks); err != nil {
+		return errors.Wrapf(err, "ReorgSimulator.Reorg: ")
+	}
+	branchTipHash, err := branch.Blocks[len(branch.Blocks)-1].Hash()
+	if err != nil {
+		return errors.Wrapf(err, "ReorgSimulator.Reorg: Problem hashing branch tip")
+	}
+	if !target.Chain.BlockTip().Hash.IsEqual(branchTipHash) {
+		return fmt.Errorf("ReorgSimulator.Reorg: Target tip %v is not the branch tip %v; the branch "+
+			"may not have enough work", target.Chain.BlockTip().Hash, branchTipHash)
+	}
+	return nil
+}
+
+// Stop stops all of the nodes created by the simulator and frees their dbs.
+func (sim *ReorgSimulator) Stop() {
+	for _, node := range sim.nodes {
+		node.stop()
+	}
+	sim.nodes = nil
+}
+
+// MineBlocks mines blocks on the node. The hook, if set, is called before each block is mined.
+func (node *ReorgSimulatorNode) MineBlocks(numBlocks int,
+	beforeEachBlock func(node *ReorgSimulatorNode, blockIndex int) error) ([]*MsgDeSoBlock, error) {
+
+	var blocks []*MsgDeSoBlock
+	for ii := 0; ii < numBlocks; ii++ {
+		if beforeEachBlock != nil {
+			if err := beforeEachBlock(node, ii); err != nil {
+				return nil, errors.Wrapf(err, "ReorgSimulatorNode.MineBlocks: Problem before block %d", ii)
+			}
+		}
+		// The event handlers update the mempool, so we don't pass it to the miner.
+		block, err := node.Miner.MineAndProcessSingleBlock(0 /*threadIndex*/, nil /*mempoolToUpdate*/)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ReorgSimulatorNode.MineBlocks: Problem mining block %d", ii)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// ProcessBlocks processes the blocks on the node in order.
+func (node *ReorgSimulatorNode) ProcessBlocks(blocks []*MsgDeSoBlock) error {
+	for _, block := range blocks {
+		if _, _, _, err := node.Chain.ProcessBlock(block, true /*verifySignatures*/); err != nil {
+			blockHash, _ := block.Hash()
+			return errors.Wrapf(err, "ReorgSimulatorNode.ProcessBlocks: Problem processing block %v", blockHash)
+		}
+	}
+	return nil
+}
+
+// GetBestChainBlocks returns the blocks of the node's best chain from the start height to the end height,
+// inclusive.
+func (node *ReorgSimulatorNode) GetBestChainBlocks(startHeight uint64, endHeight uint64) ([]*MsgDeSoBlock, error) {
+	bestChain := node.Chain.BestChain()
+	if endHeight >= uint64(len(bestChain)) {
+		return nil, fmt.Errorf("ReorgSimulatorNode.GetBestChainBlocks: End height %d is past the tip %d",
+			endHeight, len(bestChain)-1)
+	}
+	var blocks []*MsgDeSoBlock
+	for height := startHeight; height <= endHeight; height++ {
+		block, err := GetBlock(bestChain[height].Hash, node.db, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ReorgSimulatorNode.GetBestChainBlocks: Problem getting block "+
+				"at height %d", height)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (node *ReorgSimulatorNode) stop() {
+	if node.Miner != nil {
+		node.Miner.Stop()
+	}
+	if node.blockProducer != nil {
+		node.blockProducer.Stop()
+	}
+	if node.Mempool != nil && !node.Mempool.stopped {
+		node.Mempool.Stop()
+	}
+	if node.db != nil {
+		_ = node.db.Close()
+	}
+}
+
+// reorgSimulatorSkippedPrefixes are the state prefixes that CompareChainStates doesn't compare. Block rewards
+// are indexed when a block is stored rather than when it's connected, so a node that reorged keeps the block
+// rewards of the blocks it disconnected.
+var reorgSimulatorSkippedPrefixes = map[string]struct{}{
+	string(Prefixes.PrefixPublicKeyBlockHashToBlockReward): {},
+}
+
+// CompareChainStates returns an error if the two chains don't have the same tip, or if their dbs don't have the
+// same state. Two nodes that end up on the same best chain should always pass, no matter how many reorgs it
+// took them to get there.
+func CompareChainStates(chainA *Blockchain, chainB *Blockchain) error {
+	tipA, tipB := chainA.BlockTip(), chainB.BlockTip()
+	if !tipA.Hash.IsEqual(tipB.Hash) {
+		return fmt.Errorf("CompareChainStates: Tips differ: %v at height %d vs %v at height %d",
+			tipA.Hash, tipA.Height, tipB.Hash, tipB.Height)
+	}
+	for _, prefix := range StatePrefixes.StatePrefixesList {
+		if _, skip := reorgSimulatorSkippedPrefixes[string(prefix)]; skip {
+			continue
+		}
+		keysA, valsA := EnumerateKeysForPrefix(chainA.DB(), prefix, false)
+		keysB, valsB := EnumerateKeysForPrefix(chainB.DB(), prefix, false)
+		for ii := 0; ii < len(keysA) || ii < len(keysB); ii++ {
+			if ii >= len(keysA) {
+				return fmt.Errorf("CompareChainStates: Prefix %v: Key %x is only in the second chain", prefix, keysB[ii])
+			}
+			if ii >= len(keysB) {
+				return fmt.Errorf("CompareChainStates: Prefix %v: Key %x is only in the first chain", prefix, keysA[ii])
+			}
+			if !bytes.Equal(keysA[ii], keysB[ii]) {
+				return fmt.Errorf("CompareChainStates: Prefix %v: Keys differ at index %d: %x vs %x",
+					prefix, ii, keysA[ii], keysB[ii])
+			}
+			if !bytes.Equal(valsA[ii], valsB[ii]) {
+				return fmt.Errorf("CompareChainStates: Prefix %v: Values differ for key %x", prefix, keysA[ii])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgSimulator(t *testing.T) {
+	require := require.New(t)
+	setupTestDeSoEncoder(t)
+	// Regenerate the mempool view after every txn so that each block picks up the txns added right before it.
+	ReadOnlyUtxoViewRegenerationIntervalTxns = 1
+
+	_, err := NewReorgSimulator(nil, []string{senderPkString})
+	require.Error(err)
+	params := NewTestParams(&DeSoTestnetParams)
+	_, err = NewReorgSimulator(&params, nil)
+	require.Error(err)
+
+	sim, err := NewReorgSimulator(&params, []string{senderPkString})
+	require.NoError(err)
+	defer sim.Stop()
+
+	// Send the recipient some DeSo in every block of a chain, so that the reorg has to undo real txns.
+	sendToRecipient := func(amountNanos uint64) func(*ReorgSimulatorNode, int) error {
+		return func(node *ReorgSimulatorNode, blockIndex int) error {
+			if node.Chain.BlockTip().Height < 2 {
+				return nil
+			}
+			txn := _assembleBasicTransferTxnFullySigned(t, node.Chain, amountNanos, 0,
+				senderPkString, recipientPkString, senderPrivString, node.Mempool)
+			_, err := node.Mempool.ProcessTransaction(txn, false /*allowUnconnectedTxn*/, false, /*rateLimit*/
+				0 /*peerID*/, true /*verifySignatures*/)
+			return err
+		}
+	}
+
+	mainNode, err := sim.NewNode()
+	require.NoError(err)
+	_, err = mainNode.MineBlocks(6, sendToRecipient(10))
+	require.NoError(err)
+	require.Equal(uint32(6), mainNode.Chain.BlockTip().Height)
+	require.Equal(uint64(40), _getBalance(t, mainNode.Chain, mainNode.Mempool, recipientPkString))
+
+	// A branch that forks at height 3 and is longer than the main chain replaces it.
+	branch, err := sim.BuildBranch(mainNode, 3, 4, sendToRecipient(1))
+	require.NoError(err)
+	require.Len(branch.Blocks, 4)
+	require.Equal(uint32(7), branch.Node.Chain.BlockTip().Height)
+	require.Error(CompareChainStates(mainNode.Chain, branch.Node.Chain))
+
+	require.NoError(sim.Reorg(mainNode, branch))
+	require.NoError(CompareChainStates(mainNode.Chain, branch.Node.Chain))
+	require.Equal(uint64(14), _getBalance(t, mainNode.Chain, mainNode.Mempool, recipientPkString))
+
+	// A branch that's shorter than the chain doesn't have enough work to replace it.
+	shortBranch, err := sim.BuildBranch(mainNode, 5, 1, nil)
+	require.NoError(err)
+	err = sim.Reorg(mainNode, shortBranch)
+	require.Error(err)
+	require.Contains(err.Error(), "may not have enough work")
+	require.Error(CompareChainStates(mainNode.Chain, shortBranch.Node.Chain))
+
+	// The fork height has to be on the chain.
+	_, err = sim.BuildBranch(mainNode, 8, 1, nil)
+	require.Error(err)
+}
@@ -0,0 +1,670 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Read Replicas
+//
+// A read replica is a node that doesn't validate blocks itself. Instead, it follows a primary node and applies
+// the primary's db flushes directly to its own badger db. Every record the primary writes through DBSetWithTxn
+// and DBDeleteWithTxn is already reported to the EventManager as a StateSyncerOperationEvent, and every
+// completed flush as a StateSyncerFlushedEvent, since that's what the StateChangeSyncer consumes. The
+// ReplicationPrimary subscribes to the same events, groups the operations of each successful flush into a
+// ReplicationBatch, and streams the batches to any number of ReplicationReplicas over TCP. Replicas can then
+// serve reads, e.g. through the backend API, while the primary is the only node doing the validation work.
+//
+// Every batch is numbered by a (session id, sequence) pair. The replica persists the cursor of the last batch
+// it applied in the same db, so it can reconnect and resume where it left off, as long as the primary still
+// buffers the batches it missed. The primary persists its own cursor when it shuts down cleanly, so a restart
+// of the primary doesn't break its replicas. If the primary crashes, it starts a new session and its replicas
+// must be re-bootstrapped.
+//
+// A replica must be bootstrapped from a copy of the primary's data directory, taken while the primary is
+// stopped. The replica then connects with the cursor copied along with the data directory and follows the
+// primary from there. Replicas only receive db writes, so their in-memory view of the chain, e.g. the block
+// tip, is not updated until they restart.
+
+const (
+	// ReplicationProtocolVersion is bumped whenever the wire format of the replication stream changes.
+	ReplicationProtocolVersion = uint64(1)
+
+	// DefaultReplicationMaxBufferedBatches is the default number of recent batches a ReplicationPrimary keeps in
+	// memory so that replicas that disconnect briefly can catch up.
+	DefaultReplicationMaxBufferedBatches = 10000
+
+	// replicationHandshakeTimeout is how long the primary waits for a replica's hello.
+	replicationHandshakeTimeout = 30 * time.Second
+	// replicationReconnectInterval is how long a replica waits before reconnecting to its primary.
+	replicationReconnectInterval = 5 * time.Second
+)
+
+// The frames exchanged between replicas and the primary.
+//   - <replicationFrameTypeHello, version uint64, session id [16]byte, next sequence uint64>: replica -> primary
+//   - <replicationFrameTypeBatch, ReplicationBatch>: primary -> replica
+//   - <replicationFrameTypeError, message string>: primary -> replica, right before the primary disconnects
+const (
+	replicationFrameTypeHello byte = 0
+	replicationFrameTypeBatch byte = 1
+	replicationFrameTypeError byte = 2
+)
+
+// The keys under which the cursors are stored, in the db of the primary and the replica respectively.
+var (
+	replicationPrimaryCursorKey = append(append([]byte{}, Prefixes.PrefixReplicationCursor...), []byte("primary")...)
+	replicationReplicaCursorKey = append(append([]byte{}, Prefixes.PrefixReplicationCursor...), []byte("replica")...)
+)
+
+// ReplicationEntry is a single record written or deleted by a flush on the primary.
+type ReplicationEntry struct {
+	OperationType StateSyncerOperationType
+	Key           []byte
+	Value         []byte
+}
+
+// ReplicationBatch holds all records written by a single successful flush on the primary, in the order they
+// were written.
+type ReplicationBatch struct {
+	SessionId uuid.UUID
+	Sequence  uint64
+	Entries   []*ReplicationEntry
+}
+
+func (batch *ReplicationBatch) ToBytes() []byte {
+	var data []byte
+	data = append(data, batch.SessionId[:]...)
+	data = append(data, UintToBuf(batch.Sequence)...)
+	data = append(data, UintToBuf(uint64(len(batch.Entries)))...)
+	for _, entry := range batch.Entries {
+		data = append(data, UintToBuf(uint64(entry.OperationType))...)
+		data = append(data, EncodeByteArray(entry.Key)...)
+		data = append(data, EncodeByteArray(entry.Value)...)
+	}
+	return data
+}
+
+func (batch *ReplicationBatch) FromBytes(rr *bytes.Reader) error {
+	if _, err := io.ReadFull(rr, batch.SessionId[:]); err != nil {
+		return errors.Wrapf(err, "ReplicationBatch.FromBytes: Problem reading SessionId")
+	}
+	var err error
+	if batch.Sequence, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "ReplicationBatch.FromBytes: Problem reading Sequence")
+	}
+	numEntries, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ReplicationBatch.FromBytes: Problem reading number of entries")
+	}
+	batch.Entries, err = SafeMakeSliceWithLengthAndCapacity[*ReplicationEntry](0, numEntries)
+	if err != nil {
+		return errors.Wrapf(err, "ReplicationBatch.FromBytes: Problem creating slice for entries")
+	}
+	for ii := uint64(0); ii < numEntries; ii++ {
+		entry := &ReplicationEntry{}
+		operationType, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ReplicationBatch.FromBytes: Problem reading OperationType of entry %d", ii)
+		}
+		entry.OperationType = StateSyncerOperationType(operationType)
+		if entry.Key, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "ReplicationBatch.FromBytes: Problem reading Key of entry %d", ii)
+		}
+		if entry.Value, err = DecodeByteArray(rr); err != nil {
+			return errors.Wrapf(err, "ReplicationBatch.FromBytes: Problem reading Value of entry %d", ii)
+		}
+		batch.Entries = append(batch.Entries, entry)
+	}
+	return nil
+}
+
+func writeReplicationFrame(ww io.Writer, frameType byte, payload []byte) error {
+	frame := append(UintToBuf(uint64(len(payload)+1)), frameType)
+	frame = append(frame, payload...)
+	_, err := ww.Write(frame)
+	return err
+}
+
+func readReplicationFrame(rr *bufio.Reader) (_frameType byte, _payload []byte, _err error) {
+	frameLength, err := ReadUvarint(rr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if frameLength == 0 || frameLength > MaxMessagePayload {
+		return 0, nil, fmt.Errorf("readReplicationFrame: Invalid frame length %d", frameLength)
+	}
+	frame := make([]byte, frameLength)
+	if _, err = io.ReadFull(rr, frame); err != nil {
+		return 0, nil, err
+	}
+	return frame[0], frame[1:], nil
+}
+
+func encodeReplicationCursor(sessionId uuid.UUID, nextSequence uint64) []byte {
+	return append(append([]byte{}, sessionId[:]...), EncodeUint64(nextSequence)...)
+}
+
+func decodeReplicationCursor(cursorBytes []byte) (_sessionId uuid.UUID, _nextSequence uint64, _err error) {
+	if len(cursorBytes) != len(uuid.UUID{})+8 {
+		return uuid.Nil, 0, fmt.Errorf("decodeReplicationCursor: Invalid cursor length %d", len(cursorBytes))
+	}
+	var sessionId uuid.UUID
+	copy(sessionId[:], cursorBytes[:len(sessionId)])
+	return sessionId, DecodeUint64(cursorBytes[len(sessionId):]), nil
+}
+
+func dbGetReplicationCursor(db *badger.DB, key []byte) (_sessionId uuid.UUID, _nextSequence uint64, _exists bool, _err error) {
+	var cursorBytes []byte
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cursorBytes, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil || cursorBytes == nil {
+		return uuid.Nil, 0, false, err
+	}
+	sessionId, nextSequence, err := decodeReplicationCursor(cursorBytes)
+	if err != nil {
+		return uuid.Nil, 0, false, err
+	}
+	return sessionId, nextSequence, true, nil
+}
+
+// ========================
+//	ReplicationPrimary
+// ========================
+
+// replicaConnection is a replica connected to a ReplicationPrimary.
+type replicaConnection struct {
+	conn net.Conn
+	// frames is drained by a dedicated writer goroutine. If it fills up, the replica is too slow and is
+	// disconnected, so that a slow replica can never stall the primary's flushes.
+	frames    chan []byte
+	closeOnce sync.Once
+}
+
+func (rc *replicaConnection) close() {
+	rc.closeOnce.Do(func() {
+		close(rc.frames)
+		rc.conn.Close()
+	})
+}
+
+// ReplicationPrimary streams the primary node's flushes to its read replicas. See the comment at the top of
+// this file.
+type ReplicationPrimary struct {
+	mtx sync.Mutex
+
+	db         *badger.DB
+	listenAddr string
+	listener   net.Listener
+
+	// sessionId and nextSequence identify the next batch the primary will produce.
+	sessionId    uuid.UUID
+	nextSequence uint64
+
+	// pendingEntries holds the entries written by flushes that haven't completed yet, by flush id.
+	pendingEntries map[uuid.UUID][]*ReplicationEntry
+	// bufferedBatchBytes holds the encoded frames of the most recent batches, oldest first. bufferedBatchBytes[0]
+	// has sequence firstBufferedSequence.
+	bufferedBatchBytes    [][]byte
+	firstBufferedSequence uint64
+	maxBufferedBatches    int
+
+	replicas map[*replicaConnection]struct{}
+
+	quit      chan struct{}
+	waitGroup sync.WaitGroup
+}
+
+func NewReplicationPrimary(db *badger.DB, listenAddr string, maxBufferedBatches int) *ReplicationPrimary {
+	if maxBufferedBatches <= 0 {
+		maxBufferedBatches = DefaultReplicationMaxBufferedBatches
+	}
+	return &ReplicationPrimary{
+		db:                 db,
+		listenAddr:         listenAddr,
+		pendingEntries:     make(map[uuid.UUID][]*ReplicationEntry),
+		maxBufferedBatches: maxBufferedBatches,
+		replicas:           make(map[*replicaConnection]struct{}),
+		quit:               make(chan struct{}),
+	}
+}
+
+// RegisterWithEventManager subscribes the primary to the flushes reported by the provided EventManager. It
+// must be called before the node starts processing blocks.
+func (rp *ReplicationPrimary) RegisterWithEventManager(eventManager *EventManager) {
+	eventManager.OnStateSyncerOperation(rp._handleStateSyncerOperation)
+	eventManager.OnStateSyncerFlushed(rp._handleStateSyncerFlush)
+}
+
+// Start resumes the session persisted by the last clean shutdown, or starts a new one, and begins accepting
+// replica connections.
+func (rp *ReplicationPrimary) Start() error {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+
+	sessionId, nextSequence, exists, err := dbGetReplicationCursor(rp.db, replicationPrimaryCursorKey)
+	if err != nil {
+		return errors.Wrapf(err, "ReplicationPrimary.Start: Problem reading persisted cursor")
+	}
+	if exists {
+		// Delete the persisted cursor so that, if we crash, we don't resume a session whose flushes were lost.
+		err = rp.db.Update(func(txn *badger.Txn) error {
+			return txn.Delete(replicationPrimaryCursorKey)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "ReplicationPrimary.Start: Problem deleting persisted cursor")
+		}
+		glog.Infof("ReplicationPrimary.Start: Resuming session %v at sequence %d", sessionId, nextSequence)
+	} else {
+		sessionId = uuid.New()
+		nextSequence = 0
+		glog.Infof("ReplicationPrimary.Start: Starting new session %v", sessionId)
+	}
+	rp.sessionId = sessionId
+	rp.nextSequence = nextSequence
+	rp.firstBufferedSequence = nextSequence
+
+	if rp.listenAddr != "" {
+		rp.listener, err = net.Listen("tcp", rp.listenAddr)
+		if err != nil {
+			return errors.Wrapf(err, "ReplicationPrimary.Start: Problem listening on %v", rp.listenAddr)
+		}
+		rp.waitGroup.Add(1)
+		go rp.acceptLoop()
+	}
+	return nil
+}
+
+// Stop disconnects all replicas and persists the primary's cursor. It must be called after the node has
+// stopped flushing to the db, and before the db is closed.
+func (rp *ReplicationPrimary) Stop() {
+	close(rp.quit)
+	if rp.listener != nil {
+		rp.listener.Close()
+	}
+
+	rp.mtx.Lock()
+	for replica := range rp.replicas {
+		replica.close()
+		delete(rp.replicas, replica)
+	}
+	sessionId, nextSequence := rp.sessionId, rp.nextSequence
+	rp.mtx.Unlock()
+	rp.waitGroup.Wait()
+
+	err := rp.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(replicationPrimaryCursorKey, encodeReplicationCursor(sessionId, nextSequence))
+	})
+	if err != nil {
+		glog.Errorf("ReplicationPrimary.Stop: Problem persisting cursor, replicas will need to be "+
+			"re-bootstrapped: %v", err)
+	}
+}
+
+// GetCursor returns the session id and sequence of the next batch the primary will produce.
+func (rp *ReplicationPrimary) GetCursor() (_sessionId uuid.UUID, _nextSequence uint64) {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+	return rp.sessionId, rp.nextSequence
+}
+
+func (rp *ReplicationPrimary) _handleStateSyncerOperation(event *StateSyncerOperationEvent) {
+	if event.IsMempoolTxn || event.StateChangeEntry == nil {
+		return
+	}
+	entry := &ReplicationEntry{
+		OperationType: event.StateChangeEntry.OperationType,
+		Key:           event.StateChangeEntry.KeyBytes,
+		Value:         event.StateChangeEntry.EncoderBytes,
+	}
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+	rp.pendingEntries[event.FlushId] = append(rp.pendingEntries[event.FlushId], entry)
+}
+
+func (rp *ReplicationPrimary) _handleStateSyncerFlush(event *StateSyncerFlushedEvent) {
+	if event.IsMempoolFlush {
+		return
+	}
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+
+	entries := rp.pendingEntries[event.FlushId]
+	delete(rp.pendingEntries, event.FlushId)
+	if !event.Succeeded || len(entries) == 0 {
+		return
+	}
+
+	batch := &ReplicationBatch{
+		SessionId: rp.sessionId,
+		Sequence:  rp.nextSequence,
+		Entries:   entries,
+	}
+	rp.nextSequence++
+	batchBytes := batch.ToBytes()
+
+	rp.bufferedBatchBytes = append(rp.bufferedBatchBytes, batchBytes)
+	if len(rp.bufferedBatchBytes) > rp.maxBufferedBatches {
+		rp.bufferedBatchBytes[0] = nil
+		rp.bufferedBatchBytes = rp.bufferedBatchBytes[1:]
+		rp.firstBufferedSequence++
+	}
+
+	for replica := range rp.replicas {
+		select {
+		case replica.frames <- batchBytes:
+		default:
+			glog.Warningf("ReplicationPrimary: Disconnecting replica %v because it is falling behind",
+				replica.conn.RemoteAddr())
+			replica.close()
+			delete(rp.replicas, replica)
+		}
+	}
+}
+
+func (rp *ReplicationPrimary) acceptLoop() {
+	defer rp.waitGroup.Done()
+	for {
+		conn, err := rp.listener.Accept()
+		if err != nil {
+			select {
+			case <-rp.quit:
+				return
+			default:
+			}
+			glog.Errorf("ReplicationPrimary.acceptLoop: Problem accepting connection: %v", err)
+			continue
+		}
+		rp.waitGroup.Add(1)
+		go rp.handleReplica(conn)
+	}
+}
+
+func (rp *ReplicationPrimary) handleReplica(conn net.Conn) {
+	defer rp.waitGroup.Done()
+
+	refuse := func(err error) {
+		glog.Errorf("ReplicationPrimary.handleReplica: Refusing replica %v: %v", conn.RemoteAddr(), err)
+		writeReplicationFrame(conn, replicationFrameTypeError, []byte(err.Error()))
+		conn.Close()
+	}
+
+	// Read the replica's hello, which tells us where it wants to resume.
+	conn.SetReadDeadline(time.Now().Add(replicationHandshakeTimeout))
+	frameType, payload, err := readReplicationFrame(bufio.NewReader(conn))
+	if err != nil || frameType != replicationFrameTypeHello {
+		refuse(fmt.Errorf("expected hello, got frame type %d, error: %v", frameType, err))
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	rr := bytes.NewReader(payload)
+	version, err := ReadUvarint(rr)
+	if err != nil || version != ReplicationProtocolVersion {
+		refuse(fmt.Errorf("unsupported protocol version %d", version))
+		return
+	}
+	var sessionId uuid.UUID
+	if _, err = io.ReadFull(rr, sessionId[:]); err != nil {
+		refuse(errors.Wrapf(err, "problem reading session id"))
+		return
+	}
+	nextSequence, err := ReadUvarint(rr)
+	if err != nil {
+		refuse(errors.Wrapf(err, "problem reading next sequence"))
+		return
+	}
+
+	// Register the replica and queue up the batches it missed in a single critical section, so that no
+	// batch is skipped or sent twice.
+	rp.mtx.Lock()
+	if sessionId != rp.sessionId {
+		rp.mtx.Unlock()
+		refuse(fmt.Errorf("replica is on session %v but the primary is on session %v; the replica must be "+
+			"re-bootstrapped from a copy of the primary's data directory", sessionId, rp.sessionId))
+		return
+	}
+	if nextSequence < rp.firstBufferedSequence || nextSequence > rp.nextSequence {
+		firstBufferedSequence, primaryNextSequence := rp.firstBufferedSequence, rp.nextSequence
+		rp.mtx.Unlock()
+		refuse(fmt.Errorf("replica wants sequence %d but the primary only has sequences %d to %d buffered; the "+
+			"replica must be re-bootstrapped", nextSequence, firstBufferedSequence, primaryNextSequence))
+		return
+	}
+	backlog := rp.bufferedBatchBytes[nextSequence-rp.firstBufferedSequence:]
+	replica := &replicaConnection{
+		conn:   conn,
+		frames: make(chan []byte, len(backlog)+rp.maxBufferedBatches),
+	}
+	for _, batchBytes := range backlog {
+		replica.frames <- batchBytes
+	}
+	rp.replicas[replica] = struct{}{}
+	rp.mtx.Unlock()
+	glog.Infof("ReplicationPrimary.handleReplica: Replica %v connected at sequence %d, %d batches behind",
+		conn.RemoteAddr(), nextSequence, len(backlog))
+
+	ww := bufio.NewWriter(conn)
+	for batchBytes := range replica.frames {
+		if err = writeReplicationFrame(ww, replicationFrameTypeBatch, batchBytes); err == nil && len(replica.frames) == 0 {
+			err = ww.Flush()
+		}
+		if err != nil {
+			glog.Errorf("ReplicationPrimary.handleReplica: Problem writing to replica %v: %v", conn.RemoteAddr(), err)
+			break
+		}
+	}
+	rp.mtx.Lock()
+	delete(rp.replicas, replica)
+	rp.mtx.Unlock()
+	replica.close()
+}
+
+// ========================
+//	ReplicationReplica
+// ========================
+
+// ReplicationReplica follows a ReplicationPrimary and applies its batches to the local db. See the comment at
+// the top of this file.
+type ReplicationReplica struct {
+	mtx sync.Mutex
+
+	db *badger.DB
+	// snapshot is optional. If set, the entries of every applied batch are evicted from its DatabaseCache so
+	// that reads don't return stale values.
+	snapshot    *Snapshot
+	primaryAddr string
+
+	// sessionId and nextSequence identify the next batch the replica expects.
+	sessionId    uuid.UUID
+	nextSequence uint64
+
+	conn      net.Conn
+	quit      chan struct{}
+	waitGroup sync.WaitGroup
+}
+
+// NewReplicationReplica creates a replica that applies the batches of the primary listening at primaryAddr to
+// db. The replica resumes from the cursor stored in db, which is the primary's cursor if db was copied from the
+// primary's data directory.
+func NewReplicationReplica(db *badger.DB, snapshot *Snapshot, primaryAddr string) (*ReplicationReplica, error) {
+	sessionId, nextSequence, exists, err := dbGetReplicationCursor(db, replicationReplicaCursorKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewReplicationReplica: Problem reading replica cursor")
+	}
+	if !exists {
+		// If the db was copied from a cleanly stopped primary, the primary's cursor tells us where to start.
+		sessionId, nextSequence, exists, err = dbGetReplicationCursor(db, replicationPrimaryCursorKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewReplicationReplica: Problem reading primary cursor")
+		}
+		if !exists {
+			return nil, errors.New("NewReplicationReplica: The data directory has no replication cursor. A " +
+				"replica must be bootstrapped from a copy of a cleanly stopped primary's data directory")
+		}
+	}
+	return &ReplicationReplica{
+		db:           db,
+		snapshot:     snapshot,
+		primaryAddr:  primaryAddr,
+		sessionId:    sessionId,
+		nextSequence: nextSequence,
+		quit:         make(chan struct{}),
+	}, nil
+}
+
+// Start connects to the primary and applies its batches until Stop is called, reconnecting whenever the
+// connection drops.
+func (rr *ReplicationReplica) Start() {
+	rr.waitGroup.Add(1)
+	go func() {
+		defer rr.waitGroup.Done()
+		for {
+			if err := rr.followPrimary(); err != nil {
+				glog.Errorf("ReplicationReplica: Lost connection to primary %v: %v", rr.primaryAddr, err)
+			}
+			select {
+			case <-rr.quit:
+				return
+			case <-time.After(replicationReconnectInterval):
+			}
+		}
+	}()
+}
+
+func (rr *ReplicationReplica) Stop() {
+	close(rr.quit)
+	rr.mtx.Lock()
+	if rr.conn != nil {
+		rr.conn.Close()
+	}
+	rr.mtx.Unlock()
+	rr.waitGroup.Wait()
+}
+
+// GetCursor returns the session id and sequence of the next batch the replica expects.
+func (rr *ReplicationReplica) GetCursor() (_sessionId uuid.UUID, _nextSequence uint64) {
+	rr.mtx.Lock()
+	defer rr.mtx.Unlock()
+	return rr.sessionId, rr.nextSequence
+}
+
+func (rr *ReplicationReplica) followPrimary() error {
+	conn, err := net.DialTimeout("tcp", rr.primaryAddr, replicationHandshakeTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "ReplicationReplica.followPrimary: Problem dialing primary")
+	}
+	rr.mtx.Lock()
+	select {
+	case <-rr.quit:
+		rr.mtx.Unlock()
+		conn.Close()
+		return nil
+	default:
+	}
+	rr.conn = conn
+	sessionId, nextSequence := rr.sessionId, rr.nextSequence
+	rr.mtx.Unlock()
+	defer conn.Close()
+
+	hello := UintToBuf(ReplicationProtocolVersion)
+	hello = append(hello, sessionId[:]...)
+	hello = append(hello, UintToBuf(nextSequence)...)
+	if err = writeReplicationFrame(conn, replicationFrameTypeHello, hello); err != nil {
+		return errors.Wrapf(err, "ReplicationReplica.followPrimary: Problem sending hello")
+	}
+	glog.Infof("ReplicationReplica: Following primary %v from session %v, sequence %d",
+		rr.primaryAddr, sessionId, nextSequence)
+
+	reader := bufio.NewReader(conn)
+	for {
+		frameType, payload, err := readReplicationFrame(reader)
+		if err != nil {
+			select {
+			case <-rr.quit:
+				return nil
+			default:
+			}
+			return errors.Wrapf(err, "ReplicationReplica.followPrimary: Problem reading frame")
+		}
+		switch frameType {
+		case replicationFrameTypeError:
+			return fmt.Errorf("ReplicationReplica.followPrimary: Primary refused connection: %v", string(payload))
+		case replicationFrameTypeBatch:
+			batch := &ReplicationBatch{}
+			if err = batch.FromBytes(bytes.NewReader(payload)); err != nil {
+				return errors.Wrapf(err, "ReplicationReplica.followPrimary: Problem decoding batch")
+			}
+			if err = rr.ApplyBatch(batch); err != nil {
+				return errors.Wrapf(err, "ReplicationReplica.followPrimary: ")
+			}
+		default:
+			return fmt.Errorf("ReplicationReplica.followPrimary: Unexpected frame type %d", frameType)
+		}
+	}
+}
+
+// ApplyBatch writes the entries of a batch to the replica's db and advances the replica's cursor. Batches must
+// be applied in order. Applying the same batch twice is harmless, which is what makes it safe to crash between
+// writing the entries and writing the cursor.
+func (rr *ReplicationReplica) ApplyBatch(batch *ReplicationBatch) error {
+	rr.mtx.Lock()
+	defer rr.mtx.Unlock()
+
+	if batch.SessionId != rr.sessionId || batch.Sequence != rr.nextSequence {
+		return fmt.Errorf("ReplicationReplica.ApplyBatch: Expected batch %d of session %v, got batch %d of "+
+			"session %v", rr.nextSequence, rr.sessionId, batch.Sequence, batch.SessionId)
+	}
+
+	wb := rr.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, entry := range batch.Entries {
+		var err error
+		if entry.OperationType == DbOperationTypeDelete {
+			err = wb.Delete(entry.Key)
+		} else {
+			err = wb.Set(entry.Key, entry.Value)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "ReplicationReplica.ApplyBatch: Problem writing entry to batch")
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return errors.Wrapf(err, "ReplicationReplica.ApplyBatch: Problem flushing batch %d", batch.Sequence)
+	}
+	if rr.snapshot != nil {
+		for _, entry := range batch.Entries {
+			rr.snapshot.DatabaseCache.Delete(hex.EncodeToString(entry.Key))
+			rr.snapshot.StateCache.Invalidate(entry.Key)
+		}
+		rr.snapshot.StateCache.EndFlush(rr.db)
+	}
+
+	// Only advance the cursor once all the entries are durably written.
+	err := rr.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(replicationReplicaCursorKey, encodeReplicationCursor(batch.SessionId, batch.Sequence+1))
+	})
+	if err != nil {
+		return errors.Wrapf(err, "ReplicationReplica.ApplyBatch: Problem persisting cursor")
+	}
+	rr.nextSequence = batch.Sequence + 1
+	return nil
+}
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationBatchEncoding(t *testing.T) {
+	require := require.New(t)
+
+	batch := &ReplicationBatch{
+		SessionId: uuid.New(),
+		Sequence:  42,
+		Entries: []*ReplicationEntry{
+			{OperationType: DbOperationTypeUpsert, Key: []byte("key1"), Value: []byte("value1")},
+			{OperationType: DbOperationTypeDelete, Key: []byte("key2")},
+		},
+	}
+	decodedBatch := &ReplicationBatch{}
+	require.NoError(decodedBatch.FromBytes(bytes.NewReader(batch.ToBytes())))
+	require.Equal(batch, decodedBatch)
+
+	// Truncated batches are rejected.
+	batchBytes := batch.ToBytes()
+	require.Error((&ReplicationBatch{}).FromBytes(bytes.NewReader(batchBytes[:len(batchBytes)-1])))
+}
+
+func TestReplication(t *testing.T) {
+	require := require.New(t)
+
+	primaryDb, primaryDir := GetTestBadgerDb()
+	defer os.RemoveAll(primaryDir)
+	defer primaryDb.Close()
+	replicaDb, replicaDir := GetTestBadgerDb()
+	defer os.RemoveAll(replicaDir)
+	defer replicaDb.Close()
+
+	eventManager := NewEventManager()
+	primary := NewReplicationPrimary(primaryDb, "127.0.0.1:0", 0)
+	primary.RegisterWithEventManager(eventManager)
+	require.NoError(primary.Start())
+	primaryAddr := primary.listener.Addr().String()
+	sessionId, nextSequence := primary.GetCursor()
+	require.Equal(uint64(0), nextSequence)
+
+	flush := func(succeeded bool, writes func(txn *badger.Txn) error) {
+		require.NoError(primaryDb.Update(writes))
+		eventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{FlushId: uuid.Nil, Succeeded: succeeded})
+	}
+	getReplicaValue := func(key []byte) []byte {
+		value, err := DBGetWithTxn(replicaDb.NewTransaction(false), nil, key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		require.NoError(err)
+		return value
+	}
+	waitForReplicaSequence := func(replica *ReplicationReplica, sequence uint64) {
+		require.Eventually(func() bool {
+			_, replicaNextSequence := replica.GetCursor()
+			return replicaNextSequence == sequence
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+
+	// A replica can't start without a cursor.
+	_, err := NewReplicationReplica(replicaDb, nil, primaryAddr)
+	require.Error(err)
+
+	// Bootstrap the replica the way copying the primary's data directory would.
+	require.NoError(replicaDb.Update(func(txn *badger.Txn) error {
+		return txn.Set(replicationPrimaryCursorKey, encodeReplicationCursor(sessionId, nextSequence))
+	}))
+	replica, err := NewReplicationReplica(replicaDb, nil, primaryAddr)
+	require.NoError(err)
+	replica.Start()
+
+	flush(true, func(txn *badger.Txn) error {
+		require.NoError(DBSetWithTxn(txn, nil, []byte("key1"), []byte("value1"), eventManager))
+		return DBSetWithTxn(txn, nil, []byte("key2"), []byte("value2"), eventManager)
+	})
+	waitForReplicaSequence(replica, 1)
+	require.Equal([]byte("value1"), getReplicaValue([]byte("key1")))
+	require.Equal([]byte("value2"), getReplicaValue([]byte("key2")))
+
+	// Failed flushes and mempool flushes are not replicated.
+	flush(false, func(txn *badger.Txn) error {
+		return DBSetWithTxn(txn, nil, []byte("key3"), []byte("value3"), eventManager)
+	})
+	eventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{FlushId: uuid.Nil, Succeeded: true, IsMempoolFlush: true})
+	_, nextSequence = primary.GetCursor()
+	require.Equal(uint64(1), nextSequence)
+
+	flush(true, func(txn *badger.Txn) error {
+		return DBDeleteWithTxn(txn, nil, []byte("key1"), eventManager, true)
+	})
+	waitForReplicaSequence(replica, 2)
+	require.Nil(getReplicaValue([]byte("key1")))
+	require.Nil(getReplicaValue([]byte("key3")))
+
+	// A replica that disconnects catches up on the batches it missed when it reconnects.
+	replica.Stop()
+	flush(true, func(txn *badger.Txn) error {
+		return DBSetWithTxn(txn, nil, []byte("key2"), []byte("value2b"), eventManager)
+	})
+	replica, err = NewReplicationReplica(replicaDb, nil, primaryAddr)
+	require.NoError(err)
+	replica.Start()
+	waitForReplicaSequence(replica, 3)
+	require.Equal([]byte("value2b"), getReplicaValue([]byte("key2")))
+	replica.Stop()
+
+	// Batches must be applied in order.
+	err = replica.ApplyBatch(&ReplicationBatch{SessionId: sessionId, Sequence: 5})
+	require.Error(err)
+	err = replica.ApplyBatch(&ReplicationBatch{SessionId: uuid.New(), Sequence: 3})
+	require.Error(err)
+
+	// The primary resumes its session after a clean restart.
+	primary.Stop()
+	primary = NewReplicationPrimary(primaryDb, "", 0)
+	require.NoError(primary.Start())
+	restartedSessionId, restartedNextSequence := primary.GetCursor()
+	require.Equal(sessionId, restartedSessionId)
+	require.Equal(uint64(3), restartedNextSequence)
+	primary.Stop()
+}
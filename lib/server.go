@@ -5,14 +5,17 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/deso-protocol/go-deadlock"
+	"math"
 	"net"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/wire"
+	"github.com/deso-protocol/core/bls"
 	"github.com/deso-protocol/core/collections"
 	"github.com/deso-protocol/core/consensus"
 
@@ -34,6 +37,8 @@ type ServerMessage struct {
 	Peer      *Peer
 	Msg       DeSoMessage
 	ReplyChan chan *ServerReply
+	// CorrelationID identifies the message in the logs. It's only set for messages received from a Peer.
+	CorrelationID CorrelationID
 }
 
 // GetDataRequestInfo is a data structure used to keep track of which transactions
@@ -68,6 +73,48 @@ type Server struct {
 
 	networkManager *NetworkManager
 
+	// logger is scoped to the server component. The loggers of the Server's subsystems are created from it.
+	logger Logger
+
+	// trustedSnapshotSignerPublicKeys are the BLS public keys whose signatures we accept on v2 snapshot
+	// state roots. If empty, we hypersync in the v1 format from the sync peer, since we'd have no way to
+	// tell whether a v2 state root was honest before downloading chunks from other peers.
+	trustedSnapshotSignerPublicKeys []*bls.PublicKey
+
+	// txnRelayFilter holds the TxnTypes that the operator has paused through the admin RPC. Paused TxnTypes
+	// aren't accepted, relayed, or included in the blocks we produce.
+	txnRelayFilter *TxnRelayFilter
+
+	// blockInclusionFilter holds the operator's rules for which transactions we include in the blocks we produce.
+	// It may be nil. See pos_block_inclusion_filter.go.
+	blockInclusionFilter *BlockInclusionFilter
+
+	// blockProducerDeterministicTxnShuffle orders the txns of the blocks we produce by the deterministic shuffle
+	// even if the network doesn't enforce it. See deterministic_txn_shuffle.go.
+	blockProducerDeterministicTxnShuffle bool
+
+	// txnSubmissionTracker tracks whether the transactions submitted through SubmitTransactionToPeers are
+	// announced by other peers, so that propagation failures and suspected censorship can be reported.
+	txnSubmissionTracker *TxnSubmissionTracker
+
+	// localTxnRebroadcastInterval is how often the transactions submitted to this node are rebroadcast to peers
+	// until they're confirmed. Local transactions aren't rebroadcast if it's zero.
+	localTxnRebroadcastInterval time.Duration
+
+	// txnReconciliationInterval is how often we reconcile transactions with each outbound peer that supports it,
+	// rather than flooding INVs to it. Transactions are always flooded if it's zero. See txn_reconciliation.go.
+	txnReconciliationInterval time.Duration
+
+	// compactBlockRelay is true if we announce new blocks with compact blocks to the peers that support them, and
+	// accept compact blocks from them. See compact_block.go.
+	compactBlockRelay bool
+
+	// feeTelemetryInterval is how often we share a summary of our mempool's fees with the peers that support it.
+	// Fee telemetry is disabled if it's zero. See fee_telemetry.go.
+	feeTelemetryInterval time.Duration
+	// feeTelemetry holds the latest summaries of our peers. It's nil if fee telemetry is disabled.
+	feeTelemetry *FeeTelemetryAggregator
+
 	fastHotStuffConsensus                    *FastHotStuffConsensus
 	fastHotStuffConsensusTransitionCheckTime time.Time
 
@@ -83,6 +130,11 @@ type Server struct {
 	// messages to notify the Server e.g. when a Peer connects or disconnects so that
 	// the Server can take action appropriately.
 	incomingMessages chan *ServerMessage
+	// messageLanes routes the messages received from peers to the consensus, txn, and default lanes, the last of
+	// which is incomingMessages. See server_message_lanes.go.
+	messageLanes *serverMessageLanes
+	// validatorStandby is set if the node is the standby of its validator. See pos_validator_standby.go.
+	validatorStandby *ValidatorStandby
 	// inventoryBeingProcessed keeps track of the inventory (hashes of blocks and
 	// transactions) that we've recently processed from peers. It is useful for
 	// avoiding situations in which we re-fetch the same data from many peers.
@@ -181,7 +233,7 @@ func (srv *Server) ResetRequestQueues() {
 	srv.dataLock.Lock()
 	defer srv.dataLock.Unlock()
 
-	glog.V(2).Infof("Server.ResetRequestQueues: Resetting request queues")
+	srv.logger.V(2).Infof("Server.ResetRequestQueues: Resetting request queues")
 
 	srv.requestedTransactionsMap = make(map[BlockHash]*GetDataRequestInfo)
 }
@@ -190,6 +242,10 @@ func (srv *Server) GetNetworkManager() *NetworkManager {
 	return srv.networkManager
 }
 
+func (srv *Server) GetTxnRelayFilter() *TxnRelayFilter {
+	return srv.txnRelayFilter
+}
+
 func (srv *Server) AdminOverrideViewNumber(view uint64) error {
 	if srv.fastHotStuffConsensus == nil || srv.fastHotStuffConsensus.fastHotStuffEventLoop == nil {
 		return fmt.Errorf("AdminOverrideViewNumber: FastHotStuffConsensus is nil")
@@ -211,6 +267,10 @@ func (srv *Server) AdminOverrideViewNumber(view uint64) error {
 		srv.blockchain,
 		srv.posMempool,
 		signer,
+		srv.txnRelayFilter,
+		srv.blockInclusionFilter,
+		srv.blockProducerDeterministicTxnShuffle,
+		srv.logger.WithComponent(LogComponentConsensus),
 	)
 	if err := srv.fastHotStuffConsensus.Start(); err != nil {
 		return fmt.Errorf("AdminOverrideViewNumber: Problem starting FastHotStuffConsensus: %v", err)
@@ -322,6 +382,104 @@ func (srv *Server) VerifyAndBroadcastTransaction(txn *MsgDeSoTxn) error {
 	return nil
 }
 
+// PreviewBlock runs the PoS block construction for the next block on top of the current tip, as if
+// proposerPublicKey were the proposer, and returns a report on the block without producing it. The header
+// of the tip is used to estimate the size of the next block's header, since their QCs are of similar size.
+func (srv *Server) PreviewBlock(proposerPublicKey []byte) (*BlockPreview, error) {
+	if len(proposerPublicKey) != PublicKeyLenCompressed {
+		return nil, fmt.Errorf("PreviewBlock: Proposer public key has length %d, expected %d",
+			len(proposerPublicKey), PublicKeyLenCompressed)
+	}
+
+	srv.blockchain.ChainLock.RLock()
+	defer srv.blockchain.ChainLock.RUnlock()
+
+	tip := srv.blockchain.BlockTip()
+	newBlockHeight := uint64(tip.Height) + 1
+	if !srv.params.IsPoSBlockHeight(newBlockHeight) {
+		return nil, fmt.Errorf("PreviewBlock: Block height %d is not a PoS block height", newBlockHeight)
+	}
+	tipView, err := srv.blockchain.GetUncommittedTipView()
+	if err != nil {
+		return nil, errors.Wrapf(err, "PreviewBlock: ")
+	}
+	tipHeaderBytes, err := tip.Header.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "PreviewBlock: Problem getting tip header size: ")
+	}
+
+	// The tip's view may be cached and shared with the consensus, so we build the block on a copy of it.
+	blockProducer := NewPosBlockProducer(srv.posMempool, srv.params, NewPublicKey(proposerPublicKey), nil,
+		tip.Header.TstampNanoSecs, srv.txnRelayFilter, srv.blockInclusionFilter,
+		srv.blockProducerDeterministicTxnShuffle)
+	preview, err := blockProducer.PreviewBlock(tipView.CopyUtxoView(), newBlockHeight, uint64(len(tipHeaderBytes)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "PreviewBlock: ")
+	}
+	return preview, nil
+}
+
+// txnSubmissionTimeout is how long a transaction submitted through SubmitTransactionToPeers has to be announced
+// by other peers before it's reported as a propagation failure or as suspected censorship.
+const txnSubmissionTimeout = 30 * time.Second
+
+// SubmitTransactionToPeers adds the txn to the mempool like BroadcastTransaction, and then announces it directly
+// to up to maxPeers peers, or to all of them if maxPeers is zero, instead of relying on the mempool's relay.
+// Outbound peers are preferred, since they're less likely to be controlled by a single party. The submission is
+// tracked until the txn is announced back to us by other peers, and its status can be polled with
+// GetTxnSubmissionStatus to detect propagation failures and suspected censorship.
+func (srv *Server) SubmitTransactionToPeers(txn *MsgDeSoTxn, maxPeers int) (*TxnSubmissionStatus, error) {
+	txnHash := txn.Hash()
+	if txnHash == nil {
+		return nil, fmt.Errorf("SubmitTransactionToPeers: Txn hash is nil")
+	}
+	if _, err := srv.BroadcastTransaction(txn); err != nil {
+		return nil, errors.Wrapf(err, "SubmitTransactionToPeers: ")
+	}
+
+	var peers []*Peer
+	for _, pp := range srv.cmgr.GetAllPeers() {
+		if pp.canReceiveInvMessages {
+			peers = append(peers, pp)
+		}
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("SubmitTransactionToPeers: No peers to submit txn %v to", txnHash)
+	}
+	sort.Slice(peers, func(ii, jj int) bool {
+		if peers[ii].isOutbound != peers[jj].isOutbound {
+			return peers[ii].isOutbound
+		}
+		return peers[ii].ID < peers[jj].ID
+	})
+	if maxPeers > 0 && len(peers) > maxPeers {
+		peers = peers[:maxPeers]
+	}
+
+	// Like _rebroadcastLocalTransactions, we announce the txn even to the peers that we've already announced it
+	// to, since they may have dropped it.
+	invVect := &InvVect{
+		Type: InvTypeTx,
+		Hash: *txnHash,
+	}
+	peerIDs := make([]uint64, 0, len(peers))
+	for _, pp := range peers {
+		pp.knownInventory.Add(*invVect, struct{}{})
+		pp.AddDeSoMessage(&MsgDeSoInv{InvList: []*InvVect{invVect}}, false)
+		peerIDs = append(peerIDs, pp.ID)
+	}
+	now := time.Now()
+	srv.txnSubmissionTracker.AddSubmission(txnHash, peerIDs, now)
+	srv.logger.V(1).Infof("Server.SubmitTransactionToPeers: Submitted txn %v to peers %v", txnHash, peerIDs)
+	return srv.txnSubmissionTracker.GetStatus(txnHash, now), nil
+}
+
+// GetTxnSubmissionStatus returns the status of a transaction submitted through SubmitTransactionToPeers, or nil
+// if it wasn't submitted or is no longer tracked.
+func (srv *Server) GetTxnSubmissionStatus(txnHash *BlockHash) *TxnSubmissionStatus {
+	return srv.txnSubmissionTracker.GetStatus(txnHash, time.Now())
+}
+
 type NodeSyncType string
 
 const (
@@ -347,20 +505,27 @@ func NodeCanHypersyncState(syncType NodeSyncType) bool {
 }
 
 func ValidateHyperSyncFlags(isHypersync bool, syncType NodeSyncType) {
+	if err := validateHyperSyncFlags(isHypersync, syncType); err != nil {
+		glog.Fatal(err)
+	}
+}
+
+func validateHyperSyncFlags(isHypersync bool, syncType NodeSyncType) error {
 	if syncType != NodeSyncTypeAny &&
 		syncType != NodeSyncTypeBlockSync &&
 		syncType != NodeSyncTypeHyperSyncArchival &&
 		syncType != NodeSyncTypeHyperSync {
-		glog.Fatalf("Unrecognized --sync-type flag %v", syncType)
+		return fmt.Errorf("Unrecognized --sync-type flag %v", syncType)
 	}
 	if !isHypersync &&
 		syncType == NodeSyncTypeHyperSync {
-		glog.Fatal("Cannot set --sync-type=hypersync without also setting --hypersync=true")
+		return fmt.Errorf("Cannot set --sync-type=hypersync without also setting --hypersync=true")
 	}
 	if !isHypersync &&
 		syncType == NodeSyncTypeHyperSyncArchival {
-		glog.Fatal("Cannot set --sync-type=hypersync-archival without also setting --hypersync=true")
+		return fmt.Errorf("Cannot set --sync-type=hypersync-archival without also setting --hypersync=true")
 	}
+	return nil
 }
 
 // NewServer initializes all of the internal data structures. Right now this basically
@@ -386,66 +551,42 @@ func ValidateHyperSyncFlags(isHypersync bool, syncType NodeSyncType) {
 //     a particular peer, which could be the case in initial block download where a single
 //     sync peer is used.
 //
-// TODO: Refactor all these arguments into a config object or something.
+// The node's tunables are set in the NodeConfig, which is validated before anything is initialized.
 func NewServer(
-	_params *DeSoParams,
-	_isRegtest bool,
+	config *NodeConfig,
 	_listeners []net.Listener,
 	_desoAddrMgr *addrmgr.AddrManager,
-	_connectIps []string,
+	_peerDialer *PeerDialer,
 	_db *badger.DB,
 	postgres *Postgres,
-	_targetOutboundPeers uint32,
-	_maxInboundPeers uint32,
-	_minerPublicKeys []string,
-	_numMiningThreads uint64,
-	_limitOneInboundConnectionPerIP bool,
-	_peerConnectionRefreshIntervalMillis uint64,
-	_hyperSync bool,
-	_syncType NodeSyncType,
-	_maxSyncBlockHeight uint32,
-	_disableEncoderMigrations bool,
-	_rateLimitFeerateNanosPerKB uint64,
-	_minFeeRateNanosPerKB uint64,
-	_stallTimeoutSeconds uint64,
-	_maxBlockTemplatesToCache uint64,
-	_minBlockUpdateIntervalSeconds uint64,
-	_blockCypherAPIKey string,
-	_runReadOnlyUtxoViewUpdater bool,
-	_snapshotBlockHeightPeriod uint64,
-	_dataDir string,
-	_mempoolDumpDir string,
-	_disableNetworking bool,
-	_readOnlyMode bool,
-	_ignoreInboundPeerInvMessages bool,
 	statsd *statsd.Client,
-	_blockProducerSeed string,
-	_trustedBlockProducerPublicKeys []string,
-	_trustedBlockProducerStartHeight uint64,
 	eventManager *EventManager,
 	_nodeMessageChan chan NodeMessage,
-	_forceChecksum bool,
-	_stateChangeDir string,
-	_hypersyncMaxQueueSize uint32,
 	_blsKeystore *BLSKeystore,
-	_mempoolBackupIntervalMillis uint64,
-	_mempoolMaxValidationViewConnects uint64,
-	_transactionValidationRefreshIntervalMillis uint64,
-	_stateSyncerMempoolTxnSyncLimit uint64,
-	_checkpointSyncingProviders []string,
 ) (
 	_srv *Server,
 	_err error,
 	_shouldRestart bool,
 ) {
-	var err error
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Invalid config"), false
+	}
+	logConfig, err := NewLogConfig(config.LogFormat, config.LogComponentLevels)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem parsing log config"), false
+	}
+	peerRequestRateLimits, err := NewPeerRequestRateLimits(config.PeerRequestRateLimits)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem parsing peer request rate limits"), false
+	}
 
 	// Only initialize state change syncer if the directories are defined.
 	var stateChangeSyncer *StateChangeSyncer
-	if _stateChangeDir != "" {
+	if config.StateChangeDir != "" {
 		// Create the state change syncer to handle syncing state changes to disk, and assign some of its methods
 		// to the event manager.
-		stateChangeSyncer = NewStateChangeSyncer(_stateChangeDir, _syncType, _stateSyncerMempoolTxnSyncLimit)
+		stateChangeSyncer = NewStateChangeSyncer(config.StateChangeDir, config.SyncType, config.StateSyncerMempoolTxnSyncLimit,
+			config.StateChangeFileMaxSizeBytes)
 		eventManager.OnStateSyncerOperation(stateChangeSyncer._handleStateSyncerOperation)
 		eventManager.OnStateSyncerFlushed(stateChangeSyncer._handleStateSyncerFlush)
 	}
@@ -455,17 +596,19 @@ func NewServer(
 	shouldRestart := false
 	isChecksumIssue := false
 	archivalMode := false
-	if _hyperSync {
+	if config.HyperSync {
 		_snapshot, err, shouldRestart, isChecksumIssue = NewSnapshot(
 			_db,
-			_snapshotBlockHeightPeriod,
+			config.SnapshotBlockHeightPeriod,
 			false,
 			// If we aren't forcing the checksum to be correct, we set disableChecksum on the snapshot to true.
-			// This allows us to skip unnecessary checksum calculations.
-			!_forceChecksum,
-			_params,
-			_disableEncoderMigrations,
-			_hypersyncMaxQueueSize,
+			// This allows us to skip unnecessary checksum calculations. The continuous checksum needs the
+			// checksum to be updated on every flush, so it enables it regardless.
+			!config.ForceChecksum && !config.ContinuousChecksum,
+			config.Params,
+			config.DisableEncoderMigrations,
+			config.HypersyncMaxQueueSize,
+			config.HypersyncChunkApplyWorkers,
 			eventManager,
 		)
 		if err != nil {
@@ -473,30 +616,94 @@ func NewServer(
 		}
 	}
 
+	// The continuous checksum records the state checksum after every block. Like the state commitment, the
+	// config is validated to only enable it with hypersync.
+	if config.ContinuousChecksum {
+		if err = _snapshot.EnableContinuousChecksum(); err != nil {
+			return nil, errors.Wrapf(err, "NewServer: Problem enabling continuous checksum"), false
+		}
+	}
+
+	// The state commitment is updated alongside the snapshot's ancestral records and checksum. The config is
+	// validated to only enable it with hypersync, so the snapshot is always set here.
+	if config.StateCommitment {
+		if err = _snapshot.EnableStateCommitment(); err != nil {
+			return nil, errors.Wrapf(err, "NewServer: Problem enabling state commitment"), false
+		}
+	}
+
+	// The state cache is kept consistent by the snapshot's DB write hooks, so it's only used with hypersync.
+	if _snapshot != nil {
+		_snapshot.StateCache = NewStateCache(config.StateCacheMaxBytes)
+	}
+
+	// A view flush that was split into batches and interrupted leaves the DB with part of the flush, which we
+	// can't recover from. See block_view_flush_batching.go.
+	if err = DBCheckNoUtxoViewFlushInProgress(_db); err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem checking for an interrupted flush"), false
+	}
+
+	// The follow and post association counts aren't part of the state, so a node that predates them builds them
+	// from its follows and post associations.
+	if postgres == nil {
+		if err = DbBuildFollowCountsIfMissing(_db); err != nil {
+			return nil, errors.Wrapf(err, "NewServer: Problem building follow counts"), false
+		}
+		if err = DbBuildPostAssociationCountsIfMissing(_db); err != nil {
+			return nil, errors.Wrapf(err, "NewServer: Problem building post association counts"), false
+		}
+	}
+
 	// We only set archival mode true if we're a hypersync node.
-	if IsNodeArchival(_syncType) {
+	if IsNodeArchival(config.SyncType) {
 		archivalMode = true
 	}
 
 	// Create an empty Server object here so we can pass a reference to it to the
 	// ConnectionManager.
 	srv := &Server{
-		DisableNetworking:            _disableNetworking,
-		ReadOnlyMode:                 _readOnlyMode,
-		IgnoreInboundPeerInvMessages: _ignoreInboundPeerInvMessages,
+		DisableNetworking:            config.DisableNetworking,
+		ReadOnlyMode:                 config.ReadOnlyMode,
+		IgnoreInboundPeerInvMessages: config.IgnoreInboundPeerInvMessages,
 		snapshot:                     _snapshot,
 		nodeMessageChannel:           _nodeMessageChan,
-		forceChecksum:                _forceChecksum,
+		forceChecksum:                config.ForceChecksum,
 		AddrMgr:                      _desoAddrMgr,
-		params:                       _params,
-		connectIps:                   _connectIps,
-		datadir:                      _dataDir,
+		params:                       config.Params,
+		connectIps:                   config.ConnectIPs,
+		datadir:                      config.DataDir,
+		txnRelayFilter:               NewTxnRelayFilter(),
+		txnSubmissionTracker:         NewTxnSubmissionTracker(txnSubmissionTimeout),
+		localTxnRebroadcastInterval:  time.Duration(config.MempoolLocalTxnRebroadcastIntervalSeconds) * time.Second,
+		txnReconciliationInterval:    time.Duration(config.TxnReconciliationIntervalMillis) * time.Millisecond,
+		compactBlockRelay:            config.CompactBlockRelay,
+		feeTelemetryInterval:         time.Duration(config.FeeTelemetryIntervalSeconds) * time.Second,
+		logger:                       NewLogger(logConfig, LogComponentServer),
 	}
 
 	if stateChangeSyncer != nil {
 		srv.stateChangeSyncer = stateChangeSyncer
 	}
 
+	for _, publicKeyString := range config.TrustedSnapshotSignerPublicKeys {
+		publicKey, err := (&bls.PublicKey{}).FromString(publicKeyString)
+		if err != nil || publicKey == nil {
+			return nil, errors.Errorf("NewServer: Invalid trusted snapshot signer public key (%v)",
+				publicKeyString), false
+		}
+		srv.trustedSnapshotSignerPublicKeys = append(srv.trustedSnapshotSignerPublicKeys, publicKey)
+	}
+
+	srv.blockInclusionFilter, err = NewBlockInclusionFilter(config.BlockInclusionExcludedTxnTypes,
+		config.BlockInclusionExcludedPublicKeys, config.BlockInclusionMinFeeRates)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem parsing block inclusion filter"), false
+	}
+	if srv.blockInclusionFilter != nil {
+		srv.logger.Infof("NewServer: Block inclusion filter: %v", srv.blockInclusionFilter)
+	}
+	srv.blockProducerDeterministicTxnShuffle = config.BlockProducerDeterministicTxnShuffle
+
 	// The same timesource is used in the chain data structure and in the connection
 	// manager. It just takes and keeps track of the median time among our peers so
 	// we can keep a consistent clock.
@@ -506,10 +713,11 @@ func NewServer(
 	timesource.AddTimeSample("my-time", time.Now())
 
 	// Create a new connection manager but note that it won't be initialized until Start().
-	_incomingMessages := make(chan *ServerMessage, _params.ServerMessageChannelSize+(_targetOutboundPeers+_maxInboundPeers)*3)
+	_incomingMessages := make(chan *ServerMessage, config.Params.ServerMessageChannelSize+(config.TargetOutboundPeers+config.MaxInboundPeers)*3)
 	_cmgr := NewConnectionManager(
-		_params, _listeners, _hyperSync, _syncType, _stallTimeoutSeconds,
-		_minFeeRateNanosPerKB, _incomingMessages, srv)
+		config.Params, _listeners, _peerDialer, config.HyperSync, config.SyncType, config.StallTimeoutSeconds,
+		config.BlockStallTimeoutSeconds, config.MinFeeRateNanosPerKB, peerRequestRateLimits, _incomingMessages, srv,
+		srv.logger.WithComponent(LogComponentConnectionManager))
 
 	// Set up the blockchain data structure. This is responsible for accepting new
 	// blocks, keeping track of the best chain, and keeping all of that state up
@@ -527,12 +735,20 @@ func NewServer(
 	eventManager.OnBlockAccepted(srv._handleBlockAccepted)
 	eventManager.OnBlockDisconnected(srv._handleBlockMainChainDisconnectedd)
 
-	_chain, err := NewBlockchain(
-		_trustedBlockProducerPublicKeys, _trustedBlockProducerStartHeight, _maxSyncBlockHeight,
-		_params, timesource, _db, postgres, eventManager, _snapshot, archivalMode, _checkpointSyncingProviders)
+	_chain, err := NewBlockchainFromNodeConfig(config, timesource, _db, postgres, eventManager, _snapshot)
 	if err != nil {
 		return nil, errors.Wrapf(err, "NewServer: Problem initializing blockchain"), true
 	}
+	if err = _chain.AddBlockCheckpoints(config.BlockCheckpoints); err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem adding block checkpoints"), false
+	}
+	_chain.SetMaxReorgDepth(config.MaxReorgDepth)
+	_chain.SetUndoDataRetentionBlocks(config.UndoDataRetentionBlocks)
+
+	// The global params history isn't part of the state, so a node that predates it starts it at its tip.
+	if err = DbBuildGlobalParamsHistoryIfMissing(_db, uint64(_chain.BlockTip().Height)); err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem building global params history"), false
+	}
 
 	headerCumWorkStr := "<nil>"
 	headerCumWork := BigintToHash(_chain.headerTip().CumWork)
@@ -544,7 +760,7 @@ func NewServer(
 	if blockCumWork != nil {
 		blockCumWorkStr = hex.EncodeToString(blockCumWork[:])
 	}
-	glog.V(1).Infof("Initialized chain: Best Header Height: %d, Header Hash: %s, Header CumWork: %s, Best Block Height: %d, Block Hash: %s, Block CumWork: %s",
+	srv.logger.V(1).Infof("Initialized chain: Best Header Height: %d, Header Hash: %s, Header CumWork: %s, Best Block Height: %d, Block Hash: %s, Block CumWork: %s",
 		_chain.headerTip().Height,
 		hex.EncodeToString(_chain.headerTip().Hash[:]),
 		headerCumWorkStr,
@@ -553,18 +769,43 @@ func NewServer(
 		blockCumWorkStr)
 
 	nodeServices := SFFullNodeDeprecated
-	if _hyperSync {
-		nodeServices |= SFHyperSync
+	if config.HyperSync {
+		nodeServices |= SFHyperSync | SFHyperSyncV2
 	}
 	if archivalMode {
 		nodeServices |= SFArchivalNode
 	}
+	if config.TxnReconciliationIntervalMillis > 0 {
+		nodeServices |= SFTxnReconciliation
+	}
+	if config.CompactBlockRelay {
+		nodeServices |= SFCompactBlocks
+	}
+	if config.FeeTelemetryIntervalSeconds > 0 {
+		nodeServices |= SFFeeTelemetry
+		srv.feeTelemetry = NewFeeTelemetryAggregator(srv.feeTelemetryInterval)
+	}
 	if _blsKeystore != nil {
 		nodeServices |= SFPosValidator
+		// Validators sign the state roots of the snapshots they serve, so that syncing nodes can
+		// check them against their trusted snapshot signers.
+		if _snapshot != nil {
+			_snapshot.SetStateRootSigner(_blsKeystore.GetSigner())
+		}
+	}
+	addrQuality, err := NewAddrQualityTracker(config.DataDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem initializing address quality tracker"), false
 	}
-	srv.networkManager = NewNetworkManager(_params, srv, _chain, _cmgr, _blsKeystore, _desoAddrMgr,
-		_connectIps, _targetOutboundPeers, _maxInboundPeers, _limitOneInboundConnectionPerIP,
-		_peerConnectionRefreshIntervalMillis, _minFeeRateNanosPerKB, nodeServices)
+	accessList, err := NewPeerAccessList(_db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem initializing peer access list"), false
+	}
+	srv.networkManager = NewNetworkManager(config.Params, srv, _chain, _cmgr, _blsKeystore, _desoAddrMgr, addrQuality,
+		accessList,
+		config.ConnectIPs, config.TargetOutboundPeers, config.MaxInboundPeers, config.LimitOneInboundConnectionPerIP,
+		config.PeerConnectionRefreshIntervalMillis, config.MinFeeRateNanosPerKB, nodeServices,
+		srv.logger.WithComponent(LogComponentNetworkManager))
 
 	if srv.stateChangeSyncer != nil {
 		srv.stateChangeSyncer.BlockHeight = uint64(_chain.headerTip().Height)
@@ -572,9 +813,9 @@ func NewServer(
 
 	// Create a mempool to store transactions until they're ready to be mined into
 	// blocks.
-	_mempool := NewDeSoMempool(_chain, _rateLimitFeerateNanosPerKB,
-		_minFeeRateNanosPerKB, _blockCypherAPIKey, _runReadOnlyUtxoViewUpdater, _dataDir,
-		_mempoolDumpDir, false)
+	_mempool := NewDeSoMempool(_chain, config.RateLimitFeerateNanosPerKB,
+		config.MinFeeRateNanosPerKB, config.BlockCypherAPIKey, config.RunReadOnlyUtxoViewUpdater, config.DataDir,
+		config.MempoolDumpDir, false)
 
 	// Initialize the PoS mempool. We need to initialize a best-effort UtxoView based on the current
 	// known state of the chain. This will all be overwritten as we process blocks later on.
@@ -590,20 +831,29 @@ func NewServer(
 	}
 	_posMempool := NewPosMempool()
 	err = _posMempool.Init(
-		_params,
+		config.Params,
 		currentGlobalParamsEntry,
 		currentUtxoView,
 		uint64(_chain.blockTip().Height),
-		_mempoolDumpDir,
-		_mempoolDumpDir == "", // If no mempool dump dir is set, then the mempool will be in memory only
-		_mempoolBackupIntervalMillis,
+		config.MempoolDumpDir,
+		config.MempoolDumpDir == "", // If no mempool dump dir is set, then the mempool will be in memory only
+		config.MempoolBackupIntervalMillis,
 		[]*MsgDeSoBlock{latestBlock},
-		_mempoolMaxValidationViewConnects,
-		_transactionValidationRefreshIntervalMillis,
+		config.MempoolMaxValidationViewConnects,
+		config.TransactionValidationRefreshIntervalMillis,
+		config.MempoolMaxSizeBytes,
+		config.MempoolMaxQueuedTxnsPerPublicKey,
+		config.MempoolValidationWorkers,
+		config.MempoolNonLocalTxnTTLSeconds,
 	)
 	if err != nil {
 		return nil, errors.Wrapf(err, "NewServer: Problem initializing PoS mempool"), true
 	}
+	_posMempool.SetPublicKeyQuota(config.MempoolPublicKeyQuota)
+	_posMempool.OnLocalTxnDropped(func(event *LocalTxnDroppedEvent) {
+		srv.logger.Warningf("Server: Local transaction %v was dropped from the mempool without being confirmed: %v, "+
+			"error: %v", event.TxnHash, event.Reason, event.Err)
+	})
 
 	// Useful for debugging. Every second, it outputs the contents of the mempool
 	// and the contents of the addrmanager.
@@ -611,16 +861,16 @@ func NewServer(
 		go func() {
 			time.Sleep(3 * time.Second)
 			for {
-				glog.V(2).Infof("Current mempool txns: ")
+				srv.logger.V(2).Infof("Current mempool txns: ")
 				counter := 0
 				for kk, mempoolTx := range _mempool.poolMap {
 					kkCopy := kk
-					glog.V(2).Infof("\t%d: < %v: %v >", counter, &kkCopy, mempoolTx)
+					srv.logger.V(2).Infof("\t%d: < %v: %v >", counter, &kkCopy, mempoolTx)
 					counter++
 				}
-				glog.V(2).Infof("Current addrs: ")
+				srv.logger.V(2).Infof("Current addrs: ")
 				for ii, na := range srv.cmgr.AddrMgr.GetAllAddrs() {
-					glog.V(2).Infof("Addr %d: <%s:%d>", ii, na.IP.String(), na.Port)
+					srv.logger.V(2).Infof("Addr %d: <%s:%d>", ii, na.IP.String(), na.Port)
 				}
 				time.Sleep(1 * time.Second)
 			}
@@ -630,17 +880,18 @@ func NewServer(
 	// Initialize the BlockProducer
 	// TODO(miner): Should figure out a way to get this into main.
 	var _blockProducer *DeSoBlockProducer
-	glog.V(1).Infof("NewServer: Starting Block Producer: %d", _maxBlockTemplatesToCache)
-	if _maxBlockTemplatesToCache > 0 {
+	srv.logger.V(1).Infof("NewServer: Starting Block Producer: %d", config.MaxBlockTemplatesToCache)
+	if config.MaxBlockTemplatesToCache > 0 {
 		_blockProducer, err = NewDeSoBlockProducer(
-			_minBlockUpdateIntervalSeconds, _maxBlockTemplatesToCache,
-			_blockProducerSeed,
+			config.MinBlockUpdateIntervalSeconds, config.MaxBlockTemplatesToCache,
+			config.BlockProducerSeed,
 			_mempool, _chain,
-			_params, postgres)
+			config.Params, postgres, srv.txnRelayFilter,
+			srv.blockProducerDeterministicTxnShuffle)
 		if err != nil {
 			panic(err)
 		}
-		glog.V(1).Infof("NewServer: Initiating block producer gofund")
+		srv.logger.V(1).Infof("NewServer: Initiating block producer gofund")
 		go func() {
 			_blockProducer.Start()
 		}()
@@ -648,32 +899,37 @@ func NewServer(
 
 	// TODO(miner): Make the miner its own binary and pull it out of here.
 	// Don't start the miner unless miner public keys are set.
-	if _numMiningThreads <= 0 {
-		_numMiningThreads = uint64(runtime.NumCPU())
+	numMiningThreads := config.NumMiningThreads
+	if numMiningThreads <= 0 {
+		numMiningThreads = uint64(runtime.NumCPU())
 	}
-	_miner, err := NewDeSoMiner(_minerPublicKeys, uint32(_numMiningThreads), _blockProducer, _params)
+	_miner, err := NewDeSoMiner(config.MinerPublicKeys, uint32(numMiningThreads), _blockProducer, config.Params)
 	if err != nil {
 		return nil, errors.Wrapf(err, "NewServer: "), true
 	}
 	// If we only want to sync to a specific block height, we would disable the miner.
-	// _maxSyncBlockHeight is used for development.
-	if _maxSyncBlockHeight > 0 {
+	// config.MaxSyncBlockHeight is used for development.
+	if config.MaxSyncBlockHeight > 0 {
 		_miner = nil
 	}
 
 	// Only initialize the FastHotStuffConsensus if the node is a validator with a BLS keystore
 	if _blsKeystore != nil {
 		srv.fastHotStuffConsensus = NewFastHotStuffConsensus(
-			_params,
+			config.Params,
 			srv.networkManager,
 			_chain,
 			_posMempool,
 			_blsKeystore.GetSigner(),
+			srv.txnRelayFilter,
+			srv.blockInclusionFilter,
+			srv.blockProducerDeterministicTxnShuffle,
+			srv.logger.WithComponent(LogComponentConsensus),
 		)
 		// On testnet, if the node is configured to be a PoW block producer, and it is configured
 		// to be also a PoS validator, then we attach block mined listeners to the miner to kick
 		// off the PoS consensus once the miner is done.
-		if _isRegtest && _params.NetworkType == NetworkType_TESTNET && _miner != nil && _blockProducer != nil {
+		if config.Regtest && config.Params.NetworkType == NetworkType_TESTNET && _miner != nil && _blockProducer != nil {
 			_miner.AddBlockMinedListener(srv.submitRegtestValidatorRegistrationTxns)
 		}
 	}
@@ -686,6 +942,7 @@ func NewServer(
 	srv.miner = _miner
 	srv.blockProducer = _blockProducer
 	srv.incomingMessages = _incomingMessages
+	srv.messageLanes = newServerMessageLanes(_incomingMessages, uint32(cap(_incomingMessages)), config.TxnMessageWorkers)
 	// Make this hold a multiple of what we hold for individual peers.
 	srv.inventoryBeingProcessed = *lru.NewSet[InvVect](maxKnownInventory)
 	srv.requestTimeoutSeconds = 10
@@ -719,12 +976,12 @@ func NewServer(
 		if stateChangeSyncer != nil {
 			stateChangeSyncer.Reset()
 		}
-		if !_forceChecksum && isChecksumIssue {
-			glog.Warningf(CLog(Yellow, "NewServer: Not forcing a rollback to the last snapshot epoch even though the"+
+		if !config.ForceChecksum && isChecksumIssue {
+			srv.logger.Warningf(CLog(Yellow, "NewServer: Not forcing a rollback to the last snapshot epoch even though the"+
 				"node was not closed properly last time."))
 			shouldRestart = false
 		} else {
-			glog.Errorf(CLog(Red, "NewServer: Forcing a rollback to the last snapshot epoch because node was not closed "+
+			srv.logger.Errorf(CLog(Red, "NewServer: Forcing a rollback to the last snapshot epoch because node was not closed "+
 				"properly last time"))
 			return nil, errors.Wrapf(err, "NewServer: Restart required"), true
 		}
@@ -734,7 +991,7 @@ func NewServer(
 }
 
 func (srv *Server) _handleGetHeaders(pp *Peer, msg *MsgDeSoGetHeaders) {
-	glog.V(1).Infof("Server._handleGetHeadersMessage: called with locator: (%v), "+
+	srv.logger.V(1).Infof("Server._handleGetHeadersMessage: called with locator: (%v), "+
 		"stopHash: (%v) from Peer %v", msg.BlockLocator, msg.StopHash, pp)
 
 	// Find the most recent known block in the best block chain based
@@ -762,7 +1019,7 @@ func (srv *Server) _handleGetHeaders(pp *Peer, msg *MsgDeSoGetHeaders) {
 		TipHash:   blockTip.Hash,
 		TipHeight: blockTip.Height,
 	}, false)
-	glog.V(2).Infof("Server._handleGetHeadersMessage: Replied to GetHeaders request "+
+	srv.logger.V(2).Infof("Server._handleGetHeadersMessage: Replied to GetHeaders request "+
 		"with response headers: (%v), tip hash (%v), tip height (%d) from Peer %v",
 		headers, blockTip.Hash, blockTip.Height, pp)
 }
@@ -772,6 +1029,10 @@ func (srv *Server) _handleGetHeaders(pp *Peer, msg *MsgDeSoGetHeaders) {
 // we will request a snapshot data chunk from them. Otherwise, we will assign a
 // new prefix to that peer.
 func (srv *Server) GetSnapshot(pp *Peer) {
+	if srv.HyperSyncProgress.UseFormatV2 {
+		srv.GetSnapshotChunksV2(pp)
+		return
+	}
 
 	// Start the timer to measure how much time passes from a GetSnapshot msg to
 	// a SnapshotData message.
@@ -797,7 +1058,7 @@ func (srv *Server) GetSnapshot(pp *Peer) {
 			syncingPrefix = true
 			break
 		} else {
-			glog.V(1).Infof("GetSnapshot: switching peers on prefix (%v), previous peer ID (%v) "+
+			srv.logger.V(1).Infof("GetSnapshot: switching peers on prefix (%v), previous peer ID (%v) "+
 				"current peer ID (%v)", prefixProgress.Prefix, prefixProgress.PrefixSyncPeer.ID, pp.ID)
 			// TODO: Should disable the previous sync peer here somehow
 
@@ -832,7 +1093,7 @@ func (srv *Server) GetSnapshot(pp *Peer) {
 		}
 		// If no prefix was found, we error and return because the state is already synced.
 		if !syncingPrefix {
-			glog.Errorf("Server.GetSnapshot: Error selecting a prefix for peer %v "+
+			srv.logger.Errorf("Server.GetSnapshot: Error selecting a prefix for peer %v "+
 				"all prefixes are synced", pp)
 			return
 		}
@@ -842,7 +1103,7 @@ func (srv *Server) GetSnapshot(pp *Peer) {
 	go func() {
 		srv.snapshot.operationQueueSemaphore <- struct{}{}
 		// Now send a message to the peer to fetch the snapshot chunk.
-		glog.V(2).Infof("Server.GetSnapshot: Sending a GetSnapshot message to peer (%v) "+
+		srv.logger.V(2).Infof("Server.GetSnapshot: Sending a GetSnapshot message to peer (%v) "+
 			"with Prefix (%v) and SnapshotStartEntry (%v)", pp, prefix, lastReceivedKey)
 		pp.AddDeSoMessage(&MsgDeSoGetSnapshot{
 			SnapshotStartKey: lastReceivedKey,
@@ -850,13 +1111,66 @@ func (srv *Server) GetSnapshot(pp *Peer) {
 	}()
 }
 
+// GetSnapshotChunksV2 is used for requesting chunks in the v2 snapshot format. Until we know the state
+// root, we only request the first chunk, and only from pp, which is the sync peer. The response tells us
+// the state root, which we then use to verify every chunk. Once we have it, we request a chunk from every
+// peer that supports SFHyperSyncV2 and doesn't already have a request in flight.
+func (srv *Server) GetSnapshotChunksV2(pp *Peer) {
+	progress := &srv.HyperSyncProgress
+	if progress.StateRoot == nil {
+		if len(progress.ChunksInFlight) != 0 {
+			return
+		}
+		if !pp.serviceFlags.HasService(SFHyperSyncV2) {
+			srv.logger.Errorf("Server.GetSnapshotChunksV2: Peer %v doesn't support the v2 snapshot format, "+
+				"waiting for a new sync peer", pp)
+			return
+		}
+		progress.chunksToRetry = nil
+		progress.nextChunkIndex = 1
+		srv.sendGetSnapshotChunkV2(pp, 0)
+		return
+	}
+
+	peers := append([]*Peer{pp}, srv.cmgr.GetAllPeers()...)
+	for _, peer := range peers {
+		if !peer.Connected() || !peer.serviceFlags.HasService(SFHyperSyncV2) {
+			continue
+		}
+		if _, exists := progress.ChunksInFlight[peer.ID]; exists {
+			continue
+		}
+		chunkIndex, exists := progress.popChunkToRequest()
+		if !exists {
+			return
+		}
+		srv.sendGetSnapshotChunkV2(peer, chunkIndex)
+	}
+}
+
+func (srv *Server) sendGetSnapshotChunkV2(pp *Peer, chunkIndex uint64) {
+	srv.HyperSyncProgress.ChunksInFlight[pp.ID] = chunkIndex
+	// As in GetSnapshot, we pace the requests with the operationQueueSemaphore.
+	go func() {
+		srv.snapshot.operationQueueSemaphore <- struct{}{}
+		srv.logger.V(2).Infof("Server.sendGetSnapshotChunkV2: Sending a GetSnapshot message to peer (%v) "+
+			"with ChunkIndex (%v)", pp, chunkIndex)
+		pp.AddDeSoMessage(&MsgDeSoGetSnapshot{
+			// The start key is unused in v2, but it must be non-empty to pass validation.
+			SnapshotStartKey:      StatePrefixes.StatePrefixesList[0],
+			SnapshotFormatVersion: SnapshotFormatVersion2,
+			ChunkIndex:            chunkIndex,
+		}, false)
+	}()
+}
+
 // GetBlocksToStore is part of the archival mode, which makes the node download all historical blocks after completing
 // hypersync. We will go through all blocks corresponding to the snapshot and download the blocks.
 func (srv *Server) GetBlocksToStore(pp *Peer) {
-	glog.V(2).Infof("GetBlocksToStore: Calling for peer (%v)", pp)
+	srv.logger.V(2).Infof("GetBlocksToStore: Calling for peer (%v)", pp)
 
 	if srv.blockchain.ChainState() != SyncStateSyncingHistoricalBlocks {
-		glog.Errorf("GetBlocksToStore: Called even though all blocks have already been downloaded. This " +
+		srv.logger.Errorf("GetBlocksToStore: Called even though all blocks have already been downloaded. This " +
 			"shouldn't happen.")
 		return
 	}
@@ -909,7 +1223,7 @@ func (srv *Server) GetBlocksToStore(pp *Peer) {
 				HashList: hashList,
 			}, false)
 
-			glog.V(1).Infof("GetBlocksToStore: Downloading blocks to store for header %v from peer %v",
+			srv.logger.V(1).Infof("GetBlocksToStore: Downloading blocks to store for header %v from peer %v",
 				blockNode.Header, pp)
 			return
 		}
@@ -921,8 +1235,9 @@ func (srv *Server) GetBlocksToStore(pp *Peer) {
 
 // GetBlocks computes what blocks we need to fetch and asks for them from the
 // corresponding peer. It is typically called after we have exited
-// SyncStateSyncingHeaders.
-func (srv *Server) RequestBlocksUpToHeight(pp *Peer, maxHeight int) {
+// SyncStateSyncingHeaders. The cid is the CorrelationID of the message that
+// caused the request, if any, and is attached to the GetBlocks message.
+func (srv *Server) RequestBlocksUpToHeight(pp *Peer, maxHeight int, cid CorrelationID) {
 	numBlocksToFetch := srv.getMaxBlocksInFlight(pp) - len(pp.requestedBlocks)
 	blockNodesToFetch := srv.blockchain.GetBlockNodesToFetch(
 		numBlocksToFetch, maxHeight, pp.requestedBlocks,
@@ -940,9 +1255,10 @@ func (srv *Server) RequestBlocksUpToHeight(pp *Peer, maxHeight int) {
 		pp.requestedBlocks[*node.Hash] = true
 	}
 
-	pp.AddDeSoMessage(&MsgDeSoGetBlocks{HashList: hashList}, false)
+	pp.AddDeSoMessageWithCorrelationID(&MsgDeSoGetBlocks{HashList: hashList}, false, cid)
 
-	glog.V(1).Infof("GetBlocks: Downloading %d blocks from header %v to header %v from peer %v",
+	srv.logger.V(1).Infof("GetBlocks: [%v] Downloading %d blocks from header %v to header %v from peer %v",
+		cid,
 		len(blockNodesToFetch),
 		blockNodesToFetch[0].Header,
 		blockNodesToFetch[len(blockNodesToFetch)-1].Header,
@@ -951,7 +1267,8 @@ func (srv *Server) RequestBlocksUpToHeight(pp *Peer, maxHeight int) {
 }
 
 // RequestBlocksByHash requests the exact blocks specified by the block hashes from the peer.
-func (srv *Server) RequestBlocksByHash(pp *Peer, blockHashes []*BlockHash) {
+// The cid is attached to the GetBlocks message like in RequestBlocksUpToHeight.
+func (srv *Server) RequestBlocksByHash(pp *Peer, blockHashes []*BlockHash, cid CorrelationID) {
 	numBlocksToFetch := srv.getMaxBlocksInFlight(pp) - len(pp.requestedBlocks)
 	if numBlocksToFetch <= 0 {
 		return
@@ -971,9 +1288,9 @@ func (srv *Server) RequestBlocksByHash(pp *Peer, blockHashes []*BlockHash) {
 		return
 	}
 
-	pp.AddDeSoMessage(&MsgDeSoGetBlocks{HashList: blocksToRequest}, false)
+	pp.AddDeSoMessageWithCorrelationID(&MsgDeSoGetBlocks{HashList: blocksToRequest}, false, cid)
 
-	glog.V(1).Infof("GetBlockByHash: Downloading %d blocks from peer %v", len(blocksToRequest), pp)
+	srv.logger.V(1).Infof("GetBlockByHash: [%v] Downloading %d blocks from peer %v", cid, len(blocksToRequest), pp)
 }
 
 func (srv *Server) getMaxBlocksInFlight(pp *Peer) int {
@@ -998,6 +1315,11 @@ func (srv *Server) getMaxBlocksInFlight(pp *Peer) int {
 // If the header height does not match the checkpoint block height, we should disconnect the peer.
 // Otherwise, return true.
 func (srv *Server) shouldVerifySignatures(header *MsgDeSoHeader, isHeaderChain bool) (_verifySignatures bool, _shouldDisconnect bool) {
+	// Blocks that are ancestors of a block checkpoint are vouched for by the checkpoint, so there is no
+	// need to verify their signatures.
+	if !isHeaderChain && srv.blockchain.IsAncestorOfBlockCheckpoint(header) {
+		return false, false
+	}
 	// For PoW headers, there is no signature to verify in the header, so we return true
 	// just to be safe, but it has no impact on the syncing.
 	// For PoW blocks, we verify signatures if we're not syncing.
@@ -1062,12 +1384,12 @@ func (srv *Server) getCheckpointSyncingStatus(isHeaders bool) string {
 	return fmt.Sprintf("<Checkpoint block %v seen>", checkpointBlockInfo.String())
 }
 
-func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
+func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle, cid CorrelationID) {
 	printHeight := pp.StartingBlockHeight()
 	if uint64(srv.blockchain.headerTip().Height) > printHeight {
 		printHeight = uint64(srv.blockchain.headerTip().Height)
 	}
-	glog.Infof(CLog(Yellow, fmt.Sprintf("Received header bundle with %v headers "+
+	srv.logger.Infof(CLog(Yellow, fmt.Sprintf("Received header bundle with %v headers "+
 		"in state %s from peer %v. Downloaded ( %v / %v ) total headers. Checkpoint syncing status: %v",
 		len(msg.Headers), srv.blockchain.chainState(), pp,
 		srv.blockchain.headerTip().Header.Height, printHeight, srv.getCheckpointSyncingStatus(true))))
@@ -1094,7 +1416,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 		if srv.blockchain.HasHeader(headerHash) {
 			if srv.blockchain.isSyncing() {
 
-				glog.Warningf("Server._handleHeaderBundle: Duplicate header %v received from peer %v "+
+				srv.logger.Warningf("Server._handleHeaderBundle: Duplicate header %v received from peer %v "+
 					"in state %s. Local header tip height %d "+
 					"hash %s with duplicate %v",
 					headerHash,
@@ -1119,7 +1441,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 		// check if we need to verify signatures
 		verifySignatures, shouldDisconnect := srv.shouldVerifySignatures(headerReceived, true)
 		if shouldDisconnect {
-			glog.Errorf("Server._handleHeaderBundle: Disconnecting peer %v in state %s because a mismatch was "+
+			srv.logger.Errorf("Server._handleHeaderBundle: Disconnecting peer %v in state %s because a mismatch was "+
 				"found between the received header height %v does not match the checkpoint block info %v",
 				pp, srv.blockchain.chainState(), headerReceived.Height,
 				srv.blockchain.GetCheckpointBlockInfo().String())
@@ -1133,7 +1455,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 
 		numLogHeaders := 2000
 		if ii%numLogHeaders == 0 {
-			glog.Infof(CLog(Cyan, fmt.Sprintf("Server._handleHeaderBundle: Processed header ( %v / %v ) from Peer %v",
+			srv.logger.Infof(CLog(Cyan, fmt.Sprintf("Server._handleHeaderBundle: Processed header ( %v / %v ) from Peer %v",
 				headerReceived.Height,
 				msg.Headers[len(msg.Headers)-1].Height,
 				pp)))
@@ -1144,7 +1466,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 		// a GetHeaders request, the peer should know enough to never send us
 		// unconnectedTxns unless it's misbehaving.
 		if err != nil || isOrphan {
-			glog.Errorf("Server._handleHeaderBundle: Disconnecting from peer %v in state %s "+
+			srv.logger.Errorf("Server._handleHeaderBundle: Disconnecting from peer %v in state %s "+
 				"because error occurred processing header: %v, isOrphan: %v",
 				pp, srv.blockchain.chainState(), err, isOrphan)
 
@@ -1191,7 +1513,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 		currentHeaderTipHeight := uint64(srv.blockchain.headerTip().Height)
 
 		if srv.blockchain.chainState() == SyncStateSyncingSnapshot {
-			glog.V(1).Infof("Server._handleHeaderBundle: *Syncing* state starting at "+
+			srv.logger.V(1).Infof("Server._handleHeaderBundle: *Syncing* state starting at "+
 				"height %v from peer %v", srv.blockchain.headerTip().Header.Height, pp)
 
 			// If node is a hyper sync node and we haven't finished syncing state yet, we will kick off state sync.
@@ -1199,11 +1521,11 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 				expectedSnapshotHeight := srv.computeExpectedSnapshotHeight(currentHeaderTipHeight)
 				srv.blockchain.snapshot.Migrations.CleanupMigrations(expectedSnapshotHeight)
 
-				if len(srv.HyperSyncProgress.PrefixProgress) != 0 {
+				if len(srv.HyperSyncProgress.PrefixProgress) != 0 || srv.HyperSyncProgress.UseFormatV2 {
 					srv.GetSnapshot(pp)
 					return
 				}
-				glog.Infof(CLog(Magenta, fmt.Sprintf("Initiating HyperSync after finishing downloading headers. Node "+
+				srv.logger.Infof(CLog(Magenta, fmt.Sprintf("Initiating HyperSync after finishing downloading headers. Node "+
 					"will quickly download a snapshot of the blockchain taken at height (%v). HyperSync will sync each "+
 					"prefix of the node's KV database. Connected peer (%v). Note: State sync is a new feature and hence "+
 					"might contain some unexpected behavior. If you see an issue, please report it in DeSo Github "+
@@ -1212,17 +1534,17 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 				// Clean all the state prefixes from the node db so that we can populate it with snapshot entries.
 				// When we start a node, it first loads a bunch of seed transactions in the genesis block. We want to
 				// remove these entries from the db because we will receive them during state sync.
-				glog.Infof(CLog(Magenta, "HyperSync: deleting all state records. This can take a while."))
+				srv.logger.Infof(CLog(Magenta, "HyperSync: deleting all state records. This can take a while."))
 				shouldErase, err := DBDeleteAllStateRecords(srv.blockchain.db)
 				if err != nil {
-					glog.Errorf(CLog(Red, fmt.Sprintf("Server._handleHeaderBundle: problem while deleting state "+
+					srv.logger.Errorf(CLog(Red, fmt.Sprintf("Server._handleHeaderBundle: problem while deleting state "+
 						"records, error: %v", err)))
 				}
 				if shouldErase {
 					if srv.nodeMessageChannel != nil {
 						srv.nodeMessageChannel <- NodeErase
 					}
-					glog.Errorf(CLog(Red, fmt.Sprintf("Server._handleHeaderBundle: Records were found in the node "+
+					srv.logger.Errorf(CLog(Red, fmt.Sprintf("Server._handleHeaderBundle: Records were found in the node "+
 						"directory, while trying to resync. Now erasing the node directory and restarting the node. "+
 						"That's faster than manually expunging all records from the database.")))
 					return
@@ -1241,18 +1563,23 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 				}
 				srv.HyperSyncProgress.PrefixProgress = []*SyncPrefixProgress{}
 				srv.HyperSyncProgress.Completed = false
+				// If the peer serves v2 snapshots and we have trusted snapshot signers, we download the snapshot
+				// in the v2 format, which lets us verify each chunk on receipt and download chunks from multiple
+				// peers in parallel. Without a trusted signer, we fall back to the v1 format from the sync peer.
+				srv.HyperSyncProgress.resetChunkProgress(pp.serviceFlags.HasService(SFHyperSyncV2) &&
+					len(srv.trustedSnapshotSignerPublicKeys) > 0)
 				go srv.HyperSyncProgress.PrintLoop()
 
 				// Initialize the snapshot checksum so that it's reset. It got modified during chain initialization
 				// when processing seed transaction from the genesis block. So we need to clear it.
 				srv.snapshot.Checksum.ResetChecksum()
 				if err = srv.snapshot.Checksum.SaveChecksum(); err != nil {
-					glog.Errorf("Server._handleHeaderBundle: Problem saving snapshot to database, error (%v)", err)
+					srv.logger.Errorf("Server._handleHeaderBundle: Problem saving snapshot to database, error (%v)", err)
 				}
 				// Reset the migrations along with the main checksum.
 				srv.snapshot.Migrations.ResetChecksums()
 				if err = srv.snapshot.Migrations.SaveMigrations(); err != nil {
-					glog.Errorf("Server._handleHeaderBundle: Problem saving migration checksums to database, error (%v)", err)
+					srv.logger.Errorf("Server._handleHeaderBundle: Problem saving migration checksums to database, error (%v)", err)
 				}
 
 				// Start a timer for hyper sync. This keeps track of how long hyper sync takes in total.
@@ -1268,7 +1595,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 		// hypersync and the node has the archival mode turned on, we might need to download historical blocks.
 		// We'll check if there are any outstanding historical blocks to download.
 		if srv.blockchain.checkArchivalMode() {
-			glog.V(1).Infof("Server._handleHeaderBundle: Syncing historical blocks because node is in " +
+			srv.logger.V(1).Infof("Server._handleHeaderBundle: Syncing historical blocks because node is in " +
 				"archival mode.")
 			srv.blockchain.downloadingHistoricalBlocks = true
 			srv.GetBlocksToStore(pp)
@@ -1294,12 +1621,12 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 			// has. We can do that in this case since this usually happens during sync
 			// before we've made any GetBlocks requests to the peer.
 			blockTip := srv.blockchain.blockTip()
-			glog.V(1).Infof("Server._handleHeaderBundle: *Syncing* blocks starting at "+
+			srv.logger.V(1).Infof("Server._handleHeaderBundle: *Syncing* blocks starting at "+
 				"height %d out of %d from peer %v",
 				blockTip.Header.Height+1, msg.TipHeight, pp)
 			maxHeight := -1
 			srv.blockchain.updateCheckpointBlockInfo()
-			srv.RequestBlocksUpToHeight(pp, maxHeight)
+			srv.RequestBlocksUpToHeight(pp, maxHeight, cid)
 			return
 		}
 
@@ -1315,7 +1642,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 			// Doing things this way makes it so that when we request blocks we
 			// are 100% positive the peer has them.
 			if !srv.blockchain.HasHeader(msg.TipHash) {
-				glog.V(1).Infof("Server._handleHeaderBundle: Peer's tip is not in our "+
+				srv.logger.V(1).Infof("Server._handleHeaderBundle: Peer's tip is not in our "+
 					"blockchain so not requesting anything else from them. Our block "+
 					"tip %v, their tip %v:%d, peer: %v",
 					srv.blockchain.blockTip().Header, msg.TipHash, msg.TipHeight, pp)
@@ -1327,16 +1654,16 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 			// them should be available as long as they don't exceed the peer's
 			// tip height.
 			blockTip := srv.blockchain.blockTip()
-			glog.V(1).Infof("Server._handleHeaderBundle: *Downloading* blocks starting at "+
+			srv.logger.V(1).Infof("Server._handleHeaderBundle: *Downloading* blocks starting at "+
 				"block tip %v out of %d from peer %v",
 				blockTip.Header, msg.TipHeight, pp)
-			srv.RequestBlocksUpToHeight(pp, int(msg.TipHeight))
+			srv.RequestBlocksUpToHeight(pp, int(msg.TipHeight), cid)
 			return
 		}
 
 		// If we get here it means we have all the headers and blocks we need
 		// so there's nothing more to do.
-		glog.V(1).Infof("Server._handleHeaderBundle: Tip is up-to-date so no "+
+		srv.logger.V(1).Infof("Server._handleHeaderBundle: Tip is up-to-date so no "+
 			"need to send anything. Our block tip: %v, their tip: %v:%d, Peer: %v",
 			srv.blockchain.blockTip().Header, msg.TipHash, msg.TipHeight, pp)
 		return
@@ -1354,7 +1681,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 	lastHash, _ := msg.Headers[len(msg.Headers)-1].Hash()
 	locator, err := srv.blockchain.HeaderLocatorWithNodeHash(lastHash)
 	if err != nil {
-		glog.Warningf("Server._handleHeaderBundle: Disconnecting peer %v because "+
+		srv.logger.Warningf("Server._handleHeaderBundle: Disconnecting peer %v because "+
 			"she indicated that she has more headers but the last hash %v in "+
 			"the header bundle does not correspond to a block in our index.",
 			pp, lastHash)
@@ -1366,23 +1693,23 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 		BlockLocator: locator,
 	}, false)
 	headerTip := srv.blockchain.headerTip()
-	glog.V(1).Infof("Server._handleHeaderBundle: *Syncing* headers for blocks starting at "+
+	srv.logger.V(1).Infof("Server._handleHeaderBundle: *Syncing* headers for blocks starting at "+
 		"header tip %v out of %d from peer %v",
 		headerTip.Header, msg.TipHeight, pp)
 }
 
-func (srv *Server) _handleGetBlocks(pp *Peer, msg *MsgDeSoGetBlocks) {
-	glog.V(1).Infof("srv._handleGetBlocks: Called with message %v from Peer %v", msg, pp)
+func (srv *Server) _handleGetBlocks(pp *Peer, msg *MsgDeSoGetBlocks, cid CorrelationID) {
+	srv.logger.V(1).Infof("srv._handleGetBlocks: [%v] Called with message %v from Peer %v", cid, msg, pp)
 
 	// Let the peer handle this
-	pp.AddDeSoMessage(msg, true /*inbound*/)
+	pp.AddDeSoMessageWithCorrelationID(msg, true /*inbound*/, cid)
 }
 
 // _handleGetSnapshot gets called whenever we receive a GetSnapshot message from a peer. This means
 // a peer is asking us to send him some data from our most recent snapshot. To respond to the peer we
 // will retrieve the chunk from our main and ancestral records db and attach it to the response message.
 func (srv *Server) _handleGetSnapshot(pp *Peer, msg *MsgDeSoGetSnapshot) {
-	glog.V(1).Infof("srv._handleGetSnapshot: Called with message %v from Peer %v", msg, pp)
+	srv.logger.V(1).Infof("srv._handleGetSnapshot: Called with message %v from Peer %v", msg, pp)
 
 	// Let the peer handle this. We will delegate this message to the peer's queue of inbound messages, because
 	// fetching a snapshot chunk is an expensive operation.
@@ -1418,7 +1745,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	// If there are no db entries in the msg, we should also disconnect the peer. There should always be
 	// at least one entry sent, which is either the empty entry or the last key we've requested.
 	if srv.snapshot == nil {
-		glog.Errorf("srv._handleSnapshot: Received a snapshot message from a peer but srv.snapshot is nil. " +
+		srv.logger.Errorf("srv._handleSnapshot: Received a snapshot message from a peer but srv.snapshot is nil. " +
 			"This peer shouldn't send us snapshot messages because we didn't pass the SFHyperSync flag.")
 		pp.Disconnect("handleSnapshot: Snapshot message received but snapshot is nil")
 		return
@@ -1426,7 +1753,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 
 	// If we're not syncing then we don't need the snapshot chunk so
 	if srv.blockchain.ChainState() != SyncStateSyncingSnapshot {
-		glog.Errorf("srv._handleSnapshot: Received a snapshot message from peer but chain is not currently syncing from "+
+		srv.logger.Errorf("srv._handleSnapshot: Received a snapshot message from peer but chain is not currently syncing from "+
 			"snapshot. This means peer is most likely misbehaving so we'll disconnect them. Peer: (%v)", pp)
 		pp.Disconnect("handleSnapshot: Chain is not syncing from snapshot")
 		return
@@ -1434,13 +1761,13 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 
 	if len(msg.SnapshotChunk) == 0 {
 		// We should disconnect the peer because he is misbehaving or doesn't have the snapshot.
-		glog.Errorf("srv._handleSnapshot: Received a snapshot messages with empty snapshot chunk "+
+		srv.logger.Errorf("srv._handleSnapshot: Received a snapshot messages with empty snapshot chunk "+
 			"disconnecting misbehaving peer (%v)", pp)
 		pp.Disconnect("handleSnapshot: Empty snapshot chunk received from peer")
 		return
 	}
 
-	glog.V(1).Infof(CLog(Yellow, fmt.Sprintf("Received a snapshot message with entry keys (First entry: "+
+	srv.logger.V(1).Infof(CLog(Yellow, fmt.Sprintf("Received a snapshot message with entry keys (First entry: "+
 		"<%v>, Last entry: <%v>), (number of entries: %v), metadata (%v), and isEmpty (%v), from Peer %v",
 		msg.SnapshotChunk[0].Key, msg.SnapshotChunk[len(msg.SnapshotChunk)-1].Key, len(msg.SnapshotChunk),
 		msg.SnapshotMetadata, msg.SnapshotChunk[0].IsEmpty(), pp)))
@@ -1463,13 +1790,13 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		// TODO: Figure out how to handle header not reaching us, yet peer is telling us that the new epoch has started.
 		if srv.nodeMessageChannel != nil {
 			srv.nodeMessageChannel <- NodeRestart
-			glog.Infof(CLog(Yellow, fmt.Sprintf("srv._handleSnapshot: Received a snapshot metadata with height (%v) "+
+			srv.logger.Infof(CLog(Yellow, fmt.Sprintf("srv._handleSnapshot: Received a snapshot metadata with height (%v) "+
 				"which is greater than the hypersync progress height (%v). This can happen when the network entered "+
 				"a new snapshot epoch while we were syncing. The node will be restarted to retry hypersync with new epoch.",
 				msg.SnapshotMetadata.SnapshotBlockHeight, srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight)))
 			return
 		} else {
-			glog.Errorf(CLog(Red, "srv._handleSnapshot: Trying to restart the node but nodeMessageChannel is empty, "+
+			srv.logger.Errorf(CLog(Red, "srv._handleSnapshot: Trying to restart the node but nodeMessageChannel is empty, "+
 				"this should never happen."))
 			return
 		}
@@ -1479,7 +1806,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	if msg.SnapshotMetadata.SnapshotBlockHeight != srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight ||
 		!bytes.Equal(msg.SnapshotMetadata.CurrentEpochBlockHash[:], srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash[:]) {
 
-		glog.Errorf("srv._handleSnapshot: blockheight (%v) and blockhash (%v) in msg do not match the expected "+
+		srv.logger.Errorf("srv._handleSnapshot: blockheight (%v) and blockhash (%v) in msg do not match the expected "+
 			"hyper sync height (%v) and hash (%v)",
 			msg.SnapshotMetadata.SnapshotBlockHeight, msg.SnapshotMetadata.CurrentEpochBlockHash,
 			srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight, srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash)
@@ -1487,6 +1814,11 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		return
 	}
 
+	if srv.HyperSyncProgress.UseFormatV2 {
+		chunkProcessed = srv._handleSnapshotV2(pp, msg)
+		return
+	}
+
 	// First find the hyper sync progress struct that matches the received message.
 	var syncPrefixProgress *SyncPrefixProgress
 	for _, syncProgress := range srv.HyperSyncProgress.PrefixProgress {
@@ -1498,7 +1830,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	// If peer sent a message with an incorrect prefix, we should disconnect them.
 	if syncPrefixProgress == nil {
 		// We should disconnect the peer because he is misbehaving
-		glog.Errorf("srv._handleSnapshot: Problem finding appropriate sync prefix progress "+
+		srv.logger.Errorf("srv._handleSnapshot: Problem finding appropriate sync prefix progress "+
 			"disconnecting misbehaving peer (%v)", pp)
 		pp.Disconnect("handleSnapshot: Problem finding appropriate sync prefix progress")
 		return
@@ -1513,7 +1845,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = msg.SnapshotMetadata.CurrentEpochChecksumBytes
 	} else if !reflect.DeepEqual(srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes, msg.SnapshotMetadata.CurrentEpochChecksumBytes) {
 		// We should disconnect the peer because he is misbehaving
-		glog.Errorf("srv._handleSnapshot: HyperSyncProgress epoch checksum bytes does not match that received from peer, "+
+		srv.logger.Errorf("srv._handleSnapshot: HyperSyncProgress epoch checksum bytes does not match that received from peer, "+
 			"disconnecting misbehaving peer (%v)", pp)
 		pp.Disconnect("handleSnapshot: Snapshot checksum bytes do not match expected checksum bytes")
 		return
@@ -1528,14 +1860,14 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	if msg.SnapshotChunk[0].IsEmpty() {
 		// We send the empty DB entry whenever we've exhausted the prefix. It can only be the first entry in the
 		// chunk. We set chunkEmpty to true.
-		glog.Infof("srv._handleSnapshot: First snapshot chunk is empty")
+		srv.logger.Infof("srv._handleSnapshot: First snapshot chunk is empty")
 		chunkEmpty = true
 	} else if bytes.Equal(syncPrefixProgress.LastReceivedKey, syncPrefixProgress.Prefix) {
 		// If this is the first message that we're receiving for this sync progress, the first entry in the chunk
 		// is going to be equal to the prefix.
 		if !bytes.HasPrefix(msg.SnapshotChunk[0].Key, msg.Prefix) {
 			// We should disconnect the peer because he is misbehaving.
-			glog.Errorf("srv._handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix "+
+			srv.logger.Errorf("srv._handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix "+
 				"disconnecting misbehaving peer (%v)", pp)
 			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
 			pp.Disconnect("handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix")
@@ -1547,7 +1879,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		// should be identical to the first key in snapshot chunk. If it is not, then the peer either re-sent
 		// the same payload twice, a message was dropped by the network, or he is misbehaving.
 		if !bytes.Equal(syncPrefixProgress.LastReceivedKey, msg.SnapshotChunk[0].Key) {
-			glog.Errorf("srv._handleSnapshot: Received a snapshot chunk that's not in-line with the sync progress "+
+			srv.logger.Errorf("srv._handleSnapshot: Received a snapshot chunk that's not in-line with the sync progress "+
 				"disconnecting misbehaving peer (%v)", pp)
 			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
 			pp.Disconnect("handleSnapshot: Snapshot chunk not in-line with sync progress")
@@ -1564,7 +1896,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			// Make sure that all dbChunk entries have the same prefix as in the message.
 			if !bytes.HasPrefix(dbChunk[ii].Key, msg.Prefix) {
 				// We should disconnect the peer because he is misbehaving
-				glog.Errorf("srv._handleSnapshot: DBEntry key has mismatched prefix "+
+				srv.logger.Errorf("srv._handleSnapshot: DBEntry key has mismatched prefix "+
 					"disconnecting misbehaving peer (%v)", pp)
 				srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
 				pp.Disconnect("handleSnapshot: DBEntry key has mismatched prefix")
@@ -1573,7 +1905,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			// Make sure that the dbChunk is sorted increasingly.
 			if bytes.Compare(dbChunk[ii-1].Key, dbChunk[ii].Key) != -1 {
 				// We should disconnect the peer because he is misbehaving
-				glog.Errorf("srv._handleSnapshot: dbChunk entries are not sorted: first entry at index (%v) with "+
+				srv.logger.Errorf("srv._handleSnapshot: dbChunk entries are not sorted: first entry at index (%v) with "+
 					"value (%v) and second entry with index (%v) and value (%v) disconnecting misbehaving peer (%v)",
 					ii-1, dbChunk[ii-1].Key, ii, dbChunk[ii].Key, pp)
 				srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
@@ -1635,6 +1967,156 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		completedPrefixes = append(completedPrefixes, prefix)
 	}
 
+	srv._finishHyperSync(pp)
+}
+
+// _handleSnapshotV2 handles a SnapshotData message in the v2 snapshot format. Each chunk comes with a Merkle
+// proof against the snapshot state root, so we can verify the chunk on receipt regardless of which peer sent
+// it. It returns true if the chunk was passed on to ProcessSnapshotChunk, which frees the operation queue
+// semaphore.
+func (srv *Server) _handleSnapshotV2(pp *Peer, msg *MsgDeSoSnapshotData) (_chunkProcessed bool) {
+	progress := &srv.HyperSyncProgress
+
+	// Make sure that we've requested this chunk from this peer.
+	requestedChunkIndex, requested := progress.ChunksInFlight[pp.ID]
+	if !requested || msg.StateRoot == nil || msg.ChunkIndex != requestedChunkIndex {
+		srv.logger.Errorf("srv._handleSnapshotV2: Received a snapshot chunk that we didn't request, "+
+			"disconnecting misbehaving peer (%v)", pp)
+		srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: Received a snapshot chunk that we didn't request")
+		return false
+	}
+
+	// The first chunk tells us the state root. Every other chunk must have the same state root.
+	if progress.StateRoot == nil {
+		if err := srv.validateSnapshotStateRoot(msg.StateRoot); err != nil {
+			srv.logger.Errorf("srv._handleSnapshotV2: Problem validating state root (%v), disconnecting "+
+				"misbehaving peer (%v), error (%v)", msg.StateRoot, pp, err)
+			srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: Invalid snapshot state root")
+			return false
+		}
+		srv.logger.Infof(CLog(Magenta, fmt.Sprintf("HyperSync: Downloading snapshot with %v from peer %v",
+			msg.StateRoot, pp)))
+		progress.StateRoot = msg.StateRoot
+		progress.SnapshotMetadata.CurrentEpochChecksumBytes = msg.SnapshotMetadata.CurrentEpochChecksumBytes
+	} else if !progress.StateRoot.Equals(msg.StateRoot) {
+		srv.logger.Errorf("srv._handleSnapshotV2: State root (%v) doesn't match the expected state root (%v), "+
+			"disconnecting misbehaving peer (%v)", msg.StateRoot, progress.StateRoot, pp)
+		srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: Snapshot state root does not match expected state root")
+		return false
+	} else if !reflect.DeepEqual(progress.SnapshotMetadata.CurrentEpochChecksumBytes,
+		msg.SnapshotMetadata.CurrentEpochChecksumBytes) {
+		srv.logger.Errorf("srv._handleSnapshotV2: HyperSyncProgress epoch checksum bytes does not match that received "+
+			"from peer, disconnecting misbehaving peer (%v)", pp)
+		srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: Snapshot checksum bytes do not match expected checksum bytes")
+		return false
+	}
+
+	// Make sure that the chunk belongs to a state prefix, and that its entries are sorted increasingly.
+	if !isStateKey(msg.Prefix) {
+		srv.logger.Errorf("srv._handleSnapshotV2: Prefix (%v) is not a state prefix, disconnecting "+
+			"misbehaving peer (%v)", msg.Prefix, pp)
+		srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: Snapshot chunk prefix is not a state prefix")
+		return false
+	}
+	for ii, entry := range msg.SnapshotChunk {
+		if !bytes.HasPrefix(entry.Key, msg.Prefix) {
+			srv.logger.Errorf("srv._handleSnapshotV2: DBEntry key has mismatched prefix "+
+				"disconnecting misbehaving peer (%v)", pp)
+			srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: DBEntry key has mismatched prefix")
+			return false
+		}
+		if ii > 0 && bytes.Compare(msg.SnapshotChunk[ii-1].Key, entry.Key) != -1 {
+			srv.logger.Errorf("srv._handleSnapshotV2: Snapshot chunk entries are not sorted at index (%v), "+
+				"disconnecting misbehaving peer (%v)", ii, pp)
+			srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: Snapshot chunk entries are not sorted")
+			return false
+		}
+	}
+
+	// Verify the chunk against the state root.
+	chunkHash := ComputeSnapshotChunkHash(msg.SnapshotChunk)
+	if !VerifySnapshotChunkMerkleProof(progress.StateRoot, msg.ChunkIndex, chunkHash, msg.ChunkMerkleProof) {
+		srv.logger.Errorf("srv._handleSnapshotV2: Merkle proof of chunk (%v) doesn't match the state root, "+
+			"disconnecting misbehaving peer (%v)", msg.ChunkIndex, pp)
+		srv.rejectSnapshotChunkV2(pp, "handleSnapshotV2: Snapshot chunk Merkle proof is invalid")
+		return false
+	}
+
+	delete(progress.ChunksInFlight, pp.ID)
+	progress.NumChunksReceived++
+
+	// Process the DBEntries from the msg and add them to the db.
+	srv.timer.Start("Server._handleSnapshot Process Snapshot")
+	srv.snapshot.ProcessSnapshotChunk(srv.blockchain.db, &srv.blockchain.ChainLock, msg.SnapshotChunk,
+		progress.SnapshotMetadata.SnapshotBlockHeight)
+	srv.timer.End("Server._handleSnapshot Process Snapshot")
+	srv.timer.End("Server._handleSnapshot Main")
+
+	if progress.NumChunksReceived < progress.StateRoot.NumChunks {
+		srv.GetSnapshotChunksV2(pp)
+		return true
+	}
+
+	// We've received all chunks, so we're done with hyper sync. We sync the remaining blocks from the
+	// sync peer, since pp can be any peer that served us a chunk.
+	syncPeer := pp
+	if srv.SyncPeer != nil {
+		syncPeer = srv.SyncPeer
+	}
+	srv._finishHyperSync(syncPeer)
+	return true
+}
+
+// validateSnapshotStateRoot checks that the state root commits to the snapshot we expect and that it's
+// signed by one of our trusted snapshot signers.
+func (srv *Server) validateSnapshotStateRoot(stateRoot *SnapshotStateRoot) error {
+	if stateRoot.SnapshotBlockHeight != srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight ||
+		!stateRoot.CurrentEpochBlockHash.IsEqual(srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash) {
+		return fmt.Errorf("validateSnapshotStateRoot: State root height (%v) and hash (%v) don't match the "+
+			"expected height (%v) and hash (%v)", stateRoot.SnapshotBlockHeight, stateRoot.CurrentEpochBlockHash,
+			srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight,
+			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash)
+	}
+	if stateRoot.NumChunks == 0 {
+		return fmt.Errorf("validateSnapshotStateRoot: State root has no chunks")
+	}
+	if !stateRoot.IsSigned() {
+		return fmt.Errorf("validateSnapshotStateRoot: State root is not signed")
+	}
+	isTrustedSigner := false
+	for _, publicKey := range srv.trustedSnapshotSignerPublicKeys {
+		if publicKey.Eq(stateRoot.SignerPublicKey) {
+			isTrustedSigner = true
+			break
+		}
+	}
+	if !isTrustedSigner {
+		return fmt.Errorf("validateSnapshotStateRoot: State root signer (%v) is not a trusted snapshot signer",
+			stateRoot.SignerPublicKey.ToString())
+	}
+	isValid, err := stateRoot.VerifySignature()
+	if err != nil {
+		return errors.Wrapf(err, "validateSnapshotStateRoot: Problem verifying signature")
+	}
+	if !isValid {
+		return fmt.Errorf("validateSnapshotStateRoot: Invalid signature")
+	}
+	return nil
+}
+
+// rejectSnapshotChunkV2 disconnects a peer that sent us an invalid v2 snapshot chunk. The chunk we've
+// requested from the peer will be requested from another peer.
+func (srv *Server) rejectSnapshotChunkV2(pp *Peer, reason string) {
+	srv.HyperSyncProgress.releaseChunkInFlight(pp.ID)
+	pp.Disconnect(reason)
+	if srv.SyncPeer != nil && srv.SyncPeer.ID != pp.ID {
+		srv.GetSnapshotChunksV2(srv.SyncPeer)
+	}
+}
+
+// _finishHyperSync gets called once we've downloaded all snapshot chunks. It verifies the state checksum,
+// marks the blocks up to the snapshot height as processed, and starts syncing the remaining blocks from pp.
+func (srv *Server) _finishHyperSync(pp *Peer) {
 	srv.HyperSyncProgress.printChannel <- struct{}{}
 	// Wait for the snapshot thread to process all operations and print the checksum.
 	srv.snapshot.WaitForAllOperationsToFinish()
@@ -1649,24 +2131,24 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	srv.timer.Print("Server._handleSnapshot Main")
 	srv.timer.Print("HyperSync")
 	srv.snapshot.PrintChecksum("Finished hyper sync. Checksum is:")
-	glog.Infof(CLog(Magenta, fmt.Sprintf("Metadata checksum: (%v)",
+	srv.logger.Infof(CLog(Magenta, fmt.Sprintf("Metadata checksum: (%v)",
 		srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes)))
 
-	glog.Infof(CLog(Yellow, fmt.Sprintf("Best header chain %v best block chain %v",
-		srv.blockchain.bestHeaderChain[msg.SnapshotMetadata.SnapshotBlockHeight], srv.blockchain.bestChain)))
+	srv.logger.Infof(CLog(Yellow, fmt.Sprintf("Best header chain %v best block chain %v",
+		srv.blockchain.bestHeaderChain[srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight], srv.blockchain.bestChain)))
 
 	// Verify that the state checksum matches the one in HyperSyncProgress snapshot metadata.
 	// If the checksums don't match, it means that we've been interacting with a peer that was misbehaving.
 	checksumBytes, err := srv.snapshot.Checksum.ToBytes()
 	if err != nil {
-		glog.Errorf("Server._handleSnapshot: Problem getting checksum bytes, error (%v)", err)
+		srv.logger.Errorf("Server._finishHyperSync: Problem getting checksum bytes, error (%v)", err)
 	}
 	if reflect.DeepEqual(checksumBytes, srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes) {
-		glog.Infof(CLog(Green, fmt.Sprintf("Server._handleSnapshot: State checksum matched "+
+		srv.logger.Infof(CLog(Green, fmt.Sprintf("Server._finishHyperSync: State checksum matched "+
 			"what was expected!")))
 	} else {
 		// Checksums didn't match
-		glog.Errorf(CLog(Red, fmt.Sprintf("Server._handleSnapshot: The final db checksum doesn't match the "+
+		srv.logger.Errorf(CLog(Red, fmt.Sprintf("Server._finishHyperSync: The final db checksum doesn't match the "+
 			"checksum received from the peer. It is likely that HyperSync encountered some unexpected error earlier. "+
 			"You should report this as an issue on DeSo github https://github.com/deso-protocol/core. It is also possible "+
 			"that the peer is misbehaving and sent invalid snapshot chunks. In either way, we'll restart the node and "+
@@ -1681,7 +2163,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			return
 		} else {
 			// Otherwise, if forceChecksum is false, we error but then keep going.
-			glog.Errorf(CLog(Yellow, fmt.Sprintf("Server._handleSnapshot: Ignoring checksum mismatch because "+
+			srv.logger.Errorf(CLog(Yellow, fmt.Sprintf("Server._finishHyperSync: Ignoring checksum mismatch because "+
 				"--force-checksum is set to false.")))
 		}
 	}
@@ -1694,7 +2176,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	//
 	// We split the db update into batches of 10,000 block nodes to avoid a single transaction
 	// being too large and possibly causing an error in badger.
-	glog.V(0).Infof("Server._handleSnapshot: Updating snapshot block nodes in the database")
+	srv.logger.V(0).Infof("Server._finishHyperSync: Updating snapshot block nodes in the database")
 	var blockNodeBatch []*BlockNode
 	// acquire the chain lock while we update the best chain and best chain map.
 	srv.blockchain.ChainLock.Lock()
@@ -1713,7 +2195,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		}
 		err = PutHeightHashToNodeInfoBatch(srv.blockchain.db, srv.snapshot, blockNodeBatch, false /*bitcoinNodes*/, srv.eventManager)
 		if err != nil {
-			glog.Errorf("Server._handleSnapshot: Problem updating snapshot block nodes, error: (%v)", err)
+			srv.logger.Errorf("Server._finishHyperSync: Problem updating snapshot block nodes, error: (%v)", err)
 			break
 		}
 		blockNodeBatch = []*BlockNode{}
@@ -1721,17 +2203,42 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	if len(blockNodeBatch) > 0 {
 		err = PutHeightHashToNodeInfoBatch(srv.blockchain.db, srv.snapshot, blockNodeBatch, false /*bitcoinNodes*/, srv.eventManager)
 		if err != nil {
-			glog.Errorf("Server._handleSnapshot: Problem updating snapshot block nodes, error: (%v)", err)
+			srv.logger.Errorf("Server._finishHyperSync: Problem updating snapshot block nodes, error: (%v)", err)
 		}
 	}
 
-	err = PutBestHash(srv.blockchain.db, srv.snapshot, msg.SnapshotMetadata.CurrentEpochBlockHash, ChainTypeDeSoBlock, srv.eventManager)
+	err = PutBestHash(srv.blockchain.db, srv.snapshot, srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash, ChainTypeDeSoBlock, srv.eventManager)
 	if err != nil {
-		glog.Errorf("Server._handleSnapshot: Problem updating best hash, error: (%v)", err)
+		srv.logger.Errorf("Server._finishHyperSync: Problem updating best hash, error: (%v)", err)
 	}
 	// We also reset the in-memory snapshot cache, because it is populated with stale records after
 	// we've initialized the chain with seed transactions.
 	srv.snapshot.DatabaseCache = *lru.NewMap[string, []byte](DatabaseCacheSize)
+	srv.snapshot.StateCache.Purge()
+
+	// Hypersync writes the snapshot chunks directly to the DB, so we build the state commitment from the synced state.
+	if srv.snapshot.StateCommitment != nil {
+		if err = srv.snapshot.StateCommitment.Rebuild(srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash); err != nil {
+			srv.logger.Errorf("Server._finishHyperSync: Problem building state commitment, error: (%v)", err)
+		}
+	}
+
+	// Hypersync doesn't sync the follow and post association counts, so we build them from the synced state.
+	if srv.blockchain.postgres == nil {
+		if err = DbRebuildFollowCounts(srv.blockchain.db); err != nil {
+			srv.logger.Errorf("Server._finishHyperSync: Problem building follow counts, error: (%v)", err)
+		}
+		if err = DbRebuildPostAssociationCounts(srv.blockchain.db); err != nil {
+			srv.logger.Errorf("Server._finishHyperSync: Problem building post association counts, error: (%v)", err)
+		}
+	}
+
+	// Hypersync doesn't sync the global params history either, so we start it at the snapshot height.
+	if err = DbResetGlobalParamsHistory(
+		srv.blockchain.db, srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight,
+	); err != nil {
+		srv.logger.Errorf("Server._finishHyperSync: Problem starting global params history, error: (%v)", err)
+	}
 
 	// If we got here then we finished the snapshot sync so set appropriate flags.
 	srv.blockchain.syncingState = false
@@ -1745,7 +2252,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		})
 		srv.snapshot.SnapshotDbMutex.Unlock()
 		if err != nil {
-			glog.Errorf("server._handleSnapshot: Problem setting snapshot epoch metadata in snapshot db, error (%v)", err)
+			srv.logger.Errorf("server._finishHyperSync: Problem setting snapshot epoch metadata in snapshot db, error (%v)", err)
 			time.Sleep(1 * time.Second)
 			continue
 		}
@@ -1753,13 +2260,13 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	}
 
 	// Update the snapshot status in the DB.
-	srv.snapshot.Status.CurrentBlockHeight = msg.SnapshotMetadata.SnapshotBlockHeight
+	srv.snapshot.Status.CurrentBlockHeight = srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight
 	srv.snapshot.Status.SaveStatus()
 
 	// Unlock chain lock now that we're done modifying the chain state.
 	srv.blockchain.ChainLock.Unlock()
 
-	glog.Infof("server._handleSnapshot: FINAL snapshot checksum is (%v) (%v)",
+	srv.logger.Infof("server._finishHyperSync: FINAL snapshot checksum is (%v) (%v)",
 		srv.snapshot.CurrentEpochSnapshotMetadata.CurrentEpochChecksumBytes,
 		hex.EncodeToString(srv.snapshot.CurrentEpochSnapshotMetadata.CurrentEpochChecksumBytes))
 
@@ -1774,51 +2281,48 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	}
 
 	headerTip := srv.blockchain.headerTip()
-	srv.RequestBlocksUpToHeight(pp, int(headerTip.Height))
+	srv.RequestBlocksUpToHeight(pp, int(headerTip.Height), "")
 }
 
 func (srv *Server) _startSync() {
 	// Return now if we're already syncing.
 	if srv.SyncPeer != nil {
-		glog.V(2).Infof("Server._startSync: Not running because SyncPeer != nil")
+		srv.logger.V(2).Infof("Server._startSync: Not running because SyncPeer != nil")
 		return
 	}
-	glog.V(1).Infof("Server._startSync: Attempting to start sync")
+	srv.logger.V(1).Infof("Server._startSync: Attempting to start sync")
 
 	// Set our tip to be the best header tip rather than the best block tip. Using
 	// the block tip instead might cause us to select a peer who is missing blocks
 	// for the headers we've downloaded.
 	bestHeight := srv.blockchain.headerTip().Height
 
-	// Find a peer with StartingHeight bigger than our best header tip.
-	var bestPeer *Peer
+	// Find the peers with StartingHeight bigger than our best header tip.
+	var candidatePeers []*Peer
 	for _, peer := range srv.cmgr.GetAllPeers() {
 		// If connectIps is set, only sync from persistent peers.
 		if len(srv.connectIps) > 0 && !peer.IsPersistent() {
-			glog.Infof("Server._startSync: Connect-ips is set, so non-persistent peer is not a "+
+			srv.logger.Infof("Server._startSync: Connect-ips is set, so non-persistent peer is not a "+
 				"sync candidate %v", peer)
 			continue
 		}
 
 		if !peer.IsSyncCandidate() {
-			glog.Infof("Peer is not sync candidate: %v (isOutbound: %v)", peer, peer.isOutbound)
+			srv.logger.Infof("Peer is not sync candidate: %v (isOutbound: %v)", peer, peer.isOutbound)
 			continue
 		}
 
-		// Choose the peer with the best height out of everyone who's a
-		// valid sync candidate.
 		if peer.StartingBlockHeight() < uint64(bestHeight) {
 			continue
 		}
-
-		// TODO: Choose best peers based on ping time and/or the highest
-		// starting block height. For now, keeping it simple and just choosing
-		// the last one we iterate over with a block height larger than our best.
-		bestPeer = peer
+		candidatePeers = append(candidatePeers, peer)
 	}
 
+	// Out of everyone who's a valid sync candidate, choose the peer that answers
+	// our pings the fastest.
+	bestPeer := _lowestLatencyPeer(candidatePeers)
 	if bestPeer == nil {
-		glog.V(1).Infof("Server._startSync: No sync peer candidates available")
+		srv.logger.V(1).Infof("Server._startSync: No sync peer candidates available")
 		return
 	}
 
@@ -1834,7 +2338,7 @@ func (srv *Server) _startSync() {
 	// before we start requesting blocks. If we were to go directly to fetching
 	// blocks from our SyncPeer without doing this first, we wouldn't be 100%
 	// sure that she has them.
-	glog.V(1).Infof("Server._startSync: Syncing headers to height %d from peer %v",
+	srv.logger.V(1).Infof("Server._startSync: Syncing headers to height %d from peer %v",
 		bestPeer.StartingBlockHeight(), bestPeer)
 
 	// Send a GetHeaders message to the Peer to start the headers sync.
@@ -1845,12 +2349,70 @@ func (srv *Server) _startSync() {
 		StopHash:     &BlockHash{},
 		BlockLocator: locator,
 	}, false)
-	glog.V(1).Infof("Server._startSync: Downloading headers for blocks starting at "+
+	srv.logger.V(1).Infof("Server._startSync: Downloading headers for blocks starting at "+
 		"header tip height %v from peer %v", bestHeight, bestPeer)
 
 	srv.SyncPeer = bestPeer
 }
 
+// _lowestLatencyPeer returns the peer with the lowest average ping latency. Peers that
+// haven't answered a ping yet are only returned if none of the peers have.
+func _lowestLatencyPeer(peers []*Peer) *Peer {
+	var bestPeer *Peer
+	var bestPingMicros int64
+	for _, peer := range peers {
+		pingMicros := peer.AveragePingMicros()
+		if bestPeer == nil || (pingMicros != 0 && (bestPingMicros == 0 || pingMicros < bestPingMicros)) {
+			bestPeer = peer
+			bestPingMicros = pingMicros
+		}
+	}
+	return bestPeer
+}
+
+// _requestBlocksFromAnotherPeer requests the blocks that were in flight from a peer that
+// disconnected from another peer. Peers are disconnected when they stall on a block request,
+// so this keeps a stalled peer from holding up the blocks it was asked for.
+func (srv *Server) _requestBlocksFromAnotherPeer(pp *Peer) {
+	if len(pp.requestedBlocks) == 0 {
+		return
+	}
+
+	var candidatePeers []*Peer
+	for _, peer := range srv.cmgr.GetAllPeers() {
+		if peer.ID != pp.ID && peer.Connected() && peer.IsSyncCandidate() {
+			candidatePeers = append(candidatePeers, peer)
+		}
+	}
+	newPeer := _lowestLatencyPeer(candidatePeers)
+	if newPeer == nil {
+		srv.logger.V(1).Infof("Server._requestBlocksFromAnotherPeer: No peer to request %d blocks "+
+			"from after disconnecting from peer %v", len(pp.requestedBlocks), pp)
+		return
+	}
+
+	// Request the blocks in order of height, so that they're not orphans when they arrive.
+	blockHashes := make([]*BlockHash, 0, len(pp.requestedBlocks))
+	blockHeights := make(map[BlockHash]uint32, len(pp.requestedBlocks))
+	for blockHashIter := range pp.requestedBlocks {
+		blockHash := blockHashIter
+		blockHashes = append(blockHashes, &blockHash)
+		if blockNode, exists := srv.blockchain.blockIndexByHash.Get(blockHash); exists {
+			blockHeights[blockHash] = blockNode.Height
+		} else {
+			blockHeights[blockHash] = math.MaxUint32
+		}
+	}
+	sort.Slice(blockHashes, func(ii, jj int) bool {
+		return blockHeights[*blockHashes[ii]] < blockHeights[*blockHashes[jj]]
+	})
+	pp.requestedBlocks = make(map[BlockHash]bool)
+
+	srv.logger.Infof("Server._requestBlocksFromAnotherPeer: Requesting %d blocks that were in flight "+
+		"from peer %v from peer %v instead", len(blockHashes), pp, newPeer)
+	srv.RequestBlocksByHash(newPeer, blockHashes, NewCorrelationID(newPeer.ID))
+}
+
 func (srv *Server) HandleAcceptedPeer(rn *RemoteNode) {
 	if rn == nil || rn.GetPeer() == nil {
 		return
@@ -1863,7 +2425,7 @@ func (srv *Server) HandleAcceptedPeer(rn *RemoteNode) {
 	isSyncCandidate := pp.IsSyncCandidate()
 	isSyncing := srv.blockchain.isSyncing()
 	chainState := srv.blockchain.chainState()
-	glog.V(1).Infof("Server.HandleAcceptedPeer: Processing NewPeer: (%v); IsSyncCandidate(%v), "+
+	srv.logger.V(1).Infof("Server.HandleAcceptedPeer: Processing NewPeer: (%v); IsSyncCandidate(%v), "+
 		"syncPeerIsNil=(%v), IsSyncing=(%v), ChainState=(%v)",
 		pp, isSyncCandidate, (srv.SyncPeer == nil), isSyncing, chainState)
 
@@ -1876,7 +2438,7 @@ func (srv *Server) HandleAcceptedPeer(rn *RemoteNode) {
 	}
 
 	if !isSyncCandidate {
-		glog.Infof("Peer is not sync candidate: %v (isOutbound: %v)", pp, pp.isOutbound)
+		srv.logger.Infof("Peer is not sync candidate: %v (isOutbound: %v)", pp, pp.isOutbound)
 	}
 }
 
@@ -1891,7 +2453,7 @@ func (srv *Server) maybeRequestAddresses(remoteNode *RemoteNode) {
 	}
 
 	if err := remoteNode.SendMessage(&MsgDeSoGetAddr{}); err != nil {
-		glog.Errorf("Server.maybeRequestAddresses: Problem sending GetAddr message to "+
+		srv.logger.Errorf("Server.maybeRequestAddresses: Problem sending GetAddr message to "+
 			"remoteNode (id= %v); err: %v", remoteNode, err)
 	}
 }
@@ -1963,17 +2525,34 @@ func (srv *Server) _cleanupDonePeerState(pp *Peer) {
 }
 
 func (srv *Server) _handleDisconnectedPeerMessage(pp *Peer) {
-	glog.V(1).Infof("Server._handleDisconnectedPeerMessage: Processing DonePeer: %v", pp)
+	srv.logger.V(1).Infof("Server._handleDisconnectedPeerMessage: Processing DonePeer: %v", pp)
 
 	srv._cleanupDonePeerState(pp)
+	srv.feeTelemetry.RemovePeer(pp.ID)
+
+	// If we requested a v2 snapshot chunk from the peer, free its operation queue slot and request the
+	// chunk from another peer.
+	if srv.HyperSyncProgress.releaseChunkInFlight(pp.ID) {
+		srv.snapshot.FreeOperationQueueSemaphore()
+		if srv.SyncPeer != nil && srv.SyncPeer.ID != pp.ID &&
+			srv.blockchain.ChainState() == SyncStateSyncingSnapshot {
+			srv.GetSnapshotChunksV2(srv.SyncPeer)
+		}
+	}
 
 	// Attempt to find a new peer to sync from if the quitting peer is the sync peer.
 	// We need to refresh the sync peer regardless of whether we're syncing or not.
 	// In the event that we fall behind, this allows us to switch to a peer allows us
 	// to continue syncing.
+	//
+	// The new sync peer requests the blocks we're missing once it's synced our headers,
+	// so the blocks in flight from the sync peer don't need to be requested again. Blocks
+	// in flight from any other peer are requested from another peer right away.
 	if srv.SyncPeer != nil && srv.SyncPeer.ID == pp.ID {
 		srv.SyncPeer = nil
 		srv._startSync()
+	} else {
+		srv._requestBlocksFromAnotherPeer(pp)
 	}
 }
 
@@ -1986,27 +2565,38 @@ func (srv *Server) _relayTransactions() {
 	// current block height.
 	mempool := srv.GetMempool()
 
-	glog.V(3).Infof("Server._relayTransactions: Waiting for mempool readOnlyView to regenerate")
+	srv.logger.V(3).Infof("Server._relayTransactions: Waiting for mempool readOnlyView to regenerate")
 	mempool.BlockUntilReadOnlyViewRegenerated()
-	glog.V(3).Infof("Server._relayTransactions: Mempool view has regenerated")
+	srv.logger.V(3).Infof("Server._relayTransactions: Mempool view has regenerated")
 
 	// We pull the transactions from either the PoW mempool or the PoS mempool depending
 	// on the current block height.
 	txnList := mempool.GetTransactions()
 
+	// We flood transactions to the peers we don't reconcile them with, and to a few of our outbound
+	// peers that we do so that they still propagate quickly. The rest of the peers learn about them
+	// in the next reconciliation round.
+	floodPeerIDs := srv._getTxnFloodPeerIDs(allPeers)
+
 	for _, pp := range allPeers {
 		if !pp.canReceiveInvMessages {
-			glog.V(1).Infof("Skipping invs for peer %v because not ready "+
+			srv.logger.V(1).Infof("Skipping invs for peer %v because not ready "+
 				"yet: %v", pp, pp.canReceiveInvMessages)
 			continue
 		}
 		// For each peer construct an inventory message that excludes transactions
 		// for which the minimum fee is below what the Peer will allow.
 		invMsg := &MsgDeSoInv{}
+		reconcileTxns := srv._reconcilesTxnsWithPeer(pp) && !floodPeerIDs[pp.ID]
+		var reconcileTxnHashes []BlockHash
 		for _, newTxn := range txnList {
 			if !newTxn.IsValidated() {
 				continue
 			}
+			// Don't relay transactions whose TxnType the operator has paused.
+			if srv.txnRelayFilter.IsTxnPaused(newTxn.Tx) {
+				continue
+			}
 
 			invVect := &InvVect{
 				Type: InvTypeTx,
@@ -2022,14 +2612,24 @@ func (srv *Server) _relayTransactions() {
 			// it here when we enqueue the message to the peers outgoing
 			// message queue so that we don't have remember to do it later.
 			pp.knownInventory.Add(*invVect, struct{}{})
+			if reconcileTxns {
+				reconcileTxnHashes = append(reconcileTxnHashes, invVect.Hash)
+				continue
+			}
 			invMsg.InvList = append(invMsg.InvList, invVect)
 		}
+		// The transactions that don't fit in the peer's reconciliation set are flooded.
+		if len(reconcileTxnHashes) > 0 {
+			for _, txnHash := range pp.txnReconciliation.addTxns(reconcileTxnHashes) {
+				invMsg.InvList = append(invMsg.InvList, &InvVect{Type: InvTypeTx, Hash: txnHash})
+			}
+		}
 		if len(invMsg.InvList) > 0 {
 			pp.AddDeSoMessage(invMsg, false)
 		}
 	}
 
-	glog.V(3).Infof("Server._relayTransactions: Relay to all peers is complete!")
+	srv.logger.V(3).Infof("Server._relayTransactions: Relay to all peers is complete!")
 }
 
 func (srv *Server) _addNewTxn(pp *Peer, txn *MsgDeSoTxn, rateLimit bool) ([]*MsgDeSoTxn, error) {
@@ -2037,10 +2637,15 @@ func (srv *Server) _addNewTxn(pp *Peer, txn *MsgDeSoTxn, rateLimit bool) ([]*Msg
 	if srv.ReadOnlyMode {
 		err := fmt.Errorf("Server._addNewTxnAndRelay: Not processing txn from peer %v "+
 			"because peer is in read-only mode: %v", pp, srv.ReadOnlyMode)
-		glog.V(1).Infof(err.Error())
+		srv.logger.V(1).Infof(err.Error())
 		return nil, err
 	}
 
+	if srv.txnRelayFilter.IsTxnPaused(txn) {
+		return nil, fmt.Errorf("Server._addNewTxn: Not processing txn %v from peer %v because its TxnType "+
+			"is paused", txn.Hash(), pp)
+	}
+
 	srv.blockchain.ChainLock.RLock()
 	tipHeight := uint64(srv.blockchain.BlockTip().Height)
 	chainState := srv.blockchain.chainState()
@@ -2051,11 +2656,11 @@ func (srv *Server) _addNewTxn(pp *Peer, txn *MsgDeSoTxn, rateLimit bool) ([]*Msg
 		// Otherwise, we error.
 		err := fmt.Errorf("Server._addNewTxnAndRelay: Cannot process txn "+
 			"from peer %v while syncing: %v %v", pp, srv.blockchain.chainState(), txn.Hash())
-		glog.Error(err)
+		srv.logger.Error(err)
 		return nil, err
 	}
 
-	glog.V(1).Infof("Server._addNewTxnAndRelay: txn: %v, peer: %v", txn, pp)
+	srv.logger.V(1).Infof("Server._addNewTxnAndRelay: txn: %v, peer: %v", txn, pp)
 
 	// Try and add the transaction to the mempool.
 	peerID := uint64(0)
@@ -2077,7 +2682,7 @@ func (srv *Server) _addNewTxn(pp *Peer, txn *MsgDeSoTxn, rateLimit bool) ([]*Msg
 			return nil, errors.Wrapf(err, "Server._addNewTxn: Problem adding transaction to mempool: ")
 		}
 
-		glog.V(1).Infof("Server._addNewTxn: newly accepted txn: %v, Peer: %v", txn, pp)
+		srv.logger.V(1).Infof("Server._addNewTxn: newly accepted txn: %v, Peer: %v", txn, pp)
 	}
 
 	// Always add the txn to the PoS mempool. This will usually succeed if the txn
@@ -2087,7 +2692,16 @@ func (srv *Server) _addNewTxn(pp *Peer, txn *MsgDeSoTxn, rateLimit bool) ([]*Msg
 	// txn addition into the PoW mempool to succeed, while the addition into the PoS
 	// mempool fails. This error handling catches that and gives the user the correct
 	// feedback on the txn addition's success.
-	if err := srv.posMempool.AddTransaction(txn, time.Now()); err != nil {
+	//
+	// Txns without a peer were submitted to this node, so the PoS mempool tracks them as
+	// local txns and we rebroadcast them until they're confirmed.
+	var err error
+	if pp == nil {
+		err = srv.posMempool.AddLocalTransaction(txn, time.Now())
+	} else {
+		err = srv.posMempool.AddTransaction(txn, time.Now())
+	}
+	if err != nil {
 		if uint64(tipHeight) >= srv.params.GetFinalPoWBlockHeight() {
 			return nil, errors.Wrapf(err, "Server._addNewTxn: problem adding txn to pos mempool")
 		}
@@ -2120,11 +2734,11 @@ func (srv *Server) _handleBlockMainChainConnectedd(event *BlockEvent) {
 	srv.posMempool.OnBlockConnected(blk)
 
 	if err := srv._updatePosMempoolAfterTipChange(); err != nil {
-		glog.Errorf("Server._handleBlockMainChainDisconnected: Problem updating pos mempool after tip change: %v", err)
+		srv.logger.Errorf("Server._handleBlockMainChainDisconnected: Problem updating pos mempool after tip change: %v", err)
 	}
 
 	blockHash, _ := blk.Header.Hash()
-	glog.V(1).Infof("_handleBlockMainChainConnected: Block %s height %d connected to "+
+	srv.logger.V(1).Infof("_handleBlockMainChainConnected: Block %s height %d connected to "+
 		"main chain and chain is current.", hex.EncodeToString(blockHash[:]), blk.Header.Height)
 }
 
@@ -2148,11 +2762,11 @@ func (srv *Server) _handleBlockMainChainDisconnectedd(event *BlockEvent) {
 	srv.posMempool.OnBlockDisconnected(blk)
 
 	if err := srv._updatePosMempoolAfterTipChange(); err != nil {
-		glog.Errorf("Server._handleBlockMainChainDisconnected: Problem updating pos mempool after tip change: %v", err)
+		srv.logger.Errorf("Server._handleBlockMainChainDisconnected: Problem updating pos mempool after tip change: %v", err)
 	}
 
 	blockHash, _ := blk.Header.Hash()
-	glog.V(1).Infof("_handleBlockMainChainDisconnect: Block %s height %d disconnected from "+
+	srv.logger.V(1).Infof("_handleBlockMainChainDisconnect: Block %s height %d disconnected from "+
 		"main chain and chain is current.", hex.EncodeToString(blockHash[:]), blk.Header.Height)
 }
 
@@ -2179,13 +2793,13 @@ func (srv *Server) _updatePosMempoolAfterTipChange() error {
 func (srv *Server) _tryRequestMempoolFromPeer(pp *Peer) {
 	// If the peer is nil, then there's nothing to do.
 	if pp == nil {
-		glog.V(1).Infof("Server._tryRequestMempoolFromPeer: NOT sending mempool message because peer is nil: %v", pp)
+		srv.logger.V(1).Infof("Server._tryRequestMempoolFromPeer: NOT sending mempool message because peer is nil: %v", pp)
 		return
 	}
 
 	// If we have already requested the mempool from the peer, then there's nothing to do.
 	if pp.hasReceivedMempoolMessage {
-		glog.V(2).Infof(
+		srv.logger.V(2).Infof(
 			"Server._tryRequestMempoolFromPeer: NOT sending mempool message because we have already sent one: %v", pp,
 		)
 		return
@@ -2202,10 +2816,10 @@ func (srv *Server) _tryRequestMempoolFromPeer(pp *Peer) {
 	isRunningFastHotStuffConsensus := srv.fastHotStuffConsensus != nil && srv.fastHotStuffConsensus.IsRunning()
 
 	if isChainCurrent || isRunningFastHotStuffConsensus {
-		glog.V(1).Infof("Server._tryRequestMempoolFromPeer: Sending mempool message: %v", pp)
+		srv.logger.V(1).Infof("Server._tryRequestMempoolFromPeer: Sending mempool message: %v", pp)
 		pp.AddDeSoMessage(&MsgDeSoMempool{}, false)
 	} else {
-		glog.V(1).Infof(
+		srv.logger.V(1).Infof(
 			"Server._tryRequestMempoolFromPeer: NOT sending mempool message. The node is still syncing: %v, %v",
 			srv.blockchain.chainState(),
 			pp,
@@ -2230,8 +2844,28 @@ func (srv *Server) _handleBlockAccepted(event *BlockEvent) {
 
 	// Iterate through all non-validator peers and relay the InvVect to them.
 	// This will only actually be relayed if it's not already in the peer's knownInventory.
+	// Peers that support compact blocks get a compact block instead, which they can
+	// usually reconstruct from their mempool without another round trip.
+	var compactBlock *MsgDeSoCompactBlock
 	allNonValidators := srv.networkManager.GetAllNonValidators()
 	for _, remoteNode := range allNonValidators {
+		pp := remoteNode.GetPeer()
+		if srv._relaysCompactBlocksWithPeer(pp) {
+			if pp.knownInventory.Contains(*invVect) {
+				continue
+			}
+			if compactBlock == nil {
+				var err error
+				if compactBlock, err = srv._newCompactBlockForRelay(blk); err != nil {
+					srv.logger.Errorf("Server._handleBlockAccepted: Problem creating compact block: %v", err)
+				}
+			}
+			if compactBlock != nil {
+				pp.knownInventory.Add(*invVect, struct{}{})
+				remoteNode.sendMessage(compactBlock)
+				continue
+			}
+		}
 		remoteNode.sendMessage(&MsgDeSoInv{
 			InvList: []*InvVect{invVect},
 		})
@@ -2246,7 +2880,7 @@ func (srv *Server) _logAndDisconnectPeer(pp *Peer, blockMsg *MsgDeSoBlock, suffi
 	// be restarted as a resul. If we're not syncing our peer and have instead reached
 	// the steady-state, then the next interesting inv message should cause us to
 	// fetch headers, blocks, etc. So we'll be back.
-	glog.Errorf("Server._handleBlock: Encountered an error processing "+
+	srv.logger.Errorf("Server._handleBlock: Encountered an error processing "+
 		"block %v. Disconnecting from peer %v: %s", blockMsg, pp, suffix)
 	pp.Disconnect("Problem processing block")
 }
@@ -2258,7 +2892,9 @@ func (srv *Server) _logAndDisconnectPeer(pp *Peer, blockMsg *MsgDeSoBlock, suffi
 // isLastBlock indicates that this is the last block in the list of blocks we received back
 // via a MsgDeSoBlockBundle message. When we receive a single block, isLastBlock will automatically
 // be true, which will give it its old single-block behavior.
-func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
+//
+// cid is the CorrelationID of the message that carried the block.
+func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool, cid CorrelationID) {
 	srv.timer.Start("Server._handleBlock: General")
 
 	// Pull out the header for easy access.
@@ -2273,7 +2909,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	// stop accepting new blocks.
 	blockTip := srv.blockchain.blockTip()
 	if srv.blockchain.isTipMaxed(blockTip) && blockHeader.Height > uint64(blockTip.Height) {
-		glog.Infof("Server._handleBlock: Exiting because block tip is maxed out")
+		srv.logger.Infof("Server._handleBlock: Exiting because block tip is maxed out")
 		return
 	}
 
@@ -2284,6 +2920,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 		srv._logAndDisconnectPeer(pp, blk, "Problem computing block hash")
 		return
 	}
+	logger := srv.logger.With(LogFieldPeerID(pp.ID), LogFieldBlockHash(blockHash))
 
 	// Unless we're running a PoS validator, we should not expect to see a block that we did not request. If
 	// we see such a block, then we log an error and disconnect from the peer.
@@ -2317,7 +2954,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	// check if we should verify signatures or not.
 	verifySignatures, shouldDisconnect := srv.shouldVerifySignatures(blk.Header, false)
 	if shouldDisconnect {
-		glog.Errorf("Server._handleHeaderBundle: Disconnecting peer %v in state %s because a mismatch was "+
+		srv.logger.Errorf("Server._handleHeaderBundle: Disconnecting peer %v in state %s because a mismatch was "+
 			"found between the received header height %v does not match the checkpoint block info %v",
 			pp, srv.blockchain.chainState(), blk.Header.Height,
 			srv.blockchain.GetCheckpointBlockInfo().Hash.String())
@@ -2335,25 +2972,25 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 		// If the FastHotStuffConsensus has been initialized, then we pass the block to the new consensus
 		// which will validate the block, try to apply it, and handle the orphan case by requesting missing
 		// parents.
-		glog.V(0).Infof(CLog(Cyan, fmt.Sprintf(
-			"Server._handleBlock: Processing block %v with FastHotStuffConsensus with SyncState=%v for peer %v",
-			blk, srv.blockchain.chainState(), pp,
+		srv.logger.V(0).Infof(CLog(Cyan, fmt.Sprintf(
+			"Server._handleBlock: [%v] Processing block %v with FastHotStuffConsensus with SyncState=%v for peer %v",
+			cid, blk, srv.blockchain.chainState(), pp,
 		)))
 		blockHashesToRequest, err = srv.fastHotStuffConsensus.HandleBlock(pp, blk)
 		isOrphan = len(blockHashesToRequest) > 0
 	} else if !verifySignatures {
-		glog.V(0).Infof(CLog(Cyan, fmt.Sprintf(
-			"Server._handleBlock: Processing block %v WITHOUT signature checking because SyncState=%v for peer %v",
-			blk, srv.blockchain.chainState(), pp,
+		srv.logger.V(0).Infof(CLog(Cyan, fmt.Sprintf(
+			"Server._handleBlock: [%v] Processing block %v WITHOUT signature checking because SyncState=%v for peer %v",
+			cid, blk, srv.blockchain.chainState(), pp,
 		)))
 		_, isOrphan, blockHashesToRequest, err = srv.blockchain.ProcessBlock(blk, false)
 	} else {
 		// TODO: Signature checking slows things down because it acquires the ChainLock.
 		// The optimal solution is to check signatures in a way that doesn't acquire the
 		// ChainLock, which is what Bitcoin Core does.
-		glog.V(0).Infof(CLog(Cyan, fmt.Sprintf(
-			"Server._handleBlock: Processing block %v WITH signature checking because SyncState=%v for peer %v",
-			blk, srv.blockchain.chainState(), pp,
+		srv.logger.V(0).Infof(CLog(Cyan, fmt.Sprintf(
+			"Server._handleBlock: [%v] Processing block %v WITH signature checking because SyncState=%v for peer %v",
+			cid, blk, srv.blockchain.chainState(), pp,
 		)))
 		_, isOrphan, blockHashesToRequest, err = srv.blockchain.ProcessBlock(blk, true)
 	}
@@ -2366,7 +3003,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 			// TODO: This assuages a bug similar to the one referenced in the duplicate
 			// headers comment above but in the future we should probably try and figure
 			// out a way to be more strict about things.
-			glog.Warningf("Got duplicate block %v from peer %v", blk, pp)
+			logger.Warningf("Got duplicate block %v from peer %v [%v]", blk, pp, cid)
 		} else if strings.Contains(err.Error(), RuleErrorFailedSpamPreventionsCheck.Error()) {
 			// If the block fails the spam prevention check, then it must be signed by the
 			// bad block proposer signature or it has a bad QC. In either case, we should
@@ -2375,7 +3012,8 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 			return
 		} else {
 			// For any other error, we log the error and continue.
-			glog.Errorf("Server._handleBlock: Error while processing block at height %v: %v", blk.Header.Height, err)
+			logger.Errorf("Server._handleBlock: [%v] Error while processing block at height %v: %v",
+				cid, blk.Header.Height, err)
 			return
 		}
 	}
@@ -2401,17 +3039,18 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 		// 2. With the PoW protocol where we do not expect to ever receive an orphan block due to how
 		//    we request header first before requesting blocks, we disconnect from the peer.
 
-		glog.Warningf("ERROR: Received orphan block with hash %v height %v.", blockHash, blk.Header.Height)
+		logger.Warningf("ERROR: Received orphan block with hash %v height %v.", blockHash, blk.Header.Height)
 
 		// Request the missing blocks from the peer if needed.
 		if len(blockHashesToRequest) > 0 {
-			glog.Warningf(
-				"Server._handleBlock: Orphan block %v at height %d. Requesting missing ancestors from peer: %v",
+			logger.Warningf(
+				"Server._handleBlock: [%v] Orphan block %v at height %d. Requesting missing ancestors from peer: %v",
+				cid,
 				blockHash,
 				blk.Header.Height,
 				pp,
 			)
-			srv.RequestBlocksByHash(pp, blockHashesToRequest)
+			srv.RequestBlocksByHash(pp, blockHashesToRequest, cid)
 		} else {
 			// If we don't have any blocks to request, then we disconnect from the peer.
 			srv._logAndDisconnectPeer(pp, blk, "Received orphan block")
@@ -2424,15 +3063,15 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	// if it took longer than MaxTipAge to sync blocks to this point. We'll revert to
 	// syncing headers and then resume syncing blocks once we're current again.
 	if srv.blockchain.chainState() == SyncStateSyncingHeaders {
-		glog.Warningf("Server._handleBlock: Received block while syncing headers: %v", blk)
-		glog.Infof("Requesting headers: %v", pp)
+		srv.logger.Warningf("Server._handleBlock: Received block while syncing headers: %v", blk)
+		srv.logger.Infof("Requesting headers: %v", pp)
 
 		locator := srv.blockchain.LatestHeaderLocator()
 		pp.AddDeSoMessage(&MsgDeSoGetHeaders{
 			StopHash:     &BlockHash{},
 			BlockLocator: locator,
 		}, false)
-		glog.V(1).Infof("Server._handleHeaderBundle: *Syncing* headers for blocks starting at "+
+		srv.logger.V(1).Infof("Server._handleHeaderBundle: *Syncing* headers for blocks starting at "+
 			"header tip %v from peer %v",
 			srv.blockchain.HeaderTip(), pp)
 		return
@@ -2454,7 +3093,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 		// peer, which is OK because we can assume the peer has all of them when
 		// we're syncing.
 		maxHeight := -1
-		srv.RequestBlocksUpToHeight(pp, maxHeight)
+		srv.RequestBlocksUpToHeight(pp, maxHeight, cid)
 		return
 	}
 
@@ -2492,17 +3131,17 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	srv.tryTransitionToFastHotStuffConsensus()
 }
 
-func (srv *Server) _handleBlockBundle(pp *Peer, bundle *MsgDeSoBlockBundle) {
+func (srv *Server) _handleBlockBundle(pp *Peer, bundle *MsgDeSoBlockBundle, cid CorrelationID) {
 	if len(bundle.Blocks) == 0 {
-		glog.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: Received EMPTY block bundle "+
+		srv.logger.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: Received EMPTY block bundle "+
 			"at header height ( %v ) from Peer %v. Disconnecting peer since this should never happen.",
 			srv.blockchain.headerTip().Height, pp)))
 		pp.Disconnect("Received empty block bundle.")
 		return
 	}
-	glog.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: Received blocks ( %v->%v / %v ) from Peer %v. "+
+	srv.logger.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: [%v] Received blocks ( %v->%v / %v ) from Peer %v. "+
 		"Checkpoint syncing status: %v",
-		bundle.Blocks[0].Header.Height, bundle.Blocks[len(bundle.Blocks)-1].Header.Height,
+		cid, bundle.Blocks[0].Header.Height, bundle.Blocks[len(bundle.Blocks)-1].Header.Height,
 		srv.blockchain.headerTip().Height, pp, srv.getCheckpointSyncingStatus(false))))
 
 	srv.timer.Start("Server._handleBlockBundle: General")
@@ -2520,7 +3159,7 @@ func (srv *Server) _handleBlockBundle(pp *Peer, bundle *MsgDeSoBlockBundle) {
 		// _handleBlock is a legacy function that doesn't support erroring out. It's not a big deal
 		// though as we'll just connect all the blocks after the failed one and those blocks will also
 		// gracefully fail.
-		srv._handleBlock(pp, blk, ii == len(bundle.Blocks)-1 /*isLastBlock*/)
+		srv._handleBlock(pp, blk, ii == len(bundle.Blocks)-1 /*isLastBlock*/, cid)
 		numLogBlocks := 100
 		if srv.params.IsPoSBlockHeight(blk.Header.Height) ||
 			srv.params.NetworkType == NetworkType_TESTNET {
@@ -2528,7 +3167,7 @@ func (srv *Server) _handleBlockBundle(pp *Peer, bundle *MsgDeSoBlockBundle) {
 		}
 
 		if ii%numLogBlocks == 0 {
-			glog.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: Processed block ( %v / %v ) = ( %v / %v ) from Peer %v",
+			srv.logger.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: Processed block ( %v / %v ) = ( %v / %v ) from Peer %v",
 				bundle.Blocks[ii].Header.Height,
 				srv.blockchain.headerTip().Height,
 				ii+1, len(bundle.Blocks),
@@ -2546,7 +3185,7 @@ func (srv *Server) _handleBlockBundle(pp *Peer, bundle *MsgDeSoBlockBundle) {
 
 func (srv *Server) _handleInv(peer *Peer, msg *MsgDeSoInv) {
 	if !peer.isOutbound && srv.IgnoreInboundPeerInvMessages {
-		glog.Infof("_handleInv: Ignoring inv message from inbound peer because "+
+		srv.logger.Infof("_handleInv: Ignoring inv message from inbound peer because "+
 			"ignore_outbound_peer_inv_messages=true: %v", peer)
 		return
 	}
@@ -2559,7 +3198,7 @@ func (srv *Server) _handleInv(peer *Peer, msg *MsgDeSoInv) {
 }
 
 func (srv *Server) _handleGetTransactions(pp *Peer, msg *MsgDeSoGetTransactions) {
-	glog.V(1).Infof("Server._handleGetTransactions: Received GetTransactions "+
+	srv.logger.V(1).Infof("Server._handleGetTransactions: Received GetTransactions "+
 		"message %v from Peer %v", msg, pp)
 
 	pp.AddDeSoMessage(msg, true /*inbound*/)
@@ -2577,6 +3216,11 @@ func (srv *Server) ProcessSingleTxnWithChainLock(pp *Peer, txn *MsgDeSoTxn) ([]*
 	// Note we set rateLimit=false because we have a global minimum txn fee that should
 	// prevent spam on its own.
 
+	if srv.txnRelayFilter.IsTxnPaused(txn) {
+		return nil, fmt.Errorf("Server.ProcessSingleTxnWithChainLock: Not processing txn %v from peer %v "+
+			"because its TxnType is paused", txn.Hash(), pp)
+	}
+
 	// Only attempt to add the transaction to the PoW mempool if we're on the
 	// PoW protocol. If we're on the PoW protocol, then we use the PoW mempool's
 	// txn validity checks to signal whether the txn has been added or not. The PoW
@@ -2625,7 +3269,7 @@ func (srv *Server) _processTransactions(pp *Peer, transactions []*MsgDeSoTxn) []
 	// a block. Doing something like this would make it so that if a transaction
 	// was initially rejected due to us not having its dependencies, then we
 	// will eventually add it as opposed to just forgetting about it.
-	glog.V(1).Infof("Server._processTransactions: Processing %d transactions from "+
+	srv.logger.V(1).Infof("Server._processTransactions: Processing %d transactions from "+
 		"peer %v", len(transactions), pp)
 	transactionsToRelay := []*MsgDeSoTxn{}
 	for ii, txn := range transactions {
@@ -2637,23 +3281,23 @@ func (srv *Server) _processTransactions(pp *Peer, transactions []*MsgDeSoTxn) []
 		// hurt so we decided to leave it in for now.
 		if (ii+1)%1000 == 0 {
 			// Log
-			glog.V(1).Infof("Server._processTransactions: Taking a break to allow " +
+			srv.logger.V(1).Infof("Server._processTransactions: Taking a break to allow " +
 				"other services to grab the ChainLock")
 			time.Sleep(5000 * time.Millisecond)
 		}
 
-		glog.V(1).Infof("Server._processTransactions: Processing txn ( %d / %d ) from "+
+		srv.logger.V(1).Infof("Server._processTransactions: Processing txn ( %d / %d ) from "+
 			"peer %v", ii, len(transactions), pp)
 		// Process the transaction with rate-limiting while allowing unconnectedTxns and
 		// verifying signatures.
 		newlyAcceptedTxns, err := srv.ProcessSingleTxnWithChainLock(pp, txn)
 		if err != nil {
-			glog.V(4).Info(fmt.Sprintf("Server._handleTransactionBundle: Rejected "+
+			srv.logger.V(4).Info(fmt.Sprintf("Server._handleTransactionBundle: Rejected "+
 				"transaction %v from peer %v from mempool: %v", txn, pp, err))
 			// A peer should know better than to send us a transaction that's below
 			// our min feerate, which they see when we send them a version message.
 			if errors.Is(err, TxErrorInsufficientFeeMinFee) {
-				glog.Errorf(fmt.Sprintf("Server._handleTransactionBundle: Disconnecting "+
+				srv.logger.Errorf(fmt.Sprintf("Server._handleTransactionBundle: Disconnecting "+
 					"Peer %v for sending us a transaction %v with fee below the minimum fee %d",
 					pp, txn, srv.mempool.minFeeRateNanosPerKB))
 				pp.Disconnect("Transaction fee below minimum fee")
@@ -2663,7 +3307,7 @@ func (srv *Server) _processTransactions(pp *Peer, transactions []*MsgDeSoTxn) []
 			continue
 		}
 		if len(newlyAcceptedTxns) == 0 {
-			glog.Infof(fmt.Sprintf("Server._handleTransactionBundle: "+
+			srv.logger.Infof(fmt.Sprintf("Server._handleTransactionBundle: "+
 				"Transaction %v from peer %v was added as an ORPHAN", spew.Sdump(txn), pp))
 		}
 
@@ -2677,21 +3321,21 @@ func (srv *Server) _processTransactions(pp *Peer, transactions []*MsgDeSoTxn) []
 }
 
 func (srv *Server) _handleTransactionBundle(pp *Peer, msg *MsgDeSoTransactionBundle) {
-	glog.V(1).Infof("Server._handleTransactionBundle: Received TransactionBundle "+
+	srv.logger.V(1).Infof("Server._handleTransactionBundle: Received TransactionBundle "+
 		"message of size %v from Peer %v", len(msg.Transactions), pp)
 
 	pp.AddDeSoMessage(msg, true /*inbound*/)
 }
 
 func (srv *Server) _handleTransactionBundleV2(pp *Peer, msg *MsgDeSoTransactionBundleV2) {
-	glog.V(1).Infof("Server._handleTransactionBundleV2: Received TransactionBundle "+
+	srv.logger.V(1).Infof("Server._handleTransactionBundleV2: Received TransactionBundle "+
 		"message of size %v from Peer %v", len(msg.Transactions), pp)
 
 	pp.AddDeSoMessage(msg, true /*inbound*/)
 }
 
 func (srv *Server) _handleMempool(pp *Peer, msg *MsgDeSoMempool) {
-	glog.V(1).Infof("Server._handleMempool: Received Mempool message from Peer %v", pp)
+	srv.logger.V(1).Infof("Server._handleMempool: Received Mempool message from Peer %v", pp)
 
 	pp.canReceiveInvMessages = true
 }
@@ -2711,6 +3355,13 @@ func (srv *Server) StartStatsdReporter() {
 				// Report PoS Mempool size
 				posMempoolTotal := srv.posMempool.txnRegister.Count()
 				srv.statsdClient.Gauge("POS_MEMPOOL.COUNT", float64(posMempoolTotal), tags, 1)
+				srv.statsdClient.Gauge("POS_MEMPOOL.SIZE_BYTES", float64(srv.posMempool.GetSizeBytes()), tags, 1)
+
+				// Report PoS Mempool evictions
+				evictionStats := srv.posMempool.GetEvictionStats()
+				srv.statsdClient.Gauge("POS_MEMPOOL.EVICTED_TXNS", float64(evictionStats.EvictedTxnCount), tags, 1)
+				srv.statsdClient.Gauge("POS_MEMPOOL.EVICTED_BYTES", float64(evictionStats.EvictedTxnSizeBytes), tags, 1)
+				srv.statsdClient.Gauge("POS_MEMPOOL.LAST_EVICTED_FEE_RATE", float64(evictionStats.LastEvictedFeeRateNanosPerKB), tags, 1)
 
 				// Report block + headers height
 				blocksHeight := srv.blockchain.BlockTip().Height
@@ -2719,6 +3370,17 @@ func (srv *Server) StartStatsdReporter() {
 				headersHeight := srv.blockchain.HeaderTip().Height
 				srv.statsdClient.Gauge("HEADERS.HEIGHT", float64(headersHeight), tags, 1)
 
+				// Report message lane counters
+				for _, laneStats := range srv.GetMessageLaneStats() {
+					laneTags := append(tags, "lane:"+laneStats.Lane.String())
+					srv.statsdClient.Gauge("MESSAGE_LANE.RECEIVED", float64(laneStats.NumReceived), laneTags, 1)
+					srv.statsdClient.Gauge("MESSAGE_LANE.PROCESSED", float64(laneStats.NumProcessed), laneTags, 1)
+					srv.statsdClient.Gauge("MESSAGE_LANE.DROPPED", float64(laneStats.NumDropped), laneTags, 1)
+					srv.statsdClient.Gauge("MESSAGE_LANE.QUEUE_LENGTH", float64(laneStats.QueueLength), laneTags, 1)
+					srv.statsdClient.Gauge("MESSAGE_LANE.PROCESSING_MILLIS",
+						float64(laneStats.ProcessingTime.Milliseconds()), laneTags, 1)
+				}
+
 			case <-srv.mempool.quit:
 				break out
 			}
@@ -2735,7 +3397,7 @@ func (srv *Server) _handleAddrMessage(pp *Peer, desoMsg DeSoMessage) {
 	var msg *MsgDeSoAddr
 	var ok bool
 	if msg, ok = desoMsg.(*MsgDeSoAddr); !ok {
-		glog.Errorf("Server._handleAddrMessage: Problem decoding MsgDeSoAddr: %v", spew.Sdump(desoMsg))
+		srv.logger.Errorf("Server._handleAddrMessage: Problem decoding MsgDeSoAddr: %v", spew.Sdump(desoMsg))
 		srv.networkManager.DisconnectById(id, "Problem decoding MsgDeSoAddr")
 		return
 	}
@@ -2743,12 +3405,12 @@ func (srv *Server) _handleAddrMessage(pp *Peer, desoMsg DeSoMessage) {
 	srv.addrsToBroadcastLock.Lock()
 	defer srv.addrsToBroadcastLock.Unlock()
 
-	glog.V(1).Infof("Server._handleAddrMessage: Received Addr from peer id=%v with addrs %v", pp.ID, spew.Sdump(msg.AddrList))
+	srv.logger.V(1).Infof("Server._handleAddrMessage: Received Addr from peer id=%v with addrs %v", pp.ID, spew.Sdump(msg.AddrList))
 
 	// If this addr message contains more than the maximum allowed number of addresses
 	// then disconnect this peer.
 	if len(msg.AddrList) > MaxAddrsPerAddrMsg {
-		glog.Errorf(fmt.Sprintf("Server._handleAddrMessage: Disconnecting "+
+		srv.logger.Errorf(fmt.Sprintf("Server._handleAddrMessage: Disconnecting "+
 			"Peer id=%v for sending us an addr message with %d transactions, which exceeds "+
 			"the max allowed %d",
 			pp.ID, len(msg.AddrList), MaxAddrsPerAddrMsg))
@@ -2762,7 +3424,7 @@ func (srv *Server) _handleAddrMessage(pp *Peer, desoMsg DeSoMessage) {
 		addrAsNetAddr := wire.NetAddressV2FromBytes(
 			addr.Timestamp, (wire.ServiceFlag)(addr.Services), addr.IP[:], addr.Port)
 		if !addrmgr.IsRoutable(addrAsNetAddr) {
-			glog.V(1).Infof("Server._handleAddrMessage: Dropping address %v from peer %v because it is not routable", addr, pp)
+			srv.logger.V(1).Infof("Server._handleAddrMessage: Dropping address %v from peer %v because it is not routable", addr, pp)
 			continue
 		}
 
@@ -2773,7 +3435,7 @@ func (srv *Server) _handleAddrMessage(pp *Peer, desoMsg DeSoMessage) {
 
 	// If the message had <= 10 addrs in it, then queue all the addresses for relaying on the next cycle.
 	if len(msg.AddrList) <= 10 {
-		glog.V(1).Infof("Server._handleAddrMessage: Queueing %d addrs for forwarding from "+
+		srv.logger.V(1).Infof("Server._handleAddrMessage: Queueing %d addrs for forwarding from "+
 			"peer %v", len(msg.AddrList), pp)
 		sourceAddr := &SingleAddr{
 			Timestamp: time.Now(),
@@ -2802,13 +3464,13 @@ func (srv *Server) _handleGetAddrMessage(pp *Peer, desoMsg DeSoMessage) {
 
 	id := NewRemoteNodeId(pp.ID)
 	if _, ok := desoMsg.(*MsgDeSoGetAddr); !ok {
-		glog.Errorf("Server._handleAddrMessage: Problem decoding "+
+		srv.logger.Errorf("Server._handleAddrMessage: Problem decoding "+
 			"MsgDeSoAddr: %v", spew.Sdump(desoMsg))
 		srv.networkManager.DisconnectById(id, "Problem decoding MsgDeSoGetAddr")
 		return
 	}
 
-	glog.V(1).Infof("Server._handleGetAddrMessage: Received GetAddr from peer %v", pp)
+	srv.logger.V(1).Infof("Server._handleGetAddrMessage: Received GetAddr from peer %v", pp)
 	// When we get a GetAddr message, choose MaxAddrsPerMsg from the AddrMgr
 	// and send them back to the peer.
 	netAddrsFound := srv.AddrMgr.AddressCache()
@@ -2832,7 +3494,7 @@ func (srv *Server) _handleGetAddrMessage(pp *Peer, desoMsg DeSoMessage) {
 	}
 	rn := srv.networkManager.GetRemoteNodeById(id)
 	if err := srv.networkManager.SendMessage(rn, res); err != nil {
-		glog.Errorf("Server._handleGetAddrMessage: Problem sending addr message to peer %v: %v", pp, err)
+		srv.logger.Errorf("Server._handleGetAddrMessage: Problem sending addr message to peer %v: %v", pp, err)
 		srv.networkManager.DisconnectById(id, "Problem sending addr message")
 		return
 	}
@@ -2864,14 +3526,14 @@ func (srv *Server) _handlePeerMessages(serverMessage *ServerMessage) {
 	case *MsgDeSoGetHeaders:
 		srv._handleGetHeaders(serverMessage.Peer, msg)
 	case *MsgDeSoHeaderBundle:
-		srv._handleHeaderBundle(serverMessage.Peer, msg)
+		srv._handleHeaderBundle(serverMessage.Peer, msg, serverMessage.CorrelationID)
 	case *MsgDeSoBlockBundle:
-		srv._handleBlockBundle(serverMessage.Peer, msg)
+		srv._handleBlockBundle(serverMessage.Peer, msg, serverMessage.CorrelationID)
 	case *MsgDeSoGetBlocks:
-		srv._handleGetBlocks(serverMessage.Peer, msg)
+		srv._handleGetBlocks(serverMessage.Peer, msg, serverMessage.CorrelationID)
 	case *MsgDeSoBlock:
 		// isLastBlock is always true when we get a legacy single-block message.
-		srv._handleBlock(serverMessage.Peer, msg, true)
+		srv._handleBlock(serverMessage.Peer, msg, true, serverMessage.CorrelationID)
 	case *MsgDeSoGetSnapshot:
 		srv._handleGetSnapshot(serverMessage.Peer, msg)
 	case *MsgDeSoSnapshotData:
@@ -2894,6 +3556,22 @@ func (srv *Server) _handlePeerMessages(serverMessage *ServerMessage) {
 		srv._handleValidatorVote(serverMessage.Peer, msg)
 	case *MsgDeSoValidatorTimeout:
 		srv._handleValidatorTimeout(serverMessage.Peer, msg)
+	case *MsgDeSoReconcileTxnsRequest:
+		srv._handleReconcileTxnsRequest(serverMessage.Peer, msg)
+	case *MsgDeSoReconcileTxnsSketch:
+		srv._handleReconcileTxnsSketch(serverMessage.Peer, msg)
+	case *MsgDeSoReconcileTxnsDiff:
+		srv._handleReconcileTxnsDiff(serverMessage.Peer, msg)
+	case *MsgDeSoValidatorHeartbeat:
+		srv._handleValidatorHeartbeat(serverMessage.Peer, msg)
+	case *MsgDeSoCompactBlock:
+		srv._handleCompactBlock(serverMessage.Peer, msg, serverMessage.CorrelationID)
+	case *MsgDeSoGetBlockTxns:
+		srv._handleGetBlockTxns(serverMessage.Peer, msg)
+	case *MsgDeSoBlockTxns:
+		srv._handleBlockTxns(serverMessage.Peer, msg, serverMessage.CorrelationID)
+	case *MsgDeSoFeeTelemetry:
+		srv._handleFeeTelemetry(serverMessage.Peer, msg)
 	}
 }
 
@@ -2901,7 +3579,14 @@ func (srv *Server) _handleFastHotStuffConsensusEvent(event *consensus.FastHotStu
 	// This should never happen. If the consensus message handler isn't defined, then something went
 	// wrong during the node initialization. We log it and return early to avoid panicking.
 	if srv.fastHotStuffConsensus == nil {
-		glog.Errorf("Server._handleFastHotStuffConsensusEvent: Consensus controller is nil")
+		srv.logger.Errorf("Server._handleFastHotStuffConsensusEvent: Consensus controller is nil")
+		return
+	}
+
+	// A standby doesn't sign anything until it takes over from the primary.
+	if !srv._isSigningForValidator() {
+		srv.logger.V(2).Infof("Server._handleFastHotStuffConsensusEvent: Standby is skipping consensus event: %s",
+			event.ToString())
 		return
 	}
 
@@ -2924,12 +3609,12 @@ func (srv *Server) _handleValidatorVote(pp *Peer, msg *MsgDeSoValidatorVote) {
 	// It's possible that the consensus controller hasn't been initialized. If so,
 	// we log an error and move on.
 	if srv.fastHotStuffConsensus == nil {
-		glog.Errorf("Server._handleValidatorVote: Consensus controller is nil")
+		srv.logger.Errorf("Server._handleValidatorVote: Consensus controller is nil")
 		return
 	}
 
 	if err := srv.fastHotStuffConsensus.HandleValidatorVote(pp, msg); err != nil {
-		glog.Errorf("Server._handleValidatorVote: Error handling vote message from peer: %v", err)
+		srv.logger.Errorf("Server._handleValidatorVote: Error handling vote message from peer: %v", err)
 	}
 }
 
@@ -2940,18 +3625,18 @@ func (srv *Server) _handleValidatorTimeout(pp *Peer, msg *MsgDeSoValidatorTimeou
 	// It's possible that the consensus controller hasn't been initialized. If so,
 	// we log an error and move on.
 	if srv.fastHotStuffConsensus == nil {
-		glog.Errorf("Server._handleValidatorTimeout: Consensus controller is nil")
+		srv.logger.Errorf("Server._handleValidatorTimeout: Consensus controller is nil")
 		return
 	}
 
 	missingBlockHashes, err := srv.fastHotStuffConsensus.HandleValidatorTimeout(pp, msg)
 	if err != nil {
-		glog.Errorf("Server._handleValidatorTimeout: Error handling timeout message from peer: %v", err)
+		srv.logger.Errorf("Server._handleValidatorTimeout: Error handling timeout message from peer: %v", err)
 	}
 
 	// If we have missing blocks to request, then we send a GetBlocks message to the peer.
 	if len(missingBlockHashes) > 0 {
-		srv.RequestBlocksByHash(pp, missingBlockHashes)
+		srv.RequestBlocksByHash(pp, missingBlockHashes, "")
 	}
 }
 
@@ -2982,31 +3667,38 @@ func (srv *Server) _startConsensus() {
 			break
 		}
 
+		// Consensus messages jump ahead of everything else, so that votes, timeouts, and blocks are handled
+		// as soon as they arrive even when other messages are backed up.
+		select {
+		case serverMessage := <-srv.getConsensusMessageChannel():
+			srv._handleLaneMessage(serverMessage, MessageLaneConsensus)
+			continue
+		default:
+		}
+
 		select {
 		case <-srv.getFastHotStuffTransitionCheckTime():
 			{
-				glog.V(2).Info("Server._startConsensus: Checking if FastHotStuffConsensus is ready to start")
+				srv.logger.V(2).Info("Server._startConsensus: Checking if FastHotStuffConsensus is ready to start")
 				srv.tryTransitionToFastHotStuffConsensus()
 			}
 
 		case consensusEvent := <-srv.getFastHotStuffConsensusEventChannel():
 			{
-				glog.V(2).Infof("Server._startConsensus: Received consensus event: %s", consensusEvent.ToString())
+				srv.logger.V(2).Infof("Server._startConsensus: Received consensus event: %s", consensusEvent.ToString())
 				srv._handleFastHotStuffConsensusEvent(consensusEvent)
 			}
 
-		case serverMessage := <-srv.incomingMessages:
+		case serverMessage := <-srv.getConsensusMessageChannel():
 			{
-				// There is an incoming network message from a peer.
-
-				glog.V(2).Infof("Server._startConsensus: Handling message of type %v from Peer %v",
-					serverMessage.Msg.GetMsgType(), serverMessage.Peer)
-				srv._handlePeerMessages(serverMessage)
+				// There is an incoming vote, timeout, or block from a peer.
+				srv._handleLaneMessage(serverMessage, MessageLaneConsensus)
+			}
 
-				// Always check for and handle control messages regardless of whether the
-				// BitcoinManager is synced. Note that we filter control messages out in a
-				// Peer's inHandler so any control message we get at this point should be bona fide.
-				shouldQuit := srv._handleControlMessages(serverMessage)
+		case serverMessage := <-srv.incomingMessages:
+			{
+				// There is an incoming network message from a peer, or a control message.
+				shouldQuit := srv._handleLaneMessage(serverMessage, MessageLaneDefault)
 				if shouldQuit {
 					break
 				}
@@ -3018,7 +3710,7 @@ func (srv *Server) _startConsensus() {
 	// If we broke out of the select statement then it's time to allow things to
 	// clean up.
 	srv.waitGroup.Done()
-	glog.V(2).Info("Server.Start: Server done")
+	srv.logger.V(2).Info("Server.Start: Server done")
 }
 
 func (srv *Server) getAddrsToBroadcast() []*SingleAddr {
@@ -3069,7 +3761,7 @@ func (srv *Server) _startAddressRelayer() {
 		}
 		// For the first ten minutes after the connection controller starts, relay our address to all
 		// peers. After the first ten minutes, do it once every 24 hours.
-		glog.V(1).Infof("Server.startAddressRelayer: Relaying our own addr to peers")
+		srv.logger.V(1).Infof("Server.startAddressRelayer: Relaying our own addr to peers")
 		remoteNodes := srv.networkManager.GetAllRemoteNodes().GetAll()
 		if numMinutesPassed < 10 || numMinutesPassed%(RebroadcastNodeAddrIntervalMinutes) == 0 {
 			for _, rn := range remoteNodes {
@@ -3082,7 +3774,7 @@ func (srv *Server) _startAddressRelayer() {
 				}
 				bestAddress := srv.AddrMgr.GetBestLocalAddress(netAddr)
 				if bestAddress != nil {
-					glog.V(2).Infof("Server.startAddressRelayer: Relaying address %v to "+
+					srv.logger.V(2).Infof("Server.startAddressRelayer: Relaying address %v to "+
 						"RemoteNode (id= %v)", bestAddress.Addr.String(), rn.GetId())
 					addrMsg := &MsgDeSoAddr{
 						AddrList: []*SingleAddr{
@@ -3095,23 +3787,23 @@ func (srv *Server) _startAddressRelayer() {
 						},
 					}
 					if err := rn.SendMessage(addrMsg); err != nil {
-						glog.Errorf("Server.startAddressRelayer: Problem sending "+
+						srv.logger.Errorf("Server.startAddressRelayer: Problem sending "+
 							"MsgDeSoAddr to RemoteNode (id= %v): %v", rn.GetId(), err)
 					}
 				}
 			}
 		}
 
-		glog.V(2).Infof("Server.startAddressRelayer: Seeing if there are addrs to relay...")
+		srv.logger.V(2).Infof("Server.startAddressRelayer: Seeing if there are addrs to relay...")
 		// Broadcast the addrs we have to all of our peers.
 		addrsToBroadcast := srv.getAddrsToBroadcast()
 		if len(addrsToBroadcast) == 0 {
-			glog.V(2).Infof("Server.startAddressRelayer: No addrs to relay.")
+			srv.logger.V(2).Infof("Server.startAddressRelayer: No addrs to relay.")
 			time.Sleep(AddrRelayIntervalSeconds * time.Second)
 			continue
 		}
 
-		glog.V(2).Infof("Server.startAddressRelayer: Found %d addrs to "+
+		srv.logger.V(2).Infof("Server.startAddressRelayer: Found %d addrs to "+
 			"relay: %v", len(addrsToBroadcast), spew.Sdump(addrsToBroadcast))
 		// Iterate over all our peers and broadcast the addrs to all of them.
 		for _, rn := range remoteNodes {
@@ -3122,7 +3814,7 @@ func (srv *Server) _startAddressRelayer() {
 				AddrList: addrsToBroadcast,
 			}
 			if err := rn.SendMessage(addrMsg); err != nil {
-				glog.Errorf("Server.startAddressRelayer: Problem sending "+
+				srv.logger.Errorf("Server.startAddressRelayer: Problem sending "+
 					"MsgDeSoAddr to RemoteNode (id= %v): %v", rn.GetId(), err)
 			}
 		}
@@ -3222,80 +3914,173 @@ func (srv *Server) _startTransactionRelayer() {
 	}
 }
 
-func (srv *Server) Stop() {
-	glog.Info("Server.Stop: Gracefully shutting down Server")
-
-	// Iterate through all the peers and flush their logs before we quit.
-	glog.Info("Server.Stop: Flushing logs for all peers")
-	atomic.AddInt32(&srv.shutdown, 1)
-
-	// Stop the ConnectionManager
-	srv.cmgr.Stop()
-	glog.Infof(CLog(Yellow, "Server.Stop: Closed the ConnectionManger"))
+// _startLocalTxnRebroadcaster must be run inside a goroutine. It rebroadcasts the local txns in the
+// PoS mempool to all peers every localTxnRebroadcastInterval, until the Server shuts down.
+func (srv *Server) _startLocalTxnRebroadcaster() {
+	// If we've set a maximum sync height, we will not relay transactions.
+	if srv.blockchain.MaxSyncBlockHeight > 0 || srv.localTxnRebroadcastInterval == 0 {
+		return
+	}
 
-	srv.networkManager.Stop()
-	glog.Infof(CLog(Yellow, "Server.Stop: Closed the NetworkManager"))
+	for {
+		time.Sleep(srv.localTxnRebroadcastInterval)
+		if atomic.LoadInt32(&srv.shutdown) >= 1 {
+			break
+		}
+		srv._rebroadcastLocalTransactions()
+	}
+}
 
-	// Stop the miner if we have one running.
-	if srv.miner != nil {
-		srv.miner.Stop()
-		glog.Infof(CLog(Yellow, "Server.Stop: Closed the Miner"))
+// _rebroadcastLocalTransactions sends an inv for each validated local txn to every peer. Unlike
+// _relayTransactions, it doesn't skip the txns a peer already knows about, since the peer may
+// have evicted them from its mempool since.
+func (srv *Server) _rebroadcastLocalTransactions() {
+	var invList []*InvVect
+	for _, localTxn := range srv.posMempool.GetLocalTransactions() {
+		if !localTxn.IsValidated() || srv.txnRelayFilter.IsTxnPaused(localTxn.Tx) {
+			continue
+		}
+		invList = append(invList, &InvVect{
+			Type: InvTypeTx,
+			Hash: *localTxn.Hash,
+		})
+	}
+	if len(invList) == 0 {
+		return
 	}
 
-	// Stop the PoS validator consensus if one is running
-	if srv.fastHotStuffConsensus != nil {
-		srv.fastHotStuffConsensus.Stop()
+	numPeers := 0
+	for _, pp := range srv.cmgr.GetAllPeers() {
+		if !pp.canReceiveInvMessages {
+			continue
+		}
+		invMsg := &MsgDeSoInv{}
+		for _, invVect := range invList {
+			pp.knownInventory.Add(*invVect, struct{}{})
+			invMsg.InvList = append(invMsg.InvList, invVect)
+		}
+		pp.AddDeSoMessage(invMsg, false)
+		numPeers++
 	}
+	srv.logger.V(1).Infof("Server._rebroadcastLocalTransactions: Rebroadcast %d local txns to %d peers",
+		len(invList), numPeers)
+}
 
-	// Stop the PoS block proposer if we have one running.
-	if srv.fastHotStuffConsensus != nil {
-		srv.fastHotStuffConsensus.fastHotStuffEventLoop.Stop()
-		glog.Infof(CLog(Yellow, "Server.Stop: Closed the fastHotStuffEventLoop"))
+// Stop shuts down the Server's subsystems in order. We stop producing blocks first, then wait for
+// any block that's being processed to finish flushing, then drain the mempools, stop the snapshot,
+// and finally close our peers. Doing it in this order means that the final mempool dump and the
+// snapshot see a chain that isn't changing underneath them.
+func (srv *Server) Stop() {
+	srv.logger.Info("Server.Stop: Gracefully shutting down Server")
+
+	if err := srv.newShutdownManager().Shutdown(); err != nil {
+		srv.logger.Errorf(CLog(Red, fmt.Sprintf("Server.Stop: Problem shutting down Server: %v", err)))
 	}
+	srv.logger.Info("Server.Stop: Successfully shut down Server")
+}
 
-	// TODO: Stop the PoS mempool if we have one running.
+// newShutdownManager returns a ShutdownManager with the stages that Stop runs.
+func (srv *Server) newShutdownManager() *ShutdownManager {
+	shutdownManager := NewShutdownManager()
 
-	if srv.mempool != nil {
-		// Before the node shuts down, write all the mempool txns to disk
-		// if the flag is set.
-		if srv.mempool.mempoolDir != "" {
-			glog.Info("Doing final mempool dump...")
-			srv.mempool.DumpTxnsToDB()
-			glog.Info("Final mempool dump complete!")
+	shutdownManager.AddStage("block producers", 0, func() error {
+		// Stop the miner if we have one running.
+		if srv.miner != nil {
+			srv.miner.Stop()
+			srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed the Miner"))
 		}
 
-		if !srv.mempool.stopped {
-			srv.mempool.Stop()
+		// Stop the PoS validator consensus and its event loop if one is running.
+		if srv.fastHotStuffConsensus != nil {
+			srv.fastHotStuffConsensus.Stop()
+			srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed the fastHotStuffEventLoop"))
+		}
+
+		// Stop the block producer
+		if srv.blockProducer != nil {
+			if srv.blockchain.MaxSyncBlockHeight == 0 {
+				srv.blockProducer.Stop()
+			}
+			srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed BlockProducer"))
+		}
+		return nil
+	})
+
+	shutdownManager.AddStage("block processing", 0, func() error {
+		// This will signal the Server's goroutines to quit once they finish the message they're
+		// currently handling.
+		atomic.AddInt32(&srv.shutdown, 1)
+		if srv.messageLanes != nil {
+			close(srv.messageLanes.quit)
 		}
-		glog.Infof(CLog(Yellow, "Server.Stop: Closed Mempool"))
-	}
 
-	glog.Infof(CLog(Yellow, "Server.Stop: Closed PosMempool"))
-	srv.posMempool.Stop()
+		// Wake up the message loop in case it's waiting for a message. The channel is buffered,
+		// so this doesn't block even if the loop has already quit.
+		go func() {
+			srv.incomingMessages <- &ServerMessage{
+				// Peer is ignored for MsgDeSoQuit.
+				Peer: nil,
+				Msg:  &MsgDeSoQuit{},
+			}
+		}()
 
-	// Stop the block producer
-	if srv.blockProducer != nil {
-		if srv.blockchain.MaxSyncBlockHeight == 0 {
-			srv.blockProducer.Stop()
+		// Wait for the message loop to quit. After this no more blocks are processed from peers.
+		srv.waitGroup.Wait()
+
+		// Blocks can also be processed outside of the message loop, e.g. by the miner. Taking the
+		// ChainLock waits for any of those to finish connecting and flushing.
+		if srv.blockchain != nil {
+			srv.blockchain.ChainLock.Lock()
+			srv.blockchain.ChainLock.Unlock()
 		}
-		glog.Infof(CLog(Yellow, "Server.Stop: Closed BlockProducer"))
-	}
+		srv.logger.Infof(CLog(Yellow, "Server.Stop: Finished processing blocks"))
+		return nil
+	})
 
-	// This will signal any goroutines to quit. Note that enqueing this after stopping
-	// the ConnectionManager seems like it should cause the Server to process any remaining
-	// messages before calling waitGroup.Done(), which seems like a good thing.
-	go func() {
-		srv.incomingMessages <- &ServerMessage{
-			// Peer is ignored for MsgDeSoQuit.
-			Peer: nil,
-			Msg:  &MsgDeSoQuit{},
+	shutdownManager.AddStage("mempools", 2*DefaultShutdownStageTimeout, func() error {
+		if srv.mempool != nil {
+			// Stop waits for the periodic dumper, so the final dump below runs on its own.
+			if !srv.mempool.stopped {
+				srv.mempool.Stop()
+			}
+			// Before the node shuts down, write all the mempool txns to disk
+			// if the flag is set.
+			if srv.mempool.mempoolDir != "" {
+				srv.logger.Info("Doing final mempool dump...")
+				srv.mempool.DumpTxnsToDB()
+				srv.logger.Info("Final mempool dump complete!")
+			}
+			srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed Mempool"))
 		}
-	}()
 
-	// Wait for the server to fully shut down.
-	// TODO: shouldn't we wait for all modules to shutdown?
-	srv.waitGroup.Wait()
-	glog.Info("Server.Stop: Successfully shut down Server")
+		// Stopping the PosMempool drains its persister to the mempool db.
+		if srv.posMempool != nil {
+			srv.posMempool.Stop()
+			srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed PosMempool"))
+		}
+		return nil
+	})
+
+	shutdownManager.AddStage("snapshot", 2*DefaultShutdownStageTimeout, func() error {
+		// Stop waits for the snapshot's outstanding operations, including the checksum, to finish.
+		if srv.blockchain != nil && srv.blockchain.snapshot != nil {
+			srv.blockchain.snapshot.Stop()
+			srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed Snapshot"))
+		}
+		return nil
+	})
+
+	shutdownManager.AddStage("peers", 0, func() error {
+		// Stop the ConnectionManager
+		srv.cmgr.Stop()
+		srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed the ConnectionManger"))
+
+		srv.networkManager.Stop()
+		srv.logger.Infof(CLog(Yellow, "Server.Stop: Closed the NetworkManager"))
+		return nil
+	})
+
+	return shutdownManager
 }
 
 func (srv *Server) GetStatsdClient() *statsd.Client {
@@ -3308,7 +4093,7 @@ func (srv *Server) GetStatsdClient() *statsd.Client {
 func (srv *Server) Start() {
 	// Start the Server so that it will be ready to process messages once the ConnectionManager
 	// finds some Peers.
-	glog.Info("Server.Start: Starting Server")
+	srv.logger.Info("Server.Start: Starting Server")
 	srv.waitGroup.Add(1)
 
 	go srv._startConsensus()
@@ -3317,6 +4102,18 @@ func (srv *Server) Start() {
 
 	go srv._startTransactionRelayer()
 
+	go srv._startLocalTxnRebroadcaster()
+
+	go srv._startTxnReconciler()
+
+	go srv._startFeeTelemetry()
+
+	go srv._startValidatorHeartbeats()
+
+	for _, txnMessages := range srv.messageLanes.txnMessages {
+		go srv._startTxnMessageWorker(txnMessages)
+	}
+
 	srv.posMempool.Start()
 
 	// Once the ConnectionManager is started, peers will be found and connected to and
@@ -3367,9 +4164,64 @@ type SyncProgress struct {
 	// Completed indicates whether we've finished syncing state.
 	Completed bool
 
+	// UseFormatV2 indicates whether we're downloading the snapshot in the v2 format, where chunks are
+	// fetched by index from every peer that supports SFHyperSyncV2, and verified against StateRoot on
+	// receipt. It is set when hypersync starts if the sync peer supports the v2 format and we have
+	// trusted snapshot signers.
+	UseFormatV2 bool
+	// StateRoot is the v2 state root of the snapshot we're downloading. It is set from the response
+	// to our request for the first chunk, which we always send to the sync peer.
+	StateRoot *SnapshotStateRoot
+	// NumChunksReceived is the number of v2 chunks that we've received and verified.
+	NumChunksReceived uint64
+	// ChunksInFlight maps a peer ID to the index of the v2 chunk we've requested from that peer. A peer
+	// can only have one snapshot request in flight at a time.
+	ChunksInFlight map[uint64]uint64
+	// nextChunkIndex is the lowest chunk index that we haven't requested yet, and chunksToRetry are the
+	// chunks that were requested from peers that disconnected or misbehaved before sending them.
+	nextChunkIndex uint64
+	chunksToRetry  []uint64
+
 	printChannel chan struct{}
 }
 
+// resetChunkProgress resets the v2 chunk progress at the start of hyper sync.
+func (progress *SyncProgress) resetChunkProgress(useFormatV2 bool) {
+	progress.UseFormatV2 = useFormatV2
+	progress.StateRoot = nil
+	progress.NumChunksReceived = 0
+	progress.ChunksInFlight = make(map[uint64]uint64)
+	progress.nextChunkIndex = 0
+	progress.chunksToRetry = nil
+}
+
+// popChunkToRequest returns the next v2 chunk that we should request, or false if every chunk has been
+// requested. Must only be called once the StateRoot is known.
+func (progress *SyncProgress) popChunkToRequest() (_chunkIndex uint64, _exists bool) {
+	if len(progress.chunksToRetry) > 0 {
+		chunkIndex := progress.chunksToRetry[len(progress.chunksToRetry)-1]
+		progress.chunksToRetry = progress.chunksToRetry[:len(progress.chunksToRetry)-1]
+		return chunkIndex, true
+	}
+	if progress.nextChunkIndex >= progress.StateRoot.NumChunks {
+		return 0, false
+	}
+	progress.nextChunkIndex++
+	return progress.nextChunkIndex - 1, true
+}
+
+// releaseChunkInFlight marks the v2 chunk requested from the peer, if any, as needing to be requested again.
+// It returns true if the peer had a chunk in flight.
+func (progress *SyncProgress) releaseChunkInFlight(peerID uint64) bool {
+	chunkIndex, exists := progress.ChunksInFlight[peerID]
+	if !exists {
+		return false
+	}
+	delete(progress.ChunksInFlight, peerID)
+	progress.chunksToRetry = append(progress.chunksToRetry, chunkIndex)
+	return true
+}
+
 func (progress *SyncProgress) PrintLoop() {
 	progress.printChannel = make(chan struct{})
 	ticker := time.NewTicker(60 * time.Second)
@@ -3380,6 +4232,14 @@ func (progress *SyncProgress) PrintLoop() {
 		case <-progress.printChannel:
 			return
 		case <-ticker.C:
+			if progress.UseFormatV2 {
+				if progress.StateRoot != nil {
+					glog.Infof(CLog(Magenta, fmt.Sprintf("HyperSync: downloaded (%v/%v) snapshot chunks, "+
+						"(%v) chunk requests in flight", progress.NumChunksReceived, progress.StateRoot.NumChunks,
+						len(progress.ChunksInFlight))))
+				}
+				continue
+			}
 			var completedPrefixes [][]byte
 			var incompletePrefixes [][]byte
 			var currentPrefix []byte
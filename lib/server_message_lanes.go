@@ -0,0 +1,233 @@
+package lib
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Message Lanes
+//
+// The messages a Peer receives are forwarded to the Server through one of three lanes, depending on their type:
+//   - The consensus lane carries votes, timeouts, blocks, compact blocks, and validator heartbeats. It's drained by the consensus
+//     event loop ahead of everything else, so that a block proposal or a vote is never stuck behind a backlog of
+//     other messages.
+//   - The txn lane carries INVs, transaction bundles, and the other messages used to relay transactions. It's
+//     drained by a pool of txn workers, separately from the consensus event loop. Each peer's messages always go to
+//     the same worker, so that they're processed in the order the peer sent them.
+//   - The default lane carries every other message, along with the control messages the Server sends itself. It's
+//     drained by the consensus event loop, after the consensus lane.
+//
+// A Peer's inHandler blocks while the lane it forwards a message to is full, which holds up every message the peer
+// sends after it. To keep a flood of transactions from holding up the peer's consensus messages, a txn message that
+// doesn't fit in its worker's queue is dropped instead. Transactions are best-effort, and a dropped INV or
+// transaction bundle is recovered the next time the transaction is announced or requested.
+
+// MessageLane is the lane through which a Peer forwards a message to the Server.
+type MessageLane uint8
+
+const (
+	MessageLaneConsensus MessageLane = 0
+	MessageLaneTxn       MessageLane = 1
+	MessageLaneDefault   MessageLane = 2
+	numMessageLanes                  = 3
+)
+
+const (
+	// DefaultTxnMessageWorkers is the default number of workers that process the messages in the txn lane.
+	DefaultTxnMessageWorkers = 4
+
+	// txnMessageLaneQueueSize is the number of messages each txn worker can have queued before the messages sent to
+	// it are dropped.
+	txnMessageLaneQueueSize = 1000
+)
+
+func (lane MessageLane) String() string {
+	switch lane {
+	case MessageLaneConsensus:
+		return "CONSENSUS"
+	case MessageLaneTxn:
+		return "TXN"
+	case MessageLaneDefault:
+		return "DEFAULT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// GetMessageLane returns the lane through which messages of the given type are forwarded to the Server.
+func GetMessageLane(msgType MsgType) MessageLane {
+	switch msgType {
+	case MsgTypeValidatorVote, MsgTypeValidatorTimeout, MsgTypeBlock, MsgTypeValidatorHeartbeat,
+		MsgTypeCompactBlock, MsgTypeBlockTxns:
+		return MessageLaneConsensus
+	case MsgTypeInv, MsgTypeGetTransactions, MsgTypeTransactionBundle, MsgTypeTransactionBundleV2, MsgTypeMempool,
+		MsgTypeReconcileTxnsRequest, MsgTypeReconcileTxnsSketch, MsgTypeReconcileTxnsDiff:
+		return MessageLaneTxn
+	default:
+		return MessageLaneDefault
+	}
+}
+
+// MessageLaneStats holds the counters of a message lane since the Server started.
+type MessageLaneStats struct {
+	Lane MessageLane
+	// NumReceived is the number of messages forwarded to the lane.
+	NumReceived uint64
+	// NumProcessed is the number of messages in the lane that were processed.
+	NumProcessed uint64
+	// NumDropped is the number of messages dropped because the lane was full.
+	NumDropped uint64
+	// QueueLength is the number of messages currently waiting in the lane.
+	QueueLength uint64
+	// ProcessingTime is the total time spent processing the messages in the lane.
+	ProcessingTime time.Duration
+}
+
+type messageLaneCounters struct {
+	numReceived         uint64
+	numProcessed        uint64
+	numDropped          uint64
+	processingTimeNanos uint64
+}
+
+// serverMessageLanes holds the queues of the message lanes, along with their counters.
+type serverMessageLanes struct {
+	defaultMessages   chan *ServerMessage
+	consensusMessages chan *ServerMessage
+	// txnMessages holds a queue for each txn worker. Peers are assigned to workers by ID.
+	txnMessages []chan *ServerMessage
+
+	counters [numMessageLanes]messageLaneCounters
+
+	// quit is closed to stop the txn workers.
+	quit chan struct{}
+}
+
+func newServerMessageLanes(defaultMessages chan *ServerMessage, consensusQueueSize uint32,
+	numTxnWorkers uint64) *serverMessageLanes {
+
+	lanes := &serverMessageLanes{
+		defaultMessages:   defaultMessages,
+		consensusMessages: make(chan *ServerMessage, consensusQueueSize),
+		quit:              make(chan struct{}),
+	}
+	if numTxnWorkers == 0 {
+		numTxnWorkers = 1
+	}
+	for ii := uint64(0); ii < numTxnWorkers; ii++ {
+		lanes.txnMessages = append(lanes.txnMessages, make(chan *ServerMessage, txnMessageLaneQueueSize))
+	}
+	return lanes
+}
+
+// enqueue forwards a message from a Peer to its lane. It blocks while the consensus or the default lane is full, and
+// returns false if the message was dropped because the txn lane was full.
+func (lanes *serverMessageLanes) enqueue(serverMessage *ServerMessage) bool {
+	lane := GetMessageLane(serverMessage.Msg.GetMsgType())
+	switch lane {
+	case MessageLaneConsensus:
+		lanes.consensusMessages <- serverMessage
+	case MessageLaneTxn:
+		select {
+		case lanes.txnMessages[serverMessage.Peer.ID%uint64(len(lanes.txnMessages))] <- serverMessage:
+		default:
+			atomic.AddUint64(&lanes.counters[lane].numDropped, 1)
+			return false
+		}
+	default:
+		lanes.defaultMessages <- serverMessage
+	}
+	atomic.AddUint64(&lanes.counters[lane].numReceived, 1)
+	return true
+}
+
+// recordProcessed updates the counters of a lane after one of its messages was processed.
+func (lanes *serverMessageLanes) recordProcessed(lane MessageLane, processingTime time.Duration) {
+	atomic.AddUint64(&lanes.counters[lane].numProcessed, 1)
+	atomic.AddUint64(&lanes.counters[lane].processingTimeNanos, uint64(processingTime.Nanoseconds()))
+}
+
+func (lanes *serverMessageLanes) stats() []MessageLaneStats {
+	queueLengths := [numMessageLanes]uint64{
+		MessageLaneConsensus: uint64(len(lanes.consensusMessages)),
+		MessageLaneDefault:   uint64(len(lanes.defaultMessages)),
+	}
+	for _, txnMessages := range lanes.txnMessages {
+		queueLengths[MessageLaneTxn] += uint64(len(txnMessages))
+	}
+
+	stats := []MessageLaneStats{}
+	for lane := MessageLane(0); lane < numMessageLanes; lane++ {
+		counters := &lanes.counters[lane]
+		stats = append(stats, MessageLaneStats{
+			Lane:           lane,
+			NumReceived:    atomic.LoadUint64(&counters.numReceived),
+			NumProcessed:   atomic.LoadUint64(&counters.numProcessed),
+			NumDropped:     atomic.LoadUint64(&counters.numDropped),
+			QueueLength:    queueLengths[lane],
+			ProcessingTime: time.Duration(atomic.LoadUint64(&counters.processingTimeNanos)),
+		})
+	}
+	return stats
+}
+
+// GetMessageLaneStats returns the counters of each message lane, or nil if the Server doesn't use message lanes.
+func (srv *Server) GetMessageLaneStats() []MessageLaneStats {
+	if srv.messageLanes == nil {
+		return nil
+	}
+	return srv.messageLanes.stats()
+}
+
+// getConsensusMessageChannel returns the queue of the consensus lane, or nil if the Server doesn't use message lanes.
+func (srv *Server) getConsensusMessageChannel() chan *ServerMessage {
+	if srv.messageLanes == nil {
+		return nil
+	}
+	return srv.messageLanes.consensusMessages
+}
+
+// _handleLaneMessage processes a message from one of the lanes and records it in the lane's counters. It returns
+// true if the message tells the Server to quit.
+func (srv *Server) _handleLaneMessage(serverMessage *ServerMessage, lane MessageLane) (_shouldQuit bool) {
+	srv.logger.V(2).Infof("Server._handleLaneMessage: Handling message of type %v from Peer %v in lane %v",
+		serverMessage.Msg.GetMsgType(), serverMessage.Peer, lane)
+
+	startTime := time.Now()
+	srv._handlePeerMessages(serverMessage)
+
+	// Always check for and handle control messages regardless of whether the
+	// BitcoinManager is synced. Note that we filter control messages out in a
+	// Peer's inHandler so any control message we get at this point should be bona fide.
+	shouldQuit := srv._handleControlMessages(serverMessage)
+
+	if srv.messageLanes != nil {
+		srv.messageLanes.recordProcessed(lane, time.Since(startTime))
+	}
+	return shouldQuit
+}
+
+// _startTxnMessageWorker must be run inside a goroutine. It processes the messages sent to a txn worker until the
+// Server shuts down.
+func (srv *Server) _startTxnMessageWorker(txnMessages chan *ServerMessage) {
+	for {
+		select {
+		case serverMessage := <-txnMessages:
+			srv._handleLaneMessage(serverMessage, MessageLaneTxn)
+		case <-srv.messageLanes.quit:
+			return
+		}
+	}
+}
+
+// _forwardMessageToServer sends a message received from the peer to the Server, through the message's lane.
+func (pp *Peer) _forwardMessageToServer(serverMessage *ServerMessage) {
+	if pp.srv == nil || pp.srv.messageLanes == nil {
+		pp.MessageChan <- serverMessage
+		return
+	}
+	if !pp.srv.messageLanes.enqueue(serverMessage) {
+		pp.logger.V(1).Infof("Peer._forwardMessageToServer: [%v] Dropping message of type %v from Peer %v because "+
+			"the txn lane is full", serverMessage.CorrelationID, serverMessage.Msg.GetMsgType(), pp)
+	}
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMessageLanes(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(MessageLaneConsensus, GetMessageLane(MsgTypeValidatorVote))
+	require.Equal(MessageLaneConsensus, GetMessageLane(MsgTypeValidatorTimeout))
+	require.Equal(MessageLaneConsensus, GetMessageLane(MsgTypeBlock))
+	require.Equal(MessageLaneConsensus, GetMessageLane(MsgTypeCompactBlock))
+	require.Equal(MessageLaneTxn, GetMessageLane(MsgTypeInv))
+	require.Equal(MessageLaneTxn, GetMessageLane(MsgTypeTransactionBundleV2))
+	require.Equal(MessageLaneTxn, GetMessageLane(MsgTypeReconcileTxnsSketch))
+	require.Equal(MessageLaneDefault, GetMessageLane(MsgTypeHeaderBundle))
+	require.Equal(MessageLaneDefault, GetMessageLane(MsgTypeNewConnection))
+
+	defaultMessages := make(chan *ServerMessage, 10)
+	lanes := newServerMessageLanes(defaultMessages, 10, 2)
+	peers := []*Peer{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	// Each peer's txn messages go to the same worker.
+	for ii := 0; ii < 3; ii++ {
+		for _, pp := range peers {
+			require.True(lanes.enqueue(&ServerMessage{Peer: pp, Msg: &MsgDeSoInv{}}))
+		}
+	}
+	require.Len(lanes.txnMessages[0], 3)
+	require.Len(lanes.txnMessages[1], 6)
+	for workerIndex, txnMessages := range lanes.txnMessages {
+		for len(txnMessages) > 0 {
+			require.Equal(uint64(workerIndex), (<-txnMessages).Peer.ID%2)
+		}
+	}
+
+	// Consensus and default messages aren't held up by a full txn lane.
+	for ii := 0; ii < txnMessageLaneQueueSize; ii++ {
+		require.True(lanes.enqueue(&ServerMessage{Peer: peers[0], Msg: &MsgDeSoTransactionBundleV2{}}))
+	}
+	require.False(lanes.enqueue(&ServerMessage{Peer: peers[0], Msg: &MsgDeSoInv{}}))
+	require.True(lanes.enqueue(&ServerMessage{Peer: peers[0], Msg: &MsgDeSoValidatorVote{}}))
+	require.True(lanes.enqueue(&ServerMessage{Peer: peers[0], Msg: &MsgDeSoHeaderBundle{}}))
+	require.Len(lanes.consensusMessages, 1)
+	require.Len(defaultMessages, 1)
+
+	lanes.recordProcessed(MessageLaneConsensus, time.Millisecond)
+	stats := lanes.stats()
+	require.Len(stats, numMessageLanes)
+	require.Equal(MessageLaneStats{
+		Lane:           MessageLaneConsensus,
+		NumReceived:    1,
+		NumProcessed:   1,
+		QueueLength:    1,
+		ProcessingTime: time.Millisecond,
+	}, stats[MessageLaneConsensus])
+	require.Equal(uint64(9+txnMessageLaneQueueSize), stats[MessageLaneTxn].NumReceived)
+	require.Equal(uint64(1), stats[MessageLaneTxn].NumDropped)
+	require.Equal(uint64(txnMessageLaneQueueSize), stats[MessageLaneTxn].QueueLength)
+	require.Equal(uint64(1), stats[MessageLaneDefault].NumReceived)
+}
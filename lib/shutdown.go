@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Shutdown
+//
+// A node is made up of subsystems that depend on each other: the miner and the block producers feed blocks to
+// the blockchain, the blockchain flushes blocks to the DB and the snapshot, the mempools track the chain and
+// persist their txns, and peers feed all of them. Stopping these in an arbitrary order causes problems on exit. A
+// final mempool dump that runs while a block is still being connected, or while the periodic dumper is writing
+// the same files, can leave a corrupted dump behind.
+//
+// The ShutdownManager stops the subsystems as an ordered list of stages. Each stage runs only after the stage
+// before it has finished or timed out. A stage that times out is logged and left to finish in the background, so
+// that one stuck subsystem can't prevent the rest of the node from shutting down.
+
+// DefaultShutdownStageTimeout is how long a shutdown stage gets to finish when no timeout is given.
+const DefaultShutdownStageTimeout = 30 * time.Second
+
+// ShutdownStage is one step of a shutdown. Stop should block until the subsystems it's responsible for have
+// finished their work.
+type ShutdownStage struct {
+	Name    string
+	Timeout time.Duration
+	Stop    func() error
+}
+
+type ShutdownManager struct {
+	mtx    sync.Mutex
+	stages []*ShutdownStage
+	// Shutdown only runs the stages the first time it's called.
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+func NewShutdownManager() *ShutdownManager {
+	return &ShutdownManager{}
+}
+
+// AddStage appends a stage to the shutdown. Stages run in the order they're added. A timeout of zero means
+// DefaultShutdownStageTimeout.
+func (sm *ShutdownManager) AddStage(name string, timeout time.Duration, stop func() error) {
+	if timeout == 0 {
+		timeout = DefaultShutdownStageTimeout
+	}
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	sm.stages = append(sm.stages, &ShutdownStage{
+		Name:    name,
+		Timeout: timeout,
+		Stop:    stop,
+	})
+}
+
+// Shutdown runs all of the stages in order. It returns an error naming every stage that failed or timed out,
+// and nil if all of them finished cleanly. Calling Shutdown more than once is safe, and later calls return the
+// result of the first one.
+func (sm *ShutdownManager) Shutdown() error {
+	sm.shutdownOnce.Do(func() {
+		sm.mtx.Lock()
+		stages := append([]*ShutdownStage{}, sm.stages...)
+		sm.mtx.Unlock()
+
+		var stageErrors []string
+		for _, stage := range stages {
+			if err := sm.runStage(stage); err != nil {
+				glog.Errorf(CLog(Red, fmt.Sprintf("ShutdownManager.Shutdown: %v", err)))
+				stageErrors = append(stageErrors, err.Error())
+			}
+		}
+		if len(stageErrors) > 0 {
+			sm.shutdownErr = fmt.Errorf("ShutdownManager.Shutdown: Problem with %v stage(s): %v",
+				len(stageErrors), strings.Join(stageErrors, "; "))
+		}
+	})
+	return sm.shutdownErr
+}
+
+func (sm *ShutdownManager) runStage(stage *ShutdownStage) error {
+	glog.Infof(CLog(Yellow, fmt.Sprintf("ShutdownManager: Stopping %v...", stage.Name)))
+	startTime := time.Now()
+
+	// The channel is buffered so that a stage that finishes after its timeout doesn't leak its goroutine.
+	doneChan := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				doneChan <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		doneChan <- stage.Stop()
+	}()
+
+	select {
+	case err := <-doneChan:
+		if err != nil {
+			return fmt.Errorf("stage %v failed: %v", stage.Name, err)
+		}
+		glog.Infof(CLog(Yellow, fmt.Sprintf("ShutdownManager: Stopped %v in %v", stage.Name, time.Since(startTime))))
+		return nil
+	case <-time.After(stage.Timeout):
+		return fmt.Errorf("stage %v timed out after %v", stage.Name, stage.Timeout)
+	}
+}
@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownManager(t *testing.T) {
+	require := require.New(t)
+
+	var stoppedStages []string
+	blockStage := make(chan struct{})
+	defer close(blockStage)
+
+	shutdownManager := NewShutdownManager()
+	shutdownManager.AddStage("first", 0, func() error {
+		stoppedStages = append(stoppedStages, "first")
+		return nil
+	})
+	shutdownManager.AddStage("failing", 0, func() error {
+		stoppedStages = append(stoppedStages, "failing")
+		return fmt.Errorf("failed to stop")
+	})
+	shutdownManager.AddStage("stuck", 10*time.Millisecond, func() error {
+		<-blockStage
+		return nil
+	})
+	shutdownManager.AddStage("panicking", 0, func() error {
+		panic("failed to stop")
+	})
+	shutdownManager.AddStage("last", 0, func() error {
+		stoppedStages = append(stoppedStages, "last")
+		return nil
+	})
+
+	// Every stage runs in order, even after a stage fails, times out, or panics.
+	err := shutdownManager.Shutdown()
+	require.Error(err)
+	require.Equal([]string{"first", "failing", "last"}, stoppedStages)
+	require.Contains(err.Error(), "stage failing failed: failed to stop")
+	require.Contains(err.Error(), "stage stuck timed out")
+	require.Contains(err.Error(), "stage panicking failed: panic: failed to stop")
+	require.NotContains(err.Error(), "stage first")
+	require.NotContains(err.Error(), "stage last")
+
+	// The stages only run once.
+	require.Equal(err, shutdownManager.Shutdown())
+	require.Equal([]string{"first", "failing", "last"}, stoppedStages)
+
+	// A shutdown with no problems doesn't return an error.
+	require.NoError(NewShutdownManager().Shutdown())
+}
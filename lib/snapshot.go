@@ -53,6 +53,11 @@ var (
 	_prefixOperationChannelStatus = []byte{4}
 
 	_prefixMigrationStatus = []byte{5}
+
+	// This prefix saves the state checksum after every block when the continuous checksum is enabled.
+	// See snapshot_continuous_checksum.go.
+	// 	<prefix [1]byte, blockheight [8]byte> -> <block hash [32]byte, checksum bytes [32]byte>
+	_prefixChecksumByBlockHeight = []byte{6}
 )
 
 // getMainDbPrefix is a helper function thatused to get the main db prefix for a given snapshot db prefix.
@@ -315,6 +320,10 @@ type Snapshot struct {
 	// saves us read time when we're writing to the DB during UtxoView flush.
 	DatabaseCache lru.Map[string, []byte]
 
+	// StateCache holds the hot state entries that were recently read from the DB. It's nil unless the node
+	// is configured with a StateCacheMaxBytes. See state_cache.go.
+	StateCache *StateCache
+
 	// AncestralFlushCounter is used to offset ancestral records flush to occur only after x blocks.
 	AncestralFlushCounter uint64
 
@@ -330,6 +339,10 @@ type Snapshot struct {
 	// much memory.
 	operationQueueSemaphore chan struct{}
 
+	// chunkApplier sets the snapshot chunks we get during hypersync with a pool of workers. It's nil if chunks
+	// are set one at a time. See snapshot_chunk_applier.go for details.
+	chunkApplier *snapshotChunkApplier
+
 	// Checksum allows us to confirm integrity of the state so that when we're syncing with peers,
 	// we are confident that data wasn't tampered with.
 	Checksum *StateChecksum
@@ -342,6 +355,17 @@ type Snapshot struct {
 	// state checksum.
 	CurrentEpochSnapshotMetadata *SnapshotEpochMetadata
 
+	// stateRootSigner signs the state root of the current snapshot epoch, if the node has a BLS key.
+	// manifest holds the v2 snapshot chunks of the current snapshot epoch. It is built the first time
+	// a peer requests a v2 chunk. See snapshot_state_root.go for details.
+	stateRootSigner *BLSSigner
+	manifestMutex   sync.Mutex
+	manifest        *snapshotManifest
+
+	// StateCommitment is the optional Merkle trie over the state, which is updated on every flush. It is nil
+	// unless the state commitment is enabled. See state_commitment.go for details.
+	StateCommitment *StateCommitment
+
 	// Status is used to monitor the health of the snapshot. Snapshot is updated concurrently to the main
 	// block processing thread. Snapshot is efficient and doesn't stall the main thread, instead it does
 	// the snapshot computation in parallel. In a way, Snapshot plays catch with the main thread. As you
@@ -356,6 +380,9 @@ type Snapshot struct {
 
 	isTxIndex       bool
 	disableChecksum bool
+	// continuousChecksum is set when the checksum is kept up to date on every flush and recorded for every
+	// block. See snapshot_continuous_checksum.go.
+	continuousChecksum bool
 
 	// ExitChannel is used to stop the snapshot when shutting down the node.
 	ExitChannel chan bool
@@ -377,6 +404,7 @@ func NewSnapshot(
 	params *DeSoParams,
 	disableMigrations bool,
 	hypersyncMaxQueueSize uint32,
+	hypersyncChunkApplyWorkers uint32,
 	eventManager *EventManager,
 ) (
 	_snap *Snapshot,
@@ -390,6 +418,9 @@ func NewSnapshot(
 	if hypersyncMaxQueueSize == 0 {
 		hypersyncMaxQueueSize = HypersyncDefaultMaxQueueSize
 	}
+	if hypersyncChunkApplyWorkers == 0 {
+		hypersyncChunkApplyWorkers = HypersyncDefaultChunkApplyWorkers
+	}
 
 	// Retrieve and initialize the checksum.
 	checksum := &StateChecksum{}
@@ -506,6 +537,10 @@ func NewSnapshot(
 	}
 	// Now we will set the handler for finishing all operations in the operation channel.
 	snap.OperationChannel.SetFinishAllOperationsHandler(snap.PersistChecksumAndMigration)
+	// With a single worker, the Run loop sets the chunks itself.
+	if hypersyncChunkApplyWorkers > 1 {
+		snap.chunkApplier = newSnapshotChunkApplier(snap, hypersyncChunkApplyWorkers)
+	}
 	// Run the snapshot main loop.
 	go snap.Run()
 
@@ -519,6 +554,18 @@ func (snap *Snapshot) Run() {
 	snap.updateWaitGroup.Add(1)
 	for {
 		operation := snap.OperationChannel.DequeueOperationStateless()
+		if snap.chunkApplier != nil {
+			// The chunk applier finishes the operation once the chunk is set.
+			if operation.operationType == SnapshotOperationProcessChunk {
+				glog.V(1).Infof("Snapshot.Run: Number of operations in the operation channel (%v)",
+					snap.OperationChannel.GetStatus())
+				snap.chunkApplier.Enqueue(operation)
+				continue
+			}
+			// Other operations expect the chunks enqueued before them to be set, so we let the chunk
+			// applier catch up first.
+			snap.chunkApplier.Wait()
+		}
 		switch operation.operationType {
 		case SnapshotOperationFlush:
 			// When the snapshot logic was changed to be synchronous and blocking,
@@ -628,6 +675,9 @@ func (snap *Snapshot) FinishProcessBlock(blockNode *BlockNode) {
 	glog.V(1).Infof("Snapshot.FinishProcessBlock: Processing block with height (%v) and hash (%v)",
 		blockNode.Height, blockNode.Hash)
 
+	// The block's state has been committed, so the hot entries it wrote can be cached again.
+	snap.StateCache.EndFlush(snap.mainDb)
+
 	snap.CurrentEpochSnapshotMetadata.updateMutex.Lock()
 	defer snap.CurrentEpochSnapshotMetadata.updateMutex.Unlock()
 
@@ -644,6 +694,13 @@ func (snap *Snapshot) FinishProcessBlock(blockNode *BlockNode) {
 	}
 
 	snap.snapshotProcessBlockNoLock(blockNode)
+
+	if snap.continuousChecksum {
+		if err := snap.recordBlockChecksum(blockNode); err != nil {
+			glog.Errorf("Snapshot.FinishProcessBlock: Problem recording checksum for block with height (%v): %v",
+				blockNode.Height, err)
+		}
+	}
 }
 
 func (snap *Snapshot) ProcessSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.RWMutex,
@@ -842,6 +899,23 @@ func (snap *Snapshot) flushAncestralRecordsHelper(
 	if err != nil {
 		return errors.Wrapf(err, "Snapshot.FlushAncestralRecords: Problem flushing checksum bytes")
 	}
+	// If the ancestral records are stored in a DB of their own, they're committed before txn is. A record holds
+	// the value a key had at the snapshot height, which is still right if txn then fails, and the record is
+	// skipped when the flush is retried.
+	if ancestralDb := GetAncestralRecordsDB(snap.mainDb); ancestralDb != nil {
+		return ancestralDb.Update(func(ancestralTxn *badger.Txn) error {
+			return snap.setAncestralRecordsWithTxn(ancestralTxn, recordsKeyList, oldestAncestralCache, blockHeight)
+		})
+	}
+	return snap.setAncestralRecordsWithTxn(txn, recordsKeyList, oldestAncestralCache, blockHeight)
+}
+
+func (snap *Snapshot) setAncestralRecordsWithTxn(
+	txn *badger.Txn,
+	recordsKeyList []string,
+	oldestAncestralCache *AncestralCache,
+	blockHeight uint64) error {
+	var err error
 	// Iterate through all now-sorted keys.
 	glog.V(2).Infof("Snapshot.FlushAncestralRecords: Adding (%v) new records", len(recordsKeyList))
 	glog.V(2).Infof("Snapshot.FlushAncestralRecords: Adding (%v) ancestral records", len(oldestAncestralCache.AncestralRecordsMap))
@@ -901,7 +975,7 @@ func (snap *Snapshot) DeleteAncestralRecords(height uint64) error {
 	defer snap.SnapshotDbMutex.Unlock()
 
 	var keys [][]byte
-	err := snap.mainDb.Update(func(txn *badger.Txn) error {
+	err := snap.ancestralDb().Update(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.AllVersions = false
 		opts.PrefetchValues = false
@@ -954,6 +1028,15 @@ func (snap *Snapshot) GetAncestralRecordsKeyWithTxn(txn *badger.Txn, key []byte,
 	return txn.Get(recordsKey)
 }
 
+// ancestralDb returns the DB the ancestral records are stored in, which is the main DB unless another DB was
+// registered for it with RegisterAncestralRecordsDB.
+func (snap *Snapshot) ancestralDb() *badger.DB {
+	if ancestralDb := GetAncestralRecordsDB(snap.mainDb); ancestralDb != nil {
+		return ancestralDb
+	}
+	return snap.mainDb
+}
+
 func (snap *Snapshot) GetSnapshotBlockHeightPeriod() uint64 {
 	return snap.snapshotBlockHeightPeriod
 }
@@ -1112,6 +1195,13 @@ func (snap *Snapshot) String() string {
 func (snap *Snapshot) GetSnapshotChunk(prefix []byte, startKey []byte) (
 	_snapshotEntriesBatch []*DBEntry, _snapshotEntriesFilled bool, _err error) {
 
+	return snap.getSnapshotChunkWithBatchSize(prefix, startKey, SnapshotBatchSize)
+}
+
+// getSnapshotChunkWithBatchSize is GetSnapshotChunk with a configurable batch size in bytes.
+func (snap *Snapshot) getSnapshotChunkWithBatchSize(prefix []byte, startKey []byte, batchSize uint32) (
+	_snapshotEntriesBatch []*DBEntry, _snapshotEntriesFilled bool, _err error) {
+
 	// This the list of fetched DB entries.
 	var snapshotEntriesBatch []*DBEntry
 	blockHeight := snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight
@@ -1122,13 +1212,13 @@ func (snap *Snapshot) GetSnapshotChunk(prefix []byte, startKey []byte) (
 	err := snap.mainDb.View(func(txn *badger.Txn) error {
 		var innerErr error
 		// Fetch the batch from main DB records with a batch size of about snap.BatchSize.
-		mainDbBatchEntries, mainDbFilled, innerErr = DBIteratePrefixKeys(snap.mainDb, prefix, startKey, SnapshotBatchSize)
+		mainDbBatchEntries, mainDbFilled, innerErr = DBIteratePrefixKeys(snap.mainDb, prefix, startKey, batchSize)
 		if innerErr != nil {
 			return errors.Wrapf(innerErr, "Snapshot.GetSnapshotChunk: Problem fetching main Db records: ")
 		}
 		// Fetch the batch from the ancestral DB records with a batch size of about snap.BatchSize.
-		ancestralDbBatchEntries, ancestralDbFilled, innerErr = DBIteratePrefixKeys(snap.mainDb,
-			snap.GetAncestralRecordsKey(prefix, blockHeight), snap.GetAncestralRecordsKey(startKey, blockHeight), SnapshotBatchSize)
+		ancestralDbBatchEntries, ancestralDbFilled, innerErr = DBIteratePrefixKeys(snap.ancestralDb(),
+			snap.GetAncestralRecordsKey(prefix, blockHeight), snap.GetAncestralRecordsKey(startKey, blockHeight), batchSize)
 		if innerErr != nil {
 			return errors.Wrapf(innerErr, "Snapshot.GetSnapshotChunk: Problem fetching main Db records: ")
 		}
@@ -1191,7 +1281,7 @@ func (snap *Snapshot) GetSnapshotChunk(prefix []byte, startKey []byte) (
 			// no record from the main DB was added.
 			lastAncestralEntry := ancestralDbBatchEntries[len(ancestralDbBatchEntries)-1]
 			dbEntry := snap.AncestralRecordToDBEntry(lastAncestralEntry)
-			return snap.GetSnapshotChunk(prefix, dbEntry.Key)
+			return snap.getSnapshotChunkWithBatchSize(prefix, dbEntry.Key, batchSize)
 		} else {
 			snapshotEntriesBatch = append(snapshotEntriesBatch, EmptyDBEntry())
 			return snapshotEntriesBatch, false, nil
@@ -1222,74 +1312,102 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 		}
 	}
 
-	// We use badgerDb write batches as it's the fastest way to write multiple records to the db.
-	wb := mainDb.NewWriteBatch()
-	defer wb.Cancel()
-
 	// Setup two go routines to do the db write and the checksum computation in parallel.
+	var writeErr, checksumErr error
 	syncGroup.Add(2)
 	go func() {
 		defer syncGroup.Done()
-		//snap.timer.Start("SetSnapshotChunk.Set")
-		// TODO: Should we split the chunk into batches of 8MB so that we don't write too much data at once?
-		for _, dbEntry := range chunk {
-			localErr := wb.Set(dbEntry.Key, dbEntry.Value) // Will create txns as needed.
-			if snap.eventManager != nil {
-				snap.eventManager.stateSyncerOperation(&StateSyncerOperationEvent{
-					StateChangeEntry: &StateChangeEntry{
-						OperationType: DbOperationTypeInsert,
-						KeyBytes:      dbEntry.Key,
-						EncoderBytes:  dbEntry.Value,
-						IsReverted:    false,
-					},
-					FlushId: dbFlushId,
-				})
-			}
-			if localErr != nil {
-				glog.Errorf("Snapshot.SetSnapshotChunk: Problem setting db entry in write batch")
-				err = localErr
-				return
-			}
-		}
-		if localErr := wb.Flush(); localErr != nil {
-			if snap.eventManager != nil {
-				snap.eventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
-					FlushId:   dbFlushId,
-					Succeeded: false,
-				})
-			}
-			glog.Errorf("Snapshot.SetSnapshotChunk: Problem flushing write batch to db")
-			err = localErr
-			return
-		}
-		//snap.timer.End("SetSnapshotChunk.Set")
+		writeErr = snap.writeSnapshotChunk(mainDb, chunk, dbFlushId)
 	}()
 	go func() {
 		defer syncGroup.Done()
+		checksumErr = snap.addSnapshotChunkToChecksum(chunk, blockHeight)
+	}()
+	syncGroup.Wait()
+	if writeErr != nil {
+		err = writeErr
+	} else {
+		err = checksumErr
+	}
 
-		// If we're disabling checksums, we don't need to add or remove bytes from the checksum
-		// when we're setting a snapshot chunk.
-		if snap.disableChecksum {
-			return
+	if err = snap.finishSnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight, dbFlushId,
+		initialChecksumBytes, err); err != nil {
+		return err
+	}
+
+	snap.timer.End("SetSnapshotChunk.Total")
+
+	snap.timer.Print("SetSnapshotChunk.Total")
+	snap.timer.Print("SetSnapshotChunk.Set")
+	snap.timer.Print("SetSnapshotChunk.Checksum")
+	return nil
+}
+
+// writeSnapshotChunk writes the chunk to the main db with a write batch.
+func (snap *Snapshot) writeSnapshotChunk(mainDb *badger.DB, chunk []*DBEntry, dbFlushId uuid.UUID) error {
+	// We use badgerDb write batches as it's the fastest way to write multiple records to the db.
+	wb := mainDb.NewWriteBatch()
+	defer wb.Cancel()
+
+	// TODO: Should we split the chunk into batches of 8MB so that we don't write too much data at once?
+	for _, dbEntry := range chunk {
+		localErr := wb.Set(dbEntry.Key, dbEntry.Value) // Will create txns as needed.
+		if snap.eventManager != nil {
+			snap.eventManager.stateSyncerOperation(&StateSyncerOperationEvent{
+				StateChangeEntry: &StateChangeEntry{
+					OperationType: DbOperationTypeInsert,
+					KeyBytes:      dbEntry.Key,
+					EncoderBytes:  dbEntry.Value,
+					IsReverted:    false,
+				},
+				FlushId: dbFlushId,
+			})
 		}
-		//snap.timer.Start("SetSnapshotChunk.Checksum")
-		for _, dbEntry := range chunk {
-			if localErr := snap.Checksum.AddOrRemoveBytesWithMigrations(dbEntry.Key, dbEntry.Value, blockHeight,
-				snap.Migrations.migrationChecksums, snap.Migrations.migrationChecksumLock, true); localErr != nil {
-				glog.Errorf("Snapshot.SetSnapshotChunk: Problem adding checksum")
-				err = localErr
-				return
-			}
+		if localErr != nil {
+			glog.Errorf("Snapshot.SetSnapshotChunk: Problem setting db entry in write batch")
+			return localErr
 		}
-		if localErr := snap.Checksum.Wait(); localErr != nil {
-			err = localErr
-			glog.Errorf("Snapshot.SetSnapshotChunk: Problem waiting for the checksum")
+	}
+	if localErr := wb.Flush(); localErr != nil {
+		if snap.eventManager != nil {
+			snap.eventManager.stateSyncerFlushed(&StateSyncerFlushedEvent{
+				FlushId:   dbFlushId,
+				Succeeded: false,
+			})
 		}
+		glog.Errorf("Snapshot.SetSnapshotChunk: Problem flushing write batch to db")
+		return localErr
+	}
+	return nil
+}
 
-		//snap.timer.End("SetSnapshotChunk.Checksum")
-	}()
-	syncGroup.Wait()
-	//mainDbMutex.Unlock()
+// addSnapshotChunkToChecksum adds the chunk's entries to the state checksum and waits for the checksum to
+// finish computing.
+func (snap *Snapshot) addSnapshotChunkToChecksum(chunk []*DBEntry, blockHeight uint64) error {
+	// If we're disabling checksums, we don't need to add or remove bytes from the checksum
+	// when we're setting a snapshot chunk.
+	if snap.disableChecksum {
+		return nil
+	}
+	for _, dbEntry := range chunk {
+		if err := snap.Checksum.AddOrRemoveBytesWithMigrations(dbEntry.Key, dbEntry.Value, blockHeight,
+			snap.Migrations.migrationChecksums, snap.Migrations.migrationChecksumLock, true); err != nil {
+			glog.Errorf("Snapshot.SetSnapshotChunk: Problem adding checksum")
+			return err
+		}
+	}
+	if err := snap.Checksum.Wait(); err != nil {
+		glog.Errorf("Snapshot.SetSnapshotChunk: Problem waiting for the checksum")
+		return err
+	}
+	return nil
+}
+
+// finishSnapshotChunk wraps up setting a snapshot chunk. If setting the chunk failed, the checksum is reset to
+// initialChecksumBytes, unless they're nil, and the chunk is rescheduled. Otherwise, the chunk's slot in the
+// operation queue semaphore is freed.
+func (snap *Snapshot) finishSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.RWMutex, chunk []*DBEntry,
+	blockHeight uint64, dbFlushId uuid.UUID, initialChecksumBytes []byte, err error) error {
 
 	// If there's a problem setting the snapshot checksum, we'll reschedule this snapshot chunk set.
 	if err != nil {
@@ -1301,12 +1419,12 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 		}
 		glog.Infof("Snapshot.SetSnapshotChunk: Problem setting the snapshot chunk, error (%v)", err)
 
-		if !snap.disableChecksum {
+		if initialChecksumBytes != nil {
 			// We reset the snapshot checksum so its initial value, so we won't overlap with processing the next snapshot chunk.
 			// If we've errored during a writeBatch set we'll redo this chunk in next SetSnapshotChunk so we're fine with overlaps.
-			if err = snap.Checksum.FromBytes(initialChecksumBytes); err != nil {
+			if resetErr := snap.Checksum.FromBytes(initialChecksumBytes); resetErr != nil {
 				panic(fmt.Errorf("Snapshot.SetSnapshotChunk: Problem resetting checksum. This should never happen, "+
-					"error: (%v)", err))
+					"error: (%v)", resetErr))
 			}
 		}
 		snap.ProcessSnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight)
@@ -1322,12 +1440,6 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 	// If we get here, then we've successfully processed the snapshot chunk
 	// and can free one slot in the operation queue semaphore.
 	snap.FreeOperationQueueSemaphore()
-
-	snap.timer.End("SetSnapshotChunk.Total")
-
-	snap.timer.Print("SetSnapshotChunk.Total")
-	snap.timer.Print("SetSnapshotChunk.Set")
-	snap.timer.Print("SetSnapshotChunk.Checksum")
 	return nil
 }
 
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// AncestralRecordsDbFolder is the name of the folder, relative to the directory passed to
+// GetAncestralRecordsDbPath, in which the ancestral records DB is stored.
+const AncestralRecordsDbFolder = "ancestral_records"
+
+// ancestralRecordsDBs maps each chain DB to the DB that holds its snapshot's ancestral records, for nodes that
+// keep them apart from the state, e.g. on a cheaper disk. The ancestral records are only needed to build the
+// snapshot chunks that are served to hypersyncing peers, and they can grow large over a snapshot epoch. Chain
+// DBs that aren't in the map keep their ancestral records under PrefixHypersyncSnapshotDBPrefix.
+var (
+	ancestralRecordsDBsLock sync.RWMutex
+	ancestralRecordsDBs     = make(map[*badger.DB]*badger.DB)
+)
+
+func GetAncestralRecordsDbPath(dir string) string {
+	return filepath.Join(dir, AncestralRecordsDbFolder)
+}
+
+// RegisterAncestralRecordsDB makes the snapshot of handle store its ancestral records in ancestralHandle. It
+// must be called before the snapshot is created. The ancestral records aren't moved between DBs, so it fails if
+// handle already holds some.
+func RegisterAncestralRecordsDB(handle *badger.DB, ancestralHandle *badger.DB) error {
+	prefix := getMainDbPrefix(_prefixAncestralRecord)
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Seek(prefix)
+		if it.ValidForPrefix(prefix) {
+			return errors.New("the chain DB already holds ancestral records. The ancestral records can only " +
+				"be moved to a DB of their own before the node first reaches a snapshot height.")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "RegisterAncestralRecordsDB: ")
+	}
+
+	ancestralRecordsDBsLock.Lock()
+	defer ancestralRecordsDBsLock.Unlock()
+	ancestralRecordsDBs[handle] = ancestralHandle
+	return nil
+}
+
+func UnregisterAncestralRecordsDB(handle *badger.DB) {
+	ancestralRecordsDBsLock.Lock()
+	defer ancestralRecordsDBsLock.Unlock()
+	delete(ancestralRecordsDBs, handle)
+}
+
+// GetAncestralRecordsDB returns the DB registered for handle, or nil if the ancestral records are stored in
+// handle.
+func GetAncestralRecordsDB(handle *badger.DB) *badger.DB {
+	ancestralRecordsDBsLock.RLock()
+	defer ancestralRecordsDBsLock.RUnlock()
+	return ancestralRecordsDBs[handle]
+}
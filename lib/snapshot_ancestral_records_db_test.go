@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAncestralRecordsDB(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	ancestralDb, _ := GetTestBadgerDb()
+	defer CleanUpBadger(ancestralDb)
+	require.NoError(RegisterAncestralRecordsDB(db, ancestralDb))
+	defer UnregisterAncestralRecordsDB(db)
+
+	snap, err, _, _ := NewSnapshot(db, SnapshotBlockHeightPeriod, false, false, &DeSoTestnetParams,
+		false, HypersyncDefaultMaxQueueSize, HypersyncDefaultChunkApplyWorkers, nil)
+	require.NoError(err)
+	defer snap.Stop()
+
+	// Change a record in the main DB, and flush the value it had at the snapshot height as an ancestral record.
+	prefix := Prefixes.PrefixPublicKeyToDeSoBalanceNanos
+	key := append(append([]byte{}, prefix...), RandomBytes(33)...)
+	oldValue := EncodeUint64(100)
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, EncodeUint64(200))
+	}))
+	snap.PrepareAncestralRecordsFlush()
+	require.NoError(snap.PrepareAncestralRecord(hex.EncodeToString(key), oldValue, true))
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return snap.FlushAncestralRecordsWithTxn(txn)
+	}))
+
+	// The ancestral record is only in the ancestral records DB, and the snapshot chunk is built from it.
+	ancestralKey := snap.GetAncestralRecordsKey(key, snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight)
+	require.ErrorIs(db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(ancestralKey)
+		return err
+	}), badger.ErrKeyNotFound)
+	require.NoError(ancestralDb.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(ancestralKey)
+		return err
+	}))
+	chunk, _, err := snap.GetSnapshotChunk(prefix, prefix)
+	require.NoError(err)
+	require.Equal([]*DBEntry{{Key: key, Value: oldValue}}, chunk)
+
+	// Deleting the ancestral records of the snapshot height deletes them from the ancestral records DB.
+	require.NoError(snap.DeleteAncestralRecords(snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight))
+	require.ErrorIs(ancestralDb.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(ancestralKey)
+		return err
+	}), badger.ErrKeyNotFound)
+
+	// A chain DB that already holds ancestral records can't have them moved to another DB.
+	otherDb, _ := GetTestBadgerDb()
+	defer CleanUpBadger(otherDb)
+	require.NoError(otherDb.Update(func(txn *badger.Txn) error {
+		return txn.Set(ancestralKey, append(oldValue, 1))
+	}))
+	require.Error(RegisterAncestralRecordsDB(otherDb, ancestralDb))
+	require.Nil(GetAncestralRecordsDB(otherDb))
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+)
+
+// Parallel Chunk Application
+//
+// During hypersync, the snapshot chunks we get from peers are normally set in the db one at a time by the
+// snapshot's Run loop. On fast disks most of that time is spent waiting on badger write batches, so the
+// snapshotChunkApplier writes chunks of different prefixes concurrently instead. Each prefix that has chunks
+// waiting gets its own worker, which writes that prefix's chunks in the order they arrived, and the number of
+// chunks being written at the same time is bounded by the number of workers. The number of chunks held in memory
+// is still bounded by the snapshot's operationQueueSemaphore, since a chunk's slot is only freed once it's set.
+//
+// The state checksum isn't written concurrently. Once a chunk is written, it's added to the checksum in the order
+// it was enqueued, so the checksum goes through the same sequence of values it would if the chunks were set one at
+// a time. If a chunk fails to be written or checksummed, the checksum is left as it was before the chunk, and the
+// chunk is rescheduled like it is in SetSnapshotChunk.
+
+const (
+	// HypersyncDefaultChunkApplyWorkers is the default number of snapshot chunks that are written to the db at the
+	// same time during hypersync.
+	HypersyncDefaultChunkApplyWorkers = 4
+)
+
+type snapshotChunkJob struct {
+	seq       uint64
+	operation *SnapshotOperation
+	dbFlushId uuid.UUID
+	writeErr  error
+}
+
+type snapshotChunkApplier struct {
+	snap *Snapshot
+
+	mtx sync.Mutex
+	// prefixQueues holds the chunks of each prefix that are waiting to be written. A prefix has a worker for as
+	// long as it's in the map.
+	prefixQueues map[string][]*snapshotChunkJob
+	// workerSemaphore bounds the number of chunks that are written at the same time.
+	workerSemaphore chan struct{}
+
+	// Chunks are numbered in the order they're enqueued, and writtenJobs holds the chunks that were written but
+	// haven't been added to the checksum because a chunk before them is still being written.
+	nextJobSeq      uint64
+	nextChecksumSeq uint64
+	writtenJobs     map[uint64]*snapshotChunkJob
+	isChecksumming  bool
+
+	// pendingJobs is used to wait for all of the enqueued chunks to be set.
+	pendingJobs sync.WaitGroup
+}
+
+func newSnapshotChunkApplier(snap *Snapshot, numWorkers uint32) *snapshotChunkApplier {
+	return &snapshotChunkApplier{
+		snap:            snap,
+		prefixQueues:    make(map[string][]*snapshotChunkJob),
+		workerSemaphore: make(chan struct{}, numWorkers),
+		writtenJobs:     make(map[uint64]*snapshotChunkJob),
+	}
+}
+
+// Enqueue schedules the chunk of the SnapshotOperationProcessChunk operation to be set. The operation is finished
+// on the snapshot's OperationChannel once the chunk has been set or rescheduled.
+func (applier *snapshotChunkApplier) Enqueue(operation *SnapshotOperation) {
+	applier.pendingJobs.Add(1)
+
+	applier.mtx.Lock()
+	defer applier.mtx.Unlock()
+
+	job := &snapshotChunkJob{
+		seq:       applier.nextJobSeq,
+		operation: operation,
+		dbFlushId: uuid.New(),
+	}
+	applier.nextJobSeq++
+
+	prefix := getSnapshotChunkPrefix(operation.snapshotChunk)
+	queue, hasWorker := applier.prefixQueues[prefix]
+	applier.prefixQueues[prefix] = append(queue, job)
+	if !hasWorker {
+		go applier.runPrefixWorker(prefix)
+	}
+}
+
+// Wait blocks until all of the enqueued chunks have been set or rescheduled.
+func (applier *snapshotChunkApplier) Wait() {
+	applier.pendingJobs.Wait()
+}
+
+func (applier *snapshotChunkApplier) runPrefixWorker(prefix string) {
+	for {
+		applier.mtx.Lock()
+		queue := applier.prefixQueues[prefix]
+		if len(queue) == 0 {
+			delete(applier.prefixQueues, prefix)
+			applier.mtx.Unlock()
+			return
+		}
+		job := queue[0]
+		applier.prefixQueues[prefix] = queue[1:]
+		applier.mtx.Unlock()
+
+		applier.workerSemaphore <- struct{}{}
+		job.writeErr = applier.snap.writeSnapshotChunk(job.operation.mainDb, job.operation.snapshotChunk, job.dbFlushId)
+		<-applier.workerSemaphore
+
+		applier.finishWrite(job)
+	}
+}
+
+// finishWrite adds the written chunk to the checksum once all of the chunks before it have been added. Whichever
+// worker finishes the next chunk in line adds it, and any chunks after it that are ready, to the checksum.
+func (applier *snapshotChunkApplier) finishWrite(job *snapshotChunkJob) {
+	applier.mtx.Lock()
+	applier.writtenJobs[job.seq] = job
+	if applier.isChecksumming {
+		applier.mtx.Unlock()
+		return
+	}
+	applier.isChecksumming = true
+	for {
+		nextJob, exists := applier.writtenJobs[applier.nextChecksumSeq]
+		if !exists {
+			applier.isChecksumming = false
+			applier.mtx.Unlock()
+			return
+		}
+		delete(applier.writtenJobs, applier.nextChecksumSeq)
+		applier.nextChecksumSeq++
+		applier.mtx.Unlock()
+
+		applier.finishJob(nextJob)
+
+		applier.mtx.Lock()
+	}
+}
+
+func (applier *snapshotChunkApplier) finishJob(job *snapshotChunkJob) {
+	snap := applier.snap
+	operation := job.operation
+
+	err := job.writeErr
+	var initialChecksumBytes []byte
+	if err == nil && !snap.disableChecksum {
+		if initialChecksumBytes, err = snap.Checksum.ToBytes(); err != nil {
+			glog.Errorf("snapshotChunkApplier.finishJob: Problem retrieving checksum bytes, error: (%v)", err)
+		} else {
+			err = snap.addSnapshotChunkToChecksum(operation.snapshotChunk, operation.blockHeight)
+		}
+	}
+	if err = snap.finishSnapshotChunk(operation.mainDb, operation.mainDbMutex, operation.snapshotChunk,
+		operation.blockHeight, job.dbFlushId, initialChecksumBytes, err); err != nil {
+		glog.Errorf("snapshotChunkApplier.finishJob: Problem adding snapshot chunk to the db")
+	}
+
+	// A rescheduled chunk was enqueued again before we finish its operation, so the OperationChannel can't run out
+	// of operations in between.
+	snap.OperationChannel.FinishOperation()
+	applier.pendingJobs.Done()
+}
+
+// getSnapshotChunkPrefix returns the prefix of the chunk's entries. The chunks we request during hypersync only
+// contain entries of a single prefix.
+func getSnapshotChunkPrefix(chunk []*DBEntry) string {
+	if len(chunk) == 0 || len(chunk[0].Key) == 0 {
+		return ""
+	}
+	return string(chunk[0].Key[:1])
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/deso-protocol/go-deadlock"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotChunkApplier(t *testing.T) {
+	require := require.New(t)
+
+	// Make chunks for a few prefixes, and interleave them the way they'd arrive from several peers. The prefixes
+	// don't store encoders, so that the checksum accepts random values.
+	prefixes := [][]byte{
+		Prefixes.PrefixPosterPublicKeyPostHash,
+		Prefixes.PrefixTstampNanosPostHash,
+		Prefixes.PrefixPublicKeyToDeSoBalanceNanos,
+	}
+	var chunks [][]*DBEntry
+	for ii := 0; ii < 4; ii++ {
+		for _, prefix := range prefixes {
+			var chunk []*DBEntry
+			for jj := 0; jj < 25; jj++ {
+				chunk = append(chunk, &DBEntry{
+					Key:   append(append([]byte{}, prefix...), RandomBytes(32)...),
+					Value: RandomBytes(40),
+				})
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	// Set the chunks one at a time and with a pool of workers, and check that both end up with the same db
+	// entries and checksum.
+	var checksums [][]byte
+	for _, numWorkers := range []uint32{1, 4} {
+		db, _ := GetTestBadgerDb()
+		snap, err, _, _ := NewSnapshot(db, SnapshotBlockHeightPeriod, false, false, &DeSoTestnetParams,
+			false, HypersyncDefaultMaxQueueSize, numWorkers, nil)
+		require.NoError(err)
+		require.Equal(numWorkers > 1, snap.chunkApplier != nil)
+
+		var mainDbMutex deadlock.RWMutex
+		for _, chunk := range chunks {
+			snap.ProcessSnapshotChunk(db, &mainDbMutex, chunk, 0)
+		}
+		snap.WaitForAllOperationsToFinish()
+
+		require.NoError(db.View(func(txn *badger.Txn) error {
+			for _, chunk := range chunks {
+				for _, dbEntry := range chunk {
+					value, err := DBGetWithTxn(txn, nil, dbEntry.Key)
+					require.NoError(err)
+					require.Equal(dbEntry.Value, value)
+				}
+			}
+			return nil
+		}))
+		checksum, err := snap.Checksum.ToBytes()
+		require.NoError(err)
+		checksums = append(checksums, checksum)
+
+		snap.Stop()
+		CleanUpBadger(db)
+	}
+	require.Equal(checksums[0], checksums[1])
+}
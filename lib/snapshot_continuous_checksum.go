@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// By default, the state checksum is only kept up to date when it's needed to check a snapshot: while hypersync
+// chunks are set, and on every flush if --force-checksum is set. Even then, it's only saved with the ancestral
+// records and compared at snapshot epoch boundaries, so a node whose state diverged can go a whole epoch
+// without noticing. The continuous checksum fixes that. When it's enabled:
+//   - The checksum is updated on every flush, by adding and removing the state keys the flush mutated. This is
+//     the same incremental update DBSetWithTxn and DBDeleteWithTxn do with --force-checksum.
+//   - The checksum is saved after every block, and recorded for that block under _prefixChecksumByBlockHeight,
+//     so two nodes can compare their state at any block, rather than just at snapshot heights.
+//   - VerifyChecksum recomputes the checksum from the state in the DB and compares it to the incrementally
+//     updated one, which lets a node check its own state for corruption whenever it wants.
+//
+// The first time the continuous checksum is enabled on a node, the checksum the node saved before may not reflect
+// its state, so it's recomputed from the DB state.
+
+// EnableContinuousChecksum turns on the continuous checksum. If no block checksum has been recorded yet, the
+// checksum is recomputed from the state in the DB, which can take a while.
+func (snap *Snapshot) EnableContinuousChecksum() error {
+	snap.continuousChecksum = true
+	snap.disableChecksum = false
+
+	var hasBlockChecksums bool
+	err := snap.mainDb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = getMainDbPrefix(_prefixChecksumByBlockHeight)
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Seek(opts.Prefix)
+		hasBlockChecksums = it.ValidForPrefix(opts.Prefix)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Snapshot.EnableContinuousChecksum: Problem looking up block checksums")
+	}
+	if hasBlockChecksums {
+		return nil
+	}
+
+	glog.Infof("Snapshot.EnableContinuousChecksum: Computing the state checksum from the DB state")
+	checksumBytes, err := snap.computeChecksumFromDb(snap.Status.CurrentBlockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "Snapshot.EnableContinuousChecksum: ")
+	}
+	if err = snap.Checksum.FromBytes(checksumBytes); err != nil {
+		return errors.Wrapf(err, "Snapshot.EnableContinuousChecksum: ")
+	}
+	if err = snap.Checksum.SaveChecksum(); err != nil {
+		return errors.Wrapf(err, "Snapshot.EnableContinuousChecksum: Problem saving checksum")
+	}
+	return nil
+}
+
+// recordBlockChecksum waits for the checksum updates of the block's flush to be applied, then saves the checksum
+// and records it as the checksum of the block.
+func (snap *Snapshot) recordBlockChecksum(blockNode *BlockNode) error {
+	checksumBytes, err := snap.waitForChecksumBytes()
+	if err != nil {
+		return errors.Wrapf(err, "Snapshot.recordBlockChecksum: ")
+	}
+
+	value := append(blockNode.Hash.ToBytes(), checksumBytes...)
+	snap.SnapshotDbMutex.Lock()
+	defer snap.SnapshotDbMutex.Unlock()
+	err = snap.mainDb.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(getMainDbPrefix(_prefixSnapshotChecksum), checksumBytes); err != nil {
+			return err
+		}
+		return txn.Set(_dbKeyForChecksumByBlockHeight(uint64(blockNode.Height)), value)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Snapshot.recordBlockChecksum: Problem saving checksum")
+	}
+	glog.V(2).Infof("Snapshot.recordBlockChecksum: Checksum at height (%v) is (%v)", blockNode.Height, checksumBytes)
+	return nil
+}
+
+// waitForChecksumBytes waits for the checksum operations in the operation channel to be applied, and returns
+// the resulting checksum bytes. Unlike WaitForAllOperationsToFinish, it doesn't log its progress, since it
+// runs after every block.
+func (snap *Snapshot) waitForChecksumBytes() ([]byte, error) {
+	for snap.OperationChannel.GetStatus() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := snap.Checksum.Wait(); err != nil {
+		return nil, errors.Wrapf(err, "Snapshot.waitForChecksumBytes: Problem waiting for checksum")
+	}
+	checksumBytes, err := snap.Checksum.ToBytes()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Snapshot.waitForChecksumBytes: Problem getting checksum bytes")
+	}
+	return checksumBytes, nil
+}
+
+// GetChecksumAtBlockHeight returns the hash of the block that was recorded at blockHeight and the state checksum
+// after that block. It returns nil if no checksum was recorded at blockHeight, e.g. because the continuous
+// checksum wasn't enabled at the time.
+func (snap *Snapshot) GetChecksumAtBlockHeight(blockHeight uint64) (
+	_blockHash *BlockHash, _checksumBytes []byte, _err error) {
+
+	var value []byte
+	err := snap.mainDb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(_dbKeyForChecksumByBlockHeight(blockHeight))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Snapshot.GetChecksumAtBlockHeight: Problem reading checksum")
+	}
+	if len(value) <= HashSizeBytes {
+		return nil, nil, fmt.Errorf("Snapshot.GetChecksumAtBlockHeight: Checksum record has invalid length %v",
+			len(value))
+	}
+	return NewBlockHash(value[:HashSizeBytes]), value[HashSizeBytes:], nil
+}
+
+// VerifyChecksum recomputes the state checksum from the state in the DB and returns an error if it doesn't match
+// the incrementally updated checksum. It reads the entire state, so it's slow, and it must be called while no
+// flush is in progress, e.g. while holding the blockchain's lock.
+func (snap *Snapshot) VerifyChecksum() error {
+	if !snap.continuousChecksum {
+		return fmt.Errorf("Snapshot.VerifyChecksum: Continuous checksum is not enabled")
+	}
+	checksumBytes, err := snap.waitForChecksumBytes()
+	if err != nil {
+		return errors.Wrapf(err, "Snapshot.VerifyChecksum: ")
+	}
+	computedChecksumBytes, err := snap.computeChecksumFromDb(snap.Status.CurrentBlockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "Snapshot.VerifyChecksum: ")
+	}
+	if !bytes.Equal(checksumBytes, computedChecksumBytes) {
+		return fmt.Errorf("Snapshot.VerifyChecksum: Checksum (%v) doesn't match the checksum computed from "+
+			"the DB state (%v)", checksumBytes, computedChecksumBytes)
+	}
+	return nil
+}
+
+// computeChecksumFromDb computes the checksum of all of the state records in the DB, encoded at blockHeight.
+func (snap *Snapshot) computeChecksumFromDb(blockHeight uint64) ([]byte, error) {
+	checksum := &StateChecksum{}
+	if err := checksum.Initialize(nil, nil); err != nil {
+		return nil, errors.Wrapf(err, "Snapshot.computeChecksumFromDb: Problem initializing checksum")
+	}
+	// The computed checksum has no migrations to keep up to date, but AddOrRemoveBytesWithMigrations still
+	// expects a lock for them.
+	var migrationChecksumLock sync.RWMutex
+	numKeys := 0
+	err := snap.mainDb.View(func(txn *badger.Txn) error {
+		for _, prefix := range StatePrefixes.StatePrefixesList {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				value, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					it.Close()
+					return err
+				}
+				if err = checksum.AddOrRemoveBytesWithMigrations(it.Item().Key(), value, blockHeight,
+					nil, &migrationChecksumLock, true); err != nil {
+					it.Close()
+					return err
+				}
+				numKeys++
+			}
+			it.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Snapshot.computeChecksumFromDb: Problem reading state")
+	}
+	checksumBytes, err := checksum.ToBytes()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Snapshot.computeChecksumFromDb: Problem getting checksum bytes")
+	}
+	glog.V(1).Infof("Snapshot.computeChecksumFromDb: Computed checksum over %v keys", numKeys)
+	return checksumBytes, nil
+}
+
+func _dbKeyForChecksumByBlockHeight(blockHeight uint64) []byte {
+	return append(getMainDbPrefix(_prefixChecksumByBlockHeight), EncodeUint64(blockHeight)...)
+}
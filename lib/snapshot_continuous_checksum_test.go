@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContinuousChecksum(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	snap := chain.snapshot
+	require.NotNil(snap)
+	require.NoError(snap.EnableContinuousChecksum())
+	require.NoError(snap.VerifyChecksum())
+
+	var blockChecksums [][]byte
+	for ii := 0; ii < 3; ii++ {
+		block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+		blockHash, err := block.Hash()
+		require.NoError(err)
+		recordedHash, checksumBytes, err := snap.GetChecksumAtBlockHeight(block.Header.Height)
+		require.NoError(err)
+		require.True(recordedHash.IsEqual(blockHash))
+		blockChecksums = append(blockChecksums, checksumBytes)
+
+		// The incrementally updated checksum matches the checksum computed from the state in the DB.
+		require.NoError(snap.VerifyChecksum())
+	}
+	// Every block pays a block reward, so every block has a different checksum.
+	require.NotEqual(blockChecksums[0], blockChecksums[1])
+	require.NotEqual(blockChecksums[1], blockChecksums[2])
+
+	// No checksum was recorded for blocks that weren't processed.
+	blockHash, checksumBytes, err := snap.GetChecksumAtBlockHeight(uint64(chain.blockTip().Height) + 1)
+	require.NoError(err)
+	require.Nil(blockHash)
+	require.Nil(checksumBytes)
+
+	// A state write that bypasses the snapshot isn't in the checksum, so verification catches it.
+	postEntry := &PostEntry{PostHash: NewBlockHash(RandomBytes(HashSizeBytes))}
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		return txn.Set(_dbKeyForPostEntryHash(postEntry.PostHash),
+			EncodeToBytes(uint64(chain.blockTip().Height), postEntry))
+	}))
+	require.Error(snap.VerifyChecksum())
+
+	// Once block checksums have been recorded, enabling the continuous checksum again doesn't recompute it.
+	require.NoError(snap.EnableContinuousChecksum())
+	require.Error(snap.VerifyChecksum())
+}
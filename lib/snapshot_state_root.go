@@ -0,0 +1,393 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"math"
+
+	"github.com/deso-protocol/core/bls"
+	merkletree "github.com/deso-protocol/go-merkle-tree"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// This file implements the v2 hypersync snapshot format. In v1, a syncing node downloads each state prefix from a
+// single peer, one chunk after another, and it only learns whether the peer sent valid data once it has downloaded
+// the entire state and compared the resulting state checksum against the one the peer advertised. In v2, the state
+// at the snapshot height is split into deterministic chunks, and the chunks are committed to in a Merkle tree whose
+// root is the snapshot state root:
+//   - Chunks are formed by walking the state prefixes in StatePrefixes.StatePrefixesList order, and the keys within
+//     each prefix in lexicographic order. A chunk is cut as soon as its entries reach SnapshotChunkV2SizeBytes, or
+//     when the prefix ends, so a chunk never spans two prefixes. Empty prefixes have no chunks. Because the chunk
+//     boundaries only depend on the state, every node with the same snapshot computes the same chunks.
+//   - The hash of a chunk is the double sha256 of the concatenation of its entries' DBEntry.ToBytes().
+//   - The state root is the root of the Merkle tree of the chunk hashes, built with go-merkle-tree. The tree
+//     duplicates the last node of a row if the row has an odd number of nodes.
+//   - Nodes that have a BLS key sign the state root, along with the snapshot height, block hash, and number of
+//     chunks. See SnapshotStateRoot.
+//
+// Every SnapshotData message in v2 carries the state root, the index of the chunk, and the Merkle proof of the
+// chunk against the root. Once a syncing node trusts a state root, it can verify each chunk on receipt, no matter
+// which peer sent it, so it can download chunks from many untrusted peers in parallel.
+//
+// The chunk proofs only show that a chunk belongs to the state root, not that the state root is honest, so the
+// state root itself is trusted through its signature. A syncing node only accepts a state root signed by one of
+// its configured trusted snapshot signers. A node with no trusted signers doesn't use v2 at all: it hypersyncs
+// in the v1 format from its sync peer, and checks the downloaded state against the peer's state checksum.
+
+// SnapshotFormatVersion2 is the version of the snapshot format that uses chunk Merkle proofs. Peers that serve it
+// set the SFHyperSyncV2 service flag.
+const SnapshotFormatVersion2 uint64 = 2
+
+// SnapshotStateRoot is the commitment to the state of a snapshot epoch in the v2 snapshot format.
+type SnapshotStateRoot struct {
+	// SnapshotBlockHeight and CurrentEpochBlockHash identify the snapshot, as in SnapshotEpochMetadata.
+	SnapshotBlockHeight   uint64
+	CurrentEpochBlockHash *BlockHash
+
+	// StateRoot is the root of the Merkle tree of the snapshot's chunk hashes, and NumChunks is the number
+	// of chunks in the snapshot.
+	StateRoot *BlockHash
+	NumChunks uint64
+
+	// SignerPublicKey and Signature are the BLS public key of the node that computed the state root and its
+	// signature of the state root. They are nil if the node doesn't have a BLS key.
+	SignerPublicKey *bls.PublicKey
+	Signature       *bls.Signature
+}
+
+func (root *SnapshotStateRoot) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(root.SnapshotBlockHeight)...)
+	data = append(data, root.CurrentEpochBlockHash.ToBytes()...)
+	data = append(data, root.StateRoot.ToBytes()...)
+	data = append(data, UintToBuf(root.NumChunks)...)
+	data = append(data, EncodeBLSPublicKey(root.SignerPublicKey)...)
+	data = append(data, EncodeOptionalBLSSignature(root.Signature)...)
+	return data
+}
+
+func (root *SnapshotStateRoot) FromBytes(rr *bytes.Reader) error {
+	var err error
+	if root.SnapshotBlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotStateRoot.FromBytes: Problem reading SnapshotBlockHeight")
+	}
+	if root.CurrentEpochBlockHash, err = ReadBlockHash(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotStateRoot.FromBytes: Problem reading CurrentEpochBlockHash")
+	}
+	if root.StateRoot, err = ReadBlockHash(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotStateRoot.FromBytes: Problem reading StateRoot")
+	}
+	if root.NumChunks, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotStateRoot.FromBytes: Problem reading NumChunks")
+	}
+	if root.SignerPublicKey, err = DecodeBLSPublicKey(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotStateRoot.FromBytes: Problem reading SignerPublicKey")
+	}
+	if root.Signature, err = DecodeOptionalBLSSignature(rr); err != nil {
+		return errors.Wrapf(err, "SnapshotStateRoot.FromBytes: Problem reading Signature")
+	}
+	return nil
+}
+
+// Equals returns true if the two state roots commit to the same snapshot. The signatures are not compared,
+// because peers with different BLS keys sign the same state root.
+func (root *SnapshotStateRoot) Equals(other *SnapshotStateRoot) bool {
+	return root.SnapshotBlockHeight == other.SnapshotBlockHeight &&
+		root.CurrentEpochBlockHash.IsEqual(other.CurrentEpochBlockHash) &&
+		root.StateRoot.IsEqual(other.StateRoot) &&
+		root.NumChunks == other.NumChunks
+}
+
+// IsSigned returns true if the state root has a signer and a signature.
+func (root *SnapshotStateRoot) IsSigned() bool {
+	return root.SignerPublicKey != nil && root.Signature != nil
+}
+
+// VerifySignature returns true if the state root is signed by its signer.
+func (root *SnapshotStateRoot) VerifySignature() (bool, error) {
+	if !root.IsSigned() {
+		return false, nil
+	}
+	return BLSVerifySnapshotStateRoot(root, root.Signature, root.SignerPublicKey)
+}
+
+func (root *SnapshotStateRoot) String() string {
+	return fmt.Sprintf("< SnapshotStateRoot | height: %v, block hash: %v, state root: %v, num chunks: %v >",
+		root.SnapshotBlockHeight, root.CurrentEpochBlockHash, root.StateRoot, root.NumChunks)
+}
+
+// snapshotChunkHasher computes the hash of a snapshot chunk incrementally, so that the chunk's entries
+// don't need to be concatenated in memory.
+type snapshotChunkHasher struct {
+	hasher   hash.Hash
+	numBytes uint64
+}
+
+func newSnapshotChunkHasher() *snapshotChunkHasher {
+	return &snapshotChunkHasher{hasher: sha256.New()}
+}
+
+func (chunkHasher *snapshotChunkHasher) addEntry(entry *DBEntry) {
+	entryBytes := entry.ToBytes()
+	chunkHasher.hasher.Write(entryBytes)
+	chunkHasher.numBytes += uint64(len(entryBytes))
+}
+
+func (chunkHasher *snapshotChunkHasher) sum() *BlockHash {
+	chunkHash := BlockHash(sha256.Sum256(chunkHasher.hasher.Sum(nil)))
+	return &chunkHash
+}
+
+// ComputeSnapshotChunkHash returns the hash of a v2 snapshot chunk.
+func ComputeSnapshotChunkHash(chunk []*DBEntry) *BlockHash {
+	chunkHasher := newSnapshotChunkHasher()
+	for _, entry := range chunk {
+		chunkHasher.addEntry(entry)
+	}
+	return chunkHasher.sum()
+}
+
+// ComputeSnapshotStateRoot returns the Merkle root of the chunk hashes.
+func ComputeSnapshotStateRoot(chunkHashes []*BlockHash) *BlockHash {
+	if len(chunkHashes) == 0 {
+		return &ZeroBlockHash
+	}
+	return NewBlockHash(newSnapshotChunkMerkleTree(chunkHashes).Root.GetHash())
+}
+
+func newSnapshotChunkMerkleTree(chunkHashes []*BlockHash) *merkletree.Tree {
+	leaves := make([][]byte, len(chunkHashes))
+	for ii, chunkHash := range chunkHashes {
+		leaves[ii] = chunkHash.ToBytes()
+	}
+	return merkletree.NewTreeFromHashes(merkletree.Sha256DoubleHash, leaves)
+}
+
+// getSnapshotChunkMerkleProof returns the sibling hashes on the path from the chunk at chunkIndex to the root.
+func getSnapshotChunkMerkleProof(tree *merkletree.Tree, chunkIndex uint64) []*BlockHash {
+	var proof []*BlockHash
+	index := int(chunkIndex)
+	for _, row := range tree.Rows[:len(tree.Rows)-1] {
+		siblingIndex := index ^ 1
+		// The last node of a row with an odd number of nodes is paired with itself.
+		if siblingIndex >= len(row) {
+			siblingIndex = index
+		}
+		proof = append(proof, NewBlockHash(row[siblingIndex].GetHash()))
+		index /= 2
+	}
+	return proof
+}
+
+// getSnapshotChunkMerkleTreeHeight returns the number of rows below the root of the Merkle tree of numChunks
+// chunks, which is the length of a chunk's Merkle proof. This mirrors the tree construction in go-merkle-tree.
+func getSnapshotChunkMerkleTreeHeight(numChunks uint64) int {
+	return int(math.Ceil(math.Log2(float64(numChunks + numChunks%2))))
+}
+
+// VerifySnapshotChunkMerkleProof returns true if the proof shows that chunkHash is the hash of the chunk at
+// chunkIndex in the snapshot with the given state root. The position of each sibling is derived from the
+// chunk index, so a chunk can't be passed off as a different chunk of the same snapshot.
+func VerifySnapshotChunkMerkleProof(stateRoot *SnapshotStateRoot, chunkIndex uint64, chunkHash *BlockHash,
+	proof []*BlockHash) bool {
+
+	if chunkIndex >= stateRoot.NumChunks ||
+		len(proof) != getSnapshotChunkMerkleTreeHeight(stateRoot.NumChunks) {
+		return false
+	}
+	currentHash := chunkHash.ToBytes()
+	index := chunkIndex
+	for _, sibling := range proof {
+		if index%2 == 0 {
+			currentHash = merkletree.Sha256DoubleHash(append(currentHash, sibling.ToBytes()...))
+		} else {
+			currentHash = merkletree.Sha256DoubleHash(append(sibling.ToBytes(), currentHash...))
+		}
+		index /= 2
+	}
+	return bytes.Equal(currentHash, stateRoot.StateRoot.ToBytes())
+}
+
+// snapshotChunkDescriptor locates a v2 snapshot chunk in the state. The chunk consists of the keys in
+// [StartKey, EndKey] under Prefix.
+type snapshotChunkDescriptor struct {
+	Prefix    []byte
+	StartKey  []byte
+	EndKey    []byte
+	ChunkHash *BlockHash
+}
+
+// snapshotManifest lists the v2 chunks of a snapshot epoch.
+type snapshotManifest struct {
+	stateRoot  *SnapshotStateRoot
+	chunks     []*snapshotChunkDescriptor
+	merkleTree *merkletree.Tree
+}
+
+// SetStateRootSigner sets the signer used to sign the state roots of snapshot epochs.
+func (snap *Snapshot) SetStateRootSigner(signer *BLSSigner) {
+	snap.manifestMutex.Lock()
+	defer snap.manifestMutex.Unlock()
+
+	snap.stateRootSigner = signer
+}
+
+// forEachSnapshotEntry calls fn on every entry under prefix at the current snapshot height, in key order,
+// starting from startKey, until fn returns false.
+func (snap *Snapshot) forEachSnapshotEntry(prefix []byte, startKey []byte, fn func(entry *DBEntry) bool) error {
+	var lastKey []byte
+	for {
+		chunk, chunkFull, err := snap.getSnapshotChunkWithBatchSize(prefix, startKey, SnapshotChunkV2SizeBytes)
+		if err != nil {
+			return errors.Wrapf(err, "Snapshot.forEachSnapshotEntry: Problem fetching snapshot chunk")
+		}
+		for _, entry := range chunk {
+			if entry.IsEmpty() {
+				return nil
+			}
+			// Consecutive batches overlap on the start key.
+			if lastKey != nil && bytes.Compare(entry.Key, lastKey) <= 0 {
+				continue
+			}
+			lastKey = entry.Key
+			if !fn(entry) {
+				return nil
+			}
+		}
+		if !chunkFull || lastKey == nil {
+			return nil
+		}
+		startKey = lastKey
+	}
+}
+
+// buildSnapshotManifest splits the state of the current snapshot epoch into v2 chunks, and computes the state root.
+func (snap *Snapshot) buildSnapshotManifest() (*snapshotManifest, error) {
+	snapshotBlockHeight := snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight
+	glog.V(0).Infof("Snapshot.buildSnapshotManifest: Computing the v2 snapshot state root at height %v",
+		snapshotBlockHeight)
+
+	var chunks []*snapshotChunkDescriptor
+	for _, prefix := range StatePrefixes.StatePrefixesList {
+		var currentChunk *snapshotChunkDescriptor
+		var chunkHasher *snapshotChunkHasher
+		err := snap.forEachSnapshotEntry(prefix, prefix, func(entry *DBEntry) bool {
+			if currentChunk == nil {
+				currentChunk = &snapshotChunkDescriptor{Prefix: prefix, StartKey: entry.Key}
+				chunkHasher = newSnapshotChunkHasher()
+			}
+			chunkHasher.addEntry(entry)
+			currentChunk.EndKey = entry.Key
+			if chunkHasher.numBytes >= uint64(SnapshotChunkV2SizeBytes) {
+				currentChunk.ChunkHash = chunkHasher.sum()
+				chunks = append(chunks, currentChunk)
+				currentChunk = nil
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Snapshot.buildSnapshotManifest: Problem iterating prefix %v", prefix)
+		}
+		if currentChunk != nil {
+			currentChunk.ChunkHash = chunkHasher.sum()
+			chunks = append(chunks, currentChunk)
+		}
+	}
+
+	// If the node entered a new snapshot epoch while we were iterating, the chunks are a mix of two epochs.
+	if snapshotBlockHeight != snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight {
+		return nil, fmt.Errorf("Snapshot.buildSnapshotManifest: Snapshot epoch changed from height %v to %v "+
+			"while computing the state root", snapshotBlockHeight, snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight)
+	}
+
+	chunkHashes := make([]*BlockHash, len(chunks))
+	for ii, chunk := range chunks {
+		chunkHashes[ii] = chunk.ChunkHash
+	}
+	manifest := &snapshotManifest{
+		stateRoot: &SnapshotStateRoot{
+			SnapshotBlockHeight:   snapshotBlockHeight,
+			CurrentEpochBlockHash: snap.CurrentEpochSnapshotMetadata.CurrentEpochBlockHash,
+			StateRoot:             ComputeSnapshotStateRoot(chunkHashes),
+			NumChunks:             uint64(len(chunks)),
+		},
+		chunks: chunks,
+	}
+	if len(chunks) > 0 {
+		manifest.merkleTree = newSnapshotChunkMerkleTree(chunkHashes)
+	}
+	if snap.stateRootSigner != nil {
+		signature, err := snap.stateRootSigner.SignSnapshotStateRoot(manifest.stateRoot)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Snapshot.buildSnapshotManifest: Problem signing state root")
+		}
+		manifest.stateRoot.SignerPublicKey = snap.stateRootSigner.GetPublicKey()
+		manifest.stateRoot.Signature = signature
+	}
+	glog.V(0).Infof("Snapshot.buildSnapshotManifest: Computed %v", manifest.stateRoot)
+	return manifest, nil
+}
+
+// getSnapshotManifest returns the manifest of the current snapshot epoch, building it if needed. Building the
+// manifest requires iterating over the whole state, so it is only done once per snapshot epoch.
+func (snap *Snapshot) getSnapshotManifest() (*snapshotManifest, error) {
+	snap.manifestMutex.Lock()
+	defer snap.manifestMutex.Unlock()
+
+	if snap.manifest != nil &&
+		snap.manifest.stateRoot.SnapshotBlockHeight == snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight {
+		return snap.manifest, nil
+	}
+	manifest, err := snap.buildSnapshotManifest()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Snapshot.getSnapshotManifest: ")
+	}
+	snap.manifest = manifest
+	return manifest, nil
+}
+
+// GetSnapshotStateRoot returns the v2 state root of the current snapshot epoch.
+func (snap *Snapshot) GetSnapshotStateRoot() (*SnapshotStateRoot, error) {
+	manifest, err := snap.getSnapshotManifest()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Snapshot.GetSnapshotStateRoot: ")
+	}
+	return manifest.stateRoot, nil
+}
+
+// GetSnapshotChunkV2 returns the entries of the v2 chunk at chunkIndex of the current snapshot epoch, along with
+// the epoch's state root and the chunk's Merkle proof.
+func (snap *Snapshot) GetSnapshotChunkV2(chunkIndex uint64) (
+	_prefix []byte, _chunk []*DBEntry, _stateRoot *SnapshotStateRoot, _proof []*BlockHash, _err error) {
+
+	manifest, err := snap.getSnapshotManifest()
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrapf(err, "Snapshot.GetSnapshotChunkV2: ")
+	}
+	if chunkIndex >= uint64(len(manifest.chunks)) {
+		return nil, nil, nil, nil, fmt.Errorf("Snapshot.GetSnapshotChunkV2: Chunk index %v is out of range, "+
+			"snapshot has %v chunks", chunkIndex, len(manifest.chunks))
+	}
+
+	descriptor := manifest.chunks[chunkIndex]
+	var chunk []*DBEntry
+	err = snap.forEachSnapshotEntry(descriptor.Prefix, descriptor.StartKey, func(entry *DBEntry) bool {
+		if bytes.Compare(entry.Key, descriptor.EndKey) > 0 {
+			return false
+		}
+		chunk = append(chunk, entry)
+		return true
+	})
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrapf(err, "Snapshot.GetSnapshotChunkV2: Problem fetching chunk %v", chunkIndex)
+	}
+	// The chunk can only differ from the one we hashed if the snapshot epoch changed in the meantime.
+	if !ComputeSnapshotChunkHash(chunk).IsEqual(descriptor.ChunkHash) {
+		return nil, nil, nil, nil, fmt.Errorf("Snapshot.GetSnapshotChunkV2: Chunk %v doesn't match the chunk hash "+
+			"in the manifest", chunkIndex)
+	}
+	return descriptor.Prefix, chunk, manifest.stateRoot, getSnapshotChunkMerkleProof(manifest.merkleTree, chunkIndex), nil
+}
@@ -0,0 +1,255 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotChunkMerkleProofs(t *testing.T) {
+	require := require.New(t)
+
+	for _, numChunks := range []int{1, 2, 3, 4, 5, 7, 8, 9, 16, 33} {
+		var chunkHashes []*BlockHash
+		for ii := 0; ii < numChunks; ii++ {
+			chunkHashes = append(chunkHashes, ComputeSnapshotChunkHash([]*DBEntry{
+				{Key: RandomBytes(10), Value: RandomBytes(20)},
+			}))
+		}
+		stateRoot := &SnapshotStateRoot{
+			StateRoot: ComputeSnapshotStateRoot(chunkHashes),
+			NumChunks: uint64(numChunks),
+		}
+		tree := newSnapshotChunkMerkleTree(chunkHashes)
+
+		for ii := 0; ii < numChunks; ii++ {
+			proof := getSnapshotChunkMerkleProof(tree, uint64(ii))
+			require.True(VerifySnapshotChunkMerkleProof(stateRoot, uint64(ii), chunkHashes[ii], proof))
+
+			// A chunk can't be passed off as a different chunk, or as a chunk that doesn't exist.
+			if numChunks > 1 {
+				otherIndex := uint64((ii + 1) % numChunks)
+				if !chunkHashes[otherIndex].IsEqual(chunkHashes[ii]) {
+					require.False(VerifySnapshotChunkMerkleProof(stateRoot, otherIndex, chunkHashes[ii], proof))
+				}
+			}
+			require.False(VerifySnapshotChunkMerkleProof(stateRoot, uint64(numChunks), chunkHashes[ii], proof))
+
+			// A tampered chunk or proof doesn't verify.
+			require.False(VerifySnapshotChunkMerkleProof(stateRoot, uint64(ii), NewBlockHash(RandomBytes(HashSizeBytes)), proof))
+			if len(proof) > 0 {
+				tamperedProof := append([]*BlockHash{}, proof...)
+				tamperedProof[0] = NewBlockHash(RandomBytes(HashSizeBytes))
+				require.False(VerifySnapshotChunkMerkleProof(stateRoot, uint64(ii), chunkHashes[ii], tamperedProof))
+				require.False(VerifySnapshotChunkMerkleProof(stateRoot, uint64(ii), chunkHashes[ii], proof[1:]))
+			}
+		}
+	}
+}
+
+func TestSnapshotStateRootEncodingAndSignature(t *testing.T) {
+	require := require.New(t)
+
+	stateRoot := &SnapshotStateRoot{
+		SnapshotBlockHeight:   1000,
+		CurrentEpochBlockHash: NewBlockHash(RandomBytes(HashSizeBytes)),
+		StateRoot:             NewBlockHash(RandomBytes(HashSizeBytes)),
+		NumChunks:             12,
+	}
+
+	// Unsigned state roots encode without a signer.
+	decodedStateRoot := &SnapshotStateRoot{}
+	require.NoError(decodedStateRoot.FromBytes(bytes.NewReader(stateRoot.ToBytes())))
+	require.True(stateRoot.Equals(decodedStateRoot))
+	require.False(decodedStateRoot.IsSigned())
+	isValid, err := decodedStateRoot.VerifySignature()
+	require.NoError(err)
+	require.False(isValid)
+
+	privateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	signer, err := NewBLSSigner(privateKey)
+	require.NoError(err)
+	signature, err := signer.SignSnapshotStateRoot(stateRoot)
+	require.NoError(err)
+	stateRoot.SignerPublicKey = signer.GetPublicKey()
+	stateRoot.Signature = signature
+
+	decodedStateRoot = &SnapshotStateRoot{}
+	require.NoError(decodedStateRoot.FromBytes(bytes.NewReader(stateRoot.ToBytes())))
+	require.True(stateRoot.Equals(decodedStateRoot))
+	require.True(decodedStateRoot.SignerPublicKey.Eq(stateRoot.SignerPublicKey))
+	isValid, err = decodedStateRoot.VerifySignature()
+	require.NoError(err)
+	require.True(isValid)
+
+	// The signature doesn't verify for a different state root.
+	decodedStateRoot.NumChunks++
+	isValid, err = decodedStateRoot.VerifySignature()
+	require.NoError(err)
+	require.False(isValid)
+}
+
+func TestValidateSnapshotStateRoot(t *testing.T) {
+	require := require.New(t)
+
+	stateRoot := &SnapshotStateRoot{
+		SnapshotBlockHeight:   1000,
+		CurrentEpochBlockHash: NewBlockHash(RandomBytes(HashSizeBytes)),
+		StateRoot:             NewBlockHash(RandomBytes(HashSizeBytes)),
+		NumChunks:             12,
+	}
+	srv := &Server{}
+	srv.HyperSyncProgress.SnapshotMetadata = &SnapshotEpochMetadata{
+		SnapshotBlockHeight:   stateRoot.SnapshotBlockHeight,
+		CurrentEpochBlockHash: stateRoot.CurrentEpochBlockHash,
+	}
+
+	// Without trusted signers, no state root is accepted, signed or not.
+	require.Error(srv.validateSnapshotStateRoot(stateRoot))
+	privateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	signer, err := NewBLSSigner(privateKey)
+	require.NoError(err)
+	signature, err := signer.SignSnapshotStateRoot(stateRoot)
+	require.NoError(err)
+	stateRoot.SignerPublicKey = signer.GetPublicKey()
+	stateRoot.Signature = signature
+	require.Error(srv.validateSnapshotStateRoot(stateRoot))
+
+	// A state root signed by a trusted signer is accepted, as long as it's for the expected snapshot.
+	srv.trustedSnapshotSignerPublicKeys = []*bls.PublicKey{signer.GetPublicKey()}
+	require.NoError(srv.validateSnapshotStateRoot(stateRoot))
+	stateRoot.NumChunks++
+	require.Error(srv.validateSnapshotStateRoot(stateRoot))
+	stateRoot.NumChunks--
+	srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight++
+	require.Error(srv.validateSnapshotStateRoot(stateRoot))
+	srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight--
+
+	// A state root signed by anyone else isn't.
+	otherPrivateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	srv.trustedSnapshotSignerPublicKeys = []*bls.PublicKey{otherPrivateKey.PublicKey()}
+	require.Error(srv.validateSnapshotStateRoot(stateRoot))
+}
+
+func TestSnapshotMessagesV2Encoding(t *testing.T) {
+	require := require.New(t)
+
+	// v1 messages are unchanged, and decode without the v2 fields.
+	getSnapshotMsg := &MsgDeSoGetSnapshot{SnapshotStartKey: []byte{5}}
+	getSnapshotBytes, err := getSnapshotMsg.ToBytes(false)
+	require.NoError(err)
+	require.Equal(EncodeByteArray([]byte{5}), getSnapshotBytes)
+	decodedGetSnapshotMsg := &MsgDeSoGetSnapshot{}
+	require.NoError(decodedGetSnapshotMsg.FromBytes(getSnapshotBytes))
+	require.Equal(getSnapshotMsg, decodedGetSnapshotMsg)
+
+	getSnapshotMsg = &MsgDeSoGetSnapshot{
+		SnapshotStartKey:      []byte{5},
+		SnapshotFormatVersion: SnapshotFormatVersion2,
+		ChunkIndex:            42,
+	}
+	getSnapshotBytes, err = getSnapshotMsg.ToBytes(false)
+	require.NoError(err)
+	decodedGetSnapshotMsg = &MsgDeSoGetSnapshot{}
+	require.NoError(decodedGetSnapshotMsg.FromBytes(getSnapshotBytes))
+	require.Equal(getSnapshotMsg, decodedGetSnapshotMsg)
+
+	snapshotDataMsg := &MsgDeSoSnapshotData{
+		SnapshotMetadata: &SnapshotEpochMetadata{
+			SnapshotBlockHeight:       1000,
+			FirstSnapshotBlockHeight:  1000,
+			CurrentEpochChecksumBytes: RandomBytes(33),
+			CurrentEpochBlockHash:     NewBlockHash(RandomBytes(HashSizeBytes)),
+		},
+		SnapshotChunk: []*DBEntry{{Key: []byte{5, 1}, Value: RandomBytes(10)}},
+		Prefix:        []byte{5},
+		StateRoot: &SnapshotStateRoot{
+			SnapshotBlockHeight:   1000,
+			CurrentEpochBlockHash: NewBlockHash(RandomBytes(HashSizeBytes)),
+			StateRoot:             NewBlockHash(RandomBytes(HashSizeBytes)),
+			NumChunks:             3,
+		},
+		ChunkIndex: 2,
+		ChunkMerkleProof: []*BlockHash{
+			NewBlockHash(RandomBytes(HashSizeBytes)),
+			NewBlockHash(RandomBytes(HashSizeBytes)),
+		},
+	}
+	snapshotDataBytes, err := snapshotDataMsg.ToBytes(false)
+	require.NoError(err)
+	decodedSnapshotDataMsg := &MsgDeSoSnapshotData{}
+	require.NoError(decodedSnapshotDataMsg.FromBytes(snapshotDataBytes))
+	require.True(snapshotDataMsg.StateRoot.Equals(decodedSnapshotDataMsg.StateRoot))
+	require.Equal(snapshotDataMsg.ChunkIndex, decodedSnapshotDataMsg.ChunkIndex)
+	require.Equal(snapshotDataMsg.ChunkMerkleProof, decodedSnapshotDataMsg.ChunkMerkleProof)
+	require.Equal(snapshotDataMsg.SnapshotChunk, decodedSnapshotDataMsg.SnapshotChunk)
+
+	// Without a state root, the message is in the v1 format.
+	snapshotDataMsg.StateRoot = nil
+	snapshotDataBytes, err = snapshotDataMsg.ToBytes(false)
+	require.NoError(err)
+	decodedSnapshotDataMsg = &MsgDeSoSnapshotData{}
+	require.NoError(decodedSnapshotDataMsg.FromBytes(snapshotDataBytes))
+	require.Nil(decodedSnapshotDataMsg.StateRoot)
+	require.Nil(decodedSnapshotDataMsg.ChunkMerkleProof)
+}
+
+func TestSnapshotChunksV2(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	for ii := 0; ii < 3; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+	snap := chain.snapshot
+	require.NotNil(snap)
+	// The test chain is still in its first snapshot epoch, at height 0, when the state was empty. No
+	// ancestral records exist at the tip height, so a snapshot at the tip height is the current state.
+	snap.CurrentEpochSnapshotMetadata.SnapshotBlockHeight = uint64(chain.BlockTip().Height)
+
+	stateRoot, err := snap.GetSnapshotStateRoot()
+	require.NoError(err)
+	require.NotZero(stateRoot.NumChunks)
+	require.False(stateRoot.IsSigned())
+
+	// Every chunk verifies against the state root, and the chunks cover the state prefixes in order.
+	var lastPrefix []byte
+	for chunkIndex := uint64(0); chunkIndex < stateRoot.NumChunks; chunkIndex++ {
+		prefix, chunk, chunkStateRoot, proof, err := snap.GetSnapshotChunkV2(chunkIndex)
+		require.NoError(err)
+		require.True(stateRoot.Equals(chunkStateRoot))
+		require.True(isStateKey(prefix))
+		require.NotEmpty(chunk)
+		if lastPrefix != nil {
+			require.LessOrEqual(bytes.Compare(lastPrefix, prefix), 0)
+		}
+		lastPrefix = prefix
+		for _, entry := range chunk {
+			require.True(bytes.HasPrefix(entry.Key, prefix))
+		}
+		require.True(VerifySnapshotChunkMerkleProof(stateRoot, chunkIndex, ComputeSnapshotChunkHash(chunk), proof))
+	}
+	_, _, _, _, err = snap.GetSnapshotChunkV2(stateRoot.NumChunks)
+	require.Error(err)
+
+	// Once a signer is set, state roots of new manifests are signed.
+	privateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	signer, err := NewBLSSigner(privateKey)
+	require.NoError(err)
+	snap.SetStateRootSigner(signer)
+	snap.manifest = nil
+	signedStateRoot, err := snap.GetSnapshotStateRoot()
+	require.NoError(err)
+	require.True(stateRoot.Equals(signedStateRoot))
+	isValid, err := signedStateRoot.VerifySignature()
+	require.NoError(err)
+	require.True(isValid)
+}
@@ -0,0 +1,670 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Soft fork deployments let non-emergency rule changes activate once enough block producers run code that
+// enforces them, instead of at a fixed fork height. The scheme follows Bitcoin's version bits (BIP9):
+//   - Every deployment in DeSoParams.SoftForkDeployments is assigned a signal bit and a range of block heights
+//     in which it can be signaled.
+//   - Block producers signal readiness by setting the deployment's bit in the SoftForkSignalBitsKey ExtraData
+//     of the block reward transaction. A missing or malformed value signals nothing.
+//   - The chain is split into windows of SoftForkSignalingWindowBlocks blocks. The state of a deployment only
+//     changes at the start of a window, based on the state and signals of the previous window:
+//
+//     DEFINED   -> STARTED   once the window starts at or after StartBlockHeight.
+//     STARTED   -> LOCKED_IN once at least SoftForkActivationThresholdBasisPoints of the previous window signaled.
+//     LOCKED_IN -> ACTIVE    unconditionally, one window later.
+//     DEFINED or STARTED -> FAILED once the window starts at or after TimeoutBlockHeight without locking in.
+//
+// The state of every deployment is tracked per window in the consensus state, so all nodes agree on when a rule
+// change activates. Code that enforces a new rule should check UtxoView.IsSoftForkActive for the height of the
+// block being connected.
+
+// SoftForkSignalBitsKey is the key in a block reward transaction's ExtraData whose uvarint-encoded value holds the
+// bits of the deployments the block producer signals for.
+const SoftForkSignalBitsKey = "SoftForkSignalBits"
+
+// MaxSoftForkDeploymentBit is the highest signal bit a deployment can be assigned.
+const MaxSoftForkDeploymentBit = uint8(31)
+
+type SoftForkDeploymentState uint8
+
+const (
+	SoftForkDeploymentStateDefined  SoftForkDeploymentState = 0
+	SoftForkDeploymentStateStarted  SoftForkDeploymentState = 1
+	SoftForkDeploymentStateLockedIn SoftForkDeploymentState = 2
+	SoftForkDeploymentStateActive   SoftForkDeploymentState = 3
+	SoftForkDeploymentStateFailed   SoftForkDeploymentState = 4
+)
+
+func (state SoftForkDeploymentState) String() string {
+	switch state {
+	case SoftForkDeploymentStateDefined:
+		return "DEFINED"
+	case SoftForkDeploymentStateStarted:
+		return "STARTED"
+	case SoftForkDeploymentStateLockedIn:
+		return "LOCKED_IN"
+	case SoftForkDeploymentStateActive:
+		return "ACTIVE"
+	case SoftForkDeploymentStateFailed:
+		return "FAILED"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", uint8(state))
+	}
+}
+
+// SoftForkDeployment describes a rule change that activates through signaling. A deployment must be added to
+// the params before StartBlockHeight, and its Name must never be reused. Bits can be reused by deployments whose
+// signaling ranges don't overlap.
+type SoftForkDeployment struct {
+	Name string
+	Bit  uint8
+	// StartBlockHeight is the first height at which block producers can signal for the deployment.
+	StartBlockHeight uint64
+	// TimeoutBlockHeight is the height after which the deployment fails if it hasn't locked in.
+	TimeoutBlockHeight uint64
+}
+
+// GetSoftForkDeployment returns the deployment with the given name, or nil if there isn't one.
+func (params *DeSoParams) GetSoftForkDeployment(name string) *SoftForkDeployment {
+	for ii := range params.SoftForkDeployments {
+		if params.SoftForkDeployments[ii].Name == name {
+			return &params.SoftForkDeployments[ii]
+		}
+	}
+	return nil
+}
+
+// GetSoftForkSignalingWindowStartHeight returns the height of the first block in the signaling window that
+// contains blockHeight.
+func (params *DeSoParams) GetSoftForkSignalingWindowStartHeight(blockHeight uint64) uint64 {
+	return blockHeight - blockHeight%params.SoftForkSignalingWindowBlocks
+}
+
+// ValidateSoftForkDeployments checks that the deployments in the params are well-formed.
+func ValidateSoftForkDeployments(params *DeSoParams) error {
+	if len(params.SoftForkDeployments) == 0 {
+		return nil
+	}
+	if params.SoftForkSignalingWindowBlocks == 0 {
+		return fmt.Errorf("ValidateSoftForkDeployments: SoftForkSignalingWindowBlocks must be positive")
+	}
+	if params.SoftForkActivationThresholdBasisPoints == 0 ||
+		params.SoftForkActivationThresholdBasisPoints > MaxBasisPoints {
+		return fmt.Errorf("ValidateSoftForkDeployments: SoftForkActivationThresholdBasisPoints must be "+
+			"between 1 and %d, got %d", MaxBasisPoints, params.SoftForkActivationThresholdBasisPoints)
+	}
+	names := NewSet([]string{})
+	for ii, deployment := range params.SoftForkDeployments {
+		if deployment.Name == "" || len(deployment.Name) > 255 {
+			return fmt.Errorf("ValidateSoftForkDeployments: Deployment %d has invalid name %q", ii, deployment.Name)
+		}
+		if names.Includes(deployment.Name) {
+			return fmt.Errorf("ValidateSoftForkDeployments: Duplicate deployment name %v", deployment.Name)
+		}
+		names.Add(deployment.Name)
+		if deployment.Bit > MaxSoftForkDeploymentBit {
+			return fmt.Errorf("ValidateSoftForkDeployments: Deployment %v has bit %d, max is %d",
+				deployment.Name, deployment.Bit, MaxSoftForkDeploymentBit)
+		}
+		if deployment.StartBlockHeight >= deployment.TimeoutBlockHeight {
+			return fmt.Errorf("ValidateSoftForkDeployments: Deployment %v must start before it times out",
+				deployment.Name)
+		}
+		for _, other := range params.SoftForkDeployments[:ii] {
+			if other.Bit == deployment.Bit &&
+				other.StartBlockHeight < deployment.TimeoutBlockHeight &&
+				deployment.StartBlockHeight < other.TimeoutBlockHeight {
+				return fmt.Errorf("ValidateSoftForkDeployments: Deployments %v and %v signal on bit %d "+
+					"during overlapping heights", other.Name, deployment.Name, deployment.Bit)
+			}
+		}
+	}
+	return nil
+}
+
+// GetSoftForkSignalBits returns the signal bits in the block reward transaction's ExtraData.
+func GetSoftForkSignalBits(blockRewardTxn *MsgDeSoTxn) uint32 {
+	if blockRewardTxn == nil {
+		return 0
+	}
+	signalBitsBytes, exists := blockRewardTxn.ExtraData[SoftForkSignalBitsKey]
+	if !exists {
+		return 0
+	}
+	signalBits, numBytes := Uvarint(signalBitsBytes)
+	if numBytes != len(signalBitsBytes) || signalBits > uint64(^uint32(0)) {
+		return 0
+	}
+	return uint32(signalBits)
+}
+
+// SetSoftForkSignalBits sets the signal bits in the block reward transaction's ExtraData. The key is removed if
+// signalBits is zero so that blocks that don't signal aren't any larger.
+func SetSoftForkSignalBits(blockRewardTxn *MsgDeSoTxn, signalBits uint32) {
+	if signalBits == 0 {
+		delete(blockRewardTxn.ExtraData, SoftForkSignalBitsKey)
+		return
+	}
+	if blockRewardTxn.ExtraData == nil {
+		blockRewardTxn.ExtraData = make(map[string][]byte)
+	}
+	blockRewardTxn.ExtraData[SoftForkSignalBitsKey] = UintToBuf(uint64(signalBits))
+}
+
+//
+// TYPES: SoftForkDeploymentStateEntry
+//
+
+// SoftForkDeploymentStateEntry holds the state of a deployment during a signaling window, along with the number
+// of blocks connected in the window and how many of them signaled for the deployment. Signals are only counted
+// while the deployment is STARTED.
+type SoftForkDeploymentStateEntry struct {
+	DeploymentName         string
+	WindowStartBlockHeight uint64
+	State                  SoftForkDeploymentState
+	NumBlocks              uint64
+	NumSignalingBlocks     uint64
+
+	isDeleted bool
+}
+
+type SoftForkDeploymentStateMapKey struct {
+	DeploymentName         string
+	WindowStartBlockHeight uint64
+}
+
+func (entry *SoftForkDeploymentStateEntry) Copy() *SoftForkDeploymentStateEntry {
+	return &SoftForkDeploymentStateEntry{
+		DeploymentName:         entry.DeploymentName,
+		WindowStartBlockHeight: entry.WindowStartBlockHeight,
+		State:                  entry.State,
+		NumBlocks:              entry.NumBlocks,
+		NumSignalingBlocks:     entry.NumSignalingBlocks,
+		isDeleted:              entry.isDeleted,
+	}
+}
+
+func (entry *SoftForkDeploymentStateEntry) ToMapKey() SoftForkDeploymentStateMapKey {
+	return SoftForkDeploymentStateMapKey{
+		DeploymentName:         entry.DeploymentName,
+		WindowStartBlockHeight: entry.WindowStartBlockHeight,
+	}
+}
+
+func (entry *SoftForkDeploymentStateEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, EncodeByteArray([]byte(entry.DeploymentName))...)
+	data = append(data, UintToBuf(entry.WindowStartBlockHeight)...)
+	data = append(data, byte(entry.State))
+	data = append(data, UintToBuf(entry.NumBlocks)...)
+	data = append(data, UintToBuf(entry.NumSignalingBlocks)...)
+	return data
+}
+
+func (entry *SoftForkDeploymentStateEntry) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	// DeploymentName
+	deploymentNameBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "SoftForkDeploymentStateEntry.Decode: Problem reading DeploymentName: ")
+	}
+	entry.DeploymentName = string(deploymentNameBytes)
+
+	// WindowStartBlockHeight
+	entry.WindowStartBlockHeight, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "SoftForkDeploymentStateEntry.Decode: Problem reading WindowStartBlockHeight: ")
+	}
+
+	// State
+	stateByte, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "SoftForkDeploymentStateEntry.Decode: Problem reading State: ")
+	}
+	entry.State = SoftForkDeploymentState(stateByte)
+
+	// NumBlocks
+	entry.NumBlocks, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "SoftForkDeploymentStateEntry.Decode: Problem reading NumBlocks: ")
+	}
+
+	// NumSignalingBlocks
+	entry.NumSignalingBlocks, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "SoftForkDeploymentStateEntry.Decode: Problem reading NumSignalingBlocks: ")
+	}
+
+	return nil
+}
+
+func (entry *SoftForkDeploymentStateEntry) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (entry *SoftForkDeploymentStateEntry) GetEncoderType() EncoderType {
+	return EncoderTypeSoftForkDeploymentStateEntry
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForSoftForkDeploymentState(entry *SoftForkDeploymentStateEntry) []byte {
+	data := DBPrefixKeyForSoftForkDeploymentState(entry.DeploymentName)
+	data = append(data, EncodeUint64(entry.WindowStartBlockHeight)...)
+	return data
+}
+
+// DBPrefixKeyForSoftForkDeploymentState returns the prefix of the deployment's entries. The name is length-prefixed
+// so that no deployment's prefix is a prefix of another's.
+func DBPrefixKeyForSoftForkDeploymentState(deploymentName string) []byte {
+	data := append([]byte{}, Prefixes.PrefixSoftForkDeploymentStateByNameWindow...)
+	data = append(data, byte(len(deploymentName)))
+	data = append(data, []byte(deploymentName)...)
+	return data
+}
+
+func DBGetSoftForkDeploymentStateEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	deploymentName string,
+	windowStartBlockHeight uint64,
+) (*SoftForkDeploymentStateEntry, error) {
+	key := DBKeyForSoftForkDeploymentState(&SoftForkDeploymentStateEntry{
+		DeploymentName:         deploymentName,
+		WindowStartBlockHeight: windowStartBlockHeight,
+	})
+	entryBytes, err := DBGetWithTxn(txn, snap, key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSoftForkDeploymentStateEntryWithTxn: problem retrieving entry: ")
+	}
+	entry, err := DecodeDeSoEncoder(&SoftForkDeploymentStateEntry{}, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSoftForkDeploymentStateEntryWithTxn: problem decoding entry: ")
+	}
+	return entry, nil
+}
+
+func DBGetSoftForkDeploymentStateEntry(
+	handle *badger.DB,
+	snap *Snapshot,
+	deploymentName string,
+	windowStartBlockHeight uint64,
+) (*SoftForkDeploymentStateEntry, error) {
+	var entry *SoftForkDeploymentStateEntry
+	err := handle.View(func(txn *badger.Txn) error {
+		var innerErr error
+		entry, innerErr = DBGetSoftForkDeploymentStateEntryWithTxn(txn, snap, deploymentName, windowStartBlockHeight)
+		return innerErr
+	})
+	return entry, err
+}
+
+// DBGetSoftForkDeploymentStateEntriesForDeployment returns all of the deployment's entries ordered by window.
+// Keys in keysToSkip are ignored.
+func DBGetSoftForkDeploymentStateEntriesForDeployment(
+	handle *badger.DB,
+	deploymentName string,
+	keysToSkip *Set[string],
+) ([]*SoftForkDeploymentStateEntry, error) {
+	var entries []*SoftForkDeploymentStateEntry
+	prefix := DBPrefixKeyForSoftForkDeploymentState(deploymentName)
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			if keysToSkip.Includes(string(iterator.Item().Key())) {
+				continue
+			}
+			entryBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := DecodeDeSoEncoder(&SoftForkDeploymentStateEntry{}, bytes.NewReader(entryBytes))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetSoftForkDeploymentStateEntriesForDeployment: problem retrieving entries: ")
+	}
+	return entries, nil
+}
+
+func DBPutSoftForkDeploymentStateEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *SoftForkDeploymentStateEntry,
+	blockHeight uint64,
+	eventManager *EventManager,
+) error {
+	if entry == nil {
+		// This should never happen but is a sanity check.
+		glog.Errorf("DBPutSoftForkDeploymentStateEntryWithTxn: called with nil entry")
+		return nil
+	}
+	if err := DBSetWithTxn(
+		txn, snap, DBKeyForSoftForkDeploymentState(entry), EncodeToBytes(blockHeight, entry), eventManager,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBPutSoftForkDeploymentStateEntryWithTxn: problem storing entry in index PrefixSoftForkDeploymentStateByNameWindow: ",
+		)
+	}
+	return nil
+}
+
+func DBDeleteSoftForkDeploymentStateEntryWithTxn(
+	txn *badger.Txn,
+	snap *Snapshot,
+	entry *SoftForkDeploymentStateEntry,
+	eventManager *EventManager,
+	entryIsDeleted bool,
+) error {
+	if entry == nil {
+		return nil
+	}
+	if err := DBDeleteWithTxn(
+		txn, snap, DBKeyForSoftForkDeploymentState(entry), eventManager, entryIsDeleted,
+	); err != nil {
+		return errors.Wrapf(
+			err, "DBDeleteSoftForkDeploymentStateEntryWithTxn: problem deleting entry from index PrefixSoftForkDeploymentStateByNameWindow: ",
+		)
+	}
+	return nil
+}
+
+//
+// UTXO VIEW UTILS
+//
+
+func (bav *UtxoView) _setSoftForkDeploymentStateEntryMappings(entry *SoftForkDeploymentStateEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_setSoftForkDeploymentStateEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	bav.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry[entry.ToMapKey()] = entry
+}
+
+func (bav *UtxoView) _deleteSoftForkDeploymentStateEntryMappings(entry *SoftForkDeploymentStateEntry) {
+	// This function shouldn't be called with nil.
+	if entry == nil {
+		glog.Errorf("_deleteSoftForkDeploymentStateEntryMappings: called with nil entry, this should never happen")
+		return
+	}
+	// Create a tombstone entry.
+	tombstoneEntry := entry.Copy()
+	tombstoneEntry.isDeleted = true
+	bav._setSoftForkDeploymentStateEntryMappings(tombstoneEntry)
+}
+
+// GetSoftForkDeploymentStateEntry returns the deployment's entry for the signaling window starting at
+// windowStartBlockHeight, or nil if no block in the window has been connected.
+func (bav *UtxoView) GetSoftForkDeploymentStateEntry(
+	deploymentName string, windowStartBlockHeight uint64) (*SoftForkDeploymentStateEntry, error) {
+
+	mapKey := SoftForkDeploymentStateMapKey{
+		DeploymentName:         deploymentName,
+		WindowStartBlockHeight: windowStartBlockHeight,
+	}
+	if entry, exists := bav.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry[mapKey]; exists {
+		if entry.isDeleted {
+			return nil, nil
+		}
+		return entry, nil
+	}
+	entry, err := DBGetSoftForkDeploymentStateEntry(bav.Handle, bav.Snapshot, deploymentName, windowStartBlockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetSoftForkDeploymentStateEntry: ")
+	}
+	if entry != nil {
+		bav._setSoftForkDeploymentStateEntryMappings(entry)
+	}
+	return entry, nil
+}
+
+// GetSoftForkDeploymentStateEntries returns the deployment's entries for every signaling window in which a block
+// has been connected, ordered by window. This is the deployment's signaling history.
+func (bav *UtxoView) GetSoftForkDeploymentStateEntries(deploymentName string) ([]*SoftForkDeploymentStateEntry, error) {
+	prefix := DBPrefixKeyForSoftForkDeploymentState(deploymentName)
+	var utxoViewEntries []*SoftForkDeploymentStateEntry
+	dbKeysToSkip := NewSet([]string{})
+	for _, entry := range bav.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry {
+		dbKey := DBKeyForSoftForkDeploymentState(entry)
+		if !bytes.HasPrefix(dbKey, prefix) {
+			continue
+		}
+		dbKeysToSkip.Add(string(dbKey))
+		if !entry.isDeleted {
+			utxoViewEntries = append(utxoViewEntries, entry)
+		}
+	}
+
+	entries, err := DBGetSoftForkDeploymentStateEntriesForDeployment(bav.Handle, deploymentName, dbKeysToSkip)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetSoftForkDeploymentStateEntries: ")
+	}
+	entries = append(entries, utxoViewEntries...)
+	sort.Slice(entries, func(ii, jj int) bool {
+		return entries[ii].WindowStartBlockHeight < entries[jj].WindowStartBlockHeight
+	})
+	return entries, nil
+}
+
+// GetSoftForkDeploymentState returns the state of the deployment for a block at blockHeight. blockHeight must be
+// at most the height of the next block to be connected, since the state of later windows depends on signals
+// that haven't been seen yet.
+func (bav *UtxoView) GetSoftForkDeploymentState(
+	deploymentName string, blockHeight uint64) (SoftForkDeploymentState, error) {
+
+	deployment := bav.Params.GetSoftForkDeployment(deploymentName)
+	if deployment == nil {
+		return SoftForkDeploymentStateDefined, fmt.Errorf(
+			"GetSoftForkDeploymentState: Unknown deployment %v", deploymentName)
+	}
+	entry, err := bav._getOrComputeSoftForkDeploymentStateEntry(deployment, blockHeight)
+	if err != nil {
+		return SoftForkDeploymentStateDefined, errors.Wrapf(err, "GetSoftForkDeploymentState: ")
+	}
+	return entry.State, nil
+}
+
+// IsSoftForkActive returns true if the deployment's rules apply to a block at blockHeight. Unknown deployments are
+// never active.
+func (bav *UtxoView) IsSoftForkActive(deploymentName string, blockHeight uint64) (bool, error) {
+	if bav.Params.GetSoftForkDeployment(deploymentName) == nil {
+		return false, nil
+	}
+	state, err := bav.GetSoftForkDeploymentState(deploymentName, blockHeight)
+	if err != nil {
+		return false, errors.Wrapf(err, "IsSoftForkActive: ")
+	}
+	return state == SoftForkDeploymentStateActive, nil
+}
+
+// GetSoftForkSignalBitsForBlockHeight returns the bits a block producer running this code should signal in a
+// block at blockHeight: the bits of every deployment that is STARTED.
+func (bav *UtxoView) GetSoftForkSignalBitsForBlockHeight(blockHeight uint64) (uint32, error) {
+	var signalBits uint32
+	for ii := range bav.Params.SoftForkDeployments {
+		deployment := &bav.Params.SoftForkDeployments[ii]
+		entry, err := bav._getOrComputeSoftForkDeploymentStateEntry(deployment, blockHeight)
+		if err != nil {
+			return 0, errors.Wrapf(err, "GetSoftForkSignalBitsForBlockHeight: ")
+		}
+		if entry.State == SoftForkDeploymentStateStarted {
+			signalBits |= 1 << deployment.Bit
+		}
+	}
+	return signalBits, nil
+}
+
+// _getOrComputeSoftForkDeploymentStateEntry returns the deployment's entry for the window containing blockHeight.
+// If no block in the window has been connected yet, it returns a new, empty entry whose state is derived from the
+// previous window. The new entry isn't set in the view.
+func (bav *UtxoView) _getOrComputeSoftForkDeploymentStateEntry(
+	deployment *SoftForkDeployment, blockHeight uint64) (*SoftForkDeploymentStateEntry, error) {
+
+	windowStartBlockHeight := bav.Params.GetSoftForkSignalingWindowStartHeight(blockHeight)
+	entry, err := bav.GetSoftForkDeploymentStateEntry(deployment.Name, windowStartBlockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "_getOrComputeSoftForkDeploymentStateEntry: ")
+	}
+	if entry != nil {
+		return entry, nil
+	}
+
+	var prevEntry *SoftForkDeploymentStateEntry
+	if windowStartBlockHeight >= bav.Params.SoftForkSignalingWindowBlocks {
+		prevEntry, err = bav.GetSoftForkDeploymentStateEntry(
+			deployment.Name, windowStartBlockHeight-bav.Params.SoftForkSignalingWindowBlocks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "_getOrComputeSoftForkDeploymentStateEntry: ")
+		}
+	}
+	return &SoftForkDeploymentStateEntry{
+		DeploymentName:         deployment.Name,
+		WindowStartBlockHeight: windowStartBlockHeight,
+		State:                  bav._computeNextSoftForkDeploymentState(deployment, prevEntry, windowStartBlockHeight),
+	}, nil
+}
+
+// _computeNextSoftForkDeploymentState returns the deployment's state in the window starting at
+// windowStartBlockHeight given its entry for the previous window, which is nil if no block in the previous window
+// was connected while the deployment was known.
+func (bav *UtxoView) _computeNextSoftForkDeploymentState(
+	deployment *SoftForkDeployment,
+	prevEntry *SoftForkDeploymentStateEntry,
+	windowStartBlockHeight uint64,
+) SoftForkDeploymentState {
+	prevState := SoftForkDeploymentStateDefined
+	if prevEntry != nil {
+		prevState = prevEntry.State
+	}
+
+	switch prevState {
+	case SoftForkDeploymentStateDefined:
+		if windowStartBlockHeight >= deployment.TimeoutBlockHeight {
+			return SoftForkDeploymentStateFailed
+		}
+		if windowStartBlockHeight >= deployment.StartBlockHeight {
+			return SoftForkDeploymentStateStarted
+		}
+		return SoftForkDeploymentStateDefined
+	case SoftForkDeploymentStateStarted:
+		// The threshold is compared against the full window size rather than the number of blocks seen, so
+		// a deployment can't lock in off of a partial window.
+		if prevEntry.NumSignalingBlocks*MaxBasisPoints >=
+			bav.Params.SoftForkActivationThresholdBasisPoints*bav.Params.SoftForkSignalingWindowBlocks {
+			return SoftForkDeploymentStateLockedIn
+		}
+		if windowStartBlockHeight >= deployment.TimeoutBlockHeight {
+			return SoftForkDeploymentStateFailed
+		}
+		return SoftForkDeploymentStateStarted
+	case SoftForkDeploymentStateLockedIn:
+		return SoftForkDeploymentStateActive
+	default:
+		// ACTIVE and FAILED are final.
+		return prevState
+	}
+}
+
+// _updateSoftForkDeploymentStatesForBlock adds the block to the entries of every deployment for the block's
+// signaling window, or subtracts it if isConnect is false. Entries are created when the first block of their
+// window is connected and deleted when it is disconnected, which is when the state transitions happen.
+func (bav *UtxoView) _updateSoftForkDeploymentStatesForBlock(desoBlock *MsgDeSoBlock, isConnect bool) error {
+	if len(bav.Params.SoftForkDeployments) == 0 {
+		return nil
+	}
+	var signalBits uint32
+	if len(desoBlock.Txns) > 0 {
+		signalBits = GetSoftForkSignalBits(desoBlock.Txns[0])
+	}
+	blockHeight := desoBlock.Header.Height
+
+	for ii := range bav.Params.SoftForkDeployments {
+		deployment := &bav.Params.SoftForkDeployments[ii]
+		prevEntry, err := bav._getOrComputeSoftForkDeploymentStateEntry(deployment, blockHeight)
+		if err != nil {
+			return errors.Wrapf(err, "_updateSoftForkDeploymentStatesForBlock: ")
+		}
+		entry := prevEntry.Copy()
+		isSignaling := entry.State == SoftForkDeploymentStateStarted && signalBits&(1<<deployment.Bit) != 0
+
+		if isConnect {
+			entry.NumBlocks++
+			if isSignaling {
+				entry.NumSignalingBlocks++
+			}
+			if entry.NumBlocks == 1 {
+				glog.V(1).Infof("_updateSoftForkDeploymentStatesForBlock: Deployment %v is %v for the window "+
+					"starting at block %d", deployment.Name, entry.State, entry.WindowStartBlockHeight)
+			}
+			bav._setSoftForkDeploymentStateEntryMappings(entry)
+			continue
+		}
+
+		if entry.NumBlocks == 0 || (isSignaling && entry.NumSignalingBlocks == 0) {
+			return fmt.Errorf("_updateSoftForkDeploymentStatesForBlock: Deployment %v has no blocks to disconnect "+
+				"in window starting at %d", deployment.Name, entry.WindowStartBlockHeight)
+		}
+		entry.NumBlocks--
+		if isSignaling {
+			entry.NumSignalingBlocks--
+		}
+		if entry.NumBlocks == 0 {
+			bav._deleteSoftForkDeploymentStateEntryMappings(entry)
+		} else {
+			bav._setSoftForkDeploymentStateEntryMappings(entry)
+		}
+	}
+	return nil
+}
+
+func (bav *UtxoView) _flushSoftForkDeploymentStateEntriesToDbWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	for mapKey, entry := range bav.SoftForkDeploymentStateMapKeyToSoftForkDeploymentStateEntry {
+		// Sanity-check that the entry matches the map key.
+		if entry.ToMapKey() != mapKey {
+			return fmt.Errorf(
+				"_flushSoftForkDeploymentStateEntriesToDbWithTxn: entry key %v doesn't match MapKey %v",
+				entry.ToMapKey(), mapKey,
+			)
+		}
+
+		// Delete the existing entry from the db, then put the entry if it isn't deleted.
+		if err := DBDeleteSoftForkDeploymentStateEntryWithTxn(
+			txn, bav.Snapshot, entry, bav.EventManager, entry.isDeleted,
+		); err != nil {
+			return errors.Wrapf(err, "_flushSoftForkDeploymentStateEntriesToDbWithTxn: ")
+		}
+		if entry.isDeleted {
+			continue
+		}
+		if err := DBPutSoftForkDeploymentStateEntryWithTxn(
+			txn, bav.Snapshot, entry, blockHeight, bav.EventManager,
+		); err != nil {
+			return errors.Wrapf(err, "_flushSoftForkDeploymentStateEntriesToDbWithTxn: ")
+		}
+	}
+	return nil
+}
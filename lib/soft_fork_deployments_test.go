@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftForkDeploymentStates(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	params := DeSoTestnetParams
+	params.SoftForkSignalingWindowBlocks = 10
+	params.SoftForkActivationThresholdBasisPoints = 8000
+	params.SoftForkDeployments = []SoftForkDeployment{
+		// Signaled by 8 of the 10 blocks in the window starting at 20, so it locks in at 30 and activates at 40.
+		{Name: "locks-in", Bit: 0, StartBlockHeight: 20, TimeoutBlockHeight: 100},
+		// Only signaled by 7 blocks per window, so it fails at its timeout.
+		{Name: "times-out", Bit: 1, StartBlockHeight: 20, TimeoutBlockHeight: 40},
+	}
+	require.NoError(ValidateSoftForkDeployments(&params))
+
+	newBlock := func(height uint64) *MsgDeSoBlock {
+		blockRewardTxn := &MsgDeSoTxn{TxnMeta: &BlockRewardMetadataa{}}
+		var signalBits uint32
+		if height%10 < 8 {
+			signalBits |= 1 << 0
+		}
+		if height%10 < 7 {
+			signalBits |= 1 << 1
+		}
+		SetSoftForkSignalBits(blockRewardTxn, signalBits)
+		return &MsgDeSoBlock{Header: &MsgDeSoHeader{Height: height}, Txns: []*MsgDeSoTxn{blockRewardTxn}}
+	}
+	requireStates := func(utxoView *UtxoView, height uint64, lockInState SoftForkDeploymentState,
+		timeOutState SoftForkDeploymentState) {
+		state, err := utxoView.GetSoftForkDeploymentState("locks-in", height)
+		require.NoError(err)
+		require.Equal(lockInState, state, "height %d", height)
+		state, err = utxoView.GetSoftForkDeploymentState("times-out", height)
+		require.NoError(err)
+		require.Equal(timeOutState, state, "height %d", height)
+	}
+
+	// Connect blocks 1 through 49, flushing every few blocks so that the entries are read back from the db.
+	utxoView := NewUtxoView(db, &params, nil, nil, nil)
+	for height := uint64(1); height < 50; height++ {
+		require.NoError(utxoView._updateSoftForkDeploymentStatesForBlock(newBlock(height), true))
+		if height%7 == 0 {
+			require.NoError(utxoView.FlushToDb(height))
+			utxoView = NewUtxoView(db, &params, nil, nil, nil)
+		}
+	}
+	require.NoError(utxoView.FlushToDb(49))
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+
+	requireStates(utxoView, 5, SoftForkDeploymentStateDefined, SoftForkDeploymentStateDefined)
+	requireStates(utxoView, 25, SoftForkDeploymentStateStarted, SoftForkDeploymentStateStarted)
+	requireStates(utxoView, 35, SoftForkDeploymentStateLockedIn, SoftForkDeploymentStateStarted)
+	requireStates(utxoView, 45, SoftForkDeploymentStateActive, SoftForkDeploymentStateFailed)
+	// The next block is in a new window whose state is derived from the previous one.
+	requireStates(utxoView, 50, SoftForkDeploymentStateActive, SoftForkDeploymentStateFailed)
+
+	isActive, err := utxoView.IsSoftForkActive("locks-in", 39)
+	require.NoError(err)
+	require.False(isActive)
+	isActive, err = utxoView.IsSoftForkActive("locks-in", 40)
+	require.NoError(err)
+	require.True(isActive)
+	isActive, err = utxoView.IsSoftForkActive("unknown", 40)
+	require.NoError(err)
+	require.False(isActive)
+
+	// Signals are only counted while a deployment is STARTED.
+	entries, err := utxoView.GetSoftForkDeploymentStateEntries("locks-in")
+	require.NoError(err)
+	require.Len(entries, 5)
+	require.Equal(uint64(0), entries[0].WindowStartBlockHeight)
+	require.Equal(uint64(9), entries[0].NumBlocks)
+	require.Equal(uint64(0), entries[0].NumSignalingBlocks)
+	require.Equal(SoftForkDeploymentStateStarted, entries[2].State)
+	require.Equal(uint64(8), entries[2].NumSignalingBlocks)
+	require.Equal(uint64(0), entries[3].NumSignalingBlocks)
+
+	// Only the deployments that are STARTED are signaled for.
+	signalBits, err := utxoView.GetSoftForkSignalBitsForBlockHeight(25)
+	require.NoError(err)
+	require.Equal(uint32(0b11), signalBits)
+	signalBits, err = utxoView.GetSoftForkSignalBitsForBlockHeight(35)
+	require.NoError(err)
+	require.Equal(uint32(0b10), signalBits)
+	signalBits, err = utxoView.GetSoftForkSignalBitsForBlockHeight(45)
+	require.NoError(err)
+	require.Equal(uint32(0), signalBits)
+
+	// Disconnecting the blocks back to height 29 reverts the lock in.
+	for height := uint64(49); height >= 30; height-- {
+		require.NoError(utxoView._updateSoftForkDeploymentStatesForBlock(newBlock(height), false))
+	}
+	require.NoError(utxoView.FlushToDb(29))
+	utxoView = NewUtxoView(db, &params, nil, nil, nil)
+	requireStates(utxoView, 29, SoftForkDeploymentStateStarted, SoftForkDeploymentStateStarted)
+	requireStates(utxoView, 30, SoftForkDeploymentStateLockedIn, SoftForkDeploymentStateStarted)
+	entries, err = utxoView.GetSoftForkDeploymentStateEntries("locks-in")
+	require.NoError(err)
+	require.Len(entries, 3)
+
+	// A window can't be disconnected past its first block.
+	require.Error(utxoView._updateSoftForkDeploymentStatesForBlock(newBlock(35), false))
+}
+
+func TestValidateSoftForkDeployments(t *testing.T) {
+	require := require.New(t)
+
+	params := DeSoTestnetParams
+	params.SoftForkSignalingWindowBlocks = 10
+	params.SoftForkActivationThresholdBasisPoints = 9000
+	params.SoftForkDeployments = []SoftForkDeployment{
+		{Name: "a", Bit: 0, StartBlockHeight: 10, TimeoutBlockHeight: 20},
+		// The bit can be reused once the first deployment has timed out.
+		{Name: "b", Bit: 0, StartBlockHeight: 20, TimeoutBlockHeight: 30},
+	}
+	require.NoError(ValidateSoftForkDeployments(&params))
+
+	params.SoftForkDeployments[1].StartBlockHeight = 15
+	require.Error(ValidateSoftForkDeployments(&params))
+	params.SoftForkDeployments[1].Bit = 1
+	require.NoError(ValidateSoftForkDeployments(&params))
+
+	params.SoftForkDeployments[1].Name = "a"
+	require.Error(ValidateSoftForkDeployments(&params))
+	params.SoftForkDeployments[1].Name = "b"
+
+	params.SoftForkDeployments[1].Bit = MaxSoftForkDeploymentBit + 1
+	require.Error(ValidateSoftForkDeployments(&params))
+	params.SoftForkDeployments[1].Bit = 1
+
+	params.SoftForkDeployments[1].TimeoutBlockHeight = 15
+	require.Error(ValidateSoftForkDeployments(&params))
+	params.SoftForkDeployments[1].TimeoutBlockHeight = 30
+
+	params.SoftForkActivationThresholdBasisPoints = MaxBasisPoints + 1
+	require.Error(ValidateSoftForkDeployments(&params))
+}
+
+func TestSoftForkSignalBits(t *testing.T) {
+	require := require.New(t)
+
+	txn := &MsgDeSoTxn{TxnMeta: &BlockRewardMetadataa{}}
+	require.Equal(uint32(0), GetSoftForkSignalBits(txn))
+
+	SetSoftForkSignalBits(txn, 1<<31|1)
+	require.Equal(uint32(1<<31|1), GetSoftForkSignalBits(txn))
+
+	SetSoftForkSignalBits(txn, 0)
+	require.NotContains(txn.ExtraData, SoftForkSignalBitsKey)
+
+	// Malformed values don't signal anything.
+	txn.ExtraData = map[string][]byte{SoftForkSignalBitsKey: UintToBuf(1 << 32)}
+	require.Equal(uint32(0), GetSoftForkSignalBits(txn))
+	txn.ExtraData = map[string][]byte{SoftForkSignalBitsKey: append(UintToBuf(1), 0)}
+	require.Equal(uint32(0), GetSoftForkSignalBits(txn))
+}
@@ -0,0 +1,267 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// StateAuditor scans the DB of a stopped node for entries that reference other entries that don't exist, e.g.
+// after a crash or a bad manual edit left the DB partially written. It's meant for operators diagnosing
+// corruption, so it scans incrementally: every Run scans a bounded number of entries and returns a cursor that
+// the next Run resumes from.
+//
+// In repair mode, the auditor deletes the dangling entries that can't be valid without the entries they
+// reference. The deletions bypass the snapshot, so a node that serves hypersync snapshots has to recompute its
+// state checksum after a repair.
+type StateAuditor struct {
+	db     *badger.DB
+	repair bool
+}
+
+// StateAuditCheck is one of the reference checks that the StateAuditor runs, in order.
+type StateAuditCheck uint8
+
+const (
+	// StateAuditCheckPostProfiles finds posts whose poster doesn't have a profile. Consensus doesn't require a
+	// profile to post, so these are only reported, and never repaired.
+	StateAuditCheckPostProfiles StateAuditCheck = 0
+	// StateAuditCheckNFTPosts finds NFT entries whose post doesn't exist.
+	StateAuditCheckNFTPosts StateAuditCheck = 1
+	// StateAuditCheckCreatorCoinBalanceProfiles finds creator coin balance entries whose creator doesn't have a
+	// profile.
+	StateAuditCheckCreatorCoinBalanceProfiles StateAuditCheck = 2
+	// StateAuditCheckDAOCoinBalanceProfiles finds DAO coin balance entries whose creator doesn't have a profile.
+	StateAuditCheckDAOCoinBalanceProfiles StateAuditCheck = 3
+	StateAuditCheckEnd                    StateAuditCheck = 4
+)
+
+func (check StateAuditCheck) String() string {
+	switch check {
+	case StateAuditCheckPostProfiles:
+		return "POST_PROFILES"
+	case StateAuditCheckNFTPosts:
+		return "NFT_POSTS"
+	case StateAuditCheckCreatorCoinBalanceProfiles:
+		return "CREATOR_COIN_BALANCE_PROFILES"
+	case StateAuditCheckDAOCoinBalanceProfiles:
+		return "DAO_COIN_BALANCE_PROFILES"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (check StateAuditCheck) prefix() []byte {
+	switch check {
+	case StateAuditCheckPostProfiles:
+		return Prefixes.PrefixPostHashToPostEntry
+	case StateAuditCheckNFTPosts:
+		return Prefixes.PrefixPostHashSerialNumberToNFTEntry
+	case StateAuditCheckCreatorCoinBalanceProfiles:
+		return Prefixes.PrefixHODLerPKIDCreatorPKIDToBalanceEntry
+	case StateAuditCheckDAOCoinBalanceProfiles:
+		return Prefixes.PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry
+	default:
+		return nil
+	}
+}
+
+// StateAuditCursor is where a StateAuditor run stopped: the check it was running and the last key it scanned.
+type StateAuditCursor struct {
+	Check   StateAuditCheck
+	LastKey []byte
+}
+
+func (cursor *StateAuditCursor) ToBytes() []byte {
+	return append([]byte{byte(cursor.Check)}, cursor.LastKey...)
+}
+
+func (cursor *StateAuditCursor) FromBytes(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("StateAuditCursor.FromBytes: Empty cursor")
+	}
+	if StateAuditCheck(data[0]) >= StateAuditCheckEnd {
+		return fmt.Errorf("StateAuditCursor.FromBytes: Unknown check %d", data[0])
+	}
+	cursor.Check = StateAuditCheck(data[0])
+	cursor.LastKey = append([]byte{}, data[1:]...)
+	return nil
+}
+
+// StateAuditFinding is a dangling entry found by the StateAuditor.
+type StateAuditFinding struct {
+	Check       StateAuditCheck
+	Key         []byte
+	Description string
+	// Repaired is true if the entry was deleted.
+	Repaired bool
+}
+
+// StateAuditReport is the result of a StateAuditor run.
+type StateAuditReport struct {
+	Findings           []*StateAuditFinding
+	NumEntriesScanned  uint64
+	NumEntriesRepaired uint64
+	// Cursor is where the next run resumes from, or nil if the audit is complete.
+	Cursor *StateAuditCursor
+}
+
+// stateAuditRepair deletes the dangling entry of a finding.
+type stateAuditRepair func(txn *badger.Txn) error
+
+func NewStateAuditor(db *badger.DB, repair bool) *StateAuditor {
+	return &StateAuditor{
+		db:     db,
+		repair: repair,
+	}
+}
+
+// Run scans up to maxEntries entries, starting after the cursor, or from the beginning of the audit if the cursor
+// is nil. In repair mode, the dangling entries it finds are deleted in a single txn once the scan is done.
+func (auditor *StateAuditor) Run(cursor *StateAuditCursor, maxEntries uint64) (*StateAuditReport, error) {
+	if maxEntries == 0 {
+		return nil, fmt.Errorf("StateAuditor.Run: maxEntries must be greater than zero")
+	}
+	if cursor == nil {
+		cursor = &StateAuditCursor{Check: StateAuditCheckPostProfiles}
+	}
+
+	report := &StateAuditReport{}
+	var repairs []stateAuditRepair
+	err := auditor.db.View(func(txn *badger.Txn) error {
+		check := cursor.Check
+		lastKey := cursor.LastKey
+		for ; check < StateAuditCheckEnd; check, lastKey = check+1, nil {
+			prefix := check.prefix()
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = prefix
+			opts.PrefetchValues = check == StateAuditCheckPostProfiles
+			it := txn.NewIterator(opts)
+
+			seekKey := prefix
+			if len(lastKey) > 0 {
+				seekKey = append(append([]byte{}, lastKey...), 0)
+			}
+			for it.Seek(seekKey); it.ValidForPrefix(prefix); it.Next() {
+				if report.NumEntriesScanned == maxEntries {
+					report.Cursor = &StateAuditCursor{Check: check, LastKey: lastKey}
+					it.Close()
+					return nil
+				}
+				key := it.Item().KeyCopy(nil)
+				finding, repair, err := auditor._checkEntry(txn, check, key, it.Item())
+				if err != nil {
+					it.Close()
+					return errors.Wrapf(err, "StateAuditor.Run: Problem checking %v entry %x", check, key)
+				}
+				if finding != nil {
+					report.Findings = append(report.Findings, finding)
+					if auditor.repair && repair != nil {
+						repairs = append(repairs, repair)
+						finding.Repaired = true
+					}
+				}
+				report.NumEntriesScanned++
+				lastKey = key
+			}
+			it.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(repairs) > 0 {
+		err = auditor.db.Update(func(txn *badger.Txn) error {
+			for _, repair := range repairs {
+				if err := repair(txn); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "StateAuditor.Run: Problem repairing entries")
+		}
+		report.NumEntriesRepaired = uint64(len(repairs))
+	}
+	return report, nil
+}
+
+// _checkEntry returns a finding if the entry is dangling, along with the repair that deletes it if it can be
+// repaired.
+func (auditor *StateAuditor) _checkEntry(txn *badger.Txn, check StateAuditCheck, key []byte, item *badger.Item) (
+	*StateAuditFinding, stateAuditRepair, error) {
+
+	prefixLen := len(check.prefix())
+	switch check {
+	case StateAuditCheckPostProfiles:
+		postEntryBytes, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		postEntry := &PostEntry{}
+		if exists, err := DecodeFromBytes(postEntry, bytes.NewReader(postEntryBytes)); err != nil {
+			return nil, nil, errors.Wrapf(err, "Problem decoding post entry")
+		} else if !exists {
+			return nil, nil, fmt.Errorf("Post entry is nil")
+		}
+		posterPKID := DBGetPKIDEntryForPublicKeyWithTxn(txn, nil, postEntry.PosterPublicKey).PKID
+		if _dbHasKeyWithTxn(txn, _dbKeyForPKIDToProfileEntry(posterPKID)) {
+			return nil, nil, nil
+		}
+		return &StateAuditFinding{
+			Check: check,
+			Key:   key,
+			Description: fmt.Sprintf("Post %v has poster %v without a profile",
+				postEntry.PostHash, PkToStringBoth(postEntry.PosterPublicKey)),
+		}, nil, nil
+
+	case StateAuditCheckNFTPosts:
+		if len(key) != prefixLen+HashSizeBytes+8 {
+			return nil, nil, fmt.Errorf("Invalid key length %d", len(key))
+		}
+		postHash := NewBlockHash(key[prefixLen : prefixLen+HashSizeBytes])
+		serialNumber := DecodeUint64(key[prefixLen+HashSizeBytes:])
+		if _dbHasKeyWithTxn(txn, _dbKeyForPostEntryHash(postHash)) {
+			return nil, nil, nil
+		}
+		return &StateAuditFinding{
+			Check:       check,
+			Key:         key,
+			Description: fmt.Sprintf("NFT %v #%d has no post", postHash, serialNumber),
+		}, func(txn *badger.Txn) error {
+			return DBDeleteNFTMappingsWithTxn(txn, nil, postHash, serialNumber, nil, true)
+		}, nil
+
+	case StateAuditCheckCreatorCoinBalanceProfiles, StateAuditCheckDAOCoinBalanceProfiles:
+		if len(key) != prefixLen+2*PublicKeyLenCompressed {
+			return nil, nil, fmt.Errorf("Invalid key length %d", len(key))
+		}
+		hodlerPKID := NewPKID(key[prefixLen : prefixLen+PublicKeyLenCompressed])
+		creatorPKID := NewPKID(key[prefixLen+PublicKeyLenCompressed:])
+		if _dbHasKeyWithTxn(txn, _dbKeyForPKIDToProfileEntry(creatorPKID)) {
+			return nil, nil, nil
+		}
+		isDAOCoin := check == StateAuditCheckDAOCoinBalanceProfiles
+		return &StateAuditFinding{
+			Check: check,
+			Key:   key,
+			Description: fmt.Sprintf("Balance entry of HODLer %v has creator %v without a profile",
+				PkToStringBoth(hodlerPKID[:]), PkToStringBoth(creatorPKID[:])),
+		}, func(txn *badger.Txn) error {
+			return DBDeleteBalanceEntryMappingsWithTxn(txn, nil, hodlerPKID, creatorPKID, isDAOCoin, nil, true)
+		}, nil
+
+	default:
+		return nil, nil, fmt.Errorf("Unknown check %d", check)
+	}
+}
+
+func _dbHasKeyWithTxn(txn *badger.Txn, key []byte) bool {
+	_, err := txn.Get(key)
+	return err == nil
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateAuditor(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	params := &DeSoTestnetParams
+
+	// m0 has a profile and m1 doesn't. Each of them has a post, an NFT, and a holder of their creator coin and
+	// DAO coin, and m1 has an NFT whose post is missing.
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	m2PKID := NewPKID(m2PkBytes)
+	m0PostHash := &BlockHash{1}
+	m1PostHash := &BlockHash{2}
+	missingPostHash := &BlockHash{3}
+	require.NoError(db.Update(func(txn *badger.Txn) error {
+		profileEntry := &ProfileEntry{PublicKey: m0PkBytes, Username: []byte("m0")}
+		require.NoError(DBPutProfileEntryMappingsWithTxn(txn, nil, 0, profileEntry, m0PKID, params, nil))
+		for _, postEntry := range []*PostEntry{
+			{PostHash: m0PostHash, PosterPublicKey: m0PkBytes},
+			{PostHash: m1PostHash, PosterPublicKey: m1PkBytes},
+		} {
+			require.NoError(DBPutPostEntryMappingsWithTxn(txn, nil, 0, postEntry, params, nil))
+		}
+		for _, nftPostHash := range []*BlockHash{m0PostHash, m1PostHash, missingPostHash} {
+			nftEntry := &NFTEntry{OwnerPKID: m2PKID, NFTPostHash: nftPostHash, SerialNumber: 1}
+			require.NoError(DBPutNFTEntryMappingsWithTxn(txn, nil, 0, nftEntry, nil))
+		}
+		for _, creatorPKID := range []*PKID{m0PKID, m1PKID} {
+			for _, isDAOCoin := range []bool{false, true} {
+				balanceEntry := &BalanceEntry{
+					HODLerPKID:   m2PKID,
+					CreatorPKID:  creatorPKID,
+					BalanceNanos: *uint256.NewInt(100),
+				}
+				require.NoError(DBPutBalanceEntryMappingsWithTxn(txn, nil, 0, balanceEntry, isDAOCoin, nil))
+			}
+		}
+		return nil
+	}))
+
+	// Audit two entries at a time, resuming from the cursor, without repairing anything.
+	auditor := NewStateAuditor(db, false)
+	var findings []*StateAuditFinding
+	var cursor *StateAuditCursor
+	numRuns := 0
+	for {
+		report, err := auditor.Run(cursor, 2)
+		require.NoError(err)
+		require.LessOrEqual(report.NumEntriesScanned, uint64(2))
+		require.Zero(report.NumEntriesRepaired)
+		findings = append(findings, report.Findings...)
+		numRuns++
+		if report.Cursor == nil {
+			break
+		}
+		// The cursor survives a round trip through its bytes, e.g. when an operator passes it back in.
+		cursor = &StateAuditCursor{}
+		require.NoError(cursor.FromBytes(report.Cursor.ToBytes()))
+	}
+	// There are 2 posts, 3 NFTs, and 4 balance entries.
+	require.Equal(5, numRuns)
+	require.Len(findings, 4)
+	require.Equal(StateAuditCheckPostProfiles, findings[0].Check)
+	require.Equal(_dbKeyForPostEntryHash(m1PostHash), findings[0].Key)
+	require.Equal(StateAuditCheckNFTPosts, findings[1].Check)
+	require.Equal(_dbKeyForNFTPostHashSerialNumber(missingPostHash, 1), findings[1].Key)
+	require.Equal(StateAuditCheckCreatorCoinBalanceProfiles, findings[2].Check)
+	require.Equal(_dbKeyForHODLerPKIDCreatorPKIDToBalanceEntry(m2PKID, m1PKID, false), findings[2].Key)
+	require.Equal(StateAuditCheckDAOCoinBalanceProfiles, findings[3].Check)
+	require.Equal(_dbKeyForHODLerPKIDCreatorPKIDToBalanceEntry(m2PKID, m1PKID, true), findings[3].Key)
+	for _, finding := range findings {
+		require.False(finding.Repaired)
+	}
+
+	// Repairing deletes the dangling NFT and balance entries, but not the post.
+	report, err := NewStateAuditor(db, true).Run(nil, 100)
+	require.NoError(err)
+	require.Nil(report.Cursor)
+	require.Len(report.Findings, 4)
+	require.False(report.Findings[0].Repaired)
+	require.Equal(uint64(3), report.NumEntriesRepaired)
+	require.NotNil(DBGetPostEntryByPostHash(db, nil, m1PostHash))
+	require.NoError(db.View(func(txn *badger.Txn) error {
+		require.Nil(DBGetNFTEntryByPostHashSerialNumberWithTxn(txn, nil, missingPostHash, 1))
+		require.NotNil(DBGetNFTEntryByPostHashSerialNumberWithTxn(txn, nil, m1PostHash, 1))
+		return nil
+	}))
+	for _, isDAOCoin := range []bool{false, true} {
+		require.True(DBGetBalanceEntryForHODLerAndCreatorPKIDs(db, nil, m2PKID, m1PKID, isDAOCoin).BalanceNanos.IsZero())
+		require.Equal(uint64(100),
+			DBGetBalanceEntryForHODLerAndCreatorPKIDs(db, nil, m2PKID, m0PKID, isDAOCoin).BalanceNanos.Uint64())
+	}
+
+	// Only the post is left.
+	report, err = auditor.Run(nil, 100)
+	require.NoError(err)
+	require.Len(report.Findings, 1)
+	require.Equal(StateAuditCheckPostProfiles, report.Findings[0].Check)
+}
@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// StateCache is a size-bounded LRU cache of hot state entries, i.e. profiles, global params, and follows, that
+// sits in front of Badger. Feed-heavy API load reads the same profiles and follows over and over, and each of
+// those reads would otherwise go to disk. DBGetWithTxn fills the cache on a miss, and DBSetWithTxn and
+// DBDeleteWithTxn invalidate the entries they write, so it lives on the Snapshot alongside the DatabaseCache and
+// is only used by hypersync nodes.
+//
+// Unlike the DatabaseCache, the StateCache is filled by reads, so it has to make sure that a read from a Badger
+// txn that started before a flush committed can't put a stale value back into the cache after the flush has
+// invalidated it. To that end:
+//   - Once a flush writes a hot entry, the cache stops accepting new values until the flush ends, since the
+//     values read in the meantime may be from either side of the flush, or uncommitted.
+//   - When the flush ends, the cache only accepts values read by Badger txns that started after everything the
+//     flush wrote was committed, i.e. whose read timestamp is at least the DB's max version.
+//
+// A nil StateCache doesn't cache anything.
+type StateCache struct {
+	mtx      sync.Mutex
+	maxBytes uint64
+	numBytes uint64
+
+	// entries are the elements of lruList, keyed by the entries' keys. The front of lruList is the most
+	// recently used entry.
+	entries map[string]*list.Element
+	lruList *list.List
+
+	// hasPendingWrites is true while a flush that wrote hot entries is in progress. minReadTs is the read
+	// timestamp that a Badger txn needs for the values it reads to be cached.
+	hasPendingWrites bool
+	minReadTs        uint64
+}
+
+type stateCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// stateCacheEntryOverheadBytes approximates the memory that an entry takes up on top of its key and value, i.e.
+// its list element and map entry, so that caching many small entries doesn't exceed maxBytes by much.
+const stateCacheEntryOverheadBytes = 128
+
+// stateCachePrefixes are the prefixes of the hot entries that the StateCache holds.
+var stateCachePrefixes = [][]byte{
+	Prefixes.PrefixPKIDToProfileEntry,
+	Prefixes.PrefixProfileUsernameToPKID,
+	Prefixes.PrefixGlobalParams,
+	Prefixes.PrefixFollowerPKIDToFollowedPKID,
+	Prefixes.PrefixFollowedPKIDToFollowerPKID,
+}
+
+// NewStateCache returns a StateCache that holds up to maxBytes of entries, or nil if maxBytes is zero.
+func NewStateCache(maxBytes uint64) *StateCache {
+	if maxBytes == 0 {
+		return nil
+	}
+	return &StateCache{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lruList:  list.New(),
+	}
+}
+
+// isStateCacheKey returns true if the key is one of the hot entries that the StateCache holds.
+func isStateCacheKey(key []byte) bool {
+	for _, prefix := range stateCachePrefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the cached value of the key. The value must not be modified.
+func (cache *StateCache) Get(key []byte) ([]byte, bool) {
+	if cache == nil || !isStateCacheKey(key) {
+		return nil, false
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	element, exists := cache.entries[string(key)]
+	if !exists {
+		return nil, false
+	}
+	cache.lruList.MoveToFront(element)
+	return element.Value.(*stateCacheEntry).value, true
+}
+
+// Put caches the value of the key that was read by txn, unless the value may be stale. Least recently used
+// entries are evicted to make room for it.
+func (cache *StateCache) Put(txn *badger.Txn, key []byte, value []byte) {
+	if cache == nil || txn == nil || !isStateCacheKey(key) {
+		return
+	}
+	entrySize := stateCacheEntrySize(key, value)
+	if entrySize > cache.maxBytes {
+		return
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	if cache.hasPendingWrites || txn.ReadTs() < cache.minReadTs {
+		return
+	}
+	cache._removeEntry(string(key))
+	for cache.numBytes+entrySize > cache.maxBytes {
+		cache._removeEntry(cache.lruList.Back().Value.(*stateCacheEntry).key)
+	}
+	entry := &stateCacheEntry{
+		key:   string(key),
+		value: value,
+	}
+	cache.entries[entry.key] = cache.lruList.PushFront(entry)
+	cache.numBytes += entrySize
+}
+
+// Invalidate removes the key from the cache because it's being written. The cache doesn't accept new values
+// until EndFlush is called.
+func (cache *StateCache) Invalidate(key []byte) {
+	if cache == nil || !isStateCacheKey(key) {
+		return
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	cache._removeEntry(string(key))
+	cache.hasPendingWrites = true
+}
+
+// EndFlush is called once a flush has been committed or aborted. If the flush wrote any hot entries, the cache
+// starts accepting the values read by Badger txns that started after the flush.
+func (cache *StateCache) EndFlush(db *badger.DB) {
+	if cache == nil || db == nil {
+		return
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	if !cache.hasPendingWrites {
+		return
+	}
+	cache.hasPendingWrites = false
+	cache.minReadTs = db.MaxVersion()
+}
+
+// Purge removes all of the entries from the cache, e.g. after the DB was written without going through
+// DBSetWithTxn and DBDeleteWithTxn.
+func (cache *StateCache) Purge() {
+	if cache == nil {
+		return
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	cache.entries = make(map[string]*list.Element)
+	cache.lruList.Init()
+	cache.numBytes = 0
+}
+
+// NumBytes returns the approximate size of the cached entries.
+func (cache *StateCache) NumBytes() uint64 {
+	if cache == nil {
+		return 0
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	return cache.numBytes
+}
+
+func (cache *StateCache) _removeEntry(key string) {
+	element, exists := cache.entries[key]
+	if !exists {
+		return
+	}
+	entry := cache.lruList.Remove(element).(*stateCacheEntry)
+	delete(cache.entries, key)
+	cache.numBytes -= stateCacheEntrySize([]byte(entry.key), entry.value)
+}
+
+func stateCacheEntrySize(key []byte, value []byte) uint64 {
+	return uint64(len(key)+len(value)) + stateCacheEntryOverheadBytes
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateCache(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	profileKey := func(ii byte) []byte {
+		return _dbKeyForPKIDToProfileEntry(&PKID{ii})
+	}
+	setValue := func(key []byte, value []byte) {
+		require.NoError(db.Update(func(txn *badger.Txn) error {
+			return txn.Set(key, value)
+		}))
+	}
+	value := make([]byte, 100)
+	entrySize := stateCacheEntrySize(profileKey(1), value)
+	cache := NewStateCache(3 * entrySize)
+	require.Nil(NewStateCache(0))
+
+	// Hot entries are cached, and other entries aren't.
+	readTxn := db.NewTransaction(false)
+	for ii := byte(1); ii <= 3; ii++ {
+		cache.Put(readTxn, profileKey(ii), value)
+	}
+	cache.Put(readTxn, _dbKeyForPostEntryHash(&BlockHash{1}), value)
+	readTxn.Discard()
+	require.Equal(3*entrySize, cache.NumBytes())
+	_, exists := cache.Get(_dbKeyForPostEntryHash(&BlockHash{1}))
+	require.False(exists)
+
+	// Caching a fourth entry evicts the least recently used one.
+	_, exists = cache.Get(profileKey(1))
+	require.True(exists)
+	readTxn = db.NewTransaction(false)
+	cache.Put(readTxn, profileKey(4), value)
+	readTxn.Discard()
+	require.Equal(3*entrySize, cache.NumBytes())
+	_, exists = cache.Get(profileKey(2))
+	require.False(exists)
+	for _, ii := range []byte{1, 3, 4} {
+		_, exists = cache.Get(profileKey(ii))
+		require.True(exists)
+	}
+
+	// A txn that reads before a flush can't cache its values, neither during the flush nor after it.
+	staleTxn := db.NewTransaction(false)
+	defer staleTxn.Discard()
+	cache.Invalidate(profileKey(1))
+	_, exists = cache.Get(profileKey(1))
+	require.False(exists)
+	cache.Put(staleTxn, profileKey(1), value)
+	_, exists = cache.Get(profileKey(1))
+	require.False(exists)
+	setValue(profileKey(1), []byte{1})
+	cache.EndFlush(db)
+	cache.Put(staleTxn, profileKey(1), value)
+	_, exists = cache.Get(profileKey(1))
+	require.False(exists)
+
+	// A txn that reads after the flush can.
+	readTxn = db.NewTransaction(false)
+	cache.Put(readTxn, profileKey(1), []byte{1})
+	readTxn.Discard()
+	cachedValue, exists := cache.Get(profileKey(1))
+	require.True(exists)
+	require.Equal([]byte{1}, cachedValue)
+
+	cache.Purge()
+	require.Zero(cache.NumBytes())
+	_, exists = cache.Get(profileKey(1))
+	require.False(exists)
+}
@@ -0,0 +1,545 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// State Change Cursors
+//
+// Consumers of the committed state change file can keep their place in it across node restarts and file rotation
+// with cursors. Every committed state change entry has an entry index, which counts the entries written since the
+// state change files were created or last reset. An entry's position is its entry index and the block height it
+// was encoded at.
+//
+// Files in the state change directory, in addition to the ones described in state_change_syncer.go:
+//   - state-changes-metadata.json: the StateChangeLogMetadata.
+//   - state-changes-height-index.bin: a list of <block height [8]byte, entry index [8]byte> records in
+//     little-endian, one for every run of entries encoded at the same height, so that replays can start from a
+//     height.
+//   - state-changes-<first entry index>.bin and state-changes-index-<first entry index>.bin: the segments that
+//     were rotated out of state-changes.bin and state-changes-index.bin once the file got larger than the
+//     --state-change-file-max-size-bytes. The offsets in a rotated index file are relative to its segment.
+//   - state-change-cursors/<name>.json: the StateChangeCursor of each registered consumer.
+//
+// Rotated segments are deleted once every registered cursor has moved past them, so a consumer doesn't miss
+// entries while it's down. If no cursor is registered, the segments are kept. Consumers read the files with a
+// StateChangeLogReader, which reports a StateChangeGap when the entries after a position are no longer there,
+// either because their segments were deleted or because the node reset the state change files.
+//
+// Only committed state changes are covered. The mempool state change file is reset whenever a block is
+// committed, so there's nothing to replay.
+
+const (
+	StateChangeLogMetadataFileName = "state-changes-metadata.json"
+	StateChangeHeightIndexFileName = "state-changes-height-index.bin"
+	StateChangeCursorsDirName      = "state-change-cursors"
+
+	stateChangeHeightIndexRecordSize = 16
+	stateChangeIndexRecordSize       = 8
+)
+
+// StateChangeLogMetadata describes the committed state change files as a whole.
+type StateChangeLogMetadata struct {
+	// Generation is incremented whenever the node resets the state change files, after which the entry indexes
+	// start over from zero.
+	Generation uint64
+	// ActiveFirstEntryIndex is the entry index of the first entry in state-changes.bin.
+	ActiveFirstEntryIndex uint64
+}
+
+// StateChangePosition is the position of a committed state change entry.
+type StateChangePosition struct {
+	BlockHeight uint64
+	EntryIndex  uint64
+}
+
+// StateChangeCursor is the place of a consumer in the committed state change files.
+type StateChangeCursor struct {
+	Name string
+	// Generation is the generation of the state change files the cursor's entry index refers to.
+	Generation uint64
+	// NextEntryIndex is the entry index of the first entry the consumer hasn't processed yet.
+	NextEntryIndex uint64
+	// LastBlockHeight is the block height of the last entry the consumer processed.
+	LastBlockHeight uint64
+}
+
+// StateChangeGap describes entries that a consumer asked for but that are no longer in the state change files.
+// The entries from FromEntryIndex up to, but not including, ToEntryIndex are missing. If IsReset is set, the node
+// reset the state change files since the consumer's position was recorded, and the consumer has to resync from
+// the start of the files.
+type StateChangeGap struct {
+	FromEntryIndex uint64
+	ToEntryIndex   uint64
+	IsReset        bool
+}
+
+// StateChangeRecord is a committed state change entry along with its position.
+type StateChangeRecord struct {
+	Position StateChangePosition
+	Entry    *StateChangeEntry
+}
+
+// StateChangeReadResult is the result of a read from the state change files. NextEntryIndex is the entry index
+// to read from next. Gap is set if the entries right before Records are missing.
+type StateChangeReadResult struct {
+	Records        []*StateChangeRecord
+	NextEntryIndex uint64
+	Gap            *StateChangeGap
+}
+
+type stateChangeHeightIndexRecord struct {
+	BlockHeight uint64
+	EntryIndex  uint64
+}
+
+// stateChangeSegment is a state change file along with its index file.
+type stateChangeSegment struct {
+	FirstEntryIndex uint64
+	NumEntries      uint64
+	FilePath        string
+	IndexFilePath   string
+}
+
+func stateChangeSegmentFileName(firstEntryIndex uint64) string {
+	return fmt.Sprintf("state-changes-%020d.bin", firstEntryIndex)
+}
+
+func stateChangeSegmentIndexFileName(firstEntryIndex uint64) string {
+	return fmt.Sprintf("state-changes-index-%020d.bin", firstEntryIndex)
+}
+
+// loadStateChangeLogMetadata reads the metadata in stateChangeDir, or returns empty metadata if there's none.
+func loadStateChangeLogMetadata(stateChangeDir string) (*StateChangeLogMetadata, error) {
+	metadata := &StateChangeLogMetadata{}
+	fileBytes, err := os.ReadFile(filepath.Join(stateChangeDir, StateChangeLogMetadataFileName))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "loadStateChangeLogMetadata: Problem reading metadata")
+	}
+	if err = json.Unmarshal(fileBytes, metadata); err != nil {
+		return nil, errors.Wrapf(err, "loadStateChangeLogMetadata: Problem decoding metadata")
+	}
+	return metadata, nil
+}
+
+func saveStateChangeLogMetadata(stateChangeDir string, metadata *StateChangeLogMetadata) error {
+	fileBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return errors.Wrapf(err, "saveStateChangeLogMetadata: Problem encoding metadata")
+	}
+	return writeFileAtomically(filepath.Join(stateChangeDir, StateChangeLogMetadataFileName), fileBytes)
+}
+
+// writeFileAtomically writes to a temporary file first so a crash mid-write can't corrupt the file.
+func writeFileAtomically(filePath string, fileBytes []byte) error {
+	tempFilePath := filePath + ".tmp"
+	if err := os.WriteFile(tempFilePath, fileBytes, 0644); err != nil {
+		return errors.Wrapf(err, "writeFileAtomically: Problem writing file %v", tempFilePath)
+	}
+	if err := os.Rename(tempFilePath, filePath); err != nil {
+		return errors.Wrapf(err, "writeFileAtomically: Problem renaming %v to %v", tempFilePath, filePath)
+	}
+	return nil
+}
+
+func countStateChangeIndexEntries(indexFilePath string) (uint64, error) {
+	fileInfo, err := os.Stat(indexFilePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "countStateChangeIndexEntries: Problem reading %v", indexFilePath)
+	}
+	return uint64(fileInfo.Size()) / stateChangeIndexRecordSize, nil
+}
+
+// listStateChangeSegments returns the rotated segments in stateChangeDir, followed by the active one, in order.
+func listStateChangeSegments(stateChangeDir string, metadata *StateChangeLogMetadata) ([]*stateChangeSegment, error) {
+	filePaths, err := filepath.Glob(filepath.Join(stateChangeDir, "state-changes-[0-9]*.bin"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "listStateChangeSegments: Problem listing segments")
+	}
+	var segments []*stateChangeSegment
+	for _, filePath := range filePaths {
+		var firstEntryIndex uint64
+		if _, err = fmt.Sscanf(filepath.Base(filePath), "state-changes-%d.bin", &firstEntryIndex); err != nil {
+			continue
+		}
+		segment := &stateChangeSegment{
+			FirstEntryIndex: firstEntryIndex,
+			FilePath:        filePath,
+			IndexFilePath:   filepath.Join(stateChangeDir, stateChangeSegmentIndexFileName(firstEntryIndex)),
+		}
+		if segment.NumEntries, err = countStateChangeIndexEntries(segment.IndexFilePath); err != nil {
+			return nil, errors.Wrapf(err, "listStateChangeSegments: ")
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(ii, jj int) bool {
+		return segments[ii].FirstEntryIndex < segments[jj].FirstEntryIndex
+	})
+
+	// The metadata is saved after a segment is rotated, so if the node crashed in between, the active file starts
+	// where the last rotated segment ends.
+	activeSegment := &stateChangeSegment{
+		FirstEntryIndex: metadata.ActiveFirstEntryIndex,
+		FilePath:        filepath.Join(stateChangeDir, StateChangeFileName),
+		IndexFilePath:   filepath.Join(stateChangeDir, StateChangeIndexFileName),
+	}
+	if len(segments) > 0 {
+		lastSegment := segments[len(segments)-1]
+		if lastSegment.FirstEntryIndex+lastSegment.NumEntries > activeSegment.FirstEntryIndex {
+			activeSegment.FirstEntryIndex = lastSegment.FirstEntryIndex + lastSegment.NumEntries
+		}
+	}
+	if activeSegment.NumEntries, err = countStateChangeIndexEntries(activeSegment.IndexFilePath); err != nil {
+		return nil, errors.Wrapf(err, "listStateChangeSegments: ")
+	}
+	return append(segments, activeSegment), nil
+}
+
+func encodeStateChangeHeightIndexRecord(record *stateChangeHeightIndexRecord) []byte {
+	recordBytes := make([]byte, stateChangeHeightIndexRecordSize)
+	binary.LittleEndian.PutUint64(recordBytes[:8], record.BlockHeight)
+	binary.LittleEndian.PutUint64(recordBytes[8:], record.EntryIndex)
+	return recordBytes
+}
+
+func loadStateChangeHeightIndex(stateChangeDir string) ([]*stateChangeHeightIndexRecord, error) {
+	fileBytes, err := os.ReadFile(filepath.Join(stateChangeDir, StateChangeHeightIndexFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "loadStateChangeHeightIndex: Problem reading height index")
+	}
+	var records []*stateChangeHeightIndexRecord
+	for ii := 0; ii+stateChangeHeightIndexRecordSize <= len(fileBytes); ii += stateChangeHeightIndexRecordSize {
+		records = append(records, &stateChangeHeightIndexRecord{
+			BlockHeight: binary.LittleEndian.Uint64(fileBytes[ii : ii+8]),
+			EntryIndex:  binary.LittleEndian.Uint64(fileBytes[ii+8 : ii+16]),
+		})
+	}
+	return records, nil
+}
+
+func getStateChangeCursorFilePath(stateChangeDir string, name string) string {
+	return filepath.Join(stateChangeDir, StateChangeCursorsDirName, name+".json")
+}
+
+func validateStateChangeCursorName(name string) error {
+	if name == "" || len(name) > 64 {
+		return fmt.Errorf("validateStateChangeCursorName: Name must be between 1 and 64 characters")
+	}
+	for _, char := range name {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' ||
+			char == '-' || char == '_') {
+			return fmt.Errorf("validateStateChangeCursorName: Name %v can only contain letters, digits, "+
+				"dashes, and underscores", name)
+		}
+	}
+	return nil
+}
+
+// loadStateChangeCursors returns the cursors registered in stateChangeDir.
+func loadStateChangeCursors(stateChangeDir string) ([]*StateChangeCursor, error) {
+	filePaths, err := filepath.Glob(filepath.Join(stateChangeDir, StateChangeCursorsDirName, "*.json"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "loadStateChangeCursors: Problem listing cursors")
+	}
+	var cursors []*StateChangeCursor
+	for _, filePath := range filePaths {
+		fileBytes, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loadStateChangeCursors: Problem reading %v", filePath)
+		}
+		cursor := &StateChangeCursor{}
+		if err = json.Unmarshal(fileBytes, cursor); err != nil {
+			return nil, errors.Wrapf(err, "loadStateChangeCursors: Problem decoding %v", filePath)
+		}
+		cursors = append(cursors, cursor)
+	}
+	return cursors, nil
+}
+
+// StateChangeLogReader reads the committed state change files in a state change directory, which may be written
+// to by a running node, and keeps track of the cursors of its consumers.
+type StateChangeLogReader struct {
+	stateChangeDir string
+}
+
+func NewStateChangeLogReader(stateChangeDir string) *StateChangeLogReader {
+	return &StateChangeLogReader{stateChangeDir: stateChangeDir}
+}
+
+// RegisterCursor returns the cursor with the given name, creating it at the start of the state change files if it
+// doesn't exist. The node keeps the entries the cursor hasn't moved past until it's deleted.
+func (reader *StateChangeLogReader) RegisterCursor(name string) (*StateChangeCursor, error) {
+	cursor, err := reader.GetCursor(name)
+	if err != nil || cursor != nil {
+		return cursor, err
+	}
+	metadata, err := loadStateChangeLogMetadata(reader.stateChangeDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.RegisterCursor: ")
+	}
+	cursor = &StateChangeCursor{Name: name, Generation: metadata.Generation}
+	if err = reader.saveCursor(cursor); err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.RegisterCursor: ")
+	}
+	return cursor, nil
+}
+
+// GetCursor returns the cursor with the given name, or nil if it isn't registered.
+func (reader *StateChangeLogReader) GetCursor(name string) (*StateChangeCursor, error) {
+	if err := validateStateChangeCursorName(name); err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.GetCursor: ")
+	}
+	fileBytes, err := os.ReadFile(getStateChangeCursorFilePath(reader.stateChangeDir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.GetCursor: Problem reading cursor %v", name)
+	}
+	cursor := &StateChangeCursor{}
+	if err = json.Unmarshal(fileBytes, cursor); err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.GetCursor: Problem decoding cursor %v", name)
+	}
+	return cursor, nil
+}
+
+// DeleteCursor deletes the cursor with the given name, so that the node no longer keeps entries for it.
+func (reader *StateChangeLogReader) DeleteCursor(name string) error {
+	if err := validateStateChangeCursorName(name); err != nil {
+		return errors.Wrapf(err, "StateChangeLogReader.DeleteCursor: ")
+	}
+	err := os.Remove(getStateChangeCursorFilePath(reader.stateChangeDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "StateChangeLogReader.DeleteCursor: Problem deleting cursor %v", name)
+	}
+	return nil
+}
+
+func (reader *StateChangeLogReader) saveCursor(cursor *StateChangeCursor) error {
+	if err := os.MkdirAll(filepath.Join(reader.stateChangeDir, StateChangeCursorsDirName), 0755); err != nil {
+		return errors.Wrapf(err, "StateChangeLogReader.saveCursor: Problem creating cursors directory")
+	}
+	fileBytes, err := json.Marshal(cursor)
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeLogReader.saveCursor: Problem encoding cursor")
+	}
+	return writeFileAtomically(getStateChangeCursorFilePath(reader.stateChangeDir, cursor.Name), fileBytes)
+}
+
+// AckCursor moves the cursor with the given name past the entry at position, once the consumer has processed it.
+func (reader *StateChangeLogReader) AckCursor(name string, position StateChangePosition) error {
+	cursor, err := reader.GetCursor(name)
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeLogReader.AckCursor: ")
+	}
+	if cursor == nil {
+		return fmt.Errorf("StateChangeLogReader.AckCursor: Cursor %v isn't registered", name)
+	}
+	metadata, err := loadStateChangeLogMetadata(reader.stateChangeDir)
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeLogReader.AckCursor: ")
+	}
+	if err = reader.checkPosition(metadata, position); err != nil {
+		return errors.Wrapf(err, "StateChangeLogReader.AckCursor: ")
+	}
+	cursor.Generation = metadata.Generation
+	cursor.NextEntryIndex = position.EntryIndex + 1
+	cursor.LastBlockHeight = position.BlockHeight
+	return reader.saveCursor(cursor)
+}
+
+// ReadFromCursor returns up to maxEntries entries from where the cursor with the given name is. It doesn't move
+// the cursor, which is done with AckCursor.
+func (reader *StateChangeLogReader) ReadFromCursor(name string, maxEntries uint64) (*StateChangeReadResult, error) {
+	cursor, err := reader.GetCursor(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.ReadFromCursor: ")
+	}
+	if cursor == nil {
+		return nil, fmt.Errorf("StateChangeLogReader.ReadFromCursor: Cursor %v isn't registered", name)
+	}
+	metadata, err := loadStateChangeLogMetadata(reader.stateChangeDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.ReadFromCursor: ")
+	}
+	if cursor.Generation != metadata.Generation {
+		return reader.readEntries(metadata, 0, maxEntries, &StateChangeGap{IsReset: true})
+	}
+	return reader.readEntries(metadata, cursor.NextEntryIndex, maxEntries, nil)
+}
+
+// ReplaySince returns up to maxEntries entries that come after position. If position is nil, the entries are
+// returned from the start of the state change files. It fails if the entry at position isn't encoded at the
+// position's block height, which means the state change files were reset and the consumer has to resync.
+func (reader *StateChangeLogReader) ReplaySince(position *StateChangePosition, maxEntries uint64) (
+	*StateChangeReadResult, error) {
+	metadata, err := loadStateChangeLogMetadata(reader.stateChangeDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.ReplaySince: ")
+	}
+	if position == nil {
+		return reader.readEntries(metadata, 0, maxEntries, nil)
+	}
+	if err = reader.checkPosition(metadata, *position); err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.ReplaySince: ")
+	}
+	return reader.readEntries(metadata, position.EntryIndex+1, maxEntries, nil)
+}
+
+// ReplaySinceHeight returns up to maxEntries entries, starting with the first entry encoded at a height of at
+// least blockHeight.
+func (reader *StateChangeLogReader) ReplaySinceHeight(blockHeight uint64, maxEntries uint64) (
+	*StateChangeReadResult, error) {
+	metadata, err := loadStateChangeLogMetadata(reader.stateChangeDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.ReplaySinceHeight: ")
+	}
+	heightIndex, err := loadStateChangeHeightIndex(reader.stateChangeDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.ReplaySinceHeight: ")
+	}
+	// Heights can go down after a reorg, so use the first run of entries at or above the height that isn't
+	// followed by a run below it.
+	startEntryIndex := uint64(0)
+	isStartFound := false
+	for _, record := range heightIndex {
+		if record.BlockHeight < blockHeight {
+			isStartFound = false
+		} else if !isStartFound {
+			startEntryIndex = record.EntryIndex
+			isStartFound = true
+		}
+	}
+	if !isStartFound {
+		segments, err := listStateChangeSegments(reader.stateChangeDir, metadata)
+		if err != nil {
+			return nil, errors.Wrapf(err, "StateChangeLogReader.ReplaySinceHeight: ")
+		}
+		activeSegment := segments[len(segments)-1]
+		startEntryIndex = activeSegment.FirstEntryIndex + activeSegment.NumEntries
+	}
+	return reader.readEntries(metadata, startEntryIndex, maxEntries, nil)
+}
+
+// checkPosition checks that the entry at position is in the state change files and is encoded at the position's
+// block height.
+func (reader *StateChangeLogReader) checkPosition(metadata *StateChangeLogMetadata, position StateChangePosition) error {
+	result, err := reader.readEntries(metadata, position.EntryIndex, 1, nil)
+	if err != nil {
+		return err
+	}
+	if result.Gap != nil {
+		return fmt.Errorf("the entry at index %v is no longer in the state change files", position.EntryIndex)
+	}
+	if len(result.Records) == 0 {
+		return fmt.Errorf("there's no entry at index %v in the state change files", position.EntryIndex)
+	}
+	if result.Records[0].Position.BlockHeight != position.BlockHeight {
+		return fmt.Errorf("the entry at index %v is at block height %v rather than %v, so the state change files "+
+			"were reset", position.EntryIndex, result.Records[0].Position.BlockHeight, position.BlockHeight)
+	}
+	return nil
+}
+
+// readEntries returns up to maxEntries entries starting at startEntryIndex, or at the first entry that's still in
+// the state change files if it's greater, in which case the gap is reported. A gap that's passed in is reported
+// as is.
+func (reader *StateChangeLogReader) readEntries(metadata *StateChangeLogMetadata, startEntryIndex uint64,
+	maxEntries uint64, gap *StateChangeGap) (*StateChangeReadResult, error) {
+	segments, err := listStateChangeSegments(reader.stateChangeDir, metadata)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeLogReader.readEntries: ")
+	}
+	if firstEntryIndex := segments[0].FirstEntryIndex; startEntryIndex < firstEntryIndex {
+		if gap == nil {
+			gap = &StateChangeGap{FromEntryIndex: startEntryIndex}
+		}
+		gap.ToEntryIndex = firstEntryIndex
+		startEntryIndex = firstEntryIndex
+	} else if gap != nil {
+		gap.ToEntryIndex = startEntryIndex
+	}
+
+	result := &StateChangeReadResult{NextEntryIndex: startEntryIndex, Gap: gap}
+	for _, segment := range segments {
+		if uint64(len(result.Records)) >= maxEntries {
+			break
+		}
+		if result.NextEntryIndex >= segment.FirstEntryIndex+segment.NumEntries {
+			continue
+		}
+		records, err := readStateChangeSegmentEntries(segment, result.NextEntryIndex,
+			maxEntries-uint64(len(result.Records)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "StateChangeLogReader.readEntries: ")
+		}
+		result.Records = append(result.Records, records...)
+		result.NextEntryIndex += uint64(len(records))
+	}
+	return result, nil
+}
+
+// readStateChangeSegmentEntries returns up to maxEntries entries of the segment, starting at startEntryIndex.
+func readStateChangeSegmentEntries(segment *stateChangeSegment, startEntryIndex uint64, maxEntries uint64) (
+	[]*StateChangeRecord, error) {
+	numEntries := segment.FirstEntryIndex + segment.NumEntries - startEntryIndex
+	if numEntries > maxEntries {
+		numEntries = maxEntries
+	}
+
+	// Look up where the first entry starts. The entries that follow it are right after it in the file.
+	indexFile, err := os.Open(segment.IndexFilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "readStateChangeSegmentEntries: Problem opening %v", segment.IndexFilePath)
+	}
+	defer indexFile.Close()
+	offsetBytes := make([]byte, stateChangeIndexRecordSize)
+	_, err = indexFile.ReadAt(offsetBytes, int64((startEntryIndex-segment.FirstEntryIndex)*stateChangeIndexRecordSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "readStateChangeSegmentEntries: Problem reading %v", segment.IndexFilePath)
+	}
+
+	file, err := os.Open(segment.FilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "readStateChangeSegmentEntries: Problem opening %v", segment.FilePath)
+	}
+	defer file.Close()
+	fileReader := bufio.NewReader(io.NewSectionReader(file, int64(binary.LittleEndian.Uint64(offsetBytes)), 1<<62))
+	var records []*StateChangeRecord
+	for ii := uint64(0); ii < numEntries; ii++ {
+		entryBytes, err := DecodeByteArray(fileReader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "readStateChangeSegmentEntries: Problem reading entry %v",
+				startEntryIndex+ii)
+		}
+		entry := &StateChangeEntry{}
+		if _, err = DecodeFromBytes(entry, bytes.NewReader(entryBytes)); err != nil {
+			return nil, errors.Wrapf(err, "readStateChangeSegmentEntries: Problem decoding entry %v",
+				startEntryIndex+ii)
+		}
+		records = append(records, &StateChangeRecord{
+			Position: StateChangePosition{BlockHeight: entry.BlockHeight, EntryIndex: startEntryIndex + ii},
+			Entry:    entry,
+		})
+	}
+	return records, nil
+}
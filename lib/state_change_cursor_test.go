@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateChangeCursors(t *testing.T) {
+	require := require.New(t)
+
+	stateChangeDir := t.TempDir()
+	reader := NewStateChangeLogReader(stateChangeDir)
+
+	// Rotate the state change file after every flush.
+	newStateChangeSyncer := func() *StateChangeSyncer {
+		stateChangeSyncer := NewStateChangeSyncer(stateChangeDir, NodeSyncTypeBlockSync, 10000, 1)
+		t.Cleanup(func() {
+			stateChangeSyncer.StateChangeFile.Close()
+			stateChangeSyncer.StateChangeIndexFile.Close()
+			stateChangeSyncer.StateChangeMempoolFile.Close()
+			stateChangeSyncer.StateChangeMempoolIndexFile.Close()
+			stateChangeSyncer.StateChangeHeightIndexFile.Close()
+		})
+		return stateChangeSyncer
+	}
+	// Flush two committed entries at the given height.
+	flushEntries := func(stateChangeSyncer *StateChangeSyncer, blockHeight uint64) {
+		flushId := uuid.New()
+		for ii := 0; ii < 2; ii++ {
+			postEntry := &PostEntry{PostHash: NewBlockHash(RandomBytes(HashSizeBytes)), Body: []byte("test")}
+			stateChangeEntry := &StateChangeEntry{
+				OperationType: DbOperationTypeUpsert,
+				KeyBytes:      postEntry.PostHash.ToBytes(),
+				Encoder:       postEntry,
+				EncoderType:   postEntry.GetEncoderType(),
+				FlushId:       flushId,
+				BlockHeight:   blockHeight,
+			}
+			writeBytes := EncodeByteArray(EncodeToBytes(blockHeight, stateChangeEntry, false))
+			stateChangeSyncer.addTransactionToQueue(flushId, writeBytes, blockHeight, false)
+		}
+		require.NoError(stateChangeSyncer.FlushTransactionsToFile(&StateSyncerFlushedEvent{
+			FlushId: flushId, Succeeded: true}))
+	}
+	requirePositions := func(result *StateChangeReadResult, expectedPositions []StateChangePosition) {
+		var positions []StateChangePosition
+		for _, record := range result.Records {
+			positions = append(positions, record.Position)
+		}
+		require.Equal(expectedPositions, positions)
+	}
+
+	// Write entries 0 through 5 at heights 1 through 3. With no cursors registered, every segment is kept.
+	stateChangeSyncer := newStateChangeSyncer()
+	for blockHeight := uint64(1); blockHeight <= 3; blockHeight++ {
+		flushEntries(stateChangeSyncer, blockHeight)
+	}
+	require.Equal(uint64(6), stateChangeSyncer.StateChangeLogMetadata.ActiveFirstEntryIndex)
+	result, err := reader.ReplaySince(nil, 100)
+	require.NoError(err)
+	require.Nil(result.Gap)
+	require.Equal(uint64(6), result.NextEntryIndex)
+	requirePositions(result, []StateChangePosition{{1, 0}, {1, 1}, {2, 2}, {2, 3}, {3, 4}, {3, 5}})
+
+	// Replays can start after a position or at a height, across segments.
+	result, err = reader.ReplaySince(&StateChangePosition{BlockHeight: 1, EntryIndex: 1}, 2)
+	require.NoError(err)
+	requirePositions(result, []StateChangePosition{{2, 2}, {2, 3}})
+	_, err = reader.ReplaySince(&StateChangePosition{BlockHeight: 2, EntryIndex: 1}, 2)
+	require.Error(err)
+	result, err = reader.ReplaySinceHeight(2, 3)
+	require.NoError(err)
+	requirePositions(result, []StateChangePosition{{2, 2}, {2, 3}, {3, 4}})
+	result, err = reader.ReplaySinceHeight(4, 3)
+	require.NoError(err)
+	require.Empty(result.Records)
+	require.Equal(uint64(6), result.NextEntryIndex)
+
+	// A cursor starts at the first entry, and moves when the consumer acks an entry.
+	_, err = reader.RegisterCursor("consumer/1")
+	require.Error(err)
+	cursor, err := reader.RegisterCursor("consumer")
+	require.NoError(err)
+	require.Equal(uint64(0), cursor.NextEntryIndex)
+	result, err = reader.ReadFromCursor("consumer", 4)
+	require.NoError(err)
+	requirePositions(result, []StateChangePosition{{1, 0}, {1, 1}, {2, 2}, {2, 3}})
+	require.Error(reader.AckCursor("consumer", StateChangePosition{BlockHeight: 3, EntryIndex: 3}))
+	require.NoError(reader.AckCursor("consumer", StateChangePosition{BlockHeight: 2, EntryIndex: 3}))
+	cursor, err = reader.GetCursor("consumer")
+	require.NoError(err)
+	require.Equal(&StateChangeCursor{Name: "consumer", NextEntryIndex: 4, LastBlockHeight: 2}, cursor)
+
+	// After a restart, the entry indexes carry on, and the segments the cursor has moved past are deleted on the
+	// next rotation.
+	stateChangeSyncer = newStateChangeSyncer()
+	require.Equal(uint64(6), stateChangeSyncer.StateChangeEntryCount)
+	flushEntries(stateChangeSyncer, 4)
+	result, err = reader.ReadFromCursor("consumer", 100)
+	require.NoError(err)
+	require.Nil(result.Gap)
+	requirePositions(result, []StateChangePosition{{3, 4}, {3, 5}, {4, 6}, {4, 7}})
+
+	// Consumers that ask for the deleted entries are told about the gap.
+	result, err = reader.ReplaySince(nil, 1)
+	require.NoError(err)
+	require.Equal(&StateChangeGap{FromEntryIndex: 0, ToEntryIndex: 4}, result.Gap)
+	requirePositions(result, []StateChangePosition{{3, 4}})
+	_, err = reader.ReplaySince(&StateChangePosition{BlockHeight: 1, EntryIndex: 1}, 1)
+	require.Error(err)
+	_, err = reader.RegisterCursor("late-consumer")
+	require.NoError(err)
+	result, err = reader.ReadFromCursor("late-consumer", 100)
+	require.NoError(err)
+	require.Equal(&StateChangeGap{FromEntryIndex: 0, ToEntryIndex: 4}, result.Gap)
+	require.Len(result.Records, 4)
+	require.NoError(reader.DeleteCursor("late-consumer"))
+
+	// Once the node resets the state change files, cursors from before the reset start over with a gap.
+	stateChangeSyncer.Reset()
+	flushEntries(stateChangeSyncer, 5)
+	result, err = reader.ReadFromCursor("consumer", 100)
+	require.NoError(err)
+	require.Equal(&StateChangeGap{IsReset: true}, result.Gap)
+	requirePositions(result, []StateChangePosition{{5, 0}, {5, 1}})
+	_, err = reader.ReplaySince(&StateChangePosition{BlockHeight: 3, EntryIndex: 1}, 1)
+	require.Error(err)
+	require.NoError(reader.AckCursor("consumer", StateChangePosition{BlockHeight: 5, EntryIndex: 1}))
+	result, err = reader.ReadFromCursor("consumer", 100)
+	require.NoError(err)
+	require.Nil(result.Gap)
+	require.Empty(result.Records)
+	require.Equal(uint64(2), result.NextEntryIndex)
+}
@@ -227,6 +227,8 @@ type UnflushedStateSyncerBytes struct {
 	StateChangeBytes []byte
 	// This is a list of the indexes of the state change bytes that should be written to the state change index file.
 	StateChangeOperationIndexes []uint64
+	// The block height of each state change entry, which is used to build the state change height index.
+	StateChangeBlockHeights []uint64
 }
 
 // StateChangeSyncer is used to keep track of the state changes that should be written to the state change file.
@@ -294,6 +296,19 @@ type StateChangeSyncer struct {
 	BlocksyncCompleteEntriesFlushed bool
 
 	MempoolTxnSyncLimit uint64
+
+	// The directory the state change files are in.
+	StateChangeDir string
+	// The size at which the committed state change file is rotated, or zero to never rotate it. See
+	// state_change_cursor.go.
+	StateChangeFileMaxSizeBytes uint64
+	StateChangeLogMetadata      *StateChangeLogMetadata
+	// The number of committed state change entries, which is also the entry index of the next one.
+	StateChangeEntryCount uint64
+	// The height index file, along with the height of its last record.
+	StateChangeHeightIndexFile *os.File
+	lastHeightIndexBlockHeight uint64
+	isHeightIndexEmpty         bool
 }
 
 // Open a file, create if it doesn't exist.
@@ -312,7 +327,7 @@ func openOrCreateLogFile(filePath string) (*os.File, error) {
 
 // NewStateChangeSyncer initializes necessary log files and returns a StateChangeSyncer.
 func NewStateChangeSyncer(stateChangeDir string, nodeSyncType NodeSyncType, mempoolTxnSyncLimit uint64,
-) *StateChangeSyncer {
+	stateChangeFileMaxSizeBytes uint64) *StateChangeSyncer {
 	stateChangeFilePath := filepath.Join(stateChangeDir, StateChangeFileName)
 	stateChangeIndexFilePath := filepath.Join(stateChangeDir, StateChangeIndexFileName)
 	stateChangeMempoolFilePath := filepath.Join(stateChangeDir, StateChangeMempoolFileName)
@@ -342,10 +357,34 @@ func NewStateChangeSyncer(stateChangeDir string, nodeSyncType NodeSyncType, memp
 	if err != nil {
 		glog.Fatalf("Error getting stateChangeMempoolFileInfo: %v", err)
 	}
+	stateChangeLogMetadata, err := loadStateChangeLogMetadata(stateChangeDir)
+	if err != nil {
+		glog.Fatalf("Error loading stateChangeLogMetadata: %v", err)
+	}
+	stateChangeSegments, err := listStateChangeSegments(stateChangeDir, stateChangeLogMetadata)
+	if err != nil {
+		glog.Fatalf("Error listing state change segments: %v", err)
+	}
+	activeSegment := stateChangeSegments[len(stateChangeSegments)-1]
+	stateChangeLogMetadata.ActiveFirstEntryIndex = activeSegment.FirstEntryIndex
+	stateChangeHeightIndex, err := loadStateChangeHeightIndex(stateChangeDir)
+	if err != nil {
+		glog.Fatalf("Error loading stateChangeHeightIndex: %v", err)
+	}
+	stateChangeHeightIndexFile, err := openOrCreateLogFile(filepath.Join(stateChangeDir, StateChangeHeightIndexFileName))
+	if err != nil {
+		glog.Fatalf("Error opening stateChangeHeightIndexFile: %v", err)
+	}
+	lastHeightIndexBlockHeight := uint64(0)
+	if len(stateChangeHeightIndex) > 0 {
+		lastHeightIndexBlockHeight = stateChangeHeightIndex[len(stateChangeHeightIndex)-1].BlockHeight
+	}
 
-	// Check if the state change file is empty. If not, BlocksyncCompleteEntriesFlushed should be true.
+	// Check if any state change entries were written. If so, BlocksyncCompleteEntriesFlushed should be true. The
+	// state change file can be empty if it was just rotated.
+	stateChangeEntryCount := activeSegment.FirstEntryIndex + activeSegment.NumEntries
 	blocksyncCompleteEntriesFlushed := false
-	if stateChangeFileInfo.Size() > 0 {
+	if stateChangeFileInfo.Size() > 0 || stateChangeEntryCount > 0 {
 		blocksyncCompleteEntriesFlushed = true
 	}
 
@@ -366,10 +405,19 @@ func NewStateChangeSyncer(stateChangeDir string, nodeSyncType NodeSyncType, memp
 		SyncType:                        nodeSyncType,
 		BlocksyncCompleteEntriesFlushed: blocksyncCompleteEntriesFlushed,
 		MempoolTxnSyncLimit:             mempoolTxnSyncLimit,
+		StateChangeDir:                  stateChangeDir,
+		StateChangeFileMaxSizeBytes:     stateChangeFileMaxSizeBytes,
+		StateChangeLogMetadata:          stateChangeLogMetadata,
+		StateChangeEntryCount:           stateChangeEntryCount,
+		StateChangeHeightIndexFile:      stateChangeHeightIndexFile,
+		lastHeightIndexBlockHeight:      lastHeightIndexBlockHeight,
+		isHeightIndexEmpty:              len(stateChangeHeightIndex) == 0,
 	}
 }
 
-// Reset resets the state change syncer by truncating the state change file and index file.
+// Reset resets the state change syncer by truncating the state change file and index file. The rotated segments and
+// the height index are deleted too, and the generation of the state change files is incremented so that consumers
+// know to resync.
 func (stateChangeSyncer *StateChangeSyncer) Reset() {
 	err := stateChangeSyncer.StateChangeFile.Truncate(0)
 	if err != nil {
@@ -382,6 +430,28 @@ func (stateChangeSyncer *StateChangeSyncer) Reset() {
 	}
 
 	stateChangeSyncer.StateChangeFileSize = 0
+
+	err = stateChangeSyncer.StateChangeHeightIndexFile.Truncate(0)
+	if err != nil {
+		glog.Fatalf("Error truncating stateChangeHeightIndexFile: %v", err)
+	}
+	stateChangeSyncer.isHeightIndexEmpty = true
+	stateChangeSyncer.StateChangeEntryCount = 0
+	segments, err := listStateChangeSegments(stateChangeSyncer.StateChangeDir, stateChangeSyncer.StateChangeLogMetadata)
+	if err != nil {
+		glog.Fatalf("Error listing state change segments: %v", err)
+	}
+	for _, segment := range segments[:len(segments)-1] {
+		if err = deleteStateChangeSegment(segment); err != nil {
+			glog.Fatalf("Error deleting state change segment: %v", err)
+		}
+	}
+	stateChangeSyncer.StateChangeLogMetadata.Generation++
+	stateChangeSyncer.StateChangeLogMetadata.ActiveFirstEntryIndex = 0
+	err = saveStateChangeLogMetadata(stateChangeSyncer.StateChangeDir, stateChangeSyncer.StateChangeLogMetadata)
+	if err != nil {
+		glog.Fatalf("Error saving stateChangeLogMetadata: %v", err)
+	}
 }
 
 // handleDbTransactionConnected is called when a badger db operation takes place.
@@ -500,7 +570,8 @@ func (stateChangeSyncer *StateChangeSyncer) _handleStateSyncerOperation(event *S
 	writeBytes := EncodeByteArray(entryBytes)
 
 	// Add the StateChangeEntry bytes to the queue of bytes to be written to the state change file upon Badger db flush.
-	stateChangeSyncer.addTransactionToQueue(stateChangeEntry.FlushId, writeBytes, event.IsMempoolTxn)
+	stateChangeSyncer.addTransactionToQueue(
+		stateChangeEntry.FlushId, writeBytes, stateChangeEntry.BlockHeight, event.IsMempoolTxn)
 }
 
 // _handleStateSyncerFlush is called when a Badger db flush takes place. It calls a helper function that takes the bytes that
@@ -564,7 +635,7 @@ func (stateChangeSyncer *StateChangeSyncer) _handleStateSyncerFlush(event *State
 					glog.V(2).Infof("Reverting entry %d\n", cachedSCE.EncoderType)
 
 					// Add the StateChangeEntry bytes to the queue of bytes to be written to the state change file upon Badger db flush.
-					stateChangeSyncer.addTransactionToQueue(cachedSCE.FlushId, writeBytes, true)
+					stateChangeSyncer.addTransactionToQueue(cachedSCE.FlushId, writeBytes, cachedSCE.BlockHeight, true)
 
 					// Remove this entry from the synced map
 					delete(stateChangeSyncer.MempoolSyncedKeyValueMap, key)
@@ -607,7 +678,8 @@ func (stateChangeSyncer *StateChangeSyncer) ResetMempool() {
 }
 
 // Add a transaction to the queue of transactions to be flushed to disk upon badger db flush.
-func (stateChangeSyncer *StateChangeSyncer) addTransactionToQueue(flushId uuid.UUID, writeBytes []byte, isMempool bool) {
+func (stateChangeSyncer *StateChangeSyncer) addTransactionToQueue(flushId uuid.UUID, writeBytes []byte,
+	blockHeight uint64, isMempool bool) {
 
 	var unflushedBytes UnflushedStateSyncerBytes
 	var exists bool
@@ -622,12 +694,14 @@ func (stateChangeSyncer *StateChangeSyncer) addTransactionToQueue(flushId uuid.U
 		unflushedBytes = UnflushedStateSyncerBytes{
 			StateChangeBytes:            []byte{},
 			StateChangeOperationIndexes: []uint64{},
+			StateChangeBlockHeights:     []uint64{},
 		}
 	}
 	// Get the byte index of where this transaction occurs in the unflushed bytes, and add it to the list of
 	// indexes that should be written to the index file.
 	dbOperationIndex := uint64(len(unflushedBytes.StateChangeBytes))
 	unflushedBytes.StateChangeOperationIndexes = append(unflushedBytes.StateChangeOperationIndexes, dbOperationIndex)
+	unflushedBytes.StateChangeBlockHeights = append(unflushedBytes.StateChangeBlockHeights, blockHeight)
 
 	unflushedBytes.StateChangeBytes = append(unflushedBytes.StateChangeBytes, writeBytes...)
 
@@ -755,6 +829,127 @@ func (stateChangeSyncer *StateChangeSyncer) FlushTransactionsToFile(event *State
 		delete(stateChangeSyncer.UnflushedCommittedBytes, flushId)
 	}
 
+	if !event.IsMempoolFlush {
+		if err = stateChangeSyncer.addHeightIndexRecords(unflushedBytes.StateChangeBlockHeights); err != nil {
+			return errors.Wrapf(err, "Error writing to state change height index file: ")
+		}
+		if err = stateChangeSyncer.maybeRotateStateChangeFile(); err != nil {
+			return errors.Wrapf(err, "Error rotating state change file: ")
+		}
+	}
+	return nil
+}
+
+// addHeightIndexRecords accounts for the committed entries that were just written at the given block heights, and
+// adds a record to the height index file wherever the height changes.
+func (stateChangeSyncer *StateChangeSyncer) addHeightIndexRecords(blockHeights []uint64) error {
+	var heightIndexBuf []byte
+	for _, blockHeight := range blockHeights {
+		entryIndex := stateChangeSyncer.StateChangeEntryCount
+		stateChangeSyncer.StateChangeEntryCount++
+		if !stateChangeSyncer.isHeightIndexEmpty && stateChangeSyncer.lastHeightIndexBlockHeight == blockHeight {
+			continue
+		}
+		heightIndexBuf = append(heightIndexBuf, encodeStateChangeHeightIndexRecord(
+			&stateChangeHeightIndexRecord{BlockHeight: blockHeight, EntryIndex: entryIndex})...)
+		stateChangeSyncer.lastHeightIndexBlockHeight = blockHeight
+		stateChangeSyncer.isHeightIndexEmpty = false
+	}
+	if len(heightIndexBuf) == 0 {
+		return nil
+	}
+	_, err := stateChangeSyncer.StateChangeHeightIndexFile.Write(heightIndexBuf)
+	return err
+}
+
+// maybeRotateStateChangeFile moves the committed state change file and its index file to a segment once the file
+// is larger than the max size, and starts new ones. It then deletes the segments that every registered cursor has
+// moved past.
+func (stateChangeSyncer *StateChangeSyncer) maybeRotateStateChangeFile() error {
+	if stateChangeSyncer.StateChangeFileMaxSizeBytes == 0 ||
+		stateChangeSyncer.StateChangeFileSize < stateChangeSyncer.StateChangeFileMaxSizeBytes {
+		return nil
+	}
+	stateChangeDir := stateChangeSyncer.StateChangeDir
+	firstEntryIndex := stateChangeSyncer.StateChangeLogMetadata.ActiveFirstEntryIndex
+	if err := stateChangeSyncer.StateChangeFile.Close(); err != nil {
+		return err
+	}
+	if err := stateChangeSyncer.StateChangeIndexFile.Close(); err != nil {
+		return err
+	}
+	// The index file is moved first, since a segment is only listed once its state change file is there.
+	err := os.Rename(filepath.Join(stateChangeDir, StateChangeIndexFileName),
+		filepath.Join(stateChangeDir, stateChangeSegmentIndexFileName(firstEntryIndex)))
+	if err != nil {
+		return err
+	}
+	err = os.Rename(filepath.Join(stateChangeDir, StateChangeFileName),
+		filepath.Join(stateChangeDir, stateChangeSegmentFileName(firstEntryIndex)))
+	if err != nil {
+		return err
+	}
+	stateChangeSyncer.StateChangeLogMetadata.ActiveFirstEntryIndex = stateChangeSyncer.StateChangeEntryCount
+	if err = saveStateChangeLogMetadata(stateChangeDir, stateChangeSyncer.StateChangeLogMetadata); err != nil {
+		return err
+	}
+	if stateChangeSyncer.StateChangeFile, err = openOrCreateLogFile(
+		filepath.Join(stateChangeDir, StateChangeFileName)); err != nil {
+		return err
+	}
+	if stateChangeSyncer.StateChangeIndexFile, err = openOrCreateLogFile(
+		filepath.Join(stateChangeDir, StateChangeIndexFileName)); err != nil {
+		return err
+	}
+	stateChangeSyncer.StateChangeFileSize = 0
+	glog.V(1).Infof("StateChangeSyncer: Rotated state change file starting at entry %v", firstEntryIndex)
+	return stateChangeSyncer.pruneStateChangeSegments()
+}
+
+// pruneStateChangeSegments deletes the rotated segments that every registered cursor has moved past. Cursors of an
+// older generation have to resync from the first entry, so they hold on to every segment. If no cursor is
+// registered, the segments are kept.
+func (stateChangeSyncer *StateChangeSyncer) pruneStateChangeSegments() error {
+	cursors, err := loadStateChangeCursors(stateChangeSyncer.StateChangeDir)
+	if err != nil {
+		return err
+	}
+	if len(cursors) == 0 {
+		return nil
+	}
+	minNextEntryIndex := stateChangeSyncer.StateChangeEntryCount
+	for _, cursor := range cursors {
+		if cursor.Generation != stateChangeSyncer.StateChangeLogMetadata.Generation {
+			return nil
+		}
+		if cursor.NextEntryIndex < minNextEntryIndex {
+			minNextEntryIndex = cursor.NextEntryIndex
+		}
+	}
+	segments, err := listStateChangeSegments(stateChangeSyncer.StateChangeDir, stateChangeSyncer.StateChangeLogMetadata)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments[:len(segments)-1] {
+		if segment.FirstEntryIndex+segment.NumEntries > minNextEntryIndex {
+			break
+		}
+		if err = deleteStateChangeSegment(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteStateChangeSegment deletes a rotated segment. The state change file is deleted first, since a segment is
+// only listed while its state change file is there.
+func deleteStateChangeSegment(segment *stateChangeSegment) error {
+	if err := os.Remove(segment.FilePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(segment.IndexFilePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
@@ -1043,7 +1238,11 @@ func (stateChangeSyncer *StateChangeSyncer) StartMempoolSyncRoutine(server *Serv
 }
 
 func (stateChangeSyncer *StateChangeSyncer) FlushAllEntriesToFile(server *Server) error {
-	// Check if the state change file already exists and is not empty. If so, return.
+	// Check if the state change file already exists and is not empty. If so, return. The state change file can be
+	// empty if it was just rotated, so check the entry count too.
+	if stateChangeSyncer.StateChangeEntryCount > 0 {
+		return nil
+	}
 	stateChangeFileInfo, err := stateChangeSyncer.StateChangeFile.Stat()
 	if err == nil {
 		// If the file is non-empty, no need to flush entries to file.
@@ -0,0 +1,634 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// This file implements the optional state commitment, an authenticated commitment to the state prefixes that is
+// updated incrementally every time a UtxoView is flushed, and that produces a state root for every block. Unlike
+// the state checksum, which is a single EllipticSum over the entire state that can only be compared as a whole, the
+// state commitment is a Merkle trie, so:
+//   - Two nodes whose state roots differ at some block know that they diverged at that block, rather than at some
+//     point before the next snapshot epoch.
+//   - A node can prove the value of any state key, or its absence, against the state root of a block. This is what
+//     light clients need to verify state without syncing it.
+//
+// The trie is a binary sparse Merkle trie over sha256(key), with one leaf per state key:
+//   - A leaf commits to the keyHash and to sha256(value). Its hash is sha256(0x00 || keyHash || valueHash).
+//   - An internal node has two children, selected by the bit of the keyHash at the node's depth, most significant
+//     bit first. Its hash is sha256(0x01 || leftHash || rightHash).
+//   - An empty subtree has the ZeroBlockHash.
+//   - A leaf is stored at the shallowest depth at which it is the only leaf in its subtree. This makes the trie
+//     canonical: the root only depends on the set of key-values, not on the order in which they were written.
+//
+// Trie nodes are stored content-addressed under PrefixStateCommitmentNode, and the root is stored under
+// PrefixStateCommitmentRoot and, for every block that's flushed, under PrefixStateCommitmentRootByBlockHash.
+// Replaced nodes are never deleted, so proofs can be generated against the state root of any past block.
+//
+// The state commitment hooks into the snapshot: DBSetWithTxn and DBDeleteWithTxn record the state writes of a flush
+// alongside their checksum updates, and FlushToDbWithTxn applies them to the trie in the same badger transaction,
+// via FlushStateCommitmentWithTxn. Hypersync writes snapshot chunks directly to the DB, so the trie is rebuilt from
+// the DB state once hypersync finishes, and when the state commitment is first enabled on an existing node.
+
+const (
+	stateCommitmentLeafNodeType     byte = 0
+	stateCommitmentInternalNodeType byte = 1
+
+	// stateCommitmentKeyHashBits is the depth of the trie if all keyHashes shared every prefix but the last bit.
+	stateCommitmentKeyHashBits = HashSizeBytes * 8
+
+	// stateCommitmentRebuildBatchSize is the number of state keys that are inserted into the trie per badger
+	// transaction when the trie is rebuilt. Every insert writes a path of trie nodes, so this is kept well below
+	// the number of writes that would make badger reject the transaction as too big.
+	stateCommitmentRebuildBatchSize = 1000
+)
+
+// StateCommitment maintains the state commitment trie. The state writes that are recorded between two flushes
+// are applied to the trie in FlushWithTxn.
+type StateCommitment struct {
+	mainDb *badger.DB
+
+	// pendingChanges maps the state keys written since the last flush to their last write. Only
+	// the last write of a key matters, so deleting and then re-setting a key within a flush is a set.
+	pendingChangesMutex sync.Mutex
+	pendingChanges      map[string]*stateCommitmentChange
+}
+
+type stateCommitmentChange struct {
+	key       []byte
+	value     []byte
+	isDeleted bool
+}
+
+// NewStateCommitment creates a StateCommitment for the state in mainDb. If the DB doesn't have a state root yet,
+// e.g. because the state commitment wasn't enabled before, the trie is built from the current state.
+func NewStateCommitment(mainDb *badger.DB) (*StateCommitment, error) {
+	sc := &StateCommitment{
+		mainDb:         mainDb,
+		pendingChanges: make(map[string]*stateCommitmentChange),
+	}
+	var rootExists bool
+	err := mainDb.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(Prefixes.PrefixStateCommitmentRoot)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		rootExists = err == nil
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateCommitment: Problem reading state root")
+	}
+	if !rootExists {
+		if err = sc.Rebuild(nil); err != nil {
+			return nil, errors.Wrapf(err, "NewStateCommitment: Problem building state commitment")
+		}
+	}
+	return sc, nil
+}
+
+// EnableStateCommitment enables the state commitment, building the trie from the current state if needed.
+func (snap *Snapshot) EnableStateCommitment() error {
+	stateCommitment, err := NewStateCommitment(snap.mainDb)
+	if err != nil {
+		return errors.Wrapf(err, "Snapshot.EnableStateCommitment: ")
+	}
+	snap.StateCommitment = stateCommitment
+	return nil
+}
+
+// FlushStateCommitmentWithTxn applies the state writes of the current flush to the state commitment, if it's
+// enabled, and records the resulting state root as the state root of blockHash. It should be called in the same
+// badger transaction as the flush, before FlushAncestralRecordsWithTxn.
+func (snap *Snapshot) FlushStateCommitmentWithTxn(txn *badger.Txn, blockHash *BlockHash) error {
+	if snap.StateCommitment == nil {
+		return nil
+	}
+	if err := snap.StateCommitment.FlushWithTxn(txn, blockHash); err != nil {
+		return errors.Wrapf(err, "Snapshot.FlushStateCommitmentWithTxn: ")
+	}
+	return nil
+}
+
+// recordSet records that the state key was set to value. The value is copied, since callers may reuse it.
+func (sc *StateCommitment) recordSet(key []byte, value []byte) {
+	sc.pendingChangesMutex.Lock()
+	defer sc.pendingChangesMutex.Unlock()
+
+	sc.pendingChanges[string(key)] = &stateCommitmentChange{
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	}
+}
+
+// recordDelete records that the state key was deleted.
+func (sc *StateCommitment) recordDelete(key []byte) {
+	sc.pendingChangesMutex.Lock()
+	defer sc.pendingChangesMutex.Unlock()
+
+	sc.pendingChanges[string(key)] = &stateCommitmentChange{
+		key:       append([]byte{}, key...),
+		isDeleted: true,
+	}
+}
+
+// FlushWithTxn applies the state writes recorded since the last flush to the trie, and stores the new state root.
+// If blockHash is non-nil, the state root is also stored as the state root of that block. FlushWithTxn should be
+// called in the same badger transaction as the state writes, so that the trie can never diverge from the state.
+func (sc *StateCommitment) FlushWithTxn(txn *badger.Txn, blockHash *BlockHash) error {
+	sc.pendingChangesMutex.Lock()
+	pendingChanges := sc.pendingChanges
+	sc.pendingChanges = make(map[string]*stateCommitmentChange)
+	sc.pendingChangesMutex.Unlock()
+
+	changes := make([]*stateCommitmentChange, 0, len(pendingChanges))
+	for _, change := range pendingChanges {
+		changes = append(changes, change)
+	}
+	if err := sc.applyChangesWithTxn(txn, changes, blockHash); err != nil {
+		return errors.Wrapf(err, "StateCommitment.FlushWithTxn: ")
+	}
+	return nil
+}
+
+func (sc *StateCommitment) applyChangesWithTxn(txn *badger.Txn, changes []*stateCommitmentChange, blockHash *BlockHash) error {
+	root, err := DBGetStateCommitmentRootWithTxn(txn)
+	if err != nil {
+		return err
+	}
+
+	// The trie is canonical, so the order of the changes doesn't affect the root. We still sort them by key, so
+	// that the order in which trie nodes are read and written is deterministic.
+	sort.Slice(changes, func(ii, jj int) bool {
+		return bytes.Compare(changes[ii].key, changes[jj].key) < 0
+	})
+	update := &stateCommitmentTrieUpdate{
+		txn:        txn,
+		dirtyNodes: make(map[BlockHash][]byte),
+	}
+	for _, change := range changes {
+		keyHash := BlockHash(sha256.Sum256(change.key))
+		if change.isDeleted {
+			root, err = update.delete(root, 0, &keyHash)
+		} else {
+			valueHash := BlockHash(sha256.Sum256(change.value))
+			root, err = update.insert(root, 0, &keyHash, &valueHash)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Problem updating trie for key %v", change.key)
+		}
+	}
+	if err = update.writeReachableDirtyNodes(root); err != nil {
+		return err
+	}
+
+	if err = txn.Set(Prefixes.PrefixStateCommitmentRoot, root.ToBytes()); err != nil {
+		return errors.Wrapf(err, "Problem setting state root")
+	}
+	if blockHash != nil {
+		if err = txn.Set(_dbKeyForStateCommitmentRootByBlockHash(blockHash), root.ToBytes()); err != nil {
+			return errors.Wrapf(err, "Problem setting state root for block %v", blockHash)
+		}
+	}
+	return nil
+}
+
+// Rebuild discards the trie and builds it from the state in the DB. If blockHash is non-nil, the new state root is
+// stored as the state root of that block. Rebuild must not run concurrently with state writes.
+func (sc *StateCommitment) Rebuild(blockHash *BlockHash) error {
+	glog.Infof("StateCommitment.Rebuild: Building state commitment from the DB state")
+	sc.pendingChangesMutex.Lock()
+	sc.pendingChanges = make(map[string]*stateCommitmentChange)
+	sc.pendingChangesMutex.Unlock()
+
+	err := sc.mainDb.Update(func(txn *badger.Txn) error {
+		return txn.Set(Prefixes.PrefixStateCommitmentRoot, ZeroBlockHash.ToBytes())
+	})
+	if err != nil {
+		return errors.Wrapf(err, "StateCommitment.Rebuild: Problem resetting state root")
+	}
+
+	numKeys := 0
+	for _, prefix := range StatePrefixes.StatePrefixesList {
+		startKey := prefix
+		for {
+			changes, nextKey, err := sc.getStateBatch(prefix, startKey)
+			if err != nil {
+				return errors.Wrapf(err, "StateCommitment.Rebuild: Problem reading state for prefix %v", prefix)
+			}
+			if len(changes) == 0 {
+				break
+			}
+			err = sc.mainDb.Update(func(txn *badger.Txn) error {
+				return sc.applyChangesWithTxn(txn, changes, nil)
+			})
+			if err != nil {
+				return errors.Wrapf(err, "StateCommitment.Rebuild: Problem inserting state for prefix %v", prefix)
+			}
+			numKeys += len(changes)
+			if nextKey == nil {
+				break
+			}
+			startKey = nextKey
+		}
+	}
+
+	// Apply an empty set of changes to store the final state root for the block.
+	err = sc.mainDb.Update(func(txn *badger.Txn) error {
+		return sc.applyChangesWithTxn(txn, nil, blockHash)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "StateCommitment.Rebuild: Problem storing state root")
+	}
+	glog.Infof("StateCommitment.Rebuild: Finished building state commitment over %v keys", numKeys)
+	return nil
+}
+
+// getStateBatch returns up to stateCommitmentRebuildBatchSize state keys under prefix, starting at startKey, and
+// the key to start the next batch at. The next key is nil if there are no more keys under the prefix.
+func (sc *StateCommitment) getStateBatch(prefix []byte, startKey []byte) (
+	_changes []*stateCommitmentChange, _nextKey []byte, _err error) {
+
+	var changes []*stateCommitmentChange
+	var nextKey []byte
+	err := sc.mainDb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(startKey); it.ValidForPrefix(prefix); it.Next() {
+			if len(changes) == stateCommitmentRebuildBatchSize {
+				nextKey = it.Item().KeyCopy(nil)
+				return nil
+			}
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, &stateCommitmentChange{key: it.Item().KeyCopy(nil), value: value})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return changes, nextKey, nil
+}
+
+// GetStateRoot returns the current state root.
+func (sc *StateCommitment) GetStateRoot() (*BlockHash, error) {
+	var root *BlockHash
+	err := sc.mainDb.View(func(txn *badger.Txn) error {
+		var err error
+		root, err = DBGetStateCommitmentRootWithTxn(txn)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateCommitment.GetStateRoot: ")
+	}
+	return root, nil
+}
+
+// GetStateProof returns the proof of the value of key at the given state root, or of its absence. The proof can be
+// verified with VerifyStateProof.
+func (sc *StateCommitment) GetStateProof(root *BlockHash, key []byte) (*StateProof, error) {
+	keyHash := BlockHash(sha256.Sum256(key))
+	proof := &StateProof{}
+	err := sc.mainDb.View(func(txn *badger.Txn) error {
+		update := &stateCommitmentTrieUpdate{txn: txn}
+		nodeHash := root
+		for depth := 0; !nodeHash.IsEqual(&ZeroBlockHash); depth++ {
+			node, err := update.getNode(nodeHash)
+			if err != nil {
+				return err
+			}
+			if node.isLeaf() {
+				proof.LeafKeyHash, proof.LeafValueHash = node.leftOrKeyHash, node.rightOrValueHash
+				return nil
+			}
+			if getStateCommitmentKeyHashBit(&keyHash, depth) == 0 {
+				proof.Siblings = append(proof.Siblings, node.rightOrValueHash)
+				nodeHash = node.leftOrKeyHash
+			} else {
+				proof.Siblings = append(proof.Siblings, node.leftOrKeyHash)
+				nodeHash = node.rightOrValueHash
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateCommitment.GetStateProof: Problem walking trie for key %v", key)
+	}
+	return proof, nil
+}
+
+// StateProof proves the value of a state key, or its absence, against a state root.
+type StateProof struct {
+	// Siblings are the hashes of the siblings of the nodes on the path to the key, from the root down.
+	Siblings []*BlockHash
+	// LeafKeyHash and LeafValueHash are the hashes committed to by the leaf at the end of the path. A proof of
+	// absence either ends in an empty subtree, in which case they are nil, or in the leaf of a different key.
+	LeafKeyHash   *BlockHash
+	LeafValueHash *BlockHash
+}
+
+// VerifyStateProof returns true if the proof shows that key has the given value at the state root. A nil value
+// verifies that key doesn't exist at the state root.
+func VerifyStateProof(root *BlockHash, key []byte, value []byte, proof *StateProof) bool {
+	if root == nil || proof == nil || len(proof.Siblings) > stateCommitmentKeyHashBits {
+		return false
+	}
+	if (proof.LeafKeyHash == nil) != (proof.LeafValueHash == nil) {
+		return false
+	}
+	keyHash := BlockHash(sha256.Sum256(key))
+	depth := len(proof.Siblings)
+
+	var nodeHash *BlockHash
+	if value != nil {
+		valueHash := BlockHash(sha256.Sum256(value))
+		if proof.LeafKeyHash == nil || !proof.LeafKeyHash.IsEqual(&keyHash) || !proof.LeafValueHash.IsEqual(&valueHash) {
+			return false
+		}
+		nodeHash = hashStateCommitmentNode(stateCommitmentLeafNodeType, &keyHash, &valueHash)
+	} else if proof.LeafKeyHash != nil {
+		// The leaf at the end of the path must be of a different key, on the same path.
+		if proof.LeafKeyHash.IsEqual(&keyHash) {
+			return false
+		}
+		for ii := 0; ii < depth; ii++ {
+			if getStateCommitmentKeyHashBit(proof.LeafKeyHash, ii) != getStateCommitmentKeyHashBit(&keyHash, ii) {
+				return false
+			}
+		}
+		nodeHash = hashStateCommitmentNode(stateCommitmentLeafNodeType, proof.LeafKeyHash, proof.LeafValueHash)
+	} else {
+		nodeHash = &ZeroBlockHash
+	}
+
+	for ii := depth - 1; ii >= 0; ii-- {
+		if proof.Siblings[ii] == nil {
+			return false
+		}
+		if getStateCommitmentKeyHashBit(&keyHash, ii) == 0 {
+			nodeHash = hashStateCommitmentNode(stateCommitmentInternalNodeType, nodeHash, proof.Siblings[ii])
+		} else {
+			nodeHash = hashStateCommitmentNode(stateCommitmentInternalNodeType, proof.Siblings[ii], nodeHash)
+		}
+	}
+	return nodeHash.IsEqual(root)
+}
+
+// stateCommitmentNode is a decoded trie node. For leaves, the two hashes are the keyHash and the valueHash; for
+// internal nodes, they are the hashes of the left and right children.
+type stateCommitmentNode struct {
+	nodeType         byte
+	leftOrKeyHash    *BlockHash
+	rightOrValueHash *BlockHash
+}
+
+func (node *stateCommitmentNode) isLeaf() bool {
+	return node.nodeType == stateCommitmentLeafNodeType
+}
+
+func encodeStateCommitmentNode(nodeType byte, leftOrKeyHash *BlockHash, rightOrValueHash *BlockHash) []byte {
+	data := make([]byte, 0, 1+2*HashSizeBytes)
+	data = append(data, nodeType)
+	data = append(data, leftOrKeyHash[:]...)
+	data = append(data, rightOrValueHash[:]...)
+	return data
+}
+
+func hashStateCommitmentNode(nodeType byte, leftOrKeyHash *BlockHash, rightOrValueHash *BlockHash) *BlockHash {
+	nodeHash := BlockHash(sha256.Sum256(encodeStateCommitmentNode(nodeType, leftOrKeyHash, rightOrValueHash)))
+	return &nodeHash
+}
+
+func decodeStateCommitmentNode(data []byte) (*stateCommitmentNode, error) {
+	if len(data) != 1+2*HashSizeBytes {
+		return nil, fmt.Errorf("decodeStateCommitmentNode: Node has %v bytes, expected %v",
+			len(data), 1+2*HashSizeBytes)
+	}
+	if data[0] != stateCommitmentLeafNodeType && data[0] != stateCommitmentInternalNodeType {
+		return nil, fmt.Errorf("decodeStateCommitmentNode: Unknown node type %v", data[0])
+	}
+	return &stateCommitmentNode{
+		nodeType:         data[0],
+		leftOrKeyHash:    NewBlockHash(data[1 : 1+HashSizeBytes]),
+		rightOrValueHash: NewBlockHash(data[1+HashSizeBytes:]),
+	}, nil
+}
+
+// getStateCommitmentKeyHashBit returns the bit of the keyHash that selects the child at the given depth.
+func getStateCommitmentKeyHashBit(keyHash *BlockHash, depth int) byte {
+	return (keyHash[depth/8] >> (7 - uint(depth%8))) & 1
+}
+
+// stateCommitmentTrieUpdate applies changes to the trie within a badger transaction. New nodes are kept in
+// dirtyNodes, and only the ones that are still reachable from the final root are written to the DB.
+type stateCommitmentTrieUpdate struct {
+	txn        *badger.Txn
+	dirtyNodes map[BlockHash][]byte
+}
+
+func (update *stateCommitmentTrieUpdate) getNode(nodeHash *BlockHash) (*stateCommitmentNode, error) {
+	if data, exists := update.dirtyNodes[*nodeHash]; exists {
+		return decodeStateCommitmentNode(data)
+	}
+	item, err := update.txn.Get(_dbKeyForStateCommitmentNode(nodeHash))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem getting trie node %v", nodeHash)
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem copying trie node %v", nodeHash)
+	}
+	return decodeStateCommitmentNode(data)
+}
+
+func (update *stateCommitmentTrieUpdate) putNode(nodeType byte, leftOrKeyHash *BlockHash, rightOrValueHash *BlockHash) *BlockHash {
+	data := encodeStateCommitmentNode(nodeType, leftOrKeyHash, rightOrValueHash)
+	nodeHash := BlockHash(sha256.Sum256(data))
+	update.dirtyNodes[nodeHash] = data
+	return &nodeHash
+}
+
+// putInternalNode stores the internal node with the given children, where children[0] is the left child.
+func (update *stateCommitmentTrieUpdate) putInternalNode(children [2]*BlockHash) *BlockHash {
+	return update.putNode(stateCommitmentInternalNodeType, children[0], children[1])
+}
+
+// insert sets the leaf of keyHash to valueHash in the subtree at nodeHash, and returns the new subtree hash.
+func (update *stateCommitmentTrieUpdate) insert(nodeHash *BlockHash, depth int, keyHash *BlockHash, valueHash *BlockHash) (
+	*BlockHash, error) {
+
+	if nodeHash.IsEqual(&ZeroBlockHash) {
+		return update.putNode(stateCommitmentLeafNodeType, keyHash, valueHash), nil
+	}
+	node, err := update.getNode(nodeHash)
+	if err != nil {
+		return nil, err
+	}
+	if node.isLeaf() {
+		newLeafHash := update.putNode(stateCommitmentLeafNodeType, keyHash, valueHash)
+		if node.leftOrKeyHash.IsEqual(keyHash) {
+			return newLeafHash, nil
+		}
+		return update.splitLeaves(depth, nodeHash, node.leftOrKeyHash, newLeafHash, keyHash), nil
+	}
+
+	children := [2]*BlockHash{node.leftOrKeyHash, node.rightOrValueHash}
+	bit := getStateCommitmentKeyHashBit(keyHash, depth)
+	if children[bit], err = update.insert(children[bit], depth+1, keyHash, valueHash); err != nil {
+		return nil, err
+	}
+	return update.putInternalNode(children), nil
+}
+
+// splitLeaves returns the subtree at the given depth that holds the two leaves, whose keyHashes share the bits
+// above that depth. Internal nodes are added until the keyHashes differ.
+func (update *stateCommitmentTrieUpdate) splitLeaves(depth int, leafHashA *BlockHash, keyHashA *BlockHash,
+	leafHashB *BlockHash, keyHashB *BlockHash) *BlockHash {
+
+	children := [2]*BlockHash{&ZeroBlockHash, &ZeroBlockHash}
+	bitA := getStateCommitmentKeyHashBit(keyHashA, depth)
+	bitB := getStateCommitmentKeyHashBit(keyHashB, depth)
+	if bitA == bitB {
+		children[bitA] = update.splitLeaves(depth+1, leafHashA, keyHashA, leafHashB, keyHashB)
+	} else {
+		children[bitA] = leafHashA
+		children[bitB] = leafHashB
+	}
+	return update.putInternalNode(children)
+}
+
+// delete removes the leaf of keyHash from the subtree at nodeHash, and returns the new subtree hash. If a subtree
+// is left with a single leaf, the leaf replaces it, which keeps the trie canonical.
+func (update *stateCommitmentTrieUpdate) delete(nodeHash *BlockHash, depth int, keyHash *BlockHash) (*BlockHash, error) {
+	if nodeHash.IsEqual(&ZeroBlockHash) {
+		return nodeHash, nil
+	}
+	node, err := update.getNode(nodeHash)
+	if err != nil {
+		return nil, err
+	}
+	if node.isLeaf() {
+		if node.leftOrKeyHash.IsEqual(keyHash) {
+			return &ZeroBlockHash, nil
+		}
+		return nodeHash, nil
+	}
+
+	children := [2]*BlockHash{node.leftOrKeyHash, node.rightOrValueHash}
+	bit := getStateCommitmentKeyHashBit(keyHash, depth)
+	newChild, err := update.delete(children[bit], depth+1, keyHash)
+	if err != nil {
+		return nil, err
+	}
+	if newChild.IsEqual(children[bit]) {
+		return nodeHash, nil
+	}
+	children[bit] = newChild
+
+	// An internal node always has at least two leaves below it. If only one is left, it moves up.
+	sibling := children[1-bit]
+	if newChild.IsEqual(&ZeroBlockHash) {
+		siblingNode, err := update.getNode(sibling)
+		if err != nil {
+			return nil, err
+		}
+		if siblingNode.isLeaf() {
+			return sibling, nil
+		}
+	} else if sibling.IsEqual(&ZeroBlockHash) {
+		newChildNode, err := update.getNode(newChild)
+		if err != nil {
+			return nil, err
+		}
+		if newChildNode.isLeaf() {
+			return newChild, nil
+		}
+	}
+	return update.putInternalNode(children), nil
+}
+
+// writeReachableDirtyNodes writes the new nodes that are reachable from root to the DB. Nodes that were created
+// and then replaced within the same update are dropped.
+func (update *stateCommitmentTrieUpdate) writeReachableDirtyNodes(root *BlockHash) error {
+	data, isDirty := update.dirtyNodes[*root]
+	if !isDirty {
+		return nil
+	}
+	delete(update.dirtyNodes, *root)
+	if err := update.txn.Set(_dbKeyForStateCommitmentNode(root), data); err != nil {
+		return errors.Wrapf(err, "Problem setting trie node %v", root)
+	}
+	node, err := decodeStateCommitmentNode(data)
+	if err != nil {
+		return err
+	}
+	if node.isLeaf() {
+		return nil
+	}
+	if err = update.writeReachableDirtyNodes(node.leftOrKeyHash); err != nil {
+		return err
+	}
+	return update.writeReachableDirtyNodes(node.rightOrValueHash)
+}
+
+func _dbKeyForStateCommitmentNode(nodeHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixStateCommitmentNode...), nodeHash[:]...)
+}
+
+func _dbKeyForStateCommitmentRootByBlockHash(blockHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixStateCommitmentRootByBlockHash...), blockHash[:]...)
+}
+
+// DBGetStateCommitmentRootWithTxn returns the current state root. The root of an empty trie is the ZeroBlockHash.
+func DBGetStateCommitmentRootWithTxn(txn *badger.Txn) (*BlockHash, error) {
+	item, err := txn.Get(Prefixes.PrefixStateCommitmentRoot)
+	if err == badger.ErrKeyNotFound {
+		return NewBlockHash(ZeroBlockHash[:]), nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetStateCommitmentRootWithTxn: Problem getting state root")
+	}
+	rootBytes, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetStateCommitmentRootWithTxn: Problem copying state root")
+	}
+	return NewBlockHash(rootBytes), nil
+}
+
+// DBGetStateCommitmentRootForBlock returns the state root after the block with the given hash was connected, or
+// nil if the state commitment wasn't enabled when the block was flushed.
+func DBGetStateCommitmentRootForBlock(handle *badger.DB, blockHash *BlockHash) (*BlockHash, error) {
+	var root *BlockHash
+	err := handle.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(_dbKeyForStateCommitmentRootByBlockHash(blockHash))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rootBytes, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		root = NewBlockHash(rootBytes)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetStateCommitmentRootForBlock: Problem getting state root for block %v", blockHash)
+	}
+	return root, nil
+}
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateCommitmentTrie(t *testing.T) {
+	require := require.New(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	sc, err := NewStateCommitment(db)
+	require.NoError(err)
+	flush := func() *BlockHash {
+		require.NoError(db.Update(func(txn *badger.Txn) error {
+			return sc.FlushWithTxn(txn, nil)
+		}))
+		root, err := sc.GetStateRoot()
+		require.NoError(err)
+		return root
+	}
+	require.True(flush().IsEqual(&ZeroBlockHash))
+
+	// Write the same key-values in two different orders, across multiple flushes. Some keys are deleted and
+	// rewritten along the way.
+	keyValues := make(map[string][]byte)
+	for ii := 0; ii < 200; ii++ {
+		keyValues[string(append(append([]byte{}, Prefixes.PrefixPostHashToPostEntry...), RandomBytes(10)...))] = RandomBytes(20)
+	}
+	var keys []string
+	for key := range keyValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for ii, key := range keys {
+		sc.recordSet([]byte(key), RandomBytes(20))
+		if ii%50 == 49 {
+			flush()
+		}
+	}
+	for ii := len(keys) - 1; ii >= 0; ii-- {
+		sc.recordDelete([]byte(keys[ii]))
+		sc.recordSet([]byte(keys[ii]), keyValues[keys[ii]])
+		if ii%3 == 0 {
+			flush()
+		}
+	}
+	root := flush()
+
+	// Deleting keys changes the root, and the root goes back once the keys are rewritten.
+	for _, key := range keys[:20] {
+		sc.recordDelete([]byte(key))
+	}
+	rootWithDeletes := flush()
+	require.False(root.IsEqual(rootWithDeletes))
+	for _, key := range keys[:20] {
+		sc.recordSet([]byte(key), keyValues[key])
+	}
+	require.True(root.IsEqual(flush()))
+
+	// A trie built from scratch with the same key-values has the same root.
+	otherDb, otherDir := GetTestBadgerDb()
+	defer os.RemoveAll(otherDir)
+	defer otherDb.Close()
+	other, err := NewStateCommitment(otherDb)
+	require.NoError(err)
+	for key, value := range keyValues {
+		other.recordSet([]byte(key), value)
+	}
+	require.NoError(otherDb.Update(func(txn *badger.Txn) error {
+		return other.FlushWithTxn(txn, nil)
+	}))
+	otherRoot, err := other.GetStateRoot()
+	require.NoError(err)
+	require.True(root.IsEqual(otherRoot))
+
+	// Every key has a proof of its value against the root, and against no other value.
+	for _, key := range keys {
+		proof, err := sc.GetStateProof(root, []byte(key))
+		require.NoError(err)
+		require.True(VerifyStateProof(root, []byte(key), keyValues[key], proof))
+		require.False(VerifyStateProof(root, []byte(key), RandomBytes(20), proof))
+		require.False(VerifyStateProof(root, []byte(key), nil, proof))
+		require.False(VerifyStateProof(rootWithDeletes, []byte(key), keyValues[key], proof))
+		if len(proof.Siblings) > 0 {
+			tamperedProof := &StateProof{
+				Siblings:      append([]*BlockHash{NewBlockHash(RandomBytes(HashSizeBytes))}, proof.Siblings[1:]...),
+				LeafKeyHash:   proof.LeafKeyHash,
+				LeafValueHash: proof.LeafValueHash,
+			}
+			require.False(VerifyStateProof(root, []byte(key), keyValues[key], tamperedProof))
+		}
+	}
+
+	// Deleted and missing keys have proofs of absence.
+	for _, key := range keys[:20] {
+		proof, err := sc.GetStateProof(rootWithDeletes, []byte(key))
+		require.NoError(err)
+		require.True(VerifyStateProof(rootWithDeletes, []byte(key), nil, proof))
+		require.False(VerifyStateProof(rootWithDeletes, []byte(key), keyValues[key], proof))
+	}
+	missingKey := append(append([]byte{}, Prefixes.PrefixPostHashToPostEntry...), RandomBytes(10)...)
+	proof, err := sc.GetStateProof(root, missingKey)
+	require.NoError(err)
+	require.True(VerifyStateProof(root, missingKey, nil, proof))
+}
+
+func TestStateCommitmentBlockRoots(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	snap := chain.snapshot
+	require.NotNil(snap)
+	require.NoError(snap.EnableStateCommitment())
+
+	var blockRoots []*BlockHash
+	for ii := 0; ii < 3; ii++ {
+		block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+		blockHash, err := block.Hash()
+		require.NoError(err)
+		blockRoot, err := DBGetStateCommitmentRootForBlock(db, blockHash)
+		require.NoError(err)
+		require.NotNil(blockRoot)
+		blockRoots = append(blockRoots, blockRoot)
+	}
+	// Every block pays a block reward, so every block has a different state root.
+	require.False(blockRoots[0].IsEqual(blockRoots[1]))
+	require.False(blockRoots[1].IsEqual(blockRoots[2]))
+
+	root, err := snap.StateCommitment.GetStateRoot()
+	require.NoError(err)
+	require.True(root.IsEqual(blockRoots[2]))
+
+	// The incrementally updated trie matches the trie built from the state in the DB.
+	require.NoError(snap.StateCommitment.Rebuild(nil))
+	rebuiltRoot, err := snap.StateCommitment.GetStateRoot()
+	require.NoError(err)
+	require.True(root.IsEqual(rebuiltRoot))
+
+	// The proof of a state key verifies against the block's state root.
+	stateKey := Prefixes.PrefixGlobalParams
+	var value []byte
+	require.NoError(db.View(func(txn *badger.Txn) error {
+		value, err = DBGetWithTxn(txn, nil, stateKey)
+		return err
+	}))
+	proof, err := snap.StateCommitment.GetStateProof(root, stateKey)
+	require.NoError(err)
+	require.True(VerifyStateProof(root, stateKey, value, proof))
+}
@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Tracing
+//
+// Core is instrumented with spans around the work that determines how quickly a node processes blocks and
+// transactions: ProcessBlock, ConnectBlock, ConnectTransaction, FlushToDb, and mempool admission. The spans
+// follow the OpenTelemetry model. Each span has a name, a start and end time, a set of attributes, and an
+// optional error, and a span started with a parent belongs to the parent's trace. This lets an operator see,
+// for example, which transactions in a slow block took the longest to connect, and how long the block took to
+// flush.
+//
+// The tracer is a no-op by default, so the instrumentation costs almost nothing unless tracing is enabled.
+// SetTracer installs a different Tracer. NewExportingTracer returns a Tracer that records spans and passes them
+// to a SpanExporter when they end. Exporters are pluggable: LogSpanExporter logs slow spans with glog, and an
+// embedding application can implement SpanExporter to forward spans to an OpenTelemetry collector or any other
+// backend.
+
+// Keys of the attributes we set on spans.
+const (
+	TraceAttributeKeyTxnType        = "deso.txn.type"
+	TraceAttributeKeyTxnHash        = "deso.txn.hash"
+	TraceAttributeKeyTxnSizeBytes   = "deso.txn.size_bytes"
+	TraceAttributeKeyTxnFeeNanos    = "deso.txn.fee_nanos"
+	TraceAttributeKeyBlockHeight    = "deso.block.height"
+	TraceAttributeKeyBlockHash      = "deso.block.hash"
+	TraceAttributeKeyBlockSizeBytes = "deso.block.size_bytes"
+	TraceAttributeKeyBlockNumTxns   = "deso.block.num_txns"
+	TraceAttributeKeyRuleError      = "deso.rule_error"
+)
+
+// TraceAttribute is a key-value pair that describes the work done in a span.
+type TraceAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// TraceSpan tracks a single unit of work. A span must be ended exactly once, and it can't be modified after it
+// has ended.
+type TraceSpan interface {
+	// IsRecording returns false if the span is discarded. Callers can use it to skip computing expensive
+	// attributes.
+	IsRecording() bool
+	SetAttributes(attributes ...TraceAttribute)
+	// RecordError marks the span as failed. Nil errors are ignored.
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans. The parent may be nil, in which case the span starts a new trace.
+type Tracer interface {
+	StartSpan(name string, parent TraceSpan) TraceSpan
+}
+
+// tracerHolder lets us store Tracers with different concrete types in an atomic.Value.
+type tracerHolder struct {
+	tracer Tracer
+}
+
+var globalTracer atomic.Value
+
+// SetTracer sets the Tracer used by all of the instrumentation in core. Passing nil disables tracing.
+func SetTracer(tracer Tracer) {
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	globalTracer.Store(tracerHolder{tracer: tracer})
+}
+
+// GetTracer returns the Tracer set with SetTracer, or a no-op Tracer if none was set.
+func GetTracer() Tracer {
+	holder, ok := globalTracer.Load().(tracerHolder)
+	if !ok {
+		return noopTracer{}
+	}
+	return holder.tracer
+}
+
+// StartTraceSpan starts a span with the global Tracer.
+func StartTraceSpan(name string, parent TraceSpan) TraceSpan {
+	return GetTracer().StartSpan(name, parent)
+}
+
+// EndTraceSpan records the error, if any, and ends the span. It is meant to be deferred by functions with a
+// named error return.
+func EndTraceSpan(span TraceSpan, err error) {
+	span.RecordError(err)
+	span.End()
+}
+
+// txnTraceAttributes returns the attributes that describe a transaction. Computing the size requires encoding
+// the transaction, so it should only be called for recording spans.
+func txnTraceAttributes(txn *MsgDeSoTxn, txHash *BlockHash) []TraceAttribute {
+	var attributes []TraceAttribute
+	if txn.TxnMeta != nil {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeKeyTxnType, Value: txn.TxnMeta.GetTxnType().String()})
+	}
+	if txHash != nil {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeKeyTxnHash, Value: txHash.String()})
+	}
+	if txnBytes, err := txn.ToBytes(false); err == nil {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeKeyTxnSizeBytes, Value: len(txnBytes)})
+	}
+	return attributes
+}
+
+// blockTraceAttributes returns the attributes that describe a block. Like txnTraceAttributes, it encodes the
+// block and should only be called for recording spans.
+func blockTraceAttributes(block *MsgDeSoBlock) []TraceAttribute {
+	attributes := []TraceAttribute{{Key: TraceAttributeKeyBlockNumTxns, Value: len(block.Txns)}}
+	if block.Header != nil {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeKeyBlockHeight, Value: block.Header.Height})
+		if blockHash, err := block.Hash(); err == nil {
+			attributes = append(attributes, TraceAttribute{Key: TraceAttributeKeyBlockHash, Value: blockHash.String()})
+		}
+	}
+	if blockBytes, err := block.ToBytes(false); err == nil {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeKeyBlockSizeBytes, Value: len(blockBytes)})
+	}
+	return attributes
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(name string, parent TraceSpan) TraceSpan {
+	return noopTraceSpan{}
+}
+
+type noopTraceSpan struct{}
+
+func (noopTraceSpan) IsRecording() bool                          { return false }
+func (noopTraceSpan) SetAttributes(attributes ...TraceAttribute) {}
+func (noopTraceSpan) RecordError(err error)                      {}
+func (noopTraceSpan) End()                                       {}
+
+// SpanData is a span that has ended. The IDs are random, and the ParentSpanID is all zeros for the root span of
+// a trace.
+type SpanData struct {
+	Name         string
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   []TraceAttribute
+	Err          error
+}
+
+func (data *SpanData) Duration() time.Duration {
+	return data.EndTime.Sub(data.StartTime)
+}
+
+// GetAttribute returns the value of the last attribute with the given key.
+func (data *SpanData) GetAttribute(key string) (interface{}, bool) {
+	for ii := len(data.Attributes) - 1; ii >= 0; ii-- {
+		if data.Attributes[ii].Key == key {
+			return data.Attributes[ii].Value, true
+		}
+	}
+	return nil, false
+}
+
+// SpanExporter receives every span recorded by an exporting Tracer when the span ends. ExportSpan is called
+// synchronously from the instrumented code, so exporters that do I/O should buffer spans and send them in the
+// background.
+type SpanExporter interface {
+	ExportSpan(span *SpanData)
+}
+
+type exportingTracer struct {
+	exporter SpanExporter
+}
+
+// NewExportingTracer returns a Tracer that records every span and passes it to the exporter once it ends.
+func NewExportingTracer(exporter SpanExporter) Tracer {
+	return &exportingTracer{exporter: exporter}
+}
+
+func (tracer *exportingTracer) StartSpan(name string, parent TraceSpan) TraceSpan {
+	span := &exportingTraceSpan{
+		exporter: tracer.exporter,
+		data: SpanData{
+			Name:      name,
+			StartTime: time.Now(),
+		},
+	}
+	// Spans only join the trace of parents recorded by the same kind of Tracer.
+	if parentSpan, ok := parent.(*exportingTraceSpan); ok && parentSpan != nil {
+		span.data.TraceID = parentSpan.data.TraceID
+		span.data.ParentSpanID = parentSpan.data.SpanID
+	} else {
+		_, _ = rand.Read(span.data.TraceID[:])
+	}
+	_, _ = rand.Read(span.data.SpanID[:])
+	return span
+}
+
+type exportingTraceSpan struct {
+	mtx      sync.Mutex
+	exporter SpanExporter
+	data     SpanData
+	ended    bool
+}
+
+func (span *exportingTraceSpan) IsRecording() bool {
+	span.mtx.Lock()
+	defer span.mtx.Unlock()
+	return !span.ended
+}
+
+func (span *exportingTraceSpan) SetAttributes(attributes ...TraceAttribute) {
+	span.mtx.Lock()
+	defer span.mtx.Unlock()
+	if span.ended {
+		return
+	}
+	span.data.Attributes = append(span.data.Attributes, attributes...)
+}
+
+func (span *exportingTraceSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	span.mtx.Lock()
+	defer span.mtx.Unlock()
+	if span.ended {
+		return
+	}
+	span.data.Err = err
+	// Rule errors are the most common reason a block or transaction is rejected, so we break them out into
+	// their own attribute to make them easy to filter on.
+	if ruleError := findRuleError(err); ruleError != "" {
+		span.data.Attributes = append(span.data.Attributes,
+			TraceAttribute{Key: TraceAttributeKeyRuleError, Value: ruleError})
+	}
+}
+
+func (span *exportingTraceSpan) End() {
+	span.mtx.Lock()
+	if span.ended {
+		span.mtx.Unlock()
+		return
+	}
+	span.ended = true
+	span.data.EndTime = time.Now()
+	data := span.data
+	span.mtx.Unlock()
+
+	span.exporter.ExportSpan(&data)
+}
+
+// findRuleError returns the first RuleError in the error message, or an empty string if there isn't one. Like
+// IsRuleError, it goes by the message because wrapping hides the RuleError type.
+func findRuleError(err error) string {
+	if !IsRuleError(err) {
+		return ""
+	}
+	for _, word := range strings.FieldsFunc(err.Error(), func(r rune) bool {
+		return r == ' ' || r == ':' || r == ';' || r == ','
+	}) {
+		if strings.HasPrefix(word, "RuleError") {
+			return word
+		}
+	}
+	return ""
+}
+
+// LogSpanExporter logs every span that takes at least the threshold.
+type LogSpanExporter struct {
+	threshold time.Duration
+}
+
+func NewLogSpanExporter(threshold time.Duration) *LogSpanExporter {
+	return &LogSpanExporter{threshold: threshold}
+}
+
+func (exporter *LogSpanExporter) ExportSpan(span *SpanData) {
+	if span.Duration() < exporter.threshold {
+		return
+	}
+	attributeStrings := make([]string, 0, len(span.Attributes))
+	for _, attribute := range span.Attributes {
+		attributeStrings = append(attributeStrings, fmt.Sprintf("%v=%v", attribute.Key, attribute.Value))
+	}
+	glog.Infof("Trace: %v took %v (trace: %x, span: %x, parent: %x, attributes: [%v], error: %v)",
+		span.Name, span.Duration(), span.TraceID, span.SpanID, span.ParentSpanID,
+		strings.Join(attributeStrings, ", "), span.Err)
+}
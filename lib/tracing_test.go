@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type testSpanExporter struct {
+	mtx   sync.Mutex
+	spans []*SpanData
+}
+
+func (exporter *testSpanExporter) ExportSpan(span *SpanData) {
+	exporter.mtx.Lock()
+	defer exporter.mtx.Unlock()
+	exporter.spans = append(exporter.spans, span)
+}
+
+func (exporter *testSpanExporter) getSpans(name string) []*SpanData {
+	exporter.mtx.Lock()
+	defer exporter.mtx.Unlock()
+	var spans []*SpanData
+	for _, span := range exporter.spans {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	require := require.New(t)
+
+	// The default tracer doesn't record anything.
+	require.False(StartTraceSpan("test", nil).IsRecording())
+
+	exporter := &testSpanExporter{}
+	SetTracer(NewExportingTracer(exporter))
+	defer SetTracer(nil)
+
+	// Spans with a parent join the parent's trace, and rule errors get their own attribute.
+	parent := StartTraceSpan("parent", nil)
+	child := StartTraceSpan("child", parent)
+	require.True(child.IsRecording())
+	child.SetAttributes(TraceAttribute{Key: TraceAttributeKeyBlockHeight, Value: uint64(10)})
+	EndTraceSpan(child, errors.Wrapf(RuleErrorInputWithPublicKeyDifferentFromTxnPublicKey, "test: "))
+	require.False(child.IsRecording())
+	EndTraceSpan(parent, nil)
+
+	parentData, childData := exporter.getSpans("parent")[0], exporter.getSpans("child")[0]
+	require.Equal(parentData.TraceID, childData.TraceID)
+	require.Equal(parentData.SpanID, childData.ParentSpanID)
+	require.Equal([8]byte{}, parentData.ParentSpanID)
+	require.Nil(parentData.Err)
+	require.Error(childData.Err)
+	ruleError, exists := childData.GetAttribute(TraceAttributeKeyRuleError)
+	require.True(exists)
+	require.Equal(string(RuleErrorInputWithPublicKeyDifferentFromTxnPublicKey), ruleError)
+
+	// Processing a block traces the connection of the block and its transactions, and the flush.
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	block, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(err)
+	blockHash, err := block.Hash()
+	require.NoError(err)
+
+	processBlockSpans := exporter.getSpans("Blockchain.ProcessBlock")
+	require.Len(processBlockSpans, 1)
+	processBlockSpan := processBlockSpans[0]
+	spanBlockHash, _ := processBlockSpan.GetAttribute(TraceAttributeKeyBlockHash)
+	require.Equal(blockHash.String(), spanBlockHash)
+	numTxns, _ := processBlockSpan.GetAttribute(TraceAttributeKeyBlockNumTxns)
+	require.Equal(len(block.Txns), numTxns)
+
+	connectBlockSpans := exporter.getSpans("UtxoView.ConnectBlock")
+	require.Len(connectBlockSpans, 1)
+	require.Equal(processBlockSpan.SpanID, connectBlockSpans[0].ParentSpanID)
+
+	var blockTxnSpans []*SpanData
+	for _, span := range exporter.getSpans("UtxoView.ConnectTransaction") {
+		if span.ParentSpanID == connectBlockSpans[0].SpanID {
+			blockTxnSpans = append(blockTxnSpans, span)
+		}
+	}
+	require.Len(blockTxnSpans, len(block.Txns))
+	txnType, _ := blockTxnSpans[0].GetAttribute(TraceAttributeKeyTxnType)
+	require.Equal(TxnTypeBlockReward.String(), txnType)
+	txnSize, _ := blockTxnSpans[0].GetAttribute(TraceAttributeKeyTxnSizeBytes)
+	require.Greater(txnSize, 0)
+
+	flushSpans := exporter.getSpans("UtxoView.FlushToDb")
+	require.NotEmpty(flushSpans)
+	require.Equal(processBlockSpan.SpanID, flushSpans[len(flushSpans)-1].ParentSpanID)
+}
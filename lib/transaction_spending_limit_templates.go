@@ -0,0 +1,683 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/pkg/errors"
+)
+
+// Wallets that authorize derived keys tend to offer the same handful of spending limits, e.g. a key that can only
+// post and like, or a key that can only trade creator coins, and each of them used to build those limits and
+// describe them to the user on their own. This file gives them a shared way to do both:
+//   - TransactionSpendingLimitBuilder builds a TransactionSpendingLimit one limit at a time, and can merge other
+//     limits and named templates into it, so templates can be composed and then tweaked.
+//   - The named templates below cover the common cases.
+//   - Describe and ToHumanReadableString render any TransactionSpendingLimit as plain English, in a canonical
+//     order, so the same limit produces the same approval prompt in every wallet.
+//
+// Note that ToMetamaskString is part of the derived key signature for metamask, so its format can't change. The
+// human-readable description here is for display only and may be reworded over time.
+
+const (
+	TransactionSpendingLimitTemplateSocialOnly     = "social-only"
+	TransactionSpendingLimitTemplateMessagingOnly  = "messaging-only"
+	TransactionSpendingLimitTemplateTradingLimited = "trading-limited"
+	TransactionSpendingLimitTemplateNFTCollector   = "nft-collector"
+)
+
+// transactionSpendingLimitTemplates maps each template name to a function that adds the template's limits to a
+// builder. Templates are applied as functions so that every call gets its own maps.
+var transactionSpendingLimitTemplates = map[string]func(builder *TransactionSpendingLimitBuilder){
+	// A key that can post, like, follow, update the profile, and create associations on users and posts, e.g.
+	// for reactions, with enough DESO to pay its fees for a long time.
+	TransactionSpendingLimitTemplateSocialOnly: func(builder *TransactionSpendingLimitBuilder) {
+		builder.
+			WithGlobalDESOLimit(NanosPerUnit/100).
+			WithTransactionCount(TxnTypeSubmitPost, 1000).
+			WithTransactionCount(TxnTypeLike, 10000).
+			WithTransactionCount(TxnTypeFollow, 1000).
+			WithTransactionCount(TxnTypeUpdateProfile, 100).
+			WithAssociation(AssociationClassUser, "", nil, AssociationOperationAny, 1000).
+			WithAssociation(AssociationClassPost, "", nil, AssociationOperationAny, 10000)
+	},
+	// A key that can only send messages, with enough DESO to pay its fees for a long time.
+	TransactionSpendingLimitTemplateMessagingOnly: func(builder *TransactionSpendingLimitBuilder) {
+		builder.
+			WithGlobalDESOLimit(NanosPerUnit/100).
+			WithTransactionCount(TxnTypePrivateMessage, 10000).
+			WithTransactionCount(TxnTypeNewMessage, 10000)
+	},
+	// A key that can buy and sell the creator coins of any creator, spending at most 1 $DESO. DAO coin limit
+	// orders are left out, since their limits can't cover any coin and have to be added per coin pair.
+	TransactionSpendingLimitTemplateTradingLimited: func(builder *TransactionSpendingLimitBuilder) {
+		builder.
+			WithGlobalDESOLimit(NanosPerUnit).
+			WithCreatorCoinOperation(nil, BuyCreatorCoinOperation, 100).
+			WithCreatorCoinOperation(nil, SellCreatorCoinOperation, 100)
+	},
+	// A key that can bid on any NFT and accept NFTs transferred to the user, spending at most 1 $DESO.
+	TransactionSpendingLimitTemplateNFTCollector: func(builder *TransactionSpendingLimitBuilder) {
+		builder.
+			WithGlobalDESOLimit(NanosPerUnit).
+			WithNFTOperation(nil, 0, NFTBidOperation, 100).
+			WithNFTOperation(nil, 0, AcceptNFTTransferOperation, 100)
+	},
+}
+
+// GetTransactionSpendingLimitTemplateNames returns the names of all the templates, sorted.
+func GetTransactionSpendingLimitTemplateNames() []string {
+	var names []string
+	for name := range transactionSpendingLimitTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetTransactionSpendingLimitTemplate returns a new TransactionSpendingLimit with the limits of the named template.
+func GetTransactionSpendingLimitTemplate(name string) (*TransactionSpendingLimit, error) {
+	return NewTransactionSpendingLimitFromTemplates(name)
+}
+
+// NewTransactionSpendingLimitFromTemplates returns a new TransactionSpendingLimit with the limits of all of the
+// named templates added together.
+func NewTransactionSpendingLimitFromTemplates(names ...string) (*TransactionSpendingLimit, error) {
+	builder := NewTransactionSpendingLimitBuilder()
+	for _, name := range names {
+		builder.WithTemplate(name)
+	}
+	return builder.Build()
+}
+
+// TransactionSpendingLimitBuilder builds a TransactionSpendingLimit. Limits added for the same key are added
+// together, saturating at the max value rather than overflowing, so templates and other limits can be merged
+// freely. The builder records the first invalid input it's given, and Build returns it.
+type TransactionSpendingLimitBuilder struct {
+	limit *TransactionSpendingLimit
+	err   error
+}
+
+func NewTransactionSpendingLimitBuilder() *TransactionSpendingLimitBuilder {
+	return &TransactionSpendingLimitBuilder{
+		limit: &TransactionSpendingLimit{
+			TransactionCountLimitMap:     make(map[TxnType]uint64),
+			CreatorCoinOperationLimitMap: make(map[CreatorCoinOperationLimitKey]uint64),
+			DAOCoinOperationLimitMap:     make(map[DAOCoinOperationLimitKey]uint64),
+			NFTOperationLimitMap:         make(map[NFTOperationLimitKey]uint64),
+			DAOCoinLimitOrderLimitMap:    make(map[DAOCoinLimitOrderLimitKey]uint64),
+			AssociationLimitMap:          make(map[AssociationLimitKey]uint64),
+			AccessGroupMap:               make(map[AccessGroupLimitKey]uint64),
+			AccessGroupMemberMap:         make(map[AccessGroupMemberLimitKey]uint64),
+			LockupLimitMap:               make(map[LockupLimitKey]uint64),
+			StakeLimitMap:                make(map[StakeLimitKey]*uint256.Int),
+			UnstakeLimitMap:              make(map[StakeLimitKey]*uint256.Int),
+			UnlockStakeLimitMap:          make(map[StakeLimitKey]uint64),
+		},
+	}
+}
+
+func (builder *TransactionSpendingLimitBuilder) setErr(err error) *TransactionSpendingLimitBuilder {
+	if builder.err == nil {
+		builder.err = err
+	}
+	return builder
+}
+
+func _saturatingAddUint64(aa uint64, bb uint64) uint64 {
+	if aa > math.MaxUint64-bb {
+		return math.MaxUint64
+	}
+	return aa + bb
+}
+
+func _saturatingAddUint256(aa *uint256.Int, bb *uint256.Int) *uint256.Int {
+	if aa == nil {
+		return bb.Clone()
+	}
+	sum, overflow := uint256.NewInt(0).AddOverflow(aa, bb)
+	if overflow {
+		return MaxUint256.Clone()
+	}
+	return sum
+}
+
+// _pkidOrZero returns ZeroPKID for a nil PKID, which the spending limit maps use to mean "any".
+func _pkidOrZero(pkid *PKID) PKID {
+	if pkid == nil {
+		return ZeroPKID
+	}
+	return *pkid
+}
+
+// Unlimited makes the spending limit unlimited. An unlimited spending limit can't have any other limits, so Build
+// fails if any are added.
+func (builder *TransactionSpendingLimitBuilder) Unlimited() *TransactionSpendingLimitBuilder {
+	builder.limit.IsUnlimited = true
+	return builder
+}
+
+func (builder *TransactionSpendingLimitBuilder) WithGlobalDESOLimit(nanos uint64) *TransactionSpendingLimitBuilder {
+	builder.limit.GlobalDESOLimit = _saturatingAddUint64(builder.limit.GlobalDESOLimit, nanos)
+	return builder
+}
+
+func (builder *TransactionSpendingLimitBuilder) WithTransactionCount(
+	txnType TxnType, count uint64) *TransactionSpendingLimitBuilder {
+
+	if txnType == TxnTypeUnset || txnType == TxnTypeAuthorizeDerivedKey {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithTransactionCount: Invalid transaction type %v", txnType))
+	}
+	builder.limit.TransactionCountLimitMap[txnType] = _saturatingAddUint64(
+		builder.limit.TransactionCountLimitMap[txnType], count)
+	return builder
+}
+
+// WithCreatorCoinOperation limits operations on the creator coin of creatorPKID. A nil creatorPKID means any
+// creator.
+func (builder *TransactionSpendingLimitBuilder) WithCreatorCoinOperation(
+	creatorPKID *PKID, operation CreatorCoinLimitOperation, count uint64) *TransactionSpendingLimitBuilder {
+
+	if operation >= UndefinedCreatorCoinOperation {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithCreatorCoinOperation: Invalid operation %v", operation))
+	}
+	key := MakeCreatorCoinOperationLimitKey(_pkidOrZero(creatorPKID), operation)
+	builder.limit.CreatorCoinOperationLimitMap[key] = _saturatingAddUint64(
+		builder.limit.CreatorCoinOperationLimitMap[key], count)
+	return builder
+}
+
+// WithDAOCoinOperation limits operations on the DAO coin of creatorPKID. A nil creatorPKID means any creator.
+func (builder *TransactionSpendingLimitBuilder) WithDAOCoinOperation(
+	creatorPKID *PKID, operation DAOCoinLimitOperation, count uint64) *TransactionSpendingLimitBuilder {
+
+	if operation >= UndefinedDAOCoinOperation {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithDAOCoinOperation: Invalid operation %v", operation))
+	}
+	key := MakeDAOCoinOperationLimitKey(_pkidOrZero(creatorPKID), operation)
+	builder.limit.DAOCoinOperationLimitMap[key] = _saturatingAddUint64(
+		builder.limit.DAOCoinOperationLimitMap[key], count)
+	return builder
+}
+
+// WithNFTOperation limits operations on the NFT with the given post hash and serial number. A nil postHash means
+// any NFT, and a serial number of zero means any serial number.
+func (builder *TransactionSpendingLimitBuilder) WithNFTOperation(
+	postHash *BlockHash, serialNumber uint64, operation NFTLimitOperation, count uint64,
+) *TransactionSpendingLimitBuilder {
+
+	if operation >= UndefinedNFTOperation {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithNFTOperation: Invalid operation %v", operation))
+	}
+	if postHash == nil {
+		if serialNumber != 0 {
+			return builder.setErr(fmt.Errorf(
+				"TransactionSpendingLimitBuilder.WithNFTOperation: Serial number requires a post hash"))
+		}
+		postHash = &ZeroBlockHash
+	}
+	key := MakeNFTOperationLimitKey(*postHash, serialNumber, operation)
+	builder.limit.NFTOperationLimitMap[key] = _saturatingAddUint64(builder.limit.NFTOperationLimitMap[key], count)
+	return builder
+}
+
+// WithDAOCoinLimitOrder limits DAO coin limit orders that buy the coin of buyingCreatorPKID with the coin of
+// sellingCreatorPKID. Unlike the other limits, a nil PKID here means $DESO rather than any coin.
+func (builder *TransactionSpendingLimitBuilder) WithDAOCoinLimitOrder(
+	buyingCreatorPKID *PKID, sellingCreatorPKID *PKID, count uint64) *TransactionSpendingLimitBuilder {
+
+	key := MakeDAOCoinLimitOrderLimitKey(_pkidOrZero(buyingCreatorPKID), _pkidOrZero(sellingCreatorPKID))
+	if key.BuyingDAOCoinCreatorPKID.Eq(&key.SellingDAOCoinCreatorPKID) {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithDAOCoinLimitOrder: Buying and selling coins must differ"))
+	}
+	builder.limit.DAOCoinLimitOrderLimitMap[key] = _saturatingAddUint64(
+		builder.limit.DAOCoinLimitOrderLimitMap[key], count)
+	return builder
+}
+
+// WithAssociation limits association operations of the given class and type made through appPKID. An empty
+// associationType means any type, and a nil appPKID means any app.
+func (builder *TransactionSpendingLimitBuilder) WithAssociation(
+	associationClass AssociationClass,
+	associationType string,
+	appPKID *PKID,
+	operation AssociationOperation,
+	count uint64,
+) *TransactionSpendingLimitBuilder {
+
+	if associationClass != AssociationClassUser && associationClass != AssociationClassPost {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithAssociation: Invalid association class %v", associationClass))
+	}
+	if operation != AssociationOperationAny && operation != AssociationOperationCreate &&
+		operation != AssociationOperationDelete {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithAssociation: Invalid operation %v", operation))
+	}
+	appScopeType := AssociationAppScopeTypeAny
+	if appPKID != nil {
+		appScopeType = AssociationAppScopeTypeScoped
+	}
+	key := MakeAssociationLimitKey(
+		associationClass, []byte(associationType), _pkidOrZero(appPKID), appScopeType, operation)
+	builder.limit.AssociationLimitMap[key] = _saturatingAddUint64(builder.limit.AssociationLimitMap[key], count)
+	return builder
+}
+
+// WithLockup limits lockup operations on the coin of profilePKID. A nil profilePKID means any coin.
+func (builder *TransactionSpendingLimitBuilder) WithLockup(
+	profilePKID *PKID, operation LockupLimitOperation, count uint64) *TransactionSpendingLimitBuilder {
+
+	if operation >= UndefinedCoinLockupOperation {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithLockup: Invalid operation %v", operation))
+	}
+	scopeType := LockupLimitScopeTypeAnyCoins
+	if profilePKID != nil {
+		scopeType = LockupLimitScopeTypeScopedCoins
+	}
+	key := MakeLockupLimitKey(_pkidOrZero(profilePKID), scopeType, operation)
+	builder.limit.LockupLimitMap[key] = _saturatingAddUint64(builder.limit.LockupLimitMap[key], count)
+	return builder
+}
+
+// WithStake limits the $DESO nanos that can be staked with validatorPKID. A nil validatorPKID means any validator.
+func (builder *TransactionSpendingLimitBuilder) WithStake(
+	validatorPKID *PKID, nanos *uint256.Int) *TransactionSpendingLimitBuilder {
+
+	key := MakeStakeLimitKey(&ZeroPKID)
+	if validatorPKID != nil {
+		key = MakeStakeLimitKey(validatorPKID)
+	}
+	builder.limit.StakeLimitMap[key] = _saturatingAddUint256(builder.limit.StakeLimitMap[key], nanos)
+	return builder
+}
+
+// WithUnstake limits the $DESO nanos that can be unstaked from validatorPKID. A nil validatorPKID means any
+// validator.
+func (builder *TransactionSpendingLimitBuilder) WithUnstake(
+	validatorPKID *PKID, nanos *uint256.Int) *TransactionSpendingLimitBuilder {
+
+	key := MakeStakeLimitKey(&ZeroPKID)
+	if validatorPKID != nil {
+		key = MakeStakeLimitKey(validatorPKID)
+	}
+	builder.limit.UnstakeLimitMap[key] = _saturatingAddUint256(builder.limit.UnstakeLimitMap[key], nanos)
+	return builder
+}
+
+// WithUnlockStake limits the number of times stake can be unlocked from validatorPKID. A nil validatorPKID means
+// any validator.
+func (builder *TransactionSpendingLimitBuilder) WithUnlockStake(
+	validatorPKID *PKID, count uint64) *TransactionSpendingLimitBuilder {
+
+	key := MakeStakeLimitKey(&ZeroPKID)
+	if validatorPKID != nil {
+		key = MakeStakeLimitKey(validatorPKID)
+	}
+	builder.limit.UnlockStakeLimitMap[key] = _saturatingAddUint64(builder.limit.UnlockStakeLimitMap[key], count)
+	return builder
+}
+
+// WithLimit adds all of the limits of another TransactionSpendingLimit, including access group limits, which
+// the builder has no methods for since they're scoped to the owner's public key.
+func (builder *TransactionSpendingLimitBuilder) WithLimit(
+	other *TransactionSpendingLimit) *TransactionSpendingLimitBuilder {
+
+	if other == nil {
+		return builder
+	}
+	limit := builder.limit
+	if other.IsUnlimited {
+		limit.IsUnlimited = true
+	}
+	limit.GlobalDESOLimit = _saturatingAddUint64(limit.GlobalDESOLimit, other.GlobalDESOLimit)
+	for key, count := range other.TransactionCountLimitMap {
+		limit.TransactionCountLimitMap[key] = _saturatingAddUint64(limit.TransactionCountLimitMap[key], count)
+	}
+	for key, count := range other.CreatorCoinOperationLimitMap {
+		limit.CreatorCoinOperationLimitMap[key] = _saturatingAddUint64(
+			limit.CreatorCoinOperationLimitMap[key], count)
+	}
+	for key, count := range other.DAOCoinOperationLimitMap {
+		limit.DAOCoinOperationLimitMap[key] = _saturatingAddUint64(limit.DAOCoinOperationLimitMap[key], count)
+	}
+	for key, count := range other.NFTOperationLimitMap {
+		limit.NFTOperationLimitMap[key] = _saturatingAddUint64(limit.NFTOperationLimitMap[key], count)
+	}
+	for key, count := range other.DAOCoinLimitOrderLimitMap {
+		limit.DAOCoinLimitOrderLimitMap[key] = _saturatingAddUint64(limit.DAOCoinLimitOrderLimitMap[key], count)
+	}
+	for key, count := range other.AssociationLimitMap {
+		limit.AssociationLimitMap[key] = _saturatingAddUint64(limit.AssociationLimitMap[key], count)
+	}
+	for key, count := range other.AccessGroupMap {
+		limit.AccessGroupMap[key] = _saturatingAddUint64(limit.AccessGroupMap[key], count)
+	}
+	for key, count := range other.AccessGroupMemberMap {
+		limit.AccessGroupMemberMap[key] = _saturatingAddUint64(limit.AccessGroupMemberMap[key], count)
+	}
+	for key, count := range other.LockupLimitMap {
+		limit.LockupLimitMap[key] = _saturatingAddUint64(limit.LockupLimitMap[key], count)
+	}
+	for key, nanos := range other.StakeLimitMap {
+		limit.StakeLimitMap[key] = _saturatingAddUint256(limit.StakeLimitMap[key], nanos)
+	}
+	for key, nanos := range other.UnstakeLimitMap {
+		limit.UnstakeLimitMap[key] = _saturatingAddUint256(limit.UnstakeLimitMap[key], nanos)
+	}
+	for key, count := range other.UnlockStakeLimitMap {
+		limit.UnlockStakeLimitMap[key] = _saturatingAddUint64(limit.UnlockStakeLimitMap[key], count)
+	}
+	return builder
+}
+
+// WithTemplate adds the limits of the named template.
+func (builder *TransactionSpendingLimitBuilder) WithTemplate(name string) *TransactionSpendingLimitBuilder {
+	applyTemplate, exists := transactionSpendingLimitTemplates[name]
+	if !exists {
+		return builder.setErr(fmt.Errorf(
+			"TransactionSpendingLimitBuilder.WithTemplate: Unknown template %v, must be one of %v",
+			name, GetTransactionSpendingLimitTemplateNames()))
+	}
+	applyTemplate(builder)
+	return builder
+}
+
+// Build returns a copy of the spending limit built so far, or the first error the builder ran into. The builder
+// can still be used after Build.
+func (builder *TransactionSpendingLimitBuilder) Build() (*TransactionSpendingLimit, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+	limit := builder.limit
+	if limit.IsUnlimited && (limit.GlobalDESOLimit > 0 ||
+		len(limit.TransactionCountLimitMap) > 0 ||
+		len(limit.CreatorCoinOperationLimitMap) > 0 ||
+		len(limit.DAOCoinOperationLimitMap) > 0 ||
+		len(limit.NFTOperationLimitMap) > 0 ||
+		len(limit.DAOCoinLimitOrderLimitMap) > 0 ||
+		len(limit.AssociationLimitMap) > 0 ||
+		len(limit.AccessGroupMap) > 0 ||
+		len(limit.AccessGroupMemberMap) > 0 ||
+		len(limit.LockupLimitMap) > 0 ||
+		len(limit.StakeLimitMap) > 0 ||
+		len(limit.UnstakeLimitMap) > 0 ||
+		len(limit.UnlockStakeLimitMap) > 0) {
+		return nil, errors.Wrapf(RuleErrorUnlimitedDerivedKeyNonEmptySpendingLimits,
+			"TransactionSpendingLimitBuilder.Build: ")
+	}
+	return limit.Copy(), nil
+}
+
+// ToHumanReadableString returns the lines of Describe joined by newlines.
+func (tsl *TransactionSpendingLimit) ToHumanReadableString(params *DeSoParams) string {
+	return strings.Join(tsl.Describe(params), "\n")
+}
+
+// Describe returns a plain-English sentence for every limit in the spending limit, meant to be shown to a user
+// who's asked to approve it. The output is deterministic: sections come in a fixed order, and the sentences
+// within a section are sorted. Public keys are rendered in base58, and "any" keys are spelled out.
+func (tsl *TransactionSpendingLimit) Describe(params *DeSoParams) []string {
+	if tsl.IsUnlimited {
+		return []string{"Perform any transaction, with no spending limits"}
+	}
+
+	var lines []string
+	var section []string
+	addSection := func() {
+		sort.Strings(section)
+		lines = append(lines, section...)
+		section = nil
+	}
+	// addOperation adds a sentence for a count-limited operation. An empty operation word means any operation, and
+	// target includes its preposition.
+	addOperation := func(count uint64, operation string, noun string, target string) {
+		if operation != "" {
+			operation += " "
+		}
+		section = append(section, fmt.Sprintf("Make up to %v %v%v operations %v", count, operation, noun, target))
+	}
+	pkidString := func(pkid PKID) string {
+		return Base58CheckEncode(pkid.ToBytes(), false, params)
+	}
+	nanosString := func(nanos *big.Int) string {
+		return FormatScaledUint256AsDecimalString(nanos, big.NewInt(int64(NanosPerUnit))) + " $DESO"
+	}
+	validatorString := func(key StakeLimitKey) string {
+		if key.ValidatorPKID.Eq(&ZeroPKID) {
+			return "any validator"
+		}
+		return "validator " + pkidString(key.ValidatorPKID)
+	}
+	accessGroupString := func(owner PublicKey, scopeType AccessGroupScopeType, keyName GroupKeyName) string {
+		ownerString := Base58CheckEncode(owner.ToBytes(), false, params)
+		if scopeType == AccessGroupScopeTypeScoped {
+			return fmt.Sprintf("on access group %v owned by %v", string(AccessKeyNameDecode(&keyName)), ownerString)
+		}
+		return "on any access group owned by " + ownerString
+	}
+
+	if tsl.GlobalDESOLimit > 0 {
+		lines = append(lines, fmt.Sprintf("Spend up to %v in total",
+			nanosString(big.NewInt(0).SetUint64(tsl.GlobalDESOLimit))))
+	}
+
+	for txnType, count := range tsl.TransactionCountLimitMap {
+		section = append(section, fmt.Sprintf("Submit up to %v %v transactions", count, txnType.String()))
+	}
+	addSection()
+
+	for key, count := range tsl.CreatorCoinOperationLimitMap {
+		target := "on any creator coin"
+		if !key.CreatorPKID.Eq(&ZeroPKID) {
+			target = "on the creator coin of " + pkidString(key.CreatorPKID)
+		}
+		addOperation(count, _creatorCoinLimitOperationWord(key.Operation), "creator coin", target)
+	}
+	addSection()
+
+	for key, count := range tsl.DAOCoinOperationLimitMap {
+		target := "on any DAO coin"
+		if !key.CreatorPKID.Eq(&ZeroPKID) {
+			target = "on the DAO coin of " + pkidString(key.CreatorPKID)
+		}
+		addOperation(count, _daoCoinLimitOperationWord(key.Operation), "DAO coin", target)
+	}
+	addSection()
+
+	for key, count := range tsl.NFTOperationLimitMap {
+		target := "on any NFT"
+		if key.BlockHash != ZeroBlockHash && key.SerialNumber == 0 {
+			target = "on any serial number of NFT " + key.BlockHash.String()
+		} else if key.BlockHash != ZeroBlockHash {
+			target = fmt.Sprintf("on serial number %v of NFT %v", key.SerialNumber, key.BlockHash.String())
+		}
+		addOperation(count, _nftLimitOperationWord(key.Operation), "NFT", target)
+	}
+	addSection()
+
+	for key, count := range tsl.DAOCoinLimitOrderLimitMap {
+		// A zero PKID in a limit order key is $DESO, not any coin.
+		coinString := func(pkid PKID) string {
+			if pkid.Eq(&ZeroPKID) {
+				return "$DESO"
+			}
+			return "the DAO coin of " + pkidString(pkid)
+		}
+		section = append(section, fmt.Sprintf("Place up to %v DAO coin limit orders buying %v with %v",
+			count, coinString(key.BuyingDAOCoinCreatorPKID), coinString(key.SellingDAOCoinCreatorPKID)))
+	}
+	addSection()
+
+	for key, count := range tsl.AssociationLimitMap {
+		target := "of any type"
+		if key.AssociationType != "" {
+			target = "of type " + strings.ToUpper(key.AssociationType)
+		}
+		if key.AppScopeType == AssociationAppScopeTypeScoped {
+			target += " through app " + pkidString(key.AppPKID)
+		} else {
+			target += " through any app"
+		}
+		addOperation(count, _associationOperationWord(key.Operation),
+			strings.ToLower(key.AssociationClass.ToString())+" association", target)
+	}
+	addSection()
+
+	for key, count := range tsl.AccessGroupMap {
+		addOperation(count, _accessGroupOperationWord(key.OperationType), "access group", accessGroupString(
+			key.AccessGroupOwnerPublicKey, key.AccessGroupScopeType, key.AccessGroupKeyName))
+	}
+	addSection()
+
+	for key, count := range tsl.AccessGroupMemberMap {
+		addOperation(count, _accessGroupMemberOperationWord(key.OperationType), "access group member",
+			accessGroupString(key.AccessGroupOwnerPublicKey, key.AccessGroupScopeType, key.AccessGroupKeyName))
+	}
+	addSection()
+
+	for key, count := range tsl.LockupLimitMap {
+		target := "on any coin"
+		if key.ScopeType == LockupLimitScopeTypeScopedCoins {
+			target = "on the coin of " + pkidString(key.ProfilePKID)
+		}
+		addOperation(count, _lockupLimitOperationWord(key.Operation), "lockup", target)
+	}
+	addSection()
+
+	for key, nanos := range tsl.StakeLimitMap {
+		section = append(section, fmt.Sprintf("Stake up to %v with %v",
+			nanosString(nanos.ToBig()), validatorString(key)))
+	}
+	addSection()
+
+	for key, nanos := range tsl.UnstakeLimitMap {
+		section = append(section, fmt.Sprintf("Unstake up to %v from %v",
+			nanosString(nanos.ToBig()), validatorString(key)))
+	}
+	addSection()
+
+	for key, count := range tsl.UnlockStakeLimitMap {
+		section = append(section, fmt.Sprintf("Unlock stake up to %v times from %v", count, validatorString(key)))
+	}
+	addSection()
+
+	if len(lines) == 0 {
+		return []string{"No transactions are allowed"}
+	}
+	return lines
+}
+
+// The operation words below are spelled out rather than derived from the operations' ToString, since those strings
+// are part of the JSON API and aren't worded consistently. The "any" operations have no word.
+
+func _creatorCoinLimitOperationWord(operation CreatorCoinLimitOperation) string {
+	switch operation {
+	case BuyCreatorCoinOperation:
+		return "buy"
+	case SellCreatorCoinOperation:
+		return "sell"
+	case TransferCreatorCoinOperation:
+		return "transfer"
+	default:
+		return ""
+	}
+}
+
+func _daoCoinLimitOperationWord(operation DAOCoinLimitOperation) string {
+	switch operation {
+	case MintDAOCoinOperation:
+		return "mint"
+	case BurnDAOCoinOperation:
+		return "burn"
+	case DisableMintingDAOCoinOperation:
+		return "disable minting"
+	case UpdateTransferRestrictionStatusDAOCoinOperation:
+		return "update transfer restriction"
+	case TransferDAOCoinOperation:
+		return "transfer"
+	default:
+		return ""
+	}
+}
+
+func _nftLimitOperationWord(operation NFTLimitOperation) string {
+	switch operation {
+	case UpdateNFTOperation:
+		return "update"
+	case AcceptNFTBidOperation:
+		return "accept bid"
+	case NFTBidOperation:
+		return "bid"
+	case TransferNFTOperation:
+		return "transfer"
+	case BurnNFTOperation:
+		return "burn"
+	case AcceptNFTTransferOperation:
+		return "accept transfer"
+	default:
+		return ""
+	}
+}
+
+func _associationOperationWord(operation AssociationOperation) string {
+	switch operation {
+	case AssociationOperationCreate:
+		return "create"
+	case AssociationOperationDelete:
+		return "delete"
+	default:
+		return ""
+	}
+}
+
+func _accessGroupOperationWord(operation AccessGroupOperationType) string {
+	switch operation {
+	case AccessGroupOperationTypeCreate:
+		return "create"
+	case AccessGroupOperationTypeUpdate:
+		return "update"
+	default:
+		return ""
+	}
+}
+
+func _accessGroupMemberOperationWord(operation AccessGroupMemberOperationType) string {
+	switch operation {
+	case AccessGroupMemberOperationTypeAdd:
+		return "add"
+	case AccessGroupMemberOperationTypeRemove:
+		return "remove"
+	case AccessGroupMemberOperationTypeUpdate:
+		return "update"
+	default:
+		return ""
+	}
+}
+
+func _lockupLimitOperationWord(operation LockupLimitOperation) string {
+	switch operation {
+	case CoinLockupOperation:
+		return "lock"
+	case UpdateCoinLockupYieldCurveOperation:
+		return "update yield curve"
+	case UpdateCoinLockupTransferRestrictionsOperation:
+		return "update transfer restriction"
+	case CoinLockupTransferOperation:
+		return "transfer"
+	case CoinLockupUnlockOperation:
+		return "unlock"
+	default:
+		return ""
+	}
+}
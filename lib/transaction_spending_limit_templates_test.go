@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionSpendingLimitTemplates(t *testing.T) {
+	require := require.New(t)
+	params := &DeSoTestnetParams
+	blockHeight := uint64(params.ForkHeights.LockupsBlockHeight)
+
+	require.Equal([]string{
+		TransactionSpendingLimitTemplateMessagingOnly,
+		TransactionSpendingLimitTemplateNFTCollector,
+		TransactionSpendingLimitTemplateSocialOnly,
+		TransactionSpendingLimitTemplateTradingLimited,
+	}, GetTransactionSpendingLimitTemplateNames())
+
+	// Every template builds, and round trips through its encoding.
+	for _, name := range GetTransactionSpendingLimitTemplateNames() {
+		limit, err := GetTransactionSpendingLimitTemplate(name)
+		require.NoError(err, name)
+		require.NotEmpty(limit.Describe(params), name)
+
+		limitBytes, err := limit.ToBytes(blockHeight)
+		require.NoError(err, name)
+		decodedLimit := &TransactionSpendingLimit{}
+		require.NoError(decodedLimit.FromBytes(blockHeight, bytes.NewReader(limitBytes)), name)
+		require.Equal(limit.ToHumanReadableString(params), decodedLimit.ToHumanReadableString(params), name)
+	}
+
+	// Each template gets its own maps.
+	socialOnly, err := GetTransactionSpendingLimitTemplate(TransactionSpendingLimitTemplateSocialOnly)
+	require.NoError(err)
+	socialOnly.TransactionCountLimitMap[TxnTypeSubmitPost] = 1
+	socialOnly, err = GetTransactionSpendingLimitTemplate(TransactionSpendingLimitTemplateSocialOnly)
+	require.NoError(err)
+	require.Equal(uint64(1000), socialOnly.TransactionCountLimitMap[TxnTypeSubmitPost])
+
+	// Templates compose, and their limits add up.
+	combined, err := NewTransactionSpendingLimitFromTemplates(
+		TransactionSpendingLimitTemplateSocialOnly, TransactionSpendingLimitTemplateTradingLimited)
+	require.NoError(err)
+	require.Equal(NanosPerUnit/100+NanosPerUnit, combined.GlobalDESOLimit)
+	require.Equal(uint64(1000), combined.TransactionCountLimitMap[TxnTypeSubmitPost])
+	require.Equal(uint64(100), combined.CreatorCoinOperationLimitMap[MakeCreatorCoinOperationLimitKey(
+		ZeroPKID, BuyCreatorCoinOperation)])
+
+	_, err = NewTransactionSpendingLimitFromTemplates("not-a-template")
+	require.Error(err)
+}
+
+func TestTransactionSpendingLimitBuilder(t *testing.T) {
+	require := require.New(t)
+
+	// Counts saturate rather than overflow.
+	limit, err := NewTransactionSpendingLimitBuilder().
+		WithTransactionCount(TxnTypeSubmitPost, math.MaxUint64).
+		WithTransactionCount(TxnTypeSubmitPost, 10).
+		WithStake(nil, MaxUint256).
+		WithStake(nil, uint256.NewInt(1)).
+		Build()
+	require.NoError(err)
+	require.Equal(uint64(math.MaxUint64), limit.TransactionCountLimitMap[TxnTypeSubmitPost])
+	require.True(limit.StakeLimitMap[MakeStakeLimitKey(&ZeroPKID)].Eq(MaxUint256))
+
+	// The first invalid input is returned by Build.
+	_, err = NewTransactionSpendingLimitBuilder().
+		WithTransactionCount(TxnTypeSubmitPost, 1).
+		WithCreatorCoinOperation(nil, UndefinedCreatorCoinOperation, 1).
+		Build()
+	require.Error(err)
+	_, err = NewTransactionSpendingLimitBuilder().WithNFTOperation(nil, 1, NFTBidOperation, 1).Build()
+	require.Error(err)
+	_, err = NewTransactionSpendingLimitBuilder().WithDAOCoinLimitOrder(nil, nil, 1).Build()
+	require.Error(err)
+
+	// An unlimited spending limit can't have other limits.
+	limit, err = NewTransactionSpendingLimitBuilder().Unlimited().Build()
+	require.NoError(err)
+	require.True(limit.IsUnlimited)
+	_, err = NewTransactionSpendingLimitBuilder().Unlimited().WithGlobalDESOLimit(1).Build()
+	require.Error(err)
+
+	// WithLimit merges another limit, and Build returns a copy.
+	builder := NewTransactionSpendingLimitBuilder().WithLimit(limit)
+	merged, err := builder.Build()
+	require.NoError(err)
+	require.True(merged.IsUnlimited)
+	merged.IsUnlimited = false
+	merged, err = builder.Build()
+	require.NoError(err)
+	require.True(merged.IsUnlimited)
+}
+
+func TestTransactionSpendingLimitDescribe(t *testing.T) {
+	require := require.New(t)
+	params := &DeSoTestnetParams
+
+	creatorPKID := NewPKID(m0PkBytes)
+	creatorBase58 := Base58CheckEncode(creatorPKID.ToBytes(), false, params)
+	postHash := NewBlockHash(RandomBytes(HashSizeBytes))
+
+	limit, err := NewTransactionSpendingLimitBuilder().
+		WithGlobalDESOLimit(NanosPerUnit+NanosPerUnit/2).
+		WithTransactionCount(TxnTypeSubmitPost, 10).
+		WithTransactionCount(TxnTypeLike, 5).
+		WithCreatorCoinOperation(nil, BuyCreatorCoinOperation, 3).
+		WithCreatorCoinOperation(creatorPKID, AnyCreatorCoinOperation, 2).
+		WithNFTOperation(postHash, 0, NFTBidOperation, 4).
+		WithDAOCoinLimitOrder(creatorPKID, nil, 6).
+		WithAssociation(AssociationClassPost, "reaction", nil, AssociationOperationCreate, 7).
+		WithStake(creatorPKID, uint256.NewInt(2*NanosPerUnit)).
+		WithUnlockStake(nil, 8).
+		Build()
+	require.NoError(err)
+
+	require.Equal([]string{
+		"Spend up to 1.5 $DESO in total",
+		"Submit up to 10 SUBMIT_POST transactions",
+		"Submit up to 5 LIKE transactions",
+		"Make up to 2 creator coin operations on the creator coin of " + creatorBase58,
+		"Make up to 3 buy creator coin operations on any creator coin",
+		"Make up to 4 bid NFT operations on any serial number of NFT " + postHash.String(),
+		"Place up to 6 DAO coin limit orders buying the DAO coin of " + creatorBase58 + " with $DESO",
+		"Make up to 7 create post association operations of type REACTION through any app",
+		"Stake up to 2.0 $DESO with validator " + creatorBase58,
+		"Unlock stake up to 8 times from any validator",
+	}, limit.Describe(params))
+
+	// The description doesn't depend on map iteration order.
+	for ii := 0; ii < 10; ii++ {
+		require.Equal(limit.ToHumanReadableString(params), limit.Copy().ToHumanReadableString(params))
+	}
+
+	unlimited, err := NewTransactionSpendingLimitBuilder().Unlimited().Build()
+	require.NoError(err)
+	require.Equal("Perform any transaction, with no spending limits", unlimited.ToHumanReadableString(params))
+
+	empty, err := NewTransactionSpendingLimitBuilder().Build()
+	require.NoError(err)
+	require.Equal("No transactions are allowed", empty.ToHumanReadableString(params))
+}
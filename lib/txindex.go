@@ -6,6 +6,7 @@ import (
 	"github.com/deso-protocol/go-deadlock"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -317,6 +318,18 @@ func (txi *TXIndex) Update() error {
 						"transaction mappings for transaction %v: %v", txn.Hash(), err)
 				}
 			}
+			if err := DbDeleteTxindexUsernameHistoryForHeightWithTxn(dbTxn, nil,
+				uint64(blockToDetach.Height), txi.CoreChain.eventManager, true); err != nil {
+
+				return fmt.Errorf("Update: Problem deleting username history "+
+					"for block %v: %v", blockToDetach.Hash, err)
+			}
+			if err := DbDeleteTxindexDiamondsForHeightWithTxn(dbTxn, nil,
+				uint64(blockToDetach.Height), txi.CoreChain.eventManager, true); err != nil {
+
+				return fmt.Errorf("Update: Problem deleting diamonds "+
+					"for block %v: %v", blockToDetach.Hash, err)
+			}
 			return nil
 		})
 		if err != nil {
@@ -425,6 +438,8 @@ func (txi *TXIndex) Update() error {
 			// - Compute its mapping values, which may include custom metadata fields
 			// - add all its mappings to the db.
 			for txnIndexInBlock, txn := range blockMsg.Txns {
+				usernamesBefore := _getProfileUsernamesForTxn(txn, utxoView)
+				diamondRecords := _getDiamondRecordsForTxn(txn, utxoView)
 				txnMeta, err := ConnectTxnAndComputeTransactionMetadata(
 					txn, utxoView, blockToAttach.Hash, blockToAttach.Height,
 					blockToAttach.Header.TstampNanoSecs, uint64(txnIndexInBlock))
@@ -433,6 +448,44 @@ func (txi *TXIndex) Update() error {
 						txn, err)
 				}
 
+				// Record any usernames the txn claimed or released in the username history.
+				for pkidIter, usernameBefore := range usernamesBefore {
+					pkid := pkidIter
+					usernameAfter := _getProfileUsernameForPKID(&pkid, utxoView)
+					if usernameAfter == usernameBefore {
+						continue
+					}
+					if usernameBefore != "" {
+						if err = DbPutTxindexUsernameHistoryWithTxn(dbTxn, nil, []byte(usernameBefore),
+							uint64(blockToAttach.Height), nil, txi.CoreChain.eventManager); err != nil {
+							return fmt.Errorf("Update: Problem releasing username for txn %v: %v", txn.Hash(), err)
+						}
+					}
+					if usernameAfter != "" {
+						if err = DbPutTxindexUsernameHistoryWithTxn(dbTxn, nil, []byte(usernameAfter),
+							uint64(blockToAttach.Height), &pkid, txi.CoreChain.eventManager); err != nil {
+							return fmt.Errorf("Update: Problem claiming username for txn %v: %v", txn.Hash(), err)
+						}
+					}
+				}
+
+				// Record any diamonds the txn gave.
+				for _, diamondRecord := range diamondRecords {
+					diamondKey := MakeDiamondKey(
+						diamondRecord.SenderPKID, diamondRecord.ReceiverPKID, diamondRecord.DiamondPostHash)
+					diamondEntry := utxoView.GetDiamondEntryForDiamondKey(&diamondKey)
+					if diamondEntry == nil || diamondEntry.isDeleted ||
+						diamondEntry.DiamondLevel == diamondRecord.PrevDiamondLevel {
+						continue
+					}
+					diamondRecord.DiamondLevel = diamondEntry.DiamondLevel
+					diamondRecord.BlockHeight = uint64(blockToAttach.Height)
+					if err = DbPutTxindexDiamondWithTxn(dbTxn, nil, diamondRecord,
+						txi.CoreChain.eventManager); err != nil {
+						return fmt.Errorf("Update: Problem adding diamond for txn %v: %v", txn.Hash(), err)
+					}
+				}
+
 				err = DbPutTxindexTransactionMappingsWithTxn(dbTxn, nil, blockMsg.Header.Height,
 					txn, txi.Params, txnMeta, txi.CoreChain.eventManager)
 				if err != nil {
@@ -461,6 +514,102 @@ func (txi *TXIndex) Update() error {
 	return nil
 }
 
+// GetPKIDForUsernameAtHeight returns the PKID that held the username as of the block height, or nil if no one
+// held it at the time. Unlike a lookup in the core chain, this returns the original holder of a username that
+// has since been changed or released, which is what's needed to attribute old transactions.
+func (txi *TXIndex) GetPKIDForUsernameAtHeight(username []byte, blockHeight uint64) (*PKID, error) {
+	pkid, err := DbGetTxindexPKIDForUsernameAtHeight(txi.TXIndexChain.DB(), username, blockHeight)
+	if err != nil {
+		return nil, fmt.Errorf("GetPKIDForUsernameAtHeight: Problem getting PKID for username %v: %v",
+			string(username), err)
+	}
+	return pkid, nil
+}
+
+// _getProfileUsernamesForTxn returns the lowercased usernames of the profiles the txn can change, keyed by the
+// profile's PKID. A profile without a username maps to an empty string. Only UpdateProfile txns, including the
+// ones inside an atomic txn, can change a username.
+func _getProfileUsernamesForTxn(txn *MsgDeSoTxn, utxoView *UtxoView) map[PKID]string {
+	usernames := make(map[PKID]string)
+	switch txnMeta := txn.TxnMeta.(type) {
+	case *UpdateProfileMetadata:
+		profilePublicKey := txn.PublicKey
+		if len(txnMeta.ProfilePublicKey) != 0 {
+			profilePublicKey = txnMeta.ProfilePublicKey
+		}
+		pkidEntry := utxoView.GetPKIDForPublicKey(profilePublicKey)
+		if pkidEntry == nil || pkidEntry.isDeleted {
+			return usernames
+		}
+		usernames[*pkidEntry.PKID] = _getProfileUsernameForPKID(pkidEntry.PKID, utxoView)
+	case *AtomicTxnsWrapperMetadata:
+		for _, innerTxn := range txnMeta.Txns {
+			for pkid, username := range _getProfileUsernamesForTxn(innerTxn, utxoView) {
+				usernames[pkid] = username
+			}
+		}
+	}
+	return usernames
+}
+
+// _getDiamondRecordsForTxn returns a record for each diamond the txn can give, with the sender's current level on
+// the post as the PrevDiamondLevel. Diamonds are given by BasicTransfer and CreatorCoinTransfer txns that have a
+// DiamondPostHashKey in their ExtraData, including the ones inside an atomic txn.
+func _getDiamondRecordsForTxn(txn *MsgDeSoTxn, utxoView *UtxoView) []*TxindexDiamondRecord {
+	var receiverPublicKey []byte
+	switch txnMeta := txn.TxnMeta.(type) {
+	case *BasicTransferMetadata, *CreatorCoinTransferMetadataa:
+	case *AtomicTxnsWrapperMetadata:
+		var records []*TxindexDiamondRecord
+		for _, innerTxn := range txnMeta.Txns {
+			records = append(records, _getDiamondRecordsForTxn(innerTxn, utxoView)...)
+		}
+		return records
+	default:
+		return nil
+	}
+
+	diamondPostHashBytes, hasDiamondPostHash := txn.ExtraData[DiamondPostHashKey]
+	if !hasDiamondPostHash || len(diamondPostHashBytes) != HashSizeBytes {
+		return nil
+	}
+	diamondPostHash := &BlockHash{}
+	copy(diamondPostHash[:], diamondPostHashBytes)
+	if txnMeta, ok := txn.TxnMeta.(*CreatorCoinTransferMetadataa); ok {
+		receiverPublicKey = txnMeta.ReceiverPublicKey
+	} else {
+		postEntry := utxoView.GetPostEntryForPostHash(diamondPostHash)
+		if postEntry == nil || postEntry.isDeleted {
+			return nil
+		}
+		receiverPublicKey = postEntry.PosterPublicKey
+	}
+
+	senderPKIDEntry := utxoView.GetPKIDForPublicKey(txn.PublicKey)
+	receiverPKIDEntry := utxoView.GetPKIDForPublicKey(receiverPublicKey)
+	if senderPKIDEntry == nil || senderPKIDEntry.isDeleted || receiverPKIDEntry == nil || receiverPKIDEntry.isDeleted {
+		return nil
+	}
+	record := &TxindexDiamondRecord{
+		SenderPKID:      senderPKIDEntry.PKID.NewPKID(),
+		ReceiverPKID:    receiverPKIDEntry.PKID.NewPKID(),
+		DiamondPostHash: diamondPostHash,
+	}
+	diamondKey := MakeDiamondKey(record.SenderPKID, record.ReceiverPKID, diamondPostHash)
+	if diamondEntry := utxoView.GetDiamondEntryForDiamondKey(&diamondKey); diamondEntry != nil && !diamondEntry.isDeleted {
+		record.PrevDiamondLevel = diamondEntry.DiamondLevel
+	}
+	return []*TxindexDiamondRecord{record}
+}
+
+func _getProfileUsernameForPKID(pkid *PKID, utxoView *UtxoView) string {
+	profileEntry := utxoView.GetProfileEntryForPKID(pkid)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return ""
+	}
+	return strings.ToLower(string(profileEntry.Username))
+}
+
 func ConnectTxnAndComputeTransactionMetadata(
 	txn *MsgDeSoTxn, utxoView *UtxoView, blockHash *BlockHash,
 	blockHeight uint32, blockTimestampNanoSecs int64, txnIndexInBlock uint64) (*TransactionMetadata, error) {
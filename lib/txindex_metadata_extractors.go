@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Txindex Metadata Extractors
+//
+// The TransactionMetadata computed for each txn only holds the fields core knows how to derive for its TxnType.
+// Apps built on DeSo often layer their own conventions on top of that, most commonly through ExtraData keys, and the
+// only way to surface those in the txindex used to be forking ComputeTransactionMetadata. Instead, an embedder can
+// register a TxindexMetadataExtractor. ComputeTransactionMetadata runs every registered extractor on each txn after
+// computing the built-in metadata, and stores the output of each one in TransactionMetadata.ExtractedTxindexMetadata
+// under the extractor's name. The output is then persisted in the txindex and returned along with the built-in
+// metadata, including for the txns in the mempool and the inner txns of atomic txns.
+//
+// Extractors should be registered before the node starts, so that every txn it indexes goes through the same set of
+// extractors. An extractor's output is only persisted in the txindex from the TxindexExtractedMetadataBlockHeight on.
+
+// TxindexMetadataExtractor derives additional metadata for the txns indexed by the node.
+type TxindexMetadataExtractor interface {
+	// GetName returns the name under which the extractor's output is stored. It must be unique among the registered
+	// extractors.
+	GetName() string
+
+	// ExtractMetadata returns the metadata the extractor derives for txn. txnMeta holds the built-in metadata computed
+	// for the txn, and utxoView the state after the txn was connected. Returning an empty map means the extractor has
+	// nothing to add for the txn. An extractor that returns an error is skipped for the txn rather than failing the
+	// indexing of the txn.
+	ExtractMetadata(txn *MsgDeSoTxn, txnMeta *TransactionMetadata, utxoView *UtxoView, utxoOps []*UtxoOperation,
+		blockHeight uint64) (map[string]string, error)
+}
+
+// txindexMetadataExtractors holds the registered extractors, in the order they were registered.
+var (
+	txindexMetadataExtractorsLock sync.RWMutex
+	txindexMetadataExtractors     []TxindexMetadataExtractor
+)
+
+// RegisterTxindexMetadataExtractor adds an extractor to the ones run by ComputeTransactionMetadata.
+func RegisterTxindexMetadataExtractor(extractor TxindexMetadataExtractor) error {
+	if extractor == nil {
+		return fmt.Errorf("RegisterTxindexMetadataExtractor: Extractor is nil")
+	}
+	name := extractor.GetName()
+	if name == "" {
+		return fmt.Errorf("RegisterTxindexMetadataExtractor: Extractor name is empty")
+	}
+
+	txindexMetadataExtractorsLock.Lock()
+	defer txindexMetadataExtractorsLock.Unlock()
+	for _, registeredExtractor := range txindexMetadataExtractors {
+		if registeredExtractor.GetName() == name {
+			return fmt.Errorf("RegisterTxindexMetadataExtractor: An extractor named %v is already registered", name)
+		}
+	}
+	txindexMetadataExtractors = append(txindexMetadataExtractors, extractor)
+	return nil
+}
+
+// UnregisterTxindexMetadataExtractor removes the extractor with the given name, if there is one.
+func UnregisterTxindexMetadataExtractor(name string) {
+	txindexMetadataExtractorsLock.Lock()
+	defer txindexMetadataExtractorsLock.Unlock()
+	for ii, registeredExtractor := range txindexMetadataExtractors {
+		if registeredExtractor.GetName() == name {
+			txindexMetadataExtractors = append(txindexMetadataExtractors[:ii:ii], txindexMetadataExtractors[ii+1:]...)
+			return
+		}
+	}
+}
+
+// GetTxindexMetadataExtractors returns the registered extractors, in the order they were registered.
+func GetTxindexMetadataExtractors() []TxindexMetadataExtractor {
+	txindexMetadataExtractorsLock.RLock()
+	defer txindexMetadataExtractorsLock.RUnlock()
+	return append([]TxindexMetadataExtractor{}, txindexMetadataExtractors...)
+}
+
+// ExtractTxindexMetadata runs the registered extractors on a txn and returns their output. Extractors that fail or
+// have nothing to add for the txn are left out.
+func ExtractTxindexMetadata(txn *MsgDeSoTxn, txnMeta *TransactionMetadata, utxoView *UtxoView,
+	utxoOps []*UtxoOperation, blockHeight uint64) []*ExtractedTxindexMetadata {
+
+	var extractedMetadataList []*ExtractedTxindexMetadata
+	for _, extractor := range GetTxindexMetadataExtractors() {
+		metadata, err := extractor.ExtractMetadata(txn, txnMeta, utxoView, utxoOps, blockHeight)
+		if err != nil {
+			glog.V(2).Infof("ExtractTxindexMetadata: Extractor %v failed for txn %v: %v",
+				extractor.GetName(), txn.Hash(), err)
+			continue
+		}
+		if len(metadata) == 0 {
+			continue
+		}
+		extractedMetadataList = append(extractedMetadataList, &ExtractedTxindexMetadata{
+			ExtractorName: extractor.GetName(),
+			Metadata:      metadata,
+		})
+	}
+	return extractedMetadataList
+}
+
+// ExtractedTxindexMetadata holds the output of a TxindexMetadataExtractor for a txn.
+type ExtractedTxindexMetadata struct {
+	ExtractorName string
+	Metadata      map[string]string
+}
+
+func (txnMeta *ExtractedTxindexMetadata) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+
+	data = append(data, EncodeByteArray([]byte(txnMeta.ExtractorName))...)
+
+	// Sort the keys so that the encoding is deterministic.
+	keys := make([]string, 0, len(txnMeta.Metadata))
+	for key := range txnMeta.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	data = append(data, UintToBuf(uint64(len(keys)))...)
+	for _, key := range keys {
+		data = append(data, EncodeByteArray([]byte(key))...)
+		data = append(data, EncodeByteArray([]byte(txnMeta.Metadata[key]))...)
+	}
+	return data
+}
+
+func (txnMeta *ExtractedTxindexMetadata) RawDecodeWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	extractorNameBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ExtractedTxindexMetadata.Decode: problem reading ExtractorName")
+	}
+	txnMeta.ExtractorName = string(extractorNameBytes)
+
+	numKeys, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "ExtractedTxindexMetadata.Decode: problem reading len Metadata")
+	}
+	txnMeta.Metadata, err = SafeMakeMapWithCapacity[string, string](numKeys)
+	if err != nil {
+		return errors.Wrapf(err, "ExtractedTxindexMetadata.Decode: problem allocating Metadata")
+	}
+	for ii := uint64(0); ii < numKeys; ii++ {
+		keyBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ExtractedTxindexMetadata.Decode: problem reading Metadata key")
+		}
+		valueBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "ExtractedTxindexMetadata.Decode: problem reading Metadata value")
+		}
+		txnMeta.Metadata[string(keyBytes)] = string(valueBytes)
+	}
+	return nil
+}
+
+func (txnMeta *ExtractedTxindexMetadata) GetVersionByte(blockHeight uint64) byte {
+	return 0
+}
+
+func (txnMeta *ExtractedTxindexMetadata) GetEncoderType() EncoderType {
+	return EncoderTypeExtractedTxindexMetadata
+}
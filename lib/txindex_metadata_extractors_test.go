@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testAppMetadataExtractor surfaces the ExtraData keys an app attaches to its txns.
+type testAppMetadataExtractor struct {
+	name string
+}
+
+func (extractor *testAppMetadataExtractor) GetName() string {
+	return extractor.name
+}
+
+func (extractor *testAppMetadataExtractor) ExtractMetadata(txn *MsgDeSoTxn, txnMeta *TransactionMetadata,
+	utxoView *UtxoView, utxoOps []*UtxoOperation, blockHeight uint64) (map[string]string, error) {
+
+	if _, exists := txn.ExtraData["invalid"]; exists {
+		return nil, fmt.Errorf("invalid ExtraData")
+	}
+	category, exists := txn.ExtraData["app:category"]
+	if !exists {
+		return nil, nil
+	}
+	return map[string]string{"category": string(category), "txnType": txnMeta.TxnType}, nil
+}
+
+func TestTxindexMetadataExtractors(t *testing.T) {
+	require := require.New(t)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+
+	appExtractor := &testAppMetadataExtractor{name: "app"}
+	require.NoError(RegisterTxindexMetadataExtractor(appExtractor))
+	defer UnregisterTxindexMetadataExtractor("app")
+	require.Error(RegisterTxindexMetadataExtractor(&testAppMetadataExtractor{name: "app"}))
+	require.Error(RegisterTxindexMetadataExtractor(&testAppMetadataExtractor{}))
+	require.Error(RegisterTxindexMetadataExtractor(nil))
+	require.NoError(RegisterTxindexMetadataExtractor(&testAppMetadataExtractor{name: "other"}))
+	UnregisterTxindexMetadataExtractor("other")
+	require.Equal([]TxindexMetadataExtractor{appExtractor}, GetTxindexMetadataExtractors())
+
+	computeTxnMeta := func(extraData map[string][]byte) *TransactionMetadata {
+		txn := &MsgDeSoTxn{
+			TxnMeta:   &BasicTransferMetadata{},
+			PublicKey: m0PkBytes,
+			ExtraData: extraData,
+		}
+		return ComputeTransactionMetadata(txn, utxoView, nil, 0, 0, 0, 0, 0, 0, nil, 1)
+	}
+
+	// The extractor's output is added to the built-in metadata.
+	txnMeta := computeTxnMeta(map[string][]byte{"app:category": []byte("music")})
+	require.Equal([]*ExtractedTxindexMetadata{{
+		ExtractorName: "app",
+		Metadata:      map[string]string{"category": "music", "txnType": TxnTypeBasicTransfer.String()},
+	}}, txnMeta.ExtractedTxindexMetadata)
+	require.NotNil(txnMeta.BasicTransferTxindexMetadata)
+
+	// Extractors that fail or have nothing to add are left out.
+	require.Empty(computeTxnMeta(nil).ExtractedTxindexMetadata)
+	require.Empty(computeTxnMeta(map[string][]byte{
+		"app:category": []byte("music"),
+		"invalid":      {},
+	}).ExtractedTxindexMetadata)
+
+	// The extracted metadata is only encoded from the TxindexExtractedMetadataMigration on.
+	migrationHeight := GlobalDeSoParams.EncoderMigrationHeights.TxindexExtractedMetadataMigration.Height
+	decodedTxnMeta := &TransactionMetadata{}
+	exists, err := DecodeFromBytes(decodedTxnMeta, bytes.NewReader(EncodeToBytes(migrationHeight, txnMeta)))
+	require.NoError(err)
+	require.True(exists)
+	require.Equal(txnMeta.ExtractedTxindexMetadata, decodedTxnMeta.ExtractedTxindexMetadata)
+	if migrationHeight > 0 {
+		decodedTxnMeta = &TransactionMetadata{}
+		_, err = DecodeFromBytes(decodedTxnMeta, bytes.NewReader(EncodeToBytes(migrationHeight-1, txnMeta)))
+		require.NoError(err)
+		require.Empty(decodedTxnMeta.ExtractedTxindexMetadata)
+	}
+}
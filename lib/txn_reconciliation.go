@@ -0,0 +1,646 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/deso-protocol/go-deadlock"
+	"github.com/pkg/errors"
+)
+
+// Transaction Reconciliation
+//
+// Relaying a transaction by flooding costs every connection an INV for it, even though all but one of the INVs a
+// well-connected node receives for a transaction announce a transaction it already has. Transaction reconciliation
+// replaces most of those INVs with a periodic exchange of sketches, whose size is proportional to the number of
+// transactions the two peers are missing from each other rather than to the number of transactions they announce.
+//
+// A node that reconciles transactions sets the SFTxnReconciliation service flag. With a peer that also sets it, the
+// node adds the transactions it would have flooded to the peer to the peer's reconciliation set instead, except for
+// txnReconciliationFloodOutboundPeers of its outbound peers, to which it keeps flooding so that new transactions
+// still propagate quickly through the network. Peers that don't set the flag are always flooded.
+//
+// Every reconciliation interval, a node starts a round with each of its outbound peers that reconciles:
+//  1. The node sends a RECONCILE_TXNS_REQUEST with a random salt and the size of its reconciliation set for the peer.
+//  2. The peer estimates the size of the difference between the two sets from their sizes, and replies with a
+//     RECONCILE_TXNS_SKETCH of its set, whose elements are the salted short IDs of the transactions in it.
+//  3. The node subtracts the sketch of its own set from the peer's and decodes the difference. It sends an INV for
+//     the transactions the peer is missing, and a RECONCILE_TXNS_DIFF with the short IDs of the ones it's missing,
+//     which the peer answers with an INV for them.
+//
+// The transactions announced with INVs are then fetched with GetTransactions as usual. If the difference is too
+// large to decode, the node marks the diff as failed and both peers fall back to flooding the round's transactions.
+//
+// The sketch is an invertible Bloom lookup table over the 64-bit short IDs. A short ID is derived from the salt of
+// the round, so that an attacker can't craft transactions whose short IDs collide in every round.
+
+const (
+	// DefaultTxnReconciliationIntervalMillis is the default interval between the reconciliation rounds a node starts
+	// with each of its outbound peers.
+	DefaultTxnReconciliationIntervalMillis = 2000
+
+	// txnReconciliationFloodOutboundPeers is the number of outbound peers that reconcile to which transactions are
+	// still flooded.
+	txnReconciliationFloodOutboundPeers = 2
+
+	// maxTxnReconciliationSetSize is the maximum number of transactions in a peer's reconciliation set. Transactions
+	// that don't fit are flooded to the peer.
+	maxTxnReconciliationSetSize = 10000
+
+	// txnReconciliationRoundTimeoutMultiple is the number of reconciliation intervals after which a round that the
+	// peer hasn't finished is abandoned, and its transactions flooded.
+	txnReconciliationRoundTimeoutMultiple = 5
+
+	// txnReconciliationDiffEstimateDivisor is used to estimate the size of the difference between two reconciliation
+	// sets: on top of the difference between their sizes, we expect one in this many of the transactions of the
+	// smaller set to be missing from the other set.
+	txnReconciliationDiffEstimateDivisor = 4
+
+	// txnSketchNumHashes is the number of cells each short ID is added to.
+	txnSketchNumHashes = 3
+	// txnSketchMinCells and maxTxnSketchCells bound the number of cells of a sketch.
+	txnSketchMinCells = 12
+	maxTxnSketchCells = 3 * maxTxnReconciliationSetSize
+)
+
+// ==================================================================
+// Transaction sketch
+// ==================================================================
+
+// TxnSketchCell is a cell of a TxnSketch.
+type TxnSketchCell struct {
+	// Count is the number of short IDs added to the cell, minus the number subtracted from it.
+	Count int64
+	// KeySum is the XOR of the short IDs added to or subtracted from the cell.
+	KeySum uint64
+	// CheckSum is the XOR of the check hashes of those short IDs.
+	CheckSum uint64
+}
+
+// TxnSketch is an invertible Bloom lookup table of the short IDs of a reconciliation set. Subtracting the sketch of
+// one set from the sketch of another leaves a sketch of the difference between the sets, which can be decoded as
+// long as the difference is small enough for the number of cells.
+type TxnSketch struct {
+	Cells []TxnSketchCell
+}
+
+// NewTxnSketch returns an empty sketch with at least numCells cells.
+func NewTxnSketch(numCells int) *TxnSketch {
+	if numCells < txnSketchMinCells {
+		numCells = txnSketchMinCells
+	}
+	if numCells > maxTxnSketchCells {
+		numCells = maxTxnSketchCells
+	}
+	// Each hash indexes its own partition of the cells, so the number of cells is a multiple of the number of hashes.
+	numCells += (txnSketchNumHashes - numCells%txnSketchNumHashes) % txnSketchNumHashes
+	return &TxnSketch{Cells: make([]TxnSketchCell, numCells)}
+}
+
+// txnSketchNumCellsForSetSizes returns the number of cells of a sketch that is likely to decode the difference
+// between two reconciliation sets of the given sizes.
+func txnSketchNumCellsForSetSizes(localSetSize uint64, remoteSetSize uint64) int {
+	minSetSize, maxSetSize := localSetSize, remoteSetSize
+	if minSetSize > maxSetSize {
+		minSetSize, maxSetSize = maxSetSize, minSetSize
+	}
+	estimatedDiff := maxSetSize - minSetSize + minSetSize/txnReconciliationDiffEstimateDivisor + 1
+	if estimatedDiff > maxTxnSketchCells {
+		return maxTxnSketchCells
+	}
+	// An invertible Bloom lookup table with three hashes decodes reliably with about 1.5 cells per element of the
+	// difference, so twice as many gives some headroom for a low estimate.
+	return int(2*estimatedDiff) + txnSketchMinCells
+}
+
+// _txnSketchMix is the finalizer of splitmix64. It's used to derive the cell indexes and check hash of a short ID.
+func _txnSketchMix(xx uint64) uint64 {
+	xx ^= xx >> 30
+	xx *= 0xbf58476d1ce4e5b9
+	xx ^= xx >> 27
+	xx *= 0x94d049bb133111eb
+	xx ^= xx >> 31
+	return xx
+}
+
+func _txnSketchCheckHash(shortID uint64) uint64 {
+	return _txnSketchMix(shortID ^ 0x9e3779b97f4a7c15)
+}
+
+func (sketch *TxnSketch) cellIndexes(shortID uint64) [txnSketchNumHashes]int {
+	partitionSize := uint64(len(sketch.Cells) / txnSketchNumHashes)
+	var indexes [txnSketchNumHashes]int
+	for ii := 0; ii < txnSketchNumHashes; ii++ {
+		hash := _txnSketchMix(shortID + uint64(ii+1)*0x9e3779b97f4a7c15)
+		indexes[ii] = ii*int(partitionSize) + int(hash%partitionSize)
+	}
+	return indexes
+}
+
+func (sketch *TxnSketch) update(shortID uint64, delta int64) {
+	checkHash := _txnSketchCheckHash(shortID)
+	for _, index := range sketch.cellIndexes(shortID) {
+		sketch.Cells[index].Count += delta
+		sketch.Cells[index].KeySum ^= shortID
+		sketch.Cells[index].CheckSum ^= checkHash
+	}
+}
+
+// Add adds a short ID to the sketch.
+func (sketch *TxnSketch) Add(shortID uint64) {
+	sketch.update(shortID, 1)
+}
+
+// Subtract subtracts other from the sketch, leaving a sketch of the difference between the two sets. The sketches
+// must have the same number of cells.
+func (sketch *TxnSketch) Subtract(other *TxnSketch) error {
+	if len(sketch.Cells) != len(other.Cells) {
+		return fmt.Errorf("TxnSketch.Subtract: Sketch has %d cells but other sketch has %d",
+			len(sketch.Cells), len(other.Cells))
+	}
+	for ii := range sketch.Cells {
+		sketch.Cells[ii].Count -= other.Cells[ii].Count
+		sketch.Cells[ii].KeySum ^= other.Cells[ii].KeySum
+		sketch.Cells[ii].CheckSum ^= other.Cells[ii].CheckSum
+	}
+	return nil
+}
+
+// Decode decodes a sketch of the difference between two sets, as left by Subtract. It returns the short IDs that
+// were only in the sketch that was subtracted from, and the ones that were only in the subtracted sketch. It returns
+// false if the difference is too large to be decoded. The sketch is left unchanged.
+func (sketch *TxnSketch) Decode() (_addedShortIDs []uint64, _removedShortIDs []uint64, _ok bool) {
+	decoded := &TxnSketch{Cells: make([]TxnSketchCell, len(sketch.Cells))}
+	copy(decoded.Cells, sketch.Cells)
+
+	isPure := func(cell *TxnSketchCell) bool {
+		return (cell.Count == 1 || cell.Count == -1) && cell.CheckSum == _txnSketchCheckHash(cell.KeySum)
+	}
+
+	// Peel the pure cells, which hold a single short ID, until there are none left. Removing a short ID from its
+	// other cells can leave them pure in turn.
+	var addedShortIDs, removedShortIDs []uint64
+	pureCells := []int{}
+	for ii := range decoded.Cells {
+		if isPure(&decoded.Cells[ii]) {
+			pureCells = append(pureCells, ii)
+		}
+	}
+	for len(pureCells) > 0 {
+		cellIndex := pureCells[len(pureCells)-1]
+		pureCells = pureCells[:len(pureCells)-1]
+		cell := decoded.Cells[cellIndex]
+		if !isPure(&cell) {
+			continue
+		}
+		shortID := cell.KeySum
+		if cell.Count == 1 {
+			addedShortIDs = append(addedShortIDs, shortID)
+		} else {
+			removedShortIDs = append(removedShortIDs, shortID)
+		}
+		decoded.update(shortID, -cell.Count)
+		for _, index := range decoded.cellIndexes(shortID) {
+			if isPure(&decoded.Cells[index]) {
+				pureCells = append(pureCells, index)
+			}
+		}
+	}
+
+	// The difference was decoded if every short ID was peeled.
+	for _, cell := range decoded.Cells {
+		if cell.Count != 0 || cell.KeySum != 0 || cell.CheckSum != 0 {
+			return nil, nil, false
+		}
+	}
+	return addedShortIDs, removedShortIDs, true
+}
+
+func (sketch *TxnSketch) ToBytes() []byte {
+	data := UintToBuf(uint64(len(sketch.Cells)))
+	for _, cell := range sketch.Cells {
+		data = append(data, IntToBuf(cell.Count)...)
+		data = append(data, EncodeUint64(cell.KeySum)...)
+		data = append(data, EncodeUint64(cell.CheckSum)...)
+	}
+	return data
+}
+
+func (sketch *TxnSketch) FromBytes(rr *bytes.Reader) error {
+	numCells, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "TxnSketch.FromBytes: Problem reading number of cells")
+	}
+	if numCells < txnSketchMinCells || numCells > maxTxnSketchCells || numCells%txnSketchNumHashes != 0 {
+		return fmt.Errorf("TxnSketch.FromBytes: Invalid number of cells %d", numCells)
+	}
+	cells := make([]TxnSketchCell, numCells)
+	sumBytes := make([]byte, 8)
+	for ii := range cells {
+		if cells[ii].Count, err = ReadVarint(rr); err != nil {
+			return errors.Wrapf(err, "TxnSketch.FromBytes: Problem reading count of cell %d", ii)
+		}
+		if _, err = io.ReadFull(rr, sumBytes); err != nil {
+			return errors.Wrapf(err, "TxnSketch.FromBytes: Problem reading key sum of cell %d", ii)
+		}
+		cells[ii].KeySum = DecodeUint64(sumBytes)
+		if _, err = io.ReadFull(rr, sumBytes); err != nil {
+			return errors.Wrapf(err, "TxnSketch.FromBytes: Problem reading check sum of cell %d", ii)
+		}
+		cells[ii].CheckSum = DecodeUint64(sumBytes)
+	}
+	*sketch = TxnSketch{Cells: cells}
+	return nil
+}
+
+// TxnShortID returns the short ID of a transaction in the reconciliation round with the given salt.
+func TxnShortID(salt uint64, txnHash *BlockHash) uint64 {
+	shortIDHash := sha256.Sum256(append(EncodeUint64(salt), txnHash[:]...))
+	return DecodeUint64(shortIDHash[:8])
+}
+
+// ==================================================================
+// Reconciliation messages
+// ==================================================================
+
+// MsgDeSoReconcileTxnsRequest starts a reconciliation round. It's sent by the outbound side of a connection.
+type MsgDeSoReconcileTxnsRequest struct {
+	// Salt is the salt of the short IDs of the round.
+	Salt uint64
+	// SetSize is the size of the sender's reconciliation set.
+	SetSize uint64
+}
+
+func (msg *MsgDeSoReconcileTxnsRequest) GetMsgType() MsgType {
+	return MsgTypeReconcileTxnsRequest
+}
+
+func (msg *MsgDeSoReconcileTxnsRequest) ToBytes(preSignature bool) ([]byte, error) {
+	data := UintToBuf(msg.Salt)
+	data = append(data, UintToBuf(msg.SetSize)...)
+	return data, nil
+}
+
+func (msg *MsgDeSoReconcileTxnsRequest) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	salt, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoReconcileTxnsRequest.FromBytes: Problem reading salt")
+	}
+	setSize, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoReconcileTxnsRequest.FromBytes: Problem reading set size")
+	}
+	*msg = MsgDeSoReconcileTxnsRequest{Salt: salt, SetSize: setSize}
+	return nil
+}
+
+func (msg *MsgDeSoReconcileTxnsRequest) String() string {
+	return fmt.Sprintf("Salt: %d, SetSize: %d", msg.Salt, msg.SetSize)
+}
+
+// MsgDeSoReconcileTxnsSketch is the reply to a MsgDeSoReconcileTxnsRequest, with the sketch of the reconciliation
+// set of the replying peer.
+type MsgDeSoReconcileTxnsSketch struct {
+	Sketch *TxnSketch
+}
+
+func (msg *MsgDeSoReconcileTxnsSketch) GetMsgType() MsgType {
+	return MsgTypeReconcileTxnsSketch
+}
+
+func (msg *MsgDeSoReconcileTxnsSketch) ToBytes(preSignature bool) ([]byte, error) {
+	if msg.Sketch == nil {
+		return nil, fmt.Errorf("MsgDeSoReconcileTxnsSketch.ToBytes: Sketch is nil")
+	}
+	return msg.Sketch.ToBytes(), nil
+}
+
+func (msg *MsgDeSoReconcileTxnsSketch) FromBytes(data []byte) error {
+	sketch := &TxnSketch{}
+	if err := sketch.FromBytes(bytes.NewReader(data)); err != nil {
+		return errors.Wrapf(err, "MsgDeSoReconcileTxnsSketch.FromBytes: ")
+	}
+	*msg = MsgDeSoReconcileTxnsSketch{Sketch: sketch}
+	return nil
+}
+
+func (msg *MsgDeSoReconcileTxnsSketch) String() string {
+	numCells := 0
+	if msg.Sketch != nil {
+		numCells = len(msg.Sketch.Cells)
+	}
+	return fmt.Sprintf("NumCells: %d", numCells)
+}
+
+// MsgDeSoReconcileTxnsDiff finishes a reconciliation round. It holds the short IDs of the transactions the sender is
+// missing, or Failed if the sender couldn't decode the difference between the sets.
+type MsgDeSoReconcileTxnsDiff struct {
+	Failed         bool
+	WantedShortIDs []uint64
+}
+
+func (msg *MsgDeSoReconcileTxnsDiff) GetMsgType() MsgType {
+	return MsgTypeReconcileTxnsDiff
+}
+
+func (msg *MsgDeSoReconcileTxnsDiff) ToBytes(preSignature bool) ([]byte, error) {
+	data := []byte{BoolToByte(msg.Failed)}
+	data = append(data, UintToBuf(uint64(len(msg.WantedShortIDs)))...)
+	for _, shortID := range msg.WantedShortIDs {
+		data = append(data, EncodeUint64(shortID)...)
+	}
+	return data, nil
+}
+
+func (msg *MsgDeSoReconcileTxnsDiff) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	failedByte, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoReconcileTxnsDiff.FromBytes: Problem reading failed")
+	}
+	numShortIDs, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoReconcileTxnsDiff.FromBytes: Problem reading number of short IDs")
+	}
+	if numShortIDs > maxTxnReconciliationSetSize {
+		return fmt.Errorf("MsgDeSoReconcileTxnsDiff.FromBytes: Number of short IDs %d exceeds the maximum %d",
+			numShortIDs, maxTxnReconciliationSetSize)
+	}
+	wantedShortIDs := make([]uint64, numShortIDs)
+	shortIDBytes := make([]byte, 8)
+	for ii := range wantedShortIDs {
+		if _, err = io.ReadFull(rr, shortIDBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoReconcileTxnsDiff.FromBytes: Problem reading short ID %d", ii)
+		}
+		wantedShortIDs[ii] = DecodeUint64(shortIDBytes)
+	}
+	*msg = MsgDeSoReconcileTxnsDiff{Failed: failedByte != 0, WantedShortIDs: wantedShortIDs}
+	return nil
+}
+
+func (msg *MsgDeSoReconcileTxnsDiff) String() string {
+	return fmt.Sprintf("Failed: %v, NumWantedShortIDs: %d", msg.Failed, len(msg.WantedShortIDs))
+}
+
+// ==================================================================
+// Per-peer reconciliation state
+// ==================================================================
+
+// txnReconciliationRound is a reconciliation round in progress with a peer.
+type txnReconciliationRound struct {
+	salt uint64
+	// txnHashesByShortID holds the reconciliation set of the round.
+	txnHashesByShortID map[uint64]BlockHash
+	startedAt          time.Time
+}
+
+// allTxnHashes returns every transaction of the round.
+func (round *txnReconciliationRound) allTxnHashes() []BlockHash {
+	txnHashes := make([]BlockHash, 0, len(round.txnHashesByShortID))
+	for _, txnHash := range round.txnHashesByShortID {
+		txnHashes = append(txnHashes, txnHash)
+	}
+	return txnHashes
+}
+
+// txnHashesForShortIDs returns the transactions of the round with the given short IDs. Short IDs that aren't in the
+// round are ignored.
+func (round *txnReconciliationRound) txnHashesForShortIDs(shortIDs []uint64) []BlockHash {
+	var txnHashes []BlockHash
+	for _, shortID := range shortIDs {
+		if txnHash, exists := round.txnHashesByShortID[shortID]; exists {
+			txnHashes = append(txnHashes, txnHash)
+		}
+	}
+	return txnHashes
+}
+
+func (round *txnReconciliationRound) sketch(numCells int) *TxnSketch {
+	sketch := NewTxnSketch(numCells)
+	for shortID := range round.txnHashesByShortID {
+		sketch.Add(shortID)
+	}
+	return sketch
+}
+
+// txnReconciliationState holds a peer's reconciliation set, i.e. the transactions we'll announce to the peer in the
+// next reconciliation round, and the round in progress with the peer, if any.
+type txnReconciliationState struct {
+	mtx       deadlock.Mutex
+	txnHashes map[BlockHash]struct{}
+	round     *txnReconciliationRound
+}
+
+func newTxnReconciliationState() *txnReconciliationState {
+	return &txnReconciliationState{txnHashes: make(map[BlockHash]struct{})}
+}
+
+// addTxns adds transactions to the reconciliation set. It returns the transactions that didn't fit in the set,
+// which should be flooded to the peer instead.
+func (state *txnReconciliationState) addTxns(txnHashes []BlockHash) []BlockHash {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+
+	var overflowTxnHashes []BlockHash
+	for _, txnHash := range txnHashes {
+		if len(state.txnHashes) >= maxTxnReconciliationSetSize {
+			overflowTxnHashes = append(overflowTxnHashes, txnHash)
+			continue
+		}
+		state.txnHashes[txnHash] = struct{}{}
+	}
+	return overflowTxnHashes
+}
+
+// startRound moves the reconciliation set into a new round with the given salt. It returns the round that was in
+// progress, if any, so that its transactions can be flooded.
+func (state *txnReconciliationState) startRound(salt uint64) (
+	_round *txnReconciliationRound, _abandonedRound *txnReconciliationRound) {
+
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+
+	round := &txnReconciliationRound{
+		salt:               salt,
+		txnHashesByShortID: make(map[uint64]BlockHash, len(state.txnHashes)),
+		startedAt:          time.Now(),
+	}
+	for txnHash := range state.txnHashes {
+		round.txnHashesByShortID[TxnShortID(salt, &txnHash)] = txnHash
+	}
+	state.txnHashes = make(map[BlockHash]struct{})
+	abandonedRound := state.round
+	state.round = round
+	return round, abandonedRound
+}
+
+// currentRound returns the round in progress, or nil if there's none.
+func (state *txnReconciliationState) currentRound() *txnReconciliationRound {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	return state.round
+}
+
+// finishRound removes the round in progress and returns it, or returns nil if there's none.
+func (state *txnReconciliationState) finishRound() *txnReconciliationRound {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	round := state.round
+	state.round = nil
+	return round
+}
+
+// ==================================================================
+// Server
+// ==================================================================
+
+// _reconcilesTxnsWithPeer returns true if we reconcile transactions with the peer rather than flooding them.
+func (srv *Server) _reconcilesTxnsWithPeer(pp *Peer) bool {
+	return srv.txnReconciliationInterval > 0 && pp.serviceFlags.HasService(SFTxnReconciliation)
+}
+
+// _getTxnFloodPeerIDs returns the IDs of the outbound peers that reconcile to which we still flood transactions.
+// The peers with the lowest IDs are picked, so that the same peers are flooded for as long as they're connected.
+func (srv *Server) _getTxnFloodPeerIDs(allPeers []*Peer) map[uint64]bool {
+	var outboundPeerIDs []uint64
+	for _, pp := range allPeers {
+		if pp.IsOutbound() && srv._reconcilesTxnsWithPeer(pp) {
+			outboundPeerIDs = append(outboundPeerIDs, pp.ID)
+		}
+	}
+	sort.Slice(outboundPeerIDs, func(ii, jj int) bool {
+		return outboundPeerIDs[ii] < outboundPeerIDs[jj]
+	})
+	floodPeerIDs := make(map[uint64]bool)
+	for ii := 0; ii < len(outboundPeerIDs) && ii < txnReconciliationFloodOutboundPeers; ii++ {
+		floodPeerIDs[outboundPeerIDs[ii]] = true
+	}
+	return floodPeerIDs
+}
+
+// _startTxnReconciler must be run inside a goroutine. It starts a reconciliation round with each outbound peer that
+// reconciles every txnReconciliationInterval, until the Server shuts down.
+func (srv *Server) _startTxnReconciler() {
+	// If we've set a maximum sync height, we will not relay transactions.
+	if srv.blockchain.MaxSyncBlockHeight > 0 || srv.txnReconciliationInterval == 0 {
+		return
+	}
+
+	for {
+		time.Sleep(srv.txnReconciliationInterval)
+		if atomic.LoadInt32(&srv.shutdown) >= 1 {
+			break
+		}
+		for _, pp := range srv.cmgr.GetAllPeers() {
+			if pp.IsOutbound() && pp.canReceiveInvMessages && srv._reconcilesTxnsWithPeer(pp) {
+				srv._requestTxnReconciliation(pp)
+			}
+		}
+	}
+}
+
+// _requestTxnReconciliation starts a reconciliation round with an outbound peer, unless the previous round is still
+// in progress and hasn't timed out.
+func (srv *Server) _requestTxnReconciliation(pp *Peer) {
+	if round := pp.txnReconciliation.currentRound(); round != nil &&
+		time.Since(round.startedAt) < txnReconciliationRoundTimeoutMultiple*srv.txnReconciliationInterval {
+		return
+	}
+	salt, err := wire.RandomUint64()
+	if err != nil {
+		srv.logger.Errorf("Server._requestTxnReconciliation: Problem generating salt: %v", err)
+		return
+	}
+	round, abandonedRound := pp.txnReconciliation.startRound(salt)
+	if abandonedRound != nil {
+		srv.logger.V(1).Infof("Server._requestTxnReconciliation: Reconciliation round with peer %v timed out", pp)
+		_sendTxnReconciliationInv(pp, abandonedRound.allTxnHashes())
+	}
+	pp.AddDeSoMessage(&MsgDeSoReconcileTxnsRequest{
+		Salt:    salt,
+		SetSize: uint64(len(round.txnHashesByShortID)),
+	}, false)
+}
+
+func (srv *Server) _handleReconcileTxnsRequest(pp *Peer, msg *MsgDeSoReconcileTxnsRequest) {
+	if pp.IsOutbound() || !srv._reconcilesTxnsWithPeer(pp) {
+		srv.logger.V(1).Infof("Server._handleReconcileTxnsRequest: Ignoring unexpected request from peer %v", pp)
+		return
+	}
+	round, abandonedRound := pp.txnReconciliation.startRound(msg.Salt)
+	if abandonedRound != nil {
+		_sendTxnReconciliationInv(pp, abandonedRound.allTxnHashes())
+	}
+	numCells := txnSketchNumCellsForSetSizes(uint64(len(round.txnHashesByShortID)), msg.SetSize)
+	pp.AddDeSoMessage(&MsgDeSoReconcileTxnsSketch{Sketch: round.sketch(numCells)}, false)
+}
+
+func (srv *Server) _handleReconcileTxnsSketch(pp *Peer, msg *MsgDeSoReconcileTxnsSketch) {
+	if !pp.IsOutbound() || !srv._reconcilesTxnsWithPeer(pp) {
+		srv.logger.V(1).Infof("Server._handleReconcileTxnsSketch: Ignoring unexpected sketch from peer %v", pp)
+		return
+	}
+	round := pp.txnReconciliation.finishRound()
+	if round == nil {
+		srv.logger.V(1).Infof("Server._handleReconcileTxnsSketch: Ignoring sketch from peer %v without a "+
+			"round in progress", pp)
+		return
+	}
+
+	// Subtracting our sketch from the peer's leaves the short IDs only the peer has as added, and the ones only we
+	// have as removed.
+	diffSketch := msg.Sketch
+	err := diffSketch.Subtract(round.sketch(len(msg.Sketch.Cells)))
+	var peerOnlyShortIDs, localOnlyShortIDs []uint64
+	ok := false
+	if err == nil {
+		peerOnlyShortIDs, localOnlyShortIDs, ok = diffSketch.Decode()
+	}
+	if !ok {
+		srv.logger.V(1).Infof("Server._handleReconcileTxnsSketch: Failed to decode the difference with peer %v, "+
+			"falling back to flooding %d txns", pp, len(round.txnHashesByShortID))
+		pp.AddDeSoMessage(&MsgDeSoReconcileTxnsDiff{Failed: true}, false)
+		_sendTxnReconciliationInv(pp, round.allTxnHashes())
+		return
+	}
+
+	_sendTxnReconciliationInv(pp, round.txnHashesForShortIDs(localOnlyShortIDs))
+	pp.AddDeSoMessage(&MsgDeSoReconcileTxnsDiff{WantedShortIDs: peerOnlyShortIDs}, false)
+}
+
+func (srv *Server) _handleReconcileTxnsDiff(pp *Peer, msg *MsgDeSoReconcileTxnsDiff) {
+	if pp.IsOutbound() || !srv._reconcilesTxnsWithPeer(pp) {
+		srv.logger.V(1).Infof("Server._handleReconcileTxnsDiff: Ignoring unexpected diff from peer %v", pp)
+		return
+	}
+	round := pp.txnReconciliation.finishRound()
+	if round == nil {
+		srv.logger.V(1).Infof("Server._handleReconcileTxnsDiff: Ignoring diff from peer %v without a "+
+			"round in progress", pp)
+		return
+	}
+	if msg.Failed {
+		_sendTxnReconciliationInv(pp, round.allTxnHashes())
+		return
+	}
+	_sendTxnReconciliationInv(pp, round.txnHashesForShortIDs(msg.WantedShortIDs))
+}
+
+// _sendTxnReconciliationInv sends the peer an INV for the given transactions.
+func _sendTxnReconciliationInv(pp *Peer, txnHashes []BlockHash) {
+	if len(txnHashes) == 0 {
+		return
+	}
+	invMsg := &MsgDeSoInv{}
+	for _, txnHash := range txnHashes {
+		invMsg.InvList = append(invMsg.InvList, &InvVect{Type: InvTypeTx, Hash: txnHash})
+	}
+	pp.AddDeSoMessage(invMsg, false)
+}
@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnSketch(t *testing.T) {
+	require := require.New(t)
+
+	newShortIDs := func(start uint64, count uint64) []uint64 {
+		shortIDs := []uint64{}
+		for ii := start; ii < start+count; ii++ {
+			shortIDs = append(shortIDs, _txnSketchMix(ii))
+		}
+		return shortIDs
+	}
+	commonShortIDs := newShortIDs(0, 1000)
+	localOnlyShortIDs := newShortIDs(1000, 40)
+	remoteOnlyShortIDs := newShortIDs(2000, 25)
+
+	numCells := txnSketchNumCellsForSetSizes(1040, 1025)
+	localSketch := NewTxnSketch(numCells)
+	remoteSketch := NewTxnSketch(numCells)
+	for _, shortID := range append(commonShortIDs, localOnlyShortIDs...) {
+		localSketch.Add(shortID)
+	}
+	for _, shortID := range append(commonShortIDs, remoteOnlyShortIDs...) {
+		remoteSketch.Add(shortID)
+	}
+
+	// The sketch survives a round trip through its encoding.
+	decodedSketch := &TxnSketch{}
+	require.NoError(decodedSketch.FromBytes(bytes.NewReader(remoteSketch.ToBytes())))
+	require.Equal(remoteSketch, decodedSketch)
+
+	// Subtracting one sketch from the other decodes to the difference between the sets.
+	require.NoError(localSketch.Subtract(decodedSketch))
+	addedShortIDs, removedShortIDs, ok := localSketch.Decode()
+	require.True(ok)
+	require.ElementsMatch(localOnlyShortIDs, addedShortIDs)
+	require.ElementsMatch(remoteOnlyShortIDs, removedShortIDs)
+
+	// A difference that's too large for the sketch doesn't decode.
+	smallSketch := NewTxnSketch(0)
+	for _, shortID := range commonShortIDs[:100] {
+		smallSketch.Add(shortID)
+	}
+	_, _, ok = smallSketch.Decode()
+	require.False(ok)
+
+	// Sketches of different sizes can't be subtracted.
+	require.Error(smallSketch.Subtract(remoteSketch))
+}
+
+func TestTxnReconciliation(t *testing.T) {
+	require := require.New(t)
+
+	newServer := func() *Server {
+		return &Server{
+			txnReconciliationInterval: time.Second,
+			logger:                    NewLogger(nil, LogComponentServer),
+		}
+	}
+	newPeer := func(isOutbound bool) *Peer {
+		return &Peer{
+			isOutbound:        isOutbound,
+			serviceFlags:      SFFullNodeDeprecated | SFTxnReconciliation,
+			txnReconciliation: newTxnReconciliationState(),
+			logger:            NewLogger(nil, LogComponentPeer),
+		}
+	}
+	newTxnHashes := func(start byte, count byte) []BlockHash {
+		txnHashes := []BlockHash{}
+		for ii := start; ii < start+count; ii++ {
+			txnHashes = append(txnHashes, BlockHash{ii})
+		}
+		return txnHashes
+	}
+	// sentMessages returns the messages queued for a peer, after a round trip through their encoding.
+	sentMessages := func(pp *Peer) []DeSoMessage {
+		pp.mtxMessageQueue.Lock()
+		defer pp.mtxMessageQueue.Unlock()
+		msgs := []DeSoMessage{}
+		for _, msgMeta := range pp.messageQueue {
+			msgBytes, err := msgMeta.DeSoMessage.ToBytes(false)
+			require.NoError(err)
+			msg := NewMessage(msgMeta.DeSoMessage.GetMsgType())
+			require.NoError(msg.FromBytes(msgBytes))
+			msgs = append(msgs, msg)
+		}
+		pp.messageQueue = nil
+		return msgs
+	}
+	invTxnHashes := func(msg DeSoMessage) []BlockHash {
+		txnHashes := []BlockHash{}
+		for _, invVect := range msg.(*MsgDeSoInv).InvList {
+			txnHashes = append(txnHashes, invVect.Hash)
+		}
+		return txnHashes
+	}
+
+	// The initiator is connected to the responder through an outbound connection.
+	initiator, responder := newServer(), newServer()
+	initiatorToResponder, responderToInitiator := newPeer(true), newPeer(false)
+
+	commonTxnHashes := newTxnHashes(0, 100)
+	initiatorOnlyTxnHashes := newTxnHashes(100, 10)
+	responderOnlyTxnHashes := newTxnHashes(200, 7)
+	require.Empty(initiatorToResponder.txnReconciliation.addTxns(append(commonTxnHashes, initiatorOnlyTxnHashes...)))
+	require.Empty(responderToInitiator.txnReconciliation.addTxns(append(commonTxnHashes, responderOnlyTxnHashes...)))
+
+	// A successful round announces to each side only the transactions it's missing.
+	initiator._requestTxnReconciliation(initiatorToResponder)
+	msgs := sentMessages(initiatorToResponder)
+	require.Len(msgs, 1)
+	require.Equal(uint64(110), msgs[0].(*MsgDeSoReconcileTxnsRequest).SetSize)
+
+	// A round in progress isn't restarted until it times out.
+	initiator._requestTxnReconciliation(initiatorToResponder)
+	require.Empty(sentMessages(initiatorToResponder))
+
+	responder._handleReconcileTxnsRequest(responderToInitiator, msgs[0].(*MsgDeSoReconcileTxnsRequest))
+	msgs = sentMessages(responderToInitiator)
+	require.Len(msgs, 1)
+	sketchMsg := msgs[0].(*MsgDeSoReconcileTxnsSketch)
+	require.Less(len(sketchMsg.Sketch.Cells), 110)
+
+	initiator._handleReconcileTxnsSketch(initiatorToResponder, sketchMsg)
+	msgs = sentMessages(initiatorToResponder)
+	require.Len(msgs, 2)
+	require.ElementsMatch(initiatorOnlyTxnHashes, invTxnHashes(msgs[0]))
+	diffMsg := msgs[1].(*MsgDeSoReconcileTxnsDiff)
+	require.False(diffMsg.Failed)
+	require.Len(diffMsg.WantedShortIDs, len(responderOnlyTxnHashes))
+
+	responder._handleReconcileTxnsDiff(responderToInitiator, diffMsg)
+	msgs = sentMessages(responderToInitiator)
+	require.Len(msgs, 1)
+	require.ElementsMatch(responderOnlyTxnHashes, invTxnHashes(msgs[0]))
+	require.Nil(initiatorToResponder.txnReconciliation.currentRound())
+	require.Nil(responderToInitiator.txnReconciliation.currentRound())
+
+	// If the difference can't be decoded, both sides flood the transactions of the round.
+	require.Empty(initiatorToResponder.txnReconciliation.addTxns(newTxnHashes(0, 200)))
+	require.Empty(responderToInitiator.txnReconciliation.addTxns(newTxnHashes(200, 3)))
+	initiator._requestTxnReconciliation(initiatorToResponder)
+	msgs = sentMessages(initiatorToResponder)
+	require.Len(msgs, 1)
+	// Understate the size of the initiator's set so that the sketch is too small.
+	msgs[0].(*MsgDeSoReconcileTxnsRequest).SetSize = 0
+	responder._handleReconcileTxnsRequest(responderToInitiator, msgs[0].(*MsgDeSoReconcileTxnsRequest))
+	msgs = sentMessages(responderToInitiator)
+	require.Len(msgs, 1)
+	initiator._handleReconcileTxnsSketch(initiatorToResponder, msgs[0].(*MsgDeSoReconcileTxnsSketch))
+	msgs = sentMessages(initiatorToResponder)
+	require.Len(msgs, 2)
+	require.True(msgs[0].(*MsgDeSoReconcileTxnsDiff).Failed)
+	require.ElementsMatch(newTxnHashes(0, 200), invTxnHashes(msgs[1]))
+	responder._handleReconcileTxnsDiff(responderToInitiator, msgs[0].(*MsgDeSoReconcileTxnsDiff))
+	msgs = sentMessages(responderToInitiator)
+	require.Len(msgs, 1)
+	require.ElementsMatch(newTxnHashes(200, 3), invTxnHashes(msgs[0]))
+
+	// Reconciliation messages in the wrong direction are ignored.
+	initiator._handleReconcileTxnsRequest(initiatorToResponder, &MsgDeSoReconcileTxnsRequest{Salt: 1})
+	responder._handleReconcileTxnsSketch(responderToInitiator, &MsgDeSoReconcileTxnsSketch{Sketch: NewTxnSketch(0)})
+	require.Empty(sentMessages(initiatorToResponder))
+	require.Empty(sentMessages(responderToInitiator))
+
+	// Transactions are flooded to the outbound peers with the lowest IDs that reconcile.
+	allPeers := []*Peer{}
+	for ii := uint64(1); ii <= 5; ii++ {
+		pp := newPeer(ii%2 == 1)
+		pp.ID = ii
+		allPeers = append(allPeers, pp)
+	}
+	allPeers[0].serviceFlags = SFFullNodeDeprecated
+	require.Equal(map[uint64]bool{3: true, 5: true}, initiator._getTxnFloodPeerIDs(allPeers))
+}
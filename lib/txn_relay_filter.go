@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"sort"
+	"sync"
+)
+
+// TxnRelayFilter tracks the TxnTypes that an operator has paused at runtime, e.g. to contain an exploit until a fix
+// is deployed. While a TxnType is paused, this node:
+//   - rejects new transactions of that type, whether they come from peers or are submitted locally,
+//   - doesn't relay transactions of that type that are already in its mempool, and
+//   - doesn't include transactions of that type in the blocks it produces.
+//
+// Pausing a TxnType is purely a local relay policy. It doesn't change the consensus rules, so blocks from other
+// producers that contain paused transactions are still valid, and transactions that are already in the mempool
+// are kept so they can be relayed and mined again once their TxnType is resumed.
+//
+// The read methods are safe to call on a nil TxnRelayFilter, which doesn't pause anything.
+type TxnRelayFilter struct {
+	mtx            sync.RWMutex
+	pausedTxnTypes map[TxnType]struct{}
+}
+
+func NewTxnRelayFilter() *TxnRelayFilter {
+	return &TxnRelayFilter{
+		pausedTxnTypes: make(map[TxnType]struct{}),
+	}
+}
+
+// PauseTxnTypes pauses the given TxnTypes. Pausing a TxnType that's already paused is a no-op.
+func (filter *TxnRelayFilter) PauseTxnTypes(txnTypes []TxnType) {
+	filter.mtx.Lock()
+	defer filter.mtx.Unlock()
+	for _, txnType := range txnTypes {
+		filter.pausedTxnTypes[txnType] = struct{}{}
+	}
+}
+
+// ResumeTxnTypes resumes the given TxnTypes. Resuming a TxnType that isn't paused is a no-op.
+func (filter *TxnRelayFilter) ResumeTxnTypes(txnTypes []TxnType) {
+	filter.mtx.Lock()
+	defer filter.mtx.Unlock()
+	for _, txnType := range txnTypes {
+		delete(filter.pausedTxnTypes, txnType)
+	}
+}
+
+// GetPausedTxnTypes returns the paused TxnTypes in ascending order.
+func (filter *TxnRelayFilter) GetPausedTxnTypes() []TxnType {
+	if filter == nil {
+		return nil
+	}
+	filter.mtx.RLock()
+	defer filter.mtx.RUnlock()
+	txnTypes := make([]TxnType, 0, len(filter.pausedTxnTypes))
+	for txnType := range filter.pausedTxnTypes {
+		txnTypes = append(txnTypes, txnType)
+	}
+	sort.Slice(txnTypes, func(ii, jj int) bool {
+		return txnTypes[ii] < txnTypes[jj]
+	})
+	return txnTypes
+}
+
+// IsTxnTypePaused returns true if the TxnType is paused.
+func (filter *TxnRelayFilter) IsTxnTypePaused(txnType TxnType) bool {
+	if filter == nil {
+		return false
+	}
+	filter.mtx.RLock()
+	defer filter.mtx.RUnlock()
+	_, isPaused := filter.pausedTxnTypes[txnType]
+	return isPaused
+}
+
+// IsTxnPaused returns true if the txn's TxnType is paused. An atomic transaction wrapper is paused if any of its
+// inner transactions is, so that paused transactions can't be smuggled in through a wrapper.
+func (filter *TxnRelayFilter) IsTxnPaused(txn *MsgDeSoTxn) bool {
+	if filter == nil || txn == nil || txn.TxnMeta == nil {
+		return false
+	}
+	if filter.IsTxnTypePaused(txn.TxnMeta.GetTxnType()) {
+		return true
+	}
+	if txnMeta, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata); ok {
+		for _, innerTxn := range txnMeta.Txns {
+			if filter.IsTxnPaused(innerTxn) {
+				return true
+			}
+		}
+	}
+	return false
+}
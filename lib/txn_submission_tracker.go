@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// TxnSubmissionTracker tracks the transactions that were submitted directly to peers through
+// Server.SubmitTransactionToPeers, so that a caller can tell whether a transaction is actually spreading through
+// the network rather than assuming that it will once it's in our mempool.
+//
+// A peer that we announce a transaction to requests it from us with a GetTransactions message if it doesn't
+// already have it, and then announces it to its own peers once it's accepted into its mempool. It won't announce
+// it back to us, since it knows we have it, so we learn that the transaction is spreading when the peers we
+// didn't deliver it to announce it to us. This gives us three outcomes once the submission times out:
+//   - If other peers announced the transaction, it has propagated.
+//   - If no peer requested or announced it, the submission failed to propagate, e.g. because our peers were
+//     unreachable or already had a conflicting transaction.
+//   - If peers requested it from us but none of the others ever announced it, the peers we delivered it to
+//     accepted it but didn't relay it, which suggests that they're censoring it.
+//
+// The methods are safe to call on a nil TxnSubmissionTracker, which doesn't track anything.
+type TxnSubmissionTracker struct {
+	mtx sync.Mutex
+	// timeout is how long we wait for a submitted transaction to be announced before reporting it as failed.
+	timeout     time.Duration
+	submissions map[BlockHash]*txnSubmission
+}
+
+type txnSubmission struct {
+	submittedAt      time.Time
+	submittedPeerIDs []uint64
+	// requestingPeerIDs are the peers that requested the transaction from us, and announcingPeerIDs are the peers
+	// that announced it to us, mapped to when they did.
+	requestingPeerIDs map[uint64]time.Time
+	announcingPeerIDs map[uint64]time.Time
+}
+
+// TxnSubmissionState is the outcome of a transaction submission.
+type TxnSubmissionState uint8
+
+const (
+	// TxnSubmissionStatePending means that the submission hasn't been announced by any peer yet, and hasn't
+	// timed out.
+	TxnSubmissionStatePending TxnSubmissionState = 0
+	// TxnSubmissionStatePropagated means that peers other than the ones we delivered the transaction to have
+	// announced it.
+	TxnSubmissionStatePropagated TxnSubmissionState = 1
+	// TxnSubmissionStatePropagationFailed means that no peer requested or announced the transaction before the
+	// submission timed out.
+	TxnSubmissionStatePropagationFailed TxnSubmissionState = 2
+	// TxnSubmissionStateSuspectedCensorship means that peers requested the transaction from us, but none of the
+	// other peers announced it before the submission timed out.
+	TxnSubmissionStateSuspectedCensorship TxnSubmissionState = 3
+)
+
+func (state TxnSubmissionState) String() string {
+	switch state {
+	case TxnSubmissionStatePending:
+		return "PENDING"
+	case TxnSubmissionStatePropagated:
+		return "PROPAGATED"
+	case TxnSubmissionStatePropagationFailed:
+		return "PROPAGATION_FAILED"
+	case TxnSubmissionStateSuspectedCensorship:
+		return "SUSPECTED_CENSORSHIP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// TxnSubmissionStatus is a snapshot of a transaction submission.
+type TxnSubmissionStatus struct {
+	TxnHash     *BlockHash
+	State       TxnSubmissionState
+	SubmittedAt time.Time
+	// SubmittedPeerIDs are the peers that the transaction was announced to.
+	SubmittedPeerIDs []uint64
+	// RequestingPeerIDs are the peers that requested the transaction from us.
+	RequestingPeerIDs []uint64
+	// AnnouncingPeerIDs are the peers that announced the transaction to us after it was submitted.
+	AnnouncingPeerIDs []uint64
+}
+
+// maxTrackedTxnSubmissions bounds the number of submissions the tracker holds. Once it's reached, the oldest
+// submission is dropped to make room for a new one.
+const maxTrackedTxnSubmissions = 10000
+
+// txnSubmissionRetentionFactor is how many timeouts a submission is kept for after it's submitted.
+const txnSubmissionRetentionFactor = 10
+
+func NewTxnSubmissionTracker(timeout time.Duration) *TxnSubmissionTracker {
+	return &TxnSubmissionTracker{
+		timeout:     timeout,
+		submissions: make(map[BlockHash]*txnSubmission),
+	}
+}
+
+// AddSubmission starts tracking a transaction that was announced to the given peers. Submitting a transaction
+// that's already tracked restarts its timeout and adds the peers to the ones it was submitted to.
+func (tracker *TxnSubmissionTracker) AddSubmission(txnHash *BlockHash, peerIDs []uint64, now time.Time) {
+	if tracker == nil || txnHash == nil {
+		return
+	}
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+
+	tracker._pruneSubmissions(now)
+	submission, exists := tracker.submissions[*txnHash]
+	if !exists {
+		submission = &txnSubmission{
+			requestingPeerIDs: make(map[uint64]time.Time),
+			announcingPeerIDs: make(map[uint64]time.Time),
+		}
+		tracker.submissions[*txnHash] = submission
+	}
+	submission.submittedAt = now
+	for _, peerID := range peerIDs {
+		if !slices.Contains(submission.submittedPeerIDs, peerID) {
+			submission.submittedPeerIDs = append(submission.submittedPeerIDs, peerID)
+		}
+	}
+}
+
+// RecordRequest records that a peer requested a tracked transaction from us.
+func (tracker *TxnSubmissionTracker) RecordRequest(peerID uint64, txnHash *BlockHash, now time.Time) {
+	if tracker == nil || txnHash == nil {
+		return
+	}
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+
+	if submission, exists := tracker.submissions[*txnHash]; exists {
+		if _, requested := submission.requestingPeerIDs[peerID]; !requested {
+			submission.requestingPeerIDs[peerID] = now
+		}
+	}
+}
+
+// RecordAnnouncement records that a peer announced a tracked transaction to us in an inv. Announcements from
+// the peers that requested the transaction from us are ignored, since they got it from us.
+func (tracker *TxnSubmissionTracker) RecordAnnouncement(peerID uint64, txnHash *BlockHash, now time.Time) {
+	if tracker == nil || txnHash == nil {
+		return
+	}
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+
+	if submission, exists := tracker.submissions[*txnHash]; exists {
+		if _, requested := submission.requestingPeerIDs[peerID]; requested {
+			return
+		}
+		if _, announced := submission.announcingPeerIDs[peerID]; !announced {
+			submission.announcingPeerIDs[peerID] = now
+		}
+	}
+}
+
+// GetStatus returns the status of a tracked transaction as of now, or nil if it isn't tracked.
+func (tracker *TxnSubmissionTracker) GetStatus(txnHash *BlockHash, now time.Time) *TxnSubmissionStatus {
+	if tracker == nil || txnHash == nil {
+		return nil
+	}
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+
+	submission, exists := tracker.submissions[*txnHash]
+	if !exists {
+		return nil
+	}
+	status := &TxnSubmissionStatus{
+		TxnHash:          txnHash.NewBlockHash(),
+		SubmittedAt:      submission.submittedAt,
+		SubmittedPeerIDs: append([]uint64{}, submission.submittedPeerIDs...),
+	}
+	for peerID := range submission.requestingPeerIDs {
+		status.RequestingPeerIDs = append(status.RequestingPeerIDs, peerID)
+	}
+	for peerID := range submission.announcingPeerIDs {
+		status.AnnouncingPeerIDs = append(status.AnnouncingPeerIDs, peerID)
+	}
+	slices.Sort(status.RequestingPeerIDs)
+	slices.Sort(status.AnnouncingPeerIDs)
+
+	if len(status.AnnouncingPeerIDs) > 0 {
+		status.State = TxnSubmissionStatePropagated
+	} else if now.Sub(submission.submittedAt) < tracker.timeout {
+		status.State = TxnSubmissionStatePending
+	} else if len(status.RequestingPeerIDs) > 0 {
+		status.State = TxnSubmissionStateSuspectedCensorship
+	} else {
+		status.State = TxnSubmissionStatePropagationFailed
+	}
+	return status
+}
+
+// _pruneSubmissions drops the submissions that are past their retention period, and the oldest submission if
+// the tracker is full. It must be called with the lock held.
+func (tracker *TxnSubmissionTracker) _pruneSubmissions(now time.Time) {
+	retention := txnSubmissionRetentionFactor * tracker.timeout
+	var oldestHash *BlockHash
+	var oldestTime time.Time
+	for txnHash, submission := range tracker.submissions {
+		if now.Sub(submission.submittedAt) > retention {
+			delete(tracker.submissions, txnHash)
+			continue
+		}
+		if oldestHash == nil || submission.submittedAt.Before(oldestTime) {
+			oldestHash = txnHash.NewBlockHash()
+			oldestTime = submission.submittedAt
+		}
+	}
+	if len(tracker.submissions) >= maxTrackedTxnSubmissions && oldestHash != nil {
+		delete(tracker.submissions, *oldestHash)
+	}
+}
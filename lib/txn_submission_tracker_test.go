@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnSubmissionTracker(t *testing.T) {
+	require := require.New(t)
+
+	tracker := NewTxnSubmissionTracker(30 * time.Second)
+	start := time.Now()
+	propagatedHash := &BlockHash{1}
+	censoredHash := &BlockHash{2}
+	failedHash := &BlockHash{3}
+	for _, txnHash := range []*BlockHash{propagatedHash, censoredHash, failedHash} {
+		tracker.AddSubmission(txnHash, []uint64{1, 2}, start)
+	}
+
+	// Untracked txns have no status, and requests and announcements for them are ignored.
+	untrackedHash := &BlockHash{4}
+	tracker.RecordAnnouncement(3, untrackedHash, start)
+	require.Nil(tracker.GetStatus(untrackedHash, start))
+
+	// Peer 1 requests the first txn, and then both it and peer 3 announce it. Only peer 3's announcement
+	// counts, since peer 1 got the txn from us.
+	tracker.RecordRequest(1, propagatedHash, start.Add(time.Second))
+	tracker.RecordAnnouncement(1, propagatedHash, start.Add(2*time.Second))
+	status := tracker.GetStatus(propagatedHash, start.Add(2*time.Second))
+	require.Equal(TxnSubmissionStatePending, status.State)
+	require.Equal([]uint64{1, 2}, status.SubmittedPeerIDs)
+	require.Equal([]uint64{1}, status.RequestingPeerIDs)
+	require.Empty(status.AnnouncingPeerIDs)
+	tracker.RecordAnnouncement(3, propagatedHash, start.Add(3*time.Second))
+	status = tracker.GetStatus(propagatedHash, start.Add(3*time.Second))
+	require.Equal(TxnSubmissionStatePropagated, status.State)
+	require.Equal([]uint64{3}, status.AnnouncingPeerIDs)
+
+	// The second txn is requested but never announced, and the third is neither requested nor announced.
+	tracker.RecordRequest(2, censoredHash, start.Add(time.Second))
+	require.Equal(TxnSubmissionStatePending, tracker.GetStatus(censoredHash, start.Add(29*time.Second)).State)
+	require.Equal(TxnSubmissionStatePending, tracker.GetStatus(failedHash, start.Add(29*time.Second)).State)
+	require.Equal(TxnSubmissionStateSuspectedCensorship,
+		tracker.GetStatus(censoredHash, start.Add(30*time.Second)).State)
+	require.Equal(TxnSubmissionStatePropagationFailed,
+		tracker.GetStatus(failedHash, start.Add(30*time.Second)).State)
+	require.Equal(TxnSubmissionStatePropagated, tracker.GetStatus(propagatedHash, start.Add(30*time.Second)).State)
+
+	// Resubmitting the third txn to another peer restarts its timeout.
+	tracker.AddSubmission(failedHash, []uint64{2, 5}, start.Add(40*time.Second))
+	status = tracker.GetStatus(failedHash, start.Add(60*time.Second))
+	require.Equal(TxnSubmissionStatePending, status.State)
+	require.Equal([]uint64{1, 2, 5}, status.SubmittedPeerIDs)
+
+	// Submissions are dropped once they're past their retention period.
+	tracker.AddSubmission(untrackedHash, []uint64{1}, start.Add(301*time.Second))
+	require.Nil(tracker.GetStatus(propagatedHash, start.Add(301*time.Second)))
+	require.NotNil(tracker.GetStatus(failedHash, start.Add(301*time.Second)))
+
+	// A nil tracker doesn't track anything.
+	var nilTracker *TxnSubmissionTracker
+	nilTracker.AddSubmission(propagatedHash, []uint64{1}, start)
+	require.Nil(nilTracker.GetStatus(propagatedHash, start))
+}
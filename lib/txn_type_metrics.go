@@ -0,0 +1,490 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// TxnType Metrics
+//
+// Spam usually shows up as a sudden jump in the number of transactions of one type, e.g. a flood of
+// CreatePostAssociation transactions. The TxnTypeMetricsTracker makes that easy to spot: for each of the last
+// windowSize committed blocks, it records the number of transactions of each TxnType, their total size, and
+// their total fees. Operators can compare the last few blocks to the whole window through the admin RPC, and
+// pause the relaying of a TxnType that's being abused.
+//
+// The metrics are kept in an in-memory ring and written to the DB under PrefixTxnTypeBlockMetrics every
+// txnTypeMetricsPersistInterval, so the window survives restarts. They're node-local, so they aren't part of
+// the state. Blocks disconnected by a reorg are removed from the window.
+//
+// The transactions inside an atomic transaction wrapper are counted under their own TxnTypes, so spam can't
+// hide in wrappers. Fees are read from TxnFeeNanos, so they're only counted for balance model transactions.
+
+const (
+	// DefaultTxnTypeMetricsWindowBlocks is the number of blocks the metrics are kept for by default.
+	DefaultTxnTypeMetricsWindowBlocks = uint64(1000)
+	// txnTypeMetricsPersistInterval is how often the metrics are written to the DB.
+	txnTypeMetricsPersistInterval = time.Minute
+)
+
+// TxnTypeMetrics are the totals of the transactions of one TxnType in a block or a range of blocks.
+type TxnTypeMetrics struct {
+	TxnType   TxnString
+	Count     uint64
+	SizeBytes uint64
+	FeeNanos  uint64
+}
+
+func (metrics *TxnTypeMetrics) add(other *TxnTypeMetrics) {
+	metrics.Count += other.Count
+	metrics.SizeBytes += other.SizeBytes
+	metrics.FeeNanos += other.FeeNanos
+}
+
+// BlockTxnTypeMetrics are the TxnTypeMetrics of a committed block. TxnTypes is sorted by TxnType.
+type BlockTxnTypeMetrics struct {
+	BlockHeight       uint64
+	BlockHashHex      string
+	TimestampNanoSecs int64
+	TxnTypes          []*TxnTypeMetrics
+}
+
+// TxnTypeMetricsSummary adds up the TxnTypeMetrics of a range of blocks. TxnTypes is sorted by count, largest
+// first, so the TxnTypes with the most traffic come first.
+type TxnTypeMetricsSummary struct {
+	NumBlocks        uint64
+	StartBlockHeight uint64
+	EndBlockHeight   uint64
+	TxnTypes         []*TxnTypeMetrics
+}
+
+// NewBlockTxnTypeMetrics computes the metrics of the block's transactions.
+func NewBlockTxnTypeMetrics(block *MsgDeSoBlock) (*BlockTxnTypeMetrics, error) {
+	blockHash, err := block.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewBlockTxnTypeMetrics: Problem hashing block")
+	}
+	metricsByTxnType := make(map[TxnType]*TxnTypeMetrics)
+	var addTxn func(txn *MsgDeSoTxn) error
+	addTxn = func(txn *MsgDeSoTxn) error {
+		if txn.TxnMeta == nil {
+			return fmt.Errorf("NewBlockTxnTypeMetrics: Transaction %v has no metadata", txn.Hash())
+		}
+		txnType := txn.TxnMeta.GetTxnType()
+		if txnType == TxnTypeAtomicTxnsWrapper {
+			for _, innerTxn := range txn.TxnMeta.(*AtomicTxnsWrapperMetadata).Txns {
+				if err := addTxn(innerTxn); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		txnBytes, err := txn.ToBytes(false)
+		if err != nil {
+			return errors.Wrapf(err, "NewBlockTxnTypeMetrics: Problem encoding transaction %v", txn.Hash())
+		}
+		metrics, exists := metricsByTxnType[txnType]
+		if !exists {
+			metrics = &TxnTypeMetrics{TxnType: txnType.GetTxnString()}
+			metricsByTxnType[txnType] = metrics
+		}
+		metrics.add(&TxnTypeMetrics{Count: 1, SizeBytes: uint64(len(txnBytes)), FeeNanos: txn.TxnFeeNanos})
+		return nil
+	}
+	for _, txn := range block.Txns {
+		if err = addTxn(txn); err != nil {
+			return nil, err
+		}
+	}
+
+	blockMetrics := &BlockTxnTypeMetrics{
+		BlockHeight:       block.Header.Height,
+		BlockHashHex:      blockHash.String(),
+		TimestampNanoSecs: block.Header.TstampNanoSecs,
+	}
+	for _, metrics := range metricsByTxnType {
+		blockMetrics.TxnTypes = append(blockMetrics.TxnTypes, metrics)
+	}
+	sortTxnTypeMetricsByTxnType(blockMetrics.TxnTypes)
+	return blockMetrics, nil
+}
+
+func sortTxnTypeMetricsByTxnType(txnTypes []*TxnTypeMetrics) {
+	sort.Slice(txnTypes, func(ii, jj int) bool {
+		return GetTxnTypeFromString(txnTypes[ii].TxnType) < GetTxnTypeFromString(txnTypes[jj].TxnType)
+	})
+}
+
+func (blockMetrics *BlockTxnTypeMetrics) ToBytes() []byte {
+	var data []byte
+	data = append(data, UintToBuf(blockMetrics.BlockHeight)...)
+	data = append(data, EncodeByteArray([]byte(blockMetrics.BlockHashHex))...)
+	data = append(data, IntToBuf(blockMetrics.TimestampNanoSecs)...)
+	data = append(data, UintToBuf(uint64(len(blockMetrics.TxnTypes)))...)
+	for _, metrics := range blockMetrics.TxnTypes {
+		data = append(data, UintToBuf(uint64(GetTxnTypeFromString(metrics.TxnType)))...)
+		data = append(data, UintToBuf(metrics.Count)...)
+		data = append(data, UintToBuf(metrics.SizeBytes)...)
+		data = append(data, UintToBuf(metrics.FeeNanos)...)
+	}
+	return data
+}
+
+func (blockMetrics *BlockTxnTypeMetrics) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	var err error
+	if blockMetrics.BlockHeight, err = ReadUvarint(rr); err != nil {
+		return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading BlockHeight")
+	}
+	blockHashHex, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading BlockHashHex")
+	}
+	blockMetrics.BlockHashHex = string(blockHashHex)
+	if blockMetrics.TimestampNanoSecs, err = ReadVarint(rr); err != nil {
+		return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading TimestampNanoSecs")
+	}
+	numTxnTypes, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading number of TxnTypes")
+	}
+	blockMetrics.TxnTypes = nil
+	for ii := uint64(0); ii < numTxnTypes; ii++ {
+		txnType, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading TxnType")
+		}
+		metrics := &TxnTypeMetrics{TxnType: TxnType(txnType).GetTxnString()}
+		if metrics.Count, err = ReadUvarint(rr); err != nil {
+			return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading Count")
+		}
+		if metrics.SizeBytes, err = ReadUvarint(rr); err != nil {
+			return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading SizeBytes")
+		}
+		if metrics.FeeNanos, err = ReadUvarint(rr); err != nil {
+			return errors.Wrapf(err, "BlockTxnTypeMetrics.FromBytes: Problem reading FeeNanos")
+		}
+		blockMetrics.TxnTypes = append(blockMetrics.TxnTypes, metrics)
+	}
+	return nil
+}
+
+type TxnTypeMetricsTracker struct {
+	// db is nil if the metrics are only kept in memory.
+	db         *badger.DB
+	windowSize int
+
+	mtx sync.RWMutex
+	// blocks is a ring holding the metrics of the last numBlocks blocks, oldest first, starting at index start.
+	blocks    []*BlockTxnTypeMetrics
+	start     int
+	numBlocks int
+	// dirty is set when the ring changes, and cleared when it's written to the DB.
+	dirty bool
+
+	quit      chan struct{}
+	waitGroup sync.WaitGroup
+}
+
+// NewTxnTypeMetricsTracker creates a tracker that keeps the metrics of the last windowSize blocks, loading the
+// metrics saved in the DB, if any.
+func NewTxnTypeMetricsTracker(db *badger.DB, windowSize uint64) (*TxnTypeMetricsTracker, error) {
+	if windowSize == 0 {
+		return nil, fmt.Errorf("NewTxnTypeMetricsTracker: Window size must be positive")
+	}
+	tracker := &TxnTypeMetricsTracker{
+		db:         db,
+		windowSize: int(windowSize),
+		blocks:     make([]*BlockTxnTypeMetrics, windowSize),
+		quit:       make(chan struct{}),
+	}
+	if db == nil {
+		return tracker, nil
+	}
+	savedBlocks, err := DBGetTxnTypeBlockMetrics(db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewTxnTypeMetricsTracker: ")
+	}
+	for _, blockMetrics := range savedBlocks {
+		tracker._pushBlock(blockMetrics)
+	}
+	return tracker, nil
+}
+
+// RegisterWithEventManager subscribes the tracker to the blocks committed and disconnected by the provided
+// EventManager.
+func (tracker *TxnTypeMetricsTracker) RegisterWithEventManager(eventManager *EventManager) {
+	eventManager.OnBlockCommitted(tracker._handleBlockCommitted)
+	eventManager.OnBlockDisconnected(tracker._handleBlockDisconnected)
+}
+
+// Start starts the background worker that writes the metrics to the DB.
+func (tracker *TxnTypeMetricsTracker) Start() {
+	if tracker.db == nil {
+		return
+	}
+	tracker.waitGroup.Add(1)
+	go func() {
+		defer tracker.waitGroup.Done()
+		ticker := time.NewTicker(txnTypeMetricsPersistInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-tracker.quit:
+				return
+			case <-ticker.C:
+				if err := tracker.Persist(); err != nil {
+					glog.Errorf("TxnTypeMetricsTracker: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the background worker and writes the metrics to the DB one last time.
+func (tracker *TxnTypeMetricsTracker) Stop() {
+	if tracker.db == nil {
+		return
+	}
+	close(tracker.quit)
+	tracker.waitGroup.Wait()
+	if err := tracker.Persist(); err != nil {
+		glog.Errorf("TxnTypeMetricsTracker.Stop: %v", err)
+	}
+}
+
+func (tracker *TxnTypeMetricsTracker) _handleBlockCommitted(event *BlockEvent) {
+	if event.Block == nil || event.Block.Header == nil {
+		return
+	}
+	blockMetrics, err := NewBlockTxnTypeMetrics(event.Block)
+	if err != nil {
+		glog.Errorf("TxnTypeMetricsTracker._handleBlockCommitted: %v", err)
+		return
+	}
+	tracker.AddBlock(blockMetrics)
+}
+
+func (tracker *TxnTypeMetricsTracker) _handleBlockDisconnected(event *BlockEvent) {
+	if event.Block == nil || event.Block.Header == nil {
+		return
+	}
+	blockHash, err := event.Block.Hash()
+	if err != nil {
+		glog.Errorf("TxnTypeMetricsTracker._handleBlockDisconnected: Problem hashing block: %v", err)
+		return
+	}
+	tracker.RemoveBlock(blockHash)
+}
+
+// AddBlock adds the metrics of a block to the window, evicting the oldest block if the window is full. Blocks at
+// or above the block's height are removed first, since they can't be on the same chain.
+func (tracker *TxnTypeMetricsTracker) AddBlock(blockMetrics *BlockTxnTypeMetrics) {
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+	tracker._pushBlock(blockMetrics)
+	tracker.dirty = true
+}
+
+func (tracker *TxnTypeMetricsTracker) _pushBlock(blockMetrics *BlockTxnTypeMetrics) {
+	for tracker.numBlocks > 0 && tracker._newestBlock().BlockHeight >= blockMetrics.BlockHeight {
+		tracker._popNewestBlock()
+	}
+	if tracker.numBlocks == tracker.windowSize {
+		tracker.blocks[tracker.start] = nil
+		tracker.start = (tracker.start + 1) % tracker.windowSize
+		tracker.numBlocks--
+	}
+	tracker.blocks[(tracker.start+tracker.numBlocks)%tracker.windowSize] = blockMetrics
+	tracker.numBlocks++
+}
+
+func (tracker *TxnTypeMetricsTracker) _newestBlock() *BlockTxnTypeMetrics {
+	return tracker.blocks[(tracker.start+tracker.numBlocks-1)%tracker.windowSize]
+}
+
+func (tracker *TxnTypeMetricsTracker) _popNewestBlock() {
+	tracker.blocks[(tracker.start+tracker.numBlocks-1)%tracker.windowSize] = nil
+	tracker.numBlocks--
+}
+
+// RemoveBlock removes a block that was disconnected from the window. Only the newest block can be disconnected,
+// so nothing happens if the block isn't the newest.
+func (tracker *TxnTypeMetricsTracker) RemoveBlock(blockHash *BlockHash) {
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+	if tracker.numBlocks == 0 || tracker._newestBlock().BlockHashHex != blockHash.String() {
+		return
+	}
+	tracker._popNewestBlock()
+	tracker.dirty = true
+}
+
+// GetBlocks returns the metrics of the last numBlocks blocks in the window, oldest first. A numBlocks of zero
+// returns the whole window.
+func (tracker *TxnTypeMetricsTracker) GetBlocks(numBlocks uint64) []*BlockTxnTypeMetrics {
+	tracker.mtx.RLock()
+	defer tracker.mtx.RUnlock()
+	return tracker._getBlocks(numBlocks)
+}
+
+func (tracker *TxnTypeMetricsTracker) _getBlocks(numBlocks uint64) []*BlockTxnTypeMetrics {
+	if numBlocks == 0 || numBlocks > uint64(tracker.numBlocks) {
+		numBlocks = uint64(tracker.numBlocks)
+	}
+	blocks := make([]*BlockTxnTypeMetrics, 0, numBlocks)
+	for ii := tracker.numBlocks - int(numBlocks); ii < tracker.numBlocks; ii++ {
+		blocks = append(blocks, tracker.blocks[(tracker.start+ii)%tracker.windowSize])
+	}
+	return blocks
+}
+
+// GetSummary adds up the metrics of the last numBlocks blocks in the window. A numBlocks of zero adds up the whole
+// window.
+func (tracker *TxnTypeMetricsTracker) GetSummary(numBlocks uint64) *TxnTypeMetricsSummary {
+	tracker.mtx.RLock()
+	defer tracker.mtx.RUnlock()
+
+	blocks := tracker._getBlocks(numBlocks)
+	summary := &TxnTypeMetricsSummary{
+		NumBlocks: uint64(len(blocks)),
+		TxnTypes:  []*TxnTypeMetrics{},
+	}
+	if len(blocks) == 0 {
+		return summary
+	}
+	summary.StartBlockHeight = blocks[0].BlockHeight
+	summary.EndBlockHeight = blocks[len(blocks)-1].BlockHeight
+
+	totalsByTxnType := make(map[TxnString]*TxnTypeMetrics)
+	for _, blockMetrics := range blocks {
+		for _, metrics := range blockMetrics.TxnTypes {
+			totals, exists := totalsByTxnType[metrics.TxnType]
+			if !exists {
+				totals = &TxnTypeMetrics{TxnType: metrics.TxnType}
+				totalsByTxnType[metrics.TxnType] = totals
+				summary.TxnTypes = append(summary.TxnTypes, totals)
+			}
+			totals.add(metrics)
+		}
+	}
+	sort.SliceStable(summary.TxnTypes, func(ii, jj int) bool {
+		return summary.TxnTypes[ii].Count > summary.TxnTypes[jj].Count
+	})
+	return summary
+}
+
+// Persist writes the window to the DB if it changed since it was last written, and deletes the saved blocks that
+// are no longer in the window.
+func (tracker *TxnTypeMetricsTracker) Persist() error {
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+	if tracker.db == nil || !tracker.dirty {
+		return nil
+	}
+
+	blocks := tracker._getBlocks(0)
+	blockHeights := make(map[uint64]bool)
+	for _, blockMetrics := range blocks {
+		blockHeights[blockMetrics.BlockHeight] = true
+	}
+	err := tracker.db.Update(func(txn *badger.Txn) error {
+		savedBlockHeights, err := DBGetTxnTypeBlockMetricsHeightsWithTxn(txn)
+		if err != nil {
+			return err
+		}
+		for _, blockHeight := range savedBlockHeights {
+			if !blockHeights[blockHeight] {
+				if err = DBDeleteTxnTypeBlockMetricsWithTxn(txn, blockHeight); err != nil {
+					return err
+				}
+			}
+		}
+		for _, blockMetrics := range blocks {
+			if err = DBPutTxnTypeBlockMetricsWithTxn(txn, blockMetrics); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "TxnTypeMetricsTracker.Persist: Problem writing metrics")
+	}
+	tracker.dirty = false
+	return nil
+}
+
+//
+// DB UTILS
+//
+
+func DBKeyForTxnTypeBlockMetrics(blockHeight uint64) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxnTypeBlockMetrics...), EncodeUint64(blockHeight)...)
+}
+
+// DBGetTxnTypeBlockMetrics returns the saved block metrics, oldest first.
+func DBGetTxnTypeBlockMetrics(handle *badger.DB) ([]*BlockTxnTypeMetrics, error) {
+	var blocks []*BlockTxnTypeMetrics
+	err := handle.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = Prefixes.PrefixTxnTypeBlockMetrics
+		iterator := txn.NewIterator(opts)
+		defer iterator.Close()
+
+		for iterator.Seek(opts.Prefix); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+			blockMetricsBytes, err := iterator.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			blockMetrics := &BlockTxnTypeMetrics{}
+			if err = blockMetrics.FromBytes(blockMetricsBytes); err != nil {
+				return err
+			}
+			blocks = append(blocks, blockMetrics)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "DBGetTxnTypeBlockMetrics: Problem retrieving metrics")
+	}
+	return blocks, nil
+}
+
+func DBGetTxnTypeBlockMetricsHeightsWithTxn(txn *badger.Txn) ([]uint64, error) {
+	var blockHeights []uint64
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = Prefixes.PrefixTxnTypeBlockMetrics
+	opts.PrefetchValues = false
+	iterator := txn.NewIterator(opts)
+	defer iterator.Close()
+
+	for iterator.Seek(opts.Prefix); iterator.ValidForPrefix(opts.Prefix); iterator.Next() {
+		key := iterator.Item().Key()
+		if len(key) != len(opts.Prefix)+8 {
+			return nil, fmt.Errorf("DBGetTxnTypeBlockMetricsHeightsWithTxn: Invalid key length %v", len(key))
+		}
+		blockHeights = append(blockHeights, DecodeUint64(key[len(opts.Prefix):]))
+	}
+	return blockHeights, nil
+}
+
+func DBPutTxnTypeBlockMetricsWithTxn(txn *badger.Txn, blockMetrics *BlockTxnTypeMetrics) error {
+	if err := txn.Set(DBKeyForTxnTypeBlockMetrics(blockMetrics.BlockHeight), blockMetrics.ToBytes()); err != nil {
+		return errors.Wrapf(err, "DBPutTxnTypeBlockMetricsWithTxn: Problem setting metrics")
+	}
+	return nil
+}
+
+func DBDeleteTxnTypeBlockMetricsWithTxn(txn *badger.Txn, blockHeight uint64) error {
+	if err := txn.Delete(DBKeyForTxnTypeBlockMetrics(blockHeight)); err != nil {
+		return errors.Wrapf(err, "DBDeleteTxnTypeBlockMetricsWithTxn: Problem deleting metrics")
+	}
+	return nil
+}
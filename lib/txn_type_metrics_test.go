@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func _newTestBlockTxnTypeMetrics(blockHeight uint64, numPosts uint64, numLikes uint64) *BlockTxnTypeMetrics {
+	blockMetrics := &BlockTxnTypeMetrics{
+		BlockHeight:  blockHeight,
+		BlockHashHex: RandomBytesHex(HashSizeBytes),
+	}
+	if numPosts > 0 {
+		blockMetrics.TxnTypes = append(blockMetrics.TxnTypes, &TxnTypeMetrics{
+			TxnType: TxnStringSubmitPost, Count: numPosts, SizeBytes: 100 * numPosts, FeeNanos: 10 * numPosts})
+	}
+	if numLikes > 0 {
+		blockMetrics.TxnTypes = append(blockMetrics.TxnTypes, &TxnTypeMetrics{
+			TxnType: TxnStringLike, Count: numLikes, SizeBytes: 50 * numLikes, FeeNanos: 5 * numLikes})
+	}
+	return blockMetrics
+}
+
+func TestNewBlockTxnTypeMetrics(t *testing.T) {
+	require := require.New(t)
+
+	postTxn := &MsgDeSoTxn{TxnMeta: &SubmitPostMetadata{}, TxnFeeNanos: 7}
+	likeTxn := &MsgDeSoTxn{TxnMeta: &LikeMetadata{LikedPostHash: &ZeroBlockHash}, TxnFeeNanos: 3}
+	block := &MsgDeSoBlock{
+		Header: &MsgDeSoHeader{Height: 5, TstampNanoSecs: 1000, PrevBlockHash: &ZeroBlockHash,
+			TransactionMerkleRoot: &ZeroBlockHash},
+		Txns: []*MsgDeSoTxn{
+			{TxnMeta: &BlockRewardMetadataa{}},
+			postTxn,
+			// The inner transactions of a wrapper are counted under their own types.
+			{TxnMeta: &AtomicTxnsWrapperMetadata{Txns: []*MsgDeSoTxn{postTxn, likeTxn}}},
+		},
+	}
+	blockMetrics, err := NewBlockTxnTypeMetrics(block)
+	require.NoError(err)
+	require.Equal(uint64(5), blockMetrics.BlockHeight)
+	require.Equal(int64(1000), blockMetrics.TimestampNanoSecs)
+
+	postTxnBytes, err := postTxn.ToBytes(false)
+	require.NoError(err)
+	require.Len(blockMetrics.TxnTypes, 3)
+	require.Equal(TxnStringBlockReward, blockMetrics.TxnTypes[0].TxnType)
+	require.Equal(&TxnTypeMetrics{
+		TxnType: TxnStringSubmitPost, Count: 2, SizeBytes: 2 * uint64(len(postTxnBytes)), FeeNanos: 14,
+	}, blockMetrics.TxnTypes[1])
+	require.Equal(TxnStringLike, blockMetrics.TxnTypes[2].TxnType)
+	require.Equal(uint64(1), blockMetrics.TxnTypes[2].Count)
+
+	decodedBlockMetrics := &BlockTxnTypeMetrics{}
+	require.NoError(decodedBlockMetrics.FromBytes(blockMetrics.ToBytes()))
+	require.Equal(blockMetrics, decodedBlockMetrics)
+}
+
+func TestTxnTypeMetricsTracker(t *testing.T) {
+	require := require.New(t)
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+
+	_, err := NewTxnTypeMetricsTracker(db, 0)
+	require.Error(err)
+
+	tracker, err := NewTxnTypeMetricsTracker(db, 3)
+	require.NoError(err)
+	require.Empty(tracker.GetBlocks(0))
+	require.Equal(&TxnTypeMetricsSummary{TxnTypes: []*TxnTypeMetrics{}}, tracker.GetSummary(0))
+
+	// The window only keeps the last three blocks.
+	var blocks []*BlockTxnTypeMetrics
+	for ii := uint64(1); ii <= 4; ii++ {
+		blocks = append(blocks, _newTestBlockTxnTypeMetrics(ii, ii, 1))
+		tracker.AddBlock(blocks[ii-1])
+	}
+	require.Equal(blocks[1:], tracker.GetBlocks(0))
+	require.Equal(blocks[3:], tracker.GetBlocks(1))
+
+	// Summaries add up the blocks, with the busiest TxnType first.
+	require.Equal(&TxnTypeMetricsSummary{
+		NumBlocks:        3,
+		StartBlockHeight: 2,
+		EndBlockHeight:   4,
+		TxnTypes: []*TxnTypeMetrics{
+			{TxnType: TxnStringSubmitPost, Count: 9, SizeBytes: 900, FeeNanos: 90},
+			{TxnType: TxnStringLike, Count: 3, SizeBytes: 150, FeeNanos: 15},
+		},
+	}, tracker.GetSummary(0))
+	require.Equal(uint64(4), tracker.GetSummary(1).TxnTypes[0].Count)
+
+	// Only the newest block can be removed.
+	tracker.RemoveBlock(NewBlockHash(RandomBytes(HashSizeBytes)))
+	require.Equal(blocks[1:], tracker.GetBlocks(0))
+	blockHashBytes, err := hex.DecodeString(blocks[3].BlockHashHex)
+	require.NoError(err)
+	tracker.RemoveBlock(NewBlockHash(blockHashBytes))
+	require.Equal(blocks[1:3], tracker.GetBlocks(0))
+
+	// Adding a block replaces the blocks at or above its height.
+	forkBlock := _newTestBlockTxnTypeMetrics(3, 0, 20)
+	tracker.AddBlock(forkBlock)
+	require.Equal([]*BlockTxnTypeMetrics{blocks[1], forkBlock}, tracker.GetBlocks(0))
+
+	// The window is reloaded from the DB after it's persisted, and blocks that left the window are deleted.
+	require.NoError(tracker.Persist())
+	reloadedTracker, err := NewTxnTypeMetricsTracker(db, 3)
+	require.NoError(err)
+	require.Equal(tracker.GetBlocks(0), reloadedTracker.GetBlocks(0))
+
+	tracker.AddBlock(_newTestBlockTxnTypeMetrics(4, 1, 0))
+	tracker.AddBlock(_newTestBlockTxnTypeMetrics(5, 1, 0))
+	require.NoError(tracker.Persist())
+	savedBlocks, err := DBGetTxnTypeBlockMetrics(db)
+	require.NoError(err)
+	require.Equal(tracker.GetBlocks(0), savedBlocks)
+
+	// A smaller window only loads the newest blocks.
+	reloadedTracker, err = NewTxnTypeMetricsTracker(db, 2)
+	require.NoError(err)
+	require.Equal(tracker.GetBlocks(2), reloadedTracker.GetBlocks(0))
+}
+
+func TestTxnTypeMetricsTrackerBlockEvents(t *testing.T) {
+	require := require.New(t)
+
+	tracker, err := NewTxnTypeMetricsTracker(nil, 10)
+	require.NoError(err)
+	eventManager := NewEventManager()
+	tracker.RegisterWithEventManager(eventManager)
+
+	newBlock := func(height uint64, numPosts int) *MsgDeSoBlock {
+		block := &MsgDeSoBlock{
+			Header: &MsgDeSoHeader{Height: height, PrevBlockHash: &ZeroBlockHash,
+				TransactionMerkleRoot: NewBlockHash(RandomBytes(HashSizeBytes))},
+			Txns: []*MsgDeSoTxn{{TxnMeta: &BlockRewardMetadataa{}}},
+		}
+		for ii := 0; ii < numPosts; ii++ {
+			block.Txns = append(block.Txns, &MsgDeSoTxn{TxnMeta: &SubmitPostMetadata{}})
+		}
+		return block
+	}
+	block1, block2, forkBlock2 := newBlock(1, 0), newBlock(2, 5), newBlock(2, 1)
+	eventManager.blockCommitted(&BlockEvent{Block: block1})
+	eventManager.blockCommitted(&BlockEvent{Block: block2})
+	summary := tracker.GetSummary(0)
+	require.Equal(uint64(2), summary.NumBlocks)
+	require.Equal(TxnStringSubmitPost, summary.TxnTypes[0].TxnType)
+	require.Equal(uint64(5), summary.TxnTypes[0].Count)
+
+	// A reorg replaces the disconnected block.
+	eventManager.blockDisconnected(&BlockEvent{Block: block2})
+	require.Len(tracker.GetBlocks(0), 1)
+	eventManager.blockCommitted(&BlockEvent{Block: forkBlock2})
+	blocks := tracker.GetBlocks(0)
+	require.Len(blocks, 2)
+	forkBlock2Hash, err := forkBlock2.Hash()
+	require.NoError(err)
+	require.Equal(forkBlock2Hash.String(), blocks[1].BlockHashHex)
+	require.Equal(&TxnTypeMetrics{TxnType: TxnStringSubmitPost, Count: 1, SizeBytes: blocks[1].TxnTypes[1].SizeBytes},
+		tracker.GetSummary(0).TxnTypes[1])
+}
@@ -0,0 +1,154 @@
+package lib
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Undo Data Pruning
+//
+// When a block is connected, the UtxoOperations of its transactions are stored under PrefixBlockHashToUtxoOperations
+// so that the block can be disconnected if the chain reorgs. Once a block is final, the chain never disconnects it,
+// so its UtxoOperations are only read by tooling that replays history, yet they used to be kept forever and make up
+// a large part of the DB.
+//
+// With an undo data retention, the node keeps the UtxoOperations of the most recent final blocks and deletes the
+// rest. A block's UtxoOperations are deleted once the block is final and at least the retention number of final
+// blocks have been added after it:
+//   - A PoS block is final once it's committed, and the PoW blocks are final once a PoS block is committed.
+//   - Before the PoS cutover, a PoW block is final once it has more confirmations than the max reorg depth. Without a
+//     max reorg depth, PoW blocks are never final and their UtxoOperations are never pruned. Note that a reorg the
+//     operator approves through the reorg guard can't disconnect blocks whose UtxoOperations were pruned.
+//
+// Pruning runs after a block is committed, and deletes the UtxoOperations of at most undoDataPruningMaxBlocksPerRun
+// blocks each time so that a node that enables pruning late catches up without stalling block processing. The
+// height pruned up to is stored under PrefixUndoDataPrunedBlockHeight, so pruning picks up where it left off after
+// a restart.
+//
+// Archival nodes, and nodes that replay the UtxoOperations of old blocks, e.g. with ReconcileDeSoBalance, should set
+// the retention to zero, which keeps the UtxoOperations of every block.
+
+const (
+	// DefaultUndoDataRetentionBlocks is the default number of final blocks whose UtxoOperations are kept.
+	DefaultUndoDataRetentionBlocks = 100000
+
+	// undoDataPruningMaxBlocksPerRun is the maximum number of blocks whose UtxoOperations are deleted each time a
+	// block is committed.
+	undoDataPruningMaxBlocksPerRun = 1000
+)
+
+// SetUndoDataRetentionBlocks sets the number of final blocks whose UtxoOperations are kept. A retention of zero
+// keeps the UtxoOperations of every block.
+func (bc *Blockchain) SetUndoDataRetentionBlocks(undoDataRetentionBlocks uint64) {
+	bc.ChainLock.Lock()
+	defer bc.ChainLock.Unlock()
+	bc.undoDataRetentionBlocks = undoDataRetentionBlocks
+}
+
+// GetUndoDataPrunedBlockHeight returns the height up to which the UtxoOperations of main chain blocks have been
+// pruned, or zero if they haven't been pruned.
+func (bc *Blockchain) GetUndoDataPrunedBlockHeight() (uint64, error) {
+	return DBGetUndoDataPrunedBlockHeight(bc.db)
+}
+
+// getFinalBlockHeight returns the height of the highest main chain block that the chain won't reorg past without
+// operator approval, following the rules of GetBlockConfirmationStatus. It returns false if no block is final. It
+// must be called with the ChainLock held.
+func (bc *Blockchain) getFinalBlockHeight() (uint64, bool) {
+	tip := bc.blockTip()
+	if tip == nil {
+		return 0, false
+	}
+	committedTip, _ := bc.GetCommittedTip()
+	if committedTip != nil && bc.params.IsPoSBlockHeight(uint64(committedTip.Height)) {
+		return uint64(committedTip.Height), true
+	}
+	if bc.maxReorgDepth > 0 && uint64(tip.Height) > bc.maxReorgDepth {
+		return uint64(tip.Height) - bc.maxReorgDepth, true
+	}
+	return 0, false
+}
+
+// pruneUndoData deletes the UtxoOperations of the final main chain blocks that are past the undo data retention.
+// Pruning is best effort, so errors are logged rather than returned. It must be called with the ChainLock held.
+func (bc *Blockchain) pruneUndoData() {
+	if bc.undoDataRetentionBlocks == 0 {
+		return
+	}
+	finalBlockHeight, isFinal := bc.getFinalBlockHeight()
+	if !isFinal || finalBlockHeight <= bc.undoDataRetentionBlocks {
+		return
+	}
+	pruneToHeight := finalBlockHeight - bc.undoDataRetentionBlocks
+
+	err := bc.db.Update(func(txn *badger.Txn) error {
+		prunedHeight, err := DBGetUndoDataPrunedBlockHeightWithTxn(txn)
+		if err != nil {
+			return err
+		}
+		if prunedHeight >= pruneToHeight {
+			return nil
+		}
+		if pruneToHeight-prunedHeight > undoDataPruningMaxBlocksPerRun {
+			pruneToHeight = prunedHeight + undoDataPruningMaxBlocksPerRun
+		}
+		for height := prunedHeight + 1; height <= pruneToHeight; height++ {
+			if height >= uint64(len(bc.bestChain)) {
+				return errors.Errorf("Block at height %d is not in the best chain", height)
+			}
+			blockHash := bc.bestChain[height].Hash
+			// Blocks that were hypersynced past never had their UtxoOperations stored, so skip them rather than
+			// writing a tombstone for them.
+			if _, err = txn.Get(_DbKeyForUtxoOps(blockHash)); errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			} else if err != nil {
+				return errors.Wrapf(err, "Problem getting UtxoOperations for block %v", blockHash)
+			}
+			// Pruning is local to this node, so we don't emit the deletions to the state syncer.
+			if err = DeleteUtxoOperationsForBlockWithTxn(txn, bc.snapshot, blockHash, nil, true); err != nil {
+				return errors.Wrapf(err, "Problem deleting UtxoOperations for block %v", blockHash)
+			}
+		}
+		return DBPutUndoDataPrunedBlockHeightWithTxn(txn, pruneToHeight)
+	})
+	if err != nil {
+		glog.Errorf("pruneUndoData: Problem pruning UtxoOperations up to height %d: %v", pruneToHeight, err)
+	}
+}
+
+func DBGetUndoDataPrunedBlockHeightWithTxn(txn *badger.Txn) (uint64, error) {
+	item, err := txn.Get(Prefixes.PrefixUndoDataPrunedBlockHeight)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "DBGetUndoDataPrunedBlockHeightWithTxn: Problem getting pruned height")
+	}
+	prunedHeightBytes, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "DBGetUndoDataPrunedBlockHeightWithTxn: Problem copying pruned height")
+	}
+	if len(prunedHeightBytes) != 8 {
+		return 0, errors.Errorf("DBGetUndoDataPrunedBlockHeightWithTxn: Invalid pruned height length %d",
+			len(prunedHeightBytes))
+	}
+	return DecodeUint64(prunedHeightBytes), nil
+}
+
+func DBGetUndoDataPrunedBlockHeight(handle *badger.DB) (uint64, error) {
+	var prunedHeight uint64
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		prunedHeight, err = DBGetUndoDataPrunedBlockHeightWithTxn(txn)
+		return err
+	})
+	return prunedHeight, err
+}
+
+func DBPutUndoDataPrunedBlockHeightWithTxn(txn *badger.Txn, prunedHeight uint64) error {
+	if err := txn.Set(Prefixes.PrefixUndoDataPrunedBlockHeight, EncodeUint64(prunedHeight)); err != nil {
+		return errors.Wrapf(err, "DBPutUndoDataPrunedBlockHeightWithTxn: Problem setting pruned height")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndoDataPruning(t *testing.T) {
+	require := require.New(t)
+	setupTestDeSoEncoder(t)
+
+	params := NewTestParams(&DeSoTestnetParams)
+	sim, err := NewReorgSimulator(&params, []string{senderPkString})
+	require.NoError(err)
+	defer sim.Stop()
+
+	hasUndoData := func(node *ReorgSimulatorNode, height int) bool {
+		_, err := GetUtxoOperationsForBlock(node.Chain.db, nil, node.Chain.bestChain[height].Hash)
+		return err == nil
+	}
+
+	// Without a max reorg depth, PoW blocks are never final, so nothing is pruned.
+	mainNode, err := sim.NewNode()
+	require.NoError(err)
+	mainNode.Chain.SetUndoDataRetentionBlocks(3)
+	_, err = mainNode.MineBlocks(6, nil)
+	require.NoError(err)
+	prunedHeight, err := mainNode.Chain.GetUndoDataPrunedBlockHeight()
+	require.NoError(err)
+	require.Zero(prunedHeight)
+	require.True(hasUndoData(mainNode, 1))
+
+	// Once blocks are final, the undo data of the final blocks past the retention is pruned.
+	mainNode.Chain.SetMaxReorgDepth(2)
+	_, err = mainNode.MineBlocks(4, nil)
+	require.NoError(err)
+	prunedHeight, err = mainNode.Chain.GetUndoDataPrunedBlockHeight()
+	require.NoError(err)
+	require.Equal(uint64(5), prunedHeight)
+	for height := 1; height <= 10; height++ {
+		require.Equal(height > 5, hasUndoData(mainNode, height), "height %d", height)
+	}
+
+	// Blocks within the max reorg depth can still be disconnected.
+	branch, err := sim.BuildBranch(mainNode, 8, 3, nil)
+	require.NoError(err)
+	require.NoError(sim.Reorg(mainNode, branch))
+	require.NoError(CompareChainStates(mainNode.Chain, branch.Node.Chain))
+
+	// A retention of zero keeps the undo data of every block.
+	archivalNode, err := sim.NewNode()
+	require.NoError(err)
+	archivalNode.Chain.SetMaxReorgDepth(2)
+	_, err = archivalNode.MineBlocks(10, nil)
+	require.NoError(err)
+	prunedHeight, err = archivalNode.Chain.GetUndoDataPrunedBlockHeight()
+	require.NoError(err)
+	require.Zero(prunedHeight)
+	for height := 1; height <= 10; height++ {
+		require.True(hasUndoData(archivalNode, height), "height %d", height)
+	}
+}
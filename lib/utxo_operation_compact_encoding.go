@@ -0,0 +1,544 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// The UtxoOperation is a union of every field that any operation type needs in order to be
+// disconnected, and the original encoding writes all of them for every operation, most as
+// zero values or nil existence bytes. Once the UtxoOperationCompactEncodingMigration is
+// triggered, a UtxoOperation is instead encoded as:
+//
+//	<Type uvarint> <NumFields uvarint> [<Tag uvarint> <Field []byte>]...
+//
+// where only the fields that are set are included, in increasing tag order. Each field is
+// encoded by a utxoOperationFieldEncoder, so a field's encoding can be tested on its own and
+// new fields don't change the encoding of operations that don't set them.
+//
+// Tags are part of the encoding. They must never be renumbered or reused; a new field gets
+// the next unused tag and is appended to utxoOperationFields.
+//
+// The compact encoding only changes how a UtxoOperation is stored. Decoding fills in the same
+// UtxoOperation, and the disconnect functions read it through the typed data of its operation
+// type in utxo_operation_data.go.
+
+// UtxoOperationFieldTag identifies a field of a UtxoOperation in the compact encoding.
+type UtxoOperationFieldTag uint64
+
+// utxoOperationFieldEncoder encodes a single field of a UtxoOperation in the compact encoding.
+type utxoOperationFieldEncoder interface {
+	// IsSet returns true if the field should be included in the encoding of the operation.
+	IsSet(op *UtxoOperation) bool
+	Encode(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte
+	Decode(op *UtxoOperation, rr *bytes.Reader) error
+}
+
+type utxoOperationField struct {
+	Tag     UtxoOperationFieldTag
+	Name    string
+	Encoder utxoOperationFieldEncoder
+}
+
+// utxoOpEncoderField encodes a field holding a pointer to a DeSoEncoder.
+type utxoOpEncoderField[E any, T interface {
+	*E
+	DeSoEncoder
+}] struct {
+	get func(op *UtxoOperation) *T
+}
+
+func newUtxoOpEncoderField[E any, T interface {
+	*E
+	DeSoEncoder
+}](get func(op *UtxoOperation) *T) utxoOperationFieldEncoder {
+	return utxoOpEncoderField[E, T]{get: get}
+}
+
+func (field utxoOpEncoderField[E, T]) IsSet(op *UtxoOperation) bool {
+	return *field.get(op) != nil
+}
+
+func (field utxoOpEncoderField[E, T]) Encode(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	return EncodeToBytes(blockHeight, *field.get(op), skipMetadata...)
+}
+
+func (field utxoOpEncoderField[E, T]) Decode(op *UtxoOperation, rr *bytes.Reader) error {
+	entry, err := DecodeDeSoEncoder(T(new(E)), rr)
+	if err != nil {
+		return err
+	}
+	*field.get(op) = entry
+	return nil
+}
+
+// utxoOpEncoderSliceField encodes a field holding a slice of pointers to a DeSoEncoder.
+type utxoOpEncoderSliceField[E any, T interface {
+	*E
+	DeSoEncoder
+}] struct {
+	get func(op *UtxoOperation) *[]T
+}
+
+func newUtxoOpEncoderSliceField[E any, T interface {
+	*E
+	DeSoEncoder
+}](get func(op *UtxoOperation) *[]T) utxoOperationFieldEncoder {
+	return utxoOpEncoderSliceField[E, T]{get: get}
+}
+
+func (field utxoOpEncoderSliceField[E, T]) IsSet(op *UtxoOperation) bool {
+	return len(*field.get(op)) > 0
+}
+
+func (field utxoOpEncoderSliceField[E, T]) Encode(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	return EncodeDeSoEncoderSlice(*field.get(op), blockHeight, skipMetadata...)
+}
+
+func (field utxoOpEncoderSliceField[E, T]) Decode(op *UtxoOperation, rr *bytes.Reader) error {
+	entries, err := DecodeDeSoEncoderSlice[T](rr)
+	if err != nil {
+		return err
+	}
+	*field.get(op) = entries
+	return nil
+}
+
+// utxoOpUint64Field encodes a uint64 field as a uvarint.
+type utxoOpUint64Field struct {
+	get func(op *UtxoOperation) *uint64
+}
+
+func (field utxoOpUint64Field) IsSet(op *UtxoOperation) bool {
+	return *field.get(op) != 0
+}
+
+func (field utxoOpUint64Field) Encode(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	return UintToBuf(*field.get(op))
+}
+
+func (field utxoOpUint64Field) Decode(op *UtxoOperation, rr *bytes.Reader) error {
+	value, err := ReadUvarint(rr)
+	if err != nil {
+		return err
+	}
+	*field.get(op) = value
+	return nil
+}
+
+// utxoOpBytesField encodes a byte slice field as a length-prefixed byte array.
+type utxoOpBytesField struct {
+	get func(op *UtxoOperation) *[]byte
+}
+
+func (field utxoOpBytesField) IsSet(op *UtxoOperation) bool {
+	return len(*field.get(op)) > 0
+}
+
+func (field utxoOpBytesField) Encode(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	return EncodeByteArray(*field.get(op))
+}
+
+func (field utxoOpBytesField) Decode(op *UtxoOperation, rr *bytes.Reader) error {
+	value, err := DecodeByteArray(rr)
+	if err != nil {
+		return err
+	}
+	*field.get(op) = value
+	return nil
+}
+
+// utxoOpFuncField encodes the fields whose types don't fit any of the generic field encoders.
+type utxoOpFuncField struct {
+	isSet  func(op *UtxoOperation) bool
+	encode func(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte
+	decode func(op *UtxoOperation, rr *bytes.Reader) error
+}
+
+func (field utxoOpFuncField) IsSet(op *UtxoOperation) bool {
+	return field.isSet(op)
+}
+
+func (field utxoOpFuncField) Encode(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	return field.encode(op, blockHeight, skipMetadata...)
+}
+
+func (field utxoOpFuncField) Decode(op *UtxoOperation, rr *bytes.Reader) error {
+	return field.decode(op, rr)
+}
+
+var utxoOperationFields = []utxoOperationField{
+	{0, "Entry", newUtxoOpEncoderField(func(op *UtxoOperation) **UtxoEntry { return &op.Entry })},
+	{1, "Key", newUtxoOpEncoderField(func(op *UtxoOperation) **UtxoKey { return &op.Key })},
+	{2, "PrevNanosPurchased", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.PrevNanosPurchased }}},
+	{3, "PrevUSDCentsPerBitcoin", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.PrevUSDCentsPerBitcoin }}},
+	{4, "PrevPostEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **PostEntry { return &op.PrevPostEntry })},
+	{5, "PrevParentPostEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **PostEntry { return &op.PrevParentPostEntry })},
+	{6, "PrevGrandparentPostEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **PostEntry { return &op.PrevGrandparentPostEntry })},
+	{7, "PrevRepostedPostEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **PostEntry { return &op.PrevRepostedPostEntry })},
+	{8, "PrevProfileEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **ProfileEntry { return &op.PrevProfileEntry })},
+	{9, "PrevLikeEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **LikeEntry { return &op.PrevLikeEntry })},
+	{10, "PrevLikeCount", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.PrevLikeCount }}},
+	{11, "PrevDiamondEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **DiamondEntry { return &op.PrevDiamondEntry })},
+	{12, "PrevNFTEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **NFTEntry { return &op.PrevNFTEntry })},
+	{13, "PrevNFTBidEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **NFTBidEntry { return &op.PrevNFTBidEntry })},
+	{14, "DeletedNFTBidEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*NFTBidEntry { return &op.DeletedNFTBidEntries })},
+	{15, "NFTPaymentUtxoKeys", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*UtxoKey { return &op.NFTPaymentUtxoKeys })},
+	{16, "NFTSpentUtxoEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*UtxoEntry { return &op.NFTSpentUtxoEntries })},
+	{17, "PrevAcceptedNFTBidEntries", utxoOpFuncField{
+		isSet:  func(op *UtxoOperation) bool { return op.PrevAcceptedNFTBidEntries != nil },
+		encode: encodeUtxoOpPrevAcceptedNFTBidEntries,
+		decode: decodeUtxoOpPrevAcceptedNFTBidEntries,
+	}},
+	{18, "PrevDerivedKeyEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **DerivedKeyEntry { return &op.PrevDerivedKeyEntry })},
+	{19, "PrevMessagingKeyEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **MessagingGroupEntry { return &op.PrevMessagingKeyEntry })},
+	{20, "PrevRepostEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **RepostEntry { return &op.PrevRepostEntry })},
+	{21, "PrevRepostCount", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.PrevRepostCount }}},
+	{22, "PrevCoinEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **CoinEntry { return &op.PrevCoinEntry })},
+	{23, "PrevCoinRoyaltyCoinEntries", utxoOpFuncField{
+		isSet:  func(op *UtxoOperation) bool { return op.PrevCoinRoyaltyCoinEntries != nil },
+		encode: encodeUtxoOpPrevCoinRoyaltyCoinEntries,
+		decode: decodeUtxoOpPrevCoinRoyaltyCoinEntries,
+	}},
+	{24, "PrevTransactorBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **BalanceEntry { return &op.PrevTransactorBalanceEntry })},
+	{25, "PrevCreatorBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **BalanceEntry { return &op.PrevCreatorBalanceEntry })},
+	{26, "FounderRewardUtxoKey", newUtxoOpEncoderField(func(op *UtxoOperation) **UtxoKey { return &op.FounderRewardUtxoKey })},
+	{27, "PrevSenderBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **BalanceEntry { return &op.PrevSenderBalanceEntry })},
+	{28, "PrevReceiverBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **BalanceEntry { return &op.PrevReceiverBalanceEntry })},
+	{29, "PrevGlobalParamsEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **GlobalParamsEntry { return &op.PrevGlobalParamsEntry })},
+	{30, "PrevForbiddenPubKeyEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **ForbiddenPubKeyEntry { return &op.PrevForbiddenPubKeyEntry })},
+	{31, "ClobberedProfileBugDESOLockedNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.ClobberedProfileBugDESOLockedNanos }}},
+	{32, "CreatorCoinDESOLockedNanosDiff", utxoOpFuncField{
+		isSet: func(op *UtxoOperation) bool { return op.CreatorCoinDESOLockedNanosDiff != 0 },
+		// Like in the original encoding, the int64 is encoded as a uint64 whose sign bit is interpreted differently.
+		encode: func(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+			return UintToBuf(uint64(op.CreatorCoinDESOLockedNanosDiff))
+		},
+		decode: func(op *UtxoOperation, rr *bytes.Reader) error {
+			value, err := ReadUvarint(rr)
+			if err != nil {
+				return err
+			}
+			op.CreatorCoinDESOLockedNanosDiff = int64(value)
+			return nil
+		},
+	}},
+	{33, "SwapIdentityFromDESOLockedNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.SwapIdentityFromDESOLockedNanos }}},
+	{34, "SwapIdentityToDESOLockedNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.SwapIdentityToDESOLockedNanos }}},
+	{35, "AcceptNFTBidCreatorPublicKey", utxoOpBytesField{func(op *UtxoOperation) *[]byte { return &op.AcceptNFTBidCreatorPublicKey }}},
+	{36, "AcceptNFTBidBidderPublicKey", utxoOpBytesField{func(op *UtxoOperation) *[]byte { return &op.AcceptNFTBidBidderPublicKey }}},
+	{37, "AcceptNFTBidCreatorRoyaltyNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.AcceptNFTBidCreatorRoyaltyNanos }}},
+	{38, "AcceptNFTBidCreatorDESORoyaltyNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.AcceptNFTBidCreatorDESORoyaltyNanos }}},
+	{39, "AcceptNFTBidAdditionalCoinRoyalties", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*PublicKeyRoyaltyPair { return &op.AcceptNFTBidAdditionalCoinRoyalties })},
+	{40, "AcceptNFTBidAdditionalDESORoyalties", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*PublicKeyRoyaltyPair { return &op.AcceptNFTBidAdditionalDESORoyalties })},
+	{41, "NFTBidCreatorPublicKey", utxoOpBytesField{func(op *UtxoOperation) *[]byte { return &op.NFTBidCreatorPublicKey }}},
+	{42, "NFTBidBidderPublicKey", utxoOpBytesField{func(op *UtxoOperation) *[]byte { return &op.NFTBidBidderPublicKey }}},
+	{43, "NFTBidCreatorRoyaltyNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.NFTBidCreatorRoyaltyNanos }}},
+	{44, "NFTBidCreatorDESORoyaltyNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.NFTBidCreatorDESORoyaltyNanos }}},
+	{45, "NFTBidAdditionalCoinRoyalties", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*PublicKeyRoyaltyPair { return &op.NFTBidAdditionalCoinRoyalties })},
+	{46, "NFTBidAdditionalDESORoyalties", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*PublicKeyRoyaltyPair { return &op.NFTBidAdditionalDESORoyalties })},
+	{47, "PrevTransactorDAOCoinLimitOrderEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **DAOCoinLimitOrderEntry { return &op.PrevTransactorDAOCoinLimitOrderEntry })},
+	{48, "PrevBalanceEntries", utxoOpFuncField{
+		isSet:  func(op *UtxoOperation) bool { return op.PrevBalanceEntries != nil },
+		encode: encodeUtxoOpPrevBalanceEntries,
+		decode: decodeUtxoOpPrevBalanceEntries,
+	}},
+	{49, "PrevMatchingOrders", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*DAOCoinLimitOrderEntry { return &op.PrevMatchingOrders })},
+	{50, "FilledDAOCoinLimitOrders", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*FilledDAOCoinLimitOrder { return &op.FilledDAOCoinLimitOrders })},
+	{51, "PrevUserAssociationEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **UserAssociationEntry { return &op.PrevUserAssociationEntry })},
+	{52, "PrevPostAssociationEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **PostAssociationEntry { return &op.PrevPostAssociationEntry })},
+	{53, "PrevAccessGroupEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **AccessGroupEntry { return &op.PrevAccessGroupEntry })},
+	{54, "PrevAccessGroupMembersList", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*AccessGroupMemberEntry { return &op.PrevAccessGroupMembersList })},
+	{55, "PrevNewMessageEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **NewMessageEntry { return &op.PrevNewMessageEntry })},
+	{56, "PrevDmThreadEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **DmThreadEntry { return &op.PrevDmThreadEntry })},
+	{57, "BalancePublicKey", utxoOpBytesField{func(op *UtxoOperation) *[]byte { return &op.BalancePublicKey }}},
+	{58, "BalanceAmountNanos", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.BalanceAmountNanos }}},
+	{59, "PrevNonceEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*TransactorNonceEntry { return &op.PrevNonceEntries })},
+	{60, "StateChangeMetadata", utxoOpFuncField{
+		// As in the original encoding, the state change metadata is only stored by nodes that run
+		// the state syncer. Unlike the original encoding, the tag tells the decoder whether it's there.
+		isSet: func(op *UtxoOperation) bool { return hackIsRunningStateSyncer() && op.StateChangeMetadata != nil },
+		encode: func(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+			return EncodeToBytes(blockHeight, op.StateChangeMetadata, skipMetadata...)
+		},
+		decode: decodeUtxoOpStateChangeMetadata,
+	}},
+	{61, "PrevValidatorEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **ValidatorEntry { return &op.PrevValidatorEntry })},
+	{62, "PrevStakeEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*StakeEntry { return &op.PrevStakeEntries })},
+	{63, "PrevLockedStakeEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*LockedStakeEntry { return &op.PrevLockedStakeEntries })},
+	{64, "PrevLockedBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **LockedBalanceEntry { return &op.PrevLockedBalanceEntry })},
+	{65, "SetLockedBalanceEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*LockedBalanceEntry { return &op.SetLockedBalanceEntries })},
+	{66, "PrevLockupYieldCurvePoint", newUtxoOpEncoderField(func(op *UtxoOperation) **LockupYieldCurvePoint { return &op.PrevLockupYieldCurvePoint })},
+	{67, "PrevLockupTransferRestriction", utxoOpFuncField{
+		isSet: func(op *UtxoOperation) bool { return op.PrevLockupTransferRestriction != 0 },
+		encode: func(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+			return []byte{byte(op.PrevLockupTransferRestriction)}
+		},
+		decode: func(op *UtxoOperation, rr *bytes.Reader) error {
+			value, err := rr.ReadByte()
+			if err != nil {
+				return err
+			}
+			op.PrevLockupTransferRestriction = TransferRestrictionStatus(value)
+			return nil
+		},
+	}},
+	{68, "PrevSenderLockedBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **LockedBalanceEntry { return &op.PrevSenderLockedBalanceEntry })},
+	{69, "PrevReceiverLockedBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **LockedBalanceEntry { return &op.PrevReceiverLockedBalanceEntry })},
+	{70, "PrevLockedBalanceEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*LockedBalanceEntry { return &op.PrevLockedBalanceEntries })},
+	{71, "ModifiedLockedBalanceEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **LockedBalanceEntry { return &op.ModifiedLockedBalanceEntry })},
+	{72, "StakeAmountNanosDiff", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.StakeAmountNanosDiff }}},
+	{73, "LockedAtEpochNumber", utxoOpUint64Field{func(op *UtxoOperation) *uint64 { return &op.LockedAtEpochNumber }}},
+	{74, "AtomicTxnsInnerUtxoOps", utxoOpFuncField{
+		isSet:  func(op *UtxoOperation) bool { return len(op.AtomicTxnsInnerUtxoOps) > 0 },
+		encode: encodeUtxoOpAtomicTxnsInnerUtxoOps,
+		decode: decodeUtxoOpAtomicTxnsInnerUtxoOps,
+	}},
+	{75, "PrevKeyValueRecordEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*KeyValueRecordEntry { return &op.PrevKeyValueRecordEntries })},
+	{76, "PrevMessageReadStateEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **MessageReadStateEntry { return &op.PrevMessageReadStateEntry })},
+	{77, "PrevNFTEntries", newUtxoOpEncoderSliceField(func(op *UtxoOperation) *[]*NFTEntry { return &op.PrevNFTEntries })},
+	{78, "PrevNFTAvatarEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **NFTAvatarEntry { return &op.PrevNFTAvatarEntry })},
+	{79, "PrevDelegatedPosterEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **DelegatedPosterEntry { return &op.PrevDelegatedPosterEntry })},
+	{80, "PrevAnchorHashRateLimitEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **AnchorHashRateLimitEntry { return &op.PrevAnchorHashRateLimitEntry })},
+	{81, "PrevSubscriptionEntry", newUtxoOpEncoderField(func(op *UtxoOperation) **SubscriptionEntry { return &op.PrevSubscriptionEntry })},
+}
+
+// utxoOperationFieldsByTag indexes utxoOperationFields by tag for decoding.
+var utxoOperationFieldsByTag = func() map[UtxoOperationFieldTag]*utxoOperationField {
+	fieldsByTag := make(map[UtxoOperationFieldTag]*utxoOperationField)
+	for ii := range utxoOperationFields {
+		fieldsByTag[utxoOperationFields[ii].Tag] = &utxoOperationFields[ii]
+	}
+	return fieldsByTag
+}()
+
+// GetSetFieldNames returns the names of the fields of the UtxoOperation that the compact encoding
+// includes, in tag order.
+func (op *UtxoOperation) GetSetFieldNames() []string {
+	var names []string
+	for _, field := range utxoOperationFields {
+		if field.Encoder.IsSet(op) {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
+
+func (op *UtxoOperation) rawEncodeCompactWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(uint64(op.Type))...)
+
+	var fieldsData []byte
+	numFields := uint64(0)
+	for _, field := range utxoOperationFields {
+		if !field.Encoder.IsSet(op) {
+			continue
+		}
+		fieldsData = append(fieldsData, UintToBuf(uint64(field.Tag))...)
+		fieldsData = append(fieldsData, field.Encoder.Encode(op, blockHeight, skipMetadata...)...)
+		numFields++
+	}
+	data = append(data, UintToBuf(numFields)...)
+	data = append(data, fieldsData...)
+	return data
+}
+
+func (op *UtxoOperation) rawDecodeCompactWithoutMetadata(blockHeight uint64, rr *bytes.Reader) error {
+	typeUint64, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading type")
+	}
+	op.Type = OperationType(uint(typeUint64))
+
+	numFields, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading number of fields")
+	}
+	if numFields > uint64(len(utxoOperationFields)) {
+		return fmt.Errorf("UtxoOperation.Decode: Number of fields %d exceeds the %d known fields",
+			numFields, len(utxoOperationFields))
+	}
+	var prevTag UtxoOperationFieldTag
+	for ii := uint64(0); ii < numFields; ii++ {
+		tag, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading tag of field %d", ii)
+		}
+		field, exists := utxoOperationFieldsByTag[UtxoOperationFieldTag(tag)]
+		if !exists {
+			return fmt.Errorf("UtxoOperation.Decode: Unknown field tag %d", tag)
+		}
+		// Fields are encoded in increasing tag order, which also rules out duplicates.
+		if ii > 0 && field.Tag <= prevTag {
+			return fmt.Errorf("UtxoOperation.Decode: Field %v is out of order", field.Name)
+		}
+		prevTag = field.Tag
+		if err = field.Encoder.Decode(op, rr); err != nil {
+			return errors.Wrapf(err, "UtxoOperation.Decode: Problem reading %v", field.Name)
+		}
+	}
+	return nil
+}
+
+func encodeUtxoOpPrevAcceptedNFTBidEntries(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(*op.PrevAcceptedNFTBidEntries)))...)
+	for _, bidEntry := range *op.PrevAcceptedNFTBidEntries {
+		data = append(data, EncodeToBytes(blockHeight, bidEntry, skipMetadata...)...)
+	}
+	return data
+}
+
+func decodeUtxoOpPrevAcceptedNFTBidEntries(op *UtxoOperation, rr *bytes.Reader) error {
+	numEntries, err := ReadUvarint(rr)
+	if err != nil {
+		return err
+	}
+	prevAcceptedNFTBidEntries, err := SafeMakeSliceWithLength[*NFTBidEntry](numEntries)
+	if err != nil {
+		return err
+	}
+	for ii := range prevAcceptedNFTBidEntries {
+		if prevAcceptedNFTBidEntries[ii], err = DecodeDeSoEncoder(&NFTBidEntry{}, rr); err != nil {
+			return err
+		}
+	}
+	op.PrevAcceptedNFTBidEntries = &prevAcceptedNFTBidEntries
+	return nil
+}
+
+// encodeUtxoOpPrevCoinRoyaltyCoinEntries encodes the <PKID, CoinEntry> pairs sorted by PKID so that
+// the encoding is deterministic.
+func encodeUtxoOpPrevCoinRoyaltyCoinEntries(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	var pkids []PKID
+	for pkid := range op.PrevCoinRoyaltyCoinEntries {
+		pkids = append(pkids, pkid)
+	}
+	sort.Slice(pkids, func(ii, jj int) bool {
+		return bytes.Compare(pkids[ii][:], pkids[jj][:]) < 0
+	})
+
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(pkids)))...)
+	for _, pkid := range pkids {
+		coinEntry := op.PrevCoinRoyaltyCoinEntries[pkid]
+		data = append(data, pkid[:]...)
+		data = append(data, EncodeToBytes(blockHeight, &coinEntry, skipMetadata...)...)
+	}
+	return data
+}
+
+func decodeUtxoOpPrevCoinRoyaltyCoinEntries(op *UtxoOperation, rr *bytes.Reader) error {
+	numEntries, err := ReadUvarint(rr)
+	if err != nil {
+		return err
+	}
+	op.PrevCoinRoyaltyCoinEntries = make(map[PKID]CoinEntry)
+	for ; numEntries > 0; numEntries-- {
+		var pkid PKID
+		if _, err = io.ReadFull(rr, pkid[:]); err != nil {
+			return err
+		}
+		coinEntry := CoinEntry{}
+		if exists, err := DecodeFromBytes(&coinEntry, rr); !exists || err != nil {
+			return errors.Wrapf(err, "Problem reading CoinEntry for PKID %v", PkToStringMainnet(pkid[:]))
+		}
+		op.PrevCoinRoyaltyCoinEntries[pkid] = coinEntry
+	}
+	return nil
+}
+
+// encodeUtxoOpPrevBalanceEntries encodes the <PKID, PKID, BalanceEntry> tuples sorted by
+// <PKID, PKID> so that the encoding is deterministic.
+func encodeUtxoOpPrevBalanceEntries(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	var pkidPairs [][2]PKID
+	for primaryPKID, secondaryMap := range op.PrevBalanceEntries {
+		for secondaryPKID := range secondaryMap {
+			pkidPairs = append(pkidPairs, [2]PKID{primaryPKID, secondaryPKID})
+		}
+	}
+	sort.Slice(pkidPairs, func(ii, jj int) bool {
+		if cmp := bytes.Compare(pkidPairs[ii][0][:], pkidPairs[jj][0][:]); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(pkidPairs[ii][1][:], pkidPairs[jj][1][:]) < 0
+	})
+
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(pkidPairs)))...)
+	for _, pkidPair := range pkidPairs {
+		data = append(data, pkidPair[0][:]...)
+		data = append(data, pkidPair[1][:]...)
+		data = append(data, EncodeToBytes(blockHeight, op.PrevBalanceEntries[pkidPair[0]][pkidPair[1]], skipMetadata...)...)
+	}
+	return data
+}
+
+func decodeUtxoOpPrevBalanceEntries(op *UtxoOperation, rr *bytes.Reader) error {
+	numEntries, err := ReadUvarint(rr)
+	if err != nil {
+		return err
+	}
+	op.PrevBalanceEntries = make(map[PKID]map[PKID]*BalanceEntry)
+	for ; numEntries > 0; numEntries-- {
+		var primaryPKID, secondaryPKID PKID
+		if _, err = io.ReadFull(rr, primaryPKID[:]); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(rr, secondaryPKID[:]); err != nil {
+			return err
+		}
+		balanceEntry, err := DecodeDeSoEncoder(&BalanceEntry{}, rr)
+		if err != nil {
+			return err
+		}
+		if _, exists := op.PrevBalanceEntries[primaryPKID]; !exists {
+			op.PrevBalanceEntries[primaryPKID] = make(map[PKID]*BalanceEntry)
+		}
+		op.PrevBalanceEntries[primaryPKID][secondaryPKID] = balanceEntry
+	}
+	return nil
+}
+
+func decodeUtxoOpStateChangeMetadata(op *UtxoOperation, rr *bytes.Reader) error {
+	stateChangeMetadata := GetStateChangeMetadataFromOpType(op.Type)
+	if stateChangeMetadata == nil {
+		return fmt.Errorf("No state change metadata for operation type %v", op.Type)
+	}
+	if exists, err := DecodeFromBytes(stateChangeMetadata, rr); !exists || err != nil {
+		return errors.Wrapf(err, "Problem reading state change metadata")
+	}
+	op.StateChangeMetadata = stateChangeMetadata
+	return nil
+}
+
+func encodeUtxoOpAtomicTxnsInnerUtxoOps(op *UtxoOperation, blockHeight uint64, skipMetadata ...bool) []byte {
+	var data []byte
+	data = append(data, UintToBuf(uint64(len(op.AtomicTxnsInnerUtxoOps)))...)
+	for _, innerUtxoOps := range op.AtomicTxnsInnerUtxoOps {
+		data = append(data, EncodeDeSoEncoderSlice(innerUtxoOps, blockHeight, skipMetadata...)...)
+	}
+	return data
+}
+
+func decodeUtxoOpAtomicTxnsInnerUtxoOps(op *UtxoOperation, rr *bytes.Reader) error {
+	numInnerTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return err
+	}
+	atomicTxnsInnerUtxoOps, err := SafeMakeSliceWithLength[[]*UtxoOperation](numInnerTxns)
+	if err != nil {
+		return err
+	}
+	for ii := range atomicTxnsInnerUtxoOps {
+		if atomicTxnsInnerUtxoOps[ii], err = DecodeDeSoEncoderSlice[*UtxoOperation](rr); err != nil {
+			return errors.Wrapf(err, "Problem reading inner utxo operations %d", ii)
+		}
+	}
+	op.AtomicTxnsInnerUtxoOps = atomicTxnsInnerUtxoOps
+	return nil
+}
@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/require"
+)
+
+// _setUtxoOperationCompactEncodingBlockHeight triggers the UtxoOperationCompactEncodingMigration and every
+// later migration at the given height, and every earlier migration at height 1. Versions have to increase
+// with the heights, otherwise the version byte of an encoding wouldn't tell which migrations it includes.
+// It returns a function that restores the previous migration heights.
+func _setUtxoOperationCompactEncodingBlockHeight(blockHeight uint64) func() {
+	prevMigrationHeightsList := GlobalDeSoParams.EncoderMigrationHeightsList
+
+	var compactEncodingVersion byte
+	for _, migrationHeight := range prevMigrationHeightsList {
+		if migrationHeight.Name == UtxoOperationCompactEncodingMigration {
+			compactEncodingVersion = migrationHeight.Version
+		}
+	}
+	var migrationHeightsList []*MigrationHeight
+	for _, migrationHeight := range prevMigrationHeightsList {
+		newMigrationHeight := *migrationHeight
+		if newMigrationHeight.Version >= compactEncodingVersion {
+			newMigrationHeight.Height = blockHeight
+		} else if newMigrationHeight.Version != 0 {
+			newMigrationHeight.Height = 1
+		}
+		migrationHeightsList = append(migrationHeightsList, &newMigrationHeight)
+	}
+	GlobalDeSoParams.EncoderMigrationHeightsList = migrationHeightsList
+	return func() {
+		GlobalDeSoParams.EncoderMigrationHeightsList = prevMigrationHeightsList
+	}
+}
+
+func TestUtxoOperationCompactEncoding(t *testing.T) {
+	require := require.New(t)
+
+	compactBlockHeight := uint64(10)
+	defer _setUtxoOperationCompactEncodingBlockHeight(compactBlockHeight)()
+
+	// A spend only sets its Entry and Key, so the compact encoding skips the placeholders for every
+	// other field.
+	spendOp := &UtxoOperation{
+		Type: OperationTypeSpendUtxo,
+		Entry: &UtxoEntry{
+			AmountNanos: 100,
+			PublicKey:   m0PkBytes,
+			BlockHeight: 5,
+			UtxoType:    UtxoTypeOutput,
+		},
+		Key: &UtxoKey{TxID: BlockHash{1}, Index: 2},
+	}
+	require.Equal([]string{"Entry", "Key"}, spendOp.GetSetFieldNames())
+	legacyBytes := EncodeToBytes(compactBlockHeight-1, spendOp)
+	compactBytes := EncodeToBytes(compactBlockHeight, spendOp)
+	require.Less(len(compactBytes)+len(utxoOperationFields)/2, len(legacyBytes))
+
+	// Operations encoded before and after the migration both decode to the same operation.
+	for _, encodedBytes := range [][]byte{legacyBytes, compactBytes} {
+		decodedOp := &UtxoOperation{}
+		exists, err := DecodeFromBytes(decodedOp, bytes.NewReader(encodedBytes))
+		require.NoError(err)
+		require.True(exists)
+		require.Equal(spendOp.Type, decodedOp.Type)
+		require.Equal([]string{"Entry", "Key"}, decodedOp.GetSetFieldNames())
+		require.Equal(compactBytes, EncodeToBytes(compactBlockHeight, decodedOp))
+	}
+
+	// An operation with every field set survives a round trip, including the nested operations of
+	// an atomic txn.
+	randomOp := &UtxoOperation{}
+	gofakeit.Struct(randomOp)
+	randomOp.StateChangeMetadata = nil
+	randomOp.AtomicTxnsInnerUtxoOps = [][]*UtxoOperation{{spendOp}, {spendOp, spendOp}}
+	randomOp.CreatorCoinDESOLockedNanosDiff = -1
+	encodedBytes := EncodeToBytes(compactBlockHeight, randomOp)
+	decodedOp := &UtxoOperation{}
+	exists, err := DecodeFromBytes(decodedOp, bytes.NewReader(encodedBytes))
+	require.NoError(err)
+	require.True(exists)
+	require.Equal(randomOp.GetSetFieldNames(), decodedOp.GetSetFieldNames())
+	require.Equal(encodedBytes, EncodeToBytes(compactBlockHeight, decodedOp))
+	require.Equal(int64(-1), decodedOp.CreatorCoinDESOLockedNanosDiff)
+	require.Len(decodedOp.AtomicTxnsInnerUtxoOps[1], 2)
+}
+
+func TestUtxoOperationCompactEncodingRejectsMalformedFields(t *testing.T) {
+	require := require.New(t)
+
+	compactBlockHeight := uint64(10)
+	defer _setUtxoOperationCompactEncodingBlockHeight(compactBlockHeight)()
+
+	decode := func(data []byte) error {
+		return (&UtxoOperation{}).RawDecodeWithoutMetadata(compactBlockHeight, bytes.NewReader(data))
+	}
+	lastTag := utxoOperationFields[len(utxoOperationFields)-1].Tag
+
+	// Two uint64 fields in increasing tag order decode fine.
+	require.NoError(decode([]byte{byte(OperationTypeBitcoinExchange), 2, 2, 1, 3, 1}))
+	// Out of order or duplicated tags are rejected.
+	require.Error(decode([]byte{byte(OperationTypeBitcoinExchange), 2, 3, 1, 2, 1}))
+	require.Error(decode([]byte{byte(OperationTypeBitcoinExchange), 2, 2, 1, 2, 1}))
+	// Unknown tags are rejected.
+	require.Error(decode(append([]byte{byte(OperationTypeBitcoinExchange), 1}, UintToBuf(uint64(lastTag)+1)...)))
+	// More fields than there are tags are rejected.
+	require.Error(decode(append([]byte{byte(OperationTypeBitcoinExchange)}, UintToBuf(uint64(len(utxoOperationFields))+1)...)))
+	// Truncated fields are rejected.
+	require.Error(decode([]byte{byte(OperationTypeBitcoinExchange), 1, 2}))
+}
+
+// Every field of the UtxoOperation needs a tag, otherwise it's silently dropped by the compact encoding.
+func TestUtxoOperationCompactEncodingCoversAllFields(t *testing.T) {
+	require := require.New(t)
+
+	tags := make(map[UtxoOperationFieldTag]bool)
+	fieldNames := make(map[string]bool)
+	for ii, field := range utxoOperationFields {
+		require.False(tags[field.Tag], "duplicate tag %d", field.Tag)
+		if ii > 0 {
+			require.Greater(field.Tag, utxoOperationFields[ii-1].Tag)
+		}
+		tags[field.Tag] = true
+		fieldNames[field.Name] = true
+	}
+
+	opType := reflect.TypeOf(UtxoOperation{})
+	structFieldNames := map[string]bool{}
+	for ii := 0; ii < opType.NumField(); ii++ {
+		if opType.Field(ii).Name == "Type" {
+			continue
+		}
+		structFieldNames[opType.Field(ii).Name] = true
+	}
+	require.Equal(structFieldNames, fieldNames)
+}
@@ -0,0 +1,783 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Typed UtxoOperation Data
+//
+// A UtxoOperation is a union of the fields that every operation type needs in order to be disconnected. Each
+// operation type only sets a few of them, and which ones is only recorded in the connect and disconnect logic of
+// the type. The types below give each operation type its own struct with just the fields it uses, and the
+// _disconnect functions read their operation through them with GetUtxoOperationData:
+//
+//	operationData, err := GetUtxoOperationData[LikeOperationData](utxoOpsForTxn[operationIndex])
+//
+// GetUtxoOperationData fails if the operation isn't of one of the types the struct is for, so a disconnect can't
+// read the fields of another type's operation. Operation types that share the same disconnect logic, like
+// CreateUserAssociation and DeleteUserAssociation, share a struct.
+//
+// The UtxoOperation is still what's stored, in the compact encoding from utxo_operation_compact_encoding.go, so
+// adding a field to a typed struct doesn't change the encoding. A new operation type gets a new struct here, listed
+// in utxoOperationDataTypes, with the fields its disconnect reads.
+
+// UtxoOperationData is the typed data of the UtxoOperations of one or more operation types.
+type UtxoOperationData interface {
+	// GetOperationTypes returns the types of the operations that the data can be read from.
+	GetOperationTypes() []OperationType
+	// readFromUtxoOperation copies the fields that the data holds from the operation.
+	readFromUtxoOperation(op *UtxoOperation)
+}
+
+// GetUtxoOperationData returns the typed data of the operation, or an error if the operation isn't of one of the
+// types that D is for.
+func GetUtxoOperationData[D any, PD interface {
+	*D
+	UtxoOperationData
+}](op *UtxoOperation) (*D, error) {
+	data := PD(new(D))
+	if op == nil {
+		return nil, fmt.Errorf("GetUtxoOperationData: Operation is nil")
+	}
+	if !slices.Contains(data.GetOperationTypes(), op.Type) {
+		return nil, fmt.Errorf("GetUtxoOperationData: Operation has type %v, expected one of %v",
+			op.Type, data.GetOperationTypes())
+	}
+	data.readFromUtxoOperation(op)
+	return data, nil
+}
+
+// utxoOperationDataTypes lists the typed data of every operation type that has any.
+var utxoOperationDataTypes = []UtxoOperationData{
+	&SpendingLimitAccountingOperationData{},
+	&DeSoDiamondOperationData{},
+	&BitcoinExchangeOperationData{},
+	&UpdateBitcoinUSDExchangeRateOperationData{},
+	&SubmitPostOperationData{},
+	&UpdateProfileOperationData{},
+	&LikeOperationData{},
+	&CreatorCoinOperationData{},
+	&UpdateGlobalParamsOperationData{},
+	&CreatorCoinTransferOperationData{},
+	&CreateNFTOperationData{},
+	&UpdateNFTOperationData{},
+	&NFTSoldOperationData{},
+	&NFTTransferOperationData{},
+	&BurnNFTOperationData{},
+	&AuthorizeDerivedKeyOperationData{},
+	&MessagingKeyOperationData{},
+	&DAOCoinOperationData{},
+	&DAOCoinTransferOperationData{},
+	&DAOCoinLimitOrderOperationData{},
+	&UserAssociationOperationData{},
+	&PostAssociationOperationData{},
+	&AccessGroupOperationData{},
+	&AccessGroupMembersOperationData{},
+	&NewMessageOperationData{},
+	&ValidatorOperationData{},
+	&UnregisterAsValidatorOperationData{},
+	&StakeOperationData{},
+	&UnstakeOperationData{},
+	&UnlockStakeOperationData{},
+	&CoinLockupOperationData{},
+	&CoinLockupTransferOperationData{},
+	&CoinUnlockOperationData{},
+	&UpdateCoinLockupParamsOperationData{},
+	&AtomicTxnsWrapperOperationData{},
+	&SetKeyValueRecordsOperationData{},
+	&MessageReadStateOperationData{},
+	&NFTBatchOperationData{},
+	&DelegatedPosterOperationData{},
+	&AnchorHashOperationData{},
+	&SubscriptionOperationData{},
+}
+
+// SpendingLimitAccountingOperationData, DeSoDiamondOperationData, and MessageReadStateOperationData are the data of
+// operations that come right before the basic transfer's own operations, and that _disconnectBasicTransfer reverts.
+type SpendingLimitAccountingOperationData struct {
+	PrevDerivedKeyEntry *DerivedKeyEntry
+}
+
+func (data *SpendingLimitAccountingOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeSpendingLimitAccounting}
+}
+
+func (data *SpendingLimitAccountingOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = SpendingLimitAccountingOperationData{
+		PrevDerivedKeyEntry: op.PrevDerivedKeyEntry,
+	}
+}
+
+type DeSoDiamondOperationData struct {
+	PrevPostEntry    *PostEntry
+	PrevDiamondEntry *DiamondEntry
+}
+
+func (data *DeSoDiamondOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeDeSoDiamond}
+}
+
+func (data *DeSoDiamondOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = DeSoDiamondOperationData{
+		PrevPostEntry:    op.PrevPostEntry,
+		PrevDiamondEntry: op.PrevDiamondEntry,
+	}
+}
+
+type BitcoinExchangeOperationData struct {
+	PrevNanosPurchased uint64
+}
+
+func (data *BitcoinExchangeOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeBitcoinExchange}
+}
+
+func (data *BitcoinExchangeOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = BitcoinExchangeOperationData{
+		PrevNanosPurchased: op.PrevNanosPurchased,
+	}
+}
+
+type UpdateBitcoinUSDExchangeRateOperationData struct {
+	PrevUSDCentsPerBitcoin uint64
+}
+
+func (data *UpdateBitcoinUSDExchangeRateOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUpdateBitcoinUSDExchangeRate}
+}
+
+func (data *UpdateBitcoinUSDExchangeRateOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UpdateBitcoinUSDExchangeRateOperationData{
+		PrevUSDCentsPerBitcoin: op.PrevUSDCentsPerBitcoin,
+	}
+}
+
+type SubmitPostOperationData struct {
+	PrevPostEntry            *PostEntry
+	PrevParentPostEntry      *PostEntry
+	PrevGrandparentPostEntry *PostEntry
+	PrevRepostedPostEntry    *PostEntry
+	PrevRepostEntry          *RepostEntry
+}
+
+func (data *SubmitPostOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeSubmitPost}
+}
+
+func (data *SubmitPostOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = SubmitPostOperationData{
+		PrevPostEntry:            op.PrevPostEntry,
+		PrevParentPostEntry:      op.PrevParentPostEntry,
+		PrevGrandparentPostEntry: op.PrevGrandparentPostEntry,
+		PrevRepostedPostEntry:    op.PrevRepostedPostEntry,
+		PrevRepostEntry:          op.PrevRepostEntry,
+	}
+}
+
+type UpdateProfileOperationData struct {
+	PrevProfileEntry   *ProfileEntry
+	PrevNFTAvatarEntry *NFTAvatarEntry
+}
+
+func (data *UpdateProfileOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUpdateProfile}
+}
+
+func (data *UpdateProfileOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UpdateProfileOperationData{
+		PrevProfileEntry:   op.PrevProfileEntry,
+		PrevNFTAvatarEntry: op.PrevNFTAvatarEntry,
+	}
+}
+
+type LikeOperationData struct {
+	PrevLikeEntry *LikeEntry
+	PrevLikeCount uint64
+}
+
+func (data *LikeOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeLike}
+}
+
+func (data *LikeOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = LikeOperationData{
+		PrevLikeEntry: op.PrevLikeEntry,
+		PrevLikeCount: op.PrevLikeCount,
+	}
+}
+
+type CreatorCoinOperationData struct {
+	PrevCoinEntry              *CoinEntry
+	PrevTransactorBalanceEntry *BalanceEntry
+	PrevCreatorBalanceEntry    *BalanceEntry
+	FounderRewardUtxoKey       *UtxoKey
+}
+
+func (data *CreatorCoinOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCreatorCoin}
+}
+
+func (data *CreatorCoinOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = CreatorCoinOperationData{
+		PrevCoinEntry:              op.PrevCoinEntry,
+		PrevTransactorBalanceEntry: op.PrevTransactorBalanceEntry,
+		PrevCreatorBalanceEntry:    op.PrevCreatorBalanceEntry,
+		FounderRewardUtxoKey:       op.FounderRewardUtxoKey,
+	}
+}
+
+type UpdateGlobalParamsOperationData struct {
+	PrevGlobalParamsEntry    *GlobalParamsEntry
+	PrevForbiddenPubKeyEntry *ForbiddenPubKeyEntry
+}
+
+func (data *UpdateGlobalParamsOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUpdateGlobalParams}
+}
+
+func (data *UpdateGlobalParamsOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UpdateGlobalParamsOperationData{
+		PrevGlobalParamsEntry:    op.PrevGlobalParamsEntry,
+		PrevForbiddenPubKeyEntry: op.PrevForbiddenPubKeyEntry,
+	}
+}
+
+type CreatorCoinTransferOperationData struct {
+	PrevCoinEntry            *CoinEntry
+	PrevSenderBalanceEntry   *BalanceEntry
+	PrevReceiverBalanceEntry *BalanceEntry
+	PrevPostEntry            *PostEntry
+	PrevDiamondEntry         *DiamondEntry
+}
+
+func (data *CreatorCoinTransferOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCreatorCoinTransfer}
+}
+
+func (data *CreatorCoinTransferOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = CreatorCoinTransferOperationData{
+		PrevCoinEntry:            op.PrevCoinEntry,
+		PrevSenderBalanceEntry:   op.PrevSenderBalanceEntry,
+		PrevReceiverBalanceEntry: op.PrevReceiverBalanceEntry,
+		PrevPostEntry:            op.PrevPostEntry,
+		PrevDiamondEntry:         op.PrevDiamondEntry,
+	}
+}
+
+type CreateNFTOperationData struct {
+	PrevPostEntry *PostEntry
+}
+
+func (data *CreateNFTOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCreateNFT}
+}
+
+func (data *CreateNFTOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = CreateNFTOperationData{
+		PrevPostEntry: op.PrevPostEntry,
+	}
+}
+
+type UpdateNFTOperationData struct {
+	PrevNFTEntry         *NFTEntry
+	DeletedNFTBidEntries []*NFTBidEntry
+	PrevPostEntry        *PostEntry
+}
+
+func (data *UpdateNFTOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUpdateNFT}
+}
+
+func (data *UpdateNFTOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UpdateNFTOperationData{
+		PrevNFTEntry:         op.PrevNFTEntry,
+		DeletedNFTBidEntries: op.DeletedNFTBidEntries,
+		PrevPostEntry:        op.PrevPostEntry,
+	}
+}
+
+// NFTSoldOperationData is the data of an AcceptNFTBid txn, or of an NFTBid txn that bought a buy-now NFT. The
+// PrevNFTBidEntry is only set for NFTBid txns.
+type NFTSoldOperationData struct {
+	PrevNFTEntry               *NFTEntry
+	PrevNFTBidEntry            *NFTBidEntry
+	DeletedNFTBidEntries       []*NFTBidEntry
+	PrevAcceptedNFTBidEntries  *[]*NFTBidEntry
+	NFTPaymentUtxoKeys         []*UtxoKey
+	NFTSpentUtxoEntries        []*UtxoEntry
+	PrevCoinEntry              *CoinEntry
+	PrevCoinRoyaltyCoinEntries map[PKID]CoinEntry
+	PrevPostEntry              *PostEntry
+}
+
+func (data *NFTSoldOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeAcceptNFTBid, OperationTypeNFTBid}
+}
+
+func (data *NFTSoldOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = NFTSoldOperationData{
+		PrevNFTEntry:               op.PrevNFTEntry,
+		PrevNFTBidEntry:            op.PrevNFTBidEntry,
+		DeletedNFTBidEntries:       op.DeletedNFTBidEntries,
+		PrevAcceptedNFTBidEntries:  op.PrevAcceptedNFTBidEntries,
+		NFTPaymentUtxoKeys:         op.NFTPaymentUtxoKeys,
+		NFTSpentUtxoEntries:        op.NFTSpentUtxoEntries,
+		PrevCoinEntry:              op.PrevCoinEntry,
+		PrevCoinRoyaltyCoinEntries: op.PrevCoinRoyaltyCoinEntries,
+		PrevPostEntry:              op.PrevPostEntry,
+	}
+}
+
+type NFTTransferOperationData struct {
+	PrevNFTEntry *NFTEntry
+}
+
+func (data *NFTTransferOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeNFTTransfer, OperationTypeAcceptNFTTransfer}
+}
+
+func (data *NFTTransferOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = NFTTransferOperationData{
+		PrevNFTEntry: op.PrevNFTEntry,
+	}
+}
+
+type BurnNFTOperationData struct {
+	PrevNFTEntry  *NFTEntry
+	PrevPostEntry *PostEntry
+}
+
+func (data *BurnNFTOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeBurnNFT}
+}
+
+func (data *BurnNFTOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = BurnNFTOperationData{
+		PrevNFTEntry:  op.PrevNFTEntry,
+		PrevPostEntry: op.PrevPostEntry,
+	}
+}
+
+type AuthorizeDerivedKeyOperationData struct {
+	PrevDerivedKeyEntry *DerivedKeyEntry
+}
+
+func (data *AuthorizeDerivedKeyOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeAuthorizeDerivedKey}
+}
+
+func (data *AuthorizeDerivedKeyOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = AuthorizeDerivedKeyOperationData{
+		PrevDerivedKeyEntry: op.PrevDerivedKeyEntry,
+	}
+}
+
+type MessagingKeyOperationData struct {
+	PrevMessagingKeyEntry *MessagingGroupEntry
+}
+
+func (data *MessagingKeyOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeMessagingKey}
+}
+
+func (data *MessagingKeyOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = MessagingKeyOperationData{
+		PrevMessagingKeyEntry: op.PrevMessagingKeyEntry,
+	}
+}
+
+type DAOCoinOperationData struct {
+	PrevCoinEntry              *CoinEntry
+	PrevTransactorBalanceEntry *BalanceEntry
+	PrevCreatorBalanceEntry    *BalanceEntry
+}
+
+func (data *DAOCoinOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeDAOCoin}
+}
+
+func (data *DAOCoinOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = DAOCoinOperationData{
+		PrevCoinEntry:              op.PrevCoinEntry,
+		PrevTransactorBalanceEntry: op.PrevTransactorBalanceEntry,
+		PrevCreatorBalanceEntry:    op.PrevCreatorBalanceEntry,
+	}
+}
+
+type DAOCoinTransferOperationData struct {
+	PrevCoinEntry            *CoinEntry
+	PrevSenderBalanceEntry   *BalanceEntry
+	PrevReceiverBalanceEntry *BalanceEntry
+}
+
+func (data *DAOCoinTransferOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeDAOCoinTransfer}
+}
+
+func (data *DAOCoinTransferOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = DAOCoinTransferOperationData{
+		PrevCoinEntry:            op.PrevCoinEntry,
+		PrevSenderBalanceEntry:   op.PrevSenderBalanceEntry,
+		PrevReceiverBalanceEntry: op.PrevReceiverBalanceEntry,
+	}
+}
+
+type DAOCoinLimitOrderOperationData struct {
+	PrevTransactorDAOCoinLimitOrderEntry *DAOCoinLimitOrderEntry
+	PrevBalanceEntries                   map[PKID]map[PKID]*BalanceEntry
+	PrevMatchingOrders                   []*DAOCoinLimitOrderEntry
+}
+
+func (data *DAOCoinLimitOrderOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeDAOCoinLimitOrder}
+}
+
+func (data *DAOCoinLimitOrderOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = DAOCoinLimitOrderOperationData{
+		PrevTransactorDAOCoinLimitOrderEntry: op.PrevTransactorDAOCoinLimitOrderEntry,
+		PrevBalanceEntries:                   op.PrevBalanceEntries,
+		PrevMatchingOrders:                   op.PrevMatchingOrders,
+	}
+}
+
+type UserAssociationOperationData struct {
+	PrevUserAssociationEntry *UserAssociationEntry
+}
+
+func (data *UserAssociationOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCreateUserAssociation, OperationTypeDeleteUserAssociation}
+}
+
+func (data *UserAssociationOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UserAssociationOperationData{
+		PrevUserAssociationEntry: op.PrevUserAssociationEntry,
+	}
+}
+
+type PostAssociationOperationData struct {
+	PrevPostAssociationEntry *PostAssociationEntry
+}
+
+func (data *PostAssociationOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCreatePostAssociation, OperationTypeDeletePostAssociation}
+}
+
+func (data *PostAssociationOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = PostAssociationOperationData{
+		PrevPostAssociationEntry: op.PrevPostAssociationEntry,
+	}
+}
+
+type AccessGroupOperationData struct {
+	PrevAccessGroupEntry *AccessGroupEntry
+}
+
+func (data *AccessGroupOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeAccessGroup}
+}
+
+func (data *AccessGroupOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = AccessGroupOperationData{
+		PrevAccessGroupEntry: op.PrevAccessGroupEntry,
+	}
+}
+
+type AccessGroupMembersOperationData struct {
+	PrevAccessGroupMembersList []*AccessGroupMemberEntry
+}
+
+func (data *AccessGroupMembersOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeAccessGroupMembers}
+}
+
+func (data *AccessGroupMembersOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = AccessGroupMembersOperationData{
+		PrevAccessGroupMembersList: op.PrevAccessGroupMembersList,
+	}
+}
+
+type NewMessageOperationData struct {
+	PrevNewMessageEntry  *NewMessageEntry
+	PrevDmThreadEntry    *DmThreadEntry
+	PrevAccessGroupEntry *AccessGroupEntry
+}
+
+func (data *NewMessageOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeNewMessage}
+}
+
+func (data *NewMessageOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = NewMessageOperationData{
+		PrevNewMessageEntry:  op.PrevNewMessageEntry,
+		PrevDmThreadEntry:    op.PrevDmThreadEntry,
+		PrevAccessGroupEntry: op.PrevAccessGroupEntry,
+	}
+}
+
+// ValidatorOperationData is the data of the txns that only change the transactor's ValidatorEntry.
+type ValidatorOperationData struct {
+	PrevValidatorEntry *ValidatorEntry
+}
+
+func (data *ValidatorOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{
+		OperationTypeRegisterAsValidator, OperationTypeUnjailValidator, OperationTypeRotateValidatorVotingKey,
+	}
+}
+
+func (data *ValidatorOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = ValidatorOperationData{
+		PrevValidatorEntry: op.PrevValidatorEntry,
+	}
+}
+
+type UnregisterAsValidatorOperationData struct {
+	PrevValidatorEntry     *ValidatorEntry
+	PrevStakeEntries       []*StakeEntry
+	PrevLockedStakeEntries []*LockedStakeEntry
+}
+
+func (data *UnregisterAsValidatorOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUnregisterAsValidator}
+}
+
+func (data *UnregisterAsValidatorOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UnregisterAsValidatorOperationData{
+		PrevValidatorEntry:     op.PrevValidatorEntry,
+		PrevStakeEntries:       op.PrevStakeEntries,
+		PrevLockedStakeEntries: op.PrevLockedStakeEntries,
+	}
+}
+
+type StakeOperationData struct {
+	PrevValidatorEntry *ValidatorEntry
+	PrevStakeEntries   []*StakeEntry
+}
+
+func (data *StakeOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeStake}
+}
+
+func (data *StakeOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = StakeOperationData{
+		PrevValidatorEntry: op.PrevValidatorEntry,
+		PrevStakeEntries:   op.PrevStakeEntries,
+	}
+}
+
+type UnstakeOperationData struct {
+	PrevValidatorEntry     *ValidatorEntry
+	PrevStakeEntries       []*StakeEntry
+	PrevLockedStakeEntries []*LockedStakeEntry
+}
+
+func (data *UnstakeOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUnstake}
+}
+
+func (data *UnstakeOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UnstakeOperationData{
+		PrevValidatorEntry:     op.PrevValidatorEntry,
+		PrevStakeEntries:       op.PrevStakeEntries,
+		PrevLockedStakeEntries: op.PrevLockedStakeEntries,
+	}
+}
+
+type UnlockStakeOperationData struct {
+	PrevLockedStakeEntries []*LockedStakeEntry
+}
+
+func (data *UnlockStakeOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUnlockStake}
+}
+
+func (data *UnlockStakeOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UnlockStakeOperationData{
+		PrevLockedStakeEntries: op.PrevLockedStakeEntries,
+	}
+}
+
+type CoinLockupOperationData struct {
+	PrevLockedBalanceEntry     *LockedBalanceEntry
+	SetLockedBalanceEntries    []*LockedBalanceEntry
+	PrevLockedBalanceEntries   []*LockedBalanceEntry
+	PrevTransactorBalanceEntry *BalanceEntry
+	PrevCoinEntry              *CoinEntry
+}
+
+func (data *CoinLockupOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCoinLockup}
+}
+
+func (data *CoinLockupOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = CoinLockupOperationData{
+		PrevLockedBalanceEntry:     op.PrevLockedBalanceEntry,
+		SetLockedBalanceEntries:    op.SetLockedBalanceEntries,
+		PrevLockedBalanceEntries:   op.PrevLockedBalanceEntries,
+		PrevTransactorBalanceEntry: op.PrevTransactorBalanceEntry,
+		PrevCoinEntry:              op.PrevCoinEntry,
+	}
+}
+
+type CoinLockupTransferOperationData struct {
+	PrevSenderLockedBalanceEntry   *LockedBalanceEntry
+	PrevReceiverLockedBalanceEntry *LockedBalanceEntry
+}
+
+func (data *CoinLockupTransferOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCoinLockupTransfer}
+}
+
+func (data *CoinLockupTransferOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = CoinLockupTransferOperationData{
+		PrevSenderLockedBalanceEntry:   op.PrevSenderLockedBalanceEntry,
+		PrevReceiverLockedBalanceEntry: op.PrevReceiverLockedBalanceEntry,
+	}
+}
+
+type CoinUnlockOperationData struct {
+	PrevLockedBalanceEntries   []*LockedBalanceEntry
+	ModifiedLockedBalanceEntry *LockedBalanceEntry
+	PrevTransactorBalanceEntry *BalanceEntry
+	PrevCoinEntry              *CoinEntry
+}
+
+func (data *CoinUnlockOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeCoinUnlock}
+}
+
+func (data *CoinUnlockOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = CoinUnlockOperationData{
+		PrevLockedBalanceEntries:   op.PrevLockedBalanceEntries,
+		ModifiedLockedBalanceEntry: op.ModifiedLockedBalanceEntry,
+		PrevTransactorBalanceEntry: op.PrevTransactorBalanceEntry,
+		PrevCoinEntry:              op.PrevCoinEntry,
+	}
+}
+
+type UpdateCoinLockupParamsOperationData struct {
+	PrevLockupYieldCurvePoint     *LockupYieldCurvePoint
+	PrevLockupTransferRestriction TransferRestrictionStatus
+}
+
+func (data *UpdateCoinLockupParamsOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeUpdateCoinLockupParams}
+}
+
+func (data *UpdateCoinLockupParamsOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = UpdateCoinLockupParamsOperationData{
+		PrevLockupYieldCurvePoint:     op.PrevLockupYieldCurvePoint,
+		PrevLockupTransferRestriction: op.PrevLockupTransferRestriction,
+	}
+}
+
+// AtomicTxnsWrapperOperationData is the data of an AtomicTxnsWrapper txn. AtomicTxnsInnerUtxoOps holds the operations
+// of each of its inner txns, which are disconnected with their own types.
+type AtomicTxnsWrapperOperationData struct {
+	AtomicTxnsInnerUtxoOps [][]*UtxoOperation
+}
+
+func (data *AtomicTxnsWrapperOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeAtomicTxnsWrapper}
+}
+
+func (data *AtomicTxnsWrapperOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = AtomicTxnsWrapperOperationData{
+		AtomicTxnsInnerUtxoOps: op.AtomicTxnsInnerUtxoOps,
+	}
+}
+
+type SetKeyValueRecordsOperationData struct {
+	PrevKeyValueRecordEntries []*KeyValueRecordEntry
+}
+
+func (data *SetKeyValueRecordsOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeSetKeyValueRecords}
+}
+
+func (data *SetKeyValueRecordsOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = SetKeyValueRecordsOperationData{
+		PrevKeyValueRecordEntries: op.PrevKeyValueRecordEntries,
+	}
+}
+
+type MessageReadStateOperationData struct {
+	PrevMessageReadStateEntry *MessageReadStateEntry
+}
+
+func (data *MessageReadStateOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeMessageReadState}
+}
+
+func (data *MessageReadStateOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = MessageReadStateOperationData{
+		PrevMessageReadStateEntry: op.PrevMessageReadStateEntry,
+	}
+}
+
+type NFTBatchOperationData struct {
+	PrevPostEntry  *PostEntry
+	PrevNFTEntries []*NFTEntry
+}
+
+func (data *NFTBatchOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeNFTBatch}
+}
+
+func (data *NFTBatchOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = NFTBatchOperationData{
+		PrevPostEntry:  op.PrevPostEntry,
+		PrevNFTEntries: op.PrevNFTEntries,
+	}
+}
+
+type DelegatedPosterOperationData struct {
+	PrevDelegatedPosterEntry *DelegatedPosterEntry
+}
+
+func (data *DelegatedPosterOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeDelegatedPoster}
+}
+
+func (data *DelegatedPosterOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = DelegatedPosterOperationData{
+		PrevDelegatedPosterEntry: op.PrevDelegatedPosterEntry,
+	}
+}
+
+type AnchorHashOperationData struct {
+	PrevAnchorHashRateLimitEntry *AnchorHashRateLimitEntry
+}
+
+func (data *AnchorHashOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeAnchorHash}
+}
+
+func (data *AnchorHashOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = AnchorHashOperationData{
+		PrevAnchorHashRateLimitEntry: op.PrevAnchorHashRateLimitEntry,
+	}
+}
+
+// SubscriptionOperationData is the data of a Subscription txn. The balance entries and the coin entry are only set
+// when the txn claims a DAO coin subscription.
+type SubscriptionOperationData struct {
+	PrevSubscriptionEntry    *SubscriptionEntry
+	PrevSenderBalanceEntry   *BalanceEntry
+	PrevReceiverBalanceEntry *BalanceEntry
+	PrevCoinEntry            *CoinEntry
+}
+
+func (data *SubscriptionOperationData) GetOperationTypes() []OperationType {
+	return []OperationType{OperationTypeSubscription}
+}
+
+func (data *SubscriptionOperationData) readFromUtxoOperation(op *UtxoOperation) {
+	*data = SubscriptionOperationData{
+		PrevSubscriptionEntry:    op.PrevSubscriptionEntry,
+		PrevSenderBalanceEntry:   op.PrevSenderBalanceEntry,
+		PrevReceiverBalanceEntry: op.PrevReceiverBalanceEntry,
+		PrevCoinEntry:            op.PrevCoinEntry,
+	}
+}
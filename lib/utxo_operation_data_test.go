@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// _setNonZeroUtxoOperationField sets the field to a value that isn't the zero value of its type.
+func _setNonZeroUtxoOperationField(t *testing.T, field reflect.Value) {
+	switch field.Kind() {
+	case reflect.Ptr:
+		field.Set(reflect.New(field.Type().Elem()))
+	case reflect.Slice:
+		field.Set(reflect.MakeSlice(field.Type(), 1, 1))
+	case reflect.Map:
+		field.Set(reflect.MakeMap(field.Type()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(1)
+	case reflect.Bool:
+		field.SetBool(true)
+	default:
+		t.Fatalf("Unsupported UtxoOperation field kind %v", field.Kind())
+	}
+	require.False(t, field.IsZero())
+}
+
+func TestUtxoOperationDataReadsUtxoOperationFields(t *testing.T) {
+	for _, dataType := range utxoOperationDataTypes {
+		structType := reflect.TypeOf(dataType).Elem()
+		require.NotEmpty(t, dataType.GetOperationTypes(), structType.Name())
+
+		for _, operationType := range dataType.GetOperationTypes() {
+			// Set every field the typed data holds on an operation of the right type.
+			op := &UtxoOperation{Type: operationType}
+			opValue := reflect.ValueOf(op).Elem()
+			for ii := 0; ii < structType.NumField(); ii++ {
+				fieldName := structType.Field(ii).Name
+				opField := opValue.FieldByName(fieldName)
+				require.True(t, opField.IsValid(), "%v.%v isn't a UtxoOperation field", structType.Name(), fieldName)
+				require.Equal(t, structType.Field(ii).Type, opField.Type(), "%v.%v", structType.Name(), fieldName)
+				_setNonZeroUtxoOperationField(t, opField)
+			}
+
+			// Every field is copied from the operation.
+			data := reflect.New(structType).Interface().(UtxoOperationData)
+			data.readFromUtxoOperation(op)
+			dataValue := reflect.ValueOf(data).Elem()
+			for ii := 0; ii < structType.NumField(); ii++ {
+				fieldName := structType.Field(ii).Name
+				require.Equal(t, opValue.FieldByName(fieldName).Interface(), dataValue.Field(ii).Interface(),
+					"%v.%v", structType.Name(), fieldName)
+			}
+		}
+	}
+}
+
+func TestUtxoOperationDataOperationTypesAreUnique(t *testing.T) {
+	dataTypeForOperationType := make(map[OperationType]string)
+	for _, dataType := range utxoOperationDataTypes {
+		structName := reflect.TypeOf(dataType).Elem().Name()
+		for _, operationType := range dataType.GetOperationTypes() {
+			prevStructName, exists := dataTypeForOperationType[operationType]
+			require.False(t, exists, "%v is read by both %v and %v", operationType, prevStructName, structName)
+			dataTypeForOperationType[operationType] = structName
+		}
+	}
+}
+
+func TestGetUtxoOperationData(t *testing.T) {
+	prevLikeEntry := &LikeEntry{LikerPubKey: m0PkBytes, LikedPostHash: NewBlockHash(RandomBytes(HashSizeBytes))}
+	likeOp := &UtxoOperation{
+		Type:          OperationTypeLike,
+		PrevLikeEntry: prevLikeEntry,
+		PrevLikeCount: 3,
+		// A field that LikeOperationData doesn't hold.
+		PrevPostEntry: &PostEntry{},
+	}
+
+	// The typed data holds the fields of its operation type.
+	likeData, err := GetUtxoOperationData[LikeOperationData](likeOp)
+	require.NoError(t, err)
+	require.Equal(t, &LikeOperationData{PrevLikeEntry: prevLikeEntry, PrevLikeCount: 3}, likeData)
+
+	// Types that share their data can each be read.
+	for _, operationType := range []OperationType{OperationTypeAcceptNFTBid, OperationTypeNFTBid} {
+		nftSoldData, err := GetUtxoOperationData[NFTSoldOperationData](&UtxoOperation{Type: operationType})
+		require.NoError(t, err)
+		require.NotNil(t, nftSoldData)
+	}
+
+	// The data of another operation type can't be read.
+	_, err = GetUtxoOperationData[SubmitPostOperationData](likeOp)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Operation has type")
+
+	// Neither can the data of a nil operation.
+	_, err = GetUtxoOperationData[LikeOperationData](nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Operation is nil")
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// View Transactions
+//
+// A UtxoView getter that misses the view's in-memory maps reads the entry from the DB in its own read transaction.
+// A caller that reads several entries, e.g. a profile, its posts, and its balances, can therefore see some of them
+// before a block's flush and others after it. A ViewTx pins a single badger read transaction to the view, so that
+// every getter that reads through UtxoView.viewDB observes the same snapshot of the DB until the ViewTx is
+// discarded.
+//
+// Reads in a ViewTx skip the snapshot's caches, since they may hold values flushed after the read transaction
+// started. Entries that were already in the view's maps before the ViewTx began are returned as they are, so a
+// ViewTx is meant for a fresh view, such as the one returned by Blockchain.GetCommittedTipView.
+//
+// The getters that read through viewDB are the ones for PKIDs, public keys, profiles, posts, DESO balances, and
+// creator coin and DAO coin balances. Other getters still read in their own transactions.
+//
+// A read transaction keeps badger from garbage collecting the versions it can see, so a ViewTx should be discarded
+// as soon as the reads are done. A view must not be flushed while it's in a ViewTx.
+
+// ViewTx is a badger read transaction pinned to a UtxoView. See view_tx.go.
+type ViewTx struct {
+	view *UtxoView
+	txn  *badger.Txn
+}
+
+// BeginViewTx pins a new read transaction to the view. The caller must call Discard on the returned ViewTx once
+// it's done reading.
+func (bav *UtxoView) BeginViewTx() (*ViewTx, error) {
+	if bav.Postgres != nil {
+		return nil, fmt.Errorf("BeginViewTx: View transactions aren't supported on Postgres")
+	}
+	if bav.Handle == nil {
+		return nil, fmt.Errorf("BeginViewTx: View has no DB handle")
+	}
+	if bav.viewTx != nil {
+		return nil, fmt.Errorf("BeginViewTx: View is already in a view transaction")
+	}
+	bav.viewTx = &ViewTx{
+		view: bav,
+		txn:  bav.Handle.NewTransaction(false),
+	}
+	return bav.viewTx, nil
+}
+
+// Discard ends the read transaction and unpins it from the view. It's safe to call more than once.
+func (viewTx *ViewTx) Discard() {
+	if viewTx.view.viewTx == viewTx {
+		viewTx.view.viewTx = nil
+	}
+	viewTx.txn.Discard()
+}
+
+// RunInViewTx calls fn with a read transaction pinned to the view, so that the getters fn calls on the view
+// observe the same snapshot of the DB.
+func (bav *UtxoView) RunInViewTx(fn func() error) error {
+	viewTx, err := bav.BeginViewTx()
+	if err != nil {
+		return err
+	}
+	defer viewTx.Discard()
+	return fn()
+}
+
+// viewDB calls fn with the read transaction of the view's ViewTx, or with a new read transaction if the view isn't
+// in one. Reads in a ViewTx are passed a nil snapshot so that they skip the snapshot's caches.
+func (bav *UtxoView) viewDB(fn func(txn *badger.Txn, snap *Snapshot) error) error {
+	if bav.viewTx != nil {
+		return fn(bav.viewTx.txn, nil)
+	}
+	if bav.Handle == nil {
+		return fmt.Errorf("viewDB: View has no DB handle")
+	}
+	return bav.Handle.View(func(txn *badger.Txn) error {
+		return fn(txn, bav.Snapshot)
+	})
+}
@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestViewTx(t *testing.T) {
+	require := require.New(t)
+	setupTestDeSoEncoder(t)
+
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	params := NewTestParams(&DeSoTestnetParams)
+
+	pkid := NewPKID(m0PkBytes)
+	putState := func(username string, balanceNanos uint64) {
+		profileEntry := &ProfileEntry{PublicKey: m0PkBytes, Username: []byte(username)}
+		require.NoError(DBPutProfileEntryMappings(db, nil, 0, profileEntry, pkid, &params, nil))
+		require.NoError(DbPutDeSoBalanceForPublicKey(db, nil, m0PkBytes, balanceNanos, nil))
+		postEntry := &PostEntry{PostHash: &BlockHash{1}, PosterPublicKey: m0PkBytes, Body: []byte(username)}
+		require.NoError(DBPutPostEntryMappings(db, nil, 0, postEntry, &params, nil))
+	}
+	putState("alice", 100)
+
+	// A view in a view transaction reads the state as of when the transaction began, even if the getters are
+	// called after the state changes.
+	view := NewUtxoView(db, &params, nil, nil, nil)
+	viewTx, err := view.BeginViewTx()
+	require.NoError(err)
+	_, err = view.BeginViewTx()
+	require.Error(err)
+	putState("bob", 200)
+	require.Equal([]byte("alice"), view.GetProfileEntryForPKID(pkid).Username)
+	require.Equal([]byte("alice"), view.GetPostEntryForPostHash(&BlockHash{1}).Body)
+	balanceNanos, err := view.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(100), balanceNanos)
+	require.Nil(view.GetProfileEntryForUsername([]byte("bob")))
+	viewTx.Discard()
+	viewTx.Discard()
+
+	// A view that isn't in a view transaction reads the latest state.
+	view = NewUtxoView(db, &params, nil, nil, nil)
+	require.Equal([]byte("bob"), view.GetPostEntryForPostHash(&BlockHash{1}).Body)
+	require.NoError(view.RunInViewTx(func() error {
+		putState("carol", 300)
+		require.Equal([]byte("bob"), view.GetProfileEntryForPKID(pkid).Username)
+		balanceNanos, err = view.GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+		require.NoError(err)
+		require.Equal(uint64(200), balanceNanos)
+		return nil
+	}))
+	require.Nil(view.viewTx)
+	balanceNanos, err = NewUtxoView(db, &params, nil, nil, nil).GetDeSoBalanceNanosForPublicKey(m0PkBytes)
+	require.NoError(err)
+	require.Equal(uint64(300), balanceNanos)
+}
@@ -66,8 +66,8 @@ func main() {
 
 	messagesFromPeer := make(chan *lib.ServerMessage)
 	peer := lib.NewPeer(0, conn, true, netAddrss, true,
-		10000, 0, &lib.DeSoMainnetParams,
-		messagesFromPeer, nil, nil, lib.NodeSyncTypeAny, nil)
+		10000, 0, 0, nil, &lib.DeSoMainnetParams,
+		messagesFromPeer, nil, nil, lib.NodeSyncTypeAny, nil, lib.NewLogger(nil, lib.LogComponentPeer))
 	time.Sleep(1 * time.Second)
 	if err := peer.NegotiateVersion(lib.DeSoMainnetParams.VersionNegotiationTimeout); err != nil {
 		panic(err)